@@ -0,0 +1,194 @@
+package seb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// Checkpoint is the position of a consumer in a topic, committed together
+// with the idempotency token of the records that were processed up to it.
+type Checkpoint struct {
+	// Offset is the offset of the next record to process.
+	Offset uint64 `json:"offset"`
+
+	// Token is given by the consumer when committing, e.g. the ID of the
+	// result of processing the records up to Offset. It makes it possible for
+	// consumers to determine whether processing was completed before a
+	// crash, and therefore whether it must be done again.
+	Token string `json:"token"`
+}
+
+// CheckpointStore stores the checkpoints of a single consumer in a seb topic.
+// Each commit adds a record to the topic, and the newest record is the
+// consumer's current checkpoint.
+//
+// NOTE: checkpoint topics grow by one record per commit; it's recommended to
+// set a retention period for them.
+type CheckpointStore struct {
+	client    *RecordClient
+	topicName string
+}
+
+// NewCheckpointStore returns a CheckpointStore that stores checkpoints in
+// topicName. topicName must only be used by a single consumer.
+func NewCheckpointStore(client *RecordClient, topicName string) *CheckpointStore {
+	return &CheckpointStore{
+		client:    client,
+		topicName: topicName,
+	}
+}
+
+// Commit stores checkpoint as the consumer's current checkpoint.
+func (s *CheckpointStore) Commit(checkpoint Checkpoint) error {
+	bs, err := json.Marshal(checkpoint)
+	if err != nil {
+		return fmt.Errorf("encoding checkpoint: %w", err)
+	}
+
+	err = s.client.AddRecords(s.topicName, []uint32{uint32(len(bs))}, bs)
+	if err != nil {
+		return fmt.Errorf("adding checkpoint to '%s': %w", s.topicName, err)
+	}
+
+	return nil
+}
+
+// Latest returns the most recently committed checkpoint. If no checkpoint
+// has been committed, the zero Checkpoint and false is returned.
+func (s *CheckpointStore) Latest() (Checkpoint, bool, error) {
+	topic, err := s.client.GetTopic(s.topicName)
+	if errors.Is(err, seberr.ErrNotFound) {
+		return Checkpoint{}, false, nil
+	}
+	if err != nil {
+		return Checkpoint{}, false, fmt.Errorf("getting topic '%s': %w", s.topicName, err)
+	}
+
+	if topic.NextOffset == 0 {
+		return Checkpoint{}, false, nil
+	}
+
+	record, err := s.client.GetRecord(s.topicName, topic.NextOffset-1)
+	if err != nil {
+		return Checkpoint{}, false, fmt.Errorf("getting checkpoint from '%s': %w", s.topicName, err)
+	}
+
+	checkpoint := Checkpoint{}
+	err = json.Unmarshal(record, &checkpoint)
+	if err != nil {
+		return Checkpoint{}, false, fmt.Errorf("decoding checkpoint: %w", err)
+	}
+
+	return checkpoint, true, nil
+}
+
+// CheckpointedConsumer consumes records from a topic, committing its offset
+// together with an idempotency token after each batch of records has been
+// processed.
+//
+// Records are delivered at least once: if the consumer stops after records
+// were processed, but before the checkpoint was committed, they're delivered
+// again. Consumers that store the results of processing together with the
+// token, e.g. in the same database transaction, can compare it with the
+// token of the latest checkpoint in order to skip processing records whose
+// results are already stored, making processing effectively-once.
+type CheckpointedConsumer struct {
+	client      *RecordClient
+	topicName   string
+	checkpoints *CheckpointStore
+
+	checkpoint Checkpoint
+	loaded     bool
+
+	// offset is the offset to read from next. It's ahead of checkpoint.Offset
+	// when only skipped, e.g. expired, records were read since the latest
+	// commit.
+	offset uint64
+}
+
+// NewCheckpointedConsumer returns a CheckpointedConsumer that consumes
+// records from topicName, storing its checkpoints in checkpoints.
+func NewCheckpointedConsumer(client *RecordClient, topicName string, checkpoints *CheckpointStore) *CheckpointedConsumer {
+	return &CheckpointedConsumer{
+		client:      client,
+		topicName:   topicName,
+		checkpoints: checkpoints,
+	}
+}
+
+// Delivery is a batch of records given to the process function of
+// CheckpointedConsumer.Process.
+type Delivery struct {
+	Records [][]byte
+
+	// Offset is the offset that Records were read from.
+	Offset uint64
+
+	// NextOffset is the offset that is committed once the records have been
+	// processed.
+	NextOffset uint64
+
+	// Previous is the checkpoint that the records follow. Its Token is empty
+	// if no checkpoint has been committed yet.
+	Previous Checkpoint
+}
+
+// Process reads the records following the latest checkpoint and gives them
+// to process. If process succeeds, the checkpoint returned by process is
+// committed and the number of processed records is returned. If process
+// returns an error, no checkpoint is committed and the records are delivered
+// again by the next call to Process.
+//
+// If no records are available within input.Timeout, process isn't called and
+// 0 is returned.
+func (c *CheckpointedConsumer) Process(input GetRecordsInput, process func(delivery Delivery) (token string, err error)) (int, error) {
+	if !c.loaded {
+		checkpoint, _, err := c.checkpoints.Latest()
+		if err != nil {
+			return 0, fmt.Errorf("loading checkpoint: %w", err)
+		}
+		c.checkpoint = checkpoint
+		c.offset = checkpoint.Offset
+		c.loaded = true
+	}
+
+	records, nextOffset, err := c.client.GetRecordsNextOffset(c.topicName, c.offset, input)
+	if err != nil {
+		if errors.Is(err, seberr.ErrOffsetOutOfBounds) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("getting records: %w", err)
+	}
+	if len(records) == 0 {
+		c.offset = nextOffset
+		return 0, nil
+	}
+
+	token, err := process(Delivery{
+		Records:    records,
+		Offset:     c.offset,
+		NextOffset: nextOffset,
+		Previous:   c.checkpoint,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("processing records: %w", err)
+	}
+
+	checkpoint := Checkpoint{Offset: nextOffset, Token: token}
+	err = c.checkpoints.Commit(checkpoint)
+	if err != nil {
+		return 0, fmt.Errorf("committing checkpoint: %w", err)
+	}
+	c.checkpoint = checkpoint
+	c.offset = nextOffset
+
+	return len(records), nil
+}
+
+// Checkpoint returns the consumer's most recently committed checkpoint.
+func (c *CheckpointedConsumer) Checkpoint() Checkpoint {
+	return c.checkpoint
+}
@@ -0,0 +1,143 @@
+package seb_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	seb "github.com/micvbang/simple-event-broker"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCheckpointStoreLatest verifies that CheckpointStore.Latest returns the
+// most recently committed checkpoint, and false when no checkpoint has been
+// committed.
+func TestCheckpointStoreLatest(t *testing.T) {
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	store := seb.NewCheckpointStore(client, "checkpoints")
+
+	_, ok, err := store.Latest()
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	for i := range uint64(3) {
+		expected := seb.Checkpoint{Offset: i * 10, Token: fmt.Sprintf("token-%d", i)}
+
+		// Act
+		err = store.Commit(expected)
+		require.NoError(t, err)
+
+		// Assert
+		got, ok, err := store.Latest()
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, expected, got)
+	}
+}
+
+// TestCheckpointedConsumerProcess verifies that CheckpointedConsumer delivers
+// all records of a topic, commits the token returned by the process function,
+// and that a new consumer using the same checkpoint store continues from the
+// latest checkpoint.
+func TestCheckpointedConsumerProcess(t *testing.T) {
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	const topicName = "topic"
+	batch := tester.MakeRandomRecordBatch(10)
+	err = client.AddRecords(topicName, batch.Sizes, batch.Data)
+	require.NoError(t, err)
+
+	input := seb.GetRecordsInput{MaxRecords: 4, Timeout: 10 * time.Millisecond}
+	store := seb.NewCheckpointStore(client, "checkpoints")
+	consumer := seb.NewCheckpointedConsumer(client, topicName, store)
+
+	gotRecords := [][]byte{}
+	process := func(delivery seb.Delivery) (string, error) {
+		require.Equal(t, uint64(len(gotRecords)), delivery.Offset)
+		gotRecords = append(gotRecords, delivery.Records...)
+		return fmt.Sprintf("token-%d", delivery.NextOffset), nil
+	}
+
+	// Act
+	n, err := consumer.Process(input, process)
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, 4, n)
+	require.Equal(t, seb.Checkpoint{Offset: 4, Token: "token-4"}, consumer.Checkpoint())
+
+	// new consumer continues from the latest checkpoint
+	consumer = seb.NewCheckpointedConsumer(client, topicName, store)
+	for {
+		n, err := consumer.Process(input, func(delivery seb.Delivery) (string, error) {
+			if delivery.Offset == 4 {
+				require.Equal(t, "token-4", delivery.Previous.Token)
+			}
+			return process(delivery)
+		})
+		require.NoError(t, err)
+		if n == 0 {
+			break
+		}
+	}
+
+	require.Equal(t, batch.IndividualRecords(), gotRecords)
+
+	checkpoint, ok, err := store.Latest()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, seb.Checkpoint{Offset: 10, Token: "token-10"}, checkpoint)
+}
+
+// TestCheckpointedConsumerProcessError verifies that no checkpoint is
+// committed when the process function returns an error, such that the records
+// are delivered again.
+func TestCheckpointedConsumerProcessError(t *testing.T) {
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	const topicName = "topic"
+	batch := tester.MakeRandomRecordBatch(3)
+	err = client.AddRecords(topicName, batch.Sizes, batch.Data)
+	require.NoError(t, err)
+
+	store := seb.NewCheckpointStore(client, "checkpoints")
+	consumer := seb.NewCheckpointedConsumer(client, topicName, store)
+	input := seb.GetRecordsInput{Timeout: 10 * time.Millisecond}
+
+	expectedErr := errors.New("processing failed")
+
+	// Act
+	_, err = consumer.Process(input, func(delivery seb.Delivery) (string, error) {
+		return "", expectedErr
+	})
+
+	// Assert
+	require.ErrorIs(t, err, expectedErr)
+
+	_, ok, err := store.Latest()
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	var redelivered [][]byte
+	_, err = consumer.Process(input, func(delivery seb.Delivery) (string, error) {
+		redelivered = delivery.Records
+		return "token", nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, batch.IndividualRecords(), redelivered)
+}
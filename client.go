@@ -2,6 +2,8 @@ package seb
 
 import (
 	"bytes"
+	"cmp"
+	"compress/gzip"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,11 +11,15 @@ import (
 	"mime"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/micvbang/go-helpy/sizey"
 	"github.com/micvbang/go-helpy/syncy"
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/retry"
 	"github.com/micvbang/simple-event-broker/internal/sebrecords"
 	"github.com/micvbang/simple-event-broker/seberr"
 )
@@ -23,20 +29,76 @@ type RecordClient struct {
 	bufPool *syncy.Pool[*bytes.Buffer]
 	baseURL *url.URL
 	apiKey  string
+
+	requestInterceptors []RequestInterceptor
+	recordInterceptors  []RecordInterceptor
+
+	requestTimeout time.Duration
+	retrier        *retry.Retrier
+
+	// requestEncodingUnsupported is set once the server has rejected a
+	// compressed request body, after which request bodies are sent
+	// uncompressed.
+	requestEncodingUnsupported atomic.Bool
+}
+
+type RecordClientOpts struct {
+	RequestInterceptors []RequestInterceptor
+	RecordInterceptors  []RecordInterceptor
+
+	// MaxIdleConnsPerHost is the number of idle connections to the broker
+	// that are kept for reuse. Defaults to 10.
+	MaxIdleConnsPerHost int
+
+	// MaxConnsPerHost limits the number of connections to the broker,
+	// including connections in use. Requests wait for a connection once it's
+	// reached. Defaults to 0, i.e. no limit.
+	MaxConnsPerHost int
+
+	// IdleConnTimeout is the amount of time after which idle connections are
+	// closed. Defaults to 1s.
+	IdleConnTimeout time.Duration
+
+	// RequestTimeout limits the time spent waiting for the response of each
+	// attempt of a request, i.e. until its headers have been received.
+	// GetRecords requests are given their wait timeout in addition; other
+	// requests that make the broker wait, e.g. ReadReplay, must be given
+	// enough time by RequestTimeout itself. Defaults to 0, i.e. no limit.
+	RequestTimeout time.Duration
+
+	// Retry configures retries of failed requests and the circuit breaker.
+	// See ClientRetryOpts.
+	Retry ClientRetryOpts
 }
 
 // NewRecordClient initializes and returns a *RecordClient.
-func NewRecordClient(baseURL string, apiKey string) (*RecordClient, error) {
+func NewRecordClient(baseURL string, apiKey string, optFuncs ...func(*RecordClientOpts)) (*RecordClient, error) {
 	bURL, err := url.Parse(baseURL)
 	if err != nil {
 		return nil, fmt.Errorf("parsing base url: %w", err)
 	}
 
+	opts := RecordClientOpts{
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     time.Second,
+		Retry: ClientRetryOpts{
+			MaxAttempts:     3,
+			BaseDelay:       50 * time.Millisecond,
+			MaxDelay:        time.Second,
+			BreakerFailures: 10,
+			BreakerCooldown: 5 * time.Second,
+		},
+	}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+
 	return &RecordClient{
 		client: &http.Client{
 			Transport: &http.Transport{
-				MaxIdleConnsPerHost: 10,
-				IdleConnTimeout:     time.Second,
+				MaxIdleConnsPerHost: opts.MaxIdleConnsPerHost,
+				MaxConnsPerHost:     opts.MaxConnsPerHost,
+				IdleConnTimeout:     opts.IdleConnTimeout,
 			},
 		},
 		baseURL: bURL,
@@ -44,36 +106,151 @@ func NewRecordClient(baseURL string, apiKey string) (*RecordClient, error) {
 		bufPool: syncy.NewPool(func() *bytes.Buffer {
 			return bytes.NewBuffer(make([]byte, 5*sizey.MB))
 		}),
+		requestInterceptors: opts.RequestInterceptors,
+		recordInterceptors:  opts.RecordInterceptors,
+		requestTimeout:      opts.RequestTimeout,
+		retrier:             retry.New(retry.Opts(opts.Retry), time.Now, nil),
 	}, nil
 }
 
 func (c *RecordClient) AddRecords(topicName string, recordSizes []uint32, recordsData []byte) error {
+	return c.AddRecordsWithExpiry(topicName, recordSizes, recordsData, nil)
+}
+
+// AddRecordsWithExpiry adds records to topicName, setting the time at which
+// each record expires. Expired records are skipped when reading records, and
+// are eventually deleted. A zero time.Time means that the record never
+// expires. If expires is empty, no records expire.
+func (c *RecordClient) AddRecordsWithExpiry(topicName string, recordSizes []uint32, recordsData []byte, expires []time.Time) error {
+	_, err := c.addRecords(topicName, recordSizes, recordsData, expires, "")
+	return err
+}
+
+type AddRecordsOutput struct {
+	Offsets []uint64 `json:"offsets"`
+
+	// BatchID and BatchKey identify the record batch that the records were
+	// committed in. BatchID is nil if the broker doesn't know it.
+	BatchID  *uint64 `json:"batch_id"`
+	BatchKey string  `json:"batch_key"`
+
+	// BatchWaitUs is the number of microseconds that the records waited for
+	// their batch to be committed, and CommitLatencyUs the total number of
+	// microseconds that the broker spent adding them.
+	BatchWaitUs     int64 `json:"batch_wait_us"`
+	CommitLatencyUs int64 `json:"commit_latency_us"`
+
+	// Duplicate is true if the broker deduplicates batches and the records
+	// weren't added because an identical batch was added recently, e.g. by a
+	// request that was retried after its response was lost. Offsets are then
+	// those of that batch.
+	Duplicate bool `json:"duplicate"`
+}
+
+// AddRecordsWithOutput is the same as AddRecords, but returns the offsets of
+// the added records, the record batch they were committed in, and the time
+// that the broker spent committing them. This allows producers to monitor the
+// latency added by the broker, and to correlate records with storage objects.
+func (c *RecordClient) AddRecordsWithOutput(topicName string, recordSizes []uint32, recordsData []byte) (AddRecordsOutput, error) {
+	return c.addRecords(topicName, recordSizes, recordsData, nil, "")
+}
+
+// addRecords adds records to topicName. If encoding is "gzip", the request
+// body is compressed, unless the server has previously rejected a compressed
+// request body; if the server rejects it, the request is retried
+// uncompressed.
+func (c *RecordClient) addRecords(topicName string, recordSizes []uint32, recordsData []byte, expires []time.Time, encoding string) (AddRecordsOutput, error) {
+	output := AddRecordsOutput{}
+
+	var expiresUs []int64
+	if len(expires) > 0 {
+		expiresUs = make([]int64, len(expires))
+		for i, expiresAt := range expires {
+			if !expiresAt.IsZero() {
+				expiresUs[i] = expiresAt.UnixMicro()
+			}
+		}
+	}
+
+	recordSizes, recordsData, err := c.interceptProduce(topicName, recordSizes, recordsData)
+	if err != nil {
+		return output, err
+	}
+
 	buf := bytes.NewBuffer(make([]byte, 0, len(recordsData)+4096))
-	contentType, err := httphelpers.RecordsToMultipartFormData(buf, recordSizes, recordsData)
+	contentType, err := httphelpers.RecordsWithExpiresToMultipartFormData(buf, recordSizes, recordsData, expiresUs)
 	if err != nil {
-		return err
+		return output, err
+	}
+
+	if c.requestEncodingUnsupported.Load() {
+		encoding = ""
+	}
+
+	output, err = c.postRecords(topicName, contentType, buf.Bytes(), encoding)
+	if encoding != "" && errors.Is(err, httphelpers.ErrUnsupportedEncoding) {
+		c.requestEncodingUnsupported.Store(true)
+		output, err = c.postRecords(topicName, contentType, buf.Bytes(), "")
+	}
+
+	return output, err
+}
+
+// postRecords sends body, the multipart form data of records, to topicName,
+// compressing it using encoding if it isn't "". An error wrapping
+// httphelpers.ErrUnsupportedEncoding is returned if the server doesn't accept
+// the encoding.
+func (c *RecordClient) postRecords(topicName string, contentType string, body []byte, encoding string) (AddRecordsOutput, error) {
+	output := AddRecordsOutput{}
+
+	if encoding != "" {
+		buf := bytes.NewBuffer(make([]byte, 0, len(body)/2))
+		gw := gzip.NewWriter(buf)
+		_, err := gw.Write(body)
+		if err != nil {
+			return output, fmt.Errorf("compressing request body: %w", err)
+		}
+		err = gw.Close()
+		if err != nil {
+			return output, fmt.Errorf("compressing request body: %w", err)
+		}
+		body = buf.Bytes()
 	}
 
-	req, err := c.request("POST", "/records", buf)
+	req, err := c.request("POST", "/records", bytes.NewReader(body))
 	if err != nil {
-		return fmt.Errorf("creating request: %w", err)
+		return output, fmt.Errorf("creating request: %w", err)
 	}
 	req.Header.Add("Content-Type", contentType)
+	if encoding != "" {
+		req.Header.Add("Content-Encoding", encoding)
+	}
+	req.Header.Add(httphelpers.ProducedAtHeader, time.Now().Format(time.RFC3339Nano))
 	httphelpers.AddQueryParams(req, map[string]string{"topic-name": topicName})
 
-	res, err := c.client.Do(req)
+	res, err := c.do(req)
 	if err != nil {
-		return fmt.Errorf("sending request: %w", err)
+		return output, fmt.Errorf("sending request: %w", err)
 	}
 	defer res.Body.Close()
-	io.Copy(io.Discard, res.Body)
 
-	err = c.statusCode(res.StatusCode)
+	defer io.Copy(io.Discard, res.Body)
+
+	if encoding != "" && res.StatusCode == http.StatusUnsupportedMediaType {
+		return output, fmt.Errorf("%w '%s': %w", httphelpers.ErrUnsupportedEncoding, encoding, c.statusCode(res))
+	}
+
+	err = c.statusCode(res)
 	if err != nil {
-		return err
+		return output, err
 	}
 
-	return nil
+	err = json.NewDecoder(res.Body).Decode(&output)
+	if err != nil {
+		return output, fmt.Errorf("decoding json: %w", err)
+	}
+
+	return output, nil
 }
 
 func (c *RecordClient) GetRecord(topicName string, offset uint64) ([]byte, error) {
@@ -87,13 +264,13 @@ func (c *RecordClient) GetRecord(topicName string, offset uint64) ([]byte, error
 		"offset":     fmt.Sprintf("%d", offset),
 	})
 
-	res, err := c.client.Do(req)
+	res, err := c.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("sending request: %w", err)
 	}
 	defer res.Body.Close()
 
-	err = c.statusCode(res.StatusCode)
+	err = c.statusCode(res)
 	if err != nil {
 		return nil, err
 	}
@@ -103,13 +280,32 @@ func (c *RecordClient) GetRecord(topicName string, offset uint64) ([]byte, error
 		return nil, fmt.Errorf("reading body: %w", err)
 	}
 
-	return buf, nil
+	records := [][]byte{buf}
+	err = c.interceptConsume(topicName, records)
+	if err != nil {
+		return nil, err
+	}
+
+	return records[0], nil
 }
 
 type GetTopicOutput struct {
 	Name           string
 	NextOffset     uint64    `json:"next_offset"`
 	LastInsertTime time.Time `json:"latest_commit_at"`
+
+	// LastProducedTime is the time at which the records of the latest record
+	// batch were produced. It's the zero time.Time if unknown.
+	LastProducedTime time.Time `json:"latest_produced_at"`
+
+	// ClockDriftUs is how far the commit time of the latest record batch is
+	// ahead of the broker's wall clock, in microseconds. It's only positive
+	// after the broker's wall clock has gone backwards.
+	ClockDriftUs int64 `json:"clock_drift_us"`
+
+	// Sealed is true if the topic has been permanently closed for writes, in
+	// which case NextOffset is its final next offset. See SealTopic.
+	Sealed bool `json:"sealed"`
 }
 
 func (c *RecordClient) GetTopic(topicName string) (GetTopicOutput, error) {
@@ -124,13 +320,13 @@ func (c *RecordClient) GetTopic(topicName string) (GetTopicOutput, error) {
 		"topic-name": topicName,
 	})
 
-	res, err := c.client.Do(req)
+	res, err := c.do(req)
 	if err != nil {
 		return topic, fmt.Errorf("sending request: %w", err)
 	}
 	defer res.Body.Close()
 
-	err = c.statusCode(res.StatusCode)
+	err = c.statusCode(res)
 	if err != nil {
 		return topic, err
 	}
@@ -143,118 +339,1353 @@ func (c *RecordClient) GetTopic(topicName string) (GetTopicOutput, error) {
 	return topic, nil
 }
 
-type GetRecordsInput struct {
-	// MaxRecords is the maximum number of records to return. Defaults to 10
-	MaxRecords int
+type BatchInfo struct {
+	BaseOffset  uint64    `json:"base_offset"`
+	NumRecords  uint64    `json:"num_records"`
+	CommittedAt time.Time `json:"committed_at"`
 
-	// Buffer is used as the backing storage for the returned records, and
-	// therefore limits how many bytes are requested.
-	//
-	// NOTE: since this will be the backing storage for the returned records
-	// (slice-of-byte-slices), it therefore must not be reused until the records
-	// are not used anymore.
-	//
-	// Defaults to 1 MiB.
-	Buffer []byte
+	// ProducedAt is the time at which the oldest records of the batch were
+	// produced. It's the zero time.Time if unknown.
+	ProducedAt time.Time `json:"produced_at"`
+}
 
-	// Timeout is the amount of time to allow the server (on the server side) to
-	// collect records for. If this timeout is exceeded, the number of records
-	// collected so far will be returned. Defaults to 10s.
-	Timeout time.Duration
+// GetBatchInfo returns information about the batch of topicName that holds
+// offset, including the times at which its records were produced and
+// committed. This makes it possible to measure end-to-end latency, and to
+// find the records of a given point in time. seberr.ErrNotFound is returned if
+// offset does not exist.
+func (c *RecordClient) GetBatchInfo(topicName string, offset uint64) (BatchInfo, error) {
+	req, err := c.request("GET", "/topic/batch", nil)
+	if err != nil {
+		return BatchInfo{}, fmt.Errorf("creating request: %w", err)
+	}
+
+	httphelpers.AddQueryParams(req, map[string]string{
+		"topic-name": topicName,
+		"offset":     fmt.Sprintf("%d", offset),
+	})
+
+	res, err := c.do(req)
+	if err != nil {
+		return BatchInfo{}, fmt.Errorf("sending request: %w", err)
+	}
+	defer res.Body.Close()
+
+	err = c.statusCode(res)
+	if err != nil {
+		return BatchInfo{}, err
+	}
+
+	info := BatchInfo{}
+	err = json.NewDecoder(res.Body).Decode(&info)
+	if err != nil {
+		return BatchInfo{}, fmt.Errorf("decoding json: %w", err)
+	}
+
+	return info, nil
 }
 
-const multipartFormData = "multipart/form-data"
+// CreateTopic creates topicName. It returns seberr.ErrTopicAlreadyExists if
+// topicName already exists.
+func (c *RecordClient) CreateTopic(topicName string) error {
+	return c.topicRequest("POST", topicName)
+}
 
-func (c *RecordClient) GetRecords(topicName string, offset uint64, input GetRecordsInput) ([][]byte, error) {
-	if input.MaxRecords == 0 {
-		input.MaxRecords = 10
+// DeleteTopic deletes topicName, including all of its records. It returns
+// seberr.ErrNotFound if topicName does not exist.
+func (c *RecordClient) DeleteTopic(topicName string) error {
+	return c.topicRequest("DELETE", topicName)
+}
+
+// SealTopic permanently closes topicName for writes, and returns its final
+// next offset. Records added to topicName afterwards are rejected with
+// seberr.ErrTopicSealed. It returns seberr.ErrNotFound if topicName does not
+// exist.
+func (c *RecordClient) SealTopic(topicName string) (uint64, error) {
+	req, err := c.request("POST", "/admin/topic/seal", nil)
+	if err != nil {
+		return 0, fmt.Errorf("creating request: %w", err)
 	}
 
-	if input.Buffer == nil {
-		input.Buffer = make([]byte, 0, sizey.MB)
+	httphelpers.AddQueryParams(req, map[string]string{
+		"topic-name": topicName,
+	})
+
+	res, err := c.do(req)
+	if err != nil {
+		return 0, fmt.Errorf("sending request: %w", err)
 	}
+	defer res.Body.Close()
 
-	req, err := c.request("GET", "/records", nil)
+	err = c.statusCode(res)
 	if err != nil {
-		return nil, fmt.Errorf("creating request: %w", err)
+		return 0, err
+	}
+
+	output := struct {
+		NextOffset uint64 `json:"next_offset"`
+	}{}
+	err = json.NewDecoder(res.Body).Decode(&output)
+	if err != nil {
+		return 0, fmt.Errorf("decoding json: %w", err)
+	}
+
+	return output.NextOffset, nil
+}
+
+func (c *RecordClient) topicRequest(method string, topicName string) error {
+	req, err := c.request(method, "/topic", nil)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
 	}
-	req.Header.Add("Accept", "multipart/form-data")
 
 	httphelpers.AddQueryParams(req, map[string]string{
-		"topic-name":  topicName,
-		"offset":      fmt.Sprintf("%d", offset),
-		"max-records": fmt.Sprintf("%d", input.MaxRecords),
-		"max-bytes":   fmt.Sprintf("%d", cap(input.Buffer)),
+		"topic-name": topicName,
 	})
 
-	if input.Timeout != 0 {
-		httphelpers.AddQueryParams(req, map[string]string{
-			"timeout": input.Timeout.String(),
-		})
+	res, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("sending request: %w", err)
+	}
+	defer res.Body.Close()
+
+	return c.statusCode(res)
+}
+
+// ListTopics returns the names of the topics that were created or used since
+// the broker started.
+func (c *RecordClient) ListTopics() ([]string, error) {
+	req, err := c.request("GET", "/topics", nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
 	}
 
-	res, err := c.client.Do(req)
+	res, err := c.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("sending request: %w", err)
 	}
 	defer res.Body.Close()
 
-	err = c.statusCode(res.StatusCode)
+	err = c.statusCode(res)
 	if err != nil {
 		return nil, err
 	}
 
-	mediaType, params, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	output := struct {
+		TopicNames []string `json:"topic_names"`
+	}{}
+	err = json.NewDecoder(res.Body).Decode(&output)
 	if err != nil {
-		return nil, fmt.Errorf("parsing media type: %w", err)
+		return nil, fmt.Errorf("decoding json: %w", err)
 	}
-	if mediaType != multipartFormData {
-		return nil, fmt.Errorf("expected mediatype '%s', got '%s'", multipartFormData, mediaType)
+
+	return output.TopicNames, nil
+}
+
+type BulkTopicsInput struct {
+	// Pattern and Labels select the topics to operate on; topics must match
+	// both. Pattern uses the syntax of path.Match, e.g. "orders-*". At least
+	// one of them must be given; use "*" to select all topics.
+	Pattern string            `json:"pattern"`
+	Labels  map[string]string `json:"labels,omitempty"`
+
+	// Operation is one of "freeze", "unfreeze", "delete", "set_retention" and
+	// "set_labels".
+	Operation string `json:"operation"`
+
+	// Retention is used by "set_retention". 0 disables retention.
+	Retention time.Duration `json:"-"`
+
+	// SetLabels is used by "set_labels". Labels with an empty value are
+	// removed.
+	SetLabels map[string]string `json:"set_labels,omitempty"`
+
+	// DryRun lists the selected topics without applying the operation.
+	DryRun bool `json:"dry_run"`
+}
+
+type BulkTopicsOutput struct {
+	DryRun     bool              `json:"dry_run"`
+	TopicNames []string          `json:"topic_names"`
+	Errors     map[string]string `json:"errors"`
+}
+
+// BulkTopics applies an operation to all topics selected by input. Topics for
+// which the operation failed are listed in BulkTopicsOutput.Errors.
+func (c *RecordClient) BulkTopics(input BulkTopicsInput) (BulkTopicsOutput, error) {
+	output := BulkTopicsOutput{}
+
+	body, err := json.Marshal(struct {
+		BulkTopicsInput
+		Retention string `json:"retention"`
+	}{
+		BulkTopicsInput: input,
+		Retention:       input.Retention.String(),
+	})
+	if err != nil {
+		return output, fmt.Errorf("encoding json: %w", err)
 	}
 
-	batch := sebrecords.NewBatch(make([]uint32, 0, input.MaxRecords), input.Buffer)
-	err = httphelpers.MultipartFormDataToRecords(res.Body, params["boundary"], &batch)
+	req, err := c.request("POST", "/admin/topics/bulk", bytes.NewReader(body))
 	if err != nil {
-		// NOTE: when partial content is received the request was accepted by
-		// the server, and the ErrBadInput error is just telling us that there's
-		// no data in the response.
-		if res.StatusCode == http.StatusPartialContent && errors.Is(err, seberr.ErrBadInput) {
-			return batch.IndividualRecords(), nil
-		}
+		return output, fmt.Errorf("creating request: %w", err)
+	}
+
+	res, err := c.do(req)
+	if err != nil {
+		return output, fmt.Errorf("sending request: %w", err)
+	}
+	defer res.Body.Close()
+
+	err = c.statusCode(res)
+	if err != nil {
+		return output, err
+	}
 
-		return nil, fmt.Errorf("parsing multipart form data: %w", err)
+	err = json.NewDecoder(res.Body).Decode(&output)
+	if err != nil {
+		return output, fmt.Errorf("decoding json: %w", err)
 	}
-	return batch.IndividualRecords(), nil
+
+	return output, nil
 }
 
-// CloseIdleConnections closes unused, idle connections on the underlying
-// http.Client.
-func (c *RecordClient) CloseIdleConnections() {
-	c.client.CloseIdleConnections()
+// TopicSpec declares a topic and its configuration. See ProvisionTopics.
+//
+// TopicSpec is encoded as JSON with Retention in the format understood by
+// time.ParseDuration, e.g. {"name": "orders", "retention": "24h"}.
+type TopicSpec struct {
+	Name string `json:"name"`
+
+	// Retention is the retention of the topic. 0 disables retention.
+	Retention time.Duration `json:"-"`
+
+	// Labels are the labels of the topic. Labels that the topic has, but
+	// which aren't given, are removed.
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
-func (c *RecordClient) statusCode(statusCode int) error {
-	switch statusCode {
-	case http.StatusUnauthorized:
-		return fmt.Errorf("status code %d: %w", statusCode, seberr.ErrNotAuthorized)
-	case http.StatusNotFound:
-		return fmt.Errorf("status code %d: %w", statusCode, seberr.ErrNotFound)
-	case http.StatusRequestEntityTooLarge:
-		return fmt.Errorf("status code %d: %w", statusCode, seberr.ErrPayloadTooLarge)
-	default:
-		return nil
+type topicSpecJSON struct {
+	Name      string            `json:"name"`
+	Retention string            `json:"retention,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+func (t TopicSpec) MarshalJSON() ([]byte, error) {
+	spec := topicSpecJSON{Name: t.Name, Labels: t.Labels}
+	if t.Retention != 0 {
+		spec.Retention = t.Retention.String()
 	}
+	return json.Marshal(spec)
 }
 
-func (c *RecordClient) request(method string, path string, body io.Reader) (*http.Request, error) {
-	url := c.baseURL.JoinPath(path)
+func (t *TopicSpec) UnmarshalJSON(data []byte) error {
+	spec := topicSpecJSON{}
+	err := json.Unmarshal(data, &spec)
+	if err != nil {
+		return err
+	}
 
-	req, err := http.NewRequest(method, url.String(), body)
+	retention := time.Duration(0)
+	if spec.Retention != "" {
+		retention, err = time.ParseDuration(spec.Retention)
+		if err != nil {
+			return fmt.Errorf("parsing retention of topic '%s': %w", spec.Name, err)
+		}
+	}
+
+	*t = TopicSpec{Name: spec.Name, Retention: retention, Labels: spec.Labels}
+	return nil
+}
+
+type ProvisionTopicsInput struct {
+	Topics []TopicSpec `json:"topics"`
+
+	// Prune deletes topics that aren't declared in Topics. Internal topics
+	// are never deleted.
+	Prune bool `json:"prune"`
+
+	// DryRun reports the changes that would be made without making them.
+	DryRun bool `json:"dry_run"`
+}
+
+type ProvisionTopicsOutput struct {
+	DryRun    bool              `json:"dry_run"`
+	Created   []string          `json:"created"`
+	Updated   []string          `json:"updated"`
+	Unchanged []string          `json:"unchanged"`
+	Deleted   []string          `json:"deleted"`
+	Errors    map[string]string `json:"errors"`
+}
+
+// ProvisionTopics reconciles the broker's topics with the topics declared in
+// input: missing topics are created, the configuration of existing topics is
+// updated and, if input.Prune is true, undeclared topics are deleted. Topics
+// that failed to be reconciled are listed in ProvisionTopicsOutput.Errors.
+// seberr.ErrBadInput is returned without making any changes if input is
+// invalid.
+func (c *RecordClient) ProvisionTopics(input ProvisionTopicsInput) (ProvisionTopicsOutput, error) {
+	output := ProvisionTopicsOutput{}
+
+	body, err := json.Marshal(input)
+	if err != nil {
+		return output, fmt.Errorf("encoding json: %w", err)
+	}
+
+	req, err := c.request("PUT", "/admin/topics", bytes.NewReader(body))
+	if err != nil {
+		return output, fmt.Errorf("creating request: %w", err)
+	}
+
+	res, err := c.do(req)
+	if err != nil {
+		return output, fmt.Errorf("sending request: %w", err)
+	}
+	defer res.Body.Close()
+
+	err = c.statusCode(res)
+	if err != nil {
+		return output, err
+	}
+
+	err = json.NewDecoder(res.Body).Decode(&output)
+	if err != nil {
+		return output, fmt.Errorf("decoding json: %w", err)
+	}
+
+	return output, nil
+}
+
+// TraceIDHeader is the header from which the broker reads the trace ID of
+// produce requests. It can be set using a RequestInterceptor, and the trace IDs
+// are returned by GetTopicSegmentsWithTraces.
+const TraceIDHeader = httphelpers.TraceIDHeader
+
+type TopicSegment struct {
+	BaseOffset uint64 `json:"base_offset"`
+	NumRecords uint64 `json:"num_records"`
+	Size       int64  `json:"size"`
+	StorageKey string `json:"storage_key"`
+
+	// Traces is only set by GetTopicSegmentsWithTraces.
+	Traces []TopicSegmentTrace `json:"traces"`
+}
+
+// TopicSegmentTrace is the trace ID of the produce request that added
+// NumRecords records starting at StartOffset.
+type TopicSegmentTrace struct {
+	TraceID     string `json:"trace_id"`
+	StartOffset uint64 `json:"start_offset"`
+	NumRecords  uint64 `json:"num_records"`
+}
+
+// GetTopicSegments returns the record batch files that make up topicName. This
+// allows external tools to read record batches directly from backing storage,
+// e.g. S3, without going through the broker.
+func (c *RecordClient) GetTopicSegments(topicName string) ([]TopicSegment, error) {
+	return c.getTopicSegments(topicName, false)
+}
+
+// GetTopicSegmentsWithTraces returns the same as GetTopicSegments, but also
+// the trace IDs that were given when adding the records of each segment.
+// NOTE: this requires the broker to read all segments of topicName.
+func (c *RecordClient) GetTopicSegmentsWithTraces(topicName string) ([]TopicSegment, error) {
+	return c.getTopicSegments(topicName, true)
+}
+
+func (c *RecordClient) getTopicSegments(topicName string, traces bool) ([]TopicSegment, error) {
+	req, err := c.request("GET", "/topic/segments", nil)
 	if err != nil {
 		return nil, fmt.Errorf("creating request: %w", err)
 	}
 
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
+	httphelpers.AddQueryParams(req, map[string]string{
+		"topic-name": topicName,
+		"traces":     strconv.FormatBool(traces),
+	})
 
-	return req, nil
+	res, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("sending request: %w", err)
+	}
+	defer res.Body.Close()
+
+	err = c.statusCode(res)
+	if err != nil {
+		return nil, err
+	}
+
+	output := struct {
+		Segments []TopicSegment `json:"segments"`
+	}{}
+	err = json.NewDecoder(res.Body).Decode(&output)
+	if err != nil {
+		return nil, fmt.Errorf("decoding json: %w", err)
+	}
+
+	return output.Segments, nil
+}
+
+type GetRecordsInput struct {
+	// MaxRecords is the maximum number of records to return. Defaults to 10.
+	// The broker rejects requests for more records than fit in its batches
+	// with seberr.ErrBadInput.
+	MaxRecords int
+
+	// Buffer is used as the backing storage for the returned records, and
+	// therefore limits how many bytes are requested.
+	//
+	// NOTE: since this will be the backing storage for the returned records
+	// (slice-of-byte-slices), it therefore must not be reused until the records
+	// are not used anymore.
+	//
+	// Defaults to 1 MiB.
+	Buffer []byte
+
+	// MaxResponseBytes makes the server limit the size of the response body,
+	// including the encoding of the records, instead of only the size of the
+	// record data. This allows responses to be kept below the body size limits
+	// of e.g. proxies. Like the limit given by Buffer, it's a soft limit: at
+	// least one record is returned. Ignored if 0.
+	MaxResponseBytes int
+
+	// Timeout is the amount of time to allow the server (on the server side) to
+	// collect records for. If this timeout is exceeded, the number of records
+	// collected so far will be returned. Defaults to 10s, and must be at most
+	// 5m.
+	Timeout time.Duration
+
+	// NonBlocking makes the server respond immediately if offset has not yet
+	// been produced, instead of waiting for it until Timeout. In this case,
+	// seberr.ErrOffsetOutOfBounds is returned together with the topic's next
+	// offset.
+	NonBlocking bool
+
+	// Key makes the server only return records with the given key. Records
+	// that are filtered out are skipped, and are accounted for by the next
+	// offset returned by GetRecordsNextOffset. Ignored if empty.
+	Key string
+
+	// Headers makes the server only return records that have all of the given
+	// headers.
+	Headers map[string]string
+
+	// Group is the consumer group that records are read on behalf of. If
+	// delivery to the group is paused, seberr.ErrGroupPaused is returned.
+	// Ignored if empty.
+	Group string
+}
+
+const multipartFormData = "multipart/form-data"
+
+func (c *RecordClient) GetRecords(topicName string, offset uint64, input GetRecordsInput) ([][]byte, error) {
+	records, _, err := c.GetRecordsNextOffset(topicName, offset, input)
+	return records, err
+}
+
+// GetRecordsNextOffset works like GetRecords, but additionally returns the
+// offset to request next in order to continue reading topicName. This differs
+// from offset+len(records) when records were skipped, e.g. because they
+// expired.
+func (c *RecordClient) GetRecordsNextOffset(topicName string, offset uint64, input GetRecordsInput) ([][]byte, uint64, error) {
+	records, nextOffset, _, err := c.getRecords(topicName, map[string]string{
+		"topic-name": topicName,
+		"offset":     fmt.Sprintf("%d", offset),
+	}, offset, "", input, nil)
+	return records, nextOffset, err
+}
+
+// ReadStats accounts for the records read by the server in response to a
+// call to GetRecordsStats, allowing consumers to tune their GetRecordsInput.
+type ReadStats struct {
+	// RecordsReturned and BytesReturned are the number of records returned
+	// and their bytes.
+	RecordsReturned int
+	BytesReturned   int
+
+	// RecordsScanned and BytesScanned are the number of records read by the
+	// server and their bytes, including records that were skipped, e.g.
+	// because they had expired.
+	RecordsScanned int
+	BytesScanned   int
+
+	// StopReason is the reason that the server stopped reading records; one
+	// of "end", "max-records", "max-bytes" and "deadline". Empty if not
+	// given by the server.
+	StopReason string
+}
+
+// GetRecordsStats works like GetRecords, but additionally returns the
+// accounting of the records read by the server, e.g. in order to tell whether
+// MaxRecords or Buffer limited the number of records returned.
+func (c *RecordClient) GetRecordsStats(topicName string, offset uint64, input GetRecordsInput) ([][]byte, ReadStats, error) {
+	stats := ReadStats{}
+	records, _, _, err := c.getRecords(topicName, map[string]string{
+		"topic-name": topicName,
+		"offset":     fmt.Sprintf("%d", offset),
+	}, offset, "", input, &stats)
+	return records, stats, err
+}
+
+// GetRecordsCursor works like GetRecords, but additionally returns an opaque
+// cursor that can be given to GetRecordsFromCursor in order to continue
+// reading topicName from where this call stopped.
+func (c *RecordClient) GetRecordsCursor(topicName string, offset uint64, input GetRecordsInput) ([][]byte, string, error) {
+	records, _, nextCursor, err := c.getRecords(topicName, map[string]string{
+		"topic-name": topicName,
+		"offset":     fmt.Sprintf("%d", offset),
+	}, offset, "", input, nil)
+	return records, nextCursor, err
+}
+
+// GetRecordsFromCursor returns records of topicName starting from cursor, as
+// returned by GetRecordsCursor or GetRecordsFromCursor, along with the cursor
+// to continue reading from. The key and headers of input override those that
+// cursor was created with. If an error is returned, the returned cursor is
+// cursor.
+func (c *RecordClient) GetRecordsFromCursor(topicName string, cursor string, input GetRecordsInput) ([][]byte, string, error) {
+	records, _, nextCursor, err := c.getRecords(topicName, map[string]string{
+		"topic-name": topicName,
+		"cursor":     cursor,
+	}, 0, cursor, input, nil)
+	return records, nextCursor, err
+}
+
+// getRecords requests records of topicName using query, which must give the
+// position to read from. offset and cursor are returned as the next offset and
+// cursor if the response doesn't give them. If stats is non-nil, it's set to
+// the ReadStats of the response.
+func (c *RecordClient) getRecords(topicName string, query map[string]string, offset uint64, cursor string, input GetRecordsInput, stats *ReadStats) ([][]byte, uint64, string, error) {
+	if input.MaxRecords == 0 {
+		input.MaxRecords = 10
+	}
+
+	if input.Buffer == nil {
+		input.Buffer = make([]byte, 0, sizey.MB)
+	}
+
+	req, err := c.request("GET", "/records", nil)
+	if err != nil {
+		return nil, offset, cursor, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Add("Accept", "multipart/form-data")
+
+	httphelpers.AddQueryParams(req, query)
+	maxBytes := cap(input.Buffer)
+	if input.MaxResponseBytes > 0 {
+		maxBytes = min(maxBytes, input.MaxResponseBytes)
+		httphelpers.AddQueryParams(req, map[string]string{
+			"max-bytes-wire": "true",
+		})
+	}
+	httphelpers.AddQueryParams(req, map[string]string{
+		"max-records": fmt.Sprintf("%d", input.MaxRecords),
+		"max-bytes":   fmt.Sprintf("%d", maxBytes),
+	})
+
+	if input.Timeout != 0 {
+		httphelpers.AddQueryParams(req, map[string]string{
+			"timeout": input.Timeout.String(),
+		})
+	}
+
+	// NOTE: the broker waits for records for up to 10s by default.
+	waitTimeout := cmp.Or(input.Timeout, 10*time.Second)
+	if input.NonBlocking {
+		waitTimeout = 0
+		httphelpers.AddQueryParams(req, map[string]string{
+			"non-blocking": "true",
+		})
+	}
+	req = withWaitTimeout(req, waitTimeout)
+
+	if input.Key != "" {
+		httphelpers.AddQueryParams(req, map[string]string{
+			"key": input.Key,
+		})
+	}
+
+	for name, value := range input.Headers {
+		httphelpers.AddQueryParams(req, map[string]string{
+			"header": name + ":" + value,
+		})
+	}
+
+	if input.Group != "" {
+		httphelpers.AddQueryParams(req, map[string]string{
+			"group": input.Group,
+		})
+	}
+
+	res, err := c.do(req)
+	if err != nil {
+		return nil, offset, cursor, fmt.Errorf("sending request: %w", err)
+	}
+	defer res.Body.Close()
+
+	nextOffset := offset
+	if nextOffsetHeader := res.Header.Get("Next-Offset"); nextOffsetHeader != "" {
+		nextOffset, err = strconv.ParseUint(nextOffsetHeader, 10, 64)
+		if err != nil {
+			return nil, offset, cursor, fmt.Errorf("parsing Next-Offset header: %w", err)
+		}
+	}
+
+	nextCursor := cursor
+	if nextCursorHeader := res.Header.Get("Next-Cursor"); nextCursorHeader != "" {
+		nextCursor = nextCursorHeader
+	}
+
+	if stats != nil {
+		*stats, err = parseReadStats(res.Header)
+		if err != nil {
+			return nil, offset, cursor, err
+		}
+	}
+
+	err = c.statusCode(res)
+	if err != nil {
+		if errors.Is(err, seberr.ErrOffsetOutOfBounds) {
+			return nil, nextOffset, cursor, err
+		}
+		return nil, offset, cursor, err
+	}
+
+	mediaType, params, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, offset, cursor, fmt.Errorf("parsing media type: %w", err)
+	}
+	if mediaType != multipartFormData {
+		return nil, offset, cursor, fmt.Errorf("expected mediatype '%s', got '%s'", multipartFormData, mediaType)
+	}
+
+	batch := sebrecords.NewBatch(make([]uint32, 0, input.MaxRecords), input.Buffer)
+	err = httphelpers.MultipartFormDataToRecords(res.Body, params["boundary"], &batch)
+	if err != nil {
+		// NOTE: when partial content is received the request was accepted by
+		// the server, and the ErrBadInput error is just telling us that there's
+		// no data in the response.
+		if res.StatusCode == http.StatusPartialContent && errors.Is(err, seberr.ErrBadInput) {
+			return batch.IndividualRecords(), nextOffset, nextCursor, nil
+		}
+
+		return nil, offset, cursor, fmt.Errorf("parsing multipart form data: %w", err)
+	}
+
+	records := batch.IndividualRecords()
+	err = c.interceptConsume(topicName, records)
+	if err != nil {
+		return nil, offset, cursor, err
+	}
+
+	return records, nextOffset, nextCursor, nil
+}
+
+type SampleRecordsInput struct {
+	// NumRecords is the number of records to sample. Defaults to 10.
+	NumRecords int
+
+	// StartOffset and EndOffset limit the sample to the offset range
+	// [StartOffset; EndOffset). EndOffset is ignored if 0.
+	StartOffset uint64
+	EndOffset   uint64
+
+	// From and To limit the sample to records that were added in the time
+	// range [From; To]. Ignored if zero.
+	From time.Time
+	To   time.Time
+
+	// Buffer is used as the backing storage for the returned records. See
+	// GetRecordsInput.Buffer. Defaults to 1 MiB.
+	Buffer []byte
+}
+
+// SampleRecords returns a uniform random sample of records from topicName,
+// along with their offsets. This is useful for e.g. schema inference and
+// data-quality checks without reading the full topic.
+func (c *RecordClient) SampleRecords(topicName string, input SampleRecordsInput) ([][]byte, []uint64, error) {
+	if input.NumRecords == 0 {
+		input.NumRecords = 10
+	}
+
+	if input.Buffer == nil {
+		input.Buffer = make([]byte, 0, sizey.MB)
+	}
+
+	req, err := c.request("GET", "/records/sample", nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	params := map[string]string{
+		"topic-name":   topicName,
+		"num-records":  fmt.Sprintf("%d", input.NumRecords),
+		"start-offset": fmt.Sprintf("%d", input.StartOffset),
+	}
+	if input.EndOffset != 0 {
+		params["end-offset"] = fmt.Sprintf("%d", input.EndOffset)
+	}
+	if !input.From.IsZero() {
+		params["from"] = input.From.Format(time.RFC3339Nano)
+	}
+	if !input.To.IsZero() {
+		params["to"] = input.To.Format(time.RFC3339Nano)
+	}
+	httphelpers.AddQueryParams(req, params)
+
+	res, err := c.do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("sending request: %w", err)
+	}
+	defer res.Body.Close()
+
+	err = c.statusCode(res)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var offsets []uint64
+	if offsetsHeader := res.Header.Get("Record-Offsets"); offsetsHeader != "" {
+		for _, offsetStr := range strings.Split(offsetsHeader, ",") {
+			offset, err := strconv.ParseUint(offsetStr, 10, 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("parsing offset '%s': %w", offsetStr, err)
+			}
+			offsets = append(offsets, offset)
+		}
+	}
+
+	_, mediaParams, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing media type: %w", err)
+	}
+
+	batch := sebrecords.NewBatch(make([]uint32, 0, input.NumRecords), input.Buffer)
+	err = httphelpers.MultipartFormDataToRecords(res.Body, mediaParams["boundary"], &batch)
+	if err != nil {
+		// NOTE: ErrBadInput is returned when there are no records in the
+		// response
+		if len(offsets) == 0 && errors.Is(err, seberr.ErrBadInput) {
+			return nil, nil, nil
+		}
+		return nil, nil, fmt.Errorf("parsing multipart form data: %w", err)
+	}
+
+	records := batch.IndividualRecords()
+	err = c.interceptConsume(topicName, records)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return records, offsets, nil
+}
+
+// CommitGroupOffset commits offset as the offset of the next record of
+// topicName that the consumer group will process. It returns
+// seberr.ErrNotFound if topicName does not exist, and
+// seberr.ErrOffsetOutOfBounds if offset is past the end of topicName.
+func (c *RecordClient) CommitGroupOffset(group string, topicName string, offset uint64) error {
+	req, err := c.request("PUT", "/groups/"+url.PathEscape(group)+"/offset", nil)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	httphelpers.AddQueryParams(req, map[string]string{
+		"topic-name": topicName,
+		"offset":     fmt.Sprintf("%d", offset),
+	})
+
+	res, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("sending request: %w", err)
+	}
+	defer res.Body.Close()
+
+	err = c.statusCode(res)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+type TopicLag struct {
+	TopicName       string `json:"topic_name"`
+	CommittedOffset uint64 `json:"committed_offset"`
+	NextOffset      uint64 `json:"next_offset"`
+	Lag             uint64 `json:"lag"`
+}
+
+type GroupLag struct {
+	Group    string     `json:"group"`
+	Topics   []TopicLag `json:"topics"`
+	TotalLag uint64     `json:"total_lag"`
+}
+
+// GetGroupLag returns the lag of the consumer group on each of the topics
+// that it has committed offsets for. It returns seberr.ErrNotFound if the
+// group hasn't committed any offsets.
+func (c *RecordClient) GetGroupLag(group string) (GroupLag, error) {
+	req, err := c.request("GET", "/groups/"+url.PathEscape(group)+"/lag", nil)
+	if err != nil {
+		return GroupLag{}, fmt.Errorf("creating request: %w", err)
+	}
+
+	res, err := c.do(req)
+	if err != nil {
+		return GroupLag{}, fmt.Errorf("sending request: %w", err)
+	}
+	defer res.Body.Close()
+
+	err = c.statusCode(res)
+	if err != nil {
+		return GroupLag{}, err
+	}
+
+	output := GroupLag{}
+	err = json.NewDecoder(res.Body).Decode(&output)
+	if err != nil {
+		return GroupLag{}, fmt.Errorf("decoding json: %w", err)
+	}
+
+	return output, nil
+}
+
+type ResetGroupOffsetsInput struct {
+	// To is what the offsets are reset to; one of "earliest", "latest",
+	// "offset" and "timestamp".
+	To string
+
+	// Offset is used by "offset", and Timestamp by "timestamp".
+	Offset    uint64
+	Timestamp time.Time
+
+	// TopicNames are the topics whose offsets are reset. They default to the
+	// topics that the group has committed offsets for.
+	TopicNames []string
+
+	// DryRun returns the resulting lag without committing the offsets.
+	DryRun bool
+}
+
+type ResetGroupOffsetsOutput struct {
+	Group    string     `json:"group"`
+	DryRun   bool       `json:"dry_run"`
+	Topics   []TopicLag `json:"topics"`
+	TotalLag uint64     `json:"total_lag"`
+}
+
+// ResetGroupOffsets resets the offsets committed by the consumer group as
+// described by input, and returns the group's resulting lag on each of the
+// reset topics. It returns seberr.ErrNotFound if the group or one of the
+// topics doesn't exist, seberr.ErrOffsetOutOfBounds if the offset is past the
+// end of a topic, and seberr.ErrBadInput if input is invalid or the group has
+// members.
+func (c *RecordClient) ResetGroupOffsets(group string, input ResetGroupOffsetsInput) (ResetGroupOffsetsOutput, error) {
+	req, err := c.request("PUT", "/admin/groups/"+url.PathEscape(group)+"/offsets/reset", nil)
+	if err != nil {
+		return ResetGroupOffsetsOutput{}, fmt.Errorf("creating request: %w", err)
+	}
+
+	query := url.Values{
+		"to":         {input.To},
+		"offset":     {fmt.Sprintf("%d", input.Offset)},
+		"topic-name": input.TopicNames,
+		"dry-run":    {fmt.Sprintf("%t", input.DryRun)},
+	}
+	if !input.Timestamp.IsZero() {
+		query.Set("timestamp", input.Timestamp.Format(time.RFC3339Nano))
+	}
+	req.URL.RawQuery = query.Encode()
+
+	res, err := c.do(req)
+	if err != nil {
+		return ResetGroupOffsetsOutput{}, fmt.Errorf("sending request: %w", err)
+	}
+	defer res.Body.Close()
+
+	err = c.statusCode(res)
+	if err != nil {
+		return ResetGroupOffsetsOutput{}, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return ResetGroupOffsetsOutput{}, fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	output := ResetGroupOffsetsOutput{}
+	err = json.NewDecoder(res.Body).Decode(&output)
+	if err != nil {
+		return ResetGroupOffsetsOutput{}, fmt.Errorf("decoding json: %w", err)
+	}
+
+	return output, nil
+}
+
+// GroupAssignment is the topics assigned to a member of a consumer group in
+// the group's current generation. The generation changes whenever the group
+// is rebalanced; members must then stop consuming topics that are no longer
+// assigned to them.
+type GroupAssignment struct {
+	MemberID   string   `json:"member_id"`
+	Generation uint64   `json:"generation"`
+	TopicNames []string `json:"topic_names"`
+
+	// PausedTopicNames is the topics of TopicNames whose delivery to the
+	// group is paused.
+	PausedTopicNames []string `json:"paused_topic_names"`
+
+	Assignor string `json:"assignor"`
+}
+
+// JoinGroup makes the client a member of the consumer group, consuming
+// topicNames, and returns the topics assigned to it. If memberID is empty, a
+// new member ID is returned in the assignment, which must be used for
+// following calls. The membership is kept alive by calling GroupHeartbeat
+// within sessionTimeout, which uses the broker's default if 0.
+//
+// assignor names the strategy used to assign the group's topics, e.g.
+// "sticky" to move as few topics as possible between members when the group
+// is rebalanced. It's chosen by the member that creates the group, and the
+// broker's default is used if it's empty. seberr.ErrBadInput is returned if
+// the group uses a different assignor.
+func (c *RecordClient) JoinGroup(group string, memberID string, topicNames []string, sessionTimeout time.Duration, assignor string) (GroupAssignment, error) {
+	req, err := c.request("POST", "/groups/"+url.PathEscape(group)+"/join", nil)
+	if err != nil {
+		return GroupAssignment{}, fmt.Errorf("creating request: %w", err)
+	}
+
+	query := url.Values{"topic-name": topicNames}
+	if memberID != "" {
+		query.Set("member-id", memberID)
+	}
+	if sessionTimeout > 0 {
+		query.Set("session-timeout", sessionTimeout.String())
+	}
+	if assignor != "" {
+		query.Set("assignor", assignor)
+	}
+	req.URL.RawQuery = query.Encode()
+
+	return c.groupAssignment(req)
+}
+
+// GroupHeartbeat keeps the membership of memberID in the consumer group
+// alive, and returns its current assignment. It returns seberr.ErrNotFound if
+// memberID isn't a member of the group, e.g. because its session timed out,
+// in which case it must rejoin the group.
+func (c *RecordClient) GroupHeartbeat(group string, memberID string) (GroupAssignment, error) {
+	req, err := c.request("POST", "/groups/"+url.PathEscape(group)+"/heartbeat", nil)
+	if err != nil {
+		return GroupAssignment{}, fmt.Errorf("creating request: %w", err)
+	}
+
+	httphelpers.AddQueryParams(req, map[string]string{
+		"member-id": memberID,
+	})
+
+	return c.groupAssignment(req)
+}
+
+func (c *RecordClient) groupAssignment(req *http.Request) (GroupAssignment, error) {
+	res, err := c.do(req)
+	if err != nil {
+		return GroupAssignment{}, fmt.Errorf("sending request: %w", err)
+	}
+	defer res.Body.Close()
+
+	err = c.statusCode(res)
+	if err != nil {
+		return GroupAssignment{}, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return GroupAssignment{}, fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	output := GroupAssignment{}
+	err = json.NewDecoder(res.Body).Decode(&output)
+	if err != nil {
+		return GroupAssignment{}, fmt.Errorf("decoding json: %w", err)
+	}
+
+	return output, nil
+}
+
+// LeaveGroup removes memberID from the consumer group, so that its topics are
+// assigned to the remaining members right away. It returns
+// seberr.ErrNotFound if memberID isn't a member of the group.
+func (c *RecordClient) LeaveGroup(group string, memberID string) error {
+	req, err := c.request("POST", "/groups/"+url.PathEscape(group)+"/leave", nil)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	httphelpers.AddQueryParams(req, map[string]string{
+		"member-id": memberID,
+	})
+
+	res, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("sending request: %w", err)
+	}
+	defer res.Body.Close()
+
+	err = c.statusCode(res)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+type CreateReplayInput struct {
+	TopicName   string
+	StartOffset uint64
+
+	// EndOffset defaults to the topic's next offset if 0.
+	EndOffset uint64
+
+	// RecordsPerSecond and BytesPerSecond limit the rate at which the
+	// replay's records are read. Unlimited if 0.
+	RecordsPerSecond int
+	BytesPerSecond   int
+
+	// BypassCache makes the broker not admit the record batches read by the
+	// replay to its cache.
+	BypassCache bool
+
+	// IdleTimeout is the amount of time after which the replay is deleted if
+	// it hasn't been read. The broker's default is used if 0.
+	IdleTimeout time.Duration
+}
+
+type Replay struct {
+	Name             string        `json:"name"`
+	TopicName        string        `json:"topic_name"`
+	StartOffset      uint64        `json:"start_offset"`
+	EndOffset        uint64        `json:"end_offset"`
+	Offset           uint64        `json:"offset"`
+	Done             bool          `json:"done"`
+	RecordsPerSecond int           `json:"records_per_second"`
+	BytesPerSecond   int           `json:"bytes_per_second"`
+	BypassCache      bool          `json:"bypass_cache"`
+	IdleTimeout      time.Duration `json:"idle_timeout"`
+	CreatedAt        time.Time     `json:"created_at"`
+	ActiveAt         time.Time     `json:"active_at"`
+}
+
+func (r *Replay) UnmarshalJSON(data []byte) error {
+	type replay Replay
+	output := struct {
+		*replay
+		IdleTimeout string `json:"idle_timeout"`
+	}{
+		replay: (*replay)(r),
+	}
+	err := json.Unmarshal(data, &output)
+	if err != nil {
+		return err
+	}
+
+	r.IdleTimeout, err = time.ParseDuration(output.IdleTimeout)
+	if err != nil {
+		return fmt.Errorf("parsing idle timeout: %w", err)
+	}
+	return nil
+}
+
+// CreateReplay creates a replay named name: a read-only cursor over a range
+// of offsets of input.TopicName, which is read using ReadReplay. Replays are
+// meant for large backfills; they have their own rate limits and can bypass
+// the broker's cache, such that they don't disturb live consumers.
+// seberr.ErrBadInput is returned if the replay already exists or input is
+// invalid, and seberr.ErrNotFound if the topic doesn't exist.
+func (c *RecordClient) CreateReplay(name string, input CreateReplayInput) (Replay, error) {
+	body := struct {
+		TopicName        string `json:"topic_name"`
+		StartOffset      uint64 `json:"start_offset"`
+		EndOffset        uint64 `json:"end_offset"`
+		RecordsPerSecond int    `json:"records_per_second"`
+		BytesPerSecond   int    `json:"bytes_per_second"`
+		BypassCache      bool   `json:"bypass_cache"`
+		IdleTimeout      string `json:"idle_timeout,omitempty"`
+	}{
+		TopicName:        input.TopicName,
+		StartOffset:      input.StartOffset,
+		EndOffset:        input.EndOffset,
+		RecordsPerSecond: input.RecordsPerSecond,
+		BytesPerSecond:   input.BytesPerSecond,
+		BypassCache:      input.BypassCache,
+	}
+	if input.IdleTimeout != 0 {
+		body.IdleTimeout = input.IdleTimeout.String()
+	}
+
+	bs, err := json.Marshal(body)
+	if err != nil {
+		return Replay{}, fmt.Errorf("encoding json: %w", err)
+	}
+
+	req, err := c.request("POST", "/replays/"+url.PathEscape(name), bytes.NewReader(bs))
+	if err != nil {
+		return Replay{}, fmt.Errorf("creating request: %w", err)
+	}
+
+	return c.replay(req)
+}
+
+// GetReplay returns the replay named name, or seberr.ErrNotFound if it
+// doesn't exist.
+func (c *RecordClient) GetReplay(name string) (Replay, error) {
+	req, err := c.request("GET", "/replays/"+url.PathEscape(name), nil)
+	if err != nil {
+		return Replay{}, fmt.Errorf("creating request: %w", err)
+	}
+
+	return c.replay(req)
+}
+
+func (c *RecordClient) replay(req *http.Request) (Replay, error) {
+	res, err := c.do(req)
+	if err != nil {
+		return Replay{}, fmt.Errorf("sending request: %w", err)
+	}
+	defer res.Body.Close()
+
+	err = c.statusCode(res)
+	if err != nil {
+		return Replay{}, err
+	}
+
+	output := Replay{}
+	err = json.NewDecoder(res.Body).Decode(&output)
+	if err != nil {
+		return Replay{}, fmt.Errorf("decoding json: %w", err)
+	}
+
+	return output, nil
+}
+
+// ListReplays returns all replays.
+func (c *RecordClient) ListReplays() ([]Replay, error) {
+	req, err := c.request("GET", "/replays", nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	res, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("sending request: %w", err)
+	}
+	defer res.Body.Close()
+
+	err = c.statusCode(res)
+	if err != nil {
+		return nil, err
+	}
+
+	output := []Replay{}
+	err = json.NewDecoder(res.Body).Decode(&output)
+	if err != nil {
+		return nil, fmt.Errorf("decoding json: %w", err)
+	}
+
+	return output, nil
+}
+
+// DeleteReplay deletes the replay named name, or returns seberr.ErrNotFound
+// if it doesn't exist.
+func (c *RecordClient) DeleteReplay(name string) error {
+	req, err := c.request("DELETE", "/replays/"+url.PathEscape(name), nil)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	res, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("sending request: %w", err)
+	}
+	defer res.Body.Close()
+
+	err = c.statusCode(res)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+type ReadReplayInput struct {
+	// MaxRecords is the maximum number of records to return. Defaults to 10.
+	MaxRecords int
+
+	// Buffer is used as the backing storage for the returned records. See
+	// GetRecordsInput.Buffer. Defaults to 1 MiB.
+	Buffer []byte
+}
+
+// ReadReplay returns the next records of the replay named name, and advances
+// the replay past them. The broker waits for the replay's rate limits before
+// responding. It returns the offset that the replay will read next, and
+// whether all of the replay's records have been read; no records are returned
+// once the replay is done.
+func (c *RecordClient) ReadReplay(name string, input ReadReplayInput) ([][]byte, uint64, bool, error) {
+	if input.MaxRecords == 0 {
+		input.MaxRecords = 10
+	}
+
+	if input.Buffer == nil {
+		input.Buffer = make([]byte, 0, sizey.MB)
+	}
+
+	req, err := c.request("GET", "/replays/"+url.PathEscape(name)+"/records", nil)
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("creating request: %w", err)
+	}
+
+	httphelpers.AddQueryParams(req, map[string]string{
+		"max-records": fmt.Sprintf("%d", input.MaxRecords),
+		"max-bytes":   fmt.Sprintf("%d", cap(input.Buffer)),
+	})
+
+	res, err := c.do(req)
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("sending request: %w", err)
+	}
+	defer res.Body.Close()
+
+	err = c.statusCode(res)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	var nextOffset uint64
+	if nextOffsetHeader := res.Header.Get("Next-Offset"); nextOffsetHeader != "" {
+		nextOffset, err = strconv.ParseUint(nextOffsetHeader, 10, 64)
+		if err != nil {
+			return nil, 0, false, fmt.Errorf("parsing Next-Offset header: %w", err)
+		}
+	}
+	done := res.Header.Get("Replay-Done") == "true"
+
+	// NOTE: no content is returned when no records were read, and partial
+	// content when the request ended while waiting for the replay's rate
+	// limits.
+	if res.StatusCode == http.StatusNoContent || res.StatusCode == http.StatusPartialContent {
+		return nil, nextOffset, done, nil
+	}
+
+	mediaType, params, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("parsing media type: %w", err)
+	}
+	if mediaType != multipartFormData {
+		return nil, 0, false, fmt.Errorf("expected mediatype '%s', got '%s'", multipartFormData, mediaType)
+	}
+
+	batch := sebrecords.NewBatch(make([]uint32, 0, input.MaxRecords), input.Buffer)
+	err = httphelpers.MultipartFormDataToRecords(res.Body, params["boundary"], &batch)
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("parsing multipart form data: %w", err)
+	}
+
+	return batch.IndividualRecords(), nextOffset, done, nil
+}
+
+// CloseIdleConnections closes unused, idle connections on the underlying
+// http.Client.
+func (c *RecordClient) CloseIdleConnections() {
+	c.client.CloseIdleConnections()
+}
+
+// statusCode returns an error if res is an error response. The error wraps the
+// seberr error identified by the code of the response body, as well as the
+// seberr error implied by the status code, such that errors from brokers that
+// don't send codes can still be recognized.
+func (c *RecordClient) statusCode(res *http.Response) error {
+	if res.StatusCode < http.StatusBadRequest {
+		return nil
+	}
+
+	err := httphelpers.ParseError(res)
+
+	var statusErr error
+	switch res.StatusCode {
+	case http.StatusUnauthorized:
+		statusErr = seberr.ErrNotAuthorized
+	case http.StatusNotFound:
+		statusErr = seberr.ErrNotFound
+	case http.StatusConflict:
+		statusErr = seberr.ErrTopicAlreadyExists
+	case http.StatusRequestEntityTooLarge:
+		statusErr = seberr.ErrPayloadTooLarge
+	case http.StatusTooManyRequests:
+		statusErr = seberr.ErrBackpressure
+	case http.StatusInsufficientStorage:
+		statusErr = seberr.ErrQuotaExceeded
+	case http.StatusRequestedRangeNotSatisfiable:
+		statusErr = seberr.ErrOffsetOutOfBounds
+	case http.StatusLocked:
+		statusErr = seberr.ErrGroupPaused
+	}
+	if statusErr == nil || errors.Is(err, statusErr) {
+		return err
+	}
+
+	return fmt.Errorf("%w: %w", statusErr, err)
+}
+
+func (c *RecordClient) request(method string, path string, body io.Reader) (*http.Request, error) {
+	url := c.baseURL.JoinPath(path)
+
+	req, err := http.NewRequest(method, url.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
+
+	return req, nil
+}
+
+// parseReadStats parses the ReadStats given in header. Stats that aren't
+// given, e.g. by older servers, are left as zero.
+func parseReadStats(header http.Header) (ReadStats, error) {
+	stats := ReadStats{
+		StopReason: header.Get("Stop-Reason"),
+	}
+
+	counts := map[string]*int{
+		"Records-Returned": &stats.RecordsReturned,
+		"Bytes-Returned":   &stats.BytesReturned,
+		"Records-Scanned":  &stats.RecordsScanned,
+		"Bytes-Scanned":    &stats.BytesScanned,
+	}
+	for name, count := range counts {
+		v := header.Get(name)
+		if v == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return ReadStats{}, fmt.Errorf("parsing %s header: %w", name, err)
+		}
+		*count = n
+	}
+
+	return stats, nil
 }
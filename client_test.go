@@ -2,6 +2,9 @@ package seb_test
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -10,8 +13,11 @@ import (
 	"github.com/micvbang/go-helpy/timey"
 	seb "github.com/micvbang/simple-event-broker"
 	"github.com/micvbang/simple-event-broker/internal/httphandlers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
 	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
 	"github.com/micvbang/simple-event-broker/seberr"
 
 	"github.com/stretchr/testify/require"
@@ -30,7 +36,7 @@ func TestRecordClientAddRecordsHappyPath(t *testing.T) {
 	)
 
 	// ensure record does not already exist
-	_, err = srv.Broker.GetRecord(helpy.Pointer(tester.NewBatch(1, 256)), topicName, offset)
+	_, err = srv.Broker.GetRecord(context.Background(), helpy.Pointer(tester.NewBatch(1, 256)), topicName, offset)
 	require.ErrorIs(t, err, seberr.ErrOutOfBounds)
 
 	expectedBatch := tester.MakeRandomRecordBatch(5)
@@ -44,6 +50,7 @@ func TestRecordClientAddRecordsHappyPath(t *testing.T) {
 	err = srv.Broker.GetRecords(context.Background(), &gotBatch, topicName, offset, 100, 0)
 	require.NoError(t, err)
 
+	expectedBatch.StopReason = sebrecords.StopReasonEnd
 	require.Equal(t, expectedBatch, gotBatch)
 }
 
@@ -188,13 +195,97 @@ func TestRecordClientGetRecordsOffsetOutOfBounds(t *testing.T) {
 	require.Equal(t, 0, len(records))
 }
 
+// TestRecordClientGetRecordsNonBlocking verifies that
+// seberr.ErrOffsetOutOfBounds is returned immediately, together with the next
+// offset of the topic, when reading an offset that does not exist yet with
+// NonBlocking set.
+func TestRecordClientGetRecordsNonBlocking(t *testing.T) {
+	const topicName = "topic-name"
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	offsets, err := srv.Broker.AddRecords(topicName, tester.MakeRandomRecordBatch(2))
+	require.NoError(t, err)
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	offsetTooHigh := slicey.Last(offsets) + 5
+	// Act
+	t0 := time.Now()
+	records, nextOffset, err := client.GetRecordsNextOffset(topicName, offsetTooHigh, seb.GetRecordsInput{
+		Timeout:     10 * time.Second,
+		NonBlocking: true,
+	})
+
+	// Assert
+	require.ErrorIs(t, err, seberr.ErrOffsetOutOfBounds)
+	require.Less(t, time.Since(t0), time.Second)
+	require.Equal(t, 0, len(records))
+	require.Equal(t, slicey.Last(offsets)+1, nextOffset)
+}
+
+// TestRecordClientAddRecordsWithOutput verifies that AddRecordsWithOutput()
+// returns the offsets of the added records and the record batch that they
+// were committed in.
+func TestRecordClientAddRecordsWithOutput(t *testing.T) {
+	const topicName = "topic-name"
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	err = client.AddRecords(topicName, []uint32{1, 1}, []byte("ab"))
+	require.NoError(t, err)
+
+	// Act
+	output, err := client.AddRecordsWithOutput(topicName, []uint32{1, 2}, []byte("cde"))
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, []uint64{2, 3}, output.Offsets)
+	require.NotNil(t, output.BatchID)
+	require.Equal(t, uint64(2), *output.BatchID)
+	require.Equal(t, sebtopic.RecordBatchKey(topicName, 2), output.BatchKey)
+	require.LessOrEqual(t, output.BatchWaitUs, output.CommitLatencyUs)
+}
+
+// TestRecordClientAddRecordsDuplicate verifies that AddRecordsWithOutput()
+// reports batches that the broker deduplicated, and returns the offsets of
+// the original batch.
+func TestRecordClientAddRecordsDuplicate(t *testing.T) {
+	const topicName = "topic-name"
+	srv := tester.HTTPServer(t, tester.HTTPBrokerOpts(sebbroker.WithDedupWindow(time.Minute)))
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	output, err := client.AddRecordsWithOutput(topicName, []uint32{1, 2}, []byte("abc"))
+	require.NoError(t, err)
+	require.False(t, output.Duplicate)
+
+	// Act
+	duplicate, err := client.AddRecordsWithOutput(topicName, []uint32{1, 2}, []byte("abc"))
+
+	// Assert
+	require.NoError(t, err)
+	require.True(t, duplicate.Duplicate)
+	require.Equal(t, output.Offsets, duplicate.Offsets)
+
+	topic, err := client.GetTopic(topicName)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), topic.NextOffset)
+}
+
 // TestRecordClientAddRecordsPayloadTooLarge verifies that AddRecords()
 // returns ErrPayloadTooLarge when receiving status code
 // http.StatusRequestEntityTooLarge.
 func TestRecordClientAddRecordsPayloadTooLarge(t *testing.T) {
 	deps := &httphandlers.MockDependencies{}
-	deps.AddRecordsMock = func(topicName string, batch sebrecords.Batch) ([]uint64, error) {
-		return nil, seberr.ErrPayloadTooLarge
+	deps.AddRecordsResultMock = func(ctx context.Context, topicName string, batch sebrecords.Batch) (sebbroker.AddResult, error) {
+		return sebbroker.AddResult{}, seberr.ErrPayloadTooLarge
 	}
 
 	srv := tester.HTTPServer(t, tester.HTTPDependencies(deps))
@@ -210,6 +301,27 @@ func TestRecordClientAddRecordsPayloadTooLarge(t *testing.T) {
 	require.ErrorIs(t, err, seberr.ErrPayloadTooLarge)
 }
 
+// TestRecordClientAddRecordsBackpressure verifies that AddRecords() returns
+// seberr.ErrBackpressure when the broker has too many pending records.
+func TestRecordClientAddRecordsBackpressure(t *testing.T) {
+	deps := &httphandlers.MockDependencies{}
+	deps.AddRecordsResultMock = func(ctx context.Context, topicName string, batch sebrecords.Batch) (sebbroker.AddResult, error) {
+		return sebbroker.AddResult{}, seberr.ErrBackpressure
+	}
+
+	srv := tester.HTTPServer(t, tester.HTTPDependencies(deps))
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	// Act
+	err = client.AddRecords("topicName", []uint32{1}, []byte{'1'})
+
+	// Assert
+	require.ErrorIs(t, err, seberr.ErrBackpressure)
+}
+
 // TestRecordClientGetTopicHappyPath verifies that GetTopic retrieves
 // and correctly parses topic metadata.
 func TestRecordClientGetTopicHappyPath(t *testing.T) {
@@ -251,3 +363,796 @@ func TestRecordClientGetTopicNotFound(t *testing.T) {
 	// Assert
 	require.ErrorIs(t, err, seberr.ErrNotFound)
 }
+
+// TestRecordClientGetTopicSegmentsHappyPath verifies that GetTopicSegments
+// retrieves and correctly parses the segments of a topic.
+func TestRecordClientGetTopicSegmentsHappyPath(t *testing.T) {
+	const topicName = "topic-name"
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	batchSizes := []int{4, 8}
+	for _, batchSize := range batchSizes {
+		_, err := srv.Broker.AddRecords(topicName, tester.MakeRandomRecordBatch(batchSize))
+		require.NoError(t, err)
+	}
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	// Act
+	segments, err := client.GetTopicSegments(topicName)
+	require.NoError(t, err)
+
+	// Assert
+	expectedSegments, err := srv.Broker.Segments(topicName)
+	require.NoError(t, err)
+	require.Equal(t, len(expectedSegments), len(segments))
+	for i, expected := range expectedSegments {
+		require.Equal(t, expected.BaseOffset, segments[i].BaseOffset)
+		require.Equal(t, expected.NumRecords, segments[i].NumRecords)
+		require.Equal(t, expected.Size, segments[i].Size)
+		require.Equal(t, expected.Path, segments[i].StorageKey)
+	}
+}
+
+// TestRecordClientGetTopicSegmentsNotFound verifies that GetTopicSegments
+// returns seberr.ErrNotFound for non-existing topics.
+func TestRecordClientGetTopicSegmentsNotFound(t *testing.T) {
+	srv := tester.HTTPServer(t, tester.HTTPBrokerAutoCreateTopic(false))
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	// Act
+	_, err = client.GetTopicSegments("does-not-exist")
+
+	// Assert
+	require.ErrorIs(t, err, seberr.ErrNotFound)
+}
+
+// TestRecordClientGetTopicSegmentsWithTraces verifies that trace IDs set via
+// TraceIDHeader are returned by GetTopicSegmentsWithTraces, and not by
+// GetTopicSegments.
+func TestRecordClientGetTopicSegmentsWithTraces(t *testing.T) {
+	const topicName = "topic-name"
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	traceIDs := []string{"trace-1", "trace-2"}
+	for _, traceID := range traceIDs {
+		client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey, seb.WithRequestInterceptors(
+			func(req *http.Request, next func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+				req.Header.Set(seb.TraceIDHeader, traceID)
+				return next(req)
+			},
+		))
+		require.NoError(t, err)
+
+		batch := tester.MakeRandomRecordBatch(2)
+		err = client.AddRecords(topicName, batch.Sizes, batch.Data)
+		require.NoError(t, err)
+	}
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	// Act
+	segments, err := client.GetTopicSegmentsWithTraces(topicName)
+	require.NoError(t, err)
+
+	// Assert
+	traces := []seb.TopicSegmentTrace{}
+	for _, segment := range segments {
+		traces = append(traces, segment.Traces...)
+	}
+	require.Equal(t, []seb.TopicSegmentTrace{
+		{TraceID: "trace-1", StartOffset: 0, NumRecords: 2},
+		{TraceID: "trace-2", StartOffset: 2, NumRecords: 2},
+	}, traces)
+
+	segments, err = client.GetTopicSegments(topicName)
+	require.NoError(t, err)
+	for _, segment := range segments {
+		require.Nil(t, segment.Traces)
+	}
+}
+
+// TestRecordClientGetBatchInfo verifies that GetBatchInfo returns the time at
+// which AddRecords sent the records of a batch, and the time at which the
+// batch was committed.
+func TestRecordClientGetBatchInfo(t *testing.T) {
+	const topicName = "topic-name"
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	batch := tester.MakeRandomRecordBatch(3)
+	tBefore := time.Now().Truncate(time.Microsecond)
+	err = client.AddRecords(topicName, batch.Sizes, batch.Data)
+	require.NoError(t, err)
+	t0 := time.Now()
+
+	// Act
+	info, err := client.GetBatchInfo(topicName, 1)
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, uint64(0), info.BaseOffset)
+	require.Equal(t, uint64(3), info.NumRecords)
+	require.False(t, info.ProducedAt.Before(tBefore))
+	require.False(t, info.ProducedAt.After(info.CommittedAt))
+	require.False(t, info.CommittedAt.After(t0))
+
+	_, err = client.GetBatchInfo(topicName, 3)
+	require.ErrorIs(t, err, seberr.ErrNotFound)
+}
+
+// TestRecordClientAddRecordsWithExpiry verifies that AddRecordsWithExpiry
+// sends expiry times to the server, causing expired records to be skipped
+// when reading.
+func TestRecordClientAddRecordsWithExpiry(t *testing.T) {
+	const topicName = "topic-name"
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	batch := tester.MakeRandomRecordBatch(3)
+	expires := []time.Time{{}, time.Now().Add(-time.Hour), time.Now().Add(time.Hour)}
+
+	// Act
+	err = client.AddRecordsWithExpiry(topicName, batch.Sizes, batch.Data, expires)
+	require.NoError(t, err)
+
+	// Assert
+	gotBatch := tester.NewBatch(batch.Len(), 4096)
+	err = srv.Broker.GetRecords(context.Background(), &gotBatch, topicName, 0, 10, 0)
+	require.NoError(t, err)
+
+	records := batch.IndividualRecords()
+	require.Equal(t, [][]byte{records[0], records[2]}, gotBatch.IndividualRecords())
+	require.Equal(t, 1, gotBatch.Skipped)
+}
+
+// TestRecordClientSampleRecords verifies that SampleRecords returns sampled
+// records along with their offsets.
+func TestRecordClientSampleRecords(t *testing.T) {
+	const topicName = "topic-name"
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	batch := tester.MakeRandomRecordBatch(32)
+	_, err := srv.Broker.AddRecords(topicName, batch)
+	require.NoError(t, err)
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	// Act
+	records, offsets, err := client.SampleRecords(topicName, seb.SampleRecordsInput{
+		NumRecords:  5,
+		StartOffset: 10,
+		EndOffset:   20,
+	})
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, 5, len(records))
+	require.Equal(t, 5, len(offsets))
+
+	expectedRecords := batch.IndividualRecords()
+	for i, offset := range offsets {
+		require.GreaterOrEqual(t, offset, uint64(10))
+		require.Less(t, offset, uint64(20))
+		require.Equal(t, expectedRecords[offset], records[i])
+	}
+}
+
+// TestRecordClientSampleRecordsEmptyRange verifies that SampleRecords returns
+// no records and no error when there are no records in the requested range.
+func TestRecordClientSampleRecordsEmptyRange(t *testing.T) {
+	const topicName = "topic-name"
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	_, err := srv.Broker.AddRecords(topicName, tester.MakeRandomRecordBatch(5))
+	require.NoError(t, err)
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	// Act
+	records, offsets, err := client.SampleRecords(topicName, seb.SampleRecordsInput{StartOffset: 100})
+
+	// Assert
+	require.NoError(t, err)
+	require.Empty(t, records)
+	require.Empty(t, offsets)
+}
+
+// TestRecordClientTopicAdministration verifies that topics can be created,
+// listed and deleted, and that the expected errors are returned when creating
+// a topic that exists or deleting a topic that does not.
+func TestRecordClientTopicAdministration(t *testing.T) {
+	const topicName = "topic-name"
+	srv := tester.HTTPServer(t, tester.HTTPBrokerAutoCreateTopic(false))
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	// Act, Assert
+	err = client.CreateTopic(topicName)
+	require.NoError(t, err)
+
+	err = client.CreateTopic(topicName)
+	require.ErrorIs(t, err, seberr.ErrTopicAlreadyExists)
+
+	topicNames, err := client.ListTopics()
+	require.NoError(t, err)
+	require.Equal(t, []string{topicName}, topicNames)
+
+	err = client.DeleteTopic(topicName)
+	require.NoError(t, err)
+
+	err = client.DeleteTopic(topicName)
+	require.ErrorIs(t, err, seberr.ErrNotFound)
+
+	topicNames, err = client.ListTopics()
+	require.NoError(t, err)
+	require.Empty(t, topicNames)
+}
+
+// TestRecordClientSealTopic verifies that SealTopic returns the topic's final
+// next offset, that records can't be added to the topic afterwards, and that
+// GetTopic reports the topic as sealed.
+func TestRecordClientSealTopic(t *testing.T) {
+	const topicName = "topic-name"
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	batch := tester.MakeRandomRecordBatch(3)
+	err = client.AddRecords(topicName, batch.Sizes, batch.Data)
+	require.NoError(t, err)
+
+	// Act
+	nextOffset, err := client.SealTopic(topicName)
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), nextOffset)
+
+	err = client.AddRecords(topicName, batch.Sizes, batch.Data)
+	require.ErrorIs(t, err, seberr.ErrTopicSealed)
+	require.ErrorIs(t, err, seberr.ErrWritesFrozen)
+
+	topic, err := client.GetTopic(topicName)
+	require.NoError(t, err)
+	require.True(t, topic.Sealed)
+	require.Equal(t, uint64(3), topic.NextOffset)
+}
+
+// TestRecordClientServiceUnavailable verifies that errors of responses with
+// status code 503 Service Unavailable are identified by the code of the
+// response, and that they're only reported as seberr.ErrWritesFrozen if the
+// code says so.
+func TestRecordClientServiceUnavailable(t *testing.T) {
+	tests := map[string]struct {
+		write        func(w http.ResponseWriter)
+		expectedErr  error
+		writesFrozen bool
+	}{
+		"writes frozen": {
+			write: func(w http.ResponseWriter) {
+				httphelpers.WriteError(w, http.StatusServiceUnavailable, seberr.ErrWritesFrozen)
+			},
+			expectedErr:  seberr.ErrWritesFrozen,
+			writesFrozen: true,
+		},
+		"storage unavailable": {
+			write: func(w http.ResponseWriter) {
+				httphelpers.WriteError(w, http.StatusServiceUnavailable, seberr.ErrStorageUnavailable)
+			},
+			expectedErr: seberr.ErrStorageUnavailable,
+		},
+		"no code": {
+			write: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				test.write(w)
+			}))
+			defer srv.Close()
+
+			client, err := seb.NewRecordClient(srv.URL, tester.DefaultAPIKey)
+			require.NoError(t, err)
+
+			batch := tester.MakeRandomRecordBatch(1)
+
+			// Act
+			err = client.AddRecords("topic-name", batch.Sizes, batch.Data)
+
+			// Assert
+			require.ErrorContains(t, err, "status code 503")
+			if test.expectedErr != nil {
+				require.ErrorIs(t, err, test.expectedErr)
+			}
+			require.Equal(t, test.writesFrozen, errors.Is(err, seberr.ErrWritesFrozen))
+		})
+	}
+}
+
+// TestRecordClientReplay verifies that a replay can be created, read until
+// it's done, listed and deleted.
+func TestRecordClientReplay(t *testing.T) {
+	const topicName = "topic-name"
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	batch := tester.MakeRandomRecordBatch(5)
+	err = client.AddRecords(topicName, batch.Sizes, batch.Data)
+	require.NoError(t, err)
+
+	// Act
+	replay, err := client.CreateReplay("backfill", seb.CreateReplayInput{
+		TopicName:   topicName,
+		EndOffset:   4,
+		BypassCache: true,
+		IdleTimeout: time.Minute,
+	})
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, "backfill", replay.Name)
+	require.Equal(t, uint64(4), replay.EndOffset)
+	require.Equal(t, time.Minute, replay.IdleTimeout)
+	require.True(t, replay.BypassCache)
+
+	// Act
+	records, nextOffset, done, err := client.ReadReplay("backfill", seb.ReadReplayInput{MaxRecords: 3})
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, batch.IndividualRecords()[:3], records)
+	require.Equal(t, uint64(3), nextOffset)
+	require.False(t, done)
+
+	records, nextOffset, done, err = client.ReadReplay("backfill", seb.ReadReplayInput{MaxRecords: 3})
+	require.NoError(t, err)
+	require.Equal(t, batch.IndividualRecords()[3:4], records)
+	require.Equal(t, uint64(4), nextOffset)
+	require.True(t, done)
+
+	records, _, done, err = client.ReadReplay("backfill", seb.ReadReplayInput{})
+	require.NoError(t, err)
+	require.Empty(t, records)
+	require.True(t, done)
+
+	replays, err := client.ListReplays()
+	require.NoError(t, err)
+	require.Len(t, replays, 1)
+	require.True(t, replays[0].Done)
+
+	// Act
+	err = client.DeleteReplay("backfill")
+
+	// Assert
+	require.NoError(t, err)
+
+	_, err = client.GetReplay("backfill")
+	require.ErrorIs(t, err, seberr.ErrNotFound)
+}
+
+// TestRecordClientGetRecordsNextOffset verifies that GetRecordsNextOffset
+// returns the offset to continue reading from, accounting for skipped records.
+func TestRecordClientGetRecordsNextOffset(t *testing.T) {
+	const topicName = "topic-name"
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	batch := tester.MakeRandomRecordBatch(3)
+	expires := []time.Time{{}, {}, time.Now().Add(-time.Hour)}
+	err = client.AddRecordsWithExpiry(topicName, batch.Sizes, batch.Data, expires)
+	require.NoError(t, err)
+
+	// Act
+	records, nextOffset, err := client.GetRecordsNextOffset(topicName, 0, seb.GetRecordsInput{
+		MaxRecords: 10,
+		Timeout:    10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, batch.IndividualRecords()[:2], records)
+	require.Equal(t, uint64(3), nextOffset)
+}
+
+// TestRecordClientGetRecordsMaxResponseBytes verifies that MaxResponseBytes
+// makes GetRecords account for the encoding of the records, returning fewer
+// records than fit in Buffer.
+func TestRecordClientGetRecordsMaxResponseBytes(t *testing.T) {
+	const topicName = "topic-name"
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	batch := tester.MakeRandomRecordBatchSize(100, 10)
+	_, err = srv.Broker.AddRecords(topicName, batch)
+	require.NoError(t, err)
+
+	input := seb.GetRecordsInput{
+		MaxRecords: batch.Len(),
+		Buffer:     make([]byte, 0, len(batch.Data)),
+		Timeout:    10 * time.Millisecond,
+	}
+
+	// Act
+	payloadRecords, err := client.GetRecords(topicName, 0, input)
+	require.NoError(t, err)
+
+	input.Buffer = make([]byte, 0, len(batch.Data))
+	input.MaxResponseBytes = len(batch.Data)
+	wireRecords, err := client.GetRecords(topicName, 0, input)
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, batch.IndividualRecords(), payloadRecords)
+	require.NotEmpty(t, wireRecords)
+	require.Less(t, len(wireRecords), batch.Len())
+	require.Equal(t, batch.IndividualRecords()[:len(wireRecords)], wireRecords)
+}
+
+// TestRecordClientGetRecordsStats verifies that GetRecordsStats returns the
+// accounting of the records read by the server.
+func TestRecordClientGetRecordsStats(t *testing.T) {
+	const topicName = "topic-name"
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	batch := tester.MakeRandomRecordBatchSize(5, 10)
+	expires := []time.Time{time.Now().Add(-time.Hour), {}, {}, {}, {}}
+	err = client.AddRecordsWithExpiry(topicName, batch.Sizes, batch.Data, expires)
+	require.NoError(t, err)
+
+	// Act
+	records, stats, err := client.GetRecordsStats(topicName, 0, seb.GetRecordsInput{
+		MaxRecords: 3,
+		Timeout:    10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, batch.IndividualRecords()[1:4], records)
+	expectedStats := seb.ReadStats{
+		RecordsReturned: 3,
+		BytesReturned:   30,
+		RecordsScanned:  4,
+		BytesScanned:    40,
+		StopReason:      "max-records",
+	}
+	require.Equal(t, expectedStats, stats)
+}
+
+// TestRecordClientGetRecordsCursor verifies that GetRecordsFromCursor
+// continues reading from where the previous call stopped, until all records
+// have been read.
+func TestRecordClientGetRecordsCursor(t *testing.T) {
+	const topicName = "topic-name"
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	batch := tester.MakeRandomRecordBatch(5)
+	_, err = srv.Broker.AddRecords(topicName, batch)
+	require.NoError(t, err)
+
+	input := seb.GetRecordsInput{
+		MaxRecords: 2,
+		Timeout:    10 * time.Millisecond,
+	}
+
+	// Act
+	gotRecords, cursor, err := client.GetRecordsCursor(topicName, 0, input)
+	require.NoError(t, err)
+	for range 3 {
+		var records [][]byte
+		records, cursor, err = client.GetRecordsFromCursor(topicName, cursor, input)
+		require.NoError(t, err)
+		gotRecords = append(gotRecords, records...)
+	}
+
+	// Assert
+	require.Equal(t, batch.IndividualRecords(), gotRecords)
+}
+
+// TestRecordClientGetRecordsFilter verifies that GetRecordsNextOffset only
+// returns records matching the given key and headers, and that the next offset
+// accounts for records that were filtered out.
+func TestRecordClientGetRecordsFilter(t *testing.T) {
+	const topicName = "topic-name"
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	batch := tester.MakeRandomRecordBatch(3)
+	batch.Keys = [][]byte{[]byte("a"), []byte("b"), []byte("a")}
+	batch.Headers = [][]sebrecords.RecordHeader{
+		{{Key: "type", Value: []byte("created")}},
+		{{Key: "type", Value: []byte("created")}},
+		{{Key: "type", Value: []byte("deleted")}},
+	}
+	_, err = srv.Broker.AddRecords(topicName, batch)
+	require.NoError(t, err)
+
+	// Act
+	records, nextOffset, err := client.GetRecordsNextOffset(topicName, 0, seb.GetRecordsInput{
+		MaxRecords: 10,
+		Timeout:    10 * time.Millisecond,
+		Key:        "a",
+		Headers:    map[string]string{"type": "created"},
+	})
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, batch.IndividualRecords()[:1], records)
+	require.Equal(t, uint64(3), nextOffset)
+}
+
+// TestRecordClientBulkTopics verifies that BulkTopics applies the operation to
+// the selected topics, and returns ErrBadInput for invalid input.
+func TestRecordClientBulkTopics(t *testing.T) {
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	for _, topicName := range []string{"orders-eu", "payments-eu"} {
+		_, err := srv.Broker.AddRecords(topicName, tester.MakeRandomRecordBatch(1))
+		require.NoError(t, err)
+	}
+
+	// Act
+	output, err := client.BulkTopics(seb.BulkTopicsInput{
+		Pattern:   "orders-*",
+		Operation: "set_retention",
+		Retention: time.Hour,
+	})
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, []string{"orders-eu"}, output.TopicNames)
+	require.Equal(t, time.Hour, srv.Broker.TopicRetention("orders-eu"))
+	require.Equal(t, time.Duration(0), srv.Broker.TopicRetention("payments-eu"))
+
+	_, err = client.BulkTopics(seb.BulkTopicsInput{Operation: "delete"})
+	require.ErrorIs(t, err, seberr.ErrBadInput)
+}
+
+// TestRecordClientProvisionTopics verifies that ProvisionTopics creates the
+// declared topics with their configuration, prunes undeclared topics, and
+// returns ErrBadInput for invalid input.
+func TestRecordClientProvisionTopics(t *testing.T) {
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	_, err = srv.Broker.AddRecords("extra", tester.MakeRandomRecordBatch(1))
+	require.NoError(t, err)
+
+	// Act
+	output, err := client.ProvisionTopics(seb.ProvisionTopicsInput{
+		Topics: []seb.TopicSpec{
+			{Name: "orders", Retention: time.Hour, Labels: map[string]string{"team": "a"}},
+		},
+		Prune: true,
+	})
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, []string{"orders"}, output.Created)
+	require.Equal(t, []string{"extra"}, output.Deleted)
+	require.Equal(t, time.Hour, srv.Broker.TopicRetention("orders"))
+	require.Equal(t, map[string]string{"team": "a"}, srv.Broker.TopicLabels("orders"))
+
+	_, err = client.ProvisionTopics(seb.ProvisionTopicsInput{
+		Topics: []seb.TopicSpec{{Name: "orders"}, {Name: "orders"}},
+	})
+	require.ErrorIs(t, err, seberr.ErrBadInput)
+}
+
+// TestRecordClientGroupLag verifies that offsets committed using
+// CommitGroupOffset are used to compute the lag returned by GetGroupLag, and
+// that the expected errors are returned for unknown topics and groups.
+func TestRecordClientGroupLag(t *testing.T) {
+	const (
+		group     = "group"
+		topicName = "topic-name"
+	)
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	batch := tester.MakeRandomRecordBatch(4)
+	err = client.AddRecords(topicName, batch.Sizes, batch.Data)
+	require.NoError(t, err)
+
+	// Act, Assert
+	err = client.CommitGroupOffset(group, topicName, 1)
+	require.NoError(t, err)
+
+	err = client.CommitGroupOffset(group, "unknown", 0)
+	require.ErrorIs(t, err, seberr.ErrNotFound)
+
+	lag, err := client.GetGroupLag(group)
+	require.NoError(t, err)
+	require.Equal(t, seb.GroupLag{
+		Group:    group,
+		Topics:   []seb.TopicLag{{TopicName: topicName, CommittedOffset: 1, NextOffset: 4, Lag: 3}},
+		TotalLag: 3,
+	}, lag)
+
+	_, err = client.GetGroupLag("unknown")
+	require.ErrorIs(t, err, seberr.ErrNotFound)
+}
+
+// TestRecordClientResetGroupOffsets verifies that the client can reset the
+// offsets of a consumer group, with and without dry runs.
+func TestRecordClientResetGroupOffsets(t *testing.T) {
+	const (
+		group     = "group"
+		topicName = "topic-name"
+	)
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	batch := tester.MakeRandomRecordBatch(4)
+	err = client.AddRecords(topicName, batch.Sizes, batch.Data)
+	require.NoError(t, err)
+	err = client.CommitGroupOffset(group, topicName, 1)
+	require.NoError(t, err)
+
+	// Act
+	output, err := client.ResetGroupOffsets(group, seb.ResetGroupOffsetsInput{To: "latest", DryRun: true})
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, seb.ResetGroupOffsetsOutput{
+		Group:  group,
+		DryRun: true,
+		Topics: []seb.TopicLag{{TopicName: topicName, CommittedOffset: 4, NextOffset: 4, Lag: 0}},
+	}, output)
+
+	lag, err := client.GetGroupLag(group)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), lag.TotalLag)
+
+	// Act
+	output, err = client.ResetGroupOffsets(group, seb.ResetGroupOffsetsInput{To: "timestamp", Timestamp: time.Now().Add(-time.Hour), TopicNames: []string{topicName}})
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, seb.ResetGroupOffsetsOutput{
+		Group:    group,
+		Topics:   []seb.TopicLag{{TopicName: topicName, CommittedOffset: 0, NextOffset: 4, Lag: 4}},
+		TotalLag: 4,
+	}, output)
+
+	lag, err = client.GetGroupLag(group)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), lag.TotalLag)
+
+	_, err = client.ResetGroupOffsets(group, seb.ResetGroupOffsetsInput{To: "offset", Offset: 5})
+	require.ErrorIs(t, err, seberr.ErrOffsetOutOfBounds)
+
+	_, err = client.ResetGroupOffsets(group, seb.ResetGroupOffsetsInput{To: "somewhere"})
+	require.ErrorIs(t, err, seberr.ErrBadInput)
+
+	_, err = client.ResetGroupOffsets("unknown", seb.ResetGroupOffsetsInput{To: "earliest"})
+	require.ErrorIs(t, err, seberr.ErrNotFound)
+}
+
+// TestRecordClientGroupMembership verifies that members can join a consumer
+// group, keep their membership alive using heartbeats, and leave the group.
+func TestRecordClientGroupMembership(t *testing.T) {
+	const group = "group"
+	topicNames := []string{"t1", "t2"}
+
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	// Act, Assert
+	a, err := client.JoinGroup(group, "", topicNames, time.Minute, "sticky")
+	require.NoError(t, err)
+	require.NotEmpty(t, a.MemberID)
+	require.Equal(t, topicNames, a.TopicNames)
+	require.Equal(t, "sticky", a.Assignor)
+
+	_, err = client.JoinGroup(group, "c", topicNames, 0, "range")
+	require.ErrorIs(t, err, seberr.ErrBadInput)
+
+	b, err := client.JoinGroup(group, "b", topicNames, 0, "")
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), b.Generation)
+	require.Len(t, b.TopicNames, 1)
+
+	a, err = client.GroupHeartbeat(group, a.MemberID)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), a.Generation)
+	require.ElementsMatch(t, topicNames, append(a.TopicNames, b.TopicNames...))
+
+	err = client.LeaveGroup(group, a.MemberID)
+	require.NoError(t, err)
+
+	_, err = client.GroupHeartbeat(group, a.MemberID)
+	require.ErrorIs(t, err, seberr.ErrNotFound)
+
+	b, err = client.GroupHeartbeat(group, "b")
+	require.NoError(t, err)
+	require.Equal(t, topicNames, b.TopicNames)
+}
+
+// TestRecordClientGetRecordsGroupPaused verifies that GetRecords returns
+// ErrGroupPaused when reading on behalf of a paused consumer group.
+func TestRecordClientGetRecordsGroupPaused(t *testing.T) {
+	const topicName = "topic"
+
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	_, err = srv.Broker.AddRecords(topicName, tester.MakeRandomRecordBatch(1))
+	require.NoError(t, err)
+	err = srv.Broker.PauseGroup(context.Background(), "paused", "")
+	require.NoError(t, err)
+
+	// Act
+	_, err = client.GetRecords(topicName, 0, seb.GetRecordsInput{Group: "paused"})
+
+	// Assert
+	require.ErrorIs(t, err, seberr.ErrGroupPaused)
+
+	records, err := client.GetRecords(topicName, 0, seb.GetRecordsInput{Group: "other"})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+}
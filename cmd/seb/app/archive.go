@@ -0,0 +1,226 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	exportFlags ExportFlags
+	importFlags ImportFlags
+)
+
+func init() {
+	fs := exportCmd.Flags()
+	fs.StringVar(&exportFlags.topicName, "topic", "", "Name of topic to export records from")
+	fs.Uint64Var(&exportFlags.startOffset, "start-offset", 0, "Offset of the first record to export")
+	fs.Uint64Var(&exportFlags.endOffset, "end-offset", 0, "Offset following the last record to export. Defaults to the topic's next offset if 0")
+	fs.StringVar(&exportFlags.output, "output", "-", "Path of the archive file to write, or - for stdout")
+	addArchiveStorageFlags(fs, &exportFlags.ArchiveStorageFlags)
+	exportCmd.MarkFlagRequired("topic")
+
+	fs = importCmd.Flags()
+	fs.StringVar(&importFlags.topicName, "topic", "", "Name of topic to import records into")
+	fs.StringVar(&importFlags.input, "input", "-", "Path of the archive file to read, or - for stdin")
+	addArchiveStorageFlags(fs, &importFlags.ArchiveStorageFlags)
+	importCmd.MarkFlagRequired("topic")
+}
+
+func addArchiveStorageFlags(fs *pflag.FlagSet, flags *ArchiveStorageFlags) {
+	fs.IntVar(&flags.logLevel, "log-level", int(logger.LevelInfo), "Log level, info=4, debug=5")
+	fs.BoolVar(&flags.compress, "batch-compress", true, "Whether record batches are compressed in storage. Must match the broker's --batch-compress")
+	addStorageFlags(fs, "", "", &flags.StorageFlags)
+
+	// encryption
+	fs.StringVar(&flags.encryptionKeyID, "encryption-key-id", "", "ID of the key used to encrypt record batches. The hex encoded key is read from the environment variable SEB_ENCRYPTION_KEY. Encryption is disabled if empty")
+}
+
+// addStorageFlags adds the flags that select and configure storage to fs,
+// with their names prefixed by prefix and their descriptions by desc.
+func addStorageFlags(fs *pflag.FlagSet, prefix string, desc string, flags *StorageFlags) {
+	fs.StringVar(&flags.storage, prefix+"storage", "s3", fmt.Sprintf("%sStorage that record batches are kept in, one of: %s", desc, strings.Join(sebtopic.StorageNames(), ", ")))
+	fs.StringVar(&flags.storageDir, prefix+"storage-dir", "", desc+"Local dir that record batches are kept in when using disk storage")
+	fs.StringToStringVar(&flags.storageParams, prefix+"storage-param", nil, desc+"Storage specific configuration, e.g. for storage registered by other modules")
+	fs.StringVar(&flags.s3BucketName, prefix+"s3-bucket", "", desc+"Bucket name. Required when using s3 or minio storage")
+	fs.StringVar(&flags.s3Endpoint, prefix+"s3-endpoint", "", desc+"URL of an S3 compatible service, e.g. MinIO or Ceph. Required when using minio storage")
+	fs.BoolVar(&flags.s3PathStyle, prefix+"s3-path-style", false, desc+"Whether to address buckets using path-style URLs. Always enabled for minio storage")
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export records of a topic to an archive file",
+	Long:  "Export the records of a topic between two offsets to a portable archive file, preserving their expiry times, timestamps, keys and headers. The archive can be imported into another topic using import",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+
+		flags := exportFlags
+		log := logger.NewWithLevel(ctx, logger.LogLevel(flags.logLevel))
+		log.Debugf("flags: %+v", flags)
+
+		broker, err := makeArchiveBroker(ctx, log, flags.ArchiveStorageFlags)
+		if err != nil {
+			return err
+		}
+
+		var w io.Writer = os.Stdout
+		if flags.output != "-" {
+			f, err := os.Create(flags.output)
+			if err != nil {
+				return fmt.Errorf("creating '%s': %w", flags.output, err)
+			}
+			defer f.Close()
+			w = f
+		}
+
+		bw := bufio.NewWriter(w)
+		result, err := broker.ExportRecords(ctx, flags.topicName, bw, flags.startOffset, flags.endOffset)
+		if err != nil {
+			return err
+		}
+
+		err = bw.Flush()
+		if err != nil {
+			return fmt.Errorf("writing archive: %w", err)
+		}
+
+		fmt.Fprintf(os.Stderr, "%s: exported %d records in %d record batches (%d expired records skipped)\n", flags.topicName, result.Records, result.RecordBatches, result.Expired)
+		return nil
+	},
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import records from an archive file into a topic",
+	Long:  "Add the records of an archive file written by export to a topic, giving them new offsets. Must not be run while a broker is serving the same topic",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+
+		flags := importFlags
+		log := logger.NewWithLevel(ctx, logger.LogLevel(flags.logLevel))
+		log.Debugf("flags: %+v", flags)
+
+		broker, err := makeArchiveBroker(ctx, log, flags.ArchiveStorageFlags)
+		if err != nil {
+			return err
+		}
+
+		var r io.Reader = os.Stdin
+		if flags.input != "-" {
+			f, err := os.Open(flags.input)
+			if err != nil {
+				return fmt.Errorf("opening '%s': %w", flags.input, err)
+			}
+			defer f.Close()
+			r = f
+		}
+
+		result, err := broker.ImportRecords(ctx, flags.topicName, bufio.NewReader(r))
+		if err != nil {
+			return err
+		}
+
+		if result.Records > 0 {
+			fmt.Fprintf(os.Stderr, "%s: imported %d records in %d record batches at offsets [%d;%d]\n", flags.topicName, result.Records, result.RecordBatches, result.FirstOffset, result.LastOffset)
+		} else {
+			fmt.Fprintf(os.Stderr, "%s: no records imported\n", flags.topicName)
+		}
+		return nil
+	},
+}
+
+// makeArchiveBroker returns a broker that reads and writes record batches
+// directly in the storage given by flags, writing each added batch as a
+// record batch of its own.
+func makeArchiveBroker(ctx context.Context, log logger.Logger, flags ArchiveStorageFlags) (*sebbroker.Broker, error) {
+	storage, err := makeStorage(ctx, log.Name("storage"), flags.StorageFlags)
+	if err != nil {
+		return nil, err
+	}
+
+	factoryOptFuncs := []func(*sebbroker.TopicFactoryOpts){}
+	if flags.encryptionKeyID != "" {
+		keyProvider, err := sebtopic.NewEnvKeyProvider(flags.encryptionKeyID, encryptionKeyEnvVar)
+		if err != nil {
+			return nil, fmt.Errorf("creating encryption key provider: %w", err)
+		}
+		factoryOptFuncs = append(factoryOptFuncs, sebbroker.WithKeyProvider(keyProvider))
+	}
+	if !flags.compress {
+		factoryOptFuncs = append(factoryOptFuncs, sebbroker.WithTopicOpts(sebtopic.WithCompress(nil)))
+	}
+
+	cache, err := sebcache.NewMemoryCache(log.Name("cache"))
+	if err != nil {
+		return nil, fmt.Errorf("creating cache: %w", err)
+	}
+
+	topicFactory := sebbroker.NewStorageTopicFactory(storage, cache, factoryOptFuncs...)
+	return sebbroker.New(log.Name("broker"), topicFactory, sebbroker.WithNullBatcher()), nil
+}
+
+// makeStorage returns the storage selected by flags.
+func makeStorage(ctx context.Context, log logger.Logger, flags StorageFlags) (sebtopic.Storage, error) {
+	storage, err := sebtopic.NewStorageByName(ctx, log, flags.storage, sebtopic.StorageConfig{
+		Dir:       flags.storageDir,
+		Bucket:    flags.s3BucketName,
+		Params:    flags.storageParams,
+		Endpoint:  flags.s3Endpoint,
+		PathStyle: flags.s3PathStyle,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating storage: %w", err)
+	}
+
+	_, err = sebtopic.CheckLayoutVersion(ctx, log, storage)
+	if err != nil {
+		return nil, fmt.Errorf("checking storage layout: %w", err)
+	}
+
+	return storage, nil
+}
+
+type StorageFlags struct {
+	storage       string
+	storageDir    string
+	storageParams map[string]string
+
+	s3BucketName string
+	s3Endpoint   string
+	s3PathStyle  bool
+}
+
+type ArchiveStorageFlags struct {
+	StorageFlags
+
+	logLevel int
+	compress bool
+
+	encryptionKeyID string
+}
+
+type ExportFlags struct {
+	ArchiveStorageFlags
+
+	topicName   string
+	startOffset uint64
+	endOffset   uint64
+	output      string
+}
+
+type ImportFlags struct {
+	ArchiveStorageFlags
+
+	topicName string
+	input     string
+}
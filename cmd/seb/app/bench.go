@@ -0,0 +1,252 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/micvbang/go-helpy/sizey"
+	"github.com/micvbang/go-helpy/syncy"
+	seb "github.com/micvbang/simple-event-broker"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/sebbench"
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/spf13/cobra"
+)
+
+var benchFlags BenchFlags
+
+func init() {
+	fs := benchCmd.Flags()
+
+	fs.IntVar(&benchFlags.logLevel, "log-level", int(logger.LevelWarn), "Log level, info=4, debug=5")
+	fs.StringVar(&benchFlags.topicName, "topic-name", "bench", "Name of topic to use for load generation")
+	fs.DurationVarP(&benchFlags.duration, "duration", "d", 30*time.Second, "Duration to generate load for")
+	fs.BoolVarP(&benchFlags.localBroker, "local-broker", "l", false, "Whether to start a broker only for this load generation")
+	fs.StringVar(&benchFlags.remoteBrokerAddress, "remote-broker-address", "http://localhost:51313", "Address of remote broker to connect to instead of starting local broker")
+	fs.StringVar(&benchFlags.remoteBrokerAPIKey, "remote-broker-api-key", "api-key", "API key to use for remote broker")
+
+	// producers
+	fs.IntVarP(&benchFlags.numProducers, "producers", "p", 4, "Number of concurrent producers")
+	fs.IntVar(&benchFlags.recordSize, "record-size", 1024, "Size of records in bytes")
+	fs.IntVar(&benchFlags.numRecordsPerBatch, "records-per-batch", 128, "Number of records each producer sends per request")
+
+	// consumers
+	fs.IntVarP(&benchFlags.numConsumers, "consumers", "c", 4, "Number of concurrent consumers. Each consumer reads all records added during load generation")
+	fs.IntVar(&benchFlags.numRecordsPerRequest, "records-per-request", 1024, "Maximum number of records each consumer requests at a time")
+
+	// local broker
+	fs.IntVar(&benchFlags.batchBytesMax, "batcher-max-bytes", 10*sizey.MB, "Maximum number of bytes to wait before committing incoming batch to storage")
+	fs.DurationVar(&benchFlags.batchBlockTime, "batcher-block-time", 5*time.Millisecond, "Maximum amount of time to wait before committing incoming batches to storage")
+}
+
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Generate load against broker",
+	Long:  "Generate load using concurrent producers and consumers, and report throughput and latency percentiles",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := benchFlags
+		log := logger.NewWithLevel(context.Background(), logger.LogLevel(flags.logLevel))
+
+		batchPool := syncy.NewPool(func() *sebrecords.Batch {
+			batch := sebrecords.NewBatch(make([]uint32, 0, flags.numRecordsPerRequest), make([]byte, 0, flags.batchBytesMax*2))
+			return &batch
+		})
+
+		var broker sebbench.Broker
+		if flags.localBroker {
+			broker = sebbench.NewLocalBroker(log, batchPool, flags.batchBlockTime, flags.batchBytesMax)
+		} else {
+			broker = &sebbench.RemoteBroker{
+				RemoteBrokerAddress: flags.remoteBrokerAddress,
+				RemoteBrokerAPIKey:  flags.remoteBrokerAPIKey,
+			}
+		}
+
+		client, err := broker.Start()
+		if err != nil {
+			return fmt.Errorf("starting broker: %w", err)
+		}
+		defer broker.Stop()
+
+		// consumers start reading from the topic's current end in order to
+		// only read records added during load generation.
+		topic, err := client.GetTopic(flags.topicName)
+		if err != nil {
+			log.Debugf("topic '%s' not found, reading from offset 0: %s", flags.topicName, err)
+		}
+		startOffset := topic.NextOffset
+
+		fmt.Printf("Generating load for %s using %d producers and %d consumers\n\n", flags.duration, flags.numProducers, flags.numConsumers)
+
+		ctx, cancel := context.WithTimeout(context.Background(), flags.duration)
+		defer cancel()
+
+		produceStats := benchStats{}
+		consumeStats := benchStats{}
+		producersDone := make(chan struct{})
+
+		wg := &sync.WaitGroup{}
+		t0 := time.Now()
+
+		producersWg := &sync.WaitGroup{}
+		producersWg.Add(flags.numProducers)
+		for producerID := range flags.numProducers {
+			go func() {
+				defer producersWg.Done()
+				benchProduce(ctx, log, client, flags, int64(producerID), &produceStats)
+			}()
+		}
+		go func() {
+			producersWg.Wait()
+			close(producersDone)
+		}()
+
+		wg.Add(flags.numConsumers)
+		for range flags.numConsumers {
+			go func() {
+				defer wg.Done()
+				benchConsume(log, client, flags, startOffset, producersDone, &consumeStats)
+			}()
+		}
+
+		<-producersDone
+		produceElapsed := time.Since(t0)
+		wg.Wait()
+		consumeElapsed := time.Since(t0)
+
+		fmt.Printf("Produce:\n%s\n", produceStats.String(produceElapsed))
+		fmt.Printf("Consume:\n%s\n", consumeStats.String(consumeElapsed))
+
+		fmt.Printf("Config:\n")
+		fmt.Printf("Producers:\t\t%d\n", flags.numProducers)
+		fmt.Printf("Consumers:\t\t%d\n", flags.numConsumers)
+		fmt.Printf("Record size:\t\t%s (%dB)\n", sizey.FormatBytes(flags.recordSize), flags.recordSize)
+		fmt.Printf("Records/batch:\t\t%d\n", flags.numRecordsPerBatch)
+		fmt.Printf("Records/request:\t%d\n", flags.numRecordsPerRequest)
+		if flags.localBroker {
+			fmt.Printf("Batch block time:\t%s\n", flags.batchBlockTime)
+			fmt.Printf("Batch bytes max:\t%s (%d)\n", sizey.FormatBytes(flags.batchBytesMax), flags.batchBytesMax)
+		}
+
+		return nil
+	},
+}
+
+// benchProduce adds batches of random records to flags.topicName until ctx
+// expires.
+func benchProduce(ctx context.Context, log logger.Logger, client *seb.RecordClient, flags BenchFlags, seed int64, stats *benchStats) {
+	randSource := rand.New(rand.NewSource(seed))
+
+	recordsData := make([]byte, flags.numRecordsPerBatch*flags.recordSize)
+	randSource.Read(recordsData)
+
+	recordSizes := make([]uint32, flags.numRecordsPerBatch)
+	for i := range recordSizes {
+		recordSizes[i] = uint32(flags.recordSize)
+	}
+
+	for ctx.Err() == nil {
+		t0 := time.Now()
+		err := client.AddRecords(flags.topicName, recordSizes, recordsData)
+		if err != nil {
+			log.Errorf("adding records: %s", err)
+			stats.errors.Add(1)
+			continue
+		}
+
+		stats.latencies.Record(time.Since(t0))
+		stats.records.Add(int64(len(recordSizes)))
+		stats.bytes.Add(int64(len(recordsData)))
+	}
+}
+
+// benchConsume reads records from flags.topicName, starting at offset, until
+// producersDone is closed and all records have been read.
+func benchConsume(log logger.Logger, client *seb.RecordClient, flags BenchFlags, offset uint64, producersDone <-chan struct{}, stats *benchStats) {
+	buf := make([]byte, 0, flags.numRecordsPerRequest*flags.recordSize)
+
+	for {
+		t0 := time.Now()
+		records, nextOffset, err := client.GetRecordsNextOffset(flags.topicName, offset, seb.GetRecordsInput{
+			MaxRecords: flags.numRecordsPerRequest,
+			Buffer:     buf,
+			Timeout:    100 * time.Millisecond,
+		})
+		// NOTE: reading from an empty topic returns ErrNotFound instead of
+		// waiting for records to be added.
+		if errors.Is(err, seberr.ErrNotFound) {
+			time.Sleep(10 * time.Millisecond)
+		} else if err != nil {
+			log.Errorf("reading records: %s", err)
+			stats.errors.Add(1)
+		}
+
+		if len(records) > 0 {
+			stats.latencies.Record(time.Since(t0))
+			stats.records.Add(int64(len(records)))
+			for _, record := range records {
+				stats.bytes.Add(int64(len(record)))
+			}
+		}
+
+		if nextOffset > offset {
+			offset = nextOffset
+			continue
+		}
+
+		// caught up; stop if there will be no more records
+		select {
+		case <-producersDone:
+			return
+		default:
+		}
+	}
+}
+
+type benchStats struct {
+	records   atomic.Int64
+	bytes     atomic.Int64
+	errors    atomic.Int64
+	latencies sebbench.LatencyRecorder
+}
+
+func (bs *benchStats) String(elapsed time.Duration) string {
+	return fmt.Sprintf(`took %v
+records/second: %.2f
+mbit/second: %.2f
+errors: %d
+request latency: %s
+`, elapsed,
+		float64(bs.records.Load())/elapsed.Seconds(),
+		float64(bs.bytes.Load()*8)/1024/1024/elapsed.Seconds(),
+		bs.errors.Load(),
+		bs.latencies.Summary().String(),
+	)
+}
+
+type BenchFlags struct {
+	logLevel int
+	duration time.Duration
+
+	topicName string
+
+	localBroker         bool
+	remoteBrokerAddress string
+	remoteBrokerAPIKey  string
+
+	numProducers       int
+	recordSize         int
+	numRecordsPerBatch int
+
+	numConsumers         int
+	numRecordsPerRequest int
+
+	batchBlockTime time.Duration
+	batchBytesMax  int
+}
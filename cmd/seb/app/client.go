@@ -1,6 +1,11 @@
 package app
 
 import (
+	"context"
+	"fmt"
+
+	seb "github.com/micvbang/simple-event-broker"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
 	"github.com/spf13/cobra"
 )
 
@@ -9,3 +14,33 @@ var clientCmd = &cobra.Command{
 	Short: "Use Seb client",
 	Long:  "Use Seb client to send requests to Seb instance",
 }
+
+// ClientFlags are the flags shared by client commands.
+type ClientFlags struct {
+	logLevel      int
+	brokerAddress string
+	brokerAPIKey  string
+}
+
+// addClientFlags adds the flags shared by client commands to cmd.
+func addClientFlags(cmd *cobra.Command, flags *ClientFlags) {
+	fs := cmd.Flags()
+
+	fs.IntVar(&flags.logLevel, "log-level", int(logger.LevelInfo), "Log level, info=4, debug=5")
+
+	// broker
+	fs.StringVar(&flags.brokerAddress, "remote-broker-address", "http://localhost:51313", "Address of remote broker to connect to")
+	fs.StringVar(&flags.brokerAPIKey, "remote-broker-api-key", "api-key", "API key to use for remote broker")
+}
+
+func (f ClientFlags) logger(ctx context.Context) logger.Logger {
+	return logger.NewWithLevel(ctx, logger.LogLevel(f.logLevel))
+}
+
+func (f ClientFlags) client() (*seb.RecordClient, error) {
+	client, err := seb.NewRecordClient(f.brokerAddress, f.brokerAPIKey)
+	if err != nil {
+		return nil, fmt.Errorf("creating client: %w", err)
+	}
+	return client, nil
+}
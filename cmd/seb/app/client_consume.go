@@ -0,0 +1,107 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/micvbang/go-helpy/sizey"
+	seb "github.com/micvbang/simple-event-broker"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/spf13/cobra"
+)
+
+var clientConsumeFlags ClientConsumeFlags
+
+func init() {
+	addClientFlags(clientConsumeCmd, &clientConsumeFlags.ClientFlags)
+
+	fs := clientConsumeCmd.Flags()
+	fs.StringVarP(&clientConsumeFlags.topicName, "topic-name", "t", "", "Name of topic to read records from")
+	fs.Uint64VarP(&clientConsumeFlags.offset, "offset", "o", 0, "Offset to start reading from")
+	fs.BoolVarP(&clientConsumeFlags.follow, "follow", "F", false, "Whether to keep waiting for new records once all existing records have been read")
+	fs.StringVarP(&clientConsumeFlags.delimiter, "delimiter", "d", "\n", "Delimiter to write after each record")
+	fs.BoolVar(&clientConsumeFlags.printOffsets, "print-offsets", false, "Whether to prefix each record with its offset. Offsets are approximate when expired records were skipped")
+	fs.IntVar(&clientConsumeFlags.maxRecords, "max-records", 128, "Maximum number of records to request at a time")
+	fs.IntVar(&clientConsumeFlags.softMaxBytes, "max-bytes", 5*sizey.MB, "Maximum bytes to request at a time")
+	fs.DurationVar(&clientConsumeFlags.timeout, "timeout", time.Second, "Maximum duration to wait for records in each request")
+
+	clientConsumeCmd.MarkFlagRequired("topic-name")
+}
+
+var clientConsumeCmd = &cobra.Command{
+	Use:   "consume",
+	Short: "Read records from topic",
+	Long:  "Read records from topic of Seb instance and write them to stdout. With --follow, keeps waiting for new records until interrupted",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		flags := clientConsumeFlags
+		log := flags.logger(ctx)
+
+		client, err := flags.client()
+		if err != nil {
+			return err
+		}
+
+		w := bufio.NewWriter(os.Stdout)
+		defer w.Flush()
+
+		buf := make([]byte, 0, flags.softMaxBytes)
+		offset := flags.offset
+		for ctx.Err() == nil {
+			records, nextOffset, err := client.GetRecordsNextOffset(flags.topicName, offset, seb.GetRecordsInput{
+				MaxRecords: flags.maxRecords,
+				Buffer:     buf,
+				Timeout:    flags.timeout,
+			})
+			if err != nil && !errors.Is(err, seberr.ErrNotFound) {
+				return fmt.Errorf("reading records from offset %d: %w", offset, err)
+			}
+
+			for i, record := range records {
+				if flags.printOffsets {
+					fmt.Fprintf(w, "%d\t", offset+uint64(i))
+				}
+				w.Write(record)
+				w.WriteString(flags.delimiter)
+			}
+			err = w.Flush()
+			if err != nil {
+				return fmt.Errorf("writing records: %w", err)
+			}
+
+			if nextOffset > offset {
+				log.Debugf("read %d records, skipped %d", len(records), nextOffset-offset-uint64(len(records)))
+				offset = nextOffset
+				continue
+			}
+
+			if !flags.follow {
+				break
+			}
+		}
+
+		log.Debugf("stopped at offset %d", offset)
+		return nil
+	},
+}
+
+type ClientConsumeFlags struct {
+	ClientFlags
+
+	topicName    string
+	offset       uint64
+	follow       bool
+	delimiter    string
+	printOffsets bool
+	maxRecords   int
+	softMaxBytes int
+	timeout      time.Duration
+}
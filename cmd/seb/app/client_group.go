@@ -0,0 +1,94 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	seb "github.com/micvbang/simple-event-broker"
+	"github.com/spf13/cobra"
+)
+
+var clientGroupResetOffsetsFlags ClientGroupResetOffsetsFlags
+
+func init() {
+	addClientFlags(clientGroupResetOffsetsCmd, &clientGroupResetOffsetsFlags.ClientFlags)
+
+	fs := clientGroupResetOffsetsCmd.Flags()
+	fs.StringVarP(&clientGroupResetOffsetsFlags.group, "group", "g", "", "Name of consumer group")
+	fs.StringVar(&clientGroupResetOffsetsFlags.to, "to", "", "What to reset offsets to: earliest, latest, offset or timestamp")
+	fs.Uint64Var(&clientGroupResetOffsetsFlags.offset, "offset", 0, "Offset to reset to, used by --to=offset")
+	fs.StringVar(&clientGroupResetOffsetsFlags.timestamp, "timestamp", "", "RFC3339 timestamp to reset to, used by --to=timestamp")
+	fs.StringSliceVarP(&clientGroupResetOffsetsFlags.topicNames, "topic-name", "t", nil, "Names of topics to reset offsets of. Defaults to all topics the group has committed offsets for")
+	fs.BoolVar(&clientGroupResetOffsetsFlags.dryRun, "dry-run", false, "Show the resulting lag without resetting offsets")
+
+	clientGroupResetOffsetsCmd.MarkFlagRequired("group")
+	clientGroupResetOffsetsCmd.MarkFlagRequired("to")
+
+	clientGroupCmd.AddCommand(clientGroupResetOffsetsCmd)
+}
+
+var clientGroupCmd = &cobra.Command{
+	Use:   "group",
+	Short: "Administrate consumer groups",
+	Long:  "Administrate consumer groups of Seb instance",
+}
+
+var clientGroupResetOffsetsCmd = &cobra.Command{
+	Use:   "reset-offsets",
+	Short: "Reset consumer group offsets",
+	Long:  "Reset the offsets committed by a consumer group to the earliest or latest offsets, a specific offset or a timestamp, and show the resulting lag. The group must not have any members",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := clientGroupResetOffsetsFlags
+
+		client, err := flags.client()
+		if err != nil {
+			return err
+		}
+
+		input := seb.ResetGroupOffsetsInput{
+			To:         flags.to,
+			Offset:     flags.offset,
+			TopicNames: flags.topicNames,
+			DryRun:     flags.dryRun,
+		}
+		if flags.timestamp != "" {
+			input.Timestamp, err = time.Parse(time.RFC3339Nano, flags.timestamp)
+			if err != nil {
+				return fmt.Errorf("parsing timestamp: %w", err)
+			}
+		}
+
+		output, err := client.ResetGroupOffsets(flags.group, input)
+		if err != nil {
+			return fmt.Errorf("resetting offsets of group '%s': %w", flags.group, err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "TOPIC\tOFFSET\tNEXT OFFSET\tLAG\n")
+		for _, lag := range output.Topics {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", lag.TopicName, lag.CommittedOffset, lag.NextOffset, lag.Lag)
+		}
+		err = w.Flush()
+		if err != nil {
+			return err
+		}
+
+		if output.DryRun {
+			fmt.Printf("dry run: offsets of group '%s' were not reset\n", output.Group)
+		}
+		return nil
+	},
+}
+
+type ClientGroupResetOffsetsFlags struct {
+	ClientFlags
+
+	group      string
+	to         string
+	offset     uint64
+	timestamp  string
+	topicNames []string
+	dryRun     bool
+}
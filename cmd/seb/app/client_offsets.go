@@ -0,0 +1,64 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var clientOffsetsFlags ClientOffsetsFlags
+
+func init() {
+	addClientFlags(clientOffsetsCmd, &clientOffsetsFlags.ClientFlags)
+
+	fs := clientOffsetsCmd.Flags()
+	fs.StringSliceVarP(&clientOffsetsFlags.topicNames, "topic-name", "t", nil, "Names of topics to show offsets of. Defaults to all topics")
+}
+
+var clientOffsetsCmd = &cobra.Command{
+	Use:   "offsets",
+	Short: "Show topic offsets",
+	Long:  "Show the next offset and latest commit time of topics on Seb instance",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := clientOffsetsFlags
+
+		client, err := flags.client()
+		if err != nil {
+			return err
+		}
+
+		topicNames := flags.topicNames
+		if len(topicNames) == 0 {
+			topicNames, err = client.ListTopics()
+			if err != nil {
+				return fmt.Errorf("listing topics: %w", err)
+			}
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "TOPIC\tNEXT OFFSET\tLATEST COMMIT\n")
+		for _, topicName := range topicNames {
+			topic, err := client.GetTopic(topicName)
+			if err != nil {
+				return fmt.Errorf("getting topic '%s': %w", topicName, err)
+			}
+
+			latestCommit := "-"
+			if !topic.LastInsertTime.IsZero() {
+				latestCommit = topic.LastInsertTime.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\n", topicName, topic.NextOffset, latestCommit)
+		}
+
+		return w.Flush()
+	},
+}
+
+type ClientOffsetsFlags struct {
+	ClientFlags
+
+	topicNames []string
+}
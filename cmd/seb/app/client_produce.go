@@ -0,0 +1,148 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/micvbang/go-helpy/sizey"
+	"github.com/spf13/cobra"
+)
+
+var clientProduceFlags ClientProduceFlags
+
+func init() {
+	addClientFlags(clientProduceCmd, &clientProduceFlags.ClientFlags)
+
+	fs := clientProduceCmd.Flags()
+	fs.StringVarP(&clientProduceFlags.topicName, "topic-name", "t", "", "Name of topic to add records to")
+	fs.StringVarP(&clientProduceFlags.path, "file", "f", "", "Path to file to read records from. Defaults to stdin")
+	fs.StringVarP(&clientProduceFlags.delimiter, "delimiter", "d", "\n", "Delimiter between records. If empty, all of the input is added as a single record")
+	fs.IntVar(&clientProduceFlags.batchRecords, "batch-records", 128, "Maximum number of records to send in each request. Records are sent once this many have been read, or when the input ends")
+	fs.IntVar(&clientProduceFlags.maxRecordBytes, "max-record-bytes", 10*sizey.MB, "Maximum size of a single record")
+
+	clientProduceCmd.MarkFlagRequired("topic-name")
+}
+
+var clientProduceCmd = &cobra.Command{
+	Use:   "produce",
+	Short: "Add records to topic",
+	Long:  "Add records read from stdin or a file to topic of Seb instance",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := clientProduceFlags
+		log := flags.logger(context.Background())
+
+		client, err := flags.client()
+		if err != nil {
+			return err
+		}
+
+		input := io.Reader(os.Stdin)
+		if flags.path != "" {
+			f, err := os.Open(flags.path)
+			if err != nil {
+				return fmt.Errorf("opening input file: %w", err)
+			}
+			defer f.Close()
+			input = f
+		}
+
+		if flags.delimiter == "" {
+			record, err := io.ReadAll(io.LimitReader(input, int64(flags.maxRecordBytes)+1))
+			if err != nil {
+				return fmt.Errorf("reading input: %w", err)
+			}
+			if len(record) > flags.maxRecordBytes {
+				return fmt.Errorf("record exceeds %s", sizey.FormatBytes(flags.maxRecordBytes))
+			}
+
+			return client.AddRecords(flags.topicName, []uint32{uint32(len(record))}, record)
+		}
+
+		scanner := bufio.NewScanner(input)
+		scanner.Buffer(make([]byte, 0, 64*sizey.KB), flags.maxRecordBytes)
+		scanner.Split(splitDelimiter([]byte(flags.delimiter)))
+
+		numRecords := 0
+		produce := func(recordSizes []uint32, recordsData []byte) error {
+			if len(recordSizes) == 0 {
+				return nil
+			}
+
+			err := client.AddRecords(flags.topicName, recordSizes, recordsData)
+			if err != nil {
+				return fmt.Errorf("adding records: %w", err)
+			}
+			numRecords += len(recordSizes)
+			log.Debugf("added %d records", len(recordSizes))
+			return nil
+		}
+
+		recordSizes := make([]uint32, 0, flags.batchRecords)
+		recordsData := make([]byte, 0, 64*sizey.KB)
+		for scanner.Scan() {
+			record := scanner.Bytes()
+			if len(record) == 0 {
+				continue
+			}
+
+			recordSizes = append(recordSizes, uint32(len(record)))
+			recordsData = append(recordsData, record...)
+
+			if len(recordSizes) >= flags.batchRecords {
+				err := produce(recordSizes, recordsData)
+				if err != nil {
+					return err
+				}
+				recordSizes = recordSizes[:0]
+				recordsData = recordsData[:0]
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("reading input: %w", err)
+		}
+
+		err = produce(recordSizes, recordsData)
+		if err != nil {
+			return err
+		}
+
+		log.Infof("added %d records to '%s'", numRecords, flags.topicName)
+		return nil
+	},
+}
+
+// splitDelimiter returns a bufio.SplitFunc that splits input on delimiter,
+// dropping the delimiter.
+func splitDelimiter(delimiter []byte) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+
+		i := bytes.Index(data, delimiter)
+		if i >= 0 {
+			return i + len(delimiter), data[:i], nil
+		}
+
+		if atEOF {
+			return len(data), data, nil
+		}
+
+		// request more data
+		return 0, nil, nil
+	}
+}
+
+type ClientProduceFlags struct {
+	ClientFlags
+
+	topicName      string
+	path           string
+	delimiter      string
+	batchRecords   int
+	maxRecordBytes int
+}
@@ -0,0 +1,180 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	seb "github.com/micvbang/simple-event-broker"
+	"github.com/spf13/cobra"
+)
+
+var clientTopicFlags ClientTopicFlags
+
+func init() {
+	for _, cmd := range []*cobra.Command{clientTopicCreateCmd, clientTopicDeleteCmd, clientTopicListCmd, clientTopicApplyCmd} {
+		addClientFlags(cmd, &clientTopicFlags.ClientFlags)
+	}
+
+	for _, cmd := range []*cobra.Command{clientTopicCreateCmd, clientTopicDeleteCmd} {
+		cmd.Flags().StringVarP(&clientTopicFlags.topicName, "topic-name", "t", "", "Name of topic")
+		cmd.MarkFlagRequired("topic-name")
+	}
+
+	clientTopicCmd.AddCommand(clientTopicCreateCmd)
+	clientTopicCmd.AddCommand(clientTopicDeleteCmd)
+	clientTopicCmd.AddCommand(clientTopicListCmd)
+
+	fs := clientTopicApplyCmd.Flags()
+	fs.StringVarP(&clientTopicFlags.specFile, "file", "f", "", "Path of JSON file declaring topics, e.g. {\"topics\": [{\"name\": \"orders\", \"retention\": \"24h\", \"labels\": {\"team\": \"a\"}}]}")
+	fs.BoolVar(&clientTopicFlags.prune, "prune", false, "Delete topics that aren't declared in file")
+	fs.BoolVar(&clientTopicFlags.dryRun, "dry-run", false, "Print the changes that would be made without making them")
+	clientTopicApplyCmd.MarkFlagRequired("file")
+	clientTopicCmd.AddCommand(clientTopicApplyCmd)
+}
+
+var clientTopicCmd = &cobra.Command{
+	Use:   "topic",
+	Short: "Administrate topics",
+	Long:  "Create, delete and list topics of Seb instance",
+}
+
+var clientTopicCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create topic",
+	Long:  "Create topic on Seb instance",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := clientTopicFlags.client()
+		if err != nil {
+			return err
+		}
+
+		err = client.CreateTopic(clientTopicFlags.topicName)
+		if err != nil {
+			return fmt.Errorf("creating topic '%s': %w", clientTopicFlags.topicName, err)
+		}
+
+		fmt.Printf("created topic '%s'\n", clientTopicFlags.topicName)
+		return nil
+	},
+}
+
+var clientTopicDeleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Delete topic",
+	Long:  "Delete topic, including all of its records, on Seb instance",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := clientTopicFlags.client()
+		if err != nil {
+			return err
+		}
+
+		err = client.DeleteTopic(clientTopicFlags.topicName)
+		if err != nil {
+			return fmt.Errorf("deleting topic '%s': %w", clientTopicFlags.topicName, err)
+		}
+
+		fmt.Printf("deleted topic '%s'\n", clientTopicFlags.topicName)
+		return nil
+	},
+}
+
+var clientTopicListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List topics",
+	Long:  "List topics that were created or used since Seb instance started",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log := clientTopicFlags.logger(context.Background())
+
+		client, err := clientTopicFlags.client()
+		if err != nil {
+			return err
+		}
+
+		topicNames, err := client.ListTopics()
+		if err != nil {
+			return fmt.Errorf("listing topics: %w", err)
+		}
+		log.Debugf("found %d topics", len(topicNames))
+
+		for _, topicName := range topicNames {
+			fmt.Println(topicName)
+		}
+		return nil
+	},
+}
+
+var clientTopicApplyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Provision topics declaratively",
+	Long:  "Reconcile topics of Seb instance with the topics declared in a file: create missing topics, update their configuration and optionally delete topics that aren't declared",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		bs, err := os.ReadFile(clientTopicFlags.specFile)
+		if err != nil {
+			return fmt.Errorf("reading file: %w", err)
+		}
+
+		input := seb.ProvisionTopicsInput{}
+		err = json.Unmarshal(bs, &input)
+		if err != nil {
+			return fmt.Errorf("parsing file '%s': %w", clientTopicFlags.specFile, err)
+		}
+		input.Prune = clientTopicFlags.prune
+		input.DryRun = clientTopicFlags.dryRun
+
+		client, err := clientTopicFlags.client()
+		if err != nil {
+			return err
+		}
+
+		output, err := client.ProvisionTopics(input)
+		if err != nil {
+			return fmt.Errorf("provisioning topics: %w", err)
+		}
+
+		prefix := ""
+		if output.DryRun {
+			prefix = "(dry run) "
+		}
+		for _, change := range []struct {
+			verb       string
+			topicNames []string
+		}{
+			{"created", output.Created},
+			{"updated", output.Updated},
+			{"unchanged", output.Unchanged},
+			{"deleted", output.Deleted},
+		} {
+			for _, topicName := range change.topicNames {
+				fmt.Printf("%s%s topic '%s'\n", prefix, change.verb, topicName)
+			}
+		}
+
+		if len(output.Errors) > 0 {
+			topicNames := make([]string, 0, len(output.Errors))
+			for topicName := range output.Errors {
+				topicNames = append(topicNames, topicName)
+			}
+			slices.Sort(topicNames)
+
+			for _, topicName := range topicNames {
+				fmt.Printf("%sfailed topic '%s': %s\n", prefix, topicName, output.Errors[topicName])
+			}
+			return fmt.Errorf("failed to provision %d topics", len(output.Errors))
+		}
+
+		return nil
+	},
+}
+
+type ClientTopicFlags struct {
+	ClientFlags
+
+	topicName string
+
+	specFile string
+	prune    bool
+	dryRun   bool
+}
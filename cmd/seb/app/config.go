@@ -0,0 +1,406 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// serveConfig is the configuration file of the http-server command, given by
+// --config. Its settings are used for the flags that aren't given on the
+// command line; see flagValues for the flag of each setting. Settings that
+// aren't set keep the flag's default.
+//
+// Log level, quotas and topic settings are applied again when the file is
+// reloaded; see configReloader.
+type serveConfig struct {
+	LogLevel  *int    `yaml:"log_level"`
+	LogFormat *string `yaml:"log_format"`
+
+	HTTP struct {
+		Address     *string `yaml:"address"`
+		Port        *int    `yaml:"port"`
+		Connections *int    `yaml:"connections"`
+	} `yaml:"http"`
+
+	Auth struct {
+		APIKey              *string `yaml:"api_key"`
+		AdminAPIKey         *string `yaml:"admin_api_key"`
+		APIKeyGrantsFile    *string `yaml:"api_key_grants_file"`
+		OIDCIssuer          *string `yaml:"oidc_issuer"`
+		OIDCAudience        *string `yaml:"oidc_audience"`
+		OIDCClaimGrantsFile *string `yaml:"oidc_claim_grants_file"`
+		TLSCertFile         *string `yaml:"tls_cert"`
+		TLSKeyFile          *string `yaml:"tls_key"`
+		TLSClientCAFile     *string `yaml:"tls_client_ca"`
+	} `yaml:"auth"`
+
+	Storage struct {
+		Backend      *string           `yaml:"backend"`
+		Dir          *string           `yaml:"dir"`
+		S3Bucket     *string           `yaml:"s3_bucket"`
+		S3Endpoint   *string           `yaml:"s3_endpoint"`
+		S3PathStyle  *bool             `yaml:"s3_path_style"`
+		S3StagingDir *string           `yaml:"s3_staging_dir"`
+		Params       map[string]string `yaml:"params"`
+	} `yaml:"storage"`
+
+	Cache struct {
+		Storage          *string        `yaml:"storage"`
+		Dir              *string        `yaml:"dir"`
+		Size             *int64         `yaml:"size"`
+		MaintenanceSize  *int64         `yaml:"maintenance_size"`
+		EvictionInterval *time.Duration `yaml:"eviction_interval"`
+		MaxItemSize      *int64         `yaml:"max_item_size"`
+		TailBatches      *int           `yaml:"tail_batches"`
+		TopicSize        *int64         `yaml:"topic_size"`
+	} `yaml:"cache"`
+
+	Batch struct {
+		WaitTime          *time.Duration `yaml:"wait_time"`
+		IdleTime          *time.Duration `yaml:"idle_time"`
+		BytesSoftMax      *int           `yaml:"bytes_soft_max"`
+		BytesHardMax      *int           `yaml:"bytes_hard_max"`
+		RecordsHardMax    *int           `yaml:"records_hard_max"`
+		PendingBytesMax   *int           `yaml:"pending_bytes_max"`
+		PendingRecordsMax *int           `yaml:"pending_records_max"`
+		PendingTimeout    *time.Duration `yaml:"pending_timeout"`
+		Compress          *bool          `yaml:"compress"`
+		DedupWindow       *time.Duration `yaml:"dedup_window"`
+	} `yaml:"batch"`
+
+	RetentionInterval *time.Duration `yaml:"retention_interval"`
+
+	// QuotasFile and Quotas are both enforced.
+	QuotasFile *string            `yaml:"quotas_file"`
+	Quotas     []serveConfigQuota `yaml:"quotas"`
+	Topics     []serveConfigTopic `yaml:"topics"`
+}
+
+type serveConfigQuota struct {
+	Namespace           string `yaml:"namespace"`
+	Principal           string `yaml:"principal"`
+	ProducedBytesPerDay int64  `yaml:"produced_bytes_per_day"`
+	RetainedBytes       int64  `yaml:"retained_bytes"`
+}
+
+// serveConfigTopic overrides the settings of a single topic. Retention and
+// labels are set using Broker.SetTopicRetention and Broker.SetTopicLabels, and
+// CacheSize limits the topic's use of the cache, like --cache-topic-quota.
+type serveConfigTopic struct {
+	Name      string            `yaml:"name"`
+	Retention time.Duration     `yaml:"retention"`
+	Labels    map[string]string `yaml:"labels"`
+	CacheSize int64             `yaml:"cache_size"`
+}
+
+// runtimeFlags are the flags whose config file settings are applied when the
+// config file is reloaded.
+var runtimeFlags = map[string]bool{
+	"log-level":   true,
+	"quotas-file": true,
+}
+
+// parseServeConfig parses a YAML config file of the http-server command.
+// Unknown settings are rejected, such that typos aren't silently ignored.
+func parseServeConfig(bs []byte) (serveConfig, error) {
+	config := serveConfig{}
+
+	dec := yaml.NewDecoder(bytes.NewReader(bs))
+	dec.KnownFields(true)
+	err := dec.Decode(&config)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return serveConfig{}, fmt.Errorf("parsing config: %w", err)
+	}
+
+	topicNames := make(map[string]struct{}, len(config.Topics))
+	for i, topic := range config.Topics {
+		if topic.Name == "" {
+			return serveConfig{}, fmt.Errorf("topic %d: name must be given", i)
+		}
+		if _, ok := topicNames[topic.Name]; ok {
+			return serveConfig{}, fmt.Errorf("topic '%s' is given more than once", topic.Name)
+		}
+		if topic.Retention < 0 || topic.CacheSize < 0 {
+			return serveConfig{}, fmt.Errorf("topic '%s': settings must not be negative", topic.Name)
+		}
+		topicNames[topic.Name] = struct{}{}
+	}
+
+	return config, nil
+}
+
+// readServeConfig reads and parses the config file at path.
+func readServeConfig(path string) (serveConfig, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return serveConfig{}, fmt.Errorf("reading config file: %w", err)
+	}
+
+	return parseServeConfig(bs)
+}
+
+// flagValues returns the values of the flags set by config, by flag name.
+func (c serveConfig) flagValues() map[string]string {
+	values := map[string]string{}
+
+	setFlagValue(values, "log-level", c.LogLevel)
+	setFlagValue(values, "log-format", c.LogFormat)
+
+	setFlagValue(values, "http-address", c.HTTP.Address)
+	setFlagValue(values, "http-port", c.HTTP.Port)
+	setFlagValue(values, "http-connections", c.HTTP.Connections)
+
+	setFlagValue(values, "http-api-key", c.Auth.APIKey)
+	setFlagValue(values, "http-admin-api-key", c.Auth.AdminAPIKey)
+	setFlagValue(values, "http-api-key-grants-file", c.Auth.APIKeyGrantsFile)
+	setFlagValue(values, "http-oidc-issuer", c.Auth.OIDCIssuer)
+	setFlagValue(values, "http-oidc-audience", c.Auth.OIDCAudience)
+	setFlagValue(values, "http-oidc-claim-grants-file", c.Auth.OIDCClaimGrantsFile)
+	setFlagValue(values, "http-tls-cert", c.Auth.TLSCertFile)
+	setFlagValue(values, "http-tls-key", c.Auth.TLSKeyFile)
+	setFlagValue(values, "http-tls-client-ca", c.Auth.TLSClientCAFile)
+
+	setFlagValue(values, "storage", c.Storage.Backend)
+	setFlagValue(values, "storage-dir", c.Storage.Dir)
+	setFlagValue(values, "s3-bucket", c.Storage.S3Bucket)
+	setFlagValue(values, "s3-endpoint", c.Storage.S3Endpoint)
+	setFlagValue(values, "s3-path-style", c.Storage.S3PathStyle)
+	setFlagValue(values, "s3-staging-dir", c.Storage.S3StagingDir)
+	setMapFlagValue(values, "storage-param", c.Storage.Params)
+
+	setFlagValue(values, "cache-storage", c.Cache.Storage)
+	setFlagValue(values, "cache-dir", c.Cache.Dir)
+	setFlagValue(values, "cache-size", c.Cache.Size)
+	setFlagValue(values, "cache-maintenance-size", c.Cache.MaintenanceSize)
+	setFlagValue(values, "cache-eviction-interval", c.Cache.EvictionInterval)
+	setFlagValue(values, "cache-max-item-size", c.Cache.MaxItemSize)
+	setFlagValue(values, "cache-tail-batches", c.Cache.TailBatches)
+	setFlagValue(values, "cache-topic-size", c.Cache.TopicSize)
+
+	cacheTopicQuotas := map[string]int64{}
+	for _, topic := range c.Topics {
+		if topic.CacheSize > 0 {
+			cacheTopicQuotas[topic.Name] = topic.CacheSize
+		}
+	}
+	setMapFlagValue(values, "cache-topic-quota", cacheTopicQuotas)
+
+	setFlagValue(values, "batch-wait-time", c.Batch.WaitTime)
+	setFlagValue(values, "batch-idle-time", c.Batch.IdleTime)
+	setFlagValue(values, "batch-bytes-soft-max", c.Batch.BytesSoftMax)
+	setFlagValue(values, "batch-bytes-hard-max", c.Batch.BytesHardMax)
+	setFlagValue(values, "batch-records-hard-max", c.Batch.RecordsHardMax)
+	setFlagValue(values, "batch-pending-bytes-max", c.Batch.PendingBytesMax)
+	setFlagValue(values, "batch-pending-records-max", c.Batch.PendingRecordsMax)
+	setFlagValue(values, "batch-pending-timeout", c.Batch.PendingTimeout)
+	setFlagValue(values, "batch-compress", c.Batch.Compress)
+	setFlagValue(values, "dedup-window", c.Batch.DedupWindow)
+
+	setFlagValue(values, "retention-interval", c.RetentionInterval)
+	setFlagValue(values, "quotas-file", c.QuotasFile)
+
+	return values
+}
+
+func setFlagValue[T any](values map[string]string, name string, v *T) {
+	if v != nil {
+		values[name] = fmt.Sprint(*v)
+	}
+}
+
+// setMapFlagValue sets the value of a flag of key=value pairs, e.g.
+// --storage-param.
+func setMapFlagValue[T any](values map[string]string, name string, m map[string]T) {
+	if len(m) == 0 {
+		return
+	}
+
+	pairs := make([]string, 0, len(m))
+	for key, value := range m {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", key, value))
+	}
+	sort.Strings(pairs)
+	values[name] = strings.Join(pairs, ",")
+}
+
+// applyServeConfig sets the flags of fs that are set by config, unless they
+// were given on the command line.
+func applyServeConfig(fs *pflag.FlagSet, config serveConfig) error {
+	for name, value := range config.flagValues() {
+		if fs.Changed(name) {
+			continue
+		}
+
+		err := fs.Set(name, value)
+		if err != nil {
+			return fmt.Errorf("setting %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// loadQuotas returns the quotas of quotasFile, if given, and of config.
+func loadQuotas(quotasFile string, config serveConfig) ([]sebbroker.Quota, error) {
+	var quotas []sebbroker.Quota
+	if quotasFile != "" {
+		bs, err := os.ReadFile(quotasFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading quotas file: %w", err)
+		}
+
+		quotas, err = sebbroker.ParseQuotas(bs)
+		if err != nil {
+			return nil, fmt.Errorf("parsing quotas file: %w", err)
+		}
+	}
+
+	for _, quota := range config.Quotas {
+		quotas = append(quotas, sebbroker.Quota{
+			Namespace:           quota.Namespace,
+			Principal:           quota.Principal,
+			ProducedBytesPerDay: quota.ProducedBytesPerDay,
+			RetainedBytes:       quota.RetainedBytes,
+		})
+	}
+
+	return quotas, nil
+}
+
+// applyTopicConfigs sets the retention and labels of the topics of config,
+// and resets the retention and removes the labels of the topics of previous
+// that config no longer sets.
+func applyTopicConfigs(broker *sebbroker.Broker, previous []serveConfigTopic, config []serveConfigTopic) {
+	topics := make(map[string]serveConfigTopic, len(config))
+	for _, topic := range config {
+		topics[topic.Name] = topic
+	}
+
+	for _, old := range previous {
+		topic := topics[old.Name]
+
+		removedLabels := map[string]string{}
+		for key := range old.Labels {
+			if _, ok := topic.Labels[key]; !ok {
+				removedLabels[key] = ""
+			}
+		}
+		if len(removedLabels) > 0 {
+			broker.SetTopicLabels(old.Name, removedLabels)
+		}
+
+		if _, ok := topics[old.Name]; !ok && old.Retention > 0 {
+			broker.SetTopicRetention(old.Name, 0)
+		}
+	}
+
+	for _, topic := range config {
+		broker.SetTopicRetention(topic.Name, topic.Retention)
+		if len(topic.Labels) > 0 {
+			broker.SetTopicLabels(topic.Name, topic.Labels)
+		}
+	}
+}
+
+// configReloader reloads the config file and quotas file of the http-server
+// command, applying the settings that can be changed at runtime: log level,
+// quotas, and the retention and labels of topics. Other settings are only
+// applied on restart.
+type configReloader struct {
+	log      logger.Logger
+	path     string
+	logLevel *logger.LevelVar
+	broker   *sebbroker.Broker
+
+	// cmdLine holds the names of the flags given on the command line, which
+	// take precedence over the config file.
+	cmdLine map[string]bool
+
+	// quotasFile is the quotas file given on the command line, if any.
+	quotasFile string
+
+	mu     sync.Mutex
+	config serveConfig
+}
+
+// ReloadConfig reloads the config file, if any, and the quotas file. Nothing
+// is applied if either is invalid.
+func (r *configReloader) ReloadConfig() ([]string, []string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	config := serveConfig{}
+	if r.path != "" {
+		var err error
+		config, err = readServeConfig(r.path)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	quotasFile := r.quotasFile
+	if !r.cmdLine["quotas-file"] && config.QuotasFile != nil {
+		quotasFile = *config.QuotasFile
+	}
+	quotas, err := loadQuotas(quotasFile, config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = r.broker.SetQuotas(quotas)
+	if err != nil {
+		return nil, nil, err
+	}
+	applied := []string{"quotas"}
+
+	if !r.cmdLine["log-level"] && config.LogLevel != nil {
+		level := logger.LogLevel(*config.LogLevel)
+		r.log.Infof("setting log level: %s", level)
+		r.logLevel.Set(level)
+		applied = append(applied, "log-level")
+	}
+
+	applyTopicConfigs(r.broker, r.config.Topics, config.Topics)
+	applied = append(applied, "topics")
+
+	restartRequired := changedFlags(r.config.flagValues(), config.flagValues())
+	restartRequired = slices.DeleteFunc(restartRequired, func(name string) bool {
+		return runtimeFlags[name] || r.cmdLine[name]
+	})
+	for _, name := range restartRequired {
+		r.log.Warnf("config setting of --%s changed; it's applied on restart", name)
+	}
+
+	r.config = config
+	return applied, restartRequired, nil
+}
+
+// changedFlags returns the sorted names of the flags whose values differ
+// between old and new.
+func changedFlags(old map[string]string, new map[string]string) []string {
+	changed := []string{}
+	for name, value := range old {
+		if newValue, ok := new[name]; !ok || newValue != value {
+			changed = append(changed, name)
+		}
+	}
+	for name := range new {
+		if _, ok := old[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/spf13/cobra"
+)
+
+var migrateFlags MigrateFlags
+
+func init() {
+	fs := migrateCmd.Flags()
+
+	fs.IntVar(&migrateFlags.logLevel, "log-level", int(logger.LevelInfo), "Log level, info=4, debug=5")
+
+	fs.StringSliceVar(&migrateFlags.topicNames, "topic", nil, "Names of topics to migrate")
+	fs.StringVar(&migrateFlags.dstPrefix, "dst-prefix", "", "Prefix to add to the names of topics that record batches are written to. Record batches are rewritten in place if empty")
+	fs.IntVar(&migrateFlags.version, "version", sebrecords.FileFormatVersionLatest, "File format version to migrate record batches to")
+	fs.BoolVar(&migrateFlags.compress, "batch-compress", true, "Whether record batches are compressed in storage. Must match the broker's --batch-compress")
+
+	// storage
+	fs.StringVar(&migrateFlags.storage, "storage", "s3", fmt.Sprintf("Storage that record batches are kept in, one of: %s", strings.Join(sebtopic.StorageNames(), ", ")))
+	fs.StringVar(&migrateFlags.storageDir, "storage-dir", "", "Local dir that record batches are kept in when using disk storage")
+	fs.StringToStringVar(&migrateFlags.storageParams, "storage-param", nil, "Storage specific configuration, e.g. for storage registered by other modules")
+	fs.StringVar(&migrateFlags.s3BucketName, "s3-bucket", "", "Bucket name. Required when using s3 or minio storage")
+	fs.StringVar(&migrateFlags.s3Endpoint, "s3-endpoint", "", "URL of an S3 compatible service, e.g. MinIO or Ceph. Required when using minio storage")
+	fs.BoolVar(&migrateFlags.s3PathStyle, "s3-path-style", false, "Whether to address buckets using path-style URLs. Always enabled for minio storage")
+
+	// encryption
+	fs.StringVar(&migrateFlags.encryptionKeyID, "encryption-key-id", "", "ID of the key used to encrypt record batches. The hex encoded key is read from the environment variable SEB_ENCRYPTION_KEY. Encryption is disabled if empty")
+
+	migrateCmd.MarkFlagRequired("topic")
+}
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Migrate record batches to a newer file format version",
+	Long:  "Rewrite record batches of topics using a newer file format version, either in place or into topics with a new prefix. Must not be run while a broker is merging record batches of the same topics",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+
+		flags := migrateFlags
+		log := logger.NewWithLevel(ctx, logger.LogLevel(flags.logLevel))
+		log.Debugf("flags: %+v", flags)
+
+		storage, err := sebtopic.NewStorageByName(ctx, log.Name("storage"), flags.storage, sebtopic.StorageConfig{
+			Dir:       flags.storageDir,
+			Bucket:    flags.s3BucketName,
+			Params:    flags.storageParams,
+			Endpoint:  flags.s3Endpoint,
+			PathStyle: flags.s3PathStyle,
+		})
+		if err != nil {
+			return fmt.Errorf("creating storage: %w", err)
+		}
+
+		_, err = sebtopic.CheckLayoutVersion(ctx, log.Name("storage"), storage)
+		if err != nil {
+			return fmt.Errorf("checking storage layout: %w", err)
+		}
+
+		if flags.encryptionKeyID != "" {
+			keyProvider, err := sebtopic.NewEnvKeyProvider(flags.encryptionKeyID, encryptionKeyEnvVar)
+			if err != nil {
+				return fmt.Errorf("creating encryption key provider: %w", err)
+			}
+			storage = sebtopic.NewEncryptedStorage(storage, keyProvider)
+		}
+
+		var compress sebtopic.Compress
+		if flags.compress {
+			compress = sebtopic.Gzip{}
+		}
+
+		for _, topicName := range flags.topicNames {
+			optFns := []func(*sebtopic.MigrateOpts){
+				sebtopic.MigrateVersion(int16(flags.version)),
+				sebtopic.MigrateCompress(compress),
+			}
+			if flags.dstPrefix != "" {
+				optFns = append(optFns, sebtopic.MigrateDstTopic(flags.dstPrefix+topicName))
+			}
+
+			result, err := sebtopic.Migrate(ctx, log.Name("migrate"), storage, topicName, optFns...)
+			if err != nil {
+				return fmt.Errorf("migrating topic '%s': %w", topicName, err)
+			}
+
+			fmt.Printf("%s: migrated %d/%d record batches (%d records)\n", topicName, result.Migrated, result.RecordBatches, result.Records)
+		}
+
+		return nil
+	},
+}
+
+type MigrateFlags struct {
+	logLevel int
+
+	topicNames []string
+	dstPrefix  string
+	version    int
+	compress   bool
+
+	storage       string
+	storageDir    string
+	storageParams map[string]string
+
+	s3BucketName string
+	s3Endpoint   string
+	s3PathStyle  bool
+
+	encryptionKeyID string
+}
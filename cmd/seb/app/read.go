@@ -91,7 +91,7 @@ var readCmd = &cobra.Command{
 
 		batch := sebrecords.NewBatch(make([]uint32, 0, p.Header.NumRecords), make([]byte, 0, fi.Size()))
 		fileSize := fi.Size()
-		headerSize := p.Header.Size()
+		headerSize := p.DataOffset()
 		dataSize := fileSize - int64(headerSize)
 		fmt.Printf("Total file size:\t%v (%v B)\n", sizey.FormatBytes(fileSize), fileSize)
 		fmt.Printf("Header size:\t\t%v (%d B)\n", sizey.FormatBytes(headerSize), headerSize)
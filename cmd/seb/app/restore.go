@@ -0,0 +1,78 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/spf13/cobra"
+)
+
+var restoreFlags RestoreFlags
+
+func init() {
+	fs := restoreCmd.Flags()
+	fs.IntVar(&restoreFlags.logLevel, "log-level", int(logger.LevelInfo), "Log level, info=4, debug=5")
+	fs.StringVar(&restoreFlags.manifest, "manifest", "-", "Path of the snapshot manifest returned by POST /admin/snapshot, or - for stdin")
+	addStorageFlags(fs, "", "Source: ", &restoreFlags.src)
+	addStorageFlags(fs, "dst-", "Destination: ", &restoreFlags.dst)
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restore a snapshot to fresh storage",
+	Long:  "Copy the files of the topics in a snapshot manifest, as returned by POST /admin/snapshot, from the storage they were snapshotted in to fresh storage. Files are copied as is, so encrypted record batches must be read using the same key after they've been restored",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+
+		flags := restoreFlags
+		log := logger.NewWithLevel(ctx, logger.LogLevel(flags.logLevel))
+		log.Debugf("flags: %+v", flags)
+
+		var r io.Reader = os.Stdin
+		if flags.manifest != "-" {
+			f, err := os.Open(flags.manifest)
+			if err != nil {
+				return fmt.Errorf("opening '%s': %w", flags.manifest, err)
+			}
+			defer f.Close()
+			r = f
+		}
+
+		snapshot := sebbroker.Snapshot{}
+		err := json.NewDecoder(r).Decode(&snapshot)
+		if err != nil {
+			return fmt.Errorf("parsing manifest: %w", err)
+		}
+
+		src, err := makeStorage(ctx, log.Name("source storage"), flags.src)
+		if err != nil {
+			return err
+		}
+
+		dst, err := makeStorage(ctx, log.Name("destination storage"), flags.dst)
+		if err != nil {
+			return err
+		}
+
+		result, err := sebbroker.RestoreSnapshot(ctx, src, dst, snapshot)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "restored %d topics (%d files, %d bytes) of snapshot made at %s\n", result.Topics, result.Files, result.Bytes, snapshot.CreatedAt)
+		return nil
+	},
+}
+
+type RestoreFlags struct {
+	logLevel int
+	manifest string
+
+	src StorageFlags
+	dst StorageFlags
+}
@@ -27,10 +27,20 @@ func init() {
 	// root
 	rootCmd.AddCommand(serveCmd)
 	rootCmd.AddCommand(readCmd)
+	rootCmd.AddCommand(migrateCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(importCmd)
+	rootCmd.AddCommand(restoreCmd)
 	rootCmd.AddCommand(benchmarkCmd)
 	rootCmd.AddCommand(benchmarkReadCmd)
+	rootCmd.AddCommand(benchCmd)
 	rootCmd.AddCommand(clientCmd)
 
 	// client
 	clientCmd.AddCommand(clientGetCmd)
+	clientCmd.AddCommand(clientProduceCmd)
+	clientCmd.AddCommand(clientConsumeCmd)
+	clientCmd.AddCommand(clientTopicCmd)
+	clientCmd.AddCommand(clientOffsetsCmd)
+	clientCmd.AddCommand(clientGroupCmd)
 }
@@ -2,24 +2,32 @@ package app
 
 import (
 	"context"
+	"crypto/tls"
+	"expvar"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"path"
 	"runtime"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/micvbang/go-helpy/sizey"
 	"github.com/micvbang/go-helpy/syncy"
 	"github.com/micvbang/simple-event-broker/internal/httphandlers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/handover"
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
 	"github.com/micvbang/simple-event-broker/internal/sebbroker"
 	"github.com/micvbang/simple-event-broker/internal/sebcache"
 	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"golang.org/x/net/netutil"
 )
 
@@ -28,58 +36,522 @@ var serveFlags ServeFlags
 func init() {
 	fs := serveCmd.Flags()
 
-	fs.IntVar(&serveFlags.logLevel, "log-level", int(logger.LevelInfo), "Log level, info=4, debug=5")
+	fs.StringVar(&serveFlags.configFile, "config", "", "Path to YAML config file of the settings given by flags, e.g. storage, cache, batching, auth and quotas, and of per-topic retention, labels and cache sizes. Flags given on the command line take precedence. Log level, quotas and topic settings are reloaded on SIGHUP and POST /admin/config/reload")
+	fs.IntVar(&serveFlags.logLevel, "log-level", int(logger.LevelInfo), "Log level, info=4, debug=5. Can be changed at runtime using PUT /admin/log-level")
+	fs.StringVar(&serveFlags.logFormat, "log-format", string(logger.FormatText), "Format of log lines, one of: text, json")
 
 	// http
 	fs.StringVar(&serveFlags.httpListenAddress, "http-address", "127.0.0.1", "Address to listen for HTTP traffic")
 	fs.IntVar(&serveFlags.httpListenPort, "http-port", 51313, "Port to listen for HTTP traffic")
 	fs.StringVar(&serveFlags.httpAPIKey, "http-api-key", "api-key", "API key for authorizing HTTP requests (this is not safe and needs to be changed)")
+	fs.StringVar(&serveFlags.httpAdminAPIKey, "http-admin-api-key", "", fmt.Sprintf("API key for authorizing HTTP requests with admin access, which is required to list and modify internal topics (topics whose names start with '%s'). Disabled if empty", sebbroker.InternalTopicPrefix))
+	fs.StringVar(&serveFlags.httpAPIKeyGrantsFile, "http-api-key-grants-file", "", "Path to JSON file of API keys with read-only access limited to topics, offset ranges and record age, e.g. [{\"api_key\": \"...\", \"topics\": [\"orders\"], \"max_age\": \"24h\"}]")
 	fs.IntVar(&serveFlags.httpConnectionsMax, "http-connections", runtime.NumCPU()*64, "Maximum number of concurrent incoming HTTP connections to be handled")
+	fs.DurationVar(&serveFlags.handoverTimeout, "handover-timeout", 30*time.Second, "Maximum amount of time to wait for a new process to become ready, and for in-flight requests to finish, when upgrading on SIGUSR2")
+
+	// http tls
+	fs.StringVar(&serveFlags.httpTLSCertFile, "http-tls-cert", "", "Path to PEM encoded TLS certificate. TLS is enabled if set. The certificate is reloaded when the file changes")
+	fs.StringVar(&serveFlags.httpTLSKeyFile, "http-tls-key", "", "Path to PEM encoded TLS key")
+	fs.StringVar(&serveFlags.httpTLSClientCAFile, "http-tls-client-ca", "", "Path to PEM encoded CA certificates used to verify client certificates")
+	fs.BoolVar(&serveFlags.httpTLSRequireClientCert, "http-tls-require-client-cert", false, "Whether to reject clients that don't present a valid certificate")
+	fs.StringSliceVar(&serveFlags.httpTLSAllowedClientIdentities, "http-tls-allowed-client-identities", nil, "Subject common names of the client certificates that are accepted. Clients presenting certificates with other identities are rejected. All verified certificates are accepted if empty")
+
+	// http oidc
+	fs.StringVar(&serveFlags.httpOIDCIssuer, "http-oidc-issuer", "", "URL of OIDC issuer whose JWTs are accepted as bearer tokens, in addition to API keys. Enabled if set")
+	fs.StringVar(&serveFlags.httpOIDCAudience, "http-oidc-audience", "", "Audience that JWTs must be issued for. Not checked if empty")
+	fs.StringVar(&serveFlags.httpOIDCJWKSURL, "http-oidc-jwks-url", "", "URL of the OIDC issuer's JSON Web Key Set. Discovered from the issuer's OpenID configuration if empty")
+	fs.DurationVar(&serveFlags.httpOIDCJWKSCacheTTL, "http-oidc-jwks-cache-ttl", time.Hour, "Amount of time to cache the OIDC issuer's keys")
+	fs.StringVar(&serveFlags.httpOIDCIdentityClaim, "http-oidc-identity-claim", "sub", "JWT claim identifying clients, e.g. for quotas")
+	fs.StringVar(&serveFlags.httpOIDCClaimGrantsFile, "http-oidc-claim-grants-file", "", "Path to JSON file mapping JWT claims to full or read-only access, e.g. [{\"claim\": \"groups\", \"value\": \"admins\", \"full_access\": true}, {\"claim\": \"groups\", \"value\": \"team-a\", \"namespaces\": [\"team-a/\"]}]")
+
+	// http server
+	fs.DurationVar(&serveFlags.httpReadHeaderTimeout, "http-read-header-timeout", 10*time.Second, "Maximum amount of time to read request headers. Disabled if 0")
+	fs.DurationVar(&serveFlags.httpReadTimeout, "http-read-timeout", time.Minute, "Maximum amount of time to read entire requests, including bodies. Disabled if 0")
+	fs.DurationVar(&serveFlags.httpWriteTimeout, "http-write-timeout", time.Minute, "Maximum amount of time to write responses. Long-polls are given their timeout on top of this. Disabled if 0")
+	fs.DurationVar(&serveFlags.httpIdleTimeout, "http-idle-timeout", 2*time.Minute, "Maximum amount of time to keep idle keep-alive connections open. Disabled if 0")
+	fs.IntVar(&serveFlags.httpHeaderMaxBytes, "http-header-bytes-max", http.DefaultMaxHeaderBytes, "Maximum size of request headers")
+	fs.Int64Var(&serveFlags.httpBodyMaxBytes, "http-body-bytes-max", 64*sizey.MB, "Maximum size of request bodies. Unlimited if 0")
+	fs.DurationVar(&serveFlags.httpShutdownTimeout, "http-shutdown-timeout", 30*time.Second, "Maximum amount of time to wait for in-flight requests to finish when shutting down on SIGINT or SIGTERM")
+	fs.IntVar(&serveFlags.httpCompressMinBytes, "http-compress-min-bytes", 1024, "Minimum size of record responses to compress using gzip or deflate, when accepted by clients. Disabled if negative")
 
 	// http debug
 	fs.BoolVar(&serveFlags.httpEnableDebug, "http-debug-enable", false, "Whether to enable DEBUG endpoints")
 	fs.StringVar(&serveFlags.httpDebugListenAddress, "http-debug-address", "127.0.0.1", "Address to expose DEBUG endpoints. You very likely want this to remain localhost!")
 	fs.IntVar(&serveFlags.httpDebugListenPort, "http-debug-port", 5000, "Port to serve DEBUG endpoints on")
 
+	// storage
+	fs.StringVar(&serveFlags.storage, "storage", "s3", fmt.Sprintf("Storage to keep record batches in, one of: %s", strings.Join(sebtopic.StorageNames(), ", ")))
+	fs.StringVar(&serveFlags.storageDir, "storage-dir", "", "Local dir to keep record batches in when using disk storage")
+	fs.BoolVar(&serveFlags.storageMmap, "storage-mmap", false, "Whether to read record batches by mapping them into memory when using disk storage")
+	fs.IntVar(&serveFlags.storageOpenFiles, "storage-open-files", 256, "Maximum number of record batch files to keep open between reads when using disk storage, so frequently read record batches aren't opened for every read. Disabled if 0")
+	fs.Int64Var(&serveFlags.storageMemoryMaxBytes, "storage-memory-bytes-max", 0, "Maximum number of bytes of record batches to keep in memory when using memory storage. Unlimited if 0")
+	fs.StringVar(&serveFlags.storageMemorySpillDir, "storage-memory-spill-dir", "", "Local dir to spill the oldest record batches to when storage-memory-bytes-max is reached. If empty, adding records fails once it's reached")
+	fs.DurationVar(&serveFlags.storageWatchInterval, "storage-watch-interval", 0, "Amount of time between checking for record batches written by other brokers sharing the storage dir when using disk storage, e.g. for read-only replicas on NFS or EFS. Must not be used by the broker writing to the topics. Disabled if 0")
+	fs.StringToStringVar(&serveFlags.storageParams, "storage-param", nil, "Storage specific configuration, e.g. for storage registered by other modules")
+
 	// s3
-	fs.StringVar(&serveFlags.s3BucketName, "s3-bucket", "", "Bucket name")
+	fs.StringVar(&serveFlags.s3BucketName, "s3-bucket", "", "Bucket name. Required when using s3 or minio storage")
+	fs.StringVar(&serveFlags.s3Endpoint, "s3-endpoint", "", "URL of an S3 compatible service, e.g. MinIO or Ceph. Required when using minio storage")
+	fs.BoolVar(&serveFlags.s3PathStyle, "s3-path-style", false, "Whether to address buckets using path-style URLs. Always enabled for minio storage")
+	fs.BoolVar(&serveFlags.s3InsecureSkipVerify, "s3-insecure-skip-verify", false, "Whether to skip verification of the S3 endpoint's TLS certificate. Only use this for testing!")
+	fs.DurationVar(&serveFlags.s3NotFoundTTL, "s3-not-found-ttl", time.Second, "Amount of time to remember that record batches were not found in S3, so that repeated reads of them don't each make a request to S3. Record batches written by other processes may not be found for this long. Disabled if 0")
+	fs.IntVar(&serveFlags.s3RetryAttempts, "s3-retry-attempts", 3, "Maximum number of times to attempt requests to S3 that fail because S3 is unavailable")
+	fs.DurationVar(&serveFlags.s3RetryBaseDelay, "s3-retry-base-delay", 100*time.Millisecond, "Delay before the first retry of a request to S3, doubled for each following retry. Delays are randomized between 0 and the computed delay")
+	fs.DurationVar(&serveFlags.s3RetryMaxDelay, "s3-retry-max-delay", 5*time.Second, "Maximum delay between retries of a request to S3")
+	fs.IntVar(&serveFlags.s3BreakerFailures, "s3-breaker-failures", 10, "Number of consecutive failed requests to S3 after which requests fail right away, until S3 is available again. Disabled if 0")
+	fs.DurationVar(&serveFlags.s3BreakerCooldown, "s3-breaker-cooldown", 30*time.Second, "Amount of time to fail requests to S3 right away before probing whether S3 is available again")
+	fs.IntVar(&serveFlags.s3UploadsMax, "s3-uploads-max", 64, "Maximum number of concurrent uploads to S3. Uploads beyond it are queued and handed out round-robin across topics. Unlimited if 0")
+	fs.StringVar(&serveFlags.s3StagingDir, "s3-staging-dir", path.Join(os.TempDir(), "seb-staging"), "Local dir to stage record batches in until they're uploaded to S3. Interrupted uploads are resumed from here on startup")
+
+	// encryption
+	fs.StringVar(&serveFlags.encryptionKeyID, "encryption-key-id", "", "ID of the key used to encrypt record batches before uploading them to S3. The hex encoded key is read from the environment variable SEB_ENCRYPTION_KEY. Encryption is disabled if empty")
 
 	// caching
+	fs.StringVar(&serveFlags.cacheStorage, "cache-storage", "disk", fmt.Sprintf("Storage to cache record batches in, one of: %s", strings.Join(sebcache.StorageNames(), ", ")))
+	fs.StringToStringVar(&serveFlags.cacheStorageParams, "cache-storage-param", nil, "Cache storage specific configuration, e.g. for storage registered by other modules")
 	fs.StringVar(&serveFlags.cacheDir, "cache-dir", path.Join(os.TempDir(), "seb-cache"), "Local dir to use when caching record batches")
+	fs.BoolVar(&serveFlags.cacheHashKeys, "cache-hash-keys", false, "Store cached record batches in files named by the hash of their path, sharded across subdirectories, to avoid file system limits with many cached record batches. The path of each record batch is kept in a .key file next to it")
 	fs.Int64Var(&serveFlags.cacheMaxBytes, "cache-size", 1*sizey.GB, "Maximum number of bytes to keep in the cache (soft limit)")
+	fs.Int64Var(&serveFlags.cacheMaintenanceMaxBytes, "cache-maintenance-size", 128*sizey.MB, "Number of bytes of the cache reserved for background work such as merging and retention, which then can't evict items used to serve clients. Not reserved if 0")
 	fs.DurationVar(&serveFlags.cacheEvictionInterval, "cache-eviction-interval", 5*time.Minute, "Amount of time between enforcing maximum cache size")
+	fs.Int64Var(&serveFlags.cacheMaxItemBytes, "cache-max-item-size", 0, "Maximum size of record batches to admit to the cache. Larger record batches are only cached until the next eviction. Disabled if 0")
+	fs.IntVar(&serveFlags.cacheTailBatches, "cache-tail-batches", 0, "Number of most recent record batches of each topic to admit to the cache when they're read from storage. Older record batches are only cached until the next eviction. Disabled if 0")
+	fs.Int64Var(&serveFlags.cacheTopicMaxBytes, "cache-topic-size", 0, "Maximum number of bytes that each topic may use of the cache, so that a single topic can't evict the record batches of all others. Disabled if 0")
+	fs.StringToInt64Var(&serveFlags.cacheTopicQuotas, "cache-topic-quota", nil, "Maximum number of bytes that individual topics may use of the cache, overriding --cache-topic-size, e.g. backfill=104857600")
+
+	// read replica
+	fs.BoolVar(&serveFlags.readReplica, "read-replica", false, "Whether to serve reads of topics written by another broker sharing the same storage, rejecting all writes. Offsets committed by consumer groups are only kept in memory")
+	fs.DurationVar(&serveFlags.readReplicaInterval, "read-replica-refresh-interval", time.Second, "Amount of time between discovering record batches added by the writing broker when running as a read replica. Set to 0 when S3 event notifications are sent to POST /replica/s3-events instead")
+
+	// epochs
+	fs.Uint64Var(&serveFlags.epoch, "epoch", 0, "Epoch of the broker, e.g. its term, included in the names of the record batches it writes such that record batches written by brokers of older epochs are ignored. Must never decrease; topics with record batches of a newer epoch can't be written to. Record batches are named as by earlier versions if 0")
+	fs.StringVar(&serveFlags.leaseHolder, "lease-holder", "", "Unique name of the broker among brokers sharing the same storage. If set, the broker acquires a lease on each topic before writing to it, and rejects writes to topics whose lease it lost, such that only one broker writes to a topic at a time. Record batches are named with the epoch of the lease. Leases are disabled if empty")
+	fs.DurationVar(&serveFlags.leaseTTL, "lease-ttl", 30*time.Second, "Amount of time that topic leases are held for without being renewed. Leases are renewed every third of it")
+
+	// retention
+	fs.DurationVar(&serveFlags.retentionInterval, "retention-interval", 5*time.Minute, "Amount of time between deleting record batches in which all records have expired")
+
+	// consumer groups
+	fs.DurationVar(&serveFlags.groupMaxIdle, "group-max-idle", 7*24*time.Hour, "Amount of time after which consumer groups that haven't been active are removed, including their committed offsets. Stale groups can be listed using GET /admin/groups/stale. Disabled if 0")
+	fs.StringVar(&serveFlags.groupAssignor, "group-assignor", "range", fmt.Sprintf("Strategy for assigning topics to the members of consumer groups that don't choose one when joining, one of: %s", strings.Join(sebbroker.AssignorNames(), ", ")))
+	fs.DurationVar(&serveFlags.groupSessionTimeout, "group-session-timeout", 30*time.Second, "Amount of time after their last heartbeat that members of consumer groups are removed, and their topics assigned to other members. Used for members that don't set their own")
+	fs.DurationVar(&serveFlags.groupExpiryInterval, "group-expiry-interval", 10*time.Minute, "Amount of time between removing consumer groups that have been idle for longer than --group-max-idle")
+
+	// scrubbing
+	fs.DurationVar(&serveFlags.scrubInterval, "scrub-interval", 0, "Amount of time between verifying the integrity of all record batches in storage. Findings are logged and counted in the seb_scrub_* metrics of GET /metrics. Disabled if 0")
+	fs.BoolVar(&serveFlags.scrubQuarantine, "scrub-quarantine", false, "Whether to move corrupt record batches that can't be repaired out of their topic, to _quarantine/ in storage")
+	fs.StringVar(&serveFlags.scrubReplicaStorage, "scrub-replica-storage", "", fmt.Sprintf("Storage holding a replica of the record batches, used to repair corrupt or missing record batches, one of: %s. Disabled if empty", strings.Join(sebtopic.StorageNames(), ", ")))
+	fs.StringVar(&serveFlags.scrubReplicaStorageDir, "scrub-replica-storage-dir", "", "Local dir of the replica when using disk storage")
+	fs.StringVar(&serveFlags.scrubReplicaS3BucketName, "scrub-replica-s3-bucket", "", "Bucket name of the replica when using s3 storage")
+
+	// replica verification
+	fs.StringVar(&serveFlags.replicaVerifyStorage, "replica-verify-storage", "", fmt.Sprintf("Storage holding a replica of the record batches, e.g. made by S3 replication, to periodically compare the record batches of all topics with, one of: %s. Divergences are logged, exposed on GET /metrics and listed by GET /admin/replica/verification. Disabled if empty", strings.Join(sebtopic.StorageNames(), ", ")))
+	fs.StringVar(&serveFlags.replicaVerifyStorageDir, "replica-verify-storage-dir", "", "Local dir of the replica to verify when using disk storage")
+	fs.StringVar(&serveFlags.replicaVerifyS3BucketName, "replica-verify-s3-bucket", "", "Bucket name of the replica to verify when using s3 storage")
+	fs.DurationVar(&serveFlags.replicaVerifyInterval, "replica-verify-interval", 10*time.Minute, "Amount of time between verifying the replica given by --replica-verify-storage")
+
+	// quotas
+	fs.StringVar(&serveFlags.quotasFile, "quotas-file", "", "Path to JSON file of quotas limiting the bytes produced per day and retained by namespaces (topic name prefixes), or produced per day by principals (client certificate identities), e.g. [{\"namespace\": \"team-a/\", \"produced_bytes_per_day\": 1073741824, \"retained_bytes\": 10737418240}]")
+
+	// usage
+	fs.DurationVar(&serveFlags.usageReconcileInterval, "usage-reconcile-interval", time.Hour, "Amount of time between reconciling the tracked storage usage of topics with the files in storage")
+
+	// merging
+	fs.DurationVar(&serveFlags.mergeInterval, "merge-interval", 10*time.Minute, "Amount of time between merging runs of small record batches into larger ones. Disabled if 0")
+	fs.IntVar(&serveFlags.mergeMaxRecords, "merge-records-max", 32*1024, "Maximum number of records in a merged record batch")
+	fs.IntVar(&serveFlags.mergeMaxBytes, "merge-bytes-max", 10*sizey.MB, "Maximum number of bytes of records in a merged record batch")
 
 	// batching
 	fs.DurationVar(&serveFlags.recordBatchBlockTime, "batch-wait-time", time.Second, "Amount of time to wait between receiving first record in batch and committing the batch")
+	fs.DurationVar(&serveFlags.recordBatchIdleTime, "batch-idle-time", 0, "Amount of time without records being added to a topic after which its batch is committed, even if batch-wait-time hasn't elapsed. Disabled if 0")
 	fs.IntVar(&serveFlags.recordBatchSoftMaxBytes, "batch-bytes-soft-max", 10*sizey.MB, "Soft maximum for the size of a batch")
 	fs.IntVar(&serveFlags.recordBatchHardMaxBytes, "batch-bytes-hard-max", 30*sizey.MB, "Hard maximum for the size of a batch")
 	fs.IntVar(&serveFlags.recordBatchMaxRecords, "batch-records-hard-max", 32*1024, "Hard maximum for the number of records a batch can contain")
-
-	// required flags
-	serveCmd.MarkFlagRequired("s3-bucket")
+	fs.IntVar(&serveFlags.recordBatchPendingMaxBytes, "batch-pending-bytes-max", 0, "Maximum number of bytes of records per topic waiting to be committed. Producers are rejected or kept waiting while it's reached. Disabled if 0")
+	fs.IntVar(&serveFlags.recordBatchPendingMaxRecords, "batch-pending-records-max", 0, "Maximum number of records per topic waiting to be committed. Producers are rejected or kept waiting while it's reached. Disabled if 0")
+	fs.DurationVar(&serveFlags.recordBatchPendingTimeout, "batch-pending-timeout", 0, "Amount of time producers wait for pending records to be committed before being rejected. Bounded by the request's lifetime")
+	fs.DurationVar(&serveFlags.dedupWindow, "dedup-window", 0, "Amount of time to remember the content hashes of added record batches, so that identical batches retried by producers, e.g. after losing the response, are acknowledged with the original offsets instead of being added again. Disabled if 0")
+	fs.IntVar(&serveFlags.recordLargeThresholdBytes, "record-large-threshold", 0, "Records larger than this are stored as separate objects, keeping record batches small. Disabled if 0")
+	// fetching
+	fs.IntVar(&serveFlags.fetchDefaultMaxRecords, "fetch-records-default", 10, "Number of records returned when clients don't specify how many records to fetch")
+	fs.IntVar(&serveFlags.fetchMaxRecords, "fetch-records-max", 0, "Maximum number of records returned by a single fetch. Unlimited if 0")
+	fs.IntVar(&serveFlags.fetchMaxBytesInFlight, "fetch-bytes-in-flight-max", 0, "Maximum number of bytes being fetched by all concurrent fetches. Fetches wait while it's reached. Unlimited if 0")
+
+	fs.IntVar(&serveFlags.recordBatchPrefetch, "batch-prefetch", 1, "Number of record batches following the one being read to prefetch into the cache, so sequential consumers don't wait for each record batch to be fetched. Disabled if 0")
+	fs.BoolVar(&serveFlags.topicManifest, "topic-manifest", true, "Write a small manifest per topic whenever a record batch is added, allowing topics to be opened without listing their record batches")
+	fs.IntVar(&serveFlags.writeBehindQueue, "write-behind-queue", 0, "Maximum number of record batches per topic waiting to be written to backing storage. If set, records are acknowledged once they're in the cache and written to backing storage in the background, lowering produce latency at the cost of losing unwritten records if the broker crashes. Producers wait while the queue is full. Disabled if 0")
+	fs.DurationVar(&serveFlags.writeBehindRetry, "write-behind-retry", 100*time.Millisecond, "Amount of time to wait before retrying a failed write behind. Doubled after each consecutive failure")
+	fs.BoolVar(&serveFlags.recordBatchCompress, "batch-compress", true, "Compress record batches in storage. Uncompressed record batches allow single records to be read without reading the entire record batch, e.g. using S3 ranged GETs. Must not be changed for existing topics")
+	fs.IntVar(&serveFlags.recordBatchCompressWorkers, "batch-compress-workers", 1, "Number of goroutines compressing each record batch concurrently, in chunks of --batch-compress-chunk-bytes. Output remains regular gzip. Defaults to GOMAXPROCS if 0")
+	fs.IntVar(&serveFlags.recordBatchCompressChunkBytes, "batch-compress-chunk-bytes", 1*sizey.MB, "Size of the chunks of record batches compressed concurrently when --batch-compress-workers isn't 1")
 }
 
+const encryptionKeyEnvVar = "SEB_ENCRYPTION_KEY"
+
 var serveCmd = &cobra.Command{
 	Use:   "http-server",
 	Short: "Start HTTP server",
 	Long:  "Start Seb's HTTP server",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		ctx := context.Background()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// NOTE: flags given on the command line must be recorded before the
+		// config file sets the others.
+		cmdLineFlags := map[string]bool{}
+		cmd.Flags().Visit(func(f *pflag.Flag) {
+			cmdLineFlags[f.Name] = true
+		})
+
+		config := serveConfig{}
+		if serveFlags.configFile != "" {
+			var err error
+			config, err = readServeConfig(serveFlags.configFile)
+			if err != nil {
+				return err
+			}
+
+			err = applyServeConfig(cmd.Flags(), config)
+			if err != nil {
+				return fmt.Errorf("applying config file: %w", err)
+			}
+		}
 
 		flags := serveFlags
-		log := logger.NewWithLevel(ctx, logger.LogLevel(flags.logLevel))
+		logFormat, err := logger.ParseFormat(flags.logFormat)
+		if err != nil {
+			return err
+		}
+
+		log, logLevel := logger.New(ctx, logger.WithLevel(logger.LogLevel(flags.logLevel)), logger.WithFormat(logFormat))
 		log.Debugf("flags: %+v", flags)
 
-		cache, err := sebcache.NewDiskCache(log, flags.cacheDir)
+		var keyProvider sebtopic.KeyProvider
+		if flags.encryptionKeyID != "" {
+			keyProvider, err = sebtopic.NewEnvKeyProvider(flags.encryptionKeyID, encryptionKeyEnvVar)
+			if err != nil {
+				log.Fatalf("creating encryption key provider: %s", err)
+			}
+		}
+
+		var apiKeyGrants []httphandlers.APIKeyGrant
+		if flags.httpAPIKeyGrantsFile != "" {
+			bs, err := os.ReadFile(flags.httpAPIKeyGrantsFile)
+			if err != nil {
+				log.Fatalf("reading api key grants file: %s", err)
+			}
+
+			apiKeyGrants, err = httphandlers.ParseAPIKeyGrants(bs)
+			if err != nil {
+				log.Fatalf("parsing api key grants file: %s", err)
+			}
+		}
+
+		auths := []httphandlers.Authenticator{
+			httphandlers.NewAdminAPIKeyAuthenticator(flags.httpAdminAPIKey),
+			httphandlers.NewAPIKeyAuthenticator(flags.httpAPIKey, apiKeyGrants...),
+		}
+		if flags.httpOIDCIssuer != "" {
+			var claimGrants []httphandlers.ClaimGrant
+			if flags.httpOIDCClaimGrantsFile != "" {
+				bs, err := os.ReadFile(flags.httpOIDCClaimGrantsFile)
+				if err != nil {
+					log.Fatalf("reading claim grants file: %s", err)
+				}
+
+				claimGrants, err = httphandlers.ParseClaimGrants(bs)
+				if err != nil {
+					log.Fatalf("parsing claim grants file: %s", err)
+				}
+			}
+
+			verifier := httphelpers.NewJWTVerifier(log.Name("jwt"), httphelpers.JWTConfig{
+				Issuer:       flags.httpOIDCIssuer,
+				Audience:     flags.httpOIDCAudience,
+				JWKSURL:      flags.httpOIDCJWKSURL,
+				JWKSCacheTTL: flags.httpOIDCJWKSCacheTTL,
+				Leeway:       time.Minute,
+			})
+			auths = append(auths, httphandlers.NewOIDCAuthenticator(log.Name("oidc"), verifier, flags.httpOIDCIdentityClaim, claimGrants...))
+		}
+
+		quotas, err := loadQuotas(flags.quotasFile, config)
 		if err != nil {
-			log.Fatalf("creating disk cache: %w", err)
+			log.Fatalf("loading quotas: %s", err)
+		}
+
+		var tlsConfig *tls.Config
+		if flags.httpTLSCertFile != "" {
+			tlsConfig, err = httphelpers.NewTLSConfig(log.Name("tls"), httphelpers.TLSConfig{
+				CertFile:                flags.httpTLSCertFile,
+				KeyFile:                 flags.httpTLSKeyFile,
+				ClientCAFile:            flags.httpTLSClientCAFile,
+				RequireClientCert:       flags.httpTLSRequireClientCert,
+				AllowedClientIdentities: flags.httpTLSAllowedClientIdentities,
+			})
+			if err != nil {
+				log.Fatalf("creating tls config: %s", err)
+			}
 		}
 
-		go sebcache.EvictionLoop(ctx, log.Name("cache eviction"), cache, flags.cacheMaxBytes, flags.cacheEvictionInterval)
+		addr := fmt.Sprintf("%s:%d", flags.httpListenAddress, flags.httpListenPort)
+		tcpListener, err := handover.Listen(addr)
+		if err != nil {
+			log.Fatalf("listening: %s", err)
+		}
+		defer tcpListener.Close()
+
+		// NOTE: the previous process may still be serving requests and
+		// writing to topics and the cache; nothing that uses them may be
+		// started before it's done.
+		if handover.Inherited() {
+			log.Infof("waiting for previous process to hand over %s", addr)
+			err = handover.TakeOver(ctx)
+			if err != nil {
+				log.Fatalf("taking over from previous process: %s", err)
+			}
+		}
 
-		blockingS3Broker, err := makeBlockingS3Broker(log, cache, flags.recordBatchSoftMaxBytes, flags.recordBatchBlockTime, flags.s3BucketName)
+		cacheStorage, err := sebcache.NewStorageByName(ctx, log.Name("cache storage"), flags.cacheStorage, sebcache.StorageConfig{
+			Dir:      flags.cacheDir,
+			HashKeys: flags.cacheHashKeys,
+			Params:   flags.cacheStorageParams,
+		})
 		if err != nil {
-			log.Fatalf("making blocking s3 broker: %s", err)
+			log.Fatalf("creating cache storage: %s", err)
+		}
+
+		cacheOptFuncs := []func(*sebcache.Opts){
+			sebcache.WithMaxItemBytes(flags.cacheMaxItemBytes),
+			sebcache.WithTailItems(flags.cacheTailBatches),
+			sebcache.WithTopicMaxBytes(flags.cacheTopicMaxBytes),
+		}
+		for topicName, bytes := range flags.cacheTopicQuotas {
+			cacheOptFuncs = append(cacheOptFuncs, sebcache.WithTopicQuota(topicName, bytes))
+		}
+
+		cache, err := sebcache.New(log, cacheStorage, cacheOptFuncs...)
+		if err != nil {
+			log.Fatalf("creating cache: %s", err)
+		}
+		expvar.Publish("cache_budgets", expvar.Func(func() any {
+			return cache.BudgetStats()
+		}))
+		expvar.Publish("cache_stats", expvar.Func(func() any {
+			return cache.Stats()
+		}))
+
+		topicStorage, err := sebtopic.NewStorageByName(ctx, log.Name("storage"), flags.storage, sebtopic.StorageConfig{
+			Dir:        flags.storageDir,
+			Mmap:       flags.storageMmap,
+			OpenFiles:  flags.storageOpenFiles,
+			Bucket:     flags.s3BucketName,
+			StagingDir: flags.s3StagingDir,
+			Params:     flags.storageParams,
+
+			MemoryMaxBytes: flags.storageMemoryMaxBytes,
+			MemorySpillDir: flags.storageMemorySpillDir,
+
+			Endpoint:           flags.s3Endpoint,
+			PathStyle:          flags.s3PathStyle,
+			InsecureSkipVerify: flags.s3InsecureSkipVerify,
+			NotFoundTTL:        flags.s3NotFoundTTL,
+			S3Retry: sebtopic.S3RetryOpts{
+				MaxAttempts:     flags.s3RetryAttempts,
+				BaseDelay:       flags.s3RetryBaseDelay,
+				MaxDelay:        flags.s3RetryMaxDelay,
+				BreakerFailures: flags.s3BreakerFailures,
+				BreakerCooldown: flags.s3BreakerCooldown,
+			},
+			MaxConcurrentUploads: flags.s3UploadsMax,
+		})
+		if err != nil {
+			log.Fatalf("creating storage: %s", err)
+		}
+
+		_, err = sebtopic.CheckLayoutVersion(ctx, log.Name("storage"), topicStorage)
+		if err != nil {
+			log.Fatalf("checking storage layout: %s", err)
+		}
+		if (flags.epoch > 0 || flags.leaseHolder != "") && !flags.readReplica {
+			err = sebtopic.UpgradeLayoutVersion(ctx, log.Name("storage"), topicStorage)
+			if err != nil {
+				log.Fatalf("upgrading storage layout: %s", err)
+			}
+		}
+		monitoring := httphandlers.Monitoring{}
+		if s3Storage, ok := topicStorage.(*sebtopic.S3Storage); ok {
+			monitoring.S3Retry = s3Storage
+			monitoring.S3Uploads = s3Storage
+		}
+		if diskStorage, ok := topicStorage.(*sebtopic.DiskStorage); ok {
+			expvar.Publish("disk_file_handle_stats", expvar.Func(func() any {
+				return diskStorage.FileHandleStats()
+			}))
+		}
+
+		_, err = sebbroker.AssignorByName(flags.groupAssignor)
+		if err != nil {
+			log.Fatalf("parsing group assignor: %s", err)
+		}
+
+		blockingBroker := makeBlockingBroker(log, cache, topicStorage, flags.recordBatchSoftMaxBytes, flags.recordBatchBlockTime, keyProvider, topicOptFuncs(flags),
+			[]func(*sebbroker.Opts){
+				sebbroker.WithDefaultMaxRecords(flags.fetchDefaultMaxRecords),
+				sebbroker.WithMaxRecords(flags.fetchMaxRecords),
+				sebbroker.WithMaxFetchBytesInFlight(flags.fetchMaxBytesInFlight),
+				sebbroker.WithAliasStore(sebbroker.NewStorageAliasStore(topicStorage)),
+				sebbroker.WithGroupOffsetStore(sebbroker.NewStorageGroupOffsetStore(topicStorage)),
+				sebbroker.WithGroupMaxIdle(flags.groupMaxIdle),
+				sebbroker.WithGroupAssignor(flags.groupAssignor),
+				sebbroker.WithGroupSessionTimeout(flags.groupSessionTimeout),
+				sebbroker.WithDedupWindow(flags.dedupWindow),
+				sebbroker.WithReadReplica(flags.readReplica),
+			},
+			sebbroker.WithMaxPendingBytes(flags.recordBatchPendingMaxBytes),
+			sebbroker.WithMaxPendingRecords(flags.recordBatchPendingMaxRecords),
+			sebbroker.WithPendingTimeout(flags.recordBatchPendingTimeout),
+			sebbroker.WithIdleTime(flags.recordBatchIdleTime),
+		)
+
+		err = blockingBroker.SetQuotas(quotas)
+		if err != nil {
+			log.Fatalf("setting quotas: %s", err)
+		}
+		applyTopicConfigs(blockingBroker, nil, config.Topics)
+
+		reloader := &configReloader{
+			log:        log.Name("config"),
+			path:       flags.configFile,
+			logLevel:   logLevel,
+			broker:     blockingBroker,
+			cmdLine:    cmdLineFlags,
+			quotasFile: flags.quotasFile,
+			config:     config,
+		}
+
+		err = blockingBroker.LoadTopicAliases(ctx)
+		if err != nil {
+			log.Fatalf("loading topic aliases: %s", err)
+		}
+
+		err = blockingBroker.LoadGroupOffsets(ctx)
+		if err != nil {
+			log.Fatalf("loading consumer group offsets: %s", err)
+		}
+
+		errs := make(chan error, 8)
+
+		var loops sync.WaitGroup
+		goLoop := func(f func() error) {
+			loops.Add(1)
+			go func() {
+				defer loops.Done()
+				err := f()
+				if ctx.Err() == nil {
+					errs <- err
+				}
+			}()
+		}
+
+		goLoop(func() error {
+			return sebcache.EvictionLoop(ctx, log.Name("cache eviction"), cache, flags.cacheMaxBytes, flags.cacheMaintenanceMaxBytes, flags.cacheEvictionInterval)
+		})
+
+		if flags.readReplica {
+			if flags.scrubQuarantine {
+				log.Fatalf("--scrub-quarantine can't be used with --read-replica")
+			}
+
+			if flags.readReplicaInterval > 0 {
+				goLoop(func() error {
+					return sebbroker.ReplicaLoop(ctx, log.Name("replica"), blockingBroker, flags.readReplicaInterval)
+				})
+			}
+		}
+
+		if flags.leaseHolder != "" && !flags.readReplica {
+			if flags.leaseTTL <= 0 {
+				log.Fatalf("--lease-ttl must be positive when using --lease-holder")
+			}
+
+			goLoop(func() error {
+				return sebbroker.LeaseLoop(ctx, log.Name("lease"), blockingBroker, flags.leaseTTL/3)
+			})
+		}
+
+		if flags.storageWatchInterval > 0 {
+			diskStorage, ok := topicStorage.(*sebtopic.DiskStorage)
+			if !ok {
+				log.Fatalf("--storage-watch-interval requires disk storage")
+			}
+
+			changed := diskStorage.WatchTopics(ctx, flags.storageWatchInterval, blockingBroker.TopicNames)
+			goLoop(func() error {
+				return sebbroker.RefreshLoop(ctx, log.Name("refresh"), blockingBroker, changed)
+			})
+		}
+
+		goLoop(func() error {
+			return sebbroker.RetentionLoop(ctx, log.Name("retention"), blockingBroker, flags.retentionInterval)
+		})
+
+		if flags.groupMaxIdle > 0 {
+			goLoop(func() error {
+				return sebbroker.GroupExpiryLoop(ctx, log.Name("group expiry"), blockingBroker, flags.groupExpiryInterval)
+			})
+		}
+
+		if flags.mergeInterval > 0 {
+			goLoop(func() error {
+				return sebbroker.MergeLoop(ctx, log.Name("merge"), blockingBroker, flags.mergeInterval, flags.mergeMaxRecords, flags.mergeMaxBytes)
+			})
+		}
+
+		if flags.scrubInterval > 0 {
+			scrubber, err := makeScrubber(ctx, log.Name("scrub"), blockingBroker, topicStorage, keyProvider, flags)
+			if err != nil {
+				log.Fatalf("creating scrubber: %s", err)
+			}
+			monitoring.Scrub = scrubber
+
+			goLoop(func() error {
+				return sebbroker.ScrubLoop(ctx, log.Name("scrub"), scrubber, flags.scrubInterval)
+			})
+		}
+
+		if flags.replicaVerifyStorage != "" {
+			if flags.replicaVerifyInterval <= 0 {
+				log.Fatalf("--replica-verify-interval must be positive when using --replica-verify-storage")
+			}
+
+			replica, err := sebtopic.NewStorageByName(ctx, log.Name("replica verification storage"), flags.replicaVerifyStorage, sebtopic.StorageConfig{
+				Dir:    flags.replicaVerifyStorageDir,
+				Bucket: flags.replicaVerifyS3BucketName,
+			})
+			if err != nil {
+				log.Fatalf("creating replica verification storage: %s", err)
+			}
+
+			replicaReports := sebtopic.NewReplicaReports()
+			monitoring.Replica = replicaReports
+
+			goLoop(func() error {
+				return sebtopic.ReplicaVerificationLoop(ctx, log.Name("replica verification"), topicStorage, replica, blockingBroker.TopicNames, flags.replicaVerifyInterval, replicaReports.Report)
+			})
+		}
+
+		expvar.Publish("topic_usage", expvar.Func(func() any {
+			return blockingBroker.Usage()
+		}))
+		goLoop(func() error {
+			return sebbroker.UsageLoop(ctx, log.Name("usage"), blockingBroker, flags.usageReconcileInterval)
+		})
+
+		if flags.httpEnableDebug {
+			goLoop(func() error {
+				return httphelpers.ListenAndServePprof(ctx, log.Name("pprof"), flags.httpDebugListenAddress, flags.httpDebugListenPort)
+			})
 		}
 
 		batchPool := syncy.NewPool(func() *sebrecords.Batch {
@@ -88,74 +560,337 @@ var serveCmd = &cobra.Command{
 		})
 
 		mux := http.NewServeMux()
-		httphandlers.RegisterRoutes(log, mux, batchPool, blockingS3Broker, flags.httpAPIKey)
+		httphandlers.RegisterRoutes(log, mux, batchPool, blockingBroker, logLevel, cache, reloader, monitoring, httphandlers.Authenticators(auths...))
 
-		errs := make(chan error, 8)
+		var handler http.Handler = mux
+		if flags.httpCompressMinBytes >= 0 {
+			handler = httphelpers.NewCompressionHandler(log.Name("http compression"), httphelpers.CompressionConfig{
+				MinSize: flags.httpCompressMinBytes,
+			})(handler)
+		}
+
+		srv := httphelpers.NewServer(log.Name("http server"), httphelpers.NewRequestIDHandler(log.Name("http"))(handler), httphelpers.ServerConfig{
+			ReadHeaderTimeout: flags.httpReadHeaderTimeout,
+			ReadTimeout:       flags.httpReadTimeout,
+			WriteTimeout:      flags.httpWriteTimeout,
+			IdleTimeout:       flags.httpIdleTimeout,
+			MaxHeaderBytes:    flags.httpHeaderMaxBytes,
+			MaxBodyBytes:      flags.httpBodyMaxBytes,
+			Drain:             blockingBroker.Shutdown,
+		})
 
 		go func() {
-			addr := fmt.Sprintf("%s:%d", flags.httpListenAddress, flags.httpListenPort)
 			log.Infof("Listening on %s", addr)
 
-			l, err := net.Listen("tcp", addr)
-			if err != nil {
-				errs <- fmt.Errorf("listening on %s: %w", addr, err)
+			var l net.Listener = netutil.LimitListener(tcpListener, flags.httpConnectionsMax)
+			if tlsConfig != nil {
+				l = tls.NewListener(l, tlsConfig)
 			}
-			defer l.Close()
 
-			l = netutil.LimitListener(l, flags.httpConnectionsMax)
-			errs <- http.Serve(l, mux)
+			err := srv.Serve(l)
+			if err != http.ErrServerClosed {
+				errs <- err
+			}
 		}()
 
-		if flags.httpEnableDebug {
-			go func() {
-				logPprof := log.Name("pprof")
-				errs <- httphelpers.ListenAndServePprof(logPprof, flags.httpDebugListenAddress, flags.httpDebugListenPort)
-			}()
-		}
+		upgrades := make(chan os.Signal, 1)
+		handover.NotifyUpgrade(upgrades)
+
+		terminate := make(chan os.Signal, 1)
+		signal.Notify(terminate, os.Interrupt, syscall.SIGTERM)
+
+		reloads := make(chan os.Signal, 1)
+		signal.Notify(reloads, syscall.SIGHUP)
+
+		for {
+			select {
+			case err = <-errs:
+				log.Errorf("main returned: %s", err)
+				return err
+			case sig := <-terminate:
+				log.Infof("received %s, shutting down", sig)
+				shutdownCtx, shutdownCancel := context.WithTimeout(ctx, flags.httpShutdownTimeout)
+				err = srv.Shutdown(shutdownCtx)
+				shutdownCancel()
+				if err != nil {
+					log.Errorf("shutting down http server: %s", err)
+				}
+
+				// NOTE: leases must be held until record batches waiting to be
+				// written behind have been written.
+				flushCtx, flushCancel := context.WithTimeout(ctx, flags.httpShutdownTimeout)
+				err = blockingBroker.FlushWrites(flushCtx)
+				flushCancel()
+				if err != nil {
+					log.Errorf("flushing writes: %s", err)
+				}
+
+				err = blockingBroker.ReleaseLeases(ctx)
+				if err != nil {
+					log.Errorf("releasing topic leases: %s", err)
+				}
+
+				cancel()
+				loops.Wait()
+				return nil
+			case <-reloads:
+				log.Infof("received SIGHUP, reloading config")
+				applied, restartRequired, err := reloader.ReloadConfig()
+				if err != nil {
+					log.Errorf("reloading config: %s", err)
+				} else {
+					log.Infof("reloaded config, applied: %v, requiring restart: %v", applied, restartRequired)
+				}
+				continue
+			case <-upgrades:
+			}
+
+			log.Infof("upgrading")
+			executable, err := os.Executable()
+			if err != nil {
+				log.Errorf("upgrading: finding executable: %s", err)
+				continue
+			}
+
+			upgradeCtx, upgradeCancel := context.WithTimeout(ctx, flags.handoverTimeout)
+			h, err := handover.Upgrade(upgradeCtx, log.Name("handover"), tcpListener, executable, os.Args[1:])
+			upgradeCancel()
+			if err != nil {
+				log.Errorf("upgrading: %s", err)
+				continue
+			}
+
+			// NOTE: Shutdown() waits for in-flight requests, including produce
+			// requests waiting for their record batches to be committed, and
+			// makes long-polling consumers return early. New connections queue
+			// up for the new process.
+			shutdownCtx, shutdownCancel := context.WithTimeout(ctx, flags.handoverTimeout)
+			err = srv.Shutdown(shutdownCtx)
+			shutdownCancel()
+			if err != nil {
+				log.Errorf("shutting down http server: %s", err)
+			}
+
+			flushCtx, flushCancel := context.WithTimeout(ctx, flags.handoverTimeout)
+			err = blockingBroker.FlushWrites(flushCtx)
+			flushCancel()
+			if err != nil {
+				log.Errorf("flushing writes: %s", err)
+			}
+
+			cancel()
+			loops.Wait()
 
-		err = <-errs
-		log.Errorf("main returned: %s", err)
-		return err
+			log.Infof("handing over to new process")
+			return h.Done()
+		}
 	},
 }
 
-func makeBlockingS3Broker(log logger.Logger, cache *sebcache.Cache, bytesSoftMax int, blockTime time.Duration, s3BucketName string) (*sebbroker.Broker, error) {
-	cfg, err := config.LoadDefaultConfig(context.TODO())
-	if err != nil {
-		return nil, fmt.Errorf("creating s3 session: %s", err)
+func makeBlockingBroker(log logger.Logger, cache *sebcache.Cache, topicStorage sebtopic.Storage, bytesSoftMax int, blockTime time.Duration, keyProvider sebtopic.KeyProvider, topicOptFuncs []func(*sebtopic.Opts), brokerOptFuncs []func(*sebbroker.Opts), batcherOptFuncs ...func(*sebbroker.BlockingBatcherOpts)) *sebbroker.Broker {
+	topicFactory := sebbroker.NewStorageTopicFactory(topicStorage, cache,
+		sebbroker.WithKeyProvider(keyProvider),
+		sebbroker.WithTopicOpts(topicOptFuncs...),
+	)
+	blockingBatcherFactory := sebbroker.NewBlockingBatcherFactory(blockTime, bytesSoftMax, batcherOptFuncs...)
+
+	brokerOptFuncs = append(brokerOptFuncs, sebbroker.WithBatcherFactory(blockingBatcherFactory))
+	return sebbroker.New(log.Name("storage"), topicFactory, brokerOptFuncs...)
+}
+
+// makeScrubber returns a scrubber of the record batches that broker keeps in
+// topicStorage, configured by flags.
+func makeScrubber(ctx context.Context, log logger.Logger, broker *sebbroker.Broker, topicStorage sebtopic.Storage, keyProvider sebtopic.KeyProvider, flags ServeFlags) (*sebbroker.Scrubber, error) {
+	optFuncs := []func(*sebtopic.ScrubOpts){
+		sebtopic.ScrubQuarantine(flags.scrubQuarantine),
+	}
+	if !flags.recordBatchCompress {
+		optFuncs = append(optFuncs, sebtopic.ScrubCompress(nil))
 	}
 
-	s3TopicFactory := sebbroker.NewS3TopicFactory(cfg, s3BucketName, cache)
-	blockingBatcherFactory := sebbroker.NewBlockingBatcherFactory(blockTime, bytesSoftMax)
+	if flags.scrubReplicaStorage != "" {
+		replica, err := sebtopic.NewStorageByName(ctx, log.Name("replica storage"), flags.scrubReplicaStorage, sebtopic.StorageConfig{
+			Dir:    flags.scrubReplicaStorageDir,
+			Bucket: flags.scrubReplicaS3BucketName,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("creating replica storage: %w", err)
+		}
+		if keyProvider != nil {
+			replica = sebtopic.NewEncryptedStorage(replica, keyProvider)
+		}
+		optFuncs = append(optFuncs, sebtopic.ScrubReplica(replica))
+	}
 
-	broker := sebbroker.New(
-		log.Name("storage"),
-		s3TopicFactory,
-		sebbroker.WithBatcherFactory(blockingBatcherFactory),
-	)
-	return broker, nil
+	if keyProvider != nil {
+		topicStorage = sebtopic.NewEncryptedStorage(topicStorage, keyProvider)
+	}
+
+	return sebbroker.NewScrubber(log, broker, topicStorage, optFuncs...), nil
+}
+
+// topicOptFuncs returns the topic options configured by flags.
+func topicOptFuncs(flags ServeFlags) []func(*sebtopic.Opts) {
+	optFuncs := []func(*sebtopic.Opts){
+		sebtopic.WithLargeRecordThreshold(flags.recordLargeThresholdBytes),
+		sebtopic.WithPrefetchBatches(flags.recordBatchPrefetch),
+		sebtopic.WithManifest(flags.topicManifest),
+		sebtopic.WithReadOnly(flags.readReplica),
+		sebtopic.WithEpoch(flags.epoch),
+	}
+	if flags.leaseHolder != "" {
+		optFuncs = append(optFuncs, sebtopic.WithLease(flags.leaseHolder, flags.leaseTTL))
+	}
+	if flags.writeBehindQueue > 0 {
+		optFuncs = append(optFuncs, sebtopic.WithWriteBehind(flags.writeBehindQueue, flags.writeBehindRetry))
+	}
+	switch {
+	case !flags.recordBatchCompress:
+		optFuncs = append(optFuncs, sebtopic.WithCompress(nil))
+	case flags.recordBatchCompressWorkers != 1:
+		optFuncs = append(optFuncs, sebtopic.WithCompress(sebtopic.ParallelGzip{
+			ChunkSize: flags.recordBatchCompressChunkBytes,
+			Workers:   flags.recordBatchCompressWorkers,
+		}))
+	}
+	return optFuncs
 }
 
 type ServeFlags struct {
-	logLevel int
+	configFile string
+
+	logLevel  int
+	logFormat string
+
+	storage          string
+	storageDir       string
+	storageMmap      bool
+	storageOpenFiles int
+	storageParams    map[string]string
+
+	storageWatchInterval time.Duration
+
+	readReplica         bool
+	readReplicaInterval time.Duration
+
+	epoch       uint64
+	leaseHolder string
+	leaseTTL    time.Duration
+
+	storageMemoryMaxBytes int64
+	storageMemorySpillDir string
+
+	s3BucketName         string
+	s3StagingDir         string
+	s3Endpoint           string
+	s3PathStyle          bool
+	s3InsecureSkipVerify bool
+	s3NotFoundTTL        time.Duration
+	s3RetryAttempts      int
+	s3RetryBaseDelay     time.Duration
+	s3RetryMaxDelay      time.Duration
+	s3BreakerFailures    int
+	s3BreakerCooldown    time.Duration
+	s3UploadsMax         int
 
-	s3BucketName string
+	encryptionKeyID string
 
 	httpListenAddress  string
 	httpListenPort     int
 	httpConnectionsMax int
 	httpAPIKey         string
+	handoverTimeout    time.Duration
+
+	httpAdminAPIKey      string
+	httpAPIKeyGrantsFile string
+
+	httpOIDCIssuer          string
+	httpOIDCAudience        string
+	httpOIDCJWKSURL         string
+	httpOIDCJWKSCacheTTL    time.Duration
+	httpOIDCIdentityClaim   string
+	httpOIDCClaimGrantsFile string
+
+	httpTLSCertFile                string
+	httpTLSKeyFile                 string
+	httpTLSClientCAFile            string
+	httpTLSRequireClientCert       bool
+	httpTLSAllowedClientIdentities []string
+
+	httpReadHeaderTimeout time.Duration
+	httpReadTimeout       time.Duration
+	httpWriteTimeout      time.Duration
+	httpIdleTimeout       time.Duration
+	httpHeaderMaxBytes    int
+	httpBodyMaxBytes      int64
+	httpShutdownTimeout   time.Duration
+
+	httpCompressMinBytes int
 
 	httpEnableDebug        bool
 	httpDebugListenAddress string
 	httpDebugListenPort    int
 
-	cacheDir              string
-	cacheMaxBytes         int64
-	cacheEvictionInterval time.Duration
+	cacheStorage             string
+	cacheStorageParams       map[string]string
+	cacheDir                 string
+	cacheHashKeys            bool
+	cacheMaxBytes            int64
+	cacheMaintenanceMaxBytes int64
+	cacheEvictionInterval    time.Duration
+	cacheMaxItemBytes        int64
+	cacheTailBatches         int
+	cacheTopicMaxBytes       int64
+	cacheTopicQuotas         map[string]int64
+
+	retentionInterval time.Duration
+
+	groupMaxIdle        time.Duration
+	groupExpiryInterval time.Duration
+	groupAssignor       string
+	groupSessionTimeout time.Duration
+
+	scrubInterval            time.Duration
+	scrubQuarantine          bool
+	scrubReplicaStorage      string
+	scrubReplicaStorageDir   string
+	scrubReplicaS3BucketName string
+
+	replicaVerifyStorage      string
+	replicaVerifyStorageDir   string
+	replicaVerifyS3BucketName string
+	replicaVerifyInterval     time.Duration
+
+	usageReconcileInterval time.Duration
+
+	quotasFile string
+
+	mergeInterval   time.Duration
+	mergeMaxRecords int
+	mergeMaxBytes   int
 
 	recordBatchBlockTime    time.Duration
+	recordBatchIdleTime     time.Duration
 	recordBatchSoftMaxBytes int
 	recordBatchMaxRecords   int
 	recordBatchHardMaxBytes int
+
+	recordBatchPendingMaxBytes   int
+	recordBatchPendingMaxRecords int
+	recordBatchPendingTimeout    time.Duration
+
+	dedupWindow time.Duration
+
+	recordLargeThresholdBytes     int
+	recordBatchCompress           bool
+	writeBehindQueue              int
+	writeBehindRetry              time.Duration
+	recordBatchCompressWorkers    int
+	recordBatchCompressChunkBytes int
+	recordBatchPrefetch           int
+	topicManifest                 bool
+
+	fetchDefaultMaxRecords int
+	fetchMaxRecords        int
+	fetchMaxBytesInFlight  int
 }
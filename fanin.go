@@ -0,0 +1,266 @@
+package seb
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// FanInTopic is a topic consumed by FanInConsumer.
+type FanInTopic struct {
+	TopicName string
+
+	// Offset is the offset of the first record to consume.
+	Offset uint64
+
+	// Priority orders topics strictly: records of a topic are only delivered
+	// when no topic with a higher priority has records available.
+	Priority int
+
+	// Weight is the share of records delivered from the topic relative to the
+	// other topics with the same priority, when all of them have records
+	// available. Defaults to 1.
+	Weight int
+}
+
+// FanInRecord is a record delivered by FanInConsumer.
+type FanInRecord struct {
+	TopicName string
+	Data      []byte
+}
+
+type FanInOpts struct {
+	// PollInterval is how often topics are polled for new records while none
+	// are available. Defaults to 100ms.
+	PollInterval time.Duration
+}
+
+// WithFanInPollInterval sets the interval that topics are polled at while no
+// records are available.
+func WithFanInPollInterval(pollInterval time.Duration) func(*FanInOpts) {
+	return func(o *FanInOpts) {
+		o.PollInterval = pollInterval
+	}
+}
+
+// FanInConsumer consumes records from several topics and merges them into a
+// single stream, e.g. to consume a control-plane topic before a bulk topic.
+// Topics are drained by priority, and topics of the same priority share the
+// stream by their weights. Records of each topic are delivered in order.
+//
+// FanInConsumer is not safe for concurrent use.
+type FanInConsumer struct {
+	client       *RecordClient
+	pollInterval time.Duration
+
+	// levels holds the topics by priority, highest priority first.
+	levels [][]*fanInTopic
+}
+
+type fanInTopic struct {
+	FanInTopic
+
+	// pending are records that have been read from offset but not yet
+	// delivered, and nextOffset is the offset to read from once they have
+	// been delivered.
+	pending    [][]byte
+	offset     uint64
+	nextOffset uint64
+
+	// current is the topic's smooth weighted round-robin counter.
+	current int
+}
+
+// NewFanInConsumer returns a FanInConsumer that consumes topics.
+// seberr.ErrBadInput is returned if no topics are given, topics are given
+// more than once or weights are negative.
+func NewFanInConsumer(client *RecordClient, topics []FanInTopic, optFuncs ...func(*FanInOpts)) (*FanInConsumer, error) {
+	opts := FanInOpts{
+		PollInterval: 100 * time.Millisecond,
+	}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("%w: at least one topic must be given", seberr.ErrBadInput)
+	}
+
+	topics = slices.Clone(topics)
+	slices.SortStableFunc(topics, func(a, b FanInTopic) int {
+		return cmp.Compare(b.Priority, a.Priority)
+	})
+
+	seen := make(map[string]bool, len(topics))
+	levels := [][]*fanInTopic{}
+	for i, topic := range topics {
+		if seen[topic.TopicName] {
+			return nil, fmt.Errorf("%w: topic '%s' given more than once", seberr.ErrBadInput, topic.TopicName)
+		}
+		seen[topic.TopicName] = true
+
+		if topic.Weight < 0 {
+			return nil, fmt.Errorf("%w: weight of topic '%s' must not be negative", seberr.ErrBadInput, topic.TopicName)
+		}
+		if topic.Weight == 0 {
+			topic.Weight = 1
+		}
+
+		if i == 0 || topic.Priority != topics[i-1].Priority {
+			levels = append(levels, nil)
+		}
+		levels[len(levels)-1] = append(levels[len(levels)-1], &fanInTopic{
+			FanInTopic: topic,
+			offset:     topic.Offset,
+			nextOffset: topic.Offset,
+		})
+	}
+
+	return &FanInConsumer{
+		client:       client,
+		pollInterval: opts.PollInterval,
+		levels:       levels,
+	}, nil
+}
+
+// Next returns up to input.MaxRecords records merged from the consumer's
+// topics. If no records are available, topics are polled until input.Timeout
+// has passed, or not at all if input.NonBlocking is set, after which no
+// records are returned.
+//
+// Topics that don't exist yet, and topics whose delivery to input.Group is
+// paused, are skipped. input.Buffer isn't used since records of several
+// topics are kept at the same time, but its capacity limits the bytes read
+// per topic.
+func (c *FanInConsumer) Next(input GetRecordsInput) ([]FanInRecord, error) {
+	if input.MaxRecords == 0 {
+		input.MaxRecords = 10
+	}
+	if input.Timeout == 0 {
+		input.Timeout = 10 * time.Second
+	}
+
+	deadline := time.Now().Add(input.Timeout)
+	for {
+		records, err := c.next(input)
+		if err != nil || len(records) > 0 || input.NonBlocking {
+			return records, err
+		}
+
+		untilDeadline := time.Until(deadline)
+		if untilDeadline <= 0 {
+			return records, nil
+		}
+		time.Sleep(min(c.pollInterval, untilDeadline))
+	}
+}
+
+// Offsets returns the offset to continue consuming each topic from, by topic
+// name, e.g. by giving them as FanInTopic.Offset to a new FanInConsumer.
+//
+// The offsets of records within a read aren't known since expired records
+// are skipped, so topics whose records have only been partly delivered
+// continue from the start of the read. Records are therefore delivered at
+// least once when consuming is continued.
+func (c *FanInConsumer) Offsets() map[string]uint64 {
+	offsets := map[string]uint64{}
+	for _, level := range c.levels {
+		for _, topic := range level {
+			offsets[topic.TopicName] = topic.offset
+		}
+	}
+
+	return offsets
+}
+
+func (c *FanInConsumer) next(input GetRecordsInput) ([]FanInRecord, error) {
+	records := []FanInRecord{}
+	for _, level := range c.levels {
+		for _, topic := range level {
+			err := c.fetch(topic, input)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for len(records) < input.MaxRecords {
+			topic := pickWeighted(level)
+			if topic == nil {
+				break
+			}
+
+			records = append(records, FanInRecord{
+				TopicName: topic.TopicName,
+				Data:      topic.pending[0],
+			})
+			topic.pending = topic.pending[1:]
+			if len(topic.pending) == 0 {
+				topic.offset = topic.nextOffset
+			}
+		}
+
+		if len(records) == input.MaxRecords {
+			break
+		}
+	}
+
+	return records, nil
+}
+
+// fetch reads the next records of topic if it has no pending records.
+func (c *FanInConsumer) fetch(topic *fanInTopic, input GetRecordsInput) error {
+	if len(topic.pending) > 0 {
+		return nil
+	}
+
+	input.NonBlocking = true
+	if input.Buffer != nil {
+		input.Buffer = make([]byte, 0, cap(input.Buffer))
+	}
+
+	records, nextOffset, err := c.client.GetRecordsNextOffset(topic.TopicName, topic.offset, input)
+	if err != nil {
+		if errors.Is(err, seberr.ErrOffsetOutOfBounds) || errors.Is(err, seberr.ErrNotFound) || errors.Is(err, seberr.ErrGroupPaused) {
+			return nil
+		}
+		return fmt.Errorf("getting records of topic '%s': %w", topic.TopicName, err)
+	}
+
+	topic.pending = records
+	topic.nextOffset = nextOffset
+	if len(records) == 0 {
+		topic.offset = nextOffset
+	}
+
+	return nil
+}
+
+// pickWeighted returns the topic of topics with pending records to deliver
+// the next record from, using smooth weighted round-robin such that records
+// are interleaved by the topics' weights. nil is returned if no topics have
+// pending records.
+func pickWeighted(topics []*fanInTopic) *fanInTopic {
+	var picked *fanInTopic
+	totalWeight := 0
+	for _, topic := range topics {
+		if len(topic.pending) == 0 {
+			continue
+		}
+
+		topic.current += topic.Weight
+		totalWeight += topic.Weight
+		if picked == nil || topic.current > picked.current {
+			picked = topic
+		}
+	}
+
+	if picked != nil {
+		picked.current -= totalWeight
+	}
+
+	return picked
+}
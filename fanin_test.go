@@ -0,0 +1,200 @@
+package seb_test
+
+import (
+	"testing"
+	"time"
+
+	seb "github.com/micvbang/simple-event-broker"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFanInConsumerPriority verifies that FanInConsumer only delivers records
+// of lower priority topics when higher priority topics have no records
+// available, and that records of each topic are delivered in order.
+func TestFanInConsumerPriority(t *testing.T) {
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	control := tester.MakeRandomRecordBatch(3)
+	err = client.AddRecords("control", control.Sizes, control.Data)
+	require.NoError(t, err)
+	bulk := tester.MakeRandomRecordBatch(5)
+	err = client.AddRecords("bulk", bulk.Sizes, bulk.Data)
+	require.NoError(t, err)
+
+	consumer, err := seb.NewFanInConsumer(client, []seb.FanInTopic{
+		{TopicName: "bulk"},
+		{TopicName: "control", Priority: 1},
+	})
+	require.NoError(t, err)
+
+	input := seb.GetRecordsInput{MaxRecords: 4, NonBlocking: true}
+
+	// Act
+	records, err := consumer.Next(input)
+	require.NoError(t, err)
+
+	// Assert
+	expected := []seb.FanInRecord{}
+	for _, record := range control.IndividualRecords() {
+		expected = append(expected, seb.FanInRecord{TopicName: "control", Data: record})
+	}
+	expected = append(expected, seb.FanInRecord{TopicName: "bulk", Data: bulk.IndividualRecords()[0]})
+	require.Equal(t, expected, records)
+
+	// bulk's read has only been partly delivered
+	require.Equal(t, map[string]uint64{"control": 3, "bulk": 0}, consumer.Offsets())
+
+	controlRecord := tester.MakeRandomRecordBatch(1)
+	err = client.AddRecords("control", controlRecord.Sizes, controlRecord.Data)
+	require.NoError(t, err)
+
+	// Act
+	records, err = consumer.Next(input)
+	require.NoError(t, err)
+
+	// Assert
+	expected = []seb.FanInRecord{{TopicName: "control", Data: controlRecord.IndividualRecords()[0]}}
+	for _, record := range bulk.IndividualRecords()[1:4] {
+		expected = append(expected, seb.FanInRecord{TopicName: "bulk", Data: record})
+	}
+	require.Equal(t, expected, records)
+	require.Equal(t, map[string]uint64{"control": 4, "bulk": 4}, consumer.Offsets())
+
+	// Act
+	records, err = consumer.Next(input)
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, []seb.FanInRecord{{TopicName: "bulk", Data: bulk.IndividualRecords()[4]}}, records)
+	require.Equal(t, map[string]uint64{"control": 4, "bulk": 5}, consumer.Offsets())
+}
+
+// TestFanInConsumerWeights verifies that FanInConsumer interleaves records of
+// topics with the same priority by their weights.
+func TestFanInConsumerWeights(t *testing.T) {
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	batches := map[string][][]byte{}
+	for _, topicName := range []string{"heavy", "light"} {
+		batch := tester.MakeRandomRecordBatch(6)
+		err = client.AddRecords(topicName, batch.Sizes, batch.Data)
+		require.NoError(t, err)
+		batches[topicName] = batch.IndividualRecords()
+	}
+
+	consumer, err := seb.NewFanInConsumer(client, []seb.FanInTopic{
+		{TopicName: "heavy", Weight: 2},
+		{TopicName: "light", Weight: 1},
+	})
+	require.NoError(t, err)
+
+	// Act
+	records, err := consumer.Next(seb.GetRecordsInput{MaxRecords: 6, NonBlocking: true})
+	require.NoError(t, err)
+
+	// Assert
+	expectedTopics := []string{"heavy", "light", "heavy", "heavy", "light", "heavy"}
+	gotTopics := []string{}
+	gotRecords := map[string][][]byte{}
+	for _, record := range records {
+		gotTopics = append(gotTopics, record.TopicName)
+		gotRecords[record.TopicName] = append(gotRecords[record.TopicName], record.Data)
+	}
+	require.Equal(t, expectedTopics, gotTopics)
+	require.Equal(t, batches["heavy"][:4], gotRecords["heavy"])
+	require.Equal(t, batches["light"][:2], gotRecords["light"])
+}
+
+// TestFanInConsumerResume verifies that a FanInConsumer started from the
+// offsets of another continues where it stopped.
+func TestFanInConsumerResume(t *testing.T) {
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	batch := tester.MakeRandomRecordBatch(6)
+	err = client.AddRecords("topic", batch.Sizes, batch.Data)
+	require.NoError(t, err)
+	records := batch.IndividualRecords()
+
+	consumer, err := seb.NewFanInConsumer(client, []seb.FanInTopic{{TopicName: "topic"}})
+	require.NoError(t, err)
+
+	input := seb.GetRecordsInput{MaxRecords: 4, NonBlocking: true}
+	got, err := consumer.Next(input)
+	require.NoError(t, err)
+	require.Len(t, got, 4)
+
+	// Act
+	resumed, err := seb.NewFanInConsumer(client, []seb.FanInTopic{{TopicName: "topic", Offset: consumer.Offsets()["topic"]}})
+	require.NoError(t, err)
+	got, err = resumed.Next(seb.GetRecordsInput{MaxRecords: 2, NonBlocking: true})
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, []seb.FanInRecord{{TopicName: "topic", Data: records[4]}, {TopicName: "topic", Data: records[5]}}, got)
+	require.Equal(t, map[string]uint64{"topic": 6}, resumed.Offsets())
+
+	got, err = resumed.Next(input)
+	require.NoError(t, err)
+	require.Empty(t, got)
+}
+
+// TestFanInConsumerTimeout verifies that FanInConsumer polls its topics until
+// the timeout has passed when no records are available, skipping topics that
+// don't exist.
+func TestFanInConsumerTimeout(t *testing.T) {
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	consumer, err := seb.NewFanInConsumer(client, []seb.FanInTopic{{TopicName: "missing"}}, seb.WithFanInPollInterval(10*time.Millisecond))
+	require.NoError(t, err)
+
+	const timeout = 50 * time.Millisecond
+	t0 := time.Now()
+
+	// Act
+	records, err := consumer.Next(seb.GetRecordsInput{Timeout: timeout})
+	require.NoError(t, err)
+
+	// Assert
+	require.Empty(t, records)
+	require.GreaterOrEqual(t, time.Since(t0), timeout)
+}
+
+// TestNewFanInConsumerErrors verifies that NewFanInConsumer rejects invalid
+// topics.
+func TestNewFanInConsumerErrors(t *testing.T) {
+	tests := map[string]struct {
+		topics []seb.FanInTopic
+	}{
+		"no topics":       {topics: nil},
+		"duplicate topic": {topics: []seb.FanInTopic{{TopicName: "a"}, {TopicName: "a", Priority: 1}}},
+		"negative weight": {topics: []seb.FanInTopic{{TopicName: "a", Weight: -1}}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			_, err := seb.NewFanInConsumer(nil, test.topics)
+
+			// Assert
+			require.ErrorIs(t, err, seberr.ErrBadInput)
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package seb
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// RequestInterceptor is called for every HTTP request made by RecordClient.
+// It must call next in order to send the request, and may modify the request
+// before sending it or inspect the response and error returned by next. This
+// makes it possible to add e.g. logging, metrics or headers to all requests
+// without wrapping every call site.
+type RequestInterceptor func(req *http.Request, next func(*http.Request) (*http.Response, error)) (*http.Response, error)
+
+// RecordInterceptor is called for every record that is added or retrieved by
+// RecordClient. Either of its fields may be nil.
+type RecordInterceptor struct {
+	// Produce is called for each record before it's sent to the server. The
+	// returned record is sent instead of the given one, making it possible
+	// to e.g. encrypt records or validate them against a schema. If an error
+	// is returned, no records are sent.
+	Produce func(topicName string, record []byte) ([]byte, error)
+
+	// Consume is called for each record received from the server. The
+	// returned record is returned to the caller instead of the given one. If
+	// an error is returned, the request fails.
+	Consume func(topicName string, record []byte) ([]byte, error)
+}
+
+// WithRequestInterceptors adds interceptors that are called for every HTTP
+// request. Interceptors are called in the order given, i.e. the first
+// interceptor is the outermost.
+func WithRequestInterceptors(interceptors ...RequestInterceptor) func(*RecordClientOpts) {
+	return func(o *RecordClientOpts) {
+		o.RequestInterceptors = append(o.RequestInterceptors, interceptors...)
+	}
+}
+
+// WithRecordInterceptors adds interceptors that are called for every record.
+// Produce interceptors are called in the order given, and Consume
+// interceptors in the reverse order, such that e.g. the first interceptor
+// encrypts last and decrypts first.
+func WithRecordInterceptors(interceptors ...RecordInterceptor) func(*RecordClientOpts) {
+	return func(o *RecordClientOpts) {
+		o.RecordInterceptors = append(o.RecordInterceptors, interceptors...)
+	}
+}
+
+// do sends req through the configured request interceptors.
+func (c *RecordClient) do(req *http.Request) (*http.Response, error) {
+	next := c.send
+	for i := len(c.requestInterceptors) - 1; i >= 0; i-- {
+		interceptor, inner := c.requestInterceptors[i], next
+		next = func(req *http.Request) (*http.Response, error) {
+			return interceptor(req, inner)
+		}
+	}
+
+	return next(req)
+}
+
+// interceptProduce runs the Produce record interceptors on all records
+// described by recordSizes and recordsData.
+func (c *RecordClient) interceptProduce(topicName string, recordSizes []uint32, recordsData []byte) ([]uint32, []byte, error) {
+	hasProduce := false
+	for _, interceptor := range c.recordInterceptors {
+		hasProduce = hasProduce || interceptor.Produce != nil
+	}
+	if !hasProduce {
+		return recordSizes, recordsData, nil
+	}
+
+	sizes := make([]uint32, 0, len(recordSizes))
+	data := make([]byte, 0, len(recordsData))
+
+	var dataOffset uint32
+	for i, recordSize := range recordSizes {
+		if int(dataOffset+recordSize) > len(recordsData) {
+			return nil, nil, fmt.Errorf("record %d exceeds data", i)
+		}
+		record := recordsData[dataOffset : dataOffset+recordSize]
+		dataOffset += recordSize
+
+		var err error
+		for _, interceptor := range c.recordInterceptors {
+			if interceptor.Produce == nil {
+				continue
+			}
+
+			record, err = interceptor.Produce(topicName, record)
+			if err != nil {
+				return nil, nil, fmt.Errorf("intercepting record %d: %w", i, err)
+			}
+		}
+
+		sizes = append(sizes, uint32(len(record)))
+		data = append(data, record...)
+	}
+
+	return sizes, data, nil
+}
+
+// interceptConsume runs the Consume record interceptors on all records,
+// replacing them in-place.
+func (c *RecordClient) interceptConsume(topicName string, records [][]byte) error {
+	for i := len(c.recordInterceptors) - 1; i >= 0; i-- {
+		interceptor := c.recordInterceptors[i]
+		if interceptor.Consume == nil {
+			continue
+		}
+
+		for j, record := range records {
+			record, err := interceptor.Consume(topicName, record)
+			if err != nil {
+				return fmt.Errorf("intercepting record %d: %w", j, err)
+			}
+			records[j] = record
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package seb_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/micvbang/go-helpy"
+	seb "github.com/micvbang/simple-event-broker"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRecordClientRequestInterceptors verifies that request interceptors are
+// called for every request, in the order they were given, and that they're
+// able to modify requests and observe responses.
+func TestRecordClientRequestInterceptors(t *testing.T) {
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	calls := []string{}
+	statusCodes := []int{}
+	interceptor := func(name string) seb.RequestInterceptor {
+		return func(req *http.Request, next func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+			calls = append(calls, name)
+			res, err := next(req)
+			if err == nil {
+				statusCodes = append(statusCodes, res.StatusCode)
+			}
+			return res, err
+		}
+	}
+
+	client, err := seb.NewRecordClient(srv.Server.URL, "invalid-api-key", seb.WithRequestInterceptors(
+		interceptor("first"),
+		interceptor("second"),
+		func(req *http.Request, next func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", tester.DefaultAPIKey))
+			return next(req)
+		},
+	))
+	require.NoError(t, err)
+
+	batch := tester.MakeRandomRecordBatch(3)
+
+	// Act
+	err = client.AddRecords("topicName", batch.Sizes, batch.Data)
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, []string{"first", "second"}, calls)
+	require.Equal(t, []int{http.StatusCreated, http.StatusCreated}, statusCodes)
+}
+
+// TestRecordClientRecordInterceptors verifies that Produce interceptors are
+// applied to each record before it's sent, and that Consume interceptors are
+// applied in reverse order to each record that is received.
+func TestRecordClientRecordInterceptors(t *testing.T) {
+	const topicName = "topicName"
+
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	wrap := func(prefix string) seb.RecordInterceptor {
+		return seb.RecordInterceptor{
+			Produce: func(_ string, record []byte) ([]byte, error) {
+				return append([]byte(prefix), record...), nil
+			},
+			Consume: func(_ string, record []byte) ([]byte, error) {
+				if !bytes.HasPrefix(record, []byte(prefix)) {
+					return nil, fmt.Errorf("expected prefix %s", prefix)
+				}
+				return record[len(prefix):], nil
+			},
+		}
+	}
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey, seb.WithRecordInterceptors(
+		wrap("a"),
+		wrap("bb"),
+	))
+	require.NoError(t, err)
+
+	batch := tester.MakeRandomRecordBatch(5)
+
+	// Act
+	err = client.AddRecords(topicName, batch.Sizes, batch.Data)
+	require.NoError(t, err)
+
+	// Assert
+	rawRecord, err := srv.Broker.GetRecord(context.Background(), helpy.Pointer(tester.NewBatch(1, 4096)), topicName, 0)
+	require.NoError(t, err)
+	require.Equal(t, append([]byte("bba"), batch.IndividualRecords()[0]...), rawRecord)
+
+	record, err := client.GetRecord(topicName, 1)
+	require.NoError(t, err)
+	require.Equal(t, batch.IndividualRecords()[1], record)
+
+	records, err := client.GetRecords(topicName, 0, seb.GetRecordsInput{
+		MaxRecords: batch.Len(),
+		Timeout:    time.Second,
+	})
+	require.NoError(t, err)
+	require.Equal(t, batch.IndividualRecords(), records)
+}
+
+// TestRecordClientRecordInterceptorError verifies that no records are sent
+// when a Produce interceptor returns an error.
+func TestRecordClientRecordInterceptorError(t *testing.T) {
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	expectedErr := fmt.Errorf("invalid record")
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey, seb.WithRecordInterceptors(
+		seb.RecordInterceptor{
+			Produce: func(_ string, record []byte) ([]byte, error) {
+				return nil, expectedErr
+			},
+		},
+	))
+	require.NoError(t, err)
+
+	batch := tester.MakeRandomRecordBatch(2)
+
+	// Act
+	err = client.AddRecords("topicName", batch.Sizes, batch.Data)
+
+	// Assert
+	require.ErrorIs(t, err, expectedErr)
+
+	_, err = srv.Broker.GetRecord(context.Background(), helpy.Pointer(tester.NewBatch(1, 4096)), "topicName", 0)
+	require.ErrorIs(t, err, seberr.ErrOutOfBounds)
+}
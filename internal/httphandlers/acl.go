@@ -0,0 +1,172 @@
+package httphandlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+)
+
+// APIKeyGrant gives an API key read-only access to a subset of the broker's
+// data. This supports data-minimization policies, e.g. for third-party
+// consumers that should only be able to read recent data.
+type APIKeyGrant struct {
+	APIKey string
+
+	// Topics are the topics that can be read, and Namespaces the prefixes of
+	// the names of topics that can be read. All topics except internal topics
+	// can be read if both are empty.
+	Topics     []string
+	Namespaces []string
+
+	// StartOffset and EndOffset limit reads to records in the offset range
+	// [StartOffset; EndOffset). EndOffset is ignored if 0.
+	StartOffset uint64
+	EndOffset   uint64
+
+	// MaxAge limits reads to records that were added within MaxAge of the
+	// time of reading. Ignored if 0.
+	MaxAge time.Duration
+}
+
+// ParseAPIKeyGrants parses a JSON list of API key grants, e.g.
+//
+//	[{"api_key": "...", "topics": ["orders"], "max_age": "24h"}]
+//
+// max_age is given in the format understood by time.ParseDuration.
+func ParseAPIKeyGrants(bs []byte) ([]APIKeyGrant, error) {
+	jsonGrants := []jsonGrant{}
+	err := json.Unmarshal(bs, &jsonGrants)
+	if err != nil {
+		return nil, fmt.Errorf("parsing api key grants: %w", err)
+	}
+
+	grants := make([]APIKeyGrant, 0, len(jsonGrants))
+	for i, jsonGrant := range jsonGrants {
+		if jsonGrant.APIKey == "" {
+			return nil, fmt.Errorf("api key grant %d: api key must be set", i)
+		}
+
+		grant, err := jsonGrant.grant()
+		if err != nil {
+			return nil, fmt.Errorf("api key grant %d: %w", i, err)
+		}
+
+		grants = append(grants, grant)
+	}
+
+	return grants, nil
+}
+
+// jsonGrant is the JSON representation of an APIKeyGrant.
+type jsonGrant struct {
+	APIKey      string   `json:"api_key"`
+	Topics      []string `json:"topics"`
+	Namespaces  []string `json:"namespaces"`
+	StartOffset uint64   `json:"start_offset"`
+	EndOffset   uint64   `json:"end_offset"`
+	MaxAge      string   `json:"max_age"`
+}
+
+func (jg jsonGrant) grant() (APIKeyGrant, error) {
+	var maxAge time.Duration
+	if jg.MaxAge != "" {
+		var err error
+		maxAge, err = time.ParseDuration(jg.MaxAge)
+		if err != nil {
+			return APIKeyGrant{}, fmt.Errorf("parsing max age: %w", err)
+		}
+	}
+
+	return APIKeyGrant{
+		APIKey:      jg.APIKey,
+		Topics:      jg.Topics,
+		Namespaces:  jg.Namespaces,
+		StartOffset: jg.StartOffset,
+		EndOffset:   jg.EndOffset,
+		MaxAge:      maxAge,
+	}, nil
+}
+
+// allowsTopic returns whether grant allows reading topicName. Internal topics
+// can only be read if they're explicitly allowed by the grant.
+func (grant APIKeyGrant) allowsTopic(topicName string) bool {
+	if len(grant.Topics) == 0 && len(grant.Namespaces) == 0 {
+		return !sebbroker.IsInternalTopic(topicName)
+	}
+
+	if slices.Contains(grant.Topics, topicName) {
+		return true
+	}
+
+	for _, namespace := range grant.Namespaces {
+		if strings.HasPrefix(topicName, namespace) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readLimits returns the sebtopic.ReadLimits of grant at now.
+func (grant APIKeyGrant) readLimits(now time.Time) sebtopic.ReadLimits {
+	limits := sebtopic.ReadLimits{
+		StartOffset: grant.StartOffset,
+		EndOffset:   grant.EndOffset,
+	}
+	if grant.MaxAge > 0 {
+		limits.NotBefore = now.Add(-grant.MaxAge)
+	}
+
+	return limits
+}
+
+// newReadACLHandler returns an http.HandlerFunc that can be used to wrap
+// read-only http.HandlerFuncs. It allows requests with full access without
+// restrictions, and other authenticated requests with the restrictions of
+// their grant: the requested topic must be allowed by the grant, and records
+// are read with the grant's sebtopic.ReadLimits.
+func newReadACLHandler(log logger.Logger, auth Authenticator) func(http.HandlerFunc) http.HandlerFunc {
+	return func(hf http.HandlerFunc) http.HandlerFunc {
+		return newAuthHandler(log, auth, func(w http.ResponseWriter, r *http.Request, access Access) {
+			if access.Full {
+				hf.ServeHTTP(w, r)
+				return
+			}
+
+			topicName := requestTopicName(r)
+			if !access.Grant.allowsTopic(topicName) {
+				log.Infof("not allowed to read topic '%s'", topicName)
+				r.Body.Close()
+				httphelpers.WriteErrorf(w, http.StatusForbidden, "not allowed to read topic '%s'", topicName)
+				return
+			}
+
+			ctx := sebtopic.WithReadLimits(r.Context(), access.Grant.readLimits(time.Now()))
+			hf.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// newFullAccessHandler returns an http.HandlerFunc that can be used to wrap
+// other http.HandlerFuncs. It only allows requests with full access.
+func newFullAccessHandler(log logger.Logger, auth Authenticator) func(http.HandlerFunc) http.HandlerFunc {
+	return func(hf http.HandlerFunc) http.HandlerFunc {
+		return newAuthHandler(log, auth, func(w http.ResponseWriter, r *http.Request, access Access) {
+			if !access.Full {
+				log.Infof("full access required")
+				invalidAuth(w, r)
+				return
+			}
+
+			hf.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package httphandlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/httphandlers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReadACL verifies that API key grants only give access to reading the
+// records of their topics within their offset ranges, and that they don't
+// give access to writing.
+func TestReadACL(t *testing.T) {
+	const (
+		topicName      = "topic"
+		otherTopicName = "other-topic"
+		grantAPIKey    = "grant-api-key"
+	)
+
+	server := tester.HTTPServer(t, tester.HTTPAPIKeyGrants(httphandlers.APIKeyGrant{
+		APIKey:      grantAPIKey,
+		Topics:      []string{topicName},
+		StartOffset: 5,
+		EndOffset:   10,
+	}))
+	defer server.Close()
+
+	for _, name := range []string{topicName, otherTopicName} {
+		_, err := server.Broker.AddRecords(name, tester.MakeRandomRecordBatch(20))
+		require.NoError(t, err)
+	}
+
+	tests := map[string]struct {
+		method     string
+		path       string
+		apiKey     string
+		topicName  string
+		offset     uint64
+		statusCode int
+	}{
+		"full api key, offset outside grant": {
+			method:     "GET",
+			path:       "/record",
+			apiKey:     tester.DefaultAPIKey,
+			topicName:  otherTopicName,
+			offset:     15,
+			statusCode: http.StatusOK,
+		},
+		"grant, offset within grant": {
+			method:     "GET",
+			path:       "/record",
+			apiKey:     grantAPIKey,
+			topicName:  topicName,
+			offset:     5,
+			statusCode: http.StatusOK,
+		},
+		"grant, offset before grant": {
+			method:     "GET",
+			path:       "/record",
+			apiKey:     grantAPIKey,
+			topicName:  topicName,
+			offset:     4,
+			statusCode: http.StatusNotFound,
+		},
+		"grant, offset after grant": {
+			method:     "GET",
+			path:       "/record",
+			apiKey:     grantAPIKey,
+			topicName:  topicName,
+			offset:     10,
+			statusCode: http.StatusNotFound,
+		},
+		"grant, other topic": {
+			method:     "GET",
+			path:       "/record",
+			apiKey:     grantAPIKey,
+			topicName:  otherTopicName,
+			offset:     5,
+			statusCode: http.StatusForbidden,
+		},
+		"grant, write": {
+			method:     "POST",
+			path:       "/records",
+			apiKey:     grantAPIKey,
+			topicName:  topicName,
+			statusCode: http.StatusUnauthorized,
+		},
+		"grant, topic metadata": {
+			method:     "GET",
+			path:       "/topic",
+			apiKey:     grantAPIKey,
+			topicName:  topicName,
+			statusCode: http.StatusUnauthorized,
+		},
+		"unknown api key": {
+			method:     "GET",
+			path:       "/record",
+			apiKey:     "unknown",
+			topicName:  topicName,
+			offset:     5,
+			statusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, test.path, nil)
+			r.Header.Add(httphelpers.APIKeyHeader, test.apiKey)
+			httphelpers.AddQueryParams(r, map[string]string{
+				"topic-name": test.topicName,
+				"offset":     fmt.Sprintf("%d", test.offset),
+			})
+
+			// Act
+			response := server.Do(r)
+
+			// Assert
+			require.Equal(t, test.statusCode, response.StatusCode)
+		})
+	}
+}
+
+// TestReadACLGetRecordsNextOffset verifies that records outside of an API
+// key grant's offset range are skipped when reading multiple records, and that
+// the Next-Offset header reflects the skipped records.
+func TestReadACLGetRecordsNextOffset(t *testing.T) {
+	const (
+		topicName   = "topic"
+		grantAPIKey = "grant-api-key"
+	)
+
+	server := tester.HTTPServer(t, tester.HTTPAPIKeyGrants(httphandlers.APIKeyGrant{
+		APIKey:      grantAPIKey,
+		StartOffset: 5,
+	}))
+	defer server.Close()
+
+	_, err := server.Broker.AddRecords(topicName, tester.MakeRandomRecordBatch(20))
+	require.NoError(t, err)
+
+	r := httptest.NewRequest("GET", "/records", nil)
+	r.Header.Add(httphelpers.APIKeyHeader, grantAPIKey)
+	r.Header.Add("Accept", "multipart/form-data")
+	httphelpers.AddQueryParams(r, map[string]string{
+		"topic-name":  topicName,
+		"offset":      "0",
+		"max-records": "100",
+		"timeout":     "10ms",
+	})
+
+	// Act
+	response := server.Do(r)
+
+	// Assert
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.Equal(t, "20", response.Header.Get(httphandlers.NextOffsetHeader))
+}
+
+// TestReadACLCursorTopic verifies that API key grants are enforced for the
+// topic of a cursor, such that cursors can't be used to read other topics.
+func TestReadACLCursorTopic(t *testing.T) {
+	const grantAPIKey = "grant-api-key"
+
+	server := tester.HTTPServer(t, tester.HTTPAPIKeyGrants(httphandlers.APIKeyGrant{
+		APIKey: grantAPIKey,
+		Topics: []string{"allowed"},
+	}))
+	defer server.Close()
+
+	_, err := server.Broker.AddRecords("forbidden", tester.MakeRandomRecordBatch(2))
+	require.NoError(t, err)
+
+	r := httptest.NewRequest("GET", "/records?topic-name=forbidden&offset=0&timeout=10ms", nil)
+	r.Header.Add("Accept", "multipart/form-data")
+	cursor := server.DoWithAuth(r).Header.Get(httphandlers.NextCursorHeader)
+	require.NotEmpty(t, cursor)
+
+	r = httptest.NewRequest("GET", "/records", nil)
+	r.Header.Add(httphelpers.APIKeyHeader, grantAPIKey)
+	r.Header.Add("Accept", "multipart/form-data")
+	httphelpers.AddQueryParams(r, map[string]string{
+		"cursor":  cursor,
+		"timeout": "10ms",
+	})
+
+	// Act
+	response := server.Do(r)
+
+	// Assert
+	require.Equal(t, http.StatusForbidden, response.StatusCode)
+}
+
+// TestParseAPIKeyGrants verifies that ParseAPIKeyGrants() parses API key
+// grants from JSON, and returns an error for invalid grants.
+func TestParseAPIKeyGrants(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected []httphandlers.APIKeyGrant
+		err      bool
+	}{
+		"valid": {
+			input: `[{"api_key": "key", "topics": ["a", "b"], "start_offset": 1, "end_offset": 2, "max_age": "24h"}]`,
+			expected: []httphandlers.APIKeyGrant{{
+				APIKey:      "key",
+				Topics:      []string{"a", "b"},
+				StartOffset: 1,
+				EndOffset:   2,
+				MaxAge:      24 * time.Hour,
+			}},
+		},
+		"missing api key": {
+			input: `[{"topics": ["a"]}]`,
+			err:   true,
+		},
+		"invalid max age": {
+			input: `[{"api_key": "key", "max_age": "a day"}]`,
+			err:   true,
+		},
+		"invalid json": {
+			input: `{`,
+			err:   true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			got, err := httphandlers.ParseAPIKeyGrants([]byte(test.input))
+
+			// Assert
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, got)
+		})
+	}
+}
@@ -1,26 +1,56 @@
 package httphandlers
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"mime"
 	"net/http"
+	"time"
 
 	"github.com/micvbang/go-helpy/syncy"
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
 	"github.com/micvbang/simple-event-broker/internal/sebrecords"
 	"github.com/micvbang/simple-event-broker/seberr"
 )
 
 type RecordsAdder interface {
-	AddRecords(topicName string, batch sebrecords.Batch) ([]uint64, error)
+	AddRecordsResult(ctx context.Context, topicName string, batch sebrecords.Batch) (sebbroker.AddResult, error)
 }
 
+// writesFrozenRetryAfterSeconds is the value of the Retry-After header that is
+// returned to clients when writes are frozen.
+const writesFrozenRetryAfterSeconds = "5"
+
+// backpressureRetryAfterSeconds is the value of the Retry-After header that is
+// returned to clients when the broker has too many pending records.
+const backpressureRetryAfterSeconds = "1"
+
 type AddRecordsOutput struct {
 	Offsets []uint64 `json:"offsets"`
+
+	// BatchID and BatchKey identify the record batch that the records were
+	// committed in. They're omitted if unknown.
+	BatchID  *uint64 `json:"batch_id,omitempty"`
+	BatchKey string  `json:"batch_key,omitempty"`
+
+	// BatchWaitUs is the number of microseconds that the records waited for
+	// their batch to be committed, and CommitLatencyUs the total number of
+	// microseconds that the broker spent adding them.
+	BatchWaitUs     int64 `json:"batch_wait_us"`
+	CommitLatencyUs int64 `json:"commit_latency_us"`
+
+	// Duplicate is true if the records weren't added because an identical
+	// batch was added recently; Offsets are then those of that batch.
+	Duplicate bool `json:"duplicate,omitempty"`
 }
 
+// AddRecords adds the records given as multipart form data to a topic. The
+// request body may be compressed using one of
+// httphelpers.AcceptedRequestEncodings, as given by its Content-Encoding
+// header; 415 Unsupported Media Type is returned for other encodings.
 func AddRecords(log logger.Logger, bufPool *syncy.Pool[*sebrecords.Batch], s RecordsAdder) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
@@ -28,48 +58,129 @@ func AddRecords(log logger.Logger, bufPool *syncy.Pool[*sebrecords.Batch], s Rec
 
 		params, err := parseQueryParams(r, QParam{topicNameKey, QueryString})
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, err.Error())
+			httphelpers.WriteError(w, http.StatusBadRequest, err)
 			return
 		}
 		topicName := params[topicNameKey].(string)
 
+		if !requireInternalTopicAccess(log, w, r, topicName) {
+			return
+		}
+
 		mediaType, mediaParams, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
 		if err != nil || mediaType != multipartFormData {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, "expected Content-Type %s", multipartFormData)
+			httphelpers.WriteErrorf(w, http.StatusBadRequest, "expected Content-Type %s", multipartFormData)
+			return
+		}
+
+		traceID := r.Header.Get(httphelpers.TraceIDHeader)
+		if len(traceID) > sebrecords.MaxTraceIDLen {
+			httphelpers.WriteErrorf(w, http.StatusBadRequest, "%s must be at most %d bytes", httphelpers.TraceIDHeader, sebrecords.MaxTraceIDLen)
+			return
+		}
+
+		var producedAt time.Time
+		if v := r.Header.Get(httphelpers.ProducedAtHeader); v != "" {
+			producedAt, err = time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				httphelpers.WriteErrorf(w, http.StatusBadRequest, "parsing %s '%s' as an RFC3339 timestamp", httphelpers.ProducedAtHeader, v)
+				return
+			}
+		}
+
+		body, err := httphelpers.RequestBody(r)
+		if err != nil {
+			if errors.Is(err, httphelpers.ErrUnsupportedEncoding) {
+				w.Header().Set("Accept-Encoding", httphelpers.AcceptedRequestEncodings)
+				httphelpers.WriteError(w, http.StatusUnsupportedMediaType, err)
+				return
+			}
+			httphelpers.WriteError(w, http.StatusBadRequest, err)
 			return
 		}
+		defer body.Close()
 
 		batch := bufPool.Get()
 		defer bufPool.Put(batch)
-		err = httphelpers.MultipartFormDataToRecords(r.Body, mediaParams["boundary"], batch)
+		err = httphelpers.MultipartFormDataToRecords(body, mediaParams["boundary"], batch)
 		if err != nil {
+			var maxBytesErr *http.MaxBytesError
 			switch {
+			case errors.As(err, &maxBytesErr):
+				httphelpers.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("%w: %s", seberr.ErrPayloadTooLarge, err))
 			case errors.Is(err, seberr.ErrBadInput):
-				w.WriteHeader(http.StatusBadRequest)
+				httphelpers.WriteError(w, http.StatusBadRequest, err)
 			default:
-				w.WriteHeader(http.StatusInternalServerError)
+				httphelpers.WriteError(w, http.StatusInternalServerError, err)
 			}
 			return
 		}
 
-		offsets, err := s.AddRecords(topicName, *batch)
+		if !producedAt.IsZero() {
+			batch.ProducedUnixEpochUs = producedAt.UnixMicro()
+		}
+
+		if traceID != "" && batch.Len() > 0 {
+			batch.Traces = append(batch.Traces, sebrecords.Trace{
+				ID:         traceID,
+				NumRecords: uint32(batch.Len()),
+			})
+		}
+
+		ctx := r.Context()
+		if identity, ok := httphelpers.IdentityFromContext(ctx); ok {
+			ctx = sebbroker.ContextWithPrincipal(ctx, identity)
+		}
+
+		result, err := s.AddRecordsResult(ctx, topicName, *batch)
 		if err != nil {
 			if errors.Is(err, seberr.ErrPayloadTooLarge) {
-				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				httphelpers.WriteError(w, http.StatusRequestEntityTooLarge, err)
+				return
+			}
+
+			if errors.Is(err, seberr.ErrBadInput) {
+				httphelpers.WriteError(w, http.StatusBadRequest, err)
+				return
+			}
+
+			if errors.Is(err, seberr.ErrWritesFrozen) {
+				log.Debugf("writes frozen: %s", err)
+				w.Header().Set("Retry-After", writesFrozenRetryAfterSeconds)
+				httphelpers.WriteError(w, http.StatusServiceUnavailable, err)
+				return
+			}
+
+			if errors.Is(err, seberr.ErrBackpressure) {
+				log.Debugf("backpressure: %s", err)
+				w.Header().Set("Retry-After", backpressureRetryAfterSeconds)
+				httphelpers.WriteError(w, http.StatusTooManyRequests, err)
+				return
+			}
+
+			if errors.Is(err, seberr.ErrQuotaExceeded) {
+				log.Debugf("quota exceeded: %s", err)
+				httphelpers.WriteError(w, http.StatusInsufficientStorage, err)
 				return
 			}
 
 			log.Errorf("failed to add: %s", err.Error())
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprint(w, err.Error())
+			httphelpers.WriteError(w, http.StatusInternalServerError, err)
 			return
 		}
 
-		err = httphelpers.WriteJSONWithStatusCode(w, http.StatusCreated, AddRecordsOutput{
-			Offsets: offsets,
-		})
+		output := AddRecordsOutput{
+			Offsets:         result.Offsets,
+			BatchWaitUs:     result.BatchWait.Microseconds(),
+			CommitLatencyUs: result.CommitLatency.Microseconds(),
+			Duplicate:       result.Duplicate,
+		}
+		if result.HasBatch {
+			output.BatchID = &result.BatchID
+			output.BatchKey = result.BatchKey
+		}
+
+		err = httphelpers.WriteJSONWithStatusCode(w, http.StatusCreated, output)
 		if err != nil {
 			log.Errorf("failed to write json: %s", err)
 		}
@@ -2,14 +2,19 @@ package httphandlers_test
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/micvbang/simple-event-broker/internal/httphandlers"
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
 	"github.com/micvbang/simple-event-broker/internal/sebrecords"
 	"github.com/micvbang/simple-event-broker/seberr"
 	"github.com/stretchr/testify/require"
@@ -56,16 +61,66 @@ func TestAddRecordsHappyPath(t *testing.T) {
 	err = server.Broker.GetRecords(context.Background(), &batch, topicName, 0, inputBatch.Len(), 0)
 	require.NoError(t, err)
 
+	inputBatch.StopReason = sebrecords.StopReasonMaxRecords
 	require.Equal(t, inputBatch, batch)
 }
 
+// TestAddRecordsOutputBatch verifies that the record batch that records were
+// committed in, and the time spent committing them, are returned, and that
+// the batch is omitted when it's unknown.
+func TestAddRecordsOutputBatch(t *testing.T) {
+	batchID := uint64(42)
+
+	tests := map[string]struct {
+		result           sebbroker.AddResult
+		expectedBatchID  *uint64
+		expectedBatchKey string
+	}{
+		"batch": {
+			result:           sebbroker.AddResult{Offsets: []uint64{42}, HasBatch: true, BatchID: batchID, BatchKey: "topic/000000000042.record_batch", BatchWait: 1500 * time.Microsecond, CommitLatency: 2 * time.Millisecond},
+			expectedBatchID:  &batchID,
+			expectedBatchKey: "topic/000000000042.record_batch",
+		},
+		"no batch": {
+			result: sebbroker.AddResult{Offsets: []uint64{42}, BatchWait: 1500 * time.Microsecond, CommitLatency: 2 * time.Millisecond},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			deps := &httphandlers.MockDependencies{}
+			deps.AddRecordsResultMock = func(ctx context.Context, topicName string, batch sebrecords.Batch) (sebbroker.AddResult, error) {
+				return test.result, nil
+			}
+
+			server := tester.HTTPServer(t, tester.HTTPDependencies(deps))
+			defer server.Close()
+
+			// Act
+			response := server.DoWithAuth(addRecordsRequest(t, "topic"))
+
+			// Assert
+			require.Equal(t, http.StatusCreated, response.StatusCode)
+
+			output := httphandlers.AddRecordsOutput{}
+			err := httphelpers.ParseJSONAndClose(response.Body, &output)
+			require.NoError(t, err)
+			require.Equal(t, test.result.Offsets, output.Offsets)
+			require.Equal(t, test.expectedBatchID, output.BatchID)
+			require.Equal(t, test.expectedBatchKey, output.BatchKey)
+			require.Equal(t, int64(1500), output.BatchWaitUs)
+			require.Equal(t, int64(2000), output.CommitLatencyUs)
+		})
+	}
+}
+
 // TestAddRecordsPayloadTooLarge verifies that http.StatusRequestEntityTooLarge
 // is returned when AddRecords() receives seberr.ErrPayloadTooLarge from its
 // dependency.
 func TestAddRecordsPayloadTooLarge(t *testing.T) {
 	deps := &httphandlers.MockDependencies{}
-	deps.AddRecordsMock = func(topicName string, batch sebrecords.Batch) ([]uint64, error) {
-		return nil, seberr.ErrPayloadTooLarge
+	deps.AddRecordsResultMock = func(ctx context.Context, topicName string, batch sebrecords.Batch) (sebbroker.AddResult, error) {
+		return sebbroker.AddResult{}, seberr.ErrPayloadTooLarge
 	}
 
 	server := tester.HTTPServer(t, tester.HTTPDependencies(deps))
@@ -91,6 +146,176 @@ func TestAddRecordsPayloadTooLarge(t *testing.T) {
 	require.Equal(t, http.StatusRequestEntityTooLarge, response.StatusCode)
 }
 
+// TestAddRecordsBackpressure verifies that http.StatusTooManyRequests and a
+// Retry-After header are returned when AddRecordsResult() returns
+// seberr.ErrBackpressure.
+func TestAddRecordsBackpressure(t *testing.T) {
+	deps := &httphandlers.MockDependencies{}
+	deps.AddRecordsResultMock = func(ctx context.Context, topicName string, batch sebrecords.Batch) (sebbroker.AddResult, error) {
+		return sebbroker.AddResult{}, seberr.ErrBackpressure
+	}
+
+	server := tester.HTTPServer(t, tester.HTTPDependencies(deps))
+	defer server.Close()
+
+	batch := tester.MakeRandomRecordBatch(1)
+
+	buf := bytes.NewBuffer(nil)
+	r := httptest.NewRequest("POST", "/records", buf)
+	contentType, err := httphelpers.RecordsToMultipartFormData(buf, batch.Sizes, batch.Data)
+	require.NoError(t, err)
+
+	r.Header.Add("Content-Type", contentType)
+	httphelpers.AddQueryParams(r, map[string]string{
+		"topic-name": "topic",
+	})
+
+	// Act
+	response := server.DoWithAuth(r)
+
+	// Assert
+	require.Equal(t, http.StatusTooManyRequests, response.StatusCode)
+	require.NotEmpty(t, response.Header.Get("Retry-After"))
+}
+
+// TestAddRecordsQuotaExceeded verifies that http.StatusInsufficientStorage is
+// returned when AddRecordsResult() returns seberr.ErrQuotaExceeded.
+func TestAddRecordsQuotaExceeded(t *testing.T) {
+	deps := &httphandlers.MockDependencies{}
+	deps.AddRecordsResultMock = func(ctx context.Context, topicName string, batch sebrecords.Batch) (sebbroker.AddResult, error) {
+		return sebbroker.AddResult{}, &sebbroker.QuotaExceededError{Quota: "namespace:topic", Limit: "retained bytes"}
+	}
+
+	server := tester.HTTPServer(t, tester.HTTPDependencies(deps))
+	defer server.Close()
+
+	// Act
+	response := server.DoWithAuth(addRecordsRequest(t, "topic"))
+
+	// Assert
+	require.Equal(t, http.StatusInsufficientStorage, response.StatusCode)
+}
+
+// TestAddRecordsProducedAtBadInput verifies that http.StatusBadRequest is
+// returned when httphelpers.ProducedAtHeader is not an RFC3339 timestamp.
+func TestAddRecordsProducedAtBadInput(t *testing.T) {
+	server := tester.HTTPServer(t)
+	defer server.Close()
+
+	batch := tester.MakeRandomRecordBatch(1)
+
+	buf := bytes.NewBuffer(nil)
+	r := httptest.NewRequest("POST", "/records", buf)
+	contentType, err := httphelpers.RecordsToMultipartFormData(buf, batch.Sizes, batch.Data)
+	require.NoError(t, err)
+
+	r.Header.Add("Content-Type", contentType)
+	r.Header.Add(httphelpers.ProducedAtHeader, "yesterday")
+	httphelpers.AddQueryParams(r, map[string]string{
+		"topic-name": "topic",
+	})
+
+	// Act
+	response := server.DoWithAuth(r)
+
+	// Assert
+	require.Equal(t, http.StatusBadRequest, response.StatusCode)
+}
+
+// TestAddRecordsContentEncoding verifies that gzip compressed request bodies
+// are decompressed, and that http.StatusUnsupportedMediaType is returned
+// together with the accepted encodings for unsupported encodings.
+func TestAddRecordsContentEncoding(t *testing.T) {
+	const topicName = "topic"
+	server := tester.HTTPServer(t)
+	defer server.Close()
+
+	batch := tester.MakeRandomRecordBatch(5)
+
+	buf := bytes.NewBuffer(nil)
+	contentType, err := httphelpers.RecordsToMultipartFormData(buf, batch.Sizes, batch.Data)
+	require.NoError(t, err)
+
+	gzipped := bytes.NewBuffer(nil)
+	gw := gzip.NewWriter(gzipped)
+	_, err = gw.Write(buf.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+
+	addRecords := func(body []byte, encoding string) *http.Response {
+		r := httptest.NewRequest("POST", "/records", bytes.NewReader(body))
+		r.Header.Add("Content-Type", contentType)
+		r.Header.Add("Content-Encoding", encoding)
+		httphelpers.AddQueryParams(r, map[string]string{
+			"topic-name": topicName,
+		})
+		return server.DoWithAuth(r)
+	}
+
+	// Act
+	unsupported := addRecords(buf.Bytes(), "br")
+	response := addRecords(gzipped.Bytes(), "gzip")
+
+	// Assert
+	require.Equal(t, http.StatusUnsupportedMediaType, unsupported.StatusCode)
+	require.Equal(t, httphelpers.AcceptedRequestEncodings, unsupported.Header.Get("Accept-Encoding"))
+
+	require.Equal(t, http.StatusCreated, response.StatusCode)
+	gotBatch := tester.NewBatch(batch.Len(), 4096)
+	err = server.Broker.GetRecords(context.Background(), &gotBatch, topicName, 0, batch.Len(), 0)
+	require.NoError(t, err)
+	require.Equal(t, batch.IndividualRecords(), gotBatch.IndividualRecords())
+}
+
+// TestAddRecordsTraceID verifies that the trace ID given in
+// httphelpers.TraceIDHeader is attached to all records of the request, and
+// that http.StatusBadRequest is returned when it's too long.
+func TestAddRecordsTraceID(t *testing.T) {
+	tests := map[string]struct {
+		traceID        string
+		expectedStatus int
+		expectedTraces []sebrecords.Trace
+	}{
+		"none":     {traceID: "", expectedStatus: http.StatusCreated, expectedTraces: nil},
+		"trace id": {traceID: "trace", expectedStatus: http.StatusCreated, expectedTraces: []sebrecords.Trace{{ID: "trace", NumRecords: 3}}},
+		"too long": {traceID: strings.Repeat("a", sebrecords.MaxTraceIDLen+1), expectedStatus: http.StatusBadRequest},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var gotTraces []sebrecords.Trace
+			deps := &httphandlers.MockDependencies{}
+			deps.AddRecordsResultMock = func(ctx context.Context, topicName string, batch sebrecords.Batch) (sebbroker.AddResult, error) {
+				gotTraces = slices.Clone(batch.Traces)
+				return sebbroker.AddResult{Offsets: make([]uint64, batch.Len())}, nil
+			}
+
+			server := tester.HTTPServer(t, tester.HTTPDependencies(deps))
+			defer server.Close()
+
+			batch := tester.MakeRandomRecordBatch(3)
+
+			buf := bytes.NewBuffer(nil)
+			r := httptest.NewRequest("POST", "/records", buf)
+			contentType, err := httphelpers.RecordsToMultipartFormData(buf, batch.Sizes, batch.Data)
+			require.NoError(t, err)
+
+			r.Header.Add("Content-Type", contentType)
+			r.Header.Add(httphelpers.TraceIDHeader, test.traceID)
+			httphelpers.AddQueryParams(r, map[string]string{
+				"topic-name": "topic",
+			})
+
+			// Act
+			response := server.DoWithAuth(r)
+
+			// Assert
+			require.Equal(t, test.expectedStatus, response.StatusCode)
+			require.Equal(t, test.expectedTraces, gotTraces)
+		})
+	}
+}
+
 // Verifies that http.BadRequest is returned when leaving out the required
 // topic-name query parameter.
 func TestAddRecordsMissingTopic(t *testing.T) {
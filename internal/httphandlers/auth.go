@@ -0,0 +1,272 @@
+package httphandlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// Access is the access given to an authenticated request.
+type Access struct {
+	// Full gives access to all routes. Without it, only records can be read,
+	// as limited by Grant.
+	Full  bool
+	Grant APIKeyGrant
+
+	// Admin gives full access, and also gives access to listing and
+	// modifying internal topics.
+	Admin bool
+
+	// Identity identifies the client, e.g. for quotas. Ignored if empty.
+	Identity string
+}
+
+// Authenticator authenticates requests using the bearer token given in their
+// Authorization header.
+type Authenticator interface {
+	// Authenticate returns the access given by token, or false if token isn't
+	// accepted by the Authenticator.
+	Authenticate(ctx context.Context, token string) (Access, bool, error)
+}
+
+type authenticatorFunc func(ctx context.Context, token string) (Access, bool, error)
+
+func (f authenticatorFunc) Authenticate(ctx context.Context, token string) (Access, bool, error) {
+	return f(ctx, token)
+}
+
+// NewAPIKeyAuthenticator returns an Authenticator that gives full access to
+// requests using apiKey, and read-only access limited by their grant to
+// requests using the API key of one of grants.
+func NewAPIKeyAuthenticator(apiKey string, grants ...APIKeyGrant) Authenticator {
+	apiKeyBs := []byte(apiKey)
+
+	grantsByAPIKey := make(map[string]APIKeyGrant, len(grants))
+	for _, grant := range grants {
+		grantsByAPIKey[grant.APIKey] = grant
+	}
+
+	return authenticatorFunc(func(ctx context.Context, token string) (Access, bool, error) {
+		if subtle.ConstantTimeCompare(apiKeyBs, []byte(token)) == 1 {
+			return Access{Full: true}, true, nil
+		}
+
+		grant, ok := grantsByAPIKey[token]
+		return Access{Grant: grant}, ok, nil
+	})
+}
+
+// NewAdminAPIKeyAuthenticator returns an Authenticator that gives admin
+// access to requests using apiKey. No requests are accepted if apiKey is
+// empty.
+func NewAdminAPIKeyAuthenticator(apiKey string) Authenticator {
+	apiKeyBs := []byte(apiKey)
+
+	return authenticatorFunc(func(ctx context.Context, token string) (Access, bool, error) {
+		if len(apiKeyBs) == 0 || subtle.ConstantTimeCompare(apiKeyBs, []byte(token)) != 1 {
+			return Access{}, false, nil
+		}
+
+		return Access{Full: true, Admin: true}, true, nil
+	})
+}
+
+// Authenticators returns an Authenticator that authenticates requests using
+// the first of auths that accepts their token.
+func Authenticators(auths ...Authenticator) Authenticator {
+	return authenticatorFunc(func(ctx context.Context, token string) (Access, bool, error) {
+		for _, auth := range auths {
+			access, ok, err := auth.Authenticate(ctx, token)
+			if err != nil || ok {
+				return access, ok, err
+			}
+		}
+
+		return Access{}, false, nil
+	})
+}
+
+// TokenVerifier verifies JWTs, e.g. httphelpers.JWTVerifier.
+type TokenVerifier interface {
+	Verify(ctx context.Context, token string) (httphelpers.JWTClaims, error)
+}
+
+// ClaimGrant gives access to requests using tokens with the claim Claim
+// containing the value Value. If Admin is true, admin access is given, and if
+// Full is true, full access is given. Otherwise, read-only access is given as
+// limited by Grant.
+type ClaimGrant struct {
+	Claim string
+	Value string
+
+	Admin bool
+	Full  bool
+	Grant APIKeyGrant
+}
+
+// rank returns the precedence of the access given by claimGrant; lower ranks
+// take precedence.
+func (claimGrant ClaimGrant) rank() int {
+	switch {
+	case claimGrant.Admin:
+		return 0
+	case claimGrant.Full:
+		return 1
+	}
+	return 2
+}
+
+// ParseClaimGrants parses a JSON list of claim grants, e.g.
+//
+//	[{"claim": "groups", "value": "operators", "admin": true},
+//	 {"claim": "groups", "value": "developers", "full_access": true},
+//	 {"claim": "groups", "value": "team-a", "namespaces": ["team-a/"], "max_age": "24h"}]
+//
+// The limits of read-only grants are given as in ParseAPIKeyGrants.
+func ParseClaimGrants(bs []byte) ([]ClaimGrant, error) {
+	jsonGrants := []struct {
+		jsonGrant
+		Claim      string `json:"claim"`
+		Value      string `json:"value"`
+		Admin      bool   `json:"admin"`
+		FullAccess bool   `json:"full_access"`
+	}{}
+	err := json.Unmarshal(bs, &jsonGrants)
+	if err != nil {
+		return nil, fmt.Errorf("parsing claim grants: %w", err)
+	}
+
+	claimGrants := make([]ClaimGrant, 0, len(jsonGrants))
+	for i, jsonGrant := range jsonGrants {
+		if jsonGrant.Claim == "" || jsonGrant.Value == "" {
+			return nil, fmt.Errorf("claim grant %d: claim and value must be set", i)
+		}
+
+		grant, err := jsonGrant.grant()
+		if err != nil {
+			return nil, fmt.Errorf("claim grant %d: %w", i, err)
+		}
+
+		claimGrants = append(claimGrants, ClaimGrant{
+			Claim: jsonGrant.Claim,
+			Value: jsonGrant.Value,
+			Admin: jsonGrant.Admin,
+			Full:  jsonGrant.FullAccess || jsonGrant.Admin,
+			Grant: grant,
+		})
+	}
+
+	return claimGrants, nil
+}
+
+// NewOIDCAuthenticator returns an Authenticator that accepts JWTs verified by
+// verifier, e.g. tokens issued by an OIDC provider for single sign-on. Tokens
+// are given the access of the first of claimGrants that matches their claims,
+// preferring grants with admin access and then full access, and are rejected
+// if none match. The client is identified by the claim identityClaim,
+// defaulting to "sub".
+//
+// Tokens that aren't JWTs are left for other Authenticators.
+func NewOIDCAuthenticator(log logger.Logger, verifier TokenVerifier, identityClaim string, claimGrants ...ClaimGrant) Authenticator {
+	if identityClaim == "" {
+		identityClaim = "sub"
+	}
+
+	claimGrants = slices.Clone(claimGrants)
+	slices.SortStableFunc(claimGrants, func(a, b ClaimGrant) int {
+		return a.rank() - b.rank()
+	})
+
+	return authenticatorFunc(func(ctx context.Context, token string) (Access, bool, error) {
+		if strings.Count(token, ".") != 2 {
+			return Access{}, false, nil
+		}
+
+		claims, err := verifier.Verify(ctx, token)
+		if err != nil {
+			if errors.Is(err, httphelpers.ErrInvalidToken) {
+				log.Infof("rejecting token: %s", err)
+				return Access{}, false, nil
+			}
+			return Access{}, false, err
+		}
+
+		var identity string
+		if identities := claims.Strings(identityClaim); len(identities) > 0 {
+			identity = identities[0]
+		}
+
+		for _, claimGrant := range claimGrants {
+			if slices.Contains(claims.Strings(claimGrant.Claim), claimGrant.Value) {
+				log.Debugf("token of '%s' matched claim %s=%s", identity, claimGrant.Claim, claimGrant.Value)
+				return Access{
+					Full:     claimGrant.Full || claimGrant.Admin,
+					Admin:    claimGrant.Admin,
+					Grant:    claimGrant.Grant,
+					Identity: identity,
+				}, true, nil
+			}
+		}
+
+		log.Infof("token of '%s' matched no claim grants", identity)
+		return Access{}, false, nil
+	})
+}
+
+// newAuthHandler returns an http.HandlerFunc that authenticates requests
+// using auth, and calls hf with the access of authenticated requests. The
+// access is added to the request's context, and its identity too unless the
+// request has already been identified, e.g. by its client certificate.
+func newAuthHandler(log logger.Logger, auth Authenticator, hf func(http.ResponseWriter, *http.Request, Access)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get(httphelpers.APIKeyHeader), "Bearer ")
+		if token == "" {
+			invalidAuth(w, r)
+			return
+		}
+
+		access, ok, err := auth.Authenticate(r.Context(), token)
+		if err != nil {
+			log.Errorf("authenticating: %s", err)
+			r.Body.Close()
+			httphelpers.WriteErrorf(w, http.StatusInternalServerError, "something went wrong")
+			return
+		}
+
+		if !ok {
+			log.Infof("invalid auth")
+			invalidAuth(w, r)
+			return
+		}
+
+		if _, identified := httphelpers.IdentityFromContext(r.Context()); !identified && access.Identity != "" {
+			r = r.WithContext(httphelpers.WithIdentity(r.Context(), access.Identity))
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), accessKey{}, access))
+		hf(w, r, access)
+	}
+}
+
+type accessKey struct{}
+
+// accessFromContext returns the access of the request, as added by
+// newAuthHandler. Requests that haven't been authenticated have no access.
+func accessFromContext(ctx context.Context) Access {
+	access, _ := ctx.Value(accessKey{}).(Access)
+	return access
+}
+
+func invalidAuth(w http.ResponseWriter, r *http.Request) {
+	r.Body.Close()
+	httphelpers.WriteError(w, http.StatusUnauthorized, fmt.Errorf("%w: invalid auth", seberr.ErrUnauthorized))
+}
@@ -0,0 +1,213 @@
+package httphandlers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/httphandlers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/stretchr/testify/require"
+)
+
+var log = logger.NewDefault(context.Background())
+
+type tokenVerifierFunc func(ctx context.Context, token string) (httphelpers.JWTClaims, error)
+
+func (f tokenVerifierFunc) Verify(ctx context.Context, token string) (httphelpers.JWTClaims, error) {
+	return f(ctx, token)
+}
+
+// TestOIDCAuthenticator verifies that tokens accepted by the OIDC
+// authenticator are given the access of the claim grant matching their
+// claims, and that API keys are still accepted.
+func TestOIDCAuthenticator(t *testing.T) {
+	const (
+		adminToken   = "admin.token.sig"
+		teamAToken   = "team-a.token.sig"
+		noGrantToken = "no-grant.token.sig"
+	)
+
+	verifier := tokenVerifierFunc(func(ctx context.Context, token string) (httphelpers.JWTClaims, error) {
+		switch token {
+		case adminToken:
+			return httphelpers.JWTClaims{"sub": "admin", "groups": []any{"admins", "team-a"}}, nil
+		case teamAToken:
+			return httphelpers.JWTClaims{"sub": "user", "groups": []any{"team-a"}}, nil
+		case noGrantToken:
+			return httphelpers.JWTClaims{"sub": "other", "groups": []any{"team-b"}}, nil
+		}
+		return nil, fmt.Errorf("%w: bad signature", httphelpers.ErrInvalidToken)
+	})
+
+	oidc := httphandlers.NewOIDCAuthenticator(log, verifier, "", []httphandlers.ClaimGrant{
+		{Claim: "groups", Value: "team-a", Grant: httphandlers.APIKeyGrant{Namespaces: []string{"team-a/"}}},
+		{Claim: "groups", Value: "admins", Full: true},
+	}...)
+
+	server := tester.HTTPServer(t, tester.HTTPAuthenticators(oidc))
+	defer server.Close()
+
+	for _, name := range []string{"team-a/topic", "team-b/topic"} {
+		_, err := server.Broker.AddRecords(name, tester.MakeRandomRecordBatch(1))
+		require.NoError(t, err)
+	}
+
+	tests := map[string]struct {
+		method     string
+		path       string
+		token      string
+		topicName  string
+		statusCode int
+	}{
+		"admin, read other namespace": {
+			method:     "GET",
+			path:       "/record",
+			token:      adminToken,
+			topicName:  "team-b/topic",
+			statusCode: http.StatusOK,
+		},
+		"admin, topic metadata": {
+			method:     "GET",
+			path:       "/topic",
+			token:      adminToken,
+			topicName:  "team-b/topic",
+			statusCode: http.StatusOK,
+		},
+		"team, read namespace": {
+			method:     "GET",
+			path:       "/record",
+			token:      teamAToken,
+			topicName:  "team-a/topic",
+			statusCode: http.StatusOK,
+		},
+		"team, read other namespace": {
+			method:     "GET",
+			path:       "/record",
+			token:      teamAToken,
+			topicName:  "team-b/topic",
+			statusCode: http.StatusForbidden,
+		},
+		"team, write": {
+			method:     "POST",
+			path:       "/records",
+			token:      teamAToken,
+			topicName:  "team-a/topic",
+			statusCode: http.StatusUnauthorized,
+		},
+		"no matching grant": {
+			method:     "GET",
+			path:       "/record",
+			token:      noGrantToken,
+			topicName:  "team-a/topic",
+			statusCode: http.StatusUnauthorized,
+		},
+		"invalid token": {
+			method:     "GET",
+			path:       "/record",
+			token:      "invalid.token.sig",
+			topicName:  "team-a/topic",
+			statusCode: http.StatusUnauthorized,
+		},
+		"api key": {
+			method:     "GET",
+			path:       "/topic",
+			token:      tester.DefaultAPIKey,
+			topicName:  "team-b/topic",
+			statusCode: http.StatusOK,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, test.path, nil)
+			r.Header.Add(httphelpers.APIKeyHeader, "Bearer "+test.token)
+			httphelpers.AddQueryParams(r, map[string]string{
+				"topic-name": test.topicName,
+				"offset":     "0",
+			})
+
+			// Act
+			response := server.Do(r)
+
+			// Assert
+			require.Equal(t, test.statusCode, response.StatusCode)
+		})
+	}
+}
+
+// TestOIDCAuthenticatorVerifierError verifies that errors other than invalid
+// tokens, e.g. failing to fetch the issuer's keys, are returned rather than
+// treated as rejected tokens.
+func TestOIDCAuthenticatorVerifierError(t *testing.T) {
+	expectedErr := fmt.Errorf("issuer unavailable")
+	verifier := tokenVerifierFunc(func(ctx context.Context, token string) (httphelpers.JWTClaims, error) {
+		return nil, expectedErr
+	})
+	auth := httphandlers.NewOIDCAuthenticator(log, verifier, "", httphandlers.ClaimGrant{Claim: "groups", Value: "admins", Full: true})
+
+	// Act
+	_, ok, err := auth.Authenticate(context.Background(), "a.jwt.token")
+
+	// Assert
+	require.ErrorIs(t, err, expectedErr)
+	require.False(t, ok)
+
+	// tokens that aren't JWTs are left for other authenticators
+	_, ok, err = auth.Authenticate(context.Background(), "api-key")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+// TestParseClaimGrants verifies that ParseClaimGrants() parses claim grants
+// from JSON, and returns an error for invalid grants.
+func TestParseClaimGrants(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected []httphandlers.ClaimGrant
+		err      bool
+	}{
+		"valid": {
+			input: `[{"claim": "groups", "value": "operators", "admin": true}, {"claim": "groups", "value": "admins", "full_access": true}, {"claim": "groups", "value": "team-a", "namespaces": ["team-a/"], "start_offset": 1}]`,
+			expected: []httphandlers.ClaimGrant{
+				{Claim: "groups", Value: "operators", Admin: true, Full: true},
+				{Claim: "groups", Value: "admins", Full: true},
+				{Claim: "groups", Value: "team-a", Grant: httphandlers.APIKeyGrant{
+					Namespaces:  []string{"team-a/"},
+					StartOffset: 1,
+				}},
+			},
+		},
+		"missing claim": {
+			input: `[{"value": "admins"}]`,
+			err:   true,
+		},
+		"missing value": {
+			input: `[{"claim": "groups"}]`,
+			err:   true,
+		},
+		"invalid max age": {
+			input: `[{"claim": "groups", "value": "admins", "max_age": "a day"}]`,
+			err:   true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			got, err := httphandlers.ParseClaimGrants([]byte(test.input))
+
+			// Assert
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, got)
+		})
+	}
+}
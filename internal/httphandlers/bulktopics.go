@@ -0,0 +1,166 @@
+package httphandlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+type TopicsBulkOperator interface {
+	MatchTopics(pattern string, labels map[string]string) ([]string, error)
+	SetTopicRetention(topicName string, retention time.Duration)
+	SetTopicLabels(topicName string, labels map[string]string)
+	SetTopicWritesFrozen(topicName string, frozen bool)
+	DeleteTopic(topicName string) error
+}
+
+type BulkOperation string
+
+const (
+	BulkOperationFreeze       BulkOperation = "freeze"
+	BulkOperationUnfreeze     BulkOperation = "unfreeze"
+	BulkOperationDelete       BulkOperation = "delete"
+	BulkOperationSetRetention BulkOperation = "set_retention"
+	BulkOperationSetLabels    BulkOperation = "set_labels"
+)
+
+type BulkTopicsInput struct {
+	// Pattern and Labels select the topics to operate on; topics must match
+	// both. Pattern uses the syntax of path.Match, e.g. "orders-*". At least
+	// one of them must be given; use "*" to select all topics.
+	Pattern string            `json:"pattern"`
+	Labels  map[string]string `json:"labels"`
+
+	Operation BulkOperation `json:"operation"`
+
+	// Retention is used by BulkOperationSetRetention, in the format
+	// understood by time.ParseDuration. "0s" disables retention.
+	Retention string `json:"retention"`
+
+	// SetLabels is used by BulkOperationSetLabels. Labels with an empty value
+	// are removed.
+	SetLabels map[string]string `json:"set_labels"`
+
+	// DryRun lists the selected topics without applying the operation.
+	DryRun bool `json:"dry_run"`
+}
+
+type BulkTopicsOutput struct {
+	DryRun     bool              `json:"dry_run"`
+	TopicNames []string          `json:"topic_names"`
+	Errors     map[string]string `json:"errors,omitempty"`
+}
+
+// BulkTopics applies an operation to all topics matching a pattern and label
+// selector. Topics for which the operation failed are listed in
+// BulkTopicsOutput.Errors; the operation is still applied to the remaining
+// topics. Internal topics are only selected for requests with admin access.
+func BulkTopics(log logger.Logger, s TopicsBulkOperator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		input := BulkTopicsInput{}
+		err := httphelpers.ParseJSONAndClose(r.Body, &input)
+		if err != nil {
+			httphelpers.WriteErrorf(w, http.StatusBadRequest, "parsing json body: %w", err)
+			return
+		}
+
+		operation, err := bulkOperation(s, input)
+		if err != nil {
+			httphelpers.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		topicNames, err := s.MatchTopics(input.Pattern, input.Labels)
+		if err != nil {
+			if errors.Is(err, seberr.ErrBadInput) {
+				httphelpers.WriteError(w, http.StatusBadRequest, err)
+				return
+			}
+
+			log.Errorf("matching topics: %s", err)
+			httphelpers.WriteErrorf(w, http.StatusInternalServerError, "failed to match topics: %w", err)
+			return
+		}
+
+		// internal topics are only operated on for admins
+		if !accessFromContext(r.Context()).Admin {
+			topicNames = slices.DeleteFunc(topicNames, sebbroker.IsInternalTopic)
+		}
+
+		output := BulkTopicsOutput{
+			DryRun:     input.DryRun,
+			TopicNames: topicNames,
+		}
+
+		if !input.DryRun {
+			log.Infof("applying '%s' to %d topics", input.Operation, len(topicNames))
+			for _, topicName := range topicNames {
+				err := operation(topicName)
+				if err != nil {
+					log.Errorf("applying '%s' to topic '%s': %s", input.Operation, topicName, err)
+					if output.Errors == nil {
+						output.Errors = make(map[string]string)
+					}
+					output.Errors[topicName] = err.Error()
+				}
+			}
+		}
+
+		httphelpers.WriteJSON(w, &output)
+	}
+}
+
+// bulkOperation validates input and returns a function that applies
+// input.Operation to a single topic.
+func bulkOperation(s TopicsBulkOperator, input BulkTopicsInput) (func(topicName string) error, error) {
+	if input.Pattern == "" && len(input.Labels) == 0 {
+		return nil, fmt.Errorf("pattern or labels must be given")
+	}
+
+	switch input.Operation {
+	case BulkOperationFreeze, BulkOperationUnfreeze:
+		frozen := input.Operation == BulkOperationFreeze
+		return func(topicName string) error {
+			s.SetTopicWritesFrozen(topicName, frozen)
+			return nil
+		}, nil
+
+	case BulkOperationDelete:
+		return s.DeleteTopic, nil
+
+	case BulkOperationSetRetention:
+		retention, err := time.ParseDuration(input.Retention)
+		if err != nil {
+			return nil, fmt.Errorf("parsing retention: %w", err)
+		}
+		if retention < 0 {
+			return nil, fmt.Errorf("retention must not be negative")
+		}
+
+		return func(topicName string) error {
+			s.SetTopicRetention(topicName, retention)
+			return nil
+		}, nil
+
+	case BulkOperationSetLabels:
+		if len(input.SetLabels) == 0 {
+			return nil, fmt.Errorf("set_labels must be given")
+		}
+
+		return func(topicName string) error {
+			s.SetTopicLabels(topicName, input.SetLabels)
+			return nil
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown operation '%s'", input.Operation)
+}
@@ -0,0 +1,140 @@
+package httphandlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/httphandlers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBulkTopics verifies that POST /admin/topics/bulk applies the requested
+// operation to all matching topics, and that dry runs only list the topics.
+func TestBulkTopics(t *testing.T) {
+	topicNames := []string{"orders-eu", "orders-us", "payments-eu"}
+
+	tests := map[string]struct {
+		input    httphandlers.BulkTopicsInput
+		expected []string
+		verify   func(t *testing.T, server *tester.HTTPTestServer)
+	}{
+		"dry run": {
+			input: httphandlers.BulkTopicsInput{
+				Pattern:   "orders-*",
+				Operation: httphandlers.BulkOperationDelete,
+				DryRun:    true,
+			},
+			expected: []string{"orders-eu", "orders-us"},
+			verify: func(t *testing.T, server *tester.HTTPTestServer) {
+				require.Equal(t, topicNames, server.Broker.TopicNames())
+			},
+		},
+		"freeze": {
+			input: httphandlers.BulkTopicsInput{
+				Pattern:   "orders-*",
+				Operation: httphandlers.BulkOperationFreeze,
+			},
+			expected: []string{"orders-eu", "orders-us"},
+			verify: func(t *testing.T, server *tester.HTTPTestServer) {
+				require.True(t, server.Broker.WritesFrozen("orders-eu"))
+				require.True(t, server.Broker.WritesFrozen("orders-us"))
+				require.False(t, server.Broker.WritesFrozen("payments-eu"))
+			},
+		},
+		"delete": {
+			input: httphandlers.BulkTopicsInput{
+				Pattern:   "*-eu",
+				Operation: httphandlers.BulkOperationDelete,
+			},
+			expected: []string{"orders-eu", "payments-eu"},
+			verify: func(t *testing.T, server *tester.HTTPTestServer) {
+				require.Equal(t, []string{"orders-us"}, server.Broker.TopicNames())
+			},
+		},
+		"set retention": {
+			input: httphandlers.BulkTopicsInput{
+				Pattern:   "payments-*",
+				Operation: httphandlers.BulkOperationSetRetention,
+				Retention: "24h",
+			},
+			expected: []string{"payments-eu"},
+			verify: func(t *testing.T, server *tester.HTTPTestServer) {
+				require.Equal(t, 24*time.Hour, server.Broker.TopicRetention("payments-eu"))
+				require.Equal(t, time.Duration(0), server.Broker.TopicRetention("orders-eu"))
+			},
+		},
+		"set labels": {
+			input: httphandlers.BulkTopicsInput{
+				Pattern:   "*",
+				Operation: httphandlers.BulkOperationSetLabels,
+				SetLabels: map[string]string{"team": "a"},
+			},
+			expected: topicNames,
+			verify: func(t *testing.T, server *tester.HTTPTestServer) {
+				for _, topicName := range topicNames {
+					require.Equal(t, map[string]string{"team": "a"}, server.Broker.TopicLabels(topicName))
+				}
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := tester.HTTPServer(t)
+			defer server.Close()
+
+			for _, topicName := range topicNames {
+				_, err := server.Broker.AddRecords(topicName, tester.MakeRandomRecordBatch(1))
+				require.NoError(t, err)
+			}
+
+			r := httptest.NewRequest("POST", "/admin/topics/bulk", jsonBody(t, test.input))
+
+			// Act
+			response := server.DoWithAuth(r)
+
+			// Assert
+			require.Equal(t, http.StatusOK, response.StatusCode)
+
+			output := httphandlers.BulkTopicsOutput{}
+			err := httphelpers.ParseJSONAndClose(response.Body, &output)
+			require.NoError(t, err)
+			require.Equal(t, test.input.DryRun, output.DryRun)
+			require.Equal(t, test.expected, output.TopicNames)
+			require.Empty(t, output.Errors)
+
+			test.verify(t, server)
+		})
+	}
+}
+
+// TestBulkTopicsBadInput verifies that POST /admin/topics/bulk returns
+// http.StatusBadRequest for invalid input.
+func TestBulkTopicsBadInput(t *testing.T) {
+	tests := map[string]httphandlers.BulkTopicsInput{
+		"no selector":       {Operation: httphandlers.BulkOperationFreeze},
+		"unknown operation": {Pattern: "*", Operation: "explode"},
+		"bad pattern":       {Pattern: "[", Operation: httphandlers.BulkOperationFreeze},
+		"bad retention":     {Pattern: "*", Operation: httphandlers.BulkOperationSetRetention, Retention: "a while"},
+		"no labels to set":  {Pattern: "*", Operation: httphandlers.BulkOperationSetLabels},
+	}
+
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := tester.HTTPServer(t)
+			defer server.Close()
+
+			r := httptest.NewRequest("POST", "/admin/topics/bulk", jsonBody(t, input))
+
+			// Act
+			response := server.DoWithAuth(r)
+
+			// Assert
+			require.Equal(t, http.StatusBadRequest, response.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package httphandlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+)
+
+type CacheInspector interface {
+	Stats() sebcache.Stats
+	Items() []sebcache.CacheItem
+}
+
+type CacheStatsOutput struct {
+	CacheBudgetStatsOutput
+	Budgets map[string]CacheBudgetStatsOutput `json:"budgets"`
+}
+
+type CacheBudgetStatsOutput struct {
+	Bytes         int64  `json:"bytes"`
+	Items         int    `json:"items"`
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	EvictedBytes  int64  `json:"evicted_bytes"`
+	EvictedItems  uint64 `json:"evicted_items"`
+	WriteFailures uint64 `json:"write_failures"`
+	NotAdmitted   uint64 `json:"not_admitted"`
+}
+
+type CacheItemsOutput struct {
+	Items []CacheItemOutput `json:"items"`
+}
+
+type CacheItemOutput struct {
+	Key        string    `json:"key"`
+	Size       int64     `json:"size"`
+	AccessedAt time.Time `json:"accessed_at"`
+	Budget     string    `json:"budget"`
+	Transient  bool      `json:"transient"`
+}
+
+// GetCacheStats returns usage statistics for the cache, both for the cache as
+// a whole and for each budget.
+func GetCacheStats(log logger.Logger, s CacheInspector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		stats := s.Stats()
+		output := CacheStatsOutput{
+			CacheBudgetStatsOutput: cacheBudgetStatsOutput(stats.BudgetStats),
+			Budgets:                make(map[string]CacheBudgetStatsOutput, len(stats.Budgets)),
+		}
+		for budget, budgetStats := range stats.Budgets {
+			output.Budgets[budget.String()] = cacheBudgetStatsOutput(budgetStats)
+		}
+
+		httphelpers.WriteJSON(w, &output)
+	}
+}
+
+func cacheBudgetStatsOutput(stats sebcache.BudgetStats) CacheBudgetStatsOutput {
+	return CacheBudgetStatsOutput{
+		Bytes:         stats.Bytes,
+		Items:         stats.Items,
+		Hits:          stats.Hits,
+		Misses:        stats.Misses,
+		EvictedBytes:  stats.EvictedBytes,
+		EvictedItems:  stats.EvictedItems,
+		WriteFailures: stats.WriteFailures,
+		NotAdmitted:   stats.NotAdmitted,
+	}
+}
+
+// GetCacheItems returns the items in the cache along with their sizes and the
+// time they were last accessed. If the prefix query parameter is given, e.g.
+// a topic name, only items whose keys start with it are returned.
+func GetCacheItems(log logger.Logger, s CacheInspector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		params, err := parseQueryParams(r,
+			QParam{prefixKey, QueryStringDefault("")},
+		)
+		if err != nil {
+			httphelpers.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		prefix := params[prefixKey].(string)
+
+		output := CacheItemsOutput{Items: []CacheItemOutput{}}
+		for _, item := range s.Items() {
+			if !strings.HasPrefix(item.Key, prefix) {
+				continue
+			}
+
+			output.Items = append(output.Items, CacheItemOutput{
+				Key:        item.Key,
+				Size:       item.Size,
+				AccessedAt: item.AccessedAt,
+				Budget:     item.Budget.String(),
+				Transient:  item.Transient,
+			})
+		}
+
+		httphelpers.WriteJSON(w, &output)
+	}
+}
+
+// cacheMetrics are the cache metrics exposed by GetMetrics.
+var cacheMetrics = []struct {
+	name       string
+	metricType string
+	help       string
+	value      func(sebcache.BudgetStats) any
+}{
+	{"seb_cache_bytes", "gauge", "Number of bytes in the cache.", func(s sebcache.BudgetStats) any { return s.Bytes }},
+	{"seb_cache_items", "gauge", "Number of items in the cache.", func(s sebcache.BudgetStats) any { return s.Items }},
+	{"seb_cache_hits_total", "counter", "Number of cache reads that found the item.", func(s sebcache.BudgetStats) any { return s.Hits }},
+	{"seb_cache_misses_total", "counter", "Number of cache reads that did not find the item.", func(s sebcache.BudgetStats) any { return s.Misses }},
+	{"seb_cache_evicted_bytes_total", "counter", "Number of bytes evicted from the cache.", func(s sebcache.BudgetStats) any { return s.EvictedBytes }},
+	{"seb_cache_evicted_items_total", "counter", "Number of items evicted from the cache.", func(s sebcache.BudgetStats) any { return s.EvictedItems }},
+	{"seb_cache_write_failures_total", "counter", "Number of failed cache writes.", func(s sebcache.BudgetStats) any { return s.WriteFailures }},
+	{"seb_cache_not_admitted_total", "counter", "Number of items that were not admitted to the cache.", func(s sebcache.BudgetStats) any { return s.NotAdmitted }},
+}
+
+type MetricsGetter interface {
+	GroupLagGetter
+	DedupStatsGetter
+}
+
+// GetMetrics returns cache metrics, the lag of consumer groups, the state of
+// batch deduplication and the metrics of the sources in monitoring in the
+// Prometheus text exposition format. Cache metrics are labelled by the budget
+// that they're attributed to, and are left out if cache is nil.
+func GetMetrics(log logger.Logger, cache CacheInspector, s MetricsGetter, monitoring Monitoring) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		if cache != nil {
+			stats := cache.Stats()
+			for _, metric := range cacheMetrics {
+				fmt.Fprintf(w, "# HELP %s %s\n", metric.name, metric.help)
+				fmt.Fprintf(w, "# TYPE %s %s\n", metric.name, metric.metricType)
+				for _, budget := range sebcache.Budgets() {
+					fmt.Fprintf(w, "%s{budget=%q} %v\n", metric.name, budget, metric.value(stats.Budgets[budget]))
+				}
+			}
+		}
+
+		writeGroupLagMetrics(log, w, s)
+		writeDedupMetrics(w, s)
+
+		if monitoring.Replica != nil {
+			writeReplicaMetrics(w, monitoring.Replica)
+		}
+
+		if monitoring.S3Retry != nil {
+			writeS3RetryMetrics(w, monitoring.S3Retry)
+		}
+
+		if monitoring.S3Uploads != nil {
+			writeS3UploadMetrics(w, monitoring.S3Uploads)
+		}
+
+		if monitoring.Scrub != nil {
+			writeScrubMetrics(w, monitoring.Scrub)
+		}
+	}
+}
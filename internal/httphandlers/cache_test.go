@@ -0,0 +1,117 @@
+package httphandlers_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/httphandlers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetCacheStats verifies that GET /admin/cache returns the cache's usage
+// statistics.
+func TestGetCacheStats(t *testing.T) {
+	server := tester.HTTPServer(t)
+	defer server.Close()
+
+	_, err := server.Cache.Write(context.Background(), "topic/a", tester.RandomBytes(t, 10))
+	require.NoError(t, err)
+
+	r, err := server.Cache.Reader(context.Background(), "topic/a")
+	require.NoError(t, err)
+	r.Close()
+
+	// Act
+	response := server.DoWithAuth(httptest.NewRequest("GET", "/admin/cache", nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	output := httphandlers.CacheStatsOutput{}
+	err = httphelpers.ParseJSONAndClose(response.Body, &output)
+	require.NoError(t, err)
+
+	expected := httphandlers.CacheBudgetStatsOutput{Bytes: 10, Items: 1, Hits: 1}
+	require.Equal(t, expected, output.CacheBudgetStatsOutput)
+	require.Equal(t, expected, output.Budgets["serving"])
+}
+
+// TestGetCacheItems verifies that GET /admin/cache/items returns the items in
+// the cache, optionally only those whose keys start with the given prefix.
+func TestGetCacheItems(t *testing.T) {
+	server := tester.HTTPServer(t)
+	defer server.Close()
+
+	for _, key := range []string{"topic1/a", "topic1/b", "topic2/a"} {
+		_, err := server.Cache.Write(context.Background(), key, tester.RandomBytes(t, 10))
+		require.NoError(t, err)
+	}
+
+	tests := map[string]struct {
+		url          string
+		expectedKeys []string
+	}{
+		"all":       {url: "/admin/cache/items", expectedKeys: []string{"topic1/a", "topic1/b", "topic2/a"}},
+		"prefix":    {url: "/admin/cache/items?prefix=topic1/", expectedKeys: []string{"topic1/a", "topic1/b"}},
+		"no prefix": {url: "/admin/cache/items?prefix=topic3/", expectedKeys: []string{}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			response := server.DoWithAuth(httptest.NewRequest("GET", test.url, nil))
+
+			// Assert
+			require.Equal(t, http.StatusOK, response.StatusCode)
+
+			output := httphandlers.CacheItemsOutput{}
+			err := httphelpers.ParseJSONAndClose(response.Body, &output)
+			require.NoError(t, err)
+
+			gotKeys := []string{}
+			for _, item := range output.Items {
+				require.Equal(t, int64(10), item.Size)
+				require.Equal(t, "serving", item.Budget)
+				require.False(t, item.AccessedAt.IsZero())
+				gotKeys = append(gotKeys, item.Key)
+			}
+			require.Equal(t, test.expectedKeys, gotKeys)
+		})
+	}
+}
+
+// TestGetMetrics verifies that GET /metrics returns cache metrics in the
+// Prometheus text format, and that it requires an API key.
+func TestGetMetrics(t *testing.T) {
+	server := tester.HTTPServer(t)
+	defer server.Close()
+
+	_, err := server.Cache.Write(context.Background(), "topic/a", tester.RandomBytes(t, 10))
+	require.NoError(t, err)
+
+	_, err = server.Cache.Reader(context.Background(), "topic/does-not-exist")
+	require.Error(t, err)
+
+	response := server.Do(httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, http.StatusUnauthorized, response.StatusCode)
+
+	// Act
+	response = server.DoWithAuth(httptest.NewRequest("GET", "/metrics", nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	bs, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+
+	body := string(bs)
+	require.Contains(t, body, "# TYPE seb_cache_bytes gauge\n")
+	require.Contains(t, body, `seb_cache_bytes{budget="serving"} 10`+"\n")
+	require.Contains(t, body, `seb_cache_misses_total{budget="serving"} 1`+"\n")
+	require.Contains(t, body, `seb_cache_hits_total{budget="maintenance"} 0`+"\n")
+}
@@ -0,0 +1,49 @@
+package httphandlers
+
+import (
+	"net/http"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+)
+
+type ConfigReloader interface {
+	// ReloadConfig reloads the server's configuration, applying the settings
+	// that can be changed at runtime. It returns the names of the settings
+	// that were applied, and of the changed settings that require a restart.
+	ReloadConfig() (applied []string, restartRequired []string, err error)
+}
+
+type ReloadConfigOutput struct {
+	Applied         []string `json:"applied"`
+	RestartRequired []string `json:"restart_required"`
+}
+
+// ReloadConfig reloads the server's configuration, e.g. after its
+// configuration file has been changed. Settings that can be changed at
+// runtime, such as the log level, quotas and topic retention, are applied
+// right away; other settings are reported as requiring a restart.
+func ReloadConfig(log logger.Logger, s ConfigReloader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		applied, restartRequired, err := s.ReloadConfig()
+		if err != nil {
+			log.Errorf("reloading config: %s", err)
+			httphelpers.WriteErrorf(w, http.StatusInternalServerError, "failed to reload config: %w", err)
+			return
+		}
+
+		if applied == nil {
+			applied = []string{}
+		}
+		if restartRequired == nil {
+			restartRequired = []string{}
+		}
+
+		httphelpers.WriteJSON(w, &ReloadConfigOutput{
+			Applied:         applied,
+			RestartRequired: restartRequired,
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package httphandlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/httphandlers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReloadConfig verifies that POST /admin/config/reload reloads the config
+// and returns the applied settings and the settings requiring a restart, and
+// that http.StatusInternalServerError is returned if reloading fails.
+func TestReloadConfig(t *testing.T) {
+	tests := map[string]struct {
+		reloader   configReloader
+		statusCode int
+		expected   httphandlers.ReloadConfigOutput
+	}{
+		"reloaded": {
+			reloader:   configReloader{applied: []string{"log-level", "quotas"}, restartRequired: []string{"cache-size"}},
+			statusCode: http.StatusOK,
+			expected:   httphandlers.ReloadConfigOutput{Applied: []string{"log-level", "quotas"}, RestartRequired: []string{"cache-size"}},
+		},
+		"nothing changed": {
+			reloader:   configReloader{},
+			statusCode: http.StatusOK,
+			expected:   httphandlers.ReloadConfigOutput{Applied: []string{}, RestartRequired: []string{}},
+		},
+		"invalid config": {
+			reloader:   configReloader{err: fmt.Errorf("parsing config file")},
+			statusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := tester.HTTPServer(t, tester.HTTPConfigReloader(&test.reloader))
+			defer server.Close()
+
+			// Act
+			response := server.DoWithAuth(httptest.NewRequest("POST", "/admin/config/reload", nil))
+
+			// Assert
+			require.Equal(t, test.statusCode, response.StatusCode)
+			require.Equal(t, 1, test.reloader.calls)
+			if test.statusCode != http.StatusOK {
+				return
+			}
+
+			output := httphandlers.ReloadConfigOutput{}
+			err := httphelpers.ParseJSONAndClose(response.Body, &output)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, output)
+		})
+	}
+}
+
+// TestReloadConfigNotRegistered verifies that the config reload route isn't
+// registered without a ConfigReloader.
+func TestReloadConfigNotRegistered(t *testing.T) {
+	server := tester.HTTPServer(t)
+	defer server.Close()
+
+	// Act
+	response := server.DoWithAuth(httptest.NewRequest("POST", "/admin/config/reload", nil))
+
+	// Assert
+	require.Equal(t, http.StatusNotFound, response.StatusCode)
+}
+
+type configReloader struct {
+	applied         []string
+	restartRequired []string
+	err             error
+	calls           int
+}
+
+func (r *configReloader) ReloadConfig() ([]string, []string, error) {
+	r.calls++
+	return r.applied, r.restartRequired, r.err
+}
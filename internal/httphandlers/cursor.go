@@ -0,0 +1,104 @@
+package httphandlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+)
+
+// NextCursorHeader is the response header containing an opaque cursor that
+// can be given in the cursor query parameter of the next request in order to
+// continue reading where the current request stopped, using the same read
+// options.
+const NextCursorHeader = "Next-Cursor"
+
+const (
+	cursorKey     = "cursor"
+	cursorVersion = 1
+)
+
+// recordsCursor is the position and read options of a consumer of a topic.
+// It's given to clients as an opaque string, so that its contents can change
+// without affecting them.
+type recordsCursor struct {
+	Version      int               `json:"v"`
+	TopicName    string            `json:"t"`
+	Offset       uint64            `json:"o"`
+	MaxRecords   int               `json:"n,omitempty"`
+	SoftMaxBytes int               `json:"b,omitempty"`
+	WireSize     bool              `json:"w,omitempty"`
+	Key          []byte            `json:"k,omitempty"`
+	Headers      map[string]string `json:"h,omitempty"`
+}
+
+func (c recordsCursor) encode() string {
+	c.Version = cursorVersion
+	bs, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(bs)
+}
+
+func (c recordsCursor) filter() sebtopic.RecordFilter {
+	return sebtopic.RecordFilter{Key: c.Key, Headers: c.Headers}
+}
+
+func decodeRecordsCursor(s string) (recordsCursor, error) {
+	bs, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return recordsCursor{}, fmt.Errorf("decoding cursor: %w", err)
+	}
+
+	cursor := recordsCursor{}
+	err = json.Unmarshal(bs, &cursor)
+	if err != nil {
+		return recordsCursor{}, fmt.Errorf("parsing cursor: %w", err)
+	}
+
+	if cursor.Version != cursorVersion {
+		return recordsCursor{}, fmt.Errorf("unsupported cursor version %d", cursor.Version)
+	}
+	if cursor.TopicName == "" {
+		return recordsCursor{}, fmt.Errorf("cursor has no topic")
+	}
+
+	return cursor, nil
+}
+
+// parseRecordsCursor parses the cursor query parameter of r. It returns false
+// if r has no cursor. The topic-name query parameter may be given along with
+// the cursor, in which case it must match the cursor's topic, whereas the
+// offset query parameter must not.
+func parseRecordsCursor(r *http.Request) (recordsCursor, bool, error) {
+	query := r.URL.Query()
+	s := query.Get(cursorKey)
+	if s == "" {
+		return recordsCursor{}, false, nil
+	}
+
+	cursor, err := decodeRecordsCursor(s)
+	if err != nil {
+		return recordsCursor{}, true, fmt.Errorf("failed to parse query parameter '%s': %w", cursorKey, err)
+	}
+
+	if query.Has(offsetKey) {
+		return recordsCursor{}, true, fmt.Errorf("query parameter '%s' can't be combined with '%s'", offsetKey, cursorKey)
+	}
+
+	if topicName := query.Get(topicNameKey); topicName != "" && topicName != cursor.TopicName {
+		return recordsCursor{}, true, fmt.Errorf("query parameter '%s' doesn't match the topic of '%s'", topicNameKey, cursorKey)
+	}
+
+	return cursor, true, nil
+}
+
+// requestTopicName returns the name of the topic requested by r, given either
+// by its topic-name query parameter or its cursor.
+func requestTopicName(r *http.Request) string {
+	cursor, ok, err := parseRecordsCursor(r)
+	if ok && err == nil {
+		return cursor.TopicName
+	}
+	return r.URL.Query().Get(topicNameKey)
+}
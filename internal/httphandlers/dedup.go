@@ -0,0 +1,97 @@
+package httphandlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+)
+
+type DedupStatsGetter interface {
+	DedupStats() sebbroker.DedupStats
+}
+
+type DedupProducerOutput struct {
+	Principal     string    `json:"principal"`
+	TopicName     string    `json:"topic_name"`
+	Batches       int       `json:"batches"`
+	Hits          uint64    `json:"hits"`
+	HighestOffset uint64    `json:"highest_offset"`
+	LastAddedAt   time.Time `json:"last_added_at"`
+}
+
+type GetDedupStatsOutput struct {
+	// Window is empty if the broker doesn't deduplicate batches.
+	Window    string                `json:"window"`
+	Batches   int                   `json:"batches"`
+	InFlight  int                   `json:"in_flight"`
+	Hits      uint64                `json:"hits"`
+	Misses    uint64                `json:"misses"`
+	Producers []DedupProducerOutput `json:"producers"`
+}
+
+// GetDedupStats returns the state of the broker's batch deduplication: the
+// batches remembered within the dedup window for each producer and topic, and
+// the number of duplicates that were acknowledged. This is useful for
+// debugging producers whose retries are unexpectedly added again.
+func GetDedupStats(log logger.Logger, s DedupStatsGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		stats := s.DedupStats()
+
+		output := GetDedupStatsOutput{
+			Batches:   stats.Batches,
+			InFlight:  stats.InFlight,
+			Hits:      stats.Hits,
+			Misses:    stats.Misses,
+			Producers: make([]DedupProducerOutput, 0, len(stats.Producers)),
+		}
+		if stats.Window > 0 {
+			output.Window = stats.Window.String()
+		}
+		for _, producer := range stats.Producers {
+			output.Producers = append(output.Producers, DedupProducerOutput(producer))
+		}
+
+		httphelpers.WriteJSON(w, &output)
+	}
+}
+
+// writeDedupMetrics writes the metrics of the broker's batch deduplication in
+// the Prometheus text exposition format. Nothing is written if the broker
+// doesn't deduplicate batches.
+func writeDedupMetrics(w io.Writer, s DedupStatsGetter) {
+	stats := s.DedupStats()
+	if stats.Window == 0 {
+		return
+	}
+
+	metrics := []struct {
+		name       string
+		metricType string
+		help       string
+		value      any
+	}{
+		{"seb_dedup_batches", "gauge", "Number of batches remembered within the dedup window.", stats.Batches},
+		{"seb_dedup_in_flight", "gauge", "Number of remembered batches that are still being added.", stats.InFlight},
+		{"seb_dedup_hits_total", "counter", "Number of duplicate batches that were acknowledged without being added.", stats.Hits},
+		{"seb_dedup_misses_total", "counter", "Number of batches that were added and remembered.", stats.Misses},
+	}
+	for _, metric := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", metric.name, metric.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", metric.name, metric.metricType)
+		fmt.Fprintf(w, "%s %v\n", metric.name, metric.value)
+	}
+
+	const producerBatches = "seb_dedup_producer_batches"
+	fmt.Fprintf(w, "# HELP %s %s\n", producerBatches, "Number of batches remembered within the dedup window, by producer and topic.")
+	fmt.Fprintf(w, "# TYPE %s gauge\n", producerBatches)
+	for _, producer := range stats.Producers {
+		fmt.Fprintf(w, "%s{principal=%q,topic=%q} %d\n", producerBatches, producer.Principal, producer.TopicName, producer.Batches)
+	}
+}
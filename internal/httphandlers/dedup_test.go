@@ -0,0 +1,84 @@
+package httphandlers_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/httphandlers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetDedupStats verifies that GET /admin/dedup returns the batches
+// remembered for each producer and the number of acknowledged duplicates, and
+// that GET /metrics includes dedup metrics.
+func TestGetDedupStats(t *testing.T) {
+	server := tester.HTTPServer(t, tester.HTTPBrokerOpts(sebbroker.WithDedupWindow(time.Minute)))
+	defer server.Close()
+
+	batch := tester.MakeRandomRecordBatch(2)
+	for range 2 {
+		_, err := server.Broker.AddRecords("topic", batch)
+		require.NoError(t, err)
+	}
+
+	// Act
+	response := server.DoWithAuth(httptest.NewRequest("GET", "/admin/dedup", nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	output := httphandlers.GetDedupStatsOutput{}
+	err := httphelpers.ParseJSONAndClose(response.Body, &output)
+	require.NoError(t, err)
+	require.Equal(t, "1m0s", output.Window)
+	require.Equal(t, 1, output.Batches)
+	require.Equal(t, uint64(1), output.Hits)
+	require.Equal(t, uint64(1), output.Misses)
+	require.Len(t, output.Producers, 1)
+	require.Equal(t, "topic", output.Producers[0].TopicName)
+	require.Equal(t, uint64(1), output.Producers[0].HighestOffset)
+
+	// Act
+	response = server.DoWithAuth(httptest.NewRequest("GET", "/metrics", nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	bs, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+
+	body := string(bs)
+	require.Contains(t, body, "seb_dedup_hits_total 1\n")
+	require.Contains(t, body, `seb_dedup_producer_batches{principal="",topic="topic"} 1`+"\n")
+}
+
+// TestGetDedupStatsDisabled verifies that GET /admin/dedup returns an empty
+// window when the broker doesn't deduplicate batches, and that GET /metrics
+// leaves out dedup metrics.
+func TestGetDedupStatsDisabled(t *testing.T) {
+	server := tester.HTTPServer(t)
+	defer server.Close()
+
+	// Act
+	response := server.DoWithAuth(httptest.NewRequest("GET", "/admin/dedup", nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	output := httphandlers.GetDedupStatsOutput{}
+	err := httphelpers.ParseJSONAndClose(response.Body, &output)
+	require.NoError(t, err)
+	require.Equal(t, "", output.Window)
+	require.Empty(t, output.Producers)
+
+	response = server.DoWithAuth(httptest.NewRequest("GET", "/metrics", nil))
+	bs, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	require.NotContains(t, string(bs), "seb_dedup_")
+}
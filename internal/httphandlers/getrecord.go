@@ -1,18 +1,19 @@
 package httphandlers
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	"net/http"
 
 	"github.com/micvbang/go-helpy/sizey"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
 	"github.com/micvbang/simple-event-broker/internal/sebrecords"
 	"github.com/micvbang/simple-event-broker/seberr"
 )
 
 type RecordGetter interface {
-	GetRecord(batch *sebrecords.Batch, topicName string, offset uint64) ([]byte, error)
+	GetRecord(ctx context.Context, batch *sebrecords.Batch, topicName string, offset uint64) ([]byte, error)
 }
 
 func GetRecord(log logger.Logger, s RecordGetter) http.HandlerFunc {
@@ -25,25 +26,27 @@ func GetRecord(log logger.Logger, s RecordGetter) http.HandlerFunc {
 		}
 		params, err := parseQueryParams(r, qparams...)
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, err.Error())
+			httphelpers.WriteError(w, http.StatusBadRequest, err)
 		}
 		offset := params[offsetKey].(uint64)
 		topicName := params[topicNameKey].(string)
 
+		if !rejectPausedGroup(log, w, r, s, topicName) {
+			return
+		}
+
 		// TODO: pool
 		batch := sebrecords.NewBatch(make([]uint32, 0, 8192), make([]byte, 0, 10*sizey.MB))
-		record, err := s.GetRecord(&batch, topicName, offset)
+		record, err := s.GetRecord(r.Context(), &batch, topicName, offset)
 		if err != nil {
 			if errors.Is(err, seberr.ErrOutOfBounds) {
 				log.Debugf("not found")
-				w.WriteHeader(http.StatusNotFound)
+				httphelpers.WriteError(w, http.StatusNotFound, err)
 				return
 			}
 
 			log.Errorf("reading record: %s", err.Error())
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "failed to read record '%d': %s", offset, err)
+			httphelpers.WriteErrorf(w, http.StatusInternalServerError, "failed to read record '%d': %w", offset, err)
 		}
 		w.Write(record)
 	}
@@ -3,54 +3,153 @@ package httphandlers
 import (
 	"context"
 	"errors"
-	"fmt"
+	"math"
 	"mime"
 	"mime/multipart"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/micvbang/go-helpy/slicey"
 	"github.com/micvbang/go-helpy/syncy"
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
 	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
 	"github.com/micvbang/simple-event-broker/seberr"
 )
 
 type RecordsGetter interface {
 	GetRecords(ctx context.Context, batch *sebrecords.Batch, topicName string, offset uint64, maxRecords int, softMaxBytes int) error
+	GetRecordsNonBlocking(ctx context.Context, batch *sebrecords.Batch, topicName string, offset uint64, maxRecords int, softMaxBytes int) (uint64, error)
+}
+
+// RecordsWriterGetter is implemented by RecordsGetters that can write record
+// data directly to the response, instead of reading it into memory first.
+type RecordsWriterGetter interface {
+	GetRecordsWriter(ctx context.Context, batch *sebrecords.Batch, topicName string, offset uint64, maxRecords int, softMaxBytes int) (*sebtopic.RecordsWriter, error)
 }
 
 const multipartFormData = "multipart/form-data"
 
+// NextOffsetHeader is the response header containing the offset that follows
+// the last record that was read. Since expired records are skipped, this is not
+// necessarily the requested offset plus the number of records returned.
+const NextOffsetHeader = "Next-Offset"
+
+// The following response headers account for the records read by GetRecords,
+// allowing clients to tune max-records and max-bytes.
+const (
+	// RecordsReturnedHeader is the number of records in the response.
+	RecordsReturnedHeader = "Records-Returned"
+
+	// BytesReturnedHeader is the number of bytes of record data in the
+	// response.
+	BytesReturnedHeader = "Bytes-Returned"
+
+	// RecordsScannedHeader is the number of records that were read, including
+	// those that were skipped, e.g. because they had expired.
+	RecordsScannedHeader = "Records-Scanned"
+
+	// BytesScannedHeader is the number of bytes of record data that were read,
+	// including that of records that were skipped after being examined.
+	BytesScannedHeader = "Bytes-Scanned"
+
+	// StopReasonHeader is the reason that reading records stopped; one of
+	// end, max-records, max-bytes and deadline.
+	StopReasonHeader = "Stop-Reason"
+)
+
+// MaxRecordsTimeout is the longest timeout that GetRecords can be asked to wait
+// for records for.
+const MaxRecordsTimeout = 5 * time.Minute
+
+// GetRecords returns records from a topic as multipart form data. By default it
+// waits for the requested offset to be produced until the request times out.
+// If non-blocking is set, it instead responds immediately with 416 Requested
+// Range Not Satisfiable and the topic's next offset in NextOffsetHeader.
+//
+// If key or header query parameters are given, only records with the given key
+// and headers are returned; other records are skipped in the same way as
+// expired records, and aren't read by the client.
+//
+// Instead of topic-name and offset, the cursor returned in NextCursorHeader by
+// a previous request can be given in the cursor query parameter. Reading then
+// continues where the previous request stopped, using its read options unless
+// they're given explicitly.
+//
+// If the group query parameter is given and delivery of records of the topic
+// to the consumer group is paused, 423 Locked is returned. See PauseGroup.
+//
+// max-records must be at most the number of records that fit in the batches of
+// batchPool, and timeout at most MaxRecordsTimeout; 400 Bad Request is returned
+// otherwise. max-bytes is a soft limit, and is lowered to the size of the
+// batches' buffers.
+//
+// By default, max-bytes limits the bytes of record data in the response. If
+// max-bytes-wire is set, it instead limits the size of the response body,
+// including the multipart headers and the sizes of the records, e.g. in order
+// to stay below the body size limits of proxies. As with record data, at least
+// one record is returned.
+//
+// The number of records and bytes that were returned and scanned, and the
+// reason that reading stopped, are given in the RecordsReturnedHeader,
+// BytesReturnedHeader, RecordsScannedHeader, BytesScannedHeader and
+// StopReasonHeader headers.
+//
+// If s implements RecordsWriterGetter, record data is written directly to the
+// response when blocking.
 func GetRecords(log logger.Logger, batchPool *syncy.Pool[*sebrecords.Batch], s RecordsGetter) http.HandlerFunc {
+	// NOTE: all batches of batchPool are expected to have the same capacity.
+	batch := batchPool.Get()
+	maxRecordsLimit := cap(batch.Sizes)
+	batchPool.Put(batch)
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Debugf("hit %s", r.URL)
 
 		mediatype, _, err := mime.ParseMediaType(r.Header.Get("Accept"))
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotAcceptable)
+			httphelpers.WriteError(w, http.StatusNotAcceptable, err)
 			return
 		}
 		if mediatype != "*/*" && mediatype != multipartFormData {
-			http.Error(w, fmt.Sprintf("set Accept: %s", multipartFormData), http.StatusMultipleChoices)
+			httphelpers.WriteErrorf(w, http.StatusMultipleChoices, "set Accept: %s", multipartFormData)
 			return
 		}
 
 		ctx := r.Context()
 		var cancel func()
 
+		cursor, hasCursor, err := parseRecordsCursor(r)
+		if err != nil {
+			log.Errorf("parsing url params: %s", err)
+			httphelpers.WriteErrorf(w, http.StatusBadRequest, "parsing url params: %w", err)
+			return
+		}
+
 		qparams := []QParam{
 			{Key: topicNameKey, Parser: QueryString},
 			{Key: offsetKey, Parser: QueryUint64},
 			{Key: softMaxBytesKey, Parser: QueryIntDefault(0)},
-			{Key: maxRecordsKey, Parser: QueryIntDefault(10)},
+			{Key: maxRecordsKey, Parser: QueryIntDefault(0)},
 			{Key: timeoutKey, Parser: QueryDurationDefault(10 * time.Second)},
+			{Key: nonBlockingKey, Parser: QueryBoolDefault(false)},
+			{Key: wireSizeKey, Parser: QueryBoolDefault(false)},
+		}
+		if hasCursor {
+			// read options that are given explicitly override those of the
+			// cursor
+			qparams[0].Parser = QueryStringDefault(cursor.TopicName)
+			qparams[1].Parser = QueryUint64Default(cursor.Offset)
+			qparams[2].Parser = QueryIntDefault(cursor.SoftMaxBytes)
+			qparams[3].Parser = QueryIntDefault(cursor.MaxRecords)
+			qparams[6].Parser = QueryBoolDefault(cursor.WireSize)
 		}
 		params, err := parseQueryParams(r, qparams...)
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
 			log.Errorf("parsing url params: %s", err)
-			fmt.Fprintf(w, "parsing url params: %s", err)
+			httphelpers.WriteErrorf(w, http.StatusBadRequest, "parsing url params: %w", err)
 			return
 		}
 
@@ -59,10 +158,64 @@ func GetRecords(log logger.Logger, batchPool *syncy.Pool[*sebrecords.Batch], s R
 		softMaxBytes := params[softMaxBytesKey].(int)
 		maxRecords := params[maxRecordsKey].(int)
 		timeout := params[timeoutKey].(time.Duration)
+		nonBlocking := params[nonBlockingKey].(bool)
+		wireSize := params[wireSizeKey].(bool)
+
+		err = errors.Join(
+			checkIntRange(maxRecordsKey, maxRecords, 0, maxRecordsLimit),
+			checkIntRange(softMaxBytesKey, softMaxBytes, 0, math.MaxInt),
+			checkDurationRange(timeoutKey, timeout, 0, MaxRecordsTimeout),
+		)
+		if err != nil {
+			log.Debugf("validating url params: %s", err)
+			httphelpers.WriteErrorf(w, http.StatusBadRequest, "validating url params: %w", err)
+			return
+		}
+
+		filter, err := parseRecordFilter(r)
+		if err != nil {
+			log.Errorf("parsing url params: %s", err)
+			httphelpers.WriteErrorf(w, http.StatusBadRequest, "parsing url params: %w", err)
+			return
+		}
+		if hasCursor && filter.Empty() {
+			filter = cursor.filter()
+		}
+		if !filter.Empty() {
+			ctx = sebtopic.WithRecordFilter(ctx, filter)
+		}
+
+		if !rejectPausedGroup(log, w, r, s, topicName) {
+			return
+		}
+
+		// NOTE: the multipart writer doesn't write to w until its first part
+		// is created; its boundary is needed in order to know the overhead of
+		// the response.
+		mw := multipart.NewWriter(w)
+		if wireSize && softMaxBytes > 0 {
+			overhead, err := httphelpers.MultipartFormDataOverhead(mw.Boundary())
+			if err != nil {
+				log.Errorf("computing multipart overhead: %s", err)
+				httphelpers.WriteErrorf(w, http.StatusInternalServerError, "computing response overhead")
+				return
+			}
+			ctx = sebtopic.WithWireSize(ctx, sebtopic.WireSize{
+				FixedOverhead:  overhead,
+				RecordOverhead: httphelpers.MultipartRecordOverhead,
+			})
+		}
 
 		ctx, cancel = context.WithTimeout(ctx, timeout)
 		defer cancel()
 
+		// NOTE: the response isn't written until records are available or the
+		// timeout expires.
+		err = httphelpers.ExtendWriteDeadline(w, r, timeout)
+		if err != nil {
+			log.Debugf("extending write deadline: %s", err)
+		}
+
 		log = log.
 			WithField("topic-name", topicName).
 			WithField("offset", offset).
@@ -75,34 +228,62 @@ func GetRecords(log logger.Logger, batchPool *syncy.Pool[*sebrecords.Batch], s R
 		batch.Reset()
 		defer batchPool.Put(batch)
 
-		err = s.GetRecords(ctx, batch, topicName, offset, maxRecords, softMaxBytes)
+		var (
+			nextOffset    uint64
+			recordsWriter *sebtopic.RecordsWriter
+		)
+		rwg, canWriteRecords := s.(RecordsWriterGetter)
+		switch {
+		case nonBlocking:
+			nextOffset, err = s.GetRecordsNonBlocking(ctx, batch, topicName, offset, maxRecords, softMaxBytes)
+		case canWriteRecords:
+			recordsWriter, err = rwg.GetRecordsWriter(ctx, batch, topicName, offset, maxRecords, softMaxBytes)
+			nextOffset = offset + uint64(batch.Len()+batch.Skipped)
+		default:
+			err = s.GetRecords(ctx, batch, topicName, offset, maxRecords, softMaxBytes)
+			nextOffset = offset + uint64(batch.Len()+batch.Skipped)
+		}
 		if err != nil {
 			if errors.Is(err, seberr.ErrTopicNotFound) {
 				log.Debugf("not found: %s", err)
-				w.WriteHeader(http.StatusNotFound)
-				fmt.Fprintf(w, "topic not found")
+				httphelpers.WriteErrorf(w, http.StatusNotFound, "topic not found")
+				return
+			}
+
+			if errors.Is(err, seberr.ErrOffsetOutOfBounds) {
+				log.Debugf("offset not yet produced: %s", err)
+				w.Header().Set(NextOffsetHeader, strconv.FormatUint(nextOffset, 10))
+				httphelpers.WriteErrorf(w, http.StatusRequestedRangeNotSatisfiable, "offset not yet produced")
 				return
 			}
 
 			if errors.Is(err, seberr.ErrOutOfBounds) {
 				log.Debugf("offset out of bounds: %s", err)
-				w.WriteHeader(http.StatusNotFound)
-				fmt.Fprintf(w, "offset out of bounds")
+				httphelpers.WriteErrorf(w, http.StatusNotFound, "offset out of bounds")
 				return
 			}
 
 			errIsContext = errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
 			if !errIsContext {
 				log.Errorf("reading record: %s", err.Error())
-				w.WriteHeader(http.StatusInternalServerError)
-				fmt.Fprintf(w, "failed to read record '%d': %s", offset, err)
+				httphelpers.WriteErrorf(w, http.StatusInternalServerError, "failed to read record '%d': %w", offset, err)
 				return
 			}
 		}
 
-		mw := multipart.NewWriter(w)
 		defer mw.Close()
 		w.Header().Set("Content-Type", mw.FormDataContentType())
+		w.Header().Set(NextOffsetHeader, strconv.FormatUint(nextOffset, 10))
+		setReadStatsHeaders(w, batch, errIsContext)
+		w.Header().Set(NextCursorHeader, recordsCursor{
+			TopicName:    topicName,
+			Offset:       nextOffset,
+			MaxRecords:   maxRecords,
+			SoftMaxBytes: softMaxBytes,
+			WireSize:     wireSize,
+			Key:          filter.Key,
+			Headers:      filter.Headers,
+		}.encode())
 
 		if errIsContext {
 			log.Debugf("context ended: %s", err)
@@ -110,9 +291,14 @@ func GetRecords(log logger.Logger, batchPool *syncy.Pool[*sebrecords.Batch], s R
 			return
 		}
 
-		log.Debugf("sizes: %d, data: %d", len(batch.Sizes), len(batch.Data))
-		// TODO: pass batch instead of sizes and data
-		err = httphelpers.RecordsToMultipartFormDataHTTP(mw, batch.Sizes, batch.Data)
+		if recordsWriter != nil {
+			log.Debugf("sizes: %d, streaming data", len(batch.Sizes))
+			err = httphelpers.RecordsWriterToMultipartFormDataHTTP(mw, batch.Sizes, recordsWriter)
+		} else {
+			log.Debugf("sizes: %d, data: %d", len(batch.Sizes), len(batch.Data))
+			// TODO: pass batch instead of sizes and data
+			err = httphelpers.RecordsToMultipartFormDataHTTP(mw, batch.Sizes, batch.Data)
+		}
 		if err != nil {
 			log.Errorf("writing record multipart form data: %s", err)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -120,3 +306,21 @@ func GetRecords(log logger.Logger, batchPool *syncy.Pool[*sebrecords.Batch], s R
 		}
 	}
 }
+
+// setReadStatsHeaders sets the headers accounting for the records read into
+// batch. If the read was stopped by its deadline, no records are returned.
+func setReadStatsHeaders(w http.ResponseWriter, batch *sebrecords.Batch, deadline bool) {
+	bytesRead := int(slicey.Sum(batch.Sizes))
+	returned, bytesReturned := batch.Len(), bytesRead
+	stopReason := batch.StopReason
+	if deadline {
+		returned, bytesReturned = 0, 0
+		stopReason = sebrecords.StopReasonDeadline
+	}
+
+	w.Header().Set(RecordsReturnedHeader, strconv.Itoa(returned))
+	w.Header().Set(BytesReturnedHeader, strconv.Itoa(bytesReturned))
+	w.Header().Set(RecordsScannedHeader, strconv.Itoa(batch.Len()+batch.Skipped))
+	w.Header().Set(BytesScannedHeader, strconv.Itoa(bytesRead+batch.SkippedBytes))
+	w.Header().Set(StopReasonHeader, string(stopReason))
+}
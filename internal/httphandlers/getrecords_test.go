@@ -1,18 +1,22 @@
 package httphandlers_test
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"mime"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/micvbang/go-helpy/sizey"
 	"github.com/micvbang/simple-event-broker/internal/httphandlers"
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
 	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
 	"github.com/micvbang/simple-event-broker/seberr"
 	"github.com/stretchr/testify/require"
 )
@@ -74,8 +78,8 @@ func TestGetRecordsExistence(t *testing.T) {
 }
 
 // TestGetRecordsURLParameters verifies that query parameters are handled as
-// expected; some are required, some have defaults, and some refer to entities
-// that must exist (topic name, offset).
+// expected; some are required, some have defaults, some must be within bounds,
+// and some refer to entities that must exist (topic name, offset).
 func TestGetRecordsURLParameters(t *testing.T) {
 	const topicName = "topic-name"
 	server := tester.HTTPServer(t, tester.HTTPBrokerAutoCreateTopic(false))
@@ -165,6 +169,86 @@ func TestGetRecordsURLParameters(t *testing.T) {
 			},
 			statusCode: http.StatusPartialContent,
 		},
+		"negative max-bytes": {
+			params: map[string]any{
+				"topic-name":  topicName,
+				"offset":      0,
+				"max-bytes":   -1,
+				"max-records": 2,
+				"timeout":     "100ms",
+			},
+			statusCode: http.StatusBadRequest,
+		},
+		"negative max-records": {
+			params: map[string]any{
+				"topic-name":  topicName,
+				"offset":      0,
+				"max-bytes":   1,
+				"max-records": -2,
+				"timeout":     "100ms",
+			},
+			statusCode: http.StatusBadRequest,
+		},
+		"too many max-records": {
+			params: map[string]any{
+				"topic-name":  topicName,
+				"offset":      0,
+				"max-bytes":   1,
+				"max-records": 1 << 31,
+				"timeout":     "100ms",
+			},
+			statusCode: http.StatusBadRequest,
+		},
+		"invalid max-records": {
+			params: map[string]any{
+				"topic-name":  topicName,
+				"offset":      0,
+				"max-bytes":   1,
+				"max-records": "two",
+				"timeout":     "100ms",
+			},
+			statusCode: http.StatusBadRequest,
+		},
+		"invalid timeout": {
+			params: map[string]any{
+				"topic-name":  topicName,
+				"offset":      0,
+				"max-bytes":   1,
+				"max-records": 2,
+				"timeout":     "soon",
+			},
+			statusCode: http.StatusBadRequest,
+		},
+		"negative timeout": {
+			params: map[string]any{
+				"topic-name":  topicName,
+				"offset":      0,
+				"max-bytes":   1,
+				"max-records": 2,
+				"timeout":     "-1s",
+			},
+			statusCode: http.StatusBadRequest,
+		},
+		"timeout too long": {
+			params: map[string]any{
+				"topic-name":  topicName,
+				"offset":      0,
+				"max-bytes":   1,
+				"max-records": 2,
+				"timeout":     (httphandlers.MaxRecordsTimeout + time.Second).String(),
+			},
+			statusCode: http.StatusBadRequest,
+		},
+		"negative offset": {
+			params: map[string]any{
+				"topic-name":  topicName,
+				"offset":      -1,
+				"max-bytes":   1,
+				"max-records": 2,
+				"timeout":     "100ms",
+			},
+			statusCode: http.StatusBadRequest,
+		},
 		"topic-name not found": {
 			params: map[string]any{
 				"topic-name":  "does-not-exist",
@@ -285,6 +369,146 @@ func TestGetRecordsMultipartFormData(t *testing.T) {
 	}
 }
 
+// TestGetRecordsWireSize verifies that max-bytes limits the size of the
+// response body when max-bytes-wire is set, also when reading from the cursor
+// of a response, and that it only limits record data otherwise.
+func TestGetRecordsWireSize(t *testing.T) {
+	server := tester.HTTPServer(t)
+	defer server.Close()
+
+	const (
+		topicName  = "topicName"
+		recordSize = 32
+		maxBytes   = 2048
+	)
+
+	batch := tester.MakeRandomRecordBatchSize(256, recordSize)
+	_, err := server.Broker.AddRecords(topicName, batch)
+	require.NoError(t, err)
+
+	getRecords := func(query map[string]string) (*http.Response, []byte) {
+		r := httptest.NewRequest("GET", "/records", nil)
+		r.Header.Add("Accept", "multipart/form-data")
+		httphelpers.AddQueryParams(r, query)
+		response := server.DoWithAuth(r)
+		require.Equal(t, http.StatusOK, response.StatusCode)
+
+		body, err := io.ReadAll(response.Body)
+		require.NoError(t, err)
+		return response, body
+	}
+
+	// Act
+	_, payloadBody := getRecords(map[string]string{
+		"topic-name":  topicName,
+		"offset":      "0",
+		"max-records": "256",
+		"max-bytes":   fmt.Sprintf("%d", maxBytes),
+	})
+	wireResponse, wireBody := getRecords(map[string]string{
+		"topic-name":     topicName,
+		"offset":         "0",
+		"max-records":    "256",
+		"max-bytes":      fmt.Sprintf("%d", maxBytes),
+		"max-bytes-wire": "true",
+	})
+	_, cursorBody := getRecords(map[string]string{
+		"cursor": wireResponse.Header.Get(httphandlers.NextCursorHeader),
+	})
+
+	// Assert
+	require.Greater(t, len(payloadBody), maxBytes)
+	require.LessOrEqual(t, len(wireBody), maxBytes)
+	require.LessOrEqual(t, len(cursorBody), maxBytes)
+
+	_, params, err := mime.ParseMediaType(wireResponse.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	gotBatch := sebrecords.NewBatch(make([]uint32, 0, 256), make([]byte, 0, sizey.MB))
+	err = httphelpers.MultipartFormDataToRecords(bytes.NewReader(wireBody), params["boundary"], &gotBatch)
+	require.NoError(t, err)
+	require.NotZero(t, gotBatch.Len())
+	require.Equal(t, batch.IndividualRecords()[:gotBatch.Len()], gotBatch.IndividualRecords())
+}
+
+// TestGetRecordsReadStats verifies that the number of records and bytes that
+// were returned and scanned, and the reason that reading stopped, are given in
+// the response headers.
+func TestGetRecordsReadStats(t *testing.T) {
+	server := tester.HTTPServer(t)
+	defer server.Close()
+
+	const (
+		topicName  = "topicName"
+		recordSize = 16
+	)
+
+	batch := tester.MakeRandomRecordBatchSize(10, recordSize)
+	batch.Expires = make([]int64, batch.Len())
+	batch.Expires[1] = time.Now().Add(-time.Hour).UnixMicro()
+	_, err := server.Broker.AddRecords(topicName, batch)
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		maxRecords      int
+		maxBytes        int
+		expectedHeaders map[string]string
+	}{
+		"max-records": {
+			maxRecords: 4,
+			expectedHeaders: map[string]string{
+				httphandlers.RecordsReturnedHeader: "4",
+				httphandlers.BytesReturnedHeader:   fmt.Sprintf("%d", 4*recordSize),
+				httphandlers.RecordsScannedHeader:  "5",
+				httphandlers.BytesScannedHeader:    fmt.Sprintf("%d", 5*recordSize),
+				httphandlers.StopReasonHeader:      "max-records",
+			},
+		},
+		"max-bytes": {
+			maxRecords: 10,
+			maxBytes:   2 * recordSize,
+			expectedHeaders: map[string]string{
+				httphandlers.RecordsReturnedHeader: "2",
+				httphandlers.BytesReturnedHeader:   fmt.Sprintf("%d", 2*recordSize),
+				httphandlers.RecordsScannedHeader:  "3",
+				httphandlers.BytesScannedHeader:    fmt.Sprintf("%d", 3*recordSize),
+				httphandlers.StopReasonHeader:      "max-bytes",
+			},
+		},
+		"end": {
+			maxRecords: 10,
+			expectedHeaders: map[string]string{
+				httphandlers.RecordsReturnedHeader: "9",
+				httphandlers.BytesReturnedHeader:   fmt.Sprintf("%d", 9*recordSize),
+				httphandlers.RecordsScannedHeader:  "10",
+				httphandlers.BytesScannedHeader:    fmt.Sprintf("%d", 10*recordSize),
+				httphandlers.StopReasonHeader:      "end",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/records", nil)
+			r.Header.Add("Accept", "multipart/form-data")
+			httphelpers.AddQueryParams(r, map[string]string{
+				"topic-name":  topicName,
+				"offset":      "0",
+				"max-records": fmt.Sprintf("%d", test.maxRecords),
+				"max-bytes":   fmt.Sprintf("%d", test.maxBytes),
+			})
+
+			// Act
+			response := server.DoWithAuth(r)
+
+			// Assert
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			for header, expected := range test.expectedHeaders {
+				require.Equal(t, expected, response.Header.Get(header), header)
+			}
+		})
+	}
+}
+
 // TestGetRecordsErrors verifies that the expected status codes are returned
 // when GetRecords() returns certain errors.
 func TestGetRecordsErrors(t *testing.T) {
@@ -341,3 +565,252 @@ func TestGetRecordsErrors(t *testing.T) {
 		})
 	}
 }
+
+// TestGetRecordsNonBlockingOutOfBounds verifies that GetRecordsNonBlocking is
+// used when non-blocking is set, and that seberr.ErrOffsetOutOfBounds is
+// returned as http.StatusRequestedRangeNotSatisfiable along with the topic's
+// next offset.
+func TestGetRecordsNonBlockingOutOfBounds(t *testing.T) {
+	deps := &httphandlers.MockDependencies{}
+	deps.GetRecordsNonBlockingMock = func(ctx context.Context, batch *sebrecords.Batch, topicName string, offset uint64, maxRecords, softMaxBytes int) (uint64, error) {
+		return 7, seberr.ErrOffsetOutOfBounds
+	}
+
+	server := tester.HTTPServer(t, tester.HTTPDependencies(deps))
+	defer server.Close()
+
+	r := httptest.NewRequest("GET", "/records", nil)
+	r.Header.Add("Accept", "multipart/form-data")
+	httphelpers.AddQueryParams(r, map[string]string{
+		"topic-name":   "some-topic",
+		"offset":       "10",
+		"non-blocking": "true",
+	})
+
+	// Act
+	response := server.DoWithAuth(r)
+
+	// Assert
+	require.Equal(t, http.StatusRequestedRangeNotSatisfiable, response.StatusCode)
+	require.Equal(t, "7", response.Header.Get(httphandlers.NextOffsetHeader))
+	require.Equal(t, 1, len(deps.GetRecordsNonBlockingCalls))
+	require.Equal(t, uint64(10), deps.GetRecordsNonBlockingCalls[0].Offset)
+	require.Equal(t, 0, len(deps.GetRecordsCalls))
+}
+
+// TestGetRecordsNextOffset verifies that the Next-Offset header accounts for
+// both returned and skipped records.
+func TestGetRecordsNextOffset(t *testing.T) {
+	deps := &httphandlers.MockDependencies{}
+	deps.GetRecordsMock = func(ctx context.Context, batch *sebrecords.Batch, topicName string, offset uint64, maxRecords, softMaxBytes int) error {
+		*batch = tester.RecordsToBatch([][]byte{[]byte("record1"), []byte("record2")})
+		batch.Skipped = 3
+		return nil
+	}
+
+	server := tester.HTTPServer(t, tester.HTTPDependencies(deps))
+	defer server.Close()
+
+	r := httptest.NewRequest("GET", "/records", nil)
+	r.Header.Add("Accept", "multipart/form-data")
+	httphelpers.AddQueryParams(r, map[string]string{
+		"topic-name": "some-topic",
+		"offset":     "10",
+	})
+
+	// Act
+	response := server.DoWithAuth(r)
+
+	// Assert
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.Equal(t, "15", response.Header.Get(httphandlers.NextOffsetHeader))
+}
+
+// TestGetRecordsMaxRecordsDefault verifies that max-records is passed on as 0
+// when it's not given, leaving the default to the broker.
+func TestGetRecordsMaxRecordsDefault(t *testing.T) {
+	deps := &httphandlers.MockDependencies{}
+	deps.GetRecordsMock = func(ctx context.Context, batch *sebrecords.Batch, topicName string, offset uint64, maxRecords, softMaxBytes int) error {
+		return nil
+	}
+
+	server := tester.HTTPServer(t, tester.HTTPDependencies(deps))
+	defer server.Close()
+
+	r := httptest.NewRequest("GET", "/records", nil)
+	r.Header.Add("Accept", "multipart/form-data")
+	httphelpers.AddQueryParams(r, map[string]string{
+		"topic-name": "some-topic",
+		"offset":     "0",
+	})
+
+	// Act
+	server.DoWithAuth(r)
+
+	// Assert
+	require.Equal(t, 1, len(deps.GetRecordsCalls))
+	require.Equal(t, 0, deps.GetRecordsCalls[0].MaxRecords)
+}
+
+// TestGetRecordsRecordFilter verifies that the key and header query parameters
+// are passed on to the broker as a sebtopic.RecordFilter, and that malformed
+// headers return http.StatusBadRequest.
+func TestGetRecordsRecordFilter(t *testing.T) {
+	tests := map[string]struct {
+		query          string
+		statusCode     int
+		expectedFilter sebtopic.RecordFilter
+		expectedOK     bool
+	}{
+		"no filter": {
+			query:      "",
+			statusCode: http.StatusOK,
+		},
+		"key": {
+			query:          "&key=user-1",
+			statusCode:     http.StatusOK,
+			expectedFilter: sebtopic.RecordFilter{Key: []byte("user-1")},
+			expectedOK:     true,
+		},
+		"headers": {
+			query:          "&header=type:created&header=region:eu:west",
+			statusCode:     http.StatusOK,
+			expectedFilter: sebtopic.RecordFilter{Headers: map[string]string{"type": "created", "region": "eu:west"}},
+			expectedOK:     true,
+		},
+		"malformed header": {
+			query:      "&header=type",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var (
+				gotFilter sebtopic.RecordFilter
+				gotOK     bool
+			)
+			deps := &httphandlers.MockDependencies{}
+			deps.GetRecordsMock = func(ctx context.Context, batch *sebrecords.Batch, topicName string, offset uint64, maxRecords, softMaxBytes int) error {
+				gotFilter, gotOK = sebtopic.RecordFilterFromContext(ctx)
+				return nil
+			}
+
+			server := tester.HTTPServer(t, tester.HTTPDependencies(deps))
+			defer server.Close()
+
+			r := httptest.NewRequest("GET", "/records?topic-name=some-topic&offset=0"+test.query, nil)
+			r.Header.Add("Accept", "multipart/form-data")
+
+			// Act
+			response := server.DoWithAuth(r)
+
+			// Assert
+			require.Equal(t, test.statusCode, response.StatusCode)
+			require.Equal(t, test.expectedOK, gotOK)
+			require.Equal(t, test.expectedFilter, gotFilter)
+		})
+	}
+}
+
+// TestGetRecordsCursor verifies that the Next-Cursor header can be given in
+// the cursor query parameter in order to continue reading from the next
+// offset using the same read options, and that read options given explicitly
+// override those of the cursor.
+func TestGetRecordsCursor(t *testing.T) {
+	type getRecordsCall struct {
+		topicName  string
+		offset     uint64
+		maxRecords int
+		filter     sebtopic.RecordFilter
+	}
+	calls := []getRecordsCall{}
+
+	deps := &httphandlers.MockDependencies{}
+	deps.GetRecordsMock = func(ctx context.Context, batch *sebrecords.Batch, topicName string, offset uint64, maxRecords, softMaxBytes int) error {
+		filter, _ := sebtopic.RecordFilterFromContext(ctx)
+		calls = append(calls, getRecordsCall{topicName: topicName, offset: offset, maxRecords: maxRecords, filter: filter})
+
+		*batch = tester.RecordsToBatch([][]byte{[]byte("record1"), []byte("record2")})
+		batch.Skipped = 1
+		return nil
+	}
+
+	server := tester.HTTPServer(t, tester.HTTPDependencies(deps))
+	defer server.Close()
+
+	getRecords := func(query map[string]string) *http.Response {
+		r := httptest.NewRequest("GET", "/records", nil)
+		r.Header.Add("Accept", "multipart/form-data")
+		httphelpers.AddQueryParams(r, query)
+		response := server.DoWithAuth(r)
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		return response
+	}
+
+	response := getRecords(map[string]string{
+		"topic-name":  "some-topic",
+		"offset":      "10",
+		"max-records": "2",
+		"key":         "user-1",
+	})
+
+	// Act
+	response = getRecords(map[string]string{
+		"cursor": response.Header.Get(httphandlers.NextCursorHeader),
+	})
+	response = getRecords(map[string]string{
+		"cursor":      response.Header.Get(httphandlers.NextCursorHeader),
+		"max-records": "5",
+	})
+
+	// Assert
+	filter := sebtopic.RecordFilter{Key: []byte("user-1")}
+	expectedCalls := []getRecordsCall{
+		{topicName: "some-topic", offset: 10, maxRecords: 2, filter: filter},
+		{topicName: "some-topic", offset: 13, maxRecords: 2, filter: filter},
+		{topicName: "some-topic", offset: 16, maxRecords: 5, filter: filter},
+	}
+	require.Equal(t, expectedCalls, calls)
+	require.Equal(t, "19", response.Header.Get(httphandlers.NextOffsetHeader))
+}
+
+// TestGetRecordsCursorErrors verifies that http.StatusBadRequest is returned
+// when the cursor query parameter is malformed or contradicts the other query
+// parameters.
+func TestGetRecordsCursorErrors(t *testing.T) {
+	deps := &httphandlers.MockDependencies{}
+	deps.GetRecordsMock = func(ctx context.Context, batch *sebrecords.Batch, topicName string, offset uint64, maxRecords, softMaxBytes int) error {
+		return nil
+	}
+
+	server := tester.HTTPServer(t, tester.HTTPDependencies(deps))
+	defer server.Close()
+
+	r := httptest.NewRequest("GET", "/records?topic-name=some-topic&offset=0", nil)
+	r.Header.Add("Accept", "multipart/form-data")
+	cursor := server.DoWithAuth(r).Header.Get(httphandlers.NextCursorHeader)
+	require.NotEmpty(t, cursor)
+
+	tests := map[string]map[string]string{
+		"not base64":     {"cursor": "!!!"},
+		"not a cursor":   {"cursor": "bm90IGEgY3Vyc29y"},
+		"offset":         {"cursor": cursor, "offset": "0"},
+		"topic mismatch": {"cursor": cursor, "topic-name": "other-topic"},
+	}
+
+	for name, query := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/records", nil)
+			r.Header.Add("Accept", "multipart/form-data")
+			httphelpers.AddQueryParams(r, query)
+
+			// Act
+			response := server.DoWithAuth(r)
+
+			// Assert
+			require.Equal(t, http.StatusBadRequest, response.StatusCode)
+		})
+	}
+	require.Equal(t, 1, len(deps.GetRecordsCalls))
+}
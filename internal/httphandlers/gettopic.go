@@ -2,7 +2,6 @@ package httphandlers
 
 import (
 	"errors"
-	"fmt"
 	"net/http"
 	"time"
 
@@ -17,8 +16,13 @@ type TopicGetter interface {
 }
 
 type GetTopicOutput struct {
-	NextOffset     uint64    `json:"next_offset"`
-	LatestCommitAt time.Time `json:"latest_commit_at"`
+	NextOffset       uint64    `json:"next_offset"`
+	LatestCommitAt   time.Time `json:"latest_commit_at"`
+	LatestProducedAt time.Time `json:"latest_produced_at"`
+	ClockDriftUs     int64     `json:"clock_drift_us"`
+	Sealed           bool      `json:"sealed"`
+
+	Usage TopicUsageOutput `json:"usage"`
 }
 
 // GetTopic returns metadata for a given topic.
@@ -28,8 +32,7 @@ func GetTopic(log logger.Logger, s TopicGetter) http.HandlerFunc {
 
 		params, err := parseQueryParams(r, QParam{topicNameKey, QueryString})
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprint(w, err.Error())
+			httphelpers.WriteError(w, http.StatusBadRequest, err)
 		}
 		topicName := params[topicNameKey].(string)
 
@@ -37,19 +40,22 @@ func GetTopic(log logger.Logger, s TopicGetter) http.HandlerFunc {
 		if err != nil {
 			if errors.Is(err, seberr.ErrTopicNotFound) {
 				log.Debugf("not found")
-				w.WriteHeader(http.StatusNotFound)
+				httphelpers.WriteError(w, http.StatusNotFound, err)
 				return
 			}
 
 			log.Errorf("reading record: %s", err.Error())
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "failed to read metadata for topic '%s': %s", topicName, err)
+			httphelpers.WriteErrorf(w, http.StatusInternalServerError, "failed to read metadata for topic '%s': %w", topicName, err)
 			return
 		}
 
 		httphelpers.WriteJSON(w, &GetTopicOutput{
-			NextOffset:     metadata.NextOffset,
-			LatestCommitAt: metadata.LatestCommitAt,
+			NextOffset:       metadata.NextOffset,
+			LatestCommitAt:   metadata.LatestCommitAt,
+			LatestProducedAt: metadata.LatestProducedAt,
+			ClockDriftUs:     metadata.ClockDrift.Microseconds(),
+			Sealed:           metadata.Sealed,
+			Usage:            makeTopicUsageOutput(metadata.StorageUsage, metadata.CacheUsage),
 		})
 	}
 }
@@ -11,6 +11,7 @@ import (
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
 	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
 	"github.com/stretchr/testify/require"
 )
 
@@ -64,7 +65,8 @@ func TestGetTopicHappyPath(t *testing.T) {
 }
 
 // TestGetTopicNotFound verifies that GET /topic returns the expected status
-// code when fetching topic metadata, both with topic auto creation on and off.
+// code when fetching topic metadata, both with topic auto creation on and off,
+// and that the error response identifies the missing topic by its code.
 func TestGetTopicNotFound(t *testing.T) {
 	r := httptest.NewRequest("GET", "/topic", nil)
 	httphelpers.AddQueryParams(r, map[string]string{
@@ -74,9 +76,10 @@ func TestGetTopicNotFound(t *testing.T) {
 	tests := map[string]struct {
 		autoCreateTopic bool
 		statusCode      int
+		code            string
 	}{
 		"auto create":    {autoCreateTopic: true, statusCode: http.StatusOK},
-		"no auto create": {autoCreateTopic: false, statusCode: http.StatusNotFound},
+		"no auto create": {autoCreateTopic: false, statusCode: http.StatusNotFound, code: seberr.CodeTopicNotFound},
 	}
 	for name, test := range tests {
 		t.Run(name, func(t *testing.T) {
@@ -88,6 +91,13 @@ func TestGetTopicNotFound(t *testing.T) {
 
 			// Assert
 			require.Equal(t, test.statusCode, response.StatusCode)
+			if test.code != "" {
+				output := httphelpers.ErrorOutput{}
+				err := httphelpers.ParseJSONAndClose(response.Body, &output)
+				require.NoError(t, err)
+				require.Equal(t, test.code, output.Code)
+				require.False(t, output.Retryable)
+			}
 		})
 	}
 }
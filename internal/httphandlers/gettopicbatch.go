@@ -0,0 +1,63 @@
+package httphandlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+type TopicBatchInfoGetter interface {
+	BatchInfo(ctx context.Context, topicName string, offset uint64) (sebtopic.BatchInfo, error)
+}
+
+type GetTopicBatchInfoOutput struct {
+	BaseOffset  uint64    `json:"base_offset"`
+	NumRecords  uint64    `json:"num_records"`
+	CommittedAt time.Time `json:"committed_at"`
+	ProducedAt  time.Time `json:"produced_at"`
+}
+
+// GetTopicBatchInfo returns information about the record batch that holds a
+// given offset, including the times at which it was produced and committed.
+func GetTopicBatchInfo(log logger.Logger, s TopicBatchInfoGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		params, err := parseQueryParams(r,
+			QParam{topicNameKey, QueryString},
+			QParam{offsetKey, QueryUint64},
+		)
+		if err != nil {
+			httphelpers.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		topicName := params[topicNameKey].(string)
+		offset := params[offsetKey].(uint64)
+
+		info, err := s.BatchInfo(r.Context(), topicName, offset)
+		if err != nil {
+			if errors.Is(err, seberr.ErrTopicNotFound) || errors.Is(err, seberr.ErrOutOfBounds) {
+				log.Debugf("not found: %s", err)
+				httphelpers.WriteError(w, http.StatusNotFound, err)
+				return
+			}
+
+			log.Errorf("reading batch info: %s", err.Error())
+			httphelpers.WriteErrorf(w, http.StatusInternalServerError, "failed to read batch info of offset %d of topic '%s': %w", offset, topicName, err)
+			return
+		}
+
+		httphelpers.WriteJSON(w, &GetTopicBatchInfoOutput{
+			BaseOffset:  info.BaseOffset,
+			NumRecords:  info.NumRecords,
+			CommittedAt: info.CommittedAt,
+			ProducedAt:  info.ProducedAt,
+		})
+	}
+}
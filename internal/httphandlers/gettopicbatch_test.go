@@ -0,0 +1,99 @@
+package httphandlers_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/httphandlers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetTopicBatchInfoHappyPath verifies that GET /topic/batch returns
+// information about the batch that holds the given offset, including the time
+// given in httphelpers.ProducedAtHeader when adding its records.
+func TestGetTopicBatchInfoHappyPath(t *testing.T) {
+	const topicName = "topic"
+
+	server := tester.HTTPServer(t)
+	defer server.Close()
+
+	producedAt := time.Now().Add(-time.Minute).Truncate(time.Microsecond)
+	for range 2 {
+		batch := tester.MakeRandomRecordBatch(2)
+
+		buf := bytes.NewBuffer(nil)
+		r := httptest.NewRequest("POST", "/records", buf)
+		contentType, err := httphelpers.RecordsToMultipartFormData(buf, batch.Sizes, batch.Data)
+		require.NoError(t, err)
+
+		r.Header.Add("Content-Type", contentType)
+		r.Header.Add(httphelpers.ProducedAtHeader, producedAt.Format(time.RFC3339Nano))
+		httphelpers.AddQueryParams(r, map[string]string{
+			"topic-name": topicName,
+		})
+		response := server.DoWithAuth(r)
+		require.Equal(t, http.StatusCreated, response.StatusCode)
+	}
+
+	expectedInfo, err := server.Broker.BatchInfo(context.Background(), topicName, 3)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest("GET", "/topic/batch", nil)
+	httphelpers.AddQueryParams(r, map[string]string{
+		"topic-name": topicName,
+		"offset":     "3",
+	})
+
+	// Act
+	response := server.DoWithAuth(r)
+
+	// Assert
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	output := httphandlers.GetTopicBatchInfoOutput{}
+	err = httphelpers.ParseJSONAndClose(response.Body, &output)
+	require.NoError(t, err)
+	require.Equal(t, expectedInfo.BaseOffset, output.BaseOffset)
+	require.Equal(t, expectedInfo.NumRecords, output.NumRecords)
+	require.True(t, expectedInfo.CommittedAt.Equal(output.CommittedAt))
+	require.True(t, producedAt.Equal(output.ProducedAt))
+}
+
+// TestGetTopicBatchInfoNotFound verifies that GET /topic/batch returns
+// http.StatusNotFound for offsets and topics that don't exist.
+func TestGetTopicBatchInfoNotFound(t *testing.T) {
+	server := tester.HTTPServer(t, tester.HTTPBrokerAutoCreateTopic(false))
+	defer server.Close()
+
+	tests := map[string]struct {
+		topicName string
+		offset    string
+	}{
+		"topic":  {topicName: "does-not-exist", offset: "0"},
+		"offset": {topicName: "topic", offset: "10"},
+	}
+
+	require.NoError(t, server.Broker.CreateTopic("topic"))
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/topic/batch", nil)
+			httphelpers.AddQueryParams(r, map[string]string{
+				"topic-name": test.topicName,
+				"offset":     test.offset,
+			})
+
+			// Act
+			response := server.DoWithAuth(r)
+
+			// Assert
+			require.Equal(t, http.StatusNotFound, response.StatusCode)
+		})
+	}
+}
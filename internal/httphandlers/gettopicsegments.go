@@ -0,0 +1,98 @@
+package httphandlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+type TopicSegmentsGetter interface {
+	Segments(topicName string) ([]sebtopic.Segment, error)
+	SegmentsWithTraces(ctx context.Context, topicName string) ([]sebtopic.Segment, error)
+}
+
+type TopicSegment struct {
+	BaseOffset uint64 `json:"base_offset"`
+	NumRecords uint64 `json:"num_records"`
+	Size       int64  `json:"size"`
+	StorageKey string `json:"storage_key"`
+
+	Traces []TopicSegmentTrace `json:"traces,omitempty"`
+}
+
+// TopicSegmentTrace is the trace ID of the produce request that added
+// NumRecords records starting at StartOffset.
+type TopicSegmentTrace struct {
+	TraceID     string `json:"trace_id"`
+	StartOffset uint64 `json:"start_offset"`
+	NumRecords  uint64 `json:"num_records"`
+}
+
+type GetTopicSegmentsOutput struct {
+	Segments []TopicSegment `json:"segments"`
+}
+
+// GetTopicSegments returns the record batch files that make up a given topic,
+// allowing external tools to read them directly from backing storage. If the
+// query parameter traces is true, the trace IDs persisted with the records of
+// each segment are returned as well. This requires reading all segments.
+func GetTopicSegments(log logger.Logger, s TopicSegmentsGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		params, err := parseQueryParams(r,
+			QParam{topicNameKey, QueryString},
+			QParam{tracesKey, QueryBoolDefault(false)},
+		)
+		if err != nil {
+			httphelpers.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		topicName := params[topicNameKey].(string)
+
+		var segments []sebtopic.Segment
+		if params[tracesKey].(bool) {
+			segments, err = s.SegmentsWithTraces(r.Context(), topicName)
+		} else {
+			segments, err = s.Segments(topicName)
+		}
+		if err != nil {
+			if errors.Is(err, seberr.ErrTopicNotFound) {
+				log.Debugf("not found")
+				httphelpers.WriteError(w, http.StatusNotFound, err)
+				return
+			}
+
+			log.Errorf("reading segments: %s", err.Error())
+			httphelpers.WriteErrorf(w, http.StatusInternalServerError, "failed to read segments for topic '%s': %w", topicName, err)
+			return
+		}
+
+		output := GetTopicSegmentsOutput{
+			Segments: make([]TopicSegment, 0, len(segments)),
+		}
+		for _, segment := range segments {
+			topicSegment := TopicSegment{
+				BaseOffset: segment.BaseOffset,
+				NumRecords: segment.NumRecords,
+				Size:       segment.Size,
+				StorageKey: segment.Path,
+			}
+			for _, trace := range segment.Traces {
+				topicSegment.Traces = append(topicSegment.Traces, TopicSegmentTrace{
+					TraceID:     trace.ID,
+					StartOffset: segment.BaseOffset + uint64(trace.Start),
+					NumRecords:  uint64(trace.NumRecords),
+				})
+			}
+			output.Segments = append(output.Segments, topicSegment)
+		}
+
+		httphelpers.WriteJSON(w, &output)
+	}
+}
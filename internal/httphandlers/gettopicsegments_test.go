@@ -0,0 +1,133 @@
+package httphandlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/httphandlers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetTopicSegmentsHappyPath verifies that GET /topic/segments returns the
+// segments of the topic.
+func TestGetTopicSegmentsHappyPath(t *testing.T) {
+	expectedSegments := []sebtopic.Segment{
+		{BaseOffset: 0, NumRecords: 10, Size: 1024, Path: "topic/000000000000.record_batch"},
+		{BaseOffset: 10, NumRecords: 5, Size: 512, Path: "topic/000000000010.record_batch"},
+	}
+
+	deps := &httphandlers.MockDependencies{}
+	deps.SegmentsMock = func(topicName string) ([]sebtopic.Segment, error) {
+		return expectedSegments, nil
+	}
+
+	server := tester.HTTPServer(t, tester.HTTPDependencies(deps))
+	defer server.Close()
+
+	r := httptest.NewRequest("GET", "/topic/segments", nil)
+	httphelpers.AddQueryParams(r, map[string]string{
+		"topic-name": "topic",
+	})
+
+	// Act
+	response := server.DoWithAuth(r)
+
+	// Assert
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.Equal(t, "topic", deps.SegmentsCalls[0].TopicName)
+
+	output := httphandlers.GetTopicSegmentsOutput{}
+	err := httphelpers.ParseJSONAndClose(response.Body, &output)
+	require.NoError(t, err)
+
+	require.Equal(t, len(expectedSegments), len(output.Segments))
+	for i, expected := range expectedSegments {
+		got := output.Segments[i]
+		require.Equal(t, expected.BaseOffset, got.BaseOffset)
+		require.Equal(t, expected.NumRecords, got.NumRecords)
+		require.Equal(t, expected.Size, got.Size)
+		require.Equal(t, expected.Path, got.StorageKey)
+	}
+}
+
+// TestGetTopicSegmentsTraces verifies that GET /topic/segments returns the
+// traces of segments, with absolute offsets, only when traces=true is given.
+func TestGetTopicSegmentsTraces(t *testing.T) {
+	deps := &httphandlers.MockDependencies{}
+	deps.SegmentsMock = func(topicName string) ([]sebtopic.Segment, error) {
+		return []sebtopic.Segment{{BaseOffset: 10, NumRecords: 5}}, nil
+	}
+	deps.SegmentsWithTracesMock = func(ctx context.Context, topicName string) ([]sebtopic.Segment, error) {
+		return []sebtopic.Segment{{
+			BaseOffset: 10,
+			NumRecords: 5,
+			Traces:     []sebrecords.Trace{{ID: "trace", Start: 2, NumRecords: 3}},
+		}}, nil
+	}
+
+	server := tester.HTTPServer(t, tester.HTTPDependencies(deps))
+	defer server.Close()
+
+	tests := map[string]struct {
+		traces         string
+		expectedTraces []httphandlers.TopicSegmentTrace
+	}{
+		"default": {traces: "", expectedTraces: nil},
+		"false":   {traces: "false", expectedTraces: nil},
+		"true": {traces: "true", expectedTraces: []httphandlers.TopicSegmentTrace{
+			{TraceID: "trace", StartOffset: 12, NumRecords: 3},
+		}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/topic/segments", nil)
+			httphelpers.AddQueryParams(r, map[string]string{
+				"topic-name": "topic",
+				"traces":     test.traces,
+			})
+
+			// Act
+			response := server.DoWithAuth(r)
+
+			// Assert
+			require.Equal(t, http.StatusOK, response.StatusCode)
+
+			output := httphandlers.GetTopicSegmentsOutput{}
+			err := httphelpers.ParseJSONAndClose(response.Body, &output)
+			require.NoError(t, err)
+			require.Equal(t, 1, len(output.Segments))
+			require.Equal(t, test.expectedTraces, output.Segments[0].Traces)
+		})
+	}
+}
+
+// TestGetTopicSegmentsNotFound verifies that GET /topic/segments returns
+// http.StatusNotFound when the topic does not exist.
+func TestGetTopicSegmentsNotFound(t *testing.T) {
+	deps := &httphandlers.MockDependencies{}
+	deps.SegmentsMock = func(topicName string) ([]sebtopic.Segment, error) {
+		return nil, seberr.ErrTopicNotFound
+	}
+
+	server := tester.HTTPServer(t, tester.HTTPDependencies(deps))
+	defer server.Close()
+
+	r := httptest.NewRequest("GET", "/topic/segments", nil)
+	httphelpers.AddQueryParams(r, map[string]string{
+		"topic-name": "does-not-exist",
+	})
+
+	// Act
+	response := server.DoWithAuth(r)
+
+	// Assert
+	require.Equal(t, http.StatusNotFound, response.StatusCode)
+}
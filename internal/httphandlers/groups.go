@@ -0,0 +1,493 @@
+package httphandlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+const (
+	groupKey          = "group"
+	memberIDKey       = "member-id"
+	sessionTimeoutKey = "session-timeout"
+	assignorKey       = "assignor"
+	resetToKey        = "to"
+	timestampKey      = "timestamp"
+	dryRunKey         = "dry-run"
+)
+
+type GroupOffsetCommitter interface {
+	CommitGroupOffset(ctx context.Context, group string, topicName string, offset uint64) error
+}
+
+type GroupLagGetter interface {
+	GroupNames() []string
+	GroupLag(group string) ([]sebbroker.TopicLag, error)
+}
+
+type StaleGroupsGetter interface {
+	StaleGroups(now time.Time) []sebbroker.StaleGroup
+}
+
+type GroupCoordinator interface {
+	JoinGroup(group string, memberID string, topicNames []string, sessionTimeout time.Duration, assignorName string) (sebbroker.GroupAssignment, error)
+	GroupHeartbeat(group string, memberID string) (sebbroker.GroupAssignment, error)
+	LeaveGroup(group string, memberID string) error
+}
+
+type GroupPauser interface {
+	PauseGroup(ctx context.Context, group string, topicName string) error
+	ResumeGroup(ctx context.Context, group string, topicName string) error
+	GroupPaused(group string, topicName string) bool
+	GroupOffsets(group string) (sebbroker.GroupOffsets, error)
+}
+
+type GroupOffsetResetter interface {
+	ResetGroupOffsets(ctx context.Context, group string, reset sebbroker.OffsetReset) ([]sebbroker.TopicLag, error)
+}
+
+// CommitGroupOffset commits the offset of the next record of a topic that a
+// consumer group will process.
+func CommitGroupOffset(log logger.Logger, s GroupOffsetCommitter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		params, err := parseQueryParams(r,
+			QParam{topicNameKey, QueryString},
+			QParam{offsetKey, QueryUint64},
+		)
+		if err != nil {
+			httphelpers.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		group := r.PathValue(groupKey)
+		topicName := params[topicNameKey].(string)
+		offset := params[offsetKey].(uint64)
+
+		err = s.CommitGroupOffset(r.Context(), group, topicName, offset)
+		if err != nil {
+			statusCode := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, seberr.ErrTopicNotFound):
+				statusCode = http.StatusNotFound
+			case errors.Is(err, seberr.ErrOutOfBounds):
+				statusCode = http.StatusRequestedRangeNotSatisfiable
+			case errors.Is(err, seberr.ErrBadInput):
+				statusCode = http.StatusBadRequest
+			default:
+				log.Errorf("committing offset of group '%s': %s", group, err)
+			}
+			httphelpers.WriteError(w, statusCode, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+type TopicLagOutput struct {
+	TopicName       string `json:"topic_name"`
+	CommittedOffset uint64 `json:"committed_offset"`
+	NextOffset      uint64 `json:"next_offset"`
+	Lag             uint64 `json:"lag"`
+}
+
+type GetGroupLagOutput struct {
+	Group    string           `json:"group"`
+	Topics   []TopicLagOutput `json:"topics"`
+	TotalLag uint64           `json:"total_lag"`
+}
+
+// GetGroupLag returns the lag of a consumer group on each of the topics that
+// it has committed offsets for, i.e. the number of records that have been
+// added to the topics after its committed offsets.
+func GetGroupLag(log logger.Logger, s GroupLagGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		group := r.PathValue(groupKey)
+		lags, err := s.GroupLag(group)
+		if err != nil {
+			if errors.Is(err, seberr.ErrNotFound) {
+				httphelpers.WriteError(w, http.StatusNotFound, err)
+				return
+			}
+
+			log.Errorf("getting lag of group '%s': %s", group, err)
+			httphelpers.WriteErrorf(w, http.StatusInternalServerError, "failed to get lag of group '%s': %w", group, err)
+			return
+		}
+
+		output := GetGroupLagOutput{
+			Group:  group,
+			Topics: make([]TopicLagOutput, 0, len(lags)),
+		}
+		for _, lag := range lags {
+			output.Topics = append(output.Topics, TopicLagOutput(lag))
+			output.TotalLag += lag.Lag
+		}
+
+		httphelpers.WriteJSON(w, &output)
+	}
+}
+
+type GroupAssignmentOutput struct {
+	MemberID         string   `json:"member_id"`
+	Generation       uint64   `json:"generation"`
+	TopicNames       []string `json:"topic_names"`
+	PausedTopicNames []string `json:"paused_topic_names"`
+	Assignor         string   `json:"assignor"`
+}
+
+func newGroupAssignmentOutput(assignment sebbroker.GroupAssignment) GroupAssignmentOutput {
+	output := GroupAssignmentOutput(assignment)
+	if output.TopicNames == nil {
+		output.TopicNames = []string{}
+	}
+	if output.PausedTopicNames == nil {
+		output.PausedTopicNames = []string{}
+	}
+	return output
+}
+
+// JoinGroup makes the client a member of a consumer group, consuming the
+// topics given by the repeated topic-name query parameter, and returns the
+// topics assigned to it. Clients that don't give a member-id are given a new
+// one, which they must use for heartbeats and when rejoining. The client that
+// creates the group may choose its assignor.
+func JoinGroup(log logger.Logger, s GroupCoordinator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		params, err := parseQueryParams(r,
+			QParam{memberIDKey, QueryStringDefault("")},
+			QParam{sessionTimeoutKey, QueryDurationDefault(0)},
+			QParam{assignorKey, QueryStringDefault("")},
+		)
+		if err != nil {
+			httphelpers.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		group := r.PathValue(groupKey)
+		memberID := params[memberIDKey].(string)
+		sessionTimeout := params[sessionTimeoutKey].(time.Duration)
+		assignorName := params[assignorKey].(string)
+		topicNames := r.URL.Query()[topicNameKey]
+
+		assignment, err := s.JoinGroup(group, memberID, topicNames, sessionTimeout, assignorName)
+		if err != nil {
+			if errors.Is(err, seberr.ErrBadInput) {
+				httphelpers.WriteError(w, http.StatusBadRequest, err)
+				return
+			}
+
+			log.Errorf("joining group '%s': %s", group, err)
+			httphelpers.WriteErrorf(w, http.StatusInternalServerError, "failed to join group '%s': %w", group, err)
+			return
+		}
+
+		output := newGroupAssignmentOutput(assignment)
+		httphelpers.WriteJSON(w, &output)
+	}
+}
+
+// GroupHeartbeat keeps the client's membership of a consumer group alive, and
+// returns the topics assigned to it in the group's current generation.
+// 404 Not Found is returned if the client isn't a member of the group, e.g.
+// because its session timed out; it must then rejoin the group.
+func GroupHeartbeat(log logger.Logger, s GroupCoordinator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		params, err := parseQueryParams(r, QParam{memberIDKey, QueryString})
+		if err != nil {
+			httphelpers.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		group := r.PathValue(groupKey)
+		memberID := params[memberIDKey].(string)
+
+		assignment, err := s.GroupHeartbeat(group, memberID)
+		if err != nil {
+			if errors.Is(err, seberr.ErrNotFound) {
+				httphelpers.WriteError(w, http.StatusNotFound, err)
+				return
+			}
+
+			log.Errorf("heartbeat of member '%s' of group '%s': %s", memberID, group, err)
+			httphelpers.WriteErrorf(w, http.StatusInternalServerError, "failed to heartbeat group '%s': %w", group, err)
+			return
+		}
+
+		output := newGroupAssignmentOutput(assignment)
+		httphelpers.WriteJSON(w, &output)
+	}
+}
+
+// LeaveGroup removes the client from a consumer group, so that its topics are
+// assigned to the remaining members right away.
+func LeaveGroup(log logger.Logger, s GroupCoordinator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		params, err := parseQueryParams(r, QParam{memberIDKey, QueryString})
+		if err != nil {
+			httphelpers.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		group := r.PathValue(groupKey)
+		memberID := params[memberIDKey].(string)
+
+		err = s.LeaveGroup(group, memberID)
+		if err != nil {
+			if errors.Is(err, seberr.ErrNotFound) {
+				httphelpers.WriteError(w, http.StatusNotFound, err)
+				return
+			}
+
+			log.Errorf("member '%s' leaving group '%s': %s", memberID, group, err)
+			httphelpers.WriteErrorf(w, http.StatusInternalServerError, "failed to leave group '%s': %w", group, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+type StaleGroupOutput struct {
+	Group    string    `json:"group"`
+	ActiveAt time.Time `json:"active_at"`
+}
+
+type ListStaleGroupsOutput struct {
+	Groups []StaleGroupOutput `json:"groups"`
+}
+
+// ListStaleGroups returns the consumer groups that haven't been active for
+// longer than the broker's maximum idle time, i.e. the groups that will be
+// removed when stale groups are next expired. Nothing is removed.
+func ListStaleGroups(log logger.Logger, s StaleGroupsGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		staleGroups := s.StaleGroups(time.Now())
+
+		output := ListStaleGroupsOutput{
+			Groups: make([]StaleGroupOutput, 0, len(staleGroups)),
+		}
+		for _, staleGroup := range staleGroups {
+			output.Groups = append(output.Groups, StaleGroupOutput(staleGroup))
+		}
+
+		httphelpers.WriteJSON(w, &output)
+	}
+}
+
+// writeGroupLagMetrics writes the committed offsets and lag of all consumer
+// groups in the Prometheus text exposition format, labelled by group and
+// topic.
+func writeGroupLagMetrics(log logger.Logger, w io.Writer, s GroupLagGetter) {
+	groupLags := map[string][]sebbroker.TopicLag{}
+	groupNames := s.GroupNames()
+	for _, group := range groupNames {
+		lags, err := s.GroupLag(group)
+		if err != nil {
+			// the group may have been removed since listing groups
+			log.Warnf("getting lag of group '%s': %s", group, err)
+			continue
+		}
+		groupLags[group] = lags
+	}
+
+	metrics := []struct {
+		name  string
+		help  string
+		value func(sebbroker.TopicLag) uint64
+	}{
+		{"seb_group_lag", "Number of records added to the topic after the offset committed by the consumer group.", func(lag sebbroker.TopicLag) uint64 { return lag.Lag }},
+		{"seb_group_committed_offset", "Offset committed by the consumer group.", func(lag sebbroker.TopicLag) uint64 { return lag.CommittedOffset }},
+	}
+	for _, metric := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", metric.name, metric.help)
+		fmt.Fprintf(w, "# TYPE %s gauge\n", metric.name)
+		for _, group := range groupNames {
+			for _, lag := range groupLags[group] {
+				fmt.Fprintf(w, "%s{group=%q,topic=%q} %d\n", metric.name, group, lag.TopicName, metric.value(lag))
+			}
+		}
+	}
+}
+
+// PauseGroup pauses delivery of records to a consumer group, e.g. while a
+// downstream system can't receive them. Only the topic given by topic-name is
+// paused if it's given, otherwise all topics are. Reads made on behalf of the
+// group are rejected with 423 Locked until it's resumed.
+func PauseGroup(log logger.Logger, s GroupPauser) http.HandlerFunc {
+	return setGroupPaused(log, s.PauseGroup, "pausing")
+}
+
+// ResumeGroup resumes delivery of records to a consumer group that was paused
+// using PauseGroup. Only the topic given by topic-name is resumed if it's
+// given, otherwise all topics are.
+func ResumeGroup(log logger.Logger, s GroupPauser) http.HandlerFunc {
+	return setGroupPaused(log, s.ResumeGroup, "resuming")
+}
+
+func setGroupPaused(log logger.Logger, set func(ctx context.Context, group string, topicName string) error, action string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		params, err := parseQueryParams(r, QParam{topicNameKey, QueryStringDefault("")})
+		if err != nil {
+			httphelpers.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		group := r.PathValue(groupKey)
+		topicName := params[topicNameKey].(string)
+
+		err = set(r.Context(), group, topicName)
+		if err != nil {
+			if errors.Is(err, seberr.ErrBadInput) {
+				httphelpers.WriteError(w, http.StatusBadRequest, err)
+				return
+			}
+
+			log.Errorf("%s group '%s': %s", action, group, err)
+			httphelpers.WriteErrorf(w, http.StatusInternalServerError, "failed %s group '%s': %w", action, group, err)
+			return
+		}
+
+		log.Infof("%s group '%s' (topic '%s')", action, group, topicName)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+type GetGroupPauseOutput struct {
+	Group        string   `json:"group"`
+	Paused       bool     `json:"paused"`
+	PausedTopics []string `json:"paused_topics"`
+}
+
+// GetGroupPause returns whether delivery of records to a consumer group is
+// paused, for all topics or for individual topics.
+func GetGroupPause(log logger.Logger, s GroupPauser) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		group := r.PathValue(groupKey)
+		output := GetGroupPauseOutput{
+			Group:        group,
+			PausedTopics: []string{},
+		}
+
+		groupOffsets, err := s.GroupOffsets(group)
+		if err != nil && !errors.Is(err, seberr.ErrNotFound) {
+			log.Errorf("getting group '%s': %s", group, err)
+			httphelpers.WriteErrorf(w, http.StatusInternalServerError, "failed to get group '%s': %w", group, err)
+			return
+		}
+		if err == nil {
+			output.Paused = groupOffsets.Paused
+			output.PausedTopics = append(output.PausedTopics, groupOffsets.PausedTopics...)
+		}
+
+		httphelpers.WriteJSON(w, &output)
+	}
+}
+
+type ResetGroupOffsetsOutput struct {
+	Group    string           `json:"group"`
+	DryRun   bool             `json:"dry_run"`
+	Topics   []TopicLagOutput `json:"topics"`
+	TotalLag uint64           `json:"total_lag"`
+}
+
+// ResetGroupOffsets resets the offsets committed by a consumer group to the
+// earliest or latest offsets of its topics, to the offset given by offset or
+// to the first records committed at or after timestamp, as selected by the to
+// query parameter. Only the topics given by the repeated topic-name query
+// parameter are reset if it's given, otherwise all of the group's topics are.
+// The group's resulting lag is returned; offsets are only committed if
+// dry-run isn't true.
+func ResetGroupOffsets(log logger.Logger, s GroupOffsetResetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		params, err := parseQueryParams(r,
+			QParam{resetToKey, QueryString},
+			QParam{offsetKey, QueryUint64Default(0)},
+			QParam{timestampKey, QueryTimeOptional},
+			QParam{dryRunKey, QueryBoolDefault(false)},
+		)
+		if err != nil {
+			httphelpers.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		group := r.PathValue(groupKey)
+		reset := sebbroker.OffsetReset{
+			To:         sebbroker.OffsetResetTarget(params[resetToKey].(string)),
+			Offset:     params[offsetKey].(uint64),
+			Timestamp:  params[timestampKey].(time.Time),
+			TopicNames: r.URL.Query()[topicNameKey],
+			DryRun:     params[dryRunKey].(bool),
+		}
+
+		lags, err := s.ResetGroupOffsets(r.Context(), group, reset)
+		if err != nil {
+			statusCode := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, seberr.ErrNotFound), errors.Is(err, seberr.ErrTopicNotFound):
+				statusCode = http.StatusNotFound
+			case errors.Is(err, seberr.ErrOutOfBounds):
+				statusCode = http.StatusRequestedRangeNotSatisfiable
+			case errors.Is(err, seberr.ErrBadInput):
+				statusCode = http.StatusBadRequest
+			default:
+				log.Errorf("resetting offsets of group '%s': %s", group, err)
+			}
+			httphelpers.WriteError(w, statusCode, err)
+			return
+		}
+
+		output := ResetGroupOffsetsOutput{
+			Group:  group,
+			DryRun: reset.DryRun,
+			Topics: make([]TopicLagOutput, 0, len(lags)),
+		}
+		for _, lag := range lags {
+			output.Topics = append(output.Topics, TopicLagOutput(lag))
+			output.TotalLag += lag.Lag
+		}
+
+		httphelpers.WriteJSON(w, &output)
+	}
+}
+
+// rejectPausedGroup rejects the request with 423 Locked if it's made on
+// behalf of a consumer group, given by the group query parameter, whose
+// delivery of records of topicName is paused. It returns true if the request
+// may continue. Requests are never rejected if s doesn't implement
+// GroupPauser.
+func rejectPausedGroup(log logger.Logger, w http.ResponseWriter, r *http.Request, s any, topicName string) bool {
+	group := r.URL.Query().Get(groupKey)
+	pauser, ok := s.(GroupPauser)
+	if group == "" || !ok {
+		return true
+	}
+
+	if pauser.GroupPaused(group, topicName) {
+		log.Debugf("group '%s' is paused for topic '%s'", group, topicName)
+		httphelpers.WriteErrorf(w, http.StatusLocked, "%s: group '%s', topic '%s'", seberr.ErrGroupPaused, group, topicName)
+		return false
+	}
+
+	return true
+}
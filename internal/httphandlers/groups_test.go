@@ -0,0 +1,360 @@
+package httphandlers_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/httphandlers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGroupLag verifies that offsets committed using PUT
+// /groups/{group}/offset are used to compute the lag returned by GET
+// /groups/{group}/lag and exposed on GET /metrics.
+func TestGroupLag(t *testing.T) {
+	const (
+		group     = "group"
+		topicName = "topic"
+	)
+
+	server := tester.HTTPServer(t)
+	defer server.Close()
+
+	_, err := server.Broker.AddRecords(topicName, tester.MakeRandomRecordBatch(5))
+	require.NoError(t, err)
+
+	r := httptest.NewRequest("PUT", "/groups/"+group+"/offset", nil)
+	httphelpers.AddQueryParams(r, map[string]string{
+		"topic-name": topicName,
+		"offset":     "2",
+	})
+
+	// Act
+	response := server.DoWithAuth(r)
+
+	// Assert
+	require.Equal(t, http.StatusNoContent, response.StatusCode)
+
+	response = server.DoWithAuth(httptest.NewRequest("GET", "/groups/"+group+"/lag", nil))
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	output := httphandlers.GetGroupLagOutput{}
+	err = httphelpers.ParseJSONAndClose(response.Body, &output)
+	require.NoError(t, err)
+	require.Equal(t, httphandlers.GetGroupLagOutput{
+		Group: group,
+		Topics: []httphandlers.TopicLagOutput{
+			{TopicName: topicName, CommittedOffset: 2, NextOffset: 5, Lag: 3},
+		},
+		TotalLag: 3,
+	}, output)
+
+	response = server.DoWithAuth(httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	bs, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(bs), `seb_group_lag{group="group",topic="topic"} 3`)
+	require.Contains(t, string(bs), `seb_group_committed_offset{group="group",topic="topic"} 2`)
+}
+
+// TestGroupOffsetErrors verifies that the group endpoints return the expected
+// status codes when offsets can't be committed or the group is unknown.
+func TestGroupOffsetErrors(t *testing.T) {
+	tests := map[string]struct {
+		method     string
+		path       string
+		params     map[string]string
+		statusCode int
+	}{
+		"commit, unknown topic": {
+			method:     "PUT",
+			path:       "/groups/group/offset",
+			params:     map[string]string{"topic-name": "unknown", "offset": "0"},
+			statusCode: http.StatusNotFound,
+		},
+		"commit, past end": {
+			method:     "PUT",
+			path:       "/groups/group/offset",
+			params:     map[string]string{"topic-name": "topic", "offset": "2"},
+			statusCode: http.StatusRequestedRangeNotSatisfiable,
+		},
+		"commit, missing offset": {
+			method:     "PUT",
+			path:       "/groups/group/offset",
+			params:     map[string]string{"topic-name": "topic"},
+			statusCode: http.StatusBadRequest,
+		},
+		"lag, unknown group": {
+			method:     "GET",
+			path:       "/groups/unknown/lag",
+			statusCode: http.StatusNotFound,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := tester.HTTPServer(t)
+			defer server.Close()
+
+			_, err := server.Broker.AddRecords("topic", tester.MakeRandomRecordBatch(1))
+			require.NoError(t, err)
+
+			r := httptest.NewRequest(test.method, test.path, nil)
+			httphelpers.AddQueryParams(r, test.params)
+
+			// Act
+			response := server.DoWithAuth(r)
+
+			// Assert
+			require.Equal(t, test.statusCode, response.StatusCode)
+		})
+	}
+}
+
+// TestListStaleGroups verifies that GET /admin/groups/stale returns the stale
+// groups reported by the broker.
+func TestListStaleGroups(t *testing.T) {
+	activeAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	deps := &httphandlers.MockDependencies{}
+	deps.StaleGroupsMock = func(now time.Time) []sebbroker.StaleGroup {
+		return []sebbroker.StaleGroup{{Group: "group", ActiveAt: activeAt}}
+	}
+
+	server := tester.HTTPServer(t, tester.HTTPDependencies(deps))
+	defer server.Close()
+
+	// Act
+	response := server.DoWithAuth(httptest.NewRequest("GET", "/admin/groups/stale", nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	output := httphandlers.ListStaleGroupsOutput{}
+	err := httphelpers.ParseJSONAndClose(response.Body, &output)
+	require.NoError(t, err)
+	require.Equal(t, []httphandlers.StaleGroupOutput{{Group: "group", ActiveAt: activeAt}}, output.Groups)
+	require.Len(t, deps.StaleGroupsCalls, 1)
+}
+
+// TestGroupMembership verifies that members joining a group using POST
+// /groups/{group}/join are assigned its topics, that POST
+// /groups/{group}/heartbeat returns their current assignment, and that POST
+// /groups/{group}/leave removes them.
+func TestGroupMembership(t *testing.T) {
+	const group = "group"
+
+	server := tester.HTTPServer(t)
+	defer server.Close()
+
+	join := func(memberID string) httphandlers.GroupAssignmentOutput {
+		r := httptest.NewRequest("POST", "/groups/"+group+"/join?topic-name=t1&topic-name=t2&member-id="+memberID, nil)
+		response := server.DoWithAuth(r)
+		require.Equal(t, http.StatusOK, response.StatusCode)
+
+		output := httphandlers.GroupAssignmentOutput{}
+		err := httphelpers.ParseJSONAndClose(response.Body, &output)
+		require.NoError(t, err)
+		return output
+	}
+	heartbeat := func(memberID string) *http.Response {
+		return server.DoWithAuth(httptest.NewRequest("POST", "/groups/"+group+"/heartbeat?member-id="+memberID, nil))
+	}
+
+	// Act
+	a := join("a")
+	b := join("b")
+
+	// Assert
+	require.Equal(t, httphandlers.GroupAssignmentOutput{MemberID: "b", Generation: 2, TopicNames: []string{"t2"}, PausedTopicNames: []string{}, Assignor: "range"}, b)
+
+	response := heartbeat("a")
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	err := httphelpers.ParseJSONAndClose(response.Body, &a)
+	require.NoError(t, err)
+	require.Equal(t, httphandlers.GroupAssignmentOutput{MemberID: "a", Generation: 2, TopicNames: []string{"t1"}, PausedTopicNames: []string{}, Assignor: "range"}, a)
+
+	// Act
+	response = server.DoWithAuth(httptest.NewRequest("POST", "/groups/"+group+"/leave?member-id=a", nil))
+
+	// Assert
+	require.Equal(t, http.StatusNoContent, response.StatusCode)
+	require.Equal(t, http.StatusNotFound, heartbeat("a").StatusCode)
+
+	response = heartbeat("b")
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	err = httphelpers.ParseJSONAndClose(response.Body, &b)
+	require.NoError(t, err)
+	require.Equal(t, httphandlers.GroupAssignmentOutput{MemberID: "b", Generation: 3, TopicNames: []string{"t1", "t2"}, PausedTopicNames: []string{}, Assignor: "range"}, b)
+}
+
+// TestGroupMembershipErrors verifies that the group membership endpoints
+// return the expected status codes for invalid requests.
+func TestGroupMembershipErrors(t *testing.T) {
+	tests := map[string]struct {
+		path       string
+		statusCode int
+	}{
+		"join, no topics":           {path: "/groups/group/join", statusCode: http.StatusBadRequest},
+		"join, unknown assignor":    {path: "/groups/group/join?topic-name=t&assignor=unknown", statusCode: http.StatusBadRequest},
+		"heartbeat, no member id":   {path: "/groups/group/heartbeat", statusCode: http.StatusBadRequest},
+		"heartbeat, unknown member": {path: "/groups/group/heartbeat?member-id=unknown", statusCode: http.StatusNotFound},
+		"leave, unknown member":     {path: "/groups/group/leave?member-id=unknown", statusCode: http.StatusNotFound},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := tester.HTTPServer(t)
+			defer server.Close()
+
+			// Act
+			response := server.DoWithAuth(httptest.NewRequest("POST", test.path, nil))
+
+			// Assert
+			require.Equal(t, test.statusCode, response.StatusCode)
+		})
+	}
+}
+
+// TestPauseGroup verifies that reads made on behalf of a paused consumer
+// group are rejected with 423 Locked until the group is resumed, and that the
+// pause is reported by GET /admin/groups/{group}/pause and in assignments.
+func TestPauseGroup(t *testing.T) {
+	const group = "group"
+
+	server := tester.HTTPServer(t)
+	defer server.Close()
+
+	for _, topicName := range []string{"t1", "t2"} {
+		_, err := server.Broker.AddRecords(topicName, tester.MakeRandomRecordBatch(1))
+		require.NoError(t, err)
+	}
+
+	getRecord := func(topicName string) int {
+		r := httptest.NewRequest("GET", "/record", nil)
+		httphelpers.AddQueryParams(r, map[string]string{
+			"topic-name": topicName,
+			"offset":     "0",
+			"group":      group,
+		})
+		return server.DoWithAuth(r).StatusCode
+	}
+
+	// Act
+	response := server.DoWithAuth(httptest.NewRequest("PUT", "/admin/groups/"+group+"/pause?topic-name=t1", nil))
+
+	// Assert
+	require.Equal(t, http.StatusNoContent, response.StatusCode)
+	require.Equal(t, http.StatusLocked, getRecord("t1"))
+	require.Equal(t, http.StatusOK, getRecord("t2"))
+
+	r := httptest.NewRequest("GET", "/records", nil)
+	r.Header.Set("Accept", "multipart/form-data")
+	httphelpers.AddQueryParams(r, map[string]string{"topic-name": "t1", "offset": "0", "group": group})
+	require.Equal(t, http.StatusLocked, server.DoWithAuth(r).StatusCode)
+
+	response = server.DoWithAuth(httptest.NewRequest("GET", "/admin/groups/"+group+"/pause", nil))
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	output := httphandlers.GetGroupPauseOutput{}
+	err := httphelpers.ParseJSONAndClose(response.Body, &output)
+	require.NoError(t, err)
+	require.Equal(t, httphandlers.GetGroupPauseOutput{Group: group, PausedTopics: []string{"t1"}}, output)
+
+	response = server.DoWithAuth(httptest.NewRequest("POST", "/groups/"+group+"/join?topic-name=t1&topic-name=t2&member-id=a", nil))
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	assignment := httphandlers.GroupAssignmentOutput{}
+	err = httphelpers.ParseJSONAndClose(response.Body, &assignment)
+	require.NoError(t, err)
+	require.Equal(t, []string{"t1"}, assignment.PausedTopicNames)
+
+	// Act
+	response = server.DoWithAuth(httptest.NewRequest("PUT", "/admin/groups/"+group+"/pause", nil))
+
+	// Assert
+	require.Equal(t, http.StatusNoContent, response.StatusCode)
+	require.Equal(t, http.StatusLocked, getRecord("t2"))
+
+	// Act
+	response = server.DoWithAuth(httptest.NewRequest("PUT", "/admin/groups/"+group+"/resume", nil))
+
+	// Assert
+	require.Equal(t, http.StatusNoContent, response.StatusCode)
+	require.Equal(t, http.StatusOK, getRecord("t1"))
+	require.Equal(t, http.StatusOK, getRecord("t2"))
+}
+
+// TestResetGroupOffsets verifies that PUT /admin/groups/{group}/offsets/reset
+// returns the group's resulting lag, only commits the offsets if it's not a
+// dry run, and returns the expected status codes for bad requests.
+func TestResetGroupOffsets(t *testing.T) {
+	const group = "group"
+
+	server := tester.HTTPServer(t)
+	defer server.Close()
+
+	_, err := server.Broker.AddRecords("topic", tester.MakeRandomRecordBatch(5))
+	require.NoError(t, err)
+	err = server.Broker.CommitGroupOffset(context.Background(), group, "topic", 4)
+	require.NoError(t, err)
+
+	expectedTopics := []httphandlers.TopicLagOutput{
+		{TopicName: "topic", CommittedOffset: 1, NextOffset: 5, Lag: 4},
+	}
+
+	// Act
+	response := server.DoWithAuth(httptest.NewRequest("PUT", "/admin/groups/"+group+"/offsets/reset?to=offset&offset=1&dry-run=true", nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	output := httphandlers.ResetGroupOffsetsOutput{}
+	err = httphelpers.ParseJSONAndClose(response.Body, &output)
+	require.NoError(t, err)
+	require.Equal(t, httphandlers.ResetGroupOffsetsOutput{Group: group, DryRun: true, Topics: expectedTopics, TotalLag: 4}, output)
+
+	groupOffsets, err := server.Broker.GroupOffsets(group)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), groupOffsets.Offsets["topic"])
+
+	// Act
+	response = server.DoWithAuth(httptest.NewRequest("PUT", "/admin/groups/"+group+"/offsets/reset?to=offset&offset=1&topic-name=topic", nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	output = httphandlers.ResetGroupOffsetsOutput{}
+	err = httphelpers.ParseJSONAndClose(response.Body, &output)
+	require.NoError(t, err)
+	require.Equal(t, httphandlers.ResetGroupOffsetsOutput{Group: group, Topics: expectedTopics, TotalLag: 4}, output)
+
+	groupOffsets, err = server.Broker.GroupOffsets(group)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), groupOffsets.Offsets["topic"])
+
+	tests := map[string]struct {
+		url        string
+		statusCode int
+	}{
+		"no target":       {url: "/admin/groups/" + group + "/offsets/reset", statusCode: http.StatusBadRequest},
+		"unknown target":  {url: "/admin/groups/" + group + "/offsets/reset?to=somewhere", statusCode: http.StatusBadRequest},
+		"bad timestamp":   {url: "/admin/groups/" + group + "/offsets/reset?to=timestamp&timestamp=yesterday", statusCode: http.StatusBadRequest},
+		"offset past end": {url: "/admin/groups/" + group + "/offsets/reset?to=offset&offset=6", statusCode: http.StatusRequestedRangeNotSatisfiable},
+		"unknown group":   {url: "/admin/groups/other/offsets/reset?to=earliest", statusCode: http.StatusNotFound},
+		"unknown topic":   {url: "/admin/groups/" + group + "/offsets/reset?to=earliest&topic-name=missing", statusCode: http.StatusNotFound},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			response := server.DoWithAuth(httptest.NewRequest("PUT", test.url, nil))
+
+			// Assert
+			require.Equal(t, test.statusCode, response.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package httphandlers
+
+import (
+	"net/http"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+)
+
+// requireInternalTopicAccess returns whether r is allowed to modify the
+// topics topicNames, i.e. whether none of them are internal topics or r has
+// admin access. If not, a 403 response is written.
+func requireInternalTopicAccess(log logger.Logger, w http.ResponseWriter, r *http.Request, topicNames ...string) bool {
+	if accessFromContext(r.Context()).Admin {
+		return true
+	}
+
+	for _, topicName := range topicNames {
+		if sebbroker.IsInternalTopic(topicName) {
+			log.Infof("not allowed to modify internal topic '%s'", topicName)
+			httphelpers.WriteErrorf(w, http.StatusForbidden, "topic '%s' is internal and can only be modified by admins", topicName)
+			return false
+		}
+	}
+
+	return true
+}
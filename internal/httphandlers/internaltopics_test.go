@@ -0,0 +1,181 @@
+package httphandlers_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/httphandlers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/stretchr/testify/require"
+)
+
+// TestInternalTopicsProtected verifies that internal topics can only be
+// produced to, created, deleted and aliased by requests with admin access,
+// and that other topics are unaffected.
+func TestInternalTopicsProtected(t *testing.T) {
+	const adminAPIKey = "admin-api-key"
+
+	tests := map[string]struct {
+		method     string
+		path       string
+		query      map[string]string
+		apiKey     string
+		statusCode int
+	}{
+		"produce": {
+			method:     "POST",
+			path:       "/records",
+			query:      map[string]string{"topic-name": "_audit"},
+			apiKey:     tester.DefaultAPIKey,
+			statusCode: http.StatusForbidden,
+		},
+		"produce, admin": {
+			method:     "POST",
+			path:       "/records",
+			query:      map[string]string{"topic-name": "_audit"},
+			apiKey:     adminAPIKey,
+			statusCode: http.StatusCreated,
+		},
+		"produce, other topic": {
+			method:     "POST",
+			path:       "/records",
+			query:      map[string]string{"topic-name": "audit"},
+			apiKey:     tester.DefaultAPIKey,
+			statusCode: http.StatusCreated,
+		},
+		"create": {
+			method:     "POST",
+			path:       "/topic",
+			query:      map[string]string{"topic-name": "_schemas"},
+			apiKey:     tester.DefaultAPIKey,
+			statusCode: http.StatusForbidden,
+		},
+		"create, admin": {
+			method:     "POST",
+			path:       "/topic",
+			query:      map[string]string{"topic-name": "_schemas"},
+			apiKey:     adminAPIKey,
+			statusCode: http.StatusCreated,
+		},
+		"delete": {
+			method:     "DELETE",
+			path:       "/topic",
+			query:      map[string]string{"topic-name": "_offsets"},
+			apiKey:     tester.DefaultAPIKey,
+			statusCode: http.StatusForbidden,
+		},
+		"delete, admin": {
+			method:     "DELETE",
+			path:       "/topic",
+			query:      map[string]string{"topic-name": "_offsets"},
+			apiKey:     adminAPIKey,
+			statusCode: http.StatusNoContent,
+		},
+		"alias internal topic": {
+			method:     "PUT",
+			path:       "/admin/topic/alias",
+			query:      map[string]string{"alias": "offsets", "topic-name": "_offsets"},
+			apiKey:     tester.DefaultAPIKey,
+			statusCode: http.StatusForbidden,
+		},
+		"internal alias": {
+			method:     "PUT",
+			path:       "/admin/topic/alias",
+			query:      map[string]string{"alias": "_alias", "topic-name": "audit"},
+			apiKey:     tester.DefaultAPIKey,
+			statusCode: http.StatusForbidden,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := tester.HTTPServer(t, tester.HTTPAuthenticators(httphandlers.NewAdminAPIKeyAuthenticator(adminAPIKey)))
+			defer server.Close()
+
+			_, err := server.Broker.AddRecords("_offsets", tester.MakeRandomRecordBatch(1))
+			require.NoError(t, err)
+
+			var r *http.Request
+			if test.method == "POST" && test.path == "/records" {
+				batch := tester.MakeRandomRecordBatch(1)
+				buf := bytes.NewBuffer(nil)
+				contentType, err := httphelpers.RecordsToMultipartFormData(buf, batch.Sizes, batch.Data)
+				require.NoError(t, err)
+				r = httptest.NewRequest(test.method, test.path, buf)
+				r.Header.Set("Content-Type", contentType)
+			} else {
+				r = httptest.NewRequest(test.method, test.path, nil)
+			}
+			r.Header.Set(httphelpers.APIKeyHeader, test.apiKey)
+			httphelpers.AddQueryParams(r, test.query)
+
+			// Act
+			response := server.Do(r)
+
+			// Assert
+			require.Equal(t, test.statusCode, response.StatusCode)
+		})
+	}
+}
+
+// TestInternalTopicsHidden verifies that internal topics are hidden from
+// GET /topics, unless requested by a request with admin access, and that they
+// can't be read using API key grants that don't explicitly allow them.
+func TestInternalTopicsHidden(t *testing.T) {
+	const (
+		adminAPIKey = "admin-api-key"
+		grantAPIKey = "grant-api-key"
+	)
+
+	server := tester.HTTPServer(t,
+		tester.HTTPAuthenticators(httphandlers.NewAdminAPIKeyAuthenticator(adminAPIKey)),
+		tester.HTTPAPIKeyGrants(httphandlers.APIKeyGrant{APIKey: grantAPIKey}),
+	)
+	defer server.Close()
+
+	for _, topicName := range []string{"_audit", "topic"} {
+		_, err := server.Broker.AddRecords(topicName, tester.MakeRandomRecordBatch(1))
+		require.NoError(t, err)
+	}
+
+	listTopics := func(apiKey string, internal bool) (int, []string) {
+		r := httptest.NewRequest("GET", "/topics", nil)
+		r.Header.Set(httphelpers.APIKeyHeader, apiKey)
+		if internal {
+			httphelpers.AddQueryParams(r, map[string]string{"internal": "true"})
+		}
+
+		response := server.Do(r)
+		if response.StatusCode != http.StatusOK {
+			return response.StatusCode, nil
+		}
+
+		output := httphandlers.ListTopicsOutput{}
+		err := httphelpers.ParseJSONAndClose(response.Body, &output)
+		require.NoError(t, err)
+		return response.StatusCode, output.TopicNames
+	}
+
+	// Act, Assert
+	statusCode, topicNames := listTopics(tester.DefaultAPIKey, false)
+	require.Equal(t, http.StatusOK, statusCode)
+	require.Equal(t, []string{"topic"}, topicNames)
+
+	statusCode, _ = listTopics(tester.DefaultAPIKey, true)
+	require.Equal(t, http.StatusForbidden, statusCode)
+
+	statusCode, topicNames = listTopics(adminAPIKey, true)
+	require.Equal(t, http.StatusOK, statusCode)
+	require.Equal(t, []string{"_audit", "topic"}, topicNames)
+
+	for topicName, expectedStatusCode := range map[string]int{"topic": http.StatusOK, "_audit": http.StatusForbidden} {
+		r := httptest.NewRequest("GET", "/record", nil)
+		r.Header.Set(httphelpers.APIKeyHeader, grantAPIKey)
+		httphelpers.AddQueryParams(r, map[string]string{"topic-name": topicName, "offset": "0"})
+		response := server.Do(r)
+		require.Equal(t, expectedStatusCode, response.StatusCode)
+	}
+}
@@ -0,0 +1,60 @@
+package httphandlers
+
+import (
+	"net/http"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+)
+
+type LogLeveler interface {
+	Level() logger.LogLevel
+	Set(level logger.LogLevel)
+}
+
+type LogLevelInput struct {
+	Level string `json:"level"`
+}
+
+type LogLevelOutput struct {
+	Level string `json:"level"`
+}
+
+// GetLogLevel returns the current log level.
+func GetLogLevel(log logger.Logger, s LogLeveler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		httphelpers.WriteJSON(w, &LogLevelOutput{
+			Level: s.Level().String(),
+		})
+	}
+}
+
+// SetLogLevel sets the log level, making it possible to e.g. enable debug
+// logging of a running broker without restarting it.
+func SetLogLevel(log logger.Logger, s LogLeveler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		input := LogLevelInput{}
+		err := httphelpers.ParseJSONAndClose(r.Body, &input)
+		if err != nil {
+			httphelpers.WriteErrorf(w, http.StatusBadRequest, "parsing json body: %w", err)
+			return
+		}
+
+		level, err := logger.ParseLevel(input.Level)
+		if err != nil {
+			httphelpers.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		log.Infof("setting log level: %s", level)
+		s.Set(level)
+
+		httphelpers.WriteJSON(w, &LogLevelOutput{
+			Level: s.Level().String(),
+		})
+	}
+}
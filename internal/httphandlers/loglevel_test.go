@@ -0,0 +1,57 @@
+package httphandlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/httphandlers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSetLogLevel verifies that PUT /admin/log-level changes the log level,
+// and that GET /admin/log-level returns it.
+func TestSetLogLevel(t *testing.T) {
+	server := tester.HTTPServer(t)
+	defer server.Close()
+
+	for _, level := range []logger.LogLevel{logger.LevelDebug, logger.LevelWarn} {
+		r := httptest.NewRequest("PUT", "/admin/log-level", jsonBody(t, httphandlers.LogLevelInput{Level: level.String()}))
+
+		// Act
+		response := server.DoWithAuth(r)
+
+		// Assert
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		require.Equal(t, level, server.LogLevel.Level())
+
+		response = server.DoWithAuth(httptest.NewRequest("GET", "/admin/log-level", nil))
+		require.Equal(t, http.StatusOK, response.StatusCode)
+
+		output := httphandlers.LogLevelOutput{}
+		err := httphelpers.ParseJSONAndClose(response.Body, &output)
+		require.NoError(t, err)
+		require.Equal(t, level.String(), output.Level)
+	}
+}
+
+// TestSetLogLevelInvalid verifies that PUT /admin/log-level returns
+// http.StatusBadRequest and doesn't change the log level when given an unknown
+// log level.
+func TestSetLogLevelInvalid(t *testing.T) {
+	server := tester.HTTPServer(t)
+	defer server.Close()
+
+	expectedLevel := server.LogLevel.Level()
+	r := httptest.NewRequest("PUT", "/admin/log-level", jsonBody(t, httphandlers.LogLevelInput{Level: "verbose"}))
+
+	// Act
+	response := server.DoWithAuth(r)
+
+	// Assert
+	require.Equal(t, http.StatusBadRequest, response.StatusCode)
+	require.Equal(t, expectedLevel, server.LogLevel.Level())
+}
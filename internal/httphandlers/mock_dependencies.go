@@ -3,50 +3,184 @@ package httphandlers
 import (
 	"context"
 	"fmt"
+	"time"
 
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
 	"github.com/micvbang/simple-event-broker/internal/sebrecords"
 	"github.com/micvbang/simple-event-broker/internal/sebtopic"
 )
 
 type MockDependencies struct {
-	AddRecordsMock  func(topicName string, batch sebrecords.Batch) ([]uint64, error)
-	AddRecordsCalls []dependenciesAddRecordsCall
+	AddRecordsResultMock  func(ctx context.Context, topicName string, batch sebrecords.Batch) (sebbroker.AddResult, error)
+	AddRecordsResultCalls []dependenciesAddRecordsResultCall
 
-	GetRecordMock  func(batch *sebrecords.Batch, topicName string, offset uint64) ([]byte, error)
+	GetRecordMock  func(ctx context.Context, batch *sebrecords.Batch, topicName string, offset uint64) ([]byte, error)
 	GetRecordCalls []dependenciesGetRecordCall
 
 	GetRecordsMock  func(ctx context.Context, batch *sebrecords.Batch, topicName string, offset uint64, maxRecords int, softMaxBytes int) error
 	GetRecordsCalls []dependenciesGetRecordsCall
 
+	GetRecordsNonBlockingMock  func(ctx context.Context, batch *sebrecords.Batch, topicName string, offset uint64, maxRecords int, softMaxBytes int) (uint64, error)
+	GetRecordsNonBlockingCalls []dependenciesGetRecordsNonBlockingCall
+
+	SampleRecordsMock  func(ctx context.Context, batch *sebrecords.Batch, topicName string, input sebtopic.SampleInput) ([]uint64, error)
+	SampleRecordsCalls []dependenciesSampleRecordsCall
+
+	BatchInfoMock  func(ctx context.Context, topicName string, offset uint64) (sebtopic.BatchInfo, error)
+	BatchInfoCalls []dependenciesBatchInfoCall
+
+	CreateTopicMock  func(topicName string) error
+	CreateTopicCalls []dependenciesCreateTopicCall
+
+	DeleteTopicMock  func(topicName string) error
+	DeleteTopicCalls []dependenciesDeleteTopicCall
+
+	SealTopicMock  func(topicName string) (uint64, error)
+	SealTopicCalls []dependenciesSealTopicCall
+
+	ProvisionTopicsMock  func(specs []sebbroker.TopicSpec, opts sebbroker.ProvisionOpts) (sebbroker.ProvisionResult, error)
+	ProvisionTopicsCalls []dependenciesProvisionTopicsCall
+
+	TopicNamesMock  func() []string
+	TopicNamesCalls []dependenciesTopicNamesCall
+
+	MatchTopicsMock  func(pattern string, labels map[string]string) ([]string, error)
+	MatchTopicsCalls []dependenciesMatchTopicsCall
+
+	SetTopicRetentionMock  func(topicName string, retention time.Duration)
+	SetTopicRetentionCalls []dependenciesSetTopicRetentionCall
+
+	SetTopicLabelsMock  func(topicName string, labels map[string]string)
+	SetTopicLabelsCalls []dependenciesSetTopicLabelsCall
+
 	MetadataMock  func(topicName string) (sebtopic.Metadata, error)
 	MetadataCalls []dependenciesMetadataCall
+
+	WatchMock  func(ctx context.Context, optFuncs ...func(*sebbroker.WatchOpts)) <-chan sebbroker.TopicEvent
+	WatchCalls []dependenciesWatchCall
+
+	SegmentsMock  func(topicName string) ([]sebtopic.Segment, error)
+	SegmentsCalls []dependenciesSegmentsCall
+
+	SegmentsWithTracesMock  func(ctx context.Context, topicName string) ([]sebtopic.Segment, error)
+	SegmentsWithTracesCalls []dependenciesSegmentsWithTracesCall
+
+	SetMaintenanceModeMock  func(enabled bool)
+	SetMaintenanceModeCalls []dependenciesSetMaintenanceModeCall
+
+	MaintenanceModeMock  func() bool
+	MaintenanceModeCalls []dependenciesMaintenanceModeCall
+
+	SetTopicWritesFrozenMock  func(topicName string, frozen bool)
+	SetTopicWritesFrozenCalls []dependenciesSetTopicWritesFrozenCall
+
+	WritesFrozenMock  func(topicName string) bool
+	WritesFrozenCalls []dependenciesWritesFrozenCall
+
+	SetTopicAliasMock  func(ctx context.Context, alias string, topicName string) error
+	SetTopicAliasCalls []dependenciesSetTopicAliasCall
+
+	RemoveTopicAliasMock  func(ctx context.Context, alias string) error
+	RemoveTopicAliasCalls []dependenciesRemoveTopicAliasCall
+
+	TopicAliasesMock  func() map[string]string
+	TopicAliasesCalls []dependenciesTopicAliasesCall
+
+	SnapshotMock  func(ctx context.Context) (sebbroker.Snapshot, error)
+	SnapshotCalls []dependenciesSnapshotCall
+
+	UsageMock  func() map[string]sebbroker.TopicUsage
+	UsageCalls []dependenciesUsageCall
+
+	QuotaUsageMock  func() []sebbroker.QuotaUsage
+	QuotaUsageCalls []dependenciesQuotaUsageCall
+
+	DedupStatsMock  func() sebbroker.DedupStats
+	DedupStatsCalls []dependenciesDedupStatsCall
+
+	CommitGroupOffsetMock  func(ctx context.Context, group string, topicName string, offset uint64) error
+	CommitGroupOffsetCalls []dependenciesCommitGroupOffsetCall
+
+	GroupNamesMock  func() []string
+	GroupNamesCalls []dependenciesGroupNamesCall
+
+	GroupLagMock  func(group string) ([]sebbroker.TopicLag, error)
+	GroupLagCalls []dependenciesGroupLagCall
+
+	StaleGroupsMock  func(now time.Time) []sebbroker.StaleGroup
+	StaleGroupsCalls []dependenciesStaleGroupsCall
+
+	JoinGroupMock  func(group string, memberID string, topicNames []string, sessionTimeout time.Duration, assignorName string) (sebbroker.GroupAssignment, error)
+	JoinGroupCalls []dependenciesJoinGroupCall
+
+	GroupHeartbeatMock  func(group string, memberID string) (sebbroker.GroupAssignment, error)
+	GroupHeartbeatCalls []dependenciesGroupHeartbeatCall
+
+	LeaveGroupMock  func(group string, memberID string) error
+	LeaveGroupCalls []dependenciesLeaveGroupCall
+
+	PauseGroupMock  func(ctx context.Context, group string, topicName string) error
+	PauseGroupCalls []dependenciesPauseGroupCall
+
+	ResumeGroupMock  func(ctx context.Context, group string, topicName string) error
+	ResumeGroupCalls []dependenciesResumeGroupCall
+
+	GroupPausedMock  func(group string, topicName string) bool
+	GroupPausedCalls []dependenciesGroupPausedCall
+
+	GroupOffsetsMock  func(group string) (sebbroker.GroupOffsets, error)
+	GroupOffsetsCalls []dependenciesGroupOffsetsCall
+
+	ResetGroupOffsetsMock  func(ctx context.Context, group string, reset sebbroker.OffsetReset) ([]sebbroker.TopicLag, error)
+	ResetGroupOffsetsCalls []dependenciesResetGroupOffsetsCall
+
+	CreateReplayMock  func(name string, topicName string, opts sebbroker.ReplayOpts) (sebbroker.Replay, error)
+	CreateReplayCalls []dependenciesCreateReplayCall
+
+	ReadReplayMock  func(ctx context.Context, batch *sebrecords.Batch, name string, maxRecords int, softMaxBytes int) (sebbroker.Replay, error)
+	ReadReplayCalls []dependenciesReadReplayCall
+
+	GetReplayMock  func(name string) (sebbroker.Replay, error)
+	GetReplayCalls []dependenciesGetReplayCall
+
+	ReplaysMock  func() []sebbroker.Replay
+	ReplaysCalls []dependenciesReplaysCall
+
+	DeleteReplayMock  func(name string) error
+	DeleteReplayCalls []dependenciesDeleteReplayCall
+
+	RefreshRecordBatchMock  func(ctx context.Context, key string) error
+	RefreshRecordBatchCalls []dependenciesRefreshRecordBatchCall
 }
 
-type dependenciesAddRecordsCall struct {
+type dependenciesAddRecordsResultCall struct {
+	Ctx       context.Context
 	TopicName string
 	Batch     sebrecords.Batch
 
-	Out0 []uint64
+	Out0 sebbroker.AddResult
 	Out1 error
 }
 
-func (_v *MockDependencies) AddRecords(topicName string, batch sebrecords.Batch) ([]uint64, error) {
-	if _v.AddRecordsMock == nil {
-		msg := fmt.Sprintf("call to %T.AddRecords, but MockAddRecords is not set", _v)
+func (_v *MockDependencies) AddRecordsResult(ctx context.Context, topicName string, batch sebrecords.Batch) (sebbroker.AddResult, error) {
+	if _v.AddRecordsResultMock == nil {
+		msg := fmt.Sprintf("call to %T.AddRecordsResult, but MockAddRecordsResult is not set", _v)
 		panic(msg)
 	}
 
-	_v.AddRecordsCalls = append(_v.AddRecordsCalls, dependenciesAddRecordsCall{
+	_v.AddRecordsResultCalls = append(_v.AddRecordsResultCalls, dependenciesAddRecordsResultCall{
+		Ctx:       ctx,
 		TopicName: topicName,
 		Batch:     batch,
 	})
-	out0, out1 := _v.AddRecordsMock(topicName, batch)
-	_v.AddRecordsCalls[len(_v.AddRecordsCalls)-1].Out0 = out0
-	_v.AddRecordsCalls[len(_v.AddRecordsCalls)-1].Out1 = out1
+	out0, out1 := _v.AddRecordsResultMock(ctx, topicName, batch)
+	_v.AddRecordsResultCalls[len(_v.AddRecordsResultCalls)-1].Out0 = out0
+	_v.AddRecordsResultCalls[len(_v.AddRecordsResultCalls)-1].Out1 = out1
 	return out0, out1
 }
 
 type dependenciesGetRecordCall struct {
+	Ctx       context.Context
 	Batch     *sebrecords.Batch
 	TopicName string
 	Offset    uint64
@@ -55,18 +189,19 @@ type dependenciesGetRecordCall struct {
 	Out1 error
 }
 
-func (_v *MockDependencies) GetRecord(batch *sebrecords.Batch, topicName string, offset uint64) ([]byte, error) {
+func (_v *MockDependencies) GetRecord(ctx context.Context, batch *sebrecords.Batch, topicName string, offset uint64) ([]byte, error) {
 	if _v.GetRecordMock == nil {
 		msg := fmt.Sprintf("call to %T.GetRecord, but MockGetRecord is not set", _v)
 		panic(msg)
 	}
 
 	_v.GetRecordCalls = append(_v.GetRecordCalls, dependenciesGetRecordCall{
+		Ctx:       ctx,
 		Batch:     batch,
 		TopicName: topicName,
 		Offset:    offset,
 	})
-	out0, out1 := _v.GetRecordMock(batch, topicName, offset)
+	out0, out1 := _v.GetRecordMock(ctx, batch, topicName, offset)
 	_v.GetRecordCalls[len(_v.GetRecordCalls)-1].Out0 = out0
 	_v.GetRecordCalls[len(_v.GetRecordCalls)-1].Out1 = out1
 	return out0, out1
@@ -102,6 +237,66 @@ func (_v *MockDependencies) GetRecords(ctx context.Context, batch *sebrecords.Ba
 	return out0
 }
 
+type dependenciesGetRecordsNonBlockingCall struct {
+	Ctx          context.Context
+	Batch        *sebrecords.Batch
+	TopicName    string
+	Offset       uint64
+	MaxRecords   int
+	SoftMaxBytes int
+
+	Out0 uint64
+	Out1 error
+}
+
+func (_v *MockDependencies) GetRecordsNonBlocking(ctx context.Context, batch *sebrecords.Batch, topicName string, offset uint64, maxRecords int, softMaxBytes int) (uint64, error) {
+	if _v.GetRecordsNonBlockingMock == nil {
+		msg := fmt.Sprintf("call to %T.GetRecordsNonBlocking, but MockGetRecordsNonBlocking is not set", _v)
+		panic(msg)
+	}
+
+	_v.GetRecordsNonBlockingCalls = append(_v.GetRecordsNonBlockingCalls, dependenciesGetRecordsNonBlockingCall{
+		Ctx:          ctx,
+		Batch:        batch,
+		TopicName:    topicName,
+		Offset:       offset,
+		MaxRecords:   maxRecords,
+		SoftMaxBytes: softMaxBytes,
+	})
+	out0, out1 := _v.GetRecordsNonBlockingMock(ctx, batch, topicName, offset, maxRecords, softMaxBytes)
+	_v.GetRecordsNonBlockingCalls[len(_v.GetRecordsNonBlockingCalls)-1].Out0 = out0
+	_v.GetRecordsNonBlockingCalls[len(_v.GetRecordsNonBlockingCalls)-1].Out1 = out1
+	return out0, out1
+}
+
+type dependenciesSampleRecordsCall struct {
+	Ctx       context.Context
+	Batch     *sebrecords.Batch
+	TopicName string
+	Input     sebtopic.SampleInput
+
+	Out0 []uint64
+	Out1 error
+}
+
+func (_v *MockDependencies) SampleRecords(ctx context.Context, batch *sebrecords.Batch, topicName string, input sebtopic.SampleInput) ([]uint64, error) {
+	if _v.SampleRecordsMock == nil {
+		msg := fmt.Sprintf("call to %T.SampleRecords, but MockSampleRecords is not set", _v)
+		panic(msg)
+	}
+
+	_v.SampleRecordsCalls = append(_v.SampleRecordsCalls, dependenciesSampleRecordsCall{
+		Ctx:       ctx,
+		Batch:     batch,
+		TopicName: topicName,
+		Input:     input,
+	})
+	out0, out1 := _v.SampleRecordsMock(ctx, batch, topicName, input)
+	_v.SampleRecordsCalls[len(_v.SampleRecordsCalls)-1].Out0 = out0
+	_v.SampleRecordsCalls[len(_v.SampleRecordsCalls)-1].Out1 = out1
+	return out0, out1
+}
+
 type dependenciesMetadataCall struct {
 	TopicName string
 
@@ -123,3 +318,874 @@ func (_v *MockDependencies) Metadata(topicName string) (sebtopic.Metadata, error
 	_v.MetadataCalls[len(_v.MetadataCalls)-1].Out1 = out1
 	return out0, out1
 }
+
+type dependenciesWatchCall struct {
+	Ctx      context.Context
+	OptFuncs []func(*sebbroker.WatchOpts)
+
+	Out0 <-chan sebbroker.TopicEvent
+}
+
+func (_v *MockDependencies) Watch(ctx context.Context, optFuncs ...func(*sebbroker.WatchOpts)) <-chan sebbroker.TopicEvent {
+	if _v.WatchMock == nil {
+		msg := fmt.Sprintf("call to %T.Watch, but MockWatch is not set", _v)
+		panic(msg)
+	}
+
+	_v.WatchCalls = append(_v.WatchCalls, dependenciesWatchCall{
+		Ctx:      ctx,
+		OptFuncs: optFuncs,
+	})
+	out0 := _v.WatchMock(ctx, optFuncs...)
+	_v.WatchCalls[len(_v.WatchCalls)-1].Out0 = out0
+	return out0
+}
+
+type dependenciesSegmentsCall struct {
+	TopicName string
+
+	Out0 []sebtopic.Segment
+	Out1 error
+}
+
+func (_v *MockDependencies) Segments(topicName string) ([]sebtopic.Segment, error) {
+	if _v.SegmentsMock == nil {
+		msg := fmt.Sprintf("call to %T.Segments, but MockSegments is not set", _v)
+		panic(msg)
+	}
+
+	_v.SegmentsCalls = append(_v.SegmentsCalls, dependenciesSegmentsCall{
+		TopicName: topicName,
+	})
+	out0, out1 := _v.SegmentsMock(topicName)
+	_v.SegmentsCalls[len(_v.SegmentsCalls)-1].Out0 = out0
+	_v.SegmentsCalls[len(_v.SegmentsCalls)-1].Out1 = out1
+	return out0, out1
+}
+
+type dependenciesSegmentsWithTracesCall struct {
+	Ctx       context.Context
+	TopicName string
+
+	Out0 []sebtopic.Segment
+	Out1 error
+}
+
+func (_v *MockDependencies) SegmentsWithTraces(ctx context.Context, topicName string) ([]sebtopic.Segment, error) {
+	if _v.SegmentsWithTracesMock == nil {
+		msg := fmt.Sprintf("call to %T.SegmentsWithTraces, but MockSegmentsWithTraces is not set", _v)
+		panic(msg)
+	}
+
+	_v.SegmentsWithTracesCalls = append(_v.SegmentsWithTracesCalls, dependenciesSegmentsWithTracesCall{
+		Ctx:       ctx,
+		TopicName: topicName,
+	})
+	out0, out1 := _v.SegmentsWithTracesMock(ctx, topicName)
+	_v.SegmentsWithTracesCalls[len(_v.SegmentsWithTracesCalls)-1].Out0 = out0
+	_v.SegmentsWithTracesCalls[len(_v.SegmentsWithTracesCalls)-1].Out1 = out1
+	return out0, out1
+}
+
+type dependenciesSetMaintenanceModeCall struct {
+	Enabled bool
+}
+
+func (_v *MockDependencies) SetMaintenanceMode(enabled bool) {
+	if _v.SetMaintenanceModeMock == nil {
+		msg := fmt.Sprintf("call to %T.SetMaintenanceMode, but MockSetMaintenanceMode is not set", _v)
+		panic(msg)
+	}
+
+	_v.SetMaintenanceModeCalls = append(_v.SetMaintenanceModeCalls, dependenciesSetMaintenanceModeCall{
+		Enabled: enabled,
+	})
+	_v.SetMaintenanceModeMock(enabled)
+}
+
+type dependenciesMaintenanceModeCall struct {
+	Out0 bool
+}
+
+func (_v *MockDependencies) MaintenanceMode() bool {
+	if _v.MaintenanceModeMock == nil {
+		msg := fmt.Sprintf("call to %T.MaintenanceMode, but MockMaintenanceMode is not set", _v)
+		panic(msg)
+	}
+
+	_v.MaintenanceModeCalls = append(_v.MaintenanceModeCalls, dependenciesMaintenanceModeCall{})
+	out0 := _v.MaintenanceModeMock()
+	_v.MaintenanceModeCalls[len(_v.MaintenanceModeCalls)-1].Out0 = out0
+	return out0
+}
+
+type dependenciesSetTopicWritesFrozenCall struct {
+	TopicName string
+	Frozen    bool
+}
+
+func (_v *MockDependencies) SetTopicWritesFrozen(topicName string, frozen bool) {
+	if _v.SetTopicWritesFrozenMock == nil {
+		msg := fmt.Sprintf("call to %T.SetTopicWritesFrozen, but MockSetTopicWritesFrozen is not set", _v)
+		panic(msg)
+	}
+
+	_v.SetTopicWritesFrozenCalls = append(_v.SetTopicWritesFrozenCalls, dependenciesSetTopicWritesFrozenCall{
+		TopicName: topicName,
+		Frozen:    frozen,
+	})
+	_v.SetTopicWritesFrozenMock(topicName, frozen)
+}
+
+type dependenciesWritesFrozenCall struct {
+	TopicName string
+
+	Out0 bool
+}
+
+func (_v *MockDependencies) WritesFrozen(topicName string) bool {
+	if _v.WritesFrozenMock == nil {
+		msg := fmt.Sprintf("call to %T.WritesFrozen, but MockWritesFrozen is not set", _v)
+		panic(msg)
+	}
+
+	_v.WritesFrozenCalls = append(_v.WritesFrozenCalls, dependenciesWritesFrozenCall{
+		TopicName: topicName,
+	})
+	out0 := _v.WritesFrozenMock(topicName)
+	_v.WritesFrozenCalls[len(_v.WritesFrozenCalls)-1].Out0 = out0
+	return out0
+}
+
+type dependenciesBatchInfoCall struct {
+	Ctx       context.Context
+	TopicName string
+	Offset    uint64
+
+	Out0 sebtopic.BatchInfo
+	Out1 error
+}
+
+func (_v *MockDependencies) BatchInfo(ctx context.Context, topicName string, offset uint64) (sebtopic.BatchInfo, error) {
+	if _v.BatchInfoMock == nil {
+		msg := fmt.Sprintf("call to %T.BatchInfo, but MockBatchInfo is not set", _v)
+		panic(msg)
+	}
+
+	_v.BatchInfoCalls = append(_v.BatchInfoCalls, dependenciesBatchInfoCall{
+		Ctx:       ctx,
+		TopicName: topicName,
+		Offset:    offset,
+	})
+	out0, out1 := _v.BatchInfoMock(ctx, topicName, offset)
+	_v.BatchInfoCalls[len(_v.BatchInfoCalls)-1].Out0 = out0
+	_v.BatchInfoCalls[len(_v.BatchInfoCalls)-1].Out1 = out1
+	return out0, out1
+}
+
+type dependenciesCreateTopicCall struct {
+	TopicName string
+
+	Out0 error
+}
+
+func (_v *MockDependencies) CreateTopic(topicName string) error {
+	if _v.CreateTopicMock == nil {
+		msg := fmt.Sprintf("call to %T.CreateTopic, but MockCreateTopic is not set", _v)
+		panic(msg)
+	}
+
+	_v.CreateTopicCalls = append(_v.CreateTopicCalls, dependenciesCreateTopicCall{
+		TopicName: topicName,
+	})
+	out0 := _v.CreateTopicMock(topicName)
+	_v.CreateTopicCalls[len(_v.CreateTopicCalls)-1].Out0 = out0
+	return out0
+}
+
+type dependenciesDeleteTopicCall struct {
+	TopicName string
+
+	Out0 error
+}
+
+func (_v *MockDependencies) DeleteTopic(topicName string) error {
+	if _v.DeleteTopicMock == nil {
+		msg := fmt.Sprintf("call to %T.DeleteTopic, but MockDeleteTopic is not set", _v)
+		panic(msg)
+	}
+
+	_v.DeleteTopicCalls = append(_v.DeleteTopicCalls, dependenciesDeleteTopicCall{
+		TopicName: topicName,
+	})
+	out0 := _v.DeleteTopicMock(topicName)
+	_v.DeleteTopicCalls[len(_v.DeleteTopicCalls)-1].Out0 = out0
+	return out0
+}
+
+type dependenciesProvisionTopicsCall struct {
+	Specs []sebbroker.TopicSpec
+	Opts  sebbroker.ProvisionOpts
+
+	Out0 sebbroker.ProvisionResult
+	Out1 error
+}
+
+func (_v *MockDependencies) ProvisionTopics(specs []sebbroker.TopicSpec, opts sebbroker.ProvisionOpts) (sebbroker.ProvisionResult, error) {
+	if _v.ProvisionTopicsMock == nil {
+		msg := fmt.Sprintf("call to %T.ProvisionTopics, but MockProvisionTopics is not set", _v)
+		panic(msg)
+	}
+
+	_v.ProvisionTopicsCalls = append(_v.ProvisionTopicsCalls, dependenciesProvisionTopicsCall{
+		Specs: specs,
+		Opts:  opts,
+	})
+	out0, out1 := _v.ProvisionTopicsMock(specs, opts)
+	_v.ProvisionTopicsCalls[len(_v.ProvisionTopicsCalls)-1].Out0 = out0
+	_v.ProvisionTopicsCalls[len(_v.ProvisionTopicsCalls)-1].Out1 = out1
+	return out0, out1
+}
+
+type dependenciesSealTopicCall struct {
+	TopicName string
+
+	Out0 uint64
+	Out1 error
+}
+
+func (_v *MockDependencies) SealTopic(topicName string) (uint64, error) {
+	if _v.SealTopicMock == nil {
+		msg := fmt.Sprintf("call to %T.SealTopic, but MockSealTopic is not set", _v)
+		panic(msg)
+	}
+
+	_v.SealTopicCalls = append(_v.SealTopicCalls, dependenciesSealTopicCall{
+		TopicName: topicName,
+	})
+	out0, out1 := _v.SealTopicMock(topicName)
+	_v.SealTopicCalls[len(_v.SealTopicCalls)-1].Out0 = out0
+	_v.SealTopicCalls[len(_v.SealTopicCalls)-1].Out1 = out1
+	return out0, out1
+}
+
+type dependenciesTopicNamesCall struct {
+	Out0 []string
+}
+
+func (_v *MockDependencies) TopicNames() []string {
+	if _v.TopicNamesMock == nil {
+		msg := fmt.Sprintf("call to %T.TopicNames, but MockTopicNames is not set", _v)
+		panic(msg)
+	}
+
+	_v.TopicNamesCalls = append(_v.TopicNamesCalls, dependenciesTopicNamesCall{})
+	out0 := _v.TopicNamesMock()
+	_v.TopicNamesCalls[len(_v.TopicNamesCalls)-1].Out0 = out0
+	return out0
+}
+
+type dependenciesMatchTopicsCall struct {
+	Pattern string
+	Labels  map[string]string
+
+	Out0 []string
+	Out1 error
+}
+
+func (_v *MockDependencies) MatchTopics(pattern string, labels map[string]string) ([]string, error) {
+	if _v.MatchTopicsMock == nil {
+		msg := fmt.Sprintf("call to %T.MatchTopics, but MockMatchTopics is not set", _v)
+		panic(msg)
+	}
+
+	_v.MatchTopicsCalls = append(_v.MatchTopicsCalls, dependenciesMatchTopicsCall{
+		Pattern: pattern,
+		Labels:  labels,
+	})
+	out0, out1 := _v.MatchTopicsMock(pattern, labels)
+	_v.MatchTopicsCalls[len(_v.MatchTopicsCalls)-1].Out0 = out0
+	_v.MatchTopicsCalls[len(_v.MatchTopicsCalls)-1].Out1 = out1
+	return out0, out1
+}
+
+type dependenciesSetTopicRetentionCall struct {
+	TopicName string
+	Retention time.Duration
+}
+
+func (_v *MockDependencies) SetTopicRetention(topicName string, retention time.Duration) {
+	if _v.SetTopicRetentionMock == nil {
+		msg := fmt.Sprintf("call to %T.SetTopicRetention, but MockSetTopicRetention is not set", _v)
+		panic(msg)
+	}
+
+	_v.SetTopicRetentionCalls = append(_v.SetTopicRetentionCalls, dependenciesSetTopicRetentionCall{
+		TopicName: topicName,
+		Retention: retention,
+	})
+	_v.SetTopicRetentionMock(topicName, retention)
+}
+
+type dependenciesSetTopicLabelsCall struct {
+	TopicName string
+	Labels    map[string]string
+}
+
+func (_v *MockDependencies) SetTopicLabels(topicName string, labels map[string]string) {
+	if _v.SetTopicLabelsMock == nil {
+		msg := fmt.Sprintf("call to %T.SetTopicLabels, but MockSetTopicLabels is not set", _v)
+		panic(msg)
+	}
+
+	_v.SetTopicLabelsCalls = append(_v.SetTopicLabelsCalls, dependenciesSetTopicLabelsCall{
+		TopicName: topicName,
+		Labels:    labels,
+	})
+	_v.SetTopicLabelsMock(topicName, labels)
+}
+
+type dependenciesSetTopicAliasCall struct {
+	Ctx       context.Context
+	Alias     string
+	TopicName string
+
+	Out0 error
+}
+
+func (_v *MockDependencies) SetTopicAlias(ctx context.Context, alias string, topicName string) error {
+	if _v.SetTopicAliasMock == nil {
+		msg := fmt.Sprintf("call to %T.SetTopicAlias, but MockSetTopicAlias is not set", _v)
+		panic(msg)
+	}
+
+	_v.SetTopicAliasCalls = append(_v.SetTopicAliasCalls, dependenciesSetTopicAliasCall{
+		Ctx:       ctx,
+		Alias:     alias,
+		TopicName: topicName,
+	})
+	out0 := _v.SetTopicAliasMock(ctx, alias, topicName)
+	_v.SetTopicAliasCalls[len(_v.SetTopicAliasCalls)-1].Out0 = out0
+	return out0
+}
+
+type dependenciesRemoveTopicAliasCall struct {
+	Ctx   context.Context
+	Alias string
+
+	Out0 error
+}
+
+func (_v *MockDependencies) RemoveTopicAlias(ctx context.Context, alias string) error {
+	if _v.RemoveTopicAliasMock == nil {
+		msg := fmt.Sprintf("call to %T.RemoveTopicAlias, but MockRemoveTopicAlias is not set", _v)
+		panic(msg)
+	}
+
+	_v.RemoveTopicAliasCalls = append(_v.RemoveTopicAliasCalls, dependenciesRemoveTopicAliasCall{
+		Ctx:   ctx,
+		Alias: alias,
+	})
+	out0 := _v.RemoveTopicAliasMock(ctx, alias)
+	_v.RemoveTopicAliasCalls[len(_v.RemoveTopicAliasCalls)-1].Out0 = out0
+	return out0
+}
+
+type dependenciesTopicAliasesCall struct {
+	Out0 map[string]string
+}
+
+func (_v *MockDependencies) TopicAliases() map[string]string {
+	if _v.TopicAliasesMock == nil {
+		msg := fmt.Sprintf("call to %T.TopicAliases, but MockTopicAliases is not set", _v)
+		panic(msg)
+	}
+
+	_v.TopicAliasesCalls = append(_v.TopicAliasesCalls, dependenciesTopicAliasesCall{})
+	out0 := _v.TopicAliasesMock()
+	_v.TopicAliasesCalls[len(_v.TopicAliasesCalls)-1].Out0 = out0
+	return out0
+}
+
+type dependenciesSnapshotCall struct {
+	Ctx  context.Context
+	Out0 sebbroker.Snapshot
+	Out1 error
+}
+
+func (_v *MockDependencies) Snapshot(ctx context.Context) (sebbroker.Snapshot, error) {
+	if _v.SnapshotMock == nil {
+		msg := fmt.Sprintf("call to %T.Snapshot, but MockSnapshot is not set", _v)
+		panic(msg)
+	}
+
+	_v.SnapshotCalls = append(_v.SnapshotCalls, dependenciesSnapshotCall{
+		Ctx: ctx,
+	})
+	out0, out1 := _v.SnapshotMock(ctx)
+	_v.SnapshotCalls[len(_v.SnapshotCalls)-1].Out0 = out0
+	_v.SnapshotCalls[len(_v.SnapshotCalls)-1].Out1 = out1
+	return out0, out1
+}
+
+type dependenciesUsageCall struct {
+	Out0 map[string]sebbroker.TopicUsage
+}
+
+func (_v *MockDependencies) Usage() map[string]sebbroker.TopicUsage {
+	if _v.UsageMock == nil {
+		msg := fmt.Sprintf("call to %T.Usage, but MockUsage is not set", _v)
+		panic(msg)
+	}
+
+	_v.UsageCalls = append(_v.UsageCalls, dependenciesUsageCall{})
+	out0 := _v.UsageMock()
+	_v.UsageCalls[len(_v.UsageCalls)-1].Out0 = out0
+	return out0
+}
+
+type dependenciesQuotaUsageCall struct {
+	Out0 []sebbroker.QuotaUsage
+}
+
+func (_v *MockDependencies) QuotaUsage() []sebbroker.QuotaUsage {
+	if _v.QuotaUsageMock == nil {
+		msg := fmt.Sprintf("call to %T.QuotaUsage, but MockQuotaUsage is not set", _v)
+		panic(msg)
+	}
+
+	_v.QuotaUsageCalls = append(_v.QuotaUsageCalls, dependenciesQuotaUsageCall{})
+	out0 := _v.QuotaUsageMock()
+	_v.QuotaUsageCalls[len(_v.QuotaUsageCalls)-1].Out0 = out0
+	return out0
+}
+
+type dependenciesDedupStatsCall struct {
+	Out0 sebbroker.DedupStats
+}
+
+func (_v *MockDependencies) DedupStats() sebbroker.DedupStats {
+	if _v.DedupStatsMock == nil {
+		msg := fmt.Sprintf("call to %T.DedupStats, but MockDedupStats is not set", _v)
+		panic(msg)
+	}
+
+	_v.DedupStatsCalls = append(_v.DedupStatsCalls, dependenciesDedupStatsCall{})
+	out0 := _v.DedupStatsMock()
+	_v.DedupStatsCalls[len(_v.DedupStatsCalls)-1].Out0 = out0
+	return out0
+}
+
+type dependenciesCommitGroupOffsetCall struct {
+	Ctx       context.Context
+	Group     string
+	TopicName string
+	Offset    uint64
+
+	Out0 error
+}
+
+func (_v *MockDependencies) CommitGroupOffset(ctx context.Context, group string, topicName string, offset uint64) error {
+	if _v.CommitGroupOffsetMock == nil {
+		msg := fmt.Sprintf("call to %T.CommitGroupOffset, but MockCommitGroupOffset is not set", _v)
+		panic(msg)
+	}
+
+	_v.CommitGroupOffsetCalls = append(_v.CommitGroupOffsetCalls, dependenciesCommitGroupOffsetCall{
+		Ctx:       ctx,
+		Group:     group,
+		TopicName: topicName,
+		Offset:    offset,
+	})
+	out0 := _v.CommitGroupOffsetMock(ctx, group, topicName, offset)
+	_v.CommitGroupOffsetCalls[len(_v.CommitGroupOffsetCalls)-1].Out0 = out0
+	return out0
+}
+
+type dependenciesGroupNamesCall struct {
+	Out0 []string
+}
+
+func (_v *MockDependencies) GroupNames() []string {
+	if _v.GroupNamesMock == nil {
+		msg := fmt.Sprintf("call to %T.GroupNames, but MockGroupNames is not set", _v)
+		panic(msg)
+	}
+
+	_v.GroupNamesCalls = append(_v.GroupNamesCalls, dependenciesGroupNamesCall{})
+	out0 := _v.GroupNamesMock()
+	_v.GroupNamesCalls[len(_v.GroupNamesCalls)-1].Out0 = out0
+	return out0
+}
+
+type dependenciesGroupLagCall struct {
+	Group string
+
+	Out0 []sebbroker.TopicLag
+	Out1 error
+}
+
+func (_v *MockDependencies) GroupLag(group string) ([]sebbroker.TopicLag, error) {
+	if _v.GroupLagMock == nil {
+		msg := fmt.Sprintf("call to %T.GroupLag, but MockGroupLag is not set", _v)
+		panic(msg)
+	}
+
+	_v.GroupLagCalls = append(_v.GroupLagCalls, dependenciesGroupLagCall{
+		Group: group,
+	})
+	out0, out1 := _v.GroupLagMock(group)
+	_v.GroupLagCalls[len(_v.GroupLagCalls)-1].Out0 = out0
+	_v.GroupLagCalls[len(_v.GroupLagCalls)-1].Out1 = out1
+	return out0, out1
+}
+
+type dependenciesStaleGroupsCall struct {
+	Now time.Time
+
+	Out0 []sebbroker.StaleGroup
+}
+
+func (_v *MockDependencies) StaleGroups(now time.Time) []sebbroker.StaleGroup {
+	if _v.StaleGroupsMock == nil {
+		msg := fmt.Sprintf("call to %T.StaleGroups, but MockStaleGroups is not set", _v)
+		panic(msg)
+	}
+
+	_v.StaleGroupsCalls = append(_v.StaleGroupsCalls, dependenciesStaleGroupsCall{
+		Now: now,
+	})
+	out0 := _v.StaleGroupsMock(now)
+	_v.StaleGroupsCalls[len(_v.StaleGroupsCalls)-1].Out0 = out0
+	return out0
+}
+
+type dependenciesJoinGroupCall struct {
+	Group          string
+	MemberID       string
+	TopicNames     []string
+	SessionTimeout time.Duration
+	AssignorName   string
+
+	Out0 sebbroker.GroupAssignment
+	Out1 error
+}
+
+func (_v *MockDependencies) JoinGroup(group string, memberID string, topicNames []string, sessionTimeout time.Duration, assignorName string) (sebbroker.GroupAssignment, error) {
+	if _v.JoinGroupMock == nil {
+		msg := fmt.Sprintf("call to %T.JoinGroup, but MockJoinGroup is not set", _v)
+		panic(msg)
+	}
+
+	_v.JoinGroupCalls = append(_v.JoinGroupCalls, dependenciesJoinGroupCall{
+		Group:          group,
+		MemberID:       memberID,
+		TopicNames:     topicNames,
+		SessionTimeout: sessionTimeout,
+		AssignorName:   assignorName,
+	})
+	out0, out1 := _v.JoinGroupMock(group, memberID, topicNames, sessionTimeout, assignorName)
+	_v.JoinGroupCalls[len(_v.JoinGroupCalls)-1].Out0 = out0
+	_v.JoinGroupCalls[len(_v.JoinGroupCalls)-1].Out1 = out1
+	return out0, out1
+}
+
+type dependenciesGroupHeartbeatCall struct {
+	Group    string
+	MemberID string
+
+	Out0 sebbroker.GroupAssignment
+	Out1 error
+}
+
+func (_v *MockDependencies) GroupHeartbeat(group string, memberID string) (sebbroker.GroupAssignment, error) {
+	if _v.GroupHeartbeatMock == nil {
+		msg := fmt.Sprintf("call to %T.GroupHeartbeat, but MockGroupHeartbeat is not set", _v)
+		panic(msg)
+	}
+
+	_v.GroupHeartbeatCalls = append(_v.GroupHeartbeatCalls, dependenciesGroupHeartbeatCall{
+		Group:    group,
+		MemberID: memberID,
+	})
+	out0, out1 := _v.GroupHeartbeatMock(group, memberID)
+	_v.GroupHeartbeatCalls[len(_v.GroupHeartbeatCalls)-1].Out0 = out0
+	_v.GroupHeartbeatCalls[len(_v.GroupHeartbeatCalls)-1].Out1 = out1
+	return out0, out1
+}
+
+type dependenciesLeaveGroupCall struct {
+	Group    string
+	MemberID string
+
+	Out0 error
+}
+
+func (_v *MockDependencies) LeaveGroup(group string, memberID string) error {
+	if _v.LeaveGroupMock == nil {
+		msg := fmt.Sprintf("call to %T.LeaveGroup, but MockLeaveGroup is not set", _v)
+		panic(msg)
+	}
+
+	_v.LeaveGroupCalls = append(_v.LeaveGroupCalls, dependenciesLeaveGroupCall{
+		Group:    group,
+		MemberID: memberID,
+	})
+	out0 := _v.LeaveGroupMock(group, memberID)
+	_v.LeaveGroupCalls[len(_v.LeaveGroupCalls)-1].Out0 = out0
+	return out0
+}
+
+type dependenciesPauseGroupCall struct {
+	Ctx       context.Context
+	Group     string
+	TopicName string
+
+	Out0 error
+}
+
+func (_v *MockDependencies) PauseGroup(ctx context.Context, group string, topicName string) error {
+	if _v.PauseGroupMock == nil {
+		msg := fmt.Sprintf("call to %T.PauseGroup, but MockPauseGroup is not set", _v)
+		panic(msg)
+	}
+
+	_v.PauseGroupCalls = append(_v.PauseGroupCalls, dependenciesPauseGroupCall{
+		Ctx:       ctx,
+		Group:     group,
+		TopicName: topicName,
+	})
+	out0 := _v.PauseGroupMock(ctx, group, topicName)
+	_v.PauseGroupCalls[len(_v.PauseGroupCalls)-1].Out0 = out0
+	return out0
+}
+
+type dependenciesResumeGroupCall struct {
+	Ctx       context.Context
+	Group     string
+	TopicName string
+
+	Out0 error
+}
+
+func (_v *MockDependencies) ResumeGroup(ctx context.Context, group string, topicName string) error {
+	if _v.ResumeGroupMock == nil {
+		msg := fmt.Sprintf("call to %T.ResumeGroup, but MockResumeGroup is not set", _v)
+		panic(msg)
+	}
+
+	_v.ResumeGroupCalls = append(_v.ResumeGroupCalls, dependenciesResumeGroupCall{
+		Ctx:       ctx,
+		Group:     group,
+		TopicName: topicName,
+	})
+	out0 := _v.ResumeGroupMock(ctx, group, topicName)
+	_v.ResumeGroupCalls[len(_v.ResumeGroupCalls)-1].Out0 = out0
+	return out0
+}
+
+type dependenciesGroupPausedCall struct {
+	Group     string
+	TopicName string
+
+	Out0 bool
+}
+
+func (_v *MockDependencies) GroupPaused(group string, topicName string) bool {
+	if _v.GroupPausedMock == nil {
+		msg := fmt.Sprintf("call to %T.GroupPaused, but MockGroupPaused is not set", _v)
+		panic(msg)
+	}
+
+	_v.GroupPausedCalls = append(_v.GroupPausedCalls, dependenciesGroupPausedCall{
+		Group:     group,
+		TopicName: topicName,
+	})
+	out0 := _v.GroupPausedMock(group, topicName)
+	_v.GroupPausedCalls[len(_v.GroupPausedCalls)-1].Out0 = out0
+	return out0
+}
+
+type dependenciesGroupOffsetsCall struct {
+	Group string
+
+	Out0 sebbroker.GroupOffsets
+	Out1 error
+}
+
+func (_v *MockDependencies) GroupOffsets(group string) (sebbroker.GroupOffsets, error) {
+	if _v.GroupOffsetsMock == nil {
+		msg := fmt.Sprintf("call to %T.GroupOffsets, but MockGroupOffsets is not set", _v)
+		panic(msg)
+	}
+
+	_v.GroupOffsetsCalls = append(_v.GroupOffsetsCalls, dependenciesGroupOffsetsCall{
+		Group: group,
+	})
+	out0, out1 := _v.GroupOffsetsMock(group)
+	_v.GroupOffsetsCalls[len(_v.GroupOffsetsCalls)-1].Out0 = out0
+	_v.GroupOffsetsCalls[len(_v.GroupOffsetsCalls)-1].Out1 = out1
+	return out0, out1
+}
+
+type dependenciesResetGroupOffsetsCall struct {
+	Ctx   context.Context
+	Group string
+	Reset sebbroker.OffsetReset
+
+	Out0 []sebbroker.TopicLag
+	Out1 error
+}
+
+func (_v *MockDependencies) ResetGroupOffsets(ctx context.Context, group string, reset sebbroker.OffsetReset) ([]sebbroker.TopicLag, error) {
+	if _v.ResetGroupOffsetsMock == nil {
+		msg := fmt.Sprintf("call to %T.ResetGroupOffsets, but MockResetGroupOffsets is not set", _v)
+		panic(msg)
+	}
+
+	_v.ResetGroupOffsetsCalls = append(_v.ResetGroupOffsetsCalls, dependenciesResetGroupOffsetsCall{
+		Ctx:   ctx,
+		Group: group,
+		Reset: reset,
+	})
+	out0, out1 := _v.ResetGroupOffsetsMock(ctx, group, reset)
+	_v.ResetGroupOffsetsCalls[len(_v.ResetGroupOffsetsCalls)-1].Out0 = out0
+	_v.ResetGroupOffsetsCalls[len(_v.ResetGroupOffsetsCalls)-1].Out1 = out1
+	return out0, out1
+}
+
+type dependenciesCreateReplayCall struct {
+	Name      string
+	TopicName string
+	Opts      sebbroker.ReplayOpts
+
+	Out0 sebbroker.Replay
+	Out1 error
+}
+
+func (_v *MockDependencies) CreateReplay(name string, topicName string, opts sebbroker.ReplayOpts) (sebbroker.Replay, error) {
+	if _v.CreateReplayMock == nil {
+		msg := fmt.Sprintf("call to %T.CreateReplay, but MockCreateReplay is not set", _v)
+		panic(msg)
+	}
+
+	_v.CreateReplayCalls = append(_v.CreateReplayCalls, dependenciesCreateReplayCall{
+		Name:      name,
+		TopicName: topicName,
+		Opts:      opts,
+	})
+	out0, out1 := _v.CreateReplayMock(name, topicName, opts)
+	_v.CreateReplayCalls[len(_v.CreateReplayCalls)-1].Out0 = out0
+	_v.CreateReplayCalls[len(_v.CreateReplayCalls)-1].Out1 = out1
+	return out0, out1
+}
+
+type dependenciesReadReplayCall struct {
+	Ctx          context.Context
+	Batch        *sebrecords.Batch
+	Name         string
+	MaxRecords   int
+	SoftMaxBytes int
+
+	Out0 sebbroker.Replay
+	Out1 error
+}
+
+func (_v *MockDependencies) ReadReplay(ctx context.Context, batch *sebrecords.Batch, name string, maxRecords int, softMaxBytes int) (sebbroker.Replay, error) {
+	if _v.ReadReplayMock == nil {
+		msg := fmt.Sprintf("call to %T.ReadReplay, but MockReadReplay is not set", _v)
+		panic(msg)
+	}
+
+	_v.ReadReplayCalls = append(_v.ReadReplayCalls, dependenciesReadReplayCall{
+		Ctx:          ctx,
+		Batch:        batch,
+		Name:         name,
+		MaxRecords:   maxRecords,
+		SoftMaxBytes: softMaxBytes,
+	})
+	out0, out1 := _v.ReadReplayMock(ctx, batch, name, maxRecords, softMaxBytes)
+	_v.ReadReplayCalls[len(_v.ReadReplayCalls)-1].Out0 = out0
+	_v.ReadReplayCalls[len(_v.ReadReplayCalls)-1].Out1 = out1
+	return out0, out1
+}
+
+type dependenciesGetReplayCall struct {
+	Name string
+
+	Out0 sebbroker.Replay
+	Out1 error
+}
+
+func (_v *MockDependencies) GetReplay(name string) (sebbroker.Replay, error) {
+	if _v.GetReplayMock == nil {
+		msg := fmt.Sprintf("call to %T.GetReplay, but MockGetReplay is not set", _v)
+		panic(msg)
+	}
+
+	_v.GetReplayCalls = append(_v.GetReplayCalls, dependenciesGetReplayCall{
+		Name: name,
+	})
+	out0, out1 := _v.GetReplayMock(name)
+	_v.GetReplayCalls[len(_v.GetReplayCalls)-1].Out0 = out0
+	_v.GetReplayCalls[len(_v.GetReplayCalls)-1].Out1 = out1
+	return out0, out1
+}
+
+type dependenciesReplaysCall struct {
+	Out0 []sebbroker.Replay
+}
+
+func (_v *MockDependencies) Replays() []sebbroker.Replay {
+	if _v.ReplaysMock == nil {
+		msg := fmt.Sprintf("call to %T.Replays, but MockReplays is not set", _v)
+		panic(msg)
+	}
+
+	_v.ReplaysCalls = append(_v.ReplaysCalls, dependenciesReplaysCall{})
+	out0 := _v.ReplaysMock()
+	_v.ReplaysCalls[len(_v.ReplaysCalls)-1].Out0 = out0
+	return out0
+}
+
+type dependenciesDeleteReplayCall struct {
+	Name string
+
+	Out0 error
+}
+
+func (_v *MockDependencies) DeleteReplay(name string) error {
+	if _v.DeleteReplayMock == nil {
+		msg := fmt.Sprintf("call to %T.DeleteReplay, but MockDeleteReplay is not set", _v)
+		panic(msg)
+	}
+
+	_v.DeleteReplayCalls = append(_v.DeleteReplayCalls, dependenciesDeleteReplayCall{
+		Name: name,
+	})
+	out0 := _v.DeleteReplayMock(name)
+	_v.DeleteReplayCalls[len(_v.DeleteReplayCalls)-1].Out0 = out0
+	return out0
+}
+
+type dependenciesRefreshRecordBatchCall struct {
+	Ctx context.Context
+	Key string
+
+	Out0 error
+}
+
+func (_v *MockDependencies) RefreshRecordBatch(ctx context.Context, key string) error {
+	if _v.RefreshRecordBatchMock == nil {
+		msg := fmt.Sprintf("call to %T.RefreshRecordBatch, but MockRefreshRecordBatch is not set", _v)
+		panic(msg)
+	}
+
+	_v.RefreshRecordBatchCalls = append(_v.RefreshRecordBatchCalls, dependenciesRefreshRecordBatchCall{
+		Ctx: ctx,
+		Key: key,
+	})
+	out0 := _v.RefreshRecordBatchMock(ctx, key)
+	_v.RefreshRecordBatchCalls[len(_v.RefreshRecordBatchCalls)-1].Out0 = out0
+	return out0
+}
@@ -0,0 +1,138 @@
+package httphandlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+type TopicProvisioner interface {
+	ProvisionTopics(specs []sebbroker.TopicSpec, opts sebbroker.ProvisionOpts) (sebbroker.ProvisionResult, error)
+}
+
+type TopicSpecInput struct {
+	Name string `json:"name"`
+
+	// Retention is in the format understood by time.ParseDuration. Retention
+	// is disabled if empty or "0s".
+	Retention string `json:"retention"`
+
+	Labels map[string]string `json:"labels"`
+}
+
+type ProvisionTopicsInput struct {
+	Topics []TopicSpecInput `json:"topics"`
+
+	// Prune deletes topics that aren't declared in Topics.
+	Prune bool `json:"prune"`
+
+	// DryRun reports the changes that would be made without making them.
+	DryRun bool `json:"dry_run"`
+}
+
+type ProvisionTopicsOutput struct {
+	DryRun    bool              `json:"dry_run"`
+	Created   []string          `json:"created"`
+	Updated   []string          `json:"updated"`
+	Unchanged []string          `json:"unchanged"`
+	Deleted   []string          `json:"deleted"`
+	Errors    map[string]string `json:"errors,omitempty"`
+}
+
+// ProvisionTopics reconciles the broker's topics with a declarative list of
+// topics and their configuration. Topics that failed to be reconciled are
+// listed in ProvisionTopicsOutput.Errors. Internal topics can only be declared
+// by requests with admin access, and are never pruned.
+func ProvisionTopics(log logger.Logger, s TopicProvisioner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		input := ProvisionTopicsInput{}
+		err := httphelpers.ParseJSONAndClose(r.Body, &input)
+		if err != nil {
+			httphelpers.WriteErrorf(w, http.StatusBadRequest, "parsing json body: %w", err)
+			return
+		}
+
+		specs, err := topicSpecs(input.Topics)
+		if err != nil {
+			httphelpers.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if !accessFromContext(r.Context()).Admin && slices.ContainsFunc(specs, func(spec sebbroker.TopicSpec) bool {
+			return sebbroker.IsInternalTopic(spec.Name)
+		}) {
+			log.Infof("not allowed to provision internal topics")
+			httphelpers.WriteErrorf(w, http.StatusForbidden, "%s", "internal topics can only be provisioned by admins")
+			return
+		}
+
+		result, err := s.ProvisionTopics(specs, sebbroker.ProvisionOpts{
+			Prune:  input.Prune,
+			DryRun: input.DryRun,
+		})
+		if err != nil {
+			if errors.Is(err, seberr.ErrBadInput) {
+				httphelpers.WriteError(w, http.StatusBadRequest, err)
+				return
+			}
+
+			if errors.Is(err, seberr.ErrWritesFrozen) {
+				httphelpers.WriteError(w, http.StatusServiceUnavailable, err)
+				return
+			}
+
+			log.Errorf("provisioning topics: %s", err)
+			httphelpers.WriteErrorf(w, http.StatusInternalServerError, "failed to provision topics: %w", err)
+			return
+		}
+
+		output := ProvisionTopicsOutput{
+			DryRun:    input.DryRun,
+			Created:   result.Created,
+			Updated:   result.Updated,
+			Unchanged: result.Unchanged,
+			Deleted:   result.Deleted,
+		}
+		for topicName, err := range result.Errors {
+			if output.Errors == nil {
+				output.Errors = make(map[string]string, len(result.Errors))
+			}
+			output.Errors[topicName] = err.Error()
+		}
+
+		httphelpers.WriteJSON(w, &output)
+	}
+}
+
+// topicSpecs parses inputs into the topic specs given to
+// TopicProvisioner.ProvisionTopics.
+func topicSpecs(inputs []TopicSpecInput) ([]sebbroker.TopicSpec, error) {
+	specs := make([]sebbroker.TopicSpec, 0, len(inputs))
+	for _, input := range inputs {
+		spec := sebbroker.TopicSpec{
+			Name:   input.Name,
+			Labels: input.Labels,
+		}
+
+		if input.Retention != "" {
+			retention, err := time.ParseDuration(input.Retention)
+			if err != nil {
+				return nil, fmt.Errorf("parsing retention of topic '%s': %w", input.Name, err)
+			}
+			spec.Retention = retention
+		}
+
+		specs = append(specs, spec)
+	}
+
+	return specs, nil
+}
@@ -0,0 +1,74 @@
+package httphandlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/httphandlers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/stretchr/testify/require"
+)
+
+// TestProvisionTopics verifies that PUT /admin/topics creates declared topics
+// with their configuration and prunes undeclared topics.
+func TestProvisionTopics(t *testing.T) {
+	server := tester.HTTPServer(t)
+	defer server.Close()
+
+	_, err := server.Broker.AddRecords("extra", tester.MakeRandomRecordBatch(1))
+	require.NoError(t, err)
+
+	input := httphandlers.ProvisionTopicsInput{
+		Topics: []httphandlers.TopicSpecInput{
+			{Name: "orders", Retention: "24h", Labels: map[string]string{"team": "a"}},
+		},
+		Prune: true,
+	}
+	r := httptest.NewRequest("PUT", "/admin/topics", jsonBody(t, input))
+
+	// Act
+	response := server.DoWithAuth(r)
+
+	// Assert
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	output := httphandlers.ProvisionTopicsOutput{}
+	err = httphelpers.ParseJSONAndClose(response.Body, &output)
+	require.NoError(t, err)
+	require.Equal(t, []string{"orders"}, output.Created)
+	require.Equal(t, []string{"extra"}, output.Deleted)
+	require.Empty(t, output.Errors)
+
+	require.Equal(t, []string{"orders"}, server.Broker.TopicNames())
+	require.Equal(t, 24*time.Hour, server.Broker.TopicRetention("orders"))
+	require.Equal(t, map[string]string{"team": "a"}, server.Broker.TopicLabels("orders"))
+}
+
+// TestProvisionTopicsBadInput verifies that PUT /admin/topics returns
+// http.StatusBadRequest for invalid input.
+func TestProvisionTopicsBadInput(t *testing.T) {
+	tests := map[string]httphandlers.ProvisionTopicsInput{
+		"bad retention": {Topics: []httphandlers.TopicSpecInput{{Name: "topic", Retention: "a while"}}},
+		"no name":       {Topics: []httphandlers.TopicSpecInput{{Retention: "1h"}}},
+		"duplicate":     {Topics: []httphandlers.TopicSpecInput{{Name: "topic"}, {Name: "topic"}}},
+	}
+
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := tester.HTTPServer(t)
+			defer server.Close()
+
+			r := httptest.NewRequest("PUT", "/admin/topics", jsonBody(t, input))
+
+			// Act
+			response := server.DoWithAuth(r)
+
+			// Assert
+			require.Equal(t, http.StatusBadRequest, response.StatusCode)
+			require.Empty(t, server.Broker.TopicNames())
+		})
+	}
+}
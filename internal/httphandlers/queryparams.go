@@ -4,10 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/micvbang/go-helpy/inty"
 	"github.com/micvbang/go-helpy/uint64y"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
 )
 
 const (
@@ -16,6 +18,14 @@ const (
 	softMaxBytesKey = "max-bytes"
 	maxRecordsKey   = "max-records"
 	timeoutKey      = "timeout"
+	tracesKey       = "traces"
+	nonBlockingKey  = "non-blocking"
+	prefixKey       = "prefix"
+	aliasKey        = "alias"
+	recordKeyKey    = "key"
+	headerKey       = "header"
+	internalKey     = "internal"
+	wireSizeKey     = "max-bytes-wire"
 )
 
 type QParam struct {
@@ -45,6 +55,32 @@ func parseQueryParams(r *http.Request, requiredParams ...QParam) (map[string]any
 	return outputs, errors.Join(errs...)
 }
 
+// parseRecordFilter parses the record filter given by the key and header query
+// parameters of r. header may be given multiple times, each formatted as
+// "name:value".
+func parseRecordFilter(r *http.Request) (sebtopic.RecordFilter, error) {
+	filter := sebtopic.RecordFilter{}
+
+	query := r.URL.Query()
+	if key := query.Get(recordKeyKey); key != "" {
+		filter.Key = []byte(key)
+	}
+
+	for _, header := range query[headerKey] {
+		name, value, ok := strings.Cut(header, ":")
+		if !ok || name == "" {
+			return sebtopic.RecordFilter{}, fmt.Errorf("failed to parse query parameter '%s': expected 'name:value', got '%s'", headerKey, header)
+		}
+
+		if filter.Headers == nil {
+			filter.Headers = make(map[string]string)
+		}
+		filter.Headers[name] = value
+	}
+
+	return filter, nil
+}
+
 var ErrQueryParameterRequired = fmt.Errorf("required")
 
 func QueryString(s string) (any, error) {
@@ -54,6 +90,15 @@ func QueryString(s string) (any, error) {
 	return s, nil
 }
 
+func QueryStringDefault(d string) func(string) (any, error) {
+	return func(s string) (any, error) {
+		if s == "" {
+			return d, nil
+		}
+		return s, nil
+	}
+}
+
 func QueryUint64(s string) (any, error) {
 	if s == "" {
 		return uint64(0), ErrQueryParameterRequired
@@ -66,22 +111,90 @@ func QueryUint64(s string) (any, error) {
 	return v, nil
 }
 
-func QueryIntDefault(i int) func(string) (any, error) {
+func QueryUint64Default(u uint64) func(string) (any, error) {
+	return func(s string) (any, error) {
+		if s == "" {
+			return u, nil
+		}
+
+		v, err := uint64y.FromString(s)
+		if err != nil {
+			return u, fmt.Errorf("parsing '%s' as a uint64", s)
+		}
+		return v, nil
+	}
+}
+
+// QueryTimeOptional parses an RFC3339 timestamp, returning the zero time.Time
+// if the parameter is not given.
+func QueryTimeOptional(s string) (any, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	v, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parsing '%s' as an RFC3339 timestamp", s)
+	}
+	return v, nil
+}
+
+func QueryBoolDefault(b bool) func(string) (any, error) {
 	return func(s string) (any, error) {
-		v, err := inty.FromString(s)
+		if s == "" {
+			return b, nil
+		}
+
+		v, err := strconv.ParseBool(s)
 		if err != nil {
+			return b, fmt.Errorf("parsing '%s' as a bool", s)
+		}
+		return v, nil
+	}
+}
+
+func QueryIntDefault(i int) func(string) (any, error) {
+	return func(s string) (any, error) {
+		if s == "" {
 			return i, nil
 		}
+
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return i, fmt.Errorf("parsing '%s' as an int", s)
+		}
 		return v, nil
 	}
 }
 
 func QueryDurationDefault(d time.Duration) func(string) (any, error) {
 	return func(s string) (any, error) {
+		if s == "" {
+			return d, nil
+		}
+
 		v, err := time.ParseDuration(s)
 		if err != nil {
-			return d, nil
+			return d, fmt.Errorf("parsing '%s' as a duration", s)
 		}
 		return v, nil
 	}
 }
+
+// checkIntRange returns an error if value, the value of the query parameter
+// key, isn't in the range [lo; hi].
+func checkIntRange(key string, value int, lo int, hi int) error {
+	if value < lo || value > hi {
+		return fmt.Errorf("%s must be in range [%d; %d], got %d", key, lo, hi, value)
+	}
+	return nil
+}
+
+// checkDurationRange returns an error if value, the value of the query
+// parameter key, isn't in the range [lo; hi].
+func checkDurationRange(key string, value time.Duration, lo time.Duration, hi time.Duration) error {
+	if value < lo || value > hi {
+		return fmt.Errorf("%s must be in range [%s; %s], got %s", key, lo, hi, value)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package httphandlers
+
+import (
+	"net/http"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+)
+
+type QuotaUsageGetter interface {
+	QuotaUsage() []sebbroker.QuotaUsage
+}
+
+type QuotaUsageOutput struct {
+	Name                string `json:"name"`
+	Namespace           string `json:"namespace,omitempty"`
+	Principal           string `json:"principal,omitempty"`
+	ProducedBytesPerDay int64  `json:"produced_bytes_per_day"`
+	RetainedBytes       int64  `json:"retained_bytes"`
+
+	ProducedBytesToday int64 `json:"produced_bytes_today"`
+	UsedRetainedBytes  int64 `json:"used_retained_bytes"`
+}
+
+type GetQuotaUsageOutput struct {
+	Quotas []QuotaUsageOutput `json:"quotas"`
+}
+
+// GetQuotaUsage returns the broker's quotas and how much of them has been
+// used. Limits of 0 are unlimited.
+func GetQuotaUsage(log logger.Logger, s QuotaUsageGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		usage := s.QuotaUsage()
+
+		output := GetQuotaUsageOutput{Quotas: make([]QuotaUsageOutput, 0, len(usage))}
+		for _, quotaUsage := range usage {
+			output.Quotas = append(output.Quotas, QuotaUsageOutput{
+				Name:                quotaUsage.Name(),
+				Namespace:           quotaUsage.Namespace,
+				Principal:           quotaUsage.Principal,
+				ProducedBytesPerDay: quotaUsage.ProducedBytesPerDay,
+				RetainedBytes:       quotaUsage.RetainedBytes,
+				ProducedBytesToday:  quotaUsage.ProducedBytesToday,
+				UsedRetainedBytes:   quotaUsage.UsedRetainedBytes,
+			})
+		}
+
+		httphelpers.WriteJSON(w, &output)
+	}
+}
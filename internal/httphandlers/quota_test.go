@@ -0,0 +1,49 @@
+package httphandlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/httphandlers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetQuotaUsage verifies that GET /admin/quotas returns the broker's
+// quotas and how much of them has been used.
+func TestGetQuotaUsage(t *testing.T) {
+	deps := &httphandlers.MockDependencies{}
+	deps.QuotaUsageMock = func() []sebbroker.QuotaUsage {
+		return []sebbroker.QuotaUsage{
+			{
+				Quota:              sebbroker.Quota{Namespace: "team-a/", ProducedBytesPerDay: 100, RetainedBytes: 1000},
+				ProducedBytesToday: 10,
+				UsedRetainedBytes:  20,
+			},
+		}
+	}
+
+	server := tester.HTTPServer(t, tester.HTTPDependencies(deps))
+	defer server.Close()
+
+	// Act
+	response := server.DoWithAuth(httptest.NewRequest("GET", "/admin/quotas", nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	output := httphandlers.GetQuotaUsageOutput{}
+	err := httphelpers.ParseJSONAndClose(response.Body, &output)
+	require.NoError(t, err)
+	require.Equal(t, []httphandlers.QuotaUsageOutput{{
+		Name:                "namespace:team-a/",
+		Namespace:           "team-a/",
+		ProducedBytesPerDay: 100,
+		RetainedBytes:       1000,
+		ProducedBytesToday:  10,
+		UsedRetainedBytes:   20,
+	}}, output.Quotas)
+}
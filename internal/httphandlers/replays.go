@@ -0,0 +1,275 @@
+package httphandlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/micvbang/go-helpy/syncy"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+const replayKey = "replay"
+
+// ReplayDoneHeader is set to "true" by ReadReplay once all records of the
+// replay have been read.
+const ReplayDoneHeader = "Replay-Done"
+
+type Replayer interface {
+	CreateReplay(name string, topicName string, opts sebbroker.ReplayOpts) (sebbroker.Replay, error)
+	ReadReplay(ctx context.Context, batch *sebrecords.Batch, name string, maxRecords int, softMaxBytes int) (sebbroker.Replay, error)
+	GetReplay(name string) (sebbroker.Replay, error)
+	Replays() []sebbroker.Replay
+	DeleteReplay(name string) error
+}
+
+type CreateReplayInput struct {
+	TopicName   string `json:"topic_name"`
+	StartOffset uint64 `json:"start_offset"`
+
+	// EndOffset defaults to the topic's next offset if 0.
+	EndOffset uint64 `json:"end_offset"`
+
+	// RecordsPerSecond and BytesPerSecond are unlimited if 0.
+	RecordsPerSecond int `json:"records_per_second"`
+	BytesPerSecond   int `json:"bytes_per_second"`
+
+	BypassCache bool `json:"bypass_cache"`
+
+	// IdleTimeout is in the format understood by time.ParseDuration. The
+	// broker's default is used if empty.
+	IdleTimeout string `json:"idle_timeout"`
+}
+
+type ReplayOutput struct {
+	Name             string    `json:"name"`
+	TopicName        string    `json:"topic_name"`
+	StartOffset      uint64    `json:"start_offset"`
+	EndOffset        uint64    `json:"end_offset"`
+	Offset           uint64    `json:"offset"`
+	Done             bool      `json:"done"`
+	RecordsPerSecond int       `json:"records_per_second"`
+	BytesPerSecond   int       `json:"bytes_per_second"`
+	BypassCache      bool      `json:"bypass_cache"`
+	IdleTimeout      string    `json:"idle_timeout"`
+	CreatedAt        time.Time `json:"created_at"`
+	ActiveAt         time.Time `json:"active_at"`
+}
+
+func newReplayOutput(replay sebbroker.Replay) ReplayOutput {
+	return ReplayOutput{
+		Name:             replay.Name,
+		TopicName:        replay.TopicName,
+		StartOffset:      replay.StartOffset,
+		EndOffset:        replay.EndOffset,
+		Offset:           replay.Offset,
+		Done:             replay.Done(),
+		RecordsPerSecond: replay.RecordsPerSecond,
+		BytesPerSecond:   replay.BytesPerSecond,
+		BypassCache:      replay.BypassCache,
+		IdleTimeout:      replay.IdleTimeout.String(),
+		CreatedAt:        replay.CreatedAt,
+		ActiveAt:         replay.ActiveAt,
+	}
+}
+
+// CreateReplay creates a named, read-only cursor over a range of a topic's
+// offsets, which is read using ReadReplay. Replays are meant for large
+// backfills; they have their own rate limits and can bypass the cache, such
+// that they don't disturb live consumers.
+func CreateReplay(log logger.Logger, s Replayer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		input := CreateReplayInput{}
+		err := httphelpers.ParseJSONAndClose(r.Body, &input)
+		if err != nil {
+			httphelpers.WriteErrorf(w, http.StatusBadRequest, "parsing json body: %w", err)
+			return
+		}
+
+		var idleTimeout time.Duration
+		if input.IdleTimeout != "" {
+			idleTimeout, err = time.ParseDuration(input.IdleTimeout)
+			if err != nil {
+				httphelpers.WriteErrorf(w, http.StatusBadRequest, "parsing idle timeout: %w", err)
+				return
+			}
+		}
+
+		name := r.PathValue(replayKey)
+		replay, err := s.CreateReplay(name, input.TopicName, sebbroker.ReplayOpts{
+			StartOffset:      input.StartOffset,
+			EndOffset:        input.EndOffset,
+			RecordsPerSecond: input.RecordsPerSecond,
+			BytesPerSecond:   input.BytesPerSecond,
+			BypassCache:      input.BypassCache,
+			IdleTimeout:      idleTimeout,
+		})
+		if err != nil {
+			statusCode := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, seberr.ErrBadInput):
+				statusCode = http.StatusBadRequest
+			case errors.Is(err, seberr.ErrTopicNotFound):
+				statusCode = http.StatusNotFound
+			default:
+				log.Errorf("creating replay '%s': %s", name, err)
+				err = fmt.Errorf("failed to create replay '%s': %w", name, err)
+			}
+			httphelpers.WriteError(w, statusCode, err)
+			return
+		}
+
+		err = httphelpers.WriteJSONWithStatusCode(w, http.StatusCreated, newReplayOutput(replay))
+		if err != nil {
+			log.Errorf("failed to write json: %s", err)
+		}
+	}
+}
+
+// GetReplay returns a replay, including the offset that it will read next.
+func GetReplay(log logger.Logger, s Replayer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		name := r.PathValue(replayKey)
+		replay, err := s.GetReplay(name)
+		if err != nil {
+			if errors.Is(err, seberr.ErrNotFound) {
+				httphelpers.WriteError(w, http.StatusNotFound, err)
+				return
+			}
+
+			log.Errorf("getting replay '%s': %s", name, err)
+			httphelpers.WriteErrorf(w, http.StatusInternalServerError, "failed to get replay '%s': %w", name, err)
+			return
+		}
+
+		output := newReplayOutput(replay)
+		httphelpers.WriteJSON(w, &output)
+	}
+}
+
+// ListReplays returns all replays.
+func ListReplays(log logger.Logger, s Replayer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		replays := s.Replays()
+		output := make([]ReplayOutput, 0, len(replays))
+		for _, replay := range replays {
+			output = append(output, newReplayOutput(replay))
+		}
+
+		httphelpers.WriteJSON(w, &output)
+	}
+}
+
+// DeleteReplay deletes a replay.
+func DeleteReplay(log logger.Logger, s Replayer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		name := r.PathValue(replayKey)
+		err := s.DeleteReplay(name)
+		if err != nil {
+			if errors.Is(err, seberr.ErrNotFound) {
+				httphelpers.WriteError(w, http.StatusNotFound, err)
+				return
+			}
+
+			log.Errorf("deleting replay '%s': %s", name, err)
+			httphelpers.WriteErrorf(w, http.StatusInternalServerError, "failed to delete replay '%s': %w", name, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ReadReplay returns the next records of a replay as multipart form data, in
+// the same format as GetRecords, and advances the replay past them. The
+// response waits for the replay's rate limits.
+//
+// The offset that the replay will read next is given in the Next-Offset
+// header, and Replay-Done is set to "true" once all of the replay's records
+// have been read. 204 No Content is returned if no records were read, e.g.
+// because the replay is done.
+func ReadReplay(log logger.Logger, batchPool *syncy.Pool[*sebrecords.Batch], s Replayer) http.HandlerFunc {
+	// NOTE: all batches of batchPool are expected to have the same capacity.
+	batch := batchPool.Get()
+	maxRecordsLimit := cap(batch.Sizes)
+	batchPool.Put(batch)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		params, err := parseQueryParams(r,
+			QParam{softMaxBytesKey, QueryIntDefault(0)},
+			QParam{maxRecordsKey, QueryIntDefault(0)},
+		)
+		if err != nil {
+			httphelpers.WriteErrorf(w, http.StatusBadRequest, "parsing url params: %w", err)
+			return
+		}
+		name := r.PathValue(replayKey)
+		softMaxBytes := params[softMaxBytesKey].(int)
+		maxRecords := params[maxRecordsKey].(int)
+
+		err = errors.Join(
+			checkIntRange(maxRecordsKey, maxRecords, 0, maxRecordsLimit),
+			checkIntRange(softMaxBytesKey, softMaxBytes, 0, math.MaxInt),
+		)
+		if err != nil {
+			httphelpers.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		batch := batchPool.Get()
+		batch.Reset()
+		defer batchPool.Put(batch)
+
+		replay, err := s.ReadReplay(r.Context(), batch, name, maxRecords, softMaxBytes)
+		if err != nil {
+			switch {
+			case errors.Is(err, seberr.ErrNotFound), errors.Is(err, seberr.ErrTopicNotFound):
+				httphelpers.WriteError(w, http.StatusNotFound, err)
+			case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+				log.Debugf("context ended: %s", err)
+				w.WriteHeader(http.StatusPartialContent)
+			default:
+				log.Errorf("reading replay '%s': %s", name, err)
+				httphelpers.WriteErrorf(w, http.StatusInternalServerError, "failed to read replay '%s': %w", name, err)
+			}
+			return
+		}
+
+		w.Header().Set(NextOffsetHeader, strconv.FormatUint(replay.Offset, 10))
+		w.Header().Set(ReplayDoneHeader, strconv.FormatBool(replay.Done()))
+		if batch.Len() == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		mw := multipart.NewWriter(w)
+		defer mw.Close()
+		w.Header().Set("Content-Type", mw.FormDataContentType())
+
+		err = httphelpers.RecordsToMultipartFormDataHTTP(mw, batch.Sizes, batch.Data)
+		if err != nil {
+			log.Errorf("writing record multipart form data: %s", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package httphandlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/micvbang/go-helpy/sizey"
+	"github.com/micvbang/simple-event-broker/internal/httphandlers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReplay verifies that a replay can be created, that its records are
+// returned by GET /replays/{replay}/records until it's done, and that it can
+// be listed and deleted.
+func TestReplay(t *testing.T) {
+	const topicName = "topic"
+
+	server := tester.HTTPServer(t)
+	defer server.Close()
+
+	records := tester.MakeRandomRecordBatch(6)
+	_, err := server.Broker.AddRecords(topicName, records)
+	require.NoError(t, err)
+
+	input := httphandlers.CreateReplayInput{
+		TopicName:   topicName,
+		StartOffset: 1,
+		BypassCache: true,
+		IdleTimeout: "1m",
+	}
+
+	// Act
+	response := server.DoWithAuth(createReplayRequest(t, "backfill", input))
+
+	// Assert
+	require.Equal(t, http.StatusCreated, response.StatusCode)
+
+	output := httphandlers.ReplayOutput{}
+	err = httphelpers.ParseJSONAndClose(response.Body, &output)
+	require.NoError(t, err)
+	require.Equal(t, "backfill", output.Name)
+	require.Equal(t, uint64(1), output.Offset)
+	require.Equal(t, uint64(6), output.EndOffset)
+	require.Equal(t, "1m0s", output.IdleTimeout)
+	require.True(t, output.BypassCache)
+
+	expected := records.IndividualRecords()
+	for _, page := range []struct {
+		nextOffset string
+		done       string
+		records    [][]byte
+	}{
+		{nextOffset: "4", done: "false", records: expected[1:4]},
+		{nextOffset: "6", done: "true", records: expected[4:6]},
+	} {
+		r := httptest.NewRequest("GET", "/replays/backfill/records", nil)
+		httphelpers.AddQueryParams(r, map[string]string{
+			"max-records": "3",
+		})
+
+		// Act
+		response := server.DoWithAuth(r)
+
+		// Assert
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		require.Equal(t, page.nextOffset, response.Header.Get(httphandlers.NextOffsetHeader))
+		require.Equal(t, page.done, response.Header.Get(httphandlers.ReplayDoneHeader))
+
+		_, params, err := mime.ParseMediaType(response.Header.Get("Content-Type"))
+		require.NoError(t, err)
+		batch := sebrecords.NewBatch(make([]uint32, 0, 8), make([]byte, 0, sizey.MB))
+		err = httphelpers.MultipartFormDataToRecords(response.Body, params["boundary"], &batch)
+		require.NoError(t, err)
+		require.Equal(t, page.records, batch.IndividualRecords())
+	}
+
+	// no records are returned once the replay is done
+	response = server.DoWithAuth(httptest.NewRequest("GET", "/replays/backfill/records", nil))
+	require.Equal(t, http.StatusNoContent, response.StatusCode)
+	require.Equal(t, "true", response.Header.Get(httphandlers.ReplayDoneHeader))
+
+	response = server.DoWithAuth(httptest.NewRequest("GET", "/replays", nil))
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	replays := []httphandlers.ReplayOutput{}
+	err = httphelpers.ParseJSONAndClose(response.Body, &replays)
+	require.NoError(t, err)
+	require.Len(t, replays, 1)
+	require.True(t, replays[0].Done)
+
+	// Act
+	response = server.DoWithAuth(httptest.NewRequest("DELETE", "/replays/backfill", nil))
+
+	// Assert
+	require.Equal(t, http.StatusNoContent, response.StatusCode)
+
+	response = server.DoWithAuth(httptest.NewRequest("GET", "/replays/backfill", nil))
+	require.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	response = server.DoWithAuth(httptest.NewRequest("GET", "/replays/backfill/records", nil))
+	require.Equal(t, http.StatusNotFound, response.StatusCode)
+}
+
+// TestCreateReplayErrors verifies that POST /replays/{replay} returns the
+// expected status codes for invalid replays.
+func TestCreateReplayErrors(t *testing.T) {
+	const topicName = "topic"
+
+	server := tester.HTTPServer(t, tester.HTTPBrokerAutoCreateTopic(false))
+	defer server.Close()
+
+	err := server.Broker.CreateTopic(topicName)
+	require.NoError(t, err)
+	_, err = server.Broker.AddRecords(topicName, tester.MakeRandomRecordBatch(3))
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		input      httphandlers.CreateReplayInput
+		statusCode int
+	}{
+		"topic not found":   {input: httphandlers.CreateReplayInput{TopicName: "does-not-exist"}, statusCode: http.StatusNotFound},
+		"beyond next":       {input: httphandlers.CreateReplayInput{TopicName: topicName, EndOffset: 4}, statusCode: http.StatusBadRequest},
+		"bad idle timeout":  {input: httphandlers.CreateReplayInput{TopicName: topicName, IdleTimeout: "soon"}, statusCode: http.StatusBadRequest},
+		"negative limit":    {input: httphandlers.CreateReplayInput{TopicName: topicName, RecordsPerSecond: -1}, statusCode: http.StatusBadRequest},
+		"start beyond end":  {input: httphandlers.CreateReplayInput{TopicName: topicName, StartOffset: 2, EndOffset: 1}, statusCode: http.StatusBadRequest},
+		"valid replay":      {input: httphandlers.CreateReplayInput{TopicName: topicName}, statusCode: http.StatusCreated},
+		"valid with limits": {input: httphandlers.CreateReplayInput{TopicName: topicName, BytesPerSecond: 1024}, statusCode: http.StatusCreated},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			response := server.DoWithAuth(createReplayRequest(t, strings.ReplaceAll(name, " ", "-"), test.input))
+
+			// Assert
+			require.Equal(t, test.statusCode, response.StatusCode)
+		})
+	}
+}
+
+func createReplayRequest(t *testing.T, name string, input httphandlers.CreateReplayInput) *http.Request {
+	bs, err := json.Marshal(input)
+	require.NoError(t, err)
+
+	return httptest.NewRequest("POST", "/replays/"+name, bytes.NewReader(bs))
+}
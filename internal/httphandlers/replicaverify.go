@@ -0,0 +1,96 @@
+package httphandlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+)
+
+type ReplicaReportsGetter interface {
+	Reports() []sebtopic.ReplicaReport
+}
+
+type ReplicaDivergenceOutput struct {
+	Key    string `json:"key"`
+	Reason string `json:"reason"`
+}
+
+type ReplicaReportOutput struct {
+	TopicName   string                    `json:"topic_name"`
+	VerifiedAt  time.Time                 `json:"verified_at"`
+	Divergences []ReplicaDivergenceOutput `json:"divergences"`
+}
+
+type GetReplicaVerificationOutput struct {
+	Topics []ReplicaReportOutput `json:"topics"`
+}
+
+// GetReplicaVerification returns the result of the latest verification of the
+// replica of each topic, including the record batches that differ between
+// the broker's storage and the replica.
+func GetReplicaVerification(log logger.Logger, s ReplicaReportsGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		reports := s.Reports()
+
+		output := GetReplicaVerificationOutput{
+			Topics: make([]ReplicaReportOutput, 0, len(reports)),
+		}
+		for _, report := range reports {
+			reportOutput := ReplicaReportOutput{
+				TopicName:   report.TopicName,
+				VerifiedAt:  report.VerifiedAt,
+				Divergences: make([]ReplicaDivergenceOutput, 0, len(report.Divergences)),
+			}
+			for _, divergence := range report.Divergences {
+				reportOutput.Divergences = append(reportOutput.Divergences, ReplicaDivergenceOutput(divergence))
+			}
+			output.Topics = append(output.Topics, reportOutput)
+		}
+
+		httphelpers.WriteJSON(w, &output)
+	}
+}
+
+// replicaDivergenceReasons are the reasons that divergences are labelled by
+// in the metrics written by writeReplicaMetrics.
+var replicaDivergenceReasons = []string{
+	sebtopic.DivergenceMissingOnFollower,
+	sebtopic.DivergenceMissingOnLeader,
+	sebtopic.DivergenceSize,
+	sebtopic.DivergenceChecksum,
+}
+
+// writeReplicaMetrics writes the number of record batches that differed
+// between the broker's storage and its replica in the latest verification of
+// each topic in the Prometheus text exposition format, labelled by topic and
+// reason.
+func writeReplicaMetrics(w io.Writer, s ReplicaReportsGetter) {
+	reports := s.Reports()
+
+	const divergences = "seb_replica_divergences"
+	fmt.Fprintf(w, "# HELP %s %s\n", divergences, "Number of record batches that differed between storage and the replica in the latest verification, by topic and reason.")
+	fmt.Fprintf(w, "# TYPE %s gauge\n", divergences)
+	for _, report := range reports {
+		counts := map[string]int{}
+		for _, divergence := range report.Divergences {
+			counts[divergence.Reason] += 1
+		}
+		for _, reason := range replicaDivergenceReasons {
+			fmt.Fprintf(w, "%s{topic=%q,reason=%q} %d\n", divergences, report.TopicName, reason, counts[reason])
+		}
+	}
+
+	const verifiedAt = "seb_replica_verified_timestamp_seconds"
+	fmt.Fprintf(w, "# HELP %s %s\n", verifiedAt, "Unix time of the latest verification of the replica, by topic.")
+	fmt.Fprintf(w, "# TYPE %s gauge\n", verifiedAt)
+	for _, report := range reports {
+		fmt.Fprintf(w, "%s{topic=%q} %d\n", verifiedAt, report.TopicName, report.VerifiedAt.Unix())
+	}
+}
@@ -0,0 +1,76 @@
+package httphandlers_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/httphandlers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetReplicaVerification verifies that GET /admin/replica/verification
+// returns the latest divergences of each topic, and that GET /metrics counts
+// them by topic and reason.
+func TestGetReplicaVerification(t *testing.T) {
+	reports := sebtopic.NewReplicaReports()
+	server := tester.HTTPServer(t, tester.HTTPMonitoring(httphandlers.Monitoring{Replica: reports}))
+	defer server.Close()
+
+	key := sebtopic.RecordBatchKey("b", 0)
+	reports.Report("a", nil)
+	reports.Report("b", []sebtopic.Divergence{{Key: key, Reason: sebtopic.DivergenceChecksum}})
+
+	// Act
+	response := server.DoWithAuth(httptest.NewRequest("GET", "/admin/replica/verification", nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	output := httphandlers.GetReplicaVerificationOutput{}
+	err := httphelpers.ParseJSONAndClose(response.Body, &output)
+	require.NoError(t, err)
+	require.Len(t, output.Topics, 2)
+	require.Equal(t, "a", output.Topics[0].TopicName)
+	require.Empty(t, output.Topics[0].Divergences)
+	require.Equal(t, "b", output.Topics[1].TopicName)
+	require.Equal(t, []httphandlers.ReplicaDivergenceOutput{{Key: key, Reason: sebtopic.DivergenceChecksum}}, output.Topics[1].Divergences)
+
+	// Act
+	response = server.DoWithAuth(httptest.NewRequest("GET", "/metrics", nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	bs, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+
+	body := string(bs)
+	require.Contains(t, body, "# TYPE seb_replica_divergences gauge\n")
+	require.Contains(t, body, `seb_replica_divergences{topic="a",reason="checksum mismatch"} 0`+"\n")
+	require.Contains(t, body, `seb_replica_divergences{topic="b",reason="checksum mismatch"} 1`+"\n")
+	require.Contains(t, body, `seb_replica_divergences{topic="b",reason="size mismatch"} 0`+"\n")
+}
+
+// TestGetReplicaVerificationDisabled verifies that GET
+// /admin/replica/verification isn't registered, and that GET /metrics has no
+// replica metrics, when replicas aren't verified.
+func TestGetReplicaVerificationDisabled(t *testing.T) {
+	server := tester.HTTPServer(t)
+	defer server.Close()
+
+	// Act
+	response := server.DoWithAuth(httptest.NewRequest("GET", "/admin/replica/verification", nil))
+
+	// Assert
+	require.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	response = server.DoWithAuth(httptest.NewRequest("GET", "/metrics", nil))
+	bs, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	require.NotContains(t, string(bs), "seb_replica_divergences")
+}
@@ -1,8 +1,6 @@
 package httphandlers
 
 import (
-	"context"
-	"crypto/subtle"
 	"net/http"
 
 	"github.com/micvbang/go-helpy/syncy"
@@ -16,21 +14,133 @@ type Dependencies interface {
 	RecordsAdder
 	RecordGetter
 	RecordsGetter
+	RecordsSampler
+	TopicAdministrator
+	TopicSealer
+	TopicsBulkOperator
+	TopicProvisioner
 	TopicGetter
+	TopicWatcher
+	TopicBatchInfoGetter
+	TopicSegmentsGetter
+	WriteFreezer
+	TopicAliaser
+	Snapshotter
+	UsageGetter
+	QuotaUsageGetter
+	DedupStatsGetter
+	GroupOffsetCommitter
+	GroupLagGetter
+	StaleGroupsGetter
+	GroupCoordinator
+	GroupPauser
+	GroupOffsetResetter
+	Replayer
+	S3EventIngester
 }
 
-func RegisterRoutes(log logger.Logger, mux *http.ServeMux, batchPool *syncy.Pool[*sebrecords.Batch], deps Dependencies, apiKey string) {
-	// TODO: we want something more secure and easier to manage than a
-	// single, static API key.
-	apiKeyBs := []byte(apiKey)
+// Monitoring holds optional sources of metrics and stats that aren't kept by
+// the broker, e.g. of background jobs. GET /metrics includes the metrics of
+// the sources that are non-nil, and their routes are only registered if they
+// are.
+type Monitoring struct {
+	// Replica holds the results of verifying the replica of the broker's
+	// storage.
+	Replica ReplicaReportsGetter
 
-	requireAPIKey := httphelpers.NewAPIKeyHandler(log.Name("api key handler"), func(ctx context.Context, apiKey string) (bool, error) {
-		apiKeyIsValid := subtle.ConstantTimeCompare(apiKeyBs, []byte(apiKey)) == 1
-		return apiKeyIsValid, nil
-	})
+	// S3Retry holds the statistics of retried requests to S3 and the state
+	// of the circuit breaker, if the broker stores records in S3.
+	S3Retry S3RetryStatsGetter
+
+	// S3Uploads holds the statistics of the uploads to S3, if the broker
+	// stores records in S3.
+	S3Uploads S3UploadStatsGetter
+
+	// Scrub holds the findings of scrubbing the record batches in storage.
+	Scrub ScrubStatsGetter
+}
+
+// RegisterRoutes registers the broker's routes on mux. Requests are
+// authenticated using auth; requests with full access can use all routes,
+// while other requests can only read the data allowed by their grant. The log
+// level routes are only registered if logLevel is non-nil, the cache routes
+// only if cache is non-nil, and the config reload route only if config is
+// non-nil.
+func RegisterRoutes(log logger.Logger, mux *http.ServeMux, batchPool *syncy.Pool[*sebrecords.Batch], deps Dependencies, logLevel LogLeveler, cache CacheInspector, config ConfigReloader, monitoring Monitoring, auth Authenticator) {
+	// identities of clients that present a verified TLS client certificate
+	// are made available to handlers via httphelpers.IdentityFromContext.
+	clientCertIdentity := httphelpers.NewClientCertIdentityHandler(log.Name("client cert identity"), nil)
+
+	fullAccess := newFullAccessHandler(log.Name("auth"), auth)
+	requireAPIKey := func(hf http.HandlerFunc) http.HandlerFunc {
+		return clientCertIdentity(fullAccess(hf))
+	}
+
+	readACL := newReadACLHandler(log.Name("read acl"), auth)
+	allowGrants := func(hf http.HandlerFunc) http.HandlerFunc {
+		return clientCertIdentity(readACL(hf))
+	}
 
 	mux.HandleFunc("POST /records", requireAPIKey(AddRecords(log, batchPool, deps)))
-	mux.HandleFunc("GET /record", requireAPIKey(GetRecord(log, deps)))
-	mux.HandleFunc("GET /records", requireAPIKey(GetRecords(log, batchPool, deps)))
+	mux.HandleFunc("GET /record", allowGrants(GetRecord(log, deps)))
+	mux.HandleFunc("GET /records", allowGrants(GetRecords(log, batchPool, deps)))
+	mux.HandleFunc("GET /records/sample", allowGrants(SampleRecords(log, batchPool, deps)))
 	mux.HandleFunc("GET /topic", requireAPIKey(GetTopic(log, deps)))
+	mux.HandleFunc("POST /topic", requireAPIKey(CreateTopic(log, deps)))
+	mux.HandleFunc("DELETE /topic", requireAPIKey(DeleteTopic(log, deps)))
+	mux.HandleFunc("GET /topic/batch", requireAPIKey(GetTopicBatchInfo(log, deps)))
+	mux.HandleFunc("GET /topic/segments", requireAPIKey(GetTopicSegments(log, deps)))
+	mux.HandleFunc("GET /topics", requireAPIKey(ListTopics(log, deps)))
+	mux.HandleFunc("GET /topics/watch", requireAPIKey(WatchTopics(log, deps)))
+
+	mux.HandleFunc("GET /admin/maintenance", requireAPIKey(GetMaintenanceMode(log, deps)))
+	mux.HandleFunc("PUT /admin/maintenance", requireAPIKey(SetMaintenanceMode(log, deps)))
+	mux.HandleFunc("GET /admin/topic/freeze", requireAPIKey(GetTopicWriteFreeze(log, deps)))
+	mux.HandleFunc("PUT /admin/topic/freeze", requireAPIKey(SetTopicWriteFreeze(log, deps)))
+	mux.HandleFunc("POST /admin/topic/seal", requireAPIKey(SealTopic(log, deps)))
+	mux.HandleFunc("POST /admin/topics/bulk", requireAPIKey(BulkTopics(log, deps)))
+	mux.HandleFunc("PUT /admin/topics", requireAPIKey(ProvisionTopics(log, deps)))
+	mux.HandleFunc("GET /admin/topic/aliases", requireAPIKey(ListTopicAliases(log, deps)))
+	mux.HandleFunc("PUT /admin/topic/alias", requireAPIKey(SetTopicAlias(log, deps)))
+	mux.HandleFunc("DELETE /admin/topic/alias", requireAPIKey(RemoveTopicAlias(log, deps)))
+	mux.HandleFunc("POST /admin/snapshot", requireAPIKey(CreateSnapshot(log, deps)))
+	mux.HandleFunc("PUT /groups/{group}/offset", requireAPIKey(CommitGroupOffset(log, deps)))
+	mux.HandleFunc("GET /groups/{group}/lag", requireAPIKey(GetGroupLag(log, deps)))
+	mux.HandleFunc("POST /groups/{group}/join", requireAPIKey(JoinGroup(log, deps)))
+	mux.HandleFunc("POST /groups/{group}/heartbeat", requireAPIKey(GroupHeartbeat(log, deps)))
+	mux.HandleFunc("POST /groups/{group}/leave", requireAPIKey(LeaveGroup(log, deps)))
+	mux.HandleFunc("GET /replays", requireAPIKey(ListReplays(log, deps)))
+	mux.HandleFunc("POST /replays/{replay}", requireAPIKey(CreateReplay(log, deps)))
+	mux.HandleFunc("GET /replays/{replay}", requireAPIKey(GetReplay(log, deps)))
+	mux.HandleFunc("DELETE /replays/{replay}", requireAPIKey(DeleteReplay(log, deps)))
+	mux.HandleFunc("GET /replays/{replay}/records", requireAPIKey(ReadReplay(log, batchPool, deps)))
+	mux.HandleFunc("GET /admin/groups/stale", requireAPIKey(ListStaleGroups(log, deps)))
+	mux.HandleFunc("GET /admin/groups/{group}/pause", requireAPIKey(GetGroupPause(log, deps)))
+	mux.HandleFunc("PUT /admin/groups/{group}/pause", requireAPIKey(PauseGroup(log, deps)))
+	mux.HandleFunc("PUT /admin/groups/{group}/resume", requireAPIKey(ResumeGroup(log, deps)))
+	mux.HandleFunc("PUT /admin/groups/{group}/offsets/reset", requireAPIKey(ResetGroupOffsets(log, deps)))
+	mux.HandleFunc("POST /replica/s3-events", requireAPIKey(IngestS3Events(log, deps)))
+	mux.HandleFunc("GET /metrics", requireAPIKey(GetMetrics(log, cache, deps, monitoring)))
+
+	mux.HandleFunc("GET /admin/usage", requireAPIKey(GetUsage(log, deps)))
+	mux.HandleFunc("GET /admin/quotas", requireAPIKey(GetQuotaUsage(log, deps)))
+	mux.HandleFunc("GET /admin/dedup", requireAPIKey(GetDedupStats(log, deps)))
+
+	if logLevel != nil {
+		mux.HandleFunc("GET /admin/log-level", requireAPIKey(GetLogLevel(log, logLevel)))
+		mux.HandleFunc("PUT /admin/log-level", requireAPIKey(SetLogLevel(log, logLevel)))
+	}
+
+	if cache != nil {
+		mux.HandleFunc("GET /admin/cache", requireAPIKey(GetCacheStats(log, cache)))
+		mux.HandleFunc("GET /admin/cache/items", requireAPIKey(GetCacheItems(log, cache)))
+	}
+
+	if config != nil {
+		mux.HandleFunc("POST /admin/config/reload", requireAPIKey(ReloadConfig(log, config)))
+	}
+
+	if monitoring.Replica != nil {
+		mux.HandleFunc("GET /admin/replica/verification", requireAPIKey(GetReplicaVerification(log, monitoring.Replica)))
+	}
 }
@@ -0,0 +1,158 @@
+package httphandlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+type S3EventIngester interface {
+	RefreshRecordBatch(ctx context.Context, key string) error
+}
+
+type IngestS3EventsOutput struct {
+	Refreshed int `json:"refreshed"`
+	Ignored   int `json:"ignored"`
+}
+
+// s3EventsMaxDepth is the maximum number of envelopes around S3 event
+// notifications, e.g. SQS message -> SNS notification -> S3 event.
+const s3EventsMaxDepth = 3
+
+// s3EventsPayload holds the fields of S3 event notifications, SNS messages and
+// SQS messages that are needed to find the keys of created objects.
+type s3EventsPayload struct {
+	// SNS
+	Type         string `json:"Type"`
+	Message      string `json:"Message"`
+	SubscribeURL string `json:"SubscribeURL"`
+
+	// S3 event notifications and SQS messages
+	Records []struct {
+		EventName string `json:"eventName"`
+		S3        struct {
+			Object struct {
+				Key string `json:"key"`
+			} `json:"object"`
+		} `json:"s3"`
+
+		// SQS
+		Body string `json:"body"`
+	} `json:"Records"`
+}
+
+// IngestS3Events picks up record batches reported by S3 event notifications,
+// making read replicas serve them without having to list the bucket. The body
+// must be an S3 event notification, either as is, wrapped in an SNS message,
+// or in SQS messages, e.g. as forwarded by an SQS consumer. Only
+// ObjectCreated events are used; keys that aren't record batches are ignored.
+// Brokers that aren't read replicas respond with http.StatusNotFound.
+//
+// SNS subscription confirmations are logged, but not confirmed, since the
+// broker must not make requests to URLs given by clients.
+//
+// NOTE: requests must be authenticated like all other requests, so SNS
+// notifications must be delivered via e.g. a proxy that adds the API key.
+func IngestS3Events(log logger.Logger, s S3EventIngester) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		buf, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			httphelpers.WriteErrorf(w, http.StatusBadRequest, "reading body: %w", err)
+			return
+		}
+
+		keys, err := parseS3EventKeys(log, buf, s3EventsMaxDepth)
+		if err != nil {
+			httphelpers.WriteErrorf(w, http.StatusBadRequest, "parsing s3 events: %w", err)
+			return
+		}
+
+		output := IngestS3EventsOutput{}
+		for _, key := range keys {
+			err := s.RefreshRecordBatch(r.Context(), key)
+			if err != nil {
+				if errors.Is(err, seberr.ErrBadInput) {
+					log.Debugf("ignoring s3 event for '%s': %s", key, err)
+					output.Ignored++
+					continue
+				}
+				if errors.Is(err, seberr.ErrNotFound) {
+					httphelpers.WriteError(w, http.StatusNotFound, err)
+					return
+				}
+
+				// NOTE: failing the request makes SNS and SQS redeliver the
+				// notification.
+				log.Errorf("refreshing record batch '%s': %s", key, err)
+				httphelpers.WriteErrorf(w, http.StatusInternalServerError, "failed to refresh record batch '%s': %w", key, err)
+				return
+			}
+			output.Refreshed++
+		}
+
+		httphelpers.WriteJSON(w, &output)
+	}
+}
+
+// parseS3EventKeys returns the keys of the objects created according to the S3
+// event notifications in buf, unwrapping at most depth SNS and SQS envelopes.
+func parseS3EventKeys(log logger.Logger, buf []byte, depth int) ([]string, error) {
+	if depth == 0 {
+		return nil, fmt.Errorf("too many nested messages")
+	}
+
+	payload := s3EventsPayload{}
+	err := json.Unmarshal(buf, &payload)
+	if err != nil {
+		return nil, err
+	}
+
+	switch payload.Type {
+	case "":
+	case "Notification":
+		return parseS3EventKeys(log, []byte(payload.Message), depth-1)
+	case "SubscriptionConfirmation":
+		log.Infof("received SNS subscription confirmation; confirm it by visiting %s", payload.SubscribeURL)
+		return nil, nil
+	default:
+		log.Debugf("ignoring SNS message of type '%s'", payload.Type)
+		return nil, nil
+	}
+
+	keys := make([]string, 0, len(payload.Records))
+	for _, record := range payload.Records {
+		if record.Body != "" {
+			bodyKeys, err := parseS3EventKeys(log, []byte(record.Body), depth-1)
+			if err != nil {
+				return nil, fmt.Errorf("parsing SQS message: %w", err)
+			}
+			keys = append(keys, bodyKeys...)
+			continue
+		}
+
+		if !strings.HasPrefix(record.EventName, "ObjectCreated:") {
+			continue
+		}
+
+		// NOTE: keys in S3 event notifications are URL encoded.
+		key, err := url.QueryUnescape(record.S3.Object.Key)
+		if err != nil {
+			return nil, fmt.Errorf("decoding key '%s': %w", record.S3.Object.Key, err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
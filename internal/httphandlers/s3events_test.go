@@ -0,0 +1,130 @@
+package httphandlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/httphandlers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestIngestS3Events verifies that POST /replica/s3-events refreshes the
+// record batches created according to S3 event notifications, whether they're
+// sent as is, wrapped in SNS messages or in SQS messages.
+func TestIngestS3Events(t *testing.T) {
+	s3Event := `{"Records":[
+		{"eventName":"ObjectCreated:Put","s3":{"object":{"key":"my+topic/000000000002.record_batch"}}},
+		{"eventName":"ObjectRemoved:Delete","s3":{"object":{"key":"my+topic/000000000000.record_batch"}}},
+		{"eventName":"ObjectCreated:Put","s3":{"object":{"key":"my+topic/manifest.json"}}}
+	]}`
+	snsMessage := fmt.Sprintf(`{"Type":"Notification","Message":%s}`, jsonString(t, s3Event))
+	sqsMessages := fmt.Sprintf(`{"Records":[{"body":%s}]}`, jsonString(t, snsMessage))
+
+	tests := map[string]struct {
+		body string
+	}{
+		"s3":  {body: s3Event},
+		"sns": {body: snsMessage},
+		"sqs": {body: sqsMessages},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			deps := &httphandlers.MockDependencies{}
+			deps.RefreshRecordBatchMock = func(ctx context.Context, key string) error {
+				if strings.HasSuffix(key, ".record_batch") {
+					return nil
+				}
+				return seberr.ErrBadInput
+			}
+
+			server := tester.HTTPServer(t, tester.HTTPDependencies(deps))
+			defer server.Close()
+
+			// Act
+			response := server.DoWithAuth(httptest.NewRequest("POST", "/replica/s3-events", strings.NewReader(test.body)))
+
+			// Assert
+			require.Equal(t, http.StatusOK, response.StatusCode)
+
+			output := httphandlers.IngestS3EventsOutput{}
+			err := httphelpers.ParseJSONAndClose(response.Body, &output)
+			require.NoError(t, err)
+			require.Equal(t, httphandlers.IngestS3EventsOutput{Refreshed: 1, Ignored: 1}, output)
+
+			require.Equal(t, 2, len(deps.RefreshRecordBatchCalls))
+			require.Equal(t, "my topic/000000000002.record_batch", deps.RefreshRecordBatchCalls[0].Key)
+			require.Equal(t, "my topic/manifest.json", deps.RefreshRecordBatchCalls[1].Key)
+		})
+	}
+}
+
+// TestIngestS3EventsSubscriptionConfirmation verifies that SNS subscription
+// confirmations are accepted without refreshing anything.
+func TestIngestS3EventsSubscriptionConfirmation(t *testing.T) {
+	deps := &httphandlers.MockDependencies{}
+	server := tester.HTTPServer(t, tester.HTTPDependencies(deps))
+	defer server.Close()
+
+	body := `{"Type":"SubscriptionConfirmation","SubscribeURL":"https://sns.example.com/confirm"}`
+
+	// Act
+	response := server.DoWithAuth(httptest.NewRequest("POST", "/replica/s3-events", strings.NewReader(body)))
+
+	// Assert
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.Empty(t, deps.RefreshRecordBatchCalls)
+}
+
+// TestIngestS3EventsErrors verifies that bad payloads are rejected with
+// http.StatusBadRequest, and that failing to refresh a record batch returns
+// http.StatusInternalServerError such that the notification is redelivered.
+// Brokers that aren't read replicas respond with http.StatusNotFound.
+func TestIngestS3EventsErrors(t *testing.T) {
+	validEvent := `{"Records":[{"eventName":"ObjectCreated:Put","s3":{"object":{"key":"topic/000000000002.record_batch"}}}]}`
+
+	tests := map[string]struct {
+		body       string
+		refreshErr error
+		statusCode int
+	}{
+		"not json":        {body: "{", statusCode: http.StatusBadRequest},
+		"bad sns message": {body: `{"Type":"Notification","Message":"{"}`, statusCode: http.StatusBadRequest},
+		"bad sqs body":    {body: `{"Records":[{"body":"{"}]}`, statusCode: http.StatusBadRequest},
+		"bad key":         {body: `{"Records":[{"eventName":"ObjectCreated:Put","s3":{"object":{"key":"topic/%zz"}}}]}`, statusCode: http.StatusBadRequest},
+		"refresh fails":   {body: validEvent, refreshErr: fmt.Errorf("boom"), statusCode: http.StatusInternalServerError},
+		"not a replica":   {body: validEvent, refreshErr: seberr.ErrNotFound, statusCode: http.StatusNotFound},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			deps := &httphandlers.MockDependencies{}
+			deps.RefreshRecordBatchMock = func(ctx context.Context, key string) error {
+				return test.refreshErr
+			}
+
+			server := tester.HTTPServer(t, tester.HTTPDependencies(deps))
+			defer server.Close()
+
+			// Act
+			response := server.DoWithAuth(httptest.NewRequest("POST", "/replica/s3-events", strings.NewReader(test.body)))
+
+			// Assert
+			require.Equal(t, test.statusCode, response.StatusCode)
+		})
+	}
+}
+
+func jsonString(t *testing.T, s string) string {
+	bs, err := json.Marshal(s)
+	require.NoError(t, err)
+	return string(bs)
+}
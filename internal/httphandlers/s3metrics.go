@@ -0,0 +1,124 @@
+package httphandlers
+
+import (
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+)
+
+type S3RetryStatsGetter interface {
+	RetryStats() sebtopic.S3RetryStats
+}
+
+type S3UploadStatsGetter interface {
+	UploadStats() sebtopic.UploadStats
+}
+
+// s3RetryMetrics are the metrics of retried S3 requests exposed by GetMetrics.
+var s3RetryMetrics = []struct {
+	name  string
+	help  string
+	value func(sebtopic.S3RetryStats) uint64
+}{
+	{"seb_s3_requests_total", "Number of attempted requests to S3, including retries and requests failed by the circuit breaker.", func(s sebtopic.S3RetryStats) uint64 { return s.Requests }},
+	{"seb_s3_retries_total", "Number of retried requests to S3.", func(s sebtopic.S3RetryStats) uint64 { return s.Retries }},
+	{"seb_s3_failures_total", "Number of requests to S3 that failed with a retryable error.", func(s sebtopic.S3RetryStats) uint64 { return s.Failures }},
+	{"seb_s3_fast_fails_total", "Number of requests to S3 that were failed by the circuit breaker without being sent.", func(s sebtopic.S3RetryStats) uint64 { return s.FastFails }},
+	{"seb_s3_breaker_opened_total", "Number of times the S3 circuit breaker opened.", func(s sebtopic.S3RetryStats) uint64 { return s.BreakerOpened }},
+	{"seb_s3_breaker_half_opens_total", "Number of times the S3 circuit breaker became half-open.", func(s sebtopic.S3RetryStats) uint64 { return s.BreakerHalfOpens }},
+	{"seb_s3_breaker_closed_total", "Number of times the S3 circuit breaker closed.", func(s sebtopic.S3RetryStats) uint64 { return s.BreakerClosed }},
+}
+
+// s3BreakerStates are the states of the S3 circuit breaker, in the order that
+// they're exposed by GetMetrics.
+var s3BreakerStates = []string{
+	sebtopic.BreakerClosed,
+	sebtopic.BreakerOpen,
+	sebtopic.BreakerHalfOpen,
+}
+
+func writeS3RetryMetrics(w io.Writer, s S3RetryStatsGetter) {
+	stats := s.RetryStats()
+	for _, metric := range s3RetryMetrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", metric.name, metric.help)
+		fmt.Fprintf(w, "# TYPE %s counter\n", metric.name)
+		fmt.Fprintf(w, "%s %d\n", metric.name, metric.value(stats))
+	}
+
+	const breakerState = "seb_s3_breaker_state"
+	fmt.Fprintf(w, "# HELP %s %s\n", breakerState, "State of the S3 circuit breaker; 1 for the current state and 0 for the others.")
+	fmt.Fprintf(w, "# TYPE %s gauge\n", breakerState)
+	for _, state := range s3BreakerStates {
+		value := 0
+		if stats.BreakerState == state {
+			value = 1
+		}
+		fmt.Fprintf(w, "%s{state=%q} %d\n", breakerState, state, value)
+	}
+}
+
+// writeS3UploadMetrics writes the metrics of the uploads to S3 limited by
+// sebtopic.S3Opts.MaxConcurrentUploads. Nothing is written if uploads aren't
+// limited.
+func writeS3UploadMetrics(w io.Writer, s S3UploadStatsGetter) {
+	stats := s.UploadStats()
+	if stats.MaxInFlight == 0 {
+		return
+	}
+
+	gauges := []struct {
+		name  string
+		help  string
+		value int
+	}{
+		{"seb_s3_uploads_max_in_flight", "Maximum number of concurrent uploads to S3.", stats.MaxInFlight},
+		{"seb_s3_uploads_in_flight", "Number of uploads to S3 in flight.", stats.InFlight},
+	}
+	for _, gauge := range gauges {
+		fmt.Fprintf(w, "# HELP %s %s\n", gauge.name, gauge.help)
+		fmt.Fprintf(w, "# TYPE %s gauge\n", gauge.name)
+		fmt.Fprintf(w, "%s %d\n", gauge.name, gauge.value)
+	}
+
+	counters := []struct {
+		name  string
+		help  string
+		value uint64
+	}{
+		{"seb_s3_uploads_total", "Number of uploads to S3 that were started.", stats.Uploads},
+		{"seb_s3_uploads_waited_total", "Number of uploads to S3 that waited in the upload queue.", stats.Waited},
+	}
+	for _, counter := range counters {
+		fmt.Fprintf(w, "# HELP %s %s\n", counter.name, counter.help)
+		fmt.Fprintf(w, "# TYPE %s counter\n", counter.name)
+		fmt.Fprintf(w, "%s %d\n", counter.name, counter.value)
+	}
+
+	// NOTE: topics are listed once they've had an upload queued, such that
+	// their queue length is reported as 0 once their queue has emptied.
+	topicNames := make([]string, 0, len(stats.WaitTimeByTopic)+len(stats.QueuedByTopic))
+	for topicName := range stats.WaitTimeByTopic {
+		topicNames = append(topicNames, topicName)
+	}
+	for topicName := range stats.QueuedByTopic {
+		topicNames = append(topicNames, topicName)
+	}
+	slices.Sort(topicNames)
+	topicNames = slices.Compact(topicNames)
+
+	const queueLength = "seb_s3_upload_queue_length"
+	fmt.Fprintf(w, "# HELP %s %s\n", queueLength, "Number of uploads to S3 waiting in the upload queue, by topic.")
+	fmt.Fprintf(w, "# TYPE %s gauge\n", queueLength)
+	for _, topicName := range topicNames {
+		fmt.Fprintf(w, "%s{topic=%q} %d\n", queueLength, topicName, stats.QueuedByTopic[topicName])
+	}
+
+	const waitTime = "seb_s3_upload_wait_seconds_total"
+	fmt.Fprintf(w, "# HELP %s %s\n", waitTime, "Total time that uploads to S3 have waited in the upload queue, by topic.")
+	fmt.Fprintf(w, "# TYPE %s counter\n", waitTime)
+	for _, topicName := range topicNames {
+		fmt.Fprintf(w, "%s{topic=%q} %g\n", waitTime, topicName, stats.WaitTimeByTopic[topicName].Seconds())
+	}
+}
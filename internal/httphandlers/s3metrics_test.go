@@ -0,0 +1,136 @@
+package httphandlers_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/httphandlers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/stretchr/testify/require"
+)
+
+type s3RetryStats sebtopic.S3RetryStats
+
+func (s s3RetryStats) RetryStats() sebtopic.S3RetryStats {
+	return sebtopic.S3RetryStats(s)
+}
+
+// TestGetMetricsS3Retry verifies that GET /metrics returns the counts of
+// retried S3 requests and the state of the circuit breaker, and that they're
+// left out when records aren't stored in S3.
+func TestGetMetricsS3Retry(t *testing.T) {
+	stats := s3RetryStats{
+		Requests:      10,
+		Retries:       3,
+		Failures:      4,
+		FastFails:     2,
+		BreakerState:  sebtopic.BreakerOpen,
+		BreakerOpened: 1,
+	}
+	server := tester.HTTPServer(t, tester.HTTPMonitoring(httphandlers.Monitoring{S3Retry: stats}))
+	defer server.Close()
+
+	// Act
+	response := server.DoWithAuth(httptest.NewRequest("GET", "/metrics", nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	bs, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+
+	body := string(bs)
+	require.Contains(t, body, "# TYPE seb_s3_requests_total counter\n")
+	require.Contains(t, body, "seb_s3_requests_total 10\n")
+	require.Contains(t, body, "seb_s3_retries_total 3\n")
+	require.Contains(t, body, "seb_s3_failures_total 4\n")
+	require.Contains(t, body, "seb_s3_fast_fails_total 2\n")
+	require.Contains(t, body, "seb_s3_breaker_opened_total 1\n")
+	require.Contains(t, body, "# TYPE seb_s3_breaker_state gauge\n")
+	require.Contains(t, body, `seb_s3_breaker_state{state="closed"} 0`+"\n")
+	require.Contains(t, body, `seb_s3_breaker_state{state="open"} 1`+"\n")
+	require.Contains(t, body, `seb_s3_breaker_state{state="half-open"} 0`+"\n")
+
+	// Act
+	server = tester.HTTPServer(t)
+	defer server.Close()
+	response = server.DoWithAuth(httptest.NewRequest("GET", "/metrics", nil))
+
+	// Assert
+	bs, err = io.ReadAll(response.Body)
+	require.NoError(t, err)
+	require.NotContains(t, string(bs), "seb_s3_")
+}
+
+type s3UploadStats sebtopic.UploadStats
+
+func (s s3UploadStats) UploadStats() sebtopic.UploadStats {
+	return sebtopic.UploadStats(s)
+}
+
+// TestGetMetricsS3Uploads verifies that GET /metrics returns the upload queue
+// length and wait time of each topic whose uploads have been queued, and that
+// they're left out when uploads to S3 aren't limited.
+func TestGetMetricsS3Uploads(t *testing.T) {
+	tests := map[string]struct {
+		stats    s3UploadStats
+		expected []string
+		notFound []string
+	}{
+		"limited": {
+			stats: s3UploadStats{
+				MaxInFlight:     2,
+				InFlight:        2,
+				Queued:          3,
+				QueuedByTopic:   map[string]int{"a": 3},
+				Uploads:         10,
+				Waited:          6,
+				WaitTimeByTopic: map[string]time.Duration{"a": time.Second, "b": 1500 * time.Millisecond},
+			},
+			expected: []string{
+				"seb_s3_uploads_max_in_flight 2\n",
+				"seb_s3_uploads_in_flight 2\n",
+				"seb_s3_uploads_total 10\n",
+				"seb_s3_uploads_waited_total 6\n",
+				"# TYPE seb_s3_upload_queue_length gauge\n",
+				`seb_s3_upload_queue_length{topic="a"} 3` + "\n",
+				`seb_s3_upload_queue_length{topic="b"} 0` + "\n",
+				"# TYPE seb_s3_upload_wait_seconds_total counter\n",
+				`seb_s3_upload_wait_seconds_total{topic="a"} 1` + "\n",
+				`seb_s3_upload_wait_seconds_total{topic="b"} 1.5` + "\n",
+			},
+		},
+		"not limited": {
+			stats:    s3UploadStats{},
+			notFound: []string{"seb_s3_upload"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := tester.HTTPServer(t, tester.HTTPMonitoring(httphandlers.Monitoring{S3Uploads: test.stats}))
+			defer server.Close()
+
+			// Act
+			response := server.DoWithAuth(httptest.NewRequest("GET", "/metrics", nil))
+
+			// Assert
+			require.Equal(t, http.StatusOK, response.StatusCode)
+
+			bs, err := io.ReadAll(response.Body)
+			require.NoError(t, err)
+
+			body := string(bs)
+			for _, expected := range test.expected {
+				require.Contains(t, body, expected)
+			}
+			for _, notFound := range test.notFound {
+				require.NotContains(t, body, notFound)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package httphandlers
+
+import (
+	"context"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/micvbang/go-helpy/syncy"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+type RecordsSampler interface {
+	SampleRecords(ctx context.Context, batch *sebrecords.Batch, topicName string, input sebtopic.SampleInput) ([]uint64, error)
+}
+
+// RecordOffsetsHeader is the response header containing the comma separated
+// offsets of the returned records.
+const RecordOffsetsHeader = "Record-Offsets"
+
+const (
+	numRecordsKey  = "num-records"
+	startOffsetKey = "start-offset"
+	endOffsetKey   = "end-offset"
+	fromKey        = "from"
+	toKey          = "to"
+)
+
+// SampleRecords returns a uniform random sample of records from a topic,
+// optionally limited to an offset and/or time range.
+func SampleRecords(log logger.Logger, batchPool *syncy.Pool[*sebrecords.Batch], s RecordsSampler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		params, err := parseQueryParams(r,
+			QParam{Key: topicNameKey, Parser: QueryString},
+			QParam{Key: numRecordsKey, Parser: QueryIntDefault(10)},
+			QParam{Key: startOffsetKey, Parser: QueryUint64Default(0)},
+			QParam{Key: endOffsetKey, Parser: QueryUint64Default(0)},
+			QParam{Key: fromKey, Parser: QueryTimeOptional},
+			QParam{Key: toKey, Parser: QueryTimeOptional},
+		)
+		if err != nil {
+			httphelpers.WriteErrorf(w, http.StatusBadRequest, "parsing url params: %w", err)
+			return
+		}
+
+		topicName := params[topicNameKey].(string)
+		input := sebtopic.SampleInput{
+			NumRecords:  params[numRecordsKey].(int),
+			StartOffset: params[startOffsetKey].(uint64),
+			EndOffset:   params[endOffsetKey].(uint64),
+			From:        params[fromKey].(time.Time),
+			To:          params[toKey].(time.Time),
+		}
+
+		batch := batchPool.Get()
+		batch.Reset()
+		defer batchPool.Put(batch)
+
+		if input.NumRecords <= 0 || input.NumRecords > cap(batch.Sizes) {
+			httphelpers.WriteErrorf(w, http.StatusBadRequest, "%s must be in range [1; %d]", numRecordsKey, cap(batch.Sizes))
+			return
+		}
+
+		if input.EndOffset != 0 && input.StartOffset >= input.EndOffset {
+			httphelpers.WriteErrorf(w, http.StatusBadRequest, "%s must be less than %s", startOffsetKey, endOffsetKey)
+			return
+		}
+
+		if !input.From.IsZero() && !input.To.IsZero() && input.To.Before(input.From) {
+			httphelpers.WriteErrorf(w, http.StatusBadRequest, "%s must not be before %s", toKey, fromKey)
+			return
+		}
+
+		offsets, err := s.SampleRecords(r.Context(), batch, topicName, input)
+		if err != nil {
+			if errors.Is(err, seberr.ErrTopicNotFound) {
+				httphelpers.WriteErrorf(w, http.StatusNotFound, "topic not found")
+				return
+			}
+
+			if errors.Is(err, seberr.ErrBufferTooSmall) {
+				httphelpers.WriteErrorf(w, http.StatusRequestEntityTooLarge, "sampled records too large; reduce %s", numRecordsKey)
+				return
+			}
+
+			log.Errorf("sampling records: %s", err)
+			httphelpers.WriteErrorf(w, http.StatusInternalServerError, "failed to sample records: %w", err)
+			return
+		}
+
+		offsetStrs := make([]string, len(offsets))
+		for i, offset := range offsets {
+			offsetStrs[i] = strconv.FormatUint(offset, 10)
+		}
+
+		mw := multipart.NewWriter(w)
+		defer mw.Close()
+		w.Header().Set("Content-Type", mw.FormDataContentType())
+		w.Header().Set(RecordOffsetsHeader, strings.Join(offsetStrs, ","))
+
+		err = httphelpers.RecordsToMultipartFormDataHTTP(mw, batch.Sizes, batch.Data)
+		if err != nil {
+			log.Errorf("writing record multipart form data: %s", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package httphandlers_test
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/httphandlers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSampleRecordsHappyPath verifies that GET /records/sample passes the
+// query parameters on to SampleRecords, and returns the sampled records and
+// their offsets.
+func TestSampleRecordsHappyPath(t *testing.T) {
+	expectedBatch := tester.MakeRandomRecordBatch(3)
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	deps := &httphandlers.MockDependencies{}
+	deps.SampleRecordsMock = func(ctx context.Context, batch *sebrecords.Batch, topicName string, input sebtopic.SampleInput) ([]uint64, error) {
+		batch.Sizes = append(batch.Sizes, expectedBatch.Sizes...)
+		batch.Data = append(batch.Data, expectedBatch.Data...)
+		return []uint64{3, 17, 42}, nil
+	}
+
+	server := tester.HTTPServer(t, tester.HTTPDependencies(deps))
+	defer server.Close()
+
+	r := httptest.NewRequest("GET", "/records/sample", nil)
+	httphelpers.AddQueryParams(r, map[string]string{
+		"topic-name":   "topic",
+		"num-records":  "3",
+		"start-offset": "1",
+		"end-offset":   "50",
+		"from":         from.Format(time.RFC3339),
+	})
+
+	// Act
+	response := server.DoWithAuth(r)
+
+	// Assert
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.Equal(t, "3,17,42", response.Header.Get(httphandlers.RecordOffsetsHeader))
+
+	call := deps.SampleRecordsCalls[0]
+	require.Equal(t, "topic", call.TopicName)
+	require.Equal(t, sebtopic.SampleInput{
+		NumRecords:  3,
+		StartOffset: 1,
+		EndOffset:   50,
+		From:        from,
+	}, call.Input)
+
+	_, params, err := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	require.NoError(t, err)
+
+	gotBatch := tester.NewBatch(3, 4096)
+	err = httphelpers.MultipartFormDataToRecords(response.Body, params["boundary"], &gotBatch)
+	require.NoError(t, err)
+	require.Equal(t, expectedBatch.IndividualRecords(), gotBatch.IndividualRecords())
+}
+
+// TestSampleRecordsErrors verifies that GET /records/sample returns the
+// expected status codes on bad input and errors.
+func TestSampleRecordsErrors(t *testing.T) {
+	tests := map[string]struct {
+		params             map[string]string
+		err                error
+		expectedStatusCode int
+	}{
+		"missing topic name": {
+			params:             map[string]string{},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"invalid time": {
+			params:             map[string]string{"topic-name": "topic", "from": "yesterday"},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"too many records": {
+			params:             map[string]string{"topic-name": "topic", "num-records": "1000000000"},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"invalid num records": {
+			params:             map[string]string{"topic-name": "topic", "num-records": "ten"},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"empty offset range": {
+			params:             map[string]string{"topic-name": "topic", "start-offset": "10", "end-offset": "10"},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"inverted time range": {
+			params:             map[string]string{"topic-name": "topic", "from": "2024-01-02T00:00:00Z", "to": "2024-01-01T00:00:00Z"},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"topic not found": {
+			params:             map[string]string{"topic-name": "topic"},
+			err:                seberr.ErrTopicNotFound,
+			expectedStatusCode: http.StatusNotFound,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			deps := &httphandlers.MockDependencies{}
+			deps.SampleRecordsMock = func(ctx context.Context, batch *sebrecords.Batch, topicName string, input sebtopic.SampleInput) ([]uint64, error) {
+				return nil, test.err
+			}
+
+			server := tester.HTTPServer(t, tester.HTTPDependencies(deps))
+			defer server.Close()
+
+			r := httptest.NewRequest("GET", "/records/sample", nil)
+			httphelpers.AddQueryParams(r, test.params)
+
+			// Act
+			response := server.DoWithAuth(r)
+
+			// Assert
+			require.Equal(t, test.expectedStatusCode, response.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package httphandlers
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+)
+
+type ScrubStatsGetter interface {
+	Stats() sebbroker.ScrubStats
+}
+
+// scrubMetrics are the scrubbing metrics exposed by GetMetrics.
+var scrubMetrics = []struct {
+	name  string
+	help  string
+	value func(sebbroker.ScrubStats) uint64
+}{
+	{"seb_scrub_runs_total", "Number of completed scrubs of all topics.", func(s sebbroker.ScrubStats) uint64 { return s.Runs }},
+	{"seb_scrub_record_batches_total", "Number of record batches that were scrubbed.", func(s sebbroker.ScrubStats) uint64 { return s.RecordBatches }},
+	{"seb_scrub_corrupt_total", "Number of corrupt record batches found by scrubbing.", func(s sebbroker.ScrubStats) uint64 { return s.Corrupt }},
+	{"seb_scrub_missing_total", "Number of missing record batches found by scrubbing.", func(s sebbroker.ScrubStats) uint64 { return s.Missing }},
+	{"seb_scrub_missing_large_records_total", "Number of missing large records found by scrubbing.", func(s sebbroker.ScrubStats) uint64 { return s.MissingLargeRecords }},
+	{"seb_scrub_repaired_total", "Number of record batches that were repaired by scrubbing.", func(s sebbroker.ScrubStats) uint64 { return s.Repaired }},
+	{"seb_scrub_quarantined_total", "Number of record batches that were quarantined by scrubbing.", func(s sebbroker.ScrubStats) uint64 { return s.Quarantined }},
+}
+
+func writeScrubMetrics(w io.Writer, s ScrubStatsGetter) {
+	stats := s.Stats()
+	for _, metric := range scrubMetrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", metric.name, metric.help)
+		fmt.Fprintf(w, "# TYPE %s counter\n", metric.name)
+		fmt.Fprintf(w, "%s %d\n", metric.name, metric.value(stats))
+	}
+
+	// NOTE: the timestamp is left out until the first scrub has completed,
+	// rather than reporting the unix epoch.
+	if !stats.LastRunAt.IsZero() {
+		const lastRunAt = "seb_scrub_last_run_timestamp_seconds"
+		fmt.Fprintf(w, "# HELP %s %s\n", lastRunAt, "Unix time of the latest completed scrub of all topics.")
+		fmt.Fprintf(w, "# TYPE %s gauge\n", lastRunAt)
+		fmt.Fprintf(w, "%s %d\n", lastRunAt, stats.LastRunAt.Unix())
+	}
+}
@@ -0,0 +1,68 @@
+package httphandlers_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/httphandlers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/stretchr/testify/require"
+)
+
+type scrubStats sebbroker.ScrubStats
+
+func (s scrubStats) Stats() sebbroker.ScrubStats {
+	return sebbroker.ScrubStats(s)
+}
+
+// TestGetMetricsScrub verifies that GET /metrics returns the number of
+// corrupt and missing record batches found by scrubbing, and that scrubbing
+// metrics are left out when the broker doesn't scrub.
+func TestGetMetricsScrub(t *testing.T) {
+	stats := scrubStats{
+		Runs:                2,
+		RecordBatches:       40,
+		Corrupt:             3,
+		Missing:             1,
+		MissingLargeRecords: 4,
+		Repaired:            2,
+		Quarantined:         1,
+		LastRunAt:           time.Unix(1700000000, 0),
+	}
+	server := tester.HTTPServer(t, tester.HTTPMonitoring(httphandlers.Monitoring{Scrub: stats}))
+	defer server.Close()
+
+	// Act
+	response := server.DoWithAuth(httptest.NewRequest("GET", "/metrics", nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	bs, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+
+	body := string(bs)
+	require.Contains(t, body, "# TYPE seb_scrub_corrupt_total counter\n")
+	require.Contains(t, body, "seb_scrub_runs_total 2\n")
+	require.Contains(t, body, "seb_scrub_record_batches_total 40\n")
+	require.Contains(t, body, "seb_scrub_corrupt_total 3\n")
+	require.Contains(t, body, "seb_scrub_missing_total 1\n")
+	require.Contains(t, body, "seb_scrub_missing_large_records_total 4\n")
+	require.Contains(t, body, "seb_scrub_repaired_total 2\n")
+	require.Contains(t, body, "seb_scrub_quarantined_total 1\n")
+	require.Contains(t, body, "seb_scrub_last_run_timestamp_seconds 1700000000\n")
+
+	// Act
+	server = tester.HTTPServer(t)
+	defer server.Close()
+	response = server.DoWithAuth(httptest.NewRequest("GET", "/metrics", nil))
+
+	// Assert
+	bs, err = io.ReadAll(response.Body)
+	require.NoError(t, err)
+	require.NotContains(t, string(bs), "seb_scrub_")
+}
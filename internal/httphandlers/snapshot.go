@@ -0,0 +1,32 @@
+package httphandlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+)
+
+type Snapshotter interface {
+	Snapshot(ctx context.Context) (sebbroker.Snapshot, error)
+}
+
+// CreateSnapshot makes a snapshot of the broker's topics and returns its
+// manifest, which can be restored to other storage using `seb restore`.
+// Writes are briefly fenced while the snapshot is being made.
+func CreateSnapshot(log logger.Logger, s Snapshotter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		snapshot, err := s.Snapshot(r.Context())
+		if err != nil {
+			log.Errorf("making snapshot: %s", err)
+			httphelpers.WriteErrorf(w, http.StatusInternalServerError, "failed to make snapshot: %w", err)
+			return
+		}
+
+		httphelpers.WriteJSON(w, &snapshot)
+	}
+}
@@ -0,0 +1,38 @@
+package httphandlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCreateSnapshot verifies that POST /admin/snapshot returns the manifest
+// of a snapshot of the broker's topics.
+func TestCreateSnapshot(t *testing.T) {
+	const topicName = "topic"
+
+	server := tester.HTTPServer(t)
+	defer server.Close()
+
+	response := server.DoWithAuth(addRecordsRequest(t, topicName))
+	require.Equal(t, http.StatusCreated, response.StatusCode)
+
+	// Act
+	response = server.DoWithAuth(httptest.NewRequest("POST", "/admin/snapshot", nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	snapshot := sebbroker.Snapshot{}
+	err := httphelpers.ParseJSONAndClose(response.Body, &snapshot)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(snapshot.Topics))
+	require.Equal(t, topicName, snapshot.Topics[0].TopicName)
+	require.Equal(t, uint64(1), snapshot.Topics[0].NextOffset)
+	require.NotEmpty(t, snapshot.Topics[0].Files)
+}
@@ -0,0 +1,120 @@
+package httphandlers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+type TopicAdministrator interface {
+	CreateTopic(topicName string) error
+	DeleteTopic(topicName string) error
+	TopicNames() []string
+}
+
+type ListTopicsOutput struct {
+	TopicNames []string `json:"topic_names"`
+}
+
+// CreateTopic creates a topic with the given name.
+func CreateTopic(log logger.Logger, s TopicAdministrator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		params, err := parseQueryParams(r, QParam{topicNameKey, QueryString})
+		if err != nil {
+			httphelpers.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		topicName := params[topicNameKey].(string)
+
+		if !requireInternalTopicAccess(log, w, r, topicName) {
+			return
+		}
+
+		err = s.CreateTopic(topicName)
+		if err != nil {
+			if errors.Is(err, seberr.ErrTopicAlreadyExists) {
+				log.Debugf("already exists")
+				httphelpers.WriteError(w, http.StatusConflict, err)
+				return
+			}
+
+			log.Errorf("creating topic: %s", err)
+			httphelpers.WriteErrorf(w, http.StatusInternalServerError, "failed to create topic '%s': %w", topicName, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+// DeleteTopic deletes the topic with the given name, including all of its
+// records.
+func DeleteTopic(log logger.Logger, s TopicAdministrator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		params, err := parseQueryParams(r, QParam{topicNameKey, QueryString})
+		if err != nil {
+			httphelpers.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		topicName := params[topicNameKey].(string)
+
+		if !requireInternalTopicAccess(log, w, r, topicName) {
+			return
+		}
+
+		err = s.DeleteTopic(topicName)
+		if err != nil {
+			if errors.Is(err, seberr.ErrTopicNotFound) {
+				log.Debugf("not found")
+				httphelpers.WriteError(w, http.StatusNotFound, err)
+				return
+			}
+
+			log.Errorf("deleting topic: %s", err)
+			httphelpers.WriteErrorf(w, http.StatusInternalServerError, "failed to delete topic '%s': %w", topicName, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ListTopics returns the names of the topics that were created or used since
+// the broker started. Internal topics are only listed if requested using the
+// internal query parameter, which requires admin access.
+func ListTopics(log logger.Logger, s TopicAdministrator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		params, err := parseQueryParams(r, QParam{internalKey, QueryBoolDefault(false)})
+		if err != nil {
+			httphelpers.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		internal := params[internalKey].(bool)
+
+		if internal && !accessFromContext(r.Context()).Admin {
+			log.Infof("not allowed to list internal topics")
+			httphelpers.WriteErrorf(w, http.StatusForbidden, "%s", "internal topics can only be listed by admins")
+			return
+		}
+
+		topicNames := s.TopicNames()
+		if !internal {
+			topicNames = slices.DeleteFunc(topicNames, sebbroker.IsInternalTopic)
+		}
+
+		httphelpers.WriteJSON(w, &ListTopicsOutput{
+			TopicNames: topicNames,
+		})
+	}
+}
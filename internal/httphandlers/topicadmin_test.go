@@ -0,0 +1,57 @@
+package httphandlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/httphandlers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTopicAdministration verifies that POST /topic, DELETE /topic and
+// GET /topics create, delete and list topics, and return the expected status
+// codes.
+func TestTopicAdministration(t *testing.T) {
+	const topicName = "topic"
+
+	server := tester.HTTPServer(t, tester.HTTPBrokerAutoCreateTopic(false))
+	defer server.Close()
+
+	topicRequest := func(method string) *http.Request {
+		r := httptest.NewRequest(method, "/topic", nil)
+		httphelpers.AddQueryParams(r, map[string]string{
+			"topic-name": topicName,
+		})
+		return r
+	}
+
+	listTopics := func() []string {
+		response := server.DoWithAuth(httptest.NewRequest("GET", "/topics", nil))
+		require.Equal(t, http.StatusOK, response.StatusCode)
+
+		output := httphandlers.ListTopicsOutput{}
+		err := httphelpers.ParseJSONAndClose(response.Body, &output)
+		require.NoError(t, err)
+		return output.TopicNames
+	}
+
+	// Act, Assert
+	response := server.DoWithAuth(topicRequest("POST"))
+	require.Equal(t, http.StatusCreated, response.StatusCode)
+
+	response = server.DoWithAuth(topicRequest("POST"))
+	require.Equal(t, http.StatusConflict, response.StatusCode)
+
+	require.Equal(t, []string{topicName}, listTopics())
+
+	response = server.DoWithAuth(topicRequest("DELETE"))
+	require.Equal(t, http.StatusNoContent, response.StatusCode)
+
+	response = server.DoWithAuth(topicRequest("DELETE"))
+	require.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	require.Empty(t, listTopics())
+}
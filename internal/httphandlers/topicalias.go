@@ -0,0 +1,105 @@
+package httphandlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+type TopicAliaser interface {
+	SetTopicAlias(ctx context.Context, alias string, topicName string) error
+	RemoveTopicAlias(ctx context.Context, alias string) error
+	TopicAliases() map[string]string
+}
+
+type TopicAliasesOutput struct {
+	// Aliases maps aliases to the names of the topics they refer to.
+	Aliases map[string]string `json:"aliases"`
+}
+
+// ListTopicAliases returns all topic aliases.
+func ListTopicAliases(log logger.Logger, s TopicAliaser) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		httphelpers.WriteJSON(w, &TopicAliasesOutput{
+			Aliases: s.TopicAliases(),
+		})
+	}
+}
+
+// SetTopicAlias makes the given alias refer to the given topic, such that
+// records can be added to and read from the topic using the alias.
+func SetTopicAlias(log logger.Logger, s TopicAliaser) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		params, err := parseQueryParams(r,
+			QParam{aliasKey, QueryString},
+			QParam{topicNameKey, QueryString},
+		)
+		if err != nil {
+			httphelpers.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		alias := params[aliasKey].(string)
+		topicName := params[topicNameKey].(string)
+
+		// aliases of internal topics would allow producing to them
+		if !requireInternalTopicAccess(log, w, r, alias, topicName) {
+			return
+		}
+
+		err = s.SetTopicAlias(r.Context(), alias, topicName)
+		if err != nil {
+			if errors.Is(err, seberr.ErrTopicAlreadyExists) {
+				log.Debugf("topic already exists: %s", err)
+				httphelpers.WriteError(w, http.StatusConflict, err)
+				return
+			}
+
+			if errors.Is(err, seberr.ErrBadInput) {
+				log.Debugf("bad input: %s", err)
+				httphelpers.WriteError(w, http.StatusBadRequest, err)
+				return
+			}
+
+			log.Errorf("setting topic alias: %s", err)
+			httphelpers.WriteErrorf(w, http.StatusInternalServerError, "failed to set alias '%s' of topic '%s': %w", alias, topicName, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RemoveTopicAlias removes the given alias.
+func RemoveTopicAlias(log logger.Logger, s TopicAliaser) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		params, err := parseQueryParams(r, QParam{aliasKey, QueryString})
+		if err != nil {
+			httphelpers.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		alias := params[aliasKey].(string)
+
+		if !requireInternalTopicAccess(log, w, r, alias) {
+			return
+		}
+
+		err = s.RemoveTopicAlias(r.Context(), alias)
+		if err != nil {
+			log.Errorf("removing topic alias: %s", err)
+			httphelpers.WriteErrorf(w, http.StatusInternalServerError, "failed to remove alias '%s': %w", alias, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,93 @@
+package httphandlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/httphandlers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSetTopicAlias verifies that PUT /admin/topic/alias makes records added
+// using the alias go to the aliased topic, that GET /admin/topic/aliases
+// returns the alias, and that DELETE /admin/topic/alias removes it.
+func TestSetTopicAlias(t *testing.T) {
+	const (
+		topicName = "new-name"
+		alias     = "old-name"
+	)
+
+	server := tester.HTTPServer(t)
+	defer server.Close()
+
+	r := httptest.NewRequest("PUT", "/admin/topic/alias", nil)
+	httphelpers.AddQueryParams(r, map[string]string{
+		"alias":      alias,
+		"topic-name": topicName,
+	})
+
+	// Act
+	response := server.DoWithAuth(r)
+
+	// Assert
+	require.Equal(t, http.StatusNoContent, response.StatusCode)
+
+	response = server.DoWithAuth(addRecordsRequest(t, alias))
+	require.Equal(t, http.StatusCreated, response.StatusCode)
+
+	metadata, err := server.Broker.Metadata(topicName)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), metadata.NextOffset)
+
+	response = server.DoWithAuth(httptest.NewRequest("GET", "/admin/topic/aliases", nil))
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	output := httphandlers.TopicAliasesOutput{}
+	err = httphelpers.ParseJSONAndClose(response.Body, &output)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{alias: topicName}, output.Aliases)
+
+	r = httptest.NewRequest("DELETE", "/admin/topic/alias", nil)
+	httphelpers.AddQueryParams(r, map[string]string{
+		"alias": alias,
+	})
+	response = server.DoWithAuth(r)
+	require.Equal(t, http.StatusNoContent, response.StatusCode)
+	require.Empty(t, server.Broker.TopicAliases())
+}
+
+// TestSetTopicAliasErrors verifies that PUT /admin/topic/alias returns the
+// expected status codes when the alias can't be set.
+func TestSetTopicAliasErrors(t *testing.T) {
+	tests := map[string]struct {
+		params     map[string]string
+		statusCode int
+	}{
+		"missing alias":       {params: map[string]string{"topic-name": "topic"}, statusCode: http.StatusBadRequest},
+		"alias of itself":     {params: map[string]string{"alias": "topic", "topic-name": "topic"}, statusCode: http.StatusBadRequest},
+		"alias is topic name": {params: map[string]string{"alias": "existing", "topic-name": "topic"}, statusCode: http.StatusConflict},
+		"missing topic name":  {params: map[string]string{"alias": "alias"}, statusCode: http.StatusBadRequest},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := tester.HTTPServer(t)
+			defer server.Close()
+
+			response := server.DoWithAuth(addRecordsRequest(t, "existing"))
+			require.Equal(t, http.StatusCreated, response.StatusCode)
+
+			r := httptest.NewRequest("PUT", "/admin/topic/alias", nil)
+			httphelpers.AddQueryParams(r, test.params)
+
+			// Act
+			response = server.DoWithAuth(r)
+
+			// Assert
+			require.Equal(t, test.statusCode, response.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package httphandlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+type TopicSealer interface {
+	SealTopic(topicName string) (uint64, error)
+}
+
+type SealTopicOutput struct {
+	NextOffset uint64 `json:"next_offset"`
+}
+
+// SealTopic permanently closes the given topic for writes, returning its final
+// next offset.
+func SealTopic(log logger.Logger, s TopicSealer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		params, err := parseQueryParams(r, QParam{topicNameKey, QueryString})
+		if err != nil {
+			httphelpers.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		topicName := params[topicNameKey].(string)
+
+		if !requireInternalTopicAccess(log, w, r, topicName) {
+			return
+		}
+
+		nextOffset, err := s.SealTopic(topicName)
+		if err != nil {
+			if errors.Is(err, seberr.ErrTopicNotFound) {
+				log.Debugf("not found")
+				httphelpers.WriteError(w, http.StatusNotFound, err)
+				return
+			}
+
+			if errors.Is(err, seberr.ErrWritesFrozen) {
+				log.Infof("writes frozen: %s", err)
+				httphelpers.WriteError(w, http.StatusServiceUnavailable, err)
+				return
+			}
+
+			log.Errorf("sealing topic: %s", err)
+			httphelpers.WriteErrorf(w, http.StatusInternalServerError, "failed to seal topic '%s': %w", topicName, err)
+			return
+		}
+
+		httphelpers.WriteJSON(w, &SealTopicOutput{
+			NextOffset: nextOffset,
+		})
+	}
+}
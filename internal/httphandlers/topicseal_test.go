@@ -0,0 +1,69 @@
+package httphandlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/httphandlers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSealTopic verifies that POST /admin/topic/seal returns the topic's final
+// next offset, and that POST /records to the sealed topic returns
+// http.StatusServiceUnavailable with the topic_sealed error code.
+func TestSealTopic(t *testing.T) {
+	const topicName = "topic"
+
+	server := tester.HTTPServer(t)
+	defer server.Close()
+
+	response := server.DoWithAuth(addRecordsRequest(t, topicName))
+	require.Equal(t, http.StatusCreated, response.StatusCode)
+
+	r := httptest.NewRequest("POST", "/admin/topic/seal", nil)
+	httphelpers.AddQueryParams(r, map[string]string{
+		"topic-name": topicName,
+	})
+
+	// Act
+	response = server.DoWithAuth(r)
+
+	// Assert
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	output := httphandlers.SealTopicOutput{}
+	err := httphelpers.ParseJSONAndClose(response.Body, &output)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), output.NextOffset)
+
+	response = server.DoWithAuth(addRecordsRequest(t, topicName))
+	require.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+
+	errOutput := httphelpers.ErrorOutput{}
+	err = httphelpers.ParseJSONAndClose(response.Body, &errOutput)
+	require.NoError(t, err)
+	require.Equal(t, seberr.CodeTopicSealed, errOutput.Code)
+	require.False(t, errOutput.Retryable)
+}
+
+// TestSealTopicNotFound verifies that POST /admin/topic/seal returns
+// http.StatusNotFound when the topic does not exist.
+func TestSealTopicNotFound(t *testing.T) {
+	server := tester.HTTPServer(t, tester.HTTPBrokerAutoCreateTopic(false))
+	defer server.Close()
+
+	r := httptest.NewRequest("POST", "/admin/topic/seal", nil)
+	httphelpers.AddQueryParams(r, map[string]string{
+		"topic-name": "does-not-exist",
+	})
+
+	// Act
+	response := server.DoWithAuth(r)
+
+	// Assert
+	require.Equal(t, http.StatusNotFound, response.StatusCode)
+}
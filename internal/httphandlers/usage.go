@@ -0,0 +1,64 @@
+package httphandlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+)
+
+type UsageGetter interface {
+	Usage() map[string]sebbroker.TopicUsage
+}
+
+type TopicUsageOutput struct {
+	StorageBytes            int64     `json:"storage_bytes"`
+	StorageFiles            int       `json:"storage_files"`
+	StorageRecordBatchBytes int64     `json:"storage_record_batch_bytes"`
+	StorageRecordBatchFiles int       `json:"storage_record_batch_files"`
+	StorageLargeRecordBytes int64     `json:"storage_large_record_bytes"`
+	StorageLargeRecordFiles int       `json:"storage_large_record_files"`
+	StorageReconciledAt     time.Time `json:"storage_reconciled_at"`
+
+	CacheBytes int64 `json:"cache_bytes"`
+	CacheItems int   `json:"cache_items"`
+}
+
+func makeTopicUsageOutput(storage sebtopic.StorageUsage, cache sebcache.TopicUsage) TopicUsageOutput {
+	return TopicUsageOutput{
+		StorageBytes:            storage.Bytes(),
+		StorageFiles:            storage.Files(),
+		StorageRecordBatchBytes: storage.RecordBatchBytes,
+		StorageRecordBatchFiles: storage.RecordBatchFiles,
+		StorageLargeRecordBytes: storage.LargeRecordBytes,
+		StorageLargeRecordFiles: storage.LargeRecordFiles,
+		StorageReconciledAt:     storage.ReconciledAt,
+		CacheBytes:              cache.Bytes,
+		CacheItems:              cache.Items,
+	}
+}
+
+type GetUsageOutput struct {
+	Topics map[string]TopicUsageOutput `json:"topics"`
+}
+
+// GetUsage returns the storage and cache usage of each topic instantiated by
+// the broker, such that costs can be attributed to topics.
+func GetUsage(log logger.Logger, s UsageGetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		usage := s.Usage()
+
+		output := GetUsageOutput{Topics: make(map[string]TopicUsageOutput, len(usage))}
+		for topicName, topicUsage := range usage {
+			output.Topics[topicName] = makeTopicUsageOutput(topicUsage.Storage, topicUsage.Cache)
+		}
+
+		httphelpers.WriteJSON(w, &output)
+	}
+}
@@ -0,0 +1,54 @@
+package httphandlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/httphandlers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetUsage verifies that GET /admin/usage returns the storage and cache
+// usage of each of the broker's topics, and that GET /topic returns the usage
+// of the given topic.
+func TestGetUsage(t *testing.T) {
+	const topicName = "topic"
+
+	server := tester.HTTPServer(t)
+	defer server.Close()
+
+	response := server.DoWithAuth(addRecordsRequest(t, topicName))
+	require.Equal(t, http.StatusCreated, response.StatusCode)
+
+	// Act
+	response = server.DoWithAuth(httptest.NewRequest("GET", "/admin/usage", nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	output := httphandlers.GetUsageOutput{}
+	err := httphelpers.ParseJSONAndClose(response.Body, &output)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(output.Topics))
+
+	usage := output.Topics[topicName]
+	require.Equal(t, 1, usage.StorageRecordBatchFiles)
+	require.Equal(t, 1, usage.StorageFiles)
+	require.Less(t, int64(0), usage.StorageBytes)
+
+	// Act
+	r := httptest.NewRequest("GET", "/topic", nil)
+	httphelpers.AddQueryParams(r, map[string]string{"topic-name": topicName})
+	response = server.DoWithAuth(r)
+
+	// Assert
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	topicOutput := httphandlers.GetTopicOutput{}
+	err = httphelpers.ParseJSONAndClose(response.Body, &topicOutput)
+	require.NoError(t, err)
+	require.Equal(t, usage, topicOutput.Usage)
+}
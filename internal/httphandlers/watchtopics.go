@@ -0,0 +1,116 @@
+package httphandlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+)
+
+// watchHeartbeatInterval is the interval at which comments are written to
+// topic watch streams while no events happen, such that proxies don't close
+// them and disconnected clients are noticed.
+const watchHeartbeatInterval = 15 * time.Second
+
+type TopicWatcher interface {
+	Watch(ctx context.Context, optFuncs ...func(*sebbroker.WatchOpts)) <-chan sebbroker.TopicEvent
+}
+
+type TopicEventOutput struct {
+	TopicName  string `json:"topic_name"`
+	NextOffset uint64 `json:"next_offset"`
+}
+
+// WatchTopics streams events about topics being created or deleted, and
+// about their next offsets advancing, as server-sent events. The name of each
+// event is its type, i.e. "created", "deleted" or "advanced", and its data is
+// a TopicEventOutput.
+//
+// Events are limited to the topics given by the topic-name query parameter,
+// which can be given multiple times. Events of internal topics are only
+// streamed if internal=true is given, which requires admin access.
+//
+// The stream ends if the client falls behind such that events would be lost;
+// clients should then read the state of their topics before watching again.
+func WatchTopics(log logger.Logger, s TopicWatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		params, err := parseQueryParams(r, QParam{internalKey, QueryBoolDefault(false)})
+		if err != nil {
+			httphelpers.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		internal := params[internalKey].(bool)
+
+		if internal && !accessFromContext(r.Context()).Admin {
+			log.Infof("not allowed to watch internal topics")
+			httphelpers.WriteErrorf(w, http.StatusForbidden, "%s", "internal topics can only be watched by admins")
+			return
+		}
+
+		optFuncs := []func(*sebbroker.WatchOpts){}
+		if topicNames := r.URL.Query()[topicNameKey]; len(topicNames) > 0 {
+			optFuncs = append(optFuncs, sebbroker.WithWatchTopicNames(topicNames...))
+		}
+		events := s.Watch(r.Context(), optFuncs...)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+
+		rc := http.NewResponseController(w)
+		flush := func() error {
+			err := httphelpers.ExtendWriteDeadline(w, r, watchHeartbeatInterval)
+			if err != nil {
+				return err
+			}
+			return rc.Flush()
+		}
+
+		err = flush()
+		if err != nil {
+			log.Errorf("flushing topic watch stream: %s", err)
+			return
+		}
+
+		heartbeat := time.NewTicker(watchHeartbeatInterval)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				if !internal && sebbroker.IsInternalTopic(event.TopicName) {
+					continue
+				}
+
+				data, err := json.Marshal(TopicEventOutput{
+					TopicName:  event.TopicName,
+					NextOffset: event.NextOffset,
+				})
+				if err != nil {
+					log.Errorf("encoding topic event: %s", err)
+					return
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+			}
+
+			err = flush()
+			if err != nil {
+				log.Debugf("topic watch stream closed: %s", err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package httphandlers_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/httphandlers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWatchTopics verifies that WatchTopics() streams the events of the
+// requested topics as server-sent events, leaving out internal topics, until
+// the watch ends.
+func TestWatchTopics(t *testing.T) {
+	deps := &httphandlers.MockDependencies{}
+	deps.WatchMock = func(ctx context.Context, optFuncs ...func(*sebbroker.WatchOpts)) <-chan sebbroker.TopicEvent {
+		events := make(chan sebbroker.TopicEvent, 3)
+		events <- sebbroker.TopicEvent{Type: sebbroker.TopicEventCreated, TopicName: "topic"}
+		events <- sebbroker.TopicEvent{Type: sebbroker.TopicEventAdvanced, TopicName: "_audit", NextOffset: 1}
+		events <- sebbroker.TopicEvent{Type: sebbroker.TopicEventAdvanced, TopicName: "topic", NextOffset: 42}
+		close(events)
+		return events
+	}
+
+	server := tester.HTTPServer(t, tester.HTTPDependencies(deps))
+	defer server.Close()
+
+	// Act
+	response := server.DoWithAuth(httptest.NewRequest("GET", "/topics/watch?topic-name=topic&topic-name=_audit", nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	expected := "event: created\ndata: {\"topic_name\":\"topic\",\"next_offset\":0}\n\n" +
+		"event: advanced\ndata: {\"topic_name\":\"topic\",\"next_offset\":42}\n\n"
+	require.Equal(t, expected, string(body))
+
+	require.Len(t, deps.WatchCalls, 1)
+	opts := sebbroker.WatchOpts{}
+	for _, optFunc := range deps.WatchCalls[0].OptFuncs {
+		optFunc(&opts)
+	}
+	require.Equal(t, []string{"topic", "_audit"}, opts.TopicNames)
+}
+
+// TestWatchTopicsInternalForbidden verifies that only admins can watch
+// internal topics.
+func TestWatchTopicsInternalForbidden(t *testing.T) {
+	server := tester.HTTPServer(t, tester.HTTPDependencies(&httphandlers.MockDependencies{}))
+	defer server.Close()
+
+	// Act
+	response := server.DoWithAuth(httptest.NewRequest("GET", "/topics/watch?internal=true", nil))
+
+	// Assert
+	require.Equal(t, http.StatusForbidden, response.StatusCode)
+}
@@ -0,0 +1,111 @@
+package httphandlers
+
+import (
+	"net/http"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+)
+
+type WriteFreezer interface {
+	SetMaintenanceMode(enabled bool)
+	MaintenanceMode() bool
+	SetTopicWritesFrozen(topicName string, frozen bool)
+	WritesFrozen(topicName string) bool
+}
+
+type MaintenanceModeInput struct {
+	Enabled bool `json:"enabled"`
+}
+
+type MaintenanceModeOutput struct {
+	Enabled bool `json:"enabled"`
+}
+
+type TopicWriteFreezeInput struct {
+	Frozen bool `json:"frozen"`
+}
+
+type TopicWriteFreezeOutput struct {
+	Frozen bool `json:"frozen"`
+}
+
+// GetMaintenanceMode returns whether the broker is in maintenance mode.
+func GetMaintenanceMode(log logger.Logger, s WriteFreezer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		httphelpers.WriteJSON(w, &MaintenanceModeOutput{
+			Enabled: s.MaintenanceMode(),
+		})
+	}
+}
+
+// SetMaintenanceMode enables or disables maintenance mode. While maintenance
+// mode is enabled, all writes are rejected.
+func SetMaintenanceMode(log logger.Logger, s WriteFreezer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		input := MaintenanceModeInput{}
+		err := httphelpers.ParseJSONAndClose(r.Body, &input)
+		if err != nil {
+			httphelpers.WriteErrorf(w, http.StatusBadRequest, "parsing json body: %w", err)
+			return
+		}
+
+		s.SetMaintenanceMode(input.Enabled)
+
+		httphelpers.WriteJSON(w, &MaintenanceModeOutput{
+			Enabled: s.MaintenanceMode(),
+		})
+	}
+}
+
+// GetTopicWriteFreeze returns whether writes to the given topic are frozen,
+// either because the topic is frozen or because the broker is in maintenance
+// mode.
+func GetTopicWriteFreeze(log logger.Logger, s WriteFreezer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		params, err := parseQueryParams(r, QParam{topicNameKey, QueryString})
+		if err != nil {
+			httphelpers.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		topicName := params[topicNameKey].(string)
+
+		httphelpers.WriteJSON(w, &TopicWriteFreezeOutput{
+			Frozen: s.WritesFrozen(topicName),
+		})
+	}
+}
+
+// SetTopicWriteFreeze freezes or unfreezes writes to the given topic.
+func SetTopicWriteFreeze(log logger.Logger, s WriteFreezer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Debugf("hit %s", r.URL)
+
+		params, err := parseQueryParams(r, QParam{topicNameKey, QueryString})
+		if err != nil {
+			r.Body.Close()
+			httphelpers.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		topicName := params[topicNameKey].(string)
+
+		input := TopicWriteFreezeInput{}
+		err = httphelpers.ParseJSONAndClose(r.Body, &input)
+		if err != nil {
+			httphelpers.WriteErrorf(w, http.StatusBadRequest, "parsing json body: %w", err)
+			return
+		}
+
+		s.SetTopicWritesFrozen(topicName, input.Frozen)
+
+		httphelpers.WriteJSON(w, &TopicWriteFreezeOutput{
+			Frozen: s.WritesFrozen(topicName),
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package httphandlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/httphandlers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSetMaintenanceMode verifies that PUT /admin/maintenance toggles
+// maintenance mode, and that POST /records returns
+// http.StatusServiceUnavailable with a Retry-After header while maintenance
+// mode is enabled.
+func TestSetMaintenanceMode(t *testing.T) {
+	server := tester.HTTPServer(t)
+	defer server.Close()
+
+	for _, enabled := range []bool{true, false} {
+		r := httptest.NewRequest("PUT", "/admin/maintenance", jsonBody(t, httphandlers.MaintenanceModeInput{Enabled: enabled}))
+
+		// Act
+		response := server.DoWithAuth(r)
+
+		// Assert
+		require.Equal(t, http.StatusOK, response.StatusCode)
+
+		output := httphandlers.MaintenanceModeOutput{}
+		err := httphelpers.ParseJSONAndClose(response.Body, &output)
+		require.NoError(t, err)
+		require.Equal(t, enabled, output.Enabled)
+		require.Equal(t, enabled, server.Broker.MaintenanceMode())
+
+		response = server.DoWithAuth(addRecordsRequest(t, "topic"))
+		if enabled {
+			require.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+			require.NotEmpty(t, response.Header.Get("Retry-After"))
+		} else {
+			require.Equal(t, http.StatusCreated, response.StatusCode)
+		}
+	}
+}
+
+// TestSetTopicWriteFreeze verifies that PUT /admin/topic/freeze freezes writes
+// only to the given topic.
+func TestSetTopicWriteFreeze(t *testing.T) {
+	const (
+		frozenTopic   = "frozen"
+		unfrozenTopic = "unfrozen"
+	)
+
+	server := tester.HTTPServer(t)
+	defer server.Close()
+
+	r := httptest.NewRequest("PUT", "/admin/topic/freeze", jsonBody(t, httphandlers.TopicWriteFreezeInput{Frozen: true}))
+	httphelpers.AddQueryParams(r, map[string]string{
+		"topic-name": frozenTopic,
+	})
+
+	// Act
+	response := server.DoWithAuth(r)
+
+	// Assert
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	output := httphandlers.TopicWriteFreezeOutput{}
+	err := httphelpers.ParseJSONAndClose(response.Body, &output)
+	require.NoError(t, err)
+	require.True(t, output.Frozen)
+
+	response = server.DoWithAuth(addRecordsRequest(t, frozenTopic))
+	require.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+
+	response = server.DoWithAuth(addRecordsRequest(t, unfrozenTopic))
+	require.Equal(t, http.StatusCreated, response.StatusCode)
+}
+
+// TestSetTopicWriteFreezeMissingTopic verifies that http.StatusBadRequest is
+// returned when leaving out the required topic-name query parameter.
+func TestSetTopicWriteFreezeMissingTopic(t *testing.T) {
+	server := tester.HTTPServer(t)
+	defer server.Close()
+
+	r := httptest.NewRequest("PUT", "/admin/topic/freeze", jsonBody(t, httphandlers.TopicWriteFreezeInput{Frozen: true}))
+
+	// Act
+	response := server.DoWithAuth(r)
+
+	// Assert
+	require.Equal(t, http.StatusBadRequest, response.StatusCode)
+}
+
+func jsonBody(t *testing.T, v any) *bytes.Buffer {
+	bs, err := json.Marshal(v)
+	require.NoError(t, err)
+	return bytes.NewBuffer(bs)
+}
+
+func addRecordsRequest(t *testing.T, topicName string) *http.Request {
+	batch := tester.MakeRandomRecordBatch(1)
+
+	buf := bytes.NewBuffer(nil)
+	contentType, err := httphelpers.RecordsToMultipartFormData(buf, batch.Sizes, batch.Data)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest("POST", "/records", buf)
+	r.Header.Add("Content-Type", contentType)
+	httphelpers.AddQueryParams(r, map[string]string{
+		"topic-name": topicName,
+	})
+	return r
+}
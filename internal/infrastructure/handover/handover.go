@@ -0,0 +1,197 @@
+// Package handover hands the listening socket of a running process over to a
+// newly started process, allowing the binary to be upgraded without refusing
+// connections.
+//
+// The listening socket is passed to the new process as an inherited file
+// descriptor, so connections that arrive during the handover wait in the
+// socket's accept queue instead of being refused. The new process signals
+// that it's ready to accept connections, after which the old process stops
+// accepting connections, finishes in-flight requests and signals that it's
+// done. Only then does the new process start serving, so the two processes
+// never write to the same topics at the same time.
+package handover
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+)
+
+const envVar = "SEB_HANDOVER"
+
+// File descriptors inherited by a process started by Upgrade. The first three
+// are stdin, stdout and stderr.
+const (
+	listenerFD = 3
+	readyFD    = 4
+	doneFD     = 5
+)
+
+// Inherited reports whether the process was started by Upgrade.
+func Inherited() bool {
+	return os.Getenv(envVar) == "1"
+}
+
+// Listen returns the listening socket inherited from the process that started
+// this one using Upgrade. If the process was not started by Upgrade, it listens
+// for TCP connections on address.
+func Listen(address string) (*net.TCPListener, error) {
+	if !Inherited() {
+		l, err := net.Listen("tcp", address)
+		if err != nil {
+			return nil, fmt.Errorf("listening on %s: %w", address, err)
+		}
+		return l.(*net.TCPListener), nil
+	}
+
+	f := os.NewFile(listenerFD, "listener")
+	defer f.Close()
+
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("using inherited listener: %w", err)
+	}
+
+	tcpListener, ok := l.(*net.TCPListener)
+	if !ok {
+		l.Close()
+		return nil, fmt.Errorf("inherited listener is %T, expected TCP listener", l)
+	}
+
+	return tcpListener, nil
+}
+
+// TakeOver signals to the process that started this one using Upgrade that it
+// is ready to accept connections, and blocks until that process is done
+// serving requests, it exits, or ctx expires.
+//
+// TakeOver must only be called when Inherited() returns true, and must be
+// called after Listen().
+func TakeOver(ctx context.Context) error {
+	ready := os.NewFile(readyFD, "ready")
+	_, err := ready.Write([]byte{1})
+	ready.Close()
+	if err != nil {
+		return fmt.Errorf("signaling ready: %w", err)
+	}
+
+	done := os.NewFile(doneFD, "done")
+	defer done.Close()
+
+	errs := make(chan error, 1)
+	go func() {
+		// NOTE: the previous process closes its end of the pipe when it's done,
+		// or when it exits. Either way, it's no longer serving requests.
+		_, err := io.Copy(io.Discard, done)
+		errs <- err
+	}()
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			return fmt.Errorf("waiting for previous process: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Handover is a handover of a listening socket to a new process that is ready
+// to accept connections.
+type Handover struct {
+	done *os.File
+}
+
+// Upgrade starts the binary at path with args and hands l over to it. It
+// returns once the new process is ready to accept connections on l. The new
+// process is expected to call Listen() and TakeOver().
+//
+// The caller must stop accepting connections on l, finish in-flight requests
+// and then call Done() to let the new process start serving. If the new
+// process exits or ctx expires before it's ready, an error is returned and the
+// caller should keep serving.
+func Upgrade(ctx context.Context, log logger.Logger, l *net.TCPListener, path string, args []string) (*Handover, error) {
+	listenerFile, err := l.File()
+	if err != nil {
+		return nil, fmt.Errorf("getting listener file: %w", err)
+	}
+	defer listenerFile.Close()
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("creating ready pipe: %w", err)
+	}
+	defer readyR.Close()
+
+	doneR, doneW, err := os.Pipe()
+	if err != nil {
+		readyW.Close()
+		return nil, fmt.Errorf("creating done pipe: %w", err)
+	}
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), envVar+"=1")
+	cmd.ExtraFiles = []*os.File{listenerFile, readyW, doneR}
+
+	err = cmd.Start()
+
+	// NOTE: the new process has its own copies of these, and ours must be
+	// closed for the new process to notice when we exit.
+	readyW.Close()
+	doneR.Close()
+
+	if err != nil {
+		doneW.Close()
+		return nil, fmt.Errorf("starting %s: %w", path, err)
+	}
+
+	log = log.WithField("pid", cmd.Process.Pid)
+	log.Infof("waiting for new process to become ready")
+
+	errs := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		_, err := readyR.Read(buf)
+		errs <- err
+	}()
+
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if err != nil {
+		doneW.Close()
+		cmd.Process.Kill()
+		cmd.Wait()
+		if err == io.EOF {
+			err = fmt.Errorf("new process exited before becoming ready")
+		}
+		return nil, err
+	}
+
+	log.Infof("new process is ready")
+
+	// NOTE: the new process outlives this one; it's not waited for.
+	err = cmd.Process.Release()
+	if err != nil {
+		log.Errorf("releasing new process: %s", err)
+	}
+
+	return &Handover{done: doneW}, nil
+}
+
+// Done lets the new process start serving requests. It must be called once
+// this process has stopped serving requests.
+func (h *Handover) Done() error {
+	return h.done.Close()
+}
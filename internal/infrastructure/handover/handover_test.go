@@ -0,0 +1,108 @@
+package handover_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/handover"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/stretchr/testify/require"
+)
+
+var log = logger.NewWithLevel(context.Background(), logger.LevelWarn)
+
+const childReply = "served by new process"
+
+// TestUpgrade verifies that a connection made after the new process is ready,
+// but before the old process is done, is served by the new process once the
+// old process is done.
+func TestUpgrade(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	l, err := handover.Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+
+	// Act
+	h, err := handover.Upgrade(ctx, log, l, os.Args[0], []string{"-test.run=^TestUpgradeChild$"})
+	require.NoError(t, err)
+
+	// old process stops accepting connections
+	require.NoError(t, l.Close())
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, h.Done())
+
+	// Assert
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(10*time.Second)))
+	got, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	require.Equal(t, childReply, string(got))
+}
+
+// TestUpgradeExitBeforeReady verifies that Upgrade() returns an error if the
+// new process exits before becoming ready.
+func TestUpgradeExitBeforeReady(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	l, err := handover.Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	// Act
+	_, err = handover.Upgrade(ctx, log, l, os.Args[0], []string{"-test.run=^TestUpgradeChildExit$"})
+
+	// Assert
+	require.Error(t, err)
+}
+
+// TestUpgradeChild is run by the new process started by TestUpgrade.
+func TestUpgradeChild(t *testing.T) {
+	if !handover.Inherited() {
+		t.Skip("only run by TestUpgrade")
+	}
+
+	// NOTE: the new process shares stdout with the test that started it, and
+	// must not report its own test results there.
+	defer func() {
+		if !t.Failed() {
+			os.Exit(0)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	l, err := handover.Listen("")
+	require.NoError(t, err)
+	defer l.Close()
+
+	err = handover.TakeOver(ctx)
+	require.NoError(t, err)
+
+	conn, err := l.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(childReply))
+	require.NoError(t, err)
+}
+
+// TestUpgradeChildExit is run by the new process started by
+// TestUpgradeExitBeforeReady.
+func TestUpgradeChildExit(t *testing.T) {
+	if !handover.Inherited() {
+		t.Skip("only run by TestUpgradeExitBeforeReady")
+	}
+
+	os.Exit(1)
+}
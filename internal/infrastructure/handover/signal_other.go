@@ -0,0 +1,8 @@
+//go:build !unix
+
+package handover
+
+import "os"
+
+// NotifyUpgrade does nothing, since upgrades are only supported on unix.
+func NotifyUpgrade(c chan<- os.Signal) {}
@@ -0,0 +1,14 @@
+//go:build unix
+
+package handover
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// NotifyUpgrade relays SIGUSR2 to c, which is used to request an upgrade.
+func NotifyUpgrade(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR2)
+}
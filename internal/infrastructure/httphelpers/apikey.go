@@ -2,22 +2,33 @@ package httphelpers
 
 import (
 	"context"
+	"fmt"
 	"math"
 	"net/http"
 	"strings"
 
 	"github.com/micvbang/go-helpy/inty"
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/seberr"
 )
 
 const (
 	APIKeyHeader = "Authorization"
 	bearerPrefix = "Bearer "
+
+	// TraceIDHeader is the header from which the trace ID of produce requests
+	// is read. It's persisted with the records of the request.
+	TraceIDHeader = "Traceparent"
+
+	// ProducedAtHeader is the header from which the time at which the records
+	// of produce requests were produced is read, formatted as RFC3339.
+	ProducedAtHeader = "Seb-Produced-At"
 )
 
 // NewAPIKeyHandler returns an http.HandlerFunc that can be used to wrap other
 // http.HandlerFuncs. The returned http.HandlerFunc uses allowed to determine
 // whether an incoming http.Request should have access to the wrapped endpoint.
+// The API key of allowed requests is available via APIKeyFromContext.
 func NewAPIKeyHandler(log logger.Logger, allowed func(ctx context.Context, apiKey string) (bool, error)) func(http.HandlerFunc) http.HandlerFunc {
 	return func(hf http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
@@ -43,19 +54,32 @@ func NewAPIKeyHandler(log logger.Logger, allowed func(ctx context.Context, apiKe
 				return
 			}
 
+			r = r.WithContext(WithAPIKey(r.Context(), requestAPIKey))
 			hf.ServeHTTP(w, r)
 		}
 	}
 }
 
+type apiKeyKey struct{}
+
+// WithAPIKey returns a copy of ctx that holds apiKey.
+func WithAPIKey(ctx context.Context, apiKey string) context.Context {
+	return context.WithValue(ctx, apiKeyKey{}, apiKey)
+}
+
+// APIKeyFromContext returns the API key that was used to authenticate the
+// request, as added by NewAPIKeyHandler.
+func APIKeyFromContext(ctx context.Context) (string, bool) {
+	apiKey, ok := ctx.Value(apiKeyKey{}).(string)
+	return apiKey, ok
+}
+
 func invalidAuth(w http.ResponseWriter, r *http.Request) {
 	r.Body.Close()
-	w.WriteHeader(http.StatusUnauthorized)
-	w.Write([]byte("invalid auth"))
+	WriteError(w, http.StatusUnauthorized, fmt.Errorf("%w: invalid auth", seberr.ErrUnauthorized))
 }
 
 func internalServerError(w http.ResponseWriter, r *http.Request) {
 	r.Body.Close()
-	w.WriteHeader(http.StatusInternalServerError)
-	w.Write([]byte("something went wrong"))
+	WriteErrorf(w, http.StatusInternalServerError, "something went wrong")
 }
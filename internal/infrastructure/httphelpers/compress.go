@@ -0,0 +1,333 @@
+package httphelpers
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+const (
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+)
+
+// CompressionConfig configures NewCompressionHandler.
+type CompressionConfig struct {
+	// MinSize is the number of bytes a response must have in order to be
+	// compressed. Smaller responses aren't worth the overhead.
+	MinSize int
+
+	// ContentTypes are the media types of responses that are compressed, e.g.
+	// "multipart/form-data". Types ending in "/*" match all subtypes, e.g.
+	// "text/*". Defaults to "multipart/form-data", which is used when
+	// returning records.
+	ContentTypes []string
+}
+
+// NewCompressionHandler returns an http.Handler that can be used to wrap other
+// http.Handlers. The returned http.Handler compresses responses using gzip or
+// deflate, as accepted by the client in its Accept-Encoding header, if the
+// response's Content-Type is one of cfg.ContentTypes and it has at least
+// cfg.MinSize bytes.
+//
+// Responses are buffered until it's known whether they'll be compressed, i.e.
+// until cfg.MinSize bytes have been written, the response is flushed, or the
+// wrapped handler returns.
+func NewCompressionHandler(log logger.Logger, cfg CompressionConfig) func(http.Handler) http.Handler {
+	if len(cfg.ContentTypes) == 0 {
+		cfg.ContentTypes = []string{"multipart/form-data"}
+	}
+
+	pools := map[string]*sync.Pool{
+		encodingGzip: {New: func() any {
+			return gzip.NewWriter(io.Discard)
+		}},
+		encodingDeflate: {New: func() any {
+			return zlib.NewWriter(io.Discard)
+		}},
+	}
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{
+				ResponseWriter: w,
+				cfg:            cfg,
+				encoding:       encoding,
+				pool:           pools[encoding],
+				status:         http.StatusOK,
+			}
+			defer func() {
+				err := cw.Close()
+				if err != nil {
+					log.Errorf("closing %s response writer: %s", encoding, err)
+				}
+			}()
+
+			h.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding returns the compression encoding to use for a request with
+// the given Accept-Encoding header, preferring gzip over deflate. It returns
+// "" if neither is accepted.
+func negotiateEncoding(acceptEncoding string) string {
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		encoding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		encoding = strings.ToLower(strings.TrimSpace(encoding))
+		if encoding == "" {
+			continue
+		}
+
+		q := 1.0
+		if qs, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			q, err = strconv.ParseFloat(qs, 64)
+			if err != nil {
+				continue
+			}
+		}
+		qualities[encoding] = q
+	}
+
+	// encodings that aren't listed are accepted with the quality of "*"
+	quality := func(encoding string) float64 {
+		if q, ok := qualities[encoding]; ok {
+			return q
+		}
+		return qualities["*"]
+	}
+
+	gzipQ, deflateQ := quality(encodingGzip), quality(encodingDeflate)
+	switch {
+	case gzipQ > 0 && gzipQ >= deflateQ:
+		return encodingGzip
+	case deflateQ > 0:
+		return encodingDeflate
+	}
+
+	return ""
+}
+
+// compressWriter compresses the response written to it, if it's eligible for
+// compression. Until that's been decided, the status and written bytes are
+// buffered.
+type compressWriter struct {
+	http.ResponseWriter
+	cfg      CompressionConfig
+	encoding string
+	pool     *sync.Pool
+
+	status      int
+	wroteHeader bool
+	buf         []byte
+
+	// decided is true once it's been decided whether to compress the
+	// response, in which case compressor is non-nil.
+	decided    bool
+	compressor compressor
+}
+
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = status
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	cw.wroteHeader = true
+	if cw.decided {
+		return cw.write(p)
+	}
+
+	if !cw.compressible() {
+		err := cw.decide(false)
+		if err != nil {
+			return 0, err
+		}
+		return cw.write(p)
+	}
+
+	cw.buf = append(cw.buf, p...)
+	if len(cw.buf) >= cw.cfg.MinSize {
+		err := cw.decide(true)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// FlushError writes the buffered response. Since it's no longer possible to
+// buffer the response once it's been flushed, this decides whether to compress
+// it.
+func (cw *compressWriter) FlushError() error {
+	if !cw.decided {
+		err := cw.decide(cw.compressible() && len(cw.buf) >= cw.cfg.MinSize)
+		if err != nil {
+			return err
+		}
+	}
+
+	if cw.compressor != nil {
+		err := cw.compressor.Flush()
+		if err != nil {
+			return err
+		}
+	}
+
+	return http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap makes it possible for http.ResponseController to reach the wrapped
+// http.ResponseWriter, e.g. to set deadlines.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Close writes the buffered response, if any, and finishes compression.
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		err := cw.decide(cw.compressible() && len(cw.buf) >= cw.cfg.MinSize)
+		if err != nil {
+			return err
+		}
+	}
+
+	if cw.compressor == nil {
+		return nil
+	}
+
+	err := cw.compressor.Close()
+	cw.compressor.Reset(io.Discard)
+	cw.pool.Put(cw.compressor)
+	cw.compressor = nil
+	return err
+}
+
+// compressible returns whether the response is eligible for compression,
+// based on its status and headers.
+func (cw *compressWriter) compressible() bool {
+	if cw.status < http.StatusOK || cw.status == http.StatusNoContent || cw.status == http.StatusNotModified {
+		return false
+	}
+
+	header := cw.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	for _, contentType := range cw.cfg.ContentTypes {
+		if prefix, ok := strings.CutSuffix(contentType, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+		} else if mediaType == contentType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// decide writes the response's headers, compressing the response if compress
+// is true, and writes the buffered bytes.
+func (cw *compressWriter) decide(compress bool) error {
+	cw.decided = true
+
+	if compress {
+		header := cw.Header()
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+
+		cw.compressor = cw.pool.Get().(compressor)
+		cw.compressor.Reset(cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	if len(cw.buf) == 0 {
+		return nil
+	}
+
+	_, err := cw.write(cw.buf)
+	cw.buf = nil
+	return err
+}
+
+func (cw *compressWriter) write(p []byte) (int, error) {
+	if cw.compressor != nil {
+		return cw.compressor.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// AcceptedRequestEncodings are the encodings of request bodies that are
+// decompressed by RequestBody, in the format of the Accept-Encoding header.
+const AcceptedRequestEncodings = encodingGzip + ", " + encodingDeflate
+
+// ErrUnsupportedEncoding is returned by RequestBody when a request body is
+// encoded using an unsupported encoding.
+var ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// RequestBody returns a reader of the body of r, decompressing it if its
+// Content-Encoding header is one of AcceptedRequestEncodings. An error
+// wrapping ErrUnsupportedEncoding is returned for other encodings; servers
+// should respond with 415 Unsupported Media Type and an Accept-Encoding header
+// listing AcceptedRequestEncodings, allowing clients to retry without the
+// encoding.
+//
+// The returned reader must be closed; this doesn't close r.Body.
+func RequestBody(r *http.Request) (io.ReadCloser, error) {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	switch encoding {
+	case "", "identity":
+		return io.NopCloser(r.Body), nil
+	case encodingGzip:
+		rdr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("%w: reading gzip header: %w", seberr.ErrBadInput, err)
+		}
+		return rdr, nil
+	case encodingDeflate:
+		rdr, err := zlib.NewReader(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("%w: reading deflate header: %w", seberr.ErrBadInput, err)
+		}
+		return rdr, nil
+	}
+
+	return nil, fmt.Errorf("%w '%s'", ErrUnsupportedEncoding, encoding)
+}
@@ -0,0 +1,190 @@
+package httphelpers_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCompressionHandler verifies that NewCompressionHandler compresses
+// responses using the encoding accepted by the client, and only when they
+// have the configured content types and are at least the configured size.
+func TestCompressionHandler(t *testing.T) {
+	tests := map[string]struct {
+		acceptEncoding   string
+		contentType      string
+		size             int
+		status           int
+		expectedEncoding string
+	}{
+		"gzip":                 {acceptEncoding: "gzip", contentType: "multipart/form-data; boundary=abc", size: 2048, expectedEncoding: "gzip"},
+		"deflate":              {acceptEncoding: "deflate", contentType: "multipart/form-data; boundary=abc", size: 2048, expectedEncoding: "deflate"},
+		"gzip preferred":       {acceptEncoding: "deflate, gzip", contentType: "multipart/form-data", size: 2048, expectedEncoding: "gzip"},
+		"quality":              {acceptEncoding: "gzip;q=0.5, deflate", contentType: "multipart/form-data", size: 2048, expectedEncoding: "deflate"},
+		"gzip refused":         {acceptEncoding: "gzip;q=0, *", contentType: "multipart/form-data", size: 2048, expectedEncoding: "deflate"},
+		"wildcard":             {acceptEncoding: "*", contentType: "multipart/form-data", size: 2048, expectedEncoding: "gzip"},
+		"not accepted":         {acceptEncoding: "br", contentType: "multipart/form-data", size: 2048},
+		"no accept encoding":   {contentType: "multipart/form-data", size: 2048},
+		"too small":            {acceptEncoding: "gzip", contentType: "multipart/form-data", size: 1023},
+		"content type":         {acceptEncoding: "gzip", contentType: "application/octet-stream", size: 2048},
+		"content type pattern": {acceptEncoding: "gzip", contentType: "text/plain; charset=utf-8", size: 2048, expectedEncoding: "gzip"},
+		"status":               {acceptEncoding: "gzip", contentType: "multipart/form-data", size: 2048, status: http.StatusPartialContent, expectedEncoding: "gzip"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			expectedBody := bytes.Repeat([]byte("a"), test.size)
+			expectedStatus := test.status
+			if expectedStatus == 0 {
+				expectedStatus = http.StatusOK
+			}
+
+			handler := httphelpers.NewCompressionHandler(log, httphelpers.CompressionConfig{
+				MinSize:      1024,
+				ContentTypes: []string{"multipart/form-data", "text/*"},
+			})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", test.contentType)
+				w.WriteHeader(expectedStatus)
+
+				// write in multiple parts to verify that small writes are
+				// buffered
+				for i := 0; i < len(expectedBody); i += 100 {
+					_, err := w.Write(expectedBody[i:min(i+100, len(expectedBody))])
+					require.NoError(t, err)
+				}
+			}))
+
+			r := httptest.NewRequest("GET", "/records", nil)
+			if test.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", test.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(w, r)
+
+			// Assert
+			require.Equal(t, expectedStatus, w.Code)
+			require.Equal(t, test.expectedEncoding, w.Header().Get("Content-Encoding"))
+			require.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+
+			var body io.Reader = w.Body
+			switch test.expectedEncoding {
+			case "gzip":
+				gr, err := gzip.NewReader(w.Body)
+				require.NoError(t, err)
+				body = gr
+			case "deflate":
+				zr, err := zlib.NewReader(w.Body)
+				require.NoError(t, err)
+				body = zr
+			}
+
+			gotBody, err := io.ReadAll(body)
+			require.NoError(t, err)
+			require.Equal(t, expectedBody, gotBody)
+		})
+	}
+}
+
+// TestCompressionHandlerFlush verifies that flushing a compressed response
+// makes the data written so far available to the client, even though the
+// response is smaller than the configured minimum size.
+func TestCompressionHandlerFlush(t *testing.T) {
+	expectedBody := []byte("streamed records")
+	flushed := make(chan struct{})
+	done := make(chan struct{})
+
+	server := httptest.NewServer(httphelpers.NewCompressionHandler(log, httphelpers.CompressionConfig{
+		MinSize: 1024,
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "multipart/form-data")
+		_, err := w.Write(expectedBody)
+		require.NoError(t, err)
+
+		err = http.NewResponseController(w).Flush()
+		require.NoError(t, err)
+		close(flushed)
+		<-done
+	})))
+	defer server.Close()
+	defer close(done)
+
+	r, err := http.NewRequest("GET", server.URL, nil)
+	require.NoError(t, err)
+	r.Header.Set("Accept-Encoding", "gzip")
+
+	// Act
+	res, err := http.DefaultClient.Do(r)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	<-flushed
+
+	// Assert
+	require.Equal(t, "", res.Header.Get("Content-Encoding"))
+	gotBody := make([]byte, len(expectedBody))
+	_, err = io.ReadFull(res.Body, gotBody)
+	require.NoError(t, err)
+	require.Equal(t, expectedBody, gotBody)
+}
+
+// TestRequestBody verifies that RequestBody decompresses request bodies
+// encoded using the supported encodings, and rejects other encodings.
+func TestRequestBody(t *testing.T) {
+	payload := bytes.Repeat([]byte("records"), 100)
+
+	compress := func(newWriter func(io.Writer) io.WriteCloser) []byte {
+		buf := bytes.NewBuffer(nil)
+		w := newWriter(buf)
+		_, err := w.Write(payload)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		return buf.Bytes()
+	}
+	gzipped := compress(func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })
+	deflated := compress(func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) })
+
+	tests := map[string]struct {
+		encoding string
+		body     []byte
+		err      error
+	}{
+		"none":        {encoding: "", body: payload},
+		"identity":    {encoding: "identity", body: payload},
+		"gzip":        {encoding: "gzip", body: gzipped},
+		"deflate":     {encoding: "deflate", body: deflated},
+		"unsupported": {encoding: "br", body: payload, err: httphelpers.ErrUnsupportedEncoding},
+		"corrupt":     {encoding: "gzip", body: payload, err: seberr.ErrBadInput},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/records", bytes.NewReader(test.body))
+			if test.encoding != "" {
+				r.Header.Set("Content-Encoding", test.encoding)
+			}
+
+			// Act
+			body, err := httphelpers.RequestBody(r)
+
+			// Assert
+			require.ErrorIs(t, err, test.err)
+			if test.err != nil {
+				return
+			}
+			defer body.Close()
+
+			got, err := io.ReadAll(body)
+			require.NoError(t, err)
+			require.Equal(t, payload, got)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package httphelpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// ErrorOutput is the body of error responses. Code identifies the error such
+// that clients can react to it without parsing Message, and Retryable tells
+// whether the request may succeed if it's retried. See seberr.Code.
+type ErrorOutput struct {
+	Code      string         `json:"code"`
+	Message   string         `json:"message"`
+	Retryable bool           `json:"retryable"`
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+// WriteError writes an error response with statusCode, whose body is an
+// ErrorOutput describing err. If err is nil, the message is the text of
+// statusCode.
+func WriteError(w http.ResponseWriter, statusCode int, err error) {
+	WriteErrorDetails(w, statusCode, err, nil)
+}
+
+// WriteErrorf is like WriteError, but formats the error like fmt.Errorf.
+func WriteErrorf(w http.ResponseWriter, statusCode int, format string, args ...any) {
+	WriteErrorDetails(w, statusCode, fmt.Errorf(format, args...), nil)
+}
+
+// WriteErrorDetails is like WriteError, but includes details about the error,
+// e.g. the name of the topic that wasn't found.
+func WriteErrorDetails(w http.ResponseWriter, statusCode int, err error, details map[string]any) {
+	code, retryable := seberr.Code(err, statusCode)
+	output := ErrorOutput{
+		Code:      code,
+		Message:   http.StatusText(statusCode),
+		Retryable: retryable,
+		Details:   details,
+	}
+	if err != nil {
+		output.Message = err.Error()
+	}
+
+	// NOTE: output only holds encodable values, unless details doesn't.
+	bs, _ := json.Marshal(output)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(bs)
+}
+
+// ParseError returns an error describing the error response res, wrapping the
+// seberr error identified by its code. If res doesn't have an ErrorOutput
+// body, e.g. because it was returned by a proxy, the body is used as the error
+// message. The body of res is read, but not closed.
+func ParseError(res *http.Response) error {
+	bs, err := io.ReadAll(io.LimitReader(res.Body, 64*1024))
+	if err != nil {
+		return fmt.Errorf("status code %d: reading error response: %w", res.StatusCode, err)
+	}
+
+	output := ErrorOutput{}
+	err = json.Unmarshal(bs, &output)
+	if err != nil || output.Code == "" {
+		return fmt.Errorf("status code %d: %s", res.StatusCode, bs)
+	}
+
+	codeErr := seberr.FromCode(output.Code)
+	if codeErr == nil {
+		return fmt.Errorf("status code %d: %s: %s", res.StatusCode, output.Code, output.Message)
+	}
+	return fmt.Errorf("status code %d: %w: %s", res.StatusCode, codeErr, output.Message)
+}
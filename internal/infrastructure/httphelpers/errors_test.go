@@ -0,0 +1,96 @@
+package httphelpers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWriteError verifies that WriteError writes an ErrorOutput body with the
+// code of the given error, and that ParseError returns an error wrapping the
+// seberr error identified by the code.
+func TestWriteError(t *testing.T) {
+	tests := map[string]struct {
+		statusCode int
+		err        error
+		code       string
+		retryable  bool
+		expected   error
+	}{
+		"topic not found": {
+			statusCode: http.StatusNotFound,
+			err:        fmt.Errorf("getting topic: %w", seberr.ErrTopicNotFound),
+			code:       seberr.CodeTopicNotFound,
+			expected:   seberr.ErrTopicNotFound,
+		},
+		"lease lost": {
+			statusCode: http.StatusServiceUnavailable,
+			err:        fmt.Errorf("adding records: %w", seberr.ErrLeaseLost),
+			code:       seberr.CodeLeaseLost,
+			retryable:  true,
+			expected:   seberr.ErrLeaseLost,
+		},
+		"status fallback": {
+			statusCode: http.StatusBadRequest,
+			err:        fmt.Errorf("invalid offset"),
+			code:       seberr.CodeBadInput,
+			expected:   seberr.ErrBadInput,
+		},
+		"internal": {
+			statusCode: http.StatusInternalServerError,
+			err:        nil,
+			code:       seberr.CodeInternal,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			// Act
+			httphelpers.WriteError(w, test.statusCode, test.err)
+
+			// Assert
+			res := w.Result()
+			require.Equal(t, test.statusCode, res.StatusCode)
+			require.Equal(t, "application/json", res.Header.Get("Content-Type"))
+
+			output := httphelpers.ErrorOutput{}
+			err := json.Unmarshal(w.Body.Bytes(), &output)
+			require.NoError(t, err)
+			require.Equal(t, test.code, output.Code)
+			require.Equal(t, test.retryable, output.Retryable)
+			if test.err != nil {
+				require.Equal(t, test.err.Error(), output.Message)
+			} else {
+				require.Equal(t, http.StatusText(test.statusCode), output.Message)
+			}
+
+			err = httphelpers.ParseError(res)
+			require.Error(t, err)
+			if test.expected != nil {
+				require.ErrorIs(t, err, test.expected)
+			}
+		})
+	}
+}
+
+// TestParseErrorNotEnvelope verifies that ParseError uses the body of error
+// responses that aren't ErrorOutputs as the error message.
+func TestParseErrorNotEnvelope(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.WriteHeader(http.StatusBadGateway)
+	w.Write([]byte("bad gateway"))
+
+	// Act
+	err := httphelpers.ParseError(w.Result())
+
+	// Assert
+	require.EqualError(t, err, "status code 502: bad gateway")
+}
@@ -0,0 +1,458 @@
+package httphelpers
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+)
+
+// ErrInvalidToken is returned by JWTVerifier.Verify when a token is
+// malformed, isn't signed by the issuer, or its claims aren't valid.
+var ErrInvalidToken = errors.New("invalid token")
+
+// jwksMinRefreshInterval is the minimum time between attempts to fetch the
+// issuer's JWKS, whether or not the previous attempt succeeded. This prevents
+// clients, e.g. ones using unknown keys, from making the broker hammer the
+// issuer.
+const jwksMinRefreshInterval = time.Minute
+
+// JWTConfig configures NewJWTVerifier.
+type JWTConfig struct {
+	// Issuer is the URL of the OIDC issuer. Tokens must have been issued by
+	// it.
+	Issuer string
+
+	// Audience is the audience that tokens must have been issued for.
+	// Ignored if empty.
+	Audience string
+
+	// JWKSURL is the URL of the issuer's JSON Web Key Set. If empty, it's
+	// discovered from the issuer's OpenID configuration.
+	JWKSURL string
+
+	// JWKSCacheTTL is the amount of time the issuer's keys are cached before
+	// they're fetched again. Defaults to one hour.
+	JWKSCacheTTL time.Duration
+
+	// Leeway is the amount of clock skew that is tolerated when validating
+	// the expiry and not-before times of tokens.
+	Leeway time.Duration
+
+	// Client is used to fetch the issuer's keys. Defaults to a client with a
+	// timeout of 10 seconds.
+	Client *http.Client
+}
+
+// JWTClaims are the claims of a verified JWT.
+type JWTClaims map[string]any
+
+// Subject returns the "sub" claim.
+func (c JWTClaims) Subject() string {
+	sub, _ := c["sub"].(string)
+	return sub
+}
+
+// Strings returns the values of claim name, which must be either a string
+// or a list of strings. Claims of nested objects can be referenced using
+// dots, e.g. "realm_access.roles".
+func (c JWTClaims) Strings(name string) []string {
+	var value any = map[string]any(c)
+	for _, part := range strings.Split(name, ".") {
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = obj[part]
+	}
+
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, elem := range v {
+			if s, ok := elem.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+
+	return nil
+}
+
+// JWTVerifier verifies JWTs issued by an OIDC issuer, using the keys of the
+// issuer's JSON Web Key Set. The keys are cached, and are fetched again when
+// they expire or a token is signed using an unknown key.
+type JWTVerifier struct {
+	log logger.Logger
+	cfg JWTConfig
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	fetchErr    error
+
+	// fetching is non-nil while the keys are being fetched, and is closed
+	// once the fetch has completed.
+	fetching chan struct{}
+}
+
+// NewJWTVerifier returns a JWTVerifier configured by cfg. The issuer's keys
+// aren't fetched until the first token is verified.
+func NewJWTVerifier(log logger.Logger, cfg JWTConfig) *JWTVerifier {
+	if cfg.JWKSCacheTTL == 0 {
+		cfg.JWKSCacheTTL = time.Hour
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &JWTVerifier{log: log, cfg: cfg}
+}
+
+// Verify verifies the signature and claims of token, returning its claims.
+// ErrInvalidToken is returned if token isn't valid.
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (JWTClaims, error) {
+	headerPart, rest, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+	claimsPart, signaturePart, ok := strings.Cut(rest, ".")
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	err := decodeJWTPart(headerPart, &header)
+	if err != nil {
+		return nil, fmt.Errorf("%w: header: %w", ErrInvalidToken, err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(signaturePart)
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %w", ErrInvalidToken, err)
+	}
+
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	err = verifyJWTSignature(header.Alg, key, []byte(headerPart+"."+claimsPart), signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	claims := JWTClaims{}
+	err = decodeJWTPart(claimsPart, &claims)
+	if err != nil {
+		return nil, fmt.Errorf("%w: claims: %w", ErrInvalidToken, err)
+	}
+
+	err = v.validateClaims(claims, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	return claims, nil
+}
+
+func (v *JWTVerifier) validateClaims(claims JWTClaims, now time.Time) error {
+	if iss, _ := claims["iss"].(string); iss != v.cfg.Issuer {
+		return fmt.Errorf("issuer '%s' not allowed", iss)
+	}
+
+	if v.cfg.Audience != "" && !slices.Contains(claims.Strings("aud"), v.cfg.Audience) {
+		return fmt.Errorf("audience not allowed")
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return fmt.Errorf("expiry missing")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(v.cfg.Leeway)) {
+		return fmt.Errorf("expired")
+	}
+
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(v.cfg.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return fmt.Errorf("not valid yet")
+	}
+
+	return nil
+}
+
+// key returns the issuer's key with the given kid, fetching the issuer's keys
+// if they haven't been fetched, have expired, or don't contain kid. Fetches
+// are attempted at most once every jwksMinRefreshInterval, and v.mu isn't
+// held while fetching.
+func (v *JWTVerifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	for {
+		v.mu.Lock()
+		key, ok := v.keys[kid]
+		if ok && time.Since(v.fetchedAt) < v.cfg.JWKSCacheTTL {
+			v.mu.Unlock()
+			return key, nil
+		}
+
+		if fetching := v.fetching; fetching != nil {
+			v.mu.Unlock()
+
+			// keep using the expired key while its replacement is fetched
+			if ok {
+				return key, nil
+			}
+
+			select {
+			case <-fetching:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		if time.Since(v.attemptedAt) < jwksMinRefreshInterval {
+			fetchErr := v.fetchErr
+			noKeys := v.keys == nil
+			v.mu.Unlock()
+
+			switch {
+			case ok:
+				return key, nil
+			case noKeys:
+				return nil, fmt.Errorf("fetching jwks: %w", fetchErr)
+			}
+			return nil, fmt.Errorf("%w: unknown key id '%s'", ErrInvalidToken, kid)
+		}
+
+		fetching := make(chan struct{})
+		v.fetching = fetching
+		v.attemptedAt = time.Now()
+		v.mu.Unlock()
+
+		// NOTE: the fetch is shared with other requests, so it must not be
+		// cancelled by the request that started it.
+		keys, err := v.fetchKeys(context.WithoutCancel(ctx))
+
+		v.mu.Lock()
+		v.fetchErr = err
+		if err == nil {
+			v.keys = keys
+			v.fetchedAt = time.Now()
+		}
+		v.fetching = nil
+		close(fetching)
+		v.mu.Unlock()
+
+		if err != nil {
+			// keep using the cached keys if the issuer is unavailable
+			if ok {
+				v.log.Warnf("fetching jwks, using cached keys: %s", err)
+				return key, nil
+			}
+			return nil, fmt.Errorf("fetching jwks: %w", err)
+		}
+	}
+}
+
+func (v *JWTVerifier) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	jwksURL := v.cfg.JWKSURL
+	if jwksURL == "" {
+		configuration := struct {
+			JWKSURI string `json:"jwks_uri"`
+		}{}
+		err := v.getJSON(ctx, strings.TrimSuffix(v.cfg.Issuer, "/")+"/.well-known/openid-configuration", &configuration)
+		if err != nil {
+			return nil, fmt.Errorf("discovering jwks url: %w", err)
+		}
+		if configuration.JWKSURI == "" {
+			return nil, fmt.Errorf("openid configuration has no jwks_uri")
+		}
+		jwksURL = configuration.JWKSURI
+	}
+
+	jwks := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+	err := v.getJSON(ctx, jwksURL, &jwks)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			v.log.Warnf("skipping jwk '%s': %s", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	v.log.Debugf("fetched %d keys from '%s'", len(keys), jwksURL)
+
+	return keys, nil
+}
+
+func (v *JWTVerifier) getJSON(ctx context.Context, url string, value any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := v.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET '%s': status %d", url, res.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(value)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decodeInt := func(s string) (*big.Int, error) {
+		bs, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(bs), nil
+	}
+
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeInt(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("decoding modulus: %w", err)
+		}
+		e, err := decodeInt(jwk.E)
+		if err != nil {
+			return nil, fmt.Errorf("decoding exponent: %w", err)
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("exponent too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve '%s'", jwk.Crv)
+		}
+
+		x, err := decodeInt(jwk.X)
+		if err != nil {
+			return nil, fmt.Errorf("decoding x: %w", err)
+		}
+		y, err := decodeInt(jwk.Y)
+		if err != nil {
+			return nil, fmt.Errorf("decoding y: %w", err)
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type '%s'", jwk.Kty)
+}
+
+// verifyJWTSignature verifies signature of signed using key and the
+// algorithm alg. Only asymmetric algorithms are supported, since tokens are
+// issued by a third party.
+func verifyJWTSignature(alg string, key crypto.PublicKey, signed []byte, signature []byte) error {
+	var h hash.Hash
+	var cryptoHash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		h, cryptoHash = sha256.New(), crypto.SHA256
+	case "RS384", "ES384":
+		h, cryptoHash = sha512.New384(), crypto.SHA384
+	case "RS512", "ES512":
+		h, cryptoHash = sha512.New(), crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm '%s'", alg)
+	}
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return fmt.Errorf("algorithm '%s' can't be used with rsa key", alg)
+		}
+		return rsa.VerifyPKCS1v15(key, cryptoHash, digest, signature)
+
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(alg, "ES") {
+			return fmt.Errorf("algorithm '%s' can't be used with ec key", alg)
+		}
+
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return fmt.Errorf("bad signature length")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return fmt.Errorf("bad signature")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unsupported key")
+}
+
+func decodeJWTPart(part string, value any) error {
+	bs, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bs, value)
+}
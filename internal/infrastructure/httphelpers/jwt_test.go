@@ -0,0 +1,337 @@
+package httphelpers_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/stretchr/testify/require"
+)
+
+// TestJWTVerifier verifies that JWTVerifier accepts tokens signed by the
+// issuer's keys with valid claims, and rejects all other tokens with
+// ErrInvalidToken.
+func TestJWTVerifier(t *testing.T) {
+	issuer := newTestIssuer(t)
+	defer issuer.Close()
+
+	now := time.Now()
+	validClaims := func() map[string]any {
+		return map[string]any{
+			"iss": issuer.URL,
+			"aud": []string{"seb", "other"},
+			"sub": "user",
+			"exp": now.Add(time.Hour).Unix(),
+		}
+	}
+
+	tests := map[string]struct {
+		token string
+		valid bool
+	}{
+		"rsa": {
+			token: issuer.sign(t, "RS256", "rsa", validClaims()),
+			valid: true,
+		},
+		"ec": {
+			token: issuer.sign(t, "ES256", "ec", validClaims()),
+			valid: true,
+		},
+		"expired": {
+			token: issuer.sign(t, "RS256", "rsa", with(validClaims(), "exp", now.Add(-time.Hour).Unix())),
+		},
+		"no expiry": {
+			token: issuer.sign(t, "RS256", "rsa", with(validClaims(), "exp", nil)),
+		},
+		"not valid yet": {
+			token: issuer.sign(t, "RS256", "rsa", with(validClaims(), "nbf", now.Add(time.Hour).Unix())),
+		},
+		"other issuer": {
+			token: issuer.sign(t, "RS256", "rsa", with(validClaims(), "iss", "https://other")),
+		},
+		"other audience": {
+			token: issuer.sign(t, "RS256", "rsa", with(validClaims(), "aud", "other")),
+		},
+		"unknown key": {
+			token: issuer.sign(t, "RS256", "unknown", validClaims()),
+		},
+		"algorithm mismatch": {
+			token: issuer.sign(t, "ES256", "rsa", validClaims()),
+		},
+		"algorithm none": {
+			token: jwtPart(t, map[string]any{"alg": "none", "kid": "rsa"}) + "." + jwtPart(t, validClaims()) + ".",
+		},
+		"tampered claims": {
+			token: func() string {
+				token := issuer.sign(t, "RS256", "rsa", validClaims())
+				parts := strings.Split(token, ".")
+				return parts[0] + "." + jwtPart(t, with(validClaims(), "sub", "admin")) + "." + parts[2]
+			}(),
+		},
+		"malformed": {
+			token: "not-a-jwt",
+		},
+	}
+
+	verifier := httphelpers.NewJWTVerifier(log, httphelpers.JWTConfig{
+		Issuer:   issuer.URL,
+		Audience: "seb",
+	})
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			claims, err := verifier.Verify(context.Background(), test.token)
+
+			// Assert
+			if !test.valid {
+				require.ErrorIs(t, err, httphelpers.ErrInvalidToken)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "user", claims.Subject())
+		})
+	}
+}
+
+// TestJWTVerifierCachesKeys verifies that JWTVerifier caches the issuer's
+// keys, and that tokens signed with unknown keys don't make it fetch the keys
+// over and over.
+func TestJWTVerifierCachesKeys(t *testing.T) {
+	issuer := newTestIssuer(t)
+	defer issuer.Close()
+
+	claims := map[string]any{
+		"iss": issuer.URL,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+
+	verifier := httphelpers.NewJWTVerifier(log, httphelpers.JWTConfig{
+		Issuer:  issuer.URL,
+		JWKSURL: issuer.URL + "/jwks",
+	})
+
+	// Act
+	for range 5 {
+		_, err := verifier.Verify(context.Background(), issuer.sign(t, "RS256", "rsa", claims))
+		require.NoError(t, err)
+
+		_, err = verifier.Verify(context.Background(), issuer.sign(t, "RS256", "unknown", claims))
+		require.ErrorIs(t, err, httphelpers.ErrInvalidToken)
+	}
+
+	// Assert
+	require.Equal(t, int64(1), issuer.jwksFetches.Load())
+	require.Equal(t, int64(0), issuer.discoveryFetches.Load())
+}
+
+// TestJWTVerifierRateLimitsFailedFetches verifies that JWTVerifier doesn't
+// fetch the issuer's keys for every token while the issuer is unavailable,
+// and that tokens are rejected with an error that isn't ErrInvalidToken.
+func TestJWTVerifierRateLimitsFailedFetches(t *testing.T) {
+	issuer := newTestIssuer(t)
+	defer issuer.Close()
+	issuer.failJWKS.Store(true)
+
+	claims := map[string]any{
+		"iss": issuer.URL,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+
+	verifier := httphelpers.NewJWTVerifier(log, httphelpers.JWTConfig{
+		Issuer:  issuer.URL,
+		JWKSURL: issuer.URL + "/jwks",
+	})
+
+	// Act
+	for range 5 {
+		_, err := verifier.Verify(context.Background(), issuer.sign(t, "RS256", "rsa", claims))
+
+		// Assert
+		require.Error(t, err)
+		require.NotErrorIs(t, err, httphelpers.ErrInvalidToken)
+	}
+
+	require.Equal(t, int64(1), issuer.jwksFetches.Load())
+}
+
+// TestJWTVerifierSharesFetches verifies that concurrent tokens share a single
+// fetch of the issuer's keys, and that requests waiting for the fetch can give
+// up once their context is done.
+func TestJWTVerifierSharesFetches(t *testing.T) {
+	issuer := newTestIssuer(t)
+	defer issuer.Close()
+
+	block := make(chan struct{})
+	issuer.jwksBlock.Store(&block)
+
+	claims := map[string]any{
+		"iss": issuer.URL,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+
+	verifier := httphelpers.NewJWTVerifier(log, httphelpers.JWTConfig{
+		Issuer:  issuer.URL,
+		JWKSURL: issuer.URL + "/jwks",
+	})
+
+	// Act
+	const numVerifiers = 10
+	errs := make(chan error, numVerifiers)
+	for range numVerifiers {
+		go func() {
+			_, err := verifier.Verify(context.Background(), issuer.sign(t, "RS256", "rsa", claims))
+			errs <- err
+		}()
+	}
+
+	require.Eventually(t, func() bool {
+		return issuer.jwksFetches.Load() == 1
+	}, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := verifier.Verify(ctx, issuer.sign(t, "RS256", "rsa", claims))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	close(block)
+
+	// Assert
+	for range numVerifiers {
+		require.NoError(t, <-errs)
+	}
+	require.Equal(t, int64(1), issuer.jwksFetches.Load())
+}
+
+// TestJWTClaimsStrings verifies that JWTClaims.Strings() returns the values
+// of string and string list claims, including nested claims.
+func TestJWTClaimsStrings(t *testing.T) {
+	claims := httphelpers.JWTClaims{}
+	err := json.Unmarshal([]byte(`{"sub": "user", "groups": ["a", "b"], "realm_access": {"roles": ["admin"]}, "exp": 123}`), &claims)
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		claim    string
+		expected []string
+	}{
+		"string":  {claim: "sub", expected: []string{"user"}},
+		"list":    {claim: "groups", expected: []string{"a", "b"}},
+		"nested":  {claim: "realm_access.roles", expected: []string{"admin"}},
+		"number":  {claim: "exp"},
+		"missing": {claim: "realm_access.groups"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			got := claims.Strings(test.claim)
+
+			// Assert
+			require.Equal(t, test.expected, got)
+		})
+	}
+}
+
+type testIssuer struct {
+	*httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+
+	discoveryFetches atomic.Int64
+	jwksFetches      atomic.Int64
+
+	// failJWKS makes requests for the JWKS fail, and jwksBlock makes them
+	// wait until it's closed.
+	failJWKS  atomic.Bool
+	jwksBlock atomic.Pointer[chan struct{}]
+}
+
+// newTestIssuer returns an OIDC issuer serving its OpenID configuration and
+// JWKS, which has an RSA key with key id "rsa" and an EC key with key id
+// "ec".
+func newTestIssuer(t *testing.T) *testIssuer {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	issuer := &testIssuer{rsaKey: rsaKey, ecKey: ecKey}
+
+	b64 := func(bs []byte) string {
+		return base64.RawURLEncoding.EncodeToString(bs)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		issuer.discoveryFetches.Add(1)
+		json.NewEncoder(w).Encode(map[string]string{"jwks_uri": issuer.URL + "/jwks"})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		issuer.jwksFetches.Add(1)
+		if block := issuer.jwksBlock.Load(); block != nil {
+			<-*block
+		}
+		if issuer.failJWKS.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.Bytes()), "y": b64(ecKey.Y.Bytes())},
+		}})
+	})
+	issuer.Server = httptest.NewServer(mux)
+
+	return issuer
+}
+
+// sign returns a JWT with claims, signed using the algorithm alg and the
+// issuer's key of the type given by kid. The kid is used as the token's key
+// id, even if it isn't one of the issuer's.
+func (issuer *testIssuer) sign(t *testing.T, alg string, kid string, claims map[string]any) string {
+	signed := jwtPart(t, map[string]any{"alg": alg, "kid": kid, "typ": "JWT"}) + "." + jwtPart(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	if kid == "ec" {
+		r, s, err := ecdsa.Sign(rand.Reader, issuer.ecKey, digest[:])
+		require.NoError(t, err)
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	} else {
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, issuer.rsaKey, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func jwtPart(t *testing.T, value any) string {
+	bs, err := json.Marshal(value)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(bs)
+}
+
+// with returns claims with claim set to value, or removed if value is nil.
+func with(claims map[string]any, claim string, value any) map[string]any {
+	if value == nil {
+		delete(claims, claim)
+		return claims
+	}
+	claims[claim] = value
+	return claims
+}
@@ -16,17 +16,33 @@ import (
 const (
 	RecordsMultipartSizesKey   = "sizes"
 	RecordsMultipartRecordsKey = "records"
+	RecordsMultipartExpiresKey = "expires"
 )
 
 // RecordsToMultipartFormData formats a slice of records as according to the
 // format expected by Seb's HTTP handlers
 func RecordsToMultipartFormData(w io.Writer, recordSizes []uint32, recordsData []byte) (string, error) {
+	return RecordsWithExpiresToMultipartFormData(w, recordSizes, recordsData, nil)
+}
+
+// RecordsWithExpiresToMultipartFormData formats a slice of records and their
+// expiry times (unix epoch microseconds, 0 meaning never) as according to the
+// format expected by Seb's HTTP handlers. If expires is empty, no expiry times
+// are included.
+func RecordsWithExpiresToMultipartFormData(w io.Writer, recordSizes []uint32, recordsData []byte, expires []int64) (string, error) {
 	mw := multipart.NewWriter(w)
 	err := recordsToMultipartFormData(mw, recordSizes, recordsData)
 	if err != nil {
 		return "", fmt.Errorf("writing records as multipart form data: %w", err)
 	}
 
+	if len(expires) > 0 {
+		err = expiresToMultipartFormData(mw, expires)
+		if err != nil {
+			return "", fmt.Errorf("writing expiry times as multipart form data: %w", err)
+		}
+	}
+
 	err = mw.Close()
 	if err != nil {
 		return "", fmt.Errorf("sizes: closing multipart writer: %w", err)
@@ -34,29 +50,102 @@ func RecordsToMultipartFormData(w io.Writer, recordSizes []uint32, recordsData [
 	return mw.FormDataContentType(), nil
 }
 
+// MultipartRecordOverhead is the maximum number of bytes that each record
+// adds to the multipart form data written by RecordsToMultipartFormDataHTTP,
+// besides its data: its size as a JSON number, and its separator.
+const MultipartRecordOverhead = len("4294967295,")
+
+// MultipartFormDataOverhead returns the number of bytes that the multipart form
+// data written by RecordsToMultipartFormDataHTTP to a multipart.Writer using
+// boundary adds besides the records, i.e. the headers and boundaries of its
+// parts. Together with MultipartRecordOverhead, it gives an upper bound of the
+// size of the form data.
+func MultipartFormDataOverhead(boundary string) (int, error) {
+	counter := &countingWriter{}
+	mw := multipart.NewWriter(counter)
+	err := mw.SetBoundary(boundary)
+	if err != nil {
+		return 0, fmt.Errorf("setting boundary: %w", err)
+	}
+
+	err = recordsToMultipartFormData(mw, []uint32{}, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	err = mw.Close()
+	if err != nil {
+		return 0, fmt.Errorf("closing multipart writer: %w", err)
+	}
+	return counter.n, nil
+}
+
+// countingWriter counts the bytes written to it, discarding them.
+type countingWriter struct {
+	n int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += len(p)
+	return len(p), nil
+}
+
 func RecordsToMultipartFormDataHTTP(mw *multipart.Writer, recordSizes []uint32, recordsData []byte) error {
 	return recordsToMultipartFormData(mw, recordSizes, recordsData)
 }
 
+// RecordsWriterToMultipartFormDataHTTP works like
+// RecordsToMultipartFormDataHTTP, but gets the record data from recordsData
+// when writing it, avoiding the need to hold it in memory.
+func RecordsWriterToMultipartFormDataHTTP(mw *multipart.Writer, recordSizes []uint32, recordsData io.WriterTo) error {
+	err := sizesToMultipartFormData(mw, recordSizes)
+	if err != nil {
+		return err
+	}
+
+	fw, err := mw.CreateFormField(RecordsMultipartRecordsKey)
+	if err != nil {
+		return fmt.Errorf("creating form field: %w", err)
+	}
+
+	expectedBytes := int64(slicey.Sum(recordSizes))
+	n, err := recordsData.WriteTo(fw)
+	if err != nil {
+		return fmt.Errorf("failed to write records: %w", err)
+	}
+	if n != expectedBytes {
+		return fmt.Errorf("records: expected to write %d bytes, wrote %d", expectedBytes, n)
+	}
+
+	return nil
+}
+
+func sizesToMultipartFormData(mw *multipart.Writer, recordSizes []uint32) error {
+	fw, err := mw.CreateFormField(RecordsMultipartSizesKey)
+	if err != nil {
+		return fmt.Errorf("creating form field: %w", err)
+	}
+
+	bs, err := json.Marshal(&recordSizes)
+	if err != nil {
+		return fmt.Errorf("failed to marshal sizes: %w", err)
+	}
+	n, err := fw.Write(bs)
+	if err != nil {
+		return fmt.Errorf("failed to write record sizes: %w", err)
+	}
+	if n != len(bs) {
+		return fmt.Errorf("sizes: expected to write %d bytes, wrote %d", len(bs), n)
+	}
+
+	return nil
+}
+
 func recordsToMultipartFormData(mw *multipart.Writer, recordSizes []uint32, recordsData []byte) error {
 	// record metadata
-	{
-		fw, err := mw.CreateFormField(RecordsMultipartSizesKey)
-		if err != nil {
-			return fmt.Errorf("creating form field: %w", err)
-		}
-
-		bs, err := json.Marshal(&recordSizes)
-		if err != nil {
-			return fmt.Errorf("failed to marshal sizes: %w", err)
-		}
-		n, err := fw.Write(bs)
-		if err != nil {
-			return fmt.Errorf("failed to write record sizes: %w", err)
-		}
-		if n != len(bs) {
-			return fmt.Errorf("sizes: expected to write %d bytes, wrote %d", len(bs), n)
-		}
+	err := sizesToMultipartFormData(mw, recordSizes)
+	if err != nil {
+		return err
 	}
 
 	// record data
@@ -77,6 +166,27 @@ func recordsToMultipartFormData(mw *multipart.Writer, recordSizes []uint32, reco
 	return nil
 }
 
+func expiresToMultipartFormData(mw *multipart.Writer, expires []int64) error {
+	fw, err := mw.CreateFormField(RecordsMultipartExpiresKey)
+	if err != nil {
+		return fmt.Errorf("creating form field: %w", err)
+	}
+
+	bs, err := json.Marshal(&expires)
+	if err != nil {
+		return fmt.Errorf("failed to marshal expiry times: %w", err)
+	}
+	_, err = fw.Write(bs)
+	if err != nil {
+		return fmt.Errorf("failed to write expiry times: %w", err)
+	}
+
+	return nil
+}
+
+// MultipartFormDataToRecords parses multipart form data written by
+// RecordsToMultipartFormData or RecordsWithExpiresToMultipartFormData into
+// batch.
 func MultipartFormDataToRecords(r io.Reader, boundary string, batch *sebrecords.Batch) (err error) {
 	if cap(batch.Sizes) == 0 || cap(batch.Data) == 0 {
 		return fmt.Errorf("%w: batch must have buffers allocated (cap(Sizes)=%d, cap(Data)=%d)", seberr.ErrBadInput, cap(batch.Sizes), cap(batch.Data))
@@ -165,6 +275,35 @@ func MultipartFormDataToRecords(r io.Reader, boundary string, batch *sebrecords.
 		}
 	}
 
+	// expires (optional)
+	{
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading multipart form data: %w", err)
+		}
+
+		if part.FormName() != RecordsMultipartExpiresKey {
+			return fmt.Errorf("%w: unexpected part '%s', expected '%s'", seberr.ErrBadInput, part.FormName(), RecordsMultipartExpiresKey)
+		}
+
+		err = json.NewDecoder(part).Decode(&batch.Expires)
+		if err != nil {
+			return fmt.Errorf("%w: parsing expiry times JSON: %s", seberr.ErrBadInput, err)
+		}
+
+		if len(batch.Expires) != len(batch.Sizes) {
+			return fmt.Errorf("%w: %d expiry times given for %d records", seberr.ErrBadInput, len(batch.Expires), len(batch.Sizes))
+		}
+
+		err = part.Close()
+		if err != nil {
+			return fmt.Errorf("closing multiwriter part: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -3,10 +3,12 @@ package httphelpers_test
 import (
 	"bytes"
 	"io"
+	"mime"
 	"mime/multipart"
 	"testing"
 
 	"github.com/micvbang/go-helpy/sizey"
+	"github.com/micvbang/go-helpy/slicey"
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
 	"github.com/micvbang/simple-event-broker/internal/sebrecords"
@@ -69,3 +71,80 @@ func recordsToMultipartFormData(t testing.TB, recordSizes []uint32, recordsData
 		expected:    expectedBatch,
 	}
 }
+
+// TestMultipartFormDataToRecordsExpires verifies that expiry times written by
+// RecordsWithExpiresToMultipartFormData are parsed into the batch, and that
+// ErrBadInput is returned when the number of expiry times does not match the
+// number of records.
+func TestMultipartFormDataToRecordsExpires(t *testing.T) {
+	inputBatch := tester.RecordsToBatch([][]byte{[]byte("42"), []byte("1337"), []byte("42")})
+
+	tests := map[string]struct {
+		expires     []int64
+		expected    []int64
+		expectedErr error
+	}{
+		"no expires":    {expires: nil, expected: []int64{}},
+		"expires":       {expires: []int64{0, 1337, 42}, expected: []int64{0, 1337, 42}},
+		"too few":       {expires: []int64{1}, expectedErr: seberr.ErrBadInput},
+		"too many":      {expires: []int64{1, 2, 3, 4}, expectedErr: seberr.ErrBadInput},
+		"all never set": {expires: []int64{0, 0, 0}, expected: []int64{0, 0, 0}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			buf := bytes.NewBuffer(nil)
+			contentType, err := httphelpers.RecordsWithExpiresToMultipartFormData(buf, inputBatch.Sizes, inputBatch.Data, test.expires)
+			require.NoError(t, err)
+
+			_, params, err := mime.ParseMediaType(contentType)
+			require.NoError(t, err)
+
+			batch := sebrecords.NewBatch(make([]uint32, 0, 64), make([]byte, 0, sizey.MB))
+			batch.Expires = []int64{}
+
+			// Act
+			err = httphelpers.MultipartFormDataToRecords(buf, params["boundary"], &batch)
+
+			// Assert
+			require.ErrorIs(t, err, test.expectedErr)
+			if test.expectedErr == nil {
+				require.Equal(t, inputBatch.IndividualRecords(), batch.IndividualRecords())
+				require.Equal(t, test.expected, batch.Expires)
+			}
+		})
+	}
+}
+
+// TestMultipartFormDataOverhead verifies that MultipartFormDataOverhead and
+// MultipartRecordOverhead give an upper bound of the size of the multipart
+// form data written by RecordsToMultipartFormDataHTTP.
+func TestMultipartFormDataOverhead(t *testing.T) {
+	tests := map[string]struct {
+		sizes []uint32
+	}{
+		"no records":   {sizes: []uint32{}},
+		"one record":   {sizes: []uint32{5}},
+		"many records": {sizes: []uint32{1, 10, 100, 1000, 10000}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			data := make([]byte, slicey.Sum(test.sizes))
+			buf := bytes.NewBuffer(nil)
+			mw := multipart.NewWriter(buf)
+
+			// Act
+			overhead, err := httphelpers.MultipartFormDataOverhead(mw.Boundary())
+			require.NoError(t, err)
+
+			// Assert
+			err = httphelpers.RecordsToMultipartFormDataHTTP(mw, test.sizes, data)
+			require.NoError(t, err)
+			require.NoError(t, mw.Close())
+
+			require.LessOrEqual(t, buf.Len(), overhead+len(data)+len(test.sizes)*httphelpers.MultipartRecordOverhead)
+			require.GreaterOrEqual(t, buf.Len(), overhead+len(data))
+		})
+	}
+}
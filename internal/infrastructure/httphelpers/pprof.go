@@ -1,6 +1,8 @@
 package httphelpers
 
 import (
+	"context"
+	"expvar"
 	"fmt"
 	"net/http"
 	"net/http/pprof"
@@ -8,7 +10,9 @@ import (
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
 )
 
-func ListenAndServePprof(log logger.Logger, address string, port int) error {
+// ListenAndServePprof serves pprof endpoints on address:port until ctx is
+// cancelled.
+func ListenAndServePprof(ctx context.Context, log logger.Logger, address string, port int) error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /debug/pprof/", pprof.Index)
 	mux.HandleFunc("GET /debug/pprof/heap", pprof.Index)
@@ -25,7 +29,19 @@ func ListenAndServePprof(log logger.Logger, address string, port int) error {
 	mux.HandleFunc("POST /debug/pprof/symbol", pprof.Symbol)
 	mux.HandleFunc("GET /debug/pprof/trace", pprof.Trace)
 
+	mux.Handle("GET /debug/vars", expvar.Handler())
+
 	listenAddr := fmt.Sprintf("%s:%d", address, port)
 	log.Warnf("Listening for DEBUG traffic on %s", listenAddr)
-	return http.ListenAndServe(listenAddr, mux)
+	srv := &http.Server{Addr: listenAddr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+
+	err := srv.ListenAndServe()
+	if err == http.ErrServerClosed {
+		return ctx.Err()
+	}
+	return err
 }
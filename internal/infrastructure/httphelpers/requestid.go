@@ -0,0 +1,82 @@
+package httphelpers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+)
+
+// RequestIDHeader is the header from which the ID of requests is read. If
+// requests don't have an ID, one is generated. The ID is returned in the
+// response's RequestIDHeader.
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDMaxLength is the maximum length of request IDs given by clients;
+// longer IDs are replaced by a generated one.
+const requestIDMaxLength = 128
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx that holds requestID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns the ID of the request, as added by
+// NewRequestIDHandler.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	requestID, ok := ctx.Value(requestIDKey{}).(string)
+	return requestID, ok
+}
+
+// NewRequestIDHandler returns an http.Handler that can be used to wrap other
+// http.Handlers. The returned http.Handler adds the ID of the request to the
+// request's context, from where it can be retrieved using
+// RequestIDFromContext, and logs each request with its ID.
+func NewRequestIDHandler(log logger.Logger) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestID := r.Header.Get(RequestIDHeader)
+			if len(requestID) == 0 || len(requestID) > requestIDMaxLength {
+				requestID = newRequestID()
+			}
+			w.Header().Set(RequestIDHeader, requestID)
+
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			t0 := time.Now()
+			h.ServeHTTP(sw, r.WithContext(WithRequestID(r.Context(), requestID)))
+
+			log.WithField(logger.FieldRequestID, requestID).
+				WithField("status", sw.status).
+				Debugf("%s %s (%s)", r.Method, r.URL.Path, time.Since(t0))
+		})
+	}
+}
+
+func newRequestID() string {
+	bs := make([]byte, 16)
+	rand.Read(bs)
+	return hex.EncodeToString(bs)
+}
+
+// statusWriter records the status code written to the wrapped
+// http.ResponseWriter.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	sw.status = status
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap makes it possible for http.ResponseController to reach the wrapped
+// http.ResponseWriter, e.g. to flush it.
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
@@ -0,0 +1,56 @@
+package httphelpers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRequestIDHandler verifies that NewRequestIDHandler makes the request ID
+// given by the client available to the wrapped handler and returns it in the
+// response, and that an ID is generated when the client doesn't give one, or
+// the given one is too long.
+func TestRequestIDHandler(t *testing.T) {
+	tests := map[string]struct {
+		requestID string
+		generated bool
+	}{
+		"given":    {requestID: "some-request-id"},
+		"missing":  {requestID: "", generated: true},
+		"too long": {requestID: strings.Repeat("a", 129), generated: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var handlerRequestID string
+			handler := httphelpers.NewRequestIDHandler(log)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var ok bool
+				handlerRequestID, ok = httphelpers.RequestIDFromContext(r.Context())
+				require.True(t, ok)
+				w.WriteHeader(http.StatusTeapot)
+			}))
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set(httphelpers.RequestIDHeader, test.requestID)
+			w := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(w, r)
+
+			// Assert
+			require.Equal(t, http.StatusTeapot, w.Code)
+			responseRequestID := w.Header().Get(httphelpers.RequestIDHeader)
+			require.Equal(t, handlerRequestID, responseRequestID)
+			if test.generated {
+				require.NotEmpty(t, responseRequestID)
+				require.NotEqual(t, test.requestID, responseRequestID)
+			} else {
+				require.Equal(t, test.requestID, responseRequestID)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package httphelpers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+)
+
+// ServerConfig configures NewServer. Timeouts and limits are disabled if 0.
+type ServerConfig struct {
+	// ReadHeaderTimeout is the amount of time allowed to read request
+	// headers, and ReadTimeout the amount of time allowed to read entire
+	// requests.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+
+	// WriteTimeout is the amount of time allowed to write responses, counted
+	// from when the request headers have been read. Handlers that wait before
+	// responding, e.g. long-polls, can extend it using ExtendWriteDeadline.
+	WriteTimeout time.Duration
+
+	// IdleTimeout is the amount of time to keep idle keep-alive connections
+	// open.
+	IdleTimeout time.Duration
+
+	// MaxHeaderBytes is the maximum size of request headers, and MaxBodyBytes
+	// the maximum size of request bodies.
+	MaxHeaderBytes int
+	MaxBodyBytes   int64
+
+	// Drain is called when Shutdown is called, and should make long-running
+	// requests, e.g. long-polls, return as soon as possible such that
+	// Shutdown doesn't have to wait for them to time out.
+	Drain func()
+}
+
+// Server is an http.Server that enforces the timeouts and limits of a
+// ServerConfig, and that drains in-flight requests when shutting down.
+type Server struct {
+	log logger.Logger
+	srv *http.Server
+}
+
+type writeTimeoutKey struct{}
+
+// NewServer returns a Server that serves handler as configured by cfg.
+func NewServer(log logger.Logger, handler http.Handler, cfg ServerConfig) *Server {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cfg.MaxBodyBytes > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxBodyBytes)
+		}
+
+		ctx := context.WithValue(r.Context(), writeTimeoutKey{}, cfg.WriteTimeout)
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+
+	srv := &http.Server{
+		Handler:           h,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+	if cfg.Drain != nil {
+		srv.RegisterOnShutdown(cfg.Drain)
+	}
+
+	return &Server{log: log, srv: srv}
+}
+
+// Serve accepts connections on l until Shutdown is called, in which case it
+// returns http.ErrServerClosed.
+func (s *Server) Serve(l net.Listener) error {
+	return s.srv.Serve(l)
+}
+
+// Shutdown stops accepting new connections, closes idle connections, drains
+// long-running requests, and waits for in-flight requests to finish until ctx
+// expires.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.log.Infof("shutting down, waiting for in-flight requests")
+	t0 := time.Now()
+
+	err := s.srv.Shutdown(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.log.Infof("in-flight requests finished (%s)", time.Since(t0))
+	return nil
+}
+
+// ExtendWriteDeadline extends the deadline for writing the response of r to
+// the server's WriteTimeout after d from now. Handlers that wait for up to d
+// before responding, e.g. long-polls, must call this in order not to time out.
+// It does nothing for requests that aren't served by a Server with a
+// WriteTimeout.
+func ExtendWriteDeadline(w http.ResponseWriter, r *http.Request, d time.Duration) error {
+	writeTimeout, _ := r.Context().Value(writeTimeoutKey{}).(time.Duration)
+	if writeTimeout <= 0 {
+		return nil
+	}
+
+	return http.NewResponseController(w).SetWriteDeadline(time.Now().Add(d + writeTimeout))
+}
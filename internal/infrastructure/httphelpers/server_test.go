@@ -0,0 +1,103 @@
+package httphelpers_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/stretchr/testify/require"
+)
+
+// TestServerShutdownDrains verifies that Server.Shutdown calls Drain, and
+// waits for in-flight requests to finish.
+func TestServerShutdownDrains(t *testing.T) {
+	drain := make(chan struct{})
+	requestStarted := make(chan struct{})
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(requestStarted)
+		select {
+		case <-drain:
+		case <-time.After(10 * time.Second):
+		}
+		w.WriteHeader(http.StatusPartialContent)
+	})
+
+	srv := httphelpers.NewServer(log, handler, httphelpers.ServerConfig{
+		Drain: func() { close(drain) },
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go srv.Serve(l)
+
+	responses := make(chan *http.Response)
+	go func() {
+		res, err := http.Get("http://" + l.Addr().String())
+		require.NoError(t, err)
+		responses <- res
+	}()
+	<-requestStarted
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Act
+	t0 := time.Now()
+	err = srv.Shutdown(ctx)
+
+	// Assert
+	require.NoError(t, err)
+	require.Less(t, time.Since(t0), 5*time.Second)
+
+	res := <-responses
+	defer res.Body.Close()
+	require.Equal(t, http.StatusPartialContent, res.StatusCode)
+}
+
+// TestServerMaxBodyBytes verifies that request bodies larger than
+// MaxBodyBytes can't be read.
+func TestServerMaxBodyBytes(t *testing.T) {
+	tests := map[string]struct {
+		bodySize int
+		tooLarge bool
+	}{
+		"at limit":  {bodySize: 1024},
+		"too large": {bodySize: 1025, tooLarge: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			readErrs := make(chan error, 1)
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, err := io.ReadAll(r.Body)
+				readErrs <- err
+			})
+
+			srv := httphelpers.NewServer(log, handler, httphelpers.ServerConfig{
+				MaxBodyBytes: 1024,
+			})
+
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			go srv.Serve(l)
+			defer srv.Shutdown(context.Background())
+
+			// Act
+			res, err := http.Post("http://"+l.Addr().String(), "application/octet-stream", bytes.NewReader(make([]byte, test.bodySize)))
+			require.NoError(t, err)
+			res.Body.Close()
+
+			// Assert
+			err = <-readErrs
+			var maxBytesErr *http.MaxBytesError
+			require.Equal(t, test.tooLarge, errors.As(err, &maxBytesErr))
+		})
+	}
+}
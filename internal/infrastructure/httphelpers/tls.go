@@ -0,0 +1,207 @@
+package httphelpers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+)
+
+type TLSConfig struct {
+	// CertFile and KeyFile are paths to the PEM encoded certificate and key
+	// used by the server. They are reloaded when they change on disk.
+	CertFile string
+	KeyFile  string
+
+	// ClientCAFile is the path to PEM encoded CA certificates used to verify
+	// client certificates. If empty, client certificates are not requested.
+	ClientCAFile string
+
+	// RequireClientCert makes the server reject clients that do not present
+	// a valid certificate. Requires ClientCAFile.
+	RequireClientCert bool
+
+	// AllowedClientIdentities are the subject common names of the client
+	// certificates that are accepted. Clients presenting a verified
+	// certificate with any other identity are rejected during the handshake.
+	// All verified certificates are accepted if empty. Requires ClientCAFile.
+	AllowedClientIdentities []string
+}
+
+// NewTLSConfig returns a *tls.Config using the certificates given in cfg.
+func NewTLSConfig(log logger.Logger, cfg TLSConfig) (*tls.Config, error) {
+	certReloader, err := NewCertReloader(log, cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certReloader.GetCertificate,
+	}
+
+	if cfg.ClientCAFile == "" {
+		if cfg.RequireClientCert || len(cfg.AllowedClientIdentities) > 0 {
+			return nil, fmt.Errorf("client CA file required in order to verify client certificates")
+		}
+		return tlsConfig, nil
+	}
+
+	caPEM, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading client CA file: %w", err)
+	}
+
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in client CA file '%s'", cfg.ClientCAFile)
+	}
+	tlsConfig.ClientCAs = clientCAs
+
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	if cfg.RequireClientCert {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	if len(cfg.AllowedClientIdentities) > 0 {
+		allowedIdentities := slices.Clone(cfg.AllowedClientIdentities)
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.VerifiedChains) == 0 || len(cs.VerifiedChains[0]) == 0 {
+				return nil
+			}
+
+			identity := cs.VerifiedChains[0][0].Subject.CommonName
+			if !slices.Contains(allowedIdentities, identity) {
+				log.Infof("rejecting client certificate identity '%s'", identity)
+				return fmt.Errorf("client certificate identity '%s' not allowed", identity)
+			}
+			return nil
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// CertReloader loads a certificate and key from disk, and reloads them when
+// either of the files are modified. This allows certificates to be rotated
+// without restarting the server.
+type CertReloader struct {
+	log      logger.Logger
+	certFile string
+	keyFile  string
+
+	mu          sync.Mutex
+	cert        *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+}
+
+func NewCertReloader(log logger.Logger, certFile string, keyFile string) (*CertReloader, error) {
+	cr := &CertReloader{
+		log:      log,
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	err := cr.reloadIfModified()
+	if err != nil {
+		return nil, err
+	}
+
+	return cr, nil
+}
+
+// GetCertificate returns the most recently loaded certificate. It can be used
+// as tls.Config.GetCertificate. If reloading a modified certificate fails,
+// the previously loaded certificate is returned.
+func (cr *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	err := cr.reloadIfModified()
+	if err != nil {
+		cr.log.Errorf("reloading certificate, using previous: %s", err)
+	}
+
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	return cr.cert, nil
+}
+
+func (cr *CertReloader) reloadIfModified() error {
+	certStat, err := os.Stat(cr.certFile)
+	if err != nil {
+		return fmt.Errorf("stat'ing certificate file: %w", err)
+	}
+
+	keyStat, err := os.Stat(cr.keyFile)
+	if err != nil {
+		return fmt.Errorf("stat'ing key file: %w", err)
+	}
+
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if cr.cert != nil && certStat.ModTime().Equal(cr.certModTime) && keyStat.ModTime().Equal(cr.keyModTime) {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading certificate: %w", err)
+	}
+
+	cr.log.Infof("loaded certificate '%s'", cr.certFile)
+	cr.cert = &cert
+	cr.certModTime = certStat.ModTime()
+	cr.keyModTime = keyStat.ModTime()
+
+	return nil
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx that holds identity.
+func WithIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns the identity of the client making the request,
+// as added by NewClientCertIdentityHandler.
+func IdentityFromContext(ctx context.Context) (string, bool) {
+	identity, ok := ctx.Value(identityKey{}).(string)
+	return identity, ok
+}
+
+// NewClientCertIdentityHandler returns an http.HandlerFunc that can be used to
+// wrap other http.HandlerFuncs. If the client presented a verified
+// certificate, identify is used to map it to an identity that is added to the
+// request's context, and can be retrieved using IdentityFromContext. If
+// identify is nil, the certificate's subject common name is used.
+//
+// The handler doesn't authorize identities; clients are authorized by the
+// handlers it wraps, and by TLSConfig.AllowedClientIdentities during the
+// handshake.
+func NewClientCertIdentityHandler(log logger.Logger, identify func(cert *x509.Certificate) string) func(http.HandlerFunc) http.HandlerFunc {
+	if identify == nil {
+		identify = func(cert *x509.Certificate) string {
+			return cert.Subject.CommonName
+		}
+	}
+
+	return func(hf http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+				identity := identify(r.TLS.VerifiedChains[0][0])
+				log.Debugf("client certificate identity '%s'", identity)
+				r = r.WithContext(WithIdentity(r.Context(), identity))
+			}
+
+			hf.ServeHTTP(w, r)
+		}
+	}
+}
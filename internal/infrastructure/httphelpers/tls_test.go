@@ -0,0 +1,226 @@
+package httphelpers_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/httphelpers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCertReloaderReloadsModifiedCert verifies that CertReloader returns the
+// new certificate once the certificate files have been modified.
+func TestCertReloaderReloadsModifiedCert(t *testing.T) {
+	certFile, keyFile := writeCert(t, t.TempDir(), "first")
+
+	certReloader, err := httphelpers.NewCertReloader(log, certFile, keyFile)
+	require.NoError(t, err)
+
+	cert, err := certReloader.GetCertificate(nil)
+	require.NoError(t, err)
+	require.Equal(t, "first", cert.Leaf.Subject.CommonName)
+
+	// Act
+	writeCert(t, filepath.Dir(certFile), "second")
+	modTime := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+
+	// Assert
+	cert, err = certReloader.GetCertificate(nil)
+	require.NoError(t, err)
+	require.Equal(t, "second", cert.Leaf.Subject.CommonName)
+}
+
+// TestCertReloaderKeepsCertOnInvalidReload verifies that CertReloader keeps
+// returning the previously loaded certificate if the modified files are
+// invalid.
+func TestCertReloaderKeepsCertOnInvalidReload(t *testing.T) {
+	certFile, keyFile := writeCert(t, t.TempDir(), "first")
+
+	certReloader, err := httphelpers.NewCertReloader(log, certFile, keyFile)
+	require.NoError(t, err)
+
+	// Act
+	require.NoError(t, os.WriteFile(certFile, []byte("not a certificate"), 0o600))
+	modTime := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+
+	// Assert
+	cert, err := certReloader.GetCertificate(nil)
+	require.NoError(t, err)
+	require.Equal(t, "first", cert.Leaf.Subject.CommonName)
+}
+
+// TestClientCertIdentity verifies that the identity of clients presenting a
+// verified certificate is available via IdentityFromContext, that clients
+// without certificates are allowed when client certificates are optional, and
+// rejected when they are required. Clients whose identity isn't one of the
+// allowed identities must be rejected.
+func TestClientCertIdentity(t *testing.T) {
+	tests := map[string]struct {
+		requireClientCert bool
+		allowedIdentities []string
+		sendClientCert    bool
+		expectedIdentity  string
+		expectErr         bool
+	}{
+		"optional, with cert": {
+			sendClientCert:   true,
+			expectedIdentity: "client",
+		},
+		"optional, without cert": {
+			expectedIdentity: "",
+		},
+		"required, with cert": {
+			requireClientCert: true,
+			sendClientCert:    true,
+			expectedIdentity:  "client",
+		},
+		"required, without cert": {
+			requireClientCert: true,
+			expectErr:         true,
+		},
+		"allowed identity": {
+			requireClientCert: true,
+			allowedIdentities: []string{"other", "client"},
+			sendClientCert:    true,
+			expectedIdentity:  "client",
+		},
+		"identity not allowed": {
+			requireClientCert: true,
+			allowedIdentities: []string{"other"},
+			sendClientCert:    true,
+			expectErr:         true,
+		},
+		"optional, identity not allowed": {
+			allowedIdentities: []string{"other"},
+			sendClientCert:    true,
+			expectErr:         true,
+		},
+		"optional, without cert, identities allowed": {
+			allowedIdentities: []string{"other"},
+			expectedIdentity:  "",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			serverCertFile, serverKeyFile := writeCert(t, filepath.Join(dir, "server"), "localhost")
+			clientCertFile, clientKeyFile := writeCert(t, filepath.Join(dir, "client"), "client")
+
+			tlsConfig, err := httphelpers.NewTLSConfig(log, httphelpers.TLSConfig{
+				CertFile:                serverCertFile,
+				KeyFile:                 serverKeyFile,
+				ClientCAFile:            clientCertFile,
+				RequireClientCert:       test.requireClientCert,
+				AllowedClientIdentities: test.allowedIdentities,
+			})
+			require.NoError(t, err)
+
+			withIdentity := httphelpers.NewClientCertIdentityHandler(log, nil)
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+
+			srv := &http.Server{Handler: withIdentity(func(w http.ResponseWriter, r *http.Request) {
+				identity, _ := httphelpers.IdentityFromContext(r.Context())
+				w.Write([]byte(identity))
+			})}
+			go srv.Serve(tls.NewListener(l, tlsConfig))
+			defer srv.Close()
+
+			client := httpsClient(t, serverCertFile, clientCertFile, clientKeyFile, test.sendClientCert)
+
+			// Act
+			res, err := client.Get(fmt.Sprintf("https://%s", l.Addr()))
+
+			// Assert
+			if test.expectErr {
+				if err == nil {
+					// TLS 1.3 reports a missing client certificate after
+					// the handshake has completed.
+					_, err = io.ReadAll(res.Body)
+				}
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			defer res.Body.Close()
+
+			identity, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+			require.Equal(t, test.expectedIdentity, string(identity))
+		})
+	}
+}
+
+// TestNewTLSConfigRequireClientCertWithoutCA verifies that an error is
+// returned when requiring client certificates, or allowing only some client
+// identities, without a CA to verify them.
+func TestNewTLSConfigRequireClientCertWithoutCA(t *testing.T) {
+	certFile, keyFile := writeCert(t, t.TempDir(), "localhost")
+
+	tests := map[string]httphelpers.TLSConfig{
+		"require client cert": {
+			CertFile:          certFile,
+			KeyFile:           keyFile,
+			RequireClientCert: true,
+		},
+		"allowed identities": {
+			CertFile:                certFile,
+			KeyFile:                 keyFile,
+			AllowedClientIdentities: []string{"client"},
+		},
+	}
+
+	for name, cfg := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			_, err := httphelpers.NewTLSConfig(log, cfg)
+
+			// Assert
+			require.Error(t, err)
+		})
+	}
+}
+
+func writeCert(t *testing.T, dir string, commonName string) (certFile string, keyFile string) {
+	require.NoError(t, os.MkdirAll(dir, os.ModePerm))
+
+	certPEM, keyPEM := tester.SelfSignedCert(t, commonName)
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, certPEM, 0o600))
+	require.NoError(t, os.WriteFile(keyFile, keyPEM, 0o600))
+
+	return certFile, keyFile
+}
+
+func httpsClient(t *testing.T, serverCertFile string, clientCertFile string, clientKeyFile string, sendClientCert bool) *http.Client {
+	serverCertPEM, err := os.ReadFile(serverCertFile)
+	require.NoError(t, err)
+
+	rootCAs := x509.NewCertPool()
+	require.True(t, rootCAs.AppendCertsFromPEM(serverCertPEM))
+
+	tlsConfig := &tls.Config{RootCAs: rootCAs}
+	if sendClientCert {
+		clientCert, err := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
+		require.NoError(t, err)
+		tlsConfig.Certificates = []tls.Certificate{clientCert}
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+}
@@ -2,6 +2,9 @@ package logger
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"os"
 
 	"github.com/sirupsen/logrus"
 )
@@ -14,6 +17,57 @@ const (
 	LevelDebug LogLevel = LogLevel(logrus.DebugLevel)
 )
 
+var levelNames = map[LogLevel]string{
+	LevelWarn:  "warn",
+	LevelInfo:  "info",
+	LevelDebug: "debug",
+}
+
+func (l LogLevel) String() string {
+	name, ok := levelNames[l]
+	if !ok {
+		return fmt.Sprintf("LogLevel(%d)", int(l))
+	}
+	return name
+}
+
+// ParseLevel returns the LogLevel with the given name, as returned by
+// LogLevel.String().
+func ParseLevel(name string) (LogLevel, error) {
+	for level, levelName := range levelNames {
+		if levelName == name {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level '%s'", name)
+}
+
+// Format is the output format of log lines.
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatJSON Format = "json"
+)
+
+// ParseFormat returns the Format with the given name.
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(name); format {
+	case FormatText, FormatJSON:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown log format '%s'", name)
+}
+
+// Names of fields used by log lines throughout the project, making it possible
+// to filter logs on them when they're fed into log aggregation systems.
+const (
+	FieldTopicName = "topic-name"
+	FieldOffset    = "offset"
+	FieldBatchID   = "batch-id"
+	FieldRequestID = "request-id"
+)
+
 // Logger contains methods used for logging in this project
 type Logger interface {
 	Infof(format string, a ...interface{})
@@ -25,10 +79,74 @@ type Logger interface {
 	Name(name string) Logger
 }
 
-func NewWithLevel(ctx context.Context, level LogLevel) Logger {
+// LevelVar controls the level of a Logger returned by New, allowing the level
+// to be changed while the Logger is in use.
+type LevelVar struct {
+	log *logrus.Logger
+}
+
+// Level returns the current log level.
+func (lv *LevelVar) Level() LogLevel {
+	return LogLevel(lv.log.GetLevel())
+}
+
+// Set sets the log level. It's safe to call concurrently with logging.
+func (lv *LevelVar) Set(level LogLevel) {
+	lv.log.SetLevel(logrus.Level(level))
+}
+
+type Opts struct {
+	Level  LogLevel
+	Format Format
+	Output io.Writer
+}
+
+// WithLevel sets the initial log level.
+func WithLevel(level LogLevel) func(*Opts) {
+	return func(o *Opts) {
+		o.Level = level
+	}
+}
+
+// WithFormat sets the output format of log lines.
+func WithFormat(format Format) func(*Opts) {
+	return func(o *Opts) {
+		o.Format = format
+	}
+}
+
+// WithOutput sets the writer that log lines are written to.
+func WithOutput(w io.Writer) func(*Opts) {
+	return func(o *Opts) {
+		o.Output = w
+	}
+}
+
+// New returns a Logger configured by optFns, and a LevelVar that can be used
+// to change its level at runtime.
+func New(ctx context.Context, optFns ...func(*Opts)) (Logger, *LevelVar) {
+	opts := Opts{
+		Level:  LevelInfo,
+		Format: FormatText,
+		Output: os.Stderr,
+	}
+	for _, optFn := range optFns {
+		optFn(&opts)
+	}
+
 	logrusLogger := logrus.New()
-	logrusLogger.Level = logrus.Level(level)
-	return NewLogrus(ctx, logrusLogger)
+	logrusLogger.Level = logrus.Level(opts.Level)
+	logrusLogger.Out = opts.Output
+	if opts.Format == FormatJSON {
+		logrusLogger.Formatter = &logrus.JSONFormatter{}
+	}
+
+	return NewLogrus(ctx, logrusLogger), &LevelVar{log: logrusLogger}
+}
+
+func NewWithLevel(ctx context.Context, level LogLevel) Logger {
+	log, _ := New(ctx, WithLevel(level))
+	return log
 }
 
 func NewDefault(ctx context.Context) Logger {
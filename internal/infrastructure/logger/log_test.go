@@ -0,0 +1,62 @@
+package logger_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/stretchr/testify/require"
+)
+
+// TestJSONFormat verifies that FormatJSON writes log lines as JSON objects
+// that include the fields of the Logger.
+func TestJSONFormat(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log, _ := logger.New(context.Background(), logger.WithFormat(logger.FormatJSON), logger.WithOutput(buf))
+
+	// Act
+	log.WithField(logger.FieldTopicName, "topic").WithField(logger.FieldOffset, 42).Infof("hello %s", "world")
+
+	// Assert
+	line := map[string]any{}
+	err := json.Unmarshal(buf.Bytes(), &line)
+	require.NoError(t, err)
+	require.Equal(t, "hello world", line["msg"])
+	require.Equal(t, "info", line["level"])
+	require.Equal(t, "topic", line[logger.FieldTopicName])
+	require.Equal(t, float64(42), line[logger.FieldOffset])
+}
+
+// TestLevelVarSet verifies that LevelVar.Set changes the level of the Logger
+// and of Loggers derived from it.
+func TestLevelVarSet(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	log, level := logger.New(context.Background(), logger.WithLevel(logger.LevelInfo), logger.WithOutput(buf))
+	log = log.Name("derived")
+
+	log.Debugf("not logged")
+	require.Empty(t, buf.Bytes())
+
+	// Act
+	level.Set(logger.LevelDebug)
+
+	// Assert
+	require.Equal(t, logger.LevelDebug, level.Level())
+	log.Debugf("logged")
+	require.Contains(t, buf.String(), "logged")
+}
+
+// TestParseLevel verifies that ParseLevel returns the level of names returned
+// by LogLevel.String(), and an error for unknown names.
+func TestParseLevel(t *testing.T) {
+	for _, level := range []logger.LogLevel{logger.LevelWarn, logger.LevelInfo, logger.LevelDebug} {
+		got, err := logger.ParseLevel(level.String())
+		require.NoError(t, err)
+		require.Equal(t, level, got)
+	}
+
+	_, err := logger.ParseLevel("verbose")
+	require.Error(t, err)
+}
@@ -0,0 +1,227 @@
+// Package retry implements retries with exponential backoff and jitter, and a
+// circuit breaker that fails requests right away while whatever they're sent
+// to appears to be unavailable.
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+var (
+	ErrBreakerOpen    = errors.New("circuit breaker is open")
+	ErrBreakerProbing = errors.New("circuit breaker is probing")
+)
+
+type Opts struct {
+	// MaxAttempts is the maximum number of times a request is attempted
+	// before its error is returned. Requests are not retried if it's 1 or
+	// less.
+	MaxAttempts int
+
+	// BaseDelay is the delay before the first retry. It's doubled for each
+	// following retry, up to MaxDelay. The actual delay is chosen at random
+	// between 0 and the computed delay, such that retries of concurrent
+	// requests are spread out.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// BreakerFailures is the number of consecutive failed requests after
+	// which the circuit breaker trips. While it's tripped, requests fail
+	// right away, until BreakerCooldown has passed and a single request is
+	// let through to probe whether requests succeed again. Disabled if 0.
+	BreakerFailures int
+	BreakerCooldown time.Duration
+}
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// Stats counts the requests, retries and circuit breaker state changes of a
+// Retrier.
+type Stats struct {
+	Requests  uint64
+	Retries   uint64
+	Failures  uint64
+	FastFails uint64
+
+	BreakerState     string
+	BreakerOpened    uint64
+	BreakerHalfOpens uint64
+	BreakerClosed    uint64
+}
+
+// Retrier holds the state of a circuit breaker shared by all requests that
+// are retried using it. Requests are retried by a loop owned by the caller,
+// which uses Allow before each attempt, reports its outcome using Succeeded,
+// Failed or Abandoned, and waits for Backoff before each retry.
+//
+// Retrier is safe for concurrent use.
+type Retrier struct {
+	opts Opts
+	now  func() time.Time
+
+	// stateChanged is called with the new state of the circuit breaker, and
+	// the error that tripped it, if any, e.g. for logging.
+	stateChanged func(state string, err error)
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+	stats    Stats
+}
+
+// New returns a Retrier configured by opts. stateChanged is called whenever
+// the circuit breaker changes state; it may be nil.
+func New(opts Opts, now func() time.Time, stateChanged func(state string, err error)) *Retrier {
+	if stateChanged == nil {
+		stateChanged = func(string, error) {}
+	}
+
+	return &Retrier{
+		opts:         opts,
+		now:          now,
+		stateChanged: stateChanged,
+		state:        BreakerClosed,
+	}
+}
+
+// MaxAttempts returns the maximum number of times a request is attempted,
+// which is at least 1.
+func (r *Retrier) MaxAttempts() int {
+	return max(r.opts.MaxAttempts, 1)
+}
+
+// Backoff returns the delay before the given retry attempt, counting the first
+// attempt as 0.
+func (r *Retrier) Backoff(attempt int) time.Duration {
+	delay := r.opts.BaseDelay << min(attempt-1, 30)
+	if r.opts.MaxDelay > 0 && (delay > r.opts.MaxDelay || delay <= 0) {
+		delay = r.opts.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	return rand.N(delay)
+}
+
+// Allow returns ErrBreakerOpen if the circuit breaker is open, or
+// ErrBreakerProbing if it's half-open and already probing. Once the cooldown
+// has passed, an open circuit breaker becomes half-open and allows a single
+// request through.
+func (r *Retrier) Allow() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stats.Requests += 1
+
+	switch r.state {
+	case BreakerOpen:
+		if r.now().Sub(r.openedAt) < r.opts.BreakerCooldown {
+			r.stats.FastFails += 1
+			return ErrBreakerOpen
+		}
+
+		r.state = BreakerHalfOpen
+		r.stats.BreakerHalfOpens += 1
+		r.probing = true
+		r.stateChanged(r.state, nil)
+		return nil
+
+	case BreakerHalfOpen:
+		if r.probing {
+			r.stats.FastFails += 1
+			return ErrBreakerProbing
+		}
+		r.probing = true
+	}
+
+	return nil
+}
+
+// Succeeded records that a request didn't fail in a way that retrying could
+// resolve, closing the circuit breaker.
+func (r *Retrier) Succeeded() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.failures = 0
+	r.probing = false
+	if r.state != BreakerClosed {
+		r.state = BreakerClosed
+		r.stats.BreakerClosed += 1
+		r.stateChanged(r.state, nil)
+	}
+}
+
+// Abandoned records that a request was given up by its caller before its
+// outcome was known, letting another request probe a half-open circuit
+// breaker.
+func (r *Retrier) Abandoned() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.probing = false
+}
+
+// Failed records that a request failed with err in a way that retrying may
+// resolve, opening the circuit breaker if it's half-open or if
+// BreakerFailures consecutive requests have failed.
+func (r *Retrier) Failed(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stats.Failures += 1
+	r.failures += 1
+	r.probing = false
+
+	if r.opts.BreakerFailures <= 0 {
+		return
+	}
+
+	if r.state == BreakerHalfOpen || (r.state == BreakerClosed && r.failures >= r.opts.BreakerFailures) {
+		r.state = BreakerOpen
+		r.openedAt = r.now()
+		r.stats.BreakerOpened += 1
+		r.stateChanged(r.state, err)
+	}
+}
+
+// Retried records that a failed request is retried.
+func (r *Retrier) Retried() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stats.Retries += 1
+}
+
+func (r *Retrier) Stats() Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := r.stats
+	stats.BreakerState = r.state
+	return stats
+}
+
+// Sleep waits for d to pass, returning ctx.Err() if ctx expires first.
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,103 @@
+package retry_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/retry"
+	"github.com/stretchr/testify/require"
+)
+
+var errUnavailable = errors.New("unavailable")
+
+// TestRetrierBreaker verifies that the circuit breaker opens after
+// BreakerFailures consecutive failures, fails requests right away until
+// BreakerCooldown has passed, lets a single request probe while it's
+// half-open, and closes once the probe succeeds.
+func TestRetrierBreaker(t *testing.T) {
+	const cooldown = time.Minute
+	now := time.Now()
+	states := []string{}
+
+	r := retry.New(retry.Opts{BreakerFailures: 2, BreakerCooldown: cooldown}, func() time.Time { return now }, func(state string, err error) {
+		states = append(states, state)
+	})
+
+	for range 2 {
+		require.NoError(t, r.Allow())
+		r.Failed(errUnavailable)
+	}
+
+	// Act, Assert
+	require.ErrorIs(t, r.Allow(), retry.ErrBreakerOpen)
+	require.Equal(t, retry.BreakerOpen, r.Stats().BreakerState)
+
+	now = now.Add(cooldown)
+	require.NoError(t, r.Allow())
+	require.ErrorIs(t, r.Allow(), retry.ErrBreakerProbing)
+	require.Equal(t, retry.BreakerHalfOpen, r.Stats().BreakerState)
+
+	r.Succeeded()
+	require.NoError(t, r.Allow())
+
+	stats := r.Stats()
+	require.Equal(t, retry.BreakerClosed, stats.BreakerState)
+	require.Equal(t, uint64(1), stats.BreakerOpened)
+	require.Equal(t, uint64(1), stats.BreakerHalfOpens)
+	require.Equal(t, uint64(1), stats.BreakerClosed)
+	require.Equal(t, uint64(2), stats.FastFails)
+	require.Equal(t, []string{retry.BreakerOpen, retry.BreakerHalfOpen, retry.BreakerClosed}, states)
+}
+
+// TestRetrierBreakerFailedProbe verifies that a half-open circuit breaker opens
+// again if the probe fails, and that abandoning the probe lets another request
+// probe instead.
+func TestRetrierBreakerFailedProbe(t *testing.T) {
+	const cooldown = time.Minute
+	now := time.Now()
+
+	r := retry.New(retry.Opts{BreakerFailures: 1, BreakerCooldown: cooldown}, func() time.Time { return now }, nil)
+
+	require.NoError(t, r.Allow())
+	r.Failed(errUnavailable)
+	now = now.Add(cooldown)
+
+	// Act, Assert
+	require.NoError(t, r.Allow())
+	r.Abandoned()
+	require.NoError(t, r.Allow())
+	r.Failed(errUnavailable)
+
+	require.ErrorIs(t, r.Allow(), retry.ErrBreakerOpen)
+	require.Equal(t, uint64(2), r.Stats().BreakerOpened)
+}
+
+// TestRetrierBackoff verifies that backoff delays are at most BaseDelay
+// doubled for each retry, capped by MaxDelay.
+func TestRetrierBackoff(t *testing.T) {
+	r := retry.New(retry.Opts{BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}, time.Now, nil)
+
+	tests := map[string]struct {
+		attempt  int
+		maxDelay time.Duration
+	}{
+		"first retry":  {attempt: 1, maxDelay: time.Millisecond},
+		"second retry": {attempt: 2, maxDelay: 2 * time.Millisecond},
+		"capped":       {attempt: 10, maxDelay: 5 * time.Millisecond},
+		"overflow":     {attempt: 100, maxDelay: 5 * time.Millisecond},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			for range 100 {
+				// Act
+				delay := r.Backoff(test.attempt)
+
+				// Assert
+				require.GreaterOrEqual(t, delay, time.Duration(0))
+				require.Less(t, delay, test.maxDelay)
+			}
+		})
+	}
+}
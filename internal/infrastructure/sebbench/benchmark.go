@@ -76,7 +76,7 @@ func (lb *LocalBroker) Start() (*seb.RecordClient, error) {
 
 	mux := http.NewServeMux()
 	const apiKey = "api-key"
-	httphandlers.RegisterRoutes(lb.log, mux, lb.batchPool, broker, apiKey)
+	httphandlers.RegisterRoutes(lb.log, mux, lb.batchPool, broker, nil, nil, nil, httphandlers.Monitoring{}, httphandlers.NewAPIKeyAuthenticator(apiKey))
 
 	lb.httpServer = httptest.NewServer(mux)
 	client, err := seb.NewRecordClient(lb.httpServer.URL, apiKey)
@@ -0,0 +1,77 @@
+package sebbench
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// LatencyRecorder records latencies and summarizes them as percentiles. It's
+// safe for concurrent use.
+type LatencyRecorder struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+}
+
+// Record records a single latency.
+func (lr *LatencyRecorder) Record(latency time.Duration) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	lr.latencies = append(lr.latencies, latency)
+}
+
+type LatencySummary struct {
+	Count int
+	Min   time.Duration
+	Mean  time.Duration
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+	P999  time.Duration
+	Max   time.Duration
+}
+
+// Summary returns a summary of the latencies recorded so far.
+func (lr *LatencyRecorder) Summary() LatencySummary {
+	lr.mu.Lock()
+	latencies := slices.Clone(lr.latencies)
+	lr.mu.Unlock()
+
+	if len(latencies) == 0 {
+		return LatencySummary{}
+	}
+	slices.Sort(latencies)
+
+	var total time.Duration
+	for _, latency := range latencies {
+		total += latency
+	}
+
+	return LatencySummary{
+		Count: len(latencies),
+		Min:   latencies[0],
+		Mean:  total / time.Duration(len(latencies)),
+		P50:   percentile(latencies, 50),
+		P90:   percentile(latencies, 90),
+		P99:   percentile(latencies, 99),
+		P999:  percentile(latencies, 99.9),
+		Max:   latencies[len(latencies)-1],
+	}
+}
+
+func (ls LatencySummary) String() string {
+	return fmt.Sprintf("n=%d min=%v mean=%v p50=%v p90=%v p99=%v p99.9=%v max=%v",
+		ls.Count, ls.Min, ls.Mean, ls.P50, ls.P90, ls.P99, ls.P999, ls.Max)
+}
+
+// percentile returns the p'th percentile of sorted using the nearest-rank
+// method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	// NOTE: the epsilon avoids rounding up because of floating point errors,
+	// e.g. 99.9/100*1000 = 999.0000000000001.
+	rank := int(math.Ceil(p*float64(len(sorted))/100 - 1e-9))
+	return sorted[min(max(rank-1, 0), len(sorted)-1)]
+}
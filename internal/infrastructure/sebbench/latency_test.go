@@ -0,0 +1,46 @@
+package sebbench_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/sebbench"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLatencyRecorderSummary verifies that Summary() returns the expected
+// percentiles of the recorded latencies.
+func TestLatencyRecorderSummary(t *testing.T) {
+	lr := sebbench.LatencyRecorder{}
+	for i := 1000; i >= 1; i-- {
+		lr.Record(time.Duration(i) * time.Millisecond)
+	}
+
+	// Act
+	got := lr.Summary()
+
+	// Assert
+	expected := sebbench.LatencySummary{
+		Count: 1000,
+		Min:   1 * time.Millisecond,
+		Mean:  500500 * time.Microsecond,
+		P50:   500 * time.Millisecond,
+		P90:   900 * time.Millisecond,
+		P99:   990 * time.Millisecond,
+		P999:  999 * time.Millisecond,
+		Max:   1000 * time.Millisecond,
+	}
+	require.Equal(t, expected, got)
+}
+
+// TestLatencyRecorderSummaryEmpty verifies that Summary() returns the zero
+// value when no latencies have been recorded.
+func TestLatencyRecorderSummaryEmpty(t *testing.T) {
+	lr := sebbench.LatencyRecorder{}
+
+	// Act
+	got := lr.Summary()
+
+	// Assert
+	require.Equal(t, sebbench.LatencySummary{}, got)
+}
@@ -23,9 +23,10 @@ type HTTPTestServer struct {
 	t      testing.TB
 	Server *httptest.Server
 
-	Mux    *http.ServeMux
-	Cache  *sebcache.Cache
-	Broker *sebbroker.Broker
+	Mux      *http.ServeMux
+	Cache    *sebcache.Cache
+	Broker   *sebbroker.Broker
+	LogLevel *logger.LevelVar
 }
 
 // Close closes all of the underlying resources
@@ -67,7 +68,7 @@ func HTTPServer(t testing.TB, OptFns ...func(*Opts)) *HTTPTestServer {
 		optFn(&opts)
 	}
 
-	log := logger.NewDefault(context.Background())
+	log, logLevel := logger.New(context.Background())
 
 	var c *sebcache.Cache
 	var broker *sebbroker.Broker
@@ -82,33 +83,46 @@ func HTTPServer(t testing.TB, OptFns ...func(*Opts)) *HTTPTestServer {
 			return sebtopic.New(log, memoryTopicStorage, topicName, c, sebtopic.WithCompress(nil))
 		}
 
-		broker = sebbroker.New(
-			log,
-			topicFactory,
+		brokerOpts := append([]func(*sebbroker.Opts){
 			sebbroker.WithNullBatcher(),
 			sebbroker.WithAutoCreateTopic(opts.BrokerTopicAutoCreate),
-		)
+		}, opts.BrokerOpts...)
+		broker = sebbroker.New(log, topicFactory, brokerOpts...)
 		opts.Dependencies = broker
 	}
 
 	mux := http.NewServeMux()
 
-	httphandlers.RegisterRoutes(log, mux, opts.BatchPool, opts.Dependencies, opts.APIKey)
+	// NOTE: a nil *sebcache.Cache must not be given as a non-nil
+	// CacheInspector.
+	var cacheInspector httphandlers.CacheInspector
+	if c != nil {
+		cacheInspector = c
+	}
+
+	auths := append([]httphandlers.Authenticator{httphandlers.NewAPIKeyAuthenticator(opts.APIKey, opts.APIKeyGrants...)}, opts.Authenticators...)
+	httphandlers.RegisterRoutes(log, mux, opts.BatchPool, opts.Dependencies, logLevel, cacheInspector, opts.ConfigReloader, opts.Monitoring, httphandlers.Authenticators(auths...))
 
 	return &HTTPTestServer{
-		t:      t,
-		Server: httptest.NewServer(mux),
-		Mux:    mux,
-		Cache:  c,
-		Broker: broker,
+		t:        t,
+		Server:   httptest.NewServer(mux),
+		Mux:      mux,
+		Cache:    c,
+		Broker:   broker,
+		LogLevel: logLevel,
 	}
 }
 
 type Opts struct {
 	APIKey                string
+	APIKeyGrants          []httphandlers.APIKeyGrant
+	Authenticators        []httphandlers.Authenticator
 	BrokerTopicAutoCreate bool
+	BrokerOpts            []func(*sebbroker.Opts)
 	Dependencies          httphandlers.Dependencies
 	BatchPool             *syncy.Pool[*sebrecords.Batch]
+	ConfigReloader        httphandlers.ConfigReloader
+	Monitoring            httphandlers.Monitoring
 }
 
 // HTTPAPIKey sets the apiKey for HTTPServer
@@ -125,6 +139,14 @@ func HTTPBrokerAutoCreateTopic(autoCreate bool) func(*Opts) {
 	}
 }
 
+// HTTPBrokerOpts sets additional options of the broker created by HTTPServer.
+// They're ignored if HTTPDependencies is used.
+func HTTPBrokerOpts(optFuncs ...func(*sebbroker.Opts)) func(*Opts) {
+	return func(c *Opts) {
+		c.BrokerOpts = append(c.BrokerOpts, optFuncs...)
+	}
+}
+
 // HTTPDependencies sets the http dependencies, avoiding creation of the
 // defaults.
 //
@@ -146,3 +168,34 @@ func HTTPBatchPool(batchPool *syncy.Pool[*sebrecords.Batch]) func(*Opts) {
 		o.BatchPool = batchPool
 	}
 }
+
+// HTTPAPIKeyGrants sets the read-only API key grants for HTTPServer
+func HTTPAPIKeyGrants(grants ...httphandlers.APIKeyGrant) func(*Opts) {
+	return func(c *Opts) {
+		c.APIKeyGrants = grants
+	}
+}
+
+// HTTPAuthenticators sets Authenticators that are used by HTTPServer in
+// addition to its API key and API key grants
+func HTTPAuthenticators(auths ...httphandlers.Authenticator) func(*Opts) {
+	return func(c *Opts) {
+		c.Authenticators = auths
+	}
+}
+
+// HTTPConfigReloader sets the ConfigReloader used by HTTPServer, registering
+// the config reload route
+func HTTPConfigReloader(reloader httphandlers.ConfigReloader) func(*Opts) {
+	return func(c *Opts) {
+		c.ConfigReloader = reloader
+	}
+}
+
+// HTTPMonitoring sets the sources of metrics and stats used by HTTPServer in
+// addition to the broker and cache, registering their routes
+func HTTPMonitoring(monitoring httphandlers.Monitoring) func(*Opts) {
+	return func(c *Opts) {
+		c.Monitoring = monitoring
+	}
+}
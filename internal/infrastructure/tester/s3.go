@@ -2,11 +2,16 @@ package tester
 
 import (
 	"context"
+	"sync"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
+// S3Mock is a mock of sebtopic.S3API. It's safe to use from multiple
+// goroutines if its Mock functions are.
 type S3Mock struct {
+	mu sync.Mutex
+
 	MockPutObject func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
 
 	PutObjectCalled bool
@@ -17,19 +22,39 @@ type S3Mock struct {
 	MockListObjectsV2 func(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
 
 	ListObjectPagesCalled bool
+
+	MockDeleteObject   func(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	DeleteObjectCalled bool
 }
 
 func (sm *S3Mock) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	sm.mu.Lock()
 	sm.PutObjectCalled = true
+	sm.mu.Unlock()
+
 	return sm.MockPutObject(ctx, params, optFns...)
 }
 
 func (sm *S3Mock) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	sm.mu.Lock()
 	sm.GetObjectCalled = true
+	sm.mu.Unlock()
+
 	return sm.MockGetObject(ctx, params, optFns...)
 }
 
 func (sm *S3Mock) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	sm.mu.Lock()
 	sm.ListObjectPagesCalled = true
+	sm.mu.Unlock()
+
 	return sm.MockListObjectsV2(ctx, params, optFns...)
 }
+
+func (sm *S3Mock) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	sm.mu.Lock()
+	sm.DeleteObjectCalled = true
+	sm.mu.Unlock()
+
+	return sm.MockDeleteObject(ctx, params, optFns...)
+}
@@ -18,11 +18,23 @@ var (
 	cacheStorageFactories = map[string]func(t *testing.T) (sebcache.Storage, error){
 		"memory": func(t *testing.T) (sebcache.Storage, error) { return sebcache.NewMemoryStorage(log), nil },
 		"disk":   func(t *testing.T) (sebcache.Storage, error) { return sebcache.NewDiskStorage(log, t.TempDir()) },
+		"disk-hashed": func(t *testing.T) (sebcache.Storage, error) {
+			return sebcache.NewDiskStorage(log, t.TempDir(), sebcache.WithDiskHashKeys(true))
+		},
 	}
 
 	storageFactories = map[string]func(t *testing.T) sebtopic.Storage{
 		"memory": func(t *testing.T) sebtopic.Storage { return sebtopic.NewMemoryStorage(log) },
-		"disk":   func(t *testing.T) sebtopic.Storage { return sebtopic.NewDiskStorage(log, t.TempDir()) },
+		"memory-spill": func(t *testing.T) sebtopic.Storage {
+			return sebtopic.NewMemoryStorage(log, sebtopic.WithMemoryMaxBytes(4096), sebtopic.WithMemorySpillDir(t.TempDir()))
+		},
+		"disk": func(t *testing.T) sebtopic.Storage { return sebtopic.NewDiskStorage(log, t.TempDir()) },
+		"disk-mmap": func(t *testing.T) sebtopic.Storage {
+			return sebtopic.NewDiskStorage(log, t.TempDir(), sebtopic.WithDiskMmap(true))
+		},
+		"disk-open-files": func(t *testing.T) sebtopic.Storage {
+			return sebtopic.NewDiskStorage(log, t.TempDir(), sebtopic.WithDiskOpenFiles(2))
+		},
 	}
 )
 
@@ -100,3 +112,16 @@ func TestBroker(t *testing.T, autoCreateTopic bool, f func(*testing.T, *sebbroke
 		}
 	}
 }
+
+// Broker returns a sebbroker.Broker whose topics are kept in storage and
+// cached in memory. Records are added to topics right away, without batching,
+// unless optFuncs configure otherwise.
+func Broker(t *testing.T, storage sebtopic.Storage, optFuncs ...func(*sebbroker.Opts)) *sebbroker.Broker {
+	t.Helper()
+
+	cache, err := sebcache.NewMemoryCache(log)
+	require.NoError(t, err)
+
+	optFuncs = append([]func(*sebbroker.Opts){sebbroker.WithNullBatcher()}, optFuncs...)
+	return sebbroker.New(log, sebbroker.NewStorageTopicFactory(storage, cache), optFuncs...)
+}
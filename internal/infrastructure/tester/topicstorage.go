@@ -1,6 +1,7 @@
 package tester
 
 import (
+	"context"
 	"fmt"
 	"io"
 
@@ -8,17 +9,21 @@ import (
 )
 
 type MockTopicStorage struct {
-	ListFilesMock  func(topicName string, extension string) ([]sebtopic.File, error)
+	ListFilesMock  func(ctx context.Context, topicName string, extension string) ([]sebtopic.File, error)
 	ListFilesCalls []storageListFilesCall
 
-	ReaderMock  func(recordBatchPath string) (io.ReadCloser, error)
+	ReaderMock  func(ctx context.Context, recordBatchPath string) (io.ReadCloser, error)
 	ReaderCalls []storageReaderCall
 
-	WriterMock  func(recordBatchPath string) (io.WriteCloser, error)
+	WriterMock  func(ctx context.Context, recordBatchPath string) (io.WriteCloser, error)
 	WriterCalls []storageWriterCall
+
+	DeleteMock  func(recordBatchPath string) error
+	DeleteCalls []storageDeleteCall
 }
 
 type storageListFilesCall struct {
+	Ctx       context.Context
 	TopicName string
 	Extension string
 
@@ -26,62 +31,87 @@ type storageListFilesCall struct {
 	Out1 error
 }
 
-func (_v *MockTopicStorage) ListFiles(topicName string, extension string) ([]sebtopic.File, error) {
+func (_v *MockTopicStorage) ListFiles(ctx context.Context, topicName string, extension string) ([]sebtopic.File, error) {
 	if _v.ListFilesMock == nil {
 		msg := fmt.Sprintf("call to %T.ListFiles, but MockListFiles is not set", _v)
 		panic(msg)
 	}
 
 	_v.ListFilesCalls = append(_v.ListFilesCalls, storageListFilesCall{
+		Ctx:       ctx,
 		TopicName: topicName,
 		Extension: extension,
 	})
-	out0, out1 := _v.ListFilesMock(topicName, extension)
+	out0, out1 := _v.ListFilesMock(ctx, topicName, extension)
 	_v.ListFilesCalls[len(_v.ListFilesCalls)-1].Out0 = out0
 	_v.ListFilesCalls[len(_v.ListFilesCalls)-1].Out1 = out1
 	return out0, out1
 }
 
 type storageReaderCall struct {
+	Ctx             context.Context
 	RecordBatchPath string
 
 	Out0 io.ReadCloser
 	Out1 error
 }
 
-func (_v *MockTopicStorage) Reader(recordBatchPath string) (io.ReadCloser, error) {
+func (_v *MockTopicStorage) Reader(ctx context.Context, recordBatchPath string) (io.ReadCloser, error) {
 	if _v.ReaderMock == nil {
 		msg := fmt.Sprintf("call to %T.Reader, but MockReader is not set", _v)
 		panic(msg)
 	}
 
 	_v.ReaderCalls = append(_v.ReaderCalls, storageReaderCall{
+		Ctx:             ctx,
 		RecordBatchPath: recordBatchPath,
 	})
-	out0, out1 := _v.ReaderMock(recordBatchPath)
+	out0, out1 := _v.ReaderMock(ctx, recordBatchPath)
 	_v.ReaderCalls[len(_v.ReaderCalls)-1].Out0 = out0
 	_v.ReaderCalls[len(_v.ReaderCalls)-1].Out1 = out1
 	return out0, out1
 }
 
 type storageWriterCall struct {
+	Ctx             context.Context
 	RecordBatchPath string
 
 	Out0 io.WriteCloser
 	Out1 error
 }
 
-func (_v *MockTopicStorage) Writer(recordBatchPath string) (io.WriteCloser, error) {
+func (_v *MockTopicStorage) Writer(ctx context.Context, recordBatchPath string) (io.WriteCloser, error) {
 	if _v.WriterMock == nil {
 		msg := fmt.Sprintf("call to %T.Writer, but MockWriter is not set", _v)
 		panic(msg)
 	}
 
 	_v.WriterCalls = append(_v.WriterCalls, storageWriterCall{
+		Ctx:             ctx,
 		RecordBatchPath: recordBatchPath,
 	})
-	out0, out1 := _v.WriterMock(recordBatchPath)
+	out0, out1 := _v.WriterMock(ctx, recordBatchPath)
 	_v.WriterCalls[len(_v.WriterCalls)-1].Out0 = out0
 	_v.WriterCalls[len(_v.WriterCalls)-1].Out1 = out1
 	return out0, out1
 }
+
+type storageDeleteCall struct {
+	RecordBatchPath string
+
+	Out0 error
+}
+
+func (_v *MockTopicStorage) Delete(recordBatchPath string) error {
+	if _v.DeleteMock == nil {
+		msg := fmt.Sprintf("call to %T.Delete, but MockDelete is not set", _v)
+		panic(msg)
+	}
+
+	_v.DeleteCalls = append(_v.DeleteCalls, storageDeleteCall{
+		RecordBatchPath: recordBatchPath,
+	})
+	out0 := _v.DeleteMock(recordBatchPath)
+	_v.DeleteCalls[len(_v.DeleteCalls)-1].Out0 = out0
+	return out0
+}
@@ -0,0 +1,239 @@
+package sebbroker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// AliasStore persists topic aliases, mapping aliases to the names of the
+// topics they refer to.
+type AliasStore interface {
+	LoadAliases(ctx context.Context) (map[string]string, error)
+	StoreAliases(ctx context.Context, aliases map[string]string) error
+}
+
+// aliasesKey is the key that StorageAliasStore stores aliases at. It's not a
+// record batch key, so it can't be mistaken for part of a topic.
+const aliasesKey = "_broker/topic_aliases.json"
+
+// StorageAliasStore is an AliasStore that keeps aliases in a single JSON
+// file in topic storage, next to the topics' record batches.
+type StorageAliasStore struct {
+	storage sebtopic.Storage
+}
+
+var _ AliasStore = &StorageAliasStore{}
+
+func NewStorageAliasStore(storage sebtopic.Storage) *StorageAliasStore {
+	return &StorageAliasStore{storage: storage}
+}
+
+// LoadAliases returns the stored aliases. No aliases are returned if none have
+// been stored.
+func (s *StorageAliasStore) LoadAliases(ctx context.Context) (map[string]string, error) {
+	rdr, err := s.storage.Reader(ctx, aliasesKey)
+	if err != nil {
+		if errors.Is(err, seberr.ErrNotInStorage) {
+			return map[string]string{}, nil
+		}
+		return nil, fmt.Errorf("opening aliases: %w", err)
+	}
+	defer rdr.Close()
+
+	bs, err := io.ReadAll(rdr)
+	if err != nil {
+		return nil, fmt.Errorf("reading aliases: %w", err)
+	}
+
+	aliases := map[string]string{}
+	err = json.Unmarshal(bs, &aliases)
+	if err != nil {
+		return nil, fmt.Errorf("parsing aliases: %w", err)
+	}
+
+	return aliases, nil
+}
+
+// StoreAliases replaces the stored aliases with aliases.
+func (s *StorageAliasStore) StoreAliases(ctx context.Context, aliases map[string]string) error {
+	bs, err := json.Marshal(aliases)
+	if err != nil {
+		return fmt.Errorf("marshaling aliases: %w", err)
+	}
+
+	wtr, err := s.storage.Writer(ctx, aliasesKey)
+	if err != nil {
+		return fmt.Errorf("creating aliases writer: %w", err)
+	}
+
+	_, err = wtr.Write(bs)
+	if err != nil {
+		wtr.Close()
+		return fmt.Errorf("writing aliases: %w", err)
+	}
+
+	err = wtr.Close()
+	if err != nil {
+		return fmt.Errorf("closing aliases writer: %w", err)
+	}
+
+	return nil
+}
+
+// LoadTopicAliases loads the topic aliases kept in the broker's AliasStore,
+// replacing any aliases that are currently set. It must be called before the
+// broker is used if aliases are to be honored after a restart.
+func (s *Broker) LoadTopicAliases(ctx context.Context) error {
+	if s.aliasStore == nil {
+		return nil
+	}
+
+	s.aliasMu.Lock()
+	defer s.aliasMu.Unlock()
+
+	aliases, err := s.aliasStore.LoadAliases(ctx)
+	if err != nil {
+		return fmt.Errorf("loading topic aliases: %w", err)
+	}
+	s.aliases.Store(&aliases)
+
+	return nil
+}
+
+// SetTopicAlias makes alias refer to topicName, such that records can be
+// added to and read from topicName using alias, e.g. while clients are
+// migrated from one topic name to another. Write freezes, retention and labels
+// set using alias apply to topicName.
+//
+// alias must not be the name of an existing topic, and topicName must not be
+// an alias itself. seberr.ErrTopicAlreadyExists and seberr.ErrBadInput are
+// returned otherwise. The alias is persisted using the broker's AliasStore, if
+// it has one.
+func (s *Broker) SetTopicAlias(ctx context.Context, alias string, topicName string) error {
+	if alias == "" || topicName == "" || alias == topicName {
+		return fmt.Errorf("%w: alias '%s' of topic '%s'", seberr.ErrBadInput, alias, topicName)
+	}
+
+	s.aliasMu.Lock()
+	defer s.aliasMu.Unlock()
+
+	aliases := *s.aliases.Load()
+	if _, ok := aliases[topicName]; ok {
+		return fmt.Errorf("%w: '%s' is an alias", seberr.ErrBadInput, topicName)
+	}
+	for _, target := range aliases {
+		if target == alias {
+			return fmt.Errorf("%w: '%s' has aliases", seberr.ErrBadInput, alias)
+		}
+	}
+
+	if _, ok := aliases[alias]; !ok {
+		exists, err := s.topicExists(alias)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("%w: '%s'", seberr.ErrTopicAlreadyExists, alias)
+		}
+	}
+
+	aliases = maps.Clone(aliases)
+	aliases[alias] = topicName
+
+	return s.storeAliases(ctx, aliases)
+}
+
+// RemoveTopicAlias removes alias. It is not an error to remove an alias that
+// does not exist.
+func (s *Broker) RemoveTopicAlias(ctx context.Context, alias string) error {
+	s.aliasMu.Lock()
+	defer s.aliasMu.Unlock()
+
+	aliases := *s.aliases.Load()
+	if _, ok := aliases[alias]; !ok {
+		return nil
+	}
+
+	aliases = maps.Clone(aliases)
+	delete(aliases, alias)
+
+	return s.storeAliases(ctx, aliases)
+}
+
+// TopicAliases returns a copy of all aliases, mapping them to the names of the
+// topics they refer to.
+func (s *Broker) TopicAliases() map[string]string {
+	return maps.Clone(*s.aliases.Load())
+}
+
+// removeAliasesOf removes all aliases of topicName.
+func (s *Broker) removeAliasesOf(topicName string) error {
+	s.aliasMu.Lock()
+	defer s.aliasMu.Unlock()
+
+	aliases := maps.Clone(*s.aliases.Load())
+	maps.DeleteFunc(aliases, func(_ string, target string) bool {
+		return target == topicName
+	})
+	if len(aliases) == len(*s.aliases.Load()) {
+		return nil
+	}
+
+	// NOTE: the context of the caller isn't available, since DeleteTopic
+	// doesn't take one.
+	return s.storeAliases(context.Background(), aliases)
+}
+
+// storeAliases persists aliases and starts using them.
+// NOTE: you must hold s.aliasMu when calling this method!
+func (s *Broker) storeAliases(ctx context.Context, aliases map[string]string) error {
+	if s.readReplica {
+		return errReadReplica
+	}
+
+	if s.aliasStore != nil {
+		err := s.aliasStore.StoreAliases(ctx, aliases)
+		if err != nil {
+			return fmt.Errorf("storing topic aliases: %w", err)
+		}
+	}
+
+	s.log.Infof("setting topic aliases: %v", aliases)
+	s.aliases.Store(&aliases)
+	return nil
+}
+
+// resolveTopicName returns the name of the topic that name refers to, which
+// is name itself unless it's an alias.
+func (s *Broker) resolveTopicName(name string) string {
+	if topicName, ok := (*s.aliases.Load())[name]; ok {
+		return topicName
+	}
+	return name
+}
+
+// topicExists returns whether topicName has records or has been sealed,
+// instantiating it if it hasn't already been instantiated.
+func (s *Broker) topicExists(topicName string) (bool, error) {
+	tb, made, err := s.loadOrMakeTopicBatcher(topicName)
+	if err != nil {
+		return false, err
+	}
+
+	if made && tb.topic.NextOffset() == 0 && !tb.topic.Sealed() {
+		s.topicBatchers.Delete(topicName)
+		return false, nil
+	}
+	if made {
+		s.watchers.created(topicName, tb.topic.NextOffset())
+	}
+
+	return true, nil
+}
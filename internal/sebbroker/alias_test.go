@@ -0,0 +1,176 @@
+package sebbroker_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBrokerTopicAlias verifies that records can be added to and read from a
+// topic using its alias, and that topic configuration set using the alias
+// applies to the topic.
+func TestBrokerTopicAlias(t *testing.T) {
+	tester.TestBroker(t, true, func(t *testing.T, s *sebbroker.Broker) {
+		const (
+			topicName = "new-name"
+			alias     = "old-name"
+		)
+		ctx := context.Background()
+
+		expectedBatch := tester.MakeRandomRecordBatch(2)
+		_, err := s.AddRecords(topicName, expectedBatch)
+		require.NoError(t, err)
+
+		// Act
+		err = s.SetTopicAlias(ctx, alias, topicName)
+		require.NoError(t, err)
+
+		// Assert
+		require.Equal(t, map[string]string{alias: topicName}, s.TopicAliases())
+
+		offsets, err := s.AddRecords(alias, tester.MakeRandomRecordBatch(1))
+		require.NoError(t, err)
+		require.Equal(t, []uint64{2}, offsets)
+
+		gotBatch := tester.NewBatch(10, 4096)
+		err = s.GetRecords(ctx, &gotBatch, alias, 0, 2, 0)
+		require.NoError(t, err)
+		require.Equal(t, expectedBatch.IndividualRecords(), gotBatch.IndividualRecords())
+
+		metadata, err := s.Metadata(alias)
+		require.NoError(t, err)
+		require.Equal(t, uint64(3), metadata.NextOffset)
+
+		s.SetTopicWritesFrozen(alias, true)
+		require.True(t, s.WritesFrozen(topicName))
+
+		s.SetTopicLabels(alias, map[string]string{"team": "a"})
+		require.Equal(t, map[string]string{"team": "a"}, s.TopicLabels(topicName))
+
+		// alias is not a topic of its own
+		require.Equal(t, []string{topicName}, s.TopicNames())
+	})
+}
+
+// TestBrokerSetTopicAliasBadInput verifies that SetTopicAlias() rejects
+// aliases that would be ambiguous.
+func TestBrokerSetTopicAliasBadInput(t *testing.T) {
+	tests := map[string]struct {
+		alias     string
+		topicName string
+		err       error
+	}{
+		"alias of itself":     {alias: "topic", topicName: "topic", err: seberr.ErrBadInput},
+		"alias is empty":      {alias: "", topicName: "topic", err: seberr.ErrBadInput},
+		"alias of alias":      {alias: "other-alias", topicName: "alias", err: seberr.ErrBadInput},
+		"alias has alias":     {alias: "topic", topicName: "other-topic", err: seberr.ErrBadInput},
+		"alias is topic name": {alias: "existing", topicName: "topic", err: seberr.ErrTopicAlreadyExists},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tester.TestBroker(t, true, func(t *testing.T, s *sebbroker.Broker) {
+				ctx := context.Background()
+
+				_, err := s.AddRecords("existing", tester.MakeRandomRecordBatch(1))
+				require.NoError(t, err)
+
+				err = s.SetTopicAlias(ctx, "alias", "topic")
+				require.NoError(t, err)
+
+				// Act
+				err = s.SetTopicAlias(ctx, test.alias, test.topicName)
+
+				// Assert
+				require.ErrorIs(t, err, test.err)
+				require.Equal(t, map[string]string{"alias": "topic"}, s.TopicAliases())
+			})
+		})
+	}
+}
+
+// TestBrokerTopicAliasCreateAndDelete verifies that aliases can't be created
+// or deleted as topics, and that deleting a topic removes its aliases.
+func TestBrokerTopicAliasCreateAndDelete(t *testing.T) {
+	tester.TestBroker(t, true, func(t *testing.T, s *sebbroker.Broker) {
+		const (
+			topicName = "topic"
+			alias     = "alias"
+		)
+		ctx := context.Background()
+
+		_, err := s.AddRecords(topicName, tester.MakeRandomRecordBatch(1))
+		require.NoError(t, err)
+
+		err = s.SetTopicAlias(ctx, alias, topicName)
+		require.NoError(t, err)
+
+		err = s.CreateTopic(alias)
+		require.ErrorIs(t, err, seberr.ErrTopicAlreadyExists)
+
+		err = s.DeleteTopic(alias)
+		require.ErrorIs(t, err, seberr.ErrBadInput)
+
+		// Act
+		err = s.DeleteTopic(topicName)
+		require.NoError(t, err)
+
+		// Assert
+		require.Empty(t, s.TopicAliases())
+	})
+}
+
+// TestBrokerTopicAliasPersisted verifies that aliases stored using
+// StorageAliasStore are honored by brokers that load them, and that removed
+// aliases are no longer honored.
+func TestBrokerTopicAliasPersisted(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, bs sebtopic.Storage, cache *sebcache.Cache) {
+		const (
+			topicName = "new-name"
+			alias     = "old-name"
+		)
+		ctx := context.Background()
+
+		newBroker := func() *sebbroker.Broker {
+			s := sebbroker.New(log,
+				func(log logger.Logger, topicName string) (*sebtopic.Topic, error) {
+					return sebtopic.New(log, bs, topicName, cache)
+				},
+				sebbroker.WithNullBatcher(),
+				sebbroker.WithAliasStore(sebbroker.NewStorageAliasStore(bs)),
+			)
+			err := s.LoadTopicAliases(ctx)
+			require.NoError(t, err)
+			return s
+		}
+
+		s1 := newBroker()
+		_, err := s1.AddRecords(topicName, tester.MakeRandomRecordBatch(1))
+		require.NoError(t, err)
+
+		// Act
+		err = s1.SetTopicAlias(ctx, alias, topicName)
+		require.NoError(t, err)
+
+		// Assert
+		s2 := newBroker()
+		require.Equal(t, map[string]string{alias: topicName}, s2.TopicAliases())
+
+		offsets, err := s2.AddRecords(alias, tester.MakeRandomRecordBatch(1))
+		require.NoError(t, err)
+		require.Equal(t, []uint64{1}, offsets)
+
+		err = s2.RemoveTopicAlias(ctx, alias)
+		require.NoError(t, err)
+
+		s3 := newBroker()
+		require.Empty(t, s3.TopicAliases())
+	})
+}
@@ -0,0 +1,77 @@
+package sebbroker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+)
+
+// ExportRecords writes the records of topicName at offsets
+// [startOffset;endOffset) to w as an archive, which can be imported into
+// another topic using ImportRecords. See sebtopic.Topic.Export.
+func (s *Broker) ExportRecords(ctx context.Context, topicName string, w io.Writer, startOffset uint64, endOffset uint64) (sebtopic.ExportResult, error) {
+	tb, err := s.getTopicBatcher(topicName)
+	if err != nil {
+		return sebtopic.ExportResult{}, err
+	}
+
+	result, err := tb.topic.Export(ctx, w, startOffset, endOffset)
+	if err != nil {
+		return result, fmt.Errorf("exporting topic '%s': %w", topicName, err)
+	}
+	return result, nil
+}
+
+// ImportResult describes the records added by ImportRecords.
+type ImportResult struct {
+	RecordBatches int
+	Records       int
+
+	// FirstOffset and LastOffset are the offsets given to the first and last
+	// record that were added.
+	FirstOffset uint64
+	LastOffset  uint64
+}
+
+// ImportRecords adds the records of the archive in r, written by
+// ExportRecords, to topicName. Records are added in the same way as by
+// AddRecordsContext, and are given new offsets in topicName.
+//
+// Record batches are added one at a time. If adding one fails, the records
+// of the record batches that were added before it remain in topicName, and
+// the returned ImportResult describes them.
+func (s *Broker) ImportRecords(ctx context.Context, topicName string, r io.Reader) (ImportResult, error) {
+	ar, err := sebtopic.NewArchiveReader(r)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	result := ImportResult{}
+	for {
+		archived, err := ar.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return result, nil
+			}
+			return result, fmt.Errorf("reading archive: %w", err)
+		}
+
+		offsets, err := s.AddRecordsContext(ctx, topicName, archived.Batch)
+		if err != nil {
+			return result, fmt.Errorf("importing record batch at offset %d: %w", archived.FirstOffset, err)
+		}
+		if len(offsets) == 0 {
+			continue
+		}
+
+		if result.Records == 0 {
+			result.FirstOffset = offsets[0]
+		}
+		result.LastOffset = offsets[len(offsets)-1]
+		result.RecordBatches += 1
+		result.Records += len(offsets)
+	}
+}
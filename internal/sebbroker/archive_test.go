@@ -0,0 +1,80 @@
+package sebbroker_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBrokerExportImportRecords verifies that records exported using
+// ExportRecords() are added to another topic by ImportRecords(), keeping their
+// timestamps, keys and headers and being given new offsets.
+func TestBrokerExportImportRecords(t *testing.T) {
+	tester.TestBroker(t, true, func(t *testing.T, s *sebbroker.Broker) {
+		ctx := context.Background()
+
+		batch := tester.MakeRandomRecordBatch(3)
+		batch.Timestamps = []int64{1, 2, 3}
+		batch.Keys = [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+		batch.Headers = [][]sebrecords.RecordHeader{{{Key: "type", Value: []byte("created")}}, {}, {}}
+		_, err := s.AddRecords("src", batch)
+		require.NoError(t, err)
+
+		_, err = s.AddRecords("dst", tester.MakeRandomRecordBatch(1))
+		require.NoError(t, err)
+
+		archive := bytes.Buffer{}
+		exportResult, err := s.ExportRecords(ctx, "src", &archive, 0, 0)
+		require.NoError(t, err)
+		require.Equal(t, 3, exportResult.Records)
+
+		// Act
+		importResult, err := s.ImportRecords(ctx, "dst", &archive)
+		require.NoError(t, err)
+
+		// Assert
+		require.Equal(t, sebbroker.ImportResult{RecordBatches: 1, Records: 3, FirstOffset: 1, LastOffset: 3}, importResult)
+
+		reexported := bytes.Buffer{}
+		_, err = s.ExportRecords(ctx, "dst", &reexported, 1, 0)
+		require.NoError(t, err)
+
+		ar, err := sebtopic.NewArchiveReader(&reexported)
+		require.NoError(t, err)
+		archived, err := ar.Next()
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), archived.FirstOffset)
+		require.Equal(t, batch.IndividualRecords(), archived.Batch.IndividualRecords())
+		require.Equal(t, batch.Timestamps, archived.Batch.Timestamps)
+		require.Equal(t, batch.Keys, archived.Batch.Keys)
+		require.Equal(t, batch.Headers, archived.Batch.Headers)
+	})
+}
+
+// TestBrokerImportRecordsBadInput verifies that ImportRecords() returns
+// seberr.ErrBadInput when given data that isn't an archive, and
+// seberr.ErrTopicNotFound when exporting a topic that doesn't exist.
+func TestBrokerImportRecordsBadInput(t *testing.T) {
+	tester.TestBroker(t, false, func(t *testing.T, s *sebbroker.Broker) {
+		ctx := context.Background()
+
+		// Act
+		_, err := s.ImportRecords(ctx, "topic", bytes.NewReader([]byte("not an archive")))
+
+		// Assert
+		require.ErrorIs(t, err, seberr.ErrBadInput)
+
+		// Act
+		_, err = s.ExportRecords(ctx, "does-not-exist", &bytes.Buffer{}, 0, 0)
+
+		// Assert
+		require.ErrorIs(t, err, seberr.ErrTopicNotFound)
+	})
+}
@@ -0,0 +1,212 @@
+package sebbroker
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// GroupMember is a member of a consumer group, and the topics that it
+// consumes.
+type GroupMember struct {
+	ID         string
+	TopicNames []string
+
+	// Assigned is the topics assigned to the member in the group's current
+	// generation.
+	Assigned []string
+}
+
+// Assignor assigns the topics consumed by the members of a consumer group to
+// the members, such that each topic is consumed by a single member.
+//
+// Topics are the unit of assignment since topics aren't partitioned.
+type Assignor interface {
+	// Assign returns the names of the topics assigned to each member, by
+	// member ID. Members are given sorted by ID, and each topic must only be
+	// assigned to a member that consumes it.
+	Assign(members []GroupMember) map[string][]string
+}
+
+var (
+	assignorsMu sync.RWMutex
+	assignors   = map[string]Assignor{
+		"range":       RangeAssignor{},
+		"round-robin": RoundRobinAssignor{},
+		"sticky":      StickyAssignor{},
+	}
+)
+
+// RegisterAssignor makes assignor available by name, e.g. for consumer groups
+// to select when joining. It's intended to be called from init() and panics
+// if name is already registered.
+func RegisterAssignor(name string, assignor Assignor) {
+	assignorsMu.Lock()
+	defer assignorsMu.Unlock()
+
+	if assignor == nil {
+		panic(fmt.Sprintf("sebbroker: assignor '%s' is nil", name))
+	}
+	if _, exists := assignors[name]; exists {
+		panic(fmt.Sprintf("sebbroker: assignor '%s' registered twice", name))
+	}
+
+	assignors[name] = assignor
+}
+
+// AssignorByName returns the Assignor registered as name, one of
+// AssignorNames().
+func AssignorByName(name string) (Assignor, error) {
+	assignorsMu.RLock()
+	assignor, ok := assignors[name]
+	assignorsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown assignor '%s', must be one of: %s", seberr.ErrBadInput, name, strings.Join(AssignorNames(), ", "))
+	}
+
+	return assignor, nil
+}
+
+// AssignorNames returns the sorted names of all registered assignors.
+func AssignorNames() []string {
+	assignorsMu.RLock()
+	defer assignorsMu.RUnlock()
+
+	names := make([]string, 0, len(assignors))
+	for name := range assignors {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+// RangeAssignor splits the sorted topics consumed by a group into contiguous
+// ranges, one per member. Topics in a range whose member doesn't consume them
+// are assigned to the member with the fewest topics that does.
+type RangeAssignor struct{}
+
+func (RangeAssignor) Assign(members []GroupMember) map[string][]string {
+	topicNames, consumers := groupTopics(members)
+
+	assignment := make(map[string][]string, len(members))
+	for i, topicName := range topicNames {
+		member := members[i*len(members)/len(topicNames)]
+		if !slices.Contains(member.TopicNames, topicName) {
+			member = leastAssigned(assignment, consumers[topicName])
+		}
+		assignment[member.ID] = append(assignment[member.ID], topicName)
+	}
+
+	return assignment
+}
+
+// RoundRobinAssignor deals the sorted topics consumed by a group to its
+// members in turn, skipping members that don't consume the topic.
+type RoundRobinAssignor struct{}
+
+func (RoundRobinAssignor) Assign(members []GroupMember) map[string][]string {
+	topicNames, _ := groupTopics(members)
+
+	assignment := make(map[string][]string, len(members))
+	next := 0
+	for _, topicName := range topicNames {
+		for i := range members {
+			member := members[(next+i)%len(members)]
+			if slices.Contains(member.TopicNames, topicName) {
+				assignment[member.ID] = append(assignment[member.ID], topicName)
+				next = (next + i + 1) % len(members)
+				break
+			}
+		}
+	}
+
+	return assignment
+}
+
+// StickyAssignor balances the topics consumed by a group between its members
+// while moving as few topics as possible, such that members can keep their
+// local state and in-flight work for the topics that stay with them. Members
+// keep their assigned topics up to their share; the rest are assigned to the
+// members with the fewest topics.
+type StickyAssignor struct{}
+
+func (StickyAssignor) Assign(members []GroupMember) map[string][]string {
+	topicNames, consumers := groupTopics(members)
+
+	// each member's share is minTopics, and the first extraTopics members
+	// that already have more may keep one more.
+	minTopics := len(topicNames) / len(members)
+	extraTopics := len(topicNames) % len(members)
+
+	assignment := make(map[string][]string, len(members))
+	assigned := make(map[string]bool, len(topicNames))
+	for _, member := range members {
+		kept := []string{}
+		for _, topicName := range member.Assigned {
+			if !assigned[topicName] && slices.Contains(member.TopicNames, topicName) {
+				kept = append(kept, topicName)
+			}
+		}
+
+		share := minTopics
+		if len(kept) > minTopics && extraTopics > 0 {
+			share++
+			extraTopics--
+		}
+
+		for _, topicName := range kept[:min(share, len(kept))] {
+			assignment[member.ID] = append(assignment[member.ID], topicName)
+			assigned[topicName] = true
+		}
+	}
+
+	for _, topicName := range topicNames {
+		if assigned[topicName] {
+			continue
+		}
+		member := leastAssigned(assignment, consumers[topicName])
+		assignment[member.ID] = append(assignment[member.ID], topicName)
+	}
+
+	for memberID := range assignment {
+		slices.Sort(assignment[memberID])
+	}
+
+	return assignment
+}
+
+// groupTopics returns the sorted names of the topics consumed by members, and
+// the members consuming each topic.
+func groupTopics(members []GroupMember) ([]string, map[string][]GroupMember) {
+	consumers := map[string][]GroupMember{}
+	for _, member := range members {
+		for _, topicName := range member.TopicNames {
+			consumers[topicName] = append(consumers[topicName], member)
+		}
+	}
+
+	topicNames := make([]string, 0, len(consumers))
+	for topicName := range consumers {
+		topicNames = append(topicNames, topicName)
+	}
+	slices.Sort(topicNames)
+
+	return topicNames, consumers
+}
+
+// leastAssigned returns the first of members with the fewest topics in
+// assignment.
+func leastAssigned(assignment map[string][]string, members []GroupMember) GroupMember {
+	least := members[0]
+	for _, member := range members[1:] {
+		if len(assignment[member.ID]) < len(assignment[least.ID]) {
+			least = member
+		}
+	}
+
+	return least
+}
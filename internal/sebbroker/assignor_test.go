@@ -0,0 +1,134 @@
+package sebbroker_test
+
+import (
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAssignors verifies that the built-in assignors assign each topic to a
+// single member consuming it, spread as expected across members.
+func TestAssignors(t *testing.T) {
+	tests := map[string]struct {
+		assignor sebbroker.Assignor
+		members  []sebbroker.GroupMember
+		expected map[string][]string
+	}{
+		"range": {
+			assignor: sebbroker.RangeAssignor{},
+			members: []sebbroker.GroupMember{
+				{ID: "a", TopicNames: []string{"t1", "t2", "t3", "t4", "t5"}},
+				{ID: "b", TopicNames: []string{"t1", "t2", "t3", "t4", "t5"}},
+			},
+			expected: map[string][]string{
+				"a": {"t1", "t2", "t3"},
+				"b": {"t4", "t5"},
+			},
+		},
+		"range, more members than topics": {
+			assignor: sebbroker.RangeAssignor{},
+			members: []sebbroker.GroupMember{
+				{ID: "a", TopicNames: []string{"t1"}},
+				{ID: "b", TopicNames: []string{"t1"}},
+			},
+			expected: map[string][]string{
+				"a": {"t1"},
+			},
+		},
+		"range, different topics": {
+			assignor: sebbroker.RangeAssignor{},
+			members: []sebbroker.GroupMember{
+				{ID: "a", TopicNames: []string{"t3", "t4"}},
+				{ID: "b", TopicNames: []string{"t1", "t2"}},
+			},
+			expected: map[string][]string{
+				"a": {"t3", "t4"},
+				"b": {"t1", "t2"},
+			},
+		},
+		"round-robin": {
+			assignor: sebbroker.RoundRobinAssignor{},
+			members: []sebbroker.GroupMember{
+				{ID: "a", TopicNames: []string{"t1", "t2", "t3", "t4", "t5"}},
+				{ID: "b", TopicNames: []string{"t1", "t2", "t3", "t4", "t5"}},
+			},
+			expected: map[string][]string{
+				"a": {"t1", "t3", "t5"},
+				"b": {"t2", "t4"},
+			},
+		},
+		"round-robin, different topics": {
+			assignor: sebbroker.RoundRobinAssignor{},
+			members: []sebbroker.GroupMember{
+				{ID: "a", TopicNames: []string{"t1", "t2", "t3"}},
+				{ID: "b", TopicNames: []string{"t1"}},
+				{ID: "c", TopicNames: []string{"t1", "t3"}},
+			},
+			expected: map[string][]string{
+				"a": {"t1", "t2"},
+				"c": {"t3"},
+			},
+		},
+		"sticky, member joins": {
+			assignor: sebbroker.StickyAssignor{},
+			members: []sebbroker.GroupMember{
+				{ID: "a", TopicNames: []string{"t1", "t2", "t3", "t4"}, Assigned: []string{"t1", "t3"}},
+				{ID: "b", TopicNames: []string{"t1", "t2", "t3", "t4"}, Assigned: []string{"t2", "t4"}},
+				{ID: "c", TopicNames: []string{"t1", "t2", "t3", "t4"}},
+			},
+			expected: map[string][]string{
+				"a": {"t1", "t3"},
+				"b": {"t2"},
+				"c": {"t4"},
+			},
+		},
+		"sticky, over share": {
+			assignor: sebbroker.StickyAssignor{},
+			members: []sebbroker.GroupMember{
+				{ID: "a", TopicNames: []string{"t1", "t2", "t3", "t4"}, Assigned: []string{"t1", "t2", "t3", "t4"}},
+				{ID: "b", TopicNames: []string{"t1", "t2", "t3", "t4"}},
+			},
+			expected: map[string][]string{
+				"a": {"t1", "t2"},
+				"b": {"t3", "t4"},
+			},
+		},
+		"sticky, topic no longer consumed": {
+			assignor: sebbroker.StickyAssignor{},
+			members: []sebbroker.GroupMember{
+				{ID: "a", TopicNames: []string{"t2"}, Assigned: []string{"t1", "t2"}},
+				{ID: "b", TopicNames: []string{"t1", "t2"}, Assigned: []string{"t2"}},
+			},
+			expected: map[string][]string{
+				"a": {"t2"},
+				"b": {"t1"},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			got := test.assignor.Assign(test.members)
+
+			// Assert
+			require.Equal(t, test.expected, got)
+		})
+	}
+}
+
+// TestAssignorByName verifies that AssignorByName() returns the assignors
+// listed by AssignorNames(), and returns ErrBadInput for unknown names.
+func TestAssignorByName(t *testing.T) {
+	require.Equal(t, []string{"range", "round-robin", "sticky"}, sebbroker.AssignorNames())
+
+	for _, name := range sebbroker.AssignorNames() {
+		_, err := sebbroker.AssignorByName(name)
+		require.NoError(t, err)
+	}
+
+	_, err := sebbroker.AssignorByName("unknown")
+	require.ErrorIs(t, err, seberr.ErrBadInput)
+}
@@ -3,23 +3,48 @@ package sebbroker
 import (
 	"context"
 	"fmt"
+	"slices"
+	"sync"
 	"time"
 
+	"github.com/micvbang/go-helpy/sizey"
+	"github.com/micvbang/go-helpy/syncy"
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
 	"github.com/micvbang/simple-event-broker/internal/sebrecords"
 	"github.com/micvbang/simple-event-broker/seberr"
 )
 
-type Persist func(sebrecords.Batch) ([]uint64, error)
+// Persist persists batch, returning the offsets of its records.
+//
+// NOTE: the buffers of batch may be reused once Persist returns, so it must
+// not be retained.
+type Persist func(batch sebrecords.Batch) ([]uint64, error)
+
+// maxPooledBatchBytes is the largest merged batch whose buffers are reused.
+const maxPooledBatchBytes = 64 * sizey.MB
+
+// mergedBatchPool holds the buffers that added batches are merged into before
+// they're persisted, avoiding allocating them for every batch.
+var mergedBatchPool = syncy.NewPool(func() *sebrecords.Batch {
+	return &sebrecords.Batch{}
+})
 
 type blockedAdd struct {
 	batch    sebrecords.Batch
 	response chan<- addResponse
+	addedAt  time.Time
 }
 
 type addResponse struct {
 	offsets []uint64
 	err     error
+
+	// batchID is the offset of the first record of the persisted batch if
+	// hasBatch is true, and batchWait is the time that the add waited for the
+	// batch to be persisted.
+	hasBatch  bool
+	batchID   uint64
+	batchWait time.Duration
 }
 
 // BlockingBatcher is responsible for batching records before persisting them
@@ -30,11 +55,17 @@ type addResponse struct {
 // BlockingBatcher collects records for a batch until either
 // 1) the block time has elapsed
 // 2) the soft maximum number of bytes has been reached
+// 3) no records have been added for the idle time, if set using WithIdleTime
 //
 // persistRecordBatch() will be called once the most recent context returned by
 // contextFactory() has expired, or bytesSoftMax has been reached. Beware of
 // long-lived contexts returned by contextFactory() as this could block all
 // adders until the context expires!
+//
+// The number of bytes and records that are pending, i.e. added but not yet
+// persisted, can be bounded using WithMaxPendingBytes and
+// WithMaxPendingRecords. When the bound is reached, adders wait for pending
+// records to be persisted, or fail with seberr.ErrBackpressure.
 type BlockingBatcher struct {
 	log          logger.Logger
 	bytesSoftMax int
@@ -43,19 +74,82 @@ type BlockingBatcher struct {
 	callers        chan blockedAdd
 
 	persist Persist
+
+	maxPendingBytes   int
+	maxPendingRecords int
+	pendingTimeout    time.Duration
+	idleTime          time.Duration
+
+	mu             sync.Mutex
+	pendingBytes   int
+	pendingRecords int
+	released       chan struct{}
 }
 
-func NewBlockingBatcher(log logger.Logger, blockTime time.Duration, bytesSoftMax int, persistRecordBatch Persist) *BlockingBatcher {
-	return NewBlockingBatcherWithConfig(log, bytesSoftMax, persistRecordBatch, NewContextFactory(blockTime))
+type BlockingBatcherOpts struct {
+	MaxPendingBytes   int
+	MaxPendingRecords int
+	PendingTimeout    time.Duration
+	IdleTime          time.Duration
 }
 
-func NewBlockingBatcherWithConfig(log logger.Logger, bytesSoftMax int, persist Persist, contextFactory func() context.Context) *BlockingBatcher {
+// WithMaxPendingBytes sets the maximum number of bytes of records that may be
+// pending. Zero means no limit.
+func WithMaxPendingBytes(maxBytes int) func(*BlockingBatcherOpts) {
+	return func(o *BlockingBatcherOpts) {
+		o.MaxPendingBytes = maxBytes
+	}
+}
+
+// WithMaxPendingRecords sets the maximum number of records that may be
+// pending. Zero means no limit.
+func WithMaxPendingRecords(maxRecords int) func(*BlockingBatcherOpts) {
+	return func(o *BlockingBatcherOpts) {
+		o.MaxPendingRecords = maxRecords
+	}
+}
+
+// WithPendingTimeout sets how long AddRecords waits for pending records to be
+// persisted when the pending limits are reached. Zero means that AddRecords
+// returns seberr.ErrBackpressure right away.
+func WithPendingTimeout(timeout time.Duration) func(*BlockingBatcherOpts) {
+	return func(o *BlockingBatcherOpts) {
+		o.PendingTimeout = timeout
+	}
+}
+
+// WithIdleTime sets how long a batch is collected without any records being
+// added before it's persisted, even if the block time hasn't elapsed. This
+// avoids holding the last records of a topic with little traffic back for the
+// full block time. Zero means that batches are only persisted once the block
+// time has elapsed or the soft maximum number of bytes has been reached.
+func WithIdleTime(idleTime time.Duration) func(*BlockingBatcherOpts) {
+	return func(o *BlockingBatcherOpts) {
+		o.IdleTime = idleTime
+	}
+}
+
+func NewBlockingBatcher(log logger.Logger, blockTime time.Duration, bytesSoftMax int, persistRecordBatch Persist, optFuncs ...func(*BlockingBatcherOpts)) *BlockingBatcher {
+	return NewBlockingBatcherWithConfig(log, bytesSoftMax, persistRecordBatch, NewContextFactory(blockTime), optFuncs...)
+}
+
+func NewBlockingBatcherWithConfig(log logger.Logger, bytesSoftMax int, persist Persist, contextFactory func() context.Context, optFuncs ...func(*BlockingBatcherOpts)) *BlockingBatcher {
+	opts := BlockingBatcherOpts{}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+
 	b := &BlockingBatcher{
-		log:            log,
-		callers:        make(chan blockedAdd, 32),
-		contextFactory: contextFactory,
-		persist:        persist,
-		bytesSoftMax:   bytesSoftMax,
+		log:               log,
+		callers:           make(chan blockedAdd, 32),
+		contextFactory:    contextFactory,
+		persist:           persist,
+		bytesSoftMax:      bytesSoftMax,
+		maxPendingBytes:   opts.MaxPendingBytes,
+		maxPendingRecords: opts.MaxPendingRecords,
+		pendingTimeout:    opts.PendingTimeout,
+		idleTime:          opts.IdleTime,
+		released:          make(chan struct{}),
 	}
 
 	// NOTE: this goroutine is never stopped
@@ -67,18 +161,45 @@ func NewBlockingBatcherWithConfig(log logger.Logger, bytesSoftMax int, persist P
 // AddRecords adds records to the batch that is currently being built and blocks
 // until persistRecordBatch() has been called and completed; when AddRecords returns,
 // the given record has either been persisted to topic storage or failed.
+//
+// If the pending limits are reached, AddRecords waits for at most the
+// configured pending timeout before returning seberr.ErrBackpressure.
 func (b *BlockingBatcher) AddRecords(batch sebrecords.Batch) ([]uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.pendingTimeout)
+	defer cancel()
+
+	return b.AddRecordsContext(ctx, batch)
+}
+
+// AddRecordsContext is the same as AddRecords, but waits for the pending
+// limits until ctx expires, instead of for the configured pending timeout.
+func (b *BlockingBatcher) AddRecordsContext(ctx context.Context, batch sebrecords.Batch) ([]uint64, error) {
+	result, err := b.AddRecordsResult(ctx, batch)
+	return result.Offsets, err
+}
+
+// AddRecordsResult is the same as AddRecordsContext, but also returns the ID
+// of the record batch that the records were persisted in, and how long they
+// waited for it to be persisted.
+func (b *BlockingBatcher) AddRecordsResult(ctx context.Context, batch sebrecords.Batch) (AddResult, error) {
 	// NOTE: allows single records larger than bytesSoftMax; this is done to
 	// avoid making it impossible to add records of unexpectedly large size.
 	if len(batch.Data) > b.bytesSoftMax && batch.Len() > 1 {
-		return nil, fmt.Errorf("%w (%d bytes), bytes max is %d", seberr.ErrPayloadTooLarge, len(batch.Data), b.bytesSoftMax)
+		return AddResult{}, fmt.Errorf("%w (%d bytes), bytes max is %d", seberr.ErrPayloadTooLarge, len(batch.Data), b.bytesSoftMax)
 	}
 
+	err := b.reservePending(ctx, len(batch.Data), batch.Len())
+	if err != nil {
+		return AddResult{}, err
+	}
+	defer b.releasePending(len(batch.Data), batch.Len())
+
 	responses := make(chan addResponse)
 
 	b.callers <- blockedAdd{
 		response: responses,
 		batch:    batch,
+		addedAt:  time.Now(),
 	}
 
 	// block caller until record has been peristed (or persisting failed)
@@ -88,13 +209,61 @@ func (b *BlockingBatcher) AddRecords(batch sebrecords.Batch) ([]uint64, error) {
 		// This is not supposed to happen; if it does, we can't trust b.persist().
 		panic(fmt.Sprintf("unexpected number of offsets returned %d, expected %d", len(response.offsets), batch.Len()))
 	}
-	return response.offsets, response.err
+	if response.err != nil {
+		return AddResult{Offsets: response.offsets}, response.err
+	}
+
+	return AddResult{
+		Offsets:   response.offsets,
+		BatchID:   response.batchID,
+		BatchWait: response.batchWait,
+		HasBatch:  response.hasBatch,
+	}, nil
+}
+
+// reservePending waits until numBytes and numRecords fit within the pending
+// limits, and reserves them. If nothing is pending, they always fit, such that
+// batches larger than the limits can still be added.
+func (b *BlockingBatcher) reservePending(ctx context.Context, numBytes int, numRecords int) error {
+	for {
+		b.mu.Lock()
+		fits := b.pendingRecords == 0 ||
+			((b.maxPendingBytes <= 0 || b.pendingBytes+numBytes <= b.maxPendingBytes) &&
+				(b.maxPendingRecords <= 0 || b.pendingRecords+numRecords <= b.maxPendingRecords))
+		if fits {
+			b.pendingBytes += numBytes
+			b.pendingRecords += numRecords
+			b.mu.Unlock()
+			return nil
+		}
+		released, pendingBytes, pendingRecords := b.released, b.pendingBytes, b.pendingRecords
+		b.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %d bytes and %d records pending", seberr.ErrBackpressure, pendingBytes, pendingRecords)
+		}
+	}
+}
+
+// releasePending releases numBytes and numRecords reserved by reservePending,
+// waking up all waiting adders.
+func (b *BlockingBatcher) releasePending(numBytes int, numRecords int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 
+	b.pendingBytes -= numBytes
+	b.pendingRecords -= numRecords
+	close(b.released)
+	b.released = make(chan struct{})
 }
 
 func (b *BlockingBatcher) collectBatches() {
+	blockedCallers := make([]blockedAdd, 0, 64)
 	for {
-		blockedCallers := make([]blockedAdd, 0, 64)
+		clear(blockedCallers)
+		blockedCallers = blockedCallers[:0]
 
 		// block until there are records coming in, starting a new batch collection
 		blockedCaller := <-b.callers
@@ -104,9 +273,16 @@ func (b *BlockingBatcher) collectBatches() {
 		batchRecords := blockedCaller.batch.Len()
 
 		ctx, cancel := context.WithCancel(b.contextFactory())
-		defer cancel()
 		t0 := time.Now()
 
+		// idle is never ready unless an idle time is configured
+		var idle <-chan time.Time
+		var idleTimer *time.Timer
+		if b.idleTime > 0 {
+			idleTimer = time.NewTimer(b.idleTime)
+			idle = idleTimer.C
+		}
+
 	innerLoop:
 		for {
 			select {
@@ -126,46 +302,128 @@ func (b *BlockingBatcher) collectBatches() {
 					// process one or more of those.
 					cancel()
 				}
+				if idleTimer != nil {
+					if !idleTimer.Stop() {
+						// drain the timer if it fired while the add was handled
+						select {
+						case <-idleTimer.C:
+						default:
+						}
+					}
+					idleTimer.Reset(b.idleTime)
+				}
+
+			case <-idle:
+				b.log.Debugf("no records added for %v, collecting", b.idleTime)
+				cancel()
 
 			case <-ctx.Done():
+				if idleTimer != nil {
+					idleTimer.Stop()
+				}
 				b.log.Debugf("batch collection time: %v", time.Since(t0))
 
-				recordData := make([]byte, 0, batchBytes)
-				recordSizes := make([]uint32, 0, batchRecords)
+				merged := mergedBatchPool.Get()
+				recordData := slices.Grow(merged.Data[:0], batchBytes)
+				recordSizes := slices.Grow(merged.Sizes[:0], batchRecords)
 				for _, add := range blockedCallers {
 					recordData = append(recordData, add.batch.Data...)
 					recordSizes = append(recordSizes, add.batch.Sizes...)
 				}
 
+				batch := sebrecords.NewBatch(recordSizes, recordData)
+				batch.Expires = mergeRecordFields(blockedCallers, batchRecords, func(b sebrecords.Batch) []int64 { return b.Expires })
+				batch.Timestamps = mergeRecordFields(blockedCallers, batchRecords, func(b sebrecords.Batch) []int64 { return b.Timestamps })
+				batch.Keys = mergeRecordFields(blockedCallers, batchRecords, func(b sebrecords.Batch) [][]byte { return b.Keys })
+				batch.Headers = mergeRecordFields(blockedCallers, batchRecords, func(b sebrecords.Batch) [][]sebrecords.RecordHeader { return b.Headers })
+				batch.Traces = mergeTraces(blockedCallers)
+				for _, add := range blockedCallers {
+					batch.ProducedUnixEpochUs = sebrecords.EarliestProduced(batch.ProducedUnixEpochUs, add.batch.ProducedUnixEpochUs)
+				}
+
 				// block until records are persisted or persisting failed
-				offsets, err := b.persist(sebrecords.NewBatch(recordSizes, recordData))
+				persistStart := time.Now()
+				offsets, err := b.persist(batch)
 				b.log.Debugf("%d records persisted (err: %v)", len(recordSizes), err)
+
+				if cap(recordData) <= maxPooledBatchBytes {
+					merged.Data, merged.Sizes = recordData, recordSizes
+					mergedBatchPool.Put(merged)
+				}
 				if err != nil {
 					b.log.Debugf("reporting error to %d waiting callers", len(recordSizes))
 
 					// offsets should be 0 in all error responses
 					offsets = make([]uint64, len(recordSizes))
 				}
+				batchID := uint64(0)
+				if len(offsets) > 0 {
+					batchID = offsets[0]
+				}
 
 				// unblock callers
 				offsetIndex := 0
 				for _, blockedCaller := range blockedCallers {
 					offsetMax := offsetIndex + blockedCaller.batch.Len()
 					blockedCaller.response <- addResponse{
-						offsets: offsets[offsetIndex:offsetMax],
-						err:     err,
+						offsets:   offsets[offsetIndex:offsetMax],
+						err:       err,
+						hasBatch:  len(offsets) > 0,
+						batchID:   batchID,
+						batchWait: persistStart.Sub(blockedCaller.addedAt),
 					}
 					offsetIndex = offsetMax
 					close(blockedCaller.response)
 				}
 
 				b.log.Debugf("done reporting results")
+				cancel()
 				break innerLoop
 			}
 		}
 	}
 }
 
+// mergeRecordFields returns the per-record values of all records in adds, as
+// returned by field, or nil if none of the adds have values. Records of adds
+// without values get the zero value, e.g. no expiry time.
+func mergeRecordFields[T any](adds []blockedAdd, numRecords int, field func(sebrecords.Batch) []T) []T {
+	hasValues := false
+	for _, add := range adds {
+		if len(field(add.batch)) > 0 {
+			hasValues = true
+			break
+		}
+	}
+	if !hasValues {
+		return nil
+	}
+
+	values := make([]T, 0, numRecords)
+	for _, add := range adds {
+		if addValues := field(add.batch); len(addValues) > 0 {
+			values = append(values, addValues...)
+		} else {
+			values = append(values, make([]T, add.batch.Len())...)
+		}
+	}
+	return values
+}
+
+// mergeTraces returns the traces of all records in adds, or nil if none of the
+// records have traces.
+func mergeTraces(adds []blockedAdd) []sebrecords.Trace {
+	var traces []sebrecords.Trace
+	numRecords := uint32(0)
+	for _, add := range adds {
+		if len(add.batch.Traces) > 0 {
+			traces = append(traces, sebrecords.ShiftTraces(add.batch.Traces, numRecords)...)
+		}
+		numRecords += uint32(add.batch.Len())
+	}
+	return traces
+}
+
 func NewContextFactory(blockTime time.Duration) func() context.Context {
 	return func() context.Context {
 		ctx, cancel := context.WithTimeout(context.Background(), blockTime)
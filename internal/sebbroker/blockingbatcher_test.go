@@ -3,6 +3,7 @@ package sebbroker_test
 import (
 	"context"
 	"fmt"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -284,3 +285,259 @@ func testBlockingBatcherConcurrency(t *testing.T, batcher sebbroker.RecordBatche
 	close(stop)
 	wg.Wait()
 }
+
+// TestBlockingBatcherTraces verifies that the traces of record batches added
+// concurrently refer to the same records in the merged record batch, and that
+// the merged record batch has the earliest produced time.
+func TestBlockingBatcherTraces(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	contextFactory := func() context.Context {
+		return ctx
+	}
+
+	var persisted sebrecords.Batch
+	persistRecordBatch := func(batch sebrecords.Batch) ([]uint64, error) {
+		// NOTE: batch's buffers are reused once persistRecordBatch returns
+		persisted = sebrecords.NewBatch(slices.Clone(batch.Sizes), slices.Clone(batch.Data))
+		persisted.Traces = batch.Traces
+		persisted.ProducedUnixEpochUs = batch.ProducedUnixEpochUs
+		return make([]uint64, batch.Len()), nil
+	}
+
+	batcher := sebbroker.NewBlockingBatcherWithConfig(log, sizey.MB, persistRecordBatch, contextFactory)
+
+	batches := map[string]sebrecords.Batch{}
+	adds := []sebrecords.Batch{tester.MakeRandomRecordBatch(2)}
+	for i := range 3 {
+		traceID := fmt.Sprintf("trace-%d", i)
+		batch := tester.MakeRandomRecordBatch(i + 1)
+		batch.Traces = []sebrecords.Trace{{ID: traceID, NumRecords: uint32(batch.Len())}}
+		batch.ProducedUnixEpochUs = int64(10 - i)
+		batches[traceID] = batch
+		adds = append(adds, batch)
+	}
+
+	wg := sync.WaitGroup{}
+	for _, batch := range adds {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := batcher.AddRecords(batch)
+			require.NoError(t, err)
+		}()
+	}
+
+	// wait for all above goroutines to be scheduled and block on AddRecords()
+	time.Sleep(5 * time.Millisecond)
+
+	// Act
+	cancel()
+	wg.Wait()
+
+	// Assert
+	require.Equal(t, 8, persisted.Len())
+	require.Equal(t, len(batches), len(persisted.Traces))
+	require.Equal(t, int64(8), persisted.ProducedUnixEpochUs)
+
+	records := persisted.IndividualRecords()
+	for _, trace := range persisted.Traces {
+		expected := batches[trace.ID]
+		require.Equal(t, uint32(expected.Len()), trace.NumRecords)
+		require.Equal(t, expected.IndividualRecords(), records[trace.Start:trace.Start+trace.NumRecords])
+	}
+}
+
+// TestBlockingBatcherRecordMetadata verifies that the timestamps, keys and
+// headers of records added concurrently are kept in the merged record batch,
+// and that records added without them get zero values.
+func TestBlockingBatcherRecordMetadata(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	contextFactory := func() context.Context {
+		return ctx
+	}
+
+	var persisted sebrecords.Batch
+	persistRecordBatch := func(batch sebrecords.Batch) ([]uint64, error) {
+		// NOTE: batch's buffers are reused once persistRecordBatch returns
+		persisted = sebrecords.NewBatch(slices.Clone(batch.Sizes), slices.Clone(batch.Data))
+		persisted.Timestamps = batch.Timestamps
+		persisted.Keys = batch.Keys
+		persisted.Headers = batch.Headers
+		return make([]uint64, batch.Len()), nil
+	}
+
+	batcher := sebbroker.NewBlockingBatcherWithConfig(log, sizey.MB, persistRecordBatch, contextFactory)
+
+	withMetadata := tester.MakeRandomRecordBatch(2)
+	withMetadata.Timestamps = []int64{1, 2}
+	withMetadata.Keys = [][]byte{[]byte("a"), []byte("b")}
+	withMetadata.Headers = [][]sebrecords.RecordHeader{{{Key: "k", Value: []byte("v")}}, {}}
+	withoutMetadata := tester.MakeRandomRecordBatch(1)
+
+	wg := sync.WaitGroup{}
+	for _, batch := range []sebrecords.Batch{withMetadata, withoutMetadata} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := batcher.AddRecords(batch)
+			require.NoError(t, err)
+		}()
+	}
+
+	// wait for all above goroutines to be scheduled and block on AddRecords()
+	time.Sleep(5 * time.Millisecond)
+
+	// Act
+	cancel()
+	wg.Wait()
+
+	// Assert
+	require.Equal(t, 3, persisted.Len())
+	require.Equal(t, 3, len(persisted.Timestamps))
+	require.Equal(t, 3, len(persisted.Keys))
+	require.Equal(t, 3, len(persisted.Headers))
+
+	for i, record := range persisted.IndividualRecords() {
+		j := slices.IndexFunc(withMetadata.IndividualRecords(), func(r []byte) bool { return slices.Equal(r, record) })
+		if j == -1 {
+			require.Equal(t, int64(0), persisted.Timestamps[i])
+			require.Nil(t, persisted.Keys[i])
+			require.Nil(t, persisted.Headers[i])
+			continue
+		}
+
+		require.Equal(t, withMetadata.Timestamps[j], persisted.Timestamps[i])
+		require.Equal(t, withMetadata.Keys[j], persisted.Keys[i])
+		require.Equal(t, withMetadata.Headers[j], persisted.Headers[i])
+	}
+}
+
+// TestBlockingBatcherBackpressure verifies that AddRecords() returns
+// seberr.ErrBackpressure when the pending limits are reached, and that
+// AddRecordsContext() waits for pending records to be persisted until its
+// context expires.
+func TestBlockingBatcherBackpressure(t *testing.T) {
+	tests := map[string]struct {
+		optFunc func(*sebbroker.BlockingBatcherOpts)
+	}{
+		"bytes":   {optFunc: sebbroker.WithMaxPendingBytes(150)},
+		"records": {optFunc: sebbroker.WithMaxPendingRecords(1)},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			contextFactory := func() context.Context {
+				return ctx
+			}
+
+			persisting := make(chan struct{}, 1)
+			unblockPersist := make(chan struct{})
+			persistRecordBatch := func(batch sebrecords.Batch) ([]uint64, error) {
+				persisting <- struct{}{}
+				<-unblockPersist
+				return make([]uint64, batch.Len()), nil
+			}
+
+			batcher := sebbroker.NewBlockingBatcherWithConfig(log, sizey.MB, persistRecordBatch, contextFactory, test.optFunc)
+
+			// first record is pending until unblockPersist is closed
+			firstErr := make(chan error)
+			go func() {
+				_, err := batcher.AddRecords(tester.MakeRandomRecordBatchSize(1, 100))
+				firstErr <- err
+			}()
+			cancel()
+			<-persisting
+
+			// Act, Assert
+			_, err := batcher.AddRecords(tester.MakeRandomRecordBatchSize(1, 100))
+			require.ErrorIs(t, err, seberr.ErrBackpressure)
+
+			waitCtx, waitCancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+			defer waitCancel()
+			_, err = batcher.AddRecordsContext(waitCtx, tester.MakeRandomRecordBatchSize(1, 100))
+			require.ErrorIs(t, err, seberr.ErrBackpressure)
+
+			// waiting adder is let through once the first record is persisted
+			waitErr := make(chan error)
+			go func() {
+				_, err := batcher.AddRecordsContext(context.Background(), tester.MakeRandomRecordBatchSize(1, 100))
+				waitErr <- err
+			}()
+
+			close(unblockPersist)
+			require.NoError(t, <-firstErr)
+
+			<-persisting
+			require.NoError(t, <-waitErr)
+		})
+	}
+}
+
+// TestBlockingBatcherIdleTime verifies that a batch is persisted once no
+// records have been added for the idle time, without waiting for the block
+// time to elapse, and that records added within the idle time of each other
+// are persisted in the same batch.
+func TestBlockingBatcherIdleTime(t *testing.T) {
+	const idleTime = 50 * time.Millisecond
+
+	// batches are never persisted because of the block time
+	contextFactory := func() context.Context {
+		return context.Background()
+	}
+
+	batchLens := make(chan int, 2)
+	persistRecordBatch := func(batch sebrecords.Batch) ([]uint64, error) {
+		batchLens <- batch.Len()
+		return make([]uint64, batch.Len()), nil
+	}
+
+	batcher := sebbroker.NewBlockingBatcherWithConfig(log, sizey.MB, persistRecordBatch, contextFactory, sebbroker.WithIdleTime(idleTime))
+
+	wg := sync.WaitGroup{}
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := batcher.AddRecords(tester.MakeRandomRecordBatch(1))
+			require.NoError(t, err)
+		}()
+	}
+
+	// Act
+	t0 := time.Now()
+	wg.Wait()
+
+	// Assert
+	require.Less(t, time.Since(t0), time.Second)
+	require.Equal(t, 2, <-batchLens)
+
+	// Act
+	_, err := batcher.AddRecords(tester.MakeRandomRecordBatch(3))
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, 3, <-batchLens)
+}
+
+func BenchmarkBlockingBatcher(b *testing.B) {
+	persistRecordBatch := func(batch sebrecords.Batch) ([]uint64, error) {
+		return make([]uint64, batch.Len()), nil
+	}
+
+	batcher := sebbroker.NewBlockingBatcher(log, time.Millisecond, 4*sizey.MB, persistRecordBatch)
+	batch := tester.MakeRandomRecordBatchSize(16, 1024)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, err := batcher.AddRecords(batch)
+			if err != nil {
+				b.Fatalf("unexpected error: %s", err)
+			}
+		}
+	})
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/micvbang/go-helpy/sizey"
@@ -18,25 +20,170 @@ type RecordBatcher interface {
 	AddRecords(sebrecords.Batch) ([]uint64, error)
 }
 
+// contextRecordBatcher is implemented by RecordBatchers that may block before
+// accepting records, and allow callers to stop waiting.
+type contextRecordBatcher interface {
+	AddRecordsContext(context.Context, sebrecords.Batch) ([]uint64, error)
+}
+
+// resultRecordBatcher is implemented by RecordBatchers that can tell which
+// record batch added records were persisted in.
+type resultRecordBatcher interface {
+	AddRecordsResult(context.Context, sebrecords.Batch) (AddResult, error)
+}
+
+// AddResult describes where and how quickly added records were committed.
+type AddResult struct {
+	Offsets []uint64
+
+	// HasBatch is true if the record batch that the records were persisted in
+	// is known. BatchID is the offset of the first record of that record
+	// batch, and BatchKey its key in topic storage at the time it was
+	// persisted; it may be merged into another record batch later.
+	HasBatch bool
+	BatchID  uint64
+	BatchKey string
+
+	// BatchWait is the time that the records waited for their batch to be
+	// persisted, and CommitLatency the total time spent adding them.
+	BatchWait     time.Duration
+	CommitLatency time.Duration
+
+	// Duplicate is true if the records weren't added because an identical
+	// batch was added within the broker's DedupWindow. The result is then
+	// that of the original batch. See WithDedupWindow.
+	Duplicate bool
+}
+
 type topicBatcher struct {
 	batcher RecordBatcher
 	topic   *sebtopic.Topic
 }
 
+// topicEntry holds the topicBatcher of a topic once it has been made. ready is
+// closed once tb and err have been set. This ensures that the topicBatcher of
+// each topic is made at most once, without holding a lock that is shared with
+// other topics while making it.
+type topicEntry struct {
+	ready chan struct{}
+	tb    topicBatcher
+	err   error
+}
+
 type Broker struct {
 	log logger.Logger
 
 	autoCreateTopics bool
+	readReplica      bool
 	topicFactory     func(log logger.Logger, topicName string) (*sebtopic.Topic, error)
 	batcherFactory   func(logger.Logger, *sebtopic.Topic) RecordBatcher
 
-	mu            *sync.Mutex
-	topicBatchers map[string]topicBatcher
+	defaultMaxRecords int
+	maxRecords        int
+	fetchLimiter      *fetchLimiter
+
+	// topicBatchers maps topic names to *topicEntry
+	topicBatchers sync.Map
+
+	mu *sync.Mutex
+
+	// maintenanceMode, frozenTopics, topicRetention and topicLabels are
+	// protected by mu
+	maintenanceMode bool
+	frozenTopics    map[string]struct{}
+	topicRetention  map[string]time.Duration
+	topicLabels     map[string]map[string]string
+
+	// aliases maps topic aliases to the names of the topics they refer to.
+	// It's replaced, never modified, while holding aliasMu.
+	aliases    atomic.Pointer[map[string]string]
+	aliasMu    sync.Mutex
+	aliasStore AliasStore
+
+	// groups maps consumer groups to the offsets they've committed. It's
+	// replaced, never modified, while holding groupMu.
+	groups     atomic.Pointer[map[string]GroupOffsets]
+	groupMu    sync.Mutex
+	groupStore GroupOffsetStore
+
+	groupMaxIdle time.Duration
+	coordinator  *groupCoordinator
+
+	replays *replays
+
+	produceInterceptors []ProduceInterceptor
+	quotas              *quotaEnforcer
+
+	// dedup is nil if batches aren't deduplicated.
+	dedup *batchDedup
+
+	watchers *topicWatchers
+
+	// writeFence is held for reading while records are added and record
+	// batches are rewritten or deleted, and for writing while a snapshot is
+	// made. See Snapshot.
+	writeFence sync.RWMutex
+
+	// shutdown is closed by Shutdown.
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
 }
 
 type Opts struct {
 	AutoCreateTopic bool
 	BatcherFactory  batcherFactory
+
+	// DefaultMaxRecords is the maximum number of records returned by
+	// GetRecords when maxRecords is 0.
+	DefaultMaxRecords int
+
+	// MaxRecords is the maximum number of records returned by a single call to
+	// GetRecords; larger values of maxRecords are lowered to it. Unlimited if
+	// 0.
+	MaxRecords int
+
+	// MaxFetchBytesInFlight is the maximum number of bytes being read by all
+	// concurrent calls to GetRecords. Calls wait for bytes to be released
+	// while it's reached. Unlimited if 0.
+	MaxFetchBytesInFlight int
+
+	// AliasStore persists topic aliases. Aliases are only kept in memory for
+	// the lifetime of Broker if nil.
+	AliasStore AliasStore
+
+	// GroupOffsetStore persists the offsets committed by consumer groups.
+	// Offsets are only kept in memory for the lifetime of Broker if nil.
+	GroupOffsetStore GroupOffsetStore
+
+	// GroupMaxIdle is the amount of time after which consumer groups that
+	// haven't been active are stale. Groups never become stale if 0. See
+	// ExpireStaleGroups.
+	GroupMaxIdle time.Duration
+
+	// GroupAssignor is the name of the assignor that assigns topics to the
+	// members of consumer groups that don't choose one. See JoinGroup.
+	GroupAssignor string
+
+	// GroupSessionTimeout is the session timeout of members of consumer
+	// groups that join without one.
+	GroupSessionTimeout time.Duration
+
+	// ProduceInterceptors are called with the records added to each topic
+	// before they're added. See WithProduceInterceptor.
+	ProduceInterceptors []ProduceInterceptor
+
+	// Quotas limit the number of bytes that can be produced to namespaces or
+	// by principals. See WithQuotas.
+	Quotas []Quota
+
+	// DedupWindow is the amount of time that identical record batches are
+	// deduplicated for. Batches aren't deduplicated if 0. See
+	// WithDedupWindow.
+	DedupWindow time.Duration
+
+	// ReadReplica makes the broker serve reads of topics written by another
+	// broker sharing its storage, rejecting all writes. See WithReadReplica.
+	ReadReplica bool
 }
 
 // New returns a Broker that utilizes topicFactory to store records.
@@ -52,49 +199,215 @@ func New(log logger.Logger, topicFactory TopicFactory, optFuncs ...func(*Opts))
 	opts := Opts{
 		AutoCreateTopic: true,
 		BatcherFactory:  NewBlockingBatcherFactory(1*time.Second, 10*sizey.MB),
+
+		DefaultMaxRecords: 10,
+
+		GroupAssignor:       "range",
+		GroupSessionTimeout: 30 * time.Second,
 	}
 
 	for _, optFunc := range optFuncs {
 		optFunc(&opts)
 	}
 
-	return &Broker{
-		log:              log,
-		autoCreateTopics: opts.AutoCreateTopic,
-		topicFactory:     topicFactory,
-		batcherFactory:   opts.BatcherFactory,
-		mu:               &sync.Mutex{},
-		topicBatchers:    make(map[string]topicBatcher),
+	quotas := make([]Quota, 0, len(opts.Quotas))
+	for _, quota := range opts.Quotas {
+		err := quota.validate()
+		if err != nil {
+			log.Errorf("ignoring quota '%s': %s", quota.Name(), err)
+			continue
+		}
+		quotas = append(quotas, quota)
+	}
+
+	broker := &Broker{
+		log:               log,
+		autoCreateTopics:  opts.AutoCreateTopic,
+		readReplica:       opts.ReadReplica,
+		topicFactory:      topicFactory,
+		batcherFactory:    opts.BatcherFactory,
+		defaultMaxRecords: opts.DefaultMaxRecords,
+		maxRecords:        opts.MaxRecords,
+		fetchLimiter:      newFetchLimiter(opts.MaxFetchBytesInFlight),
+		mu:                &sync.Mutex{},
+		frozenTopics:      make(map[string]struct{}),
+		topicRetention:    make(map[string]time.Duration),
+		topicLabels:       make(map[string]map[string]string),
+		aliasStore:        opts.AliasStore,
+		groupStore:        opts.GroupOffsetStore,
+		groupMaxIdle:      opts.GroupMaxIdle,
+		coordinator:       newGroupCoordinator(opts.GroupAssignor, opts.GroupSessionTimeout),
+		replays:           newReplays(),
+
+		produceInterceptors: opts.ProduceInterceptors,
+		quotas:              newQuotaEnforcer(quotas, time.Now),
+		watchers:            newTopicWatchers(),
+		shutdown:            make(chan struct{}),
+	}
+	if opts.DedupWindow > 0 {
+		broker.dedup = newBatchDedup(opts.DedupWindow, time.Now)
 	}
+	broker.aliases.Store(&map[string]string{})
+	broker.groups.Store(&map[string]GroupOffsets{})
+
+	return broker
 }
 
 // AddRecords adds record to topicName, using the configured batcher. It returns
 // only once data has been committed to topic storage.
+//
+// If writes to topicName are frozen, either because the broker is in
+// maintenance mode or because the topic itself is frozen, AddRecords returns
+// seberr.ErrWritesFrozen. If topicName has been sealed, AddRecords returns
+// seberr.ErrTopicSealed, which wraps seberr.ErrWritesFrozen. See SealTopic.
+//
+// If topicName has a retention, records without an expiry time are set to
+// expire after it. See SetTopicRetention.
+//
+// Records are passed through the broker's produce interceptors before they're
+// added, and only the records returned by them are given offsets. See
+// WithProduceInterceptor.
+//
+// If the batcher has too many pending records, AddRecords returns
+// seberr.ErrBackpressure.
+//
+// If adding the records would exceed one of the broker's quotas, AddRecords
+// returns a *QuotaExceededError, which wraps seberr.ErrQuotaExceeded. See
+// WithQuotas.
+//
+// If the broker deduplicates batches and an identical batch was added to
+// topicName within its window, the offsets of that batch are returned without
+// adding the records again. See WithDedupWindow.
+//
+// While a snapshot is being made, AddRecords waits for it to finish. See
+// Snapshot.
 func (s *Broker) AddRecords(topicName string, batch sebrecords.Batch) ([]uint64, error) {
+	result, err := s.addRecords(context.Background(), topicName, batch, func(batcher RecordBatcher, batch sebrecords.Batch) (AddResult, error) {
+		offsets, err := batcher.AddRecords(batch)
+		return AddResult{Offsets: offsets}, err
+	})
+	return result.Offsets, err
+}
+
+// AddRecordsContext is the same as AddRecords, but waits for the batcher's
+// pending records until ctx expires, if the batcher supports it. Principal
+// quotas are enforced for the principal of ctx. See ContextWithPrincipal.
+func (s *Broker) AddRecordsContext(ctx context.Context, topicName string, batch sebrecords.Batch) ([]uint64, error) {
+	result, err := s.AddRecordsResult(ctx, topicName, batch)
+	return result.Offsets, err
+}
+
+// AddRecordsResult is the same as AddRecordsContext, but also returns the
+// record batch that the records were persisted in, if the batcher supports
+// it, and how long it took to commit them. This allows producers to monitor
+// the latency added by batching, and to find the records in topic storage.
+func (s *Broker) AddRecordsResult(ctx context.Context, topicName string, batch sebrecords.Batch) (AddResult, error) {
+	return s.addRecords(ctx, topicName, batch, func(batcher RecordBatcher, batch sebrecords.Batch) (AddResult, error) {
+		switch batcher := batcher.(type) {
+		case resultRecordBatcher:
+			return batcher.AddRecordsResult(ctx, batch)
+		case contextRecordBatcher:
+			offsets, err := batcher.AddRecordsContext(ctx, batch)
+			return AddResult{Offsets: offsets}, err
+		}
+		offsets, err := batcher.AddRecords(batch)
+		return AddResult{Offsets: offsets}, err
+	})
+}
+
+func (s *Broker) addRecords(ctx context.Context, topicName string, batch sebrecords.Batch, add func(RecordBatcher, sebrecords.Batch) (AddResult, error)) (AddResult, error) {
+	t0 := time.Now()
+
+	s.writeFence.RLock()
+	defer s.writeFence.RUnlock()
+
+	if s.WritesFrozen(topicName) {
+		return AddResult{}, fmt.Errorf("%w: '%s'", seberr.ErrWritesFrozen, topicName)
+	}
+
+	if len(batch.Expires) > 0 && len(batch.Expires) != batch.Len() {
+		return AddResult{}, fmt.Errorf("%w: %d expiry times given for %d records", seberr.ErrBadInput, len(batch.Expires), batch.Len())
+	}
+
+	if s.dedup == nil {
+		return s.addBatch(ctx, t0, topicName, batch, add)
+	}
+
+	resolvedName := s.resolveTopicName(topicName)
+	hash := hashBatch(resolvedName, batch)
+	result, err := s.dedup.add(ctx, hash, resolvedName, PrincipalFromContext(ctx), func() (AddResult, error) {
+		return s.addBatch(ctx, t0, topicName, batch, add)
+	})
+	if result.Duplicate {
+		s.log.Debugf("acknowledged duplicate batch of %d records to topic '%s'", batch.Len(), topicName)
+		result.CommitLatency = time.Since(t0)
+	}
+	return result, err
+}
+
+// addBatch adds batch to topicName using add.
+// NOTE: you must hold s.writeFence for reading when calling this method!
+func (s *Broker) addBatch(ctx context.Context, t0 time.Time, topicName string, batch sebrecords.Batch, add func(RecordBatcher, sebrecords.Batch) (AddResult, error)) (AddResult, error) {
+	if len(s.produceInterceptors) > 0 {
+		var err error
+		batch, err = s.intercept(s.resolveTopicName(topicName), batch)
+		if err != nil {
+			return AddResult{}, fmt.Errorf("adding batch to topic '%s': %w", topicName, err)
+		}
+		if batch.Len() == 0 {
+			return AddResult{Offsets: []uint64{}, CommitLatency: time.Since(t0)}, nil
+		}
+	}
+
+	if retention := s.TopicRetention(topicName); retention > 0 {
+		batch = applyRetention(batch, retention, time.Now())
+	}
+
 	tb, err := s.getTopicBatcher(topicName)
 	if err != nil {
-		return nil, err
+		return AddResult{}, err
+	}
+
+	release, err := s.quotas.reserve(s.resolveTopicName(topicName), PrincipalFromContext(ctx), int64(len(batch.Data)), s.retainedBytes)
+	if err != nil {
+		return AddResult{}, fmt.Errorf("adding batch to topic '%s': %w", topicName, err)
 	}
 
-	offsets, err := tb.batcher.AddRecords(batch)
+	result, err := add(tb.batcher, batch)
 	if err != nil {
-		return nil, fmt.Errorf("adding batch to topic '%s': %w", topicName, err)
+		release()
+		return AddResult{}, fmt.Errorf("adding batch to topic '%s': %w", topicName, err)
 	}
-	return offsets, nil
+
+	if result.HasBatch {
+		result.BatchKey = tb.topic.RecordBatchKey(result.BatchID)
+	}
+	if len(result.Offsets) > 0 {
+		s.watchers.advanced(s.resolveTopicName(topicName), tb.topic.NextOffset())
+	}
+	result.CommitLatency = time.Since(t0)
+	return result, nil
 }
 
 // GetRecord returns the record at offset in topicName. It will only return offsets
 // that have been committed to topic storage.
-func (s *Broker) GetRecord(batch *sebrecords.Batch, topicName string, offset uint64) ([]byte, error) {
+func (s *Broker) GetRecord(ctx context.Context, batch *sebrecords.Batch, topicName string, offset uint64) ([]byte, error) {
 	tb, err := s.getTopicBatcher(topicName)
 	if err != nil {
 		return nil, err
 	}
 
-	err = tb.topic.ReadRecords(context.Background(), batch, offset, 1, 0)
+	err = tb.topic.ReadRecords(ctx, batch, offset, 1, 0)
 	if err != nil {
 		return nil, err
 	}
+
+	// the record at offset was skipped, e.g. because it's not allowed by
+	// the read limits of ctx; don't return the record following it.
+	if batch.Skipped > 0 || batch.Len() == 0 {
+		return nil, fmt.Errorf("record %d not readable: %w", offset, seberr.ErrOutOfBounds)
+	}
+
 	record, err := batch.Records(0, 1)
 	if err != nil {
 		return nil, fmt.Errorf("records: %w", err)
@@ -104,23 +417,26 @@ func (s *Broker) GetRecord(batch *sebrecords.Batch, topicName string, offset uin
 
 // CreateTopic creates a topic with the given name and default configuration.
 func (s *Broker) CreateTopic(topicName string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	// TODO: make topic configurable, e.g.
 	// - compression
 	// - mime type?
 	// TODO: store information about topic configuration somewhere
 
-	_, exists := s.topicBatchers[topicName]
-	if exists {
-		return seberr.ErrTopicAlreadyExists
+	if s.readReplica {
+		return errReadReplica
 	}
 
-	tb, err := s.makeTopicBatcher(topicName)
+	if _, ok := s.TopicAliases()[topicName]; ok {
+		return fmt.Errorf("%w: '%s' is an alias", seberr.ErrTopicAlreadyExists, topicName)
+	}
+
+	tb, made, err := s.loadOrMakeTopicBatcher(topicName)
 	if err != nil {
 		return err
 	}
+	if !made {
+		return seberr.ErrTopicAlreadyExists
+	}
 
 	// since topicBatchers is just a local cache of the topics that were
 	// instantiated during the lifetime of Broker, we don't yet know whether
@@ -129,9 +445,75 @@ func (s *Broker) CreateTopic(topicName string) error {
 	if tb.topic.NextOffset() != 0 {
 		return seberr.ErrTopicAlreadyExists
 	}
+	s.watchers.created(topicName, tb.topic.NextOffset())
+
+	return nil
+}
+
+// DeleteTopic deletes topicName and all of its records.
+//
+// Records that are added to topicName while DeleteTopic is running may or may
+// not be deleted. Aliases of topicName and offsets committed for it by consumer
+// groups are removed, and aliases can't be used to delete the topic that they
+// refer to.
+func (s *Broker) DeleteTopic(topicName string) error {
+	if s.readReplica {
+		return errReadReplica
+	}
+
+	if _, ok := s.TopicAliases()[topicName]; ok {
+		return fmt.Errorf("%w: '%s' is an alias", seberr.ErrBadInput, topicName)
+	}
+
+	s.writeFence.RLock()
+	defer s.writeFence.RUnlock()
+
+	// topics that haven't been instantiated during the lifetime of Broker
+	// must be instantiated in order to find their record batches.
+	tb, made, err := s.loadOrMakeTopicBatcher(topicName)
+	if err != nil {
+		return err
+	}
+
+	if made && tb.topic.NextOffset() == 0 {
+		s.topicBatchers.Delete(topicName)
+		return fmt.Errorf("%w: '%s'", seberr.ErrTopicNotFound, topicName)
+	}
+
+	err = tb.topic.Delete()
+	if err != nil {
+		return fmt.Errorf("deleting topic '%s': %w", topicName, err)
+	}
 
-	s.topicBatchers[topicName] = tb
-	return err
+	s.topicBatchers.Delete(topicName)
+	s.watchers.deleted(topicName)
+
+	s.mu.Lock()
+	delete(s.frozenTopics, topicName)
+	delete(s.topicRetention, topicName)
+	delete(s.topicLabels, topicName)
+	s.mu.Unlock()
+
+	err = s.removeGroupOffsetsOf(topicName)
+	if err != nil {
+		return err
+	}
+
+	return s.removeAliasesOf(topicName)
+}
+
+// TopicNames returns the names of topics that were created or used during the
+// lifetime of Broker, sorted by name.
+func (s *Broker) TopicNames() []string {
+	topicBatchers := s.madeTopicBatchers()
+
+	topicNames := make([]string, 0, len(topicBatchers))
+	for topicName := range topicBatchers {
+		topicNames = append(topicNames, topicName)
+	}
+	slices.Sort(topicNames)
+
+	return topicNames
 }
 
 // GetRecords returns records starting from startOffset and until either:
@@ -139,44 +521,184 @@ func (s *Broker) CreateTopic(topicName string) error {
 // 2) maxRecords has been reached
 // 3) softMaxBytes has been reached
 //
-// maxRecords defaults to 10 if 0 is given.
+// maxRecords defaults to Opts.DefaultMaxRecords if 0 is given, and is lowered
+// to Opts.MaxRecords if it's higher.
 // softMaxBytes is "soft" because it will not be honored if it means returning
 // zero records. In this case, at least one record will be returned.
 //
+// Records that have expired are skipped and counted in batch.Skipped. If all
+// available records from offset have expired, GetRecords waits for new records
+// to be added.
+//
 // NOTE: GetRecordBatch will always return all of the records that it managed to
 // fetch until one of the above conditions were met. This means that the
 // returned value should be used even if err is non-nil!
 func (s *Broker) GetRecords(ctx context.Context, batch *sebrecords.Batch, topicName string, offset uint64, maxRecords int, softMaxBytes int) error {
-	if maxRecords == 0 {
-		maxRecords = 10
-	}
+	maxRecords = s.fetchMaxRecords(maxRecords)
 
 	tb, err := s.getTopicBatcher(topicName)
 	if err != nil {
 		return err
 	}
 
-	// TODO: make configurable whether to block on this or return
-	// seberr.ErrNotFound, which allows us to remove GetRecord()
-	// wait for startOffset to become available. Can only return errors from
-	// the context
-	err = tb.topic.OffsetCond.Wait(ctx, offset)
+	return s.waitForRecords(ctx, tb.topic, batch, offset, func(offset uint64) error {
+		return s.readRecords(ctx, tb.topic, batch, offset, maxRecords, softMaxBytes)
+	})
+}
+
+// GetRecordsWriter works like GetRecords, but only adds the sizes of the
+// records to batch. The returned RecordsWriter writes the data of the records,
+// e.g. directly to a network connection. See sebtopic.Topic.PrepareRecords.
+//
+// If batch.Data has been allocated, softMaxBytes is lowered to cap(batch.Data)
+// such that GetRecordsWriter returns no more data than GetRecords could have
+// read into batch.
+//
+// NOTE: if the returned RecordsWriter is non-nil, it should be used even if
+// err is non-nil!
+func (s *Broker) GetRecordsWriter(ctx context.Context, batch *sebrecords.Batch, topicName string, offset uint64, maxRecords int, softMaxBytes int) (*sebtopic.RecordsWriter, error) {
+	maxRecords = s.fetchMaxRecords(maxRecords)
+	if cap(batch.Data) > 0 && (softMaxBytes <= 0 || softMaxBytes > cap(batch.Data)) {
+		softMaxBytes = cap(batch.Data)
+	}
+
+	tb, err := s.getTopicBatcher(topicName)
 	if err != nil {
-		ctxExpiredErr := errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
-		if ctxExpiredErr {
-			return fmt.Errorf("waiting for offset %d to be reached: %w", offset, err)
+		return nil, err
+	}
+
+	var rw *sebtopic.RecordsWriter
+	err = s.waitForRecords(ctx, tb.topic, batch, offset, func(offset uint64) error {
+		var err error
+		rw, err = tb.topic.PrepareRecords(ctx, batch, offset, maxRecords, softMaxBytes)
+		return err
+	})
+	return rw, err
+}
+
+// waitForRecords waits for offset to be added to topic and calls read. If all
+// of the records that read finds have expired, it waits for the offset
+// following them and calls read again.
+func (s *Broker) waitForRecords(ctx context.Context, topic *sebtopic.Topic, batch *sebrecords.Batch, offset uint64, read func(offset uint64) error) error {
+	// waiting stops when the broker is shut down
+	waitCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.shutdown:
+			cancel()
+		case <-waitCtx.Done():
+		}
+	}()
+
+	for {
+		// TODO: make configurable whether to block on this or return
+		// seberr.ErrNotFound, which allows us to remove GetRecord()
+		// wait for startOffset to become available. Can only return errors from
+		// the context
+		err := topic.OffsetCond.Wait(waitCtx, offset)
+		if err != nil {
+			ctxExpiredErr := errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+			if ctxExpiredErr {
+				return fmt.Errorf("waiting for offset %d to be reached: %w", offset, err)
+			}
+
+			s.log.Errorf("unexpected error when waiting for offset %d to be reached: %s", offset, err)
+			return fmt.Errorf("unexpected when waiting for offset %d to be reached: %w", offset, err)
 		}
 
-		s.log.Errorf("unexpected error when waiting for offset %d to be reached: %s", offset, err)
-		return fmt.Errorf("unexpected when waiting for offset %d to be reached: %w", offset, err)
+		skipped := batch.Skipped
+		err = read(offset)
+		if err != nil {
+			return err
+		}
+
+		// all of the records that were read had expired; wait for new ones
+		if batch.Len() == 0 && batch.Skipped > skipped {
+			offset += uint64(batch.Skipped - skipped)
+			continue
+		}
+
+		return nil
+	}
+}
+
+// Shutdown makes calls to GetRecords and GetRecordsWriter that are waiting
+// for records to be added return what they have read so far, with an error
+// wrapping context.Canceled, and makes future calls not wait. This allows
+// in-flight long-polls to be drained quickly when shutting down. Adding
+// records is unaffected, such that in-flight produce requests can finish.
+func (s *Broker) Shutdown() {
+	s.shutdownOnce.Do(func() {
+		s.log.Infof("shutting down, no longer waiting for records")
+		close(s.shutdown)
+	})
+}
+
+// GetRecordsNonBlocking works like GetRecords, but does not wait for offset to
+// be produced. If it hasn't been, seberr.ErrOffsetOutOfBounds is returned
+// immediately. This lets callers distinguish offsets that don't exist yet from
+// reads that time out.
+//
+// The returned offset is the offset to read next; when
+// seberr.ErrOffsetOutOfBounds is returned, this is the topic's next offset.
+func (s *Broker) GetRecordsNonBlocking(ctx context.Context, batch *sebrecords.Batch, topicName string, offset uint64, maxRecords int, softMaxBytes int) (uint64, error) {
+	maxRecords = s.fetchMaxRecords(maxRecords)
+
+	tb, err := s.getTopicBatcher(topicName)
+	if err != nil {
+		return offset, err
+	}
+
+	nextOffset := tb.topic.NextOffset()
+	if offset >= nextOffset {
+		return nextOffset, fmt.Errorf("offset %d, next offset %d: %w", offset, nextOffset, seberr.ErrOffsetOutOfBounds)
 	}
 
-	err = tb.topic.ReadRecords(ctx, batch, offset, maxRecords, softMaxBytes)
+	read, skipped := batch.Len(), batch.Skipped
+	err = s.readRecords(ctx, tb.topic, batch, offset, maxRecords, softMaxBytes)
+	return offset + uint64(batch.Len()-read+batch.Skipped-skipped), err
+}
+
+// fetchMaxRecords returns the maximum number of records to read when
+// maxRecords records are requested.
+func (s *Broker) fetchMaxRecords(maxRecords int) int {
+	if maxRecords <= 0 {
+		maxRecords = s.defaultMaxRecords
+	}
+	if s.maxRecords > 0 {
+		maxRecords = min(maxRecords, s.maxRecords)
+	}
+	return maxRecords
+}
+
+// readRecords reads records from topic into batch, waiting for the bytes that
+// may be read to fit within Opts.MaxFetchBytesInFlight.
+func (s *Broker) readRecords(ctx context.Context, topic *sebtopic.Topic, batch *sebrecords.Batch, offset uint64, maxRecords int, softMaxBytes int) error {
+	numBytes := cap(batch.Data) - len(batch.Data)
+	if softMaxBytes > 0 {
+		numBytes = min(numBytes, softMaxBytes)
+	}
+
+	err := s.fetchLimiter.reserve(ctx, numBytes)
 	if err != nil {
 		return err
 	}
+	defer s.fetchLimiter.release(numBytes)
 
-	return nil
+	return topic.ReadRecords(ctx, batch, offset, maxRecords, softMaxBytes)
+}
+
+// SampleRecords reads a uniform random sample of records from topicName into
+// batch, returning the offsets of the sampled records. See
+// sebtopic.Topic.SampleRecords.
+func (s *Broker) SampleRecords(ctx context.Context, batch *sebrecords.Batch, topicName string, input sebtopic.SampleInput) ([]uint64, error) {
+	tb, err := s.getTopicBatcher(topicName)
+	if err != nil {
+		return nil, err
+	}
+
+	return tb.topic.SampleRecords(ctx, batch, input)
 }
 
 // Metadata returns metadata about the topic.
@@ -189,11 +711,146 @@ func (s *Broker) Metadata(topicName string) (sebtopic.Metadata, error) {
 	return tb.topic.Metadata()
 }
 
+// Segments returns the record batch files that make up topicName.
+func (s *Broker) Segments(topicName string) ([]sebtopic.Segment, error) {
+	tb, err := s.getTopicBatcher(topicName)
+	if err != nil {
+		return nil, err
+	}
+
+	return tb.topic.Segments()
+}
+
+// BatchInfo returns information about the record batch of topicName that
+// holds offset. See sebtopic.Topic.BatchInfo.
+func (s *Broker) BatchInfo(ctx context.Context, topicName string, offset uint64) (sebtopic.BatchInfo, error) {
+	tb, err := s.getTopicBatcher(topicName)
+	if err != nil {
+		return sebtopic.BatchInfo{}, err
+	}
+
+	return tb.topic.BatchInfo(ctx, offset)
+}
+
+// SegmentsWithTraces returns the segments of topicName along with the traces
+// of their records. See sebtopic.Topic.SegmentsWithTraces.
+func (s *Broker) SegmentsWithTraces(ctx context.Context, topicName string) ([]sebtopic.Segment, error) {
+	tb, err := s.getTopicBatcher(topicName)
+	if err != nil {
+		return nil, err
+	}
+
+	return tb.topic.SegmentsWithTraces(ctx)
+}
+
+// DropExpiredBatches deletes the oldest record batches of all topics
+// instantiated by the broker, for as long as all of their records have expired.
+// It returns the number of record batches that were deleted.
+func (s *Broker) DropExpiredBatches(now time.Time) (int, error) {
+	// record batches are dropped by the broker writing to the topics.
+	if s.readReplica {
+		return 0, nil
+	}
+
+	s.writeFence.RLock()
+	defer s.writeFence.RUnlock()
+
+	dropped := 0
+	for _, tb := range s.madeTopicBatchers() {
+		n, err := tb.topic.DropExpiredBatches(now)
+		dropped += n
+		if err != nil {
+			return dropped, err
+		}
+	}
+
+	return dropped, nil
+}
+
+// MergeBatches merges runs of small record batches of all topics instantiated
+// by the broker into larger record batches of at most maxRecords records and
+// maxBytes bytes. It returns the number of record batches that were merged
+// into others.
+func (s *Broker) MergeBatches(maxRecords int, maxBytes int) (int, error) {
+	// record batches are merged by the broker writing to the topics.
+	if s.readReplica {
+		return 0, nil
+	}
+
+	s.writeFence.RLock()
+	defer s.writeFence.RUnlock()
+
+	merged := 0
+	for _, tb := range s.madeTopicBatchers() {
+		n, err := tb.topic.MergeBatches(maxRecords, maxBytes)
+		merged += n
+		if err != nil {
+			return merged, err
+		}
+	}
+
+	return merged, nil
+}
+
+// SetMaintenanceMode enables or disables maintenance mode. While maintenance
+// mode is enabled, writes to all topics are rejected with
+// seberr.ErrWritesFrozen. Reads are unaffected.
+func (s *Broker) SetMaintenanceMode(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.log.Infof("setting maintenance mode: %t", enabled)
+	s.maintenanceMode = enabled
+}
+
+// MaintenanceMode returns whether maintenance mode is enabled.
+func (s *Broker) MaintenanceMode() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.maintenanceMode
+}
+
+// SetTopicWritesFrozen freezes or unfreezes writes to topicName. While a topic
+// is frozen, writes to it are rejected with seberr.ErrWritesFrozen. Reads are
+// unaffected.
+func (s *Broker) SetTopicWritesFrozen(topicName string, frozen bool) {
+	topicName = s.resolveTopicName(topicName)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.log.WithField("topic-name", topicName).Infof("setting topic writes frozen: %t", frozen)
+	if frozen {
+		s.frozenTopics[topicName] = struct{}{}
+	} else {
+		delete(s.frozenTopics, topicName)
+	}
+}
+
+// WritesFrozen returns whether writes to topicName are currently rejected,
+// either because maintenance mode is enabled, because the topic is frozen or
+// because the broker is a read replica.
+func (s *Broker) WritesFrozen(topicName string) bool {
+	topicName = s.resolveTopicName(topicName)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, topicFrozen := s.frozenTopics[topicName]
+	return s.readReplica || s.maintenanceMode || topicFrozen
+}
+
+// errReadReplica is returned when attempting to change topics of a read
+// replica. See WithReadReplica.
+var errReadReplica = fmt.Errorf("%w: broker is a read replica", seberr.ErrWritesFrozen)
+
 // makeTopicBatcher initializes a new topicBatcher, but does not put it into
 // s.topicBatchers.
+//
+// NOTE: this could block for a long time, e.g. while listing record batches in
+// S3, so it must not be called while holding s.mu.
 func (s *Broker) makeTopicBatcher(topicName string) (topicBatcher, error) {
-	// NOTE: this could block for a long time. We're holding the lock, so
-	// this is terrible.
 	topicLogger := s.log.Name(fmt.Sprintf("topic storage (%s)", topicName))
 	topic, err := s.topicFactory(topicLogger, topicName)
 	if err != nil {
@@ -211,28 +868,73 @@ func (s *Broker) makeTopicBatcher(topicName string) (topicBatcher, error) {
 	return tb, nil
 }
 
+// getTopicBatcher returns the topicBatcher of topicName, or of the topic that
+// it's an alias of.
 func (s *Broker) getTopicBatcher(topicName string) (topicBatcher, error) {
-	var err error
-	// log := s.log.WithField("topicName", topicName)
+	topicName = s.resolveTopicName(topicName)
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	tb, ok := s.topicBatchers[topicName]
-	if !ok {
-		// log.Debugf("creating new topic batcher")
-		if !s.autoCreateTopics {
-			return topicBatcher{}, fmt.Errorf("%w: '%s'", seberr.ErrTopicNotFound, topicName)
+	v, ok := s.topicBatchers.Load(topicName)
+	if ok {
+		entry := v.(*topicEntry)
+		<-entry.ready
+		if entry.err == nil {
+			return entry.tb, nil
 		}
+	}
 
-		tb, err = s.makeTopicBatcher(topicName)
-		if err != nil {
-			return topicBatcher{}, err
-		}
-		s.topicBatchers[topicName] = tb
+	// read replicas open topics written by other brokers on demand, without
+	// writing anything to storage.
+	if !s.autoCreateTopics && !s.readReplica {
+		return topicBatcher{}, fmt.Errorf("%w: '%s'", seberr.ErrTopicNotFound, topicName)
 	}
 
-	return tb, nil
+	tb, made, err := s.loadOrMakeTopicBatcher(topicName)
+	if made && err == nil {
+		s.watchers.created(topicName, tb.topic.NextOffset())
+	}
+	return tb, err
+}
+
+// loadOrMakeTopicBatcher returns the topicBatcher of topicName, making it if it
+// hasn't already been made. made reports whether it was made by this call.
+// Callers that want the topicBatcher of a topic that is being made wait for it,
+// while callers of other topics are unaffected.
+func (s *Broker) loadOrMakeTopicBatcher(topicName string) (tb topicBatcher, made bool, err error) {
+	entry := &topicEntry{ready: make(chan struct{})}
+	v, loaded := s.topicBatchers.LoadOrStore(topicName, entry)
+	if loaded {
+		entry = v.(*topicEntry)
+		<-entry.ready
+		return entry.tb, false, entry.err
+	}
+
+	entry.tb, entry.err = s.makeTopicBatcher(topicName)
+	if entry.err != nil {
+		// allow following calls to retry
+		s.topicBatchers.CompareAndDelete(topicName, entry)
+	}
+	close(entry.ready)
+
+	return entry.tb, true, entry.err
+}
+
+// madeTopicBatchers returns the topicBatchers that have been made, by topic
+// name. Topics that are still being made are left out.
+func (s *Broker) madeTopicBatchers() map[string]topicBatcher {
+	topicBatchers := make(map[string]topicBatcher)
+	s.topicBatchers.Range(func(key, value any) bool {
+		entry := value.(*topicEntry)
+		select {
+		case <-entry.ready:
+			if entry.err == nil {
+				topicBatchers[key.(string)] = entry.tb
+			}
+		default:
+		}
+		return true
+	})
+
+	return topicBatchers
 }
 
 // WithAutoCreateTopic sets whether to automatically create topics if they don't
@@ -262,7 +964,102 @@ func WithNullBatcher() func(*Opts) {
 
 func WithOpts(opts Opts) func(*Opts) {
 	return func(o *Opts) {
-		o.AutoCreateTopic = opts.AutoCreateTopic
-		o.BatcherFactory = opts.BatcherFactory
+		*o = opts
+	}
+}
+
+// WithDefaultMaxRecords sets the maximum number of records returned by
+// GetRecords when maxRecords is 0.
+func WithDefaultMaxRecords(maxRecords int) func(*Opts) {
+	return func(o *Opts) {
+		o.DefaultMaxRecords = maxRecords
+	}
+}
+
+// WithMaxRecords sets the maximum number of records returned by a single call
+// to GetRecords. 0 means unlimited.
+func WithMaxRecords(maxRecords int) func(*Opts) {
+	return func(o *Opts) {
+		o.MaxRecords = maxRecords
+	}
+}
+
+// WithMaxFetchBytesInFlight sets the maximum number of bytes being read by all
+// concurrent calls to GetRecords. 0 means unlimited.
+func WithMaxFetchBytesInFlight(maxBytes int) func(*Opts) {
+	return func(o *Opts) {
+		o.MaxFetchBytesInFlight = maxBytes
+	}
+}
+
+// WithGroupOffsetStore sets the GroupOffsetStore that the offsets committed by
+// consumer groups are persisted in. See CommitGroupOffset and
+// LoadGroupOffsets.
+func WithGroupOffsetStore(groupStore GroupOffsetStore) func(*Opts) {
+	return func(o *Opts) {
+		o.GroupOffsetStore = groupStore
+	}
+}
+
+// WithGroupMaxIdle sets the amount of time after which consumer groups that
+// haven't been active are stale. 0 means groups never become stale.
+func WithGroupMaxIdle(maxIdle time.Duration) func(*Opts) {
+	return func(o *Opts) {
+		o.GroupMaxIdle = maxIdle
+	}
+}
+
+// WithGroupAssignor sets the name of the assignor used to assign topics to
+// the members of consumer groups that don't choose one. See AssignorNames.
+func WithGroupAssignor(assignorName string) func(*Opts) {
+	return func(o *Opts) {
+		o.GroupAssignor = assignorName
+	}
+}
+
+// WithGroupSessionTimeout sets the session timeout of members of consumer
+// groups that join without one.
+func WithGroupSessionTimeout(sessionTimeout time.Duration) func(*Opts) {
+	return func(o *Opts) {
+		o.GroupSessionTimeout = sessionTimeout
+	}
+}
+
+// WithDedupWindow makes the broker deduplicate record batches that are
+// identical to a batch added to the same topic within window, e.g. because a
+// producer retried a request whose response was lost. The records of
+// duplicate batches aren't added again; the offsets of the original batch are
+// returned instead. See AddResult.Duplicate.
+//
+// Batches are identified by a hash of their records, expiry times, keys and
+// headers, which is kept in memory for window. Producers that deliberately
+// add identical batches within window must not use it.
+func WithDedupWindow(window time.Duration) func(*Opts) {
+	return func(o *Opts) {
+		o.DedupWindow = window
+	}
+}
+
+// WithReadReplica makes the broker a read replica of topics written by another
+// broker sharing its storage. Topics are opened on demand, and writes to them
+// are rejected with seberr.ErrWritesFrozen, as are changes to topic aliases.
+// Record batches are neither dropped nor merged, since that's left to the
+// writing broker. Offsets committed by consumer groups are loaded from the
+// broker's GroupOffsetStore, but are only kept in memory.
+//
+// The topics of read replicas must be opened using sebtopic.WithReadOnly, and
+// must be refreshed to pick up records added after they were opened. See
+// ReplicaLoop.
+func WithReadReplica(readReplica bool) func(*Opts) {
+	return func(o *Opts) {
+		o.ReadReplica = readReplica
+	}
+}
+
+// WithAliasStore sets the AliasStore that topic aliases are persisted in. See
+// SetTopicAlias and LoadTopicAliases.
+func WithAliasStore(aliasStore AliasStore) func(*Opts) {
+	return func(o *Opts) {
+		o.AliasStore = aliasStore
 	}
 }
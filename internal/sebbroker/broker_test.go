@@ -1,7 +1,10 @@
 package sebbroker_test
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"io"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -10,7 +13,6 @@ import (
 	"github.com/micvbang/go-helpy/inty"
 	"github.com/micvbang/go-helpy/sizey"
 	"github.com/micvbang/go-helpy/slicey"
-	"github.com/micvbang/go-helpy/timey"
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
 	"github.com/micvbang/simple-event-broker/internal/sebbroker"
@@ -190,6 +192,53 @@ func TestGetRecordsOffsetOutOfBounds(t *testing.T) {
 	})
 }
 
+// TestGetRecordsNonBlocking verifies that GetRecordsNonBlocking returns
+// records and the offset to read next, and that it immediately returns
+// seberr.ErrOffsetOutOfBounds together with the topic's next offset when
+// reading an offset that does not yet exist.
+func TestGetRecordsNonBlocking(t *testing.T) {
+	const autoCreateTopic = true
+	tester.TestBroker(t, autoCreateTopic, func(t *testing.T, s *sebbroker.Broker) {
+		const topicName = "topic-name"
+		ctx := context.Background()
+
+		batch := tester.NewBatch(10, 1024)
+		nextOffset, err := s.GetRecordsNonBlocking(ctx, &batch, topicName, 0, 10, 1024)
+		require.ErrorIs(t, err, seberr.ErrOffsetOutOfBounds)
+		require.Equal(t, uint64(0), nextOffset)
+
+		expectedBatch := tester.MakeRandomRecordBatch(3)
+		_, err = s.AddRecords(topicName, expectedBatch)
+		require.NoError(t, err)
+
+		tests := map[string]struct {
+			offset     uint64
+			nextOffset uint64
+			expected   [][]byte
+			err        error
+		}{
+			"from start":       {offset: 0, nextOffset: 3, expected: expectedBatch.IndividualRecords()},
+			"from middle":      {offset: 1, nextOffset: 3, expected: expectedBatch.IndividualRecords()[1:]},
+			"next offset":      {offset: 3, nextOffset: 3, err: seberr.ErrOffsetOutOfBounds},
+			"past next offset": {offset: 10, nextOffset: 3, err: seberr.ErrOffsetOutOfBounds},
+		}
+
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				batch := tester.NewBatch(10, 1024)
+
+				// Act
+				nextOffset, err := s.GetRecordsNonBlocking(ctx, &batch, topicName, test.offset, 10, 1024)
+
+				// Assert
+				require.ErrorIs(t, err, test.err)
+				require.Equal(t, test.nextOffset, nextOffset)
+				require.Equal(t, test.expected, batch.IndividualRecords())
+			})
+		}
+	})
+}
+
 // TestGetRecordsBulkContextImmediatelyCancelled verifies that GetRecords
 // respects that the given context has been called.
 func TestGetRecordsBulkContextImmediatelyCancelled(t *testing.T) {
@@ -224,7 +273,7 @@ func TestCreateTopicHappyPath(t *testing.T) {
 
 		batch := tester.NewBatch(10, 1024)
 
-		_, err := s.GetRecord(&batch, topicName, 0)
+		_, err := s.GetRecord(context.Background(), &batch, topicName, 0)
 		require.ErrorIs(t, err, seberr.ErrTopicNotFound)
 
 		_, err = s.AddRecords(topicName, tester.MakeRandomRecordBatch(1))
@@ -235,7 +284,7 @@ func TestCreateTopicHappyPath(t *testing.T) {
 		require.NoError(t, err)
 
 		// Assert
-		_, err = s.GetRecord(&batch, topicName, 0)
+		_, err = s.GetRecord(context.Background(), &batch, topicName, 0)
 		require.ErrorIs(t, err, seberr.ErrOutOfBounds)
 
 		_, err = s.AddRecords(topicName, tester.MakeRandomRecordBatch(1))
@@ -243,7 +292,7 @@ func TestCreateTopicHappyPath(t *testing.T) {
 
 		// ensure that GetRecord does not block waiting for record to become
 		// available
-		_, err = s.GetRecord(&batch, topicName, 2)
+		_, err = s.GetRecord(context.Background(), &batch, topicName, 2)
 		require.ErrorIs(t, err, seberr.ErrOutOfBounds)
 	})
 }
@@ -321,15 +370,17 @@ func TestBrokerMetadataHappyPath(t *testing.T) {
 		const topicName = "topic-name"
 
 		for numRecords := 1; numRecords <= 10; numRecords++ {
+			// NOTE: commit times have microsecond precision.
+			t0 := time.Now().Truncate(time.Microsecond)
 			_, err := s.AddRecords(topicName, tester.MakeRandomRecordBatch(1))
 			require.NoError(t, err)
+			t1 := time.Now()
 
 			gotMetadata, err := s.Metadata(topicName)
 			require.NoError(t, err)
-			t0 := time.Now()
 
 			require.Equal(t, uint64(numRecords), gotMetadata.NextOffset)
-			require.True(t, timey.DiffEqual(5*time.Millisecond, t0, gotMetadata.LatestCommitAt))
+			require.WithinRange(t, gotMetadata.LatestCommitAt, t0, t1)
 		}
 	})
 }
@@ -382,6 +433,198 @@ func TestAddRecordsHappyPath(t *testing.T) {
 	})
 }
 
+// TestBrokerMaintenanceMode verifies that AddRecords returns
+// seberr.ErrWritesFrozen for all topics while maintenance mode is enabled, that
+// reads are still allowed, and that writes are accepted once maintenance mode
+// is disabled again.
+func TestBrokerMaintenanceMode(t *testing.T) {
+	const autoCreate = true
+	tester.TestBroker(t, autoCreate, func(t *testing.T, s *sebbroker.Broker) {
+		const topicName = "topic"
+		expectedBatch := tester.MakeRandomRecordBatch(5)
+
+		_, err := s.AddRecords(topicName, expectedBatch)
+		require.NoError(t, err)
+
+		// Act
+		s.SetMaintenanceMode(true)
+
+		// Assert
+		require.True(t, s.MaintenanceMode())
+		for _, topicName := range []string{topicName, "other-topic"} {
+			_, err = s.AddRecords(topicName, tester.MakeRandomRecordBatch(1))
+			require.ErrorIs(t, err, seberr.ErrWritesFrozen)
+		}
+
+		batch := tester.NewBatch(10, 4096)
+		err = s.GetRecords(context.Background(), &batch, topicName, 0, 10, 0)
+		require.NoError(t, err)
+		require.Equal(t, expectedBatch.IndividualRecords(), batch.IndividualRecords())
+
+		// Act
+		s.SetMaintenanceMode(false)
+
+		// Assert
+		require.False(t, s.MaintenanceMode())
+		_, err = s.AddRecords(topicName, tester.MakeRandomRecordBatch(1))
+		require.NoError(t, err)
+	})
+}
+
+// TestBrokerTopicWritesFrozen verifies that AddRecords returns
+// seberr.ErrWritesFrozen only for the topic that is frozen, and that writes are
+// accepted once the topic is unfrozen.
+func TestBrokerTopicWritesFrozen(t *testing.T) {
+	const autoCreate = true
+	tester.TestBroker(t, autoCreate, func(t *testing.T, s *sebbroker.Broker) {
+		const (
+			frozenTopic   = "frozen"
+			unfrozenTopic = "unfrozen"
+		)
+
+		// Act
+		s.SetTopicWritesFrozen(frozenTopic, true)
+
+		// Assert
+		require.True(t, s.WritesFrozen(frozenTopic))
+		require.False(t, s.WritesFrozen(unfrozenTopic))
+
+		_, err := s.AddRecords(frozenTopic, tester.MakeRandomRecordBatch(1))
+		require.ErrorIs(t, err, seberr.ErrWritesFrozen)
+
+		_, err = s.AddRecords(unfrozenTopic, tester.MakeRandomRecordBatch(1))
+		require.NoError(t, err)
+
+		// Act
+		s.SetTopicWritesFrozen(frozenTopic, false)
+
+		// Assert
+		require.False(t, s.WritesFrozen(frozenTopic))
+		_, err = s.AddRecords(frozenTopic, tester.MakeRandomRecordBatch(1))
+		require.NoError(t, err)
+	})
+}
+
+// TestGetRecordsSkipsExpired verifies that GetRecords() skips expired records,
+// and that it waits for new records to be added if all of the available
+// records have expired.
+func TestGetRecordsSkipsExpired(t *testing.T) {
+	const autoCreate = true
+	tester.TestBroker(t, autoCreate, func(t *testing.T, s *sebbroker.Broker) {
+		const topicName = "topic"
+		expired := time.Now().Add(-time.Hour).UnixMicro()
+
+		expiredBatch := tester.MakeRandomRecordBatch(3)
+		expiredBatch.Expires = []int64{expired, expired, expired}
+		_, err := s.AddRecords(topicName, expiredBatch)
+		require.NoError(t, err)
+
+		expectedBatch := tester.MakeRandomRecordBatch(2)
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			_, err := s.AddRecords(topicName, expectedBatch)
+			require.NoError(t, err)
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		batch := tester.NewBatch(10, 4096)
+
+		// Act
+		err = s.GetRecords(ctx, &batch, topicName, 0, 10, 0)
+		require.NoError(t, err)
+
+		// Assert
+		require.Equal(t, expectedBatch.IndividualRecords(), batch.IndividualRecords())
+		require.Equal(t, expiredBatch.Len(), batch.Skipped)
+	})
+}
+
+// TestAddRecordsExpiresLengthMismatch verifies that AddRecords() returns
+// seberr.ErrBadInput when the number of expiry times does not match the number
+// of records.
+func TestAddRecordsExpiresLengthMismatch(t *testing.T) {
+	const autoCreate = true
+	tester.TestBroker(t, autoCreate, func(t *testing.T, s *sebbroker.Broker) {
+		batch := tester.MakeRandomRecordBatch(3)
+		batch.Expires = []int64{1}
+
+		// Act
+		_, err := s.AddRecords("topic", batch)
+
+		// Assert
+		require.ErrorIs(t, err, seberr.ErrBadInput)
+	})
+}
+
+// TestBrokerDropExpiredBatches verifies that DropExpiredBatches() drops expired
+// record batches from all topics.
+func TestBrokerDropExpiredBatches(t *testing.T) {
+	const autoCreate = true
+	tester.TestBroker(t, autoCreate, func(t *testing.T, s *sebbroker.Broker) {
+		expired := time.Now().Add(-time.Hour).UnixMicro()
+
+		topicNames := []string{"topic1", "topic2"}
+		for _, topicName := range topicNames {
+			batch := tester.MakeRandomRecordBatch(2)
+			batch.Expires = []int64{expired, expired}
+			_, err := s.AddRecords(topicName, batch)
+			require.NoError(t, err)
+
+			_, err = s.AddRecords(topicName, tester.MakeRandomRecordBatch(1))
+			require.NoError(t, err)
+		}
+
+		// Act
+		dropped, err := s.DropExpiredBatches(time.Now())
+		require.NoError(t, err)
+
+		// Assert
+		require.Equal(t, len(topicNames), dropped)
+		for _, topicName := range topicNames {
+			segments, err := s.Segments(topicName)
+			require.NoError(t, err)
+			require.Equal(t, 1, len(segments))
+		}
+	})
+}
+
+// TestBrokerMergeBatches verifies that MergeBatches() merges small record
+// batches of all topics, keeping their records readable.
+func TestBrokerMergeBatches(t *testing.T) {
+	const autoCreate = true
+	tester.TestBroker(t, autoCreate, func(t *testing.T, s *sebbroker.Broker) {
+		topicNames := []string{"topic1", "topic2"}
+		expectedRecords := map[string][][]byte{}
+		for _, topicName := range topicNames {
+			for range 4 {
+				batch := tester.MakeRandomRecordBatch(1)
+				_, err := s.AddRecords(topicName, batch)
+				require.NoError(t, err)
+				expectedRecords[topicName] = append(expectedRecords[topicName], batch.IndividualRecords()...)
+			}
+		}
+
+		// Act
+		merged, err := s.MergeBatches(10, sizey.MB)
+		require.NoError(t, err)
+
+		// Assert
+		require.Equal(t, 2*len(topicNames), merged)
+		for _, topicName := range topicNames {
+			segments, err := s.Segments(topicName)
+			require.NoError(t, err)
+			require.Equal(t, 2, len(segments))
+
+			gotBatch := tester.NewBatch(4, 4096)
+			err = s.GetRecords(context.Background(), &gotBatch, topicName, 0, 4, 0)
+			require.NoError(t, err)
+			require.Equal(t, expectedRecords[topicName], gotBatch.IndividualRecords())
+		}
+	})
+}
+
 // TestBrokerConcurrency exercises thread safety when doing reads and writes
 // concurrently.
 func TestBrokerConcurrency(t *testing.T) {
@@ -453,9 +696,14 @@ func TestBrokerConcurrency(t *testing.T) {
 			}()
 		}
 
+		verifiersWg := sync.WaitGroup{}
+		verifiersWg.Add(verifiers)
+
 		// concurrently verify the records that were written
 		for range verifiers {
 			go func() {
+				defer verifiersWg.Done()
+
 				for verification := range verifications {
 					batch := tester.NewBatch(256, 4096)
 
@@ -484,7 +732,393 @@ func TestBrokerConcurrency(t *testing.T) {
 		close(stopWrites)
 		wg.Wait()
 
-		// stop verifiers once they've verified all writes
+		// stop verifiers once they've verified all writes, and wait for them
+		// to return. NOTE: the storage may be closed once the test returns,
+		// e.g. unmapping its files.
 		close(verifications)
+		verifiersWg.Wait()
+	})
+}
+
+// TestBrokerDeleteTopic verifies that DeleteTopic() deletes the topic's records
+// from storage, such that a new broker using the same storage does not see
+// them, and that TopicNames() no longer returns the topic.
+func TestBrokerDeleteTopic(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, bs sebtopic.Storage, cache *sebcache.Cache) {
+		const topicName = "topic-name"
+
+		topicFactory := func(log logger.Logger, topicName string) (*sebtopic.Topic, error) {
+			return sebtopic.New(log, bs, topicName, cache)
+		}
+
+		s1 := sebbroker.New(log, topicFactory, sebbroker.WithNullBatcher())
+		for range 3 {
+			_, err := s1.AddRecords(topicName, tester.MakeRandomRecordBatch(5))
+			require.NoError(t, err)
+		}
+		require.Equal(t, []string{topicName}, s1.TopicNames())
+
+		// Act
+		err := s1.DeleteTopic(topicName)
+		require.NoError(t, err)
+
+		// Assert
+		require.Empty(t, s1.TopicNames())
+
+		s2 := sebbroker.New(log, topicFactory, sebbroker.WithNullBatcher(), sebbroker.WithAutoCreateTopic(false))
+		err = s2.CreateTopic(topicName)
+		require.NoError(t, err)
+
+		batch := tester.NewBatch(1, 1024)
+		_, err = s2.GetRecord(context.Background(), &batch, topicName, 0)
+		require.ErrorIs(t, err, seberr.ErrOutOfBounds)
+	})
+}
+
+// TestBrokerDeleteTopicNotFound verifies that DeleteTopic() returns
+// ErrTopicNotFound when the topic does not exist.
+func TestBrokerDeleteTopicNotFound(t *testing.T) {
+	tester.TestBroker(t, false, func(t *testing.T, s *sebbroker.Broker) {
+		// Act
+		err := s.DeleteTopic("does-not-exist")
+
+		// Assert
+		require.ErrorIs(t, err, seberr.ErrTopicNotFound)
+	})
+}
+
+// TestBrokerSlowTopicFactory verifies that a topic whose TopicFactory call is
+// slow does not block adding records to other topics.
+func TestBrokerSlowTopicFactory(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, ts sebtopic.Storage, cache *sebcache.Cache) {
+		const slowTopicName = "slow-topic"
+		topicFactory := sebbroker.NewTopicFactory(ts, cache)
+
+		unblock := make(chan struct{})
+		s := sebbroker.New(log,
+			func(log logger.Logger, topicName string) (*sebtopic.Topic, error) {
+				if topicName == slowTopicName {
+					<-unblock
+				}
+				return topicFactory(log, topicName)
+			},
+			sebbroker.WithNullBatcher(),
+		)
+
+		slowErr := make(chan error)
+		go func() {
+			_, err := s.AddRecords(slowTopicName, tester.MakeRandomRecordBatch(1))
+			slowErr <- err
+		}()
+
+		// Act
+		_, err := s.AddRecords("other-topic", tester.MakeRandomRecordBatch(1))
+
+		// Assert
+		require.NoError(t, err)
+		require.Equal(t, []string{"other-topic"}, s.TopicNames())
+
+		close(unblock)
+		require.NoError(t, <-slowErr)
+		require.Equal(t, []string{"other-topic", slowTopicName}, s.TopicNames())
+	})
+}
+
+// TestBrokerTopicFactoryCalledOnce verifies that TopicFactory is called only
+// once per topic, also when the topic is used concurrently before it exists.
+func TestBrokerTopicFactoryCalledOnce(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, ts sebtopic.Storage, cache *sebcache.Cache) {
+		const topicName = "topic-name"
+		topicFactory := sebbroker.NewTopicFactory(ts, cache)
+
+		calls := atomic.Int32{}
+		s := sebbroker.New(log,
+			func(log logger.Logger, topicName string) (*sebtopic.Topic, error) {
+				calls.Add(1)
+				time.Sleep(10 * time.Millisecond)
+				return topicFactory(log, topicName)
+			},
+			sebbroker.WithNullBatcher(),
+		)
+
+		const numWorkers = 10
+		wg := sync.WaitGroup{}
+		wg.Add(numWorkers)
+
+		// Act
+		for range numWorkers {
+			go func() {
+				defer wg.Done()
+				_, err := s.AddRecords(topicName, tester.MakeRandomRecordBatch(1))
+				require.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+
+		// Assert
+		require.Equal(t, int32(1), calls.Load())
+
+		metadata, err := s.Metadata(topicName)
+		require.NoError(t, err)
+		require.Equal(t, uint64(numWorkers), metadata.NextOffset)
+	})
+}
+
+// TestGetRecordsDefaultAndMaxRecords verifies that GetRecords returns the
+// configured default number of records when maxRecords is 0, and at most the
+// configured maximum number of records.
+func TestGetRecordsDefaultAndMaxRecords(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, ts sebtopic.Storage, cache *sebcache.Cache) {
+		const topicName = "topic-name"
+		s := sebbroker.New(log,
+			sebbroker.NewTopicFactory(ts, cache),
+			sebbroker.WithNullBatcher(),
+			sebbroker.WithDefaultMaxRecords(3),
+			sebbroker.WithMaxRecords(5),
+		)
+
+		batch := tester.MakeRandomRecordBatch(10)
+		records := batch.IndividualRecords()
+		_, err := s.AddRecords(topicName, batch)
+		require.NoError(t, err)
+
+		tests := map[string]struct {
+			maxRecords int
+			expected   [][]byte
+		}{
+			"default":       {maxRecords: 0, expected: records[:3]},
+			"below maximum": {maxRecords: 4, expected: records[:4]},
+			"above maximum": {maxRecords: 8, expected: records[:5]},
+		}
+
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				gotBatch := tester.NewBatch(10, 4096)
+
+				// Act
+				err := s.GetRecords(context.Background(), &gotBatch, topicName, 0, test.maxRecords, 0)
+
+				// Assert
+				require.NoError(t, err)
+				require.Equal(t, test.expected, gotBatch.IndividualRecords())
+			})
+		}
+	})
+}
+
+// TestGetRecordsMaxFetchBytesInFlight verifies that concurrent calls to
+// GetRecords wait for each other while their bytes exceed the configured
+// maximum number of bytes in flight.
+func TestGetRecordsMaxFetchBytesInFlight(t *testing.T) {
+	const topicName = "topic-name"
+	memoryStorage := sebtopic.NewMemoryStorage(log)
+
+	topic, err := sebtopic.New(log, memoryStorage, topicName, newCache(t))
+	require.NoError(t, err)
+
+	batch := tester.MakeRandomRecordBatch(2)
+	_, err = topic.AddRecords(batch)
+	require.NoError(t, err)
+
+	// NOTE: the newest record batch is read when the topic is opened
+	_, err = topic.AddRecords(tester.MakeRandomRecordBatch(1))
+	require.NoError(t, err)
+
+	storage := &blockingReaderStorage{
+		Storage: memoryStorage,
+		key:     sebtopic.RecordBatchKey(topicName, 0),
+		reading: make(chan struct{}, 2),
+		unblock: make(chan struct{}),
+	}
+	s := sebbroker.New(log,
+		sebbroker.NewTopicFactory(storage, newCache(t)),
+		sebbroker.WithNullBatcher(),
+		sebbroker.WithMaxFetchBytesInFlight(1024),
+	)
+
+	getRecords := func() <-chan error {
+		errs := make(chan error, 1)
+		go func() {
+			gotBatch := tester.NewBatch(2, 1024)
+			err := s.GetRecords(context.Background(), &gotBatch, topicName, 0, 2, 0)
+			if err == nil && len(gotBatch.IndividualRecords()) != 2 {
+				err = fmt.Errorf("expected 2 records, got %d", len(gotBatch.IndividualRecords()))
+			}
+			errs <- err
+		}()
+		return errs
+	}
+
+	first := getRecords()
+	<-storage.reading
+
+	// Act
+	second := getRecords()
+
+	// Assert
+	select {
+	case <-storage.reading:
+		t.Fatalf("expected second GetRecords to wait for the first")
+	case err := <-second:
+		t.Fatalf("expected second GetRecords to wait for the first, returned %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(storage.unblock)
+	require.NoError(t, <-first)
+	require.NoError(t, <-second)
+}
+
+// blockingReaderStorage blocks calls to Reader() for key until unblock is
+// closed, sending on reading when they're made.
+type blockingReaderStorage struct {
+	sebtopic.Storage
+	key     string
+	reading chan struct{}
+	unblock chan struct{}
+}
+
+func (s *blockingReaderStorage) Reader(ctx context.Context, key string) (io.ReadCloser, error) {
+	if key == s.key {
+		s.reading <- struct{}{}
+		<-s.unblock
+	}
+	return s.Storage.Reader(ctx, key)
+}
+
+func newCache(t *testing.T) *sebcache.Cache {
+	cache, err := sebcache.New(log, sebcache.NewMemoryStorage(log))
+	require.NoError(t, err)
+	return cache
+}
+
+// TestGetRecordsWriter verifies that GetRecordsWriter() waits for records to
+// be added, skipping expired records like GetRecords(), and that it returns no
+// more bytes than fit in batch.Data.
+func TestGetRecordsWriter(t *testing.T) {
+	const autoCreate = true
+	tester.TestBroker(t, autoCreate, func(t *testing.T, s *sebbroker.Broker) {
+		const topicName = "topic"
+		expired := time.Now().Add(-time.Hour).UnixMicro()
+
+		expiredBatch := tester.MakeRandomRecordBatchSize(2, 64)
+		expiredBatch.Expires = []int64{expired, expired}
+		_, err := s.AddRecords(topicName, expiredBatch)
+		require.NoError(t, err)
+
+		expectedBatch := tester.MakeRandomRecordBatchSize(4, 64)
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			_, err := s.AddRecords(topicName, expectedBatch)
+			require.NoError(t, err)
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		// NOTE: batch.Data only has room for two of the records
+		batch := tester.NewBatch(10, 128)
+
+		// Act
+		rw, err := s.GetRecordsWriter(ctx, &batch, topicName, 0, 10, 0)
+		require.NoError(t, err)
+
+		// Assert
+		buf := bytes.NewBuffer(nil)
+		_, err = rw.WriteTo(buf)
+		require.NoError(t, err)
+
+		require.Equal(t, expectedBatch.Sizes[:2], batch.Sizes)
+		require.Equal(t, expectedBatch.Data[:128], buf.Bytes())
+		require.Empty(t, batch.Data)
+		require.Equal(t, expiredBatch.Len(), batch.Skipped)
+	})
+}
+
+// TestAddRecordsResult verifies that AddRecordsResult() returns the key of the
+// record batch that records were committed in, and that records added to the
+// same batch are given the same batch.
+func TestAddRecordsResult(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, ts sebtopic.Storage, cache *sebcache.Cache) {
+		const topicName = "topic-name"
+		ctx := context.Background()
+
+		const blockTime = 100 * time.Millisecond
+		broker := sebbroker.New(log,
+			sebbroker.NewTopicFactory(ts, cache),
+			sebbroker.WithBatcherFactory(sebbroker.NewBlockingBatcherFactory(blockTime, sizey.MB)),
+		)
+
+		_, err := broker.AddRecords(topicName, tester.MakeRandomRecordBatch(3))
+		require.NoError(t, err)
+
+		results := make([]sebbroker.AddResult, 2)
+		wg := sync.WaitGroup{}
+		for i := range results {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				// Act
+				var err error
+				results[i], err = broker.AddRecordsResult(ctx, topicName, tester.MakeRandomRecordBatch(2))
+				require.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+
+		// Assert
+		for _, result := range results {
+			require.True(t, result.HasBatch)
+			require.Equal(t, uint64(3), result.BatchID)
+			require.Equal(t, sebtopic.RecordBatchKey(topicName, 3), result.BatchKey)
+			require.Less(t, time.Duration(0), result.BatchWait)
+			require.LessOrEqual(t, result.BatchWait, result.CommitLatency)
+		}
+		require.ElementsMatch(t, []uint64{3, 4, 5, 6}, append(results[0].Offsets, results[1].Offsets...))
+
+		rdr, err := ts.Reader(ctx, results[0].BatchKey)
+		require.NoError(t, err)
+		rdr.Close()
+	})
+}
+
+// TestBrokerShutdown verifies that Shutdown makes GetRecords calls that are
+// waiting for records return context.Canceled, that later calls don't wait,
+// and that records can still be added and read.
+func TestBrokerShutdown(t *testing.T) {
+	const autoCreateTopic = true
+	tester.TestBroker(t, autoCreateTopic, func(t *testing.T, s *sebbroker.Broker) {
+		const topicName = "topic-name"
+
+		offsets, err := s.AddRecords(topicName, tester.MakeRandomRecordBatch(1))
+		require.NoError(t, err)
+		nextOffset := slicey.Last(offsets) + 1
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		errs := make(chan error)
+		go func() {
+			batch := tester.NewBatch(10, 1024)
+			errs <- s.GetRecords(ctx, &batch, topicName, nextOffset, 10, 1024)
+		}()
+
+		// Act
+		s.Shutdown()
+
+		// Assert
+		require.ErrorIs(t, <-errs, context.Canceled)
+
+		batch := tester.NewBatch(10, 1024)
+		err = s.GetRecords(ctx, &batch, topicName, nextOffset, 10, 1024)
+		require.ErrorIs(t, err, context.Canceled)
+
+		_, err = s.AddRecords(topicName, tester.MakeRandomRecordBatch(1))
+		require.NoError(t, err)
+
+		err = s.GetRecords(ctx, &batch, topicName, nextOffset, 10, 1024)
+		require.NoError(t, err)
+		require.Equal(t, 1, batch.Len())
 	})
 }
@@ -0,0 +1,335 @@
+package sebbroker
+
+import (
+	"cmp"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// GroupAssignment is the topics assigned to a member of a consumer group in
+// the group's current generation.
+type GroupAssignment struct {
+	MemberID string
+
+	// Generation is incremented every time the group is rebalanced, i.e. when
+	// members join or leave the group. Members must stop consuming topics
+	// that are no longer assigned to them when it changes.
+	Generation uint64
+
+	TopicNames []string
+
+	// PausedTopicNames is the topics of TopicNames whose delivery to the
+	// group is paused. See PauseGroup.
+	PausedTopicNames []string
+
+	// Assignor is the name of the assignor used by the group.
+	Assignor string
+}
+
+// groupCoordinator keeps track of the members of consumer groups and assigns
+// topics to them. Members stay in a group for as long as they send
+// heartbeats within their session timeout.
+//
+// Memberships are only kept in memory; members rejoin their groups if the
+// broker is restarted.
+type groupCoordinator struct {
+	assignorName          string
+	defaultSessionTimeout time.Duration
+
+	mu     sync.Mutex
+	groups map[string]*groupMembers
+}
+
+type groupMembers struct {
+	assignorName string
+	assignor     Assignor
+
+	generation uint64
+	members    map[string]*groupMemberSession
+	assignment map[string][]string
+}
+
+type groupMemberSession struct {
+	topicNames     []string
+	sessionTimeout time.Duration
+	heartbeatAt    time.Time
+}
+
+func newGroupCoordinator(assignorName string, defaultSessionTimeout time.Duration) *groupCoordinator {
+	return &groupCoordinator{
+		assignorName:          assignorName,
+		defaultSessionTimeout: defaultSessionTimeout,
+		groups:                map[string]*groupMembers{},
+	}
+}
+
+// JoinGroup makes memberID a member of group, consuming topicNames. If
+// memberID is empty a new member ID is generated. The member stays in the
+// group for as long as it calls GroupHeartbeat within sessionTimeout, which
+// defaults to the broker's GroupSessionTimeout if 0.
+//
+// The group's topics are assigned using the assignor named assignorName, one
+// of AssignorNames(), which defaults to the broker's GroupAssignor if empty.
+// It's chosen by the member that creates the group; seberr.ErrBadInput is
+// returned if other members ask for a different assignor.
+//
+// The group is rebalanced if the member is new or consumes other topics than
+// before, and the member's assignment in the group's new generation is
+// returned.
+func (s *Broker) JoinGroup(group string, memberID string, topicNames []string, sessionTimeout time.Duration, assignorName string) (GroupAssignment, error) {
+	if group == "" {
+		return GroupAssignment{}, fmt.Errorf("%w: group must be given", seberr.ErrBadInput)
+	}
+	if len(topicNames) == 0 {
+		return GroupAssignment{}, fmt.Errorf("%w: at least one topic must be given", seberr.ErrBadInput)
+	}
+	if sessionTimeout < 0 {
+		return GroupAssignment{}, fmt.Errorf("%w: session timeout must not be negative", seberr.ErrBadInput)
+	}
+
+	resolved := make([]string, 0, len(topicNames))
+	for _, topicName := range topicNames {
+		resolved = append(resolved, s.resolveTopicName(topicName))
+	}
+	slices.Sort(resolved)
+	topicNames = slices.Compact(resolved)
+
+	if memberID == "" {
+		var err error
+		memberID, err = newMemberID()
+		if err != nil {
+			return GroupAssignment{}, err
+		}
+	}
+
+	c := s.coordinator
+	if sessionTimeout == 0 {
+		sessionTimeout = c.defaultSessionTimeout
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	members, err := c.groupMembers(group, assignorName, now)
+	if err != nil {
+		return GroupAssignment{}, err
+	}
+	member, ok := members.members[memberID]
+	rebalance := !ok || !slices.Equal(member.topicNames, topicNames)
+	if !ok {
+		member = &groupMemberSession{}
+		members.members[memberID] = member
+	}
+	member.topicNames = topicNames
+	member.sessionTimeout = sessionTimeout
+	member.heartbeatAt = now
+
+	if rebalance {
+		s.log.Infof("member '%s' joined group '%s', rebalancing", memberID, group)
+		c.rebalance(members)
+	}
+
+	assignment := members.assignmentOf(memberID)
+	assignment.PausedTopicNames = s.pausedTopics(group, assignment.TopicNames)
+	return assignment, nil
+}
+
+// GroupHeartbeat keeps the session of memberID in group alive, and returns its
+// assignment in the group's current generation. seberr.ErrNotFound is
+// returned if memberID isn't a member of group, e.g. because its session has
+// timed out; it must then rejoin the group.
+func (s *Broker) GroupHeartbeat(group string, memberID string) (GroupAssignment, error) {
+	c := s.coordinator
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	member, members, err := c.member(group, memberID, now)
+	if err != nil {
+		return GroupAssignment{}, err
+	}
+	member.heartbeatAt = now
+
+	assignment := members.assignmentOf(memberID)
+	assignment.PausedTopicNames = s.pausedTopics(group, assignment.TopicNames)
+	return assignment, nil
+}
+
+// LeaveGroup removes memberID from group and rebalances the group.
+// seberr.ErrNotFound is returned if memberID isn't a member of group.
+func (s *Broker) LeaveGroup(group string, memberID string) error {
+	c := s.coordinator
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, members, err := c.member(group, memberID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	s.log.Infof("member '%s' left group '%s', rebalancing", memberID, group)
+	delete(members.members, memberID)
+	c.removeIfEmpty(group, members)
+	c.rebalance(members)
+
+	return nil
+}
+
+// GroupMembers returns the members of group, sorted by ID.
+func (s *Broker) GroupMembers(group string) []GroupMember {
+	c := s.coordinator
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	members, ok := c.groups[group]
+	if !ok {
+		return nil
+	}
+	c.expireSessions(group, members, time.Now())
+
+	return members.sortedMembers()
+}
+
+// hasMembers returns true if group has members whose sessions haven't timed
+// out.
+func (c *groupCoordinator) hasMembers(group string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	members, ok := c.groups[group]
+	if !ok {
+		return false
+	}
+	c.expireSessions(group, members, now)
+
+	return len(members.members) > 0
+}
+
+// member returns the session of memberID in group, and the group's members.
+// NOTE: you must hold c.mu when calling this method!
+func (c *groupCoordinator) member(group string, memberID string, now time.Time) (*groupMemberSession, *groupMembers, error) {
+	members, ok := c.groups[group]
+	if ok {
+		c.expireSessions(group, members, now)
+		if member, ok := members.members[memberID]; ok {
+			return member, members, nil
+		}
+	}
+
+	return nil, nil, fmt.Errorf("%w: member '%s' of group '%s'", seberr.ErrNotFound, memberID, group)
+}
+
+// groupMembers returns the members of group, creating the group using the
+// assignor named assignorName if it doesn't exist. seberr.ErrBadInput is
+// returned if the group exists and uses another assignor.
+// NOTE: you must hold c.mu when calling this method!
+func (c *groupCoordinator) groupMembers(group string, assignorName string, now time.Time) (*groupMembers, error) {
+	if members, ok := c.groups[group]; ok {
+		// expiring sessions removes the group if it has no members left
+		c.expireSessions(group, members, now)
+	}
+
+	members, ok := c.groups[group]
+	if ok {
+		if assignorName != "" && assignorName != members.assignorName {
+			return nil, fmt.Errorf("%w: group '%s' uses assignor '%s', not '%s'", seberr.ErrBadInput, group, members.assignorName, assignorName)
+		}
+		return members, nil
+	}
+
+	if assignorName == "" {
+		assignorName = c.assignorName
+	}
+	assignor, err := AssignorByName(assignorName)
+	if err != nil {
+		return nil, err
+	}
+
+	members = &groupMembers{
+		assignorName: assignorName,
+		assignor:     assignor,
+		members:      map[string]*groupMemberSession{},
+	}
+	c.groups[group] = members
+
+	return members, nil
+}
+
+// expireSessions removes the members of group whose sessions have timed out,
+// and rebalances the group if any were removed.
+// NOTE: you must hold c.mu when calling this method!
+func (c *groupCoordinator) expireSessions(group string, members *groupMembers, now time.Time) {
+	expired := false
+	for memberID, member := range members.members {
+		if now.Sub(member.heartbeatAt) > member.sessionTimeout {
+			delete(members.members, memberID)
+			expired = true
+		}
+	}
+
+	if expired {
+		c.removeIfEmpty(group, members)
+		c.rebalance(members)
+	}
+}
+
+// NOTE: you must hold c.mu when calling this method!
+func (c *groupCoordinator) removeIfEmpty(group string, members *groupMembers) {
+	if len(members.members) == 0 {
+		delete(c.groups, group)
+	}
+}
+
+// rebalance starts a new generation of the group, assigning its topics to its
+// current members.
+// NOTE: you must hold c.mu when calling this method!
+func (c *groupCoordinator) rebalance(members *groupMembers) {
+	members.generation++
+	if len(members.members) == 0 {
+		members.assignment = map[string][]string{}
+		return
+	}
+	members.assignment = members.assignor.Assign(members.sortedMembers())
+}
+
+func (members *groupMembers) assignmentOf(memberID string) GroupAssignment {
+	return GroupAssignment{
+		MemberID:   memberID,
+		Generation: members.generation,
+		TopicNames: slices.Clone(members.assignment[memberID]),
+		Assignor:   members.assignorName,
+	}
+}
+
+func (members *groupMembers) sortedMembers() []GroupMember {
+	sorted := make([]GroupMember, 0, len(members.members))
+	for memberID, member := range members.members {
+		sorted = append(sorted, GroupMember{
+			ID:         memberID,
+			TopicNames: slices.Clone(member.topicNames),
+			Assigned:   slices.Clone(members.assignment[memberID]),
+		})
+	}
+	slices.SortFunc(sorted, func(a, b GroupMember) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	return sorted
+}
+
+func newMemberID() (string, error) {
+	bs := make([]byte, 16)
+	_, err := rand.Read(bs)
+	if err != nil {
+		return "", fmt.Errorf("generating member id: %w", err)
+	}
+
+	return hex.EncodeToString(bs), nil
+}
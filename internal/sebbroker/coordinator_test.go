@@ -0,0 +1,217 @@
+package sebbroker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGroupMembership verifies that the topics of a group are split between
+// its members as they join, and reassigned when members leave, starting a
+// new generation every time.
+func TestGroupMembership(t *testing.T) {
+	tester.TestBroker(t, true, func(t *testing.T, s *sebbroker.Broker) {
+		const group = "group"
+		topicNames := []string{"t1", "t2", "t3", "t4"}
+
+		// Act
+		a, err := s.JoinGroup(group, "", topicNames, 0, "")
+		require.NoError(t, err)
+
+		// Assert
+		require.NotEmpty(t, a.MemberID)
+		require.Equal(t, uint64(1), a.Generation)
+		require.Equal(t, topicNames, a.TopicNames)
+
+		// Act
+		b, err := s.JoinGroup(group, "b", topicNames, 0, "")
+		require.NoError(t, err)
+		a, err = s.GroupHeartbeat(group, a.MemberID)
+		require.NoError(t, err)
+
+		// Assert
+		require.Equal(t, uint64(2), a.Generation)
+		require.Equal(t, uint64(2), b.Generation)
+		require.Len(t, a.TopicNames, 2)
+		require.Len(t, b.TopicNames, 2)
+		require.ElementsMatch(t, topicNames, append(a.TopicNames, b.TopicNames...))
+
+		// rejoining with the same topics doesn't rebalance
+		b, err = s.JoinGroup(group, "b", topicNames, 0, "")
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), b.Generation)
+
+		// Act
+		err = s.LeaveGroup(group, a.MemberID)
+		require.NoError(t, err)
+
+		// Assert
+		b, err = s.GroupHeartbeat(group, "b")
+		require.NoError(t, err)
+		require.Equal(t, uint64(3), b.Generation)
+		require.Equal(t, topicNames, b.TopicNames)
+
+		_, err = s.GroupHeartbeat(group, a.MemberID)
+		require.ErrorIs(t, err, seberr.ErrNotFound)
+		err = s.LeaveGroup(group, a.MemberID)
+		require.ErrorIs(t, err, seberr.ErrNotFound)
+	})
+}
+
+// TestGroupMemberSessionTimeout verifies that members that don't send
+// heartbeats within their session timeout are removed from their group, and
+// that their topics are assigned to the remaining members.
+func TestGroupMemberSessionTimeout(t *testing.T) {
+	tester.TestBroker(t, true, func(t *testing.T, s *sebbroker.Broker) {
+		const (
+			group          = "group"
+			sessionTimeout = 50 * time.Millisecond
+		)
+		topicNames := []string{"t1", "t2"}
+
+		_, err := s.JoinGroup(group, "a", topicNames, sessionTimeout, "")
+		require.NoError(t, err)
+		_, err = s.JoinGroup(group, "b", topicNames, time.Hour, "")
+		require.NoError(t, err)
+		require.Len(t, s.GroupMembers(group), 2)
+
+		// Act
+		time.Sleep(2 * sessionTimeout)
+
+		// Assert
+		_, err = s.GroupHeartbeat(group, "a")
+		require.ErrorIs(t, err, seberr.ErrNotFound)
+
+		b, err := s.GroupHeartbeat(group, "b")
+		require.NoError(t, err)
+		require.Equal(t, topicNames, b.TopicNames)
+		require.Equal(t, []sebbroker.GroupMember{{ID: "b", TopicNames: topicNames, Assigned: topicNames}}, s.GroupMembers(group))
+	})
+}
+
+// TestJoinGroupSticky verifies that groups created with the sticky assignor
+// only move the topics of members that leave, or that are needed to balance
+// the topics of members that join.
+func TestJoinGroupSticky(t *testing.T) {
+	tester.TestBroker(t, true, func(t *testing.T, s *sebbroker.Broker) {
+		const group = "group"
+		topicNames := []string{"t1", "t2", "t3", "t4", "t5", "t6"}
+
+		assignments := func() map[string][]string {
+			assignments := map[string][]string{}
+			for _, member := range s.GroupMembers(group) {
+				assignments[member.ID] = member.Assigned
+			}
+			return assignments
+		}
+
+		for _, memberID := range []string{"a", "b", "c"} {
+			_, err := s.JoinGroup(group, memberID, topicNames, time.Hour, "sticky")
+			require.NoError(t, err)
+		}
+		require.Equal(t, map[string][]string{
+			"a": {"t1", "t2"},
+			"b": {"t4", "t5"},
+			"c": {"t3", "t6"},
+		}, assignments())
+
+		// Act
+		err := s.LeaveGroup(group, "b")
+		require.NoError(t, err)
+
+		// Assert
+		require.Equal(t, map[string][]string{
+			"a": {"t1", "t2", "t4"},
+			"c": {"t3", "t5", "t6"},
+		}, assignments())
+
+		// Act
+		d, err := s.JoinGroup(group, "d", topicNames, time.Hour, "")
+		require.NoError(t, err)
+
+		// Assert
+		require.Equal(t, "sticky", d.Assignor)
+		require.Equal(t, map[string][]string{
+			"a": {"t1", "t2"},
+			"c": {"t3", "t5"},
+			"d": {"t4", "t6"},
+		}, assignments())
+
+		_, err = s.JoinGroup(group, "e", topicNames, time.Hour, "range")
+		require.ErrorIs(t, err, seberr.ErrBadInput)
+	})
+}
+
+// TestJoinGroupErrors verifies that JoinGroup() returns ErrBadInput when
+// required inputs are missing.
+func TestJoinGroupErrors(t *testing.T) {
+	tests := map[string]struct {
+		group          string
+		topicNames     []string
+		sessionTimeout time.Duration
+		assignorName   string
+	}{
+		"no group":                 {group: "", topicNames: []string{"topic"}},
+		"no topics":                {group: "group"},
+		"negative session timeout": {group: "group", topicNames: []string{"topic"}, sessionTimeout: -time.Second},
+		"unknown assignor":         {group: "group", topicNames: []string{"topic"}, assignorName: "unknown"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tester.TestBroker(t, true, func(t *testing.T, s *sebbroker.Broker) {
+				// Act
+				_, err := s.JoinGroup(test.group, "", test.topicNames, test.sessionTimeout, test.assignorName)
+
+				// Assert
+				require.ErrorIs(t, err, seberr.ErrBadInput)
+			})
+		})
+	}
+}
+
+// TestStaleGroupsWithMembers verifies that groups with members aren't stale,
+// even if they haven't committed offsets for a long time.
+func TestStaleGroupsWithMembers(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, bs sebtopic.Storage, cache *sebcache.Cache) {
+		ctx := context.Background()
+		const (
+			group   = "group"
+			maxIdle = time.Hour
+		)
+
+		s := sebbroker.New(log,
+			func(log logger.Logger, topicName string) (*sebtopic.Topic, error) {
+				return sebtopic.New(log, bs, topicName, cache)
+			},
+			sebbroker.WithNullBatcher(),
+			sebbroker.WithGroupMaxIdle(maxIdle),
+		)
+
+		_, err := s.AddRecords("topic", tester.MakeRandomRecordBatch(1))
+		require.NoError(t, err)
+		err = s.CommitGroupOffset(ctx, group, "topic", 1)
+		require.NoError(t, err)
+		now := time.Now().Add(2 * maxIdle)
+		require.Len(t, s.StaleGroups(now), 1)
+
+		_, err = s.JoinGroup(group, "member", []string{"topic"}, 3*maxIdle, "")
+		require.NoError(t, err)
+
+		// Act
+		expired, err := s.ExpireStaleGroups(ctx, now)
+
+		// Assert
+		require.NoError(t, err)
+		require.Empty(t, expired)
+		require.Equal(t, []string{group}, s.GroupNames())
+	})
+}
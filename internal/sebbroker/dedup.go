@@ -0,0 +1,291 @@
+package sebbroker
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+)
+
+type batchHash [sha256.Size]byte
+
+// batchDedup remembers the results of adding record batches, by the content
+// hash of the batches, for a window of time. This allows batches that are
+// produced again, e.g. because the response to the original request was lost,
+// to be acknowledged without adding their records twice.
+type batchDedup struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	batches map[batchHash]*dedupEntry
+
+	// order holds the entries of batches in the order they were added, such
+	// that they can be expired oldest first.
+	order []*dedupEntry
+
+	hits   uint64
+	misses uint64
+}
+
+type dedupEntry struct {
+	hash      batchHash
+	topicName string
+	principal string
+	addedAt   time.Time
+
+	// hits is the number of duplicates of the batch that were acknowledged.
+	hits uint64
+
+	// ready is closed once result and err have been set.
+	ready  chan struct{}
+	result AddResult
+	err    error
+}
+
+func newBatchDedup(window time.Duration, now func() time.Time) *batchDedup {
+	return &batchDedup{
+		window:  window,
+		now:     now,
+		batches: map[batchHash]*dedupEntry{},
+	}
+}
+
+// add adds the batch with the given hash, produced to topicName by principal,
+// using add, unless a batch with the same hash was added within the window.
+// The result of adding the original batch is then returned with Duplicate
+// set. If the original batch is still being added, add waits for it; if
+// adding it fails, the batch is added again.
+func (d *batchDedup) add(ctx context.Context, hash batchHash, topicName string, principal string, add func() (AddResult, error)) (AddResult, error) {
+	for {
+		d.mu.Lock()
+		now := d.now()
+		d.expire(now)
+
+		entry, ok := d.batches[hash]
+		if !ok {
+			entry = &dedupEntry{
+				hash:      hash,
+				topicName: topicName,
+				principal: principal,
+				addedAt:   now,
+				ready:     make(chan struct{}),
+			}
+			d.batches[hash] = entry
+			d.order = append(d.order, entry)
+			d.mu.Unlock()
+
+			entry.result, entry.err = add()
+			d.mu.Lock()
+			if entry.err != nil {
+				// the batch wasn't added, so retries must add it
+				d.remove(entry)
+			} else {
+				d.misses++
+			}
+			d.mu.Unlock()
+			close(entry.ready)
+
+			return entry.result, entry.err
+		}
+		d.mu.Unlock()
+
+		select {
+		case <-entry.ready:
+		case <-ctx.Done():
+			return AddResult{}, ctx.Err()
+		}
+
+		if entry.err == nil {
+			d.mu.Lock()
+			d.hits++
+			entry.hits++
+			d.mu.Unlock()
+
+			result := entry.result
+			result.Offsets = slices.Clone(result.Offsets)
+			result.Duplicate = true
+			return result, nil
+		}
+	}
+}
+
+// DedupStats describes the state of batch deduplication. See
+// Broker.DedupStats.
+type DedupStats struct {
+	// Window is the amount of time that batches are deduplicated for. Batches
+	// aren't deduplicated if 0.
+	Window time.Duration
+
+	// Batches is the number of batches that are remembered, and InFlight the
+	// number of those that are still being added.
+	Batches  int
+	InFlight int
+
+	// Hits is the number of duplicate batches that were acknowledged without
+	// being added, and Misses the number of batches that were added, since
+	// the broker was started.
+	Hits   uint64
+	Misses uint64
+
+	// Producers holds the remembered batches of each producer, sorted by
+	// principal and topic name.
+	Producers []DedupProducerStats
+}
+
+// DedupProducerStats describes the batches that a producer added to a topic
+// within the dedup window.
+type DedupProducerStats struct {
+	// Principal is the principal that produced the batches, as given by
+	// ContextWithPrincipal. Empty for producers without a principal.
+	Principal string
+	TopicName string
+
+	// Batches is the number of remembered batches, and Hits the number of
+	// duplicates of them that were acknowledged.
+	Batches int
+	Hits    uint64
+
+	// HighestOffset is the highest offset of the remembered batches that
+	// have been added. Records produced again up to this offset are
+	// deduplicated, while records beyond it are not. It's 0 if no batch has
+	// been added yet.
+	HighestOffset uint64
+
+	LastAddedAt time.Time
+}
+
+// DedupStats returns the state of batch deduplication, e.g. in order to
+// debug producers whose retries are unexpectedly added again or
+// acknowledged. The zero value is returned if the broker doesn't deduplicate
+// batches. See WithDedupWindow.
+func (s *Broker) DedupStats() DedupStats {
+	if s.dedup == nil {
+		return DedupStats{Producers: []DedupProducerStats{}}
+	}
+	return s.dedup.stats()
+}
+
+// stats returns the current state of d.
+func (d *batchDedup) stats() DedupStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.expire(d.now())
+
+	stats := DedupStats{
+		Window:  d.window,
+		Batches: len(d.order),
+		Hits:    d.hits,
+		Misses:  d.misses,
+	}
+
+	type producerKey struct{ principal, topicName string }
+	producers := map[producerKey]*DedupProducerStats{}
+	for _, entry := range d.order {
+		key := producerKey{entry.principal, entry.topicName}
+		producer, ok := producers[key]
+		if !ok {
+			producer = &DedupProducerStats{Principal: entry.principal, TopicName: entry.topicName}
+			producers[key] = producer
+		}
+		producer.Batches++
+		producer.Hits += entry.hits
+		producer.LastAddedAt = entry.addedAt
+
+		select {
+		case <-entry.ready:
+			if len(entry.result.Offsets) > 0 {
+				producer.HighestOffset = max(producer.HighestOffset, slices.Max(entry.result.Offsets))
+			}
+		default:
+			stats.InFlight++
+		}
+	}
+
+	stats.Producers = make([]DedupProducerStats, 0, len(producers))
+	for _, producer := range producers {
+		stats.Producers = append(stats.Producers, *producer)
+	}
+	slices.SortFunc(stats.Producers, func(a, b DedupProducerStats) int {
+		return cmp.Or(cmp.Compare(a.Principal, b.Principal), cmp.Compare(a.TopicName, b.TopicName))
+	})
+
+	return stats
+}
+
+// expire forgets the batches that were added longer than the window before
+// now.
+// NOTE: you must hold d.mu when calling this method!
+func (d *batchDedup) expire(now time.Time) {
+	expired := 0
+	for _, entry := range d.order {
+		if now.Sub(entry.addedAt) <= d.window {
+			break
+		}
+		expired++
+		if d.batches[entry.hash] == entry {
+			delete(d.batches, entry.hash)
+		}
+	}
+	d.order = d.order[expired:]
+}
+
+// NOTE: you must hold d.mu when calling this method!
+func (d *batchDedup) remove(entry *dedupEntry) {
+	if d.batches[entry.hash] == entry {
+		delete(d.batches, entry.hash)
+	}
+	d.order = slices.DeleteFunc(d.order, func(e *dedupEntry) bool {
+		return e == entry
+	})
+}
+
+// hashBatch returns the content hash of batch when added to topicName. Only
+// the records and their metadata are hashed; Traces and ProducedUnixEpochUs
+// describe the request that produced them and may differ between retries.
+func hashBatch(topicName string, batch sebrecords.Batch) batchHash {
+	h := sha256.New()
+	writeLen := func(n int) {
+		binary.Write(h, binary.LittleEndian, uint64(n))
+	}
+
+	writeLen(len(topicName))
+	h.Write([]byte(topicName))
+
+	writeLen(len(batch.Sizes))
+	binary.Write(h, binary.LittleEndian, batch.Sizes)
+	writeLen(len(batch.Data))
+	h.Write(batch.Data)
+	writeLen(len(batch.Expires))
+	binary.Write(h, binary.LittleEndian, batch.Expires)
+	writeLen(len(batch.Pointers))
+	binary.Write(h, binary.LittleEndian, batch.Pointers)
+	writeLen(len(batch.Timestamps))
+	binary.Write(h, binary.LittleEndian, batch.Timestamps)
+
+	writeLen(len(batch.Keys))
+	for _, key := range batch.Keys {
+		writeLen(len(key))
+		h.Write(key)
+	}
+
+	writeLen(len(batch.Headers))
+	for _, headers := range batch.Headers {
+		writeLen(len(headers))
+		for _, header := range headers {
+			fmt.Fprintf(h, "%d:%s%d:", len(header.Key), header.Key, len(header.Value))
+			h.Write(header.Value)
+		}
+	}
+
+	var sum batchHash
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
@@ -0,0 +1,190 @@
+package sebbroker_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDedupWindow verifies that batches identical to a batch added to the
+// same topic within the dedup window are acknowledged with the offsets of the
+// original batch without being added again, and that they're added once the
+// window has passed.
+func TestDedupWindow(t *testing.T) {
+	const window = 50 * time.Millisecond
+	s := tester.Broker(t, sebtopic.NewMemoryStorage(log), sebbroker.WithDedupWindow(window))
+	ctx := context.Background()
+
+	batch := tester.MakeRandomRecordBatch(3)
+	result, err := s.AddRecordsResult(ctx, "topic", batch)
+	require.NoError(t, err)
+	require.False(t, result.Duplicate)
+
+	// Act
+	duplicate, err := s.AddRecordsResult(ctx, "topic", batch)
+	require.NoError(t, err)
+
+	// Assert
+	require.True(t, duplicate.Duplicate)
+	require.Equal(t, result.Offsets, duplicate.Offsets)
+	metadata, err := s.Metadata("topic")
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), metadata.NextOffset)
+
+	// identical batches of other topics aren't duplicates
+	result, err = s.AddRecordsResult(ctx, "other", batch)
+	require.NoError(t, err)
+	require.False(t, result.Duplicate)
+
+	// batches with other expiry times aren't duplicates
+	expiring := batch
+	expiring.Expires = []int64{1, 2, 3}
+	result, err = s.AddRecordsResult(ctx, "topic", expiring)
+	require.NoError(t, err)
+	require.False(t, result.Duplicate)
+	require.Equal(t, []uint64{3, 4, 5}, result.Offsets)
+
+	time.Sleep(2 * window)
+
+	// Act
+	result, err = s.AddRecordsResult(ctx, "topic", batch)
+	require.NoError(t, err)
+
+	// Assert
+	require.False(t, result.Duplicate)
+	require.Equal(t, []uint64{6, 7, 8}, result.Offsets)
+}
+
+// TestDedupWindowConcurrent verifies that identical batches added
+// concurrently are only added once.
+func TestDedupWindowConcurrent(t *testing.T) {
+	s := tester.Broker(t, sebtopic.NewMemoryStorage(log), sebbroker.WithDedupWindow(time.Minute))
+	batch := tester.MakeRandomRecordBatch(2)
+
+	const producers = 10
+	results := make([]sebbroker.AddResult, producers)
+	wg := sync.WaitGroup{}
+	for i := range producers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			result, err := s.AddRecordsResult(context.Background(), "topic", batch)
+			require.NoError(t, err)
+			results[i] = result
+		}()
+	}
+
+	// Act
+	wg.Wait()
+
+	// Assert
+	duplicates := 0
+	for _, result := range results {
+		require.Equal(t, []uint64{0, 1}, result.Offsets)
+		if result.Duplicate {
+			duplicates++
+		}
+	}
+	require.Equal(t, producers-1, duplicates)
+}
+
+// TestDedupWindowFailedBatch verifies that batches that failed to be added
+// aren't deduplicated, such that retries aren't acknowledged without being
+// added.
+func TestDedupWindowFailedBatch(t *testing.T) {
+	s := tester.Broker(t, sebtopic.NewMemoryStorage(log),
+		sebbroker.WithDedupWindow(time.Minute),
+		sebbroker.WithQuotas(sebbroker.Quota{Namespace: "team-a/", ProducedBytesPerDay: 100}),
+	)
+	batch := tester.RecordsToBatch([][]byte{tester.RandomBytes(t, 120)})
+
+	_, err := s.AddRecords("team-a/orders", batch)
+	require.ErrorIs(t, err, seberr.ErrQuotaExceeded)
+
+	// Act
+	_, err = s.AddRecords("team-a/orders", batch)
+
+	// Assert
+	require.ErrorIs(t, err, seberr.ErrQuotaExceeded)
+}
+
+// TestDedupStats verifies that DedupStats() returns the batches remembered
+// for each producer and topic, along with the number of duplicates that were
+// acknowledged, and that remembered batches are forgotten once the window
+// has passed.
+func TestDedupStats(t *testing.T) {
+	const window = 50 * time.Millisecond
+	s := tester.Broker(t, sebtopic.NewMemoryStorage(log), sebbroker.WithDedupWindow(window))
+	ctxA := sebbroker.ContextWithPrincipal(context.Background(), "producer-a")
+	ctxB := sebbroker.ContextWithPrincipal(context.Background(), "producer-b")
+
+	batch := tester.MakeRandomRecordBatch(3)
+	for range 3 {
+		_, err := s.AddRecordsResult(ctxA, "topic", batch)
+		require.NoError(t, err)
+	}
+	_, err := s.AddRecordsResult(ctxA, "topic", tester.MakeRandomRecordBatch(2))
+	require.NoError(t, err)
+	_, err = s.AddRecordsResult(ctxB, "other", tester.MakeRandomRecordBatch(1))
+	require.NoError(t, err)
+
+	// Act
+	stats := s.DedupStats()
+
+	// Assert
+	require.Equal(t, window, stats.Window)
+	require.Equal(t, 3, stats.Batches)
+	require.Equal(t, 0, stats.InFlight)
+	require.Equal(t, uint64(2), stats.Hits)
+	require.Equal(t, uint64(3), stats.Misses)
+
+	require.Len(t, stats.Producers, 2)
+	producerA, producerB := stats.Producers[0], stats.Producers[1]
+	require.Equal(t, "producer-a", producerA.Principal)
+	require.Equal(t, "topic", producerA.TopicName)
+	require.Equal(t, 2, producerA.Batches)
+	require.Equal(t, uint64(2), producerA.Hits)
+	require.Equal(t, uint64(4), producerA.HighestOffset)
+
+	require.Equal(t, "producer-b", producerB.Principal)
+	require.Equal(t, "other", producerB.TopicName)
+	require.Equal(t, 1, producerB.Batches)
+	require.Equal(t, uint64(0), producerB.Hits)
+	require.Equal(t, uint64(0), producerB.HighestOffset)
+
+	time.Sleep(2 * window)
+
+	// Act
+	stats = s.DedupStats()
+
+	// Assert
+	require.Equal(t, 0, stats.Batches)
+	require.Empty(t, stats.Producers)
+	require.Equal(t, uint64(2), stats.Hits)
+}
+
+// TestDedupStatsDisabled verifies that DedupStats() returns a zero window
+// when the broker doesn't deduplicate batches.
+func TestDedupStatsDisabled(t *testing.T) {
+	const autoCreate = true
+	tester.TestBroker(t, autoCreate, func(t *testing.T, s *sebbroker.Broker) {
+		_, err := s.AddRecords("topic", tester.MakeRandomRecordBatch(1))
+		require.NoError(t, err)
+
+		// Act
+		stats := s.DedupStats()
+
+		// Assert
+		require.Equal(t, time.Duration(0), stats.Window)
+		require.Equal(t, 0, stats.Batches)
+		require.Equal(t, uint64(0), stats.Misses)
+	})
+}
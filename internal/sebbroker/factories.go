@@ -1,10 +1,10 @@
 package sebbroker
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
 	"github.com/micvbang/simple-event-broker/internal/sebcache"
 	"github.com/micvbang/simple-event-broker/internal/sebrecords"
@@ -13,25 +13,134 @@ import (
 
 type TopicFactory func(_ logger.Logger, topicName string) (*sebtopic.Topic, error)
 
-func NewS3TopicFactory(cfg aws.Config, s3BucketName string, cache *sebcache.Cache) TopicFactory {
+type TopicFactoryOpts struct {
+	// KeyProvider is used to encrypt record batches before they're written
+	// to storage. Encryption is disabled if nil.
+	KeyProvider sebtopic.KeyProvider
+
+	// StagingDir is the directory in which record batches are staged until
+	// they've been uploaded to S3. See sebtopic.S3Opts. It's only used by
+	// NewS3TopicFactory.
+	StagingDir string
+
+	// S3OptFuncs configure the S3 storage created by NewS3TopicFactory, e.g.
+	// to use an S3 compatible endpoint.
+	S3OptFuncs []func(*sebtopic.S3Opts)
+
+	TopicOptFuncs []func(*sebtopic.Opts)
+}
+
+func WithKeyProvider(keyProvider sebtopic.KeyProvider) func(*TopicFactoryOpts) {
+	return func(o *TopicFactoryOpts) {
+		o.KeyProvider = keyProvider
+	}
+}
+
+func WithStagingDir(dir string) func(*TopicFactoryOpts) {
+	return func(o *TopicFactoryOpts) {
+		o.StagingDir = dir
+	}
+}
+
+func WithS3Opts(optFuncs ...func(*sebtopic.S3Opts)) func(*TopicFactoryOpts) {
+	return func(o *TopicFactoryOpts) {
+		o.S3OptFuncs = append(o.S3OptFuncs, optFuncs...)
+	}
+}
+
+func WithTopicOpts(optFuncs ...func(*sebtopic.Opts)) func(*TopicFactoryOpts) {
+	return func(o *TopicFactoryOpts) {
+		o.TopicOptFuncs = append(o.TopicOptFuncs, optFuncs...)
+	}
+}
+
+// NewS3TopicFactory returns a TopicFactory that creates topics backed by S3.
+// Uploads that were interrupted before they reached S3 are recovered before
+// the topic is created.
+func NewS3TopicFactory(cfg aws.Config, s3BucketName string, cache *sebcache.Cache, optFuncs ...func(*TopicFactoryOpts)) TopicFactory {
+	opts := TopicFactoryOpts{}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+
 	return func(log logger.Logger, topicName string) (*sebtopic.Topic, error) {
 		storageLogger := log.Name("s3 storage").WithField("topic-name", topicName).WithField("bucket", s3BucketName)
 
-		s3Client := s3.NewFromConfig(cfg)
-		s3Storage := sebtopic.NewS3Storage(storageLogger, s3Client, s3BucketName, "")
-		return sebtopic.New(log, s3Storage, topicName, cache)
+		s3OptFuncs := append([]func(*sebtopic.S3Opts){sebtopic.WithS3StagingDir(opts.StagingDir)}, opts.S3OptFuncs...)
+		s3Storage := sebtopic.NewS3StorageFromConfig(storageLogger, cfg, s3BucketName, "", s3OptFuncs...)
+
+		recovered, err := s3Storage.RecoverUploads(topicName)
+		if err != nil {
+			return nil, fmt.Errorf("recovering uploads for topic '%s': %w", topicName, err)
+		}
+		if recovered > 0 {
+			log.Infof("recovered %d interrupted uploads for topic '%s'", recovered, topicName)
+		}
+
+		var storage sebtopic.Storage = s3Storage
+		if opts.KeyProvider != nil {
+			storage = sebtopic.NewEncryptedStorage(s3Storage, opts.KeyProvider)
+		}
+
+		return sebtopic.New(log, storage, topicName, cache, opts.TopicOptFuncs...)
+	}
+}
+
+// uploadRecoverer is implemented by storage that can recover uploads that were
+// interrupted, e.g. *sebtopic.S3Storage.
+type uploadRecoverer interface {
+	RecoverUploads(topicName string) (int, error)
+}
+
+// NewStorageTopicFactory returns a TopicFactory that creates topics backed by
+// storage, e.g. storage created by sebtopic.NewStorageByName. If storage can
+// recover interrupted uploads, they're recovered before the topic is created.
+func NewStorageTopicFactory(storage sebtopic.Storage, cache *sebcache.Cache, optFuncs ...func(*TopicFactoryOpts)) TopicFactory {
+	opts := TopicFactoryOpts{}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+
+	recoverer, canRecover := storage.(uploadRecoverer)
+	if opts.KeyProvider != nil {
+		storage = sebtopic.NewEncryptedStorage(storage, opts.KeyProvider)
+	}
+
+	return func(log logger.Logger, topicName string) (*sebtopic.Topic, error) {
+		if canRecover {
+			recovered, err := recoverer.RecoverUploads(topicName)
+			if err != nil {
+				return nil, fmt.Errorf("recovering uploads for topic '%s': %w", topicName, err)
+			}
+			if recovered > 0 {
+				log.Infof("recovered %d interrupted uploads for topic '%s'", recovered, topicName)
+			}
+		}
+
+		return sebtopic.New(log, storage, topicName, cache, opts.TopicOptFuncs...)
 	}
 }
 
-func NewTopicFactory(ts sebtopic.Storage, cache *sebcache.Cache) TopicFactory {
+// NewTopicFactory returns a TopicFactory that creates topics backed by ts.
+// Unlike NewStorageTopicFactory, interrupted uploads are not recovered.
+func NewTopicFactory(ts sebtopic.Storage, cache *sebcache.Cache, optFuncs ...func(*TopicFactoryOpts)) TopicFactory {
+	opts := TopicFactoryOpts{}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+
+	if opts.KeyProvider != nil {
+		ts = sebtopic.NewEncryptedStorage(ts, opts.KeyProvider)
+	}
+
 	return func(log logger.Logger, topicName string) (*sebtopic.Topic, error) {
-		return sebtopic.New(log, ts, topicName, cache)
+		return sebtopic.New(log, ts, topicName, cache, opts.TopicOptFuncs...)
 	}
 }
 
 type batcherFactory func(logger.Logger, *sebtopic.Topic) RecordBatcher
 
-func NewBlockingBatcherFactory(blockTime time.Duration, batchBytesMax int) batcherFactory {
+func NewBlockingBatcherFactory(blockTime time.Duration, batchBytesMax int, optFuncs ...func(*BlockingBatcherOpts)) batcherFactory {
 	return func(log logger.Logger, t *sebtopic.Topic) RecordBatcher {
 		log = log.Name("blocking batcher")
 
@@ -42,7 +151,7 @@ func NewBlockingBatcherFactory(blockTime time.Duration, batchBytesMax int) batch
 			return offsets, err
 		}
 
-		return NewBlockingBatcher(log, blockTime, batchBytesMax, persist)
+		return NewBlockingBatcher(log, blockTime, batchBytesMax, persist, optFuncs...)
 	}
 }
 
@@ -0,0 +1,94 @@
+package sebbroker_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/stretchr/testify/require"
+)
+
+// TestStorageTopicFactory verifies that topics created by
+// NewStorageTopicFactory() recover interrupted uploads before the topic is
+// created, and encrypt record batches when given a KeyProvider.
+func TestStorageTopicFactory(t *testing.T) {
+	const topicName = "topic"
+	storage := &recoveringStorage{MemoryTopicStorage: sebtopic.NewMemoryStorage(log)}
+	cache, err := sebcache.NewMemoryCache(log)
+	require.NoError(t, err)
+
+	keyProvider := sebtopic.NewStaticKeyProvider("key-1", tester.RandomBytes(t, 32))
+	topicFactory := sebbroker.NewStorageTopicFactory(storage, cache,
+		sebbroker.WithKeyProvider(keyProvider),
+		sebbroker.WithTopicOpts(sebtopic.WithCompress(nil)),
+	)
+
+	// Act
+	topic, err := topicFactory(log, topicName)
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, []string{topicName}, storage.recovered)
+
+	batch := tester.MakeRandomRecordBatch(1)
+	_, err = topic.AddRecords(batch)
+	require.NoError(t, err)
+
+	rdr, err := storage.Reader(context.Background(), sebtopic.RecordBatchKey(topicName, 0))
+	require.NoError(t, err)
+	defer rdr.Close()
+
+	stored, err := io.ReadAll(rdr)
+	require.NoError(t, err)
+	require.False(t, bytes.Contains(stored, batch.Data))
+}
+
+// TestTopicFactory verifies that topics created by NewTopicFactory() don't
+// recover interrupted uploads, and encrypt record batches when given a
+// KeyProvider.
+func TestTopicFactory(t *testing.T) {
+	const topicName = "topic"
+	storage := &recoveringStorage{MemoryTopicStorage: sebtopic.NewMemoryStorage(log)}
+	cache, err := sebcache.NewMemoryCache(log)
+	require.NoError(t, err)
+
+	keyProvider := sebtopic.NewStaticKeyProvider("key-1", tester.RandomBytes(t, 32))
+	topicFactory := sebbroker.NewTopicFactory(storage, cache,
+		sebbroker.WithKeyProvider(keyProvider),
+		sebbroker.WithTopicOpts(sebtopic.WithCompress(nil)),
+	)
+
+	// Act
+	topic, err := topicFactory(log, topicName)
+	require.NoError(t, err)
+
+	// Assert
+	require.Empty(t, storage.recovered)
+
+	batch := tester.MakeRandomRecordBatch(1)
+	_, err = topic.AddRecords(batch)
+	require.NoError(t, err)
+
+	rdr, err := storage.Reader(context.Background(), sebtopic.RecordBatchKey(topicName, 0))
+	require.NoError(t, err)
+	defer rdr.Close()
+
+	stored, err := io.ReadAll(rdr)
+	require.NoError(t, err)
+	require.False(t, bytes.Contains(stored, batch.Data))
+}
+
+type recoveringStorage struct {
+	*sebtopic.MemoryTopicStorage
+	recovered []string
+}
+
+func (s *recoveringStorage) RecoverUploads(topicName string) (int, error) {
+	s.recovered = append(s.recovered, topicName)
+	return 0, nil
+}
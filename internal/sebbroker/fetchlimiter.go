@@ -0,0 +1,65 @@
+package sebbroker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// fetchLimiter limits the number of bytes being read by concurrent calls to
+// GetRecords.
+type fetchLimiter struct {
+	maxBytes int
+
+	mu       sync.Mutex
+	inFlight int
+	released chan struct{}
+}
+
+func newFetchLimiter(maxBytes int) *fetchLimiter {
+	return &fetchLimiter{
+		maxBytes: maxBytes,
+		released: make(chan struct{}),
+	}
+}
+
+// reserve waits until numBytes fit within the limit, and reserves them. If no
+// bytes are in flight, they always fit, such that reads larger than the limit
+// can still be made.
+func (l *fetchLimiter) reserve(ctx context.Context, numBytes int) error {
+	if l.maxBytes <= 0 {
+		return nil
+	}
+
+	for {
+		l.mu.Lock()
+		if l.inFlight == 0 || l.inFlight+numBytes <= l.maxBytes {
+			l.inFlight += numBytes
+			l.mu.Unlock()
+			return nil
+		}
+		released, inFlight := l.released, l.inFlight
+		l.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for %d bytes in flight to be read: %w", inFlight, ctx.Err())
+		}
+	}
+}
+
+// release releases numBytes reserved by reserve, waking up all waiting
+// readers.
+func (l *fetchLimiter) release(numBytes int) {
+	if l.maxBytes <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight -= numBytes
+	close(l.released)
+	l.released = make(chan struct{})
+}
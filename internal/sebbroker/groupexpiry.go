@@ -0,0 +1,36 @@
+package sebbroker
+
+import (
+	"context"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+)
+
+// GroupExpiryLoop periodically removes consumer groups that haven't been
+// active for longer than the broker's GroupMaxIdle. It runs until ctx
+// expires; errors from removing groups are logged and retried at the next
+// interval.
+func GroupExpiryLoop(ctx context.Context, log logger.Logger, broker *Broker, interval time.Duration) error {
+	log = log.WithField("interval", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		expired, err := broker.ExpireStaleGroups(ctx, time.Now())
+		if err != nil {
+			log.Errorf("expiring stale consumer groups: %s", err)
+		}
+
+		for _, staleGroup := range expired {
+			log.Infof("expired consumer group '%s', last active %s", staleGroup.Group, staleGroup.ActiveAt.Format(time.RFC3339))
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package sebbroker
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// PauseGroup pauses delivery of records of topicName to group, or of all
+// topics if topicName is empty, e.g. while a downstream system can't receive
+// them. GroupPaused reports the pause until it's resumed using ResumeGroup,
+// such that reads made on behalf of the group can be rejected. The pause is
+// persisted using the broker's GroupOffsetStore, if it has one.
+func (s *Broker) PauseGroup(ctx context.Context, group string, topicName string) error {
+	if group == "" {
+		return fmt.Errorf("%w: group must be given", seberr.ErrBadInput)
+	}
+
+	return s.updateGroup(ctx, group, func(groupOffsets *GroupOffsets) {
+		if topicName == "" {
+			groupOffsets.Paused = true
+			return
+		}
+
+		topicName = s.resolveTopicName(topicName)
+		if !slices.Contains(groupOffsets.PausedTopics, topicName) {
+			groupOffsets.PausedTopics = append(groupOffsets.PausedTopics, topicName)
+			slices.Sort(groupOffsets.PausedTopics)
+		}
+	})
+}
+
+// ResumeGroup resumes delivery of records of topicName to group, or of all
+// topics if topicName is empty. Topics can't be resumed individually while
+// all topics are paused.
+func (s *Broker) ResumeGroup(ctx context.Context, group string, topicName string) error {
+	if group == "" {
+		return fmt.Errorf("%w: group must be given", seberr.ErrBadInput)
+	}
+
+	return s.updateGroup(ctx, group, func(groupOffsets *GroupOffsets) {
+		if topicName == "" {
+			groupOffsets.Paused = false
+			groupOffsets.PausedTopics = nil
+			return
+		}
+
+		topicName = s.resolveTopicName(topicName)
+		groupOffsets.PausedTopics = slices.DeleteFunc(groupOffsets.PausedTopics, func(name string) bool {
+			return name == topicName
+		})
+	})
+}
+
+// GroupPaused returns true if delivery of records of topicName to group is
+// paused.
+func (s *Broker) GroupPaused(group string, topicName string) bool {
+	groupOffsets, ok := (*s.groups.Load())[group]
+	if !ok {
+		return false
+	}
+
+	return groupOffsets.Paused || slices.Contains(groupOffsets.PausedTopics, s.resolveTopicName(topicName))
+}
+
+// pausedTopics returns the names of the topics of topicNames whose delivery
+// to group is paused.
+func (s *Broker) pausedTopics(group string, topicNames []string) []string {
+	paused := []string{}
+	for _, topicName := range topicNames {
+		if s.GroupPaused(group, topicName) {
+			paused = append(paused, topicName)
+		}
+	}
+
+	return paused
+}
+
+// updateGroup updates the state of group using update, and persists it.
+// Groups that have nothing left are removed.
+func (s *Broker) updateGroup(ctx context.Context, group string, update func(*GroupOffsets)) error {
+	s.groupMu.Lock()
+	defer s.groupMu.Unlock()
+
+	groups := maps.Clone(*s.groups.Load())
+	groupOffsets := groups[group].clone()
+	update(&groupOffsets)
+	if groupOffsets.empty() {
+		delete(groups, group)
+	} else {
+		groups[group] = groupOffsets
+	}
+
+	return s.storeGroupOffsets(ctx, groups)
+}
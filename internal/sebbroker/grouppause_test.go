@@ -0,0 +1,94 @@
+package sebbroker_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPauseGroup verifies that groups can be paused and resumed for all
+// topics or for individual topics, and that pauses are persisted using
+// StorageGroupOffsetStore.
+func TestPauseGroup(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, bs sebtopic.Storage, cache *sebcache.Cache) {
+		ctx := context.Background()
+
+		newBroker := func() *sebbroker.Broker {
+			s := sebbroker.New(log,
+				func(log logger.Logger, topicName string) (*sebtopic.Topic, error) {
+					return sebtopic.New(log, bs, topicName, cache)
+				},
+				sebbroker.WithNullBatcher(),
+				sebbroker.WithGroupOffsetStore(sebbroker.NewStorageGroupOffsetStore(bs)),
+			)
+			err := s.LoadGroupOffsets(ctx)
+			require.NoError(t, err)
+			return s
+		}
+
+		s1 := newBroker()
+
+		// Act
+		err := s1.PauseGroup(ctx, "all", "")
+		require.NoError(t, err)
+		err = s1.PauseGroup(ctx, "one", "t1")
+		require.NoError(t, err)
+
+		// Assert
+		s2 := newBroker()
+		require.True(t, s2.GroupPaused("all", "t1"))
+		require.True(t, s2.GroupPaused("all", "t2"))
+		require.True(t, s2.GroupPaused("one", "t1"))
+		require.False(t, s2.GroupPaused("one", "t2"))
+		require.False(t, s2.GroupPaused("other", "t1"))
+		require.Equal(t, []string{"all", "one"}, s2.GroupNames())
+
+		// Act
+		err = s2.ResumeGroup(ctx, "all", "t1")
+		require.NoError(t, err)
+		err = s2.ResumeGroup(ctx, "one", "t1")
+		require.NoError(t, err)
+
+		// Assert
+		s3 := newBroker()
+		require.True(t, s3.GroupPaused("all", "t1"), "topics can't be resumed individually while all are paused")
+		require.False(t, s3.GroupPaused("one", "t1"))
+		require.Equal(t, []string{"all"}, s3.GroupNames())
+
+		err = s3.ResumeGroup(ctx, "all", "")
+		require.NoError(t, err)
+		require.False(t, s3.GroupPaused("all", "t1"))
+		require.Empty(t, s3.GroupNames())
+	})
+}
+
+// TestPauseGroupTopicDeleted verifies that pauses of a topic are removed when
+// the topic is deleted, and that groups can't be paused without a name.
+func TestPauseGroupTopicDeleted(t *testing.T) {
+	tester.TestBroker(t, true, func(t *testing.T, s *sebbroker.Broker) {
+		ctx := context.Background()
+
+		_, err := s.AddRecords("topic", tester.MakeRandomRecordBatch(1))
+		require.NoError(t, err)
+		err = s.PauseGroup(ctx, "group", "topic")
+		require.NoError(t, err)
+
+		// Act
+		err = s.DeleteTopic("topic")
+		require.NoError(t, err)
+
+		// Assert
+		require.False(t, s.GroupPaused("group", "topic"))
+		require.Empty(t, s.GroupNames())
+
+		err = s.PauseGroup(ctx, "", "topic")
+		require.ErrorIs(t, err, seberr.ErrBadInput)
+	})
+}
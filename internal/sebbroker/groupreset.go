@@ -0,0 +1,178 @@
+package sebbroker
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// OffsetResetTarget is what ResetGroupOffsets resets committed offsets to.
+type OffsetResetTarget string
+
+const (
+	// OffsetResetEarliest resets offsets to the oldest record that hasn't
+	// been dropped.
+	OffsetResetEarliest OffsetResetTarget = "earliest"
+
+	// OffsetResetLatest resets offsets to the end of the topic, skipping all
+	// records that have been added.
+	OffsetResetLatest OffsetResetTarget = "latest"
+
+	// OffsetResetOffset resets offsets to OffsetReset.Offset.
+	OffsetResetOffset OffsetResetTarget = "offset"
+
+	// OffsetResetTimestamp resets offsets to the first record committed at or
+	// after OffsetReset.Timestamp.
+	OffsetResetTimestamp OffsetResetTarget = "timestamp"
+)
+
+// OffsetReset describes how ResetGroupOffsets resets the offsets committed by
+// a consumer group.
+type OffsetReset struct {
+	To OffsetResetTarget
+
+	// Offset is used by OffsetResetOffset. It must not be past the end of
+	// any of the topics.
+	Offset uint64
+
+	// Timestamp is used by OffsetResetTimestamp.
+	Timestamp time.Time
+
+	// TopicNames are the topics whose offsets are reset. They default to the
+	// topics that the group has committed offsets for.
+	TopicNames []string
+
+	// DryRun returns the lag that the group would have after the reset
+	// without committing the offsets.
+	DryRun bool
+}
+
+// ResetGroupOffsets commits new offsets for group as described by reset, e.g.
+// to reprocess records or to skip records that can't be processed, and
+// returns the group's resulting lag on each of the reset topics, sorted by
+// topic name.
+//
+// Offsets can't be reset while group has members, since they would continue
+// from the offsets that they're processing and overwrite the reset offsets;
+// seberr.ErrBadInput is returned unless reset is a dry run.
+func (s *Broker) ResetGroupOffsets(ctx context.Context, group string, reset OffsetReset) ([]TopicLag, error) {
+	if group == "" {
+		return nil, fmt.Errorf("%w: group must be given", seberr.ErrBadInput)
+	}
+	switch reset.To {
+	case OffsetResetEarliest, OffsetResetLatest, OffsetResetOffset:
+	case OffsetResetTimestamp:
+		if reset.Timestamp.IsZero() {
+			return nil, fmt.Errorf("%w: timestamp must be given", seberr.ErrBadInput)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown reset target '%s', must be one of: %s, %s, %s, %s", seberr.ErrBadInput, reset.To, OffsetResetEarliest, OffsetResetLatest, OffsetResetOffset, OffsetResetTimestamp)
+	}
+
+	if !reset.DryRun && s.coordinator.hasMembers(group, time.Now()) {
+		return nil, fmt.Errorf("%w: group '%s' has members, offsets can only be reset when it has none", seberr.ErrBadInput, group)
+	}
+
+	topicNames := make([]string, 0, len(reset.TopicNames))
+	for _, topicName := range reset.TopicNames {
+		topicNames = append(topicNames, s.resolveTopicName(topicName))
+	}
+	if len(topicNames) == 0 {
+		groupOffsets, err := s.GroupOffsets(group)
+		if err != nil {
+			return nil, err
+		}
+		for topicName := range groupOffsets.Offsets {
+			topicNames = append(topicNames, topicName)
+		}
+	}
+	slices.Sort(topicNames)
+	topicNames = slices.Compact(topicNames)
+
+	lags := make([]TopicLag, 0, len(topicNames))
+	for _, topicName := range topicNames {
+		lag, err := s.resetTopicLag(ctx, topicName, reset)
+		if err != nil {
+			return nil, err
+		}
+		lags = append(lags, lag)
+	}
+
+	if reset.DryRun {
+		return lags, nil
+	}
+
+	s.log.Infof("resetting offsets of group '%s' to %s for %d topics", group, reset.To, len(lags))
+
+	s.groupMu.Lock()
+	defer s.groupMu.Unlock()
+
+	groups := maps.Clone(*s.groups.Load())
+	groupOffsets := groups[group].clone()
+	if groupOffsets.Offsets == nil {
+		groupOffsets.Offsets = map[string]uint64{}
+	}
+	for _, lag := range lags {
+		groupOffsets.Offsets[lag.TopicName] = lag.CommittedOffset
+	}
+	groupOffsets.CommittedAt = time.Now()
+	groups[group] = groupOffsets
+
+	err := s.storeGroupOffsets(ctx, groups)
+	if err != nil {
+		return nil, err
+	}
+
+	return lags, nil
+}
+
+// resetTopicLag returns the lag of a group on topicName if its offset was
+// reset as described by reset.
+func (s *Broker) resetTopicLag(ctx context.Context, topicName string, reset OffsetReset) (TopicLag, error) {
+	exists, err := s.topicExists(topicName)
+	if err != nil {
+		return TopicLag{}, err
+	}
+	if !exists {
+		return TopicLag{}, fmt.Errorf("%w: '%s'", seberr.ErrTopicNotFound, topicName)
+	}
+
+	tb, err := s.getTopicBatcher(topicName)
+	if err != nil {
+		return TopicLag{}, err
+	}
+	topic := tb.topic
+	nextOffset := topic.NextOffset()
+
+	var offset uint64
+	switch reset.To {
+	case OffsetResetEarliest:
+		offset, err = topic.FirstOffset(ctx)
+	case OffsetResetLatest:
+		offset = nextOffset
+	case OffsetResetOffset:
+		offset = reset.Offset
+		if offset > nextOffset {
+			return TopicLag{}, fmt.Errorf("%w: offset %d is past the end of topic '%s' (%d)", seberr.ErrOffsetOutOfBounds, offset, topicName, nextOffset)
+		}
+	case OffsetResetTimestamp:
+		offset, err = topic.OffsetAt(ctx, reset.Timestamp)
+	}
+	if err != nil {
+		return TopicLag{}, fmt.Errorf("finding %s offset of topic '%s': %w", reset.To, topicName, err)
+	}
+
+	// records may have been added since nextOffset was read
+	nextOffset = max(nextOffset, offset)
+
+	return TopicLag{
+		TopicName:       topicName,
+		CommittedOffset: offset,
+		NextOffset:      nextOffset,
+		Lag:             nextOffset - offset,
+	}, nil
+}
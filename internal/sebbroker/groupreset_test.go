@@ -0,0 +1,190 @@
+package sebbroker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestResetGroupOffsets verifies that committed offsets can be reset to the
+// earliest or latest offset, a specific offset and a timestamp, and that dry
+// runs return the resulting lag without committing the offsets.
+func TestResetGroupOffsets(t *testing.T) {
+	tester.TestBroker(t, true, func(t *testing.T, s *sebbroker.Broker) {
+		ctx := context.Background()
+
+		_, err := s.AddRecords("t1", tester.MakeRandomRecordBatch(3))
+		require.NoError(t, err)
+		time.Sleep(time.Millisecond)
+		t0 := time.Now()
+		time.Sleep(time.Millisecond)
+		_, err = s.AddRecords("t1", tester.MakeRandomRecordBatch(2))
+		require.NoError(t, err)
+		_, err = s.AddRecords("t2", tester.MakeRandomRecordBatch(4))
+		require.NoError(t, err)
+
+		err = s.CommitGroupOffset(ctx, "group", "t1", 1)
+		require.NoError(t, err)
+		err = s.CommitGroupOffset(ctx, "group", "t2", 1)
+		require.NoError(t, err)
+
+		tests := map[string]struct {
+			reset    sebbroker.OffsetReset
+			expected []sebbroker.TopicLag
+		}{
+			"earliest": {
+				reset: sebbroker.OffsetReset{To: sebbroker.OffsetResetEarliest},
+				expected: []sebbroker.TopicLag{
+					{TopicName: "t1", CommittedOffset: 0, NextOffset: 5, Lag: 5},
+					{TopicName: "t2", CommittedOffset: 0, NextOffset: 4, Lag: 4},
+				},
+			},
+			"latest": {
+				reset: sebbroker.OffsetReset{To: sebbroker.OffsetResetLatest},
+				expected: []sebbroker.TopicLag{
+					{TopicName: "t1", CommittedOffset: 5, NextOffset: 5, Lag: 0},
+					{TopicName: "t2", CommittedOffset: 4, NextOffset: 4, Lag: 0},
+				},
+			},
+			"offset": {
+				reset: sebbroker.OffsetReset{To: sebbroker.OffsetResetOffset, Offset: 2},
+				expected: []sebbroker.TopicLag{
+					{TopicName: "t1", CommittedOffset: 2, NextOffset: 5, Lag: 3},
+					{TopicName: "t2", CommittedOffset: 2, NextOffset: 4, Lag: 2},
+				},
+			},
+			"timestamp": {
+				reset: sebbroker.OffsetReset{To: sebbroker.OffsetResetTimestamp, Timestamp: t0},
+				expected: []sebbroker.TopicLag{
+					{TopicName: "t1", CommittedOffset: 3, NextOffset: 5, Lag: 2},
+					{TopicName: "t2", CommittedOffset: 0, NextOffset: 4, Lag: 4},
+				},
+			},
+			"single topic": {
+				reset: sebbroker.OffsetReset{To: sebbroker.OffsetResetEarliest, TopicNames: []string{"t2"}},
+				expected: []sebbroker.TopicLag{
+					{TopicName: "t2", CommittedOffset: 0, NextOffset: 4, Lag: 4},
+				},
+			},
+		}
+
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				err := s.CommitGroupOffset(ctx, "group", "t1", 1)
+				require.NoError(t, err)
+				err = s.CommitGroupOffset(ctx, "group", "t2", 1)
+				require.NoError(t, err)
+				lagsBefore, err := s.GroupLag("group")
+				require.NoError(t, err)
+
+				// Act
+				dryRun := test.reset
+				dryRun.DryRun = true
+				dryRunLags, err := s.ResetGroupOffsets(ctx, "group", dryRun)
+				require.NoError(t, err)
+
+				// Assert
+				require.Equal(t, test.expected, dryRunLags)
+				lags, err := s.GroupLag("group")
+				require.NoError(t, err)
+				require.Equal(t, lagsBefore, lags)
+
+				// Act
+				resetLags, err := s.ResetGroupOffsets(ctx, "group", test.reset)
+				require.NoError(t, err)
+
+				// Assert
+				require.Equal(t, test.expected, resetLags)
+				lags, err = s.GroupLag("group")
+				require.NoError(t, err)
+				for _, lag := range test.expected {
+					require.Contains(t, lags, lag)
+				}
+			})
+		}
+	})
+}
+
+// TestResetGroupOffsetsErrors verifies that ResetGroupOffsets returns the
+// expected errors, and that offsets aren't reset while the group has members.
+func TestResetGroupOffsetsErrors(t *testing.T) {
+	tester.TestBroker(t, true, func(t *testing.T, s *sebbroker.Broker) {
+		ctx := context.Background()
+
+		_, err := s.AddRecords("topic", tester.MakeRandomRecordBatch(3))
+		require.NoError(t, err)
+		err = s.CommitGroupOffset(ctx, "group", "topic", 1)
+		require.NoError(t, err)
+
+		tests := map[string]struct {
+			group    string
+			reset    sebbroker.OffsetReset
+			expected error
+		}{
+			"no group": {
+				group:    "",
+				reset:    sebbroker.OffsetReset{To: sebbroker.OffsetResetEarliest},
+				expected: seberr.ErrBadInput,
+			},
+			"unknown target": {
+				group:    "group",
+				reset:    sebbroker.OffsetReset{To: "somewhere"},
+				expected: seberr.ErrBadInput,
+			},
+			"no timestamp": {
+				group:    "group",
+				reset:    sebbroker.OffsetReset{To: sebbroker.OffsetResetTimestamp},
+				expected: seberr.ErrBadInput,
+			},
+			"offset past end": {
+				group:    "group",
+				reset:    sebbroker.OffsetReset{To: sebbroker.OffsetResetOffset, Offset: 4},
+				expected: seberr.ErrOffsetOutOfBounds,
+			},
+			"unknown group": {
+				group:    "other",
+				reset:    sebbroker.OffsetReset{To: sebbroker.OffsetResetEarliest},
+				expected: seberr.ErrNotFound,
+			},
+			"unknown topic": {
+				group:    "group",
+				reset:    sebbroker.OffsetReset{To: sebbroker.OffsetResetEarliest, TopicNames: []string{"missing"}},
+				expected: seberr.ErrTopicNotFound,
+			},
+		}
+
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				// Act
+				_, err := s.ResetGroupOffsets(ctx, test.group, test.reset)
+
+				// Assert
+				require.ErrorIs(t, err, test.expected)
+			})
+		}
+
+		_, err = s.JoinGroup("group", "member", []string{"topic"}, time.Minute, "")
+		require.NoError(t, err)
+
+		// Act
+		_, err = s.ResetGroupOffsets(ctx, "group", sebbroker.OffsetReset{To: sebbroker.OffsetResetEarliest})
+
+		// Assert
+		require.ErrorIs(t, err, seberr.ErrBadInput)
+
+		// dry runs are allowed while the group has members
+		lags, err := s.ResetGroupOffsets(ctx, "group", sebbroker.OffsetReset{To: sebbroker.OffsetResetEarliest, DryRun: true})
+		require.NoError(t, err)
+		require.Equal(t, []sebbroker.TopicLag{{TopicName: "topic", CommittedOffset: 0, NextOffset: 3, Lag: 3}}, lags)
+
+		err = s.LeaveGroup("group", "member")
+		require.NoError(t, err)
+		_, err = s.ResetGroupOffsets(ctx, "group", sebbroker.OffsetReset{To: sebbroker.OffsetResetEarliest})
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,390 @@
+package sebbroker
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// GroupOffsets are the offsets committed by a consumer group, and whether
+// delivery of records to it is paused.
+type GroupOffsets struct {
+	// Offsets maps the names of topics to the offset of the next record that
+	// the group will process.
+	Offsets map[string]uint64 `json:"offsets"`
+
+	// CommittedAt is the time of the group's most recent commit.
+	CommittedAt time.Time `json:"committed_at"`
+
+	// Paused pauses delivery of records of all topics to the group, and
+	// PausedTopics pauses delivery of records of individual topics. See
+	// PauseGroup.
+	Paused       bool     `json:"paused,omitempty"`
+	PausedTopics []string `json:"paused_topics,omitempty"`
+}
+
+// activeAt returns the last time that the group was active.
+func (g GroupOffsets) activeAt() time.Time {
+	return g.CommittedAt
+}
+
+func (g GroupOffsets) clone() GroupOffsets {
+	g.Offsets = maps.Clone(g.Offsets)
+	g.PausedTopics = slices.Clone(g.PausedTopics)
+	return g
+}
+
+// empty returns true if the group has no state worth keeping.
+func (g GroupOffsets) empty() bool {
+	return len(g.Offsets) == 0 && !g.Paused && len(g.PausedTopics) == 0
+}
+
+// GroupOffsetStore persists the offsets committed by consumer groups, by
+// group name.
+type GroupOffsetStore interface {
+	LoadGroupOffsets(ctx context.Context) (map[string]GroupOffsets, error)
+	StoreGroupOffsets(ctx context.Context, groups map[string]GroupOffsets) error
+}
+
+// groupOffsetsKey is the key that StorageGroupOffsetStore stores group
+// offsets at. It's not a record batch key, so it can't be mistaken for part of
+// a topic.
+const groupOffsetsKey = "_broker/group_offsets.json"
+
+// StorageGroupOffsetStore is a GroupOffsetStore that keeps the offsets of all
+// groups in a single JSON file in topic storage, next to the topics' record
+// batches.
+type StorageGroupOffsetStore struct {
+	storage sebtopic.Storage
+}
+
+var _ GroupOffsetStore = &StorageGroupOffsetStore{}
+
+func NewStorageGroupOffsetStore(storage sebtopic.Storage) *StorageGroupOffsetStore {
+	return &StorageGroupOffsetStore{storage: storage}
+}
+
+// LoadGroupOffsets returns the stored group offsets. No groups are returned if
+// none have been stored.
+func (s *StorageGroupOffsetStore) LoadGroupOffsets(ctx context.Context) (map[string]GroupOffsets, error) {
+	rdr, err := s.storage.Reader(ctx, groupOffsetsKey)
+	if err != nil {
+		if errors.Is(err, seberr.ErrNotInStorage) {
+			return map[string]GroupOffsets{}, nil
+		}
+		return nil, fmt.Errorf("opening group offsets: %w", err)
+	}
+	defer rdr.Close()
+
+	bs, err := io.ReadAll(rdr)
+	if err != nil {
+		return nil, fmt.Errorf("reading group offsets: %w", err)
+	}
+
+	groups := map[string]GroupOffsets{}
+	err = json.Unmarshal(bs, &groups)
+	if err != nil {
+		return nil, fmt.Errorf("parsing group offsets: %w", err)
+	}
+
+	return groups, nil
+}
+
+// StoreGroupOffsets replaces the stored group offsets with groups.
+func (s *StorageGroupOffsetStore) StoreGroupOffsets(ctx context.Context, groups map[string]GroupOffsets) error {
+	bs, err := json.Marshal(groups)
+	if err != nil {
+		return fmt.Errorf("marshaling group offsets: %w", err)
+	}
+
+	wtr, err := s.storage.Writer(ctx, groupOffsetsKey)
+	if err != nil {
+		return fmt.Errorf("creating group offsets writer: %w", err)
+	}
+
+	_, err = wtr.Write(bs)
+	if err != nil {
+		wtr.Close()
+		return fmt.Errorf("writing group offsets: %w", err)
+	}
+
+	err = wtr.Close()
+	if err != nil {
+		return fmt.Errorf("closing group offsets writer: %w", err)
+	}
+
+	return nil
+}
+
+// LoadGroupOffsets loads the group offsets kept in the broker's
+// GroupOffsetStore, replacing any offsets that have been committed. It must be
+// called before the broker is used if committed offsets are to be kept after
+// a restart.
+func (s *Broker) LoadGroupOffsets(ctx context.Context) error {
+	if s.groupStore == nil {
+		return nil
+	}
+
+	s.groupMu.Lock()
+	defer s.groupMu.Unlock()
+
+	groups, err := s.groupStore.LoadGroupOffsets(ctx)
+	if err != nil {
+		return fmt.Errorf("loading group offsets: %w", err)
+	}
+
+	s.log.Infof("loaded offsets of %d consumer groups", len(groups))
+	s.groups.Store(&groups)
+	return nil
+}
+
+// CommitGroupOffset commits offset as the offset of the next record of
+// topicName that group will process. The offset must not be past the end of
+// topicName; seberr.ErrOffsetOutOfBounds is returned otherwise. The offsets
+// are persisted using the broker's GroupOffsetStore, if it has one.
+func (s *Broker) CommitGroupOffset(ctx context.Context, group string, topicName string, offset uint64) error {
+	if group == "" {
+		return fmt.Errorf("%w: group must be given", seberr.ErrBadInput)
+	}
+	topicName = s.resolveTopicName(topicName)
+
+	exists, err := s.topicExists(topicName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w: '%s'", seberr.ErrTopicNotFound, topicName)
+	}
+
+	tb, err := s.getTopicBatcher(topicName)
+	if err != nil {
+		return err
+	}
+	if nextOffset := tb.topic.NextOffset(); offset > nextOffset {
+		return fmt.Errorf("%w: offset %d is past the end of topic '%s' (%d)", seberr.ErrOffsetOutOfBounds, offset, topicName, nextOffset)
+	}
+
+	s.groupMu.Lock()
+	defer s.groupMu.Unlock()
+
+	groups := maps.Clone(*s.groups.Load())
+	groupOffsets := groups[group].clone()
+	if groupOffsets.Offsets == nil {
+		groupOffsets.Offsets = map[string]uint64{}
+	}
+	groupOffsets.Offsets[topicName] = offset
+	groupOffsets.CommittedAt = time.Now()
+	groups[group] = groupOffsets
+
+	return s.storeGroupOffsets(ctx, groups)
+}
+
+// GroupNames returns the names of consumer groups that have committed
+// offsets or are paused, sorted by name.
+func (s *Broker) GroupNames() []string {
+	groups := *s.groups.Load()
+
+	groupNames := make([]string, 0, len(groups))
+	for group := range groups {
+		groupNames = append(groupNames, group)
+	}
+	slices.Sort(groupNames)
+	return groupNames
+}
+
+// GroupOffsets returns the offsets committed by group, or seberr.ErrNotFound
+// if it hasn't committed any offsets and isn't paused.
+func (s *Broker) GroupOffsets(group string) (GroupOffsets, error) {
+	groupOffsets, ok := (*s.groups.Load())[group]
+	if !ok {
+		return GroupOffsets{}, fmt.Errorf("%w: group '%s'", seberr.ErrNotFound, group)
+	}
+
+	return groupOffsets.clone(), nil
+}
+
+// TopicLag is the lag of a consumer group on a topic, i.e. the number of
+// records that have been added to the topic after the group's committed
+// offset.
+type TopicLag struct {
+	TopicName       string
+	CommittedOffset uint64
+	NextOffset      uint64
+	Lag             uint64
+}
+
+// GroupLag returns the lag of group on each of the topics that it has
+// committed offsets for, sorted by topic name. seberr.ErrNotFound is returned
+// if group hasn't committed any offsets.
+func (s *Broker) GroupLag(group string) ([]TopicLag, error) {
+	groupOffsets, err := s.GroupOffsets(group)
+	if err != nil {
+		return nil, err
+	}
+
+	lags := make([]TopicLag, 0, len(groupOffsets.Offsets))
+	for topicName, committedOffset := range groupOffsets.Offsets {
+		nextOffset, err := s.nextOffset(topicName)
+		if err != nil {
+			return nil, fmt.Errorf("getting next offset of topic '%s': %w", topicName, err)
+		}
+
+		lag := TopicLag{
+			TopicName:       topicName,
+			CommittedOffset: committedOffset,
+			NextOffset:      nextOffset,
+		}
+		if nextOffset > committedOffset {
+			lag.Lag = nextOffset - committedOffset
+		}
+		lags = append(lags, lag)
+	}
+
+	slices.SortFunc(lags, func(a, b TopicLag) int {
+		return cmp.Compare(a.TopicName, b.TopicName)
+	})
+
+	return lags, nil
+}
+
+// StaleGroup is a consumer group that hasn't been active for longer than the
+// broker's GroupMaxIdle, i.e. it has no members and hasn't committed offsets.
+type StaleGroup struct {
+	Group    string
+	ActiveAt time.Time
+}
+
+// StaleGroups returns the consumer groups that haven't been active since
+// GroupMaxIdle before now, sorted by name. These are the groups that
+// ExpireStaleGroups would remove. No groups are stale if GroupMaxIdle is 0.
+func (s *Broker) StaleGroups(now time.Time) []StaleGroup {
+	return s.staleGroups(*s.groups.Load(), now)
+}
+
+// ExpireStaleGroups removes the consumer groups returned by StaleGroups,
+// including their committed offsets, and returns them.
+func (s *Broker) ExpireStaleGroups(ctx context.Context, now time.Time) ([]StaleGroup, error) {
+	s.groupMu.Lock()
+	defer s.groupMu.Unlock()
+
+	groups := *s.groups.Load()
+	staleGroups := s.staleGroups(groups, now)
+	if len(staleGroups) == 0 {
+		return nil, nil
+	}
+
+	groups = maps.Clone(groups)
+	for _, staleGroup := range staleGroups {
+		delete(groups, staleGroup.Group)
+	}
+
+	err := s.storeGroupOffsets(ctx, groups)
+	if err != nil {
+		return nil, err
+	}
+
+	return staleGroups, nil
+}
+
+func (s *Broker) staleGroups(groups map[string]GroupOffsets, now time.Time) []StaleGroup {
+	if s.groupMaxIdle <= 0 {
+		return nil
+	}
+
+	idleSince := now.Add(-s.groupMaxIdle)
+	staleGroups := []StaleGroup{}
+	for group, groupOffsets := range groups {
+		// groups with members are active, even if they haven't committed, and
+		// paused groups are kept until they're resumed.
+		if groupOffsets.Paused || len(groupOffsets.PausedTopics) > 0 || s.coordinator.hasMembers(group, now) {
+			continue
+		}
+
+		if activeAt := groupOffsets.activeAt(); activeAt.Before(idleSince) {
+			staleGroups = append(staleGroups, StaleGroup{Group: group, ActiveAt: activeAt})
+		}
+	}
+
+	slices.SortFunc(staleGroups, func(a, b StaleGroup) int {
+		return cmp.Compare(a.Group, b.Group)
+	})
+
+	return staleGroups
+}
+
+// nextOffset returns the next offset of topicName, which is 0 if the topic
+// doesn't exist.
+func (s *Broker) nextOffset(topicName string) (uint64, error) {
+	exists, err := s.topicExists(topicName)
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	tb, err := s.getTopicBatcher(topicName)
+	if err != nil {
+		return 0, err
+	}
+
+	return tb.topic.NextOffset(), nil
+}
+
+// removeGroupOffsetsOf removes the offsets committed for topicName by all
+// groups, and resumes delivery of topicName to them. Groups that have nothing
+// left are removed.
+func (s *Broker) removeGroupOffsetsOf(topicName string) error {
+	s.groupMu.Lock()
+	defer s.groupMu.Unlock()
+
+	groups := maps.Clone(*s.groups.Load())
+	modified := false
+	for group, groupOffsets := range groups {
+		_, committed := groupOffsets.Offsets[topicName]
+		if !committed && !slices.Contains(groupOffsets.PausedTopics, topicName) {
+			continue
+		}
+		modified = true
+
+		groupOffsets = groupOffsets.clone()
+		delete(groupOffsets.Offsets, topicName)
+		groupOffsets.PausedTopics = slices.DeleteFunc(groupOffsets.PausedTopics, func(name string) bool {
+			return name == topicName
+		})
+		if groupOffsets.empty() {
+			delete(groups, group)
+			continue
+		}
+		groups[group] = groupOffsets
+	}
+	if !modified {
+		return nil
+	}
+
+	// NOTE: the context of the caller isn't available, since DeleteTopic
+	// doesn't take one.
+	return s.storeGroupOffsets(context.Background(), groups)
+}
+
+// storeGroupOffsets persists groups and starts using them.
+// NOTE: you must hold s.groupMu when calling this method!
+func (s *Broker) storeGroupOffsets(ctx context.Context, groups map[string]GroupOffsets) error {
+	// NOTE: read replicas must not overwrite the offsets stored by the
+	// broker writing to the topics.
+	if s.groupStore != nil && !s.readReplica {
+		err := s.groupStore.StoreGroupOffsets(ctx, groups)
+		if err != nil {
+			return fmt.Errorf("storing group offsets: %w", err)
+		}
+	}
+
+	s.groups.Store(&groups)
+	return nil
+}
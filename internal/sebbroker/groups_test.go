@@ -0,0 +1,190 @@
+package sebbroker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGroupLag verifies that GroupLag() returns the number of records added
+// to each topic after the offsets committed by a consumer group.
+func TestGroupLag(t *testing.T) {
+	tester.TestBroker(t, true, func(t *testing.T, s *sebbroker.Broker) {
+		ctx := context.Background()
+		const group = "group"
+
+		_, err := s.AddRecords("topic-a", tester.MakeRandomRecordBatch(10))
+		require.NoError(t, err)
+		_, err = s.AddRecords("topic-b", tester.MakeRandomRecordBatch(5))
+		require.NoError(t, err)
+
+		err = s.CommitGroupOffset(ctx, group, "topic-b", 5)
+		require.NoError(t, err)
+		err = s.CommitGroupOffset(ctx, group, "topic-a", 3)
+		require.NoError(t, err)
+
+		_, err = s.AddRecords("topic-b", tester.MakeRandomRecordBatch(2))
+		require.NoError(t, err)
+
+		// Act
+		got, err := s.GroupLag(group)
+
+		// Assert
+		require.NoError(t, err)
+		require.Equal(t, []sebbroker.TopicLag{
+			{TopicName: "topic-a", CommittedOffset: 3, NextOffset: 10, Lag: 7},
+			{TopicName: "topic-b", CommittedOffset: 5, NextOffset: 7, Lag: 2},
+		}, got)
+		require.Equal(t, []string{group}, s.GroupNames())
+
+		_, err = s.GroupLag("unknown-group")
+		require.ErrorIs(t, err, seberr.ErrNotFound)
+	})
+}
+
+// TestCommitGroupOffsetErrors verifies that CommitGroupOffset() returns the
+// expected errors for invalid commits, and that nothing is committed.
+func TestCommitGroupOffsetErrors(t *testing.T) {
+	tests := map[string]struct {
+		group     string
+		topicName string
+		offset    uint64
+		err       error
+	}{
+		"no group":        {group: "", topicName: "topic", offset: 0, err: seberr.ErrBadInput},
+		"unknown topic":   {group: "group", topicName: "unknown", offset: 0, err: seberr.ErrTopicNotFound},
+		"past end":        {group: "group", topicName: "topic", offset: 4, err: seberr.ErrOffsetOutOfBounds},
+		"at end is valid": {group: "group", topicName: "topic", offset: 3},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tester.TestBroker(t, false, func(t *testing.T, s *sebbroker.Broker) {
+				err := s.CreateTopic("topic")
+				require.NoError(t, err)
+				_, err = s.AddRecords("topic", tester.MakeRandomRecordBatch(3))
+				require.NoError(t, err)
+
+				// Act
+				err = s.CommitGroupOffset(context.Background(), test.group, test.topicName, test.offset)
+
+				// Assert
+				require.ErrorIs(t, err, test.err)
+				if test.err != nil {
+					require.Empty(t, s.GroupNames())
+				}
+			})
+		})
+	}
+}
+
+// TestGroupOffsetsPersisted verifies that offsets stored using
+// StorageGroupOffsetStore are loaded by new brokers, and that offsets of
+// deleted topics are removed.
+func TestGroupOffsetsPersisted(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, bs sebtopic.Storage, cache *sebcache.Cache) {
+		ctx := context.Background()
+		const group = "group"
+
+		newBroker := func() *sebbroker.Broker {
+			s := sebbroker.New(log,
+				func(log logger.Logger, topicName string) (*sebtopic.Topic, error) {
+					return sebtopic.New(log, bs, topicName, cache)
+				},
+				sebbroker.WithNullBatcher(),
+				sebbroker.WithGroupOffsetStore(sebbroker.NewStorageGroupOffsetStore(bs)),
+			)
+			err := s.LoadGroupOffsets(ctx)
+			require.NoError(t, err)
+			return s
+		}
+
+		s1 := newBroker()
+		for _, topicName := range []string{"kept", "deleted"} {
+			_, err := s1.AddRecords(topicName, tester.MakeRandomRecordBatch(2))
+			require.NoError(t, err)
+
+			err = s1.CommitGroupOffset(ctx, group, topicName, 1)
+			require.NoError(t, err)
+		}
+
+		// Act
+		err := s1.DeleteTopic("deleted")
+		require.NoError(t, err)
+
+		// Assert
+		s2 := newBroker()
+		groupOffsets, err := s2.GroupOffsets(group)
+		require.NoError(t, err)
+		require.Equal(t, map[string]uint64{"kept": 1}, groupOffsets.Offsets)
+		require.False(t, groupOffsets.CommittedAt.IsZero())
+	})
+}
+
+// TestExpireStaleGroups verifies that StaleGroups() returns the groups that
+// haven't committed offsets for longer than GroupMaxIdle, and that
+// ExpireStaleGroups() removes them, including their persisted offsets.
+func TestExpireStaleGroups(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, bs sebtopic.Storage, cache *sebcache.Cache) {
+		ctx := context.Background()
+		const maxIdle = time.Hour
+
+		newBroker := func() *sebbroker.Broker {
+			s := sebbroker.New(log,
+				func(log logger.Logger, topicName string) (*sebtopic.Topic, error) {
+					return sebtopic.New(log, bs, topicName, cache)
+				},
+				sebbroker.WithNullBatcher(),
+				sebbroker.WithGroupOffsetStore(sebbroker.NewStorageGroupOffsetStore(bs)),
+				sebbroker.WithGroupMaxIdle(maxIdle),
+			)
+			err := s.LoadGroupOffsets(ctx)
+			require.NoError(t, err)
+			return s
+		}
+
+		s1 := newBroker()
+		_, err := s1.AddRecords("topic", tester.MakeRandomRecordBatch(1))
+		require.NoError(t, err)
+
+		err = s1.CommitGroupOffset(ctx, "stale", "topic", 1)
+		require.NoError(t, err)
+		stale, err := s1.GroupOffsets("stale")
+		require.NoError(t, err)
+
+		// groups are only stale once they've been idle for longer than maxIdle
+		require.Empty(t, s1.StaleGroups(time.Now()))
+
+		// make sure that "active" is committed after "stale"
+		time.Sleep(time.Millisecond)
+
+		err = s1.CommitGroupOffset(ctx, "active", "topic", 1)
+		require.NoError(t, err)
+		active, err := s1.GroupOffsets("active")
+		require.NoError(t, err)
+		now := active.CommittedAt.Add(maxIdle)
+
+		expected := []sebbroker.StaleGroup{{Group: "stale", ActiveAt: stale.CommittedAt}}
+		require.Equal(t, expected, s1.StaleGroups(now))
+
+		// Act
+		expired, err := s1.ExpireStaleGroups(ctx, now)
+
+		// Assert
+		require.NoError(t, err)
+		require.Equal(t, expected, expired)
+		require.Equal(t, []string{"active"}, s1.GroupNames())
+		require.Empty(t, s1.StaleGroups(now))
+
+		s2 := newBroker()
+		require.Equal(t, []string{"active"}, s2.GroupNames())
+	})
+}
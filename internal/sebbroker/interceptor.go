@@ -0,0 +1,106 @@
+package sebbroker
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// ProduceInterceptor is called with the records added to topicName before
+// they're handed to the topic's batcher, and returns the records to add in
+// their place. This allows records to be validated, enriched or scrubbed, and
+// metrics to be collected, for every topic or for some topics only. See
+// ForTopics.
+//
+// Records that are removed by a ProduceInterceptor are not added, and are not
+// given an offset. If a ProduceInterceptor returns an error, none of the
+// records are added and the error is returned to the caller; errors wrapping
+// seberr.ErrBadInput are treated as the caller's fault, e.g. by the HTTP API.
+//
+// ProduceInterceptors must be safe for concurrent use, and must not modify
+// the data of the batch that they're given, since it may be shared with the
+// caller; they must return a new batch instead.
+type ProduceInterceptor func(topicName string, batch sebrecords.Batch) (sebrecords.Batch, error)
+
+// WithProduceInterceptor adds interceptor to the broker's produce
+// interceptors. Interceptors are called in the order that they're added, each
+// receiving the batch returned by the previous one. They're called after write
+// freezes have been checked and before topic retention is applied, with the
+// name of the topic that records are added to, even if they're added using an
+// alias.
+func WithProduceInterceptor(interceptor ProduceInterceptor) func(*Opts) {
+	return func(o *Opts) {
+		o.ProduceInterceptors = append(o.ProduceInterceptors, interceptor)
+	}
+}
+
+// ForTopics returns a ProduceInterceptor that calls interceptor for topics
+// whose name matches pattern, using the syntax of path.Match. Batches added to
+// other topics are returned unmodified.
+func ForTopics(pattern string, interceptor ProduceInterceptor) (ProduceInterceptor, error) {
+	_, err := path.Match(pattern, "")
+	if err != nil {
+		return nil, fmt.Errorf("%w: pattern '%s': %s", seberr.ErrBadInput, pattern, err)
+	}
+
+	return func(topicName string, batch sebrecords.Batch) (sebrecords.Batch, error) {
+		matched, _ := path.Match(pattern, topicName)
+		if !matched {
+			return batch, nil
+		}
+		return interceptor(topicName, batch)
+	}, nil
+}
+
+// intercept calls the broker's produce interceptors in order, returning the
+// batch returned by the last of them.
+func (s *Broker) intercept(topicName string, batch sebrecords.Batch) (sebrecords.Batch, error) {
+	for i, interceptor := range s.produceInterceptors {
+		var err error
+		batch, err = interceptor(topicName, batch)
+		if err != nil {
+			return sebrecords.Batch{}, fmt.Errorf("produce interceptor %d rejected batch: %w", i, err)
+		}
+
+		err = validateBatch(batch)
+		if err != nil {
+			return sebrecords.Batch{}, fmt.Errorf("produce interceptor %d returned invalid batch: %w", i, err)
+		}
+		batch.Traces = sebrecords.ClampTraces(batch.Traces, uint32(batch.Len()))
+	}
+
+	return batch, nil
+}
+
+// validateBatch returns seberr.ErrBadInput if the sizes, data and per-record
+// fields of batch don't agree.
+func validateBatch(batch sebrecords.Batch) error {
+	totalSize := 0
+	for _, size := range batch.Sizes {
+		totalSize += int(size)
+	}
+	if totalSize != len(batch.Data) {
+		return fmt.Errorf("%w: record sizes total %d bytes, data is %d bytes", seberr.ErrBadInput, totalSize, len(batch.Data))
+	}
+
+	numRecords := batch.Len()
+	fields := []struct {
+		name   string
+		length int
+	}{
+		{"expiry times", len(batch.Expires)},
+		{"pointers", len(batch.Pointers)},
+		{"timestamps", len(batch.Timestamps)},
+		{"keys", len(batch.Keys)},
+		{"headers", len(batch.Headers)},
+	}
+	for _, field := range fields {
+		if field.length > 0 && field.length != numRecords {
+			return fmt.Errorf("%w: %d %s given for %d records", seberr.ErrBadInput, field.length, field.name, numRecords)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package sebbroker_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestProduceInterceptorsOrder verifies that produce interceptors are called in
+// the order they were added, each receiving the batch returned by the previous
+// one, and that the batch returned by the last one is added.
+func TestProduceInterceptorsOrder(t *testing.T) {
+	appendSuffix := func(suffix string) sebbroker.ProduceInterceptor {
+		return func(topicName string, batch sebrecords.Batch) (sebrecords.Batch, error) {
+			records := batch.IndividualRecords()
+			for i := range records {
+				records[i] = slices.Concat(records[i], []byte(suffix))
+			}
+			return tester.RecordsToBatch(records), nil
+		}
+	}
+
+	s := tester.Broker(t, sebtopic.NewMemoryStorage(log),
+		sebbroker.WithProduceInterceptor(appendSuffix("-a")),
+		sebbroker.WithProduceInterceptor(appendSuffix("-b")),
+	)
+
+	// Act
+	offsets, err := s.AddRecords("topic", tester.RecordsToBatch([][]byte{[]byte("0"), []byte("1")}))
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, []uint64{0, 1}, offsets)
+
+	batch := tester.NewBatch(10, 4096)
+	err = s.GetRecords(context.Background(), &batch, "topic", 0, 10, 0)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("0-a-b"), []byte("1-a-b")}, batch.IndividualRecords())
+}
+
+// TestProduceInterceptorsDropRecords verifies that records removed by a produce
+// interceptor are not added or given offsets, and that nothing is added when
+// all records are removed.
+func TestProduceInterceptorsDropRecords(t *testing.T) {
+	dropEmpty := func(topicName string, batch sebrecords.Batch) (sebrecords.Batch, error) {
+		records := [][]byte{}
+		for _, record := range batch.IndividualRecords() {
+			if len(record) > 0 {
+				records = append(records, record)
+			}
+		}
+		return tester.RecordsToBatch(records), nil
+	}
+
+	s := tester.Broker(t, sebtopic.NewMemoryStorage(log), sebbroker.WithProduceInterceptor(dropEmpty))
+
+	// Act
+	offsets, err := s.AddRecords("topic", tester.RecordsToBatch([][]byte{[]byte("a"), {}, []byte("b")}))
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, []uint64{0, 1}, offsets)
+
+	offsets, err = s.AddRecords("topic", tester.RecordsToBatch([][]byte{{}}))
+	require.NoError(t, err)
+	require.Empty(t, offsets)
+
+	metadata, err := s.Metadata("topic")
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), metadata.NextOffset)
+}
+
+// TestProduceInterceptorsErrors verifies that no records are added when a
+// produce interceptor returns an error or an invalid batch, that the error is
+// returned, and that the following interceptors aren't called.
+func TestProduceInterceptorsErrors(t *testing.T) {
+	errRejected := errors.New("rejected")
+
+	tests := map[string]struct {
+		interceptor sebbroker.ProduceInterceptor
+		err         error
+	}{
+		"error": {
+			interceptor: func(topicName string, batch sebrecords.Batch) (sebrecords.Batch, error) {
+				return batch, fmt.Errorf("%w: %w", seberr.ErrBadInput, errRejected)
+			},
+			err: errRejected,
+		},
+		"sizes don't match data": {
+			interceptor: func(topicName string, batch sebrecords.Batch) (sebrecords.Batch, error) {
+				batch.Sizes = append([]uint32{}, batch.Sizes[1:]...)
+				return batch, nil
+			},
+			err: seberr.ErrBadInput,
+		},
+		"expires don't match records": {
+			interceptor: func(topicName string, batch sebrecords.Batch) (sebrecords.Batch, error) {
+				batch.Expires = []int64{0}
+				return batch, nil
+			},
+			err: seberr.ErrBadInput,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			called := false
+			s := tester.Broker(t, sebtopic.NewMemoryStorage(log),
+				sebbroker.WithProduceInterceptor(test.interceptor),
+				sebbroker.WithProduceInterceptor(func(topicName string, batch sebrecords.Batch) (sebrecords.Batch, error) {
+					called = true
+					return batch, nil
+				}),
+			)
+
+			// Act
+			_, err := s.AddRecords("topic", tester.MakeRandomRecordBatch(2))
+
+			// Assert
+			require.ErrorIs(t, err, test.err)
+			require.False(t, called)
+
+			metadata, err := s.Metadata("topic")
+			require.NoError(t, err)
+			require.Equal(t, uint64(0), metadata.NextOffset)
+		})
+	}
+}
+
+// TestForTopics verifies that interceptors returned by ForTopics are only
+// called for topics matching the pattern, and that they're called with the
+// name of the topic that an alias refers to.
+func TestForTopics(t *testing.T) {
+	topicNames := []string{}
+	interceptor, err := sebbroker.ForTopics("orders-*", func(topicName string, batch sebrecords.Batch) (sebrecords.Batch, error) {
+		topicNames = append(topicNames, topicName)
+		return batch, nil
+	})
+	require.NoError(t, err)
+
+	s := tester.Broker(t, sebtopic.NewMemoryStorage(log), sebbroker.WithProduceInterceptor(interceptor))
+	err = s.SetTopicAlias(context.Background(), "alias", "orders-eu")
+	require.NoError(t, err)
+
+	// Act
+	for _, topicName := range []string{"orders-us", "payments", "alias"} {
+		_, err := s.AddRecords(topicName, tester.MakeRandomRecordBatch(1))
+		require.NoError(t, err)
+	}
+
+	// Assert
+	require.Equal(t, []string{"orders-us", "orders-eu"}, topicNames)
+
+	_, err = sebbroker.ForTopics("[", interceptor)
+	require.ErrorIs(t, err, seberr.ErrBadInput)
+}
@@ -0,0 +1,14 @@
+package sebbroker
+
+import "strings"
+
+// InternalTopicPrefix is the prefix of the names of internal topics, e.g.
+// "_audit", "_offsets" and "_schemas". Internal topics are reserved for use by
+// the broker and its operators; they're hidden from clients and protected
+// from being modified by them.
+const InternalTopicPrefix = "_"
+
+// IsInternalTopic returns whether topicName is the name of an internal topic.
+func IsInternalTopic(topicName string) bool {
+	return strings.HasPrefix(topicName, InternalTopicPrefix)
+}
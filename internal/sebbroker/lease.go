@@ -0,0 +1,63 @@
+package sebbroker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+)
+
+// RenewLeases renews the leases of all topics that have been used by the
+// broker. Topics whose lease was lost reject writes until the broker is
+// restarted. See sebtopic.WithLease.
+func (s *Broker) RenewLeases(ctx context.Context) error {
+	var errs []error
+	for topicName, tb := range s.madeTopicBatchers() {
+		err := tb.topic.RenewLease(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("renewing lease of topic '%s': %w", topicName, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ReleaseLeases releases the leases of all topics that have been used by the
+// broker, allowing other brokers to take over the topics right away, e.g.
+// when shutting down.
+func (s *Broker) ReleaseLeases(ctx context.Context) error {
+	var errs []error
+	for topicName, tb := range s.madeTopicBatchers() {
+		err := tb.topic.ReleaseLease(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("releasing lease of topic '%s': %w", topicName, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// LeaseLoop renews the leases of all topics used by the broker every interval,
+// until ctx expires. interval must be well below the TTL of the leases, such
+// that a single failed renewal doesn't make the leases expire.
+func LeaseLoop(ctx context.Context, log logger.Logger, broker *Broker, interval time.Duration) error {
+	log = log.WithField("interval", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		err := broker.RenewLeases(ctx)
+		if err != nil {
+			log.Errorf("renewing leases: %s", err)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package sebbroker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBrokerLeases verifies that a broker can't write to topics whose leases
+// are held by another broker, that it can take over once the leases are
+// released, and that the broker that released them rejects writes and fails to
+// renew them.
+func TestBrokerLeases(t *testing.T) {
+	ctx := context.Background()
+	storage := sebtopic.NewMemoryStorage(log)
+
+	newBroker := func(holder string) *sebbroker.Broker {
+		cache, err := sebcache.NewMemoryCache(log)
+		require.NoError(t, err)
+		return sebbroker.New(log,
+			sebbroker.NewStorageTopicFactory(storage, cache, sebbroker.WithTopicOpts(sebtopic.WithLease(holder, time.Minute))),
+			sebbroker.WithNullBatcher(),
+		)
+	}
+
+	brokerA := newBroker("broker-a")
+	_, err := brokerA.AddRecords("topic", tester.MakeRandomRecordBatch(2))
+	require.NoError(t, err)
+	require.NoError(t, brokerA.RenewLeases(ctx))
+
+	brokerB := newBroker("broker-b")
+	_, err = brokerB.AddRecords("topic", tester.MakeRandomRecordBatch(2))
+	require.ErrorIs(t, err, seberr.ErrLeaseLost)
+
+	// Act
+	err = brokerA.ReleaseLeases(ctx)
+	require.NoError(t, err)
+
+	// Assert
+	_, err = brokerB.AddRecords("topic", tester.MakeRandomRecordBatch(2))
+	require.NoError(t, err)
+
+	_, err = brokerA.AddRecords("topic", tester.MakeRandomRecordBatch(2))
+	require.ErrorIs(t, err, seberr.ErrWritesFrozen)
+	require.ErrorIs(t, brokerA.RenewLeases(ctx), seberr.ErrLeaseLost)
+}
@@ -0,0 +1,36 @@
+package sebbroker
+
+import (
+	"context"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+)
+
+// MergeLoop periodically merges runs of small record batches into larger
+// record batches of at most maxRecords records and maxBytes bytes. It runs
+// until ctx expires; errors from merging record batches are logged and retried
+// at the next interval.
+func MergeLoop(ctx context.Context, log logger.Logger, broker *Broker, interval time.Duration, maxRecords int, maxBytes int) error {
+	log = log.WithField("interval", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		merged, err := broker.MergeBatches(maxRecords, maxBytes)
+		if err != nil {
+			log.Errorf("merging record batches: %s", err)
+		}
+
+		if merged > 0 {
+			log.Infof("merged %d record batches", merged)
+		}
+	}
+}
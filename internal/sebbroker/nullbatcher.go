@@ -1,6 +1,7 @@
 package sebbroker
 
 import (
+	"context"
 	"fmt"
 	"sync"
 
@@ -21,12 +22,20 @@ func NewNullBatcher(persist Persist) *nullBatcher {
 }
 
 func (b *nullBatcher) AddRecords(batch sebrecords.Batch) ([]uint64, error) {
+	result, err := b.AddRecordsResult(context.Background(), batch)
+	return result.Offsets, err
+}
+
+// AddRecordsResult is the same as AddRecords, but also returns the ID of the
+// record batch that the records were persisted in. Since records are persisted
+// right away, they never wait for a batch.
+func (b *nullBatcher) AddRecordsResult(_ context.Context, batch sebrecords.Batch) (AddResult, error) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
 	offsets, err := b.persist(batch)
 	if err != nil {
-		return nil, err
+		return AddResult{}, err
 	}
 
 	if len(offsets) != batch.Len() {
@@ -34,5 +43,10 @@ func (b *nullBatcher) AddRecords(batch sebrecords.Batch) ([]uint64, error) {
 		panic(fmt.Sprintf("unexpected number of offsets returned %d, expected %d", len(offsets), batch.Len()))
 	}
 
-	return offsets, nil
+	result := AddResult{Offsets: offsets}
+	if len(offsets) > 0 {
+		result.BatchID = offsets[0]
+		result.HasBatch = true
+	}
+	return result, nil
 }
@@ -0,0 +1,187 @@
+package sebbroker
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// TopicSpec declares a topic and its configuration. See ProvisionTopics.
+type TopicSpec struct {
+	Name string
+
+	// Retention is the retention of the topic; see SetTopicRetention.
+	// Retention is disabled if 0.
+	Retention time.Duration
+
+	// Labels are the labels of the topic. Labels that the topic has, but
+	// which aren't given, are removed.
+	Labels map[string]string
+}
+
+// ProvisionOpts configures ProvisionTopics.
+type ProvisionOpts struct {
+	// Prune deletes the topics returned by TopicNames() that aren't declared.
+	// Internal topics are never deleted.
+	Prune bool
+
+	// DryRun reports the changes that would be made without making them.
+	DryRun bool
+}
+
+// ProvisionResult describes the changes made by ProvisionTopics.
+type ProvisionResult struct {
+	Created   []string
+	Updated   []string
+	Unchanged []string
+	Deleted   []string
+
+	// Errors holds the errors of topics that couldn't be reconciled, by
+	// topic name.
+	Errors map[string]error
+}
+
+// ProvisionTopics reconciles the broker's topics with specs: topics that don't
+// exist are created, and the retention and labels of topics are set to those
+// given by their spec. If opts.Prune is true, topics that aren't declared are
+// deleted. This allows topics to be managed declaratively, e.g. by
+// infrastructure-as-code tooling.
+//
+// specs are validated before any changes are made; an error wrapping
+// seberr.ErrBadInput is returned if they're invalid. Topics that fail to be
+// reconciled are listed in ProvisionResult.Errors; the remaining topics are
+// still reconciled.
+//
+// NOTE: like retention and labels themselves, only the existence of topics
+// outlives Broker.
+func (s *Broker) ProvisionTopics(specs []TopicSpec, opts ProvisionOpts) (ProvisionResult, error) {
+	if s.readReplica {
+		return ProvisionResult{}, errReadReplica
+	}
+
+	err := s.validateTopicSpecs(specs)
+	if err != nil {
+		return ProvisionResult{}, err
+	}
+
+	result := ProvisionResult{}
+	addError := func(topicName string, err error) {
+		if result.Errors == nil {
+			result.Errors = make(map[string]error)
+		}
+		result.Errors[topicName] = err
+	}
+
+	declared := make(map[string]struct{}, len(specs))
+	for _, spec := range specs {
+		declared[spec.Name] = struct{}{}
+
+		created, updated, err := s.provisionTopic(spec, opts.DryRun)
+		switch {
+		case err != nil:
+			addError(spec.Name, err)
+		case created:
+			result.Created = append(result.Created, spec.Name)
+		case updated:
+			result.Updated = append(result.Updated, spec.Name)
+		default:
+			result.Unchanged = append(result.Unchanged, spec.Name)
+		}
+	}
+
+	if opts.Prune {
+		for _, topicName := range s.TopicNames() {
+			if _, ok := declared[topicName]; ok || IsInternalTopic(topicName) {
+				continue
+			}
+
+			if !opts.DryRun {
+				err := s.DeleteTopic(topicName)
+				if err != nil {
+					addError(topicName, err)
+					continue
+				}
+			}
+			result.Deleted = append(result.Deleted, topicName)
+		}
+	}
+
+	s.log.Infof("provisioned topics (dry run: %t): %d created, %d updated, %d deleted, %d failed", opts.DryRun, len(result.Created), len(result.Updated), len(result.Deleted), len(result.Errors))
+
+	return result, nil
+}
+
+// validateTopicSpecs returns an error wrapping seberr.ErrBadInput if specs
+// can't be provisioned.
+func (s *Broker) validateTopicSpecs(specs []TopicSpec) error {
+	aliases := s.TopicAliases()
+
+	seen := make(map[string]struct{}, len(specs))
+	for _, spec := range specs {
+		if spec.Name == "" {
+			return fmt.Errorf("%w: topic name must be given", seberr.ErrBadInput)
+		}
+		if _, ok := seen[spec.Name]; ok {
+			return fmt.Errorf("%w: topic '%s' declared more than once", seberr.ErrBadInput, spec.Name)
+		}
+		seen[spec.Name] = struct{}{}
+
+		if _, ok := aliases[spec.Name]; ok {
+			return fmt.Errorf("%w: '%s' is an alias", seberr.ErrBadInput, spec.Name)
+		}
+		if spec.Retention < 0 {
+			return fmt.Errorf("%w: retention of topic '%s' must not be negative", seberr.ErrBadInput, spec.Name)
+		}
+		for key, value := range spec.Labels {
+			if key == "" || value == "" {
+				return fmt.Errorf("%w: labels of topic '%s' must have non-empty keys and values", seberr.ErrBadInput, spec.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// provisionTopic creates the topic of spec if it doesn't exist, and sets its
+// configuration to that of spec. It returns whether the topic was created, and
+// whether the configuration of an existing topic was updated.
+func (s *Broker) provisionTopic(spec TopicSpec, dryRun bool) (created bool, updated bool, err error) {
+	exists, err := s.topicExists(spec.Name)
+	if err != nil {
+		return false, false, err
+	}
+
+	if !exists && !dryRun {
+		err := s.CreateTopic(spec.Name)
+		if errors.Is(err, seberr.ErrTopicAlreadyExists) {
+			// NOTE: the topic was created concurrently.
+			exists = true
+		} else if err != nil {
+			return false, false, err
+		}
+	}
+
+	labels := s.TopicLabels(spec.Name)
+	changed := s.TopicRetention(spec.Name) != spec.Retention || !maps.Equal(labels, spec.Labels)
+	if changed && !dryRun {
+		s.SetTopicRetention(spec.Name, spec.Retention)
+
+		// NOTE: SetTopicLabels merges labels, so labels that aren't declared
+		// must be removed explicitly.
+		setLabels := maps.Clone(spec.Labels)
+		if setLabels == nil {
+			setLabels = make(map[string]string, len(labels))
+		}
+		for key := range labels {
+			if _, ok := spec.Labels[key]; !ok {
+				setLabels[key] = ""
+			}
+		}
+		s.SetTopicLabels(spec.Name, setLabels)
+	}
+
+	return !exists, exists && changed, nil
+}
@@ -0,0 +1,105 @@
+package sebbroker_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBrokerProvisionTopics verifies that ProvisionTopics() creates missing
+// topics, sets the retention and labels of topics to those declared, leaves
+// topics that match their spec unchanged, and deletes undeclared topics when
+// pruning.
+func TestBrokerProvisionTopics(t *testing.T) {
+	tester.TestBroker(t, false, func(t *testing.T, s *sebbroker.Broker) {
+		for _, topicName := range []string{"unchanged", "updated", "extra"} {
+			err := s.CreateTopic(topicName)
+			require.NoError(t, err)
+		}
+		s.SetTopicLabels("updated", map[string]string{"team": "a", "stale": "yes"})
+
+		specs := []sebbroker.TopicSpec{
+			{Name: "unchanged"},
+			{Name: "updated", Retention: time.Hour, Labels: map[string]string{"team": "b"}},
+			{Name: "created", Labels: map[string]string{"team": "c"}},
+		}
+
+		// Act
+		result, err := s.ProvisionTopics(specs, sebbroker.ProvisionOpts{Prune: true})
+
+		// Assert
+		require.NoError(t, err)
+		require.Equal(t, []string{"created"}, result.Created)
+		require.Equal(t, []string{"updated"}, result.Updated)
+		require.Equal(t, []string{"unchanged"}, result.Unchanged)
+		require.Equal(t, []string{"extra"}, result.Deleted)
+		require.Empty(t, result.Errors)
+
+		require.Equal(t, []string{"created", "unchanged", "updated"}, s.TopicNames())
+		require.Equal(t, time.Hour, s.TopicRetention("updated"))
+		require.Equal(t, map[string]string{"team": "b"}, s.TopicLabels("updated"))
+		require.Equal(t, map[string]string{"team": "c"}, s.TopicLabels("created"))
+
+		// Act
+		result, err = s.ProvisionTopics(specs, sebbroker.ProvisionOpts{Prune: true})
+
+		// Assert
+		require.NoError(t, err)
+		require.Equal(t, []string{"unchanged", "updated", "created"}, result.Unchanged)
+		require.Empty(t, result.Created)
+		require.Empty(t, result.Updated)
+		require.Empty(t, result.Deleted)
+	})
+}
+
+// TestBrokerProvisionTopicsDryRun verifies that ProvisionTopics() reports the
+// changes it would make without making them when DryRun is true.
+func TestBrokerProvisionTopicsDryRun(t *testing.T) {
+	tester.TestBroker(t, false, func(t *testing.T, s *sebbroker.Broker) {
+		err := s.CreateTopic("extra")
+		require.NoError(t, err)
+
+		specs := []sebbroker.TopicSpec{{Name: "created", Retention: time.Minute}}
+
+		// Act
+		result, err := s.ProvisionTopics(specs, sebbroker.ProvisionOpts{Prune: true, DryRun: true})
+
+		// Assert
+		require.NoError(t, err)
+		require.Equal(t, []string{"created"}, result.Created)
+		require.Equal(t, []string{"extra"}, result.Deleted)
+
+		require.Equal(t, []string{"extra"}, s.TopicNames())
+		require.Equal(t, time.Duration(0), s.TopicRetention("created"))
+	})
+}
+
+// TestBrokerProvisionTopicsInvalid verifies that ProvisionTopics() returns
+// seberr.ErrBadInput without making any changes if its specs are invalid.
+func TestBrokerProvisionTopicsInvalid(t *testing.T) {
+	tests := map[string]struct {
+		specs []sebbroker.TopicSpec
+	}{
+		"empty name":         {specs: []sebbroker.TopicSpec{{Name: ""}}},
+		"duplicate":          {specs: []sebbroker.TopicSpec{{Name: "topic"}, {Name: "topic"}}},
+		"negative retention": {specs: []sebbroker.TopicSpec{{Name: "topic"}, {Name: "other", Retention: -time.Second}}},
+		"empty label value":  {specs: []sebbroker.TopicSpec{{Name: "topic", Labels: map[string]string{"team": ""}}}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tester.TestBroker(t, false, func(t *testing.T, s *sebbroker.Broker) {
+				// Act
+				_, err := s.ProvisionTopics(test.specs, sebbroker.ProvisionOpts{})
+
+				// Assert
+				require.ErrorIs(t, err, seberr.ErrBadInput)
+				require.Empty(t, s.TopicNames())
+			})
+		})
+	}
+}
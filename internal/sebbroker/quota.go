@@ -0,0 +1,310 @@
+package sebbroker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// Quota limits the number of bytes that can be produced to topics, such that a
+// single tenant can't fill the disk of a shared broker. A quota applies either
+// to the topics of a namespace, or to the records produced by a principal.
+type Quota struct {
+	// Namespace is the prefix of the names of the topics that the quota
+	// applies to, e.g. "team-a/".
+	Namespace string
+
+	// Principal is the identity of the producers that the quota applies to,
+	// as given by ContextWithPrincipal.
+	Principal string
+
+	// ProducedBytesPerDay is the number of bytes of records that can be
+	// produced per UTC day. Unlimited if 0.
+	ProducedBytesPerDay int64
+
+	// RetainedBytes is the number of bytes that the namespace's topics can
+	// use in backing storage, as given by sebtopic.Topic.StorageUsage.
+	// Unlimited if 0. Only namespace quotas can limit retained bytes.
+	RetainedBytes int64
+}
+
+// Name returns a name that identifies the quota in errors and usage.
+func (q Quota) Name() string {
+	if q.Principal != "" {
+		return "principal:" + q.Principal
+	}
+	return "namespace:" + q.Namespace
+}
+
+func (q Quota) validate() error {
+	if (q.Namespace == "") == (q.Principal == "") {
+		return fmt.Errorf("exactly one of namespace and principal must be set")
+	}
+	if q.ProducedBytesPerDay < 0 || q.RetainedBytes < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	if q.Principal != "" && q.RetainedBytes > 0 {
+		return fmt.Errorf("retained bytes can only be limited for namespaces")
+	}
+	return nil
+}
+
+// appliesTo returns whether the quota applies to records produced to
+// topicName by principal.
+func (q Quota) appliesTo(topicName string, principal string) bool {
+	if q.Principal != "" {
+		return q.Principal == principal
+	}
+	return strings.HasPrefix(topicName, q.Namespace)
+}
+
+// ParseQuotas parses a JSON list of quotas, e.g.
+//
+//	[{"namespace": "team-a/", "produced_bytes_per_day": 1073741824, "retained_bytes": 10737418240}]
+func ParseQuotas(bs []byte) ([]Quota, error) {
+	jsonQuotas := []struct {
+		Namespace           string `json:"namespace"`
+		Principal           string `json:"principal"`
+		ProducedBytesPerDay int64  `json:"produced_bytes_per_day"`
+		RetainedBytes       int64  `json:"retained_bytes"`
+	}{}
+	err := json.Unmarshal(bs, &jsonQuotas)
+	if err != nil {
+		return nil, fmt.Errorf("parsing quotas: %w", err)
+	}
+
+	quotas := make([]Quota, 0, len(jsonQuotas))
+	for i, jsonQuota := range jsonQuotas {
+		quota := Quota{
+			Namespace:           jsonQuota.Namespace,
+			Principal:           jsonQuota.Principal,
+			ProducedBytesPerDay: jsonQuota.ProducedBytesPerDay,
+			RetainedBytes:       jsonQuota.RetainedBytes,
+		}
+
+		err := quota.validate()
+		if err != nil {
+			return nil, fmt.Errorf("quota %d: %w", i, err)
+		}
+		quotas = append(quotas, quota)
+	}
+
+	return quotas, nil
+}
+
+// QuotaExceededError is returned when adding records would exceed a quota. It
+// wraps seberr.ErrQuotaExceeded.
+type QuotaExceededError struct {
+	Quota string
+	Limit string
+	Used  int64
+	Max   int64
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s: %s of quota '%s' would be %d bytes, max is %d", seberr.ErrQuotaExceeded, e.Limit, e.Quota, e.Used, e.Max)
+}
+
+func (e *QuotaExceededError) Unwrap() error {
+	return seberr.ErrQuotaExceeded
+}
+
+// QuotaUsage describes a quota and how much of it has been used.
+type QuotaUsage struct {
+	Quota
+
+	// ProducedBytesToday is the number of bytes produced within the quota
+	// since the start of the current UTC day.
+	ProducedBytesToday int64
+
+	// UsedRetainedBytes is the number of bytes used in backing storage by the
+	// topics of the quota's namespace. It's 0 for principal quotas.
+	UsedRetainedBytes int64
+}
+
+type quotaState struct {
+	quota    Quota
+	day      time.Time
+	produced int64
+}
+
+// quotaEnforcer keeps track of the bytes produced within each quota.
+type quotaEnforcer struct {
+	now func() time.Time
+
+	mu     sync.Mutex
+	states []*quotaState
+}
+
+func newQuotaEnforcer(quotas []Quota, now func() time.Time) *quotaEnforcer {
+	states := make([]*quotaState, 0, len(quotas))
+	for _, quota := range quotas {
+		states = append(states, &quotaState{quota: quota})
+	}
+
+	return &quotaEnforcer{now: now, states: states}
+}
+
+// reserve counts bytes towards the produced bytes of the quotas that apply to
+// topicName and principal, unless it would make any of them exceed their
+// limits. retainedBytes is used to compute the retained bytes of namespaces.
+// The returned release function must be called if the bytes weren't produced
+// after all.
+func (q *quotaEnforcer) reserve(topicName string, principal string, bytes int64, retainedBytes func(namespace string) int64) (func(), error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	today := q.now().UTC().Truncate(24 * time.Hour)
+
+	reserved := make([]*quotaState, 0, 1)
+	for _, state := range q.states {
+		quota := state.quota
+		if !quota.appliesTo(topicName, principal) {
+			continue
+		}
+
+		if !state.day.Equal(today) {
+			state.day = today
+			state.produced = 0
+		}
+
+		if quota.ProducedBytesPerDay > 0 && state.produced+bytes > quota.ProducedBytesPerDay {
+			return nil, &QuotaExceededError{Quota: quota.Name(), Limit: "produced bytes per day", Used: state.produced + bytes, Max: quota.ProducedBytesPerDay}
+		}
+
+		if quota.RetainedBytes > 0 {
+			retained := retainedBytes(quota.Namespace)
+			if retained+bytes > quota.RetainedBytes {
+				return nil, &QuotaExceededError{Quota: quota.Name(), Limit: "retained bytes", Used: retained + bytes, Max: quota.RetainedBytes}
+			}
+		}
+
+		reserved = append(reserved, state)
+	}
+
+	for _, state := range reserved {
+		state.produced += bytes
+	}
+
+	return func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+
+		for _, state := range reserved {
+			if state.day.Equal(today) {
+				state.produced -= bytes
+			}
+		}
+	}, nil
+}
+
+// set replaces the enforced quotas with quotas. Quotas that are already
+// enforced, as identified by Quota.Name(), keep the bytes produced within them
+// today.
+func (q *quotaEnforcer) set(quotas []Quota) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	existing := make(map[string]*quotaState, len(q.states))
+	for _, state := range q.states {
+		existing[state.quota.Name()] = state
+	}
+
+	states := make([]*quotaState, 0, len(quotas))
+	for _, quota := range quotas {
+		state := &quotaState{quota: quota}
+		if old, ok := existing[quota.Name()]; ok {
+			state.day = old.day
+			state.produced = old.produced
+		}
+		states = append(states, state)
+	}
+
+	q.states = states
+}
+
+func (q *quotaEnforcer) usage(retainedBytes func(namespace string) int64) []QuotaUsage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	today := q.now().UTC().Truncate(24 * time.Hour)
+
+	usage := make([]QuotaUsage, 0, len(q.states))
+	for _, state := range q.states {
+		quotaUsage := QuotaUsage{Quota: state.quota}
+		if state.day.Equal(today) {
+			quotaUsage.ProducedBytesToday = state.produced
+		}
+		if state.quota.Namespace != "" {
+			quotaUsage.UsedRetainedBytes = retainedBytes(state.quota.Namespace)
+		}
+		usage = append(usage, quotaUsage)
+	}
+
+	return usage
+}
+
+type principalKey struct{}
+
+// ContextWithPrincipal returns a copy of ctx that holds principal, the identity
+// of the producer of records added using ctx. It's used to enforce principal
+// quotas.
+func ContextWithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal of ctx, as added by
+// ContextWithPrincipal, or "" if it has none.
+func PrincipalFromContext(ctx context.Context) string {
+	principal, _ := ctx.Value(principalKey{}).(string)
+	return principal
+}
+
+// QuotaUsage returns the broker's quotas and how much of them has been used.
+func (s *Broker) QuotaUsage() []QuotaUsage {
+	return s.quotas.usage(s.retainedBytes)
+}
+
+// SetQuotas replaces the broker's quotas with quotas, e.g. when they're
+// reloaded from a configuration file. Bytes produced today within quotas that
+// are kept count towards them; quotas are identified by Quota.Name().
+//
+// An error wrapping seberr.ErrBadInput is returned, and the quotas are left
+// unchanged, if any of quotas are invalid.
+func (s *Broker) SetQuotas(quotas []Quota) error {
+	for _, quota := range quotas {
+		err := quota.validate()
+		if err != nil {
+			return fmt.Errorf("%w: quota '%s': %s", seberr.ErrBadInput, quota.Name(), err)
+		}
+	}
+
+	s.log.Infof("setting %d quotas", len(quotas))
+	s.quotas.set(quotas)
+	return nil
+}
+
+// retainedBytes returns the number of bytes used in backing storage by the
+// topics instantiated by the broker whose names start with namespace.
+func (s *Broker) retainedBytes(namespace string) int64 {
+	bytes := int64(0)
+	for topicName, tb := range s.madeTopicBatchers() {
+		if strings.HasPrefix(topicName, namespace) {
+			bytes += tb.topic.StorageUsage().Bytes()
+		}
+	}
+	return bytes
+}
+
+// WithQuotas adds quotas that are enforced when records are added. Invalid
+// quotas are logged and ignored; use ParseQuotas to validate them up front.
+func WithQuotas(quotas ...Quota) func(*Opts) {
+	return func(o *Opts) {
+		o.Quotas = append(o.Quotas, quotas...)
+	}
+}
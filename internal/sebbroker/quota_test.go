@@ -0,0 +1,174 @@
+package sebbroker_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBrokerQuotaProducedBytesPerDay verifies that AddRecords() returns a
+// *QuotaExceededError once the bytes produced to the topics of a namespace
+// would exceed its quota, and that topics of other namespaces are unaffected.
+func TestBrokerQuotaProducedBytesPerDay(t *testing.T) {
+	s := tester.Broker(t, sebtopic.NewMemoryStorage(log), sebbroker.WithQuotas(sebbroker.Quota{Namespace: "team-a/", ProducedBytesPerDay: 100}))
+
+	_, err := s.AddRecords("team-a/orders", tester.RecordsToBatch([][]byte{tester.RandomBytes(t, 60)}))
+	require.NoError(t, err)
+
+	// Act
+	_, err = s.AddRecords("team-a/payments", tester.RecordsToBatch([][]byte{tester.RandomBytes(t, 60)}))
+
+	// Assert
+	require.ErrorIs(t, err, seberr.ErrQuotaExceeded)
+	quotaErr := &sebbroker.QuotaExceededError{}
+	require.ErrorAs(t, err, &quotaErr)
+	require.Equal(t, "namespace:team-a/", quotaErr.Quota)
+	require.Equal(t, int64(120), quotaErr.Used)
+	require.Equal(t, int64(100), quotaErr.Max)
+
+	_, err = s.AddRecords("team-b/orders", tester.RecordsToBatch([][]byte{tester.RandomBytes(t, 60)}))
+	require.NoError(t, err)
+
+	usage := s.QuotaUsage()
+	require.Equal(t, 1, len(usage))
+	require.Equal(t, int64(60), usage[0].ProducedBytesToday)
+}
+
+// TestBrokerQuotaPrincipal verifies that principal quotas only apply to
+// records added with the principal given by ContextWithPrincipal().
+func TestBrokerQuotaPrincipal(t *testing.T) {
+	s := tester.Broker(t, sebtopic.NewMemoryStorage(log), sebbroker.WithQuotas(sebbroker.Quota{Principal: "producer-a", ProducedBytesPerDay: 100}))
+	ctx := sebbroker.ContextWithPrincipal(context.Background(), "producer-a")
+
+	_, err := s.AddRecordsContext(ctx, "topic", tester.RecordsToBatch([][]byte{tester.RandomBytes(t, 100)}))
+	require.NoError(t, err)
+
+	// Act
+	_, err = s.AddRecordsContext(ctx, "other-topic", tester.RecordsToBatch([][]byte{tester.RandomBytes(t, 1)}))
+
+	// Assert
+	require.ErrorIs(t, err, seberr.ErrQuotaExceeded)
+
+	otherCtx := sebbroker.ContextWithPrincipal(context.Background(), "producer-b")
+	_, err = s.AddRecordsContext(otherCtx, "topic", tester.RecordsToBatch([][]byte{tester.RandomBytes(t, 100)}))
+	require.NoError(t, err)
+
+	_, err = s.AddRecords("topic", tester.RecordsToBatch([][]byte{tester.RandomBytes(t, 100)}))
+	require.NoError(t, err)
+}
+
+// TestBrokerQuotaRetainedBytes verifies that AddRecords() returns
+// seberr.ErrQuotaExceeded once the storage used by the topics of a namespace
+// would exceed its quota.
+func TestBrokerQuotaRetainedBytes(t *testing.T) {
+	const (
+		recordSize    = 100
+		retainedBytes = 500
+	)
+	s := tester.Broker(t, sebtopic.NewMemoryStorage(log), sebbroker.WithQuotas(sebbroker.Quota{Namespace: "team-a/", RetainedBytes: retainedBytes}))
+
+	var err error
+	added := 0
+	for ; added < 10; added++ {
+		// Act
+		_, err = s.AddRecords("team-a/orders", tester.RecordsToBatch([][]byte{tester.RandomBytes(t, recordSize)}))
+		if err != nil {
+			break
+		}
+	}
+
+	// Assert
+	require.ErrorIs(t, err, seberr.ErrQuotaExceeded)
+	require.Less(t, 0, added)
+
+	usage := s.QuotaUsage()
+	require.Equal(t, 1, len(usage))
+	require.Less(t, int64(retainedBytes-recordSize), usage[0].UsedRetainedBytes)
+	require.Equal(t, int64(added*recordSize), usage[0].ProducedBytesToday)
+}
+
+// TestBrokerSetQuotas verifies that SetQuotas() replaces the broker's quotas,
+// that quotas that are kept retain the bytes produced within them today, and
+// that invalid quotas are rejected without changing the quotas.
+func TestBrokerSetQuotas(t *testing.T) {
+	s := tester.Broker(t, sebtopic.NewMemoryStorage(log), sebbroker.WithQuotas(
+		sebbroker.Quota{Namespace: "team-a/", ProducedBytesPerDay: 100},
+		sebbroker.Quota{Namespace: "team-b/", ProducedBytesPerDay: 100},
+	))
+
+	_, err := s.AddRecords("team-a/orders", tester.RecordsToBatch([][]byte{tester.RandomBytes(t, 60)}))
+	require.NoError(t, err)
+
+	// Act
+	err = s.SetQuotas([]sebbroker.Quota{
+		{Namespace: "team-a/", ProducedBytesPerDay: 200},
+		{Principal: "producer-a", ProducedBytesPerDay: 10},
+	})
+
+	// Assert
+	require.NoError(t, err)
+
+	usage := s.QuotaUsage()
+	require.Equal(t, 2, len(usage))
+	require.Equal(t, "namespace:team-a/", usage[0].Name())
+	require.Equal(t, int64(60), usage[0].ProducedBytesToday)
+	require.Equal(t, int64(200), usage[0].ProducedBytesPerDay)
+	require.Equal(t, "principal:producer-a", usage[1].Name())
+
+	_, err = s.AddRecords("team-a/orders", tester.RecordsToBatch([][]byte{tester.RandomBytes(t, 60)}))
+	require.NoError(t, err)
+
+	_, err = s.AddRecords("team-b/orders", tester.RecordsToBatch([][]byte{tester.RandomBytes(t, 200)}))
+	require.NoError(t, err)
+
+	// Act
+	err = s.SetQuotas([]sebbroker.Quota{{Namespace: "team-a/", Principal: "producer-a"}})
+
+	// Assert
+	require.ErrorIs(t, err, seberr.ErrBadInput)
+	require.Equal(t, 2, len(s.QuotaUsage()))
+}
+
+// TestParseQuotas verifies that ParseQuotas() parses valid quotas and returns
+// errors for invalid ones.
+func TestParseQuotas(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected []sebbroker.Quota
+		err      bool
+	}{
+		"namespace": {
+			input:    `[{"namespace": "team-a/", "produced_bytes_per_day": 10, "retained_bytes": 20}]`,
+			expected: []sebbroker.Quota{{Namespace: "team-a/", ProducedBytesPerDay: 10, RetainedBytes: 20}},
+		},
+		"principal": {
+			input:    `[{"principal": "producer-a", "produced_bytes_per_day": 10}]`,
+			expected: []sebbroker.Quota{{Principal: "producer-a", ProducedBytesPerDay: 10}},
+		},
+		"neither":                 {input: `[{"produced_bytes_per_day": 10}]`, err: true},
+		"both":                    {input: `[{"namespace": "a", "principal": "b"}]`, err: true},
+		"negative":                {input: `[{"namespace": "a", "retained_bytes": -1}]`, err: true},
+		"principal with retained": {input: `[{"principal": "a", "retained_bytes": 10}]`, err: true},
+		"invalid json":            {input: `{`, err: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			quotas, err := sebbroker.ParseQuotas([]byte(test.input))
+
+			// Assert
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, quotas)
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package sebbroker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// RefreshTopic picks up record batches that were added to topicName by
+// another process sharing the broker's storage, and notifies watchers if its
+// next offset advanced. Topics that haven't been used by the broker are left
+// alone, since their record batches are listed once they're first used. See
+// sebtopic.Topic.Refresh.
+//
+// NOTE: RefreshTopic must only be used for topics that the broker doesn't add
+// records to.
+func (s *Broker) RefreshTopic(ctx context.Context, topicName string) error {
+	tb, ok := s.madeTopicBatchers()[topicName]
+	if !ok {
+		return nil
+	}
+
+	before := tb.topic.NextOffset()
+	nextOffset, err := tb.topic.Refresh(ctx)
+	if err != nil {
+		return fmt.Errorf("refreshing topic '%s': %w", topicName, err)
+	}
+
+	if nextOffset > before {
+		s.watchers.advanced(topicName, nextOffset)
+	}
+
+	return nil
+}
+
+// RefreshRecordBatch picks up the record batch stored at key, which was added
+// by another process sharing the broker's storage, e.g. as reported by an S3
+// event notification. Like RefreshTopic, topics that haven't been used by the
+// broker are left alone. See sebtopic.Topic.RefreshRecordBatch.
+//
+// seberr.ErrNotFound is returned if the broker isn't a read replica, since
+// topics written to by the broker itself must not be refreshed.
+func (s *Broker) RefreshRecordBatch(ctx context.Context, key string) error {
+	if !s.readReplica {
+		return fmt.Errorf("%w: broker is not a read replica", seberr.ErrNotFound)
+	}
+
+	topicName, name, err := sebtopic.ParseRecordBatchKey(key)
+	if err != nil {
+		return err
+	}
+
+	tb, ok := s.madeTopicBatchers()[topicName]
+	if !ok {
+		return nil
+	}
+
+	before := tb.topic.NextOffset()
+	nextOffset, err := tb.topic.RefreshRecordBatch(ctx, name)
+	if err != nil {
+		return fmt.Errorf("refreshing record batch '%s': %w", key, err)
+	}
+
+	if nextOffset > before {
+		s.watchers.advanced(topicName, nextOffset)
+	}
+
+	return nil
+}
+
+// RefreshLoop refreshes the topics whose names are received on changed, e.g.
+// from sebtopic.DiskStorage.WatchTopics, until ctx expires or changed is
+// closed.
+func RefreshLoop(ctx context.Context, log logger.Logger, broker *Broker, changed <-chan string) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case topicName, ok := <-changed:
+			if !ok {
+				return ctx.Err()
+			}
+
+			err := broker.RefreshTopic(ctx, topicName)
+			if err != nil {
+				log.Errorf("refreshing topic: %s", err)
+			}
+		}
+	}
+}
+
+// RefreshTopics refreshes all topics that have been used by the broker. See
+// RefreshTopic.
+func (s *Broker) RefreshTopics(ctx context.Context) error {
+	var errs []error
+	for topicName := range s.madeTopicBatchers() {
+		err := s.RefreshTopic(ctx, topicName)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ReplicaLoop refreshes all topics used by the broker every interval, such
+// that read replicas pick up record batches added to storage by the broker
+// writing to the topics, e.g. in S3. See WithReadReplica.
+func ReplicaLoop(ctx context.Context, log logger.Logger, broker *Broker, interval time.Duration) error {
+	log = log.WithField("interval", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		err := broker.RefreshTopics(ctx)
+		if err != nil {
+			log.Errorf("refreshing topics: %s", err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package sebbroker_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRefreshTopic verifies that RefreshTopic makes records added by another
+// broker sharing the same storage visible, and notifies watchers.
+func TestRefreshTopic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	storage := sebtopic.NewDiskStorage(log, t.TempDir())
+	writer, replica := tester.Broker(t, storage), tester.Broker(t, storage)
+
+	_, err := writer.AddRecords("topic", tester.MakeRandomRecordBatch(1))
+	require.NoError(t, err)
+
+	// topic is opened by the replica
+	metadata, err := replica.Metadata("topic")
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), metadata.NextOffset)
+
+	events := replica.Watch(ctx)
+
+	_, err = writer.AddRecords("topic", tester.MakeRandomRecordBatch(2))
+	require.NoError(t, err)
+
+	// Act
+	err = replica.RefreshTopic(ctx, "topic")
+	require.NoError(t, err)
+
+	// Assert
+	metadata, err = replica.Metadata("topic")
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), metadata.NextOffset)
+
+	expected := []sebbroker.TopicEvent{
+		{Type: sebbroker.TopicEventAdvanced, TopicName: "topic", NextOffset: 3},
+	}
+	require.Equal(t, expected, receiveEvents(t, events, len(expected)))
+
+	// Act
+	err = replica.RefreshTopic(ctx, "not-opened")
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, []string{"topic"}, replica.TopicNames())
+}
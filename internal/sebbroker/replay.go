@@ -0,0 +1,318 @@
+package sebbroker
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// defaultReplayIdleTimeout is the idle timeout of replays that are created
+// without one.
+const defaultReplayIdleTimeout = 10 * time.Minute
+
+// ReplayOpts configures a replay. See CreateReplay.
+type ReplayOpts struct {
+	// StartOffset is the first offset of the replay.
+	StartOffset uint64
+
+	// EndOffset is the offset following the last offset of the replay. It
+	// defaults to the topic's next offset when the replay is created if 0,
+	// and must not be larger than it.
+	EndOffset uint64
+
+	// RecordsPerSecond and BytesPerSecond limit the rate at which records
+	// are read by the replay. Unlimited if 0.
+	RecordsPerSecond int
+	BytesPerSecond   int
+
+	// BypassCache makes record batches read by the replay not be admitted
+	// to the cache.
+	BypassCache bool
+
+	// IdleTimeout is the amount of time after which the replay is deleted
+	// if it hasn't been read. Defaults to 10 minutes if 0.
+	IdleTimeout time.Duration
+}
+
+// Replay is a named, read-only cursor over a range of a topic's offsets. See
+// CreateReplay.
+type Replay struct {
+	Name      string
+	TopicName string
+
+	ReplayOpts
+
+	// Offset is the offset that the replay will read next.
+	Offset uint64
+
+	CreatedAt time.Time
+	ActiveAt  time.Time
+}
+
+// Done returns whether all records of the replay have been read.
+func (r Replay) Done() bool {
+	return r.Offset >= r.EndOffset
+}
+
+// replays keeps track of replays. Like retention, replays are only kept in
+// memory for the lifetime of Broker.
+type replays struct {
+	mu       sync.Mutex
+	sessions map[string]*replaySession
+}
+
+type replaySession struct {
+	// mu is held while the replay is read, serializing reads.
+	mu        sync.Mutex
+	replay    Replay
+	notBefore time.Time
+}
+
+func newReplays() *replays {
+	return &replays{
+		sessions: map[string]*replaySession{},
+	}
+}
+
+// CreateReplay creates a replay named name, which reads the records of
+// topicName in the range given by opts. Replays are meant for large backfills
+// of historical records: they're read using the cache budget of background
+// work, optionally without admitting the read record batches to the cache,
+// and at a limited rate, such that they don't disturb live consumers.
+//
+// seberr.ErrBadInput is returned if a replay named name already exists or if
+// opts are invalid, and seberr.ErrTopicNotFound if topicName doesn't exist.
+//
+// NOTE: replays are only kept in memory, and are deleted once they haven't
+// been read for opts.IdleTimeout.
+func (s *Broker) CreateReplay(name string, topicName string, opts ReplayOpts) (Replay, error) {
+	if name == "" {
+		return Replay{}, fmt.Errorf("%w: replay name must be given", seberr.ErrBadInput)
+	}
+	if opts.RecordsPerSecond < 0 || opts.BytesPerSecond < 0 || opts.IdleTimeout < 0 {
+		return Replay{}, fmt.Errorf("%w: replay limits must not be negative", seberr.ErrBadInput)
+	}
+
+	topicName = s.resolveTopicName(topicName)
+	exists, err := s.topicExists(topicName)
+	if err != nil {
+		return Replay{}, err
+	}
+	if !exists {
+		return Replay{}, fmt.Errorf("%w: '%s'", seberr.ErrTopicNotFound, topicName)
+	}
+
+	tb, err := s.getTopicBatcher(topicName)
+	if err != nil {
+		return Replay{}, err
+	}
+
+	nextOffset := tb.topic.NextOffset()
+	if opts.EndOffset == 0 {
+		opts.EndOffset = nextOffset
+	}
+	if opts.EndOffset > nextOffset {
+		return Replay{}, fmt.Errorf("%w: end offset %d is beyond next offset %d", seberr.ErrBadInput, opts.EndOffset, nextOffset)
+	}
+	if opts.StartOffset > opts.EndOffset {
+		return Replay{}, fmt.Errorf("%w: start offset %d is beyond end offset %d", seberr.ErrBadInput, opts.StartOffset, opts.EndOffset)
+	}
+	if opts.IdleTimeout == 0 {
+		opts.IdleTimeout = defaultReplayIdleTimeout
+	}
+
+	r := s.replays
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.expire(now)
+
+	if _, ok := r.sessions[name]; ok {
+		return Replay{}, fmt.Errorf("%w: replay '%s' already exists", seberr.ErrBadInput, name)
+	}
+
+	replay := Replay{
+		Name:       name,
+		TopicName:  topicName,
+		ReplayOpts: opts,
+		Offset:     opts.StartOffset,
+		CreatedAt:  now,
+		ActiveAt:   now,
+	}
+	r.sessions[name] = &replaySession{replay: replay}
+
+	s.log.Infof("created replay '%s' of topic '%s' [%d; %d)", name, topicName, opts.StartOffset, opts.EndOffset)
+
+	return replay, nil
+}
+
+// ReadReplay reads the next records of the replay named name into batch, and
+// advances the replay past them. It returns the replay as it is after the
+// read; no records are read once Replay.Done() is true.
+//
+// If the replay's rate limits have been reached, ReadReplay waits until
+// records may be read again, or until ctx expires. Concurrent reads of the
+// same replay are serialized.
+//
+// seberr.ErrNotFound is returned if the replay doesn't exist.
+func (s *Broker) ReadReplay(ctx context.Context, batch *sebrecords.Batch, name string, maxRecords int, softMaxBytes int) (Replay, error) {
+	session, err := s.replays.session(name)
+	if err != nil {
+		return Replay{}, err
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	replay := session.replay
+	if replay.Done() {
+		s.replays.advance(session, replay.Offset)
+		return session.replay, nil
+	}
+
+	if wait := time.Until(session.notBefore); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return replay, ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	ctx = sebcache.WithBudget(ctx, sebcache.BudgetMaintenance)
+	ctx = sebtopic.WithReadLimits(ctx, sebtopic.ReadLimits{
+		StartOffset: replay.StartOffset,
+		EndOffset:   replay.EndOffset,
+	})
+	if replay.BypassCache {
+		ctx = sebcache.WithBypass(ctx)
+	}
+
+	maxRecords = min(s.fetchMaxRecords(maxRecords), int(replay.EndOffset-replay.Offset))
+	read, readBytes := batch.Len(), len(batch.Data)
+	nextOffset, err := s.GetRecordsNonBlocking(ctx, batch, replay.TopicName, replay.Offset, maxRecords, softMaxBytes)
+	if err != nil {
+		return replay, err
+	}
+
+	// NOTE: reads may use up the rate limits ahead of time; the following
+	// read waits for it to be paid back.
+	now := time.Now()
+	if session.notBefore.Before(now) {
+		session.notBefore = now
+	}
+	session.notBefore = session.notBefore.Add(replayReadCost(replay.ReplayOpts, batch.Len()-read, len(batch.Data)-readBytes))
+	s.replays.advance(session, nextOffset)
+
+	return session.replay, nil
+}
+
+// replayReadCost returns the amount of time that reading records records of
+// size bytes uses of the rate limits of opts.
+func replayReadCost(opts ReplayOpts, records int, bytes int) time.Duration {
+	var cost time.Duration
+	if opts.RecordsPerSecond > 0 {
+		cost = time.Duration(records) * time.Second / time.Duration(opts.RecordsPerSecond)
+	}
+	if opts.BytesPerSecond > 0 {
+		cost = max(cost, time.Duration(bytes)*time.Second/time.Duration(opts.BytesPerSecond))
+	}
+	return cost
+}
+
+// GetReplay returns the replay named name, or seberr.ErrNotFound if it
+// doesn't exist.
+func (s *Broker) GetReplay(name string) (Replay, error) {
+	r := s.replays
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.expire(time.Now())
+
+	session, ok := r.sessions[name]
+	if !ok {
+		return Replay{}, fmt.Errorf("%w: replay '%s'", seberr.ErrNotFound, name)
+	}
+	return session.replay, nil
+}
+
+// Replays returns all replays, sorted by name.
+func (s *Broker) Replays() []Replay {
+	r := s.replays
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.expire(time.Now())
+
+	replays := make([]Replay, 0, len(r.sessions))
+	for _, session := range r.sessions {
+		replays = append(replays, session.replay)
+	}
+	slices.SortFunc(replays, func(a, b Replay) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	return replays
+}
+
+// DeleteReplay deletes the replay named name, or returns seberr.ErrNotFound
+// if it doesn't exist.
+func (s *Broker) DeleteReplay(name string) error {
+	r := s.replays
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.sessions[name]; !ok {
+		return fmt.Errorf("%w: replay '%s'", seberr.ErrNotFound, name)
+	}
+	delete(r.sessions, name)
+
+	s.log.Infof("deleted replay '%s'", name)
+	return nil
+}
+
+// session returns the session of the replay named name, or
+// seberr.ErrNotFound if it doesn't exist.
+func (r *replays) session(name string) (*replaySession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.expire(time.Now())
+
+	session, ok := r.sessions[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: replay '%s'", seberr.ErrNotFound, name)
+	}
+	return session, nil
+}
+
+// advance moves session to offset and marks it as active.
+// NOTE: you must hold session.mu when calling this method!
+func (r *replays) advance(session *replaySession, offset uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session.replay.Offset = offset
+	session.replay.ActiveAt = time.Now()
+}
+
+// expire deletes the replays that haven't been active within their idle
+// timeout.
+// NOTE: you must hold r.mu when calling this method!
+func (r *replays) expire(now time.Time) {
+	for name, session := range r.sessions {
+		if now.Sub(session.replay.ActiveAt) > session.replay.IdleTimeout {
+			delete(r.sessions, name)
+		}
+	}
+}
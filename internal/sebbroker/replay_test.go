@@ -0,0 +1,231 @@
+package sebbroker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBrokerReplay verifies that ReadReplay() reads the records of the
+// replay's range in order, advancing the replay, and that no records are read
+// once the replay is done.
+func TestBrokerReplay(t *testing.T) {
+	const autoCreate = true
+	tester.TestBroker(t, autoCreate, func(t *testing.T, s *sebbroker.Broker) {
+		const topicName = "topic"
+		ctx := context.Background()
+
+		records := tester.MakeRandomRecordBatch(10)
+		_, err := s.AddRecords(topicName, records)
+		require.NoError(t, err)
+
+		replay, err := s.CreateReplay("backfill", topicName, sebbroker.ReplayOpts{StartOffset: 2, EndOffset: 8})
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), replay.Offset)
+		require.False(t, replay.Done())
+
+		// Act
+		batch := tester.NewBatch(10, 4096)
+		replay, err = s.ReadReplay(ctx, &batch, "backfill", 4, 0)
+
+		// Assert
+		require.NoError(t, err)
+		require.Equal(t, uint64(6), replay.Offset)
+		require.False(t, replay.Done())
+		require.Equal(t, records.IndividualRecords()[2:6], batch.IndividualRecords())
+
+		// Act
+		batch.Reset()
+		replay, err = s.ReadReplay(ctx, &batch, "backfill", 4, 0)
+
+		// Assert
+		require.NoError(t, err)
+		require.Equal(t, uint64(8), replay.Offset)
+		require.True(t, replay.Done())
+		require.Equal(t, records.IndividualRecords()[6:8], batch.IndividualRecords())
+
+		// Act
+		batch.Reset()
+		replay, err = s.ReadReplay(ctx, &batch, "backfill", 4, 0)
+
+		// Assert
+		require.NoError(t, err)
+		require.True(t, replay.Done())
+		require.Equal(t, 0, batch.Len())
+	})
+}
+
+// TestBrokerReplayCache verifies that replays read record batches using the
+// maintenance cache budget, and that they aren't admitted to the cache when
+// the replay bypasses it.
+func TestBrokerReplayCache(t *testing.T) {
+	tests := map[string]struct {
+		bypass bool
+	}{
+		"cached": {bypass: false},
+		"bypass": {bypass: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			storage := sebtopic.NewMemoryStorage(log)
+
+			writerCache, err := sebcache.NewMemoryCache(log)
+			require.NoError(t, err)
+
+			s1 := sebbroker.New(log, func(log logger.Logger, topicName string) (*sebtopic.Topic, error) {
+				return sebtopic.New(log, storage, topicName, writerCache)
+			}, sebbroker.WithNullBatcher())
+			records := tester.MakeRandomRecordBatch(5)
+			_, err = s1.AddRecords("topic", records)
+			require.NoError(t, err)
+
+			// the last record batch is read when the topic is opened
+			_, err = s1.AddRecords("topic", tester.MakeRandomRecordBatch(5))
+			require.NoError(t, err)
+
+			// a new cache, such that record batches must be read from storage
+			cache, err := sebcache.NewMemoryCache(log)
+			require.NoError(t, err)
+			s2 := sebbroker.New(log, func(log logger.Logger, topicName string) (*sebtopic.Topic, error) {
+				return sebtopic.New(log, storage, topicName, cache)
+			}, sebbroker.WithNullBatcher())
+
+			_, err = s2.CreateReplay("backfill", "topic", sebbroker.ReplayOpts{EndOffset: 5, BypassCache: test.bypass})
+			require.NoError(t, err)
+			servingStats := cache.BudgetStats()[sebcache.BudgetServing]
+
+			// Act
+			batch := tester.NewBatch(5, 4096)
+			replay, err := s2.ReadReplay(ctx, &batch, "backfill", 5, 0)
+
+			// Assert
+			require.NoError(t, err)
+			require.True(t, replay.Done())
+			require.Equal(t, records.IndividualRecords(), batch.IndividualRecords())
+
+			stats := cache.BudgetStats()
+			require.Equal(t, servingStats, stats[sebcache.BudgetServing])
+
+			expectedNotAdmitted := uint64(0)
+			if test.bypass {
+				expectedNotAdmitted = 1
+			}
+			require.Equal(t, expectedNotAdmitted, stats[sebcache.BudgetMaintenance].NotAdmitted)
+
+			err = cache.EvictTransient()
+			require.NoError(t, err)
+			require.Equal(t, test.bypass, cache.BudgetStats()[sebcache.BudgetMaintenance].Items == 0)
+		})
+	}
+}
+
+// TestBrokerReplayRateLimit verifies that ReadReplay() waits for the replay's
+// rate limit before reading more records, and that it returns when ctx
+// expires while waiting.
+func TestBrokerReplayRateLimit(t *testing.T) {
+	const autoCreate = true
+	tester.TestBroker(t, autoCreate, func(t *testing.T, s *sebbroker.Broker) {
+		const topicName = "topic"
+
+		_, err := s.AddRecords(topicName, tester.MakeRandomRecordBatch(10))
+		require.NoError(t, err)
+
+		_, err = s.CreateReplay("backfill", topicName, sebbroker.ReplayOpts{RecordsPerSecond: 50})
+		require.NoError(t, err)
+
+		batch := tester.NewBatch(10, 4096)
+		_, err = s.ReadReplay(context.Background(), &batch, "backfill", 5, 0)
+		require.NoError(t, err)
+
+		// Act
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		batch.Reset()
+		replay, err := s.ReadReplay(ctx, &batch, "backfill", 5, 0)
+
+		// Assert
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Equal(t, uint64(5), replay.Offset)
+
+		// Act
+		t0 := time.Now()
+		replay, err = s.ReadReplay(context.Background(), &batch, "backfill", 5, 0)
+
+		// Assert
+		require.NoError(t, err)
+		require.Equal(t, uint64(10), replay.Offset)
+		require.GreaterOrEqual(t, time.Since(t0), 50*time.Millisecond)
+	})
+}
+
+// TestBrokerReplayErrors verifies that CreateReplay() rejects invalid replays,
+// and that replays can be listed and deleted.
+func TestBrokerReplayErrors(t *testing.T) {
+	const autoCreate = true
+	tester.TestBroker(t, autoCreate, func(t *testing.T, s *sebbroker.Broker) {
+		const topicName = "topic"
+
+		_, err := s.AddRecords(topicName, tester.MakeRandomRecordBatch(5))
+		require.NoError(t, err)
+
+		_, err = s.CreateReplay("existing", topicName, sebbroker.ReplayOpts{})
+		require.NoError(t, err)
+
+		tests := map[string]struct {
+			name      string
+			topicName string
+			opts      sebbroker.ReplayOpts
+			err       error
+		}{
+			"no name":          {name: "", topicName: topicName, err: seberr.ErrBadInput},
+			"already exists":   {name: "existing", topicName: topicName, err: seberr.ErrBadInput},
+			"topic not found":  {name: "replay", topicName: "does-not-exist", err: seberr.ErrTopicNotFound},
+			"beyond next":      {name: "replay", topicName: topicName, opts: sebbroker.ReplayOpts{EndOffset: 6}, err: seberr.ErrBadInput},
+			"start after end":  {name: "replay", topicName: topicName, opts: sebbroker.ReplayOpts{StartOffset: 4, EndOffset: 3}, err: seberr.ErrBadInput},
+			"negative limit":   {name: "replay", topicName: topicName, opts: sebbroker.ReplayOpts{BytesPerSecond: -1}, err: seberr.ErrBadInput},
+			"negative timeout": {name: "replay", topicName: topicName, opts: sebbroker.ReplayOpts{IdleTimeout: -1}, err: seberr.ErrBadInput},
+		}
+
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				// Act
+				_, err := s.CreateReplay(test.name, test.topicName, test.opts)
+
+				// Assert
+				require.ErrorIs(t, err, test.err)
+			})
+		}
+
+		replays := s.Replays()
+		require.Len(t, replays, 1)
+		require.Equal(t, "existing", replays[0].Name)
+		require.Equal(t, uint64(5), replays[0].EndOffset)
+
+		// Act
+		err = s.DeleteReplay("existing")
+
+		// Assert
+		require.NoError(t, err)
+		require.Empty(t, s.Replays())
+
+		_, err = s.GetReplay("existing")
+		require.ErrorIs(t, err, seberr.ErrNotFound)
+
+		batch := tester.NewBatch(1, 4096)
+		_, err = s.ReadReplay(context.Background(), &batch, "existing", 1, 0)
+		require.ErrorIs(t, err, seberr.ErrNotFound)
+
+		err = s.DeleteReplay("existing")
+		require.ErrorIs(t, err, seberr.ErrNotFound)
+	})
+}
@@ -0,0 +1,139 @@
+package sebbroker_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReadReplica verifies that read replicas serve records of topics written
+// by another broker sharing their storage once they're refreshed, and that
+// they reject writes.
+func TestReadReplica(t *testing.T) {
+	ctx := context.Background()
+	storage := sebtopic.NewMemoryStorage(log)
+
+	writerCache, err := sebcache.NewMemoryCache(log)
+	require.NoError(t, err)
+	writer := sebbroker.New(log, sebbroker.NewStorageTopicFactory(storage, writerCache), sebbroker.WithNullBatcher())
+
+	replicaCache, err := sebcache.NewMemoryCache(log)
+	require.NoError(t, err)
+	replica := sebbroker.New(log,
+		sebbroker.NewStorageTopicFactory(storage, replicaCache, sebbroker.WithTopicOpts(sebtopic.WithReadOnly(true))),
+		sebbroker.WithNullBatcher(),
+		sebbroker.WithAutoCreateTopic(false),
+		sebbroker.WithReadReplica(true),
+	)
+
+	batch1 := tester.MakeRandomRecordBatch(2)
+	_, err = writer.AddRecords("topic", batch1)
+	require.NoError(t, err)
+
+	// Act
+	gotBatch := tester.NewBatch(2, 4096)
+	err = replica.GetRecords(ctx, &gotBatch, "topic", 0, 2, 0)
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, batch1.Data, gotBatch.Data)
+
+	// Act
+	batch2 := tester.MakeRandomRecordBatch(3)
+	_, err = writer.AddRecords("topic", batch2)
+	require.NoError(t, err)
+
+	err = replica.RefreshTopics(ctx)
+	require.NoError(t, err)
+
+	// Assert
+	gotBatch = tester.NewBatch(3, 4096)
+	err = replica.GetRecords(ctx, &gotBatch, "topic", 2, 3, 0)
+	require.NoError(t, err)
+	require.Equal(t, batch2.Data, gotBatch.Data)
+
+	// Act, Assert
+	_, err = replica.AddRecords("topic", tester.MakeRandomRecordBatch(1))
+	require.ErrorIs(t, err, seberr.ErrWritesFrozen)
+
+	err = replica.CreateTopic("other")
+	require.ErrorIs(t, err, seberr.ErrWritesFrozen)
+
+	err = replica.DeleteTopic("topic")
+	require.ErrorIs(t, err, seberr.ErrWritesFrozen)
+
+	err = replica.SetTopicAlias(ctx, "alias", "topic")
+	require.ErrorIs(t, err, seberr.ErrWritesFrozen)
+
+	merged, err := replica.MergeBatches(10, 4096)
+	require.NoError(t, err)
+	require.Equal(t, 0, merged)
+}
+
+// TestReadReplicaRefreshRecordBatch verifies that read replicas pick up record
+// batches reported by their keys, e.g. from S3 event notifications, and that
+// keys of unused topics are ignored.
+func TestReadReplicaRefreshRecordBatch(t *testing.T) {
+	ctx := context.Background()
+	storage := sebtopic.NewMemoryStorage(log)
+
+	writerCache, err := sebcache.NewMemoryCache(log)
+	require.NoError(t, err)
+	writer := sebbroker.New(log, sebbroker.NewStorageTopicFactory(storage, writerCache), sebbroker.WithNullBatcher())
+
+	replicaCache, err := sebcache.NewMemoryCache(log)
+	require.NoError(t, err)
+	replica := sebbroker.New(log,
+		sebbroker.NewStorageTopicFactory(storage, replicaCache, sebbroker.WithTopicOpts(sebtopic.WithReadOnly(true))),
+		sebbroker.WithNullBatcher(),
+		sebbroker.WithAutoCreateTopic(false),
+		sebbroker.WithReadReplica(true),
+	)
+
+	_, err = writer.AddRecords("topic", tester.MakeRandomRecordBatch(2))
+	require.NoError(t, err)
+	_, err = writer.AddRecords("unused", tester.MakeRandomRecordBatch(2))
+	require.NoError(t, err)
+
+	gotBatch := tester.NewBatch(2, 4096)
+	err = replica.GetRecords(ctx, &gotBatch, "topic", 0, 2, 0)
+	require.NoError(t, err)
+
+	batch := tester.MakeRandomRecordBatch(3)
+	_, err = writer.AddRecords("topic", batch)
+	require.NoError(t, err)
+
+	// Act
+	err = replica.RefreshRecordBatch(ctx, sebtopic.RecordBatchKey("topic", 2))
+
+	// Assert
+	require.NoError(t, err)
+	gotBatch = tester.NewBatch(3, 4096)
+	err = replica.GetRecords(ctx, &gotBatch, "topic", 2, 3, 0)
+	require.NoError(t, err)
+	require.Equal(t, batch.Data, gotBatch.Data)
+
+	// Act
+	err = replica.RefreshRecordBatch(ctx, sebtopic.RecordBatchKey("unused", 0))
+
+	// Assert
+	require.NoError(t, err)
+
+	// Act
+	err = replica.RefreshRecordBatch(ctx, "topic/manifest.json")
+
+	// Assert
+	require.ErrorIs(t, err, seberr.ErrBadInput)
+
+	// Act
+	err = writer.RefreshRecordBatch(ctx, sebtopic.RecordBatchKey("topic", 2))
+
+	// Assert
+	require.ErrorIs(t, err, seberr.ErrNotFound)
+}
@@ -0,0 +1,35 @@
+package sebbroker
+
+import (
+	"context"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+)
+
+// RetentionLoop periodically deletes record batches in which all records have
+// expired. It runs until ctx expires; errors from deleting record batches are
+// logged and retried at the next interval.
+func RetentionLoop(ctx context.Context, log logger.Logger, broker *Broker, interval time.Duration) error {
+	log = log.WithField("interval", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		dropped, err := broker.DropExpiredBatches(time.Now())
+		if err != nil {
+			log.Errorf("dropping expired record batches: %s", err)
+		}
+
+		if dropped > 0 {
+			log.Infof("dropped %d expired record batches", dropped)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package sebbroker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+)
+
+// ScrubStats counts the record batches checked by a Scrubber and the files
+// that it found to be corrupt or missing, since it was created.
+type ScrubStats struct {
+	Runs          uint64
+	RecordBatches uint64
+
+	Corrupt             uint64
+	Missing             uint64
+	MissingLargeRecords uint64
+	Repaired            uint64
+	Quarantined         uint64
+
+	LastRunAt time.Time
+}
+
+// Scrubber verifies the integrity of the record batches of the topics
+// instantiated by a broker. See sebtopic.Scrub.
+type Scrubber struct {
+	log     logger.Logger
+	broker  *Broker
+	storage sebtopic.Storage
+	optFns  []func(*sebtopic.ScrubOpts)
+
+	mu    sync.Mutex
+	stats ScrubStats
+}
+
+// NewScrubber returns a Scrubber that scrubs the record batches in storage of
+// the topics instantiated by broker. storage must be the storage that the
+// broker's topics are kept in, including encryption.
+func NewScrubber(log logger.Logger, broker *Broker, storage sebtopic.Storage, optFns ...func(*sebtopic.ScrubOpts)) *Scrubber {
+	return &Scrubber{
+		log:     log,
+		broker:  broker,
+		storage: storage,
+		optFns:  optFns,
+	}
+}
+
+// Scrub scrubs the record batches of all topics instantiated by the broker,
+// returning the findings of each topic that has any. Topics that can't be
+// scrubbed, e.g. because storage is unavailable, are skipped and their errors
+// returned.
+//
+// Repaired and quarantined record batches are removed from the cache of their
+// topic, and reading records of quarantined record batches fails with
+// seberr.ErrQuarantined.
+func (s *Scrubber) Scrub(ctx context.Context) (map[string][]sebtopic.ScrubFinding, error) {
+	findings := map[string][]sebtopic.ScrubFinding{}
+
+	topicBatchers := s.broker.madeTopicBatchers()
+	topicNames := make([]string, 0, len(topicBatchers))
+	for topicName := range topicBatchers {
+		topicNames = append(topicNames, topicName)
+	}
+	slices.Sort(topicNames)
+
+	var errs []error
+	for _, topicName := range topicNames {
+		result, err := s.scrubTopic(ctx, topicBatchers[topicName].topic, topicName)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("scrubbing topic '%s': %w", topicName, err))
+			continue
+		}
+
+		if len(result.Findings) > 0 {
+			findings[topicName] = result.Findings
+		}
+	}
+
+	s.mu.Lock()
+	s.stats.Runs += 1
+	s.stats.LastRunAt = time.Now()
+	s.mu.Unlock()
+
+	return findings, errors.Join(errs...)
+}
+
+func (s *Scrubber) scrubTopic(ctx context.Context, topic *sebtopic.Topic, topicName string) (sebtopic.ScrubResult, error) {
+	// NOTE: scrubbing may write to storage when repairing or quarantining
+	// record batches, which must not happen while a snapshot is being made.
+	s.broker.writeFence.RLock()
+	defer s.broker.writeFence.RUnlock()
+
+	optFns := append(slices.Clip(s.optFns), sebtopic.ScrubTopic(topic))
+	result, err := sebtopic.Scrub(ctx, s.log, s.storage, topicName, optFns...)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stats.RecordBatches += uint64(result.RecordBatches)
+	for _, finding := range result.Findings {
+		switch finding.Reason {
+		case sebtopic.ScrubCorrupt:
+			s.stats.Corrupt += 1
+		case sebtopic.ScrubMissing:
+			s.stats.Missing += 1
+		case sebtopic.ScrubMissingLargeRecord:
+			s.stats.MissingLargeRecords += 1
+		}
+		if finding.Repaired {
+			s.stats.Repaired += 1
+		}
+		if finding.Quarantined {
+			s.stats.Quarantined += 1
+		}
+	}
+
+	return result, err
+}
+
+// Stats returns the scrubber's stats.
+func (s *Scrubber) Stats() ScrubStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.stats
+}
+
+// ScrubLoop periodically scrubs the record batches of the broker's topics
+// using scrubber. It runs until ctx expires; errors from scrubbing are logged
+// and retried at the next interval.
+func ScrubLoop(ctx context.Context, log logger.Logger, scrubber *Scrubber, interval time.Duration) error {
+	log = log.WithField("interval", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		findings, err := scrubber.Scrub(ctx)
+		if err != nil {
+			log.Errorf("scrubbing record batches: %s", err)
+		}
+
+		for topicName, topicFindings := range findings {
+			log.Errorf("topic '%s' has %d corrupt or missing files", topicName, len(topicFindings))
+		}
+	}
+}
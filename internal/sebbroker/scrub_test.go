@@ -0,0 +1,63 @@
+package sebbroker_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestScrubberStats verifies that Scrubber.Scrub() scrubs all of the broker's
+// topics, returns the findings of topics that have any, and counts them in
+// its stats. Records of quarantined record batches must no longer be served
+// by the broker.
+func TestScrubberStats(t *testing.T) {
+	ctx := context.Background()
+	storage := sebtopic.NewMemoryStorage(log)
+	s := tester.Broker(t, storage)
+
+	for _, topicName := range []string{"topic-a", "topic-b"} {
+		for range 2 {
+			_, err := s.AddRecords(topicName, tester.MakeRandomRecordBatch(2))
+			require.NoError(t, err)
+		}
+	}
+
+	corruptKey := sebtopic.RecordBatchKey("topic-b", 2)
+	wtr, err := storage.Writer(ctx, corruptKey)
+	require.NoError(t, err)
+	tester.WriteAndClose(t, wtr, []byte("corrupt"))
+
+	scrubber := sebbroker.NewScrubber(log, s, storage, sebtopic.ScrubQuarantine(true))
+
+	// Act
+	findings, err := scrubber.Scrub(ctx)
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, []string{"topic-b"}, mapKeys(findings))
+	require.Equal(t, corruptKey, findings["topic-b"][0].Key)
+
+	stats := scrubber.Stats()
+	require.Equal(t, uint64(1), stats.Runs)
+	require.Equal(t, uint64(4), stats.RecordBatches)
+	require.Equal(t, uint64(1), stats.Corrupt)
+	require.Equal(t, uint64(1), stats.Quarantined)
+	require.Equal(t, uint64(0), stats.Repaired)
+
+	batch := tester.NewBatch(1, 1024)
+	_, err = s.GetRecord(ctx, &batch, "topic-b", 2)
+	require.ErrorIs(t, err, seberr.ErrQuarantined)
+}
+
+func mapKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,56 @@
+package sebbroker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// SealTopic permanently closes topicName for writes and returns its final next
+// offset, which is recorded in the topic's manifest. Records added to a sealed
+// topic are rejected with seberr.ErrTopicSealed, also after the broker is
+// restarted. This is useful for finalizing immutable datasets and retiring
+// pipelines.
+//
+// Sealed topics can still be read and deleted. Sealing a topic that's already
+// sealed returns its final next offset. See sebtopic.Topic.Seal.
+func (s *Broker) SealTopic(topicName string) (uint64, error) {
+	if s.readReplica {
+		return 0, errReadReplica
+	}
+
+	topicName = s.resolveTopicName(topicName)
+
+	s.writeFence.RLock()
+	defer s.writeFence.RUnlock()
+
+	// topics that haven't been instantiated during the lifetime of Broker
+	// must be instantiated in order to find out whether they exist.
+	tb, made, err := s.loadOrMakeTopicBatcher(topicName)
+	if err != nil {
+		return 0, err
+	}
+
+	if made && tb.topic.NextOffset() == 0 && !tb.topic.Sealed() {
+		s.topicBatchers.Delete(topicName)
+		return 0, fmt.Errorf("%w: '%s'", seberr.ErrTopicNotFound, topicName)
+	}
+
+	nextOffset, err := tb.topic.Seal(context.Background())
+	if err != nil {
+		return 0, fmt.Errorf("sealing topic '%s': %w", topicName, err)
+	}
+
+	return nextOffset, nil
+}
+
+// TopicSealed returns whether topicName has been sealed. See SealTopic.
+func (s *Broker) TopicSealed(topicName string) (bool, error) {
+	tb, err := s.getTopicBatcher(topicName)
+	if err != nil {
+		return false, err
+	}
+
+	return tb.topic.Sealed(), nil
+}
@@ -0,0 +1,93 @@
+package sebbroker_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBrokerSealTopic verifies that SealTopic() returns the topic's final next
+// offset, and that records added to the topic afterwards are rejected with
+// seberr.ErrTopicSealed, while the topic's records can still be read.
+func TestBrokerSealTopic(t *testing.T) {
+	const autoCreate = true
+	tester.TestBroker(t, autoCreate, func(t *testing.T, s *sebbroker.Broker) {
+		const topicName = "topic"
+
+		_, err := s.AddRecords(topicName, tester.MakeRandomRecordBatch(3))
+		require.NoError(t, err)
+
+		// Act
+		nextOffset, err := s.SealTopic(topicName)
+
+		// Assert
+		require.NoError(t, err)
+		require.Equal(t, uint64(3), nextOffset)
+
+		sealed, err := s.TopicSealed(topicName)
+		require.NoError(t, err)
+		require.True(t, sealed)
+
+		_, err = s.AddRecords(topicName, tester.MakeRandomRecordBatch(1))
+		require.ErrorIs(t, err, seberr.ErrTopicSealed)
+		require.ErrorIs(t, err, seberr.ErrWritesFrozen)
+
+		batch := tester.NewBatch(1, 4096)
+		_, err = s.GetRecord(context.Background(), &batch, topicName, 2)
+		require.NoError(t, err)
+
+		// sealing a sealed topic is a no-op
+		nextOffset, err = s.SealTopic(topicName)
+		require.NoError(t, err)
+		require.Equal(t, uint64(3), nextOffset)
+	})
+}
+
+// TestBrokerSealTopicPersists verifies that a sealed topic stays sealed for a
+// new broker using the same storage.
+func TestBrokerSealTopicPersists(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, bs sebtopic.Storage, cache *sebcache.Cache) {
+		const topicName = "topic-name"
+
+		topicFactory := func(log logger.Logger, topicName string) (*sebtopic.Topic, error) {
+			return sebtopic.New(log, bs, topicName, cache)
+		}
+
+		s1 := sebbroker.New(log, topicFactory, sebbroker.WithNullBatcher())
+		_, err := s1.AddRecords(topicName, tester.MakeRandomRecordBatch(5))
+		require.NoError(t, err)
+
+		// Act
+		_, err = s1.SealTopic(topicName)
+		require.NoError(t, err)
+
+		// Assert
+		s2 := sebbroker.New(log, topicFactory, sebbroker.WithNullBatcher())
+		_, err = s2.AddRecords(topicName, tester.MakeRandomRecordBatch(1))
+		require.ErrorIs(t, err, seberr.ErrTopicSealed)
+
+		metadata, err := s2.Metadata(topicName)
+		require.NoError(t, err)
+		require.True(t, metadata.Sealed)
+		require.Equal(t, uint64(5), metadata.NextOffset)
+	})
+}
+
+// TestBrokerSealTopicNotFound verifies that SealTopic() returns
+// seberr.ErrTopicNotFound when the topic does not exist.
+func TestBrokerSealTopicNotFound(t *testing.T) {
+	tester.TestBroker(t, false, func(t *testing.T, s *sebbroker.Broker) {
+		// Act
+		_, err := s.SealTopic("does-not-exist")
+
+		// Assert
+		require.ErrorIs(t, err, seberr.ErrTopicNotFound)
+	})
+}
@@ -0,0 +1,102 @@
+package sebbroker
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+)
+
+// Snapshot is a point-in-time manifest of the topics of a broker, describing
+// the files that held their records when it was made. See Broker.Snapshot and
+// RestoreSnapshot.
+type Snapshot struct {
+	CreatedAt time.Time                `json:"created_at"`
+	Topics    []sebtopic.TopicSnapshot `json:"topics"`
+
+	// Aliases maps topic aliases to the names of the topics they refer to.
+	Aliases map[string]string `json:"aliases"`
+}
+
+// Snapshot returns a consistent Snapshot of all topics instantiated by the
+// broker.
+//
+// While the snapshot is being made, writes are fenced: Snapshot waits for
+// records that are being added to be persisted by their batcher, and records
+// added while it's running wait for it to return. Merges, retention and topic
+// deletions are fenced in the same way.
+//
+// NOTE: the snapshot only refers to files, it doesn't copy them. Files may be
+// merged or deleted once Snapshot returns, so it should be restored using
+// RestoreSnapshot soon after, or while merges and retention are disabled.
+func (s *Broker) Snapshot(ctx context.Context) (Snapshot, error) {
+	t0 := time.Now()
+	s.writeFence.Lock()
+	defer s.writeFence.Unlock()
+
+	fencedAt := time.Now()
+	s.log.Debugf("writes fenced for snapshot after %s", fencedAt.Sub(t0))
+
+	topicBatchers := s.madeTopicBatchers()
+	topicNames := make([]string, 0, len(topicBatchers))
+	for topicName := range topicBatchers {
+		topicNames = append(topicNames, topicName)
+	}
+	slices.Sort(topicNames)
+
+	snapshot := Snapshot{
+		CreatedAt: fencedAt,
+		Topics:    make([]sebtopic.TopicSnapshot, 0, len(topicNames)),
+		Aliases:   s.TopicAliases(),
+	}
+	for _, topicName := range topicNames {
+		topicSnapshot, err := topicBatchers[topicName].topic.Snapshot(ctx)
+		if err != nil {
+			return Snapshot{}, fmt.Errorf("snapshotting topic '%s': %w", topicName, err)
+		}
+		snapshot.Topics = append(snapshot.Topics, topicSnapshot)
+	}
+
+	s.log.Infof("made snapshot of %d topics, writes fenced for %s", len(snapshot.Topics), time.Since(fencedAt))
+
+	return snapshot, nil
+}
+
+// RestoreResult describes the topics restored by RestoreSnapshot.
+type RestoreResult struct {
+	Topics int
+	Files  int
+	Bytes  int64
+}
+
+// RestoreSnapshot copies the files of the topics of snapshot from src to dst,
+// and stores its aliases in dst using StorageAliasStore. dst should be fresh
+// storage; topics that already have record batches in dst are not
+// overwritten, but make RestoreSnapshot fail. See
+// sebtopic.RestoreTopicSnapshot.
+//
+// Topics are restored one at a time. If restoring one fails, the topics that
+// were restored before it remain in dst.
+func RestoreSnapshot(ctx context.Context, src sebtopic.Storage, dst sebtopic.Storage, snapshot Snapshot) (RestoreResult, error) {
+	result := RestoreResult{}
+	for _, topicSnapshot := range snapshot.Topics {
+		topicResult, err := sebtopic.RestoreTopicSnapshot(ctx, src, dst, topicSnapshot)
+		result.Files += topicResult.Files
+		result.Bytes += topicResult.Bytes
+		if err != nil {
+			return result, fmt.Errorf("restoring topic '%s': %w", topicSnapshot.TopicName, err)
+		}
+		result.Topics += 1
+	}
+
+	if len(snapshot.Aliases) > 0 {
+		err := NewStorageAliasStore(dst).StoreAliases(ctx, snapshot.Aliases)
+		if err != nil {
+			return result, fmt.Errorf("restoring aliases: %w", err)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,116 @@
+package sebbroker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBrokerSnapshotRestore verifies that a snapshot restored to fresh
+// storage using RestoreSnapshot() holds the records and aliases of the
+// broker's topics at the time the snapshot was made.
+func TestBrokerSnapshotRestore(t *testing.T) {
+	ctx := context.Background()
+	src := sebtopic.NewMemoryStorage(log)
+	s := tester.Broker(t, src, sebbroker.WithAliasStore(sebbroker.NewStorageAliasStore(src)))
+
+	records := map[string][][]byte{
+		"topic-a": tester.MakeRandomRecordBatch(3).IndividualRecords(),
+		"topic-b": tester.MakeRandomRecordBatch(2).IndividualRecords(),
+	}
+	for topicName, topicRecords := range records {
+		_, err := s.AddRecords(topicName, tester.RecordsToBatch(topicRecords))
+		require.NoError(t, err)
+	}
+	err := s.SetTopicAlias(ctx, "alias-a", "topic-a")
+	require.NoError(t, err)
+
+	// Act
+	snapshot, err := s.Snapshot(ctx)
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, 2, len(snapshot.Topics))
+	require.Equal(t, "topic-a", snapshot.Topics[0].TopicName)
+	require.Equal(t, uint64(3), snapshot.Topics[0].NextOffset)
+	require.Equal(t, map[string]string{"alias-a": "topic-a"}, snapshot.Aliases)
+
+	// records added after the snapshot was made are not restored
+	_, err = s.AddRecords("topic-a", tester.MakeRandomRecordBatch(1))
+	require.NoError(t, err)
+
+	dst := sebtopic.NewMemoryStorage(log)
+
+	// Act
+	result, err := sebbroker.RestoreSnapshot(ctx, src, dst, snapshot)
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, 2, result.Topics)
+
+	restored := tester.Broker(t, dst, sebbroker.WithAliasStore(sebbroker.NewStorageAliasStore(dst)))
+	err = restored.LoadTopicAliases(ctx)
+	require.NoError(t, err)
+
+	for topicName, topicName2 := range map[string]string{"topic-a": "alias-a", "topic-b": "topic-b"} {
+		batch := tester.NewBatch(10, 4096)
+		err = restored.GetRecords(ctx, &batch, topicName2, 0, 10, 0)
+		require.NoError(t, err)
+		require.Equal(t, records[topicName], batch.IndividualRecords())
+	}
+}
+
+// TestBrokerSnapshotFencesWrites verifies that Snapshot() waits for records
+// that are being added to be persisted, such that they're part of the
+// snapshot.
+func TestBrokerSnapshotFencesWrites(t *testing.T) {
+	storage := sebtopic.NewMemoryStorage(log)
+	cache, err := sebcache.NewMemoryCache(log)
+	require.NoError(t, err)
+
+	persisting := make(chan struct{})
+	unblockPersist := make(chan struct{})
+	batcherFactory := func(_ logger.Logger, topic *sebtopic.Topic) sebbroker.RecordBatcher {
+		return sebbroker.NewNullBatcher(func(batch sebrecords.Batch) ([]uint64, error) {
+			close(persisting)
+			<-unblockPersist
+			return topic.AddRecords(batch)
+		})
+	}
+
+	s := sebbroker.New(log, sebbroker.NewStorageTopicFactory(storage, cache), sebbroker.WithBatcherFactory(batcherFactory))
+
+	go func() {
+		_, err := s.AddRecords("topic", tester.MakeRandomRecordBatch(2))
+		require.NoError(t, err)
+	}()
+	<-persisting
+
+	snapshotted := make(chan sebbroker.Snapshot)
+	go func() {
+		snapshot, err := s.Snapshot(context.Background())
+		require.NoError(t, err)
+		snapshotted <- snapshot
+	}()
+
+	// Act
+	select {
+	case <-snapshotted:
+		t.Fatalf("expected Snapshot() to wait for records being added")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(unblockPersist)
+
+	// Assert
+	snapshot := <-snapshotted
+	require.Equal(t, 1, len(snapshot.Topics))
+	require.Equal(t, uint64(2), snapshot.Topics[0].NextOffset)
+}
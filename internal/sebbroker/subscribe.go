@@ -0,0 +1,113 @@
+package sebbroker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/micvbang/go-helpy/sizey"
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+)
+
+// SubscribedBatch is a batch of records delivered by Subscribe.
+type SubscribedBatch struct {
+	// Offset is the offset that Batch was read from.
+	Offset uint64
+
+	// NextOffset is the offset following the records of Batch, including
+	// any records that were skipped because they expired.
+	NextOffset uint64
+
+	Batch sebrecords.Batch
+
+	// Err is set on the last SubscribedBatch if the subscription failed.
+	Err error
+}
+
+type SubscribeOpts struct {
+	MaxRecords int
+	MaxBytes   int
+}
+
+// WithSubscribeMaxRecords sets the maximum number of records in each batch
+// delivered by Subscribe.
+func WithSubscribeMaxRecords(maxRecords int) func(*SubscribeOpts) {
+	return func(o *SubscribeOpts) {
+		o.MaxRecords = maxRecords
+	}
+}
+
+// WithSubscribeMaxBytes sets the maximum number of bytes of records in each
+// batch delivered by Subscribe. Records larger than this can't be delivered,
+// and fail the subscription.
+func WithSubscribeMaxBytes(maxBytes int) func(*SubscribeOpts) {
+	return func(o *SubscribeOpts) {
+		o.MaxBytes = maxBytes
+	}
+}
+
+// Subscribe returns a channel on which batches of the records of topicName,
+// starting from fromOffset, are delivered as they're committed. Subscribers
+// wait for new records using the topic's OffsetCond, so they don't have to
+// poll GetRecords.
+//
+// Each delivered batch is owned by the receiver. Records that have expired
+// are skipped and counted in Batch.Skipped.
+//
+// The channel is closed when ctx expires, or after delivering a
+// SubscribedBatch with Err set if reading records fails.
+func (s *Broker) Subscribe(ctx context.Context, topicName string, fromOffset uint64, optFuncs ...func(*SubscribeOpts)) (<-chan SubscribedBatch, error) {
+	opts := SubscribeOpts{
+		MaxRecords: 100,
+		MaxBytes:   sizey.MB,
+	}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+
+	tb, err := s.getTopicBatcher(topicName)
+	if err != nil {
+		return nil, err
+	}
+
+	batches := make(chan SubscribedBatch)
+	go func() {
+		defer close(batches)
+
+		offset := fromOffset
+		for {
+			err := tb.topic.OffsetCond.WaitReached(ctx, offset)
+			if err != nil {
+				return
+			}
+
+			batch := sebrecords.NewBatch(make([]uint32, 0, opts.MaxRecords), make([]byte, 0, opts.MaxBytes))
+			err = tb.topic.ReadRecords(ctx, &batch, offset, opts.MaxRecords, opts.MaxBytes)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+
+				err = fmt.Errorf("reading records of topic '%s' from offset %d: %w", topicName, offset, err)
+				select {
+				case batches <- SubscribedBatch{Offset: offset, NextOffset: offset, Err: err}:
+				case <-ctx.Done():
+				}
+				return
+			}
+
+			nextOffset := offset + uint64(batch.Len()+batch.Skipped)
+
+			// all of the records that were read had expired; wait for new ones
+			if batch.Len() > 0 {
+				select {
+				case batches <- SubscribedBatch{Offset: offset, NextOffset: nextOffset, Batch: batch}:
+				case <-ctx.Done():
+					return
+				}
+			}
+			offset = nextOffset
+		}
+	}()
+
+	return batches, nil
+}
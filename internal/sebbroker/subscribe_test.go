@@ -0,0 +1,101 @@
+package sebbroker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBrokerSubscribe verifies that Subscribe() delivers records as they're
+// added, to multiple subscribers starting from different offsets, including
+// subscribers that subscribed before the topic had any records.
+func TestBrokerSubscribe(t *testing.T) {
+	const autoCreateTopic = true
+	tester.TestBroker(t, autoCreateTopic, func(t *testing.T, s *sebbroker.Broker) {
+		const topicName = "topic-name"
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Act
+		fromStart, err := s.Subscribe(ctx, topicName, 0, sebbroker.WithSubscribeMaxRecords(2))
+		require.NoError(t, err)
+
+		fromMiddle, err := s.Subscribe(ctx, topicName, 3)
+		require.NoError(t, err)
+
+		records := [][]byte{}
+		for range 3 {
+			batch := tester.MakeRandomRecordBatch(2)
+			_, err = s.AddRecords(topicName, batch)
+			require.NoError(t, err)
+			records = append(records, batch.IndividualRecords()...)
+		}
+
+		// Assert
+		require.Equal(t, records, receiveRecords(t, fromStart, 0, len(records)))
+		require.Equal(t, records[3:], receiveRecords(t, fromMiddle, 3, len(records)-3))
+	})
+}
+
+// TestBrokerSubscribeContextCancelled verifies that the channel returned by
+// Subscribe() is closed when its context is cancelled.
+func TestBrokerSubscribeContextCancelled(t *testing.T) {
+	const autoCreateTopic = true
+	tester.TestBroker(t, autoCreateTopic, func(t *testing.T, s *sebbroker.Broker) {
+		const topicName = "topic-name"
+		_, err := s.AddRecords(topicName, tester.MakeRandomRecordBatch(1))
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		batches, err := s.Subscribe(ctx, topicName, 1)
+		require.NoError(t, err)
+
+		// Act
+		cancel()
+
+		// Assert
+		_, ok := <-batches
+		require.False(t, ok)
+	})
+}
+
+// TestBrokerSubscribeTopicNotFound verifies that Subscribe() returns
+// seberr.ErrTopicNotFound for topics that don't exist, when topics aren't
+// automatically created.
+func TestBrokerSubscribeTopicNotFound(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, ts sebtopic.Storage, cache *sebcache.Cache) {
+		broker := sebbroker.New(log,
+			sebbroker.NewTopicFactory(ts, cache),
+			sebbroker.WithAutoCreateTopic(false),
+		)
+
+		// Act
+		_, err := broker.Subscribe(context.Background(), "does-not-exist", 0)
+
+		// Assert
+		require.ErrorIs(t, err, seberr.ErrTopicNotFound)
+	})
+}
+
+// receiveRecords receives batches from batches until numRecords records have
+// been received, verifying that batches are contiguous from offset.
+func receiveRecords(t *testing.T, batches <-chan sebbroker.SubscribedBatch, offset uint64, numRecords int) [][]byte {
+	records := [][]byte{}
+	for len(records) < numRecords {
+		batch, ok := <-batches
+		require.True(t, ok)
+		require.NoError(t, batch.Err)
+		require.Equal(t, offset, batch.Offset)
+
+		records = append(records, batch.Batch.IndividualRecords()...)
+		offset = batch.NextOffset
+	}
+	return records
+}
@@ -0,0 +1,138 @@
+package sebbroker
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// SetTopicRetention sets the retention of topicName. Records added to
+// topicName without an expiry time expire after retention. Records that were
+// added before calling SetTopicRetention are unaffected. Retention is disabled
+// if 0.
+//
+// NOTE: like write freezes, retention is only kept in memory for the lifetime
+// of Broker.
+func (s *Broker) SetTopicRetention(topicName string, retention time.Duration) {
+	topicName = s.resolveTopicName(topicName)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.log.WithField("topic-name", topicName).Infof("setting topic retention: %s", retention)
+	if retention > 0 {
+		s.topicRetention[topicName] = retention
+	} else {
+		delete(s.topicRetention, topicName)
+	}
+}
+
+// TopicRetention returns the retention of topicName, 0 if disabled.
+func (s *Broker) TopicRetention(topicName string) time.Duration {
+	topicName = s.resolveTopicName(topicName)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.topicRetention[topicName]
+}
+
+// SetTopicLabels merges labels into the labels of topicName. Labels with an
+// empty value are removed.
+//
+// NOTE: like write freezes, labels are only kept in memory for the lifetime
+// of Broker.
+func (s *Broker) SetTopicLabels(topicName string, labels map[string]string) {
+	topicName = s.resolveTopicName(topicName)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.log.WithField("topic-name", topicName).Infof("setting topic labels: %v", labels)
+
+	topicLabels, ok := s.topicLabels[topicName]
+	if !ok {
+		topicLabels = make(map[string]string, len(labels))
+		s.topicLabels[topicName] = topicLabels
+	}
+
+	for key, value := range labels {
+		if value == "" {
+			delete(topicLabels, key)
+			continue
+		}
+		topicLabels[key] = value
+	}
+
+	if len(topicLabels) == 0 {
+		delete(s.topicLabels, topicName)
+	}
+}
+
+// TopicLabels returns a copy of the labels of topicName.
+func (s *Broker) TopicLabels(topicName string) map[string]string {
+	topicName = s.resolveTopicName(topicName)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return maps.Clone(s.topicLabels[topicName])
+}
+
+// MatchTopics returns the names of the topics returned by TopicNames() whose
+// name matches pattern and whose labels include all of labels. pattern uses
+// the syntax of path.Match, e.g. "orders-*"; all topic names match if pattern
+// is empty.
+func (s *Broker) MatchTopics(pattern string, labels map[string]string) ([]string, error) {
+	if pattern != "" {
+		// validate pattern even if there are no topics to match it against
+		_, err := path.Match(pattern, "")
+		if err != nil {
+			return nil, fmt.Errorf("%w: pattern '%s': %s", seberr.ErrBadInput, pattern, err)
+		}
+	}
+
+	topicNames := s.TopicNames()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.DeleteFunc(topicNames, func(topicName string) bool {
+		if pattern != "" {
+			matched, _ := path.Match(pattern, topicName)
+			if !matched {
+				return true
+			}
+		}
+
+		topicLabels := s.topicLabels[topicName]
+		for key, value := range labels {
+			if topicLabels[key] != value {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+// applyRetention returns a copy of batch in which records without an expiry
+// time expire after retention.
+func applyRetention(batch sebrecords.Batch, retention time.Duration, now time.Time) sebrecords.Batch {
+	expiresUs := now.Add(retention).UnixMicro()
+
+	expires := make([]int64, batch.Len())
+	copy(expires, batch.Expires)
+	for i, v := range expires {
+		if v == 0 {
+			expires[i] = expiresUs
+		}
+	}
+
+	batch.Expires = expires
+	return batch
+}
@@ -0,0 +1,117 @@
+package sebbroker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBrokerTopicRetention verifies that records added without an expiry time
+// expire after the topic's retention, and that records with an expiry time
+// keep it.
+func TestBrokerTopicRetention(t *testing.T) {
+	tester.TestBroker(t, true, func(t *testing.T, s *sebbroker.Broker) {
+		const topicName = "topic"
+
+		// Act
+		s.SetTopicRetention(topicName, time.Nanosecond)
+		require.Equal(t, time.Nanosecond, s.TopicRetention(topicName))
+
+		batch := tester.MakeRandomRecordBatch(3)
+		batch.Expires = []int64{0, 0, time.Now().Add(time.Hour).UnixMicro()}
+		_, err := s.AddRecords(topicName, batch)
+		require.NoError(t, err)
+
+		// Assert
+		time.Sleep(time.Millisecond)
+		gotBatch := tester.NewBatch(10, 4096)
+		err = s.GetRecords(context.Background(), &gotBatch, topicName, 0, 10, 0)
+		require.NoError(t, err)
+		require.Equal(t, batch.IndividualRecords()[2:], gotBatch.IndividualRecords())
+		require.Equal(t, 2, gotBatch.Skipped)
+
+		// disabling retention makes new records not expire
+		s.SetTopicRetention(topicName, 0)
+		require.Equal(t, time.Duration(0), s.TopicRetention(topicName))
+	})
+}
+
+// TestBrokerTopicLabels verifies that SetTopicLabels() merges labels into a
+// topic's existing labels, removing labels with empty values.
+func TestBrokerTopicLabels(t *testing.T) {
+	tester.TestBroker(t, true, func(t *testing.T, s *sebbroker.Broker) {
+		const topicName = "topic"
+
+		// Act
+		s.SetTopicLabels(topicName, map[string]string{"team": "a", "env": "prod"})
+		s.SetTopicLabels(topicName, map[string]string{"team": "b", "env": ""})
+
+		// Assert
+		require.Equal(t, map[string]string{"team": "b"}, s.TopicLabels(topicName))
+	})
+}
+
+// TestBrokerMatchTopics verifies that MatchTopics() returns the topics whose
+// names match the given pattern and whose labels include the given labels.
+func TestBrokerMatchTopics(t *testing.T) {
+	tester.TestBroker(t, true, func(t *testing.T, s *sebbroker.Broker) {
+		for _, topicName := range []string{"orders-eu", "orders-us", "payments-eu"} {
+			_, err := s.AddRecords(topicName, tester.MakeRandomRecordBatch(1))
+			require.NoError(t, err)
+		}
+		s.SetTopicLabels("orders-eu", map[string]string{"region": "eu"})
+		s.SetTopicLabels("payments-eu", map[string]string{"region": "eu"})
+
+		tests := map[string]struct {
+			pattern  string
+			labels   map[string]string
+			expected []string
+		}{
+			"pattern": {
+				pattern:  "orders-*",
+				expected: []string{"orders-eu", "orders-us"},
+			},
+			"labels": {
+				labels:   map[string]string{"region": "eu"},
+				expected: []string{"orders-eu", "payments-eu"},
+			},
+			"pattern and labels": {
+				pattern:  "orders-*",
+				labels:   map[string]string{"region": "eu"},
+				expected: []string{"orders-eu"},
+			},
+			"no match": {
+				pattern:  "does-not-exist",
+				expected: []string{},
+			},
+		}
+
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				// Act
+				got, err := s.MatchTopics(test.pattern, test.labels)
+
+				// Assert
+				require.NoError(t, err)
+				require.Equal(t, test.expected, got)
+			})
+		}
+	})
+}
+
+// TestBrokerMatchTopicsBadPattern verifies that MatchTopics() returns
+// ErrBadInput when given an invalid pattern.
+func TestBrokerMatchTopicsBadPattern(t *testing.T) {
+	tester.TestBroker(t, true, func(t *testing.T, s *sebbroker.Broker) {
+		// Act
+		_, err := s.MatchTopics("[", nil)
+
+		// Assert
+		require.ErrorIs(t, err, seberr.ErrBadInput)
+	})
+}
@@ -0,0 +1,82 @@
+package sebbroker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+)
+
+// TopicUsage describes the resources used by a topic, such that costs can be
+// attributed to it.
+type TopicUsage struct {
+	Storage sebtopic.StorageUsage
+	Cache   sebcache.TopicUsage
+}
+
+// Usage returns the storage and cache usage of each topic instantiated by the
+// broker, by topic name.
+func (s *Broker) Usage() map[string]TopicUsage {
+	topicBatchers := s.madeTopicBatchers()
+
+	usage := make(map[string]TopicUsage, len(topicBatchers))
+	for topicName, tb := range topicBatchers {
+		usage[topicName] = TopicUsage{
+			Storage: tb.topic.StorageUsage(),
+			Cache:   tb.topic.CacheUsage(),
+		}
+	}
+
+	return usage
+}
+
+// ReconcileUsage reconciles the storage usage of the topics instantiated by the
+// broker that were last reconciled before reconciledBefore with the files in
+// backing storage. Topics that can't be reconciled are skipped and their errors
+// returned.
+func (s *Broker) ReconcileUsage(ctx context.Context, reconciledBefore time.Time) error {
+	var errs []error
+	for topicName, tb := range s.madeTopicBatchers() {
+		if !tb.topic.StorageUsage().ReconciledAt.Before(reconciledBefore) {
+			continue
+		}
+
+		_, err := tb.topic.ReconcileStorageUsage(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("reconciling usage of topic '%s': %w", topicName, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// UsageLoop periodically reconciles the storage usage of the broker's topics
+// such that each topic is reconciled once every interval. Topics that have
+// never been reconciled, e.g. because they were just instantiated, are
+// reconciled within a minute. It runs until ctx expires; errors are logged and
+// retried at the next tick.
+func UsageLoop(ctx context.Context, log logger.Logger, broker *Broker, interval time.Duration) error {
+	log = log.WithField("interval", interval)
+
+	ticker := time.NewTicker(min(interval, time.Minute))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		t0 := time.Now()
+		err := broker.ReconcileUsage(ctx, t0.Add(-interval))
+		if err != nil {
+			log.Errorf("reconciling usage: %s", err)
+		}
+		log.Debugf("reconciled usage in %s", time.Since(t0))
+	}
+}
@@ -0,0 +1,55 @@
+package sebbroker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBrokerUsage verifies that Usage() returns the usage of each of the
+// broker's topics, and that ReconcileUsage() only reconciles topics that were
+// last reconciled before the given time.
+func TestBrokerUsage(t *testing.T) {
+	tester.TestBroker(t, true, func(t *testing.T, s *sebbroker.Broker) {
+		ctx := context.Background()
+
+		for _, topicName := range []string{"topic-a", "topic-b"} {
+			_, err := s.AddRecords(topicName, tester.MakeRandomRecordBatch(2))
+			require.NoError(t, err)
+		}
+
+		// Act
+		usage := s.Usage()
+
+		// Assert
+		require.ElementsMatch(t, []string{"topic-a", "topic-b"}, mapKeys(usage))
+		for _, topicUsage := range usage {
+			require.Equal(t, 1, topicUsage.Storage.RecordBatchFiles)
+			require.True(t, topicUsage.Storage.ReconciledAt.IsZero())
+		}
+
+		// Act
+		err := s.ReconcileUsage(ctx, time.Time{})
+		require.NoError(t, err)
+
+		// Assert
+		for _, topicUsage := range s.Usage() {
+			require.True(t, topicUsage.Storage.ReconciledAt.IsZero())
+		}
+
+		// Act
+		reconciledBefore := time.Now()
+		err = s.ReconcileUsage(ctx, reconciledBefore)
+		require.NoError(t, err)
+
+		// Assert
+		for topicName, topicUsage := range s.Usage() {
+			require.False(t, topicUsage.Storage.ReconciledAt.Before(reconciledBefore))
+			require.Equal(t, usage[topicName].Storage.Bytes(), topicUsage.Storage.Bytes())
+		}
+	})
+}
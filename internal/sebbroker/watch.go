@@ -0,0 +1,206 @@
+package sebbroker
+
+import (
+	"context"
+	"sync"
+)
+
+// TopicEventType is the type of change that a TopicEvent describes.
+type TopicEventType string
+
+const (
+	// TopicEventCreated is delivered when a topic is created, or used for the
+	// first time during the lifetime of Broker. See TopicNames.
+	TopicEventCreated TopicEventType = "created"
+
+	// TopicEventDeleted is delivered when a topic is deleted.
+	TopicEventDeleted TopicEventType = "deleted"
+
+	// TopicEventAdvanced is delivered when records have been added to a
+	// topic, advancing its next offset.
+	TopicEventAdvanced TopicEventType = "advanced"
+)
+
+// TopicEvent describes a change to a topic, delivered by Watch.
+type TopicEvent struct {
+	Type      TopicEventType
+	TopicName string
+
+	// NextOffset is the next offset of the topic after the change. It's 0 for
+	// TopicEventDeleted.
+	NextOffset uint64
+}
+
+type WatchOpts struct {
+	// TopicNames are the names of the topics to deliver events of. Events of
+	// all topics are delivered if empty.
+	TopicNames []string
+
+	// BufferSize is the number of events that are buffered for receivers that
+	// fall behind.
+	BufferSize int
+}
+
+// WithWatchTopicNames limits the events delivered by Watch to those of
+// topicNames. Aliases are resolved when Watch is called.
+func WithWatchTopicNames(topicNames ...string) func(*WatchOpts) {
+	return func(o *WatchOpts) {
+		o.TopicNames = append(o.TopicNames, topicNames...)
+	}
+}
+
+// WithWatchBufferSize sets the number of events that Watch buffers for
+// receivers that fall behind.
+func WithWatchBufferSize(size int) func(*WatchOpts) {
+	return func(o *WatchOpts) {
+		o.BufferSize = size
+	}
+}
+
+// Watch returns a channel on which events are delivered when topics are
+// created or deleted, or when their next offset advances, such that callers
+// don't have to poll Metadata to notice changes. Events are delivered with the
+// names of the topics that aliases refer to.
+//
+// Events of each topic are delivered in the order they happened, but
+// TopicEventAdvanced events are coalesced: when several record batches are
+// added at once, only the latest next offset may be delivered.
+//
+// The channel is closed when ctx expires, when the broker is shut down, or
+// when the receiver has fallen so far behind that the buffer is full. In the
+// last case, events would otherwise be lost, so receivers must read the
+// current state of the topics they're interested in before watching again.
+func (s *Broker) Watch(ctx context.Context, optFuncs ...func(*WatchOpts)) <-chan TopicEvent {
+	opts := WatchOpts{
+		BufferSize: 256,
+	}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+
+	watcher := &topicWatcher{
+		events:     make(chan TopicEvent, max(1, opts.BufferSize)),
+		overflowed: make(chan struct{}),
+	}
+	if len(opts.TopicNames) > 0 {
+		watcher.topicNames = make(map[string]struct{}, len(opts.TopicNames))
+		for _, topicName := range opts.TopicNames {
+			watcher.topicNames[s.resolveTopicName(topicName)] = struct{}{}
+		}
+	}
+
+	s.watchers.add(watcher)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-s.shutdown:
+		case <-watcher.overflowed:
+		}
+		s.watchers.remove(watcher)
+	}()
+
+	return watcher.events
+}
+
+// topicWatchers delivers TopicEvents to the channels returned by Watch.
+type topicWatchers struct {
+	mu       sync.Mutex
+	watchers map[*topicWatcher]struct{}
+
+	// nextOffsets holds the latest next offset delivered in a
+	// TopicEventAdvanced event, by topic name.
+	nextOffsets map[string]uint64
+}
+
+type topicWatcher struct {
+	events chan TopicEvent
+
+	// topicNames is nil if events of all topics are delivered.
+	topicNames map[string]struct{}
+
+	// overflowed is closed when an event couldn't be delivered because
+	// events was full. No further events are delivered once it's closed.
+	// hasOverflowed is protected by the mutex of topicWatchers.
+	overflowed    chan struct{}
+	hasOverflowed bool
+}
+
+func newTopicWatchers() *topicWatchers {
+	return &topicWatchers{
+		watchers:    make(map[*topicWatcher]struct{}),
+		nextOffsets: make(map[string]uint64),
+	}
+}
+
+func (w *topicWatchers) add(watcher *topicWatcher) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.watchers[watcher] = struct{}{}
+}
+
+func (w *topicWatchers) remove(watcher *topicWatcher) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.watchers[watcher]; !ok {
+		return
+	}
+	delete(w.watchers, watcher)
+	close(watcher.events)
+}
+
+// created delivers a TopicEventCreated event of topicName.
+func (w *topicWatchers) created(topicName string, nextOffset uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.nextOffsets[topicName] = nextOffset
+	w.deliver(TopicEvent{Type: TopicEventCreated, TopicName: topicName, NextOffset: nextOffset})
+}
+
+// deleted delivers a TopicEventDeleted event of topicName.
+func (w *topicWatchers) deleted(topicName string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(w.nextOffsets, topicName)
+	w.deliver(TopicEvent{Type: TopicEventDeleted, TopicName: topicName})
+}
+
+// advanced delivers a TopicEventAdvanced event of topicName, unless a later
+// next offset has already been delivered.
+func (w *topicWatchers) advanced(topicName string, nextOffset uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if nextOffset <= w.nextOffsets[topicName] {
+		return
+	}
+	w.nextOffsets[topicName] = nextOffset
+	w.deliver(TopicEvent{Type: TopicEventAdvanced, TopicName: topicName, NextOffset: nextOffset})
+}
+
+// deliver sends event to the watchers of its topic without blocking.
+// Watchers whose buffer is full are marked as overflowed, causing them to be
+// removed.
+// NOTE: you must hold w.mu when calling this method!
+func (w *topicWatchers) deliver(event TopicEvent) {
+	for watcher := range w.watchers {
+		if watcher.hasOverflowed {
+			continue
+		}
+		if watcher.topicNames != nil {
+			if _, ok := watcher.topicNames[event.TopicName]; !ok {
+				continue
+			}
+		}
+
+		select {
+		case watcher.events <- event:
+		default:
+			watcher.hasOverflowed = true
+			close(watcher.overflowed)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package sebbroker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWatch verifies that Watch delivers events when topics are created,
+// deleted and when records are added to them, and that events are limited to
+// the given topics.
+func TestWatch(t *testing.T) {
+	s := tester.Broker(t, sebtopic.NewMemoryStorage(log))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := s.Watch(ctx)
+
+	err := s.CreateTopic("topic")
+	require.NoError(t, err)
+	err = s.SetTopicAlias(ctx, "alias", "topic")
+	require.NoError(t, err)
+
+	filtered := s.Watch(ctx, sebbroker.WithWatchTopicNames("alias"))
+
+	// Act
+	_, err = s.AddRecords("other", tester.MakeRandomRecordBatch(1))
+	require.NoError(t, err)
+	_, err = s.AddRecords("alias", tester.MakeRandomRecordBatch(2))
+	require.NoError(t, err)
+	_, err = s.AddRecords("topic", tester.MakeRandomRecordBatch(3))
+	require.NoError(t, err)
+	err = s.DeleteTopic("topic")
+	require.NoError(t, err)
+
+	// Assert
+	expected := []sebbroker.TopicEvent{
+		{Type: sebbroker.TopicEventCreated, TopicName: "topic"},
+		{Type: sebbroker.TopicEventCreated, TopicName: "other"},
+		{Type: sebbroker.TopicEventAdvanced, TopicName: "other", NextOffset: 1},
+		{Type: sebbroker.TopicEventAdvanced, TopicName: "topic", NextOffset: 2},
+		{Type: sebbroker.TopicEventAdvanced, TopicName: "topic", NextOffset: 5},
+		{Type: sebbroker.TopicEventDeleted, TopicName: "topic"},
+	}
+	require.Equal(t, expected, receiveEvents(t, events, len(expected)))
+
+	require.Equal(t, expected[3:], receiveEvents(t, filtered, 3))
+
+	// Act
+	cancel()
+
+	// Assert
+	_, ok := <-receiveUntilClosed(events)
+	require.False(t, ok)
+}
+
+// TestWatchCreateExistingTopic verifies that Watch doesn't deliver an event
+// when CreateTopic fails because the topic already exists in storage, but
+// hasn't been loaded by the broker.
+func TestWatchCreateExistingTopic(t *testing.T) {
+	storage := sebtopic.NewMemoryStorage(log)
+
+	_, err := tester.Broker(t, storage).AddRecords("topic", tester.MakeRandomRecordBatch(1))
+	require.NoError(t, err)
+
+	s := tester.Broker(t, storage)
+	events := s.Watch(context.Background())
+
+	// Act
+	err = s.CreateTopic("topic")
+	require.ErrorIs(t, err, seberr.ErrTopicAlreadyExists)
+	err = s.CreateTopic("other")
+	require.NoError(t, err)
+
+	// Assert
+	expected := []sebbroker.TopicEvent{
+		{Type: sebbroker.TopicEventCreated, TopicName: "other"},
+	}
+	require.Equal(t, expected, receiveEvents(t, events, len(expected)))
+}
+
+// TestWatchOverflow verifies that the channel returned by Watch is closed
+// when the receiver falls so far behind that events would be lost, after
+// delivering the buffered events.
+func TestWatchOverflow(t *testing.T) {
+	s := tester.Broker(t, sebtopic.NewMemoryStorage(log))
+
+	events := s.Watch(context.Background(), sebbroker.WithWatchBufferSize(2))
+
+	// Act
+	for range 3 {
+		_, err := s.AddRecords("topic", tester.MakeRandomRecordBatch(1))
+		require.NoError(t, err)
+	}
+
+	// Assert
+	expected := []sebbroker.TopicEvent{
+		{Type: sebbroker.TopicEventCreated, TopicName: "topic"},
+		{Type: sebbroker.TopicEventAdvanced, TopicName: "topic", NextOffset: 1},
+	}
+	require.Equal(t, expected, receiveEvents(t, events, len(expected)))
+
+	_, ok := <-receiveUntilClosed(events)
+	require.False(t, ok)
+}
+
+// TestWatchShutdown verifies that the channel returned by Watch is closed
+// when the broker is shut down.
+func TestWatchShutdown(t *testing.T) {
+	s := tester.Broker(t, sebtopic.NewMemoryStorage(log))
+	events := s.Watch(context.Background())
+
+	// Act
+	s.Shutdown()
+
+	// Assert
+	_, ok := <-receiveUntilClosed(events)
+	require.False(t, ok)
+}
+
+func receiveEvents(t *testing.T, events <-chan sebbroker.TopicEvent, n int) []sebbroker.TopicEvent {
+	received := make([]sebbroker.TopicEvent, 0, n)
+	for len(received) < n {
+		select {
+		case event, ok := <-events:
+			require.True(t, ok, "channel closed after %d events", len(received))
+			received = append(received, event)
+		case <-time.After(time.Second):
+			require.Fail(t, "timed out waiting for events", "received %d of %d", len(received), n)
+		}
+	}
+
+	return received
+}
+
+// receiveUntilClosed returns a channel that is closed once events has been
+// closed, or that receives a value if that doesn't happen within a second.
+func receiveUntilClosed(events <-chan sebbroker.TopicEvent) <-chan sebbroker.TopicEvent {
+	closed := make(chan sebbroker.TopicEvent)
+	go func() {
+		defer close(closed)
+
+		timeout := time.After(time.Second)
+		for {
+			select {
+			case _, ok := <-events:
+				if !ok {
+					return
+				}
+			case <-timeout:
+				closed <- sebbroker.TopicEvent{}
+				return
+			}
+		}
+	}()
+
+	return closed
+}
@@ -0,0 +1,22 @@
+package sebbroker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// FlushWrites waits for the record batches added to all topics that have been
+// used by the broker to be written to backing storage, e.g. when shutting
+// down. See sebtopic.WithWriteBehind.
+func (s *Broker) FlushWrites(ctx context.Context) error {
+	var errs []error
+	for topicName, tb := range s.madeTopicBatchers() {
+		err := tb.topic.FlushWrites(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("flushing writes of topic '%s': %w", topicName, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
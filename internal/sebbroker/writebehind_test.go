@@ -0,0 +1,44 @@
+package sebbroker_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBrokerFlushWrites verifies that FlushWrites returns once the record
+// batches of all topics using write-behind have been written to backing
+// storage.
+func TestBrokerFlushWrites(t *testing.T) {
+	ctx := context.Background()
+	storage := sebtopic.NewMemoryStorage(log)
+
+	cache, err := sebcache.NewMemoryCache(log)
+	require.NoError(t, err)
+	broker := sebbroker.New(log,
+		sebbroker.NewStorageTopicFactory(storage, cache, sebbroker.WithTopicOpts(sebtopic.WithWriteBehind(8, time.Millisecond))),
+		sebbroker.WithNullBatcher(),
+	)
+
+	topicNames := []string{"topic-a", "topic-b"}
+	for _, topicName := range topicNames {
+		_, err := broker.AddRecords(topicName, tester.MakeRandomRecordBatch(2))
+		require.NoError(t, err)
+	}
+
+	// Act
+	err = broker.FlushWrites(ctx)
+
+	// Assert
+	require.NoError(t, err)
+	for _, topicName := range topicNames {
+		_, err := storage.Reader(ctx, sebtopic.RecordBatchKey(topicName, 0))
+		require.NoError(t, err)
+	}
+}
@@ -0,0 +1,162 @@
+package sebcache
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+)
+
+// Opts configures which items are admitted to a Cache and how much of it each
+// topic may use.
+type Opts struct {
+	// MaxItemBytes is the size of the largest item that is admitted to the
+	// cache. Admission by size is disabled if 0.
+	MaxItemBytes int64
+
+	// TailItems is the number of most recent items of each topic that are
+	// admitted to the cache when they're written using a context with a tail
+	// distance, see WithTailDistance. Admission by tail distance is disabled
+	// if 0.
+	TailItems int
+
+	// TopicMaxBytes is the number of bytes that the items of each topic may
+	// take up before the topic's least recently used items are evicted.
+	// Disabled if 0.
+	TopicMaxBytes int64
+
+	// TopicQuotas overrides TopicMaxBytes for individual topics.
+	TopicQuotas map[string]int64
+}
+
+// WithMaxItemBytes makes the cache not admit items larger than bytes.
+func WithMaxItemBytes(bytes int64) func(*Opts) {
+	return func(o *Opts) {
+		o.MaxItemBytes = bytes
+	}
+}
+
+// WithTailItems makes the cache only admit items that are written with a tail
+// distance less than items. See WithTailDistance.
+func WithTailItems(items int) func(*Opts) {
+	return func(o *Opts) {
+		o.TailItems = items
+	}
+}
+
+// WithTopicMaxBytes limits the number of bytes that the items of each topic
+// may take up in the cache.
+func WithTopicMaxBytes(bytes int64) func(*Opts) {
+	return func(o *Opts) {
+		o.TopicMaxBytes = bytes
+	}
+}
+
+// WithTopicQuota limits the number of bytes that the items of topicName may
+// take up in the cache, overriding WithTopicMaxBytes.
+func WithTopicQuota(topicName string, bytes int64) func(*Opts) {
+	return func(o *Opts) {
+		if o.TopicQuotas == nil {
+			o.TopicQuotas = map[string]int64{}
+		}
+		o.TopicQuotas[topicName] = bytes
+	}
+}
+
+type tailDistanceKey struct{}
+
+// WithTailDistance returns a copy of ctx that marks items written using it as
+// having distance newer items in their topic, e.g. the number of record
+// batches following the one being written.
+func WithTailDistance(ctx context.Context, distance int) context.Context {
+	return context.WithValue(ctx, tailDistanceKey{}, distance)
+}
+
+// tailDistanceFromContext returns the tail distance set on ctx using
+// WithTailDistance, defaulting to 0.
+func tailDistanceFromContext(ctx context.Context) int {
+	distance, _ := ctx.Value(tailDistanceKey{}).(int)
+	return distance
+}
+
+type bypassKey struct{}
+
+// WithBypass returns a copy of ctx that makes items written using it not be
+// admitted to the cache, e.g. for large one-off reads that would otherwise
+// evict the items of other readers.
+func WithBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassKey{}, true)
+}
+
+// bypassFromContext returns whether ctx was made using WithBypass.
+func bypassFromContext(ctx context.Context) bool {
+	bypass, _ := ctx.Value(bypassKey{}).(bool)
+	return bypass
+}
+
+// admit returns whether an item of size bytes, written using ctx, is admitted
+// to the cache.
+func (c *Cache) admit(ctx context.Context, size int64) bool {
+	if bypassFromContext(ctx) {
+		return false
+	}
+
+	if c.opts.MaxItemBytes > 0 && size > c.opts.MaxItemBytes {
+		return false
+	}
+
+	if c.opts.TailItems > 0 && tailDistanceFromContext(ctx) >= c.opts.TailItems {
+		return false
+	}
+
+	return true
+}
+
+// topicQuota returns the number of bytes that the items of topicName may take
+// up, or 0 if they're not limited.
+func (c *Cache) topicQuota(topicName string) int64 {
+	if quota, ok := c.opts.TopicQuotas[topicName]; ok {
+		return quota
+	}
+	return c.opts.TopicMaxBytes
+}
+
+// enforceTopicQuota evicts the least recently used items of key's topic until
+// they take up at most the topic's quota. key itself is never evicted, since
+// it was just written and is likely about to be read.
+// NOTE: you must hold c.mu lock when calling this method!
+func (c *Cache) enforceTopicQuota(key string) error {
+	topicName := topicOfKey(key)
+	if topicName == "" {
+		return nil
+	}
+
+	quota := c.topicQuota(topicName)
+	if quota <= 0 {
+		return nil
+	}
+
+	topicBytes := c.cacheItems[key].Size
+	cacheItems := make([]CacheItem, 0)
+	for _, item := range c.cacheItems {
+		if item.Key != key && topicOfKey(item.Key) == topicName {
+			cacheItems = append(cacheItems, item)
+			topicBytes += item.Size
+		}
+	}
+	if topicBytes <= quota {
+		return nil
+	}
+
+	c.log.Debugf("topic '%s' exceeds cache quota (%d/%d bytes)", topicName, topicBytes, quota)
+	return c.evictLeastRecentlyUsed(cacheItems, max(quota-c.cacheItems[key].Size, 0))
+}
+
+// topicOfKey returns the topic that key belongs to, i.e. the directory that
+// it's in, or "" if it's not in a directory.
+func topicOfKey(key string) string {
+	dir := path.Dir(filepath.ToSlash(key))
+	if dir == "." || dir == "/" {
+		return ""
+	}
+	return dir
+}
@@ -0,0 +1,88 @@
+package sebcache
+
+import (
+	"context"
+	"fmt"
+)
+
+// Budget is a share of the cache's capacity. Cache items are attributed to the
+// Budget of the context they're written or read with, see WithBudget. Budgets
+// are evicted separately, so that e.g. background work can't evict the items
+// used to serve clients.
+type Budget int
+
+const (
+	// BudgetServing is used when serving clients. It's used unless another
+	// Budget is set on the context.
+	BudgetServing Budget = iota
+
+	// BudgetMaintenance is used by background work such as merging record
+	// batches, dropping expired record batches and replication.
+	BudgetMaintenance
+
+	numBudgets
+)
+
+// Budgets returns all budgets.
+func Budgets() []Budget {
+	return []Budget{BudgetServing, BudgetMaintenance}
+}
+
+func (b Budget) String() string {
+	switch b {
+	case BudgetServing:
+		return "serving"
+	case BudgetMaintenance:
+		return "maintenance"
+	}
+	return fmt.Sprintf("Budget(%d)", int(b))
+}
+
+// MarshalText makes budgets readable when used as keys in JSON.
+func (b Budget) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+type budgetKey struct{}
+
+// WithBudget returns a copy of ctx that attributes cache items written and read
+// using it to budget.
+func WithBudget(ctx context.Context, budget Budget) context.Context {
+	return context.WithValue(ctx, budgetKey{}, budget)
+}
+
+// BudgetFromContext returns the budget set on ctx using WithBudget, defaulting
+// to BudgetServing.
+func BudgetFromContext(ctx context.Context) Budget {
+	budget, ok := ctx.Value(budgetKey{}).(Budget)
+	if !ok || budget < 0 || budget >= numBudgets {
+		return BudgetServing
+	}
+	return budget
+}
+
+// BudgetStats holds usage statistics for a single budget.
+type BudgetStats struct {
+	// Bytes is the number of bytes of cache items attributed to the budget.
+	Bytes int64
+
+	// Items is the number of cache items attributed to the budget.
+	Items int
+
+	// Hits and Misses are the number of reads using the budget that were and
+	// were not found in the cache.
+	Hits   uint64
+	Misses uint64
+
+	// EvictedBytes and EvictedItems are the number of bytes and items evicted
+	// from the budget.
+	EvictedBytes int64
+	EvictedItems uint64
+
+	// WriteFailures is the number of writes using the budget that failed.
+	WriteFailures uint64
+
+	// NotAdmitted is the number of items written using the budget that were
+	// not admitted to the cache.
+	NotAdmitted uint64
+}
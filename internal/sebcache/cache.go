@@ -1,9 +1,14 @@
 package sebcache
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"slices"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -12,8 +17,8 @@ import (
 )
 
 type Storage interface {
-	Reader(key string) (io.ReadSeekCloser, error)
-	Writer(key string) (io.WriteCloser, error)
+	Reader(ctx context.Context, key string) (io.ReadSeekCloser, error)
+	Writer(ctx context.Context, key string) (io.WriteCloser, error)
 	Remove(key string) error
 	List() (map[string]CacheItem, error)
 	SizeOf(key string) (CacheItem, error)
@@ -23,9 +28,11 @@ type Cache struct {
 	log     logger.Logger
 	storage Storage
 	now     func() time.Time
+	opts    Opts
 
 	mu         sync.Mutex
 	cacheItems map[string]CacheItem
+	stats      [numBudgets]BudgetStats
 }
 
 // NewDiskCache returns a new Cache with DiskStorage.
@@ -45,11 +52,16 @@ func NewMemoryCache(log logger.Logger) (*Cache, error) {
 	return New(log, memoryStorage)
 }
 
-func New(log logger.Logger, cacheStorage Storage) (*Cache, error) {
-	return NewCacheWithNow(log, cacheStorage, time.Now)
+func New(log logger.Logger, cacheStorage Storage, optFuncs ...func(*Opts)) (*Cache, error) {
+	return NewCacheWithNow(log, cacheStorage, time.Now, optFuncs...)
 }
 
-func NewCacheWithNow(log logger.Logger, cacheStorage Storage, now func() time.Time) (*Cache, error) {
+func NewCacheWithNow(log logger.Logger, cacheStorage Storage, now func() time.Time, optFuncs ...func(*Opts)) (*Cache, error) {
+	opts := Opts{}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+
 	cacheItems, err := cacheStorage.List()
 	if err != nil {
 		return nil, fmt.Errorf("listing existing files: %w", err)
@@ -60,34 +72,68 @@ func NewCacheWithNow(log logger.Logger, cacheStorage Storage, now func() time.Ti
 		storage:    cacheStorage,
 		cacheItems: cacheItems,
 		now:        now,
+		opts:       opts,
 	}, nil
 }
 
-func (c *Cache) Writer(key string) (io.WriteCloser, error) {
+// Writer returns a writer that adds key to the cache when closed. The item is
+// attributed to the budget of ctx, unless it's already attributed to
+// BudgetServing.
+//
+// Items that aren't admitted to the cache, e.g. because they're too large, are
+// added as transient items. They can be read until they're evicted, which they
+// are before any other items, but reading them doesn't mark them as recently
+// used. Admitted items count towards the quota of their topic, evicting its
+// least recently used items if it's exceeded.
+func (c *Cache) Writer(ctx context.Context, key string) (io.WriteCloser, error) {
 	log := c.log.WithField("key", key)
+	budget := BudgetFromContext(ctx)
 
-	w, err := c.storage.Writer(key)
+	w, err := c.storage.Writer(ctx, key)
 	if err != nil {
+		c.countWriteFailure(budget)
 		return nil, err
 	}
 
-	return newWriteCloseWrapper(w, func(size int64) {
+	return newWriteCloseWrapper(w, func() { c.countWriteFailure(budget) }, func(size int64) {
 		log.Debugf("adding to cache items")
 
 		c.mu.Lock()
 		defer c.mu.Unlock()
 
+		itemBudget := budget
+		if item, ok := c.cacheItems[key]; ok && item.Budget == BudgetServing {
+			itemBudget = BudgetServing
+		}
+
+		if !c.admit(ctx, size) {
+			log.Debugf("not admitted, adding as transient item")
+			c.stats[itemBudget].NotAdmitted += 1
+			c.cacheItems[key] = CacheItem{
+				Size:      size,
+				Key:       key,
+				Budget:    itemBudget,
+				Transient: true,
+			}
+			return
+		}
+
 		c.cacheItems[key] = CacheItem{
 			Size:       size,
 			AccessedAt: c.now(),
 			Key:        key,
+			Budget:     itemBudget,
 		}
 
+		err := c.enforceTopicQuota(key)
+		if err != nil {
+			log.Errorf("enforcing topic quota: %s", err)
+		}
 	}), nil
 }
 
-func (c *Cache) Write(key string, bs []byte) (int, error) {
-	wtr, err := c.Writer(key)
+func (c *Cache) Write(ctx context.Context, key string, bs []byte) (int, error) {
+	wtr, err := c.Writer(ctx, key)
 	if err != nil {
 		return 0, fmt.Errorf("creating writer: %w", err)
 	}
@@ -96,16 +142,26 @@ func (c *Cache) Write(key string, bs []byte) (int, error) {
 	return wtr.Write(bs)
 }
 
-func (c *Cache) Reader(key string) (io.ReadSeekCloser, error) {
+// Reader returns a reader for key. Reading an item using BudgetServing
+// attributes it to BudgetServing. Reading an item that is attributed to
+// BudgetServing using another budget does not mark it as recently used, so
+// that background work doesn't keep items around.
+func (c *Cache) Reader(ctx context.Context, key string) (io.ReadSeekCloser, error) {
 	log := c.log.WithField("key", key)
+	budget := BudgetFromContext(ctx)
 
-	r, err := c.storage.Reader(key)
+	r, err := c.storage.Reader(ctx, key)
 	if err != nil {
+		c.mu.Lock()
+		c.stats[budget].Misses += 1
+		c.mu.Unlock()
 		return nil, fmt.Errorf("reading from cache storage: %w", err)
 	}
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.stats[budget].Hits += 1
+
 	item, ok := c.cacheItems[key]
 	if !ok {
 		log.Debugf("not found in cache items, adding")
@@ -113,13 +169,43 @@ func (c *Cache) Reader(key string) (io.ReadSeekCloser, error) {
 		if err == nil {
 			item = newItem
 		}
+		item.Budget = budget
+	}
+
+	if !item.Transient && (budget == BudgetServing || item.Budget != BudgetServing) {
+		item.AccessedAt = c.now()
+		item.Budget = min(item.Budget, budget)
 	}
-	item.AccessedAt = c.now()
 	c.cacheItems[key] = item
 
 	return r, nil
 }
 
+// Remove removes key from the cache. It is not an error to remove a key that
+// is not in the cache.
+// Contains returns whether key is in the cache. Unlike Reader, it neither
+// counts as a hit or miss, nor marks key as recently used.
+func (c *Cache) Contains(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.cacheItems[key]
+	return ok
+}
+
+func (c *Cache) Remove(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := c.storage.Remove(key)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("removing '%s' from cache storage: %w", key, err)
+	}
+
+	delete(c.cacheItems, key)
+	return nil
+}
+
 func (c *Cache) Size() int64 {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -138,13 +224,135 @@ func (c *Cache) size() int64 {
 	return size
 }
 
-func (c *Cache) EvictLeastRecentlyUsed(maxSize int64) error {
-	log := c.log.WithField("maxSize", maxSize)
+// BudgetStats returns usage statistics for each budget.
+func (c *Cache) BudgetStats() map[Budget]BudgetStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := make(map[Budget]BudgetStats, numBudgets)
+	for _, budget := range Budgets() {
+		stats[budget] = c.stats[budget]
+	}
+
+	for _, item := range c.cacheItems {
+		budgetStats := stats[item.Budget]
+		budgetStats.Bytes += item.Size
+		budgetStats.Items += 1
+		stats[item.Budget] = budgetStats
+	}
+
+	return stats
+}
 
+// Stats holds usage statistics for the cache as a whole, and for each budget.
+type Stats struct {
+	BudgetStats
+	Budgets map[Budget]BudgetStats
+}
+
+// Stats returns usage statistics for the cache.
+func (c *Cache) Stats() Stats {
+	stats := Stats{Budgets: c.BudgetStats()}
+	for _, budgetStats := range stats.Budgets {
+		stats.Bytes += budgetStats.Bytes
+		stats.Items += budgetStats.Items
+		stats.Hits += budgetStats.Hits
+		stats.Misses += budgetStats.Misses
+		stats.EvictedBytes += budgetStats.EvictedBytes
+		stats.EvictedItems += budgetStats.EvictedItems
+		stats.WriteFailures += budgetStats.WriteFailures
+		stats.NotAdmitted += budgetStats.NotAdmitted
+	}
+
+	return stats
+}
+
+// TopicUsage describes the items of a topic in the cache.
+type TopicUsage struct {
+	Bytes int64
+	Items int
+}
+
+// TopicUsage returns the number of bytes and items that topicName takes up in
+// the cache.
+func (c *Cache) TopicUsage(topicName string) TopicUsage {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	usage := TopicUsage{}
+	for _, item := range c.cacheItems {
+		if topicOfKey(item.Key) == topicName {
+			usage.Bytes += item.Size
+			usage.Items += 1
+		}
+	}
+
+	return usage
+}
+
+// Items returns the items in the cache, sorted by key.
+func (c *Cache) Items() []CacheItem {
+	c.mu.Lock()
 	cacheItems := mapy.Values(c.cacheItems)
+	c.mu.Unlock()
+
+	slices.SortFunc(cacheItems, func(a, b CacheItem) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	return cacheItems
+}
+
+// EvictLeastRecentlyUsed evicts the least recently used items until the cache
+// holds at most maxSize bytes, regardless of budget.
+func (c *Cache) EvictLeastRecentlyUsed(maxSize int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.evictLeastRecentlyUsed(mapy.Values(c.cacheItems), maxSize)
+}
+
+// EvictLeastRecentlyUsedBudget evicts the least recently used items that are
+// attributed to budget until they take up at most maxSize bytes.
+func (c *Cache) EvictLeastRecentlyUsedBudget(budget Budget, maxSize int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cacheItems := make([]CacheItem, 0, len(c.cacheItems))
+	for _, item := range c.cacheItems {
+		if item.Budget == budget {
+			cacheItems = append(cacheItems, item)
+		}
+	}
+
+	return c.evictLeastRecentlyUsed(cacheItems, maxSize)
+}
+
+// EvictTransient evicts all transient items, i.e. items that were not admitted
+// to the cache when they were written.
+func (c *Cache) EvictTransient() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cacheItems := make([]CacheItem, 0)
+	for _, item := range c.cacheItems {
+		if item.Transient {
+			cacheItems = append(cacheItems, item)
+		}
+	}
+	if len(cacheItems) == 0 {
+		return nil
+	}
+
+	return c.evictLeastRecentlyUsed(cacheItems, 0)
+}
+
+// evictLeastRecentlyUsed evicts the least recently used of cacheItems until
+// the remaining ones take up at most maxSize bytes.
+// NOTE: you must hold c.mu lock when calling this method!
+func (c *Cache) evictLeastRecentlyUsed(cacheItems []CacheItem, maxSize int64) error {
+	log := c.log.WithField("maxSize", maxSize)
+
 	sort.Slice(cacheItems, func(i, j int) bool {
 		// NOTE: sorts most recently used first
 		return cacheItems[j].AccessedAt.Before(cacheItems[i].AccessedAt)
@@ -176,6 +384,8 @@ func (c *Cache) EvictLeastRecentlyUsed(maxSize int64) error {
 
 		itemsDeleted += 1
 		bytesDeleted += item.Size
+		c.stats[item.Budget].EvictedBytes += item.Size
+		c.stats[item.Budget].EvictedItems += 1
 		delete(c.cacheItems, item.Key)
 	}
 
@@ -186,15 +396,27 @@ func (c *Cache) EvictLeastRecentlyUsed(maxSize int64) error {
 
 }
 
+func (c *Cache) countWriteFailure(budget Budget) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats[budget].WriteFailures += 1
+}
+
 type writeCloseWrapper struct {
 	wc         io.WriteCloser
 	size       int64
+	failed     bool
+	onFailure  func()
 	afterClose func(int64)
 }
 
-func newWriteCloseWrapper(wc io.WriteCloser, afterClose func(int64)) *writeCloseWrapper {
+// newWriteCloseWrapper returns a writeCloseWrapper that calls afterClose with
+// the number of bytes written once wc has been closed. onFailure is called
+// once if writing to or closing wc fails.
+func newWriteCloseWrapper(wc io.WriteCloser, onFailure func(), afterClose func(int64)) *writeCloseWrapper {
 	return &writeCloseWrapper{
 		wc:         wc,
+		onFailure:  onFailure,
 		afterClose: afterClose,
 	}
 }
@@ -202,12 +424,23 @@ func newWriteCloseWrapper(wc io.WriteCloser, afterClose func(int64)) *writeClose
 func (w *writeCloseWrapper) Write(bs []byte) (int, error) {
 	n, err := w.wc.Write(bs)
 	w.size += int64(n)
+	if err != nil {
+		w.fail()
+	}
 	return n, err
 }
 
+func (w *writeCloseWrapper) fail() {
+	if !w.failed {
+		w.failed = true
+		w.onFailure()
+	}
+}
+
 func (w *writeCloseWrapper) Close() error {
 	err := w.wc.Close()
 	if err != nil {
+		w.fail()
 		return fmt.Errorf("closing writeCloseWrapper file: %w", err)
 	}
 
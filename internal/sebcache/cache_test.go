@@ -1,7 +1,9 @@
 package sebcache_test
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"sync"
 	"testing"
 	"time"
@@ -44,7 +46,7 @@ func TestCacheEvictLeastRecentlyUsed(t *testing.T) {
 		for _, item := range cacheItems {
 			mockTime.Add(time.Second)
 
-			_, err := cache.Write(item.key, item.bs)
+			_, err := cache.Write(context.Background(), item.key, item.bs)
 			require.NoError(t, err)
 
 			bytesCached += len(item.bs)
@@ -66,7 +68,7 @@ func TestCacheEvictLeastRecentlyUsed(t *testing.T) {
 
 			// most recently accessed items must be evicted
 			for _, item := range cacheItems[:i] {
-				_, err := cache.Reader(item.key)
+				_, err := cache.Reader(context.Background(), item.key)
 				require.ErrorIs(t, err, seberr.ErrNotInCache)
 			}
 
@@ -75,7 +77,7 @@ func TestCacheEvictLeastRecentlyUsed(t *testing.T) {
 				mockTime.Add(time.Second)
 
 				// Act
-				rdr, err := cache.Reader(item.key)
+				rdr, err := cache.Reader(context.Background(), item.key)
 				require.NoError(t, err)
 				bs := tester.ReadAndClose(t, rdr)
 
@@ -99,7 +101,7 @@ func TestCacheEvictLeastRecentlyUsedMaxBytes(t *testing.T) {
 		for i := 0; i < 5; i++ {
 			key := fmt.Sprintf("%d", i)
 
-			_, err = cache.Write(key, bs)
+			_, err = cache.Write(context.Background(), key, bs)
 			require.NoError(t, err)
 		}
 
@@ -147,7 +149,7 @@ func TestCacheReaderFileNotCached(t *testing.T) {
 		require.NoError(t, err)
 
 		// Act, assert
-		_, err = cache.Reader("non/existing/path")
+		_, err = cache.Reader(context.Background(), "non/existing/path")
 		require.ErrorIs(t, err, seberr.ErrNotInCache)
 	})
 }
@@ -163,7 +165,7 @@ func TestCacheSize(t *testing.T) {
 			key := fmt.Sprintf("/some/name/%d", i)
 			bs := tester.RandomBytes(t, 128+inty.RandomN(256))
 
-			_, err := cache.Write(key, bs)
+			_, err := cache.Write(context.Background(), key, bs)
 			require.NoError(t, err)
 
 			expectedSize += len(bs)
@@ -186,7 +188,7 @@ func TestCacheSizeWithExistingFiles(t *testing.T) {
 			require.NoError(t, err)
 
 			for i := 0; i < 10; i++ {
-				f, err := c1.Writer(fmt.Sprintf("/some/name/%d", i))
+				f, err := c1.Writer(context.Background(), fmt.Sprintf("/some/name/%d", i))
 				require.NoError(t, err)
 
 				bs := tester.RandomBytes(t, 128+inty.RandomN(256))
@@ -211,7 +213,7 @@ func TestCacheSizeWithExistingFiles(t *testing.T) {
 			key := fmt.Sprintf("/some/other/name/%d", i)
 			bs := tester.RandomBytes(t, 128+inty.RandomN(256))
 
-			_, err := c2.Write(key, bs)
+			_, err := c2.Write(context.Background(), key, bs)
 			require.NoError(t, err)
 
 			expectedSize += len(bs)
@@ -237,7 +239,7 @@ func TestCacheSizeOverwriteItem(t *testing.T) {
 
 		for _, item := range itemsToCache {
 			// Act
-			n, err := cache.Write("overwritten-item", item)
+			n, err := cache.Write(context.Background(), "overwritten-item", item)
 			require.NoError(t, err)
 			require.Equal(t, len(item), n)
 
@@ -297,6 +299,12 @@ type cacheStorageMock struct {
 
 	MockList   func() (map[string]sebcache.CacheItem, error)
 	ListCalled bool
+
+	MockWriter func(ctx context.Context, key string) (io.WriteCloser, error)
+}
+
+func (c *cacheStorageMock) Writer(ctx context.Context, key string) (io.WriteCloser, error) {
+	return c.MockWriter(ctx, key)
 }
 
 func (c *cacheStorageMock) Remove(key string) error {
@@ -308,3 +316,328 @@ func (c *cacheStorageMock) List() (map[string]sebcache.CacheItem, error) {
 	c.ListCalled = true
 	return c.MockList()
 }
+
+// TestCacheEvictLeastRecentlyUsedBudget verifies that
+// EvictLeastRecentlyUsedBudget() only evicts items attributed to the given
+// budget, and that BudgetStats() reports the usage of each budget.
+func TestCacheEvictLeastRecentlyUsedBudget(t *testing.T) {
+	tester.TestCacheStorage(t, func(t *testing.T, cacheStorage sebcache.Storage) {
+		cache, err := sebcache.New(log, cacheStorage)
+		require.NoError(t, err)
+
+		servingCtx := context.Background()
+		maintenanceCtx := sebcache.WithBudget(context.Background(), sebcache.BudgetMaintenance)
+
+		bs := tester.RandomBytes(t, 10)
+		for i := range 3 {
+			_, err = cache.Write(servingCtx, fmt.Sprintf("serving-%d", i), bs)
+			require.NoError(t, err)
+
+			_, err = cache.Write(maintenanceCtx, fmt.Sprintf("maintenance-%d", i), bs)
+			require.NoError(t, err)
+		}
+
+		// Act
+		err = cache.EvictLeastRecentlyUsedBudget(sebcache.BudgetMaintenance, 15)
+		require.NoError(t, err)
+
+		// Assert
+		stats := cache.BudgetStats()
+		require.Equal(t, sebcache.BudgetStats{Bytes: 30, Items: 3}, stats[sebcache.BudgetServing])
+		require.Equal(t, sebcache.BudgetStats{Bytes: 10, Items: 1, EvictedBytes: 20, EvictedItems: 2}, stats[sebcache.BudgetMaintenance])
+
+		for i := range 3 {
+			r, err := cache.Reader(servingCtx, fmt.Sprintf("serving-%d", i))
+			require.NoError(t, err)
+			r.Close()
+		}
+	})
+}
+
+// TestCacheReaderBudget verifies that reading an item using BudgetServing
+// attributes it to BudgetServing, that reading a BudgetServing item using
+// BudgetMaintenance doesn't mark it as recently used, and that hits and misses
+// are counted per budget.
+func TestCacheReaderBudget(t *testing.T) {
+	tester.TestCacheStorage(t, func(t *testing.T, cacheStorage sebcache.Storage) {
+		mockTime := timey.NewMockTime(nil)
+		cache, err := sebcache.NewCacheWithNow(log, cacheStorage, mockTime.Now)
+		require.NoError(t, err)
+
+		servingCtx := context.Background()
+		maintenanceCtx := sebcache.WithBudget(context.Background(), sebcache.BudgetMaintenance)
+
+		bs := tester.RandomBytes(t, 10)
+		_, err = cache.Write(servingCtx, "old", bs)
+		require.NoError(t, err)
+		mockTime.Add(time.Second)
+
+		_, err = cache.Write(servingCtx, "new", bs)
+		require.NoError(t, err)
+		mockTime.Add(time.Second)
+
+		_, err = cache.Write(maintenanceCtx, "promoted", bs)
+		require.NoError(t, err)
+		mockTime.Add(time.Second)
+
+		// Act
+		r, err := cache.Reader(maintenanceCtx, "old")
+		require.NoError(t, err)
+		r.Close()
+
+		r, err = cache.Reader(servingCtx, "promoted")
+		require.NoError(t, err)
+		r.Close()
+
+		_, err = cache.Reader(maintenanceCtx, "does-not-exist")
+		require.ErrorIs(t, err, seberr.ErrNotInCache)
+
+		// Assert
+		stats := cache.BudgetStats()
+		require.Equal(t, sebcache.BudgetStats{Bytes: 30, Items: 3, Hits: 1}, stats[sebcache.BudgetServing])
+		require.Equal(t, sebcache.BudgetStats{Hits: 1, Misses: 1}, stats[sebcache.BudgetMaintenance])
+
+		// "old" was not marked as recently used by the maintenance read.
+		err = cache.EvictLeastRecentlyUsedBudget(sebcache.BudgetServing, 20)
+		require.NoError(t, err)
+
+		_, err = cache.Reader(servingCtx, "old")
+		require.ErrorIs(t, err, seberr.ErrNotInCache)
+	})
+}
+
+// TestCacheContains verifies that Contains() reports whether items are in the
+// cache, without counting as hits or misses.
+func TestCacheContains(t *testing.T) {
+	tester.TestCacheStorage(t, func(t *testing.T, cacheStorage sebcache.Storage) {
+		cache, err := sebcache.New(log, cacheStorage)
+		require.NoError(t, err)
+
+		_, err = cache.Write(context.Background(), "cached", []byte("data"))
+		require.NoError(t, err)
+
+		// Act, Assert
+		require.True(t, cache.Contains("cached"))
+		require.False(t, cache.Contains("not-cached"))
+
+		require.NoError(t, cache.Remove("cached"))
+		require.False(t, cache.Contains("cached"))
+
+		stats := cache.BudgetStats()[sebcache.BudgetServing]
+		require.Equal(t, uint64(0), stats.Hits)
+		require.Equal(t, uint64(0), stats.Misses)
+	})
+}
+
+// TestCacheAdmission verifies that items that aren't admitted to the cache can
+// be read until EvictTransient() is called, that they're evicted before other
+// items, and that they're counted as not admitted.
+func TestCacheAdmission(t *testing.T) {
+	tests := map[string]struct {
+		optFuncs []func(*sebcache.Opts)
+		ctx      context.Context
+		size     int
+		admitted bool
+	}{
+		"small":          {optFuncs: []func(*sebcache.Opts){sebcache.WithMaxItemBytes(10)}, ctx: context.Background(), size: 10, admitted: true},
+		"too large":      {optFuncs: []func(*sebcache.Opts){sebcache.WithMaxItemBytes(10)}, ctx: context.Background(), size: 11, admitted: false},
+		"tail":           {optFuncs: []func(*sebcache.Opts){sebcache.WithTailItems(2)}, ctx: sebcache.WithTailDistance(context.Background(), 1), size: 10, admitted: true},
+		"not tail":       {optFuncs: []func(*sebcache.Opts){sebcache.WithTailItems(2)}, ctx: sebcache.WithTailDistance(context.Background(), 2), size: 10, admitted: false},
+		"no tail hint":   {optFuncs: []func(*sebcache.Opts){sebcache.WithTailItems(2)}, ctx: context.Background(), size: 10, admitted: true},
+		"no admission":   {ctx: sebcache.WithTailDistance(context.Background(), 100), size: 100, admitted: true},
+		"tail too large": {optFuncs: []func(*sebcache.Opts){sebcache.WithTailItems(2), sebcache.WithMaxItemBytes(10)}, ctx: context.Background(), size: 11, admitted: false},
+		"bypass":         {ctx: sebcache.WithBypass(context.Background()), size: 10, admitted: false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tester.TestCacheStorage(t, func(t *testing.T, cacheStorage sebcache.Storage) {
+				mockTime := timey.NewMockTime(nil)
+				cache, err := sebcache.NewCacheWithNow(log, cacheStorage, mockTime.Now, test.optFuncs...)
+				require.NoError(t, err)
+
+				mockTime.Add(time.Second)
+				_, err = cache.Write(context.Background(), "other", tester.RandomBytes(t, 10))
+				require.NoError(t, err)
+
+				mockTime.Add(time.Second)
+				bs := tester.RandomBytes(t, test.size)
+
+				// Act
+				_, err = cache.Write(test.ctx, "item", bs)
+				require.NoError(t, err)
+
+				// Assert
+				rdr, err := cache.Reader(context.Background(), "item")
+				require.NoError(t, err)
+				require.Equal(t, bs, tester.ReadAndClose(t, rdr))
+
+				expectedNotAdmitted := uint64(0)
+				if !test.admitted {
+					expectedNotAdmitted = 1
+				}
+				require.Equal(t, expectedNotAdmitted, cache.BudgetStats()[sebcache.BudgetServing].NotAdmitted)
+
+				// the most recently written item is evicted first if it
+				// wasn't admitted.
+				err = cache.EvictLeastRecentlyUsed(int64(test.size))
+				require.NoError(t, err)
+				require.Equal(t, test.admitted, cache.Contains("item"))
+				require.Equal(t, !test.admitted, cache.Contains("other"))
+
+				err = cache.EvictTransient()
+				require.NoError(t, err)
+				require.Equal(t, test.admitted, cache.Contains("item"))
+			})
+		})
+	}
+}
+
+// TestCacheTopicQuota verifies that writing an item evicts the least recently
+// used items of its topic when the topic exceeds its quota, without evicting
+// the items of other topics or the item being written.
+func TestCacheTopicQuota(t *testing.T) {
+	tester.TestCacheStorage(t, func(t *testing.T, cacheStorage sebcache.Storage) {
+		mockTime := timey.NewMockTime(nil)
+		cache, err := sebcache.NewCacheWithNow(log, cacheStorage, mockTime.Now,
+			sebcache.WithTopicMaxBytes(30),
+			sebcache.WithTopicQuota("backfill", 20),
+		)
+		require.NoError(t, err)
+
+		ctx := context.Background()
+		bs := tester.RandomBytes(t, 10)
+
+		for i := range 3 {
+			mockTime.Add(time.Second)
+			_, err = cache.Write(ctx, fmt.Sprintf("hot/%d", i), bs)
+			require.NoError(t, err)
+		}
+
+		// Act
+		for i := range 5 {
+			mockTime.Add(time.Second)
+			_, err = cache.Write(ctx, fmt.Sprintf("backfill/%d", i), bs)
+			require.NoError(t, err)
+		}
+
+		mockTime.Add(time.Second)
+		_, err = cache.Write(ctx, "backfill/large", tester.RandomBytes(t, 25))
+		require.NoError(t, err)
+
+		// Assert
+		for i := range 3 {
+			require.True(t, cache.Contains(fmt.Sprintf("hot/%d", i)))
+		}
+		for i := range 5 {
+			require.False(t, cache.Contains(fmt.Sprintf("backfill/%d", i)))
+		}
+		require.True(t, cache.Contains("backfill/large"))
+
+		// hot/0 is evicted since the topic exceeds the default quota
+		mockTime.Add(time.Second)
+		_, err = cache.Write(ctx, "hot/3", bs)
+		require.NoError(t, err)
+		require.False(t, cache.Contains("hot/0"))
+		require.True(t, cache.Contains("hot/3"))
+	})
+}
+
+// TestCacheItemsAndStats verifies that Items() returns the cached items with
+// their sizes and access times, and that Stats() sums the stats of all
+// budgets.
+func TestCacheItemsAndStats(t *testing.T) {
+	tester.TestCacheStorage(t, func(t *testing.T, cacheStorage sebcache.Storage) {
+		mockTime := timey.NewMockTime(nil)
+		cache, err := sebcache.NewCacheWithNow(log, cacheStorage, mockTime.Now)
+		require.NoError(t, err)
+
+		maintenanceCtx := sebcache.WithBudget(context.Background(), sebcache.BudgetMaintenance)
+
+		_, err = cache.Write(context.Background(), "b", tester.RandomBytes(t, 10))
+		require.NoError(t, err)
+
+		mockTime.Add(time.Second)
+		_, err = cache.Write(maintenanceCtx, "a", tester.RandomBytes(t, 20))
+		require.NoError(t, err)
+		t1 := mockTime.Now()
+
+		_, err = cache.Write(context.Background(), "c", tester.RandomBytes(t, 30))
+		require.NoError(t, err)
+
+		err = cache.EvictLeastRecentlyUsedBudget(sebcache.BudgetServing, 30)
+		require.NoError(t, err)
+
+		r, err := cache.Reader(maintenanceCtx, "a")
+		require.NoError(t, err)
+		r.Close()
+
+		_, err = cache.Reader(context.Background(), "b")
+		require.ErrorIs(t, err, seberr.ErrNotInCache)
+
+		// Act
+		items := cache.Items()
+		stats := cache.Stats()
+
+		// Assert
+		require.Equal(t, []sebcache.CacheItem{
+			{Key: "a", Size: 20, AccessedAt: t1, Budget: sebcache.BudgetMaintenance},
+			{Key: "c", Size: 30, AccessedAt: t1, Budget: sebcache.BudgetServing},
+		}, items)
+
+		require.Equal(t, sebcache.BudgetStats{
+			Bytes:        50,
+			Items:        2,
+			Hits:         1,
+			Misses:       1,
+			EvictedBytes: 10,
+			EvictedItems: 1,
+		}, stats.BudgetStats)
+		require.Equal(t, sebcache.BudgetStats{Bytes: 20, Items: 1, Hits: 1}, stats.Budgets[sebcache.BudgetMaintenance])
+	})
+}
+
+// TestCacheWriteFailures verifies that failing to create, write to or close
+// writers to cache storage is counted as write failures.
+func TestCacheWriteFailures(t *testing.T) {
+	writeErr := fmt.Errorf("disk full")
+
+	cacheStorage := &cacheStorageMock{}
+	cacheStorage.MockList = func() (map[string]sebcache.CacheItem, error) {
+		return map[string]sebcache.CacheItem{}, nil
+	}
+
+	cache, err := sebcache.New(log, cacheStorage)
+	require.NoError(t, err)
+
+	// Act
+	cacheStorage.MockWriter = func(ctx context.Context, key string) (io.WriteCloser, error) {
+		return nil, writeErr
+	}
+	_, err = cache.Writer(context.Background(), "key")
+	require.ErrorIs(t, err, writeErr)
+
+	cacheStorage.MockWriter = func(ctx context.Context, key string) (io.WriteCloser, error) {
+		return failingWriteCloser{err: writeErr}, nil
+	}
+	w, err := cache.Writer(context.Background(), "key")
+	require.NoError(t, err)
+
+	_, err = w.Write([]byte("data"))
+	require.ErrorIs(t, err, writeErr)
+	_, err = w.Write([]byte("data"))
+	require.ErrorIs(t, err, writeErr)
+	err = w.Close()
+	require.ErrorIs(t, err, writeErr)
+
+	// Assert
+	require.Equal(t, uint64(2), cache.Stats().WriteFailures)
+	require.False(t, cache.Contains("key"))
+}
+
+type failingWriteCloser struct {
+	err error
+}
+
+func (w failingWriteCloser) Write([]byte) (int, error) { return 0, w.err }
+func (w failingWriteCloser) Close() error              { return w.err }
@@ -1,9 +1,13 @@
 package sebcache
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
@@ -19,6 +23,13 @@ type CacheItem struct {
 	Size       int64
 	AccessedAt time.Time
 	Key        string
+
+	// Budget is the budget that the item is attributed to.
+	Budget Budget
+
+	// Transient is true for items that were not admitted to the cache when
+	// they were written. They're evicted before any other items.
+	Transient bool
 }
 
 // DiskCache is a key-value store for caching data in files on the local disk.
@@ -33,9 +44,41 @@ type DiskCache struct {
 	// possible to do atomically, is that the file being moved (renamed) is
 	// within the same file system both before and after the move.
 	tempDir string
+
+	hashKeys bool
 }
 
-func NewDiskStorage(log logger.Logger, rootDir string) (*DiskCache, error) {
+type DiskCacheOpts struct {
+	// HashKeys makes DiskCache store items in files named by the SHA-256 hash
+	// of their key, sharded across two levels of subdirectories, e.g.
+	// "ab/cd/abcd...". This keeps the number of files in each directory
+	// small, regardless of the number of items and the keys used. The key of
+	// each item is kept next to it in a file with the extension
+	// keyFileExtension, see KeyOf.
+	//
+	// NOTE: items written with a different value of HashKeys can't be read;
+	// they're evicted like any other item.
+	HashKeys bool
+}
+
+// WithDiskHashKeys sets whether DiskCache stores items in files named by the
+// hash of their key. See DiskCacheOpts.HashKeys.
+func WithDiskHashKeys(enabled bool) func(*DiskCacheOpts) {
+	return func(o *DiskCacheOpts) {
+		o.HashKeys = enabled
+	}
+}
+
+// keyFileExtension is the extension of the files that hold the keys of items
+// stored using DiskCacheOpts.HashKeys.
+const keyFileExtension = ".key"
+
+func NewDiskStorage(log logger.Logger, rootDir string, optFuncs ...func(*DiskCacheOpts)) (*DiskCache, error) {
+	opts := DiskCacheOpts{}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+
 	if !strings.HasSuffix(rootDir, "/") {
 		rootDir += "/"
 	}
@@ -47,9 +90,10 @@ func NewDiskStorage(log logger.Logger, rootDir string) (*DiskCache, error) {
 	}
 
 	return &DiskCache{
-		log:     log,
-		rootDir: rootDir,
-		tempDir: tempDir,
+		log:      log,
+		rootDir:  rootDir,
+		tempDir:  tempDir,
+		hashKeys: opts.HashKeys,
 	}, nil
 }
 
@@ -61,11 +105,25 @@ func (c *DiskCache) List() (map[string]CacheItem, error) {
 		Recursive: true,
 	}
 	err := filepathy.Walk(c.rootDir, fileWalkConfig, func(path string, info os.FileInfo, err error) error {
-		trimmedPath := strings.TrimPrefix(path, c.rootDir)
-		cacheItems[trimmedPath] = CacheItem{
+		key := strings.TrimPrefix(path, c.rootDir)
+		if c.hashKeys {
+			if strings.HasSuffix(path, keyFileExtension) || strings.HasPrefix(path, c.tempDir) {
+				return nil
+			}
+
+			key, err = c.KeyOf(path)
+			if err != nil {
+				// NOTE: the item can't be removed using its key, so it's
+				// removed now.
+				c.log.Warnf("removing cache file without key '%s': %s", path, err)
+				return os.Remove(path)
+			}
+		}
+
+		cacheItems[key] = CacheItem{
 			Size:       info.Size(),
 			AccessedAt: info.ModTime(),
-			Key:        trimmedPath,
+			Key:        key,
 		}
 		return nil
 	})
@@ -76,7 +134,7 @@ func (c *DiskCache) List() (map[string]CacheItem, error) {
 	return cacheItems, nil
 }
 
-func (c *DiskCache) Writer(key string) (io.WriteCloser, error) {
+func (c *DiskCache) Writer(_ context.Context, key string) (io.WriteCloser, error) {
 	log := c.log.WithField("key", key)
 
 	log.Debugf("adding '%s'", key)
@@ -85,7 +143,16 @@ func (c *DiskCache) Writer(key string) (io.WriteCloser, error) {
 	if err != nil {
 		return nil, fmt.Errorf("getting cache path of %s: %w", key, err)
 	}
-	return newCacheWriter(c.tempDir, cachePath)
+
+	cw, err := newCacheWriter(c.tempDir, cachePath)
+	if err != nil {
+		return nil, err
+	}
+	if c.hashKeys {
+		cw.key = key
+	}
+
+	return cw, nil
 }
 
 func (c *DiskCache) Remove(key string) error {
@@ -94,10 +161,38 @@ func (c *DiskCache) Remove(key string) error {
 		return fmt.Errorf("getting cache path of %s: %w", key, err)
 	}
 
-	return os.Remove(path)
+	err = os.Remove(path)
+	if err != nil {
+		return err
+	}
+
+	if c.hashKeys {
+		err = os.Remove(path + keyFileExtension)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("removing key file of '%s': %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+// KeyOf returns the key of the item stored in the file at path. It's only
+// supported when DiskCacheOpts.HashKeys is used, and is intended for mapping
+// the files of the cache back to their keys, e.g. when debugging.
+func (c *DiskCache) KeyOf(path string) (string, error) {
+	if !c.hashKeys {
+		return "", fmt.Errorf("%w: keys are not hashed", seberr.ErrBadInput)
+	}
+
+	key, err := os.ReadFile(path + keyFileExtension)
+	if err != nil {
+		return "", fmt.Errorf("reading key file of '%s': %w", path, err)
+	}
+
+	return string(key), nil
 }
 
-func (c *DiskCache) Reader(key string) (io.ReadSeekCloser, error) {
+func (c *DiskCache) Reader(_ context.Context, key string) (io.ReadSeekCloser, error) {
 	log := c.log.WithField("key", key)
 
 	cachePath, err := c.cachePath(key)
@@ -117,7 +212,12 @@ func (c *DiskCache) Reader(key string) (io.ReadSeekCloser, error) {
 func (c *DiskCache) SizeOf(key string) (CacheItem, error) {
 	log := c.log.WithField("key", key)
 
-	fileInfo, err := os.Stat(key)
+	cachePath, err := c.cachePath(key)
+	if err != nil {
+		return CacheItem{}, fmt.Errorf("getting cache path of %s: %w", key, err)
+	}
+
+	fileInfo, err := os.Stat(cachePath)
 	if err != nil {
 		return CacheItem{}, fmt.Errorf("calling os.Stat: %w", err)
 	}
@@ -126,10 +226,17 @@ func (c *DiskCache) SizeOf(key string) (CacheItem, error) {
 	return CacheItem{
 		Size:       fileInfo.Size(),
 		AccessedAt: fileInfo.ModTime(),
+		Key:        key,
 	}, nil
 }
 
 func (c *DiskCache) cachePath(key string) (string, error) {
+	if c.hashKeys {
+		sum := sha256.Sum256([]byte(key))
+		hash := hex.EncodeToString(sum[:])
+		return path.Join(c.rootDir, hash[:2], hash[2:4], hash), nil
+	}
+
 	// NOTE: avoid giving access to delete arbitrary files on the system
 	abs, err := filepath.Abs(path.Join(c.rootDir, key))
 	if err != nil {
@@ -165,6 +272,10 @@ func newCacheWriter(tempDir string, destPath string) (*cacheWriter, error) {
 type cacheWriter struct {
 	tmpFile  *os.File
 	destPath string
+
+	// key is written to the key file of destPath if non-empty. See
+	// DiskCacheOpts.HashKeys.
+	key string
 }
 
 func (cw *cacheWriter) Write(bs []byte) (int, error) {
@@ -183,6 +294,15 @@ func (cw cacheWriter) Close() error {
 		return fmt.Errorf("creating cache dirs '%s': %w", cacheDir, err)
 	}
 
+	// NOTE: the key file is written first, so that every item that is
+	// listed has a key file.
+	if cw.key != "" {
+		err = os.WriteFile(cw.destPath+keyFileExtension, []byte(cw.key), 0o644)
+		if err != nil {
+			return fmt.Errorf("writing key file of '%s': %w", cw.destPath, err)
+		}
+	}
+
 	// NOTE: os.Rename can only provide atomicity when renaming files within the
 	// same file system, so we require that tmpFile is written to the same file
 	// system as destPath.
@@ -2,6 +2,8 @@ package sebcache_test
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
 	"os"
 	"path"
@@ -34,7 +36,7 @@ func TestCacheWriterWritesToDisk(t *testing.T) {
 	require.NoError(t, err)
 
 	// Act
-	f, err := cache.Writer(key)
+	f, err := cache.Writer(context.Background(), key)
 	require.NoError(t, err)
 
 	n, err := f.Write(expectedBytes)
@@ -69,13 +71,13 @@ func TestDiskCacheReaderReadsFromDisk(t *testing.T) {
 	cache, err := sebcache.NewDiskStorage(log, t.TempDir())
 	require.NoError(t, err)
 
-	w, err := cache.Writer(key)
+	w, err := cache.Writer(context.Background(), key)
 	require.NoError(t, err)
 
 	tester.WriteAndClose(t, w, expectedBytes)
 
 	// Act
-	reader, err := cache.Reader(key)
+	reader, err := cache.Reader(context.Background(), key)
 	require.NoError(t, err)
 
 	// Assert
@@ -97,7 +99,7 @@ func TestDiskCacheListFromDisk(t *testing.T) {
 		"topic2/file2",
 	}
 	for _, key := range expectedKeys {
-		w, err := cache.Writer(key)
+		w, err := cache.Writer(context.Background(), key)
 		require.NoError(t, err)
 
 		tester.WriteAndClose(t, w, tester.RandomBytes(t, 16))
@@ -146,7 +148,7 @@ func TestDiskCacheListExistingCache(t *testing.T) {
 	require.NoError(t, err)
 
 	const theKey = "Vrvirksomhed/000000000000.record_batch"
-	w, err := cache.Writer(theKey)
+	w, err := cache.Writer(context.Background(), theKey)
 	require.NoError(t, err)
 
 	tester.WriteAndClose(t, w, tester.RandomBytes(t, 16))
@@ -164,3 +166,57 @@ func TestDiskCacheListExistingCache(t *testing.T) {
 	item := items[theKey]
 	require.Equal(t, theKey, item.Key)
 }
+
+// TestDiskCacheHashKeys verifies that items are stored in files named by the
+// hash of their key, sharded across subdirectories, that their keys can be
+// found using List and KeyOf, and that Remove removes both the item and its
+// key file.
+func TestDiskCacheHashKeys(t *testing.T) {
+	rootDir := t.TempDir()
+	cache, err := sebcache.NewDiskStorage(log, rootDir, sebcache.WithDiskHashKeys(true))
+	require.NoError(t, err)
+
+	const key = "some/topic/000000000000.record_batch"
+	expectedBytes := tester.RandomBytes(t, 16)
+
+	// Act
+	w, err := cache.Writer(context.Background(), key)
+	require.NoError(t, err)
+	tester.WriteAndClose(t, w, expectedBytes)
+
+	// Assert
+	require.NoFileExists(t, path.Join(rootDir, key))
+
+	sum := sha256.Sum256([]byte(key))
+	hash := hex.EncodeToString(sum[:])
+	cachedPath := path.Join(rootDir, hash[:2], hash[2:4], hash)
+	require.FileExists(t, cachedPath)
+
+	gotKey, err := cache.KeyOf(cachedPath)
+	require.NoError(t, err)
+	require.Equal(t, key, gotKey)
+
+	rdr, err := cache.Reader(context.Background(), key)
+	require.NoError(t, err)
+	require.Equal(t, expectedBytes, tester.ReadAndClose(t, rdr))
+
+	// files that can't be mapped back to a key are removed when listing
+	orphanPath := path.Join(rootDir, "ab", "cd", "orphan")
+	require.NoError(t, os.MkdirAll(path.Dir(orphanPath), os.ModePerm))
+	require.NoError(t, os.WriteFile(orphanPath, []byte("data"), 0o644))
+
+	c2, err := sebcache.NewDiskStorage(log, rootDir, sebcache.WithDiskHashKeys(true))
+	require.NoError(t, err)
+
+	items, err := c2.List()
+	require.NoError(t, err)
+	require.Equal(t, []string{key}, mapy.Keys(items))
+	require.Equal(t, key, items[key].Key)
+	require.Equal(t, int64(len(expectedBytes)), items[key].Size)
+	require.NoFileExists(t, orphanPath)
+
+	err = c2.Remove(key)
+	require.NoError(t, err)
+	require.NoFileExists(t, cachedPath)
+	require.NoFileExists(t, cachedPath+".key")
+}
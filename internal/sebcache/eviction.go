@@ -9,11 +9,24 @@ import (
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
 )
 
-func EvictionLoop(ctx context.Context, log logger.Logger, cache *Cache, cacheMaxBytes int64, interval time.Duration) error {
+// EvictionLoop evicts the least recently used items from cache every interval,
+// keeping it at cacheMaxBytes. Transient items are evicted every interval,
+// regardless of the size of the cache.
+//
+// If maintenanceMaxBytes is larger than 0, cacheMaxBytes is partitioned
+// between BudgetMaintenance, which is kept at maintenanceMaxBytes, and
+// BudgetServing, which is kept at the remaining bytes. Otherwise, items are
+// evicted regardless of budget.
+func EvictionLoop(ctx context.Context, log logger.Logger, cache *Cache, cacheMaxBytes int64, maintenanceMaxBytes int64, interval time.Duration) error {
 	log = log.
 		WithField("max bytes", cacheMaxBytes).
 		WithField("interval", interval)
 
+	budgetMaxBytes := map[Budget]int64{
+		BudgetServing:     max(cacheMaxBytes-maintenanceMaxBytes, 0),
+		BudgetMaintenance: maintenanceMaxBytes,
+	}
+
 	ticker := time.NewTicker(interval)
 	for {
 		select {
@@ -22,17 +35,40 @@ func EvictionLoop(ctx context.Context, log logger.Logger, cache *Cache, cacheMax
 		case <-ticker.C:
 		}
 
-		cacheSize := cache.Size()
-		if cacheSize <= cacheMaxBytes {
+		err := cache.EvictTransient()
+		if err != nil {
+			return fmt.Errorf("evicting transient items: %w", err)
+		}
+
+		if maintenanceMaxBytes <= 0 {
+			cacheSize := cache.Size()
+			if cacheSize <= cacheMaxBytes {
+				continue
+			}
+
+			fillLevel := float32(cacheSize) / float32(cacheMaxBytes) * 100
+			log.Infof("cache full (%.2f%%, %s/%s bytes), evicting items", fillLevel, sizey.FormatBytes(cacheSize), sizey.FormatBytes(cacheMaxBytes))
+
+			err := cache.EvictLeastRecentlyUsed(cacheMaxBytes)
+			if err != nil {
+				return fmt.Errorf("evicting cache: %w", err)
+			}
 			continue
 		}
 
-		fillLevel := float32(cacheSize) / float32(cacheMaxBytes) * 100
-		log.Infof("cache full (%.2f%%, %s/%s bytes), evicting items", fillLevel, sizey.FormatBytes(cacheSize), sizey.FormatBytes(cacheMaxBytes))
+		stats := cache.BudgetStats()
+		for _, budget := range Budgets() {
+			budgetSize, maxBytes := stats[budget].Bytes, budgetMaxBytes[budget]
+			if budgetSize <= maxBytes {
+				continue
+			}
 
-		err := cache.EvictLeastRecentlyUsed(cacheMaxBytes)
-		if err != nil {
-			return fmt.Errorf("evicting cache: %w", err)
+			log.Infof("cache budget '%s' full (%s/%s bytes), evicting items", budget, sizey.FormatBytes(budgetSize), sizey.FormatBytes(maxBytes))
+
+			err := cache.EvictLeastRecentlyUsedBudget(budget, maxBytes)
+			if err != nil {
+				return fmt.Errorf("evicting cache budget '%s': %w", budget, err)
+			}
 		}
 	}
 }
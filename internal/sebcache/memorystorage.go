@@ -1,6 +1,7 @@
 package sebcache
 
 import (
+	"context"
 	"io"
 	"sync"
 	"time"
@@ -34,7 +35,7 @@ func NewMemoryStorage(log logger.Logger) *MemoryCache {
 	}
 }
 
-func (mc *MemoryCache) Reader(key string) (io.ReadSeekCloser, error) {
+func (mc *MemoryCache) Reader(_ context.Context, key string) (io.ReadSeekCloser, error) {
 	mc.mu.Lock()
 	defer mc.mu.Unlock()
 
@@ -52,7 +53,7 @@ func (mc *MemoryCache) Reader(key string) (io.ReadSeekCloser, error) {
 	return nops.NopReadSeekCloser(buf), nil
 }
 
-func (mc *MemoryCache) Writer(key string) (io.WriteCloser, error) {
+func (mc *MemoryCache) Writer(_ context.Context, key string) (io.WriteCloser, error) {
 	mc.mu.Lock()
 	defer mc.mu.Unlock()
 
@@ -0,0 +1,102 @@
+package sebcache
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// StorageConfig is given to a StorageFactory when creating Storage. Each
+// StorageFactory uses the fields that are relevant to it.
+type StorageConfig struct {
+	// Dir is the directory that storage on local disk is rooted in.
+	Dir string
+
+	// HashKeys makes storage on local disk store items in files named by the
+	// hash of their key. See DiskCacheOpts.HashKeys.
+	HashKeys bool
+
+	// Params holds storage specific configuration, e.g. for Storage
+	// registered by other modules.
+	Params map[string]string
+}
+
+// StorageFactory creates Storage from config.
+type StorageFactory func(ctx context.Context, log logger.Logger, config StorageConfig) (Storage, error)
+
+var (
+	storageFactoriesMu sync.RWMutex
+	storageFactories   = map[string]StorageFactory{}
+)
+
+func init() {
+	RegisterStorage("memory", func(_ context.Context, log logger.Logger, _ StorageConfig) (Storage, error) {
+		return NewMemoryStorage(log), nil
+	})
+
+	RegisterStorage("disk", func(_ context.Context, log logger.Logger, config StorageConfig) (Storage, error) {
+		if config.Dir == "" {
+			return nil, fmt.Errorf("%w: disk storage requires a directory", seberr.ErrBadInput)
+		}
+
+		diskStorage, err := NewDiskStorage(log, config.Dir, WithDiskHashKeys(config.HashKeys))
+		if err != nil {
+			return nil, err
+		}
+		return diskStorage, nil
+	})
+}
+
+// RegisterStorage makes Storage created by factory available by name, e.g.
+// for selecting it in configuration. It's intended to be called from init()
+// and panics if name is already registered.
+func RegisterStorage(name string, factory StorageFactory) {
+	storageFactoriesMu.Lock()
+	defer storageFactoriesMu.Unlock()
+
+	if factory == nil {
+		panic(fmt.Sprintf("sebcache: storage factory '%s' is nil", name))
+	}
+	if _, exists := storageFactories[name]; exists {
+		panic(fmt.Sprintf("sebcache: storage '%s' registered twice", name))
+	}
+
+	storageFactories[name] = factory
+}
+
+// NewStorageByName creates Storage using the factory registered as name.
+// seberr.ErrNotFound is returned if no factory is registered as name.
+func NewStorageByName(ctx context.Context, log logger.Logger, name string, config StorageConfig) (Storage, error) {
+	storageFactoriesMu.RLock()
+	factory, ok := storageFactories[name]
+	storageFactoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: cache storage '%s', expected one of %s", seberr.ErrNotFound, name, strings.Join(StorageNames(), ", "))
+	}
+
+	storage, err := factory(ctx, log, config)
+	if err != nil {
+		return nil, fmt.Errorf("creating cache storage '%s': %w", name, err)
+	}
+
+	return storage, nil
+}
+
+// StorageNames returns the sorted names of all registered Storage.
+func StorageNames() []string {
+	storageFactoriesMu.RLock()
+	defer storageFactoriesMu.RUnlock()
+
+	names := make([]string, 0, len(storageFactories))
+	for name := range storageFactories {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
@@ -0,0 +1,44 @@
+package sebcache_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNewStorageByName verifies that cache storage registered using
+// RegisterStorage() is created by NewStorageByName() with the given config,
+// and that unknown names return seberr.ErrNotFound.
+func TestNewStorageByName(t *testing.T) {
+	const name = "test-registry-storage"
+	expectedConfig := sebcache.StorageConfig{
+		Dir:    "some-dir",
+		Params: map[string]string{"key": "value"},
+	}
+	expectedStorage := sebcache.NewMemoryStorage(log)
+
+	var gotConfig sebcache.StorageConfig
+	sebcache.RegisterStorage(name, func(_ context.Context, _ logger.Logger, config sebcache.StorageConfig) (sebcache.Storage, error) {
+		gotConfig = config
+		return expectedStorage, nil
+	})
+
+	// Act
+	storage, err := sebcache.NewStorageByName(context.Background(), log, name, expectedConfig)
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, expectedStorage, storage)
+	require.Equal(t, expectedConfig, gotConfig)
+	require.Equal(t, []string{"disk", "memory", name}, sebcache.StorageNames())
+
+	_, err = sebcache.NewStorageByName(context.Background(), log, "does-not-exist", sebcache.StorageConfig{})
+	require.ErrorIs(t, err, seberr.ErrNotFound)
+
+	_, err = sebcache.NewStorageByName(context.Background(), log, "disk", sebcache.StorageConfig{})
+	require.ErrorIs(t, err, seberr.ErrBadInput)
+}
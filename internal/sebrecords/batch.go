@@ -2,6 +2,7 @@ package sebrecords
 
 import (
 	"fmt"
+	"slices"
 
 	"github.com/micvbang/go-helpy/slicey"
 	"github.com/micvbang/simple-event-broker/seberr"
@@ -10,6 +11,83 @@ import (
 type Batch struct {
 	Sizes []uint32
 	Data  []byte
+
+	// Expires holds the expiry time of each record, in unix epoch
+	// microseconds; 0 means that the record never expires. Expires must
+	// either be empty, meaning that no records expire, or have the same length
+	// as Sizes.
+	Expires []int64
+
+	// Pointers marks records whose data is a pointer to a record that is
+	// stored elsewhere, e.g. because it's too large to store in a record
+	// batch. Pointers must either be empty, meaning that no records are
+	// pointers, or have the same length as Sizes.
+	Pointers []bool
+
+	// Traces attributes ranges of records to the trace IDs of the requests
+	// that produced them, e.g. to correlate records with application traces.
+	// Records that aren't covered by a trace have no trace ID.
+	Traces []Trace
+
+	// Timestamps holds the time of each record, in unix epoch microseconds,
+	// as given by the producer. Timestamps must either be empty or have the
+	// same length as Sizes. Requires v2 of the file format.
+	Timestamps []int64
+
+	// Keys holds the key of each record. Keys must either be empty or have
+	// the same length as Sizes. Requires v2 of the file format.
+	Keys [][]byte
+
+	// Headers holds the headers of each record. Headers must either be empty
+	// or have the same length as Sizes. Requires v2 of the file format.
+	Headers [][]RecordHeader
+
+	// ProducedUnixEpochUs is the time at which the records were produced, as
+	// given by the producer, in unix epoch microseconds; 0 means unknown.
+	ProducedUnixEpochUs int64
+
+	// Skipped is the number of records that were skipped, e.g. because they
+	// had expired, while reading records into the batch.
+	Skipped int
+
+	// SkippedBytes is the number of bytes of the records counted in Skipped
+	// that were examined before being skipped, e.g. because they had expired.
+	// Records that were skipped without being examined, e.g. because their
+	// record batch had been deleted, don't count.
+	SkippedBytes int
+
+	// StopReason is the reason that reading records into the batch stopped.
+	StopReason StopReason
+}
+
+// StopReason is the reason that reading records into a Batch stopped, e.g. in
+// order to let consumers tune how many records they ask for.
+type StopReason string
+
+const (
+	// StopReasonNone means that no records have been read into the batch.
+	StopReasonNone StopReason = ""
+
+	// StopReasonEnd means that there were no more records to read, e.g.
+	// because the end of the topic or of the allowed range was reached.
+	StopReasonEnd StopReason = "end"
+
+	// StopReasonMaxRecords means that the requested number of records was
+	// read.
+	StopReasonMaxRecords StopReason = "max-records"
+
+	// StopReasonMaxBytes means that the requested number of bytes was read.
+	StopReasonMaxBytes StopReason = "max-bytes"
+
+	// StopReasonDeadline means that the read was stopped because its context
+	// expired.
+	StopReasonDeadline StopReason = "deadline"
+)
+
+// RecordHeader is a key-value pair attached to a record.
+type RecordHeader struct {
+	Key   string
+	Value []byte
 }
 
 func NewBatch(recordSizes []uint32, recordsData []byte) Batch {
@@ -26,6 +104,16 @@ func (b Batch) Len() int {
 func (b *Batch) Reset() {
 	b.Data = b.Data[:0]
 	b.Sizes = b.Sizes[:0]
+	b.Expires = b.Expires[:0]
+	b.Pointers = b.Pointers[:0]
+	b.Traces = b.Traces[:0]
+	b.Timestamps = b.Timestamps[:0]
+	b.Keys = b.Keys[:0]
+	b.Headers = b.Headers[:0]
+	b.ProducedUnixEpochUs = 0
+	b.Skipped = 0
+	b.SkippedBytes = 0
+	b.StopReason = StopReasonNone
 }
 
 func (b Batch) Records(startIndex int, endIndex int) ([]byte, error) {
@@ -43,6 +131,74 @@ func (b Batch) Records(startIndex int, endIndex int) ([]byte, error) {
 	return b.Data[startByte:endByte], nil
 }
 
+// Slice returns the records [startIndex;endIndex) of b, i.e. their sizes and
+// contiguous data, along with their per-record metadata. The returned Batch
+// shares its memory with b; it must not be used after b is modified.
+//
+// Slice is preferred over repeated calls to Records when the size of each
+// record is needed, since the position of the data is only computed once.
+func (b Batch) Slice(startIndex int, endIndex int) (Batch, error) {
+	data, err := b.Records(startIndex, endIndex)
+	if err != nil {
+		return Batch{}, err
+	}
+
+	slice := Batch{
+		Sizes:               b.Sizes[startIndex:endIndex],
+		Data:                data,
+		ProducedUnixEpochUs: b.ProducedUnixEpochUs,
+	}
+	if len(b.Expires) > 0 {
+		slice.Expires = b.Expires[startIndex:endIndex]
+	}
+	if len(b.Pointers) > 0 {
+		slice.Pointers = b.Pointers[startIndex:endIndex]
+	}
+	if len(b.Timestamps) > 0 {
+		slice.Timestamps = b.Timestamps[startIndex:endIndex]
+	}
+	if len(b.Keys) > 0 {
+		slice.Keys = b.Keys[startIndex:endIndex]
+	}
+	if len(b.Headers) > 0 {
+		slice.Headers = b.Headers[startIndex:endIndex]
+	}
+
+	return slice, nil
+}
+
+// Clone returns a deep copy of the records of b and their per-record metadata,
+// which doesn't share memory with b. The read accounting of b (Skipped,
+// SkippedBytes and StopReason) isn't copied.
+func (b Batch) Clone() Batch {
+	clone := Batch{
+		Sizes:               slices.Clone(b.Sizes),
+		Data:                slices.Clone(b.Data),
+		Expires:             slices.Clone(b.Expires),
+		Pointers:            slices.Clone(b.Pointers),
+		Traces:              slices.Clone(b.Traces),
+		Timestamps:          slices.Clone(b.Timestamps),
+		ProducedUnixEpochUs: b.ProducedUnixEpochUs,
+	}
+	if len(b.Keys) > 0 {
+		clone.Keys = make([][]byte, len(b.Keys))
+		for i, key := range b.Keys {
+			clone.Keys[i] = slices.Clone(key)
+		}
+	}
+	if len(b.Headers) > 0 {
+		clone.Headers = make([][]RecordHeader, len(b.Headers))
+		for i, headers := range b.Headers {
+			clone.Headers[i] = slices.Clone(headers)
+			for j, header := range headers {
+				clone.Headers[i][j].Value = slices.Clone(header.Value)
+			}
+		}
+	}
+
+	return clone
+}
+
 func (b Batch) IndividualRecords() [][]byte {
 	if b.Len() == 0 {
 		return nil
@@ -57,17 +213,25 @@ func (b Batch) IndividualRecords() [][]byte {
 }
 
 func (b Batch) IndividualRecordsSubset(startIndex int, endIndex int) ([][]byte, error) {
-	recordsData, err := b.Records(startIndex, endIndex)
+	slice, err := b.Slice(startIndex, endIndex)
 	if err != nil {
 		return nil, err
 	}
 
-	records := make([][]byte, endIndex-startIndex)
+	records := make([][]byte, slice.Len())
 	bytesUsed := uint32(0)
-	for i := range records {
-		size := b.Sizes[startIndex+i]
-		records[i] = recordsData[bytesUsed : bytesUsed+size]
+	for i, size := range slice.Sizes {
+		records[i] = slice.Data[bytesUsed : bytesUsed+size]
 		bytesUsed += size
 	}
 	return records, nil
 }
+
+// EarliestProduced returns the earliest of the produced times a and b, in
+// unix epoch microseconds, ignoring unknown (0) times.
+func EarliestProduced(a int64, b int64) int64 {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
@@ -144,6 +144,97 @@ func TestBatchIndividualRecords(t *testing.T) {
 	}
 }
 
+// TestBatchSlice verifies that Slice returns the sizes, data and metadata of
+// the requested records, and that out of range slices are rejected.
+func TestBatchSlice(t *testing.T) {
+	batch := tester.RecordsToBatch([][]byte{{1}, {2, 2}, {3, 3, 3}})
+	batch.Expires = []int64{10, 20, 30}
+	batch.Keys = [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+
+	tests := map[string]struct {
+		start    int
+		end      int
+		err      error
+		expected sebrecords.Batch
+	}{
+		"start > end": {
+			start: 1,
+			end:   0,
+			err:   seberr.ErrBadInput,
+		},
+		"end out of bounds": {
+			start: 0,
+			end:   batch.Len() + 1,
+			err:   seberr.ErrOutOfBounds,
+		},
+		"first": {
+			start: 0,
+			end:   1,
+			expected: sebrecords.Batch{
+				Sizes:   []uint32{1},
+				Data:    []byte{1},
+				Expires: []int64{10},
+				Keys:    [][]byte{[]byte("a")},
+			},
+		},
+		"last two": {
+			start: 1,
+			end:   3,
+			expected: sebrecords.Batch{
+				Sizes:   []uint32{2, 3},
+				Data:    []byte{2, 2, 3, 3, 3},
+				Expires: []int64{20, 30},
+				Keys:    [][]byte{[]byte("b"), []byte("c")},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			got, err := batch.Slice(test.start, test.end)
+
+			// Assert
+			require.ErrorIs(t, err, test.err)
+			require.Equal(t, test.expected, got)
+		})
+	}
+}
+
+// TestBatchClone verifies that Clone() returns a copy of the records and
+// per-record metadata of a batch, which doesn't share memory with it.
+func TestBatchClone(t *testing.T) {
+	batch := tester.RecordsToBatch([][]byte{{1}, {2, 2}})
+	batch.Expires = []int64{10, 20}
+	batch.Pointers = []bool{false, true}
+	batch.Traces = []sebrecords.Trace{{ID: "trace", Start: 0, NumRecords: 2}}
+	batch.Timestamps = []int64{1, 2}
+	batch.Keys = [][]byte{[]byte("a"), []byte("b")}
+	batch.Headers = [][]sebrecords.RecordHeader{{{Key: "k", Value: []byte("v")}}, nil}
+	batch.ProducedUnixEpochUs = 42
+
+	// Act
+	got := batch.Clone()
+
+	// Assert
+	require.Equal(t, batch, got)
+
+	batch.Data[0] = 9
+	batch.Expires[0] = 0
+	batch.Pointers[1] = false
+	batch.Traces[0].ID = "other"
+	batch.Timestamps[0] = 0
+	batch.Keys[0][0] = 'x'
+	batch.Headers[0][0].Value[0] = 'x'
+	require.Equal(t, []byte{1, 2, 2}, got.Data)
+	require.Equal(t, []int64{10, 20}, got.Expires)
+	require.Equal(t, []bool{false, true}, got.Pointers)
+	require.Equal(t, "trace", got.Traces[0].ID)
+	require.Equal(t, []int64{1, 2}, got.Timestamps)
+	require.Equal(t, []byte("a"), got.Keys[0])
+	require.Equal(t, []byte("v"), got.Headers[0][0].Value)
+}
+
 // TestBatchReset verifies that Reset() correctly resets the underlying buffers,
 // allowing the batch to be reused.
 func TestBatchReset(t *testing.T) {
@@ -173,3 +264,29 @@ func TestBatchReset(t *testing.T) {
 		require.Equal(t, expected, got.Data)
 	}
 }
+
+// TestEarliestProduced verifies that EarliestProduced() returns the earliest
+// of two produced times, ignoring unknown (0) times.
+func TestEarliestProduced(t *testing.T) {
+	tests := map[string]struct {
+		a        int64
+		b        int64
+		expected int64
+	}{
+		"both unknown": {a: 0, b: 0, expected: 0},
+		"a unknown":    {a: 0, b: 5, expected: 5},
+		"b unknown":    {a: 5, b: 0, expected: 5},
+		"a earliest":   {a: 3, b: 5, expected: 3},
+		"b earliest":   {a: 5, b: 3, expected: 3},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			got := sebrecords.EarliestProduced(test.a, test.b)
+
+			// Assert
+			require.Equal(t, test.expected, got)
+		})
+	}
+}
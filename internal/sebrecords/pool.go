@@ -0,0 +1,84 @@
+package sebrecords
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/micvbang/go-helpy/syncy"
+)
+
+// maxPooledBufBytes is the largest buffer that is returned to bufPool. Larger
+// buffers are left for the garbage collector, so that a few unusually large
+// record batches don't keep memory allocated indefinitely.
+const maxPooledBufBytes = 1024 * 1024
+
+// bufPool holds the buffers that record batch headers and metadata are
+// encoded into and decoded from, avoiding allocations for every record batch
+// that is written or parsed.
+var bufPool = syncy.NewPool(func() *[]byte {
+	bs := make([]byte, 0, 4096)
+	return &bs
+})
+
+// getBuf returns an empty buffer from bufPool. It must be returned using
+// putBuf once it's no longer used.
+func getBuf() *[]byte {
+	buf := bufPool.Get()
+	*buf = (*buf)[:0]
+	return buf
+}
+
+func putBuf(buf *[]byte) {
+	if cap(*buf) > maxPooledBufBytes {
+		return
+	}
+	bufPool.Put(buf)
+}
+
+// readBuf reads n bytes from rdr into buf, growing it if necessary.
+func readBuf(rdr io.Reader, buf *[]byte, n int) ([]byte, error) {
+	if cap(*buf) < n {
+		*buf = make([]byte, n)
+	}
+	bs := (*buf)[:n]
+
+	_, err := io.ReadFull(rdr, bs)
+	if err != nil {
+		return nil, err
+	}
+	return bs, nil
+}
+
+// appendHeader appends header to bs, encoded in the same way as
+// binary.Write() would encode it.
+func appendHeader(bs []byte, header Header) []byte {
+	bs = append(bs, header.MagicBytes[:]...)
+	bs = byteOrder.AppendUint16(bs, uint16(header.Version))
+	bs = byteOrder.AppendUint64(bs, uint64(header.UnixEpochUs))
+	bs = byteOrder.AppendUint32(bs, header.NumRecords)
+	bs = byteOrder.AppendUint16(bs, header.Flags)
+	bs = byteOrder.AppendUint32(bs, header.TracesSize)
+	bs = byteOrder.AppendUint64(bs, uint64(header.ProducedUnixEpochUs))
+	return bs
+}
+
+// readHeader reads a header written by appendHeader from rdr.
+func readHeader(rdr io.Reader) (Header, error) {
+	var bs [headerBytes]byte
+	_, err := io.ReadFull(rdr, bs[:])
+	if err != nil {
+		return Header{}, fmt.Errorf("reading header: %w", err)
+	}
+
+	header := Header{
+		Version:             int16(byteOrder.Uint16(bs[4:])),
+		UnixEpochUs:         int64(byteOrder.Uint64(bs[6:])),
+		NumRecords:          byteOrder.Uint32(bs[14:]),
+		Flags:               byteOrder.Uint16(bs[18:]),
+		TracesSize:          byteOrder.Uint32(bs[20:]),
+		ProducedUnixEpochUs: int64(byteOrder.Uint64(bs[24:])),
+	}
+	copy(header.MagicBytes[:], bs[:4])
+
+	return header, nil
+}
@@ -16,22 +16,89 @@ var (
 )
 
 const (
-	FileFormatVersion = 1
+	FileFormatVersionV1 = 1
+	FileFormatVersionV2 = 2
+
+	// FileFormatVersion is the version written by Write and WriteAt, unless
+	// the batch uses features that require a newer version.
+	//
+	// NOTE: v1 remains the default until all brokers that may read record
+	// batches, e.g. during rolling upgrades, can read v2.
+	FileFormatVersion = FileFormatVersionV1
+
+	// FileFormatVersionLatest is the newest version that can be written.
+	FileFormatVersionLatest = FileFormatVersionV2
+
 	headerBytes       = 32
 	recordIndexSize   = 4
+	recordExpiresSize = 8
+	recordPointerSize = 1
+)
+
+const (
+	// FlagExpires is set in Header.Flags when the record batch contains the
+	// expiry time of each of its records.
+	FlagExpires uint16 = 1 << iota
+
+	// FlagPointers is set in Header.Flags when the record batch marks which
+	// of its records are pointers to records stored elsewhere.
+	FlagPointers
+
+	// FlagTraces is set in Header.Flags when the record batch contains the
+	// trace IDs of the requests that produced its records. The traces take up
+	// Header.TracesSize bytes.
+	FlagTraces
+
+	// FlagTimestamps is set in Header.Flags when the record batch contains
+	// the time of each of its records. Requires v2.
+	FlagTimestamps
+
+	// FlagKeys is set in Header.Flags when the record batch contains the key
+	// of each of its records. Requires v2.
+	FlagKeys
+
+	// FlagHeaders is set in Header.Flags when the record batch contains the
+	// headers of each of its records. Requires v2.
+	FlagHeaders
 )
 
+// v2Flags are the flags that require v2.
+const v2Flags = FlagTimestamps | FlagKeys | FlagHeaders
+
+// MaxTraceIDLen is the maximum length of a trace ID.
+const MaxTraceIDLen = 255
+
+// traceSize is the size of a trace, excluding its ID.
+const traceSize = 4 + 4 + 1
+
 type Header struct {
 	MagicBytes  [4]byte
 	Version     int16
 	UnixEpochUs int64
 	NumRecords  uint32
-	Reserved    [14]byte
+	Flags       uint16
+	TracesSize  uint32
+
+	// ProducedUnixEpochUs is the time at which the oldest records of the
+	// record batch were produced, as given by producers. It's 0 if unknown.
+	ProducedUnixEpochUs int64
 }
 
-// Size returns the size of the header in bytes
+// Size returns the size of the header of v1 record batches in bytes, i.e. the
+// offset of the record data. The size of v2 headers is variable; use
+// Parser.DataOffset() instead.
 func (h Header) Size() uint32 {
-	return headerBytes + h.NumRecords*recordIndexSize
+	size := headerBytes + h.NumRecords*recordIndexSize
+	if h.Flags&FlagExpires != 0 {
+		size += h.NumRecords * recordExpiresSize
+	}
+	if h.Flags&FlagPointers != 0 {
+		size += h.NumRecords * recordPointerSize
+	}
+	if h.Flags&FlagTraces != 0 {
+		size += h.TracesSize
+	}
+	return size
 }
 
 var UnixEpochUs = func() int64 {
@@ -39,31 +106,130 @@ var UnixEpochUs = func() int64 {
 }
 
 func Write(wtr io.Writer, batch Batch) error {
+	return WriteAt(wtr, batch, UnixEpochUs())
+}
+
+// WriteAt writes batch like Write, but with unixEpochUs as the time the
+// record batch was committed. This is useful when rewriting existing record
+// batches.
+//
+// The record batch is written using FileFormatVersion, unless batch has
+// timestamps, keys or headers, which require v2.
+func WriteAt(wtr io.Writer, batch Batch, unixEpochUs int64) error {
+	version := int16(FileFormatVersion)
+	if len(batch.Timestamps) > 0 || len(batch.Keys) > 0 || len(batch.Headers) > 0 {
+		version = FileFormatVersionV2
+	}
+	return WriteVersion(wtr, batch, unixEpochUs, version)
+}
+
+// WriteVersion writes batch like WriteAt, using the given file format
+// version.
+func WriteVersion(wtr io.Writer, batch Batch, unixEpochUs int64, version int16) error {
 	header := Header{
 		MagicBytes:  FileFormatMagicBytes,
-		UnixEpochUs: UnixEpochUs(),
-		Version:     FileFormatVersion,
+		UnixEpochUs: unixEpochUs,
+		Version:     version,
 		NumRecords:  uint32(batch.Len()),
+
+		ProducedUnixEpochUs: batch.ProducedUnixEpochUs,
 	}
 
-	err := binary.Write(wtr, byteOrder, header)
-	if err != nil {
-		return fmt.Errorf("writing header: %w", err)
+	if len(batch.Expires) > 0 {
+		if len(batch.Expires) != batch.Len() {
+			return fmt.Errorf("%w: %d expiry times given for %d records", seberr.ErrBadInput, len(batch.Expires), batch.Len())
+		}
+		header.Flags |= FlagExpires
+	}
+
+	if len(batch.Pointers) > 0 {
+		if len(batch.Pointers) != batch.Len() {
+			return fmt.Errorf("%w: %d pointer markers given for %d records", seberr.ErrBadInput, len(batch.Pointers), batch.Len())
+		}
+		header.Flags |= FlagPointers
 	}
 
-	indexes := make([]int32, len(batch.Sizes))
-	index := int32(0)
-	for i, recordSize := range batch.Sizes {
-		indexes[i] = index
-		index += int32(recordSize)
+	if len(batch.Timestamps) > 0 {
+		if len(batch.Timestamps) != batch.Len() {
+			return fmt.Errorf("%w: %d timestamps given for %d records", seberr.ErrBadInput, len(batch.Timestamps), batch.Len())
+		}
+		header.Flags |= FlagTimestamps
 	}
 
-	err = binary.Write(wtr, byteOrder, indexes)
+	if len(batch.Keys) > 0 {
+		if len(batch.Keys) != batch.Len() {
+			return fmt.Errorf("%w: %d keys given for %d records", seberr.ErrBadInput, len(batch.Keys), batch.Len())
+		}
+		header.Flags |= FlagKeys
+	}
+
+	if len(batch.Headers) > 0 {
+		if len(batch.Headers) != batch.Len() {
+			return fmt.Errorf("%w: %d record headers given for %d records", seberr.ErrBadInput, len(batch.Headers), batch.Len())
+		}
+		header.Flags |= FlagHeaders
+	}
+
+	var traces []byte
+	if len(batch.Traces) > 0 {
+		tracesBuf := getBuf()
+		defer putBuf(tracesBuf)
+
+		var err error
+		traces, err = appendTraces(*tracesBuf, batch.Traces, batch.Len())
+		if err != nil {
+			return err
+		}
+		*tracesBuf = traces
+
+		header.Flags |= FlagTraces
+		header.TracesSize = uint32(len(traces))
+	}
+
+	switch version {
+	case FileFormatVersionV1:
+		if header.Flags&v2Flags != 0 {
+			return fmt.Errorf("%w: record timestamps, keys and headers require format version %d", seberr.ErrBadInput, FileFormatVersionV2)
+		}
+		return writeV1(wtr, header, batch, traces)
+	case FileFormatVersionV2:
+		return writeV2(wtr, header, batch, traces)
+	}
+
+	return fmt.Errorf("%w: unsupported format version %d", seberr.ErrBadInput, version)
+}
+
+func writeV1(wtr io.Writer, header Header, batch Batch, traces []byte) error {
+	buf := getBuf()
+	defer putBuf(buf)
+
+	bs := appendHeader(*buf, header)
+
+	index := uint32(0)
+	for _, recordSize := range batch.Sizes {
+		bs = byteOrder.AppendUint32(bs, index)
+		index += recordSize
+	}
+
+	if header.Flags&FlagExpires != 0 {
+		for _, expires := range batch.Expires {
+			bs = byteOrder.AppendUint64(bs, uint64(expires))
+		}
+	}
+
+	if header.Flags&FlagPointers != 0 {
+		bs = appendPointers(bs, batch.Pointers)
+	}
+
+	bs = append(bs, traces...)
+	*buf = bs
+
+	_, err := wtr.Write(bs)
 	if err != nil {
-		return fmt.Errorf("writing record indexes %v: %w", indexes, err)
+		return fmt.Errorf("writing header and record index: %w", err)
 	}
 
-	err = binary.Write(wtr, byteOrder, batch.Data)
+	_, err = wtr.Write(batch.Data)
 	if err != nil {
 		return fmt.Errorf("writing records length %s: %w", sizey.FormatBytes(batch.Len()), err)
 	}
@@ -71,57 +237,198 @@ func Write(wtr io.Writer, batch Batch) error {
 	return nil
 }
 
+func appendPointers(bs []byte, pointers []bool) []byte {
+	for _, pointer := range pointers {
+		b := byte(0)
+		if pointer {
+			b = 1
+		}
+		bs = append(bs, b)
+	}
+	return bs
+}
+
 type Parser struct {
 	Header      Header
 	recordIndex []uint32
 	RecordSizes []uint32
-	rdr         io.ReadSeekCloser
+
+	// Expires holds the expiry time of each record, in unix epoch
+	// microseconds. It is nil if the record batch has no expiry times.
+	Expires []int64
+
+	// Pointers marks which records are pointers to records stored elsewhere.
+	// It is nil if the record batch has no pointer records.
+	Pointers []bool
+
+	// Traces holds the trace IDs of the requests that produced the records.
+	// It is nil if the record batch has no traces.
+	Traces []Trace
+
+	// Timestamps holds the time of each record, in unix epoch microseconds.
+	// It is nil if the record batch has no timestamps.
+	Timestamps []int64
+
+	// Keys holds the key of each record. It is nil if the record batch has no
+	// keys.
+	Keys [][]byte
+
+	// Headers holds the headers of each record. It is nil if the record batch
+	// has no headers.
+	Headers [][]RecordHeader
+
+	// dataOffset is the offset in the file at which record data starts
+	dataOffset uint32
+
+	rdr io.ReadSeekCloser
 }
 
 // Parse reads a RecordBatch file and returns a Parser which can be used to
-// read individual records.
+// read individual records. The file format version is read from the header,
+// such that files of all supported versions can be read.
 func Parse(rdr io.ReadSeekCloser) (*Parser, error) {
-	header := Header{}
-	err := binary.Read(rdr, byteOrder, &header)
+	header, err := readHeader(rdr)
 	if err != nil {
-		return nil, fmt.Errorf("reading header: %w", err)
+		return nil, err
 	}
 
-	// NOTE: we're adding the size of the final record to recordIndex below,
-	// once we've figured out the total file size
-	recordIndex := make([]uint32, header.NumRecords, header.NumRecords+1)
-	err = binary.Read(rdr, byteOrder, &recordIndex)
+	var p *Parser
+	switch header.Version {
+	case FileFormatVersionV1:
+		p, err = parseV1(rdr, header)
+		if err != nil {
+			return nil, err
+		}
+
+		// TODO: this seek is only necessary because v1 doesn't have the size
+		// of the last entry in the file; v2 does.
+		fileSize, err := rdr.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, fmt.Errorf("seeking to end of file: %w", err)
+		}
+		p.recordIndex = append(p.recordIndex, uint32(fileSize)-header.Size())
+	case FileFormatVersionV2:
+		p, err = parseV2(rdr, header)
+	default:
+		return nil, fmt.Errorf("unsupported format version %d", header.Version)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("reading record index: %w", err)
+		return nil, err
 	}
 
-	// TODO: this seek is only necessary because we don't have the size of the
-	// last entry in the file.
-	// In order to not make the code more complex than necessary, we compute the
-	// file size once, now, when the file is opened. An alternative (and
-	// probably better) solution could be to include the size of the final
-	// record in the file header.
-	fileSize, err := rdr.Seek(0, io.SeekEnd)
+	recordSizes := make([]uint32, 0, len(p.recordIndex)-1)
+	for i := 0; i < len(p.recordIndex)-1; i++ {
+		recordSize := p.recordIndex[i+1] - p.recordIndex[i]
+		recordSizes = append(recordSizes, recordSize)
+	}
+
+	p.Header = header
+	p.RecordSizes = recordSizes
+	p.rdr = rdr
+	return p, nil
+}
+
+// parseV1 parses the metadata of a v1 record batch from rdr. The returned
+// recordIndex doesn't contain the end of the last record, which can only be
+// known from the size of the file.
+func parseV1(rdr io.Reader, header Header) (*Parser, error) {
+	buf := getBuf()
+	defer putBuf(buf)
+
+	// NOTE: the caller must add the end of the final record to recordIndex,
+	// once it has figured out the total file size
+	bs, err := readBuf(rdr, buf, int(header.NumRecords)*recordIndexSize)
 	if err != nil {
-		return nil, fmt.Errorf("seeking to end of file: %w", err)
+		return nil, fmt.Errorf("reading record index: %w", err)
+	}
+	recordIndex := make([]uint32, header.NumRecords, header.NumRecords+1)
+	for i := range recordIndex {
+		recordIndex[i] = byteOrder.Uint32(bs[i*recordIndexSize:])
 	}
 
-	recordIndex = append(recordIndex, uint32(fileSize)-header.Size())
+	var expires []int64
+	if header.Flags&FlagExpires != 0 {
+		bs, err = readBuf(rdr, buf, int(header.NumRecords)*recordExpiresSize)
+		if err != nil {
+			return nil, fmt.Errorf("reading record expiry times: %w", err)
+		}
+		expires = make([]int64, header.NumRecords)
+		for i := range expires {
+			expires[i] = int64(byteOrder.Uint64(bs[i*recordExpiresSize:]))
+		}
+	}
 
-	recordSizes := make([]uint32, 0, len(recordIndex)-1)
-	for i := 0; i < len(recordIndex)-1; i++ {
-		recordSize := recordIndex[i+1] - recordIndex[i]
-		recordSizes = append(recordSizes, recordSize)
+	var pointers []bool
+	if header.Flags&FlagPointers != 0 {
+		bs, err = readBuf(rdr, buf, int(header.NumRecords)*recordPointerSize)
+		if err != nil {
+			return nil, fmt.Errorf("reading record pointer markers: %w", err)
+		}
+		pointers = make([]bool, header.NumRecords)
+		for i := range pointers {
+			pointers[i] = bs[i] != 0
+		}
+	}
+
+	var traces []Trace
+	if header.Flags&FlagTraces != 0 {
+		bs, err = readBuf(rdr, buf, int(header.TracesSize))
+		if err != nil {
+			return nil, fmt.Errorf("reading traces: %w", err)
+		}
+
+		traces, err = parseTraces(bs, header.NumRecords)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return &Parser{
-		Header:      header,
 		recordIndex: recordIndex,
-		rdr:         rdr,
-		RecordSizes: recordSizes,
+		Expires:     expires,
+		Pointers:    pointers,
+		Traces:      traces,
+		dataOffset:  header.Size(),
 	}, nil
 }
 
+// DataOffset returns the offset in the file at which record data starts.
+func (rb *Parser) DataOffset() uint32 {
+	return rb.dataOffset
+}
+
+// Expired returns true if the record at recordIndex has an expiry time that
+// is at or before nowUs (unix epoch microseconds).
+func (rb *Parser) Expired(recordIndex uint32, nowUs int64) bool {
+	if rb.Expires == nil {
+		return false
+	}
+
+	expiresUs := rb.Expires[recordIndex]
+	return expiresUs != 0 && expiresUs <= nowUs
+}
+
+// IsPointer returns true if the record at recordIndex is a pointer to a
+// record stored elsewhere.
+func (rb *Parser) IsPointer(recordIndex uint32) bool {
+	return rb.Pointers != nil && rb.Pointers[recordIndex]
+}
+
+// AllExpired returns true if every record in the record batch has expired at
+// nowUs (unix epoch microseconds).
+func (rb *Parser) AllExpired(nowUs int64) bool {
+	if rb.Expires == nil {
+		return false
+	}
+
+	for i := range rb.Header.NumRecords {
+		if !rb.Expired(i, nowUs) {
+			return false
+		}
+	}
+	return true
+}
+
 func (rb *Parser) Records(batch *Batch, recordIndexStart uint32, recordIndexEnd uint32) error {
 	if recordIndexStart >= rb.Header.NumRecords {
 		return fmt.Errorf("%d records available, start record index %d does not exist: %w", rb.Header.NumRecords, recordIndexStart, seberr.ErrOutOfBounds)
@@ -148,7 +455,7 @@ func (rb *Parser) Records(batch *Batch, recordIndexStart uint32, recordIndexEnd
 		return fmt.Errorf("%w: not enough bytes left in buffer to satisfy read; %d required, %d left", seberr.ErrBufferTooSmall, requestedBytes, bytesLeftInBatch)
 	}
 
-	fileOffsetStart := rb.Header.Size() + recordOffsetStart
+	fileOffsetStart := rb.dataOffset + recordOffsetStart
 	_, err := rb.rdr.Seek(int64(fileOffsetStart), io.SeekStart)
 	if err != nil {
 		return fmt.Errorf("seeking for record %d/%d: %w", recordIndexStart, len(rb.recordIndex), err)
@@ -173,6 +480,38 @@ func (rb *Parser) Records(batch *Batch, recordIndexStart uint32, recordIndexEnd
 	return nil
 }
 
+// WriteRecordsTo writes the data of records [recordIndexStart;recordIndexEnd)
+// to w, without reading it into an intermediate buffer. If the underlying
+// reader is a file and w supports it, e.g. a network connection, the data is
+// copied by the kernel.
+func (rb *Parser) WriteRecordsTo(w io.Writer, recordIndexStart uint32, recordIndexEnd uint32) (int64, error) {
+	if recordIndexStart >= rb.Header.NumRecords {
+		return 0, fmt.Errorf("%d records available, start record index %d does not exist: %w", rb.Header.NumRecords, recordIndexStart, seberr.ErrOutOfBounds)
+	}
+	if recordIndexEnd > rb.Header.NumRecords {
+		return 0, fmt.Errorf("%d records available, end record index %d does not exist: %w", rb.Header.NumRecords, recordIndexEnd, seberr.ErrOutOfBounds)
+	}
+	if recordIndexStart >= recordIndexEnd {
+		return 0, fmt.Errorf("%w: recordIndexStart (%d) must be lower than recordIndexEnd (%d)", seberr.ErrBadInput, recordIndexStart, recordIndexEnd)
+	}
+
+	recordOffsetStart := rb.recordIndex[recordIndexStart]
+	requestedBytes := int64(rb.recordIndex[recordIndexEnd] - recordOffsetStart)
+
+	fileOffsetStart := rb.dataOffset + recordOffsetStart
+	_, err := rb.rdr.Seek(int64(fileOffsetStart), io.SeekStart)
+	if err != nil {
+		return 0, fmt.Errorf("seeking for record %d/%d: %w", recordIndexStart, len(rb.recordIndex), err)
+	}
+
+	n, err := io.CopyN(w, rb.rdr, requestedBytes)
+	if err != nil {
+		return n, fmt.Errorf("writing record indexes [%d;%d]: %w", recordIndexStart, recordIndexEnd, err)
+	}
+
+	return n, nil
+}
+
 func (rb *Parser) Close() error {
 	return rb.rdr.Close()
 }
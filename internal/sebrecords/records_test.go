@@ -57,6 +57,92 @@ func TestWrite(t *testing.T) {
 	}
 }
 
+// TestWriteAt verifies that WriteAt() writes the given commit time to the
+// header.
+func TestWriteAt(t *testing.T) {
+	batch := tester.MakeRandomRecordBatch(3)
+	unixEpochUs := time.Now().Add(-time.Hour).UnixMicro()
+	buf := bytes.NewBuffer(nil)
+
+	// Act
+	err := sebrecords.WriteAt(buf, batch, unixEpochUs)
+	require.NoError(t, err)
+
+	// Assert
+	gotHeader := sebrecords.Header{}
+	err = binary.Read(buf, binary.LittleEndian, &gotHeader)
+	require.NoError(t, err)
+	require.Equal(t, unixEpochUs, gotHeader.UnixEpochUs)
+	require.Equal(t, uint32(batch.Len()), gotHeader.NumRecords)
+}
+
+// TestWriteReadExpires verifies that expiry times written by Write() are
+// available from the Parser, that records can still be read, and that
+// Expired() and AllExpired() report the expected values.
+func TestWriteReadExpires(t *testing.T) {
+	batch := tester.MakeRandomRecordBatch(3)
+	batch.Expires = []int64{0, 100, 200}
+
+	buf := bytes.NewBuffer(nil)
+	err := sebrecords.Write(buf, batch)
+	require.NoError(t, err)
+
+	// Act
+	parser, err := sebrecords.Parse(bytey.NewBuffer(buf.Bytes()))
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, sebrecords.FlagExpires, parser.Header.Flags)
+	require.Equal(t, batch.Expires, parser.Expires)
+
+	got := tester.NewBatch(batch.Len(), 4096)
+	err = parser.Records(&got, 0, uint32(batch.Len()))
+	require.NoError(t, err)
+	require.Equal(t, batch.Data, got.Data)
+
+	require.False(t, parser.Expired(0, 1000))
+	require.True(t, parser.Expired(1, 100))
+	require.False(t, parser.Expired(2, 199))
+	require.True(t, parser.Expired(2, 200))
+
+	// record 0 never expires
+	require.False(t, parser.AllExpired(1000))
+}
+
+// TestWriteReadNoExpires verifies that batches without expiry times are
+// written without FlagExpires and that no records are reported as expired.
+func TestWriteReadNoExpires(t *testing.T) {
+	batch := tester.MakeRandomRecordBatch(3)
+
+	buf := bytes.NewBuffer(nil)
+	err := sebrecords.Write(buf, batch)
+	require.NoError(t, err)
+
+	// Act
+	parser, err := sebrecords.Parse(bytey.NewBuffer(buf.Bytes()))
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, uint16(0), parser.Header.Flags)
+	require.Nil(t, parser.Expires)
+	require.False(t, parser.Expired(0, time.Now().UnixMicro()))
+	require.False(t, parser.AllExpired(time.Now().UnixMicro()))
+}
+
+// TestWriteExpiresLengthMismatch verifies that Write() returns
+// seberr.ErrBadInput when the number of expiry times does not match the number
+// of records.
+func TestWriteExpiresLengthMismatch(t *testing.T) {
+	batch := tester.MakeRandomRecordBatch(3)
+	batch.Expires = []int64{1}
+
+	// Act
+	err := sebrecords.Write(bytes.NewBuffer(nil), batch)
+
+	// Assert
+	require.ErrorIs(t, err, seberr.ErrBadInput)
+}
+
 // TestReadRecords verifies that Records() returns the expected records when
 // called with valid record start and end indexes.
 func TestReadRecords(t *testing.T) {
@@ -367,3 +453,356 @@ func TestWriteRaw(t *testing.T) {
 		expectedIndex += len(records)
 	}
 }
+
+// TestWriteReadPointers verifies that pointer markers are written and read
+// back, and that records are unaffected by them.
+func TestWriteReadPointers(t *testing.T) {
+	batch := tester.MakeRandomRecordBatch(3)
+	batch.Pointers = []bool{false, true, false}
+
+	buf := bytes.NewBuffer(nil)
+	err := sebrecords.Write(buf, batch)
+	require.NoError(t, err)
+
+	// Act
+	rb, err := sebrecords.Parse(bytey.NewBuffer(buf.Bytes()))
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, sebrecords.FlagPointers, rb.Header.Flags)
+	require.Equal(t, batch.Pointers, rb.Pointers)
+	require.False(t, rb.IsPointer(0))
+	require.True(t, rb.IsPointer(1))
+
+	gotBatch := tester.NewBatch(batch.Len(), 4096)
+	err = rb.Records(&gotBatch, 0, uint32(batch.Len()))
+	require.NoError(t, err)
+	require.Equal(t, batch.Data, gotBatch.Data)
+}
+
+// TestWriteReadTraces verifies that traces are written and read back, and that
+// records are unaffected by them.
+func TestWriteReadTraces(t *testing.T) {
+	batch := tester.MakeRandomRecordBatch(5)
+	batch.Expires = []int64{0, 0, 100, 0, 0}
+	batch.Traces = []sebrecords.Trace{
+		{ID: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", Start: 0, NumRecords: 2},
+		{ID: "trace-2", Start: 2, NumRecords: 3},
+	}
+
+	buf := bytes.NewBuffer(nil)
+	err := sebrecords.Write(buf, batch)
+	require.NoError(t, err)
+
+	// Act
+	rb, err := sebrecords.Parse(bytey.NewBuffer(buf.Bytes()))
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, sebrecords.FlagExpires|sebrecords.FlagTraces, rb.Header.Flags)
+	require.Equal(t, batch.Traces, rb.Traces)
+	require.Equal(t, batch.Expires, rb.Expires)
+
+	gotBatch := tester.NewBatch(batch.Len(), 4096)
+	err = rb.Records(&gotBatch, 0, uint32(batch.Len()))
+	require.NoError(t, err)
+	require.Equal(t, batch.Data, gotBatch.Data)
+}
+
+// TestWriteTracesBadInput verifies that Write() returns seberr.ErrBadInput
+// when traces have invalid IDs or refer to records outside of the batch.
+func TestWriteTracesBadInput(t *testing.T) {
+	tests := map[string]struct {
+		trace sebrecords.Trace
+	}{
+		"empty id":        {trace: sebrecords.Trace{ID: "", NumRecords: 1}},
+		"id too long":     {trace: sebrecords.Trace{ID: string(make([]byte, sebrecords.MaxTraceIDLen+1)), NumRecords: 1}},
+		"start too large": {trace: sebrecords.Trace{ID: "trace", Start: 3, NumRecords: 1}},
+		"too many":        {trace: sebrecords.Trace{ID: "trace", Start: 1, NumRecords: 3}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			batch := tester.MakeRandomRecordBatch(3)
+			batch.Traces = []sebrecords.Trace{test.trace}
+
+			// Act
+			err := sebrecords.Write(bytes.NewBuffer(nil), batch)
+
+			// Assert
+			require.ErrorIs(t, err, seberr.ErrBadInput)
+		})
+	}
+}
+
+// TestWriteReadProducedUnixEpochUs verifies that the produced time of a batch
+// is written to and read from the header.
+func TestWriteReadProducedUnixEpochUs(t *testing.T) {
+	batch := tester.MakeRandomRecordBatch(3)
+	batch.ProducedUnixEpochUs = time.Now().UnixMicro()
+
+	buf := bytes.NewBuffer(nil)
+	err := sebrecords.Write(buf, batch)
+	require.NoError(t, err)
+
+	// Act
+	rb, err := sebrecords.Parse(bytey.NewBuffer(buf.Bytes()))
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, batch.ProducedUnixEpochUs, rb.Header.ProducedUnixEpochUs)
+}
+
+// TestWriteReadV2 verifies that record batches written using v2 can be read
+// back, including the metadata of each record.
+func TestWriteReadV2(t *testing.T) {
+	unixEpochUs := time.Now().UnixMicro()
+
+	batch := tester.MakeRandomRecordBatch(4)
+	batch.Expires = []int64{0, unixEpochUs + 100, 0, 1}
+	batch.Pointers = []bool{false, true, false, false}
+	batch.Timestamps = []int64{unixEpochUs - 1000, unixEpochUs, unixEpochUs + 5, 0}
+	batch.Keys = [][]byte{[]byte("key-1"), {}, []byte("key-3"), []byte("k")}
+	batch.Headers = [][]sebrecords.RecordHeader{
+		{{Key: "content-type", Value: []byte("application/json")}},
+		{},
+		{{Key: "a", Value: []byte("1")}, {Key: "b", Value: []byte{}}},
+		{},
+	}
+	batch.Traces = []sebrecords.Trace{{ID: "trace", Start: 1, NumRecords: 2}}
+
+	buf := bytes.NewBuffer(nil)
+	err := sebrecords.WriteVersion(buf, batch, unixEpochUs, sebrecords.FileFormatVersionV2)
+	require.NoError(t, err)
+
+	// Act
+	rb, err := sebrecords.Parse(bytey.NewBuffer(buf.Bytes()))
+	require.NoError(t, err)
+
+	// Assert
+	require.EqualValues(t, sebrecords.FileFormatVersionV2, rb.Header.Version)
+	require.Equal(t, batch.Expires, rb.Expires)
+	require.Equal(t, batch.Pointers, rb.Pointers)
+	require.Equal(t, batch.Timestamps, rb.Timestamps)
+	require.Equal(t, batch.Keys, rb.Keys)
+	require.Equal(t, batch.Headers, rb.Headers)
+	require.Equal(t, batch.Traces, rb.Traces)
+	require.Equal(t, batch.Sizes, rb.RecordSizes)
+
+	gotBatch := tester.NewBatch(batch.Len(), 4096)
+	err = rb.Records(&gotBatch, 1, uint32(batch.Len()))
+	require.NoError(t, err)
+	expectedRecords, err := batch.IndividualRecordsSubset(1, batch.Len())
+	require.NoError(t, err)
+	require.Equal(t, expectedRecords, gotBatch.IndividualRecords())
+}
+
+// TestParseVersions verifies that Parse() reads record batches written using
+// all supported versions.
+func TestParseVersions(t *testing.T) {
+	batch := tester.MakeRandomRecordBatch(10)
+	batch.Expires = make([]int64, batch.Len())
+	batch.Expires[3] = 42
+
+	for _, version := range []int16{sebrecords.FileFormatVersionV1, sebrecords.FileFormatVersionV2} {
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			buf := bytes.NewBuffer(nil)
+			err := sebrecords.WriteVersion(buf, batch, time.Now().UnixMicro(), version)
+			require.NoError(t, err)
+
+			// Act
+			rb, err := sebrecords.Parse(bytey.NewBuffer(buf.Bytes()))
+			require.NoError(t, err)
+
+			// Assert
+			require.Equal(t, version, rb.Header.Version)
+			require.Equal(t, batch.Expires, rb.Expires)
+
+			gotBatch := tester.NewBatch(batch.Len(), 4096)
+			err = rb.Records(&gotBatch, 0, uint32(batch.Len()))
+			require.NoError(t, err)
+			require.Equal(t, batch.IndividualRecords(), gotBatch.IndividualRecords())
+		})
+	}
+}
+
+// TestWriteAtVersion verifies that WriteAt() writes FileFormatVersion unless
+// the batch has record metadata that requires v2, and that writing such
+// metadata using v1 returns seberr.ErrBadInput.
+func TestWriteAtVersion(t *testing.T) {
+	batch := tester.MakeRandomRecordBatch(2)
+
+	buf := bytes.NewBuffer(nil)
+	err := sebrecords.Write(buf, batch)
+	require.NoError(t, err)
+	rb, err := sebrecords.Parse(bytey.NewBuffer(buf.Bytes()))
+	require.NoError(t, err)
+	require.EqualValues(t, sebrecords.FileFormatVersion, rb.Header.Version)
+
+	batch.Keys = [][]byte{[]byte("a"), []byte("b")}
+
+	// Act
+	buf = bytes.NewBuffer(nil)
+	err = sebrecords.Write(buf, batch)
+	require.NoError(t, err)
+
+	// Assert
+	rb, err = sebrecords.Parse(bytey.NewBuffer(buf.Bytes()))
+	require.NoError(t, err)
+	require.EqualValues(t, sebrecords.FileFormatVersionV2, rb.Header.Version)
+	require.Equal(t, batch.Keys, rb.Keys)
+
+	err = sebrecords.WriteVersion(bytes.NewBuffer(nil), batch, 0, sebrecords.FileFormatVersionV1)
+	require.ErrorIs(t, err, seberr.ErrBadInput)
+}
+
+// TestParseV2Truncated verifies that Parse() returns an error when the
+// metadata of a v2 record batch is truncated.
+func TestParseV2Truncated(t *testing.T) {
+	batch := tester.MakeRandomRecordBatch(5)
+	batch.Keys = [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d"), []byte("e")}
+
+	buf := bytes.NewBuffer(nil)
+	err := sebrecords.WriteVersion(buf, batch, 0, sebrecords.FileFormatVersionV2)
+	require.NoError(t, err)
+
+	// make the metadata size claim fewer bytes than were written
+	bs := buf.Bytes()
+	binary.LittleEndian.PutUint32(bs[32:], 3)
+
+	// Act
+	_, err = sebrecords.Parse(bytey.NewBuffer(bs))
+
+	// Assert
+	require.Error(t, err)
+}
+
+// TestParseUnsupportedVersion verifies that Parse() returns an error for
+// record batches of unknown versions.
+func TestParseUnsupportedVersion(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	err := sebrecords.Write(buf, tester.MakeRandomRecordBatch(1))
+	require.NoError(t, err)
+
+	bs := buf.Bytes()
+	binary.LittleEndian.PutUint16(bs[4:], 99)
+
+	// Act
+	_, err = sebrecords.Parse(bytey.NewBuffer(bs))
+
+	// Assert
+	require.ErrorContains(t, err, "unsupported format version 99")
+}
+
+// TestParseStream verifies that ParseStream returns the sizes and metadata of
+// records in a v2 record batch, leaving the reader at the start of the record
+// data.
+func TestParseStream(t *testing.T) {
+	batch := tester.MakeRandomRecordBatch(5)
+	batch.Keys = [][]byte{[]byte("a"), []byte("b"), {}, []byte("d"), []byte("e")}
+
+	buf := bytes.NewBuffer(nil)
+	err := sebrecords.WriteVersion(buf, batch, 0, sebrecords.FileFormatVersionV2)
+	require.NoError(t, err)
+
+	// Act
+	header, gotBatch, err := sebrecords.ParseStream(buf)
+
+	// Assert
+	require.NoError(t, err)
+	require.EqualValues(t, batch.Len(), header.NumRecords)
+	require.Equal(t, batch.Sizes, gotBatch.Sizes)
+	require.Equal(t, batch.Keys, gotBatch.Keys)
+	require.Empty(t, gotBatch.Data)
+	require.Equal(t, batch.Data, buf.Bytes())
+}
+
+// TestParseStreamV1 verifies that ErrBadInput is returned when attempting to
+// stream a v1 record batch.
+func TestParseStreamV1(t *testing.T) {
+	batch := tester.MakeRandomRecordBatch(5)
+
+	buf := bytes.NewBuffer(nil)
+	err := sebrecords.WriteVersion(buf, batch, 0, sebrecords.FileFormatVersionV1)
+	require.NoError(t, err)
+
+	// Act
+	_, _, err = sebrecords.ParseStream(buf)
+
+	// Assert
+	require.ErrorIs(t, err, seberr.ErrBadInput)
+}
+
+// TestParseKeysNotReused verifies that the keys and headers of a parsed record
+// batch are not overwritten when buffers are reused by later writes and
+// parses.
+func TestParseKeysNotReused(t *testing.T) {
+	batch := tester.MakeRandomRecordBatch(3)
+	batch.Keys = [][]byte{[]byte("key-0"), []byte("key-1"), []byte("key-2")}
+	batch.Headers = [][]sebrecords.RecordHeader{{{Key: "a", Value: []byte("value-a")}}, nil, nil}
+
+	buf := bytes.NewBuffer(nil)
+	err := sebrecords.WriteVersion(buf, batch, 0, sebrecords.FileFormatVersionV2)
+	require.NoError(t, err)
+
+	parser, err := sebrecords.Parse(bytey.NewBuffer(buf.Bytes()))
+	require.NoError(t, err)
+
+	// Act
+	for range 10 {
+		other := tester.MakeRandomRecordBatch(100)
+		otherBuf := bytes.NewBuffer(nil)
+		err := sebrecords.WriteVersion(otherBuf, other, 0, sebrecords.FileFormatVersionV2)
+		require.NoError(t, err)
+
+		_, err = sebrecords.Parse(bytey.NewBuffer(otherBuf.Bytes()))
+		require.NoError(t, err)
+	}
+
+	// Assert
+	require.Equal(t, batch.Keys, parser.Keys)
+	require.Equal(t, []byte("value-a"), parser.Headers[0][0].Value)
+}
+
+func BenchmarkWriteVersion(b *testing.B) {
+	for _, version := range []int16{sebrecords.FileFormatVersionV1, sebrecords.FileFormatVersionV2} {
+		b.Run(fmt.Sprintf("v%d", version), func(b *testing.B) {
+			batch := tester.MakeRandomRecordBatchSize(1024, 512)
+			batch.Expires = make([]int64, batch.Len())
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				err := sebrecords.WriteVersion(io.Discard, batch, 0, version)
+				if err != nil {
+					b.Fatalf("unexpected error: %s", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	for _, version := range []int16{sebrecords.FileFormatVersionV1, sebrecords.FileFormatVersionV2} {
+		b.Run(fmt.Sprintf("v%d", version), func(b *testing.B) {
+			batch := tester.MakeRandomRecordBatchSize(1024, 512)
+			batch.Expires = make([]int64, batch.Len())
+
+			buf := bytes.NewBuffer(nil)
+			err := sebrecords.WriteVersion(buf, batch, 0, version)
+			if err != nil {
+				b.Fatalf("unexpected error: %s", err)
+			}
+			bs := buf.Bytes()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				_, err := sebrecords.Parse(bytey.NewBuffer(bs))
+				if err != nil {
+					b.Fatalf("unexpected error: %s", err)
+				}
+			}
+		})
+	}
+}
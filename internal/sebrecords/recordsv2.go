@@ -0,0 +1,300 @@
+package sebrecords
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// v2 record batches have the same fixed size Header as v1, followed by:
+//
+//   - the size of the metadata in bytes (uint32)
+//   - the metadata: the varint encoded size of each record, followed by the
+//     expiry times, pointer markers, timestamps, keys, headers and traces of
+//     the records, as indicated by Header.Flags
+//   - the record data
+//
+// Unlike v1, the size of every record is stored, so the size of the file
+// isn't needed in order to parse it.
+const metaSizeBytes = 4
+
+func writeV2(wtr io.Writer, header Header, batch Batch, traces []byte) error {
+	buf := getBuf()
+	defer putBuf(buf)
+
+	bs := appendHeader(*buf, header)
+
+	// the size of the metadata is set once it's known
+	bs = append(bs, 0, 0, 0, 0)
+	metaStart := len(bs)
+
+	for _, recordSize := range batch.Sizes {
+		bs = binary.AppendUvarint(bs, uint64(recordSize))
+	}
+
+	if header.Flags&FlagExpires != 0 {
+		for _, expires := range batch.Expires {
+			bs = binary.AppendVarint(bs, expires)
+		}
+	}
+
+	if header.Flags&FlagPointers != 0 {
+		bs = appendPointers(bs, batch.Pointers)
+	}
+
+	if header.Flags&FlagTimestamps != 0 {
+		// NOTE: timestamps are stored relative to the commit time, keeping
+		// them small
+		for _, timestamp := range batch.Timestamps {
+			bs = binary.AppendVarint(bs, timestamp-header.UnixEpochUs)
+		}
+	}
+
+	if header.Flags&FlagKeys != 0 {
+		for _, key := range batch.Keys {
+			bs = appendBytes(bs, key)
+		}
+	}
+
+	if header.Flags&FlagHeaders != 0 {
+		for _, recordHeaders := range batch.Headers {
+			bs = binary.AppendUvarint(bs, uint64(len(recordHeaders)))
+			for _, recordHeader := range recordHeaders {
+				bs = appendBytes(bs, []byte(recordHeader.Key))
+				bs = appendBytes(bs, recordHeader.Value)
+			}
+		}
+	}
+
+	bs = append(bs, traces...)
+	*buf = bs
+
+	metaSize := len(bs) - metaStart
+	if metaSize > math.MaxUint32 {
+		return fmt.Errorf("metadata of %d bytes too large", metaSize)
+	}
+	byteOrder.PutUint32(bs[headerBytes:], uint32(metaSize))
+
+	_, err := wtr.Write(bs)
+	if err != nil {
+		return fmt.Errorf("writing header and metadata: %w", err)
+	}
+
+	_, err = wtr.Write(batch.Data)
+	if err != nil {
+		return fmt.Errorf("writing records: %w", err)
+	}
+
+	return nil
+}
+
+func appendBytes(bs []byte, value []byte) []byte {
+	bs = binary.AppendUvarint(bs, uint64(len(value)))
+	return append(bs, value...)
+}
+
+func parseV2(rdr io.Reader, header Header) (*Parser, error) {
+	var metaSize uint32
+	err := binary.Read(rdr, byteOrder, &metaSize)
+	if err != nil {
+		return nil, fmt.Errorf("reading metadata size: %w", err)
+	}
+
+	// NOTE: keys and header values refer to the metadata, so it can only be
+	// reused when the record batch has neither.
+	var meta []byte
+	if header.Flags&(FlagKeys|FlagHeaders) == 0 {
+		buf := getBuf()
+		defer putBuf(buf)
+
+		meta, err = readBuf(rdr, buf, int(metaSize))
+	} else {
+		meta = make([]byte, metaSize)
+		_, err = io.ReadFull(rdr, meta)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading metadata: %w", err)
+	}
+
+	d := metaDecoder{bs: meta}
+
+	recordIndex := make([]uint32, 0, header.NumRecords+1)
+	index := uint64(0)
+	for range header.NumRecords {
+		recordIndex = append(recordIndex, uint32(index))
+		index += d.uvarint()
+		if index > math.MaxUint32 {
+			return nil, fmt.Errorf("reading record sizes: records too large")
+		}
+	}
+	recordIndex = append(recordIndex, uint32(index))
+
+	p := &Parser{
+		recordIndex: recordIndex,
+		dataOffset:  headerBytes + metaSizeBytes + metaSize,
+	}
+
+	if header.Flags&FlagExpires != 0 {
+		p.Expires = make([]int64, header.NumRecords)
+		for i := range p.Expires {
+			p.Expires[i] = d.varint()
+		}
+	}
+
+	if header.Flags&FlagPointers != 0 {
+		p.Pointers = make([]bool, header.NumRecords)
+		for i := range p.Pointers {
+			p.Pointers[i] = d.byte() != 0
+		}
+	}
+
+	if header.Flags&FlagTimestamps != 0 {
+		p.Timestamps = make([]int64, header.NumRecords)
+		for i := range p.Timestamps {
+			p.Timestamps[i] = header.UnixEpochUs + d.varint()
+		}
+	}
+
+	if header.Flags&FlagKeys != 0 {
+		p.Keys = make([][]byte, header.NumRecords)
+		for i := range p.Keys {
+			p.Keys[i] = d.bytes(d.uvarint())
+		}
+	}
+
+	if header.Flags&FlagHeaders != 0 {
+		p.Headers = make([][]RecordHeader, header.NumRecords)
+		for i := range p.Headers {
+			numHeaders := d.uvarint()
+			if numHeaders > uint64(len(d.bs)) {
+				d.fail()
+				break
+			}
+
+			recordHeaders := make([]RecordHeader, numHeaders)
+			for j := range recordHeaders {
+				recordHeaders[j].Key = string(d.bytes(d.uvarint()))
+				recordHeaders[j].Value = d.bytes(d.uvarint())
+			}
+			p.Headers[i] = recordHeaders
+		}
+	}
+
+	if d.err != nil {
+		return nil, fmt.Errorf("reading metadata: %w", d.err)
+	}
+
+	if header.Flags&FlagTraces != 0 {
+		if uint64(header.TracesSize) != uint64(len(d.bs)) {
+			return nil, fmt.Errorf("reading traces: expected %d bytes, %d left", header.TracesSize, len(d.bs))
+		}
+
+		p.Traces, err = parseTraces(d.bs, header.NumRecords)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// ParseStream reads the header and metadata of the record batch in rdr,
+// returning them along with a Batch holding the sizes and metadata of its
+// records, but not their data. rdr is left at the start of the record data.
+//
+// This makes it possible to handle record batches without reading their data
+// into memory. Only v2 record batches are supported, since v1 record batches
+// don't contain the size of their last record.
+func ParseStream(rdr io.Reader) (Header, Batch, error) {
+	header, err := readHeader(rdr)
+	if err != nil {
+		return Header{}, Batch{}, fmt.Errorf("%w: %w", seberr.ErrBadInput, err)
+	}
+
+	if header.MagicBytes != FileFormatMagicBytes {
+		return Header{}, Batch{}, fmt.Errorf("%w: not a record batch", seberr.ErrBadInput)
+	}
+	if header.Version != FileFormatVersionV2 {
+		return Header{}, Batch{}, fmt.Errorf("%w: format version %d not supported, must be %d", seberr.ErrBadInput, header.Version, FileFormatVersionV2)
+	}
+
+	p, err := parseV2(rdr, header)
+	if err != nil {
+		return Header{}, Batch{}, fmt.Errorf("%w: %w", seberr.ErrBadInput, err)
+	}
+
+	sizes := make([]uint32, 0, header.NumRecords)
+	for i := range header.NumRecords {
+		sizes = append(sizes, p.recordIndex[i+1]-p.recordIndex[i])
+	}
+
+	return header, Batch{
+		Sizes:      sizes,
+		Expires:    p.Expires,
+		Pointers:   p.Pointers,
+		Traces:     p.Traces,
+		Timestamps: p.Timestamps,
+		Keys:       p.Keys,
+		Headers:    p.Headers,
+
+		ProducedUnixEpochUs: header.ProducedUnixEpochUs,
+	}, nil
+}
+
+var errMetaTooShort = errors.New("too short")
+
+// metaDecoder decodes values from bs. Once a value can't be decoded, err is
+// set and all following values are zero.
+type metaDecoder struct {
+	bs  []byte
+	err error
+}
+
+func (d *metaDecoder) fail() {
+	d.err = errMetaTooShort
+	d.bs = nil
+}
+
+func (d *metaDecoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.bs)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.bs = d.bs[n:]
+	return v
+}
+
+func (d *metaDecoder) varint() int64 {
+	v, n := binary.Varint(d.bs)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.bs = d.bs[n:]
+	return v
+}
+
+func (d *metaDecoder) byte() byte {
+	if len(d.bs) == 0 {
+		d.fail()
+		return 0
+	}
+	b := d.bs[0]
+	d.bs = d.bs[1:]
+	return b
+}
+
+func (d *metaDecoder) bytes(n uint64) []byte {
+	if n > uint64(len(d.bs)) {
+		d.fail()
+		return nil
+	}
+	bs := d.bs[:n:n]
+	d.bs = d.bs[n:]
+	return bs
+}
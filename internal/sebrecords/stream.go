@@ -0,0 +1,241 @@
+package sebrecords
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// StreamParser reads the records of a record batch in order from an
+// io.Reader, without seeking. Unlike Parser, it doesn't require the record
+// batch to be buffered, so records can be streamed straight from e.g. the
+// body of an S3 GetObject response.
+//
+// Records can only be read once, in order; records that aren't needed must be
+// skipped using Skip.
+type StreamParser struct {
+	Header Header
+
+	// Expires, Pointers, Traces, Timestamps, Keys and Headers hold the
+	// metadata of the records, as documented by Parser.
+	Expires    []int64
+	Pointers   []bool
+	Traces     []Trace
+	Timestamps []int64
+	Keys       [][]byte
+	Headers    [][]RecordHeader
+
+	// recordIndex holds the offset of each record within the record data.
+	// For v1 record batches, it doesn't hold the end of the last record.
+	recordIndex []uint32
+
+	rdr io.Reader
+
+	// next is the index of the record that will be read next.
+	next uint32
+
+	// record is the reader of the record returned by NextRecord; its unread
+	// data must be discarded before reading the following record.
+	record io.Reader
+}
+
+// NewStreamParser reads the header and metadata of the record batch in rdr,
+// leaving rdr at the start of the record data. Record batches of all
+// supported versions can be read; since v1 record batches don't contain the
+// size of their last record, it's read until rdr returns io.EOF.
+//
+// An error wrapping seberr.ErrBadInput is returned if rdr doesn't contain a
+// valid record batch.
+func NewStreamParser(rdr io.Reader) (*StreamParser, error) {
+	header, err := readHeader(rdr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", seberr.ErrBadInput, err)
+	}
+
+	if header.MagicBytes != FileFormatMagicBytes {
+		return nil, fmt.Errorf("%w: not a record batch", seberr.ErrBadInput)
+	}
+
+	var p *Parser
+	switch header.Version {
+	case FileFormatVersionV1:
+		p, err = parseV1(rdr, header)
+	case FileFormatVersionV2:
+		p, err = parseV2(rdr, header)
+	default:
+		return nil, fmt.Errorf("%w: unsupported format version %d", seberr.ErrBadInput, header.Version)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", seberr.ErrBadInput, err)
+	}
+
+	return &StreamParser{
+		Header:      header,
+		Expires:     p.Expires,
+		Pointers:    p.Pointers,
+		Traces:      p.Traces,
+		Timestamps:  p.Timestamps,
+		Keys:        p.Keys,
+		Headers:     p.Headers,
+		recordIndex: p.recordIndex,
+		rdr:         rdr,
+	}, nil
+}
+
+// Next returns the index of the record that will be read next. All records
+// have been read once it's Header.NumRecords.
+func (p *StreamParser) Next() uint32 {
+	return p.next
+}
+
+// RecordSize returns the size of the record at recordIndex. false is returned
+// if the size isn't known, which is the case for the last record of v1 record
+// batches.
+func (p *StreamParser) RecordSize(recordIndex uint32) (uint32, bool) {
+	if recordIndex >= p.Header.NumRecords || int(recordIndex)+1 >= len(p.recordIndex) {
+		return 0, false
+	}
+	return p.recordIndex[recordIndex+1] - p.recordIndex[recordIndex], true
+}
+
+// NextRecord returns a reader of the data of the next record. The reader is
+// valid until the next call to NextRecord, Skip or ReadRecords; data that
+// wasn't read from it by then is discarded. io.EOF is returned once all
+// records have been read.
+func (p *StreamParser) NextRecord() (io.Reader, error) {
+	err := p.discardRecord()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.next >= p.Header.NumRecords {
+		return nil, io.EOF
+	}
+
+	size, ok := p.RecordSize(p.next)
+	if ok {
+		p.record = io.LimitReader(p.rdr, int64(size))
+	} else {
+		p.record = p.rdr
+	}
+	p.next += 1
+
+	return p.record, nil
+}
+
+// Skip discards the next n records, e.g. the records preceding the first
+// record that a consumer requested.
+func (p *StreamParser) Skip(n uint32) error {
+	if n > p.Header.NumRecords-p.next {
+		return fmt.Errorf("%w: can't skip %d records, %d left", seberr.ErrOutOfBounds, n, p.Header.NumRecords-p.next)
+	}
+
+	for range n {
+		_, err := p.NextRecord()
+		if err != nil {
+			return err
+		}
+	}
+
+	return p.discardRecord()
+}
+
+// ReadRecords reads up to maxRecords of the following records into batch,
+// appending their sizes and data. Records are read while they fit within the
+// capacity of batch; seberr.ErrBufferTooSmall is returned if not even the next
+// record fits. io.EOF is returned if all records have been read.
+//
+// NOTE: the size of the last record of v1 record batches is only known once
+// it has been read. If it doesn't fit in batch, seberr.ErrBufferTooSmall is
+// returned and the record is lost.
+func (p *StreamParser) ReadRecords(batch *Batch, maxRecords int) error {
+	err := p.discardRecord()
+	if err != nil {
+		return err
+	}
+
+	if p.next >= p.Header.NumRecords {
+		return io.EOF
+	}
+
+	read := 0
+	for ; read < maxRecords && p.next < p.Header.NumRecords; read++ {
+		if len(batch.Sizes) == cap(batch.Sizes) {
+			break
+		}
+
+		size, ok := p.RecordSize(p.next)
+		if ok && int(size) > cap(batch.Data)-len(batch.Data) {
+			break
+		}
+
+		rdr, err := p.NextRecord()
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			size, err = readToEOF(rdr, batch)
+			if err != nil {
+				return fmt.Errorf("reading record %d: %w", p.next-1, err)
+			}
+			batch.Sizes = append(batch.Sizes, size)
+			continue
+		}
+
+		start := len(batch.Data)
+		_, err = io.ReadFull(rdr, batch.Data[start:start+int(size)])
+		if err != nil {
+			return fmt.Errorf("reading record %d: %w", p.next-1, err)
+		}
+		batch.Data = batch.Data[:start+int(size)]
+		batch.Sizes = append(batch.Sizes, size)
+	}
+
+	if read == 0 && maxRecords > 0 {
+		return fmt.Errorf("%w: record %d doesn't fit in buffer", seberr.ErrBufferTooSmall, p.next)
+	}
+
+	return nil
+}
+
+// discardRecord discards the unread data of the record returned by
+// NextRecord, if any.
+func (p *StreamParser) discardRecord() error {
+	if p.record == nil {
+		return nil
+	}
+
+	_, err := io.Copy(io.Discard, p.record)
+	p.record = nil
+	if err != nil {
+		return fmt.Errorf("discarding record %d: %w", p.next-1, err)
+	}
+	return nil
+}
+
+// readToEOF reads rdr into the remaining capacity of batch.Data, returning
+// the number of bytes read. seberr.ErrBufferTooSmall is returned if rdr has
+// more data than fits.
+func readToEOF(rdr io.Reader, batch *Batch) (uint32, error) {
+	start := len(batch.Data)
+	buf := batch.Data[start:cap(batch.Data)]
+
+	n, err := io.ReadFull(rdr, buf)
+	switch err {
+	case io.EOF, io.ErrUnexpectedEOF:
+	case nil:
+		// the buffer is full; the record only fits if rdr has no more data
+		var b [1]byte
+		m, _ := io.ReadFull(rdr, b[:])
+		if m > 0 {
+			return 0, fmt.Errorf("%w: not enough bytes left in buffer", seberr.ErrBufferTooSmall)
+		}
+	default:
+		return 0, err
+	}
+
+	batch.Data = batch.Data[:start+n]
+	return uint32(n), nil
+}
@@ -0,0 +1,139 @@
+package sebrecords_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestStreamParser verifies that StreamParser reads the records of record
+// batches of all supported versions in order from a reader that can't seek,
+// and that records can be skipped and partially read.
+func TestStreamParser(t *testing.T) {
+	batch := tester.MakeRandomRecordBatch(10)
+	batch.Expires = make([]int64, batch.Len())
+	batch.Expires[3] = 42
+	expected := batch.IndividualRecords()
+
+	for _, version := range []int16{sebrecords.FileFormatVersionV1, sebrecords.FileFormatVersionV2} {
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			buf := bytes.NewBuffer(nil)
+			err := sebrecords.WriteVersion(buf, batch, time.Now().UnixMicro(), version)
+			require.NoError(t, err)
+
+			// Act
+			p, err := sebrecords.NewStreamParser(streamReader{buf})
+
+			// Assert
+			require.NoError(t, err)
+			require.Equal(t, version, p.Header.Version)
+			require.Equal(t, batch.Expires, p.Expires)
+
+			err = p.Skip(2)
+			require.NoError(t, err)
+			require.Equal(t, uint32(2), p.Next())
+
+			// only part of the record is read; the rest must be discarded
+			rdr, err := p.NextRecord()
+			require.NoError(t, err)
+			bs := make([]byte, 1)
+			_, err = io.ReadFull(rdr, bs)
+			require.NoError(t, err)
+			require.Equal(t, expected[2][:1], bs)
+
+			rdr, err = p.NextRecord()
+			require.NoError(t, err)
+			bs, err = io.ReadAll(rdr)
+			require.NoError(t, err)
+			require.Equal(t, expected[3], bs)
+
+			gotBatch := tester.NewBatch(batch.Len(), 4096)
+			err = p.ReadRecords(&gotBatch, 3)
+			require.NoError(t, err)
+			require.Equal(t, expected[4:7], gotBatch.IndividualRecords())
+
+			// the size of the last record of v1 record batches is unknown
+			// until it's read
+			err = p.ReadRecords(&gotBatch, 10)
+			require.NoError(t, err)
+			require.Equal(t, expected[4:], gotBatch.IndividualRecords())
+
+			err = p.ReadRecords(&gotBatch, 10)
+			require.ErrorIs(t, err, io.EOF)
+
+			_, err = p.NextRecord()
+			require.ErrorIs(t, err, io.EOF)
+		})
+	}
+}
+
+// TestStreamParserBufferTooSmall verifies that ReadRecords() reads the records
+// that fit in the given batch, and returns seberr.ErrBufferTooSmall if not even
+// the next record fits.
+func TestStreamParserBufferTooSmall(t *testing.T) {
+	batch := tester.MakeRandomRecordBatch(5)
+	expected := batch.IndividualRecords()
+
+	for _, version := range []int16{sebrecords.FileFormatVersionV1, sebrecords.FileFormatVersionV2} {
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			buf := bytes.NewBuffer(nil)
+			err := sebrecords.WriteVersion(buf, batch, 0, version)
+			require.NoError(t, err)
+
+			p, err := sebrecords.NewStreamParser(streamReader{buf})
+			require.NoError(t, err)
+
+			// Act
+			gotBatch := tester.NewBatch(2, 4096)
+			err = p.ReadRecords(&gotBatch, 5)
+
+			// Assert
+			require.NoError(t, err)
+			require.Equal(t, expected[:2], gotBatch.IndividualRecords())
+
+			// Act
+			err = p.ReadRecords(&gotBatch, 5)
+
+			// Assert
+			require.ErrorIs(t, err, seberr.ErrBufferTooSmall)
+			require.Equal(t, uint32(2), p.Next())
+		})
+	}
+}
+
+// TestStreamParserErrors verifies that NewStreamParser() returns
+// seberr.ErrBadInput for data that isn't a record batch, and that Skip()
+// returns seberr.ErrOutOfBounds when skipping beyond the last record.
+func TestStreamParserErrors(t *testing.T) {
+	_, err := sebrecords.NewStreamParser(streamReader{bytes.NewReader([]byte("not a record batch, but long enough"))})
+	require.ErrorIs(t, err, seberr.ErrBadInput)
+
+	_, err = sebrecords.NewStreamParser(streamReader{bytes.NewReader(nil)})
+	require.ErrorIs(t, err, seberr.ErrBadInput)
+
+	buf := bytes.NewBuffer(nil)
+	err = sebrecords.Write(buf, tester.MakeRandomRecordBatch(3))
+	require.NoError(t, err)
+
+	p, err := sebrecords.NewStreamParser(streamReader{buf})
+	require.NoError(t, err)
+
+	// Act
+	err = p.Skip(4)
+
+	// Assert
+	require.ErrorIs(t, err, seberr.ErrOutOfBounds)
+}
+
+// streamReader hides all methods of the wrapped io.Reader but Read, e.g.
+// Seek.
+type streamReader struct {
+	io.Reader
+}
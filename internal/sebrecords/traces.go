@@ -0,0 +1,88 @@
+package sebrecords
+
+import (
+	"fmt"
+
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// Trace attributes NumRecords records, starting at record index Start, to the
+// trace ID of the request that produced them.
+type Trace struct {
+	ID         string
+	Start      uint32
+	NumRecords uint32
+}
+
+// ShiftTraces returns traces with delta added to their start, e.g. for combining the
+// traces of multiple batches.
+func ShiftTraces(traces []Trace, delta uint32) []Trace {
+	shifted := make([]Trace, len(traces))
+	for i, trace := range traces {
+		trace.Start += delta
+		shifted[i] = trace
+	}
+	return shifted
+}
+
+// ClampTraces returns the parts of traces that cover records with index lower
+// than numRecords.
+func ClampTraces(traces []Trace, numRecords uint32) []Trace {
+	clamped := make([]Trace, 0, len(traces))
+	for _, trace := range traces {
+		if trace.Start >= numRecords {
+			continue
+		}
+		trace.NumRecords = min(trace.NumRecords, numRecords-trace.Start)
+		clamped = append(clamped, trace)
+	}
+	return clamped
+}
+
+// appendTraces appends the encoding of traces to bs. Traces must cover records
+// within numRecords.
+func appendTraces(bs []byte, traces []Trace, numRecords int) ([]byte, error) {
+	for _, trace := range traces {
+		if len(trace.ID) == 0 || len(trace.ID) > MaxTraceIDLen {
+			return nil, fmt.Errorf("%w: trace ID must be 1-%d bytes, was %d", seberr.ErrBadInput, MaxTraceIDLen, len(trace.ID))
+		}
+		if uint64(trace.Start)+uint64(trace.NumRecords) > uint64(numRecords) {
+			return nil, fmt.Errorf("%w: trace covers records [%d;%d) of %d", seberr.ErrBadInput, trace.Start, uint64(trace.Start)+uint64(trace.NumRecords), numRecords)
+		}
+
+		bs = byteOrder.AppendUint32(bs, trace.Start)
+		bs = byteOrder.AppendUint32(bs, trace.NumRecords)
+		bs = append(bs, uint8(len(trace.ID)))
+		bs = append(bs, trace.ID...)
+	}
+	return bs, nil
+}
+
+// parseTraces parses traces encoded by appendTraces.
+func parseTraces(bs []byte, numRecords uint32) ([]Trace, error) {
+	traces := []Trace{}
+	for len(bs) > 0 {
+		if len(bs) < traceSize {
+			return nil, fmt.Errorf("reading traces: %d bytes too short", traceSize-len(bs))
+		}
+
+		trace := Trace{
+			Start:      byteOrder.Uint32(bs),
+			NumRecords: byteOrder.Uint32(bs[4:]),
+		}
+		idLen := int(bs[8])
+		bs = bs[traceSize:]
+
+		if len(bs) < idLen {
+			return nil, fmt.Errorf("reading trace ID: %d bytes too short", idLen-len(bs))
+		}
+		trace.ID = string(bs[:idLen])
+		bs = bs[idLen:]
+
+		if uint64(trace.Start)+uint64(trace.NumRecords) > uint64(numRecords) {
+			return nil, fmt.Errorf("trace covers records [%d;%d) of %d", trace.Start, uint64(trace.Start)+uint64(trace.NumRecords), numRecords)
+		}
+		traces = append(traces, trace)
+	}
+	return traces, nil
+}
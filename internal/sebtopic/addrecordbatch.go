@@ -0,0 +1,241 @@
+package sebtopic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/micvbang/go-helpy/sizey"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// AddRecordBatch adds the records of the serialized v2 record batch in rdr,
+// returning their offsets like AddRecords. The record data is streamed from
+// rdr to backing storage without being read into memory, making it possible
+// to add record batches that are too large to keep in memory.
+//
+// The commit time of the record batch is set to the current time. Unlike
+// AddRecords, large records are not offloaded, since that would require
+// reading them into memory.
+//
+// For topics using write-behind, AddRecordBatch waits for queued record
+// batches to be written before streaming to backing storage.
+//
+// NOTE: AddRecordBatch is NOT thread safe, and must not be called
+// concurrently with itself or AddRecords.
+func (s *Topic) AddRecordBatch(ctx context.Context, rdr io.Reader) ([]uint64, error) {
+	err := s.checkWritable()
+	if err != nil {
+		return nil, err
+	}
+
+	s.sealMu.RLock()
+	defer s.sealMu.RUnlock()
+
+	err = s.checkSealed()
+	if err != nil {
+		return nil, err
+	}
+
+	// NOTE: the record batch is streamed directly to backing storage, so
+	// record batches waiting to be written behind must be written first in
+	// order to keep record batches in backing storage contiguous.
+	err = s.FlushWrites(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, metaBatch, err := sebrecords.ParseStream(rdr)
+	if err != nil {
+		return nil, err
+	}
+	if metaBatch.Len() == 0 {
+		return nil, fmt.Errorf("%w: record batch has no records", seberr.ErrBadInput)
+	}
+
+	dataSize := int64(0)
+	for _, size := range metaBatch.Sizes {
+		dataSize += int64(size)
+	}
+
+	recordBatchID := s.nextOffset.Load()
+
+	// NOTE: timestamps are stored relative to the commit time, so the
+	// metadata is written anew with the new commit time.
+	unixEpochUs, err := s.commitTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	log := s.log.WithField(logger.FieldBatchID, recordBatchID)
+
+	// NOTE: parsing the metadata may take a while, during which the lease may
+	// have been lost.
+	err = s.checkLease()
+	if err != nil {
+		return nil, err
+	}
+	rbPath := s.newRecordBatchPath(recordBatchID)
+
+	t0 := time.Now()
+	err = s.streamRecordBatch(ctx, rbPath, metaBatch, unixEpochUs, rdr, dataSize)
+	if err != nil {
+		s.epochs.removeFrom(recordBatchID)
+		return nil, err
+	}
+
+	log.Infof("streamed %d records (%s bytes) to %s (%s)", metaBatch.Len(), sizey.FormatBytes(dataSize), rbPath, time.Since(t0))
+
+	nextOffset := recordBatchID + uint64(metaBatch.Len())
+	offsets := make([]uint64, 0, metaBatch.Len())
+	for i := recordBatchID; i < nextOffset; i++ {
+		offsets = append(offsets, i)
+	}
+
+	s.publishRecordBatch(ctx, recordBatchID, nextOffset)
+	s.OffsetCond.Broadcast(nextOffset - 1)
+
+	return offsets, nil
+}
+
+// streamRecordBatch writes the metadata of metaBatch followed by dataSize
+// bytes of record data from rdr to backing storage at recordBatchPath. The
+// record batch is cached while it's written, unless caching fails.
+func (s *Topic) streamRecordBatch(ctx context.Context, recordBatchPath string, metaBatch sebrecords.Batch, unixEpochUs int64, rdr io.Reader, dataSize int64) error {
+	storageWriter, err := s.backingStorage.Writer(ctx, recordBatchPath)
+	if err != nil {
+		return fmt.Errorf("opening writer '%s': %w", recordBatchPath, err)
+	}
+	backingWriter := &countingWriteCloser{WriteCloser: storageWriter}
+
+	var w io.WriteCloser = backingWriter
+	if s.compression != nil {
+		w, err = s.compression.NewWriter(backingWriter)
+		if err != nil {
+			backingWriter.Close()
+			return fmt.Errorf("creating compression writer: %w", err)
+		}
+	}
+
+	var cacheWtr *bestEffortWriter
+	if s.cache != nil {
+		wtr, err := s.cache.Writer(ctx, recordBatchPath)
+		if err != nil {
+			s.log.Errorf("creating cache writer (%s): %s", recordBatchPath, err)
+		} else {
+			cacheWtr = &bestEffortWriter{w: wtr}
+			w = &teeWriteCloser{WriteCloser: w, tee: cacheWtr}
+		}
+	}
+
+	err = s.writeStream(w, metaBatch, unixEpochUs, rdr, dataSize)
+	if err == nil && s.compression != nil {
+		err = w.Close()
+		if err != nil {
+			err = fmt.Errorf("closing compression writer: %w", err)
+		}
+	}
+	if err == nil {
+		// once Close() returns, the data has been committed and can be
+		// retrieved by ReadRecords.
+		err = backingWriter.Close()
+		if err != nil {
+			err = fmt.Errorf("closing backing writer: %w", err)
+		}
+	}
+
+	if cacheWtr != nil {
+		s.closeCacheWriter(recordBatchPath, cacheWtr, err == nil)
+	}
+
+	if err != nil {
+		// NOTE: closing the backing writer after a failed write may commit a
+		// partial record batch, so it's removed again.
+		backingWriter.Close()
+		deleteErr := s.backingStorage.Delete(recordBatchPath)
+		if deleteErr != nil && !errors.Is(deleteErr, seberr.ErrNotInStorage) {
+			s.log.Errorf("deleting partial record batch '%s': %s", recordBatchPath, deleteErr)
+		}
+		return err
+	}
+	s.usage.set(recordBatchPath, backingWriter.n)
+
+	return nil
+}
+
+// writeStream writes the metadata of metaBatch and dataSize bytes from rdr to
+// w. rdr must contain exactly dataSize bytes.
+func (s *Topic) writeStream(w io.Writer, metaBatch sebrecords.Batch, unixEpochUs int64, rdr io.Reader, dataSize int64) error {
+	err := sebrecords.WriteVersion(w, metaBatch, unixEpochUs, sebrecords.FileFormatVersionV2)
+	if err != nil {
+		return fmt.Errorf("writing record batch metadata: %w", err)
+	}
+
+	n, err := io.CopyN(w, rdr, dataSize)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("%w: record data is %d bytes, expected %d", seberr.ErrBadInput, n, dataSize)
+		}
+		return fmt.Errorf("writing record data: %w", err)
+	}
+
+	// NOTE: trailing data would be silently dropped, which likely means that
+	// the record batch wasn't serialized as intended.
+	_, err = rdr.Read(make([]byte, 1))
+	if err != io.EOF {
+		return fmt.Errorf("%w: record data is longer than the %d bytes given by record sizes", seberr.ErrBadInput, dataSize)
+	}
+
+	return nil
+}
+
+// closeCacheWriter closes cacheWtr, removing recordBatchPath from the cache
+// if the record batch or the cached copy of it wasn't written successfully.
+func (s *Topic) closeCacheWriter(recordBatchPath string, cacheWtr *bestEffortWriter, written bool) {
+	err := cacheWtr.w.Close()
+	if written && cacheWtr.err == nil && err == nil {
+		return
+	}
+
+	if cacheWtr.err != nil {
+		s.log.Errorf("writing to cache (%s): %s", recordBatchPath, cacheWtr.err)
+	}
+	removeErr := s.cache.Remove(recordBatchPath)
+	if removeErr != nil {
+		s.log.Errorf("removing '%s' from cache: %s", recordBatchPath, removeErr)
+	}
+}
+
+// bestEffortWriter writes to w until a write fails, after which writes are
+// discarded. The error of the failed write is kept in err.
+type bestEffortWriter struct {
+	w   io.WriteCloser
+	err error
+}
+
+func (bw *bestEffortWriter) Write(p []byte) (int, error) {
+	if bw.err == nil {
+		_, bw.err = bw.w.Write(p)
+	}
+	return len(p), nil
+}
+
+// teeWriteCloser writes to both the embedded io.WriteCloser and tee. Only
+// the embedded io.WriteCloser is closed.
+type teeWriteCloser struct {
+	io.WriteCloser
+	tee io.Writer
+}
+
+func (t *teeWriteCloser) Write(p []byte) (int, error) {
+	n, err := t.WriteCloser.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	t.tee.Write(p[:n])
+	return n, nil
+}
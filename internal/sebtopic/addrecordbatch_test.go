@@ -0,0 +1,133 @@
+package sebtopic_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+func serializeV2(t *testing.T, batch sebrecords.Batch) []byte {
+	buf := bytes.NewBuffer(nil)
+	err := sebrecords.WriteVersion(buf, batch, sebrecords.UnixEpochUs(), sebrecords.FileFormatVersionV2)
+	require.NoError(t, err)
+	return buf.Bytes()
+}
+
+// TestAddRecordBatch verifies that records added by streaming a serialized
+// record batch can be read back, both with and without compression, and that
+// they're given offsets following those of records added using AddRecords.
+func TestAddRecordBatch(t *testing.T) {
+	tests := map[string]struct {
+		compression sebtopic.Compress
+	}{
+		"no compression": {compression: nil},
+		"gzip":           {compression: sebtopic.Gzip{}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tester.TestTopicStorageAndCache(t, func(t *testing.T, backingStorage sebtopic.Storage, cache *sebcache.Cache) {
+				s, err := sebtopic.New(log, backingStorage, "mytopic", cache, sebtopic.WithCompress(test.compression))
+				require.NoError(t, err)
+
+				batch1 := tester.MakeRandomRecordBatch(3)
+				_, err = s.AddRecords(batch1)
+				require.NoError(t, err)
+
+				batch2 := tester.MakeRandomRecordBatch(5)
+				batch2.Keys = make([][]byte, batch2.Len())
+				for i := range batch2.Keys {
+					batch2.Keys[i] = tester.RandomBytes(t, 8)
+				}
+
+				// Act
+				offsets, err := s.AddRecordBatch(context.Background(), bytes.NewReader(serializeV2(t, batch2)))
+
+				// Assert
+				require.NoError(t, err)
+				tester.RequireOffsets(t, 3, 8, offsets)
+				require.Equal(t, uint64(8), s.NextOffset())
+
+				gotBatch := tester.NewBatch(batch2.Len(), 4096)
+				err = s.ReadRecords(context.Background(), &gotBatch, offsets[0], batch2.Len(), 0)
+				require.NoError(t, err)
+				require.Equal(t, batch2.Data, gotBatch.Data)
+				require.Equal(t, batch2.Sizes, gotBatch.Sizes)
+
+				// keys are kept in the stored record batch
+				if test.compression == nil {
+					rdr, err := backingStorage.Reader(context.Background(), sebtopic.RecordBatchKey("mytopic", 3))
+					require.NoError(t, err)
+
+					rb, err := sebrecords.Parse(tester.ReadToMemory(t, rdr))
+					require.NoError(t, err)
+					require.Equal(t, batch2.Keys, rb.Keys)
+				}
+
+				// records are readable after the topic is reloaded from backing
+				// storage, i.e. without the in-memory state of s.
+				s2, err := sebtopic.New(log, backingStorage, "mytopic", cache, sebtopic.WithCompress(test.compression))
+				require.NoError(t, err)
+				require.Equal(t, uint64(8), s2.NextOffset())
+			})
+		})
+	}
+}
+
+// TestAddRecordBatchBadInput verifies that ErrBadInput is returned when the
+// given record batch can't be streamed, and that no records are added.
+func TestAddRecordBatchBadInput(t *testing.T) {
+	batch := tester.MakeRandomRecordBatch(5)
+	serialized := serializeV2(t, batch)
+
+	v1 := bytes.NewBuffer(nil)
+	err := sebrecords.WriteVersion(v1, batch, sebrecords.UnixEpochUs(), sebrecords.FileFormatVersionV1)
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		input []byte
+	}{
+		"empty":          {input: nil},
+		"v1":             {input: v1.Bytes()},
+		"truncated data": {input: serialized[:len(serialized)-1]},
+		"trailing data":  {input: append(bytes.Clone(serialized), 1)},
+		"no records":     {input: serializeV2(t, sebrecords.Batch{})},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tester.TestTopicStorageAndCache(t, func(t *testing.T, backingStorage sebtopic.Storage, cache *sebcache.Cache) {
+				s, err := sebtopic.New(log, backingStorage, "mytopic", cache, sebtopic.WithCompress(nil))
+				require.NoError(t, err)
+
+				// Act
+				offsets, err := s.AddRecordBatch(context.Background(), bytes.NewReader(test.input))
+
+				// Assert
+				require.ErrorIs(t, err, seberr.ErrBadInput)
+				require.Empty(t, offsets)
+				require.Equal(t, uint64(0), s.NextOffset())
+
+				// no partial record batch was left in backing storage
+				s2, err := sebtopic.New(log, backingStorage, "mytopic", cache, sebtopic.WithCompress(nil))
+				require.NoError(t, err)
+				require.Equal(t, uint64(0), s2.NextOffset())
+
+				_, err = s.AddRecords(batch)
+				require.NoError(t, err)
+
+				gotBatch := tester.NewBatch(batch.Len(), 4096)
+				err = s.ReadRecords(context.Background(), &gotBatch, 0, batch.Len(), 0)
+				require.NoError(t, err)
+				require.Equal(t, batch.Data, gotBatch.Data)
+			})
+		})
+	}
+}
@@ -0,0 +1,333 @@
+package sebtopic
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/micvbang/go-helpy/slicey"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// Archives hold records exported from a topic, such that they can be imported
+// into another topic, possibly of another deployment. An archive starts with
+// archiveMagicBytes and the archive format version, followed by a sequence of
+// entries, each holding a record batch:
+//
+//	first offset (uint64) | committed at (int64, unix epoch us) | size (uint32) | record batch (size bytes)
+//
+// Record batches are uncompressed and use v2 of the record batch file format.
+// They don't contain pointers to large records; large records are stored
+// inline.
+var archiveMagicBytes = [4]byte{'s', 'e', 'b', 'a'}
+
+const (
+	archiveVersion         = 1
+	archiveHeaderBytes     = 4 + 2
+	archiveEntryHeaderSize = 8 + 8 + 4
+)
+
+var archiveByteOrder = binary.LittleEndian
+
+// ArchivedBatch is a record batch read from an archive.
+type ArchivedBatch struct {
+	// FirstOffset is the offset that the first record in Batch had in the
+	// topic it was exported from.
+	FirstOffset uint64
+
+	// CommittedAt is the time at which the record batch was committed to the
+	// topic it was exported from.
+	CommittedAt time.Time
+
+	Batch sebrecords.Batch
+}
+
+// ArchiveWriter writes an archive to an io.Writer.
+type ArchiveWriter struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+// NewArchiveWriter writes the header of an archive to w and returns an
+// ArchiveWriter that writes record batches to it.
+func NewArchiveWriter(w io.Writer) (*ArchiveWriter, error) {
+	header := make([]byte, 0, archiveHeaderBytes)
+	header = append(header, archiveMagicBytes[:]...)
+	header = archiveByteOrder.AppendUint16(header, archiveVersion)
+	_, err := w.Write(header)
+	if err != nil {
+		return nil, fmt.Errorf("writing archive header: %w", err)
+	}
+
+	return &ArchiveWriter{w: w}, nil
+}
+
+// Write adds batch to the archive. firstOffset is the offset of the first
+// record of batch and committedAt the time it was committed, in the topic that
+// it's exported from. batch must not contain pointers to large records.
+func (a *ArchiveWriter) Write(firstOffset uint64, committedAt time.Time, batch sebrecords.Batch) error {
+	if len(batch.Pointers) > 0 {
+		return fmt.Errorf("%w: archived record batches can't contain pointers", seberr.ErrBadInput)
+	}
+
+	a.buf.Reset()
+	err := sebrecords.WriteVersion(&a.buf, batch, committedAt.UnixMicro(), sebrecords.FileFormatVersionV2)
+	if err != nil {
+		return fmt.Errorf("encoding record batch: %w", err)
+	}
+
+	var entryHeader [archiveEntryHeaderSize]byte
+	archiveByteOrder.PutUint64(entryHeader[0:], firstOffset)
+	archiveByteOrder.PutUint64(entryHeader[8:], uint64(committedAt.UnixMicro()))
+	archiveByteOrder.PutUint32(entryHeader[16:], uint32(a.buf.Len()))
+
+	_, err = a.w.Write(entryHeader[:])
+	if err != nil {
+		return fmt.Errorf("writing archive entry header: %w", err)
+	}
+
+	_, err = a.w.Write(a.buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("writing archive entry: %w", err)
+	}
+
+	return nil
+}
+
+// ArchiveReader reads the record batches of an archive written by
+// ArchiveWriter.
+type ArchiveReader struct {
+	r io.Reader
+}
+
+// NewArchiveReader reads the header of the archive in r, returning
+// seberr.ErrBadInput if r doesn't hold a supported archive.
+func NewArchiveReader(r io.Reader) (*ArchiveReader, error) {
+	var header [archiveHeaderBytes]byte
+	_, err := io.ReadFull(r, header[:])
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading archive header: %w", seberr.ErrBadInput, err)
+	}
+
+	if !bytes.Equal(header[:4], archiveMagicBytes[:]) {
+		return nil, fmt.Errorf("%w: not an archive", seberr.ErrBadInput)
+	}
+
+	version := archiveByteOrder.Uint16(header[4:])
+	if version != archiveVersion {
+		return nil, fmt.Errorf("%w: archive version %d not supported, must be %d", seberr.ErrBadInput, version, archiveVersion)
+	}
+
+	return &ArchiveReader{r: r}, nil
+}
+
+// Next returns the next record batch of the archive. io.EOF is returned once
+// all record batches have been read.
+func (a *ArchiveReader) Next() (ArchivedBatch, error) {
+	var entryHeader [archiveEntryHeaderSize]byte
+	_, err := io.ReadFull(a.r, entryHeader[:])
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return ArchivedBatch{}, io.EOF
+		}
+		return ArchivedBatch{}, fmt.Errorf("%w: reading archive entry header: %w", seberr.ErrBadInput, err)
+	}
+
+	firstOffset := archiveByteOrder.Uint64(entryHeader[0:])
+	committedAtUs := int64(archiveByteOrder.Uint64(entryHeader[8:]))
+	size := archiveByteOrder.Uint32(entryHeader[16:])
+
+	bs := make([]byte, size)
+	_, err = io.ReadFull(a.r, bs)
+	if err != nil {
+		return ArchivedBatch{}, fmt.Errorf("%w: reading archive entry: %w", seberr.ErrBadInput, err)
+	}
+
+	rdr := bytes.NewReader(bs)
+	_, batch, err := sebrecords.ParseStream(rdr)
+	if err != nil {
+		return ArchivedBatch{}, fmt.Errorf("parsing archived record batch: %w", err)
+	}
+
+	batch.Data = bs[len(bs)-rdr.Len():]
+	if len(batch.Pointers) > 0 {
+		return ArchivedBatch{}, fmt.Errorf("%w: archived record batch contains pointers", seberr.ErrBadInput)
+	}
+
+	return ArchivedBatch{
+		FirstOffset: firstOffset,
+		CommittedAt: time.UnixMicro(committedAtUs),
+		Batch:       batch,
+	}, nil
+}
+
+// ExportResult describes the records exported by Export.
+type ExportResult struct {
+	RecordBatches int
+	Records       int
+
+	// Expired is the number of records that were not exported because they
+	// had expired.
+	Expired int
+}
+
+// Export writes the records at offsets [startOffset;endOffset) to w as an
+// archive that can be read using NewArchiveReader. endOffset defaults to the
+// topic's next offset if 0, and is lowered to it if it's higher.
+//
+// Records keep their expiry times, timestamps, keys and headers, and the
+// record batches they're in keep their produced time. Large records are read
+// and stored inline. Records that have expired are not exported.
+func (s *Topic) Export(ctx context.Context, w io.Writer, startOffset uint64, endOffset uint64) (ExportResult, error) {
+	nextOffset := s.nextOffset.Load()
+	if endOffset == 0 || endOffset > nextOffset {
+		endOffset = nextOffset
+	}
+	if startOffset > endOffset {
+		return ExportResult{}, fmt.Errorf("start offset %d beyond end offset %d: %w", startOffset, endOffset, seberr.ErrOutOfBounds)
+	}
+
+	err := s.loadRecordBatchOffsetsFor(ctx, startOffset)
+	if err != nil {
+		return ExportResult{}, fmt.Errorf("loading record batch offsets: %w", err)
+	}
+
+	aw, err := NewArchiveWriter(w)
+	if err != nil {
+		return ExportResult{}, err
+	}
+
+	s.mu.Lock()
+	recordBatchOffsets := slices.Clone(s.recordBatchOffsets)
+	s.mu.Unlock()
+
+	ctx = sebcache.WithBudget(ctx, sebcache.BudgetMaintenance)
+	nowUs := time.Now().UnixMicro()
+
+	result := ExportResult{}
+	for i, batchOffset := range recordBatchOffsets {
+		if batchOffset >= endOffset {
+			break
+		}
+		if i+1 < len(recordBatchOffsets) && recordBatchOffsets[i+1] <= startOffset {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		default:
+		}
+
+		rb, err := s.parseRecordBatch(ctx, batchOffset)
+		if err != nil {
+			return result, fmt.Errorf("parsing record batch: %w", err)
+		}
+
+		// NOTE: while record batches are being merged, a record batch may
+		// overlap the record batches following it. Records are read from the
+		// newest record batch that contains them.
+		numRecords := rb.Header.NumRecords
+		if i+1 < len(recordBatchOffsets) {
+			numRecords = min(numRecords, uint32(recordBatchOffsets[i+1]-batchOffset))
+		}
+
+		first := uint32(0)
+		if startOffset > batchOffset {
+			first = uint32(startOffset - batchOffset)
+		}
+		last := numRecords
+		if batchOffset+uint64(numRecords) > endOffset {
+			last = uint32(endOffset - batchOffset)
+		}
+
+		batch, expired, err := s.exportRecords(ctx, rb, first, last, nowUs)
+		rb.Close()
+		if err != nil {
+			return result, fmt.Errorf("record batch '%s': %w", s.recordBatchPath(batchOffset), err)
+		}
+		result.Expired += expired
+
+		if batch.Len() == 0 {
+			continue
+		}
+
+		err = aw.Write(batchOffset+uint64(first), time.UnixMicro(rb.Header.UnixEpochUs), batch)
+		if err != nil {
+			return result, err
+		}
+		result.RecordBatches += 1
+		result.Records += batch.Len()
+	}
+
+	return result, nil
+}
+
+// exportRecords returns the unexpired records [first;last) of rb, along with
+// their metadata, and the number of records that had expired.
+func (s *Topic) exportRecords(ctx context.Context, rb *sebrecords.Parser, first uint32, last uint32, nowUs int64) (sebrecords.Batch, int, error) {
+	batch := sebrecords.Batch{
+		Sizes: make([]uint32, 0, last-first),
+
+		ProducedUnixEpochUs: rb.Header.ProducedUnixEpochUs,
+	}
+
+	expired := 0
+	recordIndex := first
+	for recordIndex < last {
+		if rb.Expired(recordIndex, nowUs) {
+			expired += 1
+			recordIndex += 1
+			continue
+		}
+
+		// runEnd is the end of the run of records that can be read from rb
+		// with a single read.
+		runEnd := recordIndex + 1
+		if rb.IsPointer(recordIndex) {
+			size, key, err := readPointer(rb, recordIndex)
+			if err != nil {
+				return sebrecords.Batch{}, 0, err
+			}
+
+			batch.Data = slices.Grow(batch.Data, int(size))
+			err = s.readLargeRecord(ctx, &batch, key, size)
+			if err != nil {
+				return sebrecords.Batch{}, 0, err
+			}
+		} else {
+			for runEnd < last && !rb.Expired(runEnd, nowUs) && !rb.IsPointer(runEnd) {
+				runEnd += 1
+			}
+
+			batch.Data = slices.Grow(batch.Data, int(slicey.Sum(rb.RecordSizes[recordIndex:runEnd])))
+			err := rb.Records(&batch, recordIndex, runEnd)
+			if err != nil {
+				return sebrecords.Batch{}, 0, err
+			}
+		}
+
+		if rb.Expires != nil {
+			batch.Expires = append(batch.Expires, rb.Expires[recordIndex:runEnd]...)
+		}
+		if rb.Timestamps != nil {
+			batch.Timestamps = append(batch.Timestamps, rb.Timestamps[recordIndex:runEnd]...)
+		}
+		if rb.Keys != nil {
+			batch.Keys = append(batch.Keys, rb.Keys[recordIndex:runEnd]...)
+		}
+		if rb.Headers != nil {
+			batch.Headers = append(batch.Headers, rb.Headers[recordIndex:runEnd]...)
+		}
+		recordIndex = runEnd
+	}
+
+	return batch, expired, nil
+}
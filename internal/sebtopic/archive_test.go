@@ -0,0 +1,158 @@
+package sebtopic_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTopicExport verifies that Export() writes the unexpired records of the
+// requested offsets to an archive, including large records and the records'
+// metadata.
+func TestTopicExport(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		topic, err := sebtopic.New(log, storage, "topic", cache, sebtopic.WithLargeRecordThreshold(largeRecordThreshold))
+		require.NoError(t, err)
+
+		plainBatch := tester.MakeRandomRecordBatch(2)
+		_, err = topic.AddRecords(plainBatch)
+		require.NoError(t, err)
+
+		expired := time.Now().Add(-time.Hour).UnixMicro()
+		batch := tester.RecordsToBatch([][]byte{
+			tester.RandomBytes(t, 10),
+			tester.RandomBytes(t, 2*largeRecordThreshold),
+			tester.RandomBytes(t, 20),
+		})
+		batch.Expires = []int64{0, 0, expired}
+		batch.Timestamps = []int64{1, 2, 3}
+		batch.Keys = [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+		batch.Headers = [][]sebrecords.RecordHeader{{{Key: "type", Value: []byte("created")}}, {}, {}}
+		_, err = topic.AddRecords(batch)
+		require.NoError(t, err)
+
+		buf := bytes.Buffer{}
+
+		// Act
+		result, err := topic.Export(context.Background(), &buf, 1, 0)
+		require.NoError(t, err)
+
+		// Assert
+		require.Equal(t, sebtopic.ExportResult{RecordBatches: 2, Records: 3, Expired: 1}, result)
+
+		ar, err := sebtopic.NewArchiveReader(&buf)
+		require.NoError(t, err)
+
+		archived, err := ar.Next()
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), archived.FirstOffset)
+		require.Equal(t, plainBatch.IndividualRecords()[1:], archived.Batch.IndividualRecords())
+
+		archived, err = ar.Next()
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), archived.FirstOffset)
+		require.Equal(t, batch.IndividualRecords()[:2], archived.Batch.IndividualRecords())
+		require.Equal(t, []int64{0, 0}, archived.Batch.Expires)
+		require.Equal(t, batch.Timestamps[:2], archived.Batch.Timestamps)
+		require.Equal(t, batch.Keys[:2], archived.Batch.Keys)
+		require.Equal(t, batch.Headers[:2], archived.Batch.Headers)
+
+		_, err = ar.Next()
+		require.ErrorIs(t, err, io.EOF)
+	})
+}
+
+// TestTopicExportOffsets verifies that Export() only exports records in the
+// requested range of offsets, and that it returns seberr.ErrOutOfBounds if
+// the range starts after the topic's next offset.
+func TestTopicExportOffsets(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		topic, err := sebtopic.New(log, storage, "topic", cache)
+		require.NoError(t, err)
+
+		records := [][]byte{}
+		for range 3 {
+			batch := tester.MakeRandomRecordBatch(3)
+			_, err = topic.AddRecords(batch)
+			require.NoError(t, err)
+			records = append(records, batch.IndividualRecords()...)
+		}
+
+		tests := map[string]struct {
+			startOffset     uint64
+			endOffset       uint64
+			expectedRecords [][]byte
+			expectedErr     error
+		}{
+			"all":            {startOffset: 0, endOffset: 0, expectedRecords: records},
+			"within batch":   {startOffset: 4, endOffset: 5, expectedRecords: records[4:5]},
+			"across batches": {startOffset: 2, endOffset: 7, expectedRecords: records[2:7]},
+			"end too high":   {startOffset: 7, endOffset: 100, expectedRecords: records[7:]},
+			"empty":          {startOffset: 9, endOffset: 0, expectedRecords: [][]byte{}},
+			"start too high": {startOffset: 10, endOffset: 0, expectedErr: seberr.ErrOutOfBounds},
+		}
+
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				buf := bytes.Buffer{}
+
+				// Act
+				_, err := topic.Export(context.Background(), &buf, test.startOffset, test.endOffset)
+
+				// Assert
+				require.ErrorIs(t, err, test.expectedErr)
+				if test.expectedErr != nil {
+					return
+				}
+
+				ar, err := sebtopic.NewArchiveReader(&buf)
+				require.NoError(t, err)
+
+				gotRecords := [][]byte{}
+				for {
+					archived, err := ar.Next()
+					if errors.Is(err, io.EOF) {
+						break
+					}
+					require.NoError(t, err)
+					gotRecords = append(gotRecords, archived.Batch.IndividualRecords()...)
+				}
+				require.Equal(t, test.expectedRecords, gotRecords)
+			})
+		}
+	})
+}
+
+// TestArchiveReaderBadInput verifies that NewArchiveReader() and Next()
+// return seberr.ErrBadInput when reading data that isn't a valid archive.
+func TestArchiveReaderBadInput(t *testing.T) {
+	valid := bytes.Buffer{}
+	aw, err := sebtopic.NewArchiveWriter(&valid)
+	require.NoError(t, err)
+	err = aw.Write(0, time.Now(), tester.MakeRandomRecordBatch(2))
+	require.NoError(t, err)
+
+	// Act
+	_, err = sebtopic.NewArchiveReader(bytes.NewReader([]byte("not an archive")))
+
+	// Assert
+	require.ErrorIs(t, err, seberr.ErrBadInput)
+
+	// Act
+	ar, err := sebtopic.NewArchiveReader(bytes.NewReader(valid.Bytes()[:valid.Len()-1]))
+	require.NoError(t, err)
+	_, err = ar.Next()
+
+	// Assert
+	require.ErrorIs(t, err, seberr.ErrBadInput)
+}
@@ -0,0 +1,59 @@
+package sebtopic
+
+import (
+	"sync"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+)
+
+// hybridClock issues the commit times of a topic's record batches, in unix
+// epoch microseconds. It's a hybrid logical clock: commit times follow the
+// wall clock, but when the wall clock doesn't move forward, e.g. because it
+// was adjusted backwards, commit times are advanced by one microsecond past
+// the latest one issued until the wall clock catches up.
+//
+// This keeps commit times strictly increasing within a topic, which lookups
+// of offsets by time rely on.
+type hybridClock struct {
+	mu       sync.Mutex
+	latestUs int64
+
+	// seeded is true once latestUs holds at least the commit time of the
+	// topic's latest record batch.
+	seeded bool
+}
+
+// seed makes the clock issue commit times later than unixEpochUs.
+func (c *hybridClock) seed(unixEpochUs int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.latestUs = max(c.latestUs, unixEpochUs)
+	c.seeded = true
+}
+
+func (c *hybridClock) isSeeded() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.seeded
+}
+
+// next returns a commit time later than all previously issued ones.
+func (c *hybridClock) next() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.latestUs = max(sebrecords.UnixEpochUs(), c.latestUs+1)
+	return c.latestUs
+}
+
+// drift returns how far the latest commit time issued is ahead of the wall
+// clock. It's only positive when the wall clock has gone backwards.
+func (c *hybridClock) drift() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return max(0, time.Duration(c.latestUs-sebrecords.UnixEpochUs())*time.Microsecond)
+}
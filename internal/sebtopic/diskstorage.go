@@ -1,11 +1,14 @@
 package sebtopic
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/micvbang/go-helpy/filepathy"
@@ -16,18 +19,114 @@ import (
 type DiskStorage struct {
 	log     logger.Logger
 	rootDir string
+
+	sync         DiskSync
+	syncInterval time.Duration
+	mmap         bool
+	files        *fileHandlePool
+
+	mu         sync.Mutex
+	committers map[string]*groupCommitter
+
+	// syncs is the number of sync rounds performed.
+	syncs atomic.Uint64
+}
+
+// DiskSync controls when data written to DiskStorage is fsync'ed to disk.
+type DiskSync int
+
+const (
+	// DiskSyncNone leaves it to the operating system to decide when data is
+	// written to disk. Data may be lost if the machine crashes.
+	DiskSyncNone DiskSync = iota
+
+	// DiskSyncEveryWrite fsyncs each file before Close() returns. Concurrent
+	// writes to the same topic are group committed, sharing one sync round.
+	DiskSyncEveryWrite
+
+	// DiskSyncInterval fsyncs written files in the background every
+	// DiskStorageOpts.SyncInterval. Data written within the last interval may
+	// be lost if the machine crashes.
+	DiskSyncInterval
+)
+
+type DiskStorageOpts struct {
+	Sync         DiskSync
+	SyncInterval time.Duration
+
+	// Mmap makes readers read files that are mapped into memory. See
+	// WithDiskMmap.
+	Mmap bool
+
+	// OpenFiles is the maximum number of files kept open for reading. See
+	// WithDiskOpenFiles.
+	OpenFiles int
 }
 
 // NewDiskStorage returns a *DiskStorage that stores its data in rootDir on
 // local disk.
-func NewDiskStorage(log logger.Logger, rootDir string) *DiskStorage {
+//
+// It defaults to DiskSyncNone.
+func NewDiskStorage(log logger.Logger, rootDir string, optFuncs ...func(*DiskStorageOpts)) *DiskStorage {
+	opts := DiskStorageOpts{
+		Sync:         DiskSyncNone,
+		SyncInterval: time.Second,
+	}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+
 	return &DiskStorage{
-		log:     log,
-		rootDir: rootDir,
+		log:          log,
+		rootDir:      rootDir,
+		sync:         opts.Sync,
+		syncInterval: opts.SyncInterval,
+		mmap:         opts.Mmap,
+		files:        newFileHandlePool(opts.OpenFiles),
+		committers:   make(map[string]*groupCommitter),
+	}
+}
+
+// WithDiskSync sets when data written to DiskStorage is fsync'ed to disk.
+func WithDiskSync(sync DiskSync) func(*DiskStorageOpts) {
+	return func(o *DiskStorageOpts) {
+		o.Sync = sync
+	}
+}
+
+// WithDiskSyncInterval sets DiskSyncInterval with the given interval.
+func WithDiskSyncInterval(interval time.Duration) func(*DiskStorageOpts) {
+	return func(o *DiskStorageOpts) {
+		o.Sync = DiskSyncInterval
+		o.SyncInterval = interval
+	}
+}
+
+// WithDiskMmap sets whether files are mapped into memory when read, serving
+// reads of frequently read files from the page cache without a syscall per
+// read. If mapping a file fails, e.g. on platforms that don't support mmap,
+// it's read using regular file I/O.
+//
+// NOTE: since files are only ever replaced, never modified in place, mapped
+// files stay valid until their readers are closed.
+func WithDiskMmap(enabled bool) func(*DiskStorageOpts) {
+	return func(o *DiskStorageOpts) {
+		o.Mmap = enabled
+	}
+}
+
+// WithDiskOpenFiles sets the maximum number of files that are kept open
+// between reads, such that frequently read record batches aren't opened and
+// closed for every read. The least recently read files are closed when the
+// limit is reached. Files are not kept open if maxFiles is 0, or if they're
+// mapped into memory. See WithDiskMmap.
+func WithDiskOpenFiles(maxFiles int) func(*DiskStorageOpts) {
+	return func(o *DiskStorageOpts) {
+		o.OpenFiles = maxFiles
 	}
 }
 
-func (ds *DiskStorage) Writer(key string) (io.WriteCloser, error) {
+func (ds *DiskStorage) Writer(_ context.Context, key string) (io.WriteCloser, error) {
 	batchPath := ds.rootDirPath(key)
 
 	log := ds.log.WithField("key", key).WithField("path", batchPath)
@@ -38,34 +137,129 @@ func (ds *DiskStorage) Writer(key string) (io.WriteCloser, error) {
 		return nil, fmt.Errorf("creating topic dir: %w", err)
 	}
 
+	// NOTE: data is written to a temporary file which replaces batchPath when
+	// closed, so that readers never see partially written files.
 	log.Debugf("creating file")
-	f, err := os.Create(batchPath)
+	f, err := os.Create(batchPath + diskTempExtension)
 	if err != nil {
 		return nil, fmt.Errorf("opening file '%s': %w", batchPath, err)
 	}
 
-	return f, nil
+	w := &diskWriter{File: f, path: batchPath, files: ds.files}
+	if ds.sync != DiskSyncNone {
+		w.committer = ds.committer(filepath.Dir(batchPath))
+	}
+
+	return w, nil
+}
+
+func (ds *DiskStorage) Reader(_ context.Context, key string) (io.ReadCloser, error) {
+	rdr, _, err := ds.open(key)
+	return rdr, err
+}
+
+// ReadRange returns a reader of at most length bytes of key, starting at
+// offset. See RangeReader.
+func (ds *DiskStorage) ReadRange(_ context.Context, key string, offset int64, length int64) (io.ReadCloser, int64, error) {
+	rdr, size, err := ds.open(key)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(rdr, offset, length), rdr}, size, nil
+}
+
+// diskReader is implemented by both *os.File and *mmapReader.
+type diskReader interface {
+	io.ReadSeekCloser
+	io.ReaderAt
 }
 
-func (ds *DiskStorage) Reader(key string) (io.ReadCloser, error) {
+// open opens key for reading, returning a reader of it and its size. If mmap
+// is enabled, the file is mapped into memory unless mapping it fails.
+// Otherwise, a pooled file handle is used if files are kept open.
+func (ds *DiskStorage) open(key string) (diskReader, int64, error) {
 	batchPath := ds.rootDirPath(key)
 
 	log := ds.log.WithField("key", key).WithField("path", batchPath)
 
+	if !ds.mmap && ds.files != nil {
+		return ds.files.open(batchPath, func() (*os.File, int64, error) {
+			log.Debugf("opening file")
+			return openRecordBatch(batchPath)
+		})
+	}
+
 	log.Debugf("opening file")
+	f, size, err := openRecordBatch(batchPath)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if ds.mmap {
+		rdr, err := newMmapReader(f)
+		if err == nil {
+			f.Close()
+			return rdr, rdr.Size(), nil
+		}
+		log.Debugf("falling back to file I/O: %s", err)
+	}
+
+	return f, size, nil
+}
+
+// openRecordBatch opens the file at batchPath for reading, returning it and
+// its size.
+func openRecordBatch(batchPath string) (*os.File, int64, error) {
 	f, err := os.Open(batchPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			err = errors.Join(err, seberr.ErrNotInStorage)
 		}
 
-		return nil, fmt.Errorf("opening record batch '%s': %w", batchPath, err)
+		return nil, 0, fmt.Errorf("opening record batch '%s': %w", batchPath, err)
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, fmt.Errorf("stat'ing record batch '%s': %w", f.Name(), err)
 	}
 
-	return f, nil
+	return f, stat.Size(), nil
 }
 
-func (ds *DiskStorage) ListFiles(topicName string, extension string) ([]File, error) {
+func (ds *DiskStorage) Delete(key string) error {
+	batchPath := ds.rootDirPath(key)
+
+	log := ds.log.WithField("key", key).WithField("path", batchPath)
+
+	log.Debugf("deleting file")
+	err := os.Remove(batchPath)
+	ds.files.invalidate(batchPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = errors.Join(err, seberr.ErrNotInStorage)
+		}
+
+		return fmt.Errorf("deleting record batch '%s': %w", batchPath, err)
+	}
+
+	return nil
+}
+
+func (ds *DiskStorage) ListFiles(ctx context.Context, topicName string, extension string) ([]File, error) {
+	return listFilesByWalking(func(f func(File) error) error {
+		return ds.WalkFiles(ctx, topicName, extension, f)
+	})
+}
+
+// WalkFiles calls f with each file of topicName that has the given extension,
+// while walking the topic's directory. See FileWalker.
+func (ds *DiskStorage) WalkFiles(ctx context.Context, topicName string, extension string, f func(File) error) error {
 	log := ds.log.
 		WithField("topicName", topicName).
 		WithField("extension", extension)
@@ -75,21 +269,55 @@ func (ds *DiskStorage) ListFiles(topicName string, extension string) ([]File, er
 
 	topicPath := ds.rootDirPath(topicName)
 
-	files := make([]File, 0, 128)
+	numFiles := 0
 	walkConfig := filepathy.WalkConfig{Files: true, Extensions: []string{extension}}
 	err := filepathy.Walk(topicPath, walkConfig, func(path string, info os.FileInfo, _ error) error {
-		files = append(files, File{
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		numFiles += 1
+		return f(File{
 			Size: info.Size(),
 			Path: path,
 		})
-		return nil
 	})
 
-	log.Debugf("found %d files (%s)", len(files), time.Since(t0))
+	log.Debugf("found %d files (%s)", numFiles, time.Since(t0))
 
-	return files, err
+	return err
 }
 
+// Syncs returns the number of sync rounds performed. With group commit, a
+// single round syncs all files written concurrently to a topic, so comparing
+// this to the number of writes shows the effectiveness of group commit.
+func (ds *DiskStorage) Syncs() uint64 {
+	return ds.syncs.Load()
+}
+
+// FileHandleStats returns statistics of the files kept open between reads.
+// The zero value is returned if files aren't kept open. See
+// WithDiskOpenFiles.
+func (ds *DiskStorage) FileHandleStats() FileHandleStats {
+	return ds.files.stats()
+}
+
+// committer returns the groupCommitter for dir, creating it if necessary.
+func (ds *DiskStorage) committer(dir string) *groupCommitter {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	c, ok := ds.committers[dir]
+	if !ok {
+		c = &groupCommitter{ds: ds, dir: dir}
+		ds.committers[dir] = c
+	}
+	return c
+}
+
+// diskTempExtension is the extension of files that are being written.
+const diskTempExtension = ".tmp"
+
 func (ds *DiskStorage) rootDirPath(key string) string {
 	return filepath.Join(ds.rootDir, key)
 }
@@ -1,10 +1,15 @@
 package sebtopic_test
 
 import (
+	"context"
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
 	sebtopic "github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
 	"github.com/stretchr/testify/require"
 )
 
@@ -19,15 +24,310 @@ func TestDiskTopicWriterReaderHappyPath(t *testing.T) {
 	d := sebtopic.NewDiskStorage(log, t.TempDir())
 
 	// Act, write
-	wtr, err := d.Writer(recordsKey)
+	wtr, err := d.Writer(context.Background(), recordsKey)
 	require.NoError(t, err)
 	tester.WriteAndClose(t, wtr, expectedBytes)
 
 	// Act, read
-	rdr, err := d.Reader(recordsKey)
+	rdr, err := d.Reader(context.Background(), recordsKey)
 	require.NoError(t, err)
 
 	// Assert
 	gotBytes := tester.ReadAndClose(t, rdr)
 	require.Equal(t, expectedBytes, gotBytes)
 }
+
+// TestDiskTopicDelete verifies that Delete() removes the file, and that
+// seberr.ErrNotInStorage is returned when deleting or reading a key that does
+// not exist.
+func TestDiskTopicDelete(t *testing.T) {
+	const recordsKey = "some-key"
+
+	d := sebtopic.NewDiskStorage(log, t.TempDir())
+
+	wtr, err := d.Writer(context.Background(), recordsKey)
+	require.NoError(t, err)
+	tester.WriteAndClose(t, wtr, tester.RandomBytes(t, 512))
+
+	// Act
+	err = d.Delete(recordsKey)
+	require.NoError(t, err)
+
+	// Assert
+	_, err = d.Reader(context.Background(), recordsKey)
+	require.ErrorIs(t, err, seberr.ErrNotInStorage)
+
+	err = d.Delete(recordsKey)
+	require.ErrorIs(t, err, seberr.ErrNotInStorage)
+}
+
+// TestDiskStorageSyncEveryWrite verifies that concurrent writes using
+// DiskSyncEveryWrite are all readable once Close() returns, and that they're
+// synced in at most as many sync rounds as there were writes.
+func TestDiskStorageSyncEveryWrite(t *testing.T) {
+	const numWrites = 32
+
+	d := sebtopic.NewDiskStorage(log, t.TempDir(), sebtopic.WithDiskSync(sebtopic.DiskSyncEveryWrite))
+
+	expected := make([][]byte, numWrites)
+	wg := sync.WaitGroup{}
+	wg.Add(numWrites)
+	for i := range numWrites {
+		expected[i] = tester.RandomBytes(t, 512)
+		go func() {
+			defer wg.Done()
+
+			// Act
+			wtr, err := d.Writer(context.Background(), fmt.Sprintf("topic/%d", i))
+			require.NoError(t, err)
+			tester.WriteAndClose(t, wtr, expected[i])
+		}()
+	}
+	wg.Wait()
+
+	// Assert
+	for i := range numWrites {
+		rdr, err := d.Reader(context.Background(), fmt.Sprintf("topic/%d", i))
+		require.NoError(t, err)
+		require.Equal(t, expected[i], tester.ReadAndClose(t, rdr))
+	}
+
+	require.GreaterOrEqual(t, d.Syncs(), uint64(1))
+	require.LessOrEqual(t, d.Syncs(), uint64(numWrites))
+}
+
+// TestDiskStorageSyncInterval verifies that DiskSyncInterval syncs written
+// files in the background, in a single sync round per interval.
+func TestDiskStorageSyncInterval(t *testing.T) {
+	d := sebtopic.NewDiskStorage(log, t.TempDir(), sebtopic.WithDiskSyncInterval(50*time.Millisecond))
+
+	// Act
+	for i := range 5 {
+		wtr, err := d.Writer(context.Background(), fmt.Sprintf("topic/%d", i))
+		require.NoError(t, err)
+		tester.WriteAndClose(t, wtr, tester.RandomBytes(t, 512))
+	}
+
+	// Assert
+	require.Equal(t, uint64(0), d.Syncs())
+	require.Eventually(t, func() bool {
+		return d.Syncs() == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+// TestDiskStorageSyncEveryWriteTopic verifies that records added to a topic
+// kept in DiskStorage using DiskSyncEveryWrite are synced, and can be read once
+// the topic is opened again.
+func TestDiskStorageSyncEveryWriteTopic(t *testing.T) {
+	const topicName = "topic"
+	d := sebtopic.NewDiskStorage(log, t.TempDir(), sebtopic.WithDiskSync(sebtopic.DiskSyncEveryWrite))
+
+	topic, err := sebtopic.New(log, d, topicName, newMemoryCache(t))
+	require.NoError(t, err)
+
+	expected := [][]byte{}
+	for range 4 {
+		batch := tester.MakeRandomRecordBatch(4)
+		expected = append(expected, batch.IndividualRecords()...)
+
+		// Act
+		_, err := topic.AddRecords(batch)
+		require.NoError(t, err)
+	}
+
+	// Assert
+	require.GreaterOrEqual(t, d.Syncs(), uint64(4))
+
+	reopened, err := sebtopic.New(log, d, topicName, newMemoryCache(t))
+	require.NoError(t, err)
+	require.Equal(t, uint64(len(expected)), reopened.NextOffset())
+
+	gotBatch := tester.NewBatch(len(expected), 4096)
+	err = reopened.ReadRecords(context.Background(), &gotBatch, 0, len(expected), 0)
+	require.NoError(t, err)
+	require.Equal(t, expected, gotBatch.IndividualRecords())
+}
+
+// TestDiskStorageMmap verifies that files read using WithDiskMmap can be read
+// in full and in ranges, including empty files, and that open readers keep
+// returning the data they were opened with when the file is replaced.
+func TestDiskStorageMmap(t *testing.T) {
+	const key = "some-key"
+	d := sebtopic.NewDiskStorage(log, t.TempDir(), sebtopic.WithDiskMmap(true))
+
+	expectedBytes := tester.RandomBytes(t, 512)
+	wtr, err := d.Writer(context.Background(), key)
+	require.NoError(t, err)
+	tester.WriteAndClose(t, wtr, expectedBytes)
+
+	// Act
+	rdr, err := d.Reader(context.Background(), key)
+	require.NoError(t, err)
+
+	rangeRdr, size, err := d.ReadRange(context.Background(), key, 100, 50)
+	require.NoError(t, err)
+
+	wtr, err = d.Writer(context.Background(), key)
+	require.NoError(t, err)
+	tester.WriteAndClose(t, wtr, tester.RandomBytes(t, 64))
+
+	// Assert
+	require.Equal(t, expectedBytes, tester.ReadAndClose(t, rdr))
+	require.Equal(t, int64(len(expectedBytes)), size)
+	require.Equal(t, expectedBytes[100:150], tester.ReadAndClose(t, rangeRdr))
+
+	// empty files can't be mapped, but must still be readable
+	wtr, err = d.Writer(context.Background(), key)
+	require.NoError(t, err)
+	tester.WriteAndClose(t, wtr, []byte{})
+
+	rdr, err = d.Reader(context.Background(), key)
+	require.NoError(t, err)
+	require.Empty(t, tester.ReadAndClose(t, rdr))
+}
+
+// TestDiskStorageOpenFiles verifies that files read using WithDiskOpenFiles
+// are kept open between reads up to the configured limit, that open readers
+// keep returning the data they were opened with when the file is replaced,
+// and that replaced and deleted files are not read from the pool.
+func TestDiskStorageOpenFiles(t *testing.T) {
+	ctx := context.Background()
+	d := sebtopic.NewDiskStorage(log, t.TempDir(), sebtopic.WithDiskOpenFiles(2))
+
+	keys := []string{"topic/a", "topic/b", "topic/c"}
+	expectedBytes := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		expectedBytes[key] = tester.RandomBytes(t, 512)
+		wtr, err := d.Writer(ctx, key)
+		require.NoError(t, err)
+		tester.WriteAndClose(t, wtr, expectedBytes[key])
+	}
+
+	// Act
+	for range 3 {
+		for _, key := range keys[:2] {
+			rdr, err := d.Reader(ctx, key)
+			require.NoError(t, err)
+			require.Equal(t, expectedBytes[key], tester.ReadAndClose(t, rdr))
+		}
+	}
+
+	// Assert
+	stats := d.FileHandleStats()
+	require.Equal(t, 2, stats.Open)
+	require.Equal(t, uint64(2), stats.Misses)
+	require.Equal(t, uint64(4), stats.Hits)
+
+	// Act, evict least recently read file
+	rdr, err := d.Reader(ctx, keys[2])
+	require.NoError(t, err)
+	require.Equal(t, expectedBytes[keys[2]], tester.ReadAndClose(t, rdr))
+
+	// Assert
+	stats = d.FileHandleStats()
+	require.Equal(t, 2, stats.Open)
+	require.Equal(t, uint64(1), stats.Evictions)
+
+	// Act, replace file while it's being read
+	rdr, err = d.Reader(ctx, keys[1])
+	require.NoError(t, err)
+	rangeRdr, size, err := d.ReadRange(ctx, keys[1], 100, 50)
+	require.NoError(t, err)
+
+	replacedBytes := tester.RandomBytes(t, 64)
+	wtr, err := d.Writer(ctx, keys[1])
+	require.NoError(t, err)
+	tester.WriteAndClose(t, wtr, replacedBytes)
+
+	// Assert
+	require.Equal(t, expectedBytes[keys[1]], tester.ReadAndClose(t, rdr))
+	require.Equal(t, int64(len(expectedBytes[keys[1]])), size)
+	require.Equal(t, expectedBytes[keys[1]][100:150], tester.ReadAndClose(t, rangeRdr))
+
+	rdr, err = d.Reader(ctx, keys[1])
+	require.NoError(t, err)
+	require.Equal(t, replacedBytes, tester.ReadAndClose(t, rdr))
+
+	// Act, delete file
+	err = d.Delete(keys[1])
+	require.NoError(t, err)
+
+	// Assert
+	_, err = d.Reader(ctx, keys[1])
+	require.ErrorIs(t, err, seberr.ErrNotInStorage)
+}
+
+// TestDiskStorageOpenFilesConcurrentReaders verifies that concurrent readers
+// of the same pooled file don't share their offsets.
+func TestDiskStorageOpenFilesConcurrentReaders(t *testing.T) {
+	const key = "topic/a"
+	ctx := context.Background()
+	d := sebtopic.NewDiskStorage(log, t.TempDir(), sebtopic.WithDiskOpenFiles(1))
+
+	expectedBytes := tester.RandomBytes(t, 32*1024)
+	wtr, err := d.Writer(ctx, key)
+	require.NoError(t, err)
+	tester.WriteAndClose(t, wtr, expectedBytes)
+
+	wg := sync.WaitGroup{}
+	for range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// Act
+			rdr, err := d.Reader(ctx, key)
+			require.NoError(t, err)
+
+			// Assert
+			require.Equal(t, expectedBytes, tester.ReadAndClose(t, rdr))
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(t, 1, d.FileHandleStats().Open)
+}
+
+// TestDiskStorageWalkFiles verifies that WalkFiles calls its callback with
+// the same files that are returned by ListFiles, and that it stops walking
+// once the callback returns an error.
+func TestDiskStorageWalkFiles(t *testing.T) {
+	ctx := context.Background()
+	d := sebtopic.NewDiskStorage(log, t.TempDir())
+
+	for i := range 5 {
+		wtr, err := d.Writer(ctx, sebtopic.RecordBatchKey("topic", uint64(i)))
+		require.NoError(t, err)
+		tester.WriteAndClose(t, wtr, tester.RandomBytes(t, 8+i))
+	}
+	wtr, err := d.Writer(ctx, "other-topic/000000000000.record_batch")
+	require.NoError(t, err)
+	tester.WriteAndClose(t, wtr, tester.RandomBytes(t, 8))
+
+	expectedFiles, err := d.ListFiles(ctx, "topic", ".record_batch")
+	require.NoError(t, err)
+	require.Len(t, expectedFiles, 5)
+
+	// Act
+	gotFiles := []sebtopic.File{}
+	err = d.WalkFiles(ctx, "topic", ".record_batch", func(file sebtopic.File) error {
+		gotFiles = append(gotFiles, file)
+		return nil
+	})
+
+	// Assert
+	require.NoError(t, err)
+	require.ElementsMatch(t, expectedFiles, gotFiles)
+
+	// Act
+	errStop := fmt.Errorf("stop")
+	walked := 0
+	err = d.WalkFiles(ctx, "topic", ".record_batch", func(file sebtopic.File) error {
+		walked += 1
+		return errStop
+	})
+
+	// Assert
+	require.ErrorIs(t, err, errStop)
+	require.Equal(t, 1, walked)
+}
@@ -0,0 +1,73 @@
+package sebtopic
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// diskMtimeGranularity is the coarsest modification time granularity expected
+// of the file systems that DiskStorage is used on. Changes made within the
+// same tick as a previous change don't update the modification time.
+const diskMtimeGranularity = 2 * time.Second
+
+// WatchTopics watches the directories of the topics returned by topicNames for
+// record batches written by other processes, e.g. a broker writing to a data
+// directory on NFS or EFS that is shared with read-only replicas. The name of
+// a topic is sent on the returned channel when its directory has changed,
+// after which Topic.Refresh should be used to pick up the new record batches.
+//
+// Directories are polled every interval, since file system notifications are
+// not delivered for changes made by other clients of network file systems. A
+// topic is reported the first time its directory is seen, and for as long as
+// its directory was modified within the last couple of seconds, since file
+// systems with coarse modification times may otherwise hide changes.
+//
+// The returned channel is closed when ctx expires.
+func (ds *DiskStorage) WatchTopics(ctx context.Context, interval time.Duration, topicNames func() []string) <-chan string {
+	changed := make(chan string, 64)
+
+	go func() {
+		defer close(changed)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		modTimes := map[string]time.Time{}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			seen := make(map[string]time.Time, len(modTimes))
+			for _, topicName := range topicNames() {
+				info, err := os.Stat(ds.rootDirPath(topicName))
+				if err != nil {
+					if !os.IsNotExist(err) {
+						ds.log.Warnf("watching topic '%s': %s", topicName, err)
+					}
+					continue
+				}
+
+				modTime := info.ModTime()
+				seen[topicName] = modTime
+
+				lastModTime, ok := modTimes[topicName]
+				if ok && modTime.Equal(lastModTime) && time.Since(modTime) > diskMtimeGranularity {
+					continue
+				}
+
+				select {
+				case changed <- topicName:
+				case <-ctx.Done():
+					return
+				}
+			}
+			modTimes = seen
+		}
+	}()
+
+	return changed
+}
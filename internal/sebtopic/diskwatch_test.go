@@ -0,0 +1,45 @@
+package sebtopic_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDiskStorageWatchTopics verifies that WatchTopics reports topics whose
+// directories exist, and that the returned channel is closed when ctx
+// expires.
+func TestDiskStorageWatchTopics(t *testing.T) {
+	diskStorage := sebtopic.NewDiskStorage(log, t.TempDir())
+
+	wtr, err := diskStorage.Writer(context.Background(), sebtopic.RecordBatchKey("topic", 0))
+	require.NoError(t, err)
+	tester.WriteAndClose(t, wtr, []byte("data"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Act
+	changed := diskStorage.WatchTopics(ctx, time.Millisecond, func() []string {
+		return []string{"does-not-exist", "topic"}
+	})
+
+	// Assert
+	select {
+	case topicName := <-changed:
+		require.Equal(t, "topic", topicName)
+	case <-time.After(time.Second):
+		require.Fail(t, "timed out waiting for topic to be reported")
+	}
+
+	// Act
+	cancel()
+
+	// Assert
+	for range changed {
+	}
+}
@@ -0,0 +1,515 @@
+package sebtopic
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/micvbang/go-helpy/sizey"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// KeyProvider provides the keys used by EncryptedStorage. Keys must be 16, 24
+// or 32 bytes long, selecting AES-128, AES-192 or AES-256.
+type KeyProvider interface {
+	// EncryptionKey returns the ID and key that should be used to encrypt
+	// record batches for topicName.
+	EncryptionKey(topicName string) (keyID string, key []byte, err error)
+
+	// DecryptionKey returns the key with the given ID. It must be able to
+	// return all keys that have ever been returned by EncryptionKey, in order
+	// for old record batches to remain readable after key rotation.
+	DecryptionKey(keyID string) ([]byte, error)
+}
+
+// EncryptedStorage is a Storage that AES-GCM-encrypts record batches before
+// they're written to the wrapped Storage, and decrypts them when they're read.
+// The ID of the key used is stored in the header of each encrypted file, such
+// that keys can be rotated without re-encrypting existing files.
+//
+// NOTE: only the wrapped Storage is encrypted; record batches kept in the
+// local cache are stored in plaintext.
+type EncryptedStorage struct {
+	storage     Storage
+	keyProvider KeyProvider
+}
+
+var _ Storage = &EncryptedStorage{}
+
+func NewEncryptedStorage(storage Storage, keyProvider KeyProvider) *EncryptedStorage {
+	return &EncryptedStorage{
+		storage:     storage,
+		keyProvider: keyProvider,
+	}
+}
+
+// encryptedFileMagic identifies files written by EncryptedStorage, and
+// encryptedFileVersion the layout of the header that follows it.
+//
+// Version 1: magic, version, key id length (1 byte), key id, nonce, ciphertext.
+//
+// Version 2: magic, version, key id length (1 byte), key id, chunk size (4
+// bytes), nonce, followed by the plaintext in chunks of chunk size bytes that
+// are each sealed separately, such that files can be encrypted and decrypted
+// while they're streamed. The nonce of each chunk is the file's nonce XORed
+// with the chunk's index, and the header and a flag marking the final chunk
+// are authenticated with each chunk, which detects truncated and reordered
+// chunks.
+var encryptedFileMagic = [4]byte{'s', 'e', 'b', 'e'}
+
+const (
+	encryptedFileVersionV1 = 1
+	encryptedFileVersion   = 2
+
+	// encryptedChunkSize is the number of plaintext bytes per chunk, bounding
+	// the memory used to encrypt and decrypt files of any size.
+	encryptedChunkSize = 64 * sizey.KB
+
+	// encryptedChunkSizeMax bounds the chunk size read from file headers.
+	encryptedChunkSizeMax = 16 * sizey.MB
+)
+
+func (es *EncryptedStorage) Writer(ctx context.Context, key string) (io.WriteCloser, error) {
+	keyID, encryptionKey, err := es.keyProvider.EncryptionKey(path.Dir(key))
+	if err != nil {
+		return nil, fmt.Errorf("getting encryption key: %w", err)
+	}
+	if len(keyID) > 255 {
+		return nil, fmt.Errorf("key id '%s' longer than 255 bytes: %w", keyID, seberr.ErrBadInput)
+	}
+
+	aead, err := newAEAD(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, fmt.Errorf("generating nonce: %w", err)
+	}
+
+	header := make([]byte, 0, len(encryptedFileMagic)+6+len(keyID)+len(nonce))
+	header = append(header, encryptedFileMagic[:]...)
+	header = append(header, encryptedFileVersion, byte(len(keyID)))
+	header = append(header, keyID...)
+	header = binary.BigEndian.AppendUint32(header, encryptedChunkSize)
+	header = append(header, nonce...)
+
+	wtr, err := es.storage.Writer(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &encryptingWriteCloser{
+		wtr:    wtr,
+		chunks: newEncryptedChunks(aead, header, nonce),
+		chunk:  make([]byte, 0, encryptedChunkSize),
+	}, nil
+}
+
+func (es *EncryptedStorage) Reader(ctx context.Context, key string) (io.ReadCloser, error) {
+	rdr, err := es.storage.Reader(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	decryptingRdr, err := es.newDecryptingReader(rdr)
+	if err != nil {
+		rdr.Close()
+		return nil, fmt.Errorf("decrypting '%s': %w", key, err)
+	}
+
+	return decryptingRdr, nil
+}
+func (es *EncryptedStorage) Delete(key string) error {
+	return es.storage.Delete(key)
+}
+
+func (es *EncryptedStorage) ListFiles(ctx context.Context, topicName string, extension string) ([]File, error) {
+	return es.storage.ListFiles(ctx, topicName, extension)
+}
+
+// WalkFiles calls f with each file of topicName that has the given extension.
+// See FileWalker.
+func (es *EncryptedStorage) WalkFiles(ctx context.Context, topicName string, extension string, f func(File) error) error {
+	return walkFiles(ctx, es.storage, topicName, extension, f)
+}
+
+// WalkFilesAfter calls f with each file of topicName that has the given
+// extension and whose key sorts after afterKey. See FileWalkerAfter.
+func (es *EncryptedStorage) WalkFilesAfter(ctx context.Context, topicName string, extension string, afterKey string, f func(File) error) error {
+	return walkFilesAfter(ctx, es.storage, topicName, extension, afterKey, f)
+}
+
+var errCorruptEncryptedFile = errors.New("corrupt encrypted file")
+
+// newDecryptingReader reads the header of the encrypted file in rdr and
+// returns a reader of its plaintext. Version 1 files are decrypted in full,
+// while version 2 files are decrypted a chunk at a time as they're read.
+func (es *EncryptedStorage) newDecryptingReader(rdr io.ReadCloser) (io.ReadCloser, error) {
+	bufRdr := bufio.NewReader(rdr)
+
+	header := make([]byte, len(encryptedFileMagic)+2, len(encryptedFileMagic)+2+255+4)
+	_, err := io.ReadFull(bufRdr, header)
+	if err != nil || !bytes.Equal(header[:len(encryptedFileMagic)], encryptedFileMagic[:]) {
+		return nil, errCorruptEncryptedFile
+	}
+
+	version := header[len(encryptedFileMagic)]
+	switch version {
+	case encryptedFileVersionV1:
+		rest, err := io.ReadAll(bufRdr)
+		if err != nil {
+			return nil, fmt.Errorf("reading encrypted file: %w", err)
+		}
+
+		plaintext, err := es.decryptV1(append(header, rest...))
+		if err != nil {
+			return nil, err
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{bytes.NewReader(plaintext), rdr}, nil
+
+	case encryptedFileVersion:
+	default:
+		return nil, fmt.Errorf("unsupported version %d: %w", version, errCorruptEncryptedFile)
+	}
+
+	keyIDLen := int(header[len(header)-1])
+	header = header[:len(header)+keyIDLen+4]
+	_, err = io.ReadFull(bufRdr, header[len(header)-keyIDLen-4:])
+	if err != nil {
+		return nil, errCorruptEncryptedFile
+	}
+	keyID := string(header[len(header)-keyIDLen-4 : len(header)-4])
+	chunkSize := binary.BigEndian.Uint32(header[len(header)-4:])
+	if chunkSize == 0 || chunkSize > encryptedChunkSizeMax {
+		return nil, fmt.Errorf("chunk size %d: %w", chunkSize, errCorruptEncryptedFile)
+	}
+
+	aead, err := es.aead(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(bufRdr, nonce)
+	if err != nil {
+		return nil, errCorruptEncryptedFile
+	}
+	header = append(header, nonce...)
+
+	return &decryptingReadCloser{
+		rdr:        bufRdr,
+		closer:     rdr,
+		chunks:     newEncryptedChunks(aead, header, nonce),
+		ciphertext: make([]byte, int(chunkSize)+aead.Overhead()),
+	}, nil
+}
+
+// aead returns the cipher.AEAD of the decryption key with the given ID.
+func (es *EncryptedStorage) aead(keyID string) (cipher.AEAD, error) {
+	decryptionKey, err := es.keyProvider.DecryptionKey(keyID)
+	if err != nil {
+		return nil, fmt.Errorf("getting decryption key '%s': %w", keyID, err)
+	}
+
+	return newAEAD(decryptionKey)
+}
+
+// decryptV1 decrypts the version 1 encrypted file bs.
+func (es *EncryptedStorage) decryptV1(bs []byte) ([]byte, error) {
+	headerLen := len(encryptedFileMagic) + 2
+	keyIDLen := int(bs[headerLen-1])
+	if len(bs) < headerLen+keyIDLen {
+		return nil, errCorruptEncryptedFile
+	}
+	keyID := string(bs[headerLen : headerLen+keyIDLen])
+	headerLen += keyIDLen
+
+	aead, err := es.aead(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bs) < headerLen+aead.NonceSize() {
+		return nil, errCorruptEncryptedFile
+	}
+	nonce := bs[headerLen : headerLen+aead.NonceSize()]
+	ciphertext := bs[headerLen+aead.NonceSize():]
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, bs[:headerLen])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCorruptEncryptedFile, err)
+	}
+
+	return plaintext, nil
+}
+
+// encryptedChunks seals and opens the chunks of a version 2 encrypted file.
+type encryptedChunks struct {
+	aead      cipher.AEAD
+	fileNonce []byte
+	nonce     []byte
+	ad        []byte
+	index     uint64
+	buffer    []byte
+}
+
+func newEncryptedChunks(aead cipher.AEAD, header []byte, fileNonce []byte) *encryptedChunks {
+	// additional data is the header followed by the final chunk flag
+	ad := make([]byte, len(header)+1)
+	copy(ad, header)
+
+	return &encryptedChunks{
+		aead:      aead,
+		fileNonce: fileNonce,
+		nonce:     make([]byte, len(fileNonce)),
+		ad:        ad,
+	}
+}
+
+// header returns the header of the encrypted file.
+func (c *encryptedChunks) header() []byte {
+	return c.ad[:len(c.ad)-1]
+}
+
+// next prepares the nonce and additional data of the next chunk.
+func (c *encryptedChunks) next(final bool) {
+	copy(c.nonce, c.fileNonce)
+	tail := c.nonce[len(c.nonce)-8:]
+	binary.BigEndian.PutUint64(tail, binary.BigEndian.Uint64(tail)^c.index)
+	c.index++
+
+	c.ad[len(c.ad)-1] = 0
+	if final {
+		c.ad[len(c.ad)-1] = 1
+	}
+}
+
+// seal returns the ciphertext of the next chunk. It's only valid until the
+// next call to seal.
+func (c *encryptedChunks) seal(plaintext []byte, final bool) []byte {
+	c.next(final)
+	c.buffer = c.aead.Seal(c.buffer[:0], c.nonce, plaintext, c.ad)
+	return c.buffer
+}
+
+// open returns the plaintext of the next chunk, decrypted in place.
+func (c *encryptedChunks) open(ciphertext []byte, final bool) ([]byte, error) {
+	c.next(final)
+	plaintext, err := c.aead.Open(ciphertext[:0], c.nonce, ciphertext, c.ad)
+	if err != nil {
+		return nil, fmt.Errorf("%w: chunk %d: %w", errCorruptEncryptedFile, c.index-1, err)
+	}
+	return plaintext, nil
+}
+
+// encryptingWriteCloser encrypts what's written to it a chunk at a time. The
+// header is written along with the first chunk, and the final chunk is
+// written when it's closed.
+type encryptingWriteCloser struct {
+	wtr           io.WriteCloser
+	chunks        *encryptedChunks
+	chunk         []byte
+	headerWritten bool
+	err           error
+}
+
+func (wc *encryptingWriteCloser) Write(b []byte) (int, error) {
+	n := 0
+	for len(b) > 0 && wc.err == nil {
+		// NOTE: a full chunk is only written once more bytes arrive, since
+		// it might otherwise be the final one.
+		if len(wc.chunk) == cap(wc.chunk) {
+			wc.err = wc.writeChunk(false)
+		}
+
+		copied := min(cap(wc.chunk)-len(wc.chunk), len(b))
+		wc.chunk = append(wc.chunk, b[:copied]...)
+		b = b[copied:]
+		n += copied
+	}
+
+	return n, wc.err
+}
+
+func (wc *encryptingWriteCloser) Close() error {
+	err := wc.err
+	if err == nil {
+		err = wc.writeChunk(true)
+	}
+	if err != nil {
+		wc.wtr.Close()
+		return err
+	}
+
+	return wc.wtr.Close()
+}
+
+func (wc *encryptingWriteCloser) writeChunk(final bool) error {
+	if !wc.headerWritten {
+		_, err := wc.wtr.Write(wc.chunks.header())
+		if err != nil {
+			return fmt.Errorf("writing encrypted file header: %w", err)
+		}
+		wc.headerWritten = true
+	}
+
+	_, err := wc.wtr.Write(wc.chunks.seal(wc.chunk, final))
+	if err != nil {
+		return fmt.Errorf("writing encrypted file: %w", err)
+	}
+	wc.chunk = wc.chunk[:0]
+
+	return nil
+}
+
+// decryptingReadCloser decrypts the chunks of a version 2 encrypted file as
+// they're read.
+type decryptingReadCloser struct {
+	rdr        *bufio.Reader
+	closer     io.Closer
+	chunks     *encryptedChunks
+	ciphertext []byte
+	plaintext  []byte
+	final      bool
+}
+
+func (rc *decryptingReadCloser) Read(b []byte) (int, error) {
+	for len(rc.plaintext) == 0 {
+		if rc.final {
+			return 0, io.EOF
+		}
+
+		err := rc.readChunk()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(b, rc.plaintext)
+	rc.plaintext = rc.plaintext[n:]
+	return n, nil
+}
+
+func (rc *decryptingReadCloser) readChunk() error {
+	n, err := io.ReadFull(rc.rdr, rc.ciphertext)
+	switch {
+	case err == io.EOF:
+		// the final chunk is always written, even if it's empty
+		return fmt.Errorf("%w: final chunk missing", errCorruptEncryptedFile)
+	case err == io.ErrUnexpectedEOF:
+		rc.final = true
+	case err != nil:
+		return fmt.Errorf("reading encrypted file: %w", err)
+	default:
+		_, err = rc.rdr.Peek(1)
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("reading encrypted file: %w", err)
+		}
+		rc.final = err == io.EOF
+	}
+
+	rc.plaintext, err = rc.chunks.open(rc.ciphertext[:n], rc.final)
+	return err
+}
+
+func (rc *decryptingReadCloser) Close() error {
+	return rc.closer.Close()
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("creating gcm: %w", err)
+	}
+
+	return aead, nil
+}
+
+// StaticKeyProvider is a KeyProvider that uses a fixed set of keys. Topics are
+// encrypted using the key assigned to them with WithTopicKey, falling back to
+// the default key. Keys must be added before the StaticKeyProvider is used.
+type StaticKeyProvider struct {
+	defaultKeyID string
+	topicKeyIDs  map[string]string
+	keys         map[string][]byte
+}
+
+var _ KeyProvider = &StaticKeyProvider{}
+
+// NewStaticKeyProvider returns a StaticKeyProvider that encrypts all topics
+// using the given default key.
+func NewStaticKeyProvider(defaultKeyID string, defaultKey []byte) *StaticKeyProvider {
+	return &StaticKeyProvider{
+		defaultKeyID: defaultKeyID,
+		topicKeyIDs:  make(map[string]string),
+		keys:         map[string][]byte{defaultKeyID: defaultKey},
+	}
+}
+
+// AddKey makes the key with the given ID available for decryption, e.g. after
+// it has been rotated out.
+func (kp *StaticKeyProvider) AddKey(keyID string, key []byte) {
+	kp.keys[keyID] = key
+}
+
+// SetTopicKey makes topicName be encrypted using the given key instead of the
+// default key.
+func (kp *StaticKeyProvider) SetTopicKey(topicName string, keyID string, key []byte) {
+	kp.keys[keyID] = key
+	kp.topicKeyIDs[topicName] = keyID
+}
+
+func (kp *StaticKeyProvider) EncryptionKey(topicName string) (string, []byte, error) {
+	keyID, ok := kp.topicKeyIDs[topicName]
+	if !ok {
+		keyID = kp.defaultKeyID
+	}
+
+	return keyID, kp.keys[keyID], nil
+}
+
+func (kp *StaticKeyProvider) DecryptionKey(keyID string) ([]byte, error) {
+	key, ok := kp.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("key '%s': %w", keyID, seberr.ErrNotFound)
+	}
+
+	return key, nil
+}
+
+// NewEnvKeyProvider returns a StaticKeyProvider whose default key is read,
+// hex encoded, from the environment variable envVar.
+func NewEnvKeyProvider(keyID string, envVar string) (*StaticKeyProvider, error) {
+	hexKey, ok := os.LookupEnv(envVar)
+	if !ok {
+		return nil, fmt.Errorf("environment variable '%s' not set", envVar)
+	}
+
+	key, err := hex.DecodeString(hexKey)
+	if err != nil {
+		return nil, fmt.Errorf("decoding hex key from '%s': %w", envVar, err)
+	}
+
+	return NewStaticKeyProvider(keyID, key), nil
+}
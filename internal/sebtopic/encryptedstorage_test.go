@@ -0,0 +1,294 @@
+package sebtopic_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"io"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEncryptedStorageWriterReaderHappyPath verifies that what's written to
+// EncryptedStorage is encrypted in the wrapped storage, and can be read back
+// in plaintext.
+func TestEncryptedStorageWriterReaderHappyPath(t *testing.T) {
+	expectedBytes := tester.RandomBytes(t, 512)
+	const recordsKey = "topic/some-key"
+
+	memoryStorage := sebtopic.NewMemoryStorage(log)
+	keyProvider := sebtopic.NewStaticKeyProvider("key-1", tester.RandomBytes(t, 32))
+	s := sebtopic.NewEncryptedStorage(memoryStorage, keyProvider)
+
+	// Act, write
+	wtr, err := s.Writer(context.Background(), recordsKey)
+	require.NoError(t, err)
+	tester.WriteAndClose(t, wtr, expectedBytes)
+
+	// Act, read
+	rdr, err := s.Reader(context.Background(), recordsKey)
+	require.NoError(t, err)
+
+	// Assert
+	gotBytes := tester.ReadAndClose(t, rdr)
+	require.Equal(t, expectedBytes, gotBytes)
+}
+
+// TestEncryptedStorageChunks verifies that files spanning zero, one and
+// multiple encrypted chunks can be read back, also when written in small
+// writes that don't align with chunk boundaries.
+func TestEncryptedStorageChunks(t *testing.T) {
+	const chunkSize = 64 * 1024
+
+	tests := map[string]struct {
+		size int
+	}{
+		"empty":          {size: 0},
+		"partial chunk":  {size: 1000},
+		"exact chunk":    {size: chunkSize},
+		"exact chunks":   {size: 3 * chunkSize},
+		"partial chunks": {size: 2*chunkSize + 17},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			const recordsKey = "topic/some-key"
+			expectedBytes := tester.RandomBytes(t, test.size)
+
+			keyProvider := sebtopic.NewStaticKeyProvider("key-1", tester.RandomBytes(t, 32))
+			s := sebtopic.NewEncryptedStorage(sebtopic.NewMemoryStorage(log), keyProvider)
+
+			wtr, err := s.Writer(context.Background(), recordsKey)
+			require.NoError(t, err)
+			for remaining := expectedBytes; len(remaining) > 0; {
+				n := min(len(remaining), 999)
+				_, err = wtr.Write(remaining[:n])
+				require.NoError(t, err)
+				remaining = remaining[n:]
+			}
+			require.NoError(t, wtr.Close())
+
+			// Act
+			rdr, err := s.Reader(context.Background(), recordsKey)
+			require.NoError(t, err)
+
+			// Assert
+			gotBytes := tester.ReadAndClose(t, rdr)
+			require.Equal(t, len(expectedBytes), len(gotBytes))
+			require.True(t, bytes.Equal(expectedBytes, gotBytes))
+		})
+	}
+}
+
+// TestEncryptedStorageTampered verifies that reading an encrypted file fails
+// if its chunks were truncated or modified.
+func TestEncryptedStorageTampered(t *testing.T) {
+	const (
+		recordsKey = "topic/some-key"
+		chunkSize  = 64 * 1024
+		overhead   = 16
+	)
+
+	tests := map[string]struct {
+		tamper func(bs []byte) []byte
+	}{
+		"final chunk removed": {tamper: func(bs []byte) []byte {
+			return bs[:len(bs)-(1000+overhead)]
+		}},
+		"final chunk truncated": {tamper: func(bs []byte) []byte {
+			return bs[:len(bs)-10]
+		}},
+		"chunk modified": {tamper: func(bs []byte) []byte {
+			bs[len(bs)-2000] ^= 1
+			return bs
+		}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			memoryStorage := sebtopic.NewMemoryStorage(log)
+			keyProvider := sebtopic.NewStaticKeyProvider("key-1", tester.RandomBytes(t, 32))
+			s := sebtopic.NewEncryptedStorage(memoryStorage, keyProvider)
+
+			wtr, err := s.Writer(context.Background(), recordsKey)
+			require.NoError(t, err)
+			tester.WriteAndClose(t, wtr, tester.RandomBytes(t, 2*chunkSize+1000))
+
+			rawRdr, err := memoryStorage.Reader(context.Background(), recordsKey)
+			require.NoError(t, err)
+			rawBytes := test.tamper(tester.ReadAndClose(t, rawRdr))
+
+			rawWtr, err := memoryStorage.Writer(context.Background(), recordsKey)
+			require.NoError(t, err)
+			tester.WriteAndClose(t, rawWtr, rawBytes)
+
+			// Act
+			rdr, err := s.Reader(context.Background(), recordsKey)
+			require.NoError(t, err)
+			_, err = io.ReadAll(rdr)
+			rdr.Close()
+
+			// Assert
+			require.Error(t, err)
+		})
+	}
+}
+
+// TestEncryptedStorageVersion1 verifies that files encrypted in full, as
+// written by earlier versions, remain readable.
+func TestEncryptedStorageVersion1(t *testing.T) {
+	const (
+		recordsKey = "topic/some-key"
+		keyID      = "key-1"
+	)
+	expectedBytes := tester.RandomBytes(t, 512)
+	key := tester.RandomBytes(t, 32)
+
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+	aead, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+
+	header := append([]byte("sebe"), 1, byte(len(keyID)))
+	header = append(header, keyID...)
+	nonce := tester.RandomBytes(t, aead.NonceSize())
+	file := append(append(bytes.Clone(header), nonce...), aead.Seal(nil, nonce, expectedBytes, header)...)
+
+	memoryStorage := sebtopic.NewMemoryStorage(log)
+	wtr, err := memoryStorage.Writer(context.Background(), recordsKey)
+	require.NoError(t, err)
+	tester.WriteAndClose(t, wtr, file)
+
+	s := sebtopic.NewEncryptedStorage(memoryStorage, sebtopic.NewStaticKeyProvider(keyID, key))
+
+	// Act
+	rdr, err := s.Reader(context.Background(), recordsKey)
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, expectedBytes, tester.ReadAndClose(t, rdr))
+}
+
+// TestEncryptedStorageEncrypts verifies that the bytes written to the wrapped
+// storage are encrypted, and that the key ID is stored alongside them.
+func TestEncryptedStorageEncrypts(t *testing.T) {
+	expectedBytes := tester.RandomBytes(t, 512)
+	const recordsKey = "topic/some-key"
+
+	memoryStorage := sebtopic.NewMemoryStorage(log)
+	keyProvider := sebtopic.NewStaticKeyProvider("key-1", tester.RandomBytes(t, 32))
+	s := sebtopic.NewEncryptedStorage(memoryStorage, keyProvider)
+
+	// Act
+	wtr, err := s.Writer(context.Background(), recordsKey)
+	require.NoError(t, err)
+	tester.WriteAndClose(t, wtr, expectedBytes)
+
+	// Assert
+	rawRdr, err := memoryStorage.Reader(context.Background(), recordsKey)
+	require.NoError(t, err)
+	rawBytes := tester.ReadAndClose(t, rawRdr)
+	require.False(t, bytes.Contains(rawBytes, expectedBytes))
+	require.True(t, bytes.Contains(rawBytes, []byte("key-1")))
+}
+
+// TestEncryptedStoragePerTopicKeys verifies that topics are encrypted using
+// their own keys, and that files remain readable after keys are rotated.
+func TestEncryptedStoragePerTopicKeys(t *testing.T) {
+	const (
+		topicA = "topic-a"
+		topicB = "topic-b"
+	)
+	expectedBytes := tester.RandomBytes(t, 128)
+
+	diskStorage := sebtopic.NewDiskStorage(log, t.TempDir())
+	keyProvider := sebtopic.NewStaticKeyProvider("default", tester.RandomBytes(t, 32))
+	keyProvider.SetTopicKey(topicA, "a-1", tester.RandomBytes(t, 16))
+	s := sebtopic.NewEncryptedStorage(diskStorage, keyProvider)
+
+	for _, key := range []string{topicA + "/1", topicB + "/1"} {
+		wtr, err := s.Writer(context.Background(), key)
+		require.NoError(t, err)
+		tester.WriteAndClose(t, wtr, expectedBytes)
+	}
+
+	// rotate key of topic a
+	keyProvider.SetTopicKey(topicA, "a-2", tester.RandomBytes(t, 16))
+	wtr, err := s.Writer(context.Background(), topicA+"/2")
+	require.NoError(t, err)
+	tester.WriteAndClose(t, wtr, expectedBytes)
+
+	// Act, Assert
+	expectedKeyIDs := map[string]string{
+		topicA + "/1": "a-1",
+		topicB + "/1": "default",
+		topicA + "/2": "a-2",
+	}
+	for key, keyID := range expectedKeyIDs {
+		rdr, err := s.Reader(context.Background(), key)
+		require.NoError(t, err)
+		require.Equal(t, expectedBytes, tester.ReadAndClose(t, rdr))
+
+		rawRdr, err := diskStorage.Reader(context.Background(), key)
+		require.NoError(t, err)
+		require.True(t, bytes.Contains(tester.ReadAndClose(t, rawRdr), []byte(keyID)))
+	}
+}
+
+// TestEncryptedStorageUnknownKey verifies that an error is returned when
+// reading a file that was encrypted with a key that is not available.
+func TestEncryptedStorageUnknownKey(t *testing.T) {
+	const recordsKey = "topic/some-key"
+
+	memoryStorage := sebtopic.NewMemoryStorage(log)
+	s1 := sebtopic.NewEncryptedStorage(memoryStorage, sebtopic.NewStaticKeyProvider("key-1", tester.RandomBytes(t, 32)))
+	s2 := sebtopic.NewEncryptedStorage(memoryStorage, sebtopic.NewStaticKeyProvider("key-2", tester.RandomBytes(t, 32)))
+
+	wtr, err := s1.Writer(context.Background(), recordsKey)
+	require.NoError(t, err)
+	tester.WriteAndClose(t, wtr, tester.RandomBytes(t, 64))
+
+	// Act
+	_, err = s2.Reader(context.Background(), recordsKey)
+
+	// Assert
+	require.ErrorIs(t, err, seberr.ErrNotFound)
+}
+
+// TestEncryptedStorageTopic verifies that Topic works when using
+// EncryptedStorage as its backing storage.
+func TestEncryptedStorageTopic(t *testing.T) {
+	const topicName = "topicName"
+
+	keyProvider := sebtopic.NewStaticKeyProvider("key-1", tester.RandomBytes(t, 32))
+	s := sebtopic.NewEncryptedStorage(sebtopic.NewDiskStorage(log, t.TempDir()), keyProvider)
+
+	cache, err := sebcache.NewMemoryCache(log)
+	require.NoError(t, err)
+
+	topic, err := sebtopic.New(log, s, topicName, cache)
+	require.NoError(t, err)
+
+	batch := tester.MakeRandomRecordBatch(5)
+	_, err = topic.AddRecords(batch)
+	require.NoError(t, err)
+
+	// Act
+	cache, err = sebcache.NewMemoryCache(log)
+	require.NoError(t, err)
+
+	reopened, err := sebtopic.New(log, s, topicName, cache)
+	require.NoError(t, err)
+
+	// Assert
+	gotBatch := tester.NewBatch(batch.Len(), 4096)
+	err = reopened.ReadRecords(context.Background(), &gotBatch, 0, batch.Len(), 0)
+	require.NoError(t, err)
+	require.Equal(t, batch.IndividualRecords(), gotBatch.IndividualRecords())
+}
@@ -0,0 +1,201 @@
+package sebtopic
+
+import (
+	"container/list"
+	"io"
+	"os"
+	"sync"
+)
+
+// FileHandleStats describes the use of DiskStorage's pool of open file
+// handles.
+type FileHandleStats struct {
+	MaxOpen int
+	Open    int
+
+	// Hits is the number of reads that used a pooled file handle, and Misses
+	// the number of reads that had to open the file.
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+// fileHandlePool keeps up to max files open for reading, evicting the least
+// recently used file when it's full. This avoids opening and closing the
+// files of frequently read record batches for every read.
+//
+// Pooled files are shared by all of their readers, which read them using
+// ReadAt and therefore don't share file offsets. Since files are replaced
+// rather than modified, pooled files must be invalidated when their path is
+// written or deleted; readers that already hold the old file keep reading it,
+// just as if they had opened it themselves.
+//
+// A nil fileHandlePool is valid and doesn't pool files.
+type fileHandlePool struct {
+	max int
+
+	mu    sync.Mutex
+	files map[string]*pooledFile
+
+	// lru holds the pooled files, most recently used first
+	lru *list.List
+
+	// invalidations is incremented whenever a file is invalidated. Files that
+	// are opened while it changes may be stale and are not pooled.
+	invalidations uint64
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+type pooledFile struct {
+	path string
+	f    *os.File
+	size int64
+
+	// refs is the number of open readers of f, and pooled whether f is still
+	// in the pool. f is closed once it's neither pooled nor read.
+	refs   int
+	pooled bool
+	elem   *list.Element
+}
+
+func newFileHandlePool(max int) *fileHandlePool {
+	if max <= 0 {
+		return nil
+	}
+
+	return &fileHandlePool{
+		max:   max,
+		files: make(map[string]*pooledFile),
+		lru:   list.New(),
+	}
+}
+
+// open returns a reader of the file at path and its size, using a pooled file
+// handle if there is one. open is called to open the file if there isn't.
+func (p *fileHandlePool) open(path string, open func() (*os.File, int64, error)) (diskReader, int64, error) {
+	p.mu.Lock()
+	pf, ok := p.files[path]
+	if ok {
+		p.hits += 1
+		pf.refs += 1
+		p.lru.MoveToFront(pf.elem)
+		p.mu.Unlock()
+		return newPooledFileReader(p, pf), pf.size, nil
+	}
+	p.misses += 1
+	invalidations := p.invalidations
+	p.mu.Unlock()
+
+	f, size, err := open()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.invalidations != invalidations {
+		// f may have been replaced while it was being opened
+		return f, size, nil
+	}
+
+	if existing, ok := p.files[path]; ok {
+		// opened concurrently by another reader
+		f.Close()
+		existing.refs += 1
+		p.lru.MoveToFront(existing.elem)
+		return newPooledFileReader(p, existing), existing.size, nil
+	}
+
+	pf = &pooledFile{path: path, f: f, size: size, refs: 1, pooled: true}
+	pf.elem = p.lru.PushFront(pf)
+	p.files[path] = pf
+
+	for p.lru.Len() > p.max {
+		p.evictions += 1
+		p.remove(p.lru.Back().Value.(*pooledFile))
+	}
+
+	return newPooledFileReader(p, pf), size, nil
+}
+
+// invalidate removes the file at path from the pool. It must be called
+// whenever path is replaced or deleted.
+func (p *fileHandlePool) invalidate(path string) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.invalidations += 1
+	if pf, ok := p.files[path]; ok {
+		p.remove(pf)
+	}
+}
+
+// remove removes pf from the pool, closing it unless it's being read.
+// NOTE: you must hold p.mu lock when calling this method!
+func (p *fileHandlePool) remove(pf *pooledFile) {
+	p.lru.Remove(pf.elem)
+	delete(p.files, pf.path)
+	pf.pooled = false
+	if pf.refs == 0 {
+		pf.f.Close()
+	}
+}
+
+// release releases a reader of pf, closing pf if it's no longer pooled.
+func (p *fileHandlePool) release(pf *pooledFile) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pf.refs -= 1
+	if pf.refs == 0 && !pf.pooled {
+		pf.f.Close()
+	}
+}
+
+func (p *fileHandlePool) stats() FileHandleStats {
+	if p == nil {
+		return FileHandleStats{}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return FileHandleStats{
+		MaxOpen:   p.max,
+		Open:      p.lru.Len(),
+		Hits:      p.hits,
+		Misses:    p.misses,
+		Evictions: p.evictions,
+	}
+}
+
+// pooledFileReader reads a pooled file using its own offset.
+type pooledFileReader struct {
+	*io.SectionReader
+	pool *fileHandlePool
+	pf   *pooledFile
+	once sync.Once
+}
+
+func newPooledFileReader(p *fileHandlePool, pf *pooledFile) *pooledFileReader {
+	return &pooledFileReader{
+		SectionReader: io.NewSectionReader(pf.f, 0, pf.size),
+		pool:          p,
+		pf:            pf,
+	}
+}
+
+func (r *pooledFileReader) Close() error {
+	r.once.Do(func() {
+		r.pool.release(r.pf)
+	})
+	return nil
+}
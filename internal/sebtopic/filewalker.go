@@ -0,0 +1,74 @@
+package sebtopic
+
+import (
+	"context"
+)
+
+// FileWalker is implemented by Storage that can list files without holding
+// all of them in memory at once, e.g. by listing them a page at a time. This
+// matters for topics with hundreds of thousands of files, which are listed
+// every time the topic is instantiated.
+type FileWalker interface {
+	// WalkFiles calls f with each file of topicName that has the given
+	// extension, in no particular order. If f returns an error, walking stops
+	// and the error is returned.
+	WalkFiles(ctx context.Context, topicName string, extension string, f func(File) error) error
+}
+
+// walkFiles calls f with each file of topicName in storage that has the given
+// extension. It uses WalkFiles if storage is a FileWalker, and ListFiles
+// otherwise.
+func walkFiles(ctx context.Context, storage Storage, topicName string, extension string, f func(File) error) error {
+	if walker, ok := storage.(FileWalker); ok {
+		return walker.WalkFiles(ctx, topicName, extension, f)
+	}
+
+	files, err := storage.ListFiles(ctx, topicName, extension)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		err := f(file)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FileWalkerAfter is implemented by Storage that can list the files of a
+// topic whose keys sort after a given key without listing the ones before it,
+// e.g. using S3's StartAfter. This allows cheaply discovering the newest record
+// batches of topics with many files, e.g. when tailing topics written by
+// another broker. See Topic.Refresh.
+type FileWalkerAfter interface {
+	// WalkFilesAfter calls f with each file of topicName that has the given
+	// extension and whose key sorts after afterKey. If f returns an error,
+	// walking stops and the error is returned.
+	WalkFilesAfter(ctx context.Context, topicName string, extension string, afterKey string, f func(File) error) error
+}
+
+// walkFilesAfter calls f with the files of topicName in storage that have the
+// given extension. If storage is a FileWalkerAfter, only files whose keys sort
+// after afterKey are listed. Otherwise, all files are listed and it's up to f
+// to skip the ones it's not interested in.
+func walkFilesAfter(ctx context.Context, storage Storage, topicName string, extension string, afterKey string, f func(File) error) error {
+	if walker, ok := storage.(FileWalkerAfter); ok {
+		return walker.WalkFilesAfter(ctx, topicName, extension, afterKey, f)
+	}
+
+	return walkFiles(ctx, storage, topicName, extension, f)
+}
+
+// listFilesByWalking returns the files that walk calls its callback with.
+// It's used to implement ListFiles for FileWalkers.
+func listFilesByWalking(walk func(f func(File) error) error) ([]File, error) {
+	files := make([]File, 0, 128)
+	err := walk(func(file File) error {
+		files = append(files, file)
+		return nil
+	})
+	return files, err
+}
@@ -0,0 +1,74 @@
+package sebtopic
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+)
+
+// RecordFilter selects which records are read from a topic, allowing consumers
+// that only care about a subset of records to avoid reading the rest.
+type RecordFilter struct {
+	// Key only matches records whose key is Key. Ignored if nil.
+	Key []byte
+
+	// Headers only matches records that have a header with each of the given
+	// keys and values.
+	Headers map[string]string
+}
+
+type recordFilterKey struct{}
+
+// WithRecordFilter returns a copy of ctx that holds filter. Reads from a Topic
+// using the returned context only return records matched by filter; records
+// that are not matched are skipped in the same way as expired records are.
+func WithRecordFilter(ctx context.Context, filter RecordFilter) context.Context {
+	return context.WithValue(ctx, recordFilterKey{}, filter)
+}
+
+// RecordFilterFromContext returns the RecordFilter added to ctx by
+// WithRecordFilter.
+func RecordFilterFromContext(ctx context.Context) (RecordFilter, bool) {
+	filter, ok := ctx.Value(recordFilterKey{}).(RecordFilter)
+	return filter, ok
+}
+
+// Empty returns true if f matches all records.
+func (f RecordFilter) Empty() bool {
+	return f.Key == nil && len(f.Headers) == 0
+}
+
+// matches returns true if the record at recordIndex of rb is matched by f.
+// Records in record batches without keys or headers only match filters that
+// don't require them.
+func (f RecordFilter) matches(rb *sebrecords.Parser, recordIndex uint32) bool {
+	if f.Key != nil {
+		if rb.Keys == nil || !bytes.Equal(rb.Keys[recordIndex], f.Key) {
+			return false
+		}
+	}
+
+	if len(f.Headers) > 0 {
+		if rb.Headers == nil {
+			return false
+		}
+
+		for key, value := range f.Headers {
+			if !hasHeader(rb.Headers[recordIndex], key, value) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func hasHeader(headers []sebrecords.RecordHeader, key string, value string) bool {
+	for _, header := range headers {
+		if header.Key == key && string(header.Value) == value {
+			return true
+		}
+	}
+	return false
+}
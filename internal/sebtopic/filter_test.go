@@ -0,0 +1,100 @@
+package sebtopic_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReadRecordsRecordFilter verifies that ReadRecords() only returns records
+// matched by the RecordFilter of the given context, and that records that are
+// not matched are reported as skipped.
+func TestReadRecordsRecordFilter(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		topic, err := sebtopic.New(log, storage, "topic", cache)
+		require.NoError(t, err)
+
+		// record batch without keys or headers
+		plainBatch := tester.MakeRandomRecordBatch(2)
+		_, err = topic.AddRecords(plainBatch)
+		require.NoError(t, err)
+
+		batch := tester.MakeRandomRecordBatch(4)
+		batch.Keys = [][]byte{[]byte("a"), []byte("b"), []byte("a"), []byte("b")}
+		batch.Headers = [][]sebrecords.RecordHeader{
+			{{Key: "type", Value: []byte("created")}},
+			{{Key: "type", Value: []byte("created")}, {Key: "region", Value: []byte("eu")}},
+			{{Key: "type", Value: []byte("deleted")}},
+			{},
+		}
+		_, err = topic.AddRecords(batch)
+		require.NoError(t, err)
+
+		records := append(plainBatch.IndividualRecords(), batch.IndividualRecords()...)
+
+		tests := map[string]struct {
+			filter          sebtopic.RecordFilter
+			offset          uint64
+			maxRecords      int
+			expectedRecords [][]byte
+			expectedSkipped int
+		}{
+			"empty filter": {
+				filter:          sebtopic.RecordFilter{},
+				maxRecords:      10,
+				expectedRecords: records,
+			},
+			"key": {
+				filter:          sebtopic.RecordFilter{Key: []byte("a")},
+				maxRecords:      10,
+				expectedRecords: [][]byte{records[2], records[4]},
+				expectedSkipped: 4,
+			},
+			"header": {
+				filter:          sebtopic.RecordFilter{Headers: map[string]string{"type": "created"}},
+				maxRecords:      10,
+				expectedRecords: [][]byte{records[2], records[3]},
+				expectedSkipped: 4,
+			},
+			"key and headers": {
+				filter:          sebtopic.RecordFilter{Key: []byte("b"), Headers: map[string]string{"type": "created", "region": "eu"}},
+				maxRecords:      10,
+				expectedRecords: [][]byte{records[3]},
+				expectedSkipped: 5,
+			},
+			"max records": {
+				filter:          sebtopic.RecordFilter{Key: []byte("b")},
+				maxRecords:      1,
+				expectedRecords: [][]byte{records[3]},
+				expectedSkipped: 3,
+			},
+			"no matches": {
+				filter:          sebtopic.RecordFilter{Key: []byte("c")},
+				offset:          1,
+				maxRecords:      10,
+				expectedRecords: nil,
+				expectedSkipped: 5,
+			},
+		}
+
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				ctx := sebtopic.WithRecordFilter(context.Background(), test.filter)
+				gotBatch := tester.NewBatch(10, 4096)
+
+				// Act
+				err := topic.ReadRecords(ctx, &gotBatch, test.offset, test.maxRecords, 0)
+
+				// Assert
+				require.NoError(t, err)
+				require.Equal(t, test.expectedRecords, gotBatch.IndividualRecords())
+				require.Equal(t, test.expectedSkipped, gotBatch.Skipped)
+			})
+		}
+	})
+}
@@ -0,0 +1,190 @@
+package sebtopic
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// diskWriter is returned by DiskStorage.Writer(). It writes to a temporary
+// file which is renamed to path when closed. When syncing is enabled, it hands
+// the file to its groupCommitter when closed. Once path has been replaced,
+// it's invalidated in files.
+type diskWriter struct {
+	*os.File
+	path      string
+	committer *groupCommitter
+	files     *fileHandlePool
+}
+
+func (w *diskWriter) Close() error {
+	defer w.files.invalidate(w.path)
+
+	if w.committer != nil && w.committer.ds.sync == DiskSyncEveryWrite {
+		return w.committer.commit(w.File, w.path)
+	}
+
+	err := w.File.Close()
+	if err != nil {
+		os.Remove(w.File.Name())
+		return err
+	}
+
+	err = os.Rename(w.File.Name(), w.path)
+	if err != nil {
+		os.Remove(w.File.Name())
+		return fmt.Errorf("renaming '%s': %w", w.File.Name(), err)
+	}
+
+	if w.committer != nil {
+		w.committer.syncLater(w.path)
+	}
+	return nil
+}
+
+// groupCommitter syncs files written to a single directory, i.e. a single
+// topic. Files that are committed while a sync round is in progress are
+// synced together in the next round, sharing the sync of the directory and
+// waking all of their writers at once.
+type groupCommitter struct {
+	ds  *DiskStorage
+	dir string
+
+	mu      sync.Mutex
+	syncing bool
+	pending []pendingSync
+
+	// pendingPaths and timer are used by DiskSyncInterval
+	pendingPaths []string
+	timer        *time.Timer
+}
+
+type pendingSync struct {
+	f    *os.File
+	path string
+	done chan error
+}
+
+// commit syncs and closes f and renames it to path, returning once f's data
+// and directory entry are on disk.
+func (c *groupCommitter) commit(f *os.File, path string) error {
+	ps := pendingSync{f: f, path: path, done: make(chan error, 1)}
+
+	c.mu.Lock()
+	c.pending = append(c.pending, ps)
+	if c.syncing {
+		// the current leader will sync f in its next round
+		c.mu.Unlock()
+		return <-ps.done
+	}
+	c.syncing = true
+	c.mu.Unlock()
+
+	// become leader, syncing rounds until no more files are pending
+	for {
+		c.mu.Lock()
+		pending := c.pending
+		c.pending = nil
+		if len(pending) == 0 {
+			c.syncing = false
+			c.mu.Unlock()
+			break
+		}
+		c.mu.Unlock()
+
+		c.syncRound(pending)
+	}
+
+	return <-ps.done
+}
+
+// syncRound syncs the files of pending, renames them to their paths, and syncs
+// the directory, reporting the result to their writers.
+func (c *groupCommitter) syncRound(pending []pendingSync) {
+	errs := make([]error, len(pending))
+	for i, ps := range pending {
+		err := ps.f.Sync()
+		if err != nil {
+			errs[i] = fmt.Errorf("syncing '%s': %w", ps.f.Name(), err)
+		}
+		errs[i] = errors.Join(errs[i], ps.f.Close())
+
+		if errs[i] == nil {
+			err = os.Rename(ps.f.Name(), ps.path)
+			if err != nil {
+				errs[i] = fmt.Errorf("renaming '%s': %w", ps.f.Name(), err)
+			}
+		}
+		if errs[i] != nil {
+			os.Remove(ps.f.Name())
+		}
+	}
+
+	dirErr := syncDir(c.dir)
+	c.ds.syncs.Add(1)
+
+	for i, ps := range pending {
+		ps.done <- errors.Join(errs[i], dirErr)
+	}
+}
+
+// syncLater schedules path to be synced within the configured sync interval.
+func (c *groupCommitter) syncLater(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pendingPaths = append(c.pendingPaths, path)
+	if c.timer == nil {
+		c.timer = time.AfterFunc(c.ds.syncInterval, c.syncPendingPaths)
+	}
+}
+
+// syncPendingPaths syncs the files scheduled by syncLater() along with the
+// directory.
+func (c *groupCommitter) syncPendingPaths() {
+	c.mu.Lock()
+	paths := c.pendingPaths
+	c.pendingPaths = nil
+	c.timer = nil
+	c.mu.Unlock()
+
+	for _, path := range paths {
+		err := syncPath(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			c.ds.log.Errorf("syncing '%s': %s", path, err)
+		}
+	}
+
+	err := syncDir(c.dir)
+	if err != nil {
+		c.ds.log.Errorf("syncing dir '%s': %s", c.dir, err)
+	}
+	c.ds.syncs.Add(1)
+}
+
+func syncPath(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return f.Sync()
+}
+
+// syncDir syncs dir, making the names of files created in it durable.
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("opening dir '%s': %w", dir, err)
+	}
+	defer f.Close()
+
+	err = f.Sync()
+	if err != nil {
+		return fmt.Errorf("syncing dir '%s': %w", dir, err)
+	}
+	return nil
+}
@@ -1,6 +1,10 @@
 package sebtopic_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"testing"
 
@@ -11,6 +15,7 @@ import (
 
 var compressors = []sebtopic.Compress{
 	sebtopic.Gzip{},
+	sebtopic.ParallelGzip{ChunkSize: 16, Workers: 3},
 }
 
 // TestCompressors verifies that all compressors can write random bytes and read
@@ -46,3 +51,100 @@ func TestCompressors(t *testing.T) {
 		}
 	}
 }
+
+// TestParallelGzipReadableByGzip verifies that data compressed by ParallelGzip
+// can be read by Gzip, regardless of how the data is split into chunks, and
+// that writes are returned in the order they were made.
+func TestParallelGzipReadableByGzip(t *testing.T) {
+	const chunkSize = 64
+
+	tests := map[string]struct {
+		size    int
+		workers int
+	}{
+		"empty":          {size: 0, workers: 2},
+		"less than one":  {size: chunkSize - 1, workers: 2},
+		"exactly one":    {size: chunkSize, workers: 2},
+		"many":           {size: 100*chunkSize + 7, workers: 4},
+		"single worker":  {size: 10*chunkSize + 1, workers: 1},
+		"exact multiple": {size: 8 * chunkSize, workers: 3},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			expectedBytes := tester.RandomBytes(t, test.size)
+			buf := bytes.Buffer{}
+
+			w, err := sebtopic.ParallelGzip{ChunkSize: chunkSize, Workers: test.workers}.NewWriter(&buf)
+			require.NoError(t, err)
+
+			// Act
+			// NOTE: odd write sizes ensure that writes span chunks.
+			for remaining := expectedBytes; len(remaining) > 0; {
+				n := min(len(remaining), 13)
+				_, err = w.Write(remaining[:n])
+				require.NoError(t, err)
+				remaining = remaining[n:]
+			}
+			err = w.Close()
+			require.NoError(t, err)
+
+			// Assert
+			r, err := sebtopic.Gzip{}.NewReader(&buf)
+			require.NoError(t, err)
+
+			gotBytes, err := io.ReadAll(r)
+			require.NoError(t, err)
+			require.Equal(t, len(expectedBytes), len(gotBytes))
+			require.True(t, bytes.Equal(expectedBytes, gotBytes))
+		})
+	}
+}
+
+// TestParallelGzipWriteError verifies that errors from the underlying writer
+// are returned.
+func TestParallelGzipWriteError(t *testing.T) {
+	expectedErr := fmt.Errorf("write failed")
+	w, err := sebtopic.ParallelGzip{ChunkSize: 16, Workers: 2}.NewWriter(failingWriter{err: expectedErr})
+	require.NoError(t, err)
+
+	// Act
+	_, writeErr := w.Write(tester.RandomBytes(t, 1024))
+	closeErr := w.Close()
+
+	// Assert
+	require.ErrorIs(t, errors.Join(writeErr, closeErr), expectedErr)
+}
+
+type failingWriter struct {
+	err error
+}
+
+func (w failingWriter) Write([]byte) (int, error) {
+	return 0, w.err
+}
+
+// TestTopicParallelGzip verifies that record batches written by a topic using
+// ParallelGzip can be read by a topic using Gzip.
+func TestTopicParallelGzip(t *testing.T) {
+	const topicName = "topic"
+	ctx := context.Background()
+	storage := sebtopic.NewMemoryStorage(log)
+
+	topic, err := sebtopic.New(log, storage, topicName, newMemoryCache(t), sebtopic.WithCompress(sebtopic.ParallelGzip{ChunkSize: 128, Workers: 4}))
+	require.NoError(t, err)
+
+	batch := tester.MakeRandomRecordBatchSize(64, 100)
+	_, err = topic.AddRecords(batch)
+	require.NoError(t, err)
+
+	// Act
+	reopened, err := sebtopic.New(log, storage, topicName, newMemoryCache(t), sebtopic.WithCompress(sebtopic.Gzip{}))
+	require.NoError(t, err)
+
+	// Assert
+	gotBatch := tester.NewBatch(64, 64*100)
+	err = reopened.ReadRecords(ctx, &gotBatch, 0, 64, 0)
+	require.NoError(t, err)
+	require.Equal(t, batch.IndividualRecords(), gotBatch.IndividualRecords())
+}
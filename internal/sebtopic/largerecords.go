@@ -0,0 +1,178 @@
+package sebtopic
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+const largeRecordExtension = ".large_record"
+
+// largeRecordPointerSizeBytes is the number of bytes used to store the size of
+// a large record in its pointer record. The remaining bytes of the pointer
+// record hold the large record's storage key.
+const largeRecordPointerSizeBytes = 8
+
+// LargeRecordKey returns the storage key of the record at offset, when the
+// record is stored separately from its record batch because it's large.
+func LargeRecordKey(topicName string, offset uint64) string {
+	return filepath.Join(topicName, fmt.Sprintf("%012d%s", offset, largeRecordExtension))
+}
+
+// offloadLargeRecords writes each record in batch that is larger than
+// s.largeRecordThreshold to its own object in backing storage, and returns a
+// batch in which those records are replaced by pointers to the objects.
+// firstOffset is the offset of the first record in batch.
+func (s *Topic) offloadLargeRecords(ctx context.Context, batch sebrecords.Batch, firstOffset uint64) (sebrecords.Batch, error) {
+	if s.largeRecordThreshold <= 0 {
+		return batch, nil
+	}
+
+	hasLargeRecords := false
+	for _, size := range batch.Sizes {
+		if int(size) > s.largeRecordThreshold {
+			hasLargeRecords = true
+			break
+		}
+	}
+	if !hasLargeRecords {
+		return batch, nil
+	}
+
+	pointerBatch := sebrecords.Batch{
+		Sizes:    make([]uint32, 0, batch.Len()),
+		Data:     make([]byte, 0, len(batch.Data)),
+		Expires:  batch.Expires,
+		Pointers: make([]bool, batch.Len()),
+		Traces:   batch.Traces,
+
+		Timestamps: batch.Timestamps,
+		Keys:       batch.Keys,
+		Headers:    batch.Headers,
+
+		ProducedUnixEpochUs: batch.ProducedUnixEpochUs,
+	}
+
+	dataOffset := uint32(0)
+	for i, size := range batch.Sizes {
+		record := batch.Data[dataOffset : dataOffset+size]
+		dataOffset += size
+
+		if int(size) <= s.largeRecordThreshold {
+			pointerBatch.Sizes = append(pointerBatch.Sizes, size)
+			pointerBatch.Data = append(pointerBatch.Data, record...)
+			continue
+		}
+
+		key := LargeRecordKey(s.topicName, firstOffset+uint64(i))
+		err := s.writeLargeRecord(ctx, key, record)
+		if err != nil {
+			return sebrecords.Batch{}, err
+		}
+
+		pointerStart := len(pointerBatch.Data)
+		pointerBatch.Data = binary.LittleEndian.AppendUint64(pointerBatch.Data, uint64(size))
+		pointerBatch.Data = append(pointerBatch.Data, key...)
+		pointerBatch.Sizes = append(pointerBatch.Sizes, uint32(len(pointerBatch.Data)-pointerStart))
+		pointerBatch.Pointers[i] = true
+	}
+
+	return pointerBatch, nil
+}
+
+func (s *Topic) writeLargeRecord(ctx context.Context, key string, record []byte) error {
+	wtr, err := s.backingStorage.Writer(ctx, key)
+	if err != nil {
+		return fmt.Errorf("opening writer '%s': %w", key, err)
+	}
+
+	_, err = wtr.Write(record)
+	if err != nil {
+		wtr.Close()
+		return fmt.Errorf("writing large record '%s': %w", key, err)
+	}
+
+	err = wtr.Close()
+	if err != nil {
+		return fmt.Errorf("closing large record writer '%s': %w", key, err)
+	}
+	s.usage.set(key, int64(len(record)))
+
+	return nil
+}
+
+// readPointer returns the size and storage key of the large record that the
+// pointer record at recordIndex points to.
+func readPointer(rb *sebrecords.Parser, recordIndex uint32) (uint32, string, error) {
+	pointerSize := rb.RecordSizes[recordIndex]
+	if pointerSize < largeRecordPointerSizeBytes {
+		return 0, "", fmt.Errorf("pointer record %d too small (%d bytes)", recordIndex, pointerSize)
+	}
+
+	pointer := sebrecords.NewBatch(make([]uint32, 0, 1), make([]byte, 0, pointerSize))
+	err := rb.Records(&pointer, recordIndex, recordIndex+1)
+	if err != nil {
+		return 0, "", fmt.Errorf("reading pointer record %d: %w", recordIndex, err)
+	}
+
+	size := binary.LittleEndian.Uint64(pointer.Data)
+	key := string(pointer.Data[largeRecordPointerSizeBytes:])
+	return uint32(size), key, nil
+}
+
+// readLargeRecord reads the large record stored at key into batch.
+func (s *Topic) readLargeRecord(ctx context.Context, batch *sebrecords.Batch, key string, size uint32) error {
+	bytesLeftInBatch := cap(batch.Data) - len(batch.Data)
+	if int(size) > bytesLeftInBatch {
+		return fmt.Errorf("%w: not enough bytes left in buffer to read large record; %d required, %d left", seberr.ErrBufferTooSmall, size, bytesLeftInBatch)
+	}
+	if batch.Len() == cap(batch.Sizes) {
+		return fmt.Errorf("%w: not enough records left in buffer to read large record", seberr.ErrBufferTooSmall)
+	}
+
+	rdr, err := s.backingStorage.Reader(ctx, key)
+	if err != nil {
+		return fmt.Errorf("opening large record '%s': %w", key, err)
+	}
+	defer rdr.Close()
+
+	buf := batch.Data[len(batch.Data) : len(batch.Data)+int(size)]
+	_, err = io.ReadFull(rdr, buf)
+	if err != nil {
+		return fmt.Errorf("reading large record '%s': %w", key, err)
+	}
+
+	batch.Data = batch.Data[:len(batch.Data)+int(size)]
+	batch.Sizes = append(batch.Sizes, size)
+
+	return nil
+}
+
+// deleteLargeRecords deletes the large records pointed to by the pointer
+// records in rb.
+func (s *Topic) deleteLargeRecords(rb *sebrecords.Parser) error {
+	for recordIndex := range rb.Header.NumRecords {
+		if !rb.IsPointer(recordIndex) {
+			continue
+		}
+
+		_, key, err := readPointer(rb, recordIndex)
+		if err != nil {
+			return err
+		}
+
+		err = s.backingStorage.Delete(key)
+		if err != nil && !errors.Is(err, seberr.ErrNotInStorage) {
+			return fmt.Errorf("deleting large record '%s': %w", key, err)
+		}
+		s.usage.remove(key)
+	}
+
+	return nil
+}
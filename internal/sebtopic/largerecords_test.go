@@ -0,0 +1,117 @@
+package sebtopic_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/stretchr/testify/require"
+)
+
+const largeRecordThreshold = 1024
+
+// TestTopicLargeRecords verifies that records above the large record
+// threshold are stored as separate objects, and that they're transparently
+// returned by ReadRecords(), also after the topic has been reopened.
+func TestTopicLargeRecords(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		const topicName = "topic"
+		topic, err := sebtopic.New(log, storage, topicName, cache, sebtopic.WithLargeRecordThreshold(largeRecordThreshold))
+		require.NoError(t, err)
+
+		records := [][]byte{
+			tester.RandomBytes(t, 10),
+			tester.RandomBytes(t, 4*largeRecordThreshold),
+			tester.RandomBytes(t, largeRecordThreshold),
+			tester.RandomBytes(t, largeRecordThreshold+1),
+			tester.RandomBytes(t, 20),
+		}
+
+		// Act
+		_, err = topic.AddRecords(tester.RecordsToBatch(records))
+		require.NoError(t, err)
+
+		// Assert
+		largeRecordFiles, err := storage.ListFiles(context.Background(), topicName, ".large_record")
+		require.NoError(t, err)
+		require.Equal(t, 2, len(largeRecordFiles))
+
+		segments, err := topic.Segments()
+		require.NoError(t, err)
+		require.Equal(t, 1, len(segments))
+		require.Less(t, segments[0].Size, int64(2*largeRecordThreshold))
+
+		for _, topic := range []*sebtopic.Topic{topic, reopenTopic(t, storage, topicName, cache)} {
+			gotBatch := tester.NewBatch(len(records), 10*largeRecordThreshold)
+			err = topic.ReadRecords(context.Background(), &gotBatch, 0, len(records), 0)
+			require.NoError(t, err)
+			require.Equal(t, records, gotBatch.IndividualRecords())
+
+			// read starting from a large record
+			gotBatch.Reset()
+			err = topic.ReadRecords(context.Background(), &gotBatch, 3, len(records), 0)
+			require.NoError(t, err)
+			require.Equal(t, records[3:], gotBatch.IndividualRecords())
+		}
+	})
+}
+
+// TestTopicLargeRecordsSoftMaxBytes verifies that the size of large records,
+// not their pointers, count towards ReadRecords()'s softMaxBytes.
+func TestTopicLargeRecordsSoftMaxBytes(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		topic, err := sebtopic.New(log, storage, "topic", cache, sebtopic.WithLargeRecordThreshold(largeRecordThreshold))
+		require.NoError(t, err)
+
+		records := [][]byte{
+			tester.RandomBytes(t, 2*largeRecordThreshold),
+			tester.RandomBytes(t, 2*largeRecordThreshold),
+			tester.RandomBytes(t, 10),
+		}
+		_, err = topic.AddRecords(tester.RecordsToBatch(records))
+		require.NoError(t, err)
+
+		// Act
+		gotBatch := tester.NewBatch(len(records), 10*largeRecordThreshold)
+		err = topic.ReadRecords(context.Background(), &gotBatch, 0, len(records), 3*largeRecordThreshold)
+
+		// Assert
+		require.NoError(t, err)
+		require.Equal(t, records[:1], gotBatch.IndividualRecords())
+	})
+}
+
+// TestTopicDropExpiredBatchesDeletesLargeRecords verifies that large records
+// are deleted along with the expired record batch that points to them.
+func TestTopicDropExpiredBatchesDeletesLargeRecords(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		const topicName = "topic"
+		topic, err := sebtopic.New(log, storage, topicName, cache, sebtopic.WithLargeRecordThreshold(largeRecordThreshold))
+		require.NoError(t, err)
+
+		expired := time.Now().Add(-time.Hour).UnixMicro()
+		for _, batchExpires := range [][]int64{{expired, expired}, {0, 0}} {
+			batch := tester.RecordsToBatch([][]byte{
+				tester.RandomBytes(t, 2*largeRecordThreshold),
+				tester.RandomBytes(t, 10),
+			})
+			batch.Expires = batchExpires
+			_, err = topic.AddRecords(batch)
+			require.NoError(t, err)
+		}
+
+		// Act
+		dropped, err := topic.DropExpiredBatches(time.Now())
+		require.NoError(t, err)
+
+		// Assert
+		require.Equal(t, 1, dropped)
+
+		largeRecordFiles, err := storage.ListFiles(context.Background(), topicName, ".large_record")
+		require.NoError(t, err)
+		require.Equal(t, 1, len(largeRecordFiles))
+	})
+}
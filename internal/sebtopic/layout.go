@@ -0,0 +1,130 @@
+package sebtopic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+const (
+	// LayoutVersion is the version of the layout of files in storage that
+	// this version of seb writes. It must be incremented whenever the layout
+	// changes in a way that older versions can't read.
+	//
+	// Version 2 allows record batches to be named with epochs; see
+	// RecordBatchName.
+	LayoutVersion = 2
+
+	// layoutVersionMin is the oldest layout version that this version of seb
+	// can read.
+	layoutVersionMin = 1
+
+	layoutVersionKey = "_layout/version.json"
+)
+
+type layoutMarker struct {
+	Version int `json:"version"`
+}
+
+// CheckLayoutVersion verifies that the layout of files in storage can be read
+// by this version of seb, such that data written by an incompatible version
+// is refused up front instead of failing in subtle ways when it's parsed.
+//
+// The layout version is read from a marker file in the root of storage. If
+// there is no marker, e.g. on first start, a marker with LayoutVersion is
+// written. If the marker holds a version that can't be read, an error
+// wrapping seberr.ErrIncompatibleLayout is returned.
+//
+// The layout version of storage is returned.
+func CheckLayoutVersion(ctx context.Context, log logger.Logger, storage Storage) (int, error) {
+	version, err := readLayoutVersion(ctx, storage)
+	if errors.Is(err, seberr.ErrNotInStorage) {
+		log.Infof("no layout version found, writing layout version %d", LayoutVersion)
+		err = writeLayoutVersion(ctx, storage, LayoutVersion)
+		if err != nil {
+			return 0, err
+		}
+		return LayoutVersion, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if version > LayoutVersion {
+		return version, fmt.Errorf("%w: storage was written using layout version %d, but this version of seb only supports layout versions up to %d; upgrade seb to open it", seberr.ErrIncompatibleLayout, version, LayoutVersion)
+	}
+	if version < layoutVersionMin {
+		return version, fmt.Errorf("%w: storage was written using layout version %d, but this version of seb only supports layout versions from %d; open it using an older version of seb and migrate it first", seberr.ErrIncompatibleLayout, version, layoutVersionMin)
+	}
+
+	return version, nil
+}
+
+// UpgradeLayoutVersion upgrades the layout version of storage to
+// LayoutVersion, such that older versions of seb refuse to open it. It must be
+// called before writing files that older versions can't read, e.g. record
+// batches named with epochs. Storage must have been checked using
+// CheckLayoutVersion.
+func UpgradeLayoutVersion(ctx context.Context, log logger.Logger, storage Storage) error {
+	version, err := readLayoutVersion(ctx, storage)
+	if err != nil {
+		return err
+	}
+	if version >= LayoutVersion {
+		return nil
+	}
+
+	log.Infof("upgrading layout version from %d to %d", version, LayoutVersion)
+	return writeLayoutVersion(ctx, storage, LayoutVersion)
+}
+
+func readLayoutVersion(ctx context.Context, storage Storage) (int, error) {
+	rdr, err := storage.Reader(ctx, layoutVersionKey)
+	if err != nil {
+		return 0, fmt.Errorf("opening layout version: %w", err)
+	}
+	defer rdr.Close()
+
+	bs, err := io.ReadAll(rdr)
+	if err != nil {
+		return 0, fmt.Errorf("reading layout version: %w", err)
+	}
+
+	marker := layoutMarker{}
+	err = json.Unmarshal(bs, &marker)
+	if err != nil {
+		return 0, fmt.Errorf("%w: parsing layout version '%s': %s", seberr.ErrIncompatibleLayout, layoutVersionKey, err)
+	}
+
+	return marker.Version, nil
+}
+
+func writeLayoutVersion(ctx context.Context, storage Storage, version int) error {
+	bs, err := json.Marshal(layoutMarker{Version: version})
+	if err != nil {
+		return fmt.Errorf("marshaling layout version: %w", err)
+	}
+
+	wtr, err := storage.Writer(ctx, layoutVersionKey)
+	if err != nil {
+		return fmt.Errorf("creating layout version writer: %w", err)
+	}
+
+	_, err = wtr.Write(bs)
+	if err != nil {
+		wtr.Close()
+		return fmt.Errorf("writing layout version: %w", err)
+	}
+
+	err = wtr.Close()
+	if err != nil {
+		return fmt.Errorf("closing layout version writer: %w", err)
+	}
+
+	return nil
+}
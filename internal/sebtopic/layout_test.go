@@ -0,0 +1,94 @@
+package sebtopic_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCheckLayoutVersion verifies that CheckLayoutVersion writes the current
+// layout version to storage that doesn't have one, and that it's accepted on
+// subsequent checks.
+func TestCheckLayoutVersion(t *testing.T) {
+	tester.TestBackingStorage(t, func(t *testing.T, storage sebtopic.Storage) {
+		ctx := context.Background()
+
+		// Act
+		version, err := sebtopic.CheckLayoutVersion(ctx, log, storage)
+
+		// Assert
+		require.NoError(t, err)
+		require.Equal(t, sebtopic.LayoutVersion, version)
+
+		// Act
+		version, err = sebtopic.CheckLayoutVersion(ctx, log, storage)
+
+		// Assert
+		require.NoError(t, err)
+		require.Equal(t, sebtopic.LayoutVersion, version)
+	})
+}
+
+// TestCheckLayoutVersionIncompatible verifies that CheckLayoutVersion returns
+// seberr.ErrIncompatibleLayout when storage holds a layout version that can't
+// be read, and that the layout version marker isn't overwritten.
+func TestCheckLayoutVersionIncompatible(t *testing.T) {
+	tests := map[string]struct {
+		marker string
+	}{
+		"future version": {marker: fmt.Sprintf(`{"version": %d}`, sebtopic.LayoutVersion+1)},
+		"old version":    {marker: `{"version": 0}`},
+		"corrupt":        {marker: `not json`},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			storage := sebtopic.NewMemoryStorage(log)
+
+			wtr, err := storage.Writer(ctx, "_layout/version.json")
+			require.NoError(t, err)
+			tester.WriteAndClose(t, wtr, []byte(test.marker))
+
+			// Act
+			_, err = sebtopic.CheckLayoutVersion(ctx, log, storage)
+
+			// Assert
+			require.ErrorIs(t, err, seberr.ErrIncompatibleLayout)
+
+			rdr, err := storage.Reader(ctx, "_layout/version.json")
+			require.NoError(t, err)
+			require.Equal(t, test.marker, string(tester.ReadAndClose(t, rdr)))
+		})
+	}
+}
+
+// TestUpgradeLayoutVersion verifies that UpgradeLayoutVersion upgrades storage
+// of layout version 1 to LayoutVersion, and that storage of version 1 can
+// still be opened.
+func TestUpgradeLayoutVersion(t *testing.T) {
+	ctx := context.Background()
+	storage := sebtopic.NewMemoryStorage(log)
+
+	wtr, err := storage.Writer(ctx, "_layout/version.json")
+	require.NoError(t, err)
+	tester.WriteAndClose(t, wtr, []byte(`{"version": 1}`))
+
+	version, err := sebtopic.CheckLayoutVersion(ctx, log, storage)
+	require.NoError(t, err)
+	require.Equal(t, 1, version)
+
+	// Act
+	err = sebtopic.UpgradeLayoutVersion(ctx, log, storage)
+	require.NoError(t, err)
+
+	// Assert
+	version, err = sebtopic.CheckLayoutVersion(ctx, log, storage)
+	require.NoError(t, err)
+	require.Equal(t, sebtopic.LayoutVersion, version)
+}
@@ -0,0 +1,279 @@
+package sebtopic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// A topic's lease gives a single broker, its holder, the right to add record
+// batches to the topic for a limited amount of time. Brokers sharing the same
+// storage use leases to ensure that only one of them writes to a topic at a
+// time; see WithLease.
+//
+// Each time a lease changes holder, its epoch is incremented, and the new
+// holder names the record batches it adds with it. Since record batches of
+// older epochs are ignored once record batches of a newer epoch exist, record
+// batches that the previous holder manages to write after losing the lease are
+// never read. See RecordBatchName.
+//
+// NOTE: storage doesn't support conditional writes, so two brokers acquiring
+// an expired lease at the same time may both believe that they hold it. The
+// broker that lost will notice when it next renews the lease.
+type topicLease struct {
+	Holder    string    `json:"holder"`
+	Epoch     uint64    `json:"epoch"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+const leaseExtension = ".topic_lease"
+
+// LeaseKey returns the storage key of topicName's lease.
+func LeaseKey(topicName string) string {
+	return filepath.Join(topicName, "lease"+leaseExtension)
+}
+
+// LeaseOpts configures the lease that a topic must hold in order to add
+// record batches.
+type LeaseOpts struct {
+	// Holder identifies the broker holding the lease, and must be unique
+	// among brokers sharing the same storage.
+	Holder string
+
+	// TTL is the amount of time that the lease is held for after it was
+	// acquired or last renewed.
+	TTL time.Duration
+}
+
+// leaser holds a topic's lease.
+type leaser struct {
+	storage   Storage
+	topicName string
+	opts      LeaseOpts
+
+	mu    sync.Mutex
+	epoch uint64
+	// expiresAt is when the lease expires according to the local clock. It's
+	// measured from before the lease was read, such that it never exceeds
+	// the expiry seen by other brokers.
+	expiresAt time.Time
+	lost      bool
+}
+
+func newLeaser(storage Storage, topicName string, opts LeaseOpts) *leaser {
+	return &leaser{
+		storage:   storage,
+		topicName: topicName,
+		opts:      opts,
+	}
+}
+
+// acquire acquires the lease, incrementing its epoch, and returns the epoch.
+// minEpoch is the lowest epoch that the lease may be acquired with. An error
+// wrapping seberr.ErrLeaseLost is returned if the lease is held by another
+// broker.
+func (l *leaser) acquire(ctx context.Context, minEpoch uint64) (uint64, error) {
+	t0 := time.Now()
+	current, err := readLease(ctx, l.storage, l.topicName)
+	if err != nil && !errors.Is(err, seberr.ErrNotInStorage) {
+		return 0, err
+	}
+	if err == nil && current.Holder != l.opts.Holder && t0.Before(current.ExpiresAt) {
+		return 0, fmt.Errorf("%w: lease of topic '%s' is held by '%s' until %s", seberr.ErrLeaseLost, l.topicName, current.Holder, current.ExpiresAt.Format(time.RFC3339))
+	}
+
+	lease := topicLease{
+		Holder:    l.opts.Holder,
+		Epoch:     max(current.Epoch+1, minEpoch),
+		ExpiresAt: t0.Add(l.opts.TTL),
+	}
+	err = writeLease(ctx, l.storage, l.topicName, lease)
+	if err != nil {
+		return 0, err
+	}
+
+	// another broker may have acquired the lease concurrently
+	written, err := readLease(ctx, l.storage, l.topicName)
+	if err != nil {
+		return 0, err
+	}
+	if written.Holder != lease.Holder || written.Epoch != lease.Epoch {
+		return 0, fmt.Errorf("%w: lease of topic '%s' was acquired concurrently by '%s'", seberr.ErrLeaseLost, l.topicName, written.Holder)
+	}
+
+	l.mu.Lock()
+	l.epoch = lease.Epoch
+	l.expiresAt = lease.ExpiresAt
+	l.lost = false
+	l.mu.Unlock()
+
+	return lease.Epoch, nil
+}
+
+// renew extends the lease by its TTL. An error wrapping seberr.ErrLeaseLost is
+// returned if the lease was lost, in which case it can't be renewed.
+func (l *leaser) renew(ctx context.Context) error {
+	l.mu.Lock()
+	epoch, lost := l.epoch, l.lost
+	l.mu.Unlock()
+	if lost {
+		return fmt.Errorf("%w: lease of topic '%s' was lost", seberr.ErrLeaseLost, l.topicName)
+	}
+
+	t0 := time.Now()
+	current, err := readLease(ctx, l.storage, l.topicName)
+	if err != nil {
+		return err
+	}
+	if current.Holder != l.opts.Holder || current.Epoch != epoch {
+		l.markLost()
+		return fmt.Errorf("%w: lease of topic '%s' was taken over by '%s'", seberr.ErrLeaseLost, l.topicName, current.Holder)
+	}
+
+	// NOTE: once expired, the lease may be taken over by another broker at
+	// any time, and must not be renewed.
+	if !t0.Before(current.ExpiresAt) {
+		l.markLost()
+		return fmt.Errorf("%w: lease of topic '%s' expired at %s", seberr.ErrLeaseLost, l.topicName, current.ExpiresAt.Format(time.RFC3339))
+	}
+
+	current.ExpiresAt = t0.Add(l.opts.TTL)
+	err = writeLease(ctx, l.storage, l.topicName, current)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.expiresAt = current.ExpiresAt
+	l.mu.Unlock()
+
+	return nil
+}
+
+// release expires the lease, allowing other brokers to acquire it right away.
+func (l *leaser) release(ctx context.Context) error {
+	l.mu.Lock()
+	epoch, lost := l.epoch, l.lost
+	l.lost = true
+	l.mu.Unlock()
+	if lost {
+		return nil
+	}
+
+	current, err := readLease(ctx, l.storage, l.topicName)
+	if err != nil {
+		return err
+	}
+	if current.Holder != l.opts.Holder || current.Epoch != epoch {
+		return nil
+	}
+
+	current.ExpiresAt = time.Now()
+	return writeLease(ctx, l.storage, l.topicName, current)
+}
+
+func (l *leaser) markLost() {
+	l.mu.Lock()
+	l.lost = true
+	l.mu.Unlock()
+}
+
+// check returns an error wrapping seberr.ErrLeaseLost if the lease isn't
+// currently held.
+func (l *leaser) check() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.lost {
+		return fmt.Errorf("%w: lease of topic '%s' was lost", seberr.ErrLeaseLost, l.topicName)
+	}
+	if !time.Now().Before(l.expiresAt) {
+		return fmt.Errorf("%w: lease of topic '%s' expired at %s", seberr.ErrLeaseLost, l.topicName, l.expiresAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func readLease(ctx context.Context, storage Storage, topicName string) (topicLease, error) {
+	key := LeaseKey(topicName)
+	rdr, err := storage.Reader(ctx, key)
+	if err != nil {
+		return topicLease{}, fmt.Errorf("opening lease '%s': %w", key, err)
+	}
+	defer rdr.Close()
+
+	bs, err := io.ReadAll(rdr)
+	if err != nil {
+		return topicLease{}, fmt.Errorf("reading lease '%s': %w", key, err)
+	}
+
+	lease := topicLease{}
+	err = json.Unmarshal(bs, &lease)
+	if err != nil {
+		return topicLease{}, fmt.Errorf("parsing lease '%s': %w", key, err)
+	}
+
+	return lease, nil
+}
+
+func writeLease(ctx context.Context, storage Storage, topicName string, lease topicLease) error {
+	key := LeaseKey(topicName)
+	bs, err := json.Marshal(lease)
+	if err != nil {
+		return fmt.Errorf("marshaling lease: %w", err)
+	}
+
+	wtr, err := storage.Writer(ctx, key)
+	if err != nil {
+		return fmt.Errorf("opening lease writer '%s': %w", key, err)
+	}
+
+	_, err = wtr.Write(bs)
+	if err != nil {
+		wtr.Close()
+		return fmt.Errorf("writing lease '%s': %w", key, err)
+	}
+
+	err = wtr.Close()
+	if err != nil {
+		return fmt.Errorf("closing lease writer '%s': %w", key, err)
+	}
+
+	return nil
+}
+
+// RenewLease extends the topic's lease. An error wrapping seberr.ErrLeaseLost
+// is returned if the lease was lost, in which case the topic rejects writes
+// until it's opened again. RenewLease is a no-op for topics without a lease.
+// See WithLease.
+func (s *Topic) RenewLease(ctx context.Context) error {
+	if s.lease == nil {
+		return nil
+	}
+	return s.lease.renew(ctx)
+}
+
+// ReleaseLease gives up the topic's lease, allowing other brokers to acquire
+// it right away. The topic rejects writes afterwards. ReleaseLease is a no-op
+// for topics without a lease.
+func (s *Topic) ReleaseLease(ctx context.Context) error {
+	if s.lease == nil {
+		return nil
+	}
+	return s.lease.release(ctx)
+}
+
+// checkLease returns an error wrapping seberr.ErrLeaseLost if the topic uses a
+// lease that it doesn't currently hold.
+func (s *Topic) checkLease() error {
+	if s.lease == nil {
+		return nil
+	}
+	return s.lease.check()
+}
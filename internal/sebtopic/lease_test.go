@@ -0,0 +1,132 @@
+package sebtopic_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTopicLeaseHeld verifies that a topic can't be opened for writing while
+// its lease is held by another broker, but can be opened read-only, and that
+// record batches are named with the epoch of the lease.
+func TestTopicLeaseHeld(t *testing.T) {
+	const topicName = "topic"
+	storage := sebtopic.NewMemoryStorage(log)
+
+	topic, err := sebtopic.New(log, storage, topicName, newMemoryCache(t), sebtopic.WithLease("broker-a", time.Minute))
+	require.NoError(t, err)
+	_, err = topic.AddRecords(tester.MakeRandomRecordBatch(2))
+	require.NoError(t, err)
+	require.Equal(t, sebtopic.RecordBatchName{ID: 0, Epoch: 1}.Key(topicName), topic.RecordBatchKey(0))
+
+	// Act
+	_, err = sebtopic.New(log, storage, topicName, newMemoryCache(t), sebtopic.WithLease("broker-b", time.Minute))
+
+	// Assert
+	require.ErrorIs(t, err, seberr.ErrLeaseLost)
+	require.ErrorIs(t, err, seberr.ErrWritesFrozen)
+
+	// Act
+	readOnly, err := sebtopic.New(log, storage, topicName, newMemoryCache(t), sebtopic.WithLease("broker-b", time.Minute), sebtopic.WithReadOnly(true))
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), readOnly.NextOffset())
+}
+
+// TestTopicLeaseExpired verifies that writes are rejected once a topic's lease
+// expires, that another broker can then acquire it with a newer epoch, and
+// that the broker that lost the lease can't renew it.
+func TestTopicLeaseExpired(t *testing.T) {
+	const (
+		topicName = "topic"
+		ttl       = 50 * time.Millisecond
+	)
+	ctx := context.Background()
+	storage := sebtopic.NewMemoryStorage(log)
+
+	topicA, err := sebtopic.New(log, storage, topicName, newMemoryCache(t), sebtopic.WithLease("broker-a", ttl))
+	require.NoError(t, err)
+	batch := tester.MakeRandomRecordBatch(2)
+	_, err = topicA.AddRecords(batch)
+	require.NoError(t, err)
+	expectedRecords := batch.IndividualRecords()
+
+	time.Sleep(ttl)
+
+	// Act
+	_, err = topicA.AddRecords(tester.MakeRandomRecordBatch(2))
+
+	// Assert
+	require.ErrorIs(t, err, seberr.ErrLeaseLost)
+
+	// Act
+	topicB, err := sebtopic.New(log, storage, topicName, newMemoryCache(t), sebtopic.WithLease("broker-b", time.Minute))
+	require.NoError(t, err)
+	batch = tester.MakeRandomRecordBatch(3)
+	_, err = topicB.AddRecords(batch)
+	require.NoError(t, err)
+	expectedRecords = append(expectedRecords, batch.IndividualRecords()...)
+
+	// Assert
+	require.Equal(t, sebtopic.RecordBatchName{ID: 2, Epoch: 2}.Key(topicName), topicB.RecordBatchKey(2))
+	require.ErrorIs(t, topicA.RenewLease(ctx), seberr.ErrLeaseLost)
+
+	gotBatch := tester.NewBatch(5, 4096)
+	err = topicB.ReadRecords(ctx, &gotBatch, 0, 5, 0)
+	require.NoError(t, err)
+	require.Equal(t, expectedRecords, gotBatch.IndividualRecords())
+}
+
+// TestTopicLeaseRenew verifies that renewing a topic's lease keeps it writable
+// beyond the lease's initial TTL.
+func TestTopicLeaseRenew(t *testing.T) {
+	const ttl = 100 * time.Millisecond
+	ctx := context.Background()
+	storage := sebtopic.NewMemoryStorage(log)
+
+	topic, err := sebtopic.New(log, storage, "topic", newMemoryCache(t), sebtopic.WithLease("broker-a", ttl))
+	require.NoError(t, err)
+
+	for range 3 {
+		time.Sleep(ttl / 2)
+
+		// Act
+		err = topic.RenewLease(ctx)
+		require.NoError(t, err)
+
+		// Assert
+		_, err = topic.AddRecords(tester.MakeRandomRecordBatch(1))
+		require.NoError(t, err)
+	}
+}
+
+// TestTopicLeaseRelease verifies that a released lease can be acquired by
+// another broker right away, and that the topic that released it rejects
+// writes.
+func TestTopicLeaseRelease(t *testing.T) {
+	const topicName = "topic"
+	ctx := context.Background()
+	storage := sebtopic.NewMemoryStorage(log)
+
+	topicA, err := sebtopic.New(log, storage, topicName, newMemoryCache(t), sebtopic.WithLease("broker-a", time.Minute))
+	require.NoError(t, err)
+
+	// Act
+	err = topicA.ReleaseLease(ctx)
+	require.NoError(t, err)
+
+	// Assert
+	_, err = topicA.AddRecords(tester.MakeRandomRecordBatch(1))
+	require.ErrorIs(t, err, seberr.ErrLeaseLost)
+
+	topicB, err := sebtopic.New(log, storage, topicName, newMemoryCache(t), sebtopic.WithLease("broker-b", time.Minute))
+	require.NoError(t, err)
+	_, err = topicB.AddRecords(tester.MakeRandomRecordBatch(1))
+	require.NoError(t, err)
+}
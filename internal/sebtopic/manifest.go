@@ -0,0 +1,366 @@
+package sebtopic
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"path/filepath"
+	"slices"
+
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// The manifest of a topic holds the name of its latest record batch and its
+// next offset. It is rewritten every time a record batch is added, and allows
+// a topic to be opened by reading a single small object instead of listing
+// its record batches or reading its offset index, both of which grow with the
+// number of record batches.
+//
+// Topics that are opened from their manifest only know about their latest
+// record batches. The offsets of the rest of their record batches are loaded
+// the first time they're needed; see loadRecordBatchOffsets.
+//
+// Format (little endian):
+//
+//	magic            [4]byte "sebm"
+//	version          uint16
+//	latestBatchID    uint64
+//	nextOffset       uint64
+//	latestBatchEpoch uint64 (version 2+)
+//	flags            uint8  (version 3+, bit 0: sealed)
+//	checksum         uint32 (crc32 of all of the above)
+
+const manifestExtension = ".topic_manifest"
+
+var (
+	manifestMagic   = [4]byte{'s', 'e', 'b', 'm'}
+	errManifestBad  = errors.New("bad manifest")
+	manifestVersion = uint16(3)
+)
+
+const (
+	manifestSizeV1 = 4 + 2 + 8 + 8 + 4
+	manifestSizeV2 = manifestSizeV1 + 8
+	manifestSize   = manifestSizeV2 + 1
+)
+
+const manifestFlagSealed = uint8(1 << 0)
+
+// ManifestKey returns the storage key of topicName's manifest.
+func ManifestKey(topicName string) string {
+	return filepath.Join(topicName, "manifest"+manifestExtension)
+}
+
+type manifest struct {
+	latestBatchID    uint64
+	nextOffset       uint64
+	latestBatchEpoch uint64
+	sealed           bool
+}
+
+func writeManifest(ctx context.Context, storage Storage, topicName string, m manifest) error {
+	buf := bytes.NewBuffer(make([]byte, 0, manifestSize))
+	buf.Write(manifestMagic[:])
+	binary.Write(buf, binary.LittleEndian, manifestVersion)
+	binary.Write(buf, binary.LittleEndian, m.latestBatchID)
+	binary.Write(buf, binary.LittleEndian, m.nextOffset)
+	binary.Write(buf, binary.LittleEndian, m.latestBatchEpoch)
+	flags := uint8(0)
+	if m.sealed {
+		flags |= manifestFlagSealed
+	}
+	buf.WriteByte(flags)
+	binary.Write(buf, binary.LittleEndian, crc32.ChecksumIEEE(buf.Bytes()))
+
+	key := ManifestKey(topicName)
+	w, err := storage.Writer(ctx, key)
+	if err != nil {
+		return fmt.Errorf("opening writer '%s': %w", key, err)
+	}
+
+	_, err = w.Write(buf.Bytes())
+	if err != nil {
+		w.Close()
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+
+	err = w.Close()
+	if err != nil {
+		return fmt.Errorf("closing manifest: %w", err)
+	}
+
+	return nil
+}
+
+// readManifest reads the manifest of topicName. It returns
+// seberr.ErrNotInStorage if there's no manifest, and errManifestBad if the
+// manifest can't be parsed.
+func readManifest(ctx context.Context, storage Storage, topicName string) (manifest, error) {
+	key := ManifestKey(topicName)
+	r, err := storage.Reader(ctx, key)
+	if err != nil {
+		return manifest{}, fmt.Errorf("opening reader '%s': %w", key, err)
+	}
+	defer r.Close()
+
+	bs, err := io.ReadAll(r)
+	if err != nil {
+		return manifest{}, fmt.Errorf("reading manifest: %w", err)
+	}
+
+	if len(bs) != manifestSize && len(bs) != manifestSizeV2 && len(bs) != manifestSizeV1 {
+		return manifest{}, fmt.Errorf("%w: expected %d bytes, got %d", errManifestBad, manifestSize, len(bs))
+	}
+
+	const checksumSize = 4
+	data, checksum := bs[:len(bs)-checksumSize], binary.LittleEndian.Uint32(bs[len(bs)-checksumSize:])
+	if crc32.ChecksumIEEE(data) != checksum {
+		return manifest{}, fmt.Errorf("%w: checksum mismatch", errManifestBad)
+	}
+
+	if !bytes.Equal(data[:4], manifestMagic[:]) {
+		return manifest{}, fmt.Errorf("%w: bad magic", errManifestBad)
+	}
+
+	version := binary.LittleEndian.Uint16(data[4:])
+	expectedSize := manifestSize
+	switch version {
+	case 1:
+		expectedSize = manifestSizeV1
+	case 2:
+		expectedSize = manifestSizeV2
+	}
+	if version > manifestVersion || len(bs) != expectedSize {
+		return manifest{}, fmt.Errorf("%w: unsupported version %d", errManifestBad, version)
+	}
+
+	m := manifest{
+		latestBatchID: binary.LittleEndian.Uint64(data[6:]),
+		nextOffset:    binary.LittleEndian.Uint64(data[14:]),
+	}
+	if version >= 2 {
+		m.latestBatchEpoch = binary.LittleEndian.Uint64(data[22:])
+	}
+	if version >= 3 {
+		m.sealed = data[30]&manifestFlagSealed != 0
+	}
+
+	return m, nil
+}
+
+// loadManifest loads the topic's latest record batch offsets, their epochs
+// and the topic's next offset from its manifest, catching up on record
+// batches added since the manifest was written. It returns
+// seberr.ErrNotInStorage if there's no manifest, and errManifestBad if the
+// manifest can't be used.
+func (s *Topic) loadManifest(ctx context.Context) ([]uint64, *recordBatchEpochs, uint64, error) {
+	m, err := readManifest(ctx, s.backingStorage, s.topicName)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	s.sealed.Store(m.sealed)
+
+	recordBatchOffsets := []uint64{}
+	epochs := &recordBatchEpochs{}
+	nextOffset := m.nextOffset
+	if nextOffset > 0 {
+		if m.latestBatchID >= nextOffset {
+			return nil, nil, 0, fmt.Errorf("%w: latest batch %d beyond next offset %d", errManifestBad, m.latestBatchID, nextOffset)
+		}
+		recordBatchOffsets = append(recordBatchOffsets, m.latestBatchID)
+		epochs.add(RecordBatchName{ID: m.latestBatchID, Epoch: m.latestBatchEpoch})
+	}
+
+	recordBatchOffsets, nextOffset, err = s.catchUp(ctx, epochs, recordBatchOffsets, nextOffset)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	s.log.Debugf("loaded manifest, caught up on %d record batches", len(recordBatchOffsets)-min(len(recordBatchOffsets), 1))
+
+	return recordBatchOffsets, epochs, nextOffset, nil
+}
+
+// catchUp probes for record batches at nextOffset that were added after the
+// manifest or offset index that recordBatchOffsets, epochs and nextOffset were
+// loaded from was written. The offsets of found record batches are appended
+// to recordBatchOffsets and their epochs added to epochs. The updated
+// recordBatchOffsets and next offset are returned.
+func (s *Topic) catchUp(ctx context.Context, epochs *recordBatchEpochs, recordBatchOffsets []uint64, nextOffset uint64) ([]uint64, uint64, error) {
+	for {
+		parser, name, err := s.probeRecordBatch(ctx, epochs, nextOffset)
+		if err != nil {
+			if errors.Is(err, seberr.ErrNotInStorage) {
+				break
+			}
+			return nil, 0, fmt.Errorf("probing for record batch at offset %d: %w", nextOffset, err)
+		}
+		numRecords := parser.Header.NumRecords
+		parser.Close()
+
+		epochs.add(name)
+		recordBatchOffsets = append(recordBatchOffsets, nextOffset)
+		nextOffset += uint64(numRecords)
+	}
+
+	return recordBatchOffsets, nextOffset, nil
+}
+
+// probeRecordBatch returns a parser for the record batch at recordBatchID and
+// its name. Since the epoch of the record batch isn't known, it's probed for
+// using the epoch of the newest record batch in epochs and the topic's own
+// epoch, if it's newer. seberr.ErrNotInStorage is returned if there's no
+// record batch at recordBatchID.
+func (s *Topic) probeRecordBatch(ctx context.Context, epochs *recordBatchEpochs, recordBatchID uint64) (*sebrecords.Parser, RecordBatchName, error) {
+	candidates := []uint64{epochs.latest()}
+	if s.epoch > candidates[0] {
+		candidates = append(candidates, s.epoch)
+	}
+
+	var err error
+	for _, epoch := range candidates {
+		name := RecordBatchName{ID: recordBatchID, Epoch: epoch}
+
+		var parser *sebrecords.Parser
+		parser, err = s.parseRecordBatchName(ctx, name)
+		if err == nil {
+			return parser, name, nil
+		}
+		if !errors.Is(err, seberr.ErrNotInStorage) {
+			return nil, RecordBatchName{}, err
+		}
+	}
+
+	return nil, RecordBatchName{}, err
+}
+
+// writeManifest writes the topic's latest record batch ID, next offset and
+// whether it's sealed to its manifest. The manifest of a topic without record
+// batches is only written if the topic is sealed.
+func (s *Topic) writeManifest(ctx context.Context) error {
+	s.manifestMu.Lock()
+	defer s.manifestMu.Unlock()
+
+	sealed := s.sealed.Load()
+
+	// NOTE: nextOffset must be read before recordBatchOffsets in order to
+	// guarantee that the latest record batch is below nextOffset.
+	nextOffset := s.durableNextOffset()
+	if nextOffset == 0 {
+		if !sealed {
+			return nil
+		}
+		return writeManifest(ctx, s.backingStorage, s.topicName, manifest{sealed: true})
+	}
+
+	s.mu.Lock()
+	i, _ := slices.BinarySearch(s.recordBatchOffsets, nextOffset)
+	if i == 0 {
+		s.mu.Unlock()
+		return nil
+	}
+	latestBatchID := s.recordBatchOffsets[i-1]
+	s.mu.Unlock()
+
+	return writeManifest(ctx, s.backingStorage, s.topicName, manifest{
+		latestBatchID:    latestBatchID,
+		nextOffset:       nextOffset,
+		latestBatchEpoch: s.epochs.name(latestBatchID).Epoch,
+		sealed:           sealed,
+	})
+}
+
+// deleteManifest deletes the topic's manifest, if it exists.
+func (s *Topic) deleteManifest() error {
+	s.manifestMu.Lock()
+	defer s.manifestMu.Unlock()
+
+	err := s.backingStorage.Delete(ManifestKey(s.topicName))
+	if err != nil && !errors.Is(err, seberr.ErrNotInStorage) {
+		return fmt.Errorf("deleting manifest: %w", err)
+	}
+
+	return nil
+}
+
+// loadRecordBatchOffsets loads the offsets of all of the topic's record
+// batches if the topic was opened from its manifest and they haven't been
+// loaded yet. It must be called before using recordBatchOffsets for anything
+// but the topic's latest record batches.
+func (s *Topic) loadRecordBatchOffsets(ctx context.Context) error {
+	if s.offsetsLoaded.Load() {
+		return nil
+	}
+
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+	if s.offsetsLoaded.Load() {
+		return nil
+	}
+
+	// NOTE: record batches at or above nextOffset may be in the middle of
+	// being added. They're left out and appended to recordBatchOffsets by
+	// publishRecordBatch once they've been added.
+	nextOffset := s.nextOffset.Load()
+
+	var (
+		recordBatchOffsets []uint64
+		epochs             *recordBatchEpochs
+	)
+	err := error(seberr.ErrNotInStorage)
+	if s.offsetIndexInterval > 0 {
+		recordBatchOffsets, epochs, _, err = s.loadOffsetIndex(ctx)
+		if err != nil && !errors.Is(err, seberr.ErrNotInStorage) {
+			s.log.Warnf("offset index unusable, listing record batches: %s", err)
+		}
+	}
+
+	if err != nil {
+		recordBatchOffsets, epochs, err = listRecordBatchOffsets(ctx, s.backingStorage, s.topicName)
+		if err != nil {
+			return fmt.Errorf("listing record batches: %w", err)
+		}
+	}
+
+	i, _ := slices.BinarySearch(recordBatchOffsets, nextOffset)
+	recordBatchOffsets = recordBatchOffsets[:i]
+	epochs.removeFrom(nextOffset)
+	s.epochs.merge(epochs)
+
+	s.mu.Lock()
+	recordBatchOffsets = append(recordBatchOffsets, s.recordBatchOffsets...)
+	slices.Sort(recordBatchOffsets)
+	s.recordBatchOffsets = slices.Compact(recordBatchOffsets)
+	numBatches := len(s.recordBatchOffsets)
+	s.mu.Unlock()
+
+	s.offsetsLoaded.Store(true)
+	s.log.Debugf("loaded %d record batch offsets", numBatches)
+
+	return nil
+}
+
+// loadRecordBatchOffsetsFor is like loadRecordBatchOffsets, but doesn't load
+// the topic's record batch offsets if the record batch holding offset is
+// already known. This allows consumers that are reading the newest records of
+// a topic opened from its manifest to never load them.
+func (s *Topic) loadRecordBatchOffsetsFor(ctx context.Context, offset uint64) error {
+	if s.offsetsLoaded.Load() {
+		return nil
+	}
+
+	s.mu.Lock()
+	known := len(s.recordBatchOffsets) > 0 && offset >= s.recordBatchOffsets[0]
+	s.mu.Unlock()
+	if known {
+		return nil
+	}
+
+	return s.loadRecordBatchOffsets(ctx)
+}
@@ -0,0 +1,129 @@
+package sebtopic_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTopicManifestUsedWhenOpening verifies that topics are opened from their
+// manifest without listing record batches, that the newest records can be
+// read without listing record batches, and that record batches are listed
+// once older records are read.
+func TestTopicManifestUsedWhenOpening(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		const topicName = "topic"
+		topic, err := sebtopic.New(log, storage, topicName, cache, sebtopic.WithManifest(true), sebtopic.WithOffsetIndexInterval(0))
+		require.NoError(t, err)
+
+		expectedRecords := [][]byte{}
+		for range 5 {
+			batch := tester.MakeRandomRecordBatch(3)
+			_, err = topic.AddRecords(batch)
+			require.NoError(t, err)
+			expectedRecords = append(expectedRecords, batch.IndividualRecords()...)
+		}
+
+		countingStorage := forwardingStorage(storage)
+
+		// Act
+		reopened, err := sebtopic.New(log, countingStorage, topicName, cache, sebtopic.WithManifest(true), sebtopic.WithOffsetIndexInterval(0))
+		require.NoError(t, err)
+
+		// Assert
+		require.Equal(t, 0, len(countingStorage.ListFilesCalls))
+		require.Equal(t, uint64(15), reopened.NextOffset())
+
+		gotBatch := tester.NewBatch(3, 4096)
+		err = reopened.ReadRecords(context.Background(), &gotBatch, 12, 3, 0)
+		require.NoError(t, err)
+		require.Equal(t, expectedRecords[12:], gotBatch.IndividualRecords())
+		require.Equal(t, 0, len(countingStorage.ListFilesCalls))
+
+		gotBatch = tester.NewBatch(15, 4096)
+		err = reopened.ReadRecords(context.Background(), &gotBatch, 0, 15, 0)
+		require.NoError(t, err)
+		require.Equal(t, expectedRecords, gotBatch.IndividualRecords())
+		require.Equal(t, 1, len(countingStorage.ListFilesCalls))
+	})
+}
+
+// TestTopicManifestRecordsAddedBeforeLoading verifies that record batches
+// that are added to a topic opened from its manifest, before the offsets of
+// its record batches have been loaded, are kept once they're loaded.
+func TestTopicManifestRecordsAddedBeforeLoading(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		const topicName = "topic"
+		topic, err := sebtopic.New(log, storage, topicName, cache, sebtopic.WithManifest(true))
+		require.NoError(t, err)
+
+		for range 3 {
+			_, err = topic.AddRecords(tester.MakeRandomRecordBatch(2))
+			require.NoError(t, err)
+		}
+
+		reopened, err := sebtopic.New(log, storage, topicName, cache, sebtopic.WithManifest(true))
+		require.NoError(t, err)
+
+		// Act
+		offsets, err := reopened.AddRecords(tester.MakeRandomRecordBatch(4))
+		require.NoError(t, err)
+		tester.RequireOffsets(t, 6, 10, offsets)
+
+		segments, err := reopened.Segments()
+		require.NoError(t, err)
+
+		// Assert
+		baseOffsets := []uint64{}
+		for _, segment := range segments {
+			baseOffsets = append(baseOffsets, segment.BaseOffset)
+		}
+		require.Equal(t, []uint64{0, 2, 4, 6}, baseOffsets)
+
+		err = reopened.Delete()
+		require.NoError(t, err)
+
+		reopened, err = sebtopic.New(log, storage, topicName, cache, sebtopic.WithManifest(true))
+		require.NoError(t, err)
+		require.Equal(t, uint64(0), reopened.NextOffset())
+	})
+}
+
+// TestTopicManifestBadFallsBackToListing verifies that a topic whose manifest
+// is corrupt is opened by listing its record batches, and that the manifest
+// is rewritten.
+func TestTopicManifestBadFallsBackToListing(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		const topicName = "topic"
+		topic, err := sebtopic.New(log, storage, topicName, cache, sebtopic.WithManifest(true), sebtopic.WithOffsetIndexInterval(0))
+		require.NoError(t, err)
+
+		for range 3 {
+			_, err = topic.AddRecords(tester.MakeRandomRecordBatch(2))
+			require.NoError(t, err)
+		}
+
+		w, err := storage.Writer(context.Background(), sebtopic.ManifestKey(topicName))
+		require.NoError(t, err)
+		_, err = w.Write([]byte("not a manifest"))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		// Act
+		reopened, err := sebtopic.New(log, storage, topicName, cache, sebtopic.WithManifest(true), sebtopic.WithOffsetIndexInterval(0))
+		require.NoError(t, err)
+
+		// Assert
+		require.Equal(t, uint64(6), reopened.NextOffset())
+
+		countingStorage := forwardingStorage(storage)
+		reopened, err = sebtopic.New(log, countingStorage, topicName, cache, sebtopic.WithManifest(true), sebtopic.WithOffsetIndexInterval(0))
+		require.NoError(t, err)
+		require.Equal(t, 0, len(countingStorage.ListFilesCalls))
+		require.Equal(t, uint64(6), reopened.NextOffset())
+	})
+}
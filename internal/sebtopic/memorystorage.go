@@ -2,62 +2,195 @@ package sebtopic
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
 	"sync"
 
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
-	"github.com/micvbang/simple-event-broker/internal/infrastructure/nops"
 	"github.com/micvbang/simple-event-broker/seberr"
 )
 
 // MemoryTopicStorage is an in-memory backing storage that can be used in Topic.
-// It is mostly useful for testing.
+// It is mostly useful for testing and for ephemeral topics.
+//
+// The number of bytes kept in memory can be limited. When the limit is
+// reached, the oldest files are either spilled to a directory on local disk,
+// or writes fail. See WithMemoryMaxBytes and WithMemorySpillDir.
 type MemoryTopicStorage struct {
+	log      logger.Logger
+	maxBytes int64
+
+	// spill is nil if files aren't spilled to disk.
+	spill *DiskStorage
+
 	mu      sync.Mutex
-	storage map[string]*bytes.Buffer
+	storage map[string]*memoryFile
+	bytes   int64
+
+	// order holds the files of storage in the order they were written, oldest
+	// first, such that the oldest can be spilled first. Files that have since
+	// been deleted, replaced or spilled are skipped when spilling. Only used
+	// when spilling to disk.
+	order []*memoryFile
+
+	// spilled maps the keys of files that have been spilled to disk to their
+	// sizes.
+	spilled map[string]int64
 }
 
-func NewMemoryStorage(log logger.Logger) *MemoryTopicStorage {
-	return &MemoryTopicStorage{
-		storage: make(map[string]*bytes.Buffer, 64),
+type memoryFile struct {
+	key string
+	buf *bytes.Buffer
+}
+
+type MemoryStorageOpts struct {
+	// MaxBytes is the maximum number of bytes of files kept in memory.
+	// Unlimited if 0.
+	MaxBytes int64
+
+	// SpillDir is the directory that the oldest files are spilled to when
+	// MaxBytes is reached. If empty, writes that would exceed MaxBytes fail.
+	SpillDir string
+}
+
+// WithMemoryMaxBytes sets the maximum number of bytes of files that
+// MemoryTopicStorage keeps in memory. Unlimited if 0.
+func WithMemoryMaxBytes(maxBytes int64) func(*MemoryStorageOpts) {
+	return func(o *MemoryStorageOpts) {
+		o.MaxBytes = maxBytes
+	}
+}
+
+// WithMemorySpillDir sets the directory on local disk that the oldest files
+// are spilled to when the maximum number of bytes is reached. Spilled files
+// are read from disk, and are deleted when they're deleted from storage.
+//
+// NOTE: files are spilled while writing the file that reached the limit, so
+// writing it takes longer.
+func WithMemorySpillDir(dir string) func(*MemoryStorageOpts) {
+	return func(o *MemoryStorageOpts) {
+		o.SpillDir = dir
 	}
 }
 
-func (ms *MemoryTopicStorage) Writer(key string) (io.WriteCloser, error) {
+func NewMemoryStorage(log logger.Logger, optFuncs ...func(*MemoryStorageOpts)) *MemoryTopicStorage {
+	opts := MemoryStorageOpts{}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+
+	ms := &MemoryTopicStorage{
+		log:      log,
+		maxBytes: opts.MaxBytes,
+		storage:  make(map[string]*memoryFile, 64),
+		spilled:  make(map[string]int64),
+	}
+	if opts.MaxBytes > 0 && opts.SpillDir != "" {
+		ms.spill = NewDiskStorage(log.Name("spill"), opts.SpillDir)
+	}
+
+	return ms
+}
+
+// Writer returns a writer whose data is stored at key once it's closed.
+// If storing it would exceed the maximum number of bytes kept in memory and
+// files aren't spilled to disk, Close returns an error wrapping
+// seberr.ErrQuotaExceeded.
+func (ms *MemoryTopicStorage) Writer(_ context.Context, key string) (io.WriteCloser, error) {
+	return &memoryWriter{
+		Buffer: bytes.NewBuffer(make([]byte, 0, 4096)),
+		ms:     ms,
+		key:    key,
+	}, nil
+}
+
+func (ms *MemoryTopicStorage) Reader(ctx context.Context, key string) (io.ReadCloser, error) {
 	ms.mu.Lock()
-	defer ms.mu.Unlock()
+	file, ok := ms.storage[key]
+	_, spilled := ms.spilled[key]
+	ms.mu.Unlock()
+
+	if spilled {
+		return ms.spill.Reader(ctx, key)
+	}
+	if !ok {
+		return nil, seberr.ErrNotInStorage
+	}
 
-	buf := bytes.NewBuffer(make([]byte, 0, 4096))
-	ms.storage[key] = buf
+	// NOTE: returning a new reader allows the same key to be read multiple
+	// times.
+	return io.NopCloser(bytes.NewReader(file.buf.Bytes())), nil
+}
 
-	return nops.NopWriteCloser(buf), nil
+// ReadRange returns a reader of at most length bytes of key, starting at
+// offset. See RangeReader.
+func (ms *MemoryTopicStorage) ReadRange(ctx context.Context, key string, offset int64, length int64) (io.ReadCloser, int64, error) {
+	ms.mu.Lock()
+	file, ok := ms.storage[key]
+	_, spilled := ms.spilled[key]
+	ms.mu.Unlock()
+
+	if spilled {
+		return ms.spill.ReadRange(ctx, key, offset, length)
+	}
+	if !ok {
+		return nil, 0, seberr.ErrNotInStorage
+	}
+
+	bs := file.buf.Bytes()
+	size := int64(len(bs))
+	if offset > size {
+		return nil, 0, fmt.Errorf("offset %d beyond size %d", offset, size)
+	}
+	end := min(offset+length, size)
+
+	return io.NopCloser(bytes.NewReader(bs[offset:end])), size, nil
 }
 
-func (ms *MemoryTopicStorage) Reader(key string) (io.ReadCloser, error) {
+func (ms *MemoryTopicStorage) Delete(key string) error {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
 
-	buf, ok := ms.storage[key]
+	if _, ok := ms.spilled[key]; ok {
+		delete(ms.spilled, key)
+		return ms.spill.Delete(key)
+	}
+
+	file, ok := ms.storage[key]
 	if !ok {
-		return nil, seberr.ErrNotInStorage
+		return seberr.ErrNotInStorage
 	}
 
-	return io.NopCloser(buf), nil
+	delete(ms.storage, key)
+	ms.bytes -= int64(file.buf.Len())
+	return nil
 }
 
-func (ms *MemoryTopicStorage) ListFiles(topicName string, extension string) ([]File, error) {
+func (ms *MemoryTopicStorage) ListFiles(_ context.Context, topicName string, extension string) ([]File, error) {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
 
 	files := make([]File, 0, 128)
 
 	topicPrefix := fmt.Sprintf("%s/", topicName)
-	for key, buf := range ms.storage {
-		if strings.HasPrefix(key, topicPrefix) {
+	matches := func(key string) bool {
+		return strings.HasPrefix(key, topicPrefix) && strings.HasSuffix(key, extension)
+	}
+	for key, file := range ms.storage {
+		if matches(key) {
+			files = append(files, File{
+				Size: int64(file.buf.Len()),
+				Path: key,
+			})
+		}
+	}
+	for key, size := range ms.spilled {
+		if matches(key) {
 			files = append(files, File{
-				Size: int64(buf.Len()),
+				Size: size,
 				Path: key,
 			})
 		}
@@ -65,3 +198,155 @@ func (ms *MemoryTopicStorage) ListFiles(topicName string, extension string) ([]F
 
 	return files, nil
 }
+
+// MemoryStorageUsage describes the number of bytes and files that
+// MemoryTopicStorage holds in memory and has spilled to disk.
+type MemoryStorageUsage struct {
+	Bytes        int64
+	Files        int
+	SpilledBytes int64
+	SpilledFiles int
+}
+
+// Usage returns the number of bytes and files held in memory and spilled to
+// disk.
+func (ms *MemoryTopicStorage) Usage() MemoryStorageUsage {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	usage := MemoryStorageUsage{
+		Bytes:        ms.bytes,
+		Files:        len(ms.storage),
+		SpilledFiles: len(ms.spilled),
+	}
+	for _, size := range ms.spilled {
+		usage.SpilledBytes += size
+	}
+
+	return usage
+}
+
+// store stores buf at key, replacing the file currently stored there. If
+// the maximum number of bytes would be exceeded, the oldest files are spilled
+// to disk until buf fits, or buf is spilled itself if it's larger than the
+// maximum.
+func (ms *MemoryTopicStorage) store(key string, buf *bytes.Buffer) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	size := int64(buf.Len())
+	replacedSize := int64(0)
+	if file, ok := ms.storage[key]; ok {
+		replacedSize = int64(file.buf.Len())
+	}
+
+	if ms.maxBytes > 0 && ms.bytes-replacedSize+size > ms.maxBytes {
+		if ms.spill == nil {
+			return fmt.Errorf("%w: storing %d bytes at '%s' would exceed the memory storage limit of %d bytes", seberr.ErrQuotaExceeded, size, key, ms.maxBytes)
+		}
+
+		if size > ms.maxBytes {
+			return ms.spillFile(&memoryFile{key: key, buf: buf})
+		}
+
+		err := ms.spillOldest(ms.maxBytes - size + replacedSize)
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, ok := ms.spilled[key]; ok {
+		delete(ms.spilled, key)
+		err := ms.spill.Delete(key)
+		if err != nil && !errors.Is(err, seberr.ErrNotInStorage) {
+			ms.log.Errorf("deleting replaced spilled file '%s': %s", key, err)
+		}
+	}
+
+	if file, ok := ms.storage[key]; ok {
+		ms.bytes -= int64(file.buf.Len())
+	}
+	file := &memoryFile{key: key, buf: buf}
+	ms.storage[key] = file
+	ms.bytes += size
+
+	if ms.spill != nil {
+		ms.order = append(ms.order, file)
+
+		// drop files that have been deleted or replaced, such that order
+		// doesn't grow without bounds when the same keys are written again
+		if len(ms.order) > 2*len(ms.storage)+64 {
+			order := make([]*memoryFile, 0, len(ms.storage))
+			for _, file := range ms.order {
+				if ms.storage[file.key] == file {
+					order = append(order, file)
+				}
+			}
+			ms.order = order
+		}
+	}
+
+	return nil
+}
+
+// spillOldest spills the oldest files to disk until at most maxBytes bytes
+// are kept in memory.
+// NOTE: you must hold ms.mu when calling this method!
+func (ms *MemoryTopicStorage) spillOldest(maxBytes int64) error {
+	spilled := 0
+	defer func() {
+		ms.order = ms.order[spilled:]
+	}()
+
+	for _, file := range ms.order {
+		if ms.bytes <= maxBytes {
+			break
+		}
+
+		if ms.storage[file.key] == file {
+			err := ms.spillFile(file)
+			if err != nil {
+				return err
+			}
+
+			delete(ms.storage, file.key)
+			ms.bytes -= int64(file.buf.Len())
+		}
+		spilled++
+	}
+
+	return nil
+}
+
+// spillFile writes file to disk.
+// NOTE: you must hold ms.mu when calling this method!
+func (ms *MemoryTopicStorage) spillFile(file *memoryFile) error {
+	w, err := ms.spill.Writer(context.Background(), file.key)
+	if err != nil {
+		return fmt.Errorf("spilling '%s' to disk: %w", file.key, err)
+	}
+
+	_, err = w.Write(file.buf.Bytes())
+	if err != nil {
+		w.Close()
+		return fmt.Errorf("spilling '%s' to disk: %w", file.key, err)
+	}
+
+	err = w.Close()
+	if err != nil {
+		return fmt.Errorf("spilling '%s' to disk: %w", file.key, err)
+	}
+
+	ms.spilled[file.key] = int64(file.buf.Len())
+	return nil
+}
+
+type memoryWriter struct {
+	*bytes.Buffer
+	ms  *MemoryTopicStorage
+	key string
+}
+
+func (w *memoryWriter) Close() error {
+	return w.ms.store(w.key, w.Buffer)
+}
@@ -1,6 +1,7 @@
 package sebtopic_test
 
 import (
+	"context"
 	"io"
 	"path"
 	"testing"
@@ -23,7 +24,7 @@ func TestMemoryTopicStorageSimpleReadWrite(t *testing.T) {
 	// Write
 	{
 		// Act
-		wtr, err := memoryStorage.Writer(recordBatchPath)
+		wtr, err := memoryStorage.Writer(context.Background(), recordBatchPath)
 		require.NoError(t, err)
 
 		n, err := wtr.Write(expectedBytes)
@@ -38,7 +39,7 @@ func TestMemoryTopicStorageSimpleReadWrite(t *testing.T) {
 	// Read
 	{
 		// Act
-		rdr, err := memoryStorage.Reader(recordBatchPath)
+		rdr, err := memoryStorage.Reader(context.Background(), recordBatchPath)
 		require.NoError(t, err)
 
 		// Assert
@@ -54,7 +55,7 @@ func TestMemoryTopicStorageSimpleReadWrite(t *testing.T) {
 func TestMemoryTopicStorageReadNotFound(t *testing.T) {
 	memoryStorage := sebtopic.NewMemoryStorage(log)
 
-	_, err := memoryStorage.Reader("does-not-exist")
+	_, err := memoryStorage.Reader(context.Background(), "does-not-exist")
 	require.ErrorIs(t, err, seberr.ErrNotInStorage)
 }
 
@@ -72,7 +73,7 @@ func TestMemoryTopicStorageMultiReadWrite(t *testing.T) {
 		// Act
 		writeFile(t, memoryStorage, key, expected)
 
-		rdr, err := memoryStorage.Reader(key)
+		rdr, err := memoryStorage.Reader(context.Background(), key)
 		require.NoError(t, err)
 
 		// Assert
@@ -99,24 +100,167 @@ func TestMemoryTopicStorageListFiles(t *testing.T) {
 	writeFile(t, memoryStorage, path.Join(topicName2, "3.ext"), bs)
 
 	// topic1
-	topic1Files, err := memoryStorage.ListFiles(topicName1, ".ext")
+	topic1Files, err := memoryStorage.ListFiles(context.Background(), topicName1, ".ext")
 	require.NoError(t, err)
 	require.Equal(t, 2, len(topic1Files))
 
 	// topic2
-	topic2Files, err := memoryStorage.ListFiles(topicName2, ".ext")
+	topic2Files, err := memoryStorage.ListFiles(context.Background(), topicName2, ".ext")
 	require.NoError(t, err)
 	require.Equal(t, 1, len(topic2Files))
 
 	// non-existing topic
-	nonExistingTopicFiles, err := memoryStorage.ListFiles("does-not-exist", ".ext")
+	nonExistingTopicFiles, err := memoryStorage.ListFiles(context.Background(), "does-not-exist", ".ext")
 	require.NoError(t, err)
 	require.Equal(t, 0, len(nonExistingTopicFiles))
 }
 
+// TestMemoryTopicStorageListFilesExtension verifies that ListFiles only
+// returns files with the given extension.
+func TestMemoryTopicStorageListFilesExtension(t *testing.T) {
+	memoryStorage := sebtopic.NewMemoryStorage(log)
+
+	bs := tester.RandomBytes(t, 32)
+
+	const topicName = "topic-name"
+	writeFile(t, memoryStorage, path.Join(topicName, "1.record_batch"), bs)
+	writeFile(t, memoryStorage, path.Join(topicName, "2.record_batch"), bs)
+	writeFile(t, memoryStorage, path.Join(topicName, "3.other"), bs)
+
+	// Act
+	files, err := memoryStorage.ListFiles(context.Background(), topicName, ".record_batch")
+	require.NoError(t, err)
+
+	// Assert
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+	require.ElementsMatch(t, []string{
+		path.Join(topicName, "1.record_batch"),
+		path.Join(topicName, "2.record_batch"),
+	}, paths)
+}
+
+// TestMemoryTopicStorageReadTwice verifies that a file can be read multiple
+// times without being written again.
+func TestMemoryTopicStorageReadTwice(t *testing.T) {
+	const key = "topic-name/1.record_batch"
+	expected := tester.RandomBytes(t, 32)
+
+	memoryStorage := sebtopic.NewMemoryStorage(log)
+	writeFile(t, memoryStorage, key, expected)
+
+	for i := 0; i < 2; i++ {
+		// Act
+		rdr, err := memoryStorage.Reader(context.Background(), key)
+		require.NoError(t, err)
+
+		// Assert
+		got := tester.ReadAndClose(t, rdr)
+		require.Equal(t, expected, got)
+	}
+}
+
 func writeFile(t *testing.T, ms *sebtopic.MemoryTopicStorage, key string, bs []byte) {
-	wtr, err := ms.Writer(key)
+	wtr, err := ms.Writer(context.Background(), key)
 	require.NoError(t, err)
 
 	tester.WriteAndClose(t, wtr, bs)
 }
+
+// TestMemoryTopicStorageMaxBytes verifies that writes that would exceed the
+// maximum number of bytes fail with seberr.ErrQuotaExceeded when files aren't
+// spilled to disk, and that deleting files makes room for new ones.
+func TestMemoryTopicStorageMaxBytes(t *testing.T) {
+	memoryStorage := sebtopic.NewMemoryStorage(log, sebtopic.WithMemoryMaxBytes(100))
+
+	writeFile(t, memoryStorage, "topic/1.ext", tester.RandomBytes(t, 60))
+
+	// Act
+	wtr, err := memoryStorage.Writer(context.Background(), "topic/2.ext")
+	require.NoError(t, err)
+	_, err = wtr.Write(tester.RandomBytes(t, 60))
+	require.NoError(t, err)
+	err = wtr.Close()
+
+	// Assert
+	require.ErrorIs(t, err, seberr.ErrQuotaExceeded)
+	_, err = memoryStorage.Reader(context.Background(), "topic/2.ext")
+	require.ErrorIs(t, err, seberr.ErrNotInStorage)
+
+	// Act
+	err = memoryStorage.Delete("topic/1.ext")
+	require.NoError(t, err)
+	writeFile(t, memoryStorage, "topic/2.ext", tester.RandomBytes(t, 60))
+
+	// Assert
+	require.Equal(t, sebtopic.MemoryStorageUsage{Bytes: 60, Files: 1}, memoryStorage.Usage())
+}
+
+// TestMemoryTopicStorageSpill verifies that the oldest files are spilled to
+// disk when the maximum number of bytes is reached, and that spilled files
+// can still be read, listed, replaced and deleted.
+func TestMemoryTopicStorageSpill(t *testing.T) {
+	ctx := context.Background()
+	memoryStorage := sebtopic.NewMemoryStorage(log,
+		sebtopic.WithMemoryMaxBytes(100),
+		sebtopic.WithMemorySpillDir(t.TempDir()),
+	)
+
+	files := map[string][]byte{
+		"topic/1.ext": tester.RandomBytes(t, 40),
+		"topic/2.ext": tester.RandomBytes(t, 40),
+		"topic/3.ext": tester.RandomBytes(t, 40),
+		"topic/4.ext": tester.RandomBytes(t, 150),
+	}
+
+	// Act
+	for _, key := range []string{"topic/1.ext", "topic/2.ext", "topic/3.ext", "topic/4.ext"} {
+		writeFile(t, memoryStorage, key, files[key])
+	}
+
+	// Assert
+	// 1 is spilled to make room for 3, and 4 is larger than the maximum
+	require.Equal(t, sebtopic.MemoryStorageUsage{
+		Bytes:        80,
+		Files:        2,
+		SpilledBytes: 190,
+		SpilledFiles: 2,
+	}, memoryStorage.Usage())
+
+	for key, expected := range files {
+		rdr, err := memoryStorage.Reader(ctx, key)
+		require.NoError(t, err)
+		require.Equal(t, expected, tester.ReadAndClose(t, rdr))
+
+		rdr, size, err := memoryStorage.ReadRange(ctx, key, 10, 20)
+		require.NoError(t, err)
+		require.Equal(t, int64(len(expected)), size)
+		require.Equal(t, expected[10:30], tester.ReadAndClose(t, rdr))
+	}
+
+	listed, err := memoryStorage.ListFiles(ctx, "topic", ".ext")
+	require.NoError(t, err)
+	require.Len(t, listed, len(files))
+
+	// Act
+	replaced := tester.RandomBytes(t, 10)
+	writeFile(t, memoryStorage, "topic/1.ext", replaced)
+	err = memoryStorage.Delete("topic/4.ext")
+	require.NoError(t, err)
+
+	// Assert
+	rdr, err := memoryStorage.Reader(ctx, "topic/1.ext")
+	require.NoError(t, err)
+	require.Equal(t, replaced, tester.ReadAndClose(t, rdr))
+
+	_, err = memoryStorage.Reader(ctx, "topic/4.ext")
+	require.ErrorIs(t, err, seberr.ErrNotInStorage)
+
+	// the new 1 fits in memory, replacing the spilled 1
+	require.Equal(t, sebtopic.MemoryStorageUsage{
+		Bytes: 90,
+		Files: 3,
+	}, memoryStorage.Usage())
+}
@@ -0,0 +1,293 @@
+package sebtopic
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+)
+
+// MergeBatches rewrites runs of adjacent, small record batches into single,
+// larger record batches. This reduces the number of files in backing storage
+// for topics that receive few records per record batch. It returns the number
+// of record batches that were merged into others.
+//
+// Record batches are merged for as long as the merged record batch has at
+// most maxRecords records and maxBytes bytes of record data. A merged record
+// batch is stored at the offset of its first record batch, so the offsets of
+// records are unchanged. It is given the commit time of its oldest record
+// batch and the earliest produced time of the merged record batches. The newest
+// record batch is never merged.
+func (s *Topic) MergeBatches(maxRecords int, maxBytes int) (int, error) {
+	err := s.checkWritable()
+	if err != nil {
+		return 0, err
+	}
+
+	s.maintenanceMu.Lock()
+	defer s.maintenanceMu.Unlock()
+
+	ctx := sebcache.WithBudget(context.Background(), sebcache.BudgetMaintenance)
+
+	err = s.loadRecordBatchOffsets(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("loading record batch offsets: %w", err)
+	}
+
+	durableNextOffset := s.durableNextOffset()
+	s.mu.Lock()
+	recordBatchOffsets := make([]uint64, len(s.recordBatchOffsets))
+	copy(recordBatchOffsets, s.recordBatchOffsets)
+	s.mu.Unlock()
+
+	// NOTE: record batches waiting to be written behind must not be merged
+	// before they've been written. The first of them is kept as the end of
+	// the last run, and is never merged.
+	if i, _ := slices.BinarySearch(recordBatchOffsets, durableNextOffset); i < len(recordBatchOffsets) {
+		recordBatchOffsets = recordBatchOffsets[:i+1]
+	}
+
+	merged := 0
+	run := make([]uint64, 0, 64)
+	runRecords := 0
+	for i := 0; i < len(recordBatchOffsets)-1; i++ {
+		batchOffset := recordBatchOffsets[i]
+		numRecords := int(recordBatchOffsets[i+1] - batchOffset)
+
+		if len(run) > 0 && runRecords+numRecords > maxRecords {
+			n, err := s.mergeRun(ctx, run, batchOffset, maxBytes)
+			merged += n
+			if err != nil {
+				return merged, err
+			}
+			run, runRecords = run[:0], 0
+		}
+
+		if numRecords < maxRecords {
+			run = append(run, batchOffset)
+			runRecords += numRecords
+		}
+	}
+
+	if len(run) > 0 {
+		n, err := s.mergeRun(ctx, run, recordBatchOffsets[len(recordBatchOffsets)-1], maxBytes)
+		merged += n
+		if err != nil {
+			return merged, err
+		}
+	}
+
+	if merged > 0 {
+		s.log.Infof("merged %d record batches", merged)
+	}
+
+	return merged, nil
+}
+
+// mergeRun merges the adjacent record batches of run, splitting it into
+// multiple merged record batches if their records exceed maxBytes. endOffset is
+// the offset following the last record of run. It returns the number of record
+// batches that were merged into others.
+func (s *Topic) mergeRun(ctx context.Context, run []uint64, endOffset uint64, maxBytes int) (int, error) {
+	merged := 0
+	for len(run) > 1 {
+		batch, unixEpochUs, n, err := s.readRun(ctx, run, endOffset, maxBytes)
+		if err != nil {
+			return merged, err
+		}
+
+		if n > 1 {
+			err = s.commitMerge(ctx, run[:n], batch, unixEpochUs)
+			if err != nil {
+				return merged, err
+			}
+			merged += n - 1
+		}
+
+		run = run[max(n, 1):]
+	}
+
+	return merged, nil
+}
+
+// readRun reads the records of the longest prefix of run that has at most
+// maxBytes bytes of record data, but at least one record batch. It returns
+// the records, the commit time of the first record batch, and the number of
+// record batches that were read.
+func (s *Topic) readRun(ctx context.Context, run []uint64, endOffset uint64, maxBytes int) (sebrecords.Batch, int64, int, error) {
+	var (
+		batch         sebrecords.Batch
+		unixEpochUs   int64
+		hasExpires    bool
+		hasPointers   bool
+		hasTimestamps bool
+		hasKeys       bool
+		hasHeaders    bool
+	)
+
+	n := 0
+	for ; n < len(run); n++ {
+		batchOffset := run[n]
+		batchEnd := endOffset
+		if n+1 < len(run) {
+			batchEnd = run[n+1]
+		}
+
+		rb, err := s.parseRecordBatch(ctx, batchOffset)
+		if err != nil {
+			return sebrecords.Batch{}, 0, 0, fmt.Errorf("parsing record batch: %w", err)
+		}
+
+		// NOTE: the record batch may overlap the record batches following it
+		// if a previous merge was interrupted.
+		numRecords := min(rb.Header.NumRecords, uint32(batchEnd-batchOffset))
+		numBytes := 0
+		for _, size := range rb.RecordSizes[:numRecords] {
+			numBytes += int(size)
+		}
+
+		if n > 0 && len(batch.Data)+numBytes > maxBytes {
+			rb.Close()
+			break
+		}
+
+		if n == 0 {
+			unixEpochUs = rb.Header.UnixEpochUs
+		}
+		batch.ProducedUnixEpochUs = sebrecords.EarliestProduced(batch.ProducedUnixEpochUs, rb.Header.ProducedUnixEpochUs)
+
+		// index of the record batch's first record in the merged batch
+		firstRecord := uint32(len(batch.Sizes))
+
+		if numRecords > 0 {
+			records := sebrecords.NewBatch(make([]uint32, 0, numRecords), make([]byte, 0, numBytes))
+			err = rb.Records(&records, 0, numRecords)
+			if err != nil {
+				rb.Close()
+				return sebrecords.Batch{}, 0, 0, fmt.Errorf("record batch '%s': %w", s.recordBatchPath(batchOffset), err)
+			}
+			batch.Sizes = append(batch.Sizes, records.Sizes...)
+			batch.Data = append(batch.Data, records.Data...)
+		}
+
+		if rb.Expires != nil {
+			hasExpires = true
+			batch.Expires = append(batch.Expires, rb.Expires[:numRecords]...)
+		} else {
+			batch.Expires = append(batch.Expires, make([]int64, numRecords)...)
+		}
+
+		if rb.Pointers != nil {
+			hasPointers = true
+			batch.Pointers = append(batch.Pointers, rb.Pointers[:numRecords]...)
+		} else {
+			batch.Pointers = append(batch.Pointers, make([]bool, numRecords)...)
+		}
+
+		if rb.Timestamps != nil {
+			hasTimestamps = true
+			batch.Timestamps = append(batch.Timestamps, rb.Timestamps[:numRecords]...)
+		} else {
+			batch.Timestamps = append(batch.Timestamps, make([]int64, numRecords)...)
+		}
+
+		if rb.Keys != nil {
+			hasKeys = true
+			batch.Keys = append(batch.Keys, rb.Keys[:numRecords]...)
+		} else {
+			batch.Keys = append(batch.Keys, make([][]byte, numRecords)...)
+		}
+
+		if rb.Headers != nil {
+			hasHeaders = true
+			batch.Headers = append(batch.Headers, rb.Headers[:numRecords]...)
+		} else {
+			batch.Headers = append(batch.Headers, make([][]sebrecords.RecordHeader, numRecords)...)
+		}
+
+		if rb.Traces != nil {
+			traces := sebrecords.ClampTraces(rb.Traces, numRecords)
+			batch.Traces = append(batch.Traces, sebrecords.ShiftTraces(traces, firstRecord)...)
+		}
+
+		rb.Close()
+	}
+
+	if !hasExpires {
+		batch.Expires = nil
+	}
+	if !hasPointers {
+		batch.Pointers = nil
+	}
+	if !hasTimestamps {
+		batch.Timestamps = nil
+	}
+	if !hasKeys {
+		batch.Keys = nil
+	}
+	if !hasHeaders {
+		batch.Headers = nil
+	}
+
+	return batch, unixEpochUs, n, nil
+}
+
+// commitMerge replaces the record batches of run with batch, which holds all
+// of their records.
+func (s *Topic) commitMerge(ctx context.Context, run []uint64, batch sebrecords.Batch, unixEpochUs int64) error {
+	recordBatchPath := s.recordBatchPath(run[0])
+
+	// NOTE: until the merged record batches are removed from
+	// recordBatchOffsets, readers only read the records of the first record
+	// batch from the merged record batch.
+	err := s.writeRecordBatch(ctx, recordBatchPath, batch, unixEpochUs)
+	if err != nil {
+		return fmt.Errorf("writing merged record batch: %w", err)
+	}
+
+	// NOTE: the cached copy of the first record batch must be replaced before
+	// the merged record batches are removed from recordBatchOffsets, since
+	// their records would otherwise be missing.
+	if s.cache != nil {
+		err = s.cache.Remove(recordBatchPath)
+		if err != nil {
+			return fmt.Errorf("removing '%s' from cache: %w", recordBatchPath, err)
+		}
+
+		err = s.cacheRecordBatch(ctx, recordBatchPath, batch, unixEpochUs)
+		if err != nil {
+			s.log.Errorf("caching merged record batch: %s", err)
+		}
+	}
+
+	// NOTE: record batches are only ever appended to s.recordBatchOffsets
+	// outside of maintenanceMu, so the run is still in place.
+	s.mu.Lock()
+	i, _ := slices.BinarySearch(s.recordBatchOffsets, run[0])
+	s.recordBatchOffsets = slices.Delete(s.recordBatchOffsets, i+1, i+len(run))
+	s.mu.Unlock()
+
+	// NOTE: the offset index must not refer to deleted record batches, so it's
+	// updated before deleting them. If that fails, it's removed altogether.
+	if s.offsetIndexInterval > 0 {
+		err := s.writeOffsetIndex(ctx)
+		if err != nil {
+			s.log.Errorf("writing offset index: %s", err)
+			err = s.deleteOffsetIndex()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, batchOffset := range run[1:] {
+		err := s.deleteRecordBatchFile(s.recordBatchPath(batchOffset))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
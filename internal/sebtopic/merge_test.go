@@ -0,0 +1,325 @@
+package sebtopic_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micvbang/go-helpy/sizey"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTopicMergeBatches verifies that MergeBatches() merges runs of small
+// record batches into record batches of at most maxRecords records, that the
+// newest record batch is not merged, and that offsets, expiry times and large
+// records are unchanged, also after the topic has been reopened.
+func TestTopicMergeBatches(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		const topicName = "topic"
+		topic, err := sebtopic.New(log, storage, topicName, cache, sebtopic.WithLargeRecordThreshold(largeRecordThreshold))
+		require.NoError(t, err)
+
+		const (
+			numBatches   = 10
+			largeIndex   = 2
+			expiredIndex = 5
+		)
+		expired := time.Now().Add(-time.Hour).UnixMicro()
+
+		expectedRecords := [][]byte{}
+		for i := range numBatches {
+			record := tester.RandomBytes(t, 10)
+			if i == largeIndex {
+				record = tester.RandomBytes(t, 2*largeRecordThreshold)
+			}
+
+			batch := tester.RecordsToBatch([][]byte{record})
+			if i == expiredIndex {
+				batch.Expires = []int64{expired}
+			} else {
+				expectedRecords = append(expectedRecords, record)
+			}
+
+			_, err = topic.AddRecords(batch)
+			require.NoError(t, err)
+		}
+
+		// Act
+		merged, err := topic.MergeBatches(4, sizey.MB)
+		require.NoError(t, err)
+
+		// Assert
+		require.Equal(t, 6, merged)
+
+		segments, err := topic.Segments()
+		require.NoError(t, err)
+		baseOffsets := []uint64{}
+		for _, segment := range segments {
+			baseOffsets = append(baseOffsets, segment.BaseOffset)
+		}
+		require.Equal(t, []uint64{0, 4, 8, 9}, baseOffsets)
+
+		files, err := storage.ListFiles(context.Background(), topicName, ".record_batch")
+		require.NoError(t, err)
+		require.Equal(t, 4, len(files))
+
+		largeRecordFiles, err := storage.ListFiles(context.Background(), topicName, ".large_record")
+		require.NoError(t, err)
+		require.Equal(t, 1, len(largeRecordFiles))
+
+		listedTopic, err := sebtopic.New(log, storage, topicName, cache, sebtopic.WithOffsetIndexInterval(0))
+		require.NoError(t, err)
+
+		for _, topic := range []*sebtopic.Topic{topic, reopenTopic(t, storage, topicName, cache), listedTopic} {
+			gotBatch := tester.NewBatch(numBatches, 10*largeRecordThreshold)
+			err = topic.ReadRecords(context.Background(), &gotBatch, 0, numBatches, 0)
+			require.NoError(t, err)
+			require.Equal(t, expectedRecords, gotBatch.IndividualRecords())
+			require.Equal(t, 1, gotBatch.Skipped)
+			require.Equal(t, uint64(numBatches), topic.NextOffset())
+
+			// read starting within a merged record batch
+			gotBatch.Reset()
+			err = topic.ReadRecords(context.Background(), &gotBatch, 6, numBatches, 0)
+			require.NoError(t, err)
+			require.Equal(t, expectedRecords[5:], gotBatch.IndividualRecords())
+		}
+
+		// merged record batches are not merged again
+		merged, err = topic.MergeBatches(4, sizey.MB)
+		require.NoError(t, err)
+		require.Equal(t, 0, merged)
+	})
+}
+
+// TestTopicMergeBatchesMaxBytes verifies that MergeBatches() does not merge
+// record batches into record batches with more than maxBytes bytes of records.
+func TestTopicMergeBatchesMaxBytes(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		topic, err := sebtopic.New(log, storage, "topic", cache)
+		require.NoError(t, err)
+
+		expectedRecords := [][]byte{}
+		for range 6 {
+			batch := tester.MakeRandomRecordBatchSize(1, 100)
+			_, err = topic.AddRecords(batch)
+			require.NoError(t, err)
+			expectedRecords = append(expectedRecords, batch.IndividualRecords()...)
+		}
+
+		// Act
+		merged, err := topic.MergeBatches(100, 250)
+		require.NoError(t, err)
+
+		// Assert
+		require.Equal(t, 2, merged)
+
+		segments, err := topic.Segments()
+		require.NoError(t, err)
+		require.Equal(t, 4, len(segments))
+		for _, segment := range segments[:2] {
+			require.Equal(t, uint64(2), segment.NumRecords)
+		}
+
+		gotBatch := tester.NewBatch(len(expectedRecords), 4096)
+		err = topic.ReadRecords(context.Background(), &gotBatch, 0, len(expectedRecords), 0)
+		require.NoError(t, err)
+		require.Equal(t, expectedRecords, gotBatch.IndividualRecords())
+	})
+}
+
+// TestTopicMergeBatchesInterrupted verifies that records are read exactly once
+// when a merge was interrupted after writing the merged record batch, but
+// before deleting the record batches that were merged into it, and that a
+// following MergeBatches() completes the merge.
+func TestTopicMergeBatchesInterrupted(t *testing.T) {
+	tester.TestBackingStorage(t, func(t *testing.T, storage sebtopic.Storage) {
+		const topicName = "topic"
+		topic, err := sebtopic.New(log, storage, topicName, newCache(t), sebtopic.WithCompress(nil))
+		require.NoError(t, err)
+
+		records := [][]byte{}
+		for range 3 {
+			batch := tester.MakeRandomRecordBatch(1)
+			_, err = topic.AddRecords(batch)
+			require.NoError(t, err)
+			records = append(records, batch.IndividualRecords()...)
+		}
+
+		// merged record batch holding the records of the first two record
+		// batches, which are both left in place.
+		wtr, err := storage.Writer(context.Background(), sebtopic.RecordBatchKey(topicName, 0))
+		require.NoError(t, err)
+		require.NoError(t, sebrecords.Write(wtr, tester.RecordsToBatch(records[:2])))
+		require.NoError(t, wtr.Close())
+
+		// Act
+		topic, err = sebtopic.New(log, storage, topicName, newCache(t), sebtopic.WithCompress(nil), sebtopic.WithOffsetIndexInterval(0))
+		require.NoError(t, err)
+
+		// Assert
+		gotBatch := tester.NewBatch(len(records), 4096)
+		err = topic.ReadRecords(context.Background(), &gotBatch, 0, len(records), 0)
+		require.NoError(t, err)
+		require.Equal(t, records, gotBatch.IndividualRecords())
+
+		merged, err := topic.MergeBatches(10, sizey.MB)
+		require.NoError(t, err)
+		require.Equal(t, 1, merged)
+
+		gotBatch.Reset()
+		err = topic.ReadRecords(context.Background(), &gotBatch, 0, len(records), 0)
+		require.NoError(t, err)
+		require.Equal(t, records, gotBatch.IndividualRecords())
+
+		files, err := storage.ListFiles(context.Background(), topicName, ".record_batch")
+		require.NoError(t, err)
+		require.Equal(t, 2, len(files))
+	})
+}
+
+// TestTopicMergeBatchesCacheBudget verifies that record batches cached by
+// MergeBatches() are attributed to sebcache.BudgetMaintenance until they're
+// read by clients.
+func TestTopicMergeBatchesCacheBudget(t *testing.T) {
+	tester.TestBackingStorage(t, func(t *testing.T, storage sebtopic.Storage) {
+		cache := newCache(t)
+		topic, err := sebtopic.New(log, storage, "topic", cache)
+		require.NoError(t, err)
+
+		for range 3 {
+			_, err = topic.AddRecords(tester.MakeRandomRecordBatch(1))
+			require.NoError(t, err)
+		}
+
+		// Act
+		merged, err := topic.MergeBatches(10, sizey.MB)
+		require.NoError(t, err)
+		require.Equal(t, 1, merged)
+
+		// Assert
+		stats := cache.BudgetStats()
+		require.Equal(t, 1, stats[sebcache.BudgetMaintenance].Items)
+		require.Equal(t, 1, stats[sebcache.BudgetServing].Items)
+
+		gotBatch := tester.NewBatch(3, 4096)
+		err = topic.ReadRecords(context.Background(), &gotBatch, 0, 3, 0)
+		require.NoError(t, err)
+
+		stats = cache.BudgetStats()
+		require.Equal(t, 0, stats[sebcache.BudgetMaintenance].Items)
+		require.Equal(t, 2, stats[sebcache.BudgetServing].Items)
+	})
+}
+
+// TestTopicMergeBatchesTraces verifies that the traces of merged record
+// batches are returned by SegmentsWithTraces() relative to the merged record
+// batch.
+func TestTopicMergeBatchesTraces(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		topic, err := sebtopic.New(log, storage, "topic", cache)
+		require.NoError(t, err)
+
+		for i, traceID := range []string{"trace-0", "", "trace-2", "trace-3"} {
+			batch := tester.MakeRandomRecordBatch(i + 1)
+			if traceID != "" {
+				batch.Traces = []sebrecords.Trace{{ID: traceID, NumRecords: uint32(batch.Len())}}
+			}
+			_, err = topic.AddRecords(batch)
+			require.NoError(t, err)
+		}
+
+		// Act
+		merged, err := topic.MergeBatches(10, sizey.MB)
+		require.NoError(t, err)
+		require.Equal(t, 2, merged)
+
+		// Assert
+		segments, err := topic.SegmentsWithTraces(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 2, len(segments))
+
+		require.Equal(t, uint64(0), segments[0].BaseOffset)
+		require.Equal(t, []sebrecords.Trace{
+			{ID: "trace-0", Start: 0, NumRecords: 1},
+			{ID: "trace-2", Start: 3, NumRecords: 3},
+		}, segments[0].Traces)
+
+		require.Equal(t, uint64(6), segments[1].BaseOffset)
+		require.Equal(t, []sebrecords.Trace{
+			{ID: "trace-3", Start: 0, NumRecords: 4},
+		}, segments[1].Traces)
+	})
+}
+
+// TestTopicMergeBatchesKeys verifies that the keys of records are kept when
+// record batches with and without keys are merged.
+func TestTopicMergeBatchesKeys(t *testing.T) {
+	tester.TestBackingStorage(t, func(t *testing.T, storage sebtopic.Storage) {
+		const topicName = "topic"
+		topic, err := sebtopic.New(log, storage, topicName, newCache(t), sebtopic.WithCompress(nil))
+		require.NoError(t, err)
+
+		for _, keys := range [][][]byte{{[]byte("a")}, nil, {[]byte("c")}, nil} {
+			batch := tester.MakeRandomRecordBatch(1)
+			batch.Keys = keys
+			_, err = topic.AddRecords(batch)
+			require.NoError(t, err)
+		}
+
+		// Act
+		merged, err := topic.MergeBatches(10, sizey.MB)
+		require.NoError(t, err)
+		require.Equal(t, 2, merged)
+
+		// Assert
+		rdr, err := storage.Reader(context.Background(), sebtopic.RecordBatchKey(topicName, 0))
+		require.NoError(t, err)
+
+		rb, err := sebrecords.Parse(tester.ReadToMemory(t, rdr))
+		require.NoError(t, err)
+		require.EqualValues(t, sebrecords.FileFormatVersionV2, rb.Header.Version)
+		require.Equal(t, [][]byte{[]byte("a"), {}, []byte("c")}, rb.Keys)
+	})
+}
+
+// TestTopicMergeBatchesProducedAt verifies that merged record batches are
+// given the earliest known produced time of the record batches merged into
+// them.
+func TestTopicMergeBatchesProducedAt(t *testing.T) {
+	tester.TestBackingStorage(t, func(t *testing.T, storage sebtopic.Storage) {
+		topic, err := sebtopic.New(log, storage, "topic", newCache(t))
+		require.NoError(t, err)
+
+		earliest := time.Now().Add(-time.Hour).Truncate(time.Microsecond)
+		for _, producedAt := range []time.Time{earliest.Add(time.Minute), {}, earliest, {}} {
+			batch := tester.MakeRandomRecordBatch(1)
+			if !producedAt.IsZero() {
+				batch.ProducedUnixEpochUs = producedAt.UnixMicro()
+			}
+			_, err = topic.AddRecords(batch)
+			require.NoError(t, err)
+		}
+
+		// Act
+		merged, err := topic.MergeBatches(10, sizey.MB)
+		require.NoError(t, err)
+		require.Equal(t, 2, merged)
+
+		// Assert
+		info, err := topic.BatchInfo(context.Background(), 0)
+		require.NoError(t, err)
+		require.Equal(t, uint64(3), info.NumRecords)
+		require.True(t, earliest.Equal(info.ProducedAt))
+	})
+}
+
+func newCache(t *testing.T) *sebcache.Cache {
+	cache, err := sebcache.New(log, sebcache.NewMemoryStorage(log))
+	require.NoError(t, err)
+	return cache
+}
@@ -0,0 +1,413 @@
+package sebtopic
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/micvbang/go-helpy/bytey"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+)
+
+type MigrateOpts struct {
+	Version     int16
+	Compression Compress
+
+	// DstTopicName is the name of the topic that record batches are written
+	// to. Record batches are rewritten in place if it's empty.
+	DstTopicName string
+}
+
+// MigrateVersion sets the file format version that record batches are
+// migrated to.
+func MigrateVersion(version int16) func(*MigrateOpts) {
+	return func(o *MigrateOpts) {
+		o.Version = version
+	}
+}
+
+// MigrateCompress sets the compression used by the topic. It must match the
+// compression that the topic's record batches were written with.
+func MigrateCompress(c Compress) func(*MigrateOpts) {
+	return func(o *MigrateOpts) {
+		o.Compression = c
+	}
+}
+
+// MigrateDstTopic makes Migrate write record batches to the topic
+// dstTopicName, instead of rewriting them in place.
+func MigrateDstTopic(dstTopicName string) func(*MigrateOpts) {
+	return func(o *MigrateOpts) {
+		o.DstTopicName = dstTopicName
+	}
+}
+
+// MigrateResult describes the record batches handled by Migrate.
+type MigrateResult struct {
+	RecordBatches int
+	Migrated      int
+	Records       uint64
+}
+
+// Migrate rewrites the record batches of topicName in storage that were
+// written using a file format version older than the newest one, such that
+// they use the newest version. Each rewritten record batch is read back and
+// verified to hold the same records and metadata before it's written, and the
+// offsets of all record batches are verified to be contiguous.
+//
+// When rewriting in place, record batches that already use the newest
+// version are left untouched, making it safe to rerun Migrate if it was
+// interrupted. When writing to a different topic, all record batches and
+// their large records are written to it.
+//
+// NOTE: Migrate must not run concurrently with MergeBatches or retention of
+// the same topic, since they may rewrite or delete the same record batches.
+func Migrate(ctx context.Context, log logger.Logger, storage Storage, topicName string, optFns ...func(*MigrateOpts)) (MigrateResult, error) {
+	opts := MigrateOpts{
+		Version:      sebrecords.FileFormatVersionLatest,
+		Compression:  Gzip{},
+		DstTopicName: topicName,
+	}
+	for _, optFn := range optFns {
+		optFn(&opts)
+	}
+	if opts.DstTopicName == "" {
+		opts.DstTopicName = topicName
+	}
+	log = log.WithField(logger.FieldTopicName, topicName)
+
+	recordBatchOffsets, epochs, err := listRecordBatchOffsets(ctx, storage, topicName)
+	if err != nil {
+		return MigrateResult{}, err
+	}
+
+	m := migrator{
+		storage:     storage,
+		compression: opts.Compression,
+		srcTopic:    topicName,
+		dstTopic:    opts.DstTopicName,
+		version:     opts.Version,
+	}
+
+	result := MigrateResult{}
+	nextOffset := uint64(0)
+	for i, recordBatchOffset := range recordBatchOffsets {
+		// NOTE: record batches may overlap the record batches following them
+		// if a merge was interrupted, but there must never be gaps between
+		// them.
+		if i > 0 && recordBatchOffset > nextOffset {
+			return result, fmt.Errorf("record batch %d: records [%d;%d) are missing", recordBatchOffset, nextOffset, recordBatchOffset)
+		}
+
+		numRecords, migrated, err := m.migrateRecordBatch(ctx, epochs.name(recordBatchOffset))
+		if err != nil {
+			return result, fmt.Errorf("record batch %d: %w", recordBatchOffset, err)
+		}
+
+		result.RecordBatches += 1
+		result.Records += uint64(numRecords)
+		if migrated {
+			result.Migrated += 1
+			log.WithField(logger.FieldBatchID, recordBatchOffset).Debugf("migrated %d records", numRecords)
+		}
+
+		nextOffset = max(nextOffset, recordBatchOffset+uint64(numRecords))
+	}
+
+	log.Infof("migrated %d/%d record batches (%d records) to '%s'", result.Migrated, result.RecordBatches, result.Records, opts.DstTopicName)
+
+	return result, nil
+}
+
+type migrator struct {
+	storage     Storage
+	compression Compress
+	srcTopic    string
+	dstTopic    string
+	version     int16
+}
+
+// migrateRecordBatch migrates the record batch with the given name, returning
+// its number of records and whether it was written. The migrated record batch
+// keeps its name, including its epoch.
+func (m migrator) migrateRecordBatch(ctx context.Context, name RecordBatchName) (uint32, bool, error) {
+	recordBatchOffset := name.ID
+	srcKey := name.Key(m.srcTopic)
+	bs, err := m.read(ctx, srcKey)
+	if err != nil {
+		return 0, false, err
+	}
+
+	rb, err := sebrecords.Parse(bytey.NewBuffer(bs))
+	if err != nil {
+		return 0, false, fmt.Errorf("parsing '%s': %w", srcKey, err)
+	}
+	defer rb.Close()
+
+	inPlace := m.srcTopic == m.dstTopic
+	if inPlace && rb.Header.Version >= m.version {
+		return rb.Header.NumRecords, false, nil
+	}
+
+	batch, err := parserBatch(rb)
+	if err != nil {
+		return 0, false, fmt.Errorf("reading records of '%s': %w", srcKey, err)
+	}
+
+	if !inPlace {
+		batch, err = m.copyLargeRecords(ctx, rb, batch, recordBatchOffset)
+		if err != nil {
+			return 0, false, err
+		}
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, len(bs)))
+	err = sebrecords.WriteVersion(buf, batch, rb.Header.UnixEpochUs, m.version)
+	if err != nil {
+		return 0, false, fmt.Errorf("writing record batch: %w", err)
+	}
+
+	err = verifyMigrated(buf.Bytes(), batch, rb.Header, m.version)
+	if err != nil {
+		return 0, false, fmt.Errorf("verifying migrated '%s': %w", srcKey, err)
+	}
+
+	dstKey := name.Key(m.dstTopic)
+	err = m.write(ctx, dstKey, buf.Bytes())
+	if err != nil {
+		return 0, false, err
+	}
+
+	return rb.Header.NumRecords, true, nil
+}
+
+// copyLargeRecords copies the large records pointed to by rb to the
+// destination topic, and returns batch with its pointers updated to point to
+// the copies.
+func (m migrator) copyLargeRecords(ctx context.Context, rb *sebrecords.Parser, batch sebrecords.Batch, recordBatchOffset uint64) (sebrecords.Batch, error) {
+	if rb.Pointers == nil {
+		return batch, nil
+	}
+
+	sizes := make([]uint32, 0, batch.Len())
+	data := make([]byte, 0, len(batch.Data))
+	dataOffset := uint32(0)
+	for recordIndex, size := range batch.Sizes {
+		record := batch.Data[dataOffset : dataOffset+size]
+		dataOffset += size
+
+		if !rb.IsPointer(uint32(recordIndex)) {
+			sizes = append(sizes, size)
+			data = append(data, record...)
+			continue
+		}
+
+		largeRecordSize, srcKey, err := readPointer(rb, uint32(recordIndex))
+		if err != nil {
+			return sebrecords.Batch{}, err
+		}
+
+		largeRecord, err := m.readRaw(ctx, srcKey)
+		if err != nil {
+			return sebrecords.Batch{}, err
+		}
+
+		dstKey := LargeRecordKey(m.dstTopic, recordBatchOffset+uint64(recordIndex))
+		err = m.writeRaw(ctx, dstKey, largeRecord)
+		if err != nil {
+			return sebrecords.Batch{}, err
+		}
+
+		pointerStart := len(data)
+		data = binary.LittleEndian.AppendUint64(data, uint64(largeRecordSize))
+		data = append(data, dstKey...)
+		sizes = append(sizes, uint32(len(data)-pointerStart))
+	}
+
+	batch.Sizes = sizes
+	batch.Data = data
+	return batch, nil
+}
+
+// verifyMigrated verifies that bs is a record batch of the given version that
+// holds the records and metadata of batch, and has the same header as
+// header.
+func verifyMigrated(bs []byte, batch sebrecords.Batch, header sebrecords.Header, version int16) error {
+	rb, err := sebrecords.Parse(bytey.NewBuffer(bs))
+	if err != nil {
+		return err
+	}
+	defer rb.Close()
+
+	if rb.Header.Version != version {
+		return fmt.Errorf("expected version %d, got %d", version, rb.Header.Version)
+	}
+	if rb.Header.NumRecords != header.NumRecords || rb.Header.UnixEpochUs != header.UnixEpochUs || rb.Header.ProducedUnixEpochUs != header.ProducedUnixEpochUs {
+		return fmt.Errorf("header mismatch")
+	}
+
+	got, err := parserBatch(rb)
+	if err != nil {
+		return err
+	}
+
+	if batchChecksum(got) != batchChecksum(batch) {
+		return fmt.Errorf("checksum mismatch")
+	}
+
+	return nil
+}
+
+// parserBatch returns all records of rb along with their metadata.
+func parserBatch(rb *sebrecords.Parser) (sebrecords.Batch, error) {
+	numBytes := 0
+	for _, size := range rb.RecordSizes {
+		numBytes += int(size)
+	}
+
+	batch := sebrecords.NewBatch(make([]uint32, 0, rb.Header.NumRecords), make([]byte, 0, numBytes))
+	if rb.Header.NumRecords > 0 {
+		err := rb.Records(&batch, 0, rb.Header.NumRecords)
+		if err != nil {
+			return sebrecords.Batch{}, err
+		}
+	}
+
+	batch.Expires = rb.Expires
+	batch.Pointers = rb.Pointers
+	batch.Traces = rb.Traces
+	batch.Timestamps = rb.Timestamps
+	batch.Keys = rb.Keys
+	batch.Headers = rb.Headers
+	batch.ProducedUnixEpochUs = rb.Header.ProducedUnixEpochUs
+	return batch, nil
+}
+
+// batchChecksum returns a checksum of the records and metadata of batch.
+func batchChecksum(batch sebrecords.Batch) [sha256.Size]byte {
+	h := sha256.New()
+	binary.Write(h, binary.LittleEndian, batch.Sizes)
+	h.Write(batch.Data)
+	binary.Write(h, binary.LittleEndian, batch.Expires)
+	binary.Write(h, binary.LittleEndian, batch.Pointers)
+	binary.Write(h, binary.LittleEndian, batch.Timestamps)
+	for _, key := range batch.Keys {
+		binary.Write(h, binary.LittleEndian, uint64(len(key)))
+		h.Write(key)
+	}
+	for _, headers := range batch.Headers {
+		binary.Write(h, binary.LittleEndian, uint64(len(headers)))
+		for _, header := range headers {
+			fmt.Fprintf(h, "%d:%s%d:", len(header.Key), header.Key, len(header.Value))
+			h.Write(header.Value)
+		}
+	}
+	for _, trace := range batch.Traces {
+		fmt.Fprintf(h, "%d:%s%d:%d", len(trace.ID), trace.ID, trace.Start, trace.NumRecords)
+	}
+
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// read reads the record batch at key, decompressing it if necessary.
+func (m migrator) read(ctx context.Context, key string) ([]byte, error) {
+	rdr, err := m.storage.Reader(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("opening reader '%s': %w", key, err)
+	}
+	defer rdr.Close()
+
+	r := io.Reader(rdr)
+	if m.compression != nil {
+		cr, err := m.compression.NewReader(rdr)
+		if err != nil {
+			return nil, fmt.Errorf("creating compression reader: %w", err)
+		}
+		defer cr.Close()
+		r = cr
+	}
+
+	bs, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading '%s': %w", key, err)
+	}
+	return bs, nil
+}
+
+// write writes the record batch bs to key, compressing it if necessary.
+func (m migrator) write(ctx context.Context, key string, bs []byte) error {
+	backingWriter, err := m.storage.Writer(ctx, key)
+	if err != nil {
+		return fmt.Errorf("opening writer '%s': %w", key, err)
+	}
+
+	w := backingWriter
+	if m.compression != nil {
+		w, err = m.compression.NewWriter(backingWriter)
+		if err != nil {
+			backingWriter.Close()
+			return fmt.Errorf("creating compression writer: %w", err)
+		}
+	}
+
+	_, err = w.Write(bs)
+	if err != nil {
+		backingWriter.Close()
+		return fmt.Errorf("writing '%s': %w", key, err)
+	}
+
+	if m.compression != nil {
+		err = w.Close()
+		if err != nil {
+			backingWriter.Close()
+			return fmt.Errorf("closing compression writer: %w", err)
+		}
+	}
+
+	err = backingWriter.Close()
+	if err != nil {
+		return fmt.Errorf("closing writer '%s': %w", key, err)
+	}
+	return nil
+}
+
+// readRaw reads the file at key, e.g. a large record, as is.
+func (m migrator) readRaw(ctx context.Context, key string) ([]byte, error) {
+	rdr, err := m.storage.Reader(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("opening reader '%s': %w", key, err)
+	}
+	defer rdr.Close()
+
+	bs, err := io.ReadAll(rdr)
+	if err != nil {
+		return nil, fmt.Errorf("reading '%s': %w", key, err)
+	}
+	return bs, nil
+}
+
+// writeRaw writes bs to key as is.
+func (m migrator) writeRaw(ctx context.Context, key string, bs []byte) error {
+	wtr, err := m.storage.Writer(ctx, key)
+	if err != nil {
+		return fmt.Errorf("opening writer '%s': %w", key, err)
+	}
+
+	_, err = wtr.Write(bs)
+	if err != nil {
+		wtr.Close()
+		return fmt.Errorf("writing '%s': %w", key, err)
+	}
+
+	err = wtr.Close()
+	if err != nil {
+		return fmt.Errorf("closing writer '%s': %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package sebtopic_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMigrate verifies that Migrate rewrites all record batches of a topic
+// using the newest format version, both in place and into another topic, and
+// that the records, expiry times and large records of the topic are
+// unchanged.
+func TestMigrate(t *testing.T) {
+	const srcTopicName = "src"
+
+	tests := map[string]struct {
+		dstTopicName string
+	}{
+		"in place":  {dstTopicName: ""},
+		"new topic": {dstTopicName: "dst"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tester.TestBackingStorage(t, func(t *testing.T, storage sebtopic.Storage) {
+				topic, err := sebtopic.New(log, storage, srcTopicName, newCache(t), sebtopic.WithLargeRecordThreshold(largeRecordThreshold))
+				require.NoError(t, err)
+
+				const numBatches = 5
+				expires := time.Now().Add(time.Hour).UnixMicro()
+				expectedRecords := [][]byte{}
+				for i := range numBatches {
+					batch := tester.MakeRandomRecordBatch(i + 1)
+					batch.Expires = make([]int64, batch.Len())
+					batch.Expires[0] = expires
+					if i == 2 {
+						batch = tester.RecordsToBatch([][]byte{tester.RandomBytes(t, 2*largeRecordThreshold)})
+					}
+					expectedRecords = append(expectedRecords, batch.IndividualRecords()...)
+
+					_, err = topic.AddRecords(batch)
+					require.NoError(t, err)
+				}
+
+				// Act
+				result, err := sebtopic.Migrate(context.Background(), log, storage, srcTopicName, sebtopic.MigrateDstTopic(test.dstTopicName))
+				require.NoError(t, err)
+
+				// Assert
+				require.Equal(t, sebtopic.MigrateResult{
+					RecordBatches: numBatches,
+					Migrated:      numBatches,
+					Records:       uint64(len(expectedRecords)),
+				}, result)
+
+				dstTopicName := srcTopicName
+				if test.dstTopicName != "" {
+					dstTopicName = test.dstTopicName
+				}
+
+				for offset := uint64(0); offset < uint64(len(expectedRecords)); {
+					rdr, err := storage.Reader(context.Background(), sebtopic.RecordBatchKey(dstTopicName, offset))
+					require.NoError(t, err)
+					gzipRdr, err := sebtopic.Gzip{}.NewReader(rdr)
+					require.NoError(t, err)
+
+					rb, err := sebrecords.Parse(tester.ReadToMemory(t, gzipRdr))
+					require.NoError(t, err)
+					require.EqualValues(t, sebrecords.FileFormatVersionLatest, rb.Header.Version)
+					if rb.Pointers == nil {
+						require.Equal(t, expires, rb.Expires[0])
+					}
+					offset += uint64(rb.Header.NumRecords)
+				}
+
+				dstTopic, err := sebtopic.New(log, storage, dstTopicName, newCache(t))
+				require.NoError(t, err)
+
+				gotBatch := tester.NewBatch(len(expectedRecords), 10*largeRecordThreshold)
+				err = dstTopic.ReadRecords(context.Background(), &gotBatch, 0, len(expectedRecords), 0)
+				require.NoError(t, err)
+				require.Equal(t, expectedRecords, gotBatch.IndividualRecords())
+			})
+		})
+	}
+}
+
+// TestMigrateRerun verifies that record batches that were already migrated
+// in place are not migrated again.
+func TestMigrateRerun(t *testing.T) {
+	tester.TestBackingStorage(t, func(t *testing.T, storage sebtopic.Storage) {
+		const topicName = "topic"
+		topic, err := sebtopic.New(log, storage, topicName, newCache(t))
+		require.NoError(t, err)
+
+		for range 3 {
+			_, err = topic.AddRecords(tester.MakeRandomRecordBatch(2))
+			require.NoError(t, err)
+		}
+
+		_, err = sebtopic.Migrate(context.Background(), log, storage, topicName)
+		require.NoError(t, err)
+
+		// Act
+		result, err := sebtopic.Migrate(context.Background(), log, storage, topicName)
+		require.NoError(t, err)
+
+		// Assert
+		require.Equal(t, sebtopic.MigrateResult{RecordBatches: 3, Migrated: 0, Records: 6}, result)
+	})
+}
+
+// TestMigrateMissingRecords verifies that Migrate returns an error when
+// record batches are missing between other record batches.
+func TestMigrateMissingRecords(t *testing.T) {
+	tester.TestBackingStorage(t, func(t *testing.T, storage sebtopic.Storage) {
+		const topicName = "topic"
+		topic, err := sebtopic.New(log, storage, topicName, newCache(t))
+		require.NoError(t, err)
+
+		for range 3 {
+			_, err = topic.AddRecords(tester.MakeRandomRecordBatch(2))
+			require.NoError(t, err)
+		}
+		require.NoError(t, storage.Delete(sebtopic.RecordBatchKey(topicName, 2)))
+
+		// Act
+		_, err = sebtopic.Migrate(context.Background(), log, storage, topicName)
+
+		// Assert
+		require.ErrorContains(t, err, "records [2;4) are missing")
+	})
+}
@@ -0,0 +1,59 @@
+package sebtopic
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+var errMmapUnsupported = errors.New("mmap not supported on this platform")
+
+// mmapReader reads a file that has been mapped into memory, serving reads
+// from the page cache without a syscall per read. It implements
+// io.ReadSeekCloser, io.ReaderAt and io.WriterTo.
+type mmapReader struct {
+	*bytes.Reader
+
+	once sync.Once
+	data []byte
+}
+
+// newMmapReader maps f into memory and returns a reader of it. f can be
+// closed once newMmapReader returns; the mapping stays valid until the
+// reader is closed.
+func newMmapReader(f *os.File) (*mmapReader, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("stat'ing '%s': %w", f.Name(), err)
+	}
+
+	// NOTE: empty files can't be mapped
+	if stat.Size() == 0 {
+		return &mmapReader{Reader: bytes.NewReader(nil)}, nil
+	}
+
+	data, err := mmap(f, int(stat.Size()))
+	if err != nil {
+		return nil, fmt.Errorf("mapping '%s': %w", f.Name(), err)
+	}
+
+	return &mmapReader{
+		Reader: bytes.NewReader(data),
+		data:   data,
+	}, nil
+}
+
+// Close unmaps the file. The reader must not be used after it's closed.
+func (r *mmapReader) Close() error {
+	var err error
+	r.once.Do(func() {
+		r.Reader = bytes.NewReader(nil)
+		if r.data != nil {
+			err = munmap(r.data)
+			r.data = nil
+		}
+	})
+	return err
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package sebtopic
+
+import (
+	"os"
+)
+
+// mmap returns errMmapUnsupported, since memory-mapped reads are only
+// supported on unix.
+func mmap(f *os.File, size int) ([]byte, error) {
+	return nil, errMmapUnsupported
+}
+
+func munmap(bs []byte) error {
+	return errMmapUnsupported
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package sebtopic
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmap maps the first size bytes of f into memory, read-only.
+func mmap(f *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+func munmap(bs []byte) error {
+	return syscall.Munmap(bs)
+}
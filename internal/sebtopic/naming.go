@@ -0,0 +1,238 @@
+package sebtopic
+
+import (
+	"cmp"
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/micvbang/go-helpy/uint64y"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// RecordBatchName identifies a record batch file of a topic by the offset of
+// its first record, ID, and the epoch of the broker that wrote it.
+//
+// Record batches of epoch 0 are named `<ID>.record_batch`, as they always
+// have been. Record batches of other epochs are named
+// `e<Epoch>-<ID>.record_batch`, such that brokers of different epochs never
+// overwrite each other's record batches, e.g. when a broker that has been
+// fenced off keeps writing. Both IDs and epochs are zero padded, so keys sort
+// by epoch and then ID, and epoch 0 sorts before all other epochs.
+//
+// Epochs must increase with offsets: a record batch of a lower epoch than a
+// record batch at a lower or equal offset is considered a stale write by a
+// broker that was fenced off, and is ignored. See WithEpoch.
+type RecordBatchName struct {
+	ID    uint64
+	Epoch uint64
+}
+
+const recordBatchEpochPrefix = "e"
+
+// Key returns the storage key of the record batch in topicName.
+func (n RecordBatchName) Key(topicName string) string {
+	return filepath.Join(topicName, n.fileName())
+}
+
+func (n RecordBatchName) fileName() string {
+	if n.Epoch == 0 {
+		return fmt.Sprintf("%012d%s", n.ID, recordBatchExtension)
+	}
+	return fmt.Sprintf("%s%010d-%012d%s", recordBatchEpochPrefix, n.Epoch, n.ID, recordBatchExtension)
+}
+
+// ParseRecordBatchName parses the file name of a record batch, in either
+// naming scheme. Directories of fileName are ignored.
+func ParseRecordBatchName(fileName string) (RecordBatchName, error) {
+	fileName = path.Base(fileName)
+	name, found := strings.CutSuffix(fileName, recordBatchExtension)
+	if !found {
+		return RecordBatchName{}, fmt.Errorf("%w: '%s' is not a record batch", seberr.ErrBadInput, fileName)
+	}
+
+	epochStr, idStr, hasEpoch := strings.Cut(name, "-")
+	if !hasEpoch {
+		id, err := uint64y.FromString(name)
+		if err != nil {
+			return RecordBatchName{}, fmt.Errorf("%w: parsing record batch ID of '%s': %s", seberr.ErrBadInput, fileName, err)
+		}
+		return RecordBatchName{ID: id}, nil
+	}
+
+	epochStr, found = strings.CutPrefix(epochStr, recordBatchEpochPrefix)
+	if !found {
+		return RecordBatchName{}, fmt.Errorf("%w: '%s' has bad epoch prefix", seberr.ErrBadInput, fileName)
+	}
+	epoch, err := uint64y.FromString(epochStr)
+	if err != nil {
+		return RecordBatchName{}, fmt.Errorf("%w: parsing epoch of '%s': %s", seberr.ErrBadInput, fileName, err)
+	}
+	id, err := uint64y.FromString(idStr)
+	if err != nil {
+		return RecordBatchName{}, fmt.Errorf("%w: parsing record batch ID of '%s': %s", seberr.ErrBadInput, fileName, err)
+	}
+
+	return RecordBatchName{ID: id, Epoch: epoch}, nil
+}
+
+// dropStaleRecordBatches sorts names by ID and removes the record batches
+// that were written by brokers that had been fenced off: record batches with
+// a lower epoch than a record batch at a lower or equal ID. The number of
+// removed record batches is returned.
+func dropStaleRecordBatches(names []RecordBatchName, minEpoch uint64) ([]RecordBatchName, int) {
+	slices.SortFunc(names, func(a, b RecordBatchName) int {
+		if a.ID != b.ID {
+			return cmp.Compare(a.ID, b.ID)
+		}
+		return cmp.Compare(a.Epoch, b.Epoch)
+	})
+
+	kept := names[:0]
+	dropped := 0
+	epoch := minEpoch
+	for _, name := range names {
+		if name.Epoch < epoch {
+			dropped++
+			continue
+		}
+
+		// record batches at the same ID are sorted by epoch, so the newest
+		// epoch replaces older ones.
+		if len(kept) > 0 && kept[len(kept)-1].ID == name.ID {
+			kept[len(kept)-1] = name
+			dropped++
+		} else {
+			kept = append(kept, name)
+		}
+		epoch = name.Epoch
+	}
+
+	return kept, dropped
+}
+
+// recordBatchEpochs tracks the epochs of a topic's record batches. Since
+// epochs only increase with offsets, only the first record batch of each
+// epoch is kept, making it cheap to track epochs of topics with many record
+// batches.
+type recordBatchEpochs struct {
+	mu sync.RWMutex
+
+	// starts holds the first record batch of each epoch, ordered by ID.
+	starts []RecordBatchName
+}
+
+// newRecordBatchEpochs returns the epochs of the record batches in names,
+// which must be ordered by ID and have increasing epochs.
+func newRecordBatchEpochs(names []RecordBatchName) *recordBatchEpochs {
+	e := &recordBatchEpochs{}
+	for _, name := range names {
+		e.add(name)
+	}
+	return e
+}
+
+// name returns the name of the record batch with the given ID.
+func (e *recordBatchEpochs) name(id uint64) RecordBatchName {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	i, found := slices.BinarySearchFunc(e.starts, id, func(start RecordBatchName, id uint64) int {
+		return cmp.Compare(start.ID, id)
+	})
+	if !found {
+		if i == 0 {
+			return RecordBatchName{ID: id}
+		}
+		i--
+	}
+
+	return RecordBatchName{ID: id, Epoch: e.starts[i].Epoch}
+}
+
+// key returns the storage key of the record batch of topicName with the given
+// ID.
+func (e *recordBatchEpochs) key(topicName string, id uint64) string {
+	return e.name(id).Key(topicName)
+}
+
+// add records the epoch of name, which must not have a lower ID or epoch
+// than record batches that were added before it.
+func (e *recordBatchEpochs) add(name RecordBatchName) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.addLocked(name)
+}
+
+func (e *recordBatchEpochs) addLocked(name RecordBatchName) {
+	if len(e.starts) == 0 {
+		if name.Epoch > 0 {
+			e.starts = append(e.starts, name)
+		}
+		return
+	}
+
+	last := e.starts[len(e.starts)-1]
+	if name.Epoch == last.Epoch {
+		return
+	}
+	if name.ID == last.ID {
+		e.starts[len(e.starts)-1] = name
+		return
+	}
+	e.starts = append(e.starts, name)
+}
+
+// removeFrom forgets the epochs of record batches at or after id, e.g. when
+// adding a record batch failed.
+func (e *recordBatchEpochs) removeFrom(id uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.starts = slices.DeleteFunc(e.starts, func(start RecordBatchName) bool {
+		return start.ID >= id
+	})
+}
+
+// latest returns the epoch of the newest record batch.
+func (e *recordBatchEpochs) latest() uint64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if len(e.starts) == 0 {
+		return 0
+	}
+	return e.starts[len(e.starts)-1].Epoch
+}
+
+// merge adds the epochs of other, which may overlap e.
+func (e *recordBatchEpochs) merge(other *recordBatchEpochs) {
+	other.mu.RLock()
+	starts := slices.Clone(other.starts)
+	other.mu.RUnlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	starts = append(starts, e.starts...)
+	slices.SortStableFunc(starts, func(a, b RecordBatchName) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	e.starts = nil
+	for _, start := range starts {
+		e.addLocked(start)
+	}
+}
+
+// list returns the first record batch of each epoch, ordered by ID.
+func (e *recordBatchEpochs) list() []RecordBatchName {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return slices.Clone(e.starts)
+}
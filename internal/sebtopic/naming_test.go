@@ -0,0 +1,190 @@
+package sebtopic_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRecordBatchName verifies that record batches of epoch 0 are named as
+// they always have been, that record batches of other epochs are named with
+// their epoch, and that ParseRecordBatchName parses both naming schemes.
+func TestRecordBatchName(t *testing.T) {
+	tests := map[string]struct {
+		name sebtopic.RecordBatchName
+		key  string
+	}{
+		"epoch 0":    {name: sebtopic.RecordBatchName{ID: 42}, key: "topic/000000000042.record_batch"},
+		"epoch 1":    {name: sebtopic.RecordBatchName{ID: 42, Epoch: 1}, key: "topic/e0000000001-000000000042.record_batch"},
+		"large":      {name: sebtopic.RecordBatchName{ID: 123456789012, Epoch: 1234567890}, key: "topic/e1234567890-123456789012.record_batch"},
+		"first":      {name: sebtopic.RecordBatchName{ID: 0, Epoch: 7}, key: "topic/e0000000007-000000000000.record_batch"},
+		"unpadded 0": {name: sebtopic.RecordBatchName{ID: 0}, key: "topic/000000000000.record_batch"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			key := test.name.Key("topic")
+			got, err := sebtopic.ParseRecordBatchName(key)
+
+			// Assert
+			require.Equal(t, test.key, key)
+			require.NoError(t, err)
+			require.Equal(t, test.name, got)
+		})
+	}
+}
+
+// TestParseRecordBatchNameBad verifies that ParseRecordBatchName returns
+// seberr.ErrBadInput for file names that aren't record batch names.
+func TestParseRecordBatchNameBad(t *testing.T) {
+	tests := map[string]struct {
+		fileName string
+	}{
+		"extension":    {fileName: "000000000042.large_record"},
+		"id":           {fileName: "abc.record_batch"},
+		"epoch prefix": {fileName: "x0000000001-000000000042.record_batch"},
+		"epoch":        {fileName: "eabc-000000000042.record_batch"},
+		"epoch id":     {fileName: "e0000000001-abc.record_batch"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			_, err := sebtopic.ParseRecordBatchName(test.fileName)
+
+			// Assert
+			require.ErrorIs(t, err, seberr.ErrBadInput)
+		})
+	}
+}
+
+// TestTopicEpochs verifies that topics read record batches written in
+// different epochs, including epoch 0, when opened from their manifest, their
+// offset index or by listing record batches.
+func TestTopicEpochs(t *testing.T) {
+	tests := map[string]struct {
+		optFuncs []func(*sebtopic.Opts)
+	}{
+		"listing":      {optFuncs: []func(*sebtopic.Opts){sebtopic.WithOffsetIndexInterval(0)}},
+		"offset index": {optFuncs: []func(*sebtopic.Opts){sebtopic.WithOffsetIndexInterval(1)}},
+		"manifest":     {optFuncs: []func(*sebtopic.Opts){sebtopic.WithOffsetIndexInterval(0), sebtopic.WithManifest(true)}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			const topicName = "topic"
+			ctx := context.Background()
+			storage := sebtopic.NewMemoryStorage(log)
+
+			expectedRecords := [][]byte{}
+			for _, epoch := range []uint64{0, 0, 2, 2, 5} {
+				topic, err := sebtopic.New(log, storage, topicName, newMemoryCache(t), append(test.optFuncs, sebtopic.WithEpoch(epoch))...)
+				require.NoError(t, err)
+
+				batch := tester.MakeRandomRecordBatch(3)
+				_, err = topic.AddRecords(batch)
+				require.NoError(t, err)
+				expectedRecords = append(expectedRecords, batch.IndividualRecords()...)
+			}
+
+			// Act
+			topic, err := sebtopic.New(log, storage, topicName, newMemoryCache(t), append(test.optFuncs, sebtopic.WithEpoch(5))...)
+			require.NoError(t, err)
+
+			// Assert
+			require.Equal(t, uint64(15), topic.NextOffset())
+
+			gotBatch := tester.NewBatch(15, 4096)
+			err = topic.ReadRecords(ctx, &gotBatch, 0, 15, 0)
+			require.NoError(t, err)
+			require.Equal(t, expectedRecords, gotBatch.IndividualRecords())
+
+			require.Equal(t, sebtopic.RecordBatchName{ID: 6, Epoch: 2}.Key(topicName), topic.RecordBatchKey(6))
+			require.Equal(t, sebtopic.RecordBatchName{ID: 12, Epoch: 5}.Key(topicName), topic.RecordBatchKey(12))
+
+			_, err = storage.Reader(ctx, sebtopic.RecordBatchKey(topicName, 3))
+			require.NoError(t, err)
+			_, err = storage.Reader(ctx, sebtopic.RecordBatchName{ID: 9, Epoch: 2}.Key(topicName))
+			require.NoError(t, err)
+		})
+	}
+}
+
+// TestTopicEpochStaleRecordBatches verifies that record batches written by a
+// broker of an older epoch, after a broker of a newer epoch has taken over the
+// topic, are ignored.
+func TestTopicEpochStaleRecordBatches(t *testing.T) {
+	const topicName = "topic"
+	ctx := context.Background()
+	storage := sebtopic.NewMemoryStorage(log)
+	optFuncs := []func(*sebtopic.Opts){sebtopic.WithOffsetIndexInterval(0)}
+
+	oldTopic, err := sebtopic.New(log, storage, topicName, newMemoryCache(t), append(optFuncs, sebtopic.WithEpoch(1))...)
+	require.NoError(t, err)
+	batch := tester.MakeRandomRecordBatch(3)
+	_, err = oldTopic.AddRecords(batch)
+	require.NoError(t, err)
+	expectedRecords := batch.IndividualRecords()
+
+	newTopic, err := sebtopic.New(log, storage, topicName, newMemoryCache(t), append(optFuncs, sebtopic.WithEpoch(2))...)
+	require.NoError(t, err)
+	batch = tester.MakeRandomRecordBatch(2)
+	_, err = newTopic.AddRecords(batch)
+	require.NoError(t, err)
+	expectedRecords = append(expectedRecords, batch.IndividualRecords()...)
+
+	// old broker, which hasn't been told that it was fenced off, keeps writing
+	for range 2 {
+		_, err = oldTopic.AddRecords(tester.MakeRandomRecordBatch(4))
+		require.NoError(t, err)
+	}
+
+	// Act
+	reopened, err := sebtopic.New(log, storage, topicName, newMemoryCache(t), append(optFuncs, sebtopic.WithEpoch(2))...)
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, uint64(5), reopened.NextOffset())
+
+	gotBatch := tester.NewBatch(5, 4096)
+	err = reopened.ReadRecords(ctx, &gotBatch, 0, 5, 0)
+	require.NoError(t, err)
+	require.Equal(t, expectedRecords, gotBatch.IndividualRecords())
+}
+
+// TestTopicEpochOlder verifies that topics with record batches of a newer
+// epoch can't be opened for writing, but can be opened read-only.
+func TestTopicEpochOlder(t *testing.T) {
+	const topicName = "topic"
+	storage := sebtopic.NewMemoryStorage(log)
+
+	topic, err := sebtopic.New(log, storage, topicName, newMemoryCache(t), sebtopic.WithEpoch(3))
+	require.NoError(t, err)
+	_, err = topic.AddRecords(tester.MakeRandomRecordBatch(2))
+	require.NoError(t, err)
+
+	// Act
+	_, err = sebtopic.New(log, storage, topicName, newMemoryCache(t), sebtopic.WithEpoch(2))
+
+	// Assert
+	require.ErrorIs(t, err, seberr.ErrWritesFrozen)
+
+	// Act
+	readOnly, err := sebtopic.New(log, storage, topicName, newMemoryCache(t), sebtopic.WithEpoch(0), sebtopic.WithReadOnly(true))
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), readOnly.NextOffset())
+}
+
+func newMemoryCache(t *testing.T) *sebcache.Cache {
+	cache, err := sebcache.NewMemoryCache(log)
+	require.NoError(t, err)
+	return cache
+}
@@ -0,0 +1,92 @@
+package sebtopic
+
+import (
+	"sync"
+	"time"
+)
+
+// notFoundCacheMaxKeys is the number of keys that notFoundCache holds before
+// dropping expired keys.
+const notFoundCacheMaxKeys = 10_000
+
+// notFoundCache remembers keys that were not found in storage for ttl, so that
+// repeated reads of keys that don't exist, e.g. by consumers polling for the
+// next record batch, don't each make a request to storage.
+//
+// A nil notFoundCache is valid and remembers nothing.
+type notFoundCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	expires map[string]time.Time
+}
+
+func newNotFoundCache(ttl time.Duration, now func() time.Time) *notFoundCache {
+	if ttl <= 0 {
+		return nil
+	}
+
+	return &notFoundCache{
+		ttl:     ttl,
+		now:     now,
+		expires: make(map[string]time.Time),
+	}
+}
+
+// contains returns whether key was not found within the last ttl.
+func (c *notFoundCache) contains(key string) bool {
+	if c == nil {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires, ok := c.expires[key]
+	if !ok {
+		return false
+	}
+	if !c.now().Before(expires) {
+		delete(c.expires, key)
+		return false
+	}
+	return true
+}
+
+// add remembers that key was not found.
+func (c *notFoundCache) add(key string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if len(c.expires) >= notFoundCacheMaxKeys {
+		for k, expires := range c.expires {
+			if !now.Before(expires) {
+				delete(c.expires, k)
+			}
+		}
+
+		// NOTE: forgetting keys only costs a request to storage.
+		if len(c.expires) >= notFoundCacheMaxKeys {
+			clear(c.expires)
+		}
+	}
+
+	c.expires[key] = now.Add(c.ttl)
+}
+
+// remove forgets that key was not found, e.g. because it was just written.
+func (c *notFoundCache) remove(key string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.expires, key)
+}
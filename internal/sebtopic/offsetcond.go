@@ -12,15 +12,30 @@ type OffsetCond struct {
 	mu            sync.Mutex
 	waiting       *list.List
 	currentOffset uint64
+
+	// nextOffset is the offset following the highest offset that has been
+	// reached. It differs from currentOffset+1 only before any offset has been
+	// reached.
+	nextOffset uint64
 }
 
+// NewOffsetCond returns an OffsetCond for which offset has been reached.
 func NewOffsetCond(offset uint64) *OffsetCond {
 	return &OffsetCond{
 		currentOffset: offset,
+		nextOffset:    offset + 1,
 		waiting:       list.New(),
 	}
 }
 
+// newEmptyOffsetCond returns an OffsetCond for which no offsets have been
+// reached.
+func newEmptyOffsetCond() *OffsetCond {
+	return &OffsetCond{
+		waiting: list.New(),
+	}
+}
+
 type wait struct {
 	offset uint64
 	ch     chan struct{}
@@ -33,6 +48,7 @@ func (c *OffsetCond) Broadcast(offset uint64) {
 	defer c.mu.Unlock()
 
 	c.currentOffset = offset
+	c.nextOffset = offset + 1
 
 	for el := c.waiting.Front(); el != nil; {
 		next := el.Next()
@@ -49,9 +65,28 @@ func (c *OffsetCond) Broadcast(offset uint64) {
 
 // Wait blocks until the given offset has been reached. Can only return errors
 // from the context expiring or nil.
+//
+// NOTE: Wait does not block for offset 0, even if it hasn't been reached. Use
+// WaitReached to also wait for offset 0.
 func (c *OffsetCond) Wait(ctx context.Context, offset uint64) error {
+	return c.wait(ctx, offset, func() bool {
+		return offset <= c.currentOffset
+	})
+}
+
+// WaitReached is the same as Wait, but also blocks for offset 0 until it has
+// been reached.
+func (c *OffsetCond) WaitReached(ctx context.Context, offset uint64) error {
+	return c.wait(ctx, offset, func() bool {
+		return offset < c.nextOffset
+	})
+}
+
+// wait blocks until offset is broadcast, unless reached returns true. reached
+// is called with c.mu held.
+func (c *OffsetCond) wait(ctx context.Context, offset uint64, reached func() bool) error {
 	c.mu.Lock()
-	if offset <= c.currentOffset {
+	if reached() {
 		c.mu.Unlock()
 		return nil
 	}
@@ -7,6 +7,8 @@ import (
 	"time"
 
 	"github.com/micvbang/go-helpy/uint64y"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
 	sebtopic "github.com/micvbang/simple-event-broker/internal/sebtopic"
 	"github.com/stretchr/testify/require"
 )
@@ -151,3 +153,32 @@ func chanClosed(ch chan struct{}, d time.Duration) bool {
 		return false
 	}
 }
+
+// TestOffsetCondWaitReached verifies that WaitReached() blocks for offset 0
+// until it has been broadcast on a topic without records, and doesn't block
+// once it has.
+func TestOffsetCondWaitReached(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		topic, err := sebtopic.New(log, storage, "topic", cache)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		defer cancel()
+
+		// Act, Assert
+		err = topic.OffsetCond.WaitReached(ctx, 0)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		returned := make(chan error)
+		go func() {
+			returned <- topic.OffsetCond.WaitReached(context.Background(), 0)
+		}()
+
+		_, err = topic.AddRecords(tester.MakeRandomRecordBatch(1))
+		require.NoError(t, err)
+		require.NoError(t, <-returned)
+
+		err = topic.OffsetCond.WaitReached(context.Background(), 0)
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,239 @@
+package sebtopic
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"path/filepath"
+	"slices"
+
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// The offset index of a topic lists the offsets of its record batches along
+// with the topic's next offset. It allows a topic to be opened without
+// listing all of its record batch files, which is slow for topics with many
+// batches.
+//
+// The index is only written every Opts.OffsetIndexInterval record batches,
+// so it can be stale. When loading the index, record batches added since it
+// was written are found by probing for a record batch at the index's next
+// offset.
+//
+// Format (little endian):
+//
+//	magic       [4]byte "sebi"
+//	version     uint16
+//	nextOffset  uint64
+//	numBatches  uint32
+//	offsets     [numBatches]uint64
+//	numEpochs   uint32 (version 2+)
+//	epochs      [numEpochs]{batchID uint64, epoch uint64} (version 2+)
+//	checksum    uint32 (crc32 of all of the above)
+//
+// epochs holds the first record batch of each epoch; see recordBatchEpochs.
+
+const offsetIndexExtension = ".offset_index"
+
+var (
+	offsetIndexMagic   = [4]byte{'s', 'e', 'b', 'i'}
+	errOffsetIndexBad  = errors.New("bad offset index")
+	offsetIndexVersion = uint16(2)
+)
+
+// OffsetIndexKey returns the storage key of topicName's offset index.
+func OffsetIndexKey(topicName string) string {
+	return filepath.Join(topicName, "offsets"+offsetIndexExtension)
+}
+
+type offsetIndex struct {
+	nextOffset   uint64
+	batchOffsets []uint64
+	epochs       []RecordBatchName
+}
+
+func writeOffsetIndex(ctx context.Context, storage Storage, topicName string, index offsetIndex) error {
+	buf := bytes.NewBuffer(make([]byte, 0, 4+2+8+4+8*len(index.batchOffsets)+4+16*len(index.epochs)+4))
+	buf.Write(offsetIndexMagic[:])
+	binary.Write(buf, binary.LittleEndian, offsetIndexVersion)
+	binary.Write(buf, binary.LittleEndian, index.nextOffset)
+	binary.Write(buf, binary.LittleEndian, uint32(len(index.batchOffsets)))
+	binary.Write(buf, binary.LittleEndian, index.batchOffsets)
+	binary.Write(buf, binary.LittleEndian, uint32(len(index.epochs)))
+	for _, name := range index.epochs {
+		binary.Write(buf, binary.LittleEndian, name.ID)
+		binary.Write(buf, binary.LittleEndian, name.Epoch)
+	}
+	binary.Write(buf, binary.LittleEndian, crc32.ChecksumIEEE(buf.Bytes()))
+
+	key := OffsetIndexKey(topicName)
+	w, err := storage.Writer(ctx, key)
+	if err != nil {
+		return fmt.Errorf("opening writer '%s': %w", key, err)
+	}
+
+	_, err = w.Write(buf.Bytes())
+	if err != nil {
+		w.Close()
+		return fmt.Errorf("writing offset index: %w", err)
+	}
+
+	err = w.Close()
+	if err != nil {
+		return fmt.Errorf("closing offset index: %w", err)
+	}
+
+	return nil
+}
+
+// readOffsetIndex reads the offset index of topicName. It returns
+// seberr.ErrNotInStorage if there's no index, and errOffsetIndexBad if the
+// index can't be parsed.
+func readOffsetIndex(ctx context.Context, storage Storage, topicName string) (offsetIndex, error) {
+	key := OffsetIndexKey(topicName)
+	r, err := storage.Reader(ctx, key)
+	if err != nil {
+		return offsetIndex{}, fmt.Errorf("opening reader '%s': %w", key, err)
+	}
+	defer r.Close()
+
+	bs, err := io.ReadAll(r)
+	if err != nil {
+		return offsetIndex{}, fmt.Errorf("reading offset index: %w", err)
+	}
+
+	const headerSize = 4 + 2 + 8 + 4
+	const checksumSize = 4
+	if len(bs) < headerSize+checksumSize {
+		return offsetIndex{}, fmt.Errorf("%w: %d bytes too short", errOffsetIndexBad, len(bs))
+	}
+
+	data, checksum := bs[:len(bs)-checksumSize], binary.LittleEndian.Uint32(bs[len(bs)-checksumSize:])
+	if crc32.ChecksumIEEE(data) != checksum {
+		return offsetIndex{}, fmt.Errorf("%w: checksum mismatch", errOffsetIndexBad)
+	}
+
+	if !bytes.Equal(data[:4], offsetIndexMagic[:]) {
+		return offsetIndex{}, fmt.Errorf("%w: bad magic", errOffsetIndexBad)
+	}
+
+	version := binary.LittleEndian.Uint16(data[4:])
+	if version == 0 || version > offsetIndexVersion {
+		return offsetIndex{}, fmt.Errorf("%w: unsupported version %d", errOffsetIndexBad, version)
+	}
+
+	index := offsetIndex{
+		nextOffset: binary.LittleEndian.Uint64(data[6:]),
+	}
+
+	numBatches := int(binary.LittleEndian.Uint32(data[14:]))
+	batchesEnd := headerSize + 8*numBatches
+	if version == 1 && len(data) != batchesEnd || version >= 2 && len(data) < batchesEnd+4 {
+		return offsetIndex{}, fmt.Errorf("%w: expected %d batches, got %d bytes", errOffsetIndexBad, numBatches, len(data)-headerSize)
+	}
+
+	index.batchOffsets = make([]uint64, numBatches)
+	for i := range numBatches {
+		index.batchOffsets[i] = binary.LittleEndian.Uint64(data[headerSize+8*i:])
+	}
+
+	if version >= 2 {
+		numEpochs := int(binary.LittleEndian.Uint32(data[batchesEnd:]))
+		epochsStart := batchesEnd + 4
+		if len(data) != epochsStart+16*numEpochs {
+			return offsetIndex{}, fmt.Errorf("%w: expected %d epochs, got %d bytes", errOffsetIndexBad, numEpochs, len(data)-epochsStart)
+		}
+
+		index.epochs = make([]RecordBatchName, numEpochs)
+		for i := range numEpochs {
+			index.epochs[i] = RecordBatchName{
+				ID:    binary.LittleEndian.Uint64(data[epochsStart+16*i:]),
+				Epoch: binary.LittleEndian.Uint64(data[epochsStart+16*i+8:]),
+			}
+		}
+	}
+
+	return index, nil
+}
+
+// deleteOffsetIndex deletes the topic's offset index, if it exists.
+func (s *Topic) deleteOffsetIndex() error {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	err := s.backingStorage.Delete(OffsetIndexKey(s.topicName))
+	if err != nil && !errors.Is(err, seberr.ErrNotInStorage) {
+		return fmt.Errorf("deleting offset index: %w", err)
+	}
+
+	return nil
+}
+
+// loadOffsetIndex loads the topic's record batch offsets, their epochs and the
+// topic's next offset from its offset index, catching up on record batches
+// added since the index was written. It returns seberr.ErrNotInStorage if
+// there's no index, and errOffsetIndexBad if the index can't be used.
+func (s *Topic) loadOffsetIndex(ctx context.Context) ([]uint64, *recordBatchEpochs, uint64, error) {
+	index, err := readOffsetIndex(ctx, s.backingStorage, s.topicName)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	numIndexed := len(index.batchOffsets)
+	nextOffset := index.nextOffset
+	if numIndexed > 0 && index.batchOffsets[numIndexed-1] >= nextOffset {
+		return nil, nil, 0, fmt.Errorf("%w: batch offset beyond next offset %d", errOffsetIndexBad, nextOffset)
+	}
+
+	epochs := newRecordBatchEpochs(index.epochs)
+	recordBatchOffsets, nextOffset, err := s.catchUp(ctx, epochs, index.batchOffsets, nextOffset)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	caughtUp := len(recordBatchOffsets) - numIndexed
+
+	s.mu.Lock()
+	s.batchesSinceIndex = caughtUp
+	s.mu.Unlock()
+	s.log.Debugf("loaded offset index with %d record batches, caught up on %d", numIndexed, caughtUp)
+
+	return recordBatchOffsets, epochs, nextOffset, nil
+}
+
+// writeOffsetIndex writes the topic's current record batch offsets and next
+// offset to its offset index.
+func (s *Topic) writeOffsetIndex(ctx context.Context) error {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	// NOTE: nextOffset must be read before recordBatchOffsets in order to
+	// guarantee that nextOffset is never smaller than the end of the last
+	// record batch. Record batches added in between are left out, and are
+	// caught up on when loading the index.
+	nextOffset := s.durableNextOffset()
+
+	s.mu.Lock()
+	recordBatchOffsets := make([]uint64, 0, len(s.recordBatchOffsets))
+	for _, batchOffset := range s.recordBatchOffsets {
+		if batchOffset >= nextOffset {
+			break
+		}
+		recordBatchOffsets = append(recordBatchOffsets, batchOffset)
+	}
+	s.batchesSinceIndex = 0
+	s.mu.Unlock()
+
+	epochs := slices.DeleteFunc(s.epochs.list(), func(name RecordBatchName) bool {
+		return name.ID >= nextOffset
+	})
+
+	return writeOffsetIndex(ctx, s.backingStorage, s.topicName, offsetIndex{
+		nextOffset:   nextOffset,
+		batchOffsets: recordBatchOffsets,
+		epochs:       epochs,
+	})
+}
@@ -0,0 +1,139 @@
+package sebtopic_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTopicOffsetIndexUsedWhenOpening verifies that topics are opened from
+// their offset index without listing record batches, and that record batches
+// added after the offset index was last written are caught up on.
+func TestTopicOffsetIndexUsedWhenOpening(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		const topicName = "topic"
+		topic, err := sebtopic.New(log, storage, topicName, cache, sebtopic.WithOffsetIndexInterval(2))
+		require.NoError(t, err)
+
+		// 5 batches: index is written after batch 2 and 4, so batch 5 must be
+		// caught up on.
+		expectedRecords := [][]byte{}
+		for range 5 {
+			batch := tester.MakeRandomRecordBatch(3)
+			_, err = topic.AddRecords(batch)
+			require.NoError(t, err)
+			expectedRecords = append(expectedRecords, batch.IndividualRecords()...)
+		}
+
+		countingStorage := forwardingStorage(storage)
+
+		// Act
+		reopened, err := sebtopic.New(log, countingStorage, topicName, cache, sebtopic.WithOffsetIndexInterval(2))
+		require.NoError(t, err)
+
+		// Assert
+		require.Equal(t, 0, len(countingStorage.ListFilesCalls))
+		require.Equal(t, uint64(15), reopened.NextOffset())
+
+		segments, err := reopened.Segments()
+		require.NoError(t, err)
+		require.Equal(t, 5, len(segments))
+
+		gotBatch := tester.NewBatch(15, 4096)
+		err = reopened.ReadRecords(context.Background(), &gotBatch, 0, 15, 0)
+		require.NoError(t, err)
+		require.Equal(t, expectedRecords, gotBatch.IndividualRecords())
+
+		// appending continues from the caught up offset
+		offsets, err := reopened.AddRecords(tester.MakeRandomRecordBatch(1))
+		require.NoError(t, err)
+		tester.RequireOffsets(t, 15, 16, offsets)
+	})
+}
+
+// TestTopicOffsetIndexBadFallsBackToListing verifies that a topic whose
+// offset index is corrupt is opened by listing its record batches, and that
+// the offset index is rewritten.
+func TestTopicOffsetIndexBadFallsBackToListing(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		const topicName = "topic"
+		topic, err := sebtopic.New(log, storage, topicName, cache, sebtopic.WithOffsetIndexInterval(1))
+		require.NoError(t, err)
+
+		for range 3 {
+			_, err = topic.AddRecords(tester.MakeRandomRecordBatch(2))
+			require.NoError(t, err)
+		}
+
+		w, err := storage.Writer(context.Background(), sebtopic.OffsetIndexKey(topicName))
+		require.NoError(t, err)
+		_, err = w.Write([]byte("not an offset index"))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		// Act
+		reopened, err := sebtopic.New(log, storage, topicName, cache, sebtopic.WithOffsetIndexInterval(1))
+		require.NoError(t, err)
+
+		// Assert
+		require.Equal(t, uint64(6), reopened.NextOffset())
+
+		countingStorage := forwardingStorage(storage)
+		reopened, err = sebtopic.New(log, countingStorage, topicName, cache, sebtopic.WithOffsetIndexInterval(1))
+		require.NoError(t, err)
+		require.Equal(t, 0, len(countingStorage.ListFilesCalls))
+		require.Equal(t, uint64(6), reopened.NextOffset())
+	})
+}
+
+// TestTopicOffsetIndexAfterDropExpiredBatches verifies that the offset index
+// does not refer to record batches dropped by DropExpiredBatches().
+func TestTopicOffsetIndexAfterDropExpiredBatches(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		const topicName = "topic"
+		topic, err := sebtopic.New(log, storage, topicName, cache)
+		require.NoError(t, err)
+
+		expired := time.Now().Add(-time.Hour).UnixMicro()
+		for _, expires := range []int64{expired, expired, 0} {
+			batch := tester.MakeRandomRecordBatch(2)
+			batch.Expires = []int64{expires, expires}
+			_, err = topic.AddRecords(batch)
+			require.NoError(t, err)
+		}
+
+		dropped, err := topic.DropExpiredBatches(time.Now())
+		require.NoError(t, err)
+		require.Equal(t, 2, dropped)
+
+		countingStorage := forwardingStorage(storage)
+
+		// Act
+		reopened, err := sebtopic.New(log, countingStorage, topicName, cache)
+		require.NoError(t, err)
+
+		// Assert
+		require.Equal(t, 0, len(countingStorage.ListFilesCalls))
+
+		segments, err := reopened.Segments()
+		require.NoError(t, err)
+		require.Equal(t, 1, len(segments))
+		require.Equal(t, uint64(4), segments[0].BaseOffset)
+	})
+}
+
+// forwardingStorage returns a MockTopicStorage that forwards all calls to
+// storage, recording the calls.
+func forwardingStorage(storage sebtopic.Storage) *tester.MockTopicStorage {
+	return &tester.MockTopicStorage{
+		ListFilesMock: storage.ListFiles,
+		ReaderMock:    storage.Reader,
+		WriterMock:    storage.Writer,
+		DeleteMock:    storage.Delete,
+	}
+}
@@ -0,0 +1,198 @@
+package sebtopic
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/micvbang/go-helpy/sizey"
+)
+
+// ParallelGzip implements the Compress interface for gzip compression, using
+// multiple goroutines to compress large amounts of data.
+//
+// Data is split into chunks of ChunkSize bytes, each of which is compressed
+// as a separate gzip member by one of up to Workers goroutines. Compressed
+// chunks are written in order as soon as they're ready, making the output a
+// regular multi-member gzip stream that can be read by Gzip, or any other gzip
+// reader. Data smaller than ChunkSize is compressed without starting any
+// goroutines.
+type ParallelGzip struct {
+	// ChunkSize is the number of bytes compressed by each worker at a time.
+	// Defaults to 1 MiB.
+	ChunkSize int
+
+	// Workers is the maximum number of chunks compressed concurrently by each
+	// writer. Defaults to GOMAXPROCS.
+	Workers int
+}
+
+var _ Compress = ParallelGzip{}
+
+func (c ParallelGzip) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	chunkSize := c.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = 1 * sizey.MB
+	}
+
+	workers := c.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	return &parallelGzipWriter{
+		w:       w,
+		workers: workers,
+		chunk:   make([]byte, 0, chunkSize),
+	}, nil
+}
+
+func (ParallelGzip) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+var (
+	gzipWriterPool = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+	gzipBufferPool = sync.Pool{New: func() any { return &bytes.Buffer{} }}
+)
+
+type compressedChunk struct {
+	buf *bytes.Buffer
+	err error
+}
+
+// parallelGzipWriter compresses chunks of data concurrently, writing them to
+// w in the order that they were written.
+type parallelGzipWriter struct {
+	w       io.Writer
+	workers int
+
+	// chunk holds the data that hasn't been handed to a worker yet.
+	chunk []byte
+	// pending holds the results of chunks being compressed, oldest first.
+	pending []chan compressedChunk
+	// written is true once any chunk has been compressed.
+	written bool
+	err     error
+}
+
+func (w *parallelGzipWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	n := 0
+	for len(p) > 0 {
+		copied := copy(w.chunk[len(w.chunk):cap(w.chunk)], p)
+		w.chunk = w.chunk[:len(w.chunk)+copied]
+		p = p[copied:]
+		n += copied
+
+		if len(w.chunk) == cap(w.chunk) {
+			err := w.compressChunk()
+			if err != nil {
+				return n, err
+			}
+		}
+	}
+
+	return n, nil
+}
+
+// Close compresses and writes any remaining data. It doesn't close the
+// underlying writer.
+func (w *parallelGzipWriter) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+
+	// NOTE: the output must contain at least one gzip member in order to be
+	// readable, even if no data was written.
+	if len(w.chunk) > 0 || !w.written {
+		if len(w.pending) == 0 {
+			// NOTE: avoid starting a goroutine for data that fits in a single
+			// chunk.
+			w.written = true
+			w.writeCompressed(compress(w.chunk))
+		} else {
+			w.err = w.compressChunk()
+		}
+	}
+
+	for w.err == nil && len(w.pending) > 0 {
+		w.err = w.writeOldest()
+	}
+	if w.err != nil {
+		return w.err
+	}
+
+	w.err = fmt.Errorf("writer closed")
+	return nil
+}
+
+// compressChunk hands the current chunk to a worker, waiting for the oldest
+// pending chunk to be written if all workers are busy.
+func (w *parallelGzipWriter) compressChunk() error {
+	if len(w.pending) >= w.workers {
+		err := w.writeOldest()
+		if err != nil {
+			return err
+		}
+	}
+
+	chunk := w.chunk
+	w.chunk = make([]byte, 0, cap(chunk))
+	w.written = true
+
+	done := make(chan compressedChunk, 1)
+	w.pending = append(w.pending, done)
+	go func() {
+		done <- compress(chunk)
+	}()
+
+	return nil
+}
+
+// writeOldest waits for the oldest pending chunk to be compressed and writes
+// it to the underlying writer.
+func (w *parallelGzipWriter) writeOldest() error {
+	done := w.pending[0]
+	w.pending = w.pending[1:]
+	w.writeCompressed(<-done)
+	return w.err
+}
+
+func (w *parallelGzipWriter) writeCompressed(c compressedChunk) {
+	defer gzipBufferPool.Put(c.buf)
+
+	if c.err != nil {
+		w.err = fmt.Errorf("compressing chunk: %w", c.err)
+		return
+	}
+
+	_, err := w.w.Write(c.buf.Bytes())
+	if err != nil {
+		w.err = fmt.Errorf("writing compressed chunk: %w", err)
+	}
+}
+
+// compress compresses data as a single gzip member.
+func compress(data []byte) compressedChunk {
+	buf := gzipBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+
+	gw := gzipWriterPool.Get().(*gzip.Writer)
+	defer gzipWriterPool.Put(gw)
+	gw.Reset(buf)
+
+	_, err := gw.Write(data)
+	if err != nil {
+		return compressedChunk{buf: buf, err: err}
+	}
+
+	err = gw.Close()
+	return compressedChunk{buf: buf, err: err}
+}
@@ -0,0 +1,68 @@
+package sebtopic
+
+import (
+	"context"
+	"errors"
+
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// prefetchRecordBatches starts reading the first s.prefetchBatches of
+// recordBatchOffsets from backing storage into the cache in the background.
+// Record batches that are already cached or being prefetched are skipped.
+// They're written to the cache using the values of ctx, e.g. its cache budget.
+func (s *Topic) prefetchRecordBatches(ctx context.Context, recordBatchOffsets []uint64) {
+	for _, recordBatchID := range recordBatchOffsets[:min(s.prefetchBatches, len(recordBatchOffsets))] {
+		recordBatchPath := s.recordBatchPath(recordBatchID)
+		if s.cache.Contains(recordBatchPath) {
+			continue
+		}
+
+		s.prefetchMu.Lock()
+		_, ok := s.prefetching[recordBatchID]
+		if ok {
+			s.prefetchMu.Unlock()
+			continue
+		}
+		done := make(chan struct{})
+		s.prefetching[recordBatchID] = done
+		s.prefetchMu.Unlock()
+
+		go func() {
+			defer func() {
+				s.prefetchMu.Lock()
+				delete(s.prefetching, recordBatchID)
+				s.prefetchMu.Unlock()
+				close(done)
+			}()
+
+			// NOTE: prefetching is done on behalf of consumers, but must not
+			// be cancelled when the request that triggered it ends.
+			err := s.fetchRecordBatch(context.WithoutCancel(ctx), recordBatchID)
+			if err != nil {
+				// the record batch may have been deleted, e.g. by
+				// DropExpiredBatches() or MergeBatches().
+				if errors.Is(err, seberr.ErrNotInStorage) {
+					s.log.Debugf("prefetching %s: %s", recordBatchPath, err)
+					return
+				}
+				s.log.Errorf("prefetching %s: %s", recordBatchPath, err)
+			}
+		}()
+	}
+}
+
+// waitPrefetch waits for recordBatchID to be prefetched, if it's currently
+// being prefetched, or until ctx expires.
+func (s *Topic) waitPrefetch(ctx context.Context, recordBatchID uint64) {
+	s.prefetchMu.Lock()
+	done, ok := s.prefetching[recordBatchID]
+	s.prefetchMu.Unlock()
+
+	if ok {
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+	}
+}
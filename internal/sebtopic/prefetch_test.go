@@ -0,0 +1,58 @@
+package sebtopic_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTopicPrefetchBatches verifies that reading records from a record batch
+// prefetches the configured number of following record batches into the
+// cache, and that prefetched record batches are read correctly.
+func TestTopicPrefetchBatches(t *testing.T) {
+	tester.TestBackingStorage(t, func(t *testing.T, storage sebtopic.Storage) {
+		const (
+			topicName       = "topic"
+			numBatches      = 5
+			recordsPerBatch = 2
+		)
+
+		topic, err := sebtopic.New(log, storage, topicName, newCache(t))
+		require.NoError(t, err)
+
+		expectedRecords := [][]byte{}
+		for range numBatches {
+			batch := tester.MakeRandomRecordBatch(recordsPerBatch)
+			_, err = topic.AddRecords(batch)
+			require.NoError(t, err)
+			expectedRecords = append(expectedRecords, batch.IndividualRecords()...)
+		}
+
+		cache := newCache(t)
+		topic, err = sebtopic.New(log, storage, topicName, cache, sebtopic.WithPrefetchBatches(2))
+		require.NoError(t, err)
+
+		gotBatch := tester.NewBatch(recordsPerBatch, 4096)
+
+		// Act
+		err = topic.ReadRecords(context.Background(), &gotBatch, 0, recordsPerBatch, 0)
+		require.NoError(t, err)
+
+		// Assert
+		require.Equal(t, expectedRecords[:recordsPerBatch], gotBatch.IndividualRecords())
+
+		require.Eventually(t, func() bool {
+			return cache.Contains(sebtopic.RecordBatchKey(topicName, 2)) && cache.Contains(sebtopic.RecordBatchKey(topicName, 4))
+		}, time.Second, time.Millisecond)
+		require.False(t, cache.Contains(sebtopic.RecordBatchKey(topicName, 6)))
+
+		gotBatch = tester.NewBatch(len(expectedRecords), 4096)
+		err = topic.ReadRecords(context.Background(), &gotBatch, 0, len(expectedRecords), 0)
+		require.NoError(t, err)
+		require.Equal(t, expectedRecords, gotBatch.IndividualRecords())
+	})
+}
@@ -0,0 +1,126 @@
+package sebtopic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/micvbang/go-helpy/sizey"
+)
+
+// RangeReader is implemented by Storage that can read byte ranges of files
+// without reading them in their entirety, e.g. using S3 ranged GETs.
+type RangeReader interface {
+	// ReadRange returns a reader of at most length bytes of key, starting at
+	// offset, along with the total size of key. offset must be within key.
+	ReadRange(ctx context.Context, key string, offset int64, length int64) (io.ReadCloser, int64, error)
+}
+
+// rangeReadMinBytes is the minimum number of bytes read by each ranged read.
+// It's large enough that the header and record index of most record batches
+// are read by the first ranged read.
+const rangeReadMinBytes = 32 * sizey.KB
+
+// rangeReadSeeker is an io.ReadSeekCloser that reads key using ranged reads,
+// such that only the parts of key that are actually read are fetched from
+// storage.
+type rangeReadSeeker struct {
+	ctx context.Context
+	rr  RangeReader
+	key string
+
+	size int64
+	pos  int64
+
+	// buf holds the bytes of the most recent ranged read, starting at bufStart
+	buf      []byte
+	bufStart int64
+}
+
+// newRangeReadSeeker returns a rangeReadSeeker for key. It reads the first
+// rangeReadMinBytes bytes of key in order to determine its size.
+func newRangeReadSeeker(ctx context.Context, rr RangeReader, key string) (*rangeReadSeeker, error) {
+	rs := &rangeReadSeeker{
+		ctx: ctx,
+		rr:  rr,
+		key: key,
+		buf: make([]byte, 0, rangeReadMinBytes),
+	}
+
+	err := rs.readRange(0, rangeReadMinBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return rs, nil
+}
+
+func (rs *rangeReadSeeker) Read(p []byte) (int, error) {
+	if rs.pos >= rs.size {
+		return 0, io.EOF
+	}
+
+	if rs.pos < rs.bufStart || rs.pos >= rs.bufStart+int64(len(rs.buf)) {
+		err := rs.readRange(rs.pos, max(int64(len(p)), rangeReadMinBytes))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, rs.buf[rs.pos-rs.bufStart:])
+	rs.pos += int64(n)
+	return n, nil
+}
+
+func (rs *rangeReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += rs.pos
+	case io.SeekEnd:
+		offset += rs.size
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	rs.pos = offset
+	return offset, nil
+}
+
+func (rs *rangeReadSeeker) Close() error {
+	return nil
+}
+
+// readRange reads length bytes of key, starting at offset, into rs.buf.
+func (rs *rangeReadSeeker) readRange(offset int64, length int64) error {
+	if rs.size > 0 {
+		length = min(length, rs.size-offset)
+	}
+
+	rdr, size, err := rs.rr.ReadRange(rs.ctx, rs.key, offset, length)
+	if err != nil {
+		return fmt.Errorf("reading range [%d;%d) of '%s': %w", offset, offset+length, rs.key, err)
+	}
+	defer rdr.Close()
+
+	length = min(length, size-offset)
+	if int64(cap(rs.buf)) < length {
+		rs.buf = make([]byte, length)
+	}
+	rs.buf = rs.buf[:length]
+
+	_, err = io.ReadFull(rdr, rs.buf)
+	if err != nil {
+		rs.buf = rs.buf[:0]
+		return fmt.Errorf("reading range [%d;%d) of '%s': %w", offset, offset+length, rs.key, err)
+	}
+
+	rs.size = size
+	rs.bufStart = offset
+	return nil
+}
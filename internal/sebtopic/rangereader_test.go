@@ -0,0 +1,92 @@
+package sebtopic_test
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/micvbang/go-helpy/sizey"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTopicReadRecordRanged verifies that reading a single record from a
+// record batch that isn't cached only reads a small part of the record batch
+// from backing storage, and does not cache it.
+func TestTopicReadRecordRanged(t *testing.T) {
+	tester.TestBackingStorage(t, func(t *testing.T, storage sebtopic.Storage) {
+		const (
+			topicName  = "topic"
+			numRecords = 1000
+		)
+		topic, err := sebtopic.New(log, storage, topicName, newCache(t), sebtopic.WithCompress(nil))
+		require.NoError(t, err)
+
+		batch := tester.MakeRandomRecordBatchSize(numRecords, 1024)
+		expectedRecords := batch.IndividualRecords()
+		_, err = topic.AddRecords(batch)
+		require.NoError(t, err)
+
+		// NOTE: the newest record batch is read when opening the topic, so
+		// the record batch that is read must not be the newest.
+		_, err = topic.AddRecords(tester.MakeRandomRecordBatch(1))
+		require.NoError(t, err)
+
+		rangeReader, ok := storage.(sebtopic.RangeReader)
+		require.True(t, ok)
+		countingStorage := &rangeCountingStorage{Storage: storage, rangeReader: rangeReader}
+
+		cache := newCache(t)
+		topic, err = sebtopic.New(log, countingStorage, topicName, cache, sebtopic.WithCompress(nil))
+		require.NoError(t, err)
+		cacheSize := cache.Size()
+
+		for _, offset := range []uint64{0, 500, numRecords - 1} {
+			gotBatch := tester.NewBatch(1, 4096)
+
+			// Act
+			err = topic.ReadRecords(context.Background(), &gotBatch, offset, 1, 0)
+			require.NoError(t, err)
+
+			// Assert
+			require.Equal(t, [][]byte{expectedRecords[offset]}, gotBatch.IndividualRecords())
+		}
+
+		require.Greater(t, countingStorage.bytesRead, int64(0))
+		require.LessOrEqual(t, countingStorage.bytesRead, int64(6*32*sizey.KB))
+		require.Less(t, countingStorage.bytesRead, int64(len(batch.Data)))
+		require.Equal(t, cacheSize, cache.Size())
+
+		// reading more than a single record still reads (and caches) the
+		// entire record batch
+		gotBatch := tester.NewBatch(numRecords, 2*sizey.MB)
+		err = topic.ReadRecords(context.Background(), &gotBatch, 0, numRecords, 0)
+		require.NoError(t, err)
+		require.Equal(t, expectedRecords, gotBatch.IndividualRecords())
+		require.Greater(t, cache.Size(), cacheSize+int64(len(batch.Data)))
+	})
+}
+
+// rangeCountingStorage counts the number of bytes read using ReadRange.
+type rangeCountingStorage struct {
+	sebtopic.Storage
+	rangeReader sebtopic.RangeReader
+
+	mu        sync.Mutex
+	bytesRead int64
+}
+
+func (s *rangeCountingStorage) ReadRange(ctx context.Context, key string, offset int64, length int64) (io.ReadCloser, int64, error) {
+	rdr, size, err := s.rangeReader.ReadRange(ctx, key, offset, length)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	s.mu.Lock()
+	s.bytesRead += min(length, size-offset)
+	s.mu.Unlock()
+
+	return rdr, size, nil
+}
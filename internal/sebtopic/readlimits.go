@@ -0,0 +1,37 @@
+package sebtopic
+
+import (
+	"context"
+	"time"
+)
+
+// ReadLimits limits which records can be read from a topic, e.g. in order to
+// only give consumers access to recent data.
+type ReadLimits struct {
+	// StartOffset is the first offset that can be read.
+	StartOffset uint64
+
+	// EndOffset is the offset following the last offset that can be read.
+	// No upper limit if 0.
+	EndOffset uint64
+
+	// NotBefore hides records in record batches committed before NotBefore.
+	// Ignored if zero.
+	NotBefore time.Time
+}
+
+type readLimitsKey struct{}
+
+// WithReadLimits returns a copy of ctx that holds limits. Reads from a Topic
+// using the returned context only return records allowed by limits; records
+// that are not allowed are skipped in the same way as expired records are.
+func WithReadLimits(ctx context.Context, limits ReadLimits) context.Context {
+	return context.WithValue(ctx, readLimitsKey{}, limits)
+}
+
+// ReadLimitsFromContext returns the ReadLimits added to ctx by
+// WithReadLimits.
+func ReadLimitsFromContext(ctx context.Context) (ReadLimits, bool) {
+	limits, ok := ctx.Value(readLimitsKey{}).(ReadLimits)
+	return limits, ok
+}
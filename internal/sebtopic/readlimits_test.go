@@ -0,0 +1,115 @@
+package sebtopic_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReadRecordsReadLimits verifies that ReadRecords() only returns records
+// allowed by the ReadLimits of the given context, and that records that are
+// not allowed are reported as skipped.
+func TestReadRecordsReadLimits(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		topic, err := sebtopic.New(log, storage, "topic", cache)
+		require.NoError(t, err)
+
+		records := [][]byte{}
+		for range 3 {
+			batch := tester.MakeRandomRecordBatch(10)
+			records = append(records, batch.IndividualRecords()...)
+			_, err = topic.AddRecords(batch)
+			require.NoError(t, err)
+		}
+
+		// ensure that the last batch is committed after notBefore
+		time.Sleep(5 * time.Millisecond)
+		notBefore := time.Now()
+		time.Sleep(5 * time.Millisecond)
+
+		batch := tester.MakeRandomRecordBatch(10)
+		records = append(records, batch.IndividualRecords()...)
+		_, err = topic.AddRecords(batch)
+		require.NoError(t, err)
+
+		tests := map[string]struct {
+			limits          sebtopic.ReadLimits
+			offset          uint64
+			expectedRecords [][]byte
+			expectedSkipped int
+		}{
+			"start offset": {
+				limits:          sebtopic.ReadLimits{StartOffset: 15},
+				offset:          5,
+				expectedRecords: records[15:40],
+				expectedSkipped: 10,
+			},
+			"end offset": {
+				limits:          sebtopic.ReadLimits{EndOffset: 25},
+				offset:          5,
+				expectedRecords: records[5:25],
+			},
+			"start and end offset": {
+				limits:          sebtopic.ReadLimits{StartOffset: 12, EndOffset: 17},
+				offset:          0,
+				expectedRecords: records[12:17],
+				expectedSkipped: 12,
+			},
+			"not before": {
+				limits:          sebtopic.ReadLimits{NotBefore: notBefore},
+				offset:          5,
+				expectedRecords: records[30:40],
+				expectedSkipped: 25,
+			},
+			"start offset beyond end of topic": {
+				limits:          sebtopic.ReadLimits{StartOffset: 100},
+				offset:          0,
+				expectedRecords: nil,
+				expectedSkipped: 40,
+			},
+		}
+
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				ctx := sebtopic.WithReadLimits(context.Background(), test.limits)
+				batch := tester.NewBatch(100, 4096)
+
+				// Act
+				err := topic.ReadRecords(ctx, &batch, test.offset, 100, 0)
+				require.NoError(t, err)
+
+				// Assert
+				require.Equal(t, test.expectedRecords, batch.IndividualRecords())
+				require.Equal(t, test.expectedSkipped, batch.Skipped)
+			})
+		}
+	})
+}
+
+// TestReadRecordsReadLimitsEndOffset verifies that ReadRecords() returns
+// ErrOutOfBounds when reading at or beyond the EndOffset of the ReadLimits of
+// the given context.
+func TestReadRecordsReadLimitsEndOffset(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		topic, err := sebtopic.New(log, storage, "topic", cache)
+		require.NoError(t, err)
+
+		_, err = topic.AddRecords(tester.MakeRandomRecordBatch(10))
+		require.NoError(t, err)
+
+		ctx := sebtopic.WithReadLimits(context.Background(), sebtopic.ReadLimits{EndOffset: 5})
+
+		// Act
+		err = topic.ReadRecords(ctx, &sebrecords.Batch{}, 5, 10, 0)
+
+		// Assert
+		require.ErrorIs(t, err, seberr.ErrOutOfBounds)
+	})
+}
@@ -0,0 +1,131 @@
+package sebtopic
+
+import (
+	"context"
+	"fmt"
+)
+
+// Refresh discovers record batches that were added to the topic's backing
+// storage by another process, e.g. a broker writing to a data directory or S3
+// prefix that is shared with read-only replicas, and makes their records
+// readable. Waiting consumers are woken up if the topic's next offset
+// advances. The topic's next offset is returned.
+//
+// If backing storage is a FileWalkerAfter, only the record batches following
+// the newest known one are listed.
+//
+// NOTE: Refresh must only be used for topics that aren't written to by the
+// calling process, since record batches that are in the middle of being added
+// would otherwise be published twice. Record batches that are merged or
+// dropped by the writing process are not noticed.
+func (s *Topic) Refresh(ctx context.Context) (uint64, error) {
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+
+	return s.refresh(ctx)
+}
+
+// RefreshRecordBatch is like Refresh, but is given the name of a record batch
+// that was added by another process, e.g. from an S3 event notification. This
+// avoids listing backing storage when notifications arrive in order: if the
+// record batch is at the topic's next offset, only its header is read, which
+// also warms the cache. Record batches that are already known or stale are
+// ignored, and a record batch beyond the next offset means that notifications
+// were missed or reordered, in which case the topic is refreshed by listing.
+// The topic's next offset is returned.
+func (s *Topic) RefreshRecordBatch(ctx context.Context, name RecordBatchName) (uint64, error) {
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+
+	nextOffset := s.nextOffset.Load()
+	if name.ID < nextOffset || name.Epoch < s.epochs.latest() {
+		return nextOffset, nil
+	}
+	if name.ID > nextOffset {
+		return s.refresh(ctx)
+	}
+
+	s.epochs.add(name)
+	parser, err := s.parseRecordBatch(ctx, name.ID)
+	if err != nil {
+		s.epochs.removeFrom(name.ID)
+		return nextOffset, fmt.Errorf("reading record batch header: %w", err)
+	}
+	newNextOffset := name.ID + uint64(parser.Header.NumRecords)
+	parser.Close()
+
+	s.publishRefreshed([]uint64{name.ID}, newNextOffset)
+	return newNextOffset, nil
+}
+
+// refresh implements Refresh. loadMu must be held.
+func (s *Topic) refresh(ctx context.Context) (uint64, error) {
+	nextOffset := s.nextOffset.Load()
+
+	// only record batches after the newest known one have to be listed
+	afterKey := ""
+	s.mu.Lock()
+	if len(s.recordBatchOffsets) > 0 {
+		afterKey = s.recordBatchPath(s.recordBatchOffsets[len(s.recordBatchOffsets)-1])
+	}
+	s.mu.Unlock()
+
+	// NOTE: record batch keys sort by epoch and then ID, so record batches of
+	// newer epochs are always listed.
+	names := make([]RecordBatchName, 0, 8)
+	err := walkFilesAfter(ctx, s.backingStorage, s.topicName, recordBatchExtension, afterKey, func(file File) error {
+		name, err := ParseRecordBatchName(file.Path)
+		if err != nil {
+			return err
+		}
+
+		if name.ID >= nextOffset {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nextOffset, fmt.Errorf("listing record batches: %w", err)
+	}
+
+	names, dropped := dropStaleRecordBatches(names, s.epochs.latest())
+	if dropped > 0 {
+		s.log.Warnf("ignoring %d stale record batches", dropped)
+	}
+	if len(names) == 0 {
+		return nextOffset, nil
+	}
+	if names[0].ID != nextOffset {
+		return nextOffset, fmt.Errorf("record batch at next offset %d missing, found %d", nextOffset, names[0].ID)
+	}
+
+	newOffsets := make([]uint64, 0, len(names))
+	for _, name := range names {
+		s.epochs.add(name)
+		newOffsets = append(newOffsets, name.ID)
+	}
+
+	newestRecordBatchOffset := newOffsets[len(newOffsets)-1]
+	parser, err := s.parseRecordBatch(ctx, newestRecordBatchOffset)
+	if err != nil {
+		s.epochs.removeFrom(nextOffset)
+		return nextOffset, fmt.Errorf("reading record batch header: %w", err)
+	}
+	newNextOffset := newestRecordBatchOffset + uint64(parser.Header.NumRecords)
+	parser.Close()
+
+	s.publishRefreshed(newOffsets, newNextOffset)
+	return newNextOffset, nil
+}
+
+// publishRefreshed makes the records of the refreshed record batches at
+// offsets readable and wakes up waiting consumers.
+func (s *Topic) publishRefreshed(offsets []uint64, nextOffset uint64) {
+	s.mu.Lock()
+	s.recordBatchOffsets = append(s.recordBatchOffsets, offsets...)
+	s.mu.Unlock()
+	s.nextOffset.Store(nextOffset)
+
+	s.log.Debugf("refreshed %d record batches, next offset %d", len(offsets), nextOffset)
+	s.OffsetCond.Broadcast(nextOffset - 1)
+}
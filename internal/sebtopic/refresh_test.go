@@ -0,0 +1,199 @@
+package sebtopic_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTopicRefresh verifies that Refresh makes record batches that were added
+// to backing storage by another Topic readable, and wakes up consumers waiting
+// for them.
+func TestTopicRefresh(t *testing.T) {
+	tester.TestBackingStorage(t, func(t *testing.T, backingStorage sebtopic.Storage) {
+		ctx := context.Background()
+
+		writerCache, err := sebcache.NewMemoryCache(log)
+		require.NoError(t, err)
+		writer, err := sebtopic.New(log, backingStorage, "topic", writerCache)
+		require.NoError(t, err)
+
+		_, err = writer.AddRecords(tester.MakeRandomRecordBatch(2))
+		require.NoError(t, err)
+
+		readerCache, err := sebcache.NewMemoryCache(log)
+		require.NoError(t, err)
+		reader, err := sebtopic.New(log, backingStorage, "topic", readerCache)
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), reader.NextOffset())
+
+		batch1 := tester.MakeRandomRecordBatch(3)
+		_, err = writer.AddRecords(batch1)
+		require.NoError(t, err)
+		batch2 := tester.MakeRandomRecordBatch(4)
+		_, err = writer.AddRecords(batch2)
+		require.NoError(t, err)
+
+		waited := make(chan error)
+		go func() {
+			waitCtx, cancel := context.WithTimeout(ctx, time.Second)
+			defer cancel()
+			waited <- reader.OffsetCond.Wait(waitCtx, 8)
+		}()
+
+		// Act
+		nextOffset, err := reader.Refresh(ctx)
+
+		// Assert
+		require.NoError(t, err)
+		require.Equal(t, uint64(9), nextOffset)
+		require.Equal(t, uint64(9), reader.NextOffset())
+		require.NoError(t, <-waited)
+
+		gotBatch := tester.NewBatch(7, 4096)
+		err = reader.ReadRecords(ctx, &gotBatch, 2, 7, 0)
+		require.NoError(t, err)
+		require.Equal(t, append(batch1.Data, batch2.Data...), gotBatch.Data)
+
+		// Act
+		nextOffset, err = reader.Refresh(ctx)
+
+		// Assert
+		require.NoError(t, err)
+		require.Equal(t, uint64(9), nextOffset)
+	})
+}
+
+// TestTopicRefreshRecordBatch verifies that RefreshRecordBatch makes the
+// given record batch readable and caches it, ignores record batches that are
+// already known, and falls back to listing backing storage when given a record
+// batch beyond the next offset.
+func TestTopicRefreshRecordBatch(t *testing.T) {
+	ctx := context.Background()
+	backingStorage := sebtopic.NewMemoryStorage(log)
+
+	writer, err := sebtopic.New(log, backingStorage, "topic", nil)
+	require.NoError(t, err)
+	_, err = writer.AddRecords(tester.MakeRandomRecordBatch(2))
+	require.NoError(t, err)
+
+	readerCache, err := sebcache.NewMemoryCache(log)
+	require.NoError(t, err)
+	reader, err := sebtopic.New(log, backingStorage, "topic", readerCache, sebtopic.WithReadOnly(true))
+	require.NoError(t, err)
+
+	for range 3 {
+		_, err = writer.AddRecords(tester.MakeRandomRecordBatch(3))
+		require.NoError(t, err)
+	}
+
+	// Act
+	nextOffset, err := reader.RefreshRecordBatch(ctx, sebtopic.RecordBatchName{ID: 2})
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), nextOffset)
+	require.Equal(t, uint64(5), reader.NextOffset())
+	require.True(t, readerCache.Contains(sebtopic.RecordBatchKey("topic", 2)))
+
+	// Act
+	nextOffset, err = reader.RefreshRecordBatch(ctx, sebtopic.RecordBatchName{ID: 0})
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), nextOffset)
+
+	// Act
+	nextOffset, err = reader.RefreshRecordBatch(ctx, sebtopic.RecordBatchName{ID: 8})
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, uint64(11), nextOffset)
+
+	batch := tester.NewBatch(9, 4096)
+	err = reader.ReadRecords(ctx, &batch, 2, 9, 0)
+	require.NoError(t, err)
+	require.Equal(t, 9, batch.Len())
+}
+
+// TestParseRecordBatchKey verifies that ParseRecordBatchKey is the inverse of
+// RecordBatchKey, and rejects keys that aren't record batch keys.
+func TestParseRecordBatchKey(t *testing.T) {
+	topicName, name, err := sebtopic.ParseRecordBatchKey(sebtopic.RecordBatchKey("a/topic", 42))
+	require.NoError(t, err)
+	require.Equal(t, "a/topic", topicName)
+	require.Equal(t, sebtopic.RecordBatchName{ID: 42}, name)
+
+	topicName, name, err = sebtopic.ParseRecordBatchKey(sebtopic.RecordBatchName{ID: 42, Epoch: 3}.Key("a/topic"))
+	require.NoError(t, err)
+	require.Equal(t, "a/topic", topicName)
+	require.Equal(t, sebtopic.RecordBatchName{ID: 42, Epoch: 3}, name)
+
+	tests := map[string]struct {
+		key string
+	}{
+		"no topic":      {key: "000000000042.record_batch"},
+		"extension":     {key: "topic/000000000042.offset_index"},
+		"not a number":  {key: "topic/abc.record_batch"},
+		"empty":         {key: ""},
+		"manifest file": {key: "topic/manifest.json"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			_, _, err := sebtopic.ParseRecordBatchKey(test.key)
+
+			// Assert
+			require.ErrorIs(t, err, seberr.ErrBadInput)
+		})
+	}
+}
+
+// TestTopicReadOnly verifies that read-only topics reject writes with
+// seberr.ErrWritesFrozen and don't write to backing storage when opened, while
+// still serving reads.
+func TestTopicReadOnly(t *testing.T) {
+	ctx := context.Background()
+	backingStorage := sebtopic.NewMemoryStorage(log)
+	cache, err := sebcache.NewMemoryCache(log)
+	require.NoError(t, err)
+
+	writer, err := sebtopic.New(log, backingStorage, "topic", cache, sebtopic.WithOffsetIndexInterval(0))
+	require.NoError(t, err)
+	batch := tester.MakeRandomRecordBatch(3)
+	_, err = writer.AddRecords(batch)
+	require.NoError(t, err)
+
+	// Act
+	readOnly, err := sebtopic.New(log, backingStorage, "topic", cache, sebtopic.WithReadOnly(true), sebtopic.WithManifest(true))
+	require.NoError(t, err)
+
+	// Assert
+	files, err := backingStorage.ListFiles(ctx, "topic", "")
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	gotBatch := tester.NewBatch(3, 4096)
+	err = readOnly.ReadRecords(ctx, &gotBatch, 0, 3, 0)
+	require.NoError(t, err)
+	require.Equal(t, batch.Data, gotBatch.Data)
+
+	_, err = readOnly.AddRecords(tester.MakeRandomRecordBatch(1))
+	require.ErrorIs(t, err, seberr.ErrWritesFrozen)
+
+	_, err = readOnly.DropExpiredBatches(time.Now())
+	require.ErrorIs(t, err, seberr.ErrWritesFrozen)
+
+	_, err = readOnly.MergeBatches(10, 4096)
+	require.ErrorIs(t, err, seberr.ErrWritesFrozen)
+
+	err = readOnly.Delete()
+	require.ErrorIs(t, err, seberr.ErrWritesFrozen)
+}
@@ -0,0 +1,174 @@
+package sebtopic
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// StorageConfig is given to a StorageFactory when creating Storage. Each
+// StorageFactory uses the fields that are relevant to it.
+type StorageConfig struct {
+	// Dir is the directory that storage on local disk is rooted in.
+	Dir string
+
+	// Mmap makes storage on local disk map files into memory when reading
+	// them. See WithDiskMmap.
+	Mmap bool
+
+	// OpenFiles is the maximum number of files that storage on local disk
+	// keeps open between reads. See WithDiskOpenFiles.
+	OpenFiles int
+
+	// MemoryMaxBytes is the maximum number of bytes that storage in memory
+	// keeps in memory. See WithMemoryMaxBytes.
+	MemoryMaxBytes int64
+
+	// MemorySpillDir is the directory that storage in memory spills the
+	// oldest files to when MemoryMaxBytes is reached. See WithMemorySpillDir.
+	MemorySpillDir string
+
+	// Bucket is the name of the bucket used by object storage, e.g. S3.
+	Bucket string
+
+	// StagingDir is the directory that object storage stages record batches
+	// in until they've been uploaded. See S3Opts.
+	StagingDir string
+
+	// Endpoint, PathStyle and InsecureSkipVerify configure the connection to
+	// S3 compatible object storage. See S3Opts.
+	Endpoint           string
+	PathStyle          bool
+	InsecureSkipVerify bool
+
+	// NotFoundTTL is the amount of time that object storage remembers keys
+	// that were not found. See S3Opts.
+	NotFoundTTL time.Duration
+
+	// S3Retry configures retries and the circuit breaker of requests to
+	// object storage. See S3Opts.
+	S3Retry S3RetryOpts
+
+	// MaxConcurrentUploads is the maximum number of concurrent uploads to
+	// object storage. See S3Opts.
+	MaxConcurrentUploads int
+
+	// Params holds storage specific configuration, e.g. for Storage
+	// registered by other modules.
+	Params map[string]string
+}
+
+// StorageFactory creates Storage from config.
+type StorageFactory func(ctx context.Context, log logger.Logger, config StorageConfig) (Storage, error)
+
+var (
+	storageFactoriesMu sync.RWMutex
+	storageFactories   = map[string]StorageFactory{}
+)
+
+func init() {
+	RegisterStorage("memory", func(_ context.Context, log logger.Logger, config StorageConfig) (Storage, error) {
+		return NewMemoryStorage(log,
+			WithMemoryMaxBytes(config.MemoryMaxBytes),
+			WithMemorySpillDir(config.MemorySpillDir),
+		), nil
+	})
+
+	RegisterStorage("disk", func(_ context.Context, log logger.Logger, config StorageConfig) (Storage, error) {
+		if config.Dir == "" {
+			return nil, fmt.Errorf("%w: disk storage requires a directory", seberr.ErrBadInput)
+		}
+		return NewDiskStorage(log, config.Dir, WithDiskMmap(config.Mmap), WithDiskOpenFiles(config.OpenFiles)), nil
+	})
+
+	RegisterStorage("s3", newS3StorageFromStorageConfig)
+
+	// MinIO is S3 compatible, but must be given an endpoint and addressed
+	// using path-style URLs.
+	RegisterStorage("minio", func(ctx context.Context, log logger.Logger, storageConfig StorageConfig) (Storage, error) {
+		if storageConfig.Endpoint == "" {
+			return nil, fmt.Errorf("%w: minio storage requires an endpoint", seberr.ErrBadInput)
+		}
+
+		storageConfig.PathStyle = true
+		return newS3StorageFromStorageConfig(ctx, log, storageConfig)
+	})
+}
+
+func newS3StorageFromStorageConfig(ctx context.Context, log logger.Logger, storageConfig StorageConfig) (Storage, error) {
+	if storageConfig.Bucket == "" {
+		return nil, fmt.Errorf("%w: s3 storage requires a bucket", seberr.ErrBadInput)
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading aws config: %w", err)
+	}
+
+	log = log.WithField("bucket", storageConfig.Bucket)
+	return NewS3StorageFromConfig(log, cfg, storageConfig.Bucket, "",
+		WithS3StagingDir(storageConfig.StagingDir),
+		WithS3Endpoint(storageConfig.Endpoint),
+		WithS3PathStyle(storageConfig.PathStyle),
+		WithS3InsecureSkipVerify(storageConfig.InsecureSkipVerify),
+		WithS3NotFoundTTL(storageConfig.NotFoundTTL),
+		WithS3Retry(storageConfig.S3Retry),
+		WithS3MaxConcurrentUploads(storageConfig.MaxConcurrentUploads),
+	), nil
+}
+
+// RegisterStorage makes Storage created by factory available by name, e.g.
+// for selecting it in configuration. It's intended to be called from init()
+// and panics if name is already registered.
+func RegisterStorage(name string, factory StorageFactory) {
+	storageFactoriesMu.Lock()
+	defer storageFactoriesMu.Unlock()
+
+	if factory == nil {
+		panic(fmt.Sprintf("sebtopic: storage factory '%s' is nil", name))
+	}
+	if _, exists := storageFactories[name]; exists {
+		panic(fmt.Sprintf("sebtopic: storage '%s' registered twice", name))
+	}
+
+	storageFactories[name] = factory
+}
+
+// NewStorageByName creates Storage using the factory registered as name.
+// seberr.ErrNotFound is returned if no factory is registered as name.
+func NewStorageByName(ctx context.Context, log logger.Logger, name string, config StorageConfig) (Storage, error) {
+	storageFactoriesMu.RLock()
+	factory, ok := storageFactories[name]
+	storageFactoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: storage '%s', expected one of %s", seberr.ErrNotFound, name, strings.Join(StorageNames(), ", "))
+	}
+
+	storage, err := factory(ctx, log, config)
+	if err != nil {
+		return nil, fmt.Errorf("creating storage '%s': %w", name, err)
+	}
+
+	return storage, nil
+}
+
+// StorageNames returns the sorted names of all registered Storage.
+func StorageNames() []string {
+	storageFactoriesMu.RLock()
+	defer storageFactoriesMu.RUnlock()
+
+	names := make([]string, 0, len(storageFactories))
+	for name := range storageFactories {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
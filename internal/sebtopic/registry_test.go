@@ -0,0 +1,73 @@
+package sebtopic_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNewStorageByName verifies that storage registered using
+// RegisterStorage() is created by NewStorageByName() with the given config.
+func TestNewStorageByName(t *testing.T) {
+	const name = "test-registry-storage"
+	expectedConfig := sebtopic.StorageConfig{
+		Dir:    "some-dir",
+		Params: map[string]string{"key": "value"},
+	}
+	expectedStorage := sebtopic.NewMemoryStorage(log)
+
+	var gotConfig sebtopic.StorageConfig
+	sebtopic.RegisterStorage(name, func(_ context.Context, _ logger.Logger, config sebtopic.StorageConfig) (sebtopic.Storage, error) {
+		gotConfig = config
+		return expectedStorage, nil
+	})
+
+	// Act
+	storage, err := sebtopic.NewStorageByName(context.Background(), log, name, expectedConfig)
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, expectedStorage, storage)
+	require.Equal(t, expectedConfig, gotConfig)
+	require.Contains(t, sebtopic.StorageNames(), name)
+
+	require.Panics(t, func() {
+		sebtopic.RegisterStorage(name, func(context.Context, logger.Logger, sebtopic.StorageConfig) (sebtopic.Storage, error) {
+			return nil, nil
+		})
+	})
+}
+
+// TestNewStorageByNameBuiltin verifies that the built-in storages are
+// registered, and that their configuration is validated.
+func TestNewStorageByNameBuiltin(t *testing.T) {
+	tests := map[string]struct {
+		config sebtopic.StorageConfig
+		err    error
+	}{
+		"memory": {},
+		"disk":   {config: sebtopic.StorageConfig{Dir: t.TempDir()}},
+		"s3":     {err: seberr.ErrBadInput},
+		"minio":  {config: sebtopic.StorageConfig{Bucket: "bucket"}, err: seberr.ErrBadInput},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			storage, err := sebtopic.NewStorageByName(context.Background(), log, name, test.config)
+
+			// Assert
+			require.ErrorIs(t, err, test.err)
+			if test.err == nil {
+				require.NotNil(t, storage)
+			}
+		})
+	}
+
+	_, err := sebtopic.NewStorageByName(context.Background(), log, "does-not-exist", sebtopic.StorageConfig{})
+	require.ErrorIs(t, err, seberr.ErrNotFound)
+}
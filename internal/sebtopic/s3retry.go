@@ -0,0 +1,193 @@
+package sebtopic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/retry"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+type S3RetryOpts struct {
+	// MaxAttempts is the maximum number of times a request is attempted
+	// before its error is returned. Requests are not retried if it's 1 or
+	// less.
+	MaxAttempts int
+
+	// BaseDelay is the delay before the first retry. It's doubled for each
+	// following retry, up to MaxDelay. The actual delay is chosen at random
+	// between 0 and the computed delay, such that retries of concurrent
+	// requests are spread out.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// BreakerFailures is the number of consecutive failed requests after
+	// which the circuit breaker trips. While it's tripped, requests fail
+	// right away with seberr.ErrStorageUnavailable, until BreakerCooldown has
+	// passed and a single request is let through to probe whether S3 is
+	// available again. Disabled if 0.
+	BreakerFailures int
+	BreakerCooldown time.Duration
+}
+
+// WithS3Retry sets how requests to S3 are retried and when the circuit breaker
+// trips. See S3RetryOpts.
+func WithS3Retry(retry S3RetryOpts) func(*S3Opts) {
+	return func(o *S3Opts) {
+		o.Retry = retry
+	}
+}
+
+const (
+	BreakerClosed   = retry.BreakerClosed
+	BreakerOpen     = retry.BreakerOpen
+	BreakerHalfOpen = retry.BreakerHalfOpen
+)
+
+// S3RetryStats counts the retries and circuit breaker state changes of
+// requests to S3.
+type S3RetryStats = retry.Stats
+
+// retryingS3API is an S3API that retries failed requests with exponential
+// backoff and jitter, and stops making requests while S3 appears to be
+// unavailable.
+type retryingS3API struct {
+	s3      S3API
+	retrier *retry.Retrier
+}
+
+func newRetryingS3API(log logger.Logger, s3 S3API, opts S3RetryOpts, now func() time.Time) *retryingS3API {
+	return &retryingS3API{
+		s3: s3,
+		retrier: retry.New(retry.Opts(opts), now, func(state string, err error) {
+			switch state {
+			case retry.BreakerOpen:
+				log.Warnf("s3 circuit breaker opened: %s", err)
+			case retry.BreakerHalfOpen:
+				log.Infof("s3 circuit breaker half-open, probing")
+			case retry.BreakerClosed:
+				log.Infof("s3 circuit breaker closed")
+			}
+		}),
+	}
+}
+
+func (r *retryingS3API) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return retryS3(ctx, r, nil, func() (*s3.GetObjectOutput, error) {
+		return r.s3.GetObject(ctx, params, optFns...)
+	})
+}
+
+func (r *retryingS3API) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	return retryS3(ctx, r, params.Body, func() (*s3.PutObjectOutput, error) {
+		return r.s3.PutObject(ctx, params, optFns...)
+	})
+}
+
+func (r *retryingS3API) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	return retryS3(ctx, r, nil, func() (*s3.ListObjectsV2Output, error) {
+		return r.s3.ListObjectsV2(ctx, params, optFns...)
+	})
+}
+
+func (r *retryingS3API) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	return retryS3(ctx, r, nil, func() (*s3.DeleteObjectOutput, error) {
+		return r.s3.DeleteObject(ctx, params, optFns...)
+	})
+}
+
+// retryS3 calls request until it succeeds, fails with an error that isn't
+// retryable, or has been attempted MaxAttempts times. If body is non-nil, it's
+// the body of the request; it's rewound before each retry, and the request is
+// not retried if it can't be.
+func retryS3[T any](ctx context.Context, r *retryingS3API, body io.Reader, request func() (T, error)) (T, error) {
+	var zero T
+
+	bodyStart := int64(-1)
+	if seeker, ok := body.(io.Seeker); ok {
+		offset, err := seeker.Seek(0, io.SeekCurrent)
+		if err == nil {
+			bodyStart = offset
+		}
+	}
+
+	maxAttempts := r.retrier.MaxAttempts()
+	if body != nil && bodyStart < 0 {
+		maxAttempts = 1
+	}
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			err := retry.Sleep(ctx, r.retrier.Backoff(attempt))
+			if err != nil {
+				return zero, err
+			}
+
+			if body != nil {
+				_, err = body.(io.Seeker).Seek(bodyStart, io.SeekStart)
+				if err != nil {
+					return zero, fmt.Errorf("rewinding request body: %w", err)
+				}
+			}
+		}
+
+		err := r.retrier.Allow()
+		if err != nil {
+			return zero, fmt.Errorf("%w: s3 %w", seberr.ErrStorageUnavailable, err)
+		}
+
+		out, err := request()
+		switch {
+		case ctx.Err() != nil:
+			r.retrier.Abandoned()
+			return out, err
+		case err == nil || !s3Retryable(ctx, err):
+			r.retrier.Succeeded()
+			return out, err
+		}
+
+		r.retrier.Failed(err)
+		if attempt+1 >= maxAttempts {
+			return zero, err
+		}
+		r.retrier.Retried()
+	}
+}
+
+func (r *retryingS3API) Stats() S3RetryStats {
+	return r.retrier.Stats()
+}
+
+// s3Retryable returns whether err may be resolved by retrying the request,
+// i.e. whether it's caused by S3 being unavailable rather than by the request.
+func s3Retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var responseErr *awshttp.ResponseError
+	if errors.As(err, &responseErr) {
+		statusCode := responseErr.HTTPStatusCode()
+		return statusCode >= 500 || statusCode == http.StatusTooManyRequests || statusCode == http.StatusRequestTimeout
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "InternalError", "ServiceUnavailable", "SlowDown", "RequestTimeout":
+			return true
+		}
+		return apiErr.ErrorFault() == smithy.FaultServer
+	}
+
+	// errors without a response, e.g. connection errors
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
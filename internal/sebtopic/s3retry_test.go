@@ -0,0 +1,198 @@
+package sebtopic_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestS3RetryGetObject verifies that requests that fail because S3 is
+// unavailable are retried, and that requests that fail for other reasons are
+// not.
+func TestS3RetryGetObject(t *testing.T) {
+	expectedBytes := tester.RandomBytes(t, 64)
+
+	tests := map[string]struct {
+		errs          []error
+		expectedCalls int
+		expectedErr   error
+	}{
+		"recovers": {
+			errs:          []error{s3StatusError(http.StatusServiceUnavailable), s3StatusError(http.StatusInternalServerError)},
+			expectedCalls: 3,
+		},
+		"throttled": {
+			errs:          []error{s3StatusError(http.StatusTooManyRequests)},
+			expectedCalls: 2,
+		},
+		"gives up": {
+			errs:          []error{s3StatusError(http.StatusServiceUnavailable), s3StatusError(http.StatusServiceUnavailable), s3StatusError(http.StatusServiceUnavailable)},
+			expectedCalls: 3,
+			expectedErr:   errS3Status,
+		},
+		"not found": {
+			errs:          []error{&smithy.GenericAPIError{Code: "NoSuchKey"}},
+			expectedCalls: 1,
+			expectedErr:   seberr.ErrNotInStorage,
+		},
+		"forbidden": {
+			errs:          []error{s3StatusError(http.StatusForbidden)},
+			expectedCalls: 1,
+			expectedErr:   errS3Status,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			calls := 0
+			s3Mock := &tester.S3Mock{}
+			s3Mock.MockGetObject = func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+				calls += 1
+				if calls <= len(test.errs) {
+					return nil, test.errs[calls-1]
+				}
+				return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(expectedBytes))}, nil
+			}
+
+			s3Storage := sebtopic.NewS3Storage(log, s3Mock, "mybucket", "", sebtopic.WithS3Retry(sebtopic.S3RetryOpts{
+				MaxAttempts: 3,
+				BaseDelay:   time.Microsecond,
+			}))
+
+			// Act
+			rdr, err := s3Storage.Reader(context.Background(), "topic/000.record_batch")
+
+			// Assert
+			require.Equal(t, test.expectedCalls, calls)
+			if test.expectedErr != nil {
+				require.ErrorIs(t, err, test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			defer rdr.Close()
+
+			gotBytes, err := io.ReadAll(rdr)
+			require.NoError(t, err)
+			require.Equal(t, expectedBytes, gotBytes)
+			require.Equal(t, uint64(calls-1), s3Storage.RetryStats().Retries)
+		})
+	}
+}
+
+// TestS3RetryPutObjectRewindsBody verifies that the body of a retried upload
+// is rewound, such that the complete file is uploaded.
+func TestS3RetryPutObjectRewindsBody(t *testing.T) {
+	expectedBytes := tester.RandomBytes(t, 512)
+
+	calls := 0
+	var gotBytes []byte
+	s3Mock := &tester.S3Mock{}
+	s3Mock.MockPutObject = func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+		calls += 1
+		bs, err := io.ReadAll(params.Body)
+		require.NoError(t, err)
+		if calls == 1 {
+			return nil, s3StatusError(http.StatusServiceUnavailable)
+		}
+
+		gotBytes = bs
+		return &s3.PutObjectOutput{}, nil
+	}
+
+	s3Storage := sebtopic.NewS3Storage(log, s3Mock, "mybucket", "", sebtopic.WithS3Retry(sebtopic.S3RetryOpts{
+		MaxAttempts: 2,
+		BaseDelay:   time.Microsecond,
+	}))
+
+	wtr, err := s3Storage.Writer(context.Background(), "topic/000.record_batch")
+	require.NoError(t, err)
+	tester.WriteAndClose(t, wtr, expectedBytes)
+
+	// Assert
+	require.Equal(t, 2, calls)
+	require.Equal(t, expectedBytes, gotBytes)
+}
+
+// TestS3CircuitBreaker verifies that the circuit breaker trips after the
+// configured number of consecutive failures, that requests fail right away
+// with seberr.ErrStorageUnavailable while it's open, and that it closes again
+// once a probe succeeds after the cooldown.
+func TestS3CircuitBreaker(t *testing.T) {
+	const cooldown = 50 * time.Millisecond
+
+	calls := 0
+	available := false
+	s3Mock := &tester.S3Mock{}
+	s3Mock.MockDeleteObject = func(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+		calls += 1
+		if !available {
+			return nil, s3StatusError(http.StatusServiceUnavailable)
+		}
+		return &s3.DeleteObjectOutput{}, nil
+	}
+
+	s3Storage := sebtopic.NewS3Storage(log, s3Mock, "mybucket", "", sebtopic.WithS3Retry(sebtopic.S3RetryOpts{
+		MaxAttempts:     1,
+		BreakerFailures: 2,
+		BreakerCooldown: cooldown,
+	}))
+
+	for range 2 {
+		err := s3Storage.Delete("topic/000.record_batch")
+		require.ErrorIs(t, err, errS3Status)
+	}
+	require.Equal(t, sebtopic.BreakerOpen, s3Storage.RetryStats().BreakerState)
+
+	// Act
+	err := s3Storage.Delete("topic/000.record_batch")
+
+	// Assert
+	require.ErrorIs(t, err, seberr.ErrStorageUnavailable)
+	require.Equal(t, 2, calls)
+
+	// failed probe opens the circuit breaker again
+	time.Sleep(cooldown)
+	err = s3Storage.Delete("topic/000.record_batch")
+	require.ErrorIs(t, err, errS3Status)
+	require.Equal(t, 3, calls)
+	require.Equal(t, sebtopic.BreakerOpen, s3Storage.RetryStats().BreakerState)
+
+	// successful probe closes the circuit breaker
+	available = true
+	time.Sleep(cooldown)
+	err = s3Storage.Delete("topic/000.record_batch")
+	require.NoError(t, err)
+
+	stats := s3Storage.RetryStats()
+	require.Equal(t, sebtopic.BreakerClosed, stats.BreakerState)
+	require.Equal(t, uint64(2), stats.BreakerOpened)
+	require.Equal(t, uint64(2), stats.BreakerHalfOpens)
+	require.Equal(t, uint64(1), stats.BreakerClosed)
+	require.Equal(t, uint64(1), stats.FastFails)
+}
+
+var errS3Status = errors.New("s3 status")
+
+// s3StatusError returns an error as returned by the S3 client when S3
+// responds with statusCode.
+func s3StatusError(statusCode int) error {
+	return &awshttp.ResponseError{
+		ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: statusCode}},
+			Err:      errS3Status,
+		},
+	}
+}
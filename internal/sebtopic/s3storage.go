@@ -2,15 +2,21 @@ package sebtopic
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"net/http"
 	"os"
 	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/smithy-go"
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
@@ -23,69 +29,358 @@ type S3Storage struct {
 	s3          S3API
 	bucketName  string
 	s3KeyPrefix string
+	stagingDir  string
+	notFound    *notFoundCache
+	retry       *retryingS3API
+	uploads     *uploadLimiter
 }
 
+type S3Opts struct {
+	// StagingDir is the directory in which record batches are kept until they
+	// have been uploaded to S3. Batches left in StagingDir, e.g. because the
+	// process crashed during upload, are uploaded by RecoverUploads. If
+	// StagingDir is empty, batches are staged in temporary files and cannot
+	// be recovered.
+	StagingDir string
+
+	// Endpoint is the URL of an S3 compatible service, e.g. a self-hosted
+	// MinIO or Ceph. The AWS S3 endpoint is used if empty.
+	Endpoint string
+
+	// UsePathStyle addresses buckets using path-style URLs
+	// (https://host/bucket/key) instead of virtual-hosted-style URLs
+	// (https://bucket.host/key). Most self-hosted services require this.
+	UsePathStyle bool
+
+	// InsecureSkipVerify disables verification of the endpoint's TLS
+	// certificate. It should only be used for testing.
+	InsecureSkipVerify bool
+
+	// NotFoundTTL is the amount of time that keys that were not found in S3
+	// are remembered, such that reading them again returns
+	// seberr.ErrNotInStorage without making a request to S3. Keys written
+	// using this S3Storage are forgotten immediately, but keys written by
+	// other processes may not be found for up to NotFoundTTL. Disabled if 0.
+	NotFoundTTL time.Duration
+
+	// Retry configures retries of failed requests to S3 and the circuit
+	// breaker that stops making requests while S3 is unavailable. Requests
+	// are made once, without a circuit breaker, if zero.
+	Retry S3RetryOpts
+
+	// MaxConcurrentUploads is the maximum number of uploads to S3 made at the
+	// same time. Uploads beyond it are queued, and handed slots round-robin
+	// across topics, such that a topic with many uploads can't starve others.
+	// Unlimited if 0.
+	MaxConcurrentUploads int
+}
+
+// WithS3StagingDir sets the directory that record batches are staged in
+// while they're being uploaded to S3.
+func WithS3StagingDir(dir string) func(*S3Opts) {
+	return func(o *S3Opts) {
+		o.StagingDir = dir
+	}
+}
+
+// WithS3Endpoint sets the URL of an S3 compatible service to use instead of
+// AWS S3. It's only used by NewS3StorageFromConfig.
+func WithS3Endpoint(endpoint string) func(*S3Opts) {
+	return func(o *S3Opts) {
+		o.Endpoint = endpoint
+	}
+}
+
+// WithS3PathStyle sets whether buckets are addressed using path-style URLs.
+// It's only used by NewS3StorageFromConfig.
+func WithS3PathStyle(usePathStyle bool) func(*S3Opts) {
+	return func(o *S3Opts) {
+		o.UsePathStyle = usePathStyle
+	}
+}
+
+// WithS3InsecureSkipVerify sets whether verification of the endpoint's TLS
+// certificate is skipped. It's only used by NewS3StorageFromConfig.
+func WithS3InsecureSkipVerify(skipVerify bool) func(*S3Opts) {
+	return func(o *S3Opts) {
+		o.InsecureSkipVerify = skipVerify
+	}
+}
+
+// WithS3NotFoundTTL sets the amount of time that keys that were not found in
+// S3 are remembered. See S3Opts.NotFoundTTL.
+func WithS3NotFoundTTL(ttl time.Duration) func(*S3Opts) {
+	return func(o *S3Opts) {
+		o.NotFoundTTL = ttl
+	}
+}
+
+// WithS3MaxConcurrentUploads sets the maximum number of concurrent uploads to
+// S3. See S3Opts.MaxConcurrentUploads.
+func WithS3MaxConcurrentUploads(max int) func(*S3Opts) {
+	return func(o *S3Opts) {
+		o.MaxConcurrentUploads = max
+	}
+}
+
+// stagingPendingExtension is used for staged files that are still being
+// written. Such files may be incomplete and must never be uploaded.
+const stagingPendingExtension = ".pending"
+
 type S3API interface {
 	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
 	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
 	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
 }
 
-func NewS3Storage(log logger.Logger, s3 S3API, bucketName string, s3KeyPrefix string) *S3Storage {
+// NewS3StorageFromConfig returns S3Storage using an S3 client created from cfg,
+// configured by S3Opts.Endpoint, S3Opts.UsePathStyle and
+// S3Opts.InsecureSkipVerify.
+func NewS3StorageFromConfig(log logger.Logger, cfg aws.Config, bucketName string, s3KeyPrefix string, optFuncs ...func(*S3Opts)) *S3Storage {
+	opts := S3Opts{}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+
+	s3Client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if opts.Endpoint != "" {
+			o.BaseEndpoint = aws.String(opts.Endpoint)
+		}
+		o.UsePathStyle = opts.UsePathStyle
+
+		if opts.InsecureSkipVerify {
+			o.HTTPClient = awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+				if tr.TLSClientConfig == nil {
+					tr.TLSClientConfig = &tls.Config{}
+				}
+				tr.TLSClientConfig.InsecureSkipVerify = true
+			})
+		}
+	})
+
+	return NewS3Storage(log, s3Client, bucketName, s3KeyPrefix, optFuncs...)
+}
+
+func NewS3Storage(log logger.Logger, s3 S3API, bucketName string, s3KeyPrefix string, optFuncs ...func(*S3Opts)) *S3Storage {
+	opts := S3Opts{}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+
+	var retry *retryingS3API
+	if opts.Retry.MaxAttempts > 1 || opts.Retry.BreakerFailures > 0 {
+		retry = newRetryingS3API(log.Name("s3 retry"), s3, opts.Retry, time.Now)
+		s3 = retry
+	}
+
 	return &S3Storage{
 		log:         log,
 		s3:          s3,
 		bucketName:  bucketName,
 		s3KeyPrefix: s3KeyPrefix,
+		stagingDir:  opts.StagingDir,
+		notFound:    newNotFoundCache(opts.NotFoundTTL, time.Now),
+		retry:       retry,
+		uploads:     newUploadLimiter(opts.MaxConcurrentUploads, time.Now),
 	}
 }
 
-func (ss *S3Storage) Writer(key string) (io.WriteCloser, error) {
+// UploadStats returns statistics of the uploads to S3 limited by
+// S3Opts.MaxConcurrentUploads. The zero value is returned if uploads aren't
+// limited.
+func (ss *S3Storage) UploadStats() UploadStats {
+	return ss.uploads.stats()
+}
+
+// RetryStats returns statistics of retried requests and the state of the
+// circuit breaker. The zero value is returned if retries are disabled.
+func (ss *S3Storage) RetryStats() S3RetryStats {
+	if ss.retry == nil {
+		return S3RetryStats{}
+	}
+	return ss.retry.Stats()
+}
+
+// Writer returns a writer that uploads to key when closed. The upload uses
+// ctx, so cancelling ctx before Close() aborts it.
+func (ss *S3Storage) Writer(ctx context.Context, key string) (io.WriteCloser, error) {
 	log := ss.log.WithField("recordBatchPath", key)
 
-	log.Debugf("creating temp file")
-	tmpFile, err := os.CreateTemp("", "seb_*")
-	if err != nil {
-		return nil, fmt.Errorf("creating temp file: %w", err)
+	objectKey := path.Join(ss.s3KeyPrefix, key)
+
+	var (
+		tmpFile    *os.File
+		stagedPath string
+		err        error
+	)
+	if ss.stagingDir == "" {
+		log.Debugf("creating temp file")
+		tmpFile, err = os.CreateTemp("", "seb_*")
+		if err != nil {
+			return nil, fmt.Errorf("creating temp file: %w", err)
+		}
+	} else {
+		stagedPath = filepath.Join(ss.stagingDir, filepath.FromSlash(objectKey))
+		log.Debugf("creating staging file")
+		err = os.MkdirAll(filepath.Dir(stagedPath), os.ModePerm)
+		if err != nil {
+			return nil, fmt.Errorf("creating staging dir: %w", err)
+		}
+
+		tmpFile, err = os.Create(stagedPath + stagingPendingExtension)
+		if err != nil {
+			return nil, fmt.Errorf("creating staging file: %w", err)
+		}
 	}
 	log = log.WithField("temp file", tmpFile.Name())
 
 	log.Debugf("creating s3WriteCloser")
 	writeCloser := &s3WriteCloser{
+		ctx:        ctx,
 		log:        ss.log.Name("s3UploadWriteCloser"),
 		f:          tmpFile,
+		stagedPath: stagedPath,
 		s3:         ss.s3,
 		bucketName: ss.bucketName,
-		objectKey:  path.Join(ss.s3KeyPrefix, key),
+		objectKey:  objectKey,
+		key:        key,
+		notFound:   ss.notFound,
+		uploads:    ss.uploads,
 	}
 
 	return writeCloser, nil
 }
 
-func (ss *S3Storage) Reader(key string) (io.ReadCloser, error) {
+func (ss *S3Storage) Reader(ctx context.Context, key string) (io.ReadCloser, error) {
 	log := ss.log.WithField("recordBatchPath", key)
 
+	objectKey := path.Join(ss.s3KeyPrefix, key)
+	if ss.notFound.contains(objectKey) {
+		return nil, fmt.Errorf("retrieving s3 object: recently not found: %w", seberr.ErrNotInStorage)
+	}
+
 	log.Debugf("fetching record batch from s3")
-	obj, err := ss.s3.GetObject(context.Background(), &s3.GetObjectInput{
+	obj, err := ss.s3.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(ss.bucketName),
-		Key:    aws.String(path.Join(ss.s3KeyPrefix, key)),
+		Key:    aws.String(objectKey),
 	})
 	if err != nil {
-		var apiErr smithy.APIError
-		if errors.As(err, &apiErr) {
-			if apiErr.ErrorCode() == "NoSuchKey" {
-				err = errors.Join(err, seberr.ErrNotInStorage)
-			}
-		}
-
-		return nil, fmt.Errorf("retrieving s3 object: %w", err)
+		return nil, fmt.Errorf("retrieving s3 object: %w", ss.getObjectError(objectKey, err))
 	}
 
 	// NOTE: intentionally not closing obj.Body, this is caller's responsibility
 	return obj.Body, nil
 }
 
-func (ss *S3Storage) ListFiles(topicName string, extension string) ([]File, error) {
+// ReadRange returns a reader of at most length bytes of key, starting at
+// offset, using an S3 ranged GET. See RangeReader.
+func (ss *S3Storage) ReadRange(ctx context.Context, key string, offset int64, length int64) (io.ReadCloser, int64, error) {
+	log := ss.log.WithField("recordBatchPath", key)
+
+	objectKey := path.Join(ss.s3KeyPrefix, key)
+	if ss.notFound.contains(objectKey) {
+		return nil, 0, fmt.Errorf("retrieving s3 object range: recently not found: %w", seberr.ErrNotInStorage)
+	}
+
+	log.Debugf("fetching bytes [%d;%d) of record batch from s3", offset, offset+length)
+	obj, err := ss.s3.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(ss.bucketName),
+		Key:    aws.String(objectKey),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("retrieving s3 object range: %w", ss.getObjectError(objectKey, err))
+	}
+
+	size, err := contentRangeSize(obj.ContentRange)
+	if err != nil {
+		obj.Body.Close()
+		return nil, 0, err
+	}
+
+	// NOTE: intentionally not closing obj.Body, this is caller's responsibility
+	return obj.Body, size, nil
+}
+
+// s3GetObjectError adds seberr.ErrNotInStorage to err if it's returned because
+// the object does not exist.
+func s3GetObjectError(err error) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.ErrorCode() == "NoSuchKey" {
+			err = errors.Join(err, seberr.ErrNotInStorage)
+		}
+	}
+	return err
+}
+
+// getObjectError returns s3GetObjectError(err), remembering objectKey as not
+// found if err is returned because it does not exist.
+func (ss *S3Storage) getObjectError(objectKey string, err error) error {
+	err = s3GetObjectError(err)
+	if errors.Is(err, seberr.ErrNotInStorage) {
+		ss.notFound.add(objectKey)
+	}
+	return err
+}
+
+// contentRangeSize returns the complete size of an object from the
+// Content-Range of a ranged GET, e.g. "bytes 0-99/1234".
+func contentRangeSize(contentRange *string) (int64, error) {
+	if contentRange == nil {
+		return 0, errors.New("content range missing from response")
+	}
+
+	_, sizeStr, ok := strings.Cut(*contentRange, "/")
+	if !ok {
+		return 0, fmt.Errorf("invalid content range '%s'", *contentRange)
+	}
+
+	size, err := strconv.ParseInt(sizeStr, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing size of content range '%s': %w", *contentRange, err)
+	}
+	return size, nil
+}
+
+// Delete deletes the object at key. NOTE: S3 does not report whether the
+// object existed, so deleting a key that does not exist is not an error.
+func (ss *S3Storage) Delete(key string) error {
+	log := ss.log.WithField("recordBatchPath", key)
+
+	log.Debugf("deleting record batch from s3")
+	_, err := ss.s3.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+		Bucket: aws.String(ss.bucketName),
+		Key:    aws.String(path.Join(ss.s3KeyPrefix, key)),
+	})
+	if err != nil {
+		return fmt.Errorf("deleting s3 object: %w", err)
+	}
+
+	return nil
+}
+
+func (ss *S3Storage) ListFiles(ctx context.Context, topicName string, extension string) ([]File, error) {
+	return listFilesByWalking(func(f func(File) error) error {
+		return ss.WalkFiles(ctx, topicName, extension, f)
+	})
+}
+
+// WalkFiles calls f with each file of topicName that has the given extension,
+// listing the objects of the topic a page at a time. See FileWalker.
+func (ss *S3Storage) WalkFiles(ctx context.Context, topicName string, extension string, f func(File) error) error {
+	return ss.walkFiles(ctx, topicName, extension, "", f)
+}
+
+// WalkFilesAfter is like WalkFiles, but only lists the objects of the topic
+// whose keys sort after afterKey, such that the newest files of topics can be
+// listed without listing all of their files. See FileWalkerAfter.
+func (ss *S3Storage) WalkFilesAfter(ctx context.Context, topicName string, extension string, afterKey string, f func(File) error) error {
+	return ss.walkFiles(ctx, topicName, extension, afterKey, f)
+}
+
+func (ss *S3Storage) walkFiles(ctx context.Context, topicName string, extension string, afterKey string, f func(File) error) error {
 	log := ss.log.
 		WithField("topicPath", topicName).
 		WithField("extension", extension)
@@ -96,20 +391,27 @@ func (ss *S3Storage) ListFiles(topicName string, extension string) ([]File, erro
 		topicName += "/"
 	}
 
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(ss.bucketName),
+		Prefix: &topicName,
+	}
+	if afterKey != "" {
+		afterKey = path.Join(ss.s3KeyPrefix, afterKey)
+		afterKey, _ = strings.CutPrefix(afterKey, "/")
+		input.StartAfter = &afterKey
+	}
+
 	log.Debugf("listing objects in s3")
 	t0 := time.Now()
 
-	files := make([]File, 0, 128)
-	paginator := s3.NewListObjectsV2Paginator(ss.s3, &s3.ListObjectsV2Input{
-		Bucket: aws.String(ss.bucketName),
-		Prefix: &topicName,
-	})
+	numFiles := 0
+	paginator := s3.NewListObjectsV2Paginator(ss.s3, input)
 	for paginator.HasMorePages() {
-		result, err := paginator.NextPage(context.TODO())
+		result, err := paginator.NextPage(ctx)
 		if err != nil {
 			err = fmt.Errorf("retrieving pages: %w", err)
 			log.Errorf(err.Error())
-			return nil, err
+			return err
 		}
 
 		for _, obj := range result.Contents {
@@ -120,26 +422,101 @@ func (ss *S3Storage) ListFiles(topicName string, extension string) ([]File, erro
 			filePath := *obj.Key
 
 			if strings.HasSuffix(filePath, extension) {
-				files = append(files, File{
+				numFiles += 1
+				err := f(File{
 					Path: filePath,
 					Size: *obj.Size,
 				})
+				if err != nil {
+					return err
+				}
 			}
 		}
 	}
 
-	log.Debugf("found %d files (%s)", len(files), time.Since(t0))
+	log.Debugf("found %d files (%s)", numFiles, time.Since(t0))
 
-	return files, nil
+	return nil
+}
+
+// RecoverUploads uploads record batches for topicName that were staged but
+// never uploaded to S3, e.g. because the process crashed during upload.
+// Batches that were not completely written to the staging dir are discarded.
+// Batches whose upload failed aren't staged, since their writes were reported
+// as failed.
+// RecoverUploads must be called before the topic accepts new writes, since the
+// recovered batches may otherwise be overwritten. It returns the number of
+// uploaded record batches.
+func (ss *S3Storage) RecoverUploads(topicName string) (int, error) {
+	if ss.stagingDir == "" {
+		return 0, nil
+	}
+
+	log := ss.log.WithField("topicName", topicName)
+	topicDir := filepath.Join(ss.stagingDir, filepath.FromSlash(path.Join(ss.s3KeyPrefix, topicName)))
+
+	uploaded := 0
+	err := filepath.WalkDir(topicDir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		if strings.HasSuffix(filePath, stagingPendingExtension) {
+			log.Infof("discarding incomplete staged file %s", filePath)
+			return os.Remove(filePath)
+		}
+
+		relPath, err := filepath.Rel(ss.stagingDir, filePath)
+		if err != nil {
+			return err
+		}
+		objectKey := filepath.ToSlash(relPath)
+
+		f, err := os.Open(filePath)
+		if err != nil {
+			return fmt.Errorf("opening staged file: %w", err)
+		}
+		defer f.Close()
+
+		log.Infof("recovering upload to s3://%s/%s", ss.bucketName, objectKey)
+		_, err = ss.s3.PutObject(context.Background(), &s3.PutObjectInput{
+			Bucket: &ss.bucketName,
+			Key:    &objectKey,
+			Body:   f,
+		})
+		if err != nil {
+			return fmt.Errorf("uploading %s to s3: %w", objectKey, err)
+		}
+		ss.notFound.remove(objectKey)
+		uploaded += 1
+
+		return os.Remove(filePath)
+	})
+	if err != nil {
+		return uploaded, fmt.Errorf("recovering uploads: %w", err)
+	}
+
+	return uploaded, nil
 }
 
 type s3WriteCloser struct {
+	ctx context.Context
 	log logger.Logger
 	s3  S3API
 
 	f          *os.File
+	stagedPath string
 	bucketName string
 	objectKey  string
+	key        string
+	notFound   *notFoundCache
+	uploads    *uploadLimiter
 }
 
 func (wc *s3WriteCloser) Write(b []byte) (int, error) {
@@ -147,22 +524,87 @@ func (wc *s3WriteCloser) Write(b []byte) (int, error) {
 }
 
 func (wc *s3WriteCloser) Close() error {
+	err := wc.upload()
+	if err != nil {
+		wc.f.Close()
+
+		// NOTE: the write is reported as failed, so its staged file must not
+		// be uploaded by RecoverUploads later.
+		removeErr := wc.removeStaged()
+		if removeErr != nil {
+			wc.log.Errorf("removing staged file of failed upload: %s", removeErr)
+		}
+		return err
+	}
+
+	err = wc.f.Close()
+	if err != nil {
+		return err
+	}
+
+	err = wc.removeStaged()
+	if err != nil {
+		return fmt.Errorf("removing staged file: %w", err)
+	}
+
+	return nil
+}
+
+func (wc *s3WriteCloser) upload() error {
+	if wc.stagedPath != "" {
+		err := wc.f.Sync()
+		if err != nil {
+			return fmt.Errorf("syncing staged file: %w", err)
+		}
+
+		// the staged file is now complete and can be recovered if the upload
+		// is interrupted.
+		err = os.Rename(wc.f.Name(), wc.stagedPath)
+		if err != nil {
+			return fmt.Errorf("marking staged file complete: %w", err)
+		}
+	}
+
 	_, err := wc.f.Seek(0, io.SeekStart)
 	if err != nil {
 		return fmt.Errorf("seeking to beginning: %w", err)
 	}
 
+	err = wc.uploads.acquire(wc.ctx, wc.key)
+	if err != nil {
+		return fmt.Errorf("waiting for upload slot: %w", err)
+	}
+
 	wc.log.Debugf("uploading to s3://%s/%s", wc.bucketName, wc.objectKey)
 	t0 := time.Now()
-	_, err = wc.s3.PutObject(context.Background(), &s3.PutObjectInput{
+	_, err = wc.s3.PutObject(wc.ctx, &s3.PutObjectInput{
 		Bucket: &wc.bucketName,
 		Key:    &wc.objectKey,
 		Body:   wc.f,
 	})
+	wc.uploads.release()
 	if err != nil {
 		return fmt.Errorf("uploading to s3: %w", err)
 	}
+	wc.notFound.remove(wc.objectKey)
 	wc.log.Debugf("uploaded to %s%s (%s)", wc.bucketName, wc.objectKey, time.Since(t0))
 
-	return wc.f.Close()
+	return nil
+}
+
+// removeStaged removes the staged file of the upload, whether or not it was
+// completely written.
+func (wc *s3WriteCloser) removeStaged() error {
+	if wc.stagedPath == "" {
+		return nil
+	}
+
+	for _, stagedPath := range []string{wc.stagedPath + stagingPendingExtension, wc.stagedPath} {
+		err := os.Remove(stagedPath)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
 }
@@ -3,11 +3,18 @@ package sebtopic_test
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"path"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -43,7 +50,7 @@ func TestS3WriteToS3(t *testing.T) {
 	s3Storage := sebtopic.NewS3Storage(log, s3Mock, bucketName, "")
 
 	// Act
-	rbWriter, err := s3Storage.Writer(recordBatchPath)
+	rbWriter, err := s3Storage.Writer(context.Background(), recordBatchPath)
 	require.NoError(t, err)
 
 	n, err := rbWriter.Write(randomBytes)
@@ -76,7 +83,7 @@ func TestS3WriteToS3WithError(t *testing.T) {
 	s3Storage := sebtopic.NewS3Storage(log, s3Mock, bucketName, "")
 
 	// Act
-	rbWriter, err := s3Storage.Writer(recordBatchPath)
+	rbWriter, err := s3Storage.Writer(context.Background(), recordBatchPath)
 	require.NoError(t, err)
 
 	n, err := rbWriter.Write(randomBytes)
@@ -89,6 +96,119 @@ func TestS3WriteToS3WithError(t *testing.T) {
 	require.True(t, s3Mock.PutObjectCalled)
 }
 
+// TestS3RecoverUploads verifies that a record batch that was staged but never
+// uploaded to S3, because the process crashed during upload, is uploaded by
+// RecoverUploads, and that staged files that were never completely written are
+// discarded.
+func TestS3RecoverUploads(t *testing.T) {
+	const (
+		s3KeyPrefix     = "some-prefix"
+		topicName       = "topicName"
+		recordBatchPath = "topicName/000123.record_batch"
+	)
+	expectedBytes := tester.RandomBytes(t, 512)
+	expectedKey := path.Join(s3KeyPrefix, recordBatchPath)
+	stagingDir := t.TempDir()
+	topicStagingDir := filepath.Join(stagingDir, s3KeyPrefix, topicName)
+
+	uploaded := map[string][]byte{}
+	s3Mock := &tester.S3Mock{}
+	s3Mock.MockPutObject = func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+		bs, err := io.ReadAll(params.Body)
+		require.NoError(t, err)
+		uploaded[*params.Key] = bs
+		return nil, nil
+	}
+	s3Storage := sebtopic.NewS3Storage(log, s3Mock, "mybucket", s3KeyPrefix, sebtopic.WithS3StagingDir(stagingDir))
+
+	// simulate a crash while uploading a record batch, and while writing
+	// another
+	err := os.MkdirAll(topicStagingDir, os.ModePerm)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(topicStagingDir, "000123.record_batch"), expectedBytes, 0o644)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(topicStagingDir, "000124.record_batch.pending"), []byte("incomplete"), 0o644)
+	require.NoError(t, err)
+
+	// Act
+	recovered, err := s3Storage.RecoverUploads(topicName)
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, 1, recovered)
+	require.Equal(t, map[string][]byte{expectedKey: expectedBytes}, uploaded)
+
+	entries, err := os.ReadDir(topicStagingDir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	// nothing left to recover
+	recovered, err = s3Storage.RecoverUploads(topicName)
+	require.NoError(t, err)
+	require.Equal(t, 0, recovered)
+}
+
+// TestS3RecoverUploadsFailedWrite verifies that the staged file of a record
+// batch whose upload to S3 failed is removed, such that RecoverUploads doesn't
+// upload a record batch whose write was reported as failed.
+func TestS3RecoverUploadsFailedWrite(t *testing.T) {
+	const (
+		topicName       = "topicName"
+		recordBatchPath = "topicName/000123.record_batch"
+	)
+	stagingDir := t.TempDir()
+
+	s3Mock := &tester.S3Mock{}
+	s3Mock.MockPutObject = func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+		return nil, fmt.Errorf("PutObject failed")
+	}
+	s3Storage := sebtopic.NewS3Storage(log, s3Mock, "mybucket", "", sebtopic.WithS3StagingDir(stagingDir))
+
+	wtr, err := s3Storage.Writer(context.Background(), recordBatchPath)
+	require.NoError(t, err)
+	_, err = wtr.Write(tester.RandomBytes(t, 512))
+	require.NoError(t, err)
+
+	// Act
+	err = wtr.Close()
+
+	// Assert
+	require.Error(t, err)
+
+	entries, err := os.ReadDir(filepath.Join(stagingDir, topicName))
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	s3Mock.PutObjectCalled = false
+	recovered, err := s3Storage.RecoverUploads(topicName)
+	require.NoError(t, err)
+	require.Equal(t, 0, recovered)
+	require.False(t, s3Mock.PutObjectCalled)
+}
+
+// TestS3WriteStagingDirCleanedUp verifies that staged files are removed once
+// they have been uploaded to S3.
+func TestS3WriteStagingDirCleanedUp(t *testing.T) {
+	stagingDir := t.TempDir()
+
+	s3Mock := &tester.S3Mock{}
+	s3Mock.MockPutObject = func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+		return nil, nil
+	}
+	s3Storage := sebtopic.NewS3Storage(log, s3Mock, "mybucket", "", sebtopic.WithS3StagingDir(stagingDir))
+
+	// Act
+	wtr, err := s3Storage.Writer(context.Background(), "topicName/000123.record_batch")
+	require.NoError(t, err)
+	tester.WriteAndClose(t, wtr, tester.RandomBytes(t, 128))
+
+	// Assert
+	require.True(t, s3Mock.PutObjectCalled)
+	entries, err := os.ReadDir(filepath.Join(stagingDir, "topicName"))
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
 // TestS3WriteWithPrefix verifies that the given prefix is used when calling
 // S3's PutObject.
 func TestS3WriteWithPrefix(t *testing.T) {
@@ -111,7 +231,7 @@ func TestS3WriteWithPrefix(t *testing.T) {
 	s3Storage := sebtopic.NewS3Storage(log, s3Mock, "mybucket", "some-prefix")
 
 	// Act
-	wtr, err := s3Storage.Writer(recordBatchPath)
+	wtr, err := s3Storage.Writer(context.Background(), recordBatchPath)
 	require.NoError(t, err)
 	tester.WriteAndClose(t, wtr, expectedBytes)
 	require.True(t, s3Mock.PutObjectCalled)
@@ -133,7 +253,7 @@ func TestS3ReadFromS3(t *testing.T) {
 	s3Storage := sebtopic.NewS3Storage(log, s3Mock, "mybucket", "")
 
 	// Act
-	rdr, err := s3Storage.Reader(recordBatchPath)
+	rdr, err := s3Storage.Reader(context.Background(), recordBatchPath)
 	require.NoError(t, err)
 	defer rdr.Close()
 
@@ -144,6 +264,85 @@ func TestS3ReadFromS3(t *testing.T) {
 	require.Equal(t, expectedBytes, gotBytes)
 }
 
+// TestS3ReadPassesContext verifies that Reader passes its context on to S3's
+// GetObject, such that cancelling it aborts the download.
+func TestS3ReadPassesContext(t *testing.T) {
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+
+	s3Mock := &tester.S3Mock{}
+	s3Mock.MockGetObject = func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+		require.Equal(t, "value", ctx.Value(ctxKey{}))
+		return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewBuffer(nil))}, nil
+	}
+
+	s3Storage := sebtopic.NewS3Storage(log, s3Mock, "mybucket", "")
+
+	// Act
+	rdr, err := s3Storage.Reader(ctx, "topicName/000123.record_batch")
+
+	// Assert
+	require.NoError(t, err)
+	require.NoError(t, rdr.Close())
+	require.True(t, s3Mock.GetObjectCalled)
+}
+
+// TestS3ReadRange verifies that ReadRange requests the given byte range from
+// S3, and returns the size of the object from the response's Content-Range.
+func TestS3ReadRange(t *testing.T) {
+	expectedBytes := tester.RandomBytes(t, 100)
+
+	s3Mock := &tester.S3Mock{}
+	s3Mock.MockGetObject = func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+		require.Equal(t, "bytes=10-109", *params.Range)
+		return &s3.GetObjectOutput{
+			Body:         io.NopCloser(bytes.NewBuffer(expectedBytes)),
+			ContentRange: aws.String("bytes 10-109/1234"),
+		}, nil
+	}
+
+	s3Storage := sebtopic.NewS3Storage(log, s3Mock, "mybucket", "")
+
+	// Act
+	rdr, size, err := s3Storage.ReadRange(context.Background(), "topicName/000123.record_batch", 10, 100)
+	require.NoError(t, err)
+	defer rdr.Close()
+
+	// Assert
+	require.Equal(t, int64(1234), size)
+
+	gotBytes, err := io.ReadAll(rdr)
+	require.NoError(t, err)
+	require.Equal(t, expectedBytes, gotBytes)
+}
+
+// TestS3WriteUploadsWithWriterContext verifies that the upload done when
+// closing the io.WriteCloser returned by Writer uses the context given to
+// Writer.
+func TestS3WriteUploadsWithWriterContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s3Mock := &tester.S3Mock{}
+	s3Mock.MockPutObject = func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+		return nil, ctx.Err()
+	}
+
+	s3Storage := sebtopic.NewS3Storage(log, s3Mock, "mybucket", "")
+
+	wtr, err := s3Storage.Writer(ctx, "topicName/000123.record_batch")
+	require.NoError(t, err)
+
+	_, err = wtr.Write([]byte("data"))
+	require.NoError(t, err)
+
+	// Act
+	cancel()
+	err = wtr.Close()
+
+	// Assert
+	require.ErrorIs(t, err, context.Canceled)
+}
+
 // TestS3ReadWithPrefix verifies that the given prefix is used when calling S3's
 // GetObject.
 func TestS3ReadWithPrefix(t *testing.T) {
@@ -167,7 +366,7 @@ func TestS3ReadWithPrefix(t *testing.T) {
 	s3Storage := sebtopic.NewS3Storage(log, s3Mock, "mybucket", "some-prefix")
 
 	// Act
-	rdr, err := s3Storage.Reader(recordBatchPath)
+	rdr, err := s3Storage.Reader(context.Background(), recordBatchPath)
 	require.NoError(t, err)
 
 	tester.ReadAndClose(t, rdr)
@@ -213,12 +412,53 @@ func TestListFiles(t *testing.T) {
 
 	s3Storage := sebtopic.NewS3Storage(log, s3Mock, "mybucket", "")
 
-	gotFiles, err := s3Storage.ListFiles("dummy/dir", ".ext")
+	gotFiles, err := s3Storage.ListFiles(context.Background(), "dummy/dir", ".ext")
 	require.NoError(t, err)
 
 	require.Equal(t, expectedFiles, gotFiles)
 }
 
+// TestWalkFilesStopsEarly verifies that WalkFiles calls its callback with
+// files a page at a time, and that it stops requesting pages from S3 once the
+// callback returns an error.
+func TestWalkFilesStopsEarly(t *testing.T) {
+	pages := [][]sebtopic.File{
+		{{Path: "topic/1.ext", Size: 1}, {Path: "topic/2.ext", Size: 2}},
+		{{Path: "topic/3.ext", Size: 3}},
+	}
+
+	requestedPages := 0
+	s3Mock := &tester.S3Mock{}
+	s3Mock.MockListObjectsV2 = func(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+		output := listObjectsOutputFromFiles(pages[requestedPages])
+		requestedPages += 1
+		if requestedPages < len(pages) {
+			output.IsTruncated = aws.Bool(true)
+			output.NextContinuationToken = aws.String("more data!")
+		}
+		return output, nil
+	}
+
+	s3Storage := sebtopic.NewS3Storage(log, s3Mock, "mybucket", "")
+
+	errStop := errors.New("stop")
+	gotFiles := []sebtopic.File{}
+
+	// Act
+	err := s3Storage.WalkFiles(context.Background(), "topic", ".ext", func(file sebtopic.File) error {
+		gotFiles = append(gotFiles, file)
+		if len(gotFiles) == 2 {
+			return errStop
+		}
+		return nil
+	})
+
+	// Assert
+	require.ErrorIs(t, err, errStop)
+	require.Equal(t, pages[0], gotFiles)
+	require.Equal(t, 1, requestedPages)
+}
+
 // TestListFilesOverlappingNames verifies that ListFiles formats Prefix in
 // requests to S3 ListObjectPages correctly, i.e. removes any prefix "/", and
 // ensures that it has "/" as a suffix.
@@ -243,7 +483,7 @@ func TestListFilesOverlappingNames(t *testing.T) {
 
 	for _, prefix := range testPrefixes {
 		t.Run(fmt.Sprintf("prefix '%s'", prefix), func(t *testing.T) {
-			_, err := s3Storage.ListFiles(prefix, ".ext")
+			_, err := s3Storage.ListFiles(context.Background(), prefix, ".ext")
 			require.NoError(t, err)
 		})
 	}
@@ -253,6 +493,35 @@ func TestListFilesOverlappingNames(t *testing.T) {
 	require.True(t, s3Mock.ListObjectPagesCalled)
 }
 
+// TestWalkFilesAfter verifies that WalkFilesAfter asks S3 to only list the
+// objects whose keys sort after the given key, taking the key prefix of the
+// storage into account.
+func TestWalkFilesAfter(t *testing.T) {
+	files := []sebtopic.File{{Path: "prefix/topic/000000000007.record_batch", Size: 7}}
+
+	s3Mock := &tester.S3Mock{}
+	s3Mock.MockListObjectsV2 = func(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+		// Assert
+		require.Equal(t, "prefix/topic/", *params.Prefix)
+		require.Equal(t, "prefix/topic/000000000005.record_batch", *params.StartAfter)
+		return listObjectsOutputFromFiles(files), nil
+	}
+
+	s3Storage := sebtopic.NewS3Storage(log, s3Mock, "mybucket", "prefix")
+
+	gotFiles := []sebtopic.File{}
+
+	// Act
+	err := s3Storage.WalkFilesAfter(context.Background(), "topic", ".record_batch", sebtopic.RecordBatchKey("topic", 5), func(file sebtopic.File) error {
+		gotFiles = append(gotFiles, file)
+		return nil
+	})
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, files, gotFiles)
+}
+
 func listObjectsOutputFromFiles(files []sebtopic.File) *s3.ListObjectsV2Output {
 	s3Objects := make([]types.Object, len(files))
 
@@ -279,8 +548,158 @@ func TestS3ReadFromS3NotFound(t *testing.T) {
 	s3Storage := sebtopic.NewS3Storage(log, s3Mock, "mybucket", "")
 
 	// Act
-	_, err := s3Storage.Reader(recordBatchPath)
+	_, err := s3Storage.Reader(context.Background(), recordBatchPath)
 
 	// Assert
 	require.ErrorIs(t, err, seberr.ErrNotInStorage)
 }
+
+// TestS3ReadNotFoundTTL verifies that keys that weren't found in S3 are
+// remembered for the configured amount of time, for both Reader and
+// ReadRange, and that they're forgotten when they're written.
+func TestS3ReadNotFoundTTL(t *testing.T) {
+	const recordBatchPath = "topicName/000123.record_batch"
+	const ttl = 100 * time.Millisecond
+
+	getObjectCalls := 0
+	s3Mock := &tester.S3Mock{}
+	s3Mock.MockGetObject = func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+		getObjectCalls += 1
+		return nil, &smithy.GenericAPIError{Code: "NoSuchKey"}
+	}
+	s3Mock.MockPutObject = func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+		return &s3.PutObjectOutput{}, nil
+	}
+
+	s3Storage := sebtopic.NewS3Storage(log, s3Mock, "mybucket", "", sebtopic.WithS3NotFoundTTL(ttl))
+
+	_, err := s3Storage.Reader(context.Background(), recordBatchPath)
+	require.ErrorIs(t, err, seberr.ErrNotInStorage)
+	require.Equal(t, 1, getObjectCalls)
+
+	// Act, Assert
+	_, err = s3Storage.Reader(context.Background(), recordBatchPath)
+	require.ErrorIs(t, err, seberr.ErrNotInStorage)
+	_, _, err = s3Storage.ReadRange(context.Background(), recordBatchPath, 0, 10)
+	require.ErrorIs(t, err, seberr.ErrNotInStorage)
+	require.Equal(t, 1, getObjectCalls)
+
+	// the key is forgotten once ttl has passed
+	time.Sleep(ttl)
+	_, err = s3Storage.Reader(context.Background(), recordBatchPath)
+	require.ErrorIs(t, err, seberr.ErrNotInStorage)
+	require.Equal(t, 2, getObjectCalls)
+
+	// the key is forgotten when it's written
+	wtr, err := s3Storage.Writer(context.Background(), recordBatchPath)
+	require.NoError(t, err)
+	tester.WriteAndClose(t, wtr, []byte("data"))
+
+	_, err = s3Storage.Reader(context.Background(), recordBatchPath)
+	require.ErrorIs(t, err, seberr.ErrNotInStorage)
+	require.Equal(t, 3, getObjectCalls)
+}
+
+// TestS3DeleteWithPrefix verifies that the given prefix is used when calling
+// S3's DeleteObject.
+func TestS3DeleteWithPrefix(t *testing.T) {
+	const (
+		bucketName      = "mybucket"
+		s3KeyPrefix     = "some-prefix"
+		recordBatchPath = "topicName/000123.record_batch"
+	)
+	expectedPath := path.Join(s3KeyPrefix, recordBatchPath)
+
+	s3Mock := &tester.S3Mock{}
+	s3Mock.MockDeleteObject = func(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+		// Verify the expected parameters are passed on to S3
+		require.Equal(t, bucketName, *params.Bucket)
+		require.Equal(t, expectedPath, *params.Key)
+		return &s3.DeleteObjectOutput{}, nil
+	}
+
+	s3Storage := sebtopic.NewS3Storage(log, s3Mock, bucketName, s3KeyPrefix)
+
+	// Act
+	err := s3Storage.Delete(recordBatchPath)
+
+	// Assert
+	require.NoError(t, err)
+	require.True(t, s3Mock.DeleteObjectCalled)
+}
+
+// TestS3StorageFromConfigEndpoint verifies that S3Storage created by
+// NewS3StorageFromConfig() uses the given endpoint with path-style addressing,
+// and that it can skip verification of the endpoint's TLS certificate.
+func TestS3StorageFromConfigEndpoint(t *testing.T) {
+	const (
+		bucketName = "mybucket"
+		key        = "topicName/000123.record_batch"
+	)
+
+	var (
+		mu      sync.Mutex
+		objects = map[string][]byte{}
+	)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch r.Method {
+		case http.MethodPut:
+			bs, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			objects[r.URL.Path] = bs
+		case http.MethodGet:
+			bs, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(bs)
+		}
+	}))
+	defer server.Close()
+
+	cfg := aws.Config{
+		Region:           "us-east-1",
+		RetryMaxAttempts: 1,
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "id", SecretAccessKey: "secret"}, nil
+		}),
+	}
+
+	s3Storage := sebtopic.NewS3StorageFromConfig(log, cfg, bucketName, "",
+		sebtopic.WithS3Endpoint(server.URL),
+		sebtopic.WithS3PathStyle(true),
+		sebtopic.WithS3InsecureSkipVerify(true),
+	)
+	expected := tester.RandomBytes(t, 128)
+
+	// Act
+	wtr, err := s3Storage.Writer(context.Background(), key)
+	require.NoError(t, err)
+	_, err = wtr.Write(expected)
+	require.NoError(t, err)
+	err = wtr.Close()
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, expected, objects[path.Join("/", bucketName, key)])
+
+	rdr, err := s3Storage.Reader(context.Background(), key)
+	require.NoError(t, err)
+	defer rdr.Close()
+
+	got, err := io.ReadAll(rdr)
+	require.NoError(t, err)
+	require.Equal(t, expected, got)
+
+	// TLS certificate is verified by default
+	s3Storage = sebtopic.NewS3StorageFromConfig(log, cfg, bucketName, "",
+		sebtopic.WithS3Endpoint(server.URL),
+		sebtopic.WithS3PathStyle(true),
+	)
+	_, err = s3Storage.Reader(context.Background(), key)
+	require.Error(t, err)
+}
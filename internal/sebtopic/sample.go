@@ -0,0 +1,235 @@
+package sebtopic
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+)
+
+type SampleInput struct {
+	// NumRecords is the number of records to sample. Defaults to 10.
+	NumRecords int
+
+	// StartOffset and EndOffset limit the sample to records in the offset
+	// range [StartOffset; EndOffset). EndOffset defaults to the topic's next
+	// offset if 0.
+	StartOffset uint64
+	EndOffset   uint64
+
+	// From and To limit the sample to records in record batches that were
+	// committed in the time range [From; To]. Ignored if zero.
+	From time.Time
+	To   time.Time
+}
+
+// SampleRecords reads a uniform random sample of input.NumRecords records
+// into batch, returning the offsets of the sampled records in ascending
+// order. If fewer records than requested are available, all of them are
+// returned.
+//
+// Only the record batches that hold sampled records are read, making it
+// possible to sample large topics without scanning them.
+//
+// Sampled records that have expired are skipped and counted in
+// batch.Skipped. Only records allowed by the ReadLimits of ctx are sampled.
+func (s *Topic) SampleRecords(ctx context.Context, batch *sebrecords.Batch, input SampleInput) ([]uint64, error) {
+	if input.NumRecords == 0 {
+		input.NumRecords = 10
+	}
+
+	err := s.loadRecordBatchOffsets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading record batch offsets: %w", err)
+	}
+
+	// NOTE: nextOffset must be read before recordBatchOffsets in order to
+	// guarantee that all offsets below nextOffset are in recordBatchOffsets.
+	nextOffset := s.nextOffset.Load()
+
+	s.mu.Lock()
+	recordBatchOffsets := make([]uint64, len(s.recordBatchOffsets))
+	copy(recordBatchOffsets, s.recordBatchOffsets)
+	s.mu.Unlock()
+
+	if len(recordBatchOffsets) == 0 {
+		return nil, nil
+	}
+
+	startOffset := max(input.StartOffset, recordBatchOffsets[0])
+	endOffset := nextOffset
+	if input.EndOffset != 0 {
+		endOffset = min(input.EndOffset, nextOffset)
+	}
+
+	if limits, ok := ReadLimitsFromContext(ctx); ok {
+		startOffset = max(startOffset, limits.StartOffset)
+		if limits.EndOffset != 0 {
+			endOffset = min(endOffset, limits.EndOffset)
+		}
+		if limits.NotBefore.After(input.From) {
+			input.From = limits.NotBefore
+		}
+	}
+
+	if !input.From.IsZero() || !input.To.IsZero() {
+		var err error
+		startOffset, endOffset, err = s.timeRangeOffsets(ctx, recordBatchOffsets, nextOffset, startOffset, endOffset, input.From, input.To)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if startOffset >= endOffset {
+		return nil, nil
+	}
+
+	offsets := sampleOffsets(startOffset, endOffset, input.NumRecords)
+
+	nowUs := time.Now().UnixMicro()
+	sampledOffsets := make([]uint64, 0, len(offsets))
+
+	var (
+		rb          *sebrecords.Parser
+		batchOffset uint64
+	)
+	defer func() {
+		if rb != nil {
+			rb.Close()
+		}
+	}()
+
+	for _, offset := range offsets {
+		select {
+		case <-ctx.Done():
+			return sampledOffsets, ctx.Err()
+		default:
+		}
+
+		// find the batch that offset is located in
+		batchIndex := sort.Search(len(recordBatchOffsets), func(i int) bool {
+			return recordBatchOffsets[i] > offset
+		}) - 1
+
+		if rb == nil || recordBatchOffsets[batchIndex] != batchOffset {
+			if rb != nil {
+				rb.Close()
+			}
+
+			var err error
+			batchOffset = recordBatchOffsets[batchIndex]
+			rb, err = s.parseRecordBatch(ctx, batchOffset)
+			if err != nil {
+				rb = nil
+				return sampledOffsets, fmt.Errorf("parsing record batch: %w", err)
+			}
+		}
+
+		recordIndex := uint32(offset - batchOffset)
+		if rb.Expired(recordIndex, nowUs) {
+			batch.Skipped += 1
+			continue
+		}
+
+		err := s.readRecord(ctx, batch, rb, recordIndex)
+		if err != nil {
+			return sampledOffsets, fmt.Errorf("record batch '%s': %w", s.recordBatchPath(batchOffset), err)
+		}
+		sampledOffsets = append(sampledOffsets, offset)
+	}
+
+	return sampledOffsets, nil
+}
+
+// readRecord reads the record at recordIndex in rb into batch, resolving it
+// if it's a pointer to a large record.
+func (s *Topic) readRecord(ctx context.Context, batch *sebrecords.Batch, rb *sebrecords.Parser, recordIndex uint32) error {
+	if rb.IsPointer(recordIndex) {
+		size, key, err := readPointer(rb, recordIndex)
+		if err != nil {
+			return err
+		}
+		return s.readLargeRecord(ctx, batch, key, size)
+	}
+
+	return rb.Records(batch, recordIndex, recordIndex+1)
+}
+
+// timeRangeOffsets narrows [startOffset; endOffset) to the records in record
+// batches that were committed in the time range [from; to].
+func (s *Topic) timeRangeOffsets(ctx context.Context, recordBatchOffsets []uint64, nextOffset uint64, startOffset uint64, endOffset uint64, from time.Time, to time.Time) (uint64, uint64, error) {
+	fromUs, toUs := from.UnixMicro(), to.UnixMicro()
+
+	newStart, newEnd := endOffset, endOffset
+	for i, batchOffset := range recordBatchOffsets {
+		batchEnd := nextOffset
+		if i+1 < len(recordBatchOffsets) {
+			batchEnd = recordBatchOffsets[i+1]
+		}
+
+		// batch is outside of offset range
+		if batchEnd <= startOffset {
+			continue
+		}
+		if batchOffset >= endOffset {
+			break
+		}
+
+		rb, err := s.parseRecordBatch(ctx, batchOffset)
+		if err != nil {
+			return 0, 0, fmt.Errorf("parsing record batch: %w", err)
+		}
+		committedUs := rb.Header.UnixEpochUs
+		rb.Close()
+
+		if !from.IsZero() && committedUs < fromUs {
+			continue
+		}
+		if !to.IsZero() && committedUs > toUs {
+			newEnd = max(batchOffset, startOffset)
+			break
+		}
+
+		if newStart == endOffset {
+			newStart = max(batchOffset, startOffset)
+		}
+	}
+
+	return newStart, min(newEnd, endOffset), nil
+}
+
+// sampleOffsets returns n distinct offsets chosen uniformly at random from
+// [start; end), in ascending order. If there are fewer than n offsets in the
+// range, all of them are returned.
+func sampleOffsets(start uint64, end uint64, n int) []uint64 {
+	total := end - start
+	if uint64(n) >= total {
+		offsets := make([]uint64, 0, total)
+		for offset := start; offset < end; offset++ {
+			offsets = append(offsets, offset)
+		}
+		return offsets
+	}
+
+	// Robert Floyd's algorithm for sampling without replacement
+	chosen := make(map[uint64]struct{}, n)
+	for j := total - uint64(n); j < total; j++ {
+		v := rand.Uint64N(j + 1)
+		if _, ok := chosen[v]; ok {
+			v = j
+		}
+		chosen[v] = struct{}{}
+	}
+
+	offsets := make([]uint64, 0, n)
+	for v := range chosen {
+		offsets = append(offsets, start+v)
+	}
+	slices.Sort(offsets)
+
+	return offsets
+}
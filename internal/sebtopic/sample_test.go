@@ -0,0 +1,157 @@
+package sebtopic_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTopicSampleRecords verifies that SampleRecords() returns the requested
+// number of distinct records within the given offset range, along with their
+// offsets.
+func TestTopicSampleRecords(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		topic, err := sebtopic.New(log, storage, "topic", cache, sebtopic.WithLargeRecordThreshold(largeRecordThreshold))
+		require.NoError(t, err)
+
+		records := [][]byte{}
+		for range 10 {
+			batch := tester.MakeRandomRecordBatch(10)
+			records = append(records, batch.IndividualRecords()...)
+			_, err = topic.AddRecords(batch)
+			require.NoError(t, err)
+		}
+
+		// a large record
+		largeRecord := tester.RandomBytes(t, 2*largeRecordThreshold)
+		records = append(records, largeRecord)
+		_, err = topic.AddRecords(tester.RecordsToBatch([][]byte{largeRecord}))
+		require.NoError(t, err)
+
+		tests := map[string]struct {
+			input           sebtopic.SampleInput
+			expectedRecords int
+			minOffset       uint64
+			maxOffset       uint64
+		}{
+			"whole topic": {
+				input:           sebtopic.SampleInput{NumRecords: 20},
+				expectedRecords: 20,
+				minOffset:       0,
+				maxOffset:       100,
+			},
+			"offset range": {
+				input:           sebtopic.SampleInput{NumRecords: 5, StartOffset: 15, EndOffset: 45},
+				expectedRecords: 5,
+				minOffset:       15,
+				maxOffset:       44,
+			},
+			"fewer records than requested": {
+				input:           sebtopic.SampleInput{NumRecords: 50, StartOffset: 95},
+				expectedRecords: 6,
+				minOffset:       95,
+				maxOffset:       100,
+			},
+			"end offset beyond topic": {
+				input:           sebtopic.SampleInput{NumRecords: 50, StartOffset: 98, EndOffset: 1000},
+				expectedRecords: 3,
+				minOffset:       98,
+				maxOffset:       100,
+			},
+			"empty range": {
+				input:           sebtopic.SampleInput{NumRecords: 5, StartOffset: 10, EndOffset: 10},
+				expectedRecords: 0,
+			},
+		}
+
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				batch := tester.NewBatch(test.input.NumRecords, 100*largeRecordThreshold)
+
+				// Act
+				offsets, err := topic.SampleRecords(context.Background(), &batch, test.input)
+				require.NoError(t, err)
+
+				// Assert
+				require.Equal(t, test.expectedRecords, len(offsets))
+				require.Equal(t, test.expectedRecords, batch.Len())
+				require.True(t, slices.IsSorted(offsets))
+				require.Equal(t, len(offsets), len(slices.Compact(slices.Clone(offsets))))
+
+				gotRecords := batch.IndividualRecords()
+				for i, offset := range offsets {
+					require.GreaterOrEqual(t, offset, test.minOffset)
+					require.LessOrEqual(t, offset, test.maxOffset)
+					require.Equal(t, records[offset], gotRecords[i])
+				}
+			})
+		}
+	})
+}
+
+// TestTopicSampleRecordsTimeRange verifies that SampleRecords() only samples
+// records from record batches committed within the given time range.
+func TestTopicSampleRecordsTimeRange(t *testing.T) {
+	defer func(f func() int64) { sebrecords.UnixEpochUs = f }(sebrecords.UnixEpochUs)
+
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		topic, err := sebtopic.New(log, storage, "topic", cache)
+		require.NoError(t, err)
+
+		t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		for i := range 5 {
+			sebrecords.UnixEpochUs = func() int64 {
+				return t0.Add(time.Duration(i) * time.Hour).UnixMicro()
+			}
+			_, err = topic.AddRecords(tester.MakeRandomRecordBatch(10))
+			require.NoError(t, err)
+		}
+
+		batch := tester.NewBatch(100, 4096)
+
+		// Act
+		offsets, err := topic.SampleRecords(context.Background(), &batch, sebtopic.SampleInput{
+			NumRecords: 100,
+			From:       t0.Add(time.Hour),
+			To:         t0.Add(2 * time.Hour),
+		})
+		require.NoError(t, err)
+
+		// Assert
+		require.Equal(t, 20, len(offsets))
+		require.Equal(t, uint64(10), offsets[0])
+		require.Equal(t, uint64(29), offsets[len(offsets)-1])
+	})
+}
+
+// TestTopicSampleRecordsSkipsExpired verifies that expired records are not
+// returned by SampleRecords(), but are counted in batch.Skipped.
+func TestTopicSampleRecordsSkipsExpired(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		topic, err := sebtopic.New(log, storage, "topic", cache)
+		require.NoError(t, err)
+
+		expired := time.Now().Add(-time.Hour).UnixMicro()
+		batch := tester.MakeRandomRecordBatch(4)
+		batch.Expires = []int64{expired, 0, expired, 0}
+		_, err = topic.AddRecords(batch)
+		require.NoError(t, err)
+
+		gotBatch := tester.NewBatch(10, 4096)
+
+		// Act
+		offsets, err := topic.SampleRecords(context.Background(), &gotBatch, sebtopic.SampleInput{NumRecords: 10})
+		require.NoError(t, err)
+
+		// Assert
+		require.Equal(t, []uint64{1, 3}, offsets)
+		require.Equal(t, 2, gotBatch.Skipped)
+	})
+}
@@ -0,0 +1,434 @@
+package sebtopic
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/micvbang/go-helpy/bytey"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+const (
+	ScrubCorrupt            = "corrupt"
+	ScrubMissing            = "missing"
+	ScrubMissingLargeRecord = "missing large record"
+)
+
+// quarantinePrefix is the key prefix that files are moved to when they're
+// quarantined. It's outside of all topics, so quarantined files are not read.
+const quarantinePrefix = "_quarantine"
+
+// QuarantineKey returns the key that the file at key is moved to when it's
+// quarantined by Scrub.
+func QuarantineKey(key string) string {
+	return path.Join(quarantinePrefix, key)
+}
+
+// ScrubFinding describes a file that Scrub found to be corrupt or missing.
+type ScrubFinding struct {
+	Key    string
+	Reason string
+	Err    string
+
+	// Repaired is true if the file was replaced by a valid copy from
+	// ScrubOpts.Replica.
+	Repaired bool
+
+	// Quarantined is true if the corrupt file was moved to QuarantineKey(Key).
+	Quarantined bool
+}
+
+type ScrubOpts struct {
+	Compression Compress
+
+	// Replica holds copies of the topic's files, e.g. a follower of the
+	// topic's storage. Corrupt or missing files are repaired from it if it
+	// has a valid copy. Files are not repaired if nil.
+	Replica Storage
+
+	// Quarantine moves corrupt record batches that can't be repaired to
+	// QuarantineKey(key).
+	Quarantine bool
+
+	// Topic is the instance of the topic that is serving reads, if any.
+	// Record batches that are repaired or quarantined are removed from its
+	// cache, such that it doesn't keep serving the copies it has cached.
+	Topic *Topic
+}
+
+// ScrubCompress sets the compression used by the topic. It must match the
+// compression that the topic's record batches were written with.
+func ScrubCompress(c Compress) func(*ScrubOpts) {
+	return func(o *ScrubOpts) {
+		o.Compression = c
+	}
+}
+
+// ScrubReplica sets the storage that corrupt or missing files are repaired
+// from.
+func ScrubReplica(replica Storage) func(*ScrubOpts) {
+	return func(o *ScrubOpts) {
+		o.Replica = replica
+	}
+}
+
+// ScrubQuarantine sets whether corrupt record batches that can't be repaired
+// are quarantined.
+func ScrubQuarantine(quarantine bool) func(*ScrubOpts) {
+	return func(o *ScrubOpts) {
+		o.Quarantine = quarantine
+	}
+}
+
+// ScrubTopic sets the instance of the topic that is serving reads. See
+// ScrubOpts.Topic.
+func ScrubTopic(topic *Topic) func(*ScrubOpts) {
+	return func(o *ScrubOpts) {
+		o.Topic = topic
+	}
+}
+
+// ScrubResult describes the record batches checked by Scrub.
+type ScrubResult struct {
+	RecordBatches int
+	Findings      []ScrubFinding
+}
+
+// Scrub reads every record batch of topicName in storage and verifies that it
+// can be decrypted, decompressed and parsed, that its record index matches
+// its data, and that the large records it points to exist. Gaps between the
+// offsets of record batches are reported as missing record batches.
+//
+// Failing to read from storage is returned as an error, rather than reported
+// as corruption, such that transient errors never cause files to be
+// quarantined. Record batches that are deleted while Scrub is running, e.g.
+// because they were merged, are skipped.
+func Scrub(ctx context.Context, log logger.Logger, storage Storage, topicName string, optFns ...func(*ScrubOpts)) (ScrubResult, error) {
+	opts := ScrubOpts{
+		Compression: Gzip{},
+	}
+	for _, optFn := range optFns {
+		optFn(&opts)
+	}
+	log = log.WithField(logger.FieldTopicName, topicName)
+
+	recordBatchOffsets, epochs, err := listRecordBatchOffsets(ctx, storage, topicName)
+	if err != nil {
+		return ScrubResult{}, err
+	}
+
+	largeRecordKeys := make(map[string]struct{})
+	err = walkFiles(ctx, storage, topicName, largeRecordExtension, func(file File) error {
+		largeRecordKeys[path.Join(topicName, path.Base(file.Path))] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return ScrubResult{}, fmt.Errorf("listing large records: %w", err)
+	}
+
+	s := scrubber{
+		log:             log,
+		opts:            opts,
+		storage:         migrator{storage: storage, compression: opts.Compression},
+		largeRecordKeys: largeRecordKeys,
+	}
+	if opts.Replica != nil {
+		s.replica = &migrator{storage: opts.Replica, compression: opts.Compression}
+	}
+
+	result := ScrubResult{}
+	nextOffset := uint64(0)
+	for i, recordBatchOffset := range recordBatchOffsets {
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		default:
+		}
+
+		if i > 0 && recordBatchOffset > nextOffset {
+			result.Findings = append(result.Findings, s.repairMissing(ctx, epochs.key(topicName, nextOffset)))
+		}
+
+		numRecords, findings, err := s.scrubRecordBatch(ctx, epochs.key(topicName, recordBatchOffset))
+		if err != nil {
+			return result, fmt.Errorf("record batch %d: %w", recordBatchOffset, err)
+		}
+
+		result.RecordBatches += 1
+		result.Findings = append(result.Findings, findings...)
+		if numRecords < 0 {
+			// the number of records is unknown; assume that the record
+			// batch reaches the next one.
+			if i+1 < len(recordBatchOffsets) {
+				nextOffset = max(nextOffset, recordBatchOffsets[i+1])
+			}
+			continue
+		}
+		nextOffset = max(nextOffset, recordBatchOffset+uint64(numRecords))
+	}
+
+	for _, finding := range result.Findings {
+		log.Errorf("record batch scrub: %s is %s (%s), repaired: %t, quarantined: %t", finding.Key, finding.Reason, finding.Err, finding.Repaired, finding.Quarantined)
+	}
+	log.Debugf("scrubbed %d record batches", result.RecordBatches)
+
+	return result, nil
+}
+
+type scrubber struct {
+	log             logger.Logger
+	opts            ScrubOpts
+	storage         migrator
+	replica         *migrator
+	largeRecordKeys map[string]struct{}
+}
+
+// scrubRecordBatch verifies the record batch at key, returning its number of
+// records and the files that were found to be corrupt or missing. The number
+// of records is -1 if it's unknown, because the record batch is corrupt and
+// wasn't repaired, or because it was deleted.
+func (s scrubber) scrubRecordBatch(ctx context.Context, key string) (int, []ScrubFinding, error) {
+	rb, err := s.storage.readRecordBatch(ctx, key)
+	if errors.Is(err, seberr.ErrNotInStorage) {
+		return -1, nil, nil
+	}
+	if err != nil && !errors.Is(err, errCorruptRecordBatch) {
+		return 0, nil, err
+	}
+	if err != nil {
+		finding, rb := s.repairCorrupt(ctx, key, err)
+		if rb == nil {
+			return -1, []ScrubFinding{finding}, nil
+		}
+		defer rb.Close()
+
+		return int(rb.Header.NumRecords), append([]ScrubFinding{finding}, s.scrubLargeRecords(ctx, rb)...), nil
+	}
+	defer rb.Close()
+
+	return int(rb.Header.NumRecords), s.scrubLargeRecords(ctx, rb), nil
+}
+
+// scrubLargeRecords returns a finding for each large record pointed to by rb
+// that is missing, repairing it from the replica if possible.
+func (s scrubber) scrubLargeRecords(ctx context.Context, rb *sebrecords.Parser) []ScrubFinding {
+	if rb.Pointers == nil {
+		return nil
+	}
+
+	findings := []ScrubFinding{}
+	for recordIndex := range rb.Header.NumRecords {
+		if !rb.IsPointer(recordIndex) {
+			continue
+		}
+
+		_, key, err := readPointer(rb, recordIndex)
+		if err != nil {
+			continue
+		}
+		if _, ok := s.largeRecordKeys[key]; ok {
+			continue
+		}
+
+		finding := ScrubFinding{Key: key, Reason: ScrubMissingLargeRecord}
+		if s.replica != nil {
+			bs, err := s.replica.readRaw(ctx, key)
+			if err == nil {
+				err = s.storage.writeRaw(ctx, key, bs)
+			}
+			if err != nil {
+				finding.Err = err.Error()
+			}
+			finding.Repaired = err == nil
+		}
+		findings = append(findings, finding)
+	}
+
+	return findings
+}
+
+// repairMissing returns a finding for the missing record batch at key,
+// repairing it from the replica if possible.
+func (s scrubber) repairMissing(ctx context.Context, key string) ScrubFinding {
+	finding := ScrubFinding{Key: key, Reason: ScrubMissing}
+
+	err := s.repair(ctx, key)
+	if err != nil {
+		finding.Err = err.Error()
+	}
+	finding.Repaired = err == nil && s.replica != nil
+
+	return finding
+}
+
+// repairCorrupt returns a finding for the corrupt record batch at key,
+// repairing it from the replica if possible and quarantining it otherwise. If
+// it was repaired, a parser of the repaired record batch is returned.
+func (s scrubber) repairCorrupt(ctx context.Context, key string, corruptErr error) (ScrubFinding, *sebrecords.Parser) {
+	finding := ScrubFinding{Key: key, Reason: ScrubCorrupt, Err: corruptErr.Error()}
+
+	if s.replica != nil {
+		err := s.repair(ctx, key)
+		if err == nil {
+			rb, err := s.storage.readRecordBatch(ctx, key)
+			if err == nil {
+				finding.Repaired = true
+				return finding, rb
+			}
+		}
+		s.log.Errorf("repairing '%s': %s", key, err)
+	}
+
+	if s.opts.Quarantine {
+		err := s.quarantine(ctx, key)
+		if err != nil {
+			s.log.Errorf("quarantining '%s': %s", key, err)
+		}
+		finding.Quarantined = err == nil
+	}
+
+	return finding, nil
+}
+
+// repair replaces the record batch at key with the replica's copy, if the
+// replica's copy is valid.
+func (s scrubber) repair(ctx context.Context, key string) error {
+	if s.replica == nil {
+		return nil
+	}
+
+	bs, err := s.replica.read(ctx, key)
+	if err != nil {
+		return fmt.Errorf("reading replica: %w", err)
+	}
+
+	rb, err := parseRecordBatchBytes(bs)
+	if err != nil {
+		return fmt.Errorf("replica: %w", err)
+	}
+	rb.Close()
+
+	err = s.storage.write(ctx, key, bs)
+	if err != nil {
+		return err
+	}
+	s.evict(key)
+
+	return nil
+}
+
+// quarantine moves the file at key to QuarantineKey(key).
+func (s scrubber) quarantine(ctx context.Context, key string) error {
+	bs, err := s.storage.readRaw(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	err = s.storage.writeRaw(ctx, QuarantineKey(key), bs)
+	if err != nil {
+		return err
+	}
+
+	err = s.storage.storage.Delete(key)
+	if err != nil {
+		return err
+	}
+	s.evict(key)
+
+	return nil
+}
+
+// evict removes the record batch at key from the cache of the topic serving
+// reads, if any.
+func (s scrubber) evict(key string) {
+	if s.opts.Topic == nil || s.opts.Topic.cache == nil {
+		return
+	}
+
+	err := s.opts.Topic.cache.Remove(key)
+	if err != nil {
+		s.log.Errorf("removing '%s' from cache: %s", key, err)
+	}
+}
+
+// quarantinedErr returns an error wrapping both seberr.ErrQuarantined and err
+// if err is seberr.ErrNotInStorage and the record batch at key has been
+// quarantined. Otherwise, err is returned.
+func quarantinedErr(ctx context.Context, storage Storage, key string, err error) error {
+	if !errors.Is(err, seberr.ErrNotInStorage) {
+		return err
+	}
+
+	rdr, quarantineErr := storage.Reader(ctx, QuarantineKey(key))
+	if quarantineErr != nil {
+		return err
+	}
+	rdr.Close()
+
+	return fmt.Errorf("%w: record batch '%s' was moved to '%s': %w", seberr.ErrQuarantined, key, QuarantineKey(key), err)
+}
+
+var errCorruptRecordBatch = errors.New("corrupt record batch")
+
+// readRecordBatch reads and parses the record batch at key. Files that can't
+// be decrypted, decompressed or parsed are reported as errCorruptRecordBatch.
+func (m migrator) readRecordBatch(ctx context.Context, key string) (*sebrecords.Parser, error) {
+	rdr, err := m.storage.Reader(ctx, key)
+	if err != nil {
+		if errors.Is(err, errCorruptEncryptedFile) {
+			return nil, fmt.Errorf("%w: %w", errCorruptRecordBatch, err)
+		}
+		return nil, fmt.Errorf("opening '%s': %w", key, err)
+	}
+	defer rdr.Close()
+
+	// NOTE: encrypted files are decrypted while they're read, so corrupt
+	// chunks are reported by ReadAll.
+	bs, err := io.ReadAll(rdr)
+	if err != nil {
+		if errors.Is(err, errCorruptEncryptedFile) {
+			return nil, fmt.Errorf("%w: %w", errCorruptRecordBatch, err)
+		}
+		return nil, fmt.Errorf("reading '%s': %w", key, err)
+	}
+
+	if m.compression != nil {
+		cr, err := m.compression.NewReader(bytes.NewReader(bs))
+		if err != nil {
+			return nil, fmt.Errorf("%w: decompressing: %w", errCorruptRecordBatch, err)
+		}
+		bs, err = io.ReadAll(cr)
+		cr.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%w: decompressing: %w", errCorruptRecordBatch, err)
+		}
+	}
+
+	return parseRecordBatchBytes(bs)
+}
+
+// parseRecordBatchBytes parses the uncompressed record batch bs, verifying
+// that its record index matches the size of its data.
+func parseRecordBatchBytes(bs []byte) (*sebrecords.Parser, error) {
+	rb, err := sebrecords.Parse(bytey.NewBuffer(bs))
+	if err != nil {
+		return nil, fmt.Errorf("%w: parsing: %w", errCorruptRecordBatch, err)
+	}
+
+	dataSize := uint64(0)
+	for _, size := range rb.RecordSizes {
+		dataSize += uint64(size)
+	}
+	if uint64(rb.DataOffset())+dataSize != uint64(len(bs)) {
+		rb.Close()
+		return nil, fmt.Errorf("%w: record index covers %d bytes of data, file has %d", errCorruptRecordBatch, dataSize, len(bs)-int(rb.DataOffset()))
+	}
+
+	return rb, nil
+}
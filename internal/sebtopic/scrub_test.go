@@ -0,0 +1,229 @@
+package sebtopic_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestScrubHealthy verifies that Scrub() checks all record batches and
+// reports nothing when they're intact.
+func TestScrubHealthy(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		const topicName = "topic"
+		addScrubRecords(t, storage, topicName, cache)
+
+		// Act
+		result, err := sebtopic.Scrub(context.Background(), log, storage, topicName)
+
+		// Assert
+		require.NoError(t, err)
+		require.Equal(t, 3, result.RecordBatches)
+		require.Empty(t, result.Findings)
+	})
+}
+
+// TestScrubQuarantine verifies that Scrub() reports corrupt record batches,
+// and that they're moved to QuarantineKey() when quarantining is enabled.
+func TestScrubQuarantine(t *testing.T) {
+	const topicName = "topic"
+	storage := sebtopic.NewMemoryStorage(log)
+	addScrubRecords(t, storage, topicName, newCache(t))
+
+	corruptKey := sebtopic.RecordBatchKey(topicName, 2)
+	writeFile(t, storage, corruptKey, []byte("not a record batch"))
+
+	// Act
+	result, err := sebtopic.Scrub(context.Background(), log, storage, topicName)
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, 1, len(result.Findings))
+	require.Equal(t, corruptKey, result.Findings[0].Key)
+	require.Equal(t, sebtopic.ScrubCorrupt, result.Findings[0].Reason)
+	require.False(t, result.Findings[0].Quarantined)
+
+	// Act
+	result, err = sebtopic.Scrub(context.Background(), log, storage, topicName, sebtopic.ScrubQuarantine(true))
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, 1, len(result.Findings))
+	require.True(t, result.Findings[0].Quarantined)
+
+	_, err = storage.Reader(context.Background(), corruptKey)
+	require.ErrorIs(t, err, seberr.ErrNotInStorage)
+
+	rdr, err := storage.Reader(context.Background(), sebtopic.QuarantineKey(corruptKey))
+	require.NoError(t, err)
+	rdr.Close()
+}
+
+// TestScrubRepair verifies that Scrub() repairs corrupt and missing record
+// batches and missing large records from a replica, such that the topic can
+// be read again.
+func TestScrubRepair(t *testing.T) {
+	const topicName = "topic"
+	ctx := context.Background()
+	storage := sebtopic.NewMemoryStorage(log)
+	records := addScrubRecords(t, storage, topicName, newCache(t))
+
+	topic, err := sebtopic.New(log, storage, topicName, newCache(t))
+	require.NoError(t, err)
+	snapshot, err := topic.Snapshot(ctx)
+	require.NoError(t, err)
+
+	replica := sebtopic.NewMemoryStorage(log)
+	_, err = sebtopic.RestoreTopicSnapshot(ctx, storage, replica, snapshot)
+	require.NoError(t, err)
+
+	writeFile(t, storage, sebtopic.RecordBatchKey(topicName, 0), []byte("corrupt"))
+	require.NoError(t, storage.Delete(sebtopic.RecordBatchKey(topicName, 2)))
+	require.NoError(t, storage.Delete(sebtopic.LargeRecordKey(topicName, 3)))
+
+	// Act
+	result, err := sebtopic.Scrub(ctx, log, storage, topicName, sebtopic.ScrubReplica(replica))
+
+	// Assert
+	require.NoError(t, err)
+	reasons := map[string]string{}
+	for _, finding := range result.Findings {
+		require.True(t, finding.Repaired, finding.Key)
+		reasons[finding.Key] = finding.Reason
+	}
+	require.Equal(t, map[string]string{
+		sebtopic.RecordBatchKey(topicName, 0): sebtopic.ScrubCorrupt,
+		sebtopic.RecordBatchKey(topicName, 2): sebtopic.ScrubMissing,
+		sebtopic.LargeRecordKey(topicName, 3): sebtopic.ScrubMissingLargeRecord,
+	}, reasons)
+
+	result, err = sebtopic.Scrub(ctx, log, storage, topicName)
+	require.NoError(t, err)
+	require.Empty(t, result.Findings)
+
+	restored, err := sebtopic.New(log, storage, topicName, newCache(t), sebtopic.WithLargeRecordThreshold(largeRecordThreshold))
+	require.NoError(t, err)
+	gotBatch := tester.NewBatch(len(records), 10*largeRecordThreshold)
+	err = restored.ReadRecords(ctx, &gotBatch, 0, len(records), 0)
+	require.NoError(t, err)
+	require.Equal(t, records, gotBatch.IndividualRecords())
+}
+
+// TestScrubRepairEvictsTopicCache verifies that a topic given to Scrub() stops
+// serving its cached copy of a corrupt record batch once Scrub() has repaired
+// it.
+func TestScrubRepairEvictsTopicCache(t *testing.T) {
+	const topicName = "topic"
+	ctx := context.Background()
+	storage := sebtopic.NewMemoryStorage(log)
+	records := addScrubRecords(t, storage, topicName, newCache(t))
+
+	topic, err := sebtopic.New(log, storage, topicName, newCache(t))
+	require.NoError(t, err)
+	snapshot, err := topic.Snapshot(ctx)
+	require.NoError(t, err)
+
+	replica := sebtopic.NewMemoryStorage(log)
+	_, err = sebtopic.RestoreTopicSnapshot(ctx, storage, replica, snapshot)
+	require.NoError(t, err)
+
+	writeCorruptRecordBatch(t, storage, sebtopic.RecordBatchKey(topicName, 0))
+
+	// corrupt record batch is read into the topic's cache
+	gotBatch := tester.NewBatch(2, 1024)
+	err = topic.ReadRecords(ctx, &gotBatch, 0, 2, 0)
+	require.Error(t, err)
+
+	// Act
+	result, err := sebtopic.Scrub(ctx, log, storage, topicName, sebtopic.ScrubReplica(replica), sebtopic.ScrubTopic(topic))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(result.Findings))
+	require.True(t, result.Findings[0].Repaired)
+
+	// Assert
+	gotBatch = tester.NewBatch(2, 1024)
+	err = topic.ReadRecords(ctx, &gotBatch, 0, 2, 0)
+	require.NoError(t, err)
+	require.Equal(t, records[:2], gotBatch.IndividualRecords())
+}
+
+// TestScrubQuarantineRejectsReads verifies that reading records of a
+// quarantined record batch fails with seberr.ErrQuarantined, both from the
+// topic given to Scrub() and from topics opened afterwards, and that other
+// record batches can still be read.
+func TestScrubQuarantineRejectsReads(t *testing.T) {
+	const topicName = "topic"
+	ctx := context.Background()
+	storage := sebtopic.NewMemoryStorage(log)
+	records := addScrubRecords(t, storage, topicName, newCache(t))
+
+	topic, err := sebtopic.New(log, storage, topicName, newCache(t))
+	require.NoError(t, err)
+
+	// record batch is read into the topic's cache before it's corrupted
+	gotBatch := tester.NewBatch(1, 1024)
+	err = topic.ReadRecords(ctx, &gotBatch, 2, 1, 0)
+	require.NoError(t, err)
+
+	writeCorruptRecordBatch(t, storage, sebtopic.RecordBatchKey(topicName, 2))
+
+	// Act
+	result, err := sebtopic.Scrub(ctx, log, storage, topicName, sebtopic.ScrubQuarantine(true), sebtopic.ScrubTopic(topic))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(result.Findings))
+	require.True(t, result.Findings[0].Quarantined)
+
+	// Assert
+	reopened, err := sebtopic.New(log, storage, topicName, newCache(t))
+	require.NoError(t, err)
+
+	for _, topic := range []*sebtopic.Topic{topic, reopened} {
+		gotBatch = tester.NewBatch(1, 1024)
+		err = topic.ReadRecords(ctx, &gotBatch, 2, 1, 0)
+		require.ErrorIs(t, err, seberr.ErrQuarantined)
+
+		gotBatch = tester.NewBatch(2, 1024)
+		err = topic.ReadRecords(ctx, &gotBatch, 0, 2, 0)
+		require.NoError(t, err)
+		require.Equal(t, records[:2], gotBatch.IndividualRecords())
+	}
+}
+
+// writeCorruptRecordBatch writes a record batch to key that can be
+// decompressed, but not parsed.
+func writeCorruptRecordBatch(t *testing.T, storage sebtopic.Storage, key string) {
+	wtr, err := storage.Writer(context.Background(), key)
+	require.NoError(t, err)
+
+	gzipWtr, err := sebtopic.Gzip{}.NewWriter(wtr)
+	require.NoError(t, err)
+	_, err = gzipWtr.Write([]byte("not a record batch"))
+	require.NoError(t, err)
+	require.NoError(t, gzipWtr.Close())
+	require.NoError(t, wtr.Close())
+}
+
+// addScrubRecords adds three record batches to topicName, the last of which
+// holds a large record at offset 3.
+func addScrubRecords(t *testing.T, storage sebtopic.Storage, topicName string, cache *sebcache.Cache) [][]byte {
+	topic, err := sebtopic.New(log, storage, topicName, cache, sebtopic.WithLargeRecordThreshold(largeRecordThreshold))
+	require.NoError(t, err)
+
+	records := [][]byte{}
+	for _, batchRecords := range [][][]byte{
+		{tester.RandomBytes(t, 10), tester.RandomBytes(t, 10)},
+		{tester.RandomBytes(t, 10)},
+		{tester.RandomBytes(t, 2*largeRecordThreshold), tester.RandomBytes(t, 10)},
+	} {
+		_, err = topic.AddRecords(tester.RecordsToBatch(batchRecords))
+		require.NoError(t, err)
+		records = append(records, batchRecords...)
+	}
+
+	return records
+}
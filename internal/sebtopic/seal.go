@@ -0,0 +1,90 @@
+package sebtopic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// Sealing a topic permanently closes it for writes, e.g. once a dataset has
+// been finalized or the pipeline producing to it has been retired. Whether a
+// topic is sealed is stored in its manifest, along with its final next
+// offset, such that it stays sealed when it's opened again. Sealed topics
+// always have a manifest, also if they don't otherwise use one.
+//
+// Sealing only affects adding records; sealed topics can still be read,
+// have their expired record batches dropped, be merged and be deleted.
+
+// Seal permanently closes the topic for writes, and returns its final next
+// offset. Adding records to a sealed topic fails with seberr.ErrTopicSealed.
+//
+// Record batches waiting to be written behind are written before the topic is
+// sealed. Sealing a topic that's already sealed returns its next offset.
+func (s *Topic) Seal(ctx context.Context) (uint64, error) {
+	err := s.checkWritable()
+	if err != nil {
+		return 0, err
+	}
+
+	// NOTE: sealMu is held by AddRecords and AddRecordBatch while adding
+	// record batches, ensuring that no record batch is added after the final
+	// next offset has been written to the manifest.
+	s.sealMu.Lock()
+	defer s.sealMu.Unlock()
+
+	if s.sealed.Load() {
+		return s.nextOffset.Load(), nil
+	}
+
+	err = s.FlushWrites(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	s.sealed.Store(true)
+	err = s.writeManifest(ctx)
+	if err != nil {
+		s.sealed.Store(false)
+		return 0, fmt.Errorf("writing manifest: %w", err)
+	}
+
+	nextOffset := s.nextOffset.Load()
+	s.log.Infof("sealed topic at offset %d", nextOffset)
+
+	return nextOffset, nil
+}
+
+// Sealed returns whether the topic has been sealed. See Seal.
+func (s *Topic) Sealed() bool {
+	return s.sealed.Load()
+}
+
+// checkSealed returns seberr.ErrTopicSealed if the topic has been sealed.
+func (s *Topic) checkSealed() error {
+	if s.sealed.Load() {
+		return fmt.Errorf("%w: '%s'", seberr.ErrTopicSealed, s.topicName)
+	}
+	return nil
+}
+
+// loadSealed reads whether the topic has been sealed from its manifest. It's
+// used for topics that aren't opened from their manifest; a missing manifest
+// means that the topic hasn't been sealed.
+func (s *Topic) loadSealed(ctx context.Context) error {
+	m, err := readManifest(ctx, s.backingStorage, s.topicName)
+	if err != nil {
+		if errors.Is(err, seberr.ErrNotInStorage) {
+			return nil
+		}
+		if errors.Is(err, errManifestBad) {
+			s.log.Warnf("manifest unusable, assuming topic isn't sealed: %s", err)
+			return nil
+		}
+		return fmt.Errorf("reading manifest: %w", err)
+	}
+
+	s.sealed.Store(m.sealed)
+	return nil
+}
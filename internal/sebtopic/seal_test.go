@@ -0,0 +1,151 @@
+package sebtopic_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTopicSeal verifies that records can't be added to a sealed topic, that
+// its records can still be read, and that it stays sealed at its final offset
+// when it's opened again, also if it doesn't otherwise use a manifest.
+func TestTopicSeal(t *testing.T) {
+	tests := map[string]struct {
+		manifest bool
+	}{
+		"manifest":    {manifest: true},
+		"no manifest": {manifest: false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+				const topicName = "topic"
+				ctx := context.Background()
+				topic, err := sebtopic.New(log, storage, topicName, cache, sebtopic.WithManifest(test.manifest))
+				require.NoError(t, err)
+
+				batch := tester.MakeRandomRecordBatch(5)
+				_, err = topic.AddRecords(batch)
+				require.NoError(t, err)
+
+				// Act
+				nextOffset, err := topic.Seal(ctx)
+
+				// Assert
+				require.NoError(t, err)
+				require.Equal(t, uint64(5), nextOffset)
+				require.True(t, topic.Sealed())
+
+				_, err = topic.AddRecords(tester.MakeRandomRecordBatch(1))
+				require.ErrorIs(t, err, seberr.ErrTopicSealed)
+				require.ErrorIs(t, err, seberr.ErrWritesFrozen)
+
+				// Act
+				reopened, err := sebtopic.New(log, storage, topicName, cache, sebtopic.WithManifest(test.manifest))
+				require.NoError(t, err)
+
+				// Assert
+				require.True(t, reopened.Sealed())
+				require.Equal(t, uint64(5), reopened.NextOffset())
+
+				metadata, err := reopened.Metadata()
+				require.NoError(t, err)
+				require.True(t, metadata.Sealed)
+
+				_, err = reopened.AddRecords(tester.MakeRandomRecordBatch(1))
+				require.ErrorIs(t, err, seberr.ErrTopicSealed)
+
+				gotBatch := tester.NewBatch(5, 4096)
+				err = reopened.ReadRecords(ctx, &gotBatch, 0, 5, 0)
+				require.NoError(t, err)
+				require.Equal(t, batch.IndividualRecords(), gotBatch.IndividualRecords())
+			})
+		})
+	}
+}
+
+// TestTopicSealEmpty verifies that a topic without any records can be sealed,
+// and that it stays sealed when it's opened again.
+func TestTopicSealEmpty(t *testing.T) {
+	ctx := context.Background()
+	storage := sebtopic.NewMemoryStorage(log)
+
+	topic, err := sebtopic.New(log, storage, "topic", newMemoryCache(t))
+	require.NoError(t, err)
+
+	// Act
+	nextOffset, err := topic.Seal(ctx)
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), nextOffset)
+
+	reopened, err := sebtopic.New(log, storage, "topic", newMemoryCache(t), sebtopic.WithManifest(true))
+	require.NoError(t, err)
+	require.True(t, reopened.Sealed())
+	require.Equal(t, uint64(0), reopened.NextOffset())
+
+	_, err = reopened.AddRecords(tester.MakeRandomRecordBatch(1))
+	require.ErrorIs(t, err, seberr.ErrTopicSealed)
+}
+
+// TestTopicSealWriteBehind verifies that sealing a topic that uses
+// write-behind writes its queued record batches before recording its final
+// offset.
+func TestTopicSealWriteBehind(t *testing.T) {
+	ctx := context.Background()
+	storage := sebtopic.NewMemoryStorage(log)
+
+	topic, err := sebtopic.New(log, storage, "topic", newMemoryCache(t), sebtopic.WithWriteBehind(4, time.Millisecond))
+	require.NoError(t, err)
+
+	for range 3 {
+		_, err = topic.AddRecords(tester.MakeRandomRecordBatch(2))
+		require.NoError(t, err)
+	}
+
+	// Act
+	nextOffset, err := topic.Seal(ctx)
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), nextOffset)
+	require.Equal(t, 0, topic.WriteBehindStats().Queued)
+
+	reopened, err := sebtopic.New(log, storage, "topic", newMemoryCache(t), sebtopic.WithManifest(true))
+	require.NoError(t, err)
+	require.True(t, reopened.Sealed())
+	require.Equal(t, uint64(6), reopened.NextOffset())
+}
+
+// TestTopicSealedCanBeDeleted verifies that sealed topics can be deleted.
+func TestTopicSealedCanBeDeleted(t *testing.T) {
+	ctx := context.Background()
+	storage := sebtopic.NewMemoryStorage(log)
+
+	topic, err := sebtopic.New(log, storage, "topic", newMemoryCache(t))
+	require.NoError(t, err)
+
+	_, err = topic.AddRecords(tester.MakeRandomRecordBatch(2))
+	require.NoError(t, err)
+	_, err = topic.Seal(ctx)
+	require.NoError(t, err)
+
+	// Act
+	err = topic.Delete()
+
+	// Assert
+	require.NoError(t, err)
+
+	reopened, err := sebtopic.New(log, storage, "topic", newMemoryCache(t))
+	require.NoError(t, err)
+	require.False(t, reopened.Sealed())
+	require.Equal(t, uint64(0), reopened.NextOffset())
+}
@@ -0,0 +1,187 @@
+package sebtopic
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/micvbang/go-helpy/uint64y"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// TopicSnapshot describes the files that held the topic's records at a point
+// in time. It can be used to restore the topic to other storage using
+// RestoreTopicSnapshot.
+type TopicSnapshot struct {
+	TopicName  string `json:"topic_name"`
+	NextOffset uint64 `json:"next_offset"`
+
+	// Files holds the topic's large records, followed by its record batches
+	// ordered by offset.
+	Files []SnapshotFile `json:"files"`
+}
+
+// SnapshotFile is a file in backing storage.
+type SnapshotFile struct {
+	Key  string `json:"key"`
+	Size int64  `json:"size"`
+}
+
+// Snapshot returns a TopicSnapshot of the record batches and large records
+// that hold the topic's records at offsets [0;NextOffset).
+//
+// In order for the snapshot to be consistent, records must not be added to
+// the topic while Snapshot is running, and the files it returns must not be
+// merged or deleted before they've been restored.
+func (s *Topic) Snapshot(ctx context.Context) (TopicSnapshot, error) {
+	err := s.loadRecordBatchOffsets(ctx)
+	if err != nil {
+		return TopicSnapshot{}, fmt.Errorf("loading record batch offsets: %w", err)
+	}
+
+	nextOffset := s.nextOffset.Load()
+
+	s.mu.Lock()
+	recordBatchOffsets := slices.Clone(s.recordBatchOffsets)
+	s.mu.Unlock()
+
+	recordBatchSizes, err := listRecordBatches(ctx, s.backingStorage, s.topicName)
+	if err != nil {
+		return TopicSnapshot{}, fmt.Errorf("listing record batches: %w", err)
+	}
+
+	largeRecordSizes, err := listFileSizes(ctx, s.backingStorage, s.topicName, largeRecordExtension)
+	if err != nil {
+		return TopicSnapshot{}, fmt.Errorf("listing large records: %w", err)
+	}
+
+	snapshot := TopicSnapshot{
+		TopicName:  s.topicName,
+		NextOffset: nextOffset,
+		Files:      make([]SnapshotFile, 0, len(largeRecordSizes)+len(recordBatchOffsets)),
+	}
+
+	for offset, size := range largeRecordSizes {
+		if offset < nextOffset {
+			snapshot.Files = append(snapshot.Files, SnapshotFile{Key: LargeRecordKey(s.topicName, offset), Size: size})
+		}
+	}
+	slices.SortFunc(snapshot.Files, func(a, b SnapshotFile) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	for _, batchOffset := range recordBatchOffsets {
+		// record batch was added after nextOffset was read
+		if batchOffset >= nextOffset {
+			break
+		}
+
+		key := s.recordBatchPath(batchOffset)
+		size, ok := recordBatchSizes[key]
+		if !ok {
+			return TopicSnapshot{}, fmt.Errorf("record batch '%s': %w", key, seberr.ErrNotInStorage)
+		}
+		snapshot.Files = append(snapshot.Files, SnapshotFile{Key: key, Size: size})
+	}
+
+	return snapshot, nil
+}
+
+// listFileSizes returns the sizes of the files of topicName in storage with
+// the given extension, by the offset in their name.
+func listFileSizes(ctx context.Context, storage Storage, topicName string, extension string) (map[uint64]int64, error) {
+	sizes := make(map[uint64]int64)
+	err := walkFiles(ctx, storage, topicName, extension, func(file File) error {
+		fileName := path.Base(file.Path)
+		offset, err := uint64y.FromString(strings.TrimSuffix(fileName, extension))
+		if err != nil {
+			return fmt.Errorf("parsing offset of '%s': %w", file.Path, err)
+		}
+		sizes[offset] = file.Size
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sizes, nil
+}
+
+// RestoreResult describes the files copied by RestoreTopicSnapshot.
+type RestoreResult struct {
+	Files int
+	Bytes int64
+}
+
+// RestoreTopicSnapshot copies the files of snapshot from src to dst, as they
+// are. Files are copied in the order given by snapshot, such that large
+// records are restored before the record batches that point to them.
+//
+// seberr.ErrTopicAlreadyExists is returned if dst already has record batches
+// for the topic. If a file in src doesn't have the size given by snapshot, it
+// was changed after the snapshot was made and an error is returned.
+//
+// NOTE: src and dst are used as raw storage; files are copied without
+// decompressing or decrypting them. If they're encrypted, dst must be used
+// with the key that src was written with.
+func RestoreTopicSnapshot(ctx context.Context, src Storage, dst Storage, snapshot TopicSnapshot) (RestoreResult, error) {
+	recordBatchOffsets, _, err := listRecordBatchOffsets(ctx, dst, snapshot.TopicName)
+	if err != nil {
+		return RestoreResult{}, err
+	}
+	if len(recordBatchOffsets) > 0 {
+		return RestoreResult{}, fmt.Errorf("%w: '%s' has %d record batches in destination", seberr.ErrTopicAlreadyExists, snapshot.TopicName, len(recordBatchOffsets))
+	}
+
+	result := RestoreResult{}
+	for _, file := range snapshot.Files {
+		err := copySnapshotFile(ctx, src, dst, file)
+		if err != nil {
+			return result, err
+		}
+
+		result.Files += 1
+		result.Bytes += file.Size
+	}
+
+	return result, nil
+}
+
+// copySnapshotFile copies file from src to dst. If the copied file doesn't
+// have the size given by file, it's deleted from dst.
+func copySnapshotFile(ctx context.Context, src Storage, dst Storage, file SnapshotFile) error {
+	rdr, err := src.Reader(ctx, file.Key)
+	if err != nil {
+		return fmt.Errorf("opening '%s': %w", file.Key, err)
+	}
+	defer rdr.Close()
+
+	wtr, err := dst.Writer(ctx, file.Key)
+	if err != nil {
+		return fmt.Errorf("creating writer '%s': %w", file.Key, err)
+	}
+
+	n, err := io.Copy(wtr, rdr)
+	if err != nil {
+		wtr.Close()
+		return fmt.Errorf("copying '%s': %w", file.Key, err)
+	}
+
+	err = wtr.Close()
+	if err != nil {
+		return fmt.Errorf("closing writer '%s': %w", file.Key, err)
+	}
+
+	if n != file.Size {
+		err = dst.Delete(file.Key)
+		if err != nil {
+			return fmt.Errorf("deleting '%s': %w", file.Key, err)
+		}
+		return fmt.Errorf("'%s' changed after snapshot was made: expected %d bytes, got %d", file.Key, file.Size, n)
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package sebtopic_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTopicSnapshotRestore verifies that the files of a topic's snapshot,
+// including its large records, are copied to fresh storage by
+// RestoreTopicSnapshot(), and that the restored topic holds the same records.
+func TestTopicSnapshotRestore(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		const topicName = "topic"
+		topic, err := sebtopic.New(log, storage, topicName, cache, sebtopic.WithLargeRecordThreshold(largeRecordThreshold))
+		require.NoError(t, err)
+
+		records := [][]byte{
+			tester.RandomBytes(t, 10),
+			tester.RandomBytes(t, 2*largeRecordThreshold),
+			tester.RandomBytes(t, 20),
+		}
+		_, err = topic.AddRecords(tester.RecordsToBatch(records[:2]))
+		require.NoError(t, err)
+		_, err = topic.AddRecords(tester.RecordsToBatch(records[2:]))
+		require.NoError(t, err)
+
+		// Act
+		snapshot, err := topic.Snapshot(context.Background())
+		require.NoError(t, err)
+
+		// Assert
+		require.Equal(t, topicName, snapshot.TopicName)
+		require.Equal(t, uint64(3), snapshot.NextOffset)
+		require.Equal(t, []string{
+			sebtopic.LargeRecordKey(topicName, 1),
+			sebtopic.RecordBatchKey(topicName, 0),
+			sebtopic.RecordBatchKey(topicName, 2),
+		}, snapshotKeys(snapshot))
+
+		dst := sebtopic.NewMemoryStorage(log)
+
+		// Act
+		result, err := sebtopic.RestoreTopicSnapshot(context.Background(), storage, dst, snapshot)
+		require.NoError(t, err)
+
+		// Assert
+		require.Equal(t, 3, result.Files)
+
+		restored, err := sebtopic.New(log, dst, topicName, newCache(t))
+		require.NoError(t, err)
+		require.Equal(t, snapshot.NextOffset, restored.NextOffset())
+
+		gotBatch := tester.NewBatch(len(records), 10*largeRecordThreshold)
+		err = restored.ReadRecords(context.Background(), &gotBatch, 0, len(records), 0)
+		require.NoError(t, err)
+		require.Equal(t, records, gotBatch.IndividualRecords())
+	})
+}
+
+// TestRestoreTopicSnapshotErrors verifies that RestoreTopicSnapshot() refuses
+// to overwrite a topic that already exists in the destination, and that it
+// fails if a file was changed after the snapshot was made.
+func TestRestoreTopicSnapshotErrors(t *testing.T) {
+	const topicName = "topic"
+	src := sebtopic.NewMemoryStorage(log)
+	topic, err := sebtopic.New(log, src, topicName, newCache(t))
+	require.NoError(t, err)
+
+	_, err = topic.AddRecords(tester.MakeRandomRecordBatch(2))
+	require.NoError(t, err)
+
+	snapshot, err := topic.Snapshot(context.Background())
+	require.NoError(t, err)
+
+	// Act
+	_, err = sebtopic.RestoreTopicSnapshot(context.Background(), src, src, snapshot)
+
+	// Assert
+	require.ErrorIs(t, err, seberr.ErrTopicAlreadyExists)
+
+	changed := snapshot
+	changed.Files = []sebtopic.SnapshotFile{{Key: snapshot.Files[0].Key, Size: snapshot.Files[0].Size + 1}}
+	dst := sebtopic.NewMemoryStorage(log)
+
+	// Act
+	_, err = sebtopic.RestoreTopicSnapshot(context.Background(), src, dst, changed)
+
+	// Assert
+	require.ErrorContains(t, err, "changed after snapshot")
+	files, err := dst.ListFiles(context.Background(), topicName, "")
+	require.NoError(t, err)
+	require.Empty(t, files)
+}
+
+func snapshotKeys(snapshot sebtopic.TopicSnapshot) []string {
+	keys := make([]string, 0, len(snapshot.Files))
+	for _, file := range snapshot.Files {
+		keys = append(keys, file.Key)
+	}
+	return keys
+}
@@ -2,18 +2,20 @@ package sebtopic
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"path"
-	"path/filepath"
+	"slices"
 	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/micvbang/go-helpy/sizey"
 	"github.com/micvbang/go-helpy/slicey"
-	"github.com/micvbang/go-helpy/uint64y"
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
 	"github.com/micvbang/simple-event-broker/internal/sebcache"
 	"github.com/micvbang/simple-event-broker/internal/sebrecords"
@@ -26,9 +28,10 @@ type File struct {
 }
 
 type Storage interface {
-	Writer(recordBatchPath string) (io.WriteCloser, error)
-	Reader(recordBatchPath string) (io.ReadCloser, error)
-	ListFiles(topicName string, extension string) ([]File, error)
+	Writer(ctx context.Context, recordBatchPath string) (io.WriteCloser, error)
+	Reader(ctx context.Context, recordBatchPath string) (io.ReadCloser, error)
+	ListFiles(ctx context.Context, topicName string, extension string) ([]File, error)
+	Delete(recordBatchPath string) error
 }
 
 type Compress interface {
@@ -48,94 +51,332 @@ type Topic struct {
 	cache          *sebcache.Cache
 	compression    Compress
 	OffsetCond     *OffsetCond
+
+	largeRecordThreshold int
+
+	// offsetIndexInterval is the number of record batches to add between
+	// writing the offset index. batchesSinceIndex is protected by mu.
+	offsetIndexInterval int
+	batchesSinceIndex   int
+	indexMu             sync.Mutex
+
+	// manifest is true if the topic's manifest is written whenever a record
+	// batch is added. offsetsLoaded is false until all of the topic's record
+	// batch offsets have been loaded, which is done lazily when the topic was
+	// opened from its manifest. loadMu ensures that they're only loaded once.
+	manifest      bool
+	manifestMu    sync.Mutex
+	offsetsLoaded atomic.Bool
+	loadMu        sync.Mutex
+
+	// maintenanceMu ensures that DropExpiredBatches() and MergeBatches(),
+	// which both remove record batches, don't run concurrently.
+	maintenanceMu sync.Mutex
+
+	// prefetchBatches is the number of record batches following the one
+	// being read to prefetch into the cache. prefetching holds the record
+	// batches that are currently being prefetched, and is protected by
+	// prefetchMu.
+	prefetchBatches int
+	prefetchMu      sync.Mutex
+	prefetching     map[uint64]chan struct{}
+
+	// usage tracks the sizes of the topic's files in backing storage.
+	// reconcileMu ensures that only one reconcile runs at a time.
+	usage       *usageTracker
+	reconcileMu sync.Mutex
+
+	// clock issues the commit times of record batches added to the topic.
+	clock *hybridClock
+
+	// readOnly is true if the topic must not write to backing storage.
+	readOnly bool
+
+	// epoch is the epoch that record batches added to the topic are named
+	// with, and epochs tracks the epochs of the topic's record batches.
+	epoch  uint64
+	epochs *recordBatchEpochs
+
+	// lease is the lease that the topic must hold in order to add record
+	// batches, or nil if it doesn't use a lease.
+	lease *leaser
+
+	// writeBehind writes record batches to backing storage after they've
+	// been added, or is nil if record batches are written before being added.
+	writeBehind *writeBehind
+
+	// sealed is true once the topic has been permanently closed for writes.
+	// sealMu is held while adding record batches, and by Seal. See Seal.
+	sealed atomic.Bool
+	sealMu sync.RWMutex
 }
 
 type Opts struct {
 	Compression Compress
+
+	// LargeRecordThreshold is the size in bytes above which records are
+	// stored as separate objects in backing storage, with the record batch
+	// only holding a pointer to them. This keeps record batches small while
+	// still allowing occasional huge records. Disabled if 0.
+	LargeRecordThreshold int
+
+	// OffsetIndexInterval is the number of record batches to add between
+	// writing the topic's offset index, which speeds up opening topics with
+	// many record batches. Disabled if 0.
+	OffsetIndexInterval int
+
+	// Manifest enables writing the topic's manifest whenever a record batch
+	// is added, which allows opening the topic without listing its record
+	// batches. The offsets of the topic's record batches are then only loaded
+	// once they're needed.
+	Manifest bool
+
+	// PrefetchBatches is the number of record batches following the one
+	// being read that are read from backing storage into the cache in the
+	// background, such that sequential consumers don't have to wait for each
+	// record batch to be read. Disabled if 0.
+	PrefetchBatches int
+
+	// ReadOnly makes the topic reject writes and never write to backing
+	// storage, e.g. for read replicas of a topic written by another broker.
+	// See Refresh.
+	ReadOnly bool
+
+	// Epoch is the epoch of the broker writing to the topic, e.g. its term,
+	// which is included in the names of the record batches it adds. Record
+	// batches of epoch 0 use the original naming scheme. See RecordBatchName.
+	Epoch uint64
+
+	// Lease is the lease that the topic must hold in order to add record
+	// batches. Leases are disabled if Lease.Holder is empty. See WithLease.
+	Lease LeaseOpts
+
+	// WriteBehind makes the topic write record batches to backing storage in
+	// the background after they've been added. Disabled if
+	// WriteBehind.QueueSize is 0. See WithWriteBehind.
+	WriteBehind WriteBehindOpts
 }
 
 func New(log logger.Logger, backingStorage Storage, topicName string, cache *sebcache.Cache, optFuncs ...func(*Opts)) (*Topic, error) {
 	opts := Opts{
-		Compression: Gzip{},
+		Compression:         Gzip{},
+		OffsetIndexInterval: 8,
 	}
 	for _, optFunc := range optFuncs {
 		optFunc(&opts)
 	}
 
-	recordBatchOffsets, err := listRecordBatchOffsets(backingStorage, topicName)
+	topic := &Topic{
+		log:            log.WithField(logger.FieldTopicName, topicName),
+		backingStorage: backingStorage,
+		topicName:      topicName,
+		cache:          cache,
+		compression:    opts.Compression,
+		OffsetCond:     newEmptyOffsetCond(),
+
+		largeRecordThreshold: opts.LargeRecordThreshold,
+		offsetIndexInterval:  opts.OffsetIndexInterval,
+		manifest:             opts.Manifest,
+		prefetchBatches:      opts.PrefetchBatches,
+		prefetching:          make(map[uint64]chan struct{}),
+		usage:                newUsageTracker(),
+		clock:                &hybridClock{},
+		readOnly:             opts.ReadOnly,
+		epoch:                opts.Epoch,
+		epochs:               &recordBatchEpochs{},
+	}
+
+	if opts.WriteBehind.QueueSize > 0 && !opts.ReadOnly {
+		if cache == nil {
+			return nil, fmt.Errorf("%w: write-behind requires a cache", seberr.ErrBadInput)
+		}
+		topic.writeBehind = newWriteBehind(topic.log.Name("write behind"), opts.WriteBehind, topic.writeBehindBatch, topic.wroteBehind)
+	}
+
+	ctx := context.Background()
+	if opts.Lease.Holder != "" && !opts.ReadOnly {
+		topic.lease = newLeaser(backingStorage, topicName, opts.Lease)
+		epoch, err := topic.lease.acquire(ctx, opts.Epoch)
+		if err != nil {
+			return nil, fmt.Errorf("acquiring lease: %w", err)
+		}
+		topic.epoch = epoch
+	}
+
+	if topic.manifest {
+		recordBatchOffsets, epochs, nextOffset, err := topic.loadManifest(ctx)
+		if err == nil {
+			topic.recordBatchOffsets = recordBatchOffsets
+			topic.epochs = epochs
+			topic.setNextOffset(nextOffset)
+			return topic, topic.checkEpoch()
+		}
+
+		if !errors.Is(err, seberr.ErrNotInStorage) {
+			topic.log.Warnf("manifest unusable, opening without it: %s", err)
+		}
+	}
+	topic.offsetsLoaded.Store(true)
+
+	if !topic.manifest {
+		err := topic.loadSealed(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if topic.offsetIndexInterval > 0 {
+		recordBatchOffsets, epochs, nextOffset, err := topic.loadOffsetIndex(ctx)
+		if err == nil {
+			topic.recordBatchOffsets = recordBatchOffsets
+			topic.epochs = epochs
+			topic.setNextOffset(nextOffset)
+			err = topic.checkEpoch()
+			if err != nil {
+				return nil, err
+			}
+			topic.writeMissingManifest(ctx)
+			return topic, nil
+		}
+
+		if !errors.Is(err, seberr.ErrNotInStorage) {
+			topic.log.Warnf("offset index unusable, listing record batches: %s", err)
+		}
+	}
+
+	recordBatchOffsets, epochs, err := listRecordBatchOffsets(ctx, backingStorage, topicName)
 	if err != nil {
 		return nil, fmt.Errorf("listing record batches: %w", err)
 	}
+	topic.recordBatchOffsets = recordBatchOffsets
+	topic.epochs = epochs
 
-	topic := &Topic{
-		log:                log.WithField("topic-name", topicName),
-		backingStorage:     backingStorage,
-		topicName:          topicName,
-		recordBatchOffsets: recordBatchOffsets,
-		cache:              cache,
-		compression:        opts.Compression,
-		OffsetCond:         NewOffsetCond(0),
+	err = topic.checkEpoch()
+	if err != nil {
+		return nil, err
 	}
 
 	if len(recordBatchOffsets) > 0 {
 		newestRecordBatchOffset := recordBatchOffsets[len(recordBatchOffsets)-1]
-		parser, err := topic.parseRecordBatch(newestRecordBatchOffset)
+		parser, err := topic.parseRecordBatch(ctx, newestRecordBatchOffset)
 		if err != nil {
 			return nil, fmt.Errorf("reading record batch header: %w", err)
 		}
 		defer parser.Close()
 
-		nextOffset := newestRecordBatchOffset + uint64(parser.Header.NumRecords)
-		topic.nextOffset.Store(nextOffset)
-		topic.OffsetCond = NewOffsetCond(nextOffset - 1)
+		topic.setNextOffset(newestRecordBatchOffset + uint64(parser.Header.NumRecords))
+		topic.clock.seed(parser.Header.UnixEpochUs)
+
+		if topic.offsetIndexInterval > 0 && !topic.readOnly {
+			err = topic.writeOffsetIndex(ctx)
+			if err != nil {
+				topic.log.Errorf("writing offset index: %s", err)
+			}
+		}
+		topic.writeMissingManifest(ctx)
 	}
 
 	return topic, nil
 }
 
+// checkEpoch returns an error if the topic's epoch is older than the epoch of
+// its newest record batch, in which case record batches added to it would be
+// considered stale writes. Read-only topics don't add record batches, so their
+// epoch isn't checked.
+func (s *Topic) checkEpoch() error {
+	latest := s.epochs.latest()
+	if !s.readOnly && s.epoch < latest {
+		return fmt.Errorf("%w: epoch %d of topic '%s' is older than epoch %d of its newest record batch", seberr.ErrWritesFrozen, s.epoch, s.topicName, latest)
+	}
+	return nil
+}
+
+// writeMissingManifest writes the manifest of a topic that wasn't opened from
+// its manifest, such that it can be the next time.
+func (s *Topic) writeMissingManifest(ctx context.Context) {
+	if !s.manifest || s.readOnly {
+		return
+	}
+
+	err := s.writeManifest(ctx)
+	if err != nil {
+		s.log.Errorf("writing manifest: %s", err)
+	}
+}
+
+// setNextOffset sets the topic's next offset when opening it.
+func (s *Topic) setNextOffset(nextOffset uint64) {
+	s.nextOffset.Store(nextOffset)
+	if nextOffset > 0 {
+		s.OffsetCond = NewOffsetCond(nextOffset - 1)
+	}
+}
+
 // AddRecords writes records to the topic's backing storage and returns the ids
 // of the newly added records in the same order as the records were given.
+// seberr.ErrTopicSealed is returned if the topic has been sealed; see Seal.
 //
 // NOTE: AddRecords is NOT thread safe. It's up to the caller to ensure that
 // this is not called concurrently. This is normally the responsibility of a
 // RecordBatcher.
 func (s *Topic) AddRecords(batch sebrecords.Batch) ([]uint64, error) {
+	err := s.checkWritable()
+	if err != nil {
+		return nil, err
+	}
+
+	s.sealMu.RLock()
+	defer s.sealMu.RUnlock()
+
+	err = s.checkSealed()
+	if err != nil {
+		return nil, err
+	}
+
+	// NOTE: batches are usually shared by many producers, so there's no single
+	// request context to write on behalf of.
+	ctx := context.Background()
 	recordBatchID := s.nextOffset.Load()
 
-	rbPath := RecordBatchKey(s.topicName, recordBatchID)
-	backingWriter, err := s.backingStorage.Writer(rbPath)
+	// NOTE: large records must be written before the record batch pointing
+	// to them, so that pointers are never visible before their records.
+	batch, err = s.offloadLargeRecords(ctx, batch, recordBatchID)
 	if err != nil {
-		return nil, fmt.Errorf("opening writer '%s': %w", rbPath, err)
+		return nil, fmt.Errorf("offloading large records: %w", err)
 	}
 
-	w := backingWriter
-	if s.compression != nil {
-		w, err = s.compression.NewWriter(backingWriter)
-		if err != nil {
-			return nil, fmt.Errorf("creating compression writer: %w", err)
-		}
+	unixEpochUs, err := s.commitTime(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	t0 := time.Now()
-	err = sebrecords.Write(w, batch)
+	// NOTE: offloading large records may take a while, during which the
+	// lease may have been lost.
+	err = s.checkLease()
 	if err != nil {
-		return nil, fmt.Errorf("writing record batch: %w", err)
+		return nil, err
 	}
 
-	if s.compression != nil {
-		err = w.Close()
+	rbPath := s.newRecordBatchPath(recordBatchID)
+	if s.writeBehind != nil {
+		// NOTE: until the record batch has been written to backing storage,
+		// the cache and the write-behind queue hold the only copies of it.
+		err = s.cacheRecordBatch(ctx, rbPath, batch, unixEpochUs)
 		if err != nil {
-			return nil, fmt.Errorf("closing compression writer: %w", err)
+			s.epochs.removeFrom(recordBatchID)
+			return nil, fmt.Errorf("caching record batch: %w", err)
+		}
+		s.writeBehind.enqueue(RecordBatchName{ID: recordBatchID, Epoch: s.epoch}, batch, unixEpochUs)
+	} else {
+		t0 := time.Now()
+		err = s.writeRecordBatch(ctx, rbPath, batch, unixEpochUs)
+		if err != nil {
+			s.epochs.removeFrom(recordBatchID)
+			return nil, err
 		}
-	}
-	// once Close() returns, the data has been committed and can be retrieved by
-	// ReadRecord.
-	err = backingWriter.Close()
-	if err != nil {
-		return nil, fmt.Errorf("closing backing writer: %w", err)
-	}
 
-	s.log.Infof("wrote %d records (%s bytes) to %s (%s)", batch.Len(), sizey.FormatBytes(len(batch.Data)), rbPath, time.Since(t0))
+		s.log.WithField(logger.FieldBatchID, recordBatchID).Infof("wrote %d records (%s bytes) to %s (%s)", batch.Len(), sizey.FormatBytes(len(batch.Data)), rbPath, time.Since(t0))
+	}
 
 	nextOffset := recordBatchID + uint64(batch.Len())
 	offsets := make([]uint64, 0, batch.Len())
@@ -143,33 +384,16 @@ func (s *Topic) AddRecords(batch sebrecords.Batch) ([]uint64, error) {
 		offsets = append(offsets, i)
 	}
 
-	// once Store() returns, the newly added records are visible in
-	// ReadRecords(). NOTE: recordBatchIDs must also have been updated before
-	// this is true.
-	s.mu.Lock()
-	s.recordBatchOffsets = append(s.recordBatchOffsets, recordBatchID)
-	s.mu.Unlock()
-	s.nextOffset.Store(nextOffset)
+	s.publishRecordBatch(ctx, recordBatchID, nextOffset)
 
 	// TODO: it would be nice to remove this from the "fastpath"
 	// NOTE: we are intentionally not returning caching errors to caller. It's
 	// (semi) fine if the file isn't written to cache since we can retrieve it
 	// from backing storage.
-	if s.cache != nil {
-		cacheWtr, err := s.cache.Writer(rbPath)
-		if err != nil {
-			s.log.Errorf("creating cache writer to cache (%s): %w", rbPath, err)
-			return offsets, nil
-		}
-
-		err = sebrecords.Write(cacheWtr, batch)
-		if err != nil {
-			s.log.Errorf("writing to cache (%s): %w", rbPath, err)
-		}
-
-		err = cacheWtr.Close()
+	if s.cache != nil && s.writeBehind == nil {
+		err = s.cacheRecordBatch(ctx, rbPath, batch, unixEpochUs)
 		if err != nil {
-			s.log.Errorf("closing cached file (%s): %w", rbPath, err)
+			s.log.Errorf("caching record batch: %s", err)
 		}
 	}
 
@@ -181,6 +405,61 @@ func (s *Topic) AddRecords(batch sebrecords.Batch) ([]uint64, error) {
 	return offsets, nil
 }
 
+// commitTime returns the commit time of the next record batch added to the
+// topic, in unix epoch microseconds. Commit times are strictly increasing
+// within the topic, also across restarts and jumps of the wall clock.
+func (s *Topic) commitTime(ctx context.Context) (int64, error) {
+	if !s.clock.isSeeded() {
+		// NOTE: topics opened from their manifest or offset index haven't read
+		// the commit time of their latest record batch.
+		nextOffset := s.nextOffset.Load()
+		if nextOffset > 0 {
+			info, err := s.BatchInfo(ctx, nextOffset-1)
+			if err != nil && !errors.Is(err, seberr.ErrOutOfBounds) {
+				return 0, fmt.Errorf("reading commit time of latest record batch: %w", err)
+			}
+			if err == nil {
+				s.clock.seed(info.CommittedAt.UnixMicro())
+			}
+		}
+		s.clock.seed(0)
+	}
+
+	return s.clock.next(), nil
+}
+
+// publishRecordBatch makes the records of the record batch at recordBatchID,
+// which has been written to backing storage, visible to readers.
+func (s *Topic) publishRecordBatch(ctx context.Context, recordBatchID uint64, nextOffset uint64) {
+	// once Store() returns, the newly added records are visible in
+	// ReadRecords(). NOTE: recordBatchIDs must also have been updated before
+	// this is true.
+	s.mu.Lock()
+	s.recordBatchOffsets = append(s.recordBatchOffsets, recordBatchID)
+	s.batchesSinceIndex += 1
+	// NOTE: the offset index can't be written until all record batch offsets
+	// have been loaded.
+	writeIndex := s.offsetIndexInterval > 0 && s.batchesSinceIndex >= s.offsetIndexInterval && s.offsetsLoaded.Load()
+	s.mu.Unlock()
+	s.nextOffset.Store(nextOffset)
+
+	// NOTE: with write-behind, the manifest is written once the record batch
+	// has been written to backing storage.
+	if s.manifest && s.writeBehind == nil {
+		err := s.writeManifest(ctx)
+		if err != nil {
+			s.log.Errorf("writing manifest: %s", err)
+		}
+	}
+
+	if writeIndex {
+		err := s.writeOffsetIndex(ctx)
+		if err != nil {
+			s.log.Errorf("writing offset index: %s", err)
+		}
+	}
+}
+
 // ReadRecords returns records starting from startOffset and until either:
 // 1) ctx is cancelled
 // 2) maxRecords has been reached
@@ -191,10 +470,75 @@ func (s *Topic) AddRecords(batch sebrecords.Batch) ([]uint64, error) {
 // - softMaxBytes is "soft" because it will not be honored if it means returning
 // zero records; in this case, at least one record will be returned.
 //
+// Records that have expired are skipped and counted in batch.Skipped. This
+// means that the offset following the last record read into batch is offset +
+// batch.Len() + batch.Skipped. Records that are not allowed by the ReadLimits
+// of ctx, or not matched by its RecordFilter, are skipped in the same way.
+//
+// The condition that stopped the read is given by batch.StopReason.
+//
+// When reading a single record from a record batch that isn't cached, only the
+// parts of the record batch that are needed are read from backing storage if
+// possible. See parseRecordBatchRange.
+//
 // NOTE: ReadRecords will always return all of the records that it managed
 // to fetch until one of the above conditions were met. This means that the
 // returned value should be used even if err is non-nil!
 func (s *Topic) ReadRecords(ctx context.Context, batch *sebrecords.Batch, offset uint64, maxRecords int, softMaxBytes int) error {
+	return s.readRecords(ctx, batch, batchReader{topic: s, batch: batch}, offset, maxRecords, softMaxBytes)
+}
+
+// ReadRecordsRange reads the records [startOffset;endOffset) into batch,
+// reading each run of records from a record batch with a single contiguous
+// read. Unlike ReadRecords, the number of records and bytes read is only
+// limited by the range; batch must have room for all of them.
+//
+// Records that are skipped, e.g. because they have expired, are counted in
+// batch.Skipped as documented by ReadRecords.
+func (s *Topic) ReadRecordsRange(ctx context.Context, batch *sebrecords.Batch, startOffset uint64, endOffset uint64) error {
+	if startOffset >= endOffset {
+		return fmt.Errorf("%w: start offset (%d) must be smaller than end offset (%d)", seberr.ErrBadInput, startOffset, endOffset)
+	}
+
+	// NOTE: records beyond endOffset must not be read when records in the
+	// range are skipped; the range is enforced as a read limit.
+	limits, _ := ReadLimitsFromContext(ctx)
+	if limits.EndOffset == 0 || endOffset < limits.EndOffset {
+		limits.EndOffset = endOffset
+	}
+	ctx = WithReadLimits(ctx, limits)
+
+	return s.readRecords(ctx, batch, batchReader{topic: s, batch: batch}, startOffset, int(endOffset-startOffset), 0)
+}
+
+// recordsDst receives the records found by readRecords.
+type recordsDst interface {
+	// records receives records [recordIndexStart;recordIndexEnd) of rb, the
+	// record batch at batchOffset.
+	records(rb *sebrecords.Parser, batchOffset uint64, recordIndexStart uint32, recordIndexEnd uint32) error
+
+	// largeRecord receives the large record stored at key.
+	largeRecord(ctx context.Context, key string, size uint32) error
+}
+
+// batchReader reads records into batch.
+type batchReader struct {
+	topic *Topic
+	batch *sebrecords.Batch
+}
+
+func (br batchReader) records(rb *sebrecords.Parser, _ uint64, recordIndexStart uint32, recordIndexEnd uint32) error {
+	return rb.Records(br.batch, recordIndexStart, recordIndexEnd)
+}
+
+func (br batchReader) largeRecord(ctx context.Context, key string, size uint32) error {
+	return br.topic.readLargeRecord(ctx, br.batch, key, size)
+}
+
+// readRecords implements ReadRecords, giving the records that are found to
+// dst. dst is responsible for adding the sizes of the records to batch, which
+// is used to keep track of the number of records found and skipped.
+func (s *Topic) readRecords(ctx context.Context, batch *sebrecords.Batch, dst recordsDst, offset uint64, maxRecords int, softMaxBytes int) error {
 	if offset >= s.nextOffset.Load() {
 		return fmt.Errorf("offset does not exist: %w", seberr.ErrOutOfBounds)
 	}
@@ -203,6 +547,11 @@ func (s *Topic) ReadRecords(ctx context.Context, batch *sebrecords.Batch, offset
 		maxRecords = 10
 	}
 
+	err := s.loadRecordBatchOffsetsFor(ctx, offset)
+	if err != nil {
+		return fmt.Errorf("loading record batch offsets: %w", err)
+	}
+
 	// make a local copy of recordBatchOffsets so that we don't have to hold the
 	// lock for the rest of the function.
 	s.mu.Lock()
@@ -210,6 +559,39 @@ func (s *Topic) ReadRecords(ctx context.Context, batch *sebrecords.Batch, offset
 	copy(recordBatchOffsets, s.recordBatchOffsets)
 	s.mu.Unlock()
 
+	// records before the oldest record batch have been dropped because they
+	// expired.
+	if len(recordBatchOffsets) > 0 && offset < recordBatchOffsets[0] {
+		batch.Skipped += int(recordBatchOffsets[0] - offset)
+		offset = recordBatchOffsets[0]
+	}
+
+	limits, hasLimits := ReadLimitsFromContext(ctx)
+	endOffset := uint64(math.MaxUint64)
+	var notBeforeUs int64
+	if hasLimits {
+		if limits.EndOffset != 0 {
+			if offset >= limits.EndOffset {
+				return fmt.Errorf("offset %d beyond read limit %d: %w", offset, limits.EndOffset, seberr.ErrOutOfBounds)
+			}
+			endOffset = limits.EndOffset
+		}
+
+		if offset < limits.StartOffset {
+			skipTo := min(limits.StartOffset, s.nextOffset.Load())
+			batch.Skipped += int(skipTo - offset)
+			offset = skipTo
+			if offset >= s.nextOffset.Load() {
+				batch.StopReason = sebrecords.StopReasonEnd
+				return nil
+			}
+		}
+
+		if !limits.NotBefore.IsZero() {
+			notBeforeUs = limits.NotBefore.UnixMicro()
+		}
+	}
+
 	// find the batch that offset is located in
 	var (
 		batchOffset      uint64
@@ -223,53 +605,148 @@ func (s *Topic) ReadRecords(ctx context.Context, batch *sebrecords.Batch, offset
 		}
 	}
 
+	filter, hasFilter := RecordFilterFromContext(ctx)
+	hasFilter = hasFilter && !filter.Empty()
+
+	nowUs := time.Now().UnixMicro()
 	trackByteSize := softMaxBytes != 0
 	recordBatchBytes := uint32(0)
 	batchRecordIndex := uint32(offset - batchOffset)
 	firstRecord := true
+	bytesExhausted := false
+
+	// with a WireSize, the overhead of serializing records counts towards
+	// softMaxBytes
+	recordOverhead := uint32(0)
+	if wireSize, ok := WireSizeFromContext(ctx); ok && trackByteSize {
+		recordBatchBytes = uint32(wireSize.FixedOverhead)
+		recordOverhead = uint32(wireSize.RecordOverhead)
+	}
 
 	moreRecords := func() bool { return batch.Len() < maxRecords }
-	moreBytes := func() bool { return (!trackByteSize || recordBatchBytes < uint32(softMaxBytes)) }
+	moreBytes := func() bool {
+		return !bytesExhausted && (!trackByteSize || firstRecord || recordBatchBytes < uint32(softMaxBytes))
+	}
 	moreBatches := func() bool { return batchOffsetIndex < len(recordBatchOffsets) }
 
 	for moreRecords() && moreBytes() && moreBatches() {
 		select {
 		case <-ctx.Done():
+			batch.StopReason = sebrecords.StopReasonDeadline
 			return ctx.Err()
 		default:
 		}
 
 		batchOffset = recordBatchOffsets[batchOffsetIndex]
-		rb, err := s.parseRecordBatch(batchOffset)
+		if batchOffset >= endOffset {
+			break
+		}
+
+		parse := s.parseRecordBatch
+		if maxRecords == 1 {
+			parse = s.parseRecordBatchRange
+		}
+
+		rb, err := parse(ctx, batchOffset)
 		if err != nil {
 			return fmt.Errorf("parsing record batch: %w", err)
 		}
 
-		batchMaxRecords := min(uint32(maxRecords-batch.Len()), rb.Header.NumRecords-batchRecordIndex)
-		numRecords := batchMaxRecords
-		if trackByteSize {
-			numRecords = 0
+		if maxRecords > 1 {
+			s.prefetchRecordBatches(ctx, recordBatchOffsets[batchOffsetIndex+1:])
+		}
+
+		// NOTE: while record batches are being merged, a record batch may
+		// overlap the record batches following it. Records are read from the
+		// newest record batch that contains them.
+		numRecords := rb.Header.NumRecords
+		if batchOffsetIndex+1 < len(recordBatchOffsets) {
+			numRecords = min(numRecords, uint32(recordBatchOffsets[batchOffsetIndex+1]-batchOffset))
+		}
+
+		// records in batches committed before the read limit are skipped
+		if rb.Header.UnixEpochUs < notBeforeUs {
+			batch.Skipped += int(numRecords - batchRecordIndex)
+			rb.Close()
+			batchOffsetIndex += 1
+			batchRecordIndex = 0
+			continue
+		}
+
+		// don't read records at or beyond the read limit
+		if batchOffset+uint64(numRecords) > endOffset {
+			numRecords = uint32(endOffset - batchOffset)
+		}
+
+		// expired records, and records not matched by the filter of ctx,
+		// are skipped
+		skip := func(recordIndex uint32) bool {
+			return rb.Expired(recordIndex, nowUs) || (hasFilter && !filter.matches(rb, recordIndex))
+		}
+
+		recordIndex := batchRecordIndex
+		for recordIndex < numRecords && moreRecords() && moreBytes() {
+			if skip(recordIndex) {
+				batch.Skipped += 1
+				batch.SkippedBytes += int(rb.RecordSizes[recordIndex])
+				recordIndex += 1
+				continue
+			}
+
+			if rb.IsPointer(recordIndex) {
+				size, key, err := readPointer(rb, recordIndex)
+				if err != nil {
+					rb.Close()
+					return fmt.Errorf("record batch '%s': %w", s.recordBatchPath(batchOffset), err)
+				}
+
+				if trackByteSize {
+					if !firstRecord && recordBatchBytes+size+recordOverhead > uint32(softMaxBytes) {
+						bytesExhausted = true
+						break
+					}
+					recordBatchBytes += size + recordOverhead
+				}
 
-			for _, recordSize := range rb.RecordSizes[batchRecordIndex : batchRecordIndex+batchMaxRecords] {
-				if !firstRecord && recordBatchBytes+recordSize > uint32(softMaxBytes) {
-					break
+				err = dst.largeRecord(ctx, key, size)
+				if err != nil {
+					rb.Close()
+					return err
 				}
 
-				numRecords += 1
-				recordBatchBytes += recordSize
 				firstRecord = false
+				recordIndex += 1
+				continue
 			}
-		}
 
-		// we read enough records to satisfy the request
-		if numRecords == 0 {
-			break
-		}
+			// find the longest run of records that aren't skipped and that
+			// satisfies the request
+			runEnd := recordIndex
+			for runEnd < numRecords && batch.Len()+int(runEnd-recordIndex) < maxRecords && !skip(runEnd) && !rb.IsPointer(runEnd) {
+				if trackByteSize {
+					recordSize := rb.RecordSizes[runEnd] + recordOverhead
+					if !firstRecord && recordBatchBytes+recordSize > uint32(softMaxBytes) {
+						bytesExhausted = true
+						break
+					}
+					recordBatchBytes += recordSize
+				}
 
-		// TODO: pass batch into rb.Records to write to it directly
-		err = rb.Records(batch, batchRecordIndex, batchRecordIndex+numRecords)
-		if err != nil {
-			return fmt.Errorf("record batch '%s': %w", s.recordBatchPath(batchOffset), err)
+				firstRecord = false
+				runEnd += 1
+			}
+
+			// we read enough records to satisfy the request
+			if runEnd == recordIndex {
+				break
+			}
+
+			err = dst.records(rb, batchOffset, recordIndex, runEnd)
+			if err != nil {
+				rb.Close()
+				return fmt.Errorf("record batch '%s': %w", s.recordBatchPath(batchOffset), err)
+			}
+			recordIndex = runEnd
 		}
 
 		// no more relevant records in batch -> prepare to check next batch
@@ -278,104 +755,711 @@ func (s *Topic) ReadRecords(ctx context.Context, batch *sebrecords.Batch, offset
 		batchRecordIndex = 0
 	}
 
-	return nil
-}
-
-// NextOffset returns the topic's next offset (offset of the next record added).
-func (s *Topic) NextOffset() uint64 {
-	return s.nextOffset.Load()
-}
+	switch {
+	case !moreRecords():
+		batch.StopReason = sebrecords.StopReasonMaxRecords
+	case !moreBytes():
+		batch.StopReason = sebrecords.StopReasonMaxBytes
+	default:
+		batch.StopReason = sebrecords.StopReasonEnd
+	}
 
-type Metadata struct {
-	NextOffset     uint64
-	LatestCommitAt time.Time
+	return nil
 }
 
-// Metadata returns metadata about the topic
-func (s *Topic) Metadata() (Metadata, error) {
-	var latestCommitAt time.Time
-
-	nextOffset := s.nextOffset.Load()
-	if nextOffset > 0 {
-		recordBatchID := s.offsetGetRecordBatchID(nextOffset - 1)
-		p, err := s.parseRecordBatch(recordBatchID)
-		if err != nil {
-			return Metadata{}, fmt.Errorf("parsing record batch: %w", err)
-		}
-
-		latestCommitAt = time.UnixMicro(p.Header.UnixEpochUs)
+// DropExpiredBatches deletes the topic's oldest record batches, for as long as
+// all of their records have expired at now. It returns the number of record
+// batches that were deleted.
+//
+// The newest record batch is never deleted since it is required in order to
+// determine the topic's next offset when the topic is initialized.
+func (s *Topic) DropExpiredBatches(now time.Time) (int, error) {
+	err := s.checkWritable()
+	if err != nil {
+		return 0, err
 	}
 
-	return Metadata{
-		NextOffset:     nextOffset,
-		LatestCommitAt: latestCommitAt,
-	}, nil
-}
+	s.maintenanceMu.Lock()
+	defer s.maintenanceMu.Unlock()
 
-func (s *Topic) parseRecordBatch(recordBatchID uint64) (*sebrecords.Parser, error) {
-	recordBatchPath := s.recordBatchPath(recordBatchID)
+	ctx := sebcache.WithBudget(context.Background(), sebcache.BudgetMaintenance)
 
-	// NOTE: f is given to sebrecords.Parser, which will own it and be responsible
-	// for closing it.
-	f, err := s.cache.Reader(recordBatchPath)
+	err = s.loadRecordBatchOffsets(ctx)
 	if err != nil {
-		s.log.Infof("%s not found in cache", recordBatchPath)
+		return 0, fmt.Errorf("loading record batch offsets: %w", err)
 	}
 
-	if f == nil { // not found in cache
-		backingReader, err := s.backingStorage.Reader(recordBatchPath)
-		if err != nil {
-			return nil, fmt.Errorf("opening reader '%s': %w", recordBatchPath, err)
-		}
+	s.mu.Lock()
+	recordBatchOffsets := make([]uint64, len(s.recordBatchOffsets))
+	copy(recordBatchOffsets, s.recordBatchOffsets)
+	s.mu.Unlock()
 
-		r := backingReader
-		if s.compression != nil {
-			r, err = s.compression.NewReader(backingReader)
-			if err != nil {
-				return nil, fmt.Errorf("creating compression reader: %w", err)
-			}
-		}
+	nowUs := now.UnixMicro()
+	durableNextOffset := s.durableNextOffset()
 
-		// write to cache
-		cacheFile, err := s.cache.Writer(recordBatchPath)
-		if err != nil {
-			return nil, fmt.Errorf("writing backing storage result to cache: %w", err)
+	expiredBatches := 0
+	for _, batchOffset := range recordBatchOffsets[:max(len(recordBatchOffsets)-1, 0)] {
+		// NOTE: record batches waiting to be written behind must not be
+		// deleted before they've been written.
+		if batchOffset >= durableNextOffset {
+			break
 		}
-		_, err = io.Copy(cacheFile, r)
+
+		rb, err := s.parseRecordBatch(ctx, batchOffset)
 		if err != nil {
-			return nil, fmt.Errorf("copying backing storage result to cache: %w", err)
+			return 0, fmt.Errorf("parsing record batch: %w", err)
 		}
+		allExpired := rb.AllExpired(nowUs)
+		rb.Close()
 
-		if s.compression != nil {
-			r.Close()
+		if !allExpired {
+			break
 		}
+		expiredBatches += 1
+	}
 
-		err = cacheFile.Close()
-		if err != nil {
-			return nil, fmt.Errorf("closing cacheFile: %w", err)
-		}
+	if expiredBatches == 0 {
+		return 0, nil
+	}
+
+	// NOTE: record batches are only ever appended to s.recordBatchOffsets
+	// outside of maintenanceMu, so the expired batches are still the oldest
+	// ones.
+	s.mu.Lock()
+	s.recordBatchOffsets = s.recordBatchOffsets[expiredBatches:]
+	s.mu.Unlock()
 
-		err = backingReader.Close()
+	// NOTE: the offset index must not refer to deleted record batches, so it's
+	// updated before deleting them. If that fails, it's removed altogether.
+	if s.offsetIndexInterval > 0 {
+		err := s.writeOffsetIndex(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("closing backing reader: %w", err)
+			s.log.Errorf("writing offset index: %s", err)
+			err = s.deleteOffsetIndex()
+			if err != nil {
+				return 0, err
+			}
 		}
+	}
 
-		f, err = s.cache.Reader(recordBatchPath)
+	for _, batchOffset := range recordBatchOffsets[:expiredBatches] {
+		err := s.deleteRecordBatch(ctx, batchOffset)
 		if err != nil {
-			return nil, fmt.Errorf("reading from cache just after writing it: %w", err)
+			return 0, err
 		}
 	}
 
-	rb, err := sebrecords.Parse(f)
+	s.log.Infof("dropped %d expired record batches", expiredBatches)
+
+	return expiredBatches, nil
+}
+
+// Delete deletes all of the topic's record batches and large records from
+// backing storage and cache.
+//
+// Records that are added while Delete is running may or may not be deleted.
+func (s *Topic) Delete() error {
+	err := s.checkWritable()
 	if err != nil {
-		return nil, fmt.Errorf("parsing record batch '%s': %w", recordBatchPath, err)
+		return err
+	}
+
+	if s.writeBehind != nil {
+		s.writeBehind.stop()
+	}
+
+	ctx := context.Background()
+	err = s.loadRecordBatchOffsets(ctx)
+	if err != nil {
+		return fmt.Errorf("loading record batch offsets: %w", err)
 	}
-	return rb, nil
-}
 
-func (s *Topic) offsetGetRecordBatchID(offset uint64) uint64 {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	recordBatchOffsets := s.recordBatchOffsets
+	s.recordBatchOffsets = nil
+	s.mu.Unlock()
+
+	err = s.deleteManifest()
+	if err != nil {
+		return err
+	}
+
+	err = s.deleteOffsetIndex()
+	if err != nil {
+		return err
+	}
+
+	for _, batchOffset := range recordBatchOffsets {
+		err := s.deleteRecordBatch(ctx, batchOffset)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.log.Infof("deleted %d record batches", len(recordBatchOffsets))
+
+	return nil
+}
+
+// deleteRecordBatch deletes the record batch at batchOffset along with its
+// large records from backing storage and cache.
+func (s *Topic) deleteRecordBatch(ctx context.Context, batchOffset uint64) error {
+	recordBatchPath := s.recordBatchPath(batchOffset)
+
+	rb, err := s.parseRecordBatch(ctx, batchOffset)
+	if err != nil {
+		return fmt.Errorf("parsing record batch: %w", err)
+	}
+	err = s.deleteLargeRecords(rb)
+	rb.Close()
+	if err != nil {
+		return err
+	}
+
+	return s.deleteRecordBatchFile(recordBatchPath)
+}
+
+// deleteRecordBatchFile deletes the record batch file at recordBatchPath from
+// backing storage and cache, leaving its large records untouched.
+func (s *Topic) deleteRecordBatchFile(recordBatchPath string) error {
+	err := s.backingStorage.Delete(recordBatchPath)
+	if err != nil && !errors.Is(err, seberr.ErrNotInStorage) {
+		return fmt.Errorf("deleting record batch '%s': %w", recordBatchPath, err)
+	}
+	s.usage.remove(recordBatchPath)
+
+	if s.cache != nil {
+		err = s.cache.Remove(recordBatchPath)
+		if err != nil {
+			s.log.Errorf("removing '%s' from cache: %s", recordBatchPath, err)
+		}
+	}
+
+	return nil
+}
+
+// writeRecordBatch writes batch to backing storage at recordBatchPath as a
+// record batch committed at unixEpochUs.
+func (s *Topic) writeRecordBatch(ctx context.Context, recordBatchPath string, batch sebrecords.Batch, unixEpochUs int64) error {
+	storageWriter, err := s.backingStorage.Writer(ctx, recordBatchPath)
+	if err != nil {
+		return fmt.Errorf("opening writer '%s': %w", recordBatchPath, err)
+	}
+	backingWriter := &countingWriteCloser{WriteCloser: storageWriter}
+
+	var w io.WriteCloser = backingWriter
+	if s.compression != nil {
+		w, err = s.compression.NewWriter(backingWriter)
+		if err != nil {
+			return fmt.Errorf("creating compression writer: %w", err)
+		}
+	}
+
+	err = sebrecords.WriteAt(w, batch, unixEpochUs)
+	if err != nil {
+		return fmt.Errorf("writing record batch: %w", err)
+	}
+
+	if s.compression != nil {
+		err = w.Close()
+		if err != nil {
+			return fmt.Errorf("closing compression writer: %w", err)
+		}
+	}
+	// once Close() returns, the data has been committed and can be retrieved by
+	// ReadRecord.
+	err = backingWriter.Close()
+	if err != nil {
+		return fmt.Errorf("closing backing writer: %w", err)
+	}
+	s.usage.set(recordBatchPath, backingWriter.n)
+
+	return nil
+}
+
+// cacheRecordBatch writes batch to the cache at recordBatchPath as a record
+// batch committed at unixEpochUs. If this fails, recordBatchPath is removed
+// from the cache.
+func (s *Topic) cacheRecordBatch(ctx context.Context, recordBatchPath string, batch sebrecords.Batch, unixEpochUs int64) error {
+	cacheWtr, err := s.cache.Writer(ctx, recordBatchPath)
+	if err != nil {
+		return fmt.Errorf("creating cache writer (%s): %w", recordBatchPath, err)
+	}
+
+	err = sebrecords.WriteAt(cacheWtr, batch, unixEpochUs)
+	if err != nil {
+		cacheWtr.Close()
+		removeErr := s.cache.Remove(recordBatchPath)
+		return errors.Join(fmt.Errorf("writing to cache (%s): %w", recordBatchPath, err), removeErr)
+	}
+
+	err = cacheWtr.Close()
+	if err != nil {
+		return fmt.Errorf("closing cached file (%s): %w", recordBatchPath, err)
+	}
+
+	return nil
+}
+
+// NextOffset returns the topic's next offset (offset of the next record added).
+func (s *Topic) NextOffset() uint64 {
+	return s.nextOffset.Load()
+}
+
+type Metadata struct {
+	NextOffset     uint64
+	LatestCommitAt time.Time
+
+	// LatestProducedAt is the time at which the records of the latest record
+	// batch were produced, as given by producers. It's the zero time.Time if
+	// unknown.
+	LatestProducedAt time.Time
+
+	// ClockDrift is how far the commit time of the latest record batch is
+	// ahead of the wall clock. Commit times never go backwards, so it's only
+	// positive after the wall clock has gone backwards, until it catches up.
+	ClockDrift time.Duration
+
+	// StorageUsage is the number of bytes and files that the topic uses in
+	// backing storage, and CacheUsage is the number of bytes and items that
+	// it takes up in the cache.
+	StorageUsage StorageUsage
+	CacheUsage   sebcache.TopicUsage
+
+	// Sealed is true if the topic has been permanently closed for writes, in
+	// which case NextOffset is its final next offset. See Topic.Seal.
+	Sealed bool
+}
+
+// Metadata returns metadata about the topic
+func (s *Topic) Metadata() (Metadata, error) {
+	var latestCommitAt, latestProducedAt time.Time
+
+	nextOffset := s.nextOffset.Load()
+	if nextOffset > 0 {
+		recordBatchID := s.offsetGetRecordBatchID(nextOffset - 1)
+		p, err := s.parseRecordBatch(context.Background(), recordBatchID)
+		if err != nil {
+			return Metadata{}, fmt.Errorf("parsing record batch: %w", err)
+		}
+		defer p.Close()
+
+		latestCommitAt = time.UnixMicro(p.Header.UnixEpochUs)
+		latestProducedAt = unixMicroOrZero(p.Header.ProducedUnixEpochUs)
+	}
+
+	return Metadata{
+		NextOffset:       nextOffset,
+		LatestCommitAt:   latestCommitAt,
+		LatestProducedAt: latestProducedAt,
+		ClockDrift:       s.clock.drift(),
+		StorageUsage:     s.StorageUsage(),
+		CacheUsage:       s.CacheUsage(),
+		Sealed:           s.sealed.Load(),
+	}, nil
+}
+
+// CacheUsage returns the number of bytes and items that the topic takes up in
+// the cache.
+func (s *Topic) CacheUsage() sebcache.TopicUsage {
+	if s.cache == nil {
+		return sebcache.TopicUsage{}
+	}
+	return s.cache.TopicUsage(s.topicName)
+}
+
+// BatchInfo describes the record batch that holds a given offset.
+type BatchInfo struct {
+	BaseOffset uint64
+	NumRecords uint64
+
+	// CommittedAt is the time at which the record batch was committed by the
+	// broker.
+	CommittedAt time.Time
+
+	// ProducedAt is the time at which the oldest records of the record batch
+	// were produced, as given by producers. It's the zero time.Time if
+	// unknown.
+	ProducedAt time.Time
+}
+
+// BatchInfo returns information about the record batch that holds offset.
+// seberr.ErrOutOfBounds is returned if offset does not exist, or has been
+// dropped because it expired.
+func (s *Topic) BatchInfo(ctx context.Context, offset uint64) (BatchInfo, error) {
+	nextOffset := s.nextOffset.Load()
+	if offset >= nextOffset {
+		return BatchInfo{}, fmt.Errorf("offset %d does not exist: %w", offset, seberr.ErrOutOfBounds)
+	}
+
+	err := s.loadRecordBatchOffsetsFor(ctx, offset)
+	if err != nil {
+		return BatchInfo{}, fmt.Errorf("loading record batch offsets: %w", err)
+	}
+
+	s.mu.Lock()
+	i, found := slices.BinarySearch(s.recordBatchOffsets, offset)
+	if !found {
+		i--
+	}
+	if i < 0 {
+		s.mu.Unlock()
+		return BatchInfo{}, fmt.Errorf("offset %d has been dropped: %w", offset, seberr.ErrOutOfBounds)
+	}
+	baseOffset, endOffset := s.recordBatchOffsets[i], nextOffset
+	if i+1 < len(s.recordBatchOffsets) {
+		endOffset = s.recordBatchOffsets[i+1]
+	}
+	s.mu.Unlock()
+
+	rb, err := s.parseRecordBatch(ctx, baseOffset)
+	if err != nil {
+		return BatchInfo{}, fmt.Errorf("parsing record batch: %w", err)
+	}
+	defer rb.Close()
+
+	return BatchInfo{
+		BaseOffset:  baseOffset,
+		NumRecords:  endOffset - baseOffset,
+		CommittedAt: time.UnixMicro(rb.Header.UnixEpochUs),
+		ProducedAt:  unixMicroOrZero(rb.Header.ProducedUnixEpochUs),
+	}, nil
+}
+
+// FirstOffset returns the offset of the oldest record that hasn't been
+// dropped, or NextOffset() if the topic holds no records.
+func (s *Topic) FirstOffset(ctx context.Context) (uint64, error) {
+	err := s.loadRecordBatchOffsets(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("loading record batch offsets: %w", err)
+	}
+
+	nextOffset := s.nextOffset.Load()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.recordBatchOffsets) == 0 {
+		return nextOffset, nil
+	}
+	return s.recordBatchOffsets[0], nil
+}
+
+// OffsetAt returns the offset of the first record committed at or after t, or
+// NextOffset() if no records have been committed since t. Records share the
+// commit time of their record batch, so the returned offset is always the
+// base offset of a record batch.
+func (s *Topic) OffsetAt(ctx context.Context, t time.Time) (uint64, error) {
+	err := s.loadRecordBatchOffsets(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("loading record batch offsets: %w", err)
+	}
+
+	// NOTE: nextOffset must be read before recordBatchOffsets in order to
+	// guarantee that nextOffset is never smaller than the last batch offset.
+	nextOffset := s.nextOffset.Load()
+
+	s.mu.Lock()
+	recordBatchOffsets := make([]uint64, len(s.recordBatchOffsets))
+	copy(recordBatchOffsets, s.recordBatchOffsets)
+	s.mu.Unlock()
+
+	// record batches are committed in order, so their commit times are
+	// sorted.
+	tUs := t.UnixMicro()
+	var parseErr error
+	batchIndex := sort.Search(len(recordBatchOffsets), func(i int) bool {
+		if parseErr != nil {
+			return true
+		}
+
+		rb, err := s.parseRecordBatch(ctx, recordBatchOffsets[i])
+		if err != nil {
+			parseErr = err
+			return true
+		}
+		defer rb.Close()
+
+		return rb.Header.UnixEpochUs >= tUs
+	})
+	if parseErr != nil {
+		return 0, fmt.Errorf("parsing record batch: %w", parseErr)
+	}
+
+	if batchIndex == len(recordBatchOffsets) {
+		return nextOffset, nil
+	}
+	return recordBatchOffsets[batchIndex], nil
+}
+
+// unixMicroOrZero returns the time.Time of unixEpochUs, or the zero time.Time
+// if unixEpochUs is 0.
+func unixMicroOrZero(unixEpochUs int64) time.Time {
+	if unixEpochUs == 0 {
+		return time.Time{}
+	}
+	return time.UnixMicro(unixEpochUs)
+}
+
+// Segment describes a single record batch file in the topic's backing storage.
+type Segment struct {
+	BaseOffset uint64
+	NumRecords uint64
+	Size       int64
+	Path       string
+
+	// Traces holds the traces of the segment's records, relative to
+	// BaseOffset. It's only set by SegmentsWithTraces.
+	Traces []sebrecords.Trace
+}
+
+// Segments returns the record batch files that make up the topic, ordered by
+// BaseOffset. Path is the location of the file in backing storage, making it
+// possible for external tools to read record batches directly from backing
+// storage.
+func (s *Topic) Segments() ([]Segment, error) {
+	ctx := context.Background()
+	err := s.loadRecordBatchOffsets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading record batch offsets: %w", err)
+	}
+
+	// NOTE: nextOffset must be read before recordBatchOffsets in order to
+	// guarantee that nextOffset is never smaller than the end of the last
+	// segment.
+	nextOffset := s.nextOffset.Load()
+
+	s.mu.Lock()
+	recordBatchOffsets := make([]uint64, len(s.recordBatchOffsets))
+	copy(recordBatchOffsets, s.recordBatchOffsets)
+	s.mu.Unlock()
+
+	// NOTE: storages differ in whether File.Path is absolute, so files are
+	// keyed by their path relative to the topic.
+	keyFiles := make(map[string]File, len(recordBatchOffsets))
+	err = walkFiles(ctx, s.backingStorage, s.topicName, recordBatchExtension, func(file File) error {
+		keyFiles[path.Join(s.topicName, path.Base(file.Path))] = file
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing files: %w", err)
+	}
+
+	segments := make([]Segment, 0, len(recordBatchOffsets))
+	for i, batchOffset := range recordBatchOffsets {
+		endOffset := nextOffset
+		if i+1 < len(recordBatchOffsets) {
+			endOffset = recordBatchOffsets[i+1]
+		}
+
+		// record batch was added after nextOffset was read
+		if batchOffset >= endOffset {
+			break
+		}
+
+		key := s.recordBatchPath(batchOffset)
+		file, ok := keyFiles[key]
+		if !ok {
+			return nil, fmt.Errorf("record batch '%s': %w", key, seberr.ErrNotInStorage)
+		}
+
+		segments = append(segments, Segment{
+			BaseOffset: batchOffset,
+			NumRecords: endOffset - batchOffset,
+			Size:       file.Size,
+			Path:       file.Path,
+		})
+	}
+
+	return segments, nil
+}
+
+// SegmentsWithTraces returns the same as Segments, but with the traces of each
+// segment. This requires reading each record batch.
+func (s *Topic) SegmentsWithTraces(ctx context.Context) ([]Segment, error) {
+	segments, err := s.Segments()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, segment := range segments {
+		rb, err := s.parseRecordBatch(ctx, segment.BaseOffset)
+		if err != nil {
+			return nil, fmt.Errorf("parsing record batch: %w", err)
+		}
+
+		// NOTE: the record batch may overlap the record batches following it
+		// if a merge was interrupted.
+		segments[i].Traces = sebrecords.ClampTraces(rb.Traces, uint32(segment.NumRecords))
+		rb.Close()
+	}
+
+	return segments, nil
+}
+
+// parseRecordBatch returns a parser for the record batch at recordBatchID,
+// reading it from backing storage into the cache if it's not already cached.
+// Cancelling ctx aborts reading from backing storage.
+func (s *Topic) parseRecordBatch(ctx context.Context, recordBatchID uint64) (*sebrecords.Parser, error) {
+	return s.parseRecordBatchName(ctx, s.epochs.name(recordBatchID))
+}
+
+// parseRecordBatchName is like parseRecordBatch, but reads the record batch
+// with the given name. This allows reading record batches whose epoch isn't
+// known to the topic yet.
+func (s *Topic) parseRecordBatchName(ctx context.Context, name RecordBatchName) (*sebrecords.Parser, error) {
+	recordBatchID := name.ID
+	recordBatchPath := name.Key(s.topicName)
+
+	// the record batch will be in the cache once it's been prefetched
+	s.waitPrefetch(ctx, recordBatchID)
+
+	// NOTE: f is given to sebrecords.Parser, which will own it and be responsible
+	// for closing it.
+	f, err := s.cache.Reader(ctx, recordBatchPath)
+	if err != nil {
+		s.log.Infof("%s not found in cache", recordBatchPath)
+	}
+
+	if f == nil { // not found in cache
+		err = s.fetchRecordBatchName(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		f, err = s.cache.Reader(ctx, recordBatchPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading from cache just after writing it: %w", err)
+		}
+	}
+
+	rb, err := sebrecords.Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("parsing record batch '%s': %w", recordBatchPath, err)
+	}
+	return rb, nil
+}
+
+// fetchRecordBatch reads the record batch at recordBatchID from backing
+// storage into the cache. The cache is told how many record batches follow it,
+// so that it can choose to only admit the topic's most recent record batches.
+func (s *Topic) fetchRecordBatch(ctx context.Context, recordBatchID uint64) error {
+	return s.fetchRecordBatchName(ctx, s.epochs.name(recordBatchID))
+}
+
+func (s *Topic) fetchRecordBatchName(ctx context.Context, name RecordBatchName) error {
+	recordBatchID := name.ID
+	recordBatchPath := name.Key(s.topicName)
+	ctx = sebcache.WithTailDistance(ctx, s.tailDistance(recordBatchID))
+
+	// NOTE: record batches waiting to be written behind aren't in backing
+	// storage yet, but may have been evicted from the cache.
+	pending, err := s.recachePending(ctx, name)
+	if pending {
+		return err
+	}
+
+	backingReader, err := s.backingStorage.Reader(ctx, recordBatchPath)
+	if err != nil {
+		err = quarantinedErr(ctx, s.backingStorage, recordBatchPath, err)
+		return fmt.Errorf("opening reader '%s': %w", recordBatchPath, err)
+	}
+
+	r := backingReader
+	if s.compression != nil {
+		r, err = s.compression.NewReader(backingReader)
+		if err != nil {
+			backingReader.Close()
+			return fmt.Errorf("creating compression reader: %w", err)
+		}
+	}
+
+	// write to cache
+	cacheFile, err := s.cache.Writer(ctx, recordBatchPath)
+	if err != nil {
+		backingReader.Close()
+		return fmt.Errorf("writing backing storage result to cache: %w", err)
+	}
+	_, err = io.Copy(cacheFile, r)
+	if err != nil {
+		// NOTE: the partially written record batch must not be read
+		// from cache later.
+		backingReader.Close()
+		removeErr := s.cache.Remove(recordBatchPath)
+		if removeErr != nil {
+			s.log.Errorf("removing partial '%s' from cache: %s", recordBatchPath, removeErr)
+		}
+		return fmt.Errorf("copying backing storage result to cache: %w", err)
+	}
+
+	if s.compression != nil {
+		r.Close()
+	}
+
+	err = cacheFile.Close()
+	if err != nil {
+		return fmt.Errorf("closing cacheFile: %w", err)
+	}
+
+	err = backingReader.Close()
+	if err != nil {
+		return fmt.Errorf("closing backing reader: %w", err)
+	}
+
+	return nil
+}
+
+// tailDistance returns the number of record batches following the one at
+// recordBatchID.
+func (s *Topic) tailDistance(recordBatchID uint64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, found := slices.BinarySearch(s.recordBatchOffsets, recordBatchID)
+	if found {
+		i += 1
+	}
+	return len(s.recordBatchOffsets) - i
+}
+
+// parseRecordBatchRange returns a parser for the record batch at
+// recordBatchID. If the record batch isn't cached, it's read from backing
+// storage using ranged reads, such that only the parts of it that are used are
+// read. The record batch is not cached in this case.
+//
+// Ranged reads require backing storage that implements RangeReader, and
+// uncompressed record batches. If this isn't the case, parseRecordBatch is
+// used instead.
+func (s *Topic) parseRecordBatchRange(ctx context.Context, recordBatchID uint64) (*sebrecords.Parser, error) {
+	rangeReader, ok := s.backingStorage.(RangeReader)
+	if !ok || s.compression != nil || recordBatchID >= s.durableNextOffset() {
+		return s.parseRecordBatch(ctx, recordBatchID)
+	}
+
+	recordBatchPath := s.recordBatchPath(recordBatchID)
+
+	// NOTE: f is given to sebrecords.Parser, which will own it and be responsible
+	// for closing it.
+	var f io.ReadSeekCloser
+	f, err := s.cache.Reader(ctx, recordBatchPath)
+	if err != nil {
+		f, err = newRangeReadSeeker(ctx, rangeReader, recordBatchPath)
+		if err != nil {
+			err = quarantinedErr(ctx, s.backingStorage, recordBatchPath, err)
+			return nil, fmt.Errorf("opening range reader '%s': %w", recordBatchPath, err)
+		}
+	}
+
+	rb, err := sebrecords.Parse(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("parsing record batch '%s': %w", recordBatchPath, err)
+	}
+	return rb, nil
+}
+
+func (s *Topic) offsetGetRecordBatchID(offset uint64) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	for i := len(s.recordBatchOffsets) - 1; i >= 0; i-- {
 		curBatchID := s.recordBatchOffsets[i]
@@ -388,40 +1472,101 @@ func (s *Topic) offsetGetRecordBatchID(offset uint64) uint64 {
 }
 
 func (s *Topic) recordBatchPath(recordBatchID uint64) string {
-	return RecordBatchKey(s.topicName, recordBatchID)
+	return s.epochs.key(s.topicName, recordBatchID)
 }
 
-const recordBatchExtension = ".record_batch"
+// newRecordBatchPath returns the path of the record batch at recordBatchID
+// that is about to be added, named with the topic's epoch. If adding it fails,
+// s.epochs.removeFrom(recordBatchID) must be called.
+func (s *Topic) newRecordBatchPath(recordBatchID uint64) string {
+	name := RecordBatchName{ID: recordBatchID, Epoch: s.epoch}
+	s.epochs.add(name)
+	return name.Key(s.topicName)
+}
 
-func listRecordBatchOffsets(backingStorage Storage, topicName string) ([]uint64, error) {
-	files, err := backingStorage.ListFiles(topicName, recordBatchExtension)
-	if err != nil {
-		return nil, fmt.Errorf("listing files: %w", err)
-	}
+// RecordBatchKey returns the storage key of the topic's record batch at
+// recordBatchID, including its epoch. For topics opened from their manifest,
+// epochs of record batches older than the newest one are only known once the
+// topic's record batch offsets have been loaded.
+func (s *Topic) RecordBatchKey(recordBatchID uint64) string {
+	return s.recordBatchPath(recordBatchID)
+}
 
-	offsets := make([]uint64, 0, len(files))
-	for _, file := range files {
-		fileName := path.Base(file.Path)
-		offsetStr := fileName[:len(fileName)-len(recordBatchExtension)]
+const recordBatchExtension = ".record_batch"
 
-		offset, err := uint64y.FromString(offsetStr)
+// listRecordBatchOffsets returns the offsets and epochs of the record batches
+// of topicName in storage. Stale record batches are left out; see
+// RecordBatchName.
+func listRecordBatchOffsets(ctx context.Context, backingStorage Storage, topicName string) ([]uint64, *recordBatchEpochs, error) {
+	names := make([]RecordBatchName, 0, 128)
+	err := walkFiles(ctx, backingStorage, topicName, recordBatchExtension, func(file File) error {
+		name, err := ParseRecordBatchName(file.Path)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		offsets = append(offsets, offset)
+		names = append(names, name)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("listing files: %w", err)
 	}
 
-	sort.Slice(offsets, func(i, j int) bool {
-		return offsets[i] < offsets[j]
-	})
+	names, _ = dropStaleRecordBatches(names, 0)
 
-	return offsets, nil
+	offsets := make([]uint64, len(names))
+	for i, name := range names {
+		offsets[i] = name.ID
+	}
+
+	return offsets, newRecordBatchEpochs(names), nil
 }
 
-// RecordBatchKey returns the symbolic path of the topicName and the recordBatchID.
+// RecordBatchKey returns the symbolic path of the topicName and the
+// recordBatchID, for record batches of epoch 0.
 func RecordBatchKey(topicName string, recordBatchID uint64) string {
-	return filepath.Join(topicName, fmt.Sprintf("%012d%s", recordBatchID, recordBatchExtension))
+	return RecordBatchName{ID: recordBatchID}.Key(topicName)
+}
+
+// ParseRecordBatchKey returns the topic name and record batch name of key, the
+// inverse of RecordBatchName.Key. seberr.ErrBadInput is returned if key isn't
+// the key of a record batch.
+func ParseRecordBatchKey(key string) (string, RecordBatchName, error) {
+	topicName, fileName := path.Split(key)
+	topicName = strings.TrimSuffix(topicName, "/")
+	if topicName == "" {
+		return "", RecordBatchName{}, fmt.Errorf("%w: '%s' is not a record batch key", seberr.ErrBadInput, key)
+	}
+
+	name, err := ParseRecordBatchName(fileName)
+	if err != nil {
+		return "", RecordBatchName{}, err
+	}
+
+	return topicName, name, nil
+}
+
+// WithWriteBehind makes the topic add record batches once they've been written
+// to the cache, and write them to backing storage in the background, in the
+// order they were added. This lowers the latency of adding records at the
+// cost of durability: record batches that haven't been written when the
+// broker stops are lost.
+//
+// At most queueSize record batches wait to be written at a time; adding record
+// batches blocks while the queue is full. Failed writes are retried until they
+// succeed. The topic's manifest and offset index only include record batches
+// that have been written.
+//
+// Large records are still written to backing storage before their record
+// batch is added. Write-behind requires a cache, and is disabled if queueSize
+// is 0.
+func WithWriteBehind(queueSize int, retryInterval time.Duration) func(*Opts) {
+	return func(o *Opts) {
+		o.WriteBehind = WriteBehindOpts{
+			QueueSize:     queueSize,
+			RetryInterval: retryInterval,
+		}
+	}
 }
 
 func WithCompress(c Compress) func(*Opts) {
@@ -429,3 +1574,75 @@ func WithCompress(c Compress) func(*Opts) {
 		o.Compression = c
 	}
 }
+
+// WithOffsetIndexInterval sets the number of record batches to add between
+// writing the topic's offset index. 0 disables the offset index.
+func WithOffsetIndexInterval(batches int) func(*Opts) {
+	return func(o *Opts) {
+		o.OffsetIndexInterval = batches
+	}
+}
+
+// WithManifest enables the topic's manifest, which allows opening the topic
+// without listing its record batches.
+func WithManifest(enabled bool) func(*Opts) {
+	return func(o *Opts) {
+		o.Manifest = enabled
+	}
+}
+
+// WithPrefetchBatches sets the number of record batches following the one
+// being read to prefetch into the cache. 0 disables prefetching.
+func WithPrefetchBatches(batches int) func(*Opts) {
+	return func(o *Opts) {
+		o.PrefetchBatches = batches
+	}
+}
+
+// WithEpoch makes the topic name the record batches it adds with epoch. The
+// topic can't be opened for writing if it has record batches of a newer
+// epoch. See RecordBatchName.
+func WithEpoch(epoch uint64) func(*Opts) {
+	return func(o *Opts) {
+		o.Epoch = epoch
+	}
+}
+
+// WithLease makes the topic acquire a lease when it's opened, which it must
+// hold in order to add record batches, such that brokers sharing the same
+// storage never write to the topic at the same time. The lease is held for ttl
+// and must be renewed using Topic.RenewLease. If the lease is lost, writes are
+// rejected with an error wrapping seberr.ErrLeaseLost.
+//
+// Record batches are named with the epoch of the lease, which is incremented
+// each time the lease changes holder; an epoch given by WithEpoch is the
+// lowest epoch that the lease is acquired with. Read-only topics don't
+// acquire leases.
+func WithLease(holder string, ttl time.Duration) func(*Opts) {
+	return func(o *Opts) {
+		o.Lease = LeaseOpts{Holder: holder, TTL: ttl}
+	}
+}
+
+// WithReadOnly makes the topic reject writes with seberr.ErrWritesFrozen, and
+// never write to backing storage.
+func WithReadOnly(readOnly bool) func(*Opts) {
+	return func(o *Opts) {
+		o.ReadOnly = readOnly
+	}
+}
+
+// checkWritable returns an error wrapping seberr.ErrWritesFrozen if the topic
+// is read-only or doesn't hold its lease.
+func (s *Topic) checkWritable() error {
+	if s.readOnly {
+		return fmt.Errorf("%w: topic '%s' is read-only", seberr.ErrWritesFrozen, s.topicName)
+	}
+	return s.checkLease()
+}
+
+func WithLargeRecordThreshold(bytes int) func(*Opts) {
+	return func(o *Opts) {
+		o.LargeRecordThreshold = bytes
+	}
+}
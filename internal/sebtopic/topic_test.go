@@ -4,13 +4,15 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"slices"
+	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/micvbang/go-helpy/inty"
 	"github.com/micvbang/go-helpy/sizey"
 	"github.com/micvbang/go-helpy/slicey"
-	"github.com/micvbang/go-helpy/timey"
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
 	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
 	"github.com/micvbang/simple-event-broker/internal/sebcache"
@@ -79,10 +81,13 @@ func TestStorageWriteRecordsBackingStorageWriteFails(t *testing.T) {
 		expectedErr := fmt.Errorf("failed to write to file")
 
 		backingStorage := &tester.MockTopicStorage{}
-		backingStorage.ListFilesMock = func(topicName, extension string) ([]sebtopic.File, error) {
+		backingStorage.ListFilesMock = func(_ context.Context, topicName, extension string) ([]sebtopic.File, error) {
 			return nil, nil
 		}
-		backingStorage.WriterMock = func(recordBatchPath string) (io.WriteCloser, error) {
+		backingStorage.ReaderMock = func(_ context.Context, key string) (io.ReadCloser, error) {
+			return nil, seberr.ErrNotInStorage
+		}
+		backingStorage.WriterMock = func(_ context.Context, recordBatchPath string) (io.WriteCloser, error) {
 			return &tester.MockWriteCloser{
 				WriteMock: func(p []byte) (n int, err error) {
 					return 0, expectedErr
@@ -93,7 +98,7 @@ func TestStorageWriteRecordsBackingStorageWriteFails(t *testing.T) {
 		cache, err := sebcache.New(log, cacheStorage)
 		require.NoError(t, err)
 
-		s, err := sebtopic.New(log, backingStorage, "mytopic", cache, sebtopic.WithCompress(nil))
+		s, err := sebtopic.New(log, backingStorage, "mytopic", cache, sebtopic.WithCompress(nil), sebtopic.WithOffsetIndexInterval(0))
 		require.NoError(t, err)
 
 		batch := tester.MakeRandomRecordBatch(5)
@@ -114,10 +119,13 @@ func TestStorageWriteRecordsBackingStorageCloseFails(t *testing.T) {
 		expectedErr := fmt.Errorf("failed to close file")
 
 		backingStorage := &tester.MockTopicStorage{}
-		backingStorage.ListFilesMock = func(topicName, extension string) ([]sebtopic.File, error) {
+		backingStorage.ListFilesMock = func(_ context.Context, topicName, extension string) ([]sebtopic.File, error) {
 			return nil, nil
 		}
-		backingStorage.WriterMock = func(recordBatchPath string) (io.WriteCloser, error) {
+		backingStorage.ReaderMock = func(_ context.Context, key string) (io.ReadCloser, error) {
+			return nil, seberr.ErrNotInStorage
+		}
+		backingStorage.WriterMock = func(_ context.Context, recordBatchPath string) (io.WriteCloser, error) {
 			return &tester.MockWriteCloser{
 				WriteMock: func(p []byte) (n int, err error) {
 					return len(p), nil
@@ -131,7 +139,7 @@ func TestStorageWriteRecordsBackingStorageCloseFails(t *testing.T) {
 		cache, err := sebcache.New(log, cacheStorage)
 		require.NoError(t, err)
 
-		s, err := sebtopic.New(log, backingStorage, "mytopic", cache, sebtopic.WithCompress(nil))
+		s, err := sebtopic.New(log, backingStorage, "mytopic", cache, sebtopic.WithCompress(nil), sebtopic.WithOffsetIndexInterval(0))
 		require.NoError(t, err)
 
 		batch := tester.MakeRandomRecordBatch(5)
@@ -184,6 +192,46 @@ func TestStorageWriteRecordBatchMultipleBatches(t *testing.T) {
 	})
 }
 
+// TestStorageWriteVisibleWhenClosed verifies that data written to backing
+// storage only replaces existing data at the key once the writer is closed,
+// such that readers never see partially written data.
+func TestStorageWriteVisibleWhenClosed(t *testing.T) {
+	tester.TestBackingStorage(t, func(t *testing.T, storage sebtopic.Storage) {
+		const key = "topic/some-key.record_batch"
+		ctx := context.Background()
+
+		oldBytes := tester.RandomBytes(t, 64)
+		wtr, err := storage.Writer(ctx, key)
+		require.NoError(t, err)
+		tester.WriteAndClose(t, wtr, oldBytes)
+
+		newBytes := tester.RandomBytes(t, 128)
+
+		// Act
+		wtr, err = storage.Writer(ctx, key)
+		require.NoError(t, err)
+		_, err = wtr.Write(newBytes[:64])
+		require.NoError(t, err)
+
+		// Assert
+		rdr, err := storage.Reader(ctx, key)
+		require.NoError(t, err)
+		require.Equal(t, oldBytes, tester.ReadAndClose(t, rdr))
+
+		files, err := storage.ListFiles(ctx, "topic", ".record_batch")
+		require.NoError(t, err)
+		require.Equal(t, 1, len(files))
+
+		_, err = wtr.Write(newBytes[64:])
+		require.NoError(t, err)
+		require.NoError(t, wtr.Close())
+
+		rdr, err = storage.Reader(ctx, key)
+		require.NoError(t, err)
+		require.Equal(t, newBytes, tester.ReadAndClose(t, rdr))
+	})
+}
+
 // TestStorageOpenExistingStorage verifies that storage.Storage correctly
 // initializes from a topic that already exists and has many data files.
 func TestStorageOpenExistingStorage(t *testing.T) {
@@ -229,6 +277,7 @@ func TestStorageOpenExistingStorage(t *testing.T) {
 			gotBatch := tester.NewBatch(batch.Len(), 4096)
 			err := s2.ReadRecords(context.Background(), &gotBatch, offset, batch.Len(), 0)
 			require.NoError(t, err)
+			batch.StopReason = sebrecords.StopReasonMaxRecords
 			require.Equal(t, batch, gotBatch)
 			offset += uint64(batch.Len())
 		}
@@ -307,10 +356,10 @@ func TestStorageCacheWrite(t *testing.T) {
 		// Assert
 
 		// record batch must be written to both backing storage and cache.
-		_, err = cache.Reader(batchKey)
+		_, err = cache.Reader(context.Background(), batchKey)
 		require.NoError(t, err)
 
-		_, err = backingStorage.Reader(batchKey)
+		_, err = backingStorage.Reader(context.Background(), batchKey)
 		require.NoError(t, err)
 
 		gotBatch := tester.NewBatch(numRecords, 4096)
@@ -339,13 +388,14 @@ func TestStorageCacheReadFromCache(t *testing.T) {
 		// NOTE: in order to prove that we're reading from the cache and not
 		// from the backing storage, we're truncating the file in the backing
 		// storage to zero bytes.
-		wtr, err := backingStorage.Writer(sebtopic.RecordBatchKey(topicName, 0))
+		wtr, err := backingStorage.Writer(context.Background(), sebtopic.RecordBatchKey(topicName, 0))
 		require.NoError(t, err)
 		tester.WriteAndClose(t, wtr, []byte{})
 
 		gotBatch := tester.NewBatch(numRecords, 4096)
 		err = s.ReadRecords(context.Background(), &gotBatch, offsets[0], 0, 0)
 		require.NoError(t, err)
+		batch.StopReason = sebrecords.StopReasonEnd
 		require.Equal(t, batch, gotBatch)
 	})
 }
@@ -381,6 +431,48 @@ func TestStorageCacheReadFileNotInCache(t *testing.T) {
 	})
 }
 
+// TestStorageCacheTailBatches verifies that only the most recent record
+// batches are admitted to the cache when they're read from backing storage,
+// and that older record batches are still readable.
+func TestStorageCacheTailBatches(t *testing.T) {
+	tester.TestBackingStorage(t, func(t *testing.T, backingStorage sebtopic.Storage) {
+		const topicName = "my_topic"
+
+		cache, err := sebcache.New(log, sebcache.NewMemoryStorage(log), sebcache.WithTailItems(1))
+		require.NoError(t, err)
+
+		s, err := sebtopic.New(log, backingStorage, topicName, cache)
+		require.NoError(t, err)
+
+		batches := make([]sebrecords.Batch, 3)
+		for i := range batches {
+			batches[i] = tester.MakeRandomRecordBatch(2)
+			_, err = s.AddRecords(batches[i])
+			require.NoError(t, err)
+
+			err = cache.Remove(sebtopic.RecordBatchKey(topicName, uint64(i*2)))
+			require.NoError(t, err)
+		}
+
+		for i, batch := range batches {
+			// Act
+			gotBatch := tester.NewBatch(batch.Len(), 4096)
+			err = s.ReadRecords(context.Background(), &gotBatch, uint64(i*2), batch.Len(), 0)
+
+			// Assert
+			require.NoError(t, err)
+			require.Equal(t, batch.Data, gotBatch.Data)
+		}
+
+		err = cache.EvictTransient()
+		require.NoError(t, err)
+
+		require.False(t, cache.Contains(sebtopic.RecordBatchKey(topicName, 0)))
+		require.False(t, cache.Contains(sebtopic.RecordBatchKey(topicName, 2)))
+		require.True(t, cache.Contains(sebtopic.RecordBatchKey(topicName, 4)))
+	})
+}
+
 // TestStorageCompressFiles verifies that Topic uses the given Compress to
 // seemlessly compresses and decompresses files when they're written to the
 // backing storage.
@@ -397,7 +489,7 @@ func TestStorageCompressFiles(t *testing.T) {
 		require.NoError(t, err)
 		tester.RequireOffsets(t, 0, numRecords, offsets)
 
-		backingStorageReader, err := backingStorage.Reader(sebtopic.RecordBatchKey(topicName, 0))
+		backingStorageReader, err := backingStorage.Reader(context.Background(), sebtopic.RecordBatchKey(topicName, 0))
 		require.NoError(t, err)
 
 		// read records directly from compressor in order to prove that they're compressed
@@ -617,6 +709,248 @@ func TestTopicReadRecords(t *testing.T) {
 	})
 }
 
+// TestTopicReadRecordsSkipsExpired verifies that ReadRecords() skips expired
+// records, counts them in batch.Skipped, and does not count them towards
+// maxRecords.
+func TestTopicReadRecordsSkipsExpired(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		topic, err := sebtopic.New(log, storage, "topic", cache)
+		require.NoError(t, err)
+
+		var (
+			expired = time.Now().Add(-time.Hour).UnixMicro()
+			future  = time.Now().Add(time.Hour).UnixMicro()
+		)
+
+		batch := tester.MakeRandomRecordBatch(6)
+		batch.Expires = []int64{expired, 0, expired, expired, future, 0}
+		records := batch.IndividualRecords()
+
+		_, err = topic.AddRecords(batch)
+		require.NoError(t, err)
+
+		tests := map[string]struct {
+			offset          uint64
+			maxRecords      int
+			expectedRecords [][]byte
+			expectedSkipped int
+		}{
+			"all":                   {offset: 0, maxRecords: 10, expectedRecords: [][]byte{records[1], records[4], records[5]}, expectedSkipped: 3},
+			"first unexpired":       {offset: 0, maxRecords: 1, expectedRecords: [][]byte{records[1]}, expectedSkipped: 1},
+			"skip middle":           {offset: 1, maxRecords: 2, expectedRecords: [][]byte{records[1], records[4]}, expectedSkipped: 2},
+			"starting on unexpired": {offset: 4, maxRecords: 10, expectedRecords: [][]byte{records[4], records[5]}, expectedSkipped: 0},
+		}
+
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				gotBatch := tester.NewBatch(10, 4096)
+
+				// Act
+				err := topic.ReadRecords(context.Background(), &gotBatch, test.offset, test.maxRecords, 0)
+				require.NoError(t, err)
+
+				// Assert
+				require.Equal(t, test.expectedRecords, gotBatch.IndividualRecords())
+				require.Equal(t, test.expectedSkipped, gotBatch.Skipped)
+			})
+		}
+	})
+}
+
+// TestTopicReadRecordsRange verifies that ReadRecordsRange() returns exactly
+// the records in the given range, across record batches, that skipped records
+// don't cause records beyond the range to be returned, and that invalid ranges
+// are rejected.
+func TestTopicReadRecordsRange(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		topic, err := sebtopic.New(log, storage, "topic", cache)
+		require.NoError(t, err)
+
+		expired := time.Now().Add(-time.Hour).UnixMicro()
+
+		records := [][]byte{}
+		for range 3 {
+			batch := tester.MakeRandomRecordBatchSize(5, 10)
+			batch.Expires = []int64{0, 0, expired, 0, 0}
+			_, err := topic.AddRecords(batch)
+			require.NoError(t, err)
+
+			records = append(records, batch.IndividualRecords()...)
+		}
+
+		tests := map[string]struct {
+			startOffset     uint64
+			endOffset       uint64
+			expectedRecords [][]byte
+			expectedSkipped int
+			expectedErr     error
+		}{
+			"single record":      {startOffset: 0, endOffset: 1, expectedRecords: records[:1]},
+			"within batch":       {startOffset: 0, endOffset: 5, expectedRecords: [][]byte{records[0], records[1], records[3], records[4]}, expectedSkipped: 1},
+			"across batches":     {startOffset: 3, endOffset: 8, expectedRecords: [][]byte{records[3], records[4], records[5], records[6]}, expectedSkipped: 1},
+			"all":                {startOffset: 0, endOffset: 15, expectedRecords: slices.Concat(records[0:2], records[3:7], records[8:12], records[13:15]), expectedSkipped: 3},
+			"end beyond topic":   {startOffset: 13, endOffset: 100, expectedRecords: records[13:15]},
+			"start after end":    {startOffset: 5, endOffset: 4, expectedErr: seberr.ErrBadInput},
+			"start beyond topic": {startOffset: 15, endOffset: 20, expectedErr: seberr.ErrOutOfBounds},
+		}
+
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				gotBatch := tester.NewBatch(len(records), 4096)
+
+				// Act
+				err := topic.ReadRecordsRange(context.Background(), &gotBatch, test.startOffset, test.endOffset)
+
+				// Assert
+				require.ErrorIs(t, err, test.expectedErr)
+				require.Equal(t, test.expectedRecords, gotBatch.IndividualRecords())
+				require.Equal(t, test.expectedSkipped, gotBatch.Skipped)
+			})
+		}
+	})
+}
+
+// TestTopicReadRecordsStopReason verifies that ReadRecords() reports the
+// reason that reading stopped in batch.StopReason, and the bytes of the
+// records that were skipped after being examined in batch.SkippedBytes.
+func TestTopicReadRecordsStopReason(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		topic, err := sebtopic.New(log, storage, "topic", cache)
+		require.NoError(t, err)
+
+		const recordSize = 10
+		expired := time.Now().Add(-time.Hour).UnixMicro()
+
+		batch := tester.MakeRandomRecordBatchSize(10, recordSize)
+		batch.Expires = []int64{0, expired, 0, 0, 0, 0, 0, 0, 0, 0}
+		_, err = topic.AddRecords(batch)
+		require.NoError(t, err)
+
+		tests := map[string]struct {
+			offset               uint64
+			maxRecords           int
+			softMaxBytes         int
+			expectedStopReason   sebrecords.StopReason
+			expectedSkippedBytes int
+		}{
+			"end":         {offset: 0, maxRecords: 100, expectedStopReason: sebrecords.StopReasonEnd, expectedSkippedBytes: recordSize},
+			"max records": {offset: 0, maxRecords: 5, expectedStopReason: sebrecords.StopReasonMaxRecords, expectedSkippedBytes: recordSize},
+			"max bytes":   {offset: 2, maxRecords: 100, softMaxBytes: 3 * recordSize, expectedStopReason: sebrecords.StopReasonMaxBytes},
+			"both limits": {offset: 2, maxRecords: 3, softMaxBytes: 3 * recordSize, expectedStopReason: sebrecords.StopReasonMaxRecords},
+		}
+
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				gotBatch := tester.NewBatch(10, 4096)
+
+				// Act
+				err := topic.ReadRecords(context.Background(), &gotBatch, test.offset, test.maxRecords, test.softMaxBytes)
+				require.NoError(t, err)
+
+				// Assert
+				require.Equal(t, test.expectedStopReason, gotBatch.StopReason)
+				require.Equal(t, test.expectedSkippedBytes, gotBatch.SkippedBytes)
+			})
+		}
+
+		t.Run("deadline", func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			gotBatch := tester.NewBatch(10, 4096)
+
+			// Act
+			err := topic.ReadRecords(ctx, &gotBatch, 0, 10, 0)
+
+			// Assert
+			require.ErrorIs(t, err, context.Canceled)
+			require.Equal(t, sebrecords.StopReasonDeadline, gotBatch.StopReason)
+		})
+	})
+}
+
+// TestTopicDropExpiredBatches verifies that DropExpiredBatches() deletes the
+// oldest record batches in which all records have expired, that it never
+// deletes the newest record batch, and that reading from dropped offsets skips
+// to the oldest remaining record, also after the topic is re-initialized.
+func TestTopicDropExpiredBatches(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		const topicName = "topic"
+		topic, err := sebtopic.New(log, storage, topicName, cache)
+		require.NoError(t, err)
+
+		expired := time.Now().Add(-time.Hour).UnixMicro()
+
+		// two fully expired batches, one partially expired batch, one fully
+		// expired batch. Only the first two must be dropped.
+		expires := [][]int64{
+			{expired, expired},
+			{expired, expired},
+			{expired, 0},
+			{expired, expired},
+		}
+		for _, batchExpires := range expires {
+			batch := tester.MakeRandomRecordBatch(len(batchExpires))
+			batch.Expires = batchExpires
+			_, err = topic.AddRecords(batch)
+			require.NoError(t, err)
+		}
+
+		// Act
+		dropped, err := topic.DropExpiredBatches(time.Now())
+		require.NoError(t, err)
+
+		// Assert
+		require.Equal(t, 2, dropped)
+
+		segments, err := topic.Segments()
+		require.NoError(t, err)
+		require.Equal(t, 2, len(segments))
+		require.Equal(t, uint64(4), segments[0].BaseOffset)
+
+		files, err := storage.ListFiles(context.Background(), topicName, ".record_batch")
+		require.NoError(t, err)
+		require.Equal(t, 2, len(files))
+
+		for _, topic := range []*sebtopic.Topic{topic, reopenTopic(t, storage, topicName, cache)} {
+			gotBatch := tester.NewBatch(10, 4096)
+			err = topic.ReadRecords(context.Background(), &gotBatch, 0, 10, 0)
+			require.NoError(t, err)
+			require.Equal(t, 1, gotBatch.Len())
+			require.Equal(t, 7, gotBatch.Skipped)
+			require.Equal(t, uint64(8), topic.NextOffset())
+		}
+	})
+}
+
+// TestTopicDropExpiredBatchesKeepsNewest verifies that DropExpiredBatches()
+// does not delete the newest record batch, even if all of its records have
+// expired.
+func TestTopicDropExpiredBatchesKeepsNewest(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		topic, err := sebtopic.New(log, storage, "topic", cache)
+		require.NoError(t, err)
+
+		batch := tester.MakeRandomRecordBatch(2)
+		batch.Expires = []int64{1, 1}
+		_, err = topic.AddRecords(batch)
+		require.NoError(t, err)
+
+		// Act
+		dropped, err := topic.DropExpiredBatches(time.Now())
+		require.NoError(t, err)
+
+		// Assert
+		require.Equal(t, 0, dropped)
+		require.Equal(t, uint64(batch.Len()), topic.NextOffset())
+	})
+}
+
+func reopenTopic(t *testing.T, storage sebtopic.Storage, topicName string, cache *sebcache.Cache) *sebtopic.Topic {
+	topic, err := sebtopic.New(log, storage, topicName, cache)
+	require.NoError(t, err)
+	return topic
+}
+
 // TestTopicReadRecordsRandomRecordSizes verifies that ReadRecords() returns the
 // expected records with the given offset, max number of records, and soft max
 // bytes, when the input record batches are randomly sized.
@@ -732,22 +1066,250 @@ func TestTopicMetadata(t *testing.T) {
 
 		for i := 1; i <= 5; i++ {
 			batch := tester.MakeRandomRecordBatch(32)
+			// NOTE: commit times have microsecond precision.
+			t0 := time.Now().Truncate(time.Microsecond)
 			_, err = topic.AddRecords(batch)
 			require.NoError(t, err)
+			t1 := time.Now()
 
 			// Act
 			gotMetadata, err := topic.Metadata()
 			require.NoError(t, err)
-			t0 := time.Now()
 
 			// Assert
 			expectedNextOffset := uint64(i * batch.Len())
 			require.Equal(t, expectedNextOffset, gotMetadata.NextOffset)
-			require.True(t, timey.DiffEqual(5*time.Millisecond, t0, gotMetadata.LatestCommitAt))
+			require.WithinRange(t, gotMetadata.LatestCommitAt, t0, t1)
+		}
+	})
+}
+
+// TestTopicMetadataLatestProducedAt verifies that Metadata() returns the
+// produced time of the latest record batch, and the zero time.Time when it's
+// unknown.
+func TestTopicMetadataLatestProducedAt(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		topic, err := sebtopic.New(log, storage, "topicName", cache)
+		require.NoError(t, err)
+
+		producedAt := time.Now().Add(-time.Minute).Truncate(time.Microsecond)
+		for _, expected := range []time.Time{producedAt, {}} {
+			batch := tester.MakeRandomRecordBatch(2)
+			if !expected.IsZero() {
+				batch.ProducedUnixEpochUs = expected.UnixMicro()
+			}
+			_, err = topic.AddRecords(batch)
+			require.NoError(t, err)
+
+			// Act
+			gotMetadata, err := topic.Metadata()
+			require.NoError(t, err)
+
+			// Assert
+			require.True(t, expected.Equal(gotMetadata.LatestProducedAt))
+		}
+	})
+}
+
+// TestTopicBatchInfo verifies that BatchInfo() returns information about the
+// record batch that holds the given offset, and seberr.ErrOutOfBounds for
+// offsets that don't exist or have been dropped.
+func TestTopicBatchInfo(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		topic, err := sebtopic.New(log, storage, "topicName", cache)
+		require.NoError(t, err)
+
+		expired := time.Now().Add(-time.Hour).UnixMicro()
+		producedAt := time.Now().Add(-time.Minute).Truncate(time.Microsecond)
+
+		expiredBatch := tester.MakeRandomRecordBatch(2)
+		expiredBatch.Expires = []int64{expired, expired}
+		_, err = topic.AddRecords(expiredBatch)
+		require.NoError(t, err)
+
+		batch := tester.MakeRandomRecordBatch(3)
+		batch.ProducedUnixEpochUs = producedAt.UnixMicro()
+		tBefore := time.Now().Truncate(time.Microsecond)
+		_, err = topic.AddRecords(batch)
+		require.NoError(t, err)
+		t0 := time.Now()
+
+		_, err = topic.AddRecords(tester.MakeRandomRecordBatch(1))
+		require.NoError(t, err)
+
+		dropped, err := topic.DropExpiredBatches(time.Now())
+		require.NoError(t, err)
+		require.Equal(t, 1, dropped)
+
+		for _, offset := range []uint64{2, 3, 4} {
+			// Act
+			info, err := topic.BatchInfo(context.Background(), offset)
+			require.NoError(t, err)
+
+			// Assert
+			require.Equal(t, uint64(2), info.BaseOffset)
+			require.Equal(t, uint64(3), info.NumRecords)
+			require.True(t, producedAt.Equal(info.ProducedAt))
+			require.False(t, info.CommittedAt.Before(tBefore))
+			require.False(t, info.CommittedAt.After(t0))
+		}
+
+		info, err := topic.BatchInfo(context.Background(), 5)
+		require.NoError(t, err)
+		require.Equal(t, uint64(5), info.BaseOffset)
+		require.True(t, info.ProducedAt.IsZero())
+
+		for _, offset := range []uint64{0, 1, 6} {
+			_, err = topic.BatchInfo(context.Background(), offset)
+			require.ErrorIs(t, err, seberr.ErrOutOfBounds)
+		}
+	})
+}
+
+// TestTopicOffsetLookups verifies that FirstOffset and OffsetAt return the
+// offsets of the oldest remaining record and of the first record committed
+// at or after a given time, respectively.
+func TestTopicOffsetLookups(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		topic, err := sebtopic.New(log, storage, "topicName", cache)
+		require.NoError(t, err)
+		ctx := context.Background()
+
+		// empty topic
+		firstOffset, err := topic.FirstOffset(ctx)
+		require.NoError(t, err)
+		require.Equal(t, uint64(0), firstOffset)
+
+		offset, err := topic.OffsetAt(ctx, time.Now())
+		require.NoError(t, err)
+		require.Equal(t, uint64(0), offset)
+
+		expired := time.Now().Add(-time.Hour).UnixMicro()
+		expiredBatch := tester.MakeRandomRecordBatch(2)
+		expiredBatch.Expires = []int64{expired, expired}
+		_, err = topic.AddRecords(expiredBatch)
+		require.NoError(t, err)
+
+		t0 := time.Now()
+		time.Sleep(time.Millisecond)
+		_, err = topic.AddRecords(tester.MakeRandomRecordBatch(3))
+		require.NoError(t, err)
+
+		time.Sleep(time.Millisecond)
+		t1 := time.Now()
+		time.Sleep(time.Millisecond)
+		_, err = topic.AddRecords(tester.MakeRandomRecordBatch(1))
+		require.NoError(t, err)
+
+		time.Sleep(time.Millisecond)
+		t2 := time.Now()
+
+		dropped, err := topic.DropExpiredBatches(time.Now())
+		require.NoError(t, err)
+		require.Equal(t, 1, dropped)
+
+		// Act
+		firstOffset, err = topic.FirstOffset(ctx)
+		require.NoError(t, err)
+
+		// Assert
+		require.Equal(t, uint64(2), firstOffset)
+
+		tests := map[string]struct {
+			t        time.Time
+			expected uint64
+		}{
+			"before all":        {t: t0.Add(-time.Hour), expected: 2},
+			"before second":     {t: t0, expected: 2},
+			"before third":      {t: t1, expected: 5},
+			"after all":         {t: t2, expected: 6},
+			"far in the future": {t: t2.Add(time.Hour), expected: 6},
+		}
+
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				// Act
+				offset, err := topic.OffsetAt(ctx, test.t)
+				require.NoError(t, err)
+
+				// Assert
+				require.Equal(t, test.expected, offset)
+			})
 		}
 	})
 }
 
+// TestTopicCommitTimesClockJump verifies that the commit times of record
+// batches keep increasing when the wall clock goes backwards, also when the
+// topic is reopened, and that Metadata() reports how far commit times are
+// ahead of the wall clock.
+func TestTopicCommitTimesClockJump(t *testing.T) {
+	defer func(f func() int64) { sebrecords.UnixEpochUs = f }(sebrecords.UnixEpochUs)
+
+	tests := map[string]struct {
+		manifest bool
+	}{
+		"listing record batches": {manifest: false},
+		"manifest":               {manifest: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+				ctx := context.Background()
+				t0 := time.Now().Truncate(time.Microsecond)
+				now := t0
+				sebrecords.UnixEpochUs = func() int64 { return now.UnixMicro() }
+
+				topic, err := sebtopic.New(log, storage, "topicName", cache, sebtopic.WithManifest(test.manifest))
+				require.NoError(t, err)
+
+				_, err = topic.AddRecords(tester.MakeRandomRecordBatch(2))
+				require.NoError(t, err)
+
+				now = t0.Add(-time.Hour)
+
+				// Act
+				_, err = topic.AddRecords(tester.MakeRandomRecordBatch(1))
+				require.NoError(t, err)
+
+				// Assert
+				first, err := topic.BatchInfo(ctx, 0)
+				require.NoError(t, err)
+				require.True(t, t0.Equal(first.CommittedAt))
+
+				second, err := topic.BatchInfo(ctx, 2)
+				require.NoError(t, err)
+				require.True(t, second.CommittedAt.After(first.CommittedAt))
+
+				metadata, err := topic.Metadata()
+				require.NoError(t, err)
+				require.Equal(t, second.CommittedAt.Sub(now), metadata.ClockDrift)
+
+				offset, err := topic.OffsetAt(ctx, t0.Add(time.Microsecond))
+				require.NoError(t, err)
+				require.Equal(t, uint64(2), offset)
+
+				// Act
+				reopened, err := sebtopic.New(log, storage, "topicName", cache, sebtopic.WithManifest(test.manifest))
+				require.NoError(t, err)
+				_, err = reopened.AddRecords(tester.MakeRandomRecordBatch(1))
+				require.NoError(t, err)
+
+				// Assert
+				third, err := reopened.BatchInfo(ctx, 3)
+				require.NoError(t, err)
+				require.True(t, third.CommittedAt.After(second.CommittedAt))
+
+				now = t0.Add(time.Hour)
+				metadata, err = reopened.Metadata()
+				require.NoError(t, err)
+				require.Equal(t, time.Duration(0), metadata.ClockDrift)
+			})
+		})
+	}
+}
+
 // TestTopicMetadataEmptyTopic verifies that Metadata() returns the expected
 // data when the topic is empty.
 func TestTopicMetadataEmptyTopic(t *testing.T) {
@@ -765,6 +1327,55 @@ func TestTopicMetadataEmptyTopic(t *testing.T) {
 	})
 }
 
+// TestTopicSegments verifies that Segments() returns one segment per record
+// batch, with the expected offsets, record counts and storage paths.
+func TestTopicSegments(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		const topicName = "topicName"
+		topic, err := sebtopic.New(log, storage, topicName, cache)
+		require.NoError(t, err)
+
+		batchSizes := []int{3, 5, 7}
+		for _, batchSize := range batchSizes {
+			_, err = topic.AddRecords(tester.MakeRandomRecordBatch(batchSize))
+			require.NoError(t, err)
+		}
+
+		// Act
+		segments, err := topic.Segments()
+		require.NoError(t, err)
+
+		// Assert
+		require.Equal(t, len(batchSizes), len(segments))
+
+		baseOffset := uint64(0)
+		for i, segment := range segments {
+			require.Equal(t, baseOffset, segment.BaseOffset)
+			require.Equal(t, uint64(batchSizes[i]), segment.NumRecords)
+			require.Greater(t, segment.Size, int64(0))
+			require.True(t, strings.HasSuffix(segment.Path, sebtopic.RecordBatchKey(topicName, baseOffset)))
+
+			baseOffset += uint64(batchSizes[i])
+		}
+	})
+}
+
+// TestTopicSegmentsEmptyTopic verifies that Segments() returns no segments
+// when the topic is empty.
+func TestTopicSegmentsEmptyTopic(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		topic, err := sebtopic.New(log, storage, "topicName", cache)
+		require.NoError(t, err)
+
+		// Act
+		segments, err := topic.Segments()
+		require.NoError(t, err)
+
+		// Assert
+		require.Empty(t, segments)
+	})
+}
+
 // BenchmarkTopicReadBatchUsingReadRecords benchmarks reading a record batch
 // using Topic.ReadRecords().
 func BenchmarkTopicReadBatchUsingReadRecords(b *testing.B) {
@@ -824,6 +1435,75 @@ func BenchmarkTopicReadRecordUsingReadRecords(b *testing.B) {
 	})
 }
 
+// TestTopicReadRecordsPassesContextToStorage verifies that ReadRecords()
+// passes its context to backing storage, and that a record batch whose read
+// is aborted, e.g. because the context was cancelled, is not cached.
+func TestTopicReadRecordsPassesContextToStorage(t *testing.T) {
+	tester.TestCacheStorage(t, func(t *testing.T, cacheStorage sebcache.Storage) {
+		const topicName = "topic"
+		memoryStorage := sebtopic.NewMemoryStorage(log)
+
+		cache, err := sebcache.New(log, cacheStorage)
+		require.NoError(t, err)
+
+		topic, err := sebtopic.New(log, memoryStorage, topicName, cache, sebtopic.WithCompress(nil))
+		require.NoError(t, err)
+
+		batch := tester.MakeRandomRecordBatch(5)
+		_, err = topic.AddRecords(batch)
+		require.NoError(t, err)
+
+		recordBatchKey := sebtopic.RecordBatchKey(topicName, 0)
+		require.NoError(t, cache.Remove(recordBatchKey))
+
+		// when abortRead is set, the next read of the record batch is aborted
+		// part way through
+		abortRead := false
+		recordBatchReads := 0
+		backingStorage := forwardingStorage(memoryStorage)
+		backingStorage.ReaderMock = func(ctx context.Context, key string) (io.ReadCloser, error) {
+			rdr, err := memoryStorage.Reader(ctx, key)
+			if err != nil || key != recordBatchKey {
+				return rdr, err
+			}
+
+			recordBatchReads += 1
+			if abortRead {
+				abortRead = false
+				return io.NopCloser(io.MultiReader(io.LimitReader(rdr, 10), iotest.ErrReader(context.Canceled))), nil
+			}
+			return rdr, nil
+		}
+
+		topic, err = sebtopic.New(log, backingStorage, topicName, cache, sebtopic.WithCompress(nil))
+		require.NoError(t, err)
+
+		type ctxKey struct{}
+		ctx := context.WithValue(context.Background(), ctxKey{}, "consumer request")
+		require.NoError(t, cache.Remove(recordBatchKey))
+		abortRead = true
+		recordBatchReads = 0
+
+		// Act
+		gotBatch := tester.NewBatch(batch.Len(), 4096)
+		err = topic.ReadRecords(ctx, &gotBatch, 0, batch.Len(), 0)
+
+		// Assert
+		require.ErrorIs(t, err, context.Canceled)
+		lastCall := backingStorage.ReaderCalls[len(backingStorage.ReaderCalls)-1]
+		require.Equal(t, recordBatchKey, lastCall.RecordBatchPath)
+		require.Equal(t, "consumer request", lastCall.Ctx.Value(ctxKey{}))
+
+		// record batch is read from backing storage again, since the aborted
+		// read must not have been cached.
+		gotBatch.Reset()
+		err = topic.ReadRecords(context.Background(), &gotBatch, 0, batch.Len(), 0)
+		require.NoError(t, err)
+		require.Equal(t, 2, recordBatchReads)
+		require.Equal(t, batch.IndividualRecords(), gotBatch.IndividualRecords())
+	})
+}
+
 func benchmarkTopicReadRecords(b *testing.B, readRecord func(t *sebtopic.Topic, batch *sebrecords.Batch, offset uint64) ([]byte, error)) {
 	diskCache, err := sebcache.NewDiskStorage(log, b.TempDir())
 	require.NoError(b, err)
@@ -0,0 +1,199 @@
+package sebtopic
+
+import (
+	"context"
+	"maps"
+	"path"
+	"slices"
+	"sync"
+	"time"
+)
+
+// UploadStats describes the uploads limited by an uploadLimiter.
+type UploadStats struct {
+	MaxInFlight int
+	InFlight    int
+	Queued      int
+
+	// QueuedByTopic holds the number of queued uploads of each topic that
+	// has any.
+	QueuedByTopic map[string]int
+
+	// Uploads is the total number of uploads that were started, and Waited
+	// the number of them that had to wait in the queue. WaitTime is the total
+	// amount of time spent waiting.
+	Uploads  uint64
+	Waited   uint64
+	WaitTime time.Duration
+
+	// WaitTimeByTopic holds the total amount of time spent waiting by the
+	// uploads of each topic that has had to wait.
+	WaitTimeByTopic map[string]time.Duration
+}
+
+// uploadLimiter limits the number of concurrent uploads to backing storage,
+// such that a burst of record batches being committed across many topics
+// doesn't open hundreds of concurrent uploads.
+//
+// Uploads that have to wait are queued per topic, and slots are handed to
+// topics in round-robin order. This ensures that a topic with many queued
+// uploads can't starve other topics.
+//
+// A nil uploadLimiter is valid and doesn't limit uploads.
+type uploadLimiter struct {
+	max int
+	now func() time.Time
+
+	mu       sync.Mutex
+	inFlight int
+
+	// waiters holds the queued uploads of each topic in FIFO order, and
+	// topics holds the topics that have queued uploads in the order that
+	// they're handed slots.
+	waiters map[string][]chan struct{}
+	topics  []string
+
+	uploads         uint64
+	waited          uint64
+	waitTime        time.Duration
+	waitTimeByTopic map[string]time.Duration
+}
+
+func newUploadLimiter(max int, now func() time.Time) *uploadLimiter {
+	if max <= 0 {
+		return nil
+	}
+
+	return &uploadLimiter{
+		max:             max,
+		now:             now,
+		waiters:         make(map[string][]chan struct{}),
+		waitTimeByTopic: make(map[string]time.Duration),
+	}
+}
+
+// acquire waits for a free upload slot for an upload to key, or until ctx
+// expires. If nil is returned, release must be called once the upload is done.
+func (l *uploadLimiter) acquire(ctx context.Context, key string) error {
+	if l == nil {
+		return nil
+	}
+	topicName := path.Dir(key)
+
+	l.mu.Lock()
+	l.uploads += 1
+	if l.inFlight < l.max && len(l.topics) == 0 {
+		l.inFlight += 1
+		l.mu.Unlock()
+		return nil
+	}
+
+	ready := make(chan struct{})
+	if len(l.waiters[topicName]) == 0 {
+		l.topics = append(l.topics, topicName)
+	}
+	l.waiters[topicName] = append(l.waiters[topicName], ready)
+	l.waited += 1
+	l.mu.Unlock()
+
+	t0 := l.now()
+	defer func() {
+		waitTime := l.now().Sub(t0)
+		l.mu.Lock()
+		l.waitTime += waitTime
+		l.waitTimeByTopic[topicName] += waitTime
+		l.mu.Unlock()
+	}()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	removed := l.removeWaiter(topicName, ready)
+	l.mu.Unlock()
+
+	if !removed {
+		// the slot was handed to us while ctx expired
+		l.release()
+	}
+	return ctx.Err()
+}
+
+// removeWaiter removes ready from the queue of topicName, returning whether it
+// was still queued.
+// NOTE: you must hold l.mu lock when calling this method!
+func (l *uploadLimiter) removeWaiter(topicName string, ready chan struct{}) bool {
+	waiters := l.waiters[topicName]
+	i := slices.Index(waiters, ready)
+	if i < 0 {
+		return false
+	}
+
+	waiters = slices.Delete(waiters, i, i+1)
+	if len(waiters) > 0 {
+		l.waiters[topicName] = waiters
+		return true
+	}
+
+	delete(l.waiters, topicName)
+	l.topics = slices.DeleteFunc(l.topics, func(t string) bool { return t == topicName })
+	return true
+}
+
+// release frees the slot of a finished upload, handing it to the next queued
+// upload if any.
+func (l *uploadLimiter) release() {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.topics) == 0 {
+		l.inFlight -= 1
+		return
+	}
+
+	topicName := l.topics[0]
+	l.topics = l.topics[1:]
+
+	waiters := l.waiters[topicName]
+	ready := waiters[0]
+	if len(waiters) > 1 {
+		l.waiters[topicName] = waiters[1:]
+		l.topics = append(l.topics, topicName)
+	} else {
+		delete(l.waiters, topicName)
+	}
+
+	close(ready)
+}
+
+func (l *uploadLimiter) stats() UploadStats {
+	if l == nil {
+		return UploadStats{}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := UploadStats{
+		MaxInFlight:     l.max,
+		InFlight:        l.inFlight,
+		QueuedByTopic:   make(map[string]int, len(l.waiters)),
+		Uploads:         l.uploads,
+		Waited:          l.waited,
+		WaitTime:        l.waitTime,
+		WaitTimeByTopic: maps.Clone(l.waitTimeByTopic),
+	}
+	for topicName, waiters := range l.waiters {
+		stats.QueuedByTopic[topicName] = len(waiters)
+		stats.Queued += len(waiters)
+	}
+
+	return stats
+}
@@ -0,0 +1,183 @@
+package sebtopic_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/stretchr/testify/require"
+)
+
+// TestS3MaxConcurrentUploads verifies that no more than the configured number
+// of uploads are made at the same time, and that the remaining uploads are
+// queued until a slot is freed.
+func TestS3MaxConcurrentUploads(t *testing.T) {
+	const (
+		maxUploads = 2
+		uploads    = 6
+	)
+
+	unblock := make(chan struct{})
+	mu := sync.Mutex{}
+	inFlight, maxInFlight := 0, 0
+
+	s3Mock := &tester.S3Mock{}
+	s3Mock.MockPutObject = func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+		mu.Lock()
+		inFlight += 1
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+
+		<-unblock
+
+		mu.Lock()
+		inFlight -= 1
+		mu.Unlock()
+		return &s3.PutObjectOutput{}, nil
+	}
+
+	s3Storage := sebtopic.NewS3Storage(log, s3Mock, "mybucket", "", sebtopic.WithS3MaxConcurrentUploads(maxUploads))
+
+	wg := sync.WaitGroup{}
+	for range uploads {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wtr, err := s3Storage.Writer(context.Background(), "topic/000.record_batch")
+			require.NoError(t, err)
+			tester.WriteAndClose(t, wtr, tester.RandomBytes(t, 16))
+		}()
+	}
+
+	// Act
+	require.Eventually(t, func() bool {
+		return s3Storage.UploadStats().Queued == uploads-maxUploads
+	}, time.Second, time.Millisecond)
+	stats := s3Storage.UploadStats()
+
+	close(unblock)
+	wg.Wait()
+
+	// Assert
+	require.Equal(t, maxUploads, stats.InFlight)
+	require.Equal(t, map[string]int{"topic": uploads - maxUploads}, stats.QueuedByTopic)
+	require.Equal(t, maxUploads, maxInFlight)
+
+	stats = s3Storage.UploadStats()
+	require.Equal(t, 0, stats.InFlight)
+	require.Equal(t, 0, stats.Queued)
+	require.Equal(t, uint64(uploads), stats.Uploads)
+	require.Equal(t, uint64(uploads-maxUploads), stats.Waited)
+	require.Equal(t, map[string]time.Duration{"topic": stats.WaitTime}, stats.WaitTimeByTopic)
+}
+
+// TestS3UploadFairness verifies that queued uploads are handed slots in
+// round-robin order across topics, such that a topic with many queued uploads
+// doesn't starve other topics.
+func TestS3UploadFairness(t *testing.T) {
+	unblock := make(chan struct{})
+	mu := sync.Mutex{}
+	uploadedKeys := []string{}
+
+	s3Mock := &tester.S3Mock{}
+	s3Mock.MockPutObject = func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+		mu.Lock()
+		uploadedKeys = append(uploadedKeys, *params.Key)
+		mu.Unlock()
+
+		<-unblock
+		return &s3.PutObjectOutput{}, nil
+	}
+
+	s3Storage := sebtopic.NewS3Storage(log, s3Mock, "mybucket", "prefix", sebtopic.WithS3MaxConcurrentUploads(1))
+
+	// queue uploads one at a time, such that their order is deterministic
+	keys := []string{
+		"busy/000.record_batch",
+		"busy/001.record_batch",
+		"busy/002.record_batch",
+		"busy/003.record_batch",
+		"quiet/000.record_batch",
+	}
+	wg := sync.WaitGroup{}
+	for i, key := range keys {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wtr, err := s3Storage.Writer(context.Background(), key)
+			require.NoError(t, err)
+			tester.WriteAndClose(t, wtr, tester.RandomBytes(t, 16))
+		}()
+
+		require.Eventually(t, func() bool {
+			return s3Storage.UploadStats().Queued == i
+		}, time.Second, time.Millisecond)
+	}
+
+	// Act
+	for range keys {
+		unblock <- struct{}{}
+	}
+	wg.Wait()
+
+	// Assert
+	expectedKeys := []string{
+		"prefix/busy/000.record_batch",
+		"prefix/busy/001.record_batch",
+		"prefix/quiet/000.record_batch",
+		"prefix/busy/002.record_batch",
+		"prefix/busy/003.record_batch",
+	}
+	require.Equal(t, expectedKeys, uploadedKeys)
+}
+
+// TestS3UploadQueueContextExpired verifies that a queued upload is abandoned
+// when its context expires, and that it doesn't hold on to an upload slot.
+func TestS3UploadQueueContextExpired(t *testing.T) {
+	unblock := make(chan struct{})
+	calls := 0
+
+	s3Mock := &tester.S3Mock{}
+	s3Mock.MockPutObject = func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+		calls += 1
+		<-unblock
+		return &s3.PutObjectOutput{}, nil
+	}
+
+	s3Storage := sebtopic.NewS3Storage(log, s3Mock, "mybucket", "", sebtopic.WithS3MaxConcurrentUploads(1))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		wtr, err := s3Storage.Writer(context.Background(), "topic/000.record_batch")
+		require.NoError(t, err)
+		tester.WriteAndClose(t, wtr, tester.RandomBytes(t, 16))
+	}()
+	require.Eventually(t, func() bool {
+		return s3Storage.UploadStats().InFlight == 1
+	}, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	wtr, err := s3Storage.Writer(ctx, "topic/001.record_batch")
+	require.NoError(t, err)
+	_, err = wtr.Write(tester.RandomBytes(t, 16))
+	require.NoError(t, err)
+
+	// Act
+	err = wtr.Close()
+
+	// Assert
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, 0, s3Storage.UploadStats().Queued)
+
+	close(unblock)
+	<-done
+	require.Equal(t, 1, calls)
+	require.Equal(t, 0, s3Storage.UploadStats().InFlight)
+}
@@ -0,0 +1,204 @@
+package sebtopic
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StorageUsage describes the files that hold a topic's records in backing
+// storage.
+type StorageUsage struct {
+	RecordBatchBytes int64
+	RecordBatchFiles int
+	LargeRecordBytes int64
+	LargeRecordFiles int
+
+	// ReconciledAt is the time at which usage was last reconciled with
+	// backing storage. It's the zero time.Time if it never was, in which case
+	// usage only includes the files written since the topic was opened.
+	ReconciledAt time.Time
+}
+
+// Bytes returns the total number of bytes used by the topic.
+func (u StorageUsage) Bytes() int64 {
+	return u.RecordBatchBytes + u.LargeRecordBytes
+}
+
+// Files returns the total number of files used by the topic.
+func (u StorageUsage) Files() int {
+	return u.RecordBatchFiles + u.LargeRecordFiles
+}
+
+// usageTracker keeps track of the sizes of the files that a topic has in
+// backing storage. It's maintained as files are written and deleted, and
+// periodically reconciled with the files actually in backing storage, e.g. to
+// include files written before the topic was opened.
+//
+// NOTE: the sizes of written files are the number of bytes handed to backing
+// storage, which doesn't include any overhead added by it, e.g. encryption.
+// Reconciling corrects this.
+type usageTracker struct {
+	mu           sync.Mutex
+	sizes        map[string]int64
+	totals       StorageUsage
+	reconciledAt time.Time
+
+	// changed holds the keys that were written or deleted while a reconcile
+	// is running. It's nil when no reconcile is running.
+	changed map[string]struct{}
+}
+
+func newUsageTracker() *usageTracker {
+	return &usageTracker{sizes: make(map[string]int64)}
+}
+
+func (u *usageTracker) set(key string, size int64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.setSize(key, size)
+	if u.changed != nil {
+		u.changed[key] = struct{}{}
+	}
+}
+
+func (u *usageTracker) remove(key string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.removeSize(key)
+	if u.changed != nil {
+		u.changed[key] = struct{}{}
+	}
+}
+
+// setSize sets the size of key, updating the totals.
+// NOTE: you must hold u.mu lock when calling this method!
+func (u *usageTracker) setSize(key string, size int64) {
+	u.removeSize(key)
+
+	u.sizes[key] = size
+	if strings.HasSuffix(key, largeRecordExtension) {
+		u.totals.LargeRecordBytes += size
+		u.totals.LargeRecordFiles += 1
+		return
+	}
+	u.totals.RecordBatchBytes += size
+	u.totals.RecordBatchFiles += 1
+}
+
+// removeSize removes the size of key, updating the totals.
+// NOTE: you must hold u.mu lock when calling this method!
+func (u *usageTracker) removeSize(key string) {
+	size, ok := u.sizes[key]
+	if !ok {
+		return
+	}
+
+	delete(u.sizes, key)
+	if strings.HasSuffix(key, largeRecordExtension) {
+		u.totals.LargeRecordBytes -= size
+		u.totals.LargeRecordFiles -= 1
+		return
+	}
+	u.totals.RecordBatchBytes -= size
+	u.totals.RecordBatchFiles -= 1
+}
+
+// startReconcile starts recording the keys that are changed until
+// finishReconcile is called.
+func (u *usageTracker) startReconcile() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.changed = make(map[string]struct{})
+}
+
+// finishReconcile replaces the tracked sizes with sizes, except for keys that
+// were changed since startReconcile was called; sizes might be outdated for
+// those.
+func (u *usageTracker) finishReconcile(sizes map[string]int64, now time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for key := range u.sizes {
+		if _, changed := u.changed[key]; !changed {
+			u.removeSize(key)
+		}
+	}
+	for key, size := range sizes {
+		if _, changed := u.changed[key]; !changed {
+			u.setSize(key, size)
+		}
+	}
+
+	u.changed = nil
+	u.reconciledAt = now
+}
+
+// abortReconcile stops recording changed keys, leaving the tracked sizes as
+// they are.
+func (u *usageTracker) abortReconcile() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.changed = nil
+}
+
+func (u *usageTracker) usage() StorageUsage {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	usage := u.totals
+	usage.ReconciledAt = u.reconciledAt
+	return usage
+}
+
+// StorageUsage returns the number of bytes and files that the topic uses in
+// backing storage.
+func (s *Topic) StorageUsage() StorageUsage {
+	return s.usage.usage()
+}
+
+// ReconcileStorageUsage lists the topic's record batches and large records in
+// backing storage and replaces the tracked storage usage with their sizes.
+func (s *Topic) ReconcileStorageUsage(ctx context.Context) (StorageUsage, error) {
+	s.reconcileMu.Lock()
+	defer s.reconcileMu.Unlock()
+
+	s.usage.startReconcile()
+
+	sizes := make(map[string]int64)
+	for _, extension := range []string{recordBatchExtension, largeRecordExtension} {
+		err := walkFiles(ctx, s.backingStorage, s.topicName, extension, func(file File) error {
+			sizes[path.Join(s.topicName, path.Base(file.Path))] = file.Size
+			return nil
+		})
+		if err != nil {
+			s.usage.abortReconcile()
+			return StorageUsage{}, fmt.Errorf("listing files with extension '%s': %w", extension, err)
+		}
+	}
+
+	s.usage.finishReconcile(sizes, time.Now())
+
+	return s.usage.usage(), nil
+}
+
+// countingWriteCloser counts the number of bytes written to the embedded
+// io.WriteCloser.
+type countingWriteCloser struct {
+	io.WriteCloser
+	n int64
+}
+
+func (c *countingWriteCloser) Write(p []byte) (int, error) {
+	n, err := c.WriteCloser.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,112 @@
+package sebtopic_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micvbang/go-helpy/sizey"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTopicStorageUsage verifies that StorageUsage() is maintained as record
+// batches and large records are added, merged and dropped, such that it
+// matches the usage found by ReconcileStorageUsage().
+func TestTopicStorageUsage(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		const topicName = "topic"
+		ctx := context.Background()
+		topic, err := sebtopic.New(log, storage, topicName, cache, sebtopic.WithLargeRecordThreshold(largeRecordThreshold))
+		require.NoError(t, err)
+
+		expired := time.Now().Add(-time.Hour).UnixMicro()
+		for i := range 6 {
+			batch := tester.RecordsToBatch([][]byte{
+				tester.RandomBytes(t, 10),
+				tester.RandomBytes(t, 2*largeRecordThreshold),
+			})
+			if i < 2 {
+				batch.Expires = []int64{expired, expired}
+			}
+
+			_, err = topic.AddRecords(batch)
+			require.NoError(t, err)
+		}
+
+		// Act
+		usage := topic.StorageUsage()
+
+		// Assert
+		require.Equal(t, 6, usage.RecordBatchFiles)
+		require.Equal(t, 6, usage.LargeRecordFiles)
+		require.Less(t, int64(6*2*largeRecordThreshold-1), usage.LargeRecordBytes)
+		require.True(t, usage.ReconciledAt.IsZero())
+		requireReconciledUsage(t, topic, usage)
+
+		// Act
+		_, err = topic.DropExpiredBatches(time.Now())
+		require.NoError(t, err)
+		_, err = topic.MergeBatches(4, sizey.MB)
+		require.NoError(t, err)
+		usage = topic.StorageUsage()
+
+		// Assert
+		require.Less(t, usage.RecordBatchFiles, 4)
+		require.Equal(t, 4, usage.LargeRecordFiles)
+		requireReconciledUsage(t, topic, usage)
+
+		// Act
+		reopened := reopenTopic(t, storage, topicName, cache)
+
+		// Assert
+		require.Equal(t, sebtopic.StorageUsage{}, reopened.StorageUsage())
+
+		reconciled, err := reopened.ReconcileStorageUsage(ctx)
+		require.NoError(t, err)
+		require.Equal(t, usage.Bytes(), reconciled.Bytes())
+		require.Equal(t, usage.Files(), reconciled.Files())
+		require.False(t, reconciled.ReconciledAt.IsZero())
+	})
+}
+
+// TestTopicMetadataUsage verifies that Metadata() returns the topic's storage
+// and cache usage.
+func TestTopicMetadataUsage(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		topic, err := sebtopic.New(log, storage, "topic", cache)
+		require.NoError(t, err)
+
+		otherTopic, err := sebtopic.New(log, storage, "other-topic", cache)
+		require.NoError(t, err)
+
+		_, err = topic.AddRecords(tester.MakeRandomRecordBatch(5))
+		require.NoError(t, err)
+		_, err = otherTopic.AddRecords(tester.MakeRandomRecordBatch(5))
+		require.NoError(t, err)
+
+		// Act
+		metadata, err := topic.Metadata()
+		require.NoError(t, err)
+
+		// Assert
+		require.Equal(t, 1, metadata.StorageUsage.RecordBatchFiles)
+		require.Equal(t, 1, metadata.CacheUsage.Items)
+		require.Less(t, int64(0), metadata.CacheUsage.Bytes)
+		require.Equal(t, cache.Size(), metadata.CacheUsage.Bytes+otherTopic.CacheUsage().Bytes)
+	})
+}
+
+// requireReconciledUsage requires that reconciling the storage usage of topic
+// doesn't change it from expected.
+func requireReconciledUsage(t *testing.T, topic *sebtopic.Topic, expected sebtopic.StorageUsage) {
+	t.Helper()
+
+	reconciled, err := topic.ReconcileStorageUsage(context.Background())
+	require.NoError(t, err)
+
+	expected.ReconciledAt = reconciled.ReconciledAt
+	require.Equal(t, expected, reconciled)
+}
@@ -0,0 +1,222 @@
+package sebtopic
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+)
+
+// Divergence describes a record batch that differs between a leader and a
+// follower storage.
+type Divergence struct {
+	Key    string
+	Reason string
+}
+
+const (
+	DivergenceMissingOnFollower = "missing on follower"
+	DivergenceMissingOnLeader   = "missing on leader"
+	DivergenceSize              = "size mismatch"
+	DivergenceChecksum          = "checksum mismatch"
+)
+
+// VerifyReplica compares the record batches of topicName in leader and
+// follower, returning the record batches that differ between the two.
+//
+// Since followers are expected to lag behind their leader, record batches
+// newer than the follower's newest record batch are not reported as
+// missing.
+func VerifyReplica(ctx context.Context, leader Storage, follower Storage, topicName string) ([]Divergence, error) {
+	leaderFiles, err := listRecordBatches(ctx, leader, topicName)
+	if err != nil {
+		return nil, fmt.Errorf("listing leader record batches: %w", err)
+	}
+
+	followerFiles, err := listRecordBatches(ctx, follower, topicName)
+	if err != nil {
+		return nil, fmt.Errorf("listing follower record batches: %w", err)
+	}
+
+	// NOTE: record batch keys are zero padded and therefore sort in offset
+	// order.
+	var followerNewest string
+	for key := range followerFiles {
+		followerNewest = max(followerNewest, key)
+	}
+
+	divergences := []Divergence{}
+	for key, leaderSize := range leaderFiles {
+		followerSize, ok := followerFiles[key]
+		if !ok {
+			if key < followerNewest {
+				divergences = append(divergences, Divergence{Key: key, Reason: DivergenceMissingOnFollower})
+			}
+			continue
+		}
+
+		if leaderSize != followerSize {
+			divergences = append(divergences, Divergence{Key: key, Reason: DivergenceSize})
+			continue
+		}
+
+		leaderChecksum, err := checksum(ctx, leader, key)
+		if err != nil {
+			return nil, fmt.Errorf("computing leader checksum: %w", err)
+		}
+
+		followerChecksum, err := checksum(ctx, follower, key)
+		if err != nil {
+			return nil, fmt.Errorf("computing follower checksum: %w", err)
+		}
+
+		if leaderChecksum != followerChecksum {
+			divergences = append(divergences, Divergence{Key: key, Reason: DivergenceChecksum})
+		}
+	}
+
+	for key := range followerFiles {
+		if _, ok := leaderFiles[key]; !ok {
+			divergences = append(divergences, Divergence{Key: key, Reason: DivergenceMissingOnLeader})
+		}
+	}
+
+	slices.SortFunc(divergences, func(a, b Divergence) int {
+		if a.Key < b.Key {
+			return -1
+		}
+		if a.Key > b.Key {
+			return 1
+		}
+		return 0
+	})
+
+	return divergences, nil
+}
+
+// ReplicaVerificationLoop periodically verifies that the topics returned by
+// topicNames are consistent between leader and follower, calling report with
+// the result of each verification, e.g. ReplicaReports.Report. It runs until
+// ctx expires; errors are logged and retried at the next interval.
+func ReplicaVerificationLoop(ctx context.Context, log logger.Logger, leader Storage, follower Storage, topicNames func() []string, interval time.Duration, report func(topicName string, divergences []Divergence)) error {
+	log = log.WithField("interval", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		for _, topicName := range topicNames() {
+			divergences, err := VerifyReplica(ctx, leader, follower, topicName)
+			if err != nil {
+				log.Errorf("verifying replica of topic '%s': %s", topicName, err)
+				continue
+			}
+
+			if len(divergences) > 0 {
+				log.Errorf("replica of topic '%s' diverged in %d record batches", topicName, len(divergences))
+			}
+			report(topicName, divergences)
+		}
+	}
+}
+
+// ReplicaReport is the result of the latest verification of the replica of a
+// topic.
+type ReplicaReport struct {
+	TopicName   string
+	Divergences []Divergence
+	VerifiedAt  time.Time
+}
+
+// ReplicaReports keeps the latest ReplicaReport of each topic, e.g. such that
+// the results of ReplicaVerificationLoop can be exposed. It's safe for
+// concurrent use.
+type ReplicaReports struct {
+	mu      sync.Mutex
+	reports map[string]ReplicaReport
+}
+
+func NewReplicaReports() *ReplicaReports {
+	return &ReplicaReports{
+		reports: map[string]ReplicaReport{},
+	}
+}
+
+// Report records divergences as the result of the latest verification of the
+// replica of topicName.
+func (r *ReplicaReports) Report(topicName string, divergences []Divergence) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.reports[topicName] = ReplicaReport{
+		TopicName:   topicName,
+		Divergences: divergences,
+		VerifiedAt:  time.Now(),
+	}
+}
+
+// Reports returns the latest report of each topic that has been verified,
+// sorted by topic name.
+func (r *ReplicaReports) Reports() []ReplicaReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reports := make([]ReplicaReport, 0, len(r.reports))
+	for _, report := range r.reports {
+		reports = append(reports, report)
+	}
+	slices.SortFunc(reports, func(a, b ReplicaReport) int {
+		return strings.Compare(a.TopicName, b.TopicName)
+	})
+
+	return reports
+}
+
+// listRecordBatches returns the keys and sizes of the record batches of
+// topicName in storage.
+func listRecordBatches(ctx context.Context, storage Storage, topicName string) (map[string]int64, error) {
+	// NOTE: storages differ in whether File.Path is absolute, so files are
+	// keyed by their path relative to the topic.
+	sizes := make(map[string]int64)
+	err := walkFiles(ctx, storage, topicName, recordBatchExtension, func(file File) error {
+		sizes[path.Join(topicName, path.Base(file.Path))] = file.Size
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sizes, nil
+}
+
+func checksum(ctx context.Context, storage Storage, key string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+
+	rdr, err := storage.Reader(ctx, key)
+	if err != nil {
+		return sum, fmt.Errorf("opening '%s': %w", key, err)
+	}
+	defer rdr.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, rdr)
+	if err != nil {
+		return sum, fmt.Errorf("reading '%s': %w", key, err)
+	}
+
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
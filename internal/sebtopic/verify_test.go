@@ -0,0 +1,138 @@
+package sebtopic_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/stretchr/testify/require"
+)
+
+// TestVerifyReplicaConsistent verifies that no divergences are reported when
+// the follower is identical to the leader, or when it's lagging behind.
+func TestVerifyReplicaConsistent(t *testing.T) {
+	const topicName = "topic"
+	leader := sebtopic.NewDiskStorage(log, t.TempDir())
+	follower := sebtopic.NewMemoryStorage(log)
+
+	for offset := range uint64(5) {
+		bs := tester.RandomBytes(t, 128)
+		writeKey(t, leader, sebtopic.RecordBatchKey(topicName, offset), bs)
+
+		// follower is lagging behind
+		if offset < 3 {
+			writeKey(t, follower, sebtopic.RecordBatchKey(topicName, offset), bs)
+		}
+	}
+
+	// Act
+	divergences, err := sebtopic.VerifyReplica(context.Background(), leader, follower, topicName)
+
+	// Assert
+	require.NoError(t, err)
+	require.Empty(t, divergences)
+}
+
+// TestVerifyReplicaDivergences verifies that VerifyReplica reports record
+// batches that are missing, have different sizes, or have different contents.
+func TestVerifyReplicaDivergences(t *testing.T) {
+	const topicName = "topic"
+	leader := sebtopic.NewMemoryStorage(log)
+	follower := sebtopic.NewMemoryStorage(log)
+
+	key := func(offset uint64) string {
+		return sebtopic.RecordBatchKey(topicName, offset)
+	}
+
+	bs := tester.RandomBytes(t, 128)
+	writeKey(t, leader, key(0), bs)
+	writeKey(t, follower, key(0), bs)
+
+	// missing on follower
+	writeKey(t, leader, key(1), bs)
+
+	// size mismatch
+	writeKey(t, leader, key(2), bs)
+	writeKey(t, follower, key(2), bs[:64])
+
+	// checksum mismatch
+	corrupted := append([]byte{}, bs...)
+	corrupted[10] ^= 0xff
+	writeKey(t, leader, key(3), bs)
+	writeKey(t, follower, key(3), corrupted)
+
+	// missing on leader
+	writeKey(t, follower, key(4), bs)
+
+	// Act
+	divergences, err := sebtopic.VerifyReplica(context.Background(), leader, follower, topicName)
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, []sebtopic.Divergence{
+		{Key: key(1), Reason: sebtopic.DivergenceMissingOnFollower},
+		{Key: key(2), Reason: sebtopic.DivergenceSize},
+		{Key: key(3), Reason: sebtopic.DivergenceChecksum},
+		{Key: key(4), Reason: sebtopic.DivergenceMissingOnLeader},
+	}, divergences)
+}
+
+// TestReplicaVerificationLoop verifies that ReplicaVerificationLoop reports
+// divergences for each of the given topics.
+func TestReplicaVerificationLoop(t *testing.T) {
+	leader := sebtopic.NewMemoryStorage(log)
+	follower := sebtopic.NewMemoryStorage(log)
+	writeKey(t, follower, sebtopic.RecordBatchKey("b", 0), tester.RandomBytes(t, 16))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reports := make(chan map[string]int, 1)
+	go func() {
+		report := map[string]int{}
+		sebtopic.ReplicaVerificationLoop(ctx, log, leader, follower, func() []string { return []string{"a", "b"} }, time.Millisecond, func(topicName string, divergences []sebtopic.Divergence) {
+			report[topicName] = len(divergences)
+			if len(report) == 2 {
+				cancel()
+				reports <- report
+			}
+		})
+	}()
+
+	// Act, Assert
+	select {
+	case report := <-reports:
+		require.Equal(t, map[string]int{"a": 0, "b": 1}, report)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for reports")
+	}
+}
+
+// TestReplicaReports verifies that ReplicaReports keeps the latest report of
+// each topic, sorted by topic name.
+func TestReplicaReports(t *testing.T) {
+	reports := sebtopic.NewReplicaReports()
+	divergence := sebtopic.Divergence{Key: sebtopic.RecordBatchKey("b", 0), Reason: sebtopic.DivergenceChecksum}
+
+	// Act
+	reports.Report("b", []sebtopic.Divergence{divergence})
+	reports.Report("a", []sebtopic.Divergence{divergence})
+	reports.Report("a", nil)
+
+	// Assert
+	got := reports.Reports()
+	require.Len(t, got, 2)
+	require.Equal(t, "a", got[0].TopicName)
+	require.Empty(t, got[0].Divergences)
+	require.Equal(t, "b", got[1].TopicName)
+	require.Equal(t, []sebtopic.Divergence{divergence}, got[1].Divergences)
+	require.False(t, got[1].VerifiedAt.IsZero())
+}
+
+func writeKey(t *testing.T, storage sebtopic.Storage, key string, bs []byte) {
+	wtr, err := storage.Writer(context.Background(), key)
+	require.NoError(t, err)
+	tester.WriteAndClose(t, wtr, bs)
+}
@@ -0,0 +1,33 @@
+package sebtopic
+
+import "context"
+
+// WireSize makes the soft max bytes of reads account for the size of the
+// records once serialized, e.g. in an HTTP response, instead of only the size
+// of their data. This allows responses to be kept below limits on the size of
+// response bodies, e.g. those of proxies.
+type WireSize struct {
+	// FixedOverhead is the number of bytes that a read adds to the serialized
+	// records, independently of how many records are read.
+	FixedOverhead int
+
+	// RecordOverhead is the number of bytes that each record adds to the
+	// serialized records besides its data.
+	RecordOverhead int
+}
+
+type wireSizeKey struct{}
+
+// WithWireSize returns a copy of ctx that holds wireSize. Reads from a Topic
+// using the returned context count the overhead given by wireSize towards
+// their soft max bytes. As with soft max bytes in general, at least one record
+// is read, even if it doesn't fit.
+func WithWireSize(ctx context.Context, wireSize WireSize) context.Context {
+	return context.WithValue(ctx, wireSizeKey{}, wireSize)
+}
+
+// WireSizeFromContext returns the WireSize added to ctx by WithWireSize.
+func WireSizeFromContext(ctx context.Context) (WireSize, bool) {
+	wireSize, ok := ctx.Value(wireSizeKey{}).(WireSize)
+	return wireSize, ok
+}
@@ -0,0 +1,83 @@
+package sebtopic_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReadRecordsWireSize verifies that ReadRecords() counts the overhead
+// given by the WireSize of the given context towards softMaxBytes, and that at
+// least one record is returned even if the overhead alone exceeds it.
+func TestReadRecordsWireSize(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		topic, err := sebtopic.New(log, storage, "topic", cache)
+		require.NoError(t, err)
+
+		const recordSize = 10
+
+		records := [][]byte{}
+		for range 2 {
+			batch := tester.MakeRandomRecordBatchSize(10, recordSize)
+			records = append(records, batch.IndividualRecords()...)
+			_, err = topic.AddRecords(batch)
+			require.NoError(t, err)
+		}
+
+		tests := map[string]struct {
+			wireSize        *sebtopic.WireSize
+			softMaxBytes    int
+			expectedRecords [][]byte
+		}{
+			"payload only": {
+				softMaxBytes:    5 * recordSize,
+				expectedRecords: records[:5],
+			},
+			"record overhead": {
+				wireSize:        &sebtopic.WireSize{RecordOverhead: recordSize},
+				softMaxBytes:    5 * recordSize,
+				expectedRecords: records[:2],
+			},
+			"fixed overhead": {
+				wireSize:        &sebtopic.WireSize{FixedOverhead: 2 * recordSize},
+				softMaxBytes:    5 * recordSize,
+				expectedRecords: records[:3],
+			},
+			"fixed and record overhead": {
+				wireSize:        &sebtopic.WireSize{FixedOverhead: recordSize, RecordOverhead: recordSize / 2},
+				softMaxBytes:    15 * recordSize,
+				expectedRecords: records[:9],
+			},
+			"overhead exceeds soft max bytes": {
+				wireSize:        &sebtopic.WireSize{FixedOverhead: 100 * recordSize},
+				softMaxBytes:    5 * recordSize,
+				expectedRecords: records[:1],
+			},
+			"no soft max bytes": {
+				wireSize:        &sebtopic.WireSize{FixedOverhead: 100 * recordSize, RecordOverhead: recordSize},
+				expectedRecords: records,
+			},
+		}
+
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				ctx := context.Background()
+				if test.wireSize != nil {
+					ctx = sebtopic.WithWireSize(ctx, *test.wireSize)
+				}
+				gotBatch := tester.NewBatch(len(records), 4096)
+
+				// Act
+				err := topic.ReadRecords(ctx, &gotBatch, 0, len(records), test.softMaxBytes)
+
+				// Assert
+				require.NoError(t, err)
+				require.Equal(t, test.expectedRecords, gotBatch.IndividualRecords())
+			})
+		}
+	})
+}
@@ -0,0 +1,353 @@
+package sebtopic
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/micvbang/go-helpy/sizey"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/retry"
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+)
+
+// WriteBehindOpts configures write-behind of record batches. See
+// WithWriteBehind.
+type WriteBehindOpts struct {
+	// QueueSize is the maximum number of record batches waiting to be written
+	// to backing storage. Adding record batches blocks while it's reached.
+	// Write-behind is disabled if 0.
+	QueueSize int
+
+	// RetryInterval is the amount of time to wait before retrying a failed
+	// write to backing storage. It's doubled after each consecutive failure,
+	// up to MaxRetryInterval.
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+}
+
+// WriteBehindStats describes the record batches of a topic that are waiting
+// to be written to backing storage.
+type WriteBehindStats struct {
+	// Queued is the number of record batches waiting to be written, and
+	// QueuedRecords the number of records in them.
+	Queued        int
+	QueuedRecords uint64
+
+	// Written is the total number of record batches that were written, and
+	// Failures the total number of failed attempts at writing them.
+	Written  uint64
+	Failures uint64
+}
+
+// pendingBatch is a record batch that has been added to the topic, but not
+// yet written to backing storage.
+type pendingBatch struct {
+	name        RecordBatchName
+	batch       sebrecords.Batch
+	unixEpochUs int64
+	nextOffset  uint64
+}
+
+// writeBehind writes record batches to backing storage in the background, in
+// the order that they were added. Until a record batch has been written, its
+// records are kept in memory such that they can be put back into the cache if
+// they're evicted.
+type writeBehind struct {
+	log  logger.Logger
+	opts WriteBehindOpts
+	// write writes a record batch to backing storage, and written is called
+	// once it has been removed from the queue.
+	write   func(ctx context.Context, pb pendingBatch) error
+	written func(ctx context.Context)
+
+	mu    sync.Mutex
+	cond  *sync.Cond
+	queue []pendingBatch
+
+	numWritten  uint64
+	numFailures uint64
+
+	// stopped is set, and ctx cancelled, once the writer has been stopped;
+	// done is closed once run has returned, such that stop can wait for
+	// in-flight writes.
+	stopped bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+func newWriteBehind(log logger.Logger, opts WriteBehindOpts, write func(ctx context.Context, pb pendingBatch) error, written func(ctx context.Context)) *writeBehind {
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = 100 * time.Millisecond
+	}
+	if opts.MaxRetryInterval < opts.RetryInterval {
+		opts.MaxRetryInterval = max(30*time.Second, opts.RetryInterval)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wb := &writeBehind{
+		log:     log,
+		opts:    opts,
+		write:   write,
+		written: written,
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	wb.cond = sync.NewCond(&wb.mu)
+
+	go wb.run()
+
+	return wb
+}
+
+// enqueue queues batch to be written to backing storage, waiting while the
+// queue is full. batch is copied, and may be reused once enqueue returns.
+// Record batches enqueued after the writer has been stopped are dropped.
+func (wb *writeBehind) enqueue(name RecordBatchName, batch sebrecords.Batch, unixEpochUs int64) {
+	pb := pendingBatch{
+		name:        name,
+		batch:       batch.Clone(),
+		unixEpochUs: unixEpochUs,
+		nextOffset:  name.ID + uint64(batch.Len()),
+	}
+
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+
+	for len(wb.queue) >= wb.opts.QueueSize && !wb.stopped {
+		wb.cond.Wait()
+	}
+	if wb.stopped {
+		return
+	}
+	wb.queue = append(wb.queue, pb)
+	wb.cond.Broadcast()
+}
+
+// run writes queued record batches to backing storage, retrying failed
+// writes until they succeed. It returns once the writer has been stopped.
+func (wb *writeBehind) run() {
+	defer close(wb.done)
+
+	ctx := wb.ctx
+	retryInterval := wb.opts.RetryInterval
+
+	for {
+		wb.mu.Lock()
+		for len(wb.queue) == 0 && !wb.stopped {
+			wb.cond.Wait()
+		}
+		stopped := wb.stopped
+		wb.mu.Unlock()
+		if stopped {
+			return
+		}
+
+		err := wb.writeOldest(ctx)
+		if err != nil {
+			wb.log.Errorf("writing record batch behind, retrying in %s: %s", retryInterval, err)
+			if retry.Sleep(ctx, retryInterval) != nil {
+				return
+			}
+			retryInterval = min(2*retryInterval, wb.opts.MaxRetryInterval)
+			continue
+		}
+		retryInterval = wb.opts.RetryInterval
+	}
+}
+
+// writeOldest writes the oldest queued record batch to backing storage and
+// removes it from the queue.
+func (wb *writeBehind) writeOldest(ctx context.Context) error {
+	wb.mu.Lock()
+	if len(wb.queue) == 0 {
+		// NOTE: the writer was stopped.
+		wb.mu.Unlock()
+		return nil
+	}
+	pb := wb.queue[0]
+	wb.mu.Unlock()
+
+	err := wb.write(ctx, pb)
+
+	wb.mu.Lock()
+	if err != nil {
+		wb.numFailures += 1
+		wb.mu.Unlock()
+		return err
+	}
+
+	wb.numWritten += 1
+	// NOTE: the queue may have been discarded while pb was being written.
+	if len(wb.queue) > 0 && wb.queue[0].name == pb.name {
+		wb.queue[0] = pendingBatch{}
+		wb.queue = wb.queue[1:]
+	}
+	wb.cond.Broadcast()
+	wb.mu.Unlock()
+
+	wb.written(ctx)
+
+	return nil
+}
+
+// durableNextOffset returns the offset following the last record that has
+// been written to backing storage, given that the topic's next offset is
+// nextOffset.
+func (wb *writeBehind) durableNextOffset(nextOffset uint64) uint64 {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+
+	if len(wb.queue) == 0 {
+		return nextOffset
+	}
+	return min(nextOffset, wb.queue[0].name.ID)
+}
+
+// pending returns the record batch named name if it hasn't been written to
+// backing storage yet.
+func (wb *writeBehind) pending(name RecordBatchName) (pendingBatch, bool) {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+
+	for _, pb := range wb.queue {
+		if pb.name == name {
+			return pb, true
+		}
+	}
+	return pendingBatch{}, false
+}
+
+// flush waits for all record batches queued before it was called to be
+// written to backing storage.
+func (wb *writeBehind) flush(ctx context.Context) error {
+	wb.mu.Lock()
+	if len(wb.queue) == 0 {
+		wb.mu.Unlock()
+		return nil
+	}
+	last := wb.queue[len(wb.queue)-1].name
+	wb.mu.Unlock()
+
+	// NOTE: sync.Cond can't be waited on with a context, so the queue is
+	// polled instead.
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		wb.mu.Lock()
+		done := len(wb.queue) == 0 || wb.queue[0].name.ID > last.ID
+		wb.mu.Unlock()
+		if done {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for record batches to be written: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// stop drops all queued record batches and stops the writer, cancelling any
+// in-flight write and waiting for it to return.
+func (wb *writeBehind) stop() {
+	wb.mu.Lock()
+	wb.stopped = true
+	wb.queue = nil
+	wb.cond.Broadcast()
+	wb.mu.Unlock()
+
+	wb.cancel()
+	<-wb.done
+}
+
+func (wb *writeBehind) stats() WriteBehindStats {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+
+	stats := WriteBehindStats{
+		Queued:   len(wb.queue),
+		Written:  wb.numWritten,
+		Failures: wb.numFailures,
+	}
+	for _, pb := range wb.queue {
+		stats.QueuedRecords += uint64(pb.batch.Len())
+	}
+	return stats
+}
+
+// writeBehindBatch writes pb to backing storage.
+func (s *Topic) writeBehindBatch(ctx context.Context, pb pendingBatch) error {
+	rbPath := pb.name.Key(s.topicName)
+	t0 := time.Now()
+	err := s.writeRecordBatch(ctx, rbPath, pb.batch, pb.unixEpochUs)
+	if err != nil {
+		return err
+	}
+	s.log.WithField(logger.FieldBatchID, pb.name.ID).Infof("wrote %d records (%s bytes) behind to %s (%s)", pb.batch.Len(), sizey.FormatBytes(len(pb.batch.Data)), rbPath, time.Since(t0))
+
+	return nil
+}
+
+// wroteBehind updates the topic's manifest once a record batch has been
+// written to backing storage. The manifest and offset index only include
+// record batches that have been written; see durableNextOffset.
+func (s *Topic) wroteBehind(ctx context.Context) {
+	if s.manifest {
+		err := s.writeManifest(ctx)
+		if err != nil {
+			s.log.Errorf("writing manifest: %s", err)
+		}
+	}
+}
+
+// recachePending puts the record batch named name back into the cache if it
+// hasn't been written to backing storage yet. It returns false if the record
+// batch isn't pending.
+func (s *Topic) recachePending(ctx context.Context, name RecordBatchName) (bool, error) {
+	if s.writeBehind == nil {
+		return false, nil
+	}
+
+	pb, ok := s.writeBehind.pending(name)
+	if !ok {
+		return false, nil
+	}
+
+	return true, s.cacheRecordBatch(ctx, name.Key(s.topicName), pb.batch, pb.unixEpochUs)
+}
+
+// durableNextOffset returns the offset following the last record that has
+// been written to backing storage. This is the topic's next offset unless
+// write-behind is enabled.
+func (s *Topic) durableNextOffset() uint64 {
+	nextOffset := s.nextOffset.Load()
+	if s.writeBehind == nil {
+		return nextOffset
+	}
+	return s.writeBehind.durableNextOffset(nextOffset)
+}
+
+// FlushWrites waits for the record batches that have been added to the topic
+// to be written to backing storage. It's a no-op for topics that don't use
+// write-behind. See WithWriteBehind.
+func (s *Topic) FlushWrites(ctx context.Context) error {
+	if s.writeBehind == nil {
+		return nil
+	}
+	return s.writeBehind.flush(ctx)
+}
+
+// WriteBehindStats returns statistics of the record batches waiting to be
+// written to backing storage. The zero value is returned for topics that
+// don't use write-behind.
+func (s *Topic) WriteBehindStats() WriteBehindStats {
+	if s.writeBehind == nil {
+		return WriteBehindStats{}
+	}
+	return s.writeBehind.stats()
+}
@@ -0,0 +1,314 @@
+package sebtopic_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWriteBehindReadableBeforeWritten verifies that records added to a topic
+// using write-behind are returned and readable before their record batch has
+// been written to backing storage, also if the record batch is evicted from
+// the cache, and that they're written once backing storage allows it.
+func TestWriteBehindReadableBeforeWritten(t *testing.T) {
+	const topicName = "topic"
+	ctx := context.Background()
+	storage := sebtopic.NewMemoryStorage(log)
+
+	blocked := make(chan struct{})
+	backingStorage := forwardingStorage(storage)
+	backingStorage.WriterMock = func(ctx context.Context, key string) (io.WriteCloser, error) {
+		if strings.HasSuffix(key, ".record_batch") {
+			<-blocked
+		}
+		return storage.Writer(ctx, key)
+	}
+
+	cache := newMemoryCache(t)
+	topic, err := sebtopic.New(log, backingStorage, topicName, cache, sebtopic.WithWriteBehind(4, time.Millisecond))
+	require.NoError(t, err)
+
+	batch := tester.MakeRandomRecordBatch(3)
+
+	// Act
+	offsets, err := topic.AddRecords(batch)
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, []uint64{0, 1, 2}, offsets)
+	require.Equal(t, uint64(3), topic.NextOffset())
+	require.Equal(t, 1, topic.WriteBehindStats().Queued)
+
+	_, err = storage.Reader(ctx, sebtopic.RecordBatchKey(topicName, 0))
+	require.ErrorIs(t, err, seberr.ErrNotInStorage)
+
+	// evicted record batches are cached again from the write-behind queue
+	err = cache.Remove(sebtopic.RecordBatchKey(topicName, 0))
+	require.NoError(t, err)
+
+	gotBatch := tester.NewBatch(3, 4096)
+	err = topic.ReadRecords(ctx, &gotBatch, 0, 3, 0)
+	require.NoError(t, err)
+	require.Equal(t, batch.IndividualRecords(), gotBatch.IndividualRecords())
+
+	// Act
+	close(blocked)
+	err = topic.FlushWrites(ctx)
+	require.NoError(t, err)
+
+	// Assert
+	stats := topic.WriteBehindStats()
+	require.Equal(t, 0, stats.Queued)
+	require.Equal(t, uint64(1), stats.Written)
+
+	reopened, err := sebtopic.New(log, storage, topicName, newMemoryCache(t))
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), reopened.NextOffset())
+
+	gotBatch = tester.NewBatch(3, 4096)
+	err = reopened.ReadRecords(ctx, &gotBatch, 0, 3, 0)
+	require.NoError(t, err)
+	require.Equal(t, batch.IndividualRecords(), gotBatch.IndividualRecords())
+}
+
+// TestWriteBehindRetries verifies that failed writes to backing storage are
+// retried until they succeed.
+func TestWriteBehindRetries(t *testing.T) {
+	const topicName = "topic"
+	ctx := context.Background()
+	storage := sebtopic.NewMemoryStorage(log)
+
+	failures := atomic.Int32{}
+	backingStorage := forwardingStorage(storage)
+	backingStorage.WriterMock = func(ctx context.Context, key string) (io.WriteCloser, error) {
+		if strings.HasSuffix(key, ".record_batch") && failures.Add(1) <= 3 {
+			return nil, fmt.Errorf("storage unavailable")
+		}
+		return storage.Writer(ctx, key)
+	}
+
+	topic, err := sebtopic.New(log, backingStorage, topicName, newMemoryCache(t), sebtopic.WithWriteBehind(4, time.Millisecond))
+	require.NoError(t, err)
+
+	for range 2 {
+		_, err = topic.AddRecords(tester.MakeRandomRecordBatch(2))
+		require.NoError(t, err)
+	}
+
+	// Act
+	err = topic.FlushWrites(ctx)
+
+	// Assert
+	require.NoError(t, err)
+	stats := topic.WriteBehindStats()
+	require.Equal(t, uint64(3), stats.Failures)
+	require.Equal(t, uint64(2), stats.Written)
+
+	for _, batchID := range []uint64{0, 2} {
+		_, err = storage.Reader(ctx, sebtopic.RecordBatchKey(topicName, batchID))
+		require.NoError(t, err)
+	}
+}
+
+// TestWriteBehindManifest verifies that the topic's manifest and offset index
+// only include record batches that have been written to backing storage, such
+// that a topic opened before the writes finish sees a consistent prefix.
+func TestWriteBehindManifest(t *testing.T) {
+	const topicName = "topic"
+	ctx := context.Background()
+	storage := sebtopic.NewMemoryStorage(log)
+
+	blocked := atomic.Bool{}
+	release := make(chan struct{})
+	backingStorage := forwardingStorage(storage)
+	backingStorage.WriterMock = func(ctx context.Context, key string) (io.WriteCloser, error) {
+		if strings.HasSuffix(key, ".record_batch") && blocked.Load() {
+			<-release
+		}
+		return storage.Writer(ctx, key)
+	}
+
+	optFuncs := []func(*sebtopic.Opts){sebtopic.WithManifest(true), sebtopic.WithOffsetIndexInterval(1)}
+	topic, err := sebtopic.New(log, backingStorage, topicName, newMemoryCache(t), append(optFuncs, sebtopic.WithWriteBehind(4, time.Millisecond))...)
+	require.NoError(t, err)
+
+	_, err = topic.AddRecords(tester.MakeRandomRecordBatch(2))
+	require.NoError(t, err)
+	err = topic.FlushWrites(ctx)
+	require.NoError(t, err)
+
+	// Act
+	blocked.Store(true)
+	_, err = topic.AddRecords(tester.MakeRandomRecordBatch(3))
+	require.NoError(t, err)
+
+	// Assert
+	opened, err := sebtopic.New(log, storage, topicName, newMemoryCache(t), optFuncs...)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), opened.NextOffset())
+
+	// Act
+	close(release)
+	err = topic.FlushWrites(ctx)
+	require.NoError(t, err)
+
+	// Assert
+	opened, err = sebtopic.New(log, storage, topicName, newMemoryCache(t), optFuncs...)
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), opened.NextOffset())
+}
+
+// TestWriteBehindQueueFull verifies that adding records blocks while the
+// write-behind queue is full.
+func TestWriteBehindQueueFull(t *testing.T) {
+	ctx := context.Background()
+	storage := sebtopic.NewMemoryStorage(log)
+
+	release := make(chan struct{})
+	backingStorage := forwardingStorage(storage)
+	backingStorage.WriterMock = func(ctx context.Context, key string) (io.WriteCloser, error) {
+		if strings.HasSuffix(key, ".record_batch") {
+			<-release
+		}
+		return storage.Writer(ctx, key)
+	}
+
+	topic, err := sebtopic.New(log, backingStorage, "topic", newMemoryCache(t), sebtopic.WithWriteBehind(1, time.Millisecond))
+	require.NoError(t, err)
+
+	_, err = topic.AddRecords(tester.MakeRandomRecordBatch(1))
+	require.NoError(t, err)
+
+	// Act
+	added := make(chan struct{})
+	go func() {
+		defer close(added)
+		_, err := topic.AddRecords(tester.MakeRandomRecordBatch(1))
+		require.NoError(t, err)
+	}()
+
+	// Assert
+	select {
+	case <-added:
+		t.Fatalf("expected AddRecords to block while the queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	<-added
+
+	err = topic.FlushWrites(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), topic.WriteBehindStats().Written)
+}
+
+// TestWriteBehindRecachesMetadata verifies that record batches that are put
+// back into the cache from the write-behind queue keep the per-record
+// metadata of their records, such that expired records are still skipped and
+// large records are still read from where they were offloaded.
+func TestWriteBehindRecachesMetadata(t *testing.T) {
+	const topicName = "topic"
+	ctx := context.Background()
+	storage := sebtopic.NewMemoryStorage(log)
+
+	blocked := make(chan struct{})
+	backingStorage := forwardingStorage(storage)
+	backingStorage.WriterMock = func(ctx context.Context, key string) (io.WriteCloser, error) {
+		if strings.HasSuffix(key, ".record_batch") {
+			<-blocked
+		}
+		return storage.Writer(ctx, key)
+	}
+
+	cache := newMemoryCache(t)
+	topic, err := sebtopic.New(log, backingStorage, topicName, cache, sebtopic.WithWriteBehind(4, time.Millisecond), sebtopic.WithLargeRecordThreshold(largeRecordThreshold))
+	require.NoError(t, err)
+
+	expired := time.Now().Add(-time.Hour).UnixMicro()
+	batch := tester.RecordsToBatch([][]byte{
+		tester.RandomBytes(t, 2*largeRecordThreshold),
+		tester.RandomBytes(t, 10),
+		tester.RandomBytes(t, 10),
+	})
+	batch.Expires = []int64{0, expired, 0}
+	records := batch.IndividualRecords()
+	expected := [][]byte{records[0], records[2]}
+
+	_, err = topic.AddRecords(batch)
+	require.NoError(t, err)
+
+	err = cache.Remove(sebtopic.RecordBatchKey(topicName, 0))
+	require.NoError(t, err)
+
+	// Act
+	gotBatch := tester.NewBatch(3, 4*largeRecordThreshold)
+	err = topic.ReadRecords(ctx, &gotBatch, 0, 3, 0)
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, expected, gotBatch.IndividualRecords())
+	require.Equal(t, 1, gotBatch.Skipped)
+
+	// records written from the write-behind queue also keep their metadata
+	close(blocked)
+	err = topic.FlushWrites(ctx)
+	require.NoError(t, err)
+
+	reopened, err := sebtopic.New(log, storage, topicName, newMemoryCache(t))
+	require.NoError(t, err)
+
+	gotBatch = tester.NewBatch(3, 4*largeRecordThreshold)
+	err = reopened.ReadRecords(ctx, &gotBatch, 0, 3, 0)
+	require.NoError(t, err)
+	require.Equal(t, expected, gotBatch.IndividualRecords())
+}
+
+// TestWriteBehindDeleteStopsWriter verifies that deleting a topic stops its
+// write-behind writer, cancelling the in-flight write, and that the queued
+// record batch is never written.
+func TestWriteBehindDeleteStopsWriter(t *testing.T) {
+	const topicName = "topic"
+	ctx := context.Background()
+	storage := sebtopic.NewMemoryStorage(log)
+
+	backingStorage := forwardingStorage(storage)
+	backingStorage.WriterMock = func(ctx context.Context, key string) (io.WriteCloser, error) {
+		if strings.HasSuffix(key, ".record_batch") {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return storage.Writer(ctx, key)
+	}
+
+	topic, err := sebtopic.New(log, backingStorage, topicName, newMemoryCache(t), sebtopic.WithWriteBehind(4, time.Millisecond))
+	require.NoError(t, err)
+
+	_, err = topic.AddRecords(tester.MakeRandomRecordBatch(2))
+	require.NoError(t, err)
+
+	// Act
+	deleted := make(chan error)
+	go func() {
+		deleted <- topic.Delete()
+	}()
+
+	// Assert
+	select {
+	case err := <-deleted:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatalf("expected Delete to stop the write-behind writer")
+	}
+
+	_, err = storage.Reader(ctx, sebtopic.RecordBatchKey(topicName, 0))
+	require.ErrorIs(t, err, seberr.ErrNotInStorage)
+}
@@ -0,0 +1,174 @@
+package sebtopic
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// RecordsWriter writes the data of records found by PrepareRecords.
+type RecordsWriter struct {
+	// NOTE: WriteTo can't take a context, so the one given to PrepareRecords
+	// is kept for reading record batches and large records.
+	ctx   context.Context
+	topic *Topic
+	parse func(ctx context.Context, recordBatchID uint64) (*sebrecords.Parser, error)
+	spans []recordSpan
+}
+
+// recordSpan is a run of records in the record batch at batchOffset, or a
+// single large record if key is set.
+type recordSpan struct {
+	batchOffset      uint64
+	recordIndexStart uint32
+	recordIndexEnd   uint32
+
+	key  string
+	size uint32
+}
+
+// PrepareRecords finds the records that ReadRecords would read into batch,
+// but only adds their sizes to batch. The returned RecordsWriter writes their
+// data, without reading it into memory first.
+//
+// This allows callers to write large amounts of record data, e.g. to a network
+// connection, without an intermediate buffer. Since the data isn't read into
+// batch, the size of batch.Data doesn't limit the number of bytes found.
+//
+// Like ReadRecords, the returned RecordsWriter should be used even if err is
+// non-nil; it writes the records whose sizes were added to batch.
+func (s *Topic) PrepareRecords(ctx context.Context, batch *sebrecords.Batch, offset uint64, maxRecords int, softMaxBytes int) (*RecordsWriter, error) {
+	spans := &recordSpans{batch: batch}
+	err := s.readRecords(ctx, batch, spans, offset, maxRecords, softMaxBytes)
+
+	parse := s.parseRecordBatch
+	if maxRecords == 1 {
+		parse = s.parseRecordBatchRange
+	}
+
+	return &RecordsWriter{
+		ctx:   ctx,
+		topic: s,
+		parse: parse,
+		spans: spans.spans,
+	}, err
+}
+
+// WriteRecordsTo writes the data of the records that ReadRecords would read
+// into batch to w, adding their sizes to batch. See PrepareRecords.
+func (s *Topic) WriteRecordsTo(ctx context.Context, w io.Writer, batch *sebrecords.Batch, offset uint64, maxRecords int, softMaxBytes int) error {
+	rw, readErr := s.PrepareRecords(ctx, batch, offset, maxRecords, softMaxBytes)
+
+	_, err := rw.WriteTo(w)
+	if err != nil {
+		return err
+	}
+
+	return readErr
+}
+
+// WriteTo writes the record data to w. It implements io.WriterTo.
+//
+// Record batches are read again when they're written, so records that are
+// deleted between PrepareRecords and WriteTo, e.g. because they expired,
+// cause WriteTo to fail.
+func (rw *RecordsWriter) WriteTo(w io.Writer) (int64, error) {
+	var (
+		written     int64
+		rb          *sebrecords.Parser
+		batchOffset uint64
+	)
+	defer func() {
+		if rb != nil {
+			rb.Close()
+		}
+	}()
+
+	for _, span := range rw.spans {
+		if span.key != "" {
+			n, err := rw.writeLargeRecord(w, span.key, span.size)
+			written += n
+			if err != nil {
+				return written, err
+			}
+			continue
+		}
+
+		// consecutive spans are often from the same record batch, e.g. when
+		// they're separated by expired records.
+		if rb == nil || batchOffset != span.batchOffset {
+			if rb != nil {
+				rb.Close()
+			}
+
+			var err error
+			rb, err = rw.parse(rw.ctx, span.batchOffset)
+			if err != nil {
+				rb = nil
+				return written, fmt.Errorf("parsing record batch: %w", err)
+			}
+			batchOffset = span.batchOffset
+		}
+
+		n, err := rb.WriteRecordsTo(w, span.recordIndexStart, span.recordIndexEnd)
+		written += n
+		if err != nil {
+			return written, fmt.Errorf("record batch '%s': %w", rw.topic.recordBatchPath(span.batchOffset), err)
+		}
+	}
+
+	return written, nil
+}
+
+func (rw *RecordsWriter) writeLargeRecord(w io.Writer, key string, size uint32) (int64, error) {
+	rdr, err := rw.topic.backingStorage.Reader(rw.ctx, key)
+	if err != nil {
+		return 0, fmt.Errorf("opening large record '%s': %w", key, err)
+	}
+	defer rdr.Close()
+
+	n, err := io.CopyN(w, rdr, int64(size))
+	if err != nil {
+		return n, fmt.Errorf("writing large record '%s': %w", key, err)
+	}
+
+	return n, nil
+}
+
+// recordSpans collects the records found by readRecords as recordSpans,
+// adding their sizes to batch.
+type recordSpans struct {
+	batch *sebrecords.Batch
+	spans []recordSpan
+}
+
+func (rs *recordSpans) records(rb *sebrecords.Parser, batchOffset uint64, recordIndexStart uint32, recordIndexEnd uint32) error {
+	requestedRecords := int(recordIndexEnd - recordIndexStart)
+	recordsLeftInBatch := cap(rs.batch.Sizes) - len(rs.batch.Sizes)
+	if requestedRecords > recordsLeftInBatch {
+		return fmt.Errorf("%w: not enough records left in buffer to satisfy read; %d required, %d left", seberr.ErrBufferTooSmall, requestedRecords, recordsLeftInBatch)
+	}
+
+	rs.batch.Sizes = append(rs.batch.Sizes, rb.RecordSizes[recordIndexStart:recordIndexEnd]...)
+	rs.spans = append(rs.spans, recordSpan{
+		batchOffset:      batchOffset,
+		recordIndexStart: recordIndexStart,
+		recordIndexEnd:   recordIndexEnd,
+	})
+
+	return nil
+}
+
+func (rs *recordSpans) largeRecord(_ context.Context, key string, size uint32) error {
+	if rs.batch.Len() == cap(rs.batch.Sizes) {
+		return fmt.Errorf("%w: not enough records left in buffer to read large record", seberr.ErrBufferTooSmall)
+	}
+
+	rs.batch.Sizes = append(rs.batch.Sizes, size)
+	rs.spans = append(rs.spans, recordSpan{key: key, size: size})
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package sebtopic_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWriteRecordsTo verifies that WriteRecordsTo writes the same records as
+// ReadRecords reads, across record batches and with expired and large records.
+func TestWriteRecordsTo(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		topic, err := sebtopic.New(log, storage, "topic", cache, sebtopic.WithLargeRecordThreshold(largeRecordThreshold))
+		require.NoError(t, err)
+
+		_, err = topic.AddRecords(tester.MakeRandomRecordBatch(3))
+		require.NoError(t, err)
+
+		batch := tester.RecordsToBatch([][]byte{
+			tester.RandomBytes(t, 10),
+			tester.RandomBytes(t, 20),
+			tester.RandomBytes(t, 2*largeRecordThreshold),
+			tester.RandomBytes(t, 30),
+		})
+		batch.Expires = []int64{0, time.Now().Add(-time.Hour).UnixMicro(), 0, 0}
+		_, err = topic.AddRecords(batch)
+		require.NoError(t, err)
+
+		_, err = topic.AddRecords(tester.MakeRandomRecordBatch(2))
+		require.NoError(t, err)
+
+		tests := map[string]struct {
+			offset       uint64
+			maxRecords   int
+			softMaxBytes int
+		}{
+			"all":          {offset: 0, maxRecords: 100},
+			"single":       {offset: 4, maxRecords: 1},
+			"large record": {offset: 5, maxRecords: 1},
+			"max bytes":    {offset: 2, maxRecords: 100, softMaxBytes: 100},
+		}
+
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				expectedBatch := tester.NewBatch(100, 10*largeRecordThreshold)
+				err := topic.ReadRecords(context.Background(), &expectedBatch, test.offset, test.maxRecords, test.softMaxBytes)
+				require.NoError(t, err)
+
+				// Act
+				buf := bytes.NewBuffer(nil)
+				gotBatch := sebrecords.Batch{Sizes: make([]uint32, 0, 100)}
+				err = topic.WriteRecordsTo(context.Background(), buf, &gotBatch, test.offset, test.maxRecords, test.softMaxBytes)
+
+				// Assert
+				require.NoError(t, err)
+				require.Equal(t, expectedBatch.Sizes, gotBatch.Sizes)
+				require.Equal(t, expectedBatch.Skipped, gotBatch.Skipped)
+				require.Equal(t, expectedBatch.Data, buf.Bytes())
+			})
+		}
+	})
+}
+
+// TestPrepareRecordsBufferTooSmall verifies that PrepareRecords returns
+// ErrBufferTooSmall when batch can't hold the sizes of the records, and that
+// the returned RecordsWriter writes the records whose sizes were added.
+func TestPrepareRecordsBufferTooSmall(t *testing.T) {
+	tester.TestTopicStorageAndCache(t, func(t *testing.T, storage sebtopic.Storage, cache *sebcache.Cache) {
+		topic, err := sebtopic.New(log, storage, "topic", cache)
+		require.NoError(t, err)
+
+		for range 3 {
+			_, err = topic.AddRecords(tester.MakeRandomRecordBatch(2))
+			require.NoError(t, err)
+		}
+
+		expectedBatch := tester.NewBatch(3, 4096)
+		err = topic.ReadRecords(context.Background(), &expectedBatch, 0, 6, 0)
+		require.ErrorIs(t, err, seberr.ErrBufferTooSmall)
+
+		// Act
+		batch := sebrecords.Batch{Sizes: make([]uint32, 0, 3)}
+		rw, err := topic.PrepareRecords(context.Background(), &batch, 0, 6, 0)
+
+		// Assert
+		require.ErrorIs(t, err, seberr.ErrBufferTooSmall)
+		require.Equal(t, expectedBatch.Sizes, batch.Sizes)
+
+		buf := bytes.NewBuffer(nil)
+		n, err := rw.WriteTo(buf)
+		require.NoError(t, err)
+		require.Equal(t, int64(len(expectedBatch.Data)), n)
+		require.Equal(t, expectedBatch.Data, buf.Bytes())
+	})
+}
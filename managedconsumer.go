@@ -0,0 +1,213 @@
+package seb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+type ManagedConsumerOpts struct {
+	// CommitInterval is the minimum time between commits of the consumer
+	// group's offset. Records processed since the latest commit are delivered
+	// again if the consumer stops without committing. If 0, the offset is
+	// committed after each batch of records. Defaults to 5s.
+	CommitInterval time.Duration
+
+	// StartOffset is the offset to start consuming from if the consumer group
+	// hasn't committed an offset for the topic. Defaults to 0.
+	StartOffset uint64
+
+	// PollInterval is how long to wait before reading again while the topic
+	// doesn't exist, or delivery to the consumer group is paused. Defaults to
+	// 1s.
+	PollInterval time.Duration
+}
+
+// WithManagedCommitInterval sets the minimum time between commits of the
+// consumer group's offset.
+func WithManagedCommitInterval(commitInterval time.Duration) func(*ManagedConsumerOpts) {
+	return func(o *ManagedConsumerOpts) {
+		o.CommitInterval = commitInterval
+	}
+}
+
+// WithManagedStartOffset sets the offset to start consuming from if the
+// consumer group hasn't committed an offset for the topic.
+func WithManagedStartOffset(startOffset uint64) func(*ManagedConsumerOpts) {
+	return func(o *ManagedConsumerOpts) {
+		o.StartOffset = startOffset
+	}
+}
+
+// WithManagedPollInterval sets how long to wait before reading again while
+// records can't be read.
+func WithManagedPollInterval(pollInterval time.Duration) func(*ManagedConsumerOpts) {
+	return func(o *ManagedConsumerOpts) {
+		o.PollInterval = pollInterval
+	}
+}
+
+// ManagedConsumer consumes records from a topic on behalf of a consumer group,
+// giving them to a process function and periodically committing the group's
+// offset, such that consumers don't have to keep track of their offsets.
+//
+// Records are delivered at least once: the offset of records is only
+// committed after they have been processed, and records that were processed
+// after the latest commit are delivered again if the consumer stops without
+// committing, e.g. because it crashed.
+//
+// ManagedConsumer is not safe for concurrent use.
+type ManagedConsumer struct {
+	client    *RecordClient
+	group     string
+	topicName string
+	opts      ManagedConsumerOpts
+
+	loaded     bool
+	offset     uint64
+	committed  uint64
+	lastCommit time.Time
+}
+
+// NewManagedConsumer returns a ManagedConsumer that consumes topicName on
+// behalf of group. Consuming starts from the offset most recently committed
+// by group.
+func NewManagedConsumer(client *RecordClient, group string, topicName string, optFuncs ...func(*ManagedConsumerOpts)) *ManagedConsumer {
+	opts := ManagedConsumerOpts{
+		CommitInterval: 5 * time.Second,
+		PollInterval:   time.Second,
+	}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+
+	return &ManagedConsumer{
+		client:    client,
+		group:     group,
+		topicName: topicName,
+		opts:      opts,
+	}
+}
+
+// Run reads records using input and gives them to process, until ctx expires
+// or an error occurs. The group's offset is committed every CommitInterval,
+// and when Run returns.
+//
+// If process returns an error, Run commits the offset of the records that
+// were processed before them and returns the error; the records given to the
+// failed call are delivered again when consuming is continued.
+//
+// Since reads can't be interrupted, Run may return up to input.Timeout after
+// ctx expires. input.Timeout therefore defaults to 1s.
+//
+// NOTE: if input.Buffer is given, it's reused by every read; the records given
+// to process must not be used after process returns.
+func (c *ManagedConsumer) Run(ctx context.Context, input GetRecordsInput, process func(records [][]byte) error) error {
+	if input.Timeout == 0 {
+		input.Timeout = time.Second
+	}
+	input.Group = c.group
+	buffer := input.Buffer
+
+	err := c.load()
+	if err != nil {
+		return err
+	}
+
+	for ctx.Err() == nil {
+		// NOTE: the buffer backs the records given to process; it can be
+		// reused once they have been processed.
+		if buffer != nil {
+			input.Buffer = buffer[:0]
+		}
+
+		records, nextOffset, err := c.client.GetRecordsNextOffset(c.topicName, c.offset, input)
+		if err != nil {
+			if errors.Is(err, seberr.ErrNotFound) || errors.Is(err, seberr.ErrGroupPaused) || errors.Is(err, seberr.ErrOffsetOutOfBounds) {
+				sleep(ctx, c.opts.PollInterval)
+				continue
+			}
+			return errors.Join(fmt.Errorf("getting records from offset %d: %w", c.offset, err), c.Commit())
+		}
+
+		if len(records) > 0 {
+			err = process(records)
+			if err != nil {
+				return errors.Join(fmt.Errorf("processing records from offset %d: %w", c.offset, err), c.Commit())
+			}
+		}
+		c.offset = nextOffset
+
+		if time.Since(c.lastCommit) >= c.opts.CommitInterval {
+			err = c.Commit()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return c.Commit()
+}
+
+// Commit commits the offset following the records that have been processed as
+// the group's offset, if it has changed since the latest commit.
+func (c *ManagedConsumer) Commit() error {
+	if !c.loaded || c.offset == c.committed {
+		return nil
+	}
+
+	err := c.client.CommitGroupOffset(c.group, c.topicName, c.offset)
+	if err != nil {
+		return fmt.Errorf("committing offset %d of group '%s': %w", c.offset, c.group, err)
+	}
+	c.committed = c.offset
+	c.lastCommit = time.Now()
+
+	return nil
+}
+
+// Offset returns the offset following the records that have been processed,
+// i.e. the offset that is committed by the next commit.
+func (c *ManagedConsumer) Offset() uint64 {
+	return c.offset
+}
+
+// load loads the offset most recently committed by the consumer group, if it
+// hasn't been loaded yet.
+func (c *ManagedConsumer) load() error {
+	if c.loaded {
+		return nil
+	}
+
+	offset := c.opts.StartOffset
+	lag, err := c.client.GetGroupLag(c.group)
+	if err != nil && !errors.Is(err, seberr.ErrNotFound) {
+		return fmt.Errorf("getting offsets of group '%s': %w", c.group, err)
+	}
+	for _, topic := range lag.Topics {
+		if topic.TopicName == c.topicName {
+			offset = topic.CommittedOffset
+		}
+	}
+
+	c.offset = offset
+	c.committed = offset
+	c.lastCommit = time.Now()
+	c.loaded = true
+
+	return nil
+}
+
+// sleep waits for d, or until ctx expires.
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
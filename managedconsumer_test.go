@@ -0,0 +1,170 @@
+package seb_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	seb "github.com/micvbang/simple-event-broker"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestManagedConsumerCommits verifies that ManagedConsumer delivers all
+// records to the process function, commits the group's offset, and that a
+// new ManagedConsumer of the same group continues from the committed offset.
+func TestManagedConsumerCommits(t *testing.T) {
+	const (
+		topicName = "topic"
+		group     = "group"
+	)
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	batch := tester.MakeRandomRecordBatch(10)
+	err = client.AddRecords(topicName, batch.Sizes, batch.Data)
+	require.NoError(t, err)
+
+	consume := func(expectedRecords int) [][]byte {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		got := [][]byte{}
+		consumer := seb.NewManagedConsumer(client, group, topicName, seb.WithManagedCommitInterval(0))
+		err := consumer.Run(ctx, seb.GetRecordsInput{MaxRecords: 3, Timeout: 10 * time.Millisecond}, func(records [][]byte) error {
+			got = append(got, records...)
+			if len(got) >= expectedRecords {
+				cancel()
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		return got
+	}
+
+	// Act
+	got := consume(batch.Len())
+
+	// Assert
+	require.Equal(t, batch.IndividualRecords(), got)
+	requireCommittedOffset(t, client, group, topicName, 10)
+
+	moreBatch := tester.MakeRandomRecordBatch(2)
+	err = client.AddRecords(topicName, moreBatch.Sizes, moreBatch.Data)
+	require.NoError(t, err)
+
+	// Act
+	got = consume(moreBatch.Len())
+
+	// Assert
+	require.Equal(t, moreBatch.IndividualRecords(), got)
+	requireCommittedOffset(t, client, group, topicName, 12)
+}
+
+// TestManagedConsumerCommitInterval verifies that ManagedConsumer doesn't
+// commit the group's offset more often than its commit interval, and that it
+// commits the offset of the processed records when Run returns.
+func TestManagedConsumerCommitInterval(t *testing.T) {
+	const (
+		topicName = "topic"
+		group     = "group"
+	)
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	batch := tester.MakeRandomRecordBatch(4)
+	err = client.AddRecords(topicName, batch.Sizes, batch.Data)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Act
+	processed := 0
+	consumer := seb.NewManagedConsumer(client, group, topicName, seb.WithManagedCommitInterval(time.Hour))
+	err = consumer.Run(ctx, seb.GetRecordsInput{MaxRecords: 2, Timeout: 10 * time.Millisecond}, func(records [][]byte) error {
+		processed += len(records)
+
+		// nothing has been committed while processing
+		_, err := client.GetGroupLag(group)
+		require.ErrorIs(t, err, seberr.ErrNotFound)
+
+		if processed == batch.Len() {
+			cancel()
+		}
+		return nil
+	})
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), consumer.Offset())
+	requireCommittedOffset(t, client, group, topicName, 4)
+}
+
+// TestManagedConsumerProcessError verifies that ManagedConsumer returns the
+// error of the process function after committing the offset of the records
+// processed before it, such that the failed records are delivered again.
+func TestManagedConsumerProcessError(t *testing.T) {
+	const (
+		topicName = "topic"
+		group     = "group"
+	)
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	batch := tester.MakeRandomRecordBatch(4)
+	err = client.AddRecords(topicName, batch.Sizes, batch.Data)
+	require.NoError(t, err)
+
+	errProcess := errors.New("processing failed")
+	input := seb.GetRecordsInput{MaxRecords: 2, Timeout: 10 * time.Millisecond}
+
+	// Act
+	calls := 0
+	consumer := seb.NewManagedConsumer(client, group, topicName, seb.WithManagedCommitInterval(time.Hour))
+	err = consumer.Run(context.Background(), input, func(records [][]byte) error {
+		calls += 1
+		if calls == 2 {
+			return errProcess
+		}
+		return nil
+	})
+
+	// Assert
+	require.ErrorIs(t, err, errProcess)
+	requireCommittedOffset(t, client, group, topicName, 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	got := [][]byte{}
+	consumer = seb.NewManagedConsumer(client, group, topicName)
+	err = consumer.Run(ctx, input, func(records [][]byte) error {
+		got = append(got, records...)
+		cancel()
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, batch.IndividualRecords()[2:], got)
+}
+
+func requireCommittedOffset(t *testing.T, client *seb.RecordClient, group string, topicName string, expected uint64) {
+	t.Helper()
+
+	lag, err := client.GetGroupLag(group)
+	require.NoError(t, err)
+	require.Len(t, lag.Topics, 1)
+	require.Equal(t, topicName, lag.Topics[0].TopicName)
+	require.Equal(t, expected, lag.Topics[0].CommittedOffset)
+}
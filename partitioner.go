@@ -0,0 +1,131 @@
+package seb
+
+import (
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+)
+
+// Partitioner decides which partition of a topic a record is added to.
+//
+// NOTE: the broker does not yet have a notion of partitions; partitioners are
+// provided so that applications can spread records over multiple topics, e.g.
+// "orders-0", "orders-1", ..., while keeping the key→partition mapping stable.
+type Partitioner interface {
+	// Partition returns the partition in the range [0; numPartitions) that
+	// the record with the given key should be added to. key may be nil.
+	Partition(key []byte, numPartitions int) int
+}
+
+// PartitionerFunc is an adapter that allows the use of ordinary functions as
+// Partitioners.
+type PartitionerFunc func(key []byte, numPartitions int) int
+
+func (f PartitionerFunc) Partition(key []byte, numPartitions int) int {
+	return f(key, numPartitions)
+}
+
+// NewMurmur2Partitioner returns a Partitioner that assigns records to
+// partitions by hashing their keys using murmur2. Keys are assigned to the
+// same partitions as by Kafka's default partitioner, so that the key→partition
+// mapping is stable across client implementations for a given number of
+// partitions.
+//
+// Records without a key are assigned using keyless, defaulting to
+// NewStickyPartitioner(1024) if nil.
+func NewMurmur2Partitioner(keyless Partitioner) Partitioner {
+	if keyless == nil {
+		keyless = NewStickyPartitioner(1024)
+	}
+
+	return PartitionerFunc(func(key []byte, numPartitions int) int {
+		if key == nil {
+			return keyless.Partition(key, numPartitions)
+		}
+
+		return int(Murmur2(key)&0x7fffffff) % numPartitions
+	})
+}
+
+// NewRoundRobinPartitioner returns a Partitioner that assigns records to
+// partitions in turn, ignoring their keys.
+func NewRoundRobinPartitioner() Partitioner {
+	var next atomic.Uint64
+
+	return PartitionerFunc(func(_ []byte, numPartitions int) int {
+		return int((next.Add(1) - 1) % uint64(numPartitions))
+	})
+}
+
+// NewStickyPartitioner returns a Partitioner that assigns recordsPerPartition
+// consecutive records to the same, randomly chosen, partition before switching
+// to another one, ignoring their keys. Compared to round-robin, this results
+// in fewer and larger batches per partition.
+func NewStickyPartitioner(recordsPerPartition int) Partitioner {
+	var (
+		mu        sync.Mutex
+		partition = -1
+		remaining = 0
+	)
+
+	return PartitionerFunc(func(_ []byte, numPartitions int) int {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if remaining <= 0 || partition >= numPartitions {
+			next := rand.IntN(numPartitions)
+
+			// avoid sticking to the same partition twice in a row
+			if numPartitions > 1 && next == partition {
+				next = (next + 1 + rand.IntN(numPartitions-1)) % numPartitions
+			}
+
+			partition = next
+			remaining = recordsPerPartition
+		}
+
+		remaining -= 1
+		return partition
+	})
+}
+
+// Murmur2 returns the 32-bit murmur2 hash of data, as computed by Kafka's
+// default partitioner.
+func Murmur2(data []byte) int32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+
+	length := len(data)
+	h := seed ^ uint32(length)
+
+	for i := 0; i+4 <= length; i += 4 {
+		k := uint32(data[i]) | uint32(data[i+1])<<8 | uint32(data[i+2])<<16 | uint32(data[i+3])<<24
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	tail := length &^ 3
+	switch length % 4 {
+	case 3:
+		h ^= uint32(data[tail+2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[tail+1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[tail])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+
+	return int32(h)
+}
@@ -0,0 +1,94 @@
+package seb_test
+
+import (
+	"testing"
+
+	seb "github.com/micvbang/simple-event-broker"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMurmur2 verifies that Murmur2 returns the same hashes as Kafka's
+// murmur2 implementation.
+func TestMurmur2(t *testing.T) {
+	tests := map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	}
+
+	for input, expected := range tests {
+		t.Run(input, func(t *testing.T) {
+			// Act
+			got := seb.Murmur2([]byte(input))
+
+			// Assert
+			require.Equal(t, expected, got)
+		})
+	}
+}
+
+// TestMurmur2PartitionerStable verifies that the murmur2 partitioner always
+// assigns a key to the same partition, and that keyless records are assigned
+// using the given keyless partitioner.
+func TestMurmur2PartitionerStable(t *testing.T) {
+	const numPartitions = 12
+	partitioner := seb.NewMurmur2Partitioner(seb.PartitionerFunc(func(key []byte, numPartitions int) int {
+		return 7
+	}))
+
+	for _, key := range []string{"a", "b", "some-key", ""} {
+		expected := int(seb.Murmur2([]byte(key))&0x7fffffff) % numPartitions
+		for range 10 {
+			// Act
+			got := partitioner.Partition([]byte(key), numPartitions)
+
+			// Assert
+			require.Equal(t, expected, got)
+		}
+	}
+
+	require.Equal(t, 7, partitioner.Partition(nil, numPartitions))
+}
+
+// TestRoundRobinPartitioner verifies that the round-robin partitioner assigns
+// records to partitions in turn.
+func TestRoundRobinPartitioner(t *testing.T) {
+	partitioner := seb.NewRoundRobinPartitioner()
+
+	got := []int{}
+	for range 7 {
+		// Act
+		got = append(got, partitioner.Partition([]byte("key"), 3))
+	}
+
+	// Assert
+	require.Equal(t, []int{0, 1, 2, 0, 1, 2, 0}, got)
+}
+
+// TestStickyPartitioner verifies that the sticky partitioner assigns the
+// configured number of consecutive records to the same partition, and then
+// switches to a different partition.
+func TestStickyPartitioner(t *testing.T) {
+	const (
+		recordsPerPartition = 5
+		numPartitions       = 4
+	)
+	partitioner := seb.NewStickyPartitioner(recordsPerPartition)
+
+	previous := -1
+	for range 20 {
+		partition := partitioner.Partition(nil, numPartitions)
+		require.GreaterOrEqual(t, partition, 0)
+		require.Less(t, partition, numPartitions)
+		require.NotEqual(t, previous, partition)
+
+		for range recordsPerPartition - 1 {
+			// Act, Assert
+			require.Equal(t, partition, partitioner.Partition(nil, numPartitions))
+		}
+		previous = partition
+	}
+}
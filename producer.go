@@ -0,0 +1,275 @@
+package seb
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/micvbang/go-helpy/sizey"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+// CompressionGzip compresses the request bodies of a Producer using gzip.
+const CompressionGzip = "gzip"
+
+type ProducerOpts struct {
+	// FlushInterval is the maximum time that records are kept by the
+	// Producer before being sent. Defaults to 100ms.
+	FlushInterval time.Duration
+
+	// FlushBytes and FlushRecords are the number of bytes and records of a
+	// topic that cause them to be sent immediately, without waiting for
+	// FlushInterval. Default to 1 MiB and 1000 records.
+	FlushBytes   int
+	FlushRecords int
+
+	// Partitions is the number of partitions of each topic. If larger than
+	// 0, records are added to the topic returned by PartitionTopicName for
+	// the partition chosen by Partitioner. Defaults to 0, i.e. records are
+	// added to the given topic.
+	Partitions int
+
+	// Partitioner chooses the partition of records when Partitions is larger
+	// than 0. Defaults to NewMurmur2Partitioner(nil).
+	Partitioner Partitioner
+
+	// Compression is the encoding used to compress request bodies, either ""
+	// or CompressionGzip. If the server doesn't support the encoding,
+	// requests are sent uncompressed. Defaults to "".
+	Compression string
+}
+
+// WithFlushInterval sets the maximum time that records are kept before being
+// sent.
+func WithFlushInterval(flushInterval time.Duration) func(*ProducerOpts) {
+	return func(o *ProducerOpts) {
+		o.FlushInterval = flushInterval
+	}
+}
+
+// WithFlushBytes sets the number of bytes of a topic that cause its records
+// to be sent immediately.
+func WithFlushBytes(flushBytes int) func(*ProducerOpts) {
+	return func(o *ProducerOpts) {
+		o.FlushBytes = flushBytes
+	}
+}
+
+// WithFlushRecords sets the number of records of a topic that cause them to
+// be sent immediately.
+func WithFlushRecords(flushRecords int) func(*ProducerOpts) {
+	return func(o *ProducerOpts) {
+		o.FlushRecords = flushRecords
+	}
+}
+
+// WithPartitions spreads records over the given number of partitions of each
+// topic, using partitioner to choose the partition of each record. If
+// partitioner is nil, NewMurmur2Partitioner(nil) is used.
+func WithPartitions(partitions int, partitioner Partitioner) func(*ProducerOpts) {
+	return func(o *ProducerOpts) {
+		o.Partitions = partitions
+		if partitioner != nil {
+			o.Partitioner = partitioner
+		}
+	}
+}
+
+// WithCompression sets the encoding used to compress request bodies.
+func WithCompression(compression string) func(*ProducerOpts) {
+	return func(o *ProducerOpts) {
+		o.Compression = compression
+	}
+}
+
+// PartitionTopicName returns the name of the topic holding the given
+// partition of topicName, e.g. "orders-3".
+func PartitionTopicName(topicName string, partition int) string {
+	return fmt.Sprintf("%s-%d", topicName, partition)
+}
+
+// Producer batches records on the client, sending the records of each topic
+// using a single AddRecords request every FlushInterval, or once FlushBytes or
+// FlushRecords is reached. This reduces the number of requests, and thereby
+// the overhead, of producers adding many small records.
+//
+// Records of a topic are sent in the order they were added. Records are lost
+// if the request sending them fails; the error is returned by Add, or by the
+// following call to Flush or Close if the records were sent in the
+// background.
+//
+// Producer is safe for concurrent use.
+type Producer struct {
+	client *RecordClient
+	opts   ProducerOpts
+
+	// sendMu is held while taking and sending pending records, such that
+	// records are sent in the order they were added.
+	sendMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[string]*pendingRecords
+	err     error
+	closed  bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type pendingRecords struct {
+	sizes []uint32
+	data  []byte
+}
+
+// NewProducer returns a Producer that adds records using client. Records are
+// sent in the background every FlushInterval until Close is called.
+func NewProducer(client *RecordClient, optFuncs ...func(*ProducerOpts)) (*Producer, error) {
+	opts := ProducerOpts{
+		FlushInterval: 100 * time.Millisecond,
+		FlushBytes:    1 * sizey.MB,
+		FlushRecords:  1000,
+		Partitioner:   NewMurmur2Partitioner(nil),
+	}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+
+	switch {
+	case opts.FlushInterval <= 0:
+		return nil, fmt.Errorf("%w: flush interval must be positive, got %s", seberr.ErrBadInput, opts.FlushInterval)
+	case opts.FlushBytes <= 0:
+		return nil, fmt.Errorf("%w: flush bytes must be positive, got %d", seberr.ErrBadInput, opts.FlushBytes)
+	case opts.FlushRecords <= 0:
+		return nil, fmt.Errorf("%w: flush records must be positive, got %d", seberr.ErrBadInput, opts.FlushRecords)
+	case opts.Partitions < 0:
+		return nil, fmt.Errorf("%w: partitions must not be negative, got %d", seberr.ErrBadInput, opts.Partitions)
+	case opts.Compression != "" && opts.Compression != CompressionGzip:
+		return nil, fmt.Errorf("%w: unsupported compression '%s'", seberr.ErrBadInput, opts.Compression)
+	}
+
+	p := &Producer{
+		client:  client,
+		opts:    opts,
+		pending: map[string]*pendingRecords{},
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go p.flushLoop()
+
+	return p, nil
+}
+
+// Add adds record to the pending records of topicName, or of the partition of
+// topicName chosen using key if Partitions is larger than 0. key is only used
+// for choosing partitions, and may be nil.
+//
+// If FlushBytes or FlushRecords is reached, the pending records of the topic
+// are sent before Add returns.
+func (p *Producer) Add(topicName string, key []byte, record []byte) error {
+	if p.opts.Partitions > 0 {
+		topicName = PartitionTopicName(topicName, p.opts.Partitioner.Partition(key, p.opts.Partitions))
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return fmt.Errorf("%w: producer is closed", seberr.ErrBadInput)
+	}
+
+	pending, ok := p.pending[topicName]
+	if !ok {
+		pending = &pendingRecords{}
+		p.pending[topicName] = pending
+	}
+	pending.sizes = append(pending.sizes, uint32(len(record)))
+	pending.data = append(pending.data, record...)
+	full := len(pending.sizes) >= p.opts.FlushRecords || len(pending.data) >= p.opts.FlushBytes
+	p.mu.Unlock()
+
+	if full {
+		return p.flush(topicName)
+	}
+
+	return nil
+}
+
+// Flush sends all pending records. Errors from sending records in the
+// background since the last call to Flush are returned as well.
+func (p *Producer) Flush() error {
+	return p.flush()
+}
+
+// Close stops sending records in the background and sends all pending
+// records. Records can't be added once Close has been called.
+func (p *Producer) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	close(p.stop)
+	<-p.done
+
+	return p.flush()
+}
+
+// flush sends the pending records of topicNames, or of all topics if none are
+// given, returning errors from sending them as well as errors from sending
+// records in the background.
+func (p *Producer) flush(topicNames ...string) error {
+	p.sendMu.Lock()
+	defer p.sendMu.Unlock()
+
+	p.mu.Lock()
+	taken := map[string]*pendingRecords{}
+	if len(topicNames) == 0 {
+		taken = p.pending
+		p.pending = map[string]*pendingRecords{}
+	}
+	for _, topicName := range topicNames {
+		if pending, ok := p.pending[topicName]; ok {
+			taken[topicName] = pending
+			delete(p.pending, topicName)
+		}
+	}
+	errs := []error{p.err}
+	p.err = nil
+	p.mu.Unlock()
+
+	for topicName, pending := range taken {
+		_, err := p.client.addRecords(topicName, pending.sizes, pending.data, nil, p.opts.Compression)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("adding %d records to topic '%s': %w", len(pending.sizes), topicName, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// flushLoop sends all pending records every FlushInterval until Close is
+// called. Errors are kept for the following call to Flush or Close.
+func (p *Producer) flushLoop() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.opts.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+
+		err := p.flush()
+		if err != nil {
+			p.mu.Lock()
+			p.err = errors.Join(p.err, err)
+			p.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package seb_test
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	seb "github.com/micvbang/simple-event-broker"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// requestRecorder is a RequestInterceptor that records the Content-Encoding
+// of each request adding records.
+type requestRecorder struct {
+	mu        sync.Mutex
+	encodings []string
+}
+
+func (r *requestRecorder) intercept(req *http.Request, next func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	if req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/records") {
+		r.mu.Lock()
+		r.encodings = append(r.encodings, req.Header.Get("Content-Encoding"))
+		r.mu.Unlock()
+	}
+	return next(req)
+}
+
+func (r *requestRecorder) requests() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.encodings...)
+}
+
+// TestProducerFlushRecords verifies that Producer sends the records of a
+// topic in a single request once FlushRecords is reached, and that records
+// are added in the order they were given.
+func TestProducerFlushRecords(t *testing.T) {
+	const topicName = "topic"
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	recorder := &requestRecorder{}
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey, seb.WithRequestInterceptors(recorder.intercept))
+	require.NoError(t, err)
+
+	producer, err := seb.NewProducer(client, seb.WithFlushRecords(5), seb.WithFlushInterval(time.Hour))
+	require.NoError(t, err)
+	defer producer.Close()
+
+	records := tester.MakeRandomRecordBatch(10).IndividualRecords()
+
+	// Act
+	for _, record := range records {
+		err = producer.Add(topicName, nil, record)
+		require.NoError(t, err)
+	}
+
+	// Assert
+	require.Len(t, recorder.requests(), 2)
+	got, err := client.GetRecords(topicName, 0, seb.GetRecordsInput{MaxRecords: 20, Timeout: 10 * time.Millisecond})
+	require.NoError(t, err)
+	require.Equal(t, records, got)
+}
+
+// TestProducerFlushInterval verifies that Producer sends pending records in
+// the background once FlushInterval has passed.
+func TestProducerFlushInterval(t *testing.T) {
+	const topicName = "topic"
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	recorder := &requestRecorder{}
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey, seb.WithRequestInterceptors(recorder.intercept))
+	require.NoError(t, err)
+
+	producer, err := seb.NewProducer(client, seb.WithFlushInterval(10*time.Millisecond))
+	require.NoError(t, err)
+	defer producer.Close()
+
+	records := tester.MakeRandomRecordBatch(3).IndividualRecords()
+
+	// Act
+	for _, record := range records {
+		err = producer.Add(topicName, nil, record)
+		require.NoError(t, err)
+	}
+
+	// Assert
+	require.Eventually(t, func() bool {
+		return len(recorder.requests()) == 1
+	}, time.Second, 5*time.Millisecond)
+	require.NoError(t, producer.Flush())
+
+	got, err := client.GetRecords(topicName, 0, seb.GetRecordsInput{MaxRecords: 10, Timeout: 10 * time.Millisecond})
+	require.NoError(t, err)
+	require.Equal(t, records, got)
+}
+
+// TestProducerPartitions verifies that Producer adds records to the topics of
+// the partitions chosen by its Partitioner.
+func TestProducerPartitions(t *testing.T) {
+	const topicName = "topic"
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	byKey := seb.PartitionerFunc(func(key []byte, numPartitions int) int {
+		return int(key[0]) % numPartitions
+	})
+	producer, err := seb.NewProducer(client, seb.WithPartitions(2, byKey))
+	require.NoError(t, err)
+
+	records := tester.MakeRandomRecordBatch(4).IndividualRecords()
+
+	// Act
+	for i, record := range records {
+		err = producer.Add(topicName, []byte{byte(i)}, record)
+		require.NoError(t, err)
+	}
+	err = producer.Close()
+	require.NoError(t, err)
+
+	// Assert
+	expected := map[string][][]byte{
+		seb.PartitionTopicName(topicName, 0): {records[0], records[2]},
+		seb.PartitionTopicName(topicName, 1): {records[1], records[3]},
+	}
+	for partitionTopicName, expectedRecords := range expected {
+		got, err := client.GetRecords(partitionTopicName, 0, seb.GetRecordsInput{MaxRecords: 10, Timeout: 10 * time.Millisecond})
+		require.NoError(t, err)
+		require.Equal(t, expectedRecords, got)
+	}
+	require.Equal(t, "topic-1", seb.PartitionTopicName(topicName, 1))
+}
+
+// TestProducerCompression verifies that Producer compresses request bodies
+// using gzip when configured to, and that the server decompresses them.
+func TestProducerCompression(t *testing.T) {
+	const topicName = "topic"
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	recorder := &requestRecorder{}
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey, seb.WithRequestInterceptors(recorder.intercept))
+	require.NoError(t, err)
+
+	producer, err := seb.NewProducer(client, seb.WithCompression(seb.CompressionGzip), seb.WithFlushInterval(time.Hour))
+	require.NoError(t, err)
+
+	records := tester.MakeRandomRecordBatch(5).IndividualRecords()
+
+	// Act
+	for _, record := range records {
+		err = producer.Add(topicName, nil, record)
+		require.NoError(t, err)
+	}
+	err = producer.Close()
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, []string{"gzip"}, recorder.requests())
+	got, err := client.GetRecords(topicName, 0, seb.GetRecordsInput{MaxRecords: 10, Timeout: 10 * time.Millisecond})
+	require.NoError(t, err)
+	require.Equal(t, records, got)
+}
+
+// TestProducerCompressionUnsupported verifies that Producer falls back to
+// sending uncompressed request bodies when the server responds with 415
+// Unsupported Media Type, and that it doesn't compress subsequent requests.
+func TestProducerCompressionUnsupported(t *testing.T) {
+	const topicName = "topic"
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	recorder := &requestRecorder{}
+	rejectCompressed := func(req *http.Request, next func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+		if req.Header.Get("Content-Encoding") != "" {
+			return &http.Response{
+				StatusCode: http.StatusUnsupportedMediaType,
+				Header:     http.Header{"Accept-Encoding": []string{"identity"}},
+				Body:       http.NoBody,
+				Request:    req,
+			}, nil
+		}
+		return next(req)
+	}
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey, seb.WithRequestInterceptors(recorder.intercept, rejectCompressed))
+	require.NoError(t, err)
+
+	producer, err := seb.NewProducer(client, seb.WithCompression(seb.CompressionGzip), seb.WithFlushInterval(time.Hour))
+	require.NoError(t, err)
+
+	records := tester.MakeRandomRecordBatch(4).IndividualRecords()
+
+	// Act
+	for _, record := range records[:2] {
+		err = producer.Add(topicName, nil, record)
+		require.NoError(t, err)
+	}
+	err = producer.Flush()
+	require.NoError(t, err)
+
+	for _, record := range records[2:] {
+		err = producer.Add(topicName, nil, record)
+		require.NoError(t, err)
+	}
+	err = producer.Close()
+	require.NoError(t, err)
+
+	// Assert
+	require.Equal(t, []string{"gzip", "", ""}, recorder.requests())
+	got, err := client.GetRecords(topicName, 0, seb.GetRecordsInput{MaxRecords: 10, Timeout: 10 * time.Millisecond})
+	require.NoError(t, err)
+	require.Equal(t, records, got)
+}
+
+// TestNewProducerBadInput verifies that NewProducer returns
+// seberr.ErrBadInput when given invalid options.
+func TestNewProducerBadInput(t *testing.T) {
+	client, err := seb.NewRecordClient("http://localhost", tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		optFunc func(*seb.ProducerOpts)
+	}{
+		"flush interval": {optFunc: seb.WithFlushInterval(0)},
+		"flush bytes":    {optFunc: seb.WithFlushBytes(-1)},
+		"flush records":  {optFunc: seb.WithFlushRecords(0)},
+		"partitions":     {optFunc: seb.WithPartitions(-1, nil)},
+		"compression":    {optFunc: seb.WithCompression("zstd")},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			_, err := seb.NewProducer(client, test.optFunc)
+
+			// Assert
+			require.ErrorIs(t, err, seberr.ErrBadInput)
+		})
+	}
+}
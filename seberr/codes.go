@@ -0,0 +1,116 @@
+package seberr
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Codes are machine-readable identifiers of errors, sent in HTTP error
+// responses such that clients can react to errors without parsing messages.
+const (
+	CodeOutOfBounds        = "out_of_bounds"
+	CodeOffsetOutOfBounds  = "offset_out_of_bounds"
+	CodeTopicNotFound      = "topic_not_found"
+	CodeTopicAlreadyExists = "topic_already_exists"
+	CodeUnauthorized       = "unauthorized"
+	CodeNotAuthorized      = "not_authorized"
+	CodePayloadTooLarge    = "payload_too_large"
+	CodeBadInput           = "bad_input"
+	CodeNotFound           = "not_found"
+	CodeWritesFrozen       = "writes_frozen"
+	CodeLeaseLost          = "lease_lost"
+	CodeTopicSealed        = "topic_sealed"
+	CodeBackpressure       = "backpressure"
+	CodeQuotaExceeded      = "quota_exceeded"
+	CodeStorageUnavailable = "storage_unavailable"
+	CodeGroupPaused        = "group_paused"
+	CodeIncompatibleLayout = "incompatible_layout"
+	CodeQuarantined        = "quarantined"
+	CodeInternal           = "internal"
+)
+
+type errorCode struct {
+	err       error
+	code      string
+	retryable bool
+}
+
+// errorCodes maps errors to their codes. Errors that wrap other errors must
+// come before the errors they wrap, such that the most specific code is used.
+var errorCodes = []errorCode{
+	{err: ErrOffsetOutOfBounds, code: CodeOffsetOutOfBounds, retryable: true},
+	{err: ErrOutOfBounds, code: CodeOutOfBounds},
+	{err: ErrTopicNotFound, code: CodeTopicNotFound},
+	{err: ErrTopicAlreadyExists, code: CodeTopicAlreadyExists},
+	{err: ErrUnauthorized, code: CodeUnauthorized},
+	{err: ErrNotAuthorized, code: CodeNotAuthorized},
+	{err: ErrPayloadTooLarge, code: CodePayloadTooLarge},
+	{err: ErrBadInput, code: CodeBadInput},
+	{err: ErrNotFound, code: CodeNotFound},
+	{err: ErrLeaseLost, code: CodeLeaseLost, retryable: true},
+	{err: ErrTopicSealed, code: CodeTopicSealed},
+	{err: ErrWritesFrozen, code: CodeWritesFrozen, retryable: true},
+	{err: ErrBackpressure, code: CodeBackpressure, retryable: true},
+	{err: ErrQuotaExceeded, code: CodeQuotaExceeded},
+	{err: ErrStorageUnavailable, code: CodeStorageUnavailable, retryable: true},
+	{err: ErrGroupPaused, code: CodeGroupPaused, retryable: true},
+	{err: ErrIncompatibleLayout, code: CodeIncompatibleLayout},
+	{err: ErrQuarantined, code: CodeQuarantined},
+}
+
+// statusCodes maps HTTP status codes to the codes of errors that don't wrap
+// any of the errors in errorCodes.
+var statusCodes = map[int]string{
+	http.StatusBadRequest:                   CodeBadInput,
+	http.StatusUnauthorized:                 CodeUnauthorized,
+	http.StatusForbidden:                    CodeNotAuthorized,
+	http.StatusNotFound:                     CodeNotFound,
+	http.StatusConflict:                     CodeTopicAlreadyExists,
+	http.StatusRequestEntityTooLarge:        CodePayloadTooLarge,
+	http.StatusRequestedRangeNotSatisfiable: CodeOffsetOutOfBounds,
+	http.StatusLocked:                       CodeGroupPaused,
+	http.StatusTooManyRequests:              CodeBackpressure,
+	http.StatusInsufficientStorage:          CodeQuotaExceeded,
+}
+
+// Code returns the code of err and whether the operation that failed with it
+// may succeed if it's retried. If err doesn't wrap any known error, the code
+// is derived from statusCode, the HTTP status code that err is returned with.
+// CodeInternal is returned for unknown errors.
+func Code(err error, statusCode int) (string, bool) {
+	if err != nil {
+		for _, ec := range errorCodes {
+			if errors.Is(err, ec.err) {
+				return ec.code, ec.retryable
+			}
+		}
+	}
+
+	code, ok := statusCodes[statusCode]
+	if !ok {
+		return CodeInternal, false
+	}
+	return code, Retryable(code)
+}
+
+// FromCode returns the error with the given code, or nil if code is unknown
+// or CodeInternal.
+func FromCode(code string) error {
+	for _, ec := range errorCodes {
+		if ec.code == code {
+			return ec.err
+		}
+	}
+	return nil
+}
+
+// Retryable returns whether operations that fail with the error with the
+// given code may succeed if they're retried.
+func Retryable(code string) bool {
+	for _, ec := range errorCodes {
+		if ec.code == code {
+			return ec.retryable
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package seberr_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCode verifies that Code returns the code of the most specific error
+// wrapped by err, falls back to the code implied by the status code, and
+// returns CodeInternal for unknown errors.
+func TestCode(t *testing.T) {
+	tests := map[string]struct {
+		err        error
+		statusCode int
+		code       string
+		retryable  bool
+	}{
+		"wrapped":         {err: fmt.Errorf("reading: %w", seberr.ErrTopicNotFound), statusCode: http.StatusNotFound, code: seberr.CodeTopicNotFound},
+		"most specific":   {err: seberr.ErrOffsetOutOfBounds, statusCode: http.StatusRequestedRangeNotSatisfiable, code: seberr.CodeOffsetOutOfBounds, retryable: true},
+		"lease lost":      {err: seberr.ErrLeaseLost, statusCode: http.StatusServiceUnavailable, code: seberr.CodeLeaseLost, retryable: true},
+		"topic sealed":    {err: seberr.ErrTopicSealed, statusCode: http.StatusServiceUnavailable, code: seberr.CodeTopicSealed},
+		"status fallback": {err: fmt.Errorf("bad"), statusCode: http.StatusBadRequest, code: seberr.CodeBadInput},
+		"nil":             {err: nil, statusCode: http.StatusTooManyRequests, code: seberr.CodeBackpressure, retryable: true},
+		"internal":        {err: fmt.Errorf("boom"), statusCode: http.StatusInternalServerError, code: seberr.CodeInternal},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			code, retryable := seberr.Code(test.err, test.statusCode)
+
+			// Assert
+			require.Equal(t, test.code, code)
+			require.Equal(t, test.retryable, retryable)
+		})
+	}
+}
+
+// TestFromCode verifies that FromCode returns the error that Code returns the
+// code of, and nil for unknown codes.
+func TestFromCode(t *testing.T) {
+	for _, err := range []error{seberr.ErrOutOfBounds, seberr.ErrOffsetOutOfBounds, seberr.ErrTopicNotFound, seberr.ErrLeaseLost, seberr.ErrTopicSealed, seberr.ErrWritesFrozen, seberr.ErrGroupPaused, seberr.ErrQuarantined} {
+		code, _ := seberr.Code(err, http.StatusInternalServerError)
+
+		// Act
+		got := seberr.FromCode(code)
+
+		// Assert
+		require.Equal(t, err, got)
+	}
+
+	require.Nil(t, seberr.FromCode(seberr.CodeInternal))
+	require.Nil(t, seberr.FromCode("unknown"))
+}
@@ -2,6 +2,7 @@ package seberr
 
 import (
 	"errors"
+	"fmt"
 )
 
 var (
@@ -16,4 +17,30 @@ var (
 	ErrBufferTooSmall     = errors.New("buffer too small")
 	ErrNotAuthorized      = errors.New("not authorized")
 	ErrNotFound           = errors.New("not found")
+	ErrWritesFrozen       = errors.New("writes frozen")
+	ErrBackpressure       = errors.New("too many pending records")
+	ErrQuotaExceeded      = errors.New("quota exceeded")
+	ErrStorageUnavailable = errors.New("storage unavailable")
+	ErrGroupPaused        = errors.New("consumer group paused")
+	ErrIncompatibleLayout = errors.New("incompatible storage layout")
+
+	// ErrQuarantined is returned when reading records of a record batch that
+	// was quarantined because it was corrupt.
+	ErrQuarantined = errors.New("record batch quarantined")
+
+	// ErrBrokerUnavailable is returned by clients that stop sending requests
+	// while the broker appears to be unavailable.
+	ErrBrokerUnavailable = errors.New("broker unavailable")
+
+	// ErrLeaseLost is returned when writing to a topic whose lease is held by
+	// another broker. It wraps ErrWritesFrozen.
+	ErrLeaseLost = fmt.Errorf("lease lost: %w", ErrWritesFrozen)
+
+	// ErrTopicSealed is returned when writing to a topic that has been sealed,
+	// permanently closing it for writes. It wraps ErrWritesFrozen.
+	ErrTopicSealed = fmt.Errorf("topic sealed: %w", ErrWritesFrozen)
+
+	// ErrOffsetOutOfBounds is returned when reading from an offset that has
+	// not yet been produced. It wraps ErrOutOfBounds.
+	ErrOffsetOutOfBounds = fmt.Errorf("offset not yet produced: %w", ErrOutOfBounds)
 )
@@ -0,0 +1,196 @@
+// Package sebtest runs complete brokers backed by S3 storage for integration
+// tests, e.g. of applications that embed seb or pipelines that use it. The
+// broker stores records in either an in-memory fake of S3 or a MinIO server
+// running in docker, exercising the same code paths as a production broker
+// using S3.
+package sebtest
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/micvbang/go-helpy/sizey"
+	seb "github.com/micvbang/simple-event-broker"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+)
+
+const (
+	// S3BackendFake stores records in an S3Fake.
+	S3BackendFake = "fake"
+
+	// S3BackendMinIO stores records in MinIO, started using StartMinIO.
+	S3BackendMinIO = "minio"
+)
+
+type Opts struct {
+	// S3Backend is the S3 backend that records are stored in, either
+	// S3BackendFake or S3BackendMinIO. Defaults to the value of the
+	// environment variable SEB_TEST_S3 if set, making it possible to run the
+	// same tests against MinIO in e.g. CI, and S3BackendFake otherwise.
+	S3Backend string
+
+	// MinIOImage is the docker image used for S3BackendMinIO. Defaults to
+	// DefaultMinIOImage.
+	MinIOImage string
+
+	// APIKey is the API key of the broker. Defaults to "api-key".
+	APIKey string
+
+	// BatchBlockTime is the time that the broker waits for more records
+	// before committing a record batch. Defaults to 10ms.
+	BatchBlockTime time.Duration
+}
+
+// WithS3Backend sets the S3 backend that records are stored in.
+func WithS3Backend(backend string) func(*Opts) {
+	return func(o *Opts) {
+		o.S3Backend = backend
+	}
+}
+
+// WithMinIOImage sets the docker image used for S3BackendMinIO.
+func WithMinIOImage(image string) func(*Opts) {
+	return func(o *Opts) {
+		o.MinIOImage = image
+	}
+}
+
+// WithAPIKey sets the API key of the broker.
+func WithAPIKey(apiKey string) func(*Opts) {
+	return func(o *Opts) {
+		o.APIKey = apiKey
+	}
+}
+
+// WithBatchBlockTime sets the time that the broker waits for more records
+// before committing a record batch.
+func WithBatchBlockTime(batchBlockTime time.Duration) func(*Opts) {
+	return func(o *Opts) {
+		o.BatchBlockTime = batchBlockTime
+	}
+}
+
+// Broker is a broker served over HTTP for the duration of a test.
+type Broker struct {
+	URL    string
+	APIKey string
+	Bucket string
+
+	// S3Fake is the fake that records are stored in if S3BackendFake is
+	// used, and nil otherwise.
+	S3Fake *S3Fake
+
+	// MinIO is the MinIO server that records are stored in if
+	// S3BackendMinIO is used, and the zero value otherwise.
+	MinIO MinIO
+}
+
+// storages counts the storages registered by NewBroker, giving each a unique
+// name.
+var storages atomic.Int64
+
+// NewBroker starts a broker backed by S3 storage, configured by optFuncs. The
+// broker and its storage are stopped when t ends. If S3BackendMinIO is used,
+// t is skipped if docker isn't installed, and fails if MinIO can't be started.
+func NewBroker(t testing.TB, optFuncs ...func(*Opts)) *Broker {
+	t.Helper()
+
+	opts := Opts{
+		S3Backend:      cmp.Or(os.Getenv("SEB_TEST_S3"), S3BackendFake),
+		MinIOImage:     DefaultMinIOImage,
+		APIKey:         "api-key",
+		BatchBlockTime: 10 * time.Millisecond,
+	}
+	for _, optFunc := range optFuncs {
+		optFunc(&opts)
+	}
+
+	broker := &Broker{
+		APIKey: opts.APIKey,
+		Bucket: "sebtest",
+	}
+
+	var s3API sebtopic.S3API
+	switch opts.S3Backend {
+	case S3BackendFake:
+		broker.S3Fake = NewS3Fake()
+		s3API = broker.S3Fake
+
+	case S3BackendMinIO:
+		broker.MinIO = StartMinIO(t, opts.MinIOImage)
+		err := broker.MinIO.CreateBucket(context.Background(), broker.Bucket)
+		if err != nil {
+			t.Fatalf("creating bucket: %s", err)
+		}
+		s3API = broker.MinIO.S3Client()
+
+	default:
+		t.Fatalf("unknown s3 backend '%s'", opts.S3Backend)
+	}
+
+	// NOTE: the storage is registered under a unique name, since registered
+	// storage can't be removed again.
+	storageName := fmt.Sprintf("sebtest-%d", storages.Add(1))
+	sebtopic.RegisterStorage(storageName, func(_ context.Context, log logger.Logger, config sebtopic.StorageConfig) (sebtopic.Storage, error) {
+		return sebtopic.NewS3Storage(log, s3API, config.Bucket, "", sebtopic.WithS3StagingDir(config.StagingDir)), nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	server, err := seb.NewServer(ctx, seb.ServerConfig{
+		Storage:           storageName,
+		S3Bucket:          broker.Bucket,
+		S3StagingDir:      t.TempDir(),
+		CacheStorage:      "memory",
+		CacheMaxBytes:     128 * sizey.MB,
+		BatchBlockTime:    opts.BatchBlockTime,
+		BatchSoftMaxBytes: 10 * sizey.MB,
+		BatchHardMaxBytes: 30 * sizey.MB,
+		BatchMaxRecords:   32 * 1024,
+		APIKey:            opts.APIKey,
+		LogLevel:          logger.LevelWarn.String(),
+	})
+	if err != nil {
+		cancel()
+		t.Fatalf("creating server: %s", err)
+	}
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- server.Run(ctx)
+	}()
+
+	httpServer := httptest.NewServer(server.Handler())
+	broker.URL = httpServer.URL
+
+	t.Cleanup(func() {
+		httpServer.Close()
+		cancel()
+
+		err := <-runErr
+		if err != nil {
+			t.Errorf("running server: %s", err)
+		}
+	})
+
+	return broker
+}
+
+// Client returns a RecordClient of the broker, configured by optFuncs.
+func (b *Broker) Client(t testing.TB, optFuncs ...func(*seb.RecordClientOpts)) *seb.RecordClient {
+	t.Helper()
+
+	client, err := seb.NewRecordClient(b.URL, b.APIKey, optFuncs...)
+	if err != nil {
+		t.Fatalf("creating record client: %s", err)
+	}
+	t.Cleanup(client.CloseIdleConnections)
+
+	return client
+}
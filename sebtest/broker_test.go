@@ -0,0 +1,94 @@
+package sebtest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	seb "github.com/micvbang/simple-event-broker"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/sebtest"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNewBroker verifies that the broker returned by NewBroker() serves
+// records added using its client, and that they're stored in S3.
+func TestNewBroker(t *testing.T) {
+	tests := map[string]struct {
+		backend string
+	}{
+		"fake":  {backend: sebtest.S3BackendFake},
+		"minio": {backend: sebtest.S3BackendMinIO},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			broker := sebtest.NewBroker(t, sebtest.WithS3Backend(test.backend))
+			client := broker.Client(t)
+
+			expected := tester.MakeRandomRecordBatch(5)
+
+			// Act
+			err := client.AddRecords("topic", expected.Sizes, expected.Data)
+			require.NoError(t, err)
+
+			// Assert
+			got, err := client.GetRecords("topic", 0, seb.GetRecordsInput{MaxRecords: 10, Timeout: 10 * time.Millisecond})
+			require.NoError(t, err)
+			require.Equal(t, expected.IndividualRecords(), got)
+
+			var keys []string
+			if broker.S3Fake != nil {
+				keys = broker.S3Fake.Keys()
+			} else {
+				output, err := broker.MinIO.S3Client().ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{
+					Bucket: aws.String(broker.Bucket),
+				})
+				require.NoError(t, err)
+				for _, obj := range output.Contents {
+					keys = append(keys, *obj.Key)
+				}
+			}
+			require.NotEmpty(t, keys)
+		})
+	}
+}
+
+// TestS3FakeListObjectsV2 verifies that S3Fake lists the objects with a
+// given prefix in order, starting after StartAfter, across pages.
+func TestS3FakeListObjectsV2(t *testing.T) {
+	ctx := context.Background()
+	fake := sebtest.NewS3Fake()
+
+	for _, key := range []string{"b/3", "a/1", "b/1", "b/2", "b/4"} {
+		_, err := fake.PutObject(ctx, &s3.PutObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String(key),
+		})
+		require.NoError(t, err)
+	}
+
+	// Act
+	got := []string{}
+	paginator := s3.NewListObjectsV2Paginator(fake, &s3.ListObjectsV2Input{
+		Bucket:     aws.String("bucket"),
+		Prefix:     aws.String("b/"),
+		StartAfter: aws.String("b/1"),
+		MaxKeys:    aws.Int32(2),
+	})
+	pages := 0
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		require.NoError(t, err)
+		pages += 1
+		for _, obj := range output.Contents {
+			got = append(got, *obj.Key)
+		}
+	}
+
+	// Assert
+	require.Equal(t, []string{"b/2", "b/3", "b/4"}, got)
+	require.Equal(t, 2, pages)
+}
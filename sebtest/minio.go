@@ -0,0 +1,129 @@
+package sebtest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// DefaultMinIOImage is the docker image used by StartMinIO if none is given.
+const DefaultMinIOImage = "minio/minio:latest"
+
+// MinIO describes a running MinIO server.
+type MinIO struct {
+	Endpoint        string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// StartMinIO starts a MinIO server in a docker container using image, which
+// is removed when t ends. t is skipped if docker isn't installed, such that
+// integration tests can run wherever docker is, without failing elsewhere. t
+// fails if docker is installed, but the container can't be started, e.g.
+// because the docker daemon isn't running.
+func StartMinIO(t testing.TB, image string) MinIO {
+	t.Helper()
+
+	if image == "" {
+		image = DefaultMinIOImage
+	}
+
+	_, err := exec.LookPath("docker")
+	if err != nil {
+		t.Skipf("docker not available: %s", err)
+	}
+
+	minio := MinIO{
+		AccessKeyID:     "sebtest",
+		SecretAccessKey: "sebtest-secret",
+	}
+
+	out, err := exec.Command("docker", "run", "--detach", "--rm",
+		"--publish", "127.0.0.1::9000",
+		"--env", "MINIO_ROOT_USER="+minio.AccessKeyID,
+		"--env", "MINIO_ROOT_PASSWORD="+minio.SecretAccessKey,
+		image, "server", "/data",
+	).CombinedOutput()
+	if err != nil {
+		t.Fatalf("starting minio container: %s: %s", err, out)
+	}
+	containerID := strings.TrimSpace(string(out))
+
+	t.Cleanup(func() {
+		out, err := exec.Command("docker", "rm", "--force", containerID).CombinedOutput()
+		if err != nil {
+			t.Logf("removing minio container %s: %s: %s", containerID, err, out)
+		}
+	})
+
+	out, err = exec.Command("docker", "port", containerID, "9000/tcp").CombinedOutput()
+	if err != nil {
+		t.Fatalf("getting port of minio container: %s: %s", err, out)
+	}
+	// NOTE: docker may list an address per IP version; the first is used.
+	address, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	minio.Endpoint = "http://" + address
+
+	err = waitForMinIO(minio.Endpoint, 30*time.Second)
+	if err != nil {
+		t.Fatalf("waiting for minio: %s", err)
+	}
+
+	return minio
+}
+
+// S3Client returns an S3 client of the MinIO server.
+func (m MinIO) S3Client() *s3.Client {
+	cfg := aws.Config{
+		Region: "us-east-1",
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: m.AccessKeyID, SecretAccessKey: m.SecretAccessKey}, nil
+		}),
+	}
+
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.BaseEndpoint = aws.String(m.Endpoint)
+		o.UsePathStyle = true
+	})
+}
+
+// CreateBucket creates the bucket with the given name.
+func (m MinIO) CreateBucket(ctx context.Context, bucket string) error {
+	_, err := m.S3Client().CreateBucket(ctx, &s3.CreateBucketInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		return fmt.Errorf("creating bucket '%s': %w", bucket, err)
+	}
+	return nil
+}
+
+// waitForMinIO waits until the MinIO server at endpoint is ready to serve
+// requests, or timeout has passed.
+func waitForMinIO(endpoint string, timeout time.Duration) error {
+	client := &http.Client{Timeout: time.Second}
+	deadline := time.Now().Add(timeout)
+
+	for {
+		res, err := client.Get(endpoint + "/minio/health/ready")
+		if err == nil {
+			res.Body.Close()
+			if res.StatusCode == http.StatusOK {
+				return nil
+			}
+			err = fmt.Errorf("status code %d", res.StatusCode)
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("not ready after %s: %w", timeout, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
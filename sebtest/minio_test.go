@@ -0,0 +1,69 @@
+package sebtest_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/micvbang/simple-event-broker/sebtest"
+	"github.com/stretchr/testify/require"
+)
+
+// TestStartMinIOWithoutDocker verifies that StartMinIO() skips the test when
+// docker isn't installed, and fails it when docker is installed but the MinIO
+// container can't be started.
+func TestStartMinIOWithoutDocker(t *testing.T) {
+	tests := map[string]struct {
+		docker   string
+		expected string
+	}{
+		"docker not installed": {
+			expected: "skipped",
+		},
+		"container can't start": {
+			docker:   "#!/bin/sh\necho 'cannot connect to the docker daemon' >&2\nexit 1\n",
+			expected: "failed",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			if test.docker != "" {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, "docker"), []byte(test.docker), 0o755))
+			}
+			t.Setenv("PATH", dir)
+
+			tb := &recordingTB{TB: t}
+
+			// Act
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				sebtest.StartMinIO(tb, "")
+			}()
+			<-done
+
+			// Assert
+			require.Equal(t, test.expected, tb.outcome)
+		})
+	}
+}
+
+// recordingTB records whether the test was skipped or failed instead of
+// skipping or failing it.
+type recordingTB struct {
+	testing.TB
+	outcome string
+}
+
+func (tb *recordingTB) Skipf(format string, args ...any) {
+	tb.outcome = "skipped"
+	runtime.Goexit()
+}
+
+func (tb *recordingTB) Fatalf(format string, args ...any) {
+	tb.outcome = "failed"
+	runtime.Goexit()
+}
@@ -0,0 +1,186 @@
+package sebtest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// S3Fake is an in-memory implementation of the subset of the S3 API that the
+// broker uses: getting (ranges of), putting, listing and deleting objects. It
+// allows running the broker's S3 storage without access to S3.
+//
+// S3Fake is safe for concurrent use.
+type S3Fake struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+// NewS3Fake returns an empty S3Fake.
+func NewS3Fake() *S3Fake {
+	return &S3Fake{
+		objects: map[string][]byte{},
+	}
+}
+
+// Keys returns the sorted keys of all objects, prefixed by their bucket, e.g.
+// "bucket/topic/000000000000.record_batch".
+func (f *S3Fake) Keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	keys := make([]string, 0, len(f.objects))
+	for key := range f.objects {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	return keys
+}
+
+func (f *S3Fake) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	f.mu.Lock()
+	data, ok := f.objects[objectKey(params.Bucket, params.Key)]
+	f.mu.Unlock()
+	if !ok {
+		return nil, &types.NoSuchKey{Message: aws.String(fmt.Sprintf("key '%s' does not exist", aws.ToString(params.Key)))}
+	}
+
+	output := &s3.GetObjectOutput{
+		ContentLength: aws.Int64(int64(len(data))),
+	}
+
+	if params.Range != nil {
+		start, end, err := parseRange(*params.Range, len(data))
+		if err != nil {
+			return nil, err
+		}
+		output.ContentRange = aws.String(fmt.Sprintf("bytes %d-%d/%d", start, end-1, len(data)))
+		output.ContentLength = aws.Int64(int64(end - start))
+		data = data[start:end]
+	}
+	output.Body = io.NopCloser(bytes.NewReader(data))
+
+	return output, nil
+}
+
+func (f *S3Fake) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data := []byte{}
+	if params.Body != nil {
+		var err error
+		data, err = io.ReadAll(params.Body)
+		if err != nil {
+			return nil, fmt.Errorf("reading body: %w", err)
+		}
+	}
+
+	f.mu.Lock()
+	f.objects[objectKey(params.Bucket, params.Key)] = data
+	f.mu.Unlock()
+
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *S3Fake) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	bucketPrefix := aws.ToString(params.Bucket) + "/"
+	prefix := bucketPrefix + aws.ToString(params.Prefix)
+
+	// NOTE: keys are listed in lexicographical order, starting after
+	// StartAfter or the continuation token, which is the last key returned.
+	after := ""
+	if params.StartAfter != nil {
+		after = bucketPrefix + *params.StartAfter
+	}
+	if params.ContinuationToken != nil {
+		after = bucketPrefix + *params.ContinuationToken
+	}
+
+	maxKeys := 1000
+	if params.MaxKeys != nil && *params.MaxKeys > 0 {
+		maxKeys = int(*params.MaxKeys)
+	}
+
+	output := &s3.ListObjectsV2Output{
+		Name:   params.Bucket,
+		Prefix: params.Prefix,
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	keys := []string{}
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	if len(keys) > maxKeys {
+		keys = keys[:maxKeys]
+		output.IsTruncated = aws.Bool(true)
+		output.NextContinuationToken = aws.String(strings.TrimPrefix(keys[len(keys)-1], bucketPrefix))
+	}
+
+	for _, key := range keys {
+		output.Contents = append(output.Contents, types.Object{
+			Key:  aws.String(strings.TrimPrefix(key, bucketPrefix)),
+			Size: aws.Int64(int64(len(f.objects[key]))),
+		})
+	}
+	output.KeyCount = aws.Int32(int32(len(output.Contents)))
+
+	return output, nil
+}
+
+func (f *S3Fake) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	f.mu.Lock()
+	delete(f.objects, objectKey(params.Bucket, params.Key))
+	f.mu.Unlock()
+
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func objectKey(bucket *string, key *string) string {
+	return aws.ToString(bucket) + "/" + aws.ToString(key)
+}
+
+// parseRange returns the [start; end) byte range given by an HTTP Range
+// header of the form "bytes=start-end", where end is inclusive.
+func parseRange(rangeHeader string, size int) (int, int, error) {
+	spec, ok := strings.CutPrefix(rangeHeader, "bytes=")
+	if !ok {
+		return 0, 0, fmt.Errorf("unsupported range '%s'", rangeHeader)
+	}
+
+	startStr, endStr, _ := strings.Cut(spec, "-")
+	start, err := strconv.Atoi(startStr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("parsing range start: %w", err)
+	}
+
+	end := size - 1
+	if endStr != "" {
+		end, err = strconv.Atoi(endStr)
+		if err != nil {
+			return 0, 0, fmt.Errorf("parsing range end: %w", err)
+		}
+	}
+	end = min(end+1, size)
+
+	if start >= end {
+		return 0, 0, &smithy.GenericAPIError{Code: "InvalidRange", Message: fmt.Sprintf("range '%s' not satisfiable for %d bytes", rangeHeader, size)}
+	}
+
+	return start, end, nil
+}
@@ -0,0 +1,278 @@
+package seb
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/micvbang/go-helpy/sizey"
+	"github.com/micvbang/go-helpy/syncy"
+	"github.com/micvbang/simple-event-broker/internal/httphandlers"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/logger"
+	"github.com/micvbang/simple-event-broker/internal/sebbroker"
+	"github.com/micvbang/simple-event-broker/internal/sebcache"
+	"github.com/micvbang/simple-event-broker/internal/sebrecords"
+	"github.com/micvbang/simple-event-broker/internal/sebtopic"
+)
+
+// ServerConfig configures a Server. See ServerConfigFromEnv for the
+// environment variable of each setting, and its defaults.
+type ServerConfig struct {
+	// Storage is the name of the backing storage of record batches, e.g.
+	// "disk" or "s3".
+	Storage      string
+	StorageDir   string
+	S3Bucket     string
+	S3Endpoint   string
+	S3StagingDir string
+
+	// CacheStorage is the name of the storage of the cache, e.g. "memory" or
+	// "disk".
+	CacheStorage  string
+	CacheDir      string
+	CacheMaxBytes int64
+
+	BatchBlockTime    time.Duration
+	BatchSoftMaxBytes int
+	BatchHardMaxBytes int
+	BatchMaxRecords   int
+
+	APIKey string
+
+	// LogLevel is the name of the log level, e.g. "info" or "debug".
+	LogLevel string
+}
+
+// ServerConfigFromEnv returns the ServerConfig given by the following
+// environment variables:
+//
+//	SEB_STORAGE                 backing storage, e.g. disk, s3 or minio
+//	SEB_STORAGE_DIR             dir of disk storage
+//	SEB_S3_BUCKET               bucket of s3 storage
+//	SEB_S3_ENDPOINT             URL of an S3 compatible service
+//	SEB_S3_STAGING_DIR          dir of record batches waiting to be uploaded
+//	SEB_CACHE_STORAGE           storage of the cache, memory or disk
+//	SEB_CACHE_DIR               dir of disk cache
+//	SEB_CACHE_SIZE              maximum bytes of the cache
+//	SEB_BATCH_WAIT_TIME         time to wait before committing a batch
+//	SEB_BATCH_BYTES_SOFT_MAX    soft maximum bytes of a batch
+//	SEB_BATCH_BYTES_HARD_MAX    hard maximum bytes of a batch
+//	SEB_BATCH_RECORDS_HARD_MAX  hard maximum records of a batch
+//	SEB_API_KEY                 API key for authorizing requests (required)
+//	SEB_LOG_LEVEL               log level, e.g. info or debug
+//
+// If SEB_STORAGE isn't set, s3 storage is used if SEB_S3_BUCKET is set, and
+// disk storage if SEB_STORAGE_DIR is set. The defaults of the cache and
+// batcher depend on the backing storage: local storage (disk and memory)
+// defaults to a 128 MB memory cache and 10ms batches, since writes are
+// cheap, while object storage defaults to a 1 GB disk cache and 1s batches,
+// since each record batch is a PUT request.
+func ServerConfigFromEnv() (ServerConfig, error) {
+	config := ServerConfig{
+		Storage:      os.Getenv("SEB_STORAGE"),
+		StorageDir:   os.Getenv("SEB_STORAGE_DIR"),
+		S3Bucket:     os.Getenv("SEB_S3_BUCKET"),
+		S3Endpoint:   os.Getenv("SEB_S3_ENDPOINT"),
+		S3StagingDir: envString("SEB_S3_STAGING_DIR", path.Join(os.TempDir(), "seb-staging")),
+		CacheDir:     envString("SEB_CACHE_DIR", path.Join(os.TempDir(), "seb-cache")),
+		APIKey:       os.Getenv("SEB_API_KEY"),
+		LogLevel:     envString("SEB_LOG_LEVEL", logger.LevelInfo.String()),
+	}
+
+	if config.Storage == "" {
+		switch {
+		case config.S3Bucket != "":
+			config.Storage = "s3"
+		case config.StorageDir != "":
+			config.Storage = "disk"
+		default:
+			return ServerConfig{}, fmt.Errorf("one of SEB_STORAGE, SEB_S3_BUCKET and SEB_STORAGE_DIR must be set")
+		}
+	}
+	if config.APIKey == "" {
+		return ServerConfig{}, fmt.Errorf("SEB_API_KEY must be set")
+	}
+
+	defaultCacheStorage, defaultCacheMaxBytes, defaultBlockTime := "disk", int64(1*sizey.GB), time.Second
+	if config.Storage == "disk" || config.Storage == "memory" {
+		defaultCacheStorage, defaultCacheMaxBytes, defaultBlockTime = "memory", 128*sizey.MB, 10*time.Millisecond
+	}
+	config.CacheStorage = envString("SEB_CACHE_STORAGE", defaultCacheStorage)
+
+	var err error
+	config.CacheMaxBytes, err = envInt("SEB_CACHE_SIZE", defaultCacheMaxBytes)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+
+	config.BatchBlockTime, err = envDuration("SEB_BATCH_WAIT_TIME", defaultBlockTime)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+
+	config.BatchSoftMaxBytes, err = envInt("SEB_BATCH_BYTES_SOFT_MAX", 10*sizey.MB)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+
+	config.BatchHardMaxBytes, err = envInt("SEB_BATCH_BYTES_HARD_MAX", 30*sizey.MB)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+
+	config.BatchMaxRecords, err = envInt("SEB_BATCH_RECORDS_HARD_MAX", 32*1024)
+	if err != nil {
+		return ServerConfig{}, err
+	}
+
+	return config, nil
+}
+
+// Server is a broker assembled from its backing storage, cache and batcher,
+// served over HTTP. It removes the need to wire these by hand when embedding
+// a broker, e.g. in tests or single-binary deployments.
+type Server struct {
+	log     logger.Logger
+	config  ServerConfig
+	broker  *sebbroker.Broker
+	cache   *sebcache.Cache
+	handler http.Handler
+}
+
+// NewServerFromEnv returns a Server configured by the environment variables
+// described by ServerConfigFromEnv.
+func NewServerFromEnv(ctx context.Context) (*Server, error) {
+	config, err := ServerConfigFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("reading server config from environment: %w", err)
+	}
+
+	return NewServer(ctx, config)
+}
+
+// NewServer returns a Server configured by config. The background work of the
+// server, e.g. evicting the cache, is done by Run.
+func NewServer(ctx context.Context, config ServerConfig) (*Server, error) {
+	level, err := logger.ParseLevel(config.LogLevel)
+	if err != nil {
+		return nil, fmt.Errorf("parsing log level: %w", err)
+	}
+	log, logLevel := logger.New(ctx, logger.WithLevel(level))
+
+	cacheStorage, err := sebcache.NewStorageByName(ctx, log.Name("cache storage"), config.CacheStorage, sebcache.StorageConfig{
+		Dir: config.CacheDir,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating cache storage: %w", err)
+	}
+
+	cache, err := sebcache.New(log.Name("cache"), cacheStorage)
+	if err != nil {
+		return nil, fmt.Errorf("creating cache: %w", err)
+	}
+
+	topicStorage, err := sebtopic.NewStorageByName(ctx, log.Name("storage"), config.Storage, sebtopic.StorageConfig{
+		Dir:        config.StorageDir,
+		Bucket:     config.S3Bucket,
+		Endpoint:   config.S3Endpoint,
+		StagingDir: config.S3StagingDir,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating storage: %w", err)
+	}
+
+	broker := sebbroker.New(log.Name("broker"), sebbroker.NewStorageTopicFactory(topicStorage, cache),
+		sebbroker.WithBatcherFactory(sebbroker.NewBlockingBatcherFactory(config.BatchBlockTime, config.BatchSoftMaxBytes)),
+	)
+
+	batchPool := syncy.NewPool(func() *sebrecords.Batch {
+		batch := sebrecords.NewBatch(make([]uint32, 0, config.BatchMaxRecords), make([]byte, 0, config.BatchHardMaxBytes))
+		return &batch
+	})
+
+	monitoring := httphandlers.Monitoring{}
+	if s3Storage, ok := topicStorage.(*sebtopic.S3Storage); ok {
+		monitoring.S3Retry = s3Storage
+		monitoring.S3Uploads = s3Storage
+	}
+
+	mux := http.NewServeMux()
+	httphandlers.RegisterRoutes(log.Name("http"), mux, batchPool, broker, logLevel, cache, nil, monitoring, httphandlers.NewAPIKeyAuthenticator(config.APIKey))
+
+	log.Infof("using %s storage and %s cache", config.Storage, config.CacheStorage)
+
+	return &Server{
+		log:     log,
+		config:  config,
+		broker:  broker,
+		cache:   cache,
+		handler: mux,
+	}, nil
+}
+
+// Handler returns the HTTP handler of the server's API, e.g. for use with
+// http.Server or httptest.NewServer.
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// Run does the background work of the server, evicting the cache and deleting
+// expired record batches, until ctx expires or an error occurs.
+func (s *Server) Run(ctx context.Context) error {
+	loopCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, 2)
+	go func() {
+		errs <- sebcache.EvictionLoop(loopCtx, s.log.Name("cache eviction"), s.cache, s.config.CacheMaxBytes, 0, time.Minute)
+	}()
+	go func() {
+		errs <- sebbroker.RetentionLoop(loopCtx, s.log.Name("retention"), s.broker, 5*time.Minute)
+	}()
+
+	err := <-errs
+	cancel()
+	<-errs
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+func envString(name string, defaultValue string) string {
+	if v, ok := os.LookupEnv(name); ok {
+		return v
+	}
+	return defaultValue
+}
+
+func envInt[T int | int64](name string, defaultValue T) (T, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return defaultValue, nil
+	}
+
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing %s: %w", name, err)
+	}
+	return T(i), nil
+}
+
+func envDuration(name string, defaultValue time.Duration) (time.Duration, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return defaultValue, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("parsing %s: %w", name, err)
+	}
+	return d, nil
+}
@@ -0,0 +1,128 @@
+package seb_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/micvbang/go-helpy/sizey"
+	seb "github.com/micvbang/simple-event-broker"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/stretchr/testify/require"
+)
+
+// TestServerConfigFromEnv verifies that ServerConfigFromEnv() selects the
+// backing storage from the environment, that the defaults of the cache and
+// batcher depend on it, and that invalid environments are rejected.
+func TestServerConfigFromEnv(t *testing.T) {
+	tests := map[string]struct {
+		env      map[string]string
+		expected seb.ServerConfig
+		err      bool
+	}{
+		"disk preset": {
+			env: map[string]string{"SEB_STORAGE_DIR": "/data", "SEB_API_KEY": "key"},
+			expected: seb.ServerConfig{
+				Storage:        "disk",
+				StorageDir:     "/data",
+				CacheStorage:   "memory",
+				CacheMaxBytes:  128 * sizey.MB,
+				BatchBlockTime: 10 * time.Millisecond,
+			},
+		},
+		"s3 preset": {
+			env: map[string]string{"SEB_S3_BUCKET": "bucket", "SEB_API_KEY": "key"},
+			expected: seb.ServerConfig{
+				Storage:        "s3",
+				S3Bucket:       "bucket",
+				CacheStorage:   "disk",
+				CacheMaxBytes:  1 * sizey.GB,
+				BatchBlockTime: time.Second,
+			},
+		},
+		"overrides": {
+			env: map[string]string{"SEB_STORAGE": "memory", "SEB_API_KEY": "key", "SEB_CACHE_STORAGE": "disk", "SEB_CACHE_SIZE": "1024", "SEB_BATCH_WAIT_TIME": "5ms"},
+			expected: seb.ServerConfig{
+				Storage:        "memory",
+				CacheStorage:   "disk",
+				CacheMaxBytes:  1024,
+				BatchBlockTime: 5 * time.Millisecond,
+			},
+		},
+		"no storage":         {env: map[string]string{"SEB_API_KEY": "key"}, err: true},
+		"no api key":         {env: map[string]string{"SEB_STORAGE_DIR": "/data"}, err: true},
+		"invalid cache size": {env: map[string]string{"SEB_STORAGE_DIR": "/data", "SEB_API_KEY": "key", "SEB_CACHE_SIZE": "1GB"}, err: true},
+		"invalid wait time":  {env: map[string]string{"SEB_STORAGE_DIR": "/data", "SEB_API_KEY": "key", "SEB_BATCH_WAIT_TIME": "soon"}, err: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			for _, key := range []string{"SEB_STORAGE", "SEB_STORAGE_DIR", "SEB_S3_BUCKET", "SEB_API_KEY", "SEB_CACHE_STORAGE", "SEB_CACHE_SIZE", "SEB_BATCH_WAIT_TIME"} {
+				// NOTE: t.Setenv restores the environment after the test.
+				t.Setenv(key, test.env[key])
+				if _, ok := test.env[key]; !ok {
+					os.Unsetenv(key)
+				}
+			}
+
+			// Act
+			config, err := seb.ServerConfigFromEnv()
+
+			// Assert
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected.Storage, config.Storage)
+			require.Equal(t, test.expected.StorageDir, config.StorageDir)
+			require.Equal(t, test.expected.S3Bucket, config.S3Bucket)
+			require.Equal(t, test.expected.CacheStorage, config.CacheStorage)
+			require.Equal(t, test.expected.CacheMaxBytes, config.CacheMaxBytes)
+			require.Equal(t, test.expected.BatchBlockTime, config.BatchBlockTime)
+			require.Equal(t, "key", config.APIKey)
+		})
+	}
+}
+
+// TestNewServerFromEnv verifies that the Server returned by NewServerFromEnv()
+// serves records added using a RecordClient, stored in the disk storage given
+// by the environment.
+func TestNewServerFromEnv(t *testing.T) {
+	t.Setenv("SEB_STORAGE_DIR", t.TempDir())
+	t.Setenv("SEB_API_KEY", "api-key")
+	t.Setenv("SEB_BATCH_WAIT_TIME", "1ms")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Act
+	server, err := seb.NewServerFromEnv(ctx)
+
+	// Assert
+	require.NoError(t, err)
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- server.Run(ctx)
+	}()
+
+	httpServer := httptest.NewServer(server.Handler())
+	defer httpServer.Close()
+
+	client, err := seb.NewRecordClient(httpServer.URL, "api-key")
+	require.NoError(t, err)
+
+	expected := tester.MakeRandomRecordBatch(5)
+	err = client.AddRecords("topic", expected.Sizes, expected.Data)
+	require.NoError(t, err)
+
+	got, err := client.GetRecords("topic", 0, seb.GetRecordsInput{MaxRecords: 5})
+	require.NoError(t, err)
+	require.Equal(t, expected.IndividualRecords(), got)
+
+	cancel()
+	require.NoError(t, <-runErr)
+}
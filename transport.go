@@ -0,0 +1,191 @@
+package seb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/retry"
+	"github.com/micvbang/simple-event-broker/seberr"
+)
+
+type ClientRetryOpts struct {
+	// MaxAttempts is the maximum number of times an idempotent request, i.e.
+	// a GET, HEAD, PUT or DELETE request, is attempted before its error is
+	// returned. Other requests are never retried, since the broker may have
+	// handled them even if they failed. Requests are not retried if it's 1
+	// or less.
+	MaxAttempts int
+
+	// BaseDelay is the delay before the first retry. It's doubled for each
+	// following retry, up to MaxDelay. The actual delay is chosen at random
+	// between 0 and the computed delay, such that retries of concurrent
+	// requests are spread out.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// BreakerFailures is the number of consecutive requests that failed to
+	// reach the broker after which the circuit breaker trips. While it's
+	// tripped, requests fail right away with seberr.ErrBrokerUnavailable,
+	// until BreakerCooldown has passed and a single request is let through
+	// to probe whether the broker is available again. Disabled if 0.
+	BreakerFailures int
+	BreakerCooldown time.Duration
+}
+
+// WithConnectionPool sets the number of idle connections to the broker that
+// are kept for reuse, the maximum number of connections to the broker, and
+// the time after which idle connections are closed. See RecordClientOpts.
+func WithConnectionPool(maxIdleConnsPerHost int, maxConnsPerHost int, idleConnTimeout time.Duration) func(*RecordClientOpts) {
+	return func(o *RecordClientOpts) {
+		o.MaxIdleConnsPerHost = maxIdleConnsPerHost
+		o.MaxConnsPerHost = maxConnsPerHost
+		o.IdleConnTimeout = idleConnTimeout
+	}
+}
+
+// WithRequestTimeout sets the time limit of each attempt of a request.
+func WithRequestTimeout(requestTimeout time.Duration) func(*RecordClientOpts) {
+	return func(o *RecordClientOpts) {
+		o.RequestTimeout = requestTimeout
+	}
+}
+
+// WithClientRetry sets how requests are retried and when the circuit breaker
+// trips. See ClientRetryOpts.
+func WithClientRetry(retry ClientRetryOpts) func(*RecordClientOpts) {
+	return func(o *RecordClientOpts) {
+		o.Retry = retry
+	}
+}
+
+// send sends req using the underlying http.Client, retrying it with
+// exponential backoff and jitter if it's idempotent and fails because the
+// broker is unavailable.
+func (c *RecordClient) send(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	maxAttempts := c.retrier.MaxAttempts()
+	if !idempotent(req.Method) || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		maxAttempts = 1
+	}
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			err := retry.Sleep(ctx, c.retrier.Backoff(attempt))
+			if err != nil {
+				return nil, err
+			}
+
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, fmt.Errorf("rewinding request body: %w", err)
+				}
+				req = req.Clone(ctx)
+				req.Body = body
+			}
+		}
+
+		err := c.retrier.Allow()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", seberr.ErrBrokerUnavailable, err)
+		}
+
+		res, err := c.sendOnce(req)
+		switch {
+		case ctx.Err() != nil:
+			c.retrier.Abandoned()
+			return res, err
+		case !brokerUnavailable(res, err):
+			c.retrier.Succeeded()
+			return res, err
+		}
+
+		c.retrier.Failed(err)
+		if attempt+1 >= maxAttempts {
+			return res, err
+		}
+		c.retrier.Retried()
+
+		if res != nil {
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+	}
+}
+
+// sendOnce sends req, limiting the time spent waiting for its response to the
+// client's request timeout plus the wait timeout of req, if any.
+func (c *RecordClient) sendOnce(req *http.Request) (*http.Response, error) {
+	if c.requestTimeout <= 0 {
+		return c.client.Do(req)
+	}
+
+	waitTimeout, _ := req.Context().Value(waitTimeoutKey{}).(time.Duration)
+	timeout := c.requestTimeout + waitTimeout
+
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(timeout, cancel)
+	res, err := c.client.Do(req.WithContext(ctx))
+	timedOut := !timer.Stop()
+	if err != nil {
+		cancel()
+		if timedOut && req.Context().Err() == nil {
+			return nil, fmt.Errorf("no response within %s: %w", timeout, context.DeadlineExceeded)
+		}
+		return nil, err
+	}
+
+	// NOTE: the response body is read using ctx; it's released once the body
+	// is closed. Reading the body isn't limited by the timeout, such that
+	// streaming responses, e.g. of WatchTopics, aren't cut short.
+	res.Body = &cancelOnClose{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+type waitTimeoutKey struct{}
+
+// withWaitTimeout returns a copy of req which is allowed waitTimeout in
+// addition to the client's request timeout, e.g. because the broker waits for
+// records for up to waitTimeout before responding.
+func withWaitTimeout(req *http.Request, waitTimeout time.Duration) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), waitTimeoutKey{}, waitTimeout))
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+// idempotent returns whether requests using method can safely be sent more
+// than once.
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// brokerUnavailable returns whether the response res or error err indicates
+// that the request didn't reach the broker, or that the broker is temporarily
+// unable to handle it.
+func brokerUnavailable(res *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	switch res.StatusCode {
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
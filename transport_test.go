@@ -0,0 +1,213 @@
+package seb_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	seb "github.com/micvbang/simple-event-broker"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/micvbang/simple-event-broker/seberr"
+	"github.com/stretchr/testify/require"
+)
+
+// failingProxy forwards requests to the test server srv, responding with 502
+// Bad Gateway instead while failures is positive, decrementing it.
+type failingProxy struct {
+	*httptest.Server
+	failures atomic.Int64
+	requests atomic.Int64
+}
+
+func newFailingProxy(t *testing.T, srv *tester.HTTPTestServer) *failingProxy {
+	target, err := url.Parse(srv.Server.URL)
+	require.NoError(t, err)
+	proxy := httputil.NewSingleHostReverseProxy(target)
+
+	p := &failingProxy{}
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.requests.Add(1)
+		if p.failures.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	t.Cleanup(p.Close)
+
+	return p
+}
+
+// TestRecordClientRetry verifies that idempotent requests that fail because
+// the broker is unavailable are retried up to MaxAttempts times, and that
+// other requests are not.
+func TestRecordClientRetry(t *testing.T) {
+	const topicName = "topic"
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	batch := tester.MakeRandomRecordBatch(3)
+	setupClient, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+	err = setupClient.AddRecords(topicName, batch.Sizes, batch.Data)
+	require.NoError(t, err)
+
+	getTopic := func(client *seb.RecordClient) error {
+		_, err := client.GetTopic(topicName)
+		return err
+	}
+	addRecords := func(client *seb.RecordClient) error {
+		return client.AddRecords(topicName, batch.Sizes, batch.Data)
+	}
+	getMissingRecord := func(client *seb.RecordClient) error {
+		_, err := client.GetRecord(topicName, 100)
+		return err
+	}
+
+	tests := map[string]struct {
+		request          func(*seb.RecordClient) error
+		failures         int64
+		expectedRequests int64
+		expectedErr      bool
+	}{
+		"recovers": {
+			request:          getTopic,
+			failures:         2,
+			expectedRequests: 3,
+		},
+		"gives up": {
+			request:          getTopic,
+			failures:         3,
+			expectedRequests: 3,
+			expectedErr:      true,
+		},
+		"not idempotent": {
+			request:          addRecords,
+			failures:         1,
+			expectedRequests: 1,
+			expectedErr:      true,
+		},
+		"out of bounds": {
+			request:          getMissingRecord,
+			expectedRequests: 1,
+			expectedErr:      true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			proxy := newFailingProxy(t, srv)
+			proxy.failures.Store(test.failures)
+
+			client, err := seb.NewRecordClient(proxy.URL, tester.DefaultAPIKey, seb.WithClientRetry(seb.ClientRetryOpts{
+				MaxAttempts: 3,
+				BaseDelay:   time.Millisecond,
+				MaxDelay:    time.Millisecond,
+			}))
+			require.NoError(t, err)
+
+			// Act
+			err = test.request(client)
+
+			// Assert
+			require.Equal(t, test.expectedErr, err != nil)
+			require.Equal(t, test.expectedRequests, proxy.requests.Load())
+		})
+	}
+}
+
+// TestRecordClientCircuitBreaker verifies that the circuit breaker trips after
+// BreakerFailures consecutive failures, that requests then fail with
+// seberr.ErrBrokerUnavailable without being sent, and that it closes once a
+// request succeeds after BreakerCooldown.
+func TestRecordClientCircuitBreaker(t *testing.T) {
+	const cooldown = 50 * time.Millisecond
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	proxy := newFailingProxy(t, srv)
+	proxy.failures.Store(2)
+
+	client, err := seb.NewRecordClient(proxy.URL, tester.DefaultAPIKey, seb.WithClientRetry(seb.ClientRetryOpts{
+		MaxAttempts:     1,
+		BreakerFailures: 2,
+		BreakerCooldown: cooldown,
+	}))
+	require.NoError(t, err)
+
+	for range 2 {
+		_, err = client.ListTopics()
+		require.Error(t, err)
+		require.NotErrorIs(t, err, seberr.ErrBrokerUnavailable)
+	}
+
+	// Act
+	_, err = client.ListTopics()
+
+	// Assert
+	require.ErrorIs(t, err, seberr.ErrBrokerUnavailable)
+	require.Equal(t, int64(2), proxy.requests.Load())
+
+	time.Sleep(cooldown)
+
+	// Act
+	_, err = client.ListTopics()
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, int64(3), proxy.requests.Load())
+
+	_, err = client.ListTopics()
+	require.NoError(t, err)
+}
+
+// TestRecordClientRequestTimeout verifies that requests fail once
+// RequestTimeout has passed without a response, and that GetRecords requests
+// are given their wait timeout in addition.
+func TestRecordClientRequestTimeout(t *testing.T) {
+	const topicName = "topic"
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer slow.Close()
+
+	retry := seb.WithClientRetry(seb.ClientRetryOpts{MaxAttempts: 1})
+
+	t.Run("no response", func(t *testing.T) {
+		client, err := seb.NewRecordClient(slow.URL, tester.DefaultAPIKey, seb.WithRequestTimeout(20*time.Millisecond), retry)
+		require.NoError(t, err)
+
+		// Act
+		_, err = client.ListTopics()
+
+		// Assert
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("long poll", func(t *testing.T) {
+		client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey, seb.WithRequestTimeout(50*time.Millisecond), retry)
+		require.NoError(t, err)
+
+		batch := tester.MakeRandomRecordBatch(1)
+		err = client.AddRecords(topicName, batch.Sizes, batch.Data)
+		require.NoError(t, err)
+
+		// Act
+		records, err := client.GetRecords(topicName, 1, seb.GetRecordsInput{Timeout: 150 * time.Millisecond})
+
+		// Assert
+		require.NoError(t, err)
+		require.Empty(t, records)
+	})
+}
@@ -0,0 +1,108 @@
+package seb
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TopicEvent describes a change to a topic, delivered by WatchTopics.
+type TopicEvent struct {
+	// Type is one of "created", "deleted" and "advanced".
+	Type       string `json:"-"`
+	TopicName  string `json:"topic_name"`
+	NextOffset uint64 `json:"next_offset"`
+}
+
+type WatchTopicsInput struct {
+	// TopicNames are the names of the topics to watch. All topics are watched
+	// if empty.
+	TopicNames []string
+
+	// Internal includes events of internal topics. Requires admin access.
+	Internal bool
+}
+
+// WatchTopics returns a channel on which events are delivered when topics are
+// created or deleted, or when their next offsets advance, such that callers
+// don't have to poll GetTopic to notice changes.
+//
+// The channel is closed when ctx expires or the stream of events ends, e.g.
+// because the broker is shutting down or because the receiver fell so far
+// behind that events would be lost. Callers should then read the state of the
+// topics they're interested in before watching again.
+func (c *RecordClient) WatchTopics(ctx context.Context, input WatchTopicsInput) (<-chan TopicEvent, error) {
+	req, err := c.request("GET", "/topics/watch", nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "text/event-stream")
+
+	query := req.URL.Query()
+	for _, topicName := range input.TopicNames {
+		query.Add("topic-name", topicName)
+	}
+	if input.Internal {
+		query.Set("internal", "true")
+	}
+	req.URL.RawQuery = query.Encode()
+
+	res, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("sending request: %w", err)
+	}
+
+	err = c.statusCode(res)
+	if err == nil && res.StatusCode != http.StatusOK {
+		err = fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+	if err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+
+	events := make(chan TopicEvent)
+	go func() {
+		defer close(events)
+		defer res.Body.Close()
+
+		scanner := bufio.NewScanner(res.Body)
+		eventType, data := "", ""
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				// a blank line ends an event
+				if eventType == "" || data == "" {
+					continue
+				}
+
+				event := TopicEvent{}
+				err := json.Unmarshal([]byte(data), &event)
+				if err != nil {
+					return
+				}
+				event.Type = eventType
+				eventType, data = "", ""
+
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+
+			case strings.HasPrefix(line, "event:"):
+				eventType = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+
+			case strings.HasPrefix(line, "data:"):
+				data = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			}
+		}
+	}()
+
+	return events, nil
+}
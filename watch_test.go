@@ -0,0 +1,62 @@
+package seb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	seb "github.com/micvbang/simple-event-broker"
+	"github.com/micvbang/simple-event-broker/internal/infrastructure/tester"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRecordClientWatchTopics verifies that WatchTopics() delivers events
+// when topics are created, have records added to them and are deleted.
+func TestRecordClientWatchTopics(t *testing.T) {
+	const topicName = "topic"
+
+	srv := tester.HTTPServer(t)
+	defer srv.Close()
+
+	client, err := seb.NewRecordClient(srv.Server.URL, tester.DefaultAPIKey)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := client.WatchTopics(ctx, seb.WatchTopicsInput{TopicNames: []string{topicName}})
+	require.NoError(t, err)
+
+	// Act
+	err = client.CreateTopic(topicName)
+	require.NoError(t, err)
+	err = client.AddRecords("other", []uint32{1}, []byte("a"))
+	require.NoError(t, err)
+	err = client.AddRecords(topicName, []uint32{1, 2}, []byte("abc"))
+	require.NoError(t, err)
+	err = client.DeleteTopic(topicName)
+	require.NoError(t, err)
+
+	// Assert
+	expected := []seb.TopicEvent{
+		{Type: "created", TopicName: topicName},
+		{Type: "advanced", TopicName: topicName, NextOffset: 2},
+		{Type: "deleted", TopicName: topicName},
+	}
+	for _, expectedEvent := range expected {
+		select {
+		case event, ok := <-events:
+			require.True(t, ok)
+			require.Equal(t, expectedEvent, event)
+		case <-time.After(time.Second):
+			require.Fail(t, "timed out waiting for event", "expected %v", expectedEvent)
+		}
+	}
+
+	// Act
+	cancel()
+
+	// Assert
+	for range events {
+	}
+}